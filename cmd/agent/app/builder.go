@@ -106,6 +106,10 @@ type ServerConfiguration struct {
 // HTTPServerConfiguration holds config for a server providing sampling strategies and baggage restrictions to clients
 type HTTPServerConfiguration struct {
 	HostPort string `yaml:"hostPort" validate:"nonzero"`
+	// TenantHeader is the TChannel application header carrying Tenant in the requests to the collector
+	TenantHeader string `yaml:"tenantHeader"`
+	// Tenant is the tenant the collector serves the sampling strategies of, none if empty
+	Tenant string `yaml:"tenant"`
 }
 
 // WithReporter adds auxiliary reporters.
@@ -198,7 +202,11 @@ func (b *Builder) GetProcessors(rep reporter.Reporter, mFactory metrics.Factory)
 
 // GetHTTPServer creates an HTTP server that provides sampling strategies and baggage restrictions to client libraries.
 func (c HTTPServerConfiguration) GetHTTPServer(svc string, channel *tchannel.Channel, mFactory metrics.Factory) *http.Server {
-	mgr := httpserver.NewCollectorProxy(svc, channel, mFactory)
+	var headers map[string]string
+	if c.TenantHeader != "" && c.Tenant != "" {
+		headers = map[string]string{c.TenantHeader: c.Tenant}
+	}
+	mgr := httpserver.NewCollectorProxy(svc, channel, mFactory, headers)
 	if c.HostPort == "" {
 		c.HostPort = defaultHTTPServerHostPort
 	}
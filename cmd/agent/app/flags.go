@@ -35,6 +35,8 @@ const (
 	suffixServerHostPort      = "server-host-port"
 	collectorHostPort         = "collector.host-port"
 	httpServerHostPort        = "http-server.host-port"
+	collectorTenancyHeader    = "collector.tenancy.header"
+	collectorTenancyTenant    = "collector.tenancy.tenant"
 	discoveryMinPeers         = "discovery.min-peers"
 )
 
@@ -65,6 +67,14 @@ func AddFlags(flags *flag.FlagSet) {
 		httpServerHostPort,
 		defaultHTTPServerHostPort,
 		"host:port of the http server (e.g. for /sampling point and /baggage endpoint)")
+	flags.String(
+		collectorTenancyHeader,
+		"",
+		"the TChannel header, in lower case, carrying the tenant of the agent to the collectors, which serve the sampling strategies of the tenant")
+	flags.String(
+		collectorTenancyTenant,
+		"",
+		"the tenant of the agent, sent to the collectors in the collector.tenancy.header header")
 	flags.Int(
 		discoveryMinPeers,
 		defaultMinPeers,
@@ -89,5 +99,7 @@ func (b *Builder) InitFromViper(v *viper.Viper) {
 		b.CollectorHostPorts = strings.Split(v.GetString(collectorHostPort), ",")
 	}
 	b.HTTPServer.HostPort = v.GetString(httpServerHostPort)
+	b.HTTPServer.TenantHeader = v.GetString(collectorTenancyHeader)
+	b.HTTPServer.Tenant = v.GetString(collectorTenancyTenant)
 	b.DiscoveryMinPeers = v.GetInt(discoveryMinPeers)
 }
@@ -43,6 +43,8 @@ func TestBingFlags(t *testing.T) {
 		"--collector.host-port=1.2.3.4:555,1.2.3.4:666",
 		"--discovery.min-peers=42",
 		"--http-server.host-port=:8080",
+		"--collector.tenancy.header=tenant",
+		"--collector.tenancy.tenant=team-a",
 		"--processor.jaeger-binary.server-host-port=:1111",
 		"--processor.jaeger-binary.server-max-packet-size=4242",
 		"--processor.jaeger-binary.server-queue-size=42",
@@ -55,6 +57,8 @@ func TestBingFlags(t *testing.T) {
 	assert.Equal(t, []string{"1.2.3.4:555", "1.2.3.4:666"}, b.CollectorHostPorts)
 	assert.Equal(t, 42, b.DiscoveryMinPeers)
 	assert.Equal(t, ":8080", b.HTTPServer.HostPort)
+	assert.Equal(t, "tenant", b.HTTPServer.TenantHeader)
+	assert.Equal(t, "team-a", b.HTTPServer.Tenant)
 	assert.Equal(t, ":1111", b.Processors[2].Server.HostPort)
 	assert.Equal(t, 4242, b.Processors[2].Server.MaxPacketSize)
 	assert.Equal(t, 42, b.Processors[2].Server.QueueSize)
@@ -47,21 +47,25 @@ type collectorProxy struct {
 		// Number of failed baggage restriction responses from collector
 		BaggageFailures metrics.Counter `metric:"collector-proxy" tags:"result=err,endpoint=baggage"`
 	}
+	// headers are the application headers of the requests to the collector, e.g. the tenant of the agent
+	headers map[string]string
 }
 
-// NewCollectorProxy implements Manager by proxying the requests to collector.
-func NewCollectorProxy(svc string, channel *tchannel.Channel, mFactory metrics.Factory) ClientConfigManager {
+// NewCollectorProxy implements Manager by proxying the requests to collector, sent with the given
+// application headers, which can be nil.
+func NewCollectorProxy(svc string, channel *tchannel.Channel, mFactory metrics.Factory, headers map[string]string) ClientConfigManager {
 	thriftClient := thrift.NewClient(channel, svc, nil)
 	res := &collectorProxy{
 		samplingClient: sampling.NewTChanSamplingManagerClient(thriftClient),
 		baggageClient:  baggage.NewTChanBaggageRestrictionManagerClient(thriftClient),
+		headers:        headers,
 	}
 	metrics.Init(&res.metrics, mFactory, nil)
 	return res
 }
 
 func (c *collectorProxy) GetSamplingStrategy(serviceName string) (*sampling.SamplingStrategyResponse, error) {
-	ctx, cancel := tchannel.NewContextBuilder(time.Second).DisableTracing().Build()
+	ctx, cancel := tchannel.NewContextBuilder(time.Second).DisableTracing().SetHeaders(c.headers).Build()
 	defer cancel()
 
 	// TODO: enable tracer on the tchannel and get metrics for free (sampler can be off)
@@ -75,7 +79,7 @@ func (c *collectorProxy) GetSamplingStrategy(serviceName string) (*sampling.Samp
 }
 
 func (c *collectorProxy) GetBaggageRestrictions(serviceName string) ([]*baggage.BaggageRestriction, error) {
-	ctx, cancel := tchannel.NewContextBuilder(time.Second).DisableTracing().Build()
+	ctx, cancel := tchannel.NewContextBuilder(time.Second).DisableTracing().SetHeaders(c.headers).Build()
 	defer cancel()
 
 	resp, err := c.baggageClient.GetBaggageRestrictions(ctx, serviceName)
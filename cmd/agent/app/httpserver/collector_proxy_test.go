@@ -49,7 +49,7 @@ func TestCollectorProxy(t *testing.T) {
 		{BaggageKey: "luggage", MaxValueLength: 10},
 	})
 
-	mgr := NewCollectorProxy("jaeger-collector", collector.Channel, metricsFactory)
+	mgr := NewCollectorProxy("jaeger-collector", collector.Channel, metricsFactory, nil)
 
 	sResp, err := mgr.GetSamplingStrategy("service1")
 	require.NoError(t, err)
@@ -87,6 +87,34 @@ func TestTCollectorProxyClientErrorPropagates(t *testing.T) {
 	}...)
 }
 
+func TestCollectorProxyHeaders(t *testing.T) {
+	client := &headersClient{}
+	proxy := &collectorProxy{samplingClient: client, baggageClient: client, headers: map[string]string{"tenant": "team-a"}}
+	metrics.Init(&proxy.metrics, metrics.NullFactory, nil)
+	_, err := proxy.GetSamplingStrategy("test")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"tenant": "team-a"}, client.headers)
+	client.headers = nil
+	_, err = proxy.GetBaggageRestrictions("test")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"tenant": "team-a"}, client.headers)
+}
+
+// headersClient records the application headers of the last request
+type headersClient struct {
+	headers map[string]string
+}
+
+func (c *headersClient) GetSamplingStrategy(ctx thrift.Context, serviceName string) (*sampling.SamplingStrategyResponse, error) {
+	c.headers = ctx.Headers()
+	return &sampling.SamplingStrategyResponse{}, nil
+}
+
+func (c *headersClient) GetBaggageRestrictions(ctx thrift.Context, serviceName string) ([]*baggage.BaggageRestriction, error) {
+	c.headers = ctx.Headers()
+	return nil, nil
+}
+
 type failingClient struct{}
 
 func (c *failingClient) GetSamplingStrategy(ctx thrift.Context, serviceName string) (*sampling.SamplingStrategyResponse, error) {
@@ -21,12 +21,36 @@
 package builder
 
 import (
+	"time"
+
 	"github.com/uber/jaeger-lib/metrics"
 	"go.uber.org/zap"
 
+	"github.com/uber/jaeger/cmd/collector/app"
+	"github.com/uber/jaeger/cmd/collector/app/sampling"
+	"github.com/uber/jaeger/cmd/collector/app/sanitizer"
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/model/codec"
+	zipkinConv "github.com/uber/jaeger/model/converter/thrift/zipkin"
+
+	badgercfg "github.com/uber/jaeger/pkg/badger/config"
 	cascfg "github.com/uber/jaeger/pkg/cassandra/config"
 	escfg "github.com/uber/jaeger/pkg/es/config"
+	kafkacfg "github.com/uber/jaeger/pkg/kafka/config"
+	jmetrics "github.com/uber/jaeger/pkg/metrics"
+	natscfg "github.com/uber/jaeger/pkg/nats/config"
+	pgcfg "github.com/uber/jaeger/pkg/postgres/config"
+	tlscfg "github.com/uber/jaeger/pkg/tls/config"
+	badgerSpanstore "github.com/uber/jaeger/plugin/storage/badger/spanstore"
+	"github.com/uber/jaeger/storage/spanstore"
+	"github.com/uber/jaeger/storage/spanstore/async"
+	"github.com/uber/jaeger/storage/spanstore/batch"
+	"github.com/uber/jaeger/storage/spanstore/breaker"
+	"github.com/uber/jaeger/storage/spanstore/compaction"
+	"github.com/uber/jaeger/storage/spanstore/deadline"
 	"github.com/uber/jaeger/storage/spanstore/memory"
+	"github.com/uber/jaeger/storage/spanstore/tailsampling"
+	"github.com/uber/jaeger/storage/spanstore/wal"
 )
 
 // BasicOptions is a set of basic building blocks for most Jaeger executables
@@ -39,8 +63,133 @@ type BasicOptions struct {
 	Cassandra *cascfg.Configuration
 	// MemoryStore is the memory store (as reader and writer) that will be used if required
 	MemoryStore *memory.Store
+	// CustomSpanWriter replaces the span storage selected by the flags, e.g. with a third-party backend
+	CustomSpanWriter spanstore.Writer
+	// CustomSpanReader reads the spans written by CustomSpanWriter, for the query service of the same executable
+	CustomSpanReader spanstore.Reader
 	// ElasticSearch is the elasticsearch configuration used
 	ElasticSearch *escfg.Configuration
+	// Kafka is the kafka configuration used to buffer spans before they are written to storage
+	Kafka *kafkacfg.Configuration
+	// Badger is the embedded BadgerDB configuration used for single-node deployments
+	Badger *badgercfg.Configuration
+	// BadgerStore is the Badger store (as reader and writer) opened by the executable, used instead of Badger
+	BadgerStore *badgerSpanstore.Store
+	// Postgres is the PostgreSQL DSN and connection pool configuration
+	Postgres *pgcfg.Configuration
+	// AdaptiveSampling enables the calculation of per-operation sampling probabilities in the collector
+	AdaptiveSampling *sampling.AdaptiveSamplerOptions
+	// StaticSampling serves the sampling strategies of a file to the agents, it cannot be used with AdaptiveSampling
+	StaticSampling *sampling.StaticStrategiesOptions
+	// SpanFilters decide which spans are allowed into storage, all of them must allow a span for it to be saved
+	SpanFilters []func(*model.Span) bool
+	// SpanMutators rewrite spans after they are converted to the domain model, before they are filtered
+	SpanMutators []func(*model.Span)
+	// TagMappings normalize the span and process tag keys and values, before the spans are filtered
+	TagMappings *app.TagMappings
+	// HTTPStatusRules consolidate the HTTP status codes of the spans into a canonical tag, after the tag mappings
+	HTTPStatusRules *app.HTTPStatusRules
+	// OperationNameRules derive the generic operation names of the spans of each service from their tags
+	OperationNameRules *app.OperationNameRules
+	// SamplingRules force the spans with some tags to be kept by the sampling of the collector
+	SamplingRules *app.SamplingRules
+	// CompositeSampling keeps the spans by combining the verdicts of an ordered list of sub-samplers, disabled if nil
+	CompositeSampling *app.CompositeSamplingConfig
+	// SamplingDecisionCache makes the later spans of a trace honor the composite sampling decision of its first span
+	SamplingDecisionCache *app.SamplingDecisionCacheOptions
+	// DropRules reject the spans of infrastructure components, e.g. service mesh sidecars, before they are saved
+	DropRules *app.DropRules
+	// SpanSchema rejects or tags the spans missing the tags required by instrumentation standards, e.g. team or env
+	SpanSchema *app.SpanSchemaOptions
+	// ServiceAliases rename the services of the spans, before the spans are filtered
+	ServiceAliases *app.ServiceAliases
+	// GRPCEnabled enables the gRPC span ingestion handler in the collector
+	GRPCEnabled bool
+	// TLS is the TLS the collector serves its HTTP endpoints with, plain HTTP if nil
+	TLS *tlscfg.Configuration
+	// RateLimits are the spans per second accepted by the collector from each service
+	RateLimits *app.RateLimits
+	// SpanQuotas are the spans accepted by the collector from each service each day, and what happens beyond them
+	SpanQuotas *app.SpanQuotaOptions
+	// FutureSpans drops or clamps the spans starting too far in the future, disabled if nil
+	FutureSpans *app.FutureSpanOptions
+	// SpanIDCollisions tags or reassigns the spans sharing the span ID of another span of their trace, disabled if nil
+	SpanIDCollisions *app.SpanIDCollisionOptions
+	// DeduplicationWindow is the number of recently seen spans the collector drops duplicates of, disabled if 0
+	DeduplicationWindow int
+	// TraceSpanLimit drops the spans of each trace beyond a limit, disabled if nil
+	TraceSpanLimit *app.TraceSpanLimitOptions
+	// SpanMetrics enables the request, error and duration metrics derived from the spans by the collector
+	SpanMetrics bool
+	// SpanSerialization is the format spans are serialized to by the Cassandra and ElasticSearch writers,
+	// NoFormat keeping the native layout of the backend
+	SpanSerialization codec.Format
+	// ProcessCompaction makes the Cassandra and ElasticSearch writers store the process of the spans of a trace once
+	ProcessCompaction *compaction.Options
+	// HealthCheck enables the periodic probing of the span storage by the collector
+	HealthCheck *app.HealthCheckOptions
+	// TagSanitizer drops and truncates span tags before the spans are saved
+	TagSanitizer *sanitizer.TagSanitizerOptions
+	// ZipkinReferenceRules select the Zipkin spans whose parent becomes a FOLLOWS_FROM reference
+	ZipkinReferenceRules zipkinConv.ReferenceRules
+	// OpenCensus enables the OpenCensus span receiver in the collector
+	OpenCensus bool
+	// OTLP enables the receiver of the spans exported with OTLP over HTTP in the collector
+	OTLP bool
+	// DryRun makes the collector accept and process spans without persisting them
+	DryRun bool
+	// AsyncWriter enables the buffering of spans between the collector and the span storage
+	AsyncWriter *async.Options
+	// Routes send the spans with some tags to other span writers than the span storage, which own them
+	Routes []spanstore.Route
+	// TraceBatching enables the grouping of the spans of each trace before they are written to the span storage
+	TraceBatching *batch.Options
+	// TailSampling drops the traces not sampled by the clients unless some of their spans are slow
+	TailSampling *tailsampling.Options
+	// TailSamplingRequireRoot makes the tail sampling drop the traces whose root span was not received
+	TailSamplingRequireRoot bool
+	// CircuitBreaker enables the fast failure of span writes while the span storage is failing or slow
+	CircuitBreaker *breaker.Options
+	// WriteDeadlines give up the span writes taking too long, keyed by the storage type they apply to
+	WriteDeadlines map[string]deadline.Options
+	// WAL enables the write-ahead log recording the spans accepted by the collector until they are saved
+	WAL *wal.Options
+	// NATS enables the consumption of the span batches of a NATS JetStream subscription by the collector
+	NATS *natscfg.Configuration
+	// SamplingSeed is the seed of the trace ID buckets of the probabilistic sampling of the collector, the low bits
+	// of the trace IDs being used as they are if 0
+	SamplingSeed uint64
+	// MaxSpanSize is the estimated size in bytes beyond which spans are rejected by the collector,
+	// app.DefaultMaxSpanSize if 0 and unlimited if negative
+	MaxSpanSize int
+	// BatchSize limits the number of spans of the Jaeger Thrift batches submitted to the collector, unlimited if nil
+	BatchSize *app.BatchSizeOptions
+	// Auth are the credentials required from the clients submitting spans to the collector, not required if nil
+	Auth *app.AuthOptions
+	// Prometheus also reports the metrics of MetricsFactory to a Prometheus registry, served by its handler
+	Prometheus *jmetrics.PrometheusFactory
+	// SamplingDecisions enables the tagging of spans with the sampling decisions of the clients and of TailSampler
+	SamplingDecisions bool
+	// TailSampler makes the sampling decisions recorded once spans reach the collector, none if nil
+	TailSampler app.TailSampler
+	// OperationCardinality collapses the operations of services beyond a maximum number of operation names
+	OperationCardinality *app.OperationCardinalityOptions
+	// CorrelationTag tags the spans with their trace ID in a fixed format, so that logs can be joined on it
+	CorrelationTag *app.CorrelationTagOptions
+	// CollectorTags tag the spans with the metadata of the collector storing them, e.g. its host name
+	CollectorTags *app.CollectorTagOptions
+	// Enrichment tags the spans with the metadata of their service looked up from a provider
+	Enrichment *app.EnrichmentOptions
+	// Backpressure rejects the span batches while the collector queue is beyond a high-water mark
+	Backpressure *app.BackpressureOptions
+	// Admission rejects or sheds the spans while the memory or goroutines of the collector are beyond thresholds
+	Admission *app.AdmissionOptions
+	// DroppedSpans retains a sample of the spans dropped by the collector for diagnostics
+	DroppedSpans *app.DroppedSpanSamplerOptions
+	// WorkerPoolSize caps the workers saving the queued spans to storage in a pool resizable at runtime, if not 0
+	WorkerPoolSize int
+	// Tenancy scopes the storage keys of the spans to their tenant, and rejects the spans without a tenant
+	Tenancy *app.TenancyOptions
 }
 
 // Option is a function that sets some option on StorageBuilder.
@@ -70,13 +219,29 @@ func (BasicOptions) CassandraOption(cassandra *cascfg.Configuration) Option {
 	}
 }
 
-// MemoryStoreOption creates an Option that adds a memory store
-func (BasicOptions) MemoryStoreOption(memoryStore *memory.Store) Option {
+// MemoryStoreOption creates an Option that adds a memory store, configured with the given memory options,
+// e.g. memory.Options.SnapshotPath to keep its traces across restarts
+func (BasicOptions) MemoryStoreOption(memoryStore *memory.Store, opts ...memory.Option) Option {
 	return func(b *BasicOptions) {
+		if len(opts) > 0 {
+			memoryStore.Configure(opts...)
+		}
 		b.MemoryStore = memoryStore
 	}
 }
 
+// CustomStorageOption creates an Option that plugs a third-party span storage into the collector, bypassing
+// the storage types of the flags. The writer must follow the contract of spanstore.Writer; it is probed by
+// the health check if it implements spanstore.Prober, and closed with the collector if it implements io.Closer.
+// The reader is not used by the collector: the executables also serving queries pass it to the query builder
+// as Configuration.CustomSpanReader.
+func (BasicOptions) CustomStorageOption(writer spanstore.Writer, reader spanstore.Reader) Option {
+	return func(b *BasicOptions) {
+		b.CustomSpanWriter = writer
+		b.CustomSpanReader = reader
+	}
+}
+
 // ElasticSearchOption creates an Option that adds ElasticSearch configuration.
 func (BasicOptions) ElasticSearchOption(elastic *escfg.Configuration) Option {
 	return func(b *BasicOptions) {
@@ -84,6 +249,569 @@ func (BasicOptions) ElasticSearchOption(elastic *escfg.Configuration) Option {
 	}
 }
 
+// KafkaOption creates an Option that adds Kafka configuration.
+func (BasicOptions) KafkaOption(kafka *kafkacfg.Configuration) Option {
+	return func(b *BasicOptions) {
+		b.Kafka = kafka
+	}
+}
+
+// BadgerOption creates an Option that adds BadgerDB configuration.
+func (BasicOptions) BadgerOption(badger *badgercfg.Configuration) Option {
+	return func(b *BasicOptions) {
+		b.Badger = badger
+	}
+}
+
+// BadgerStoreOption creates an Option that adds a Badger store opened by the executable, so that its query
+// service can read it too, Badger locking the directory of the store for a single process. The store is
+// not closed by the collector.
+func (BasicOptions) BadgerStoreOption(store *badgerSpanstore.Store) Option {
+	return func(b *BasicOptions) {
+		b.BadgerStore = store
+	}
+}
+
+// PostgresOption creates an Option that adds PostgreSQL configuration.
+func (BasicOptions) PostgresOption(postgres *pgcfg.Configuration) Option {
+	return func(b *BasicOptions) {
+		b.Postgres = postgres
+	}
+}
+
+// AdaptiveSamplingOption creates an Option that enables adaptive sampling with the given target
+// spans per second for each operation, recalculated every calculationInterval.
+func (BasicOptions) AdaptiveSamplingOption(targetSpansPerSecond float64, calculationInterval time.Duration) Option {
+	return func(b *BasicOptions) {
+		b.AdaptiveSampling = &sampling.AdaptiveSamplerOptions{
+			TargetSpansPerSecond: targetSpansPerSecond,
+			CalculationInterval:  calculationInterval,
+		}
+	}
+}
+
+// StaticSamplingOption creates an Option that serves the sampling strategies of the given file to the agents,
+// reloading them when the file changes, checked every reloadInterval or never if 0.
+func (BasicOptions) StaticSamplingOption(file string, reloadInterval time.Duration) Option {
+	return func(b *BasicOptions) {
+		b.StaticSampling = &sampling.StaticStrategiesOptions{
+			File:           file,
+			ReloadInterval: reloadInterval,
+		}
+	}
+}
+
+// SpanFilterOption creates an Option that adds a span filter. It can be used multiple times,
+// in which case the filters are chained in the order they were given.
+func (BasicOptions) SpanFilterOption(spanFilter func(*model.Span) bool) Option {
+	return func(b *BasicOptions) {
+		b.SpanFilters = append(b.SpanFilters, spanFilter)
+	}
+}
+
+// SpanMutatorOption creates an Option that adds a span mutator, called on each span before any span filter.
+// It can be used multiple times, in which case the mutators are called in the order they were given.
+func (BasicOptions) SpanMutatorOption(spanMutator func(*model.Span)) Option {
+	return func(b *BasicOptions) {
+		b.SpanMutators = append(b.SpanMutators, spanMutator)
+	}
+}
+
+// TagMappingOption creates an Option that renames tag keys and rewrites tag values of spans and their
+// processes according to the mappings, before any span filter.
+func (BasicOptions) TagMappingOption(mappings app.TagMappings) Option {
+	return func(b *BasicOptions) {
+		b.TagMappings = &mappings
+	}
+}
+
+// HTTPStatusRuleOption creates an Option that replaces the tags of the HTTP status codes of spans, read from
+// the source keys of the rule of their service, with the integer tag app.HTTPStatusCodeKey, and tags the spans
+// of 5xx responses with error=true, after the tag mappings and before any span filter.
+func (BasicOptions) HTTPStatusRuleOption(rules app.HTTPStatusRules) Option {
+	return func(b *BasicOptions) {
+		b.HTTPStatusRules = &rules
+	}
+}
+
+// SamplingRuleOption creates an Option that marks the spans matching the rules as sampled, tagged with the name
+// of the first matching rule, so that the tail sampling and the quota sampling of the collector keep them.
+func (BasicOptions) SamplingRuleOption(rules app.SamplingRules) Option {
+	return func(b *BasicOptions) {
+		b.SamplingRules = &rules
+	}
+}
+
+// CompositeSamplingOption creates an Option that marks the spans kept by the combined verdicts of the sub-samplers
+// of the config as sampled, tagged with the names of the sub-samplers that kept them, so that the tail sampling of
+// the collector keeps them.
+func (BasicOptions) CompositeSamplingOption(config app.CompositeSamplingConfig) Option {
+	return func(b *BasicOptions) {
+		b.CompositeSampling = &config
+	}
+}
+
+// SamplingDecisionCacheOption creates an Option that remembers the composite sampling decisions of up to size
+// traces for the ttl, so that the later spans of a trace are kept or dropped like its first span.
+func (BasicOptions) SamplingDecisionCacheOption(size int, ttl time.Duration) Option {
+	return func(b *BasicOptions) {
+		b.SamplingDecisionCache = &app.SamplingDecisionCacheOptions{Size: size, TTL: ttl}
+	}
+}
+
+// DropRuleOption creates an Option that rejects the spans matching the rules, e.g. those of the proxy hops of
+// service mesh sidecars, counting them by rule. The rules are checked after the span filters of the options.
+func (BasicOptions) DropRuleOption(rules app.DropRules) Option {
+	return func(b *BasicOptions) {
+		b.DropRules = &rules
+	}
+}
+
+// SpanSchemaOption creates an Option that checks that the spans follow the rules, e.g. carry the tags of their team
+// and environment, and rejects or tags the violating spans according to the mode, counting them by rule and service.
+// The rules are checked after the drop rules.
+func (BasicOptions) SpanSchemaOption(rules app.SchemaRules, mode app.SchemaViolationMode) Option {
+	return func(b *BasicOptions) {
+		b.SpanSchema = &app.SpanSchemaOptions{Rules: rules, Mode: mode}
+	}
+}
+
+// ServiceAliasOption creates an Option that renames the services of spans to their alias, before any span filter,
+// keeping the original names in a tag.
+func (BasicOptions) ServiceAliasOption(aliases app.ServiceAliases) Option {
+	return func(b *BasicOptions) {
+		b.ServiceAliases = &aliases
+	}
+}
+
+// OperationNameRuleOption creates an Option that rewrites the operation names of spans matching the rules of their
+// service with the value of one of their tags, keeping the original names in a tag.
+func (BasicOptions) OperationNameRuleOption(rules app.OperationNameRules) Option {
+	return func(b *BasicOptions) {
+		b.OperationNameRules = &rules
+	}
+}
+
+// GRPCEnabledOption creates an Option that enables or disables the gRPC span ingestion handler
+func (BasicOptions) GRPCEnabledOption(enabled bool) Option {
+	return func(b *BasicOptions) {
+		b.GRPCEnabled = enabled
+	}
+}
+
+// TLSOption creates an Option that serves the HTTP endpoints of the collector over TLS with the configuration,
+// whose certificate can be reloaded when its files change
+func (BasicOptions) TLSOption(configuration tlscfg.Configuration) Option {
+	return func(b *BasicOptions) {
+		b.TLS = &configuration
+	}
+}
+
+// RateLimitOption creates an Option that limits the spans per second accepted from each service.
+// Services missing from perService share a bucket with defaultRate, which is unlimited if 0.
+func (BasicOptions) RateLimitOption(defaultRate float64, perService map[string]float64) Option {
+	return func(b *BasicOptions) {
+		b.RateLimits = &app.RateLimits{
+			Default:  defaultRate,
+			Services: perService,
+		}
+	}
+}
+
+// SpanQuotaOption creates an Option that counts the spans received from each service each day, and drops, tags
+// or samples down by trace, depending on the mode of the options, the spans beyond the quota of their service.
+// The usage of all services is reset every day at the reset time of the options.
+func (BasicOptions) SpanQuotaOption(options app.SpanQuotaOptions) Option {
+	return func(b *BasicOptions) {
+		b.SpanQuotas = &options
+	}
+}
+
+// TraceSpanLimitOption creates an Option that keeps up to maxSpans spans of each trace received within the window
+// from its first span, and drops the others, the first dropped span being kept instead to tag the trace as truncated
+func (BasicOptions) TraceSpanLimitOption(maxSpans int, window time.Duration) Option {
+	return func(b *BasicOptions) {
+		b.TraceSpanLimit = &app.TraceSpanLimitOptions{
+			MaxSpans: maxSpans,
+			Window:   window,
+		}
+	}
+}
+
+// FutureSpanOption creates an Option that drops the spans starting later than the tolerance of the options after
+// the clock of the collector, or moves them back to start now tagged with the time they were moved by
+func (BasicOptions) FutureSpanOption(options app.FutureSpanOptions) Option {
+	return func(b *BasicOptions) {
+		b.FutureSpans = &options
+	}
+}
+
+// SpanIDCollisionOption creates an Option that tags the spans sharing their span ID with a different recent span
+// of their trace, or gives them a new span ID, according to the mode of the options
+func (BasicOptions) SpanIDCollisionOption(options app.SpanIDCollisionOptions) Option {
+	return func(b *BasicOptions) {
+		b.SpanIDCollisions = &options
+	}
+}
+
+// DeduplicationOption creates an Option that drops spans with the same trace and span IDs as one of the
+// last windowSize spans seen by the collector.
+func (BasicOptions) DeduplicationOption(windowSize int) Option {
+	return func(b *BasicOptions) {
+		b.DeduplicationWindow = windowSize
+	}
+}
+
+// SpanMetricsOption creates an Option that enables or disables the request, error and duration metrics
+// of each service and operation derived from the spans received by the collector
+func (BasicOptions) SpanMetricsOption(enabled bool) Option {
+	return func(b *BasicOptions) {
+		b.SpanMetrics = enabled
+	}
+}
+
+// ProcessCompactionOption creates an Option that makes the Cassandra and ElasticSearch writers store the process
+// of the spans of a trace with its first span only, the other spans referencing it, remembering the processes of
+// up to maxProcesses traces and processes. The query service restores the processes whether it is enabled or not.
+func (BasicOptions) ProcessCompactionOption(maxProcesses int) Option {
+	return func(b *BasicOptions) {
+		b.ProcessCompaction = &compaction.Options{MaxProcesses: maxProcesses}
+	}
+}
+
+// SpanSerializationOption creates an Option that sets the format spans are serialized to before being stored
+func (BasicOptions) SpanSerializationOption(format codec.Format) Option {
+	return func(b *BasicOptions) {
+		b.SpanSerialization = format
+	}
+}
+
+// HealthCheckOption creates an Option that probes the span storage every interval. The storage is reported
+// unhealthy after failureThreshold consecutive failed probes and healthy again after successThreshold
+// consecutive successful ones.
+func (BasicOptions) HealthCheckOption(interval time.Duration, failureThreshold, successThreshold int) Option {
+	return func(b *BasicOptions) {
+		b.HealthCheck = &app.HealthCheckOptions{
+			Interval:         interval,
+			FailureThreshold: failureThreshold,
+			SuccessThreshold: successThreshold,
+		}
+	}
+}
+
+// TagSanitizerOption creates an Option that drops the span tags not allowed by the allow-list and
+// deny-list, and truncates tag values longer than maxValueLength.
+func (BasicOptions) TagSanitizerOption(allowList, denyList []string, maxValueLength int) Option {
+	return func(b *BasicOptions) {
+		b.TagSanitizer = &sanitizer.TagSanitizerOptions{
+			AllowList:      allowList,
+			DenyList:       denyList,
+			MaxValueLength: maxValueLength,
+		}
+	}
+}
+
+// ZipkinReferenceRulesOption creates an Option that makes the Zipkin spans with one of the span kinds, or with an
+// annotation value or a binary annotation key among the annotations, follow from their parent span rather than
+// being its children, e.g. the consumers of a message queue
+func (BasicOptions) ZipkinReferenceRulesOption(spanKinds []string, annotations []string) Option {
+	return func(b *BasicOptions) {
+		b.ZipkinReferenceRules = zipkinConv.ReferenceRules{
+			SpanKinds:   spanKinds,
+			Annotations: annotations,
+		}
+	}
+}
+
+// OpenCensusOption creates an Option that enables or disables the OpenCensus span receiver
+func (BasicOptions) OpenCensusOption(enabled bool) Option {
+	return func(b *BasicOptions) {
+		b.OpenCensus = enabled
+	}
+}
+
+// OTLPOption creates an Option that enables or disables the OTLP/HTTP span receiver
+func (BasicOptions) OTLPOption(enabled bool) Option {
+	return func(b *BasicOptions) {
+		b.OTLP = enabled
+	}
+}
+
+// DryRunOption creates an Option that replaces the span storage with a writer that only counts and logs spans
+func (BasicOptions) DryRunOption(dryRun bool) Option {
+	return func(b *BasicOptions) {
+		b.DryRun = dryRun
+	}
+}
+
+// AsyncWriterOption creates an Option that buffers up to bufferSize spans written to storage by numWorkers
+// goroutines, so that saving a span does not wait for the storage. When the buffer is full, spans are
+// dropped unless blockWhenFull is set, in which case saving them waits for room in the buffer.
+func (BasicOptions) AsyncWriterOption(bufferSize, numWorkers int, blockWhenFull bool) Option {
+	return func(b *BasicOptions) {
+		b.AsyncWriter = &async.Options{
+			BufferSize:    bufferSize,
+			NumWorkers:    numWorkers,
+			BlockWhenFull: blockWhenFull,
+		}
+	}
+}
+
+// SpanRoutingOption creates an Option that saves the spans with a tag into the writer of the first matching
+// route instead of the span storage, which remains the default for the spans matching no route. It can be
+// used multiple times, in which case the routes are tried in the order they were given. The spans of a trace
+// are split between the destinations if only some of them match. The writers are not closed by the collector.
+func (BasicOptions) SpanRoutingOption(routes ...spanstore.Route) Option {
+	return func(b *BasicOptions) {
+		b.Routes = append(b.Routes, routes...)
+	}
+}
+
+// TraceBatchingOption creates an Option that holds the spans of each trace for window from its first span, or
+// until maxBatchSize of them are received unless it is 0, to write them together to storage. The spans of a trace
+// whose batch was written are written individually. Up to maxPendingSpans are held, beyond which the batch of a
+// span is written right away, and flushers batches are written at the same time.
+func (BasicOptions) TraceBatchingOption(window time.Duration, maxBatchSize, maxPendingSpans, flushers int) Option {
+	return func(b *BasicOptions) {
+		b.TraceBatching = &batch.Options{
+			Window:          window,
+			MaxBatchSize:    maxBatchSize,
+			MaxPendingSpans: maxPendingSpans,
+			Flushers:        flushers,
+		}
+	}
+}
+
+// TailSamplingOption creates an Option that holds the spans of each trace for window from its first span, to keep
+// the trace if one of its spans was sampled by the client, or else lasts at least durationThreshold unless it is 0.
+// The spans of the other traces are dropped.
+func (BasicOptions) TailSamplingOption(window, durationThreshold time.Duration) Option {
+	return func(b *BasicOptions) {
+		b.TailSampling = &tailsampling.Options{
+			Window:            window,
+			DurationThreshold: durationThreshold,
+		}
+	}
+}
+
+// TailSamplingRootOption creates an Option that makes the tail sampling drop the traces whose root span, the span
+// without a parent, was not received within the window, with all their late spans. It requires TailSamplingOption.
+func (BasicOptions) TailSamplingRootOption(requireRoot bool) Option {
+	return func(b *BasicOptions) {
+		b.TailSamplingRequireRoot = requireRoot
+	}
+}
+
+// CircuitBreakerOption creates an Option that stops writing spans to storage for openPeriod after failureThreshold
+// consecutive writes failed, or took longer than latencyThreshold unless it is 0. Spans are then rejected, or up to
+// fallbackSize of them are kept to be written once a span written after the open period succeeds.
+func (BasicOptions) CircuitBreakerOption(failureThreshold int, latencyThreshold, openPeriod time.Duration, fallbackSize int) Option {
+	return func(b *BasicOptions) {
+		b.CircuitBreaker = &breaker.Options{
+			FailureThreshold: failureThreshold,
+			LatencyThreshold: latencyThreshold,
+			OpenPeriod:       openPeriod,
+			FallbackSize:     fallbackSize,
+		}
+	}
+}
+
+// WriteDeadlineOption creates an Option that gives up the writes of a span to the storageType storage once
+// they take longer than timeout.
+func (BasicOptions) WriteDeadlineOption(storageType string, timeout time.Duration) Option {
+	return func(b *BasicOptions) {
+		if b.WriteDeadlines == nil {
+			b.WriteDeadlines = make(map[string]deadline.Options)
+		}
+		b.WriteDeadlines[storageType] = deadline.Options{Timeout: timeout}
+	}
+}
+
+// WALOption creates an Option that records the spans accepted by the collector in segments of segmentSize
+// bytes in the directory, until they are saved to storage, so that the spans lost by a crash are saved on the
+// next start. Spans are rejected once the segments reach maxSize bytes, unless it is zero. syncWrites flushes
+// each span to disk before it is accepted, so that spans also survive a crash of the host.
+func (BasicOptions) WALOption(directory string, segmentSize, maxSize int64, syncWrites bool) Option {
+	return func(b *BasicOptions) {
+		b.WAL = &wal.Options{
+			Directory:   directory,
+			SegmentSize: segmentSize,
+			MaxSize:     maxSize,
+			SyncWrites:  syncWrites,
+		}
+	}
+}
+
+// NATSOption creates an Option that consumes the Jaeger Thrift span batches of the JetStream subscription of the
+// configuration, acknowledging each message once its spans are saved
+func (BasicOptions) NATSOption(config natscfg.Configuration) Option {
+	return func(b *BasicOptions) {
+		b.NATS = &config
+	}
+}
+
+// OperationCardinalityOption creates an Option that renames the spans of a service to placeholder once it has
+// maxOperations distinct operation names, so that operation names templated from e.g. URLs do not blow up the
+// operation and dependency indexes. The placeholder defaults to app.DefaultOperationPlaceholder if empty.
+func (BasicOptions) OperationCardinalityOption(maxOperations int, placeholder string) Option {
+	return func(b *BasicOptions) {
+		b.OperationCardinality = &app.OperationCardinalityOptions{
+			MaxOperations: maxOperations,
+			Placeholder:   placeholder,
+		}
+	}
+}
+
+// AdmissionOption creates an Option that reads the memory and goroutines of the collector periodically, and
+// while either is beyond its threshold of the options rejects the span batches as busy, so that the clients retry
+// them later, or drops the spans of the shed ratio of the traces if it is not 0.
+func (BasicOptions) AdmissionOption(options app.AdmissionOptions) Option {
+	return func(b *BasicOptions) {
+		b.Admission = &options
+	}
+}
+
+// DroppedSpansOption creates an Option that retains the last bufferSize spans of the sampleRate of the traces
+// among the spans rejected by the span filters, shed by admission control or dropped by the full queue, so that
+// the recent drops can be inspected through SpanHandlerBuilder.DroppedSpans.
+func (BasicOptions) DroppedSpansOption(bufferSize int, sampleRate float64) Option {
+	return func(b *BasicOptions) {
+		b.DroppedSpans = &app.DroppedSpanSamplerOptions{
+			BufferSize: bufferSize,
+			SampleRate: sampleRate,
+		}
+	}
+}
+
+// WorkerPoolOption creates an Option that saves the spans queued by the collector with a pool of size workers,
+// rather than the fixed number of workers of the span processor, so that the parallelism of the writes can be
+// tuned to the capacity of the storage while the collector runs through SpanHandlerBuilder.WorkerPool.
+func (BasicOptions) WorkerPoolOption(size int) Option {
+	return func(b *BasicOptions) {
+		b.WorkerPoolSize = size
+	}
+}
+
+// EnrichmentOption creates an Option that tags each span with the metadata of its service looked up from the
+// provider, keeping the existing tags of the span. Only the metadata of the tagKeys is added, or all of it if
+// empty, and the metadata of up to cacheSize services is cached for cacheTTL if not 0. The spans whose metadata
+// cannot be looked up are kept as they are.
+func (BasicOptions) EnrichmentOption(provider app.MetadataProvider, tagKeys []string, cacheTTL time.Duration, cacheSize int) Option {
+	return func(b *BasicOptions) {
+		b.Enrichment = &app.EnrichmentOptions{
+			Provider:  provider,
+			TagKeys:   tagKeys,
+			CacheTTL:  cacheTTL,
+			CacheSize: cacheSize,
+		}
+	}
+}
+
+// CorrelationTagOption creates an Option that tags each span with its trace ID written in format, so that the
+// log pipeline can join logs and spans on the same value. A span that already has a tag with the key keeps it.
+// The key defaults to app.DefaultCorrelationTag if empty.
+func (BasicOptions) CorrelationTagOption(key string, format app.CorrelationFormat) Option {
+	return func(b *BasicOptions) {
+		b.CorrelationTag = &app.CorrelationTagOptions{
+			Key:    key,
+			Format: format,
+		}
+	}
+}
+
+// CollectorTagOption creates an Option that tags each span with the host name of the collector under hostnameKey,
+// unless it is empty, and with the other tags, e.g. the region or the version of the collector, so that the spans
+// stored by each collector of a fleet can be told apart. A span that already has a tag with one of the keys keeps it.
+func (BasicOptions) CollectorTagOption(hostnameKey string, tags map[string]string) Option {
+	return func(b *BasicOptions) {
+		b.CollectorTags = &app.CollectorTagOptions{
+			HostnameKey: hostnameKey,
+			Tags:        tags,
+		}
+	}
+}
+
+// BackpressureOption creates an Option that rejects the span batches as busy once the collector queue is filled
+// beyond the highWaterMark fraction of its capacity, until it falls back to the lowWaterMark fraction, so that
+// agents back off instead of their spans being dropped. A zero lowWaterMark is the same as highWaterMark.
+func (BasicOptions) BackpressureOption(highWaterMark, lowWaterMark float64) Option {
+	return func(b *BasicOptions) {
+		b.Backpressure = &app.BackpressureOptions{
+			HighWaterMark: highWaterMark,
+			LowWaterMark:  lowWaterMark,
+		}
+	}
+}
+
+// TenancyOption creates an Option that stores the spans under service names scoped to their tenant, read from
+// the header of the requests if not empty, or else from the given span or process tag. The spans without a
+// tenant are rejected.
+func (BasicOptions) TenancyOption(header, tag string) Option {
+	return func(b *BasicOptions) {
+		b.Tenancy = &app.TenancyOptions{
+			Header: header,
+			Tag:    tag,
+		}
+	}
+}
+
+// SamplingSeedOption creates an Option that seeds the hash of the trace IDs sampled by the span quotas and the
+// dropped span sampler, so that collectors sharing the seed make the same reproducible decisions.
+// See app.TraceSamplingBucket.
+func (BasicOptions) SamplingSeedOption(seed uint64) Option {
+	return func(b *BasicOptions) {
+		b.SamplingSeed = seed
+	}
+}
+
+// MaxSpanSizeOption creates an Option that rejects the spans whose estimated serialized size exceeds maxSize
+// bytes, before they are saved. Spans are not limited if maxSize is negative.
+func (BasicOptions) MaxSpanSizeOption(maxSize int) Option {
+	return func(b *BasicOptions) {
+		b.MaxSpanSize = maxSize
+	}
+}
+
+// BatchSizeOption creates an Option that splits the Jaeger Thrift batches of more than maxSpans spans into
+// batches of maxSpans spans, or rejects the requests submitting them, depending on the policy
+func (BasicOptions) BatchSizeOption(maxSpans int, policy app.BatchSizePolicy) Option {
+	return func(b *BasicOptions) {
+		b.BatchSize = &app.BatchSizeOptions{
+			MaxSpans: maxSpans,
+			Policy:   policy,
+		}
+	}
+}
+
+// AuthOption creates an Option that rejects the span submissions of clients presenting neither a bearer token
+// accepted by tokenValidator, if not nil, nor a verified TLS client certificate, if clientCertificates is set.
+func (BasicOptions) AuthOption(tokenValidator app.TokenValidator, clientCertificates bool) Option {
+	return func(b *BasicOptions) {
+		b.Auth = &app.AuthOptions{
+			TokenValidator:     tokenValidator,
+			ClientCertificates: clientCertificates,
+		}
+	}
+}
+
+// PrometheusOption creates an Option that reports all metrics to Prometheus as well as to the MetricsFactory,
+// with names prefixed by namespace. The histograms of timers count durations in seconds into buckets,
+// the Prometheus defaults if empty.
+func (BasicOptions) PrometheusOption(namespace string, buckets []float64) Option {
+	return func(b *BasicOptions) {
+		b.Prometheus = jmetrics.NewPrometheusFactory(namespace, buckets)
+	}
+}
+
+// SamplingDecisionsOption creates an Option that enables or disables the tagging of spans with the reason they
+// were sampled by the client and, if tailSampler is not nil, by the tail sampler.
+func (BasicOptions) SamplingDecisionsOption(enabled bool, tailSampler app.TailSampler) Option {
+	return func(b *BasicOptions) {
+		b.SamplingDecisions = enabled
+		b.TailSampler = tailSampler
+	}
+}
+
 // ApplyOptions takes a set of options and creates a populated BasicOptions struct
 func ApplyOptions(opts ...Option) BasicOptions {
 	o := BasicOptions{}
@@ -96,5 +824,8 @@ func ApplyOptions(opts ...Option) BasicOptions {
 	if o.MetricsFactory == nil {
 		o.MetricsFactory = metrics.NullFactory
 	}
+	if o.Prometheus != nil {
+		o.MetricsFactory = jmetrics.NewTeeFactory(o.MetricsFactory, o.Prometheus)
+	}
 	return o
 }
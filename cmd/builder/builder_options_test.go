@@ -21,13 +21,26 @@
 package builder
 
 import (
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 
 	"github.com/uber/jaeger-lib/metrics"
+	"github.com/uber/jaeger/cmd/collector/app"
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/model/codec"
+	badgercfg "github.com/uber/jaeger/pkg/badger/config"
 	escfg "github.com/uber/jaeger/pkg/es/config"
+	kafkacfg "github.com/uber/jaeger/pkg/kafka/config"
+	natscfg "github.com/uber/jaeger/pkg/nats/config"
+	pgcfg "github.com/uber/jaeger/pkg/postgres/config"
+	tlscfg "github.com/uber/jaeger/pkg/tls/config"
+	badgerSpanstore "github.com/uber/jaeger/plugin/storage/badger/spanstore"
+	"github.com/uber/jaeger/storage/spanstore"
 	"github.com/uber/jaeger/storage/spanstore/memory"
 )
 
@@ -40,9 +53,179 @@ func TestApplyOptions(t *testing.T) {
 		Options.ElasticSearchOption(&escfg.Configuration{
 			Servers: []string{"127.0.0.1"},
 		}),
+		Options.KafkaOption(&kafkacfg.Configuration{
+			Brokers: []string{"127.0.0.1:9092"},
+			Topic:   "jaeger-spans",
+		}),
+		Options.BadgerOption(&badgercfg.Configuration{
+			Directory: "/tmp/jaeger",
+		}),
+		Options.BadgerStoreOption(&badgerSpanstore.Store{}),
+		Options.PostgresOption(&pgcfg.Configuration{
+			DSN:          "postgres://127.0.0.1:5432/jaeger",
+			MaxOpenConns: 5,
+		}),
+		Options.AdaptiveSamplingOption(2, time.Minute),
+		Options.GRPCEnabledOption(true),
+		Options.TLSOption(tlscfg.Configuration{CertPath: "cert.pem", KeyPath: "key.pem", MinVersion: "1.2"}),
+		Options.DryRunOption(true),
+		Options.OpenCensusOption(true),
+		Options.OTLPOption(true),
+		Options.RateLimitOption(10, map[string]float64{"svc": 100}),
+		Options.SpanQuotaOption(app.SpanQuotaOptions{Quotas: app.SpanQuotas{Default: 1000}, Mode: app.TagOverQuota}),
+		Options.TagSanitizerOption([]string{"http.url"}, nil, 128),
+		Options.DeduplicationOption(1000),
+		Options.FutureSpanOption(app.FutureSpanOptions{Tolerance: time.Hour, Mode: app.ClampFutureSpans}),
+		Options.SpanIDCollisionOption(app.SpanIDCollisionOptions{WindowSize: 1000, Mode: app.ReassignSpanIDCollisions}),
+		Options.TraceSpanLimitOption(10000, time.Minute),
+		Options.HealthCheckOption(time.Second, 3, 2),
+		Options.SpanMetricsOption(true),
+		Options.SpanSerializationOption(codec.ProtobufFormat),
+		Options.AsyncWriterOption(1000, 8, true),
+		Options.TraceBatchingOption(time.Second, 50, 5000, 2),
+		Options.TailSamplingOption(2*time.Second, time.Minute),
+		Options.TailSamplingRootOption(true),
+		Options.CircuitBreakerOption(5, time.Second, 30*time.Second, 1000),
+		Options.WriteDeadlineOption("cassandra", 2*time.Second),
+		Options.WriteDeadlineOption("elasticsearch", 5*time.Second),
+		Options.SpanRoutingOption(spanstore.Route{Name: "errors", Tag: "error", Value: "true", Writer: memory.NewStore()}),
+		Options.SpanRoutingOption(spanstore.Route{Name: "debug", Tag: "debug", Value: "true", Writer: memory.NewStore()}),
+		Options.SpanMutatorOption(func(*model.Span) {}),
+		Options.TagMappingOption(app.TagMappings{Keys: map[string]string{"status_code": "http.status_code"}}),
+		Options.HTTPStatusRuleOption(app.HTTPStatusRules{Default: app.HTTPStatusRule{SourceKeys: []string{"status"}}}),
+		Options.OperationNameRuleOption(app.OperationNameRules{"frontend": {{Pattern: "^HTTP", Tag: "http.route"}}}),
+		Options.SamplingRuleOption(app.SamplingRules{{Name: "premium", Tag: "user.tier", Value: "premium"}}),
+		Options.CompositeSamplingOption(app.CompositeSamplingConfig{Samplers: []app.SamplerConfig{{Name: "baseline", Type: app.ProbabilisticSampler, Rate: 0.1}}}),
+		Options.SamplingDecisionCacheOption(1000, time.Minute),
+		Options.DropRuleOption(app.DropRules{{Name: "sidecars", ServicePrefix: "envoy-"}}),
+		Options.SpanSchemaOption(app.SchemaRules{{Name: "team", Tag: "team"}}, app.TagSchemaViolations),
+		Options.ServiceAliasOption(app.ServiceAliases{"payments-legacy": "payments"}),
+		Options.PrometheusOption("jaeger-collector", []float64{0.1, 1}),
+		Options.MaxSpanSizeOption(4096),
+		Options.SamplingSeedOption(42),
+		Options.BatchSizeOption(500, app.RejectOversizedBatches),
+		Options.AuthOption(app.NewStaticTokenValidator([]string{"secret"}), true),
+		Options.SamplingDecisionsOption(true, nil),
+		Options.WALOption("/tmp/jaeger-wal", 1<<20, 1<<30, true),
+		Options.ProcessCompactionOption(5000),
+		Options.NATSOption(natscfg.Configuration{Servers: []string{"nats://127.0.0.1:4222"}, Subject: "jaeger.spans"}),
+		Options.OperationCardinalityOption(1000, "templated"),
+		Options.CorrelationTagOption("log.trace_id", app.DecimalCorrelation),
+		Options.CollectorTagOption("collector.hostname", map[string]string{"region": "us-east-1"}),
+		Options.EnrichmentOption(app.NewHTTPMetadataProvider("http://metadata/{service}", time.Second), []string{"owner"}, time.Minute, 500),
+		Options.AdmissionOption(app.AdmissionOptions{MaxMemory: 1 << 30, MaxGoroutines: 10000, ShedRatio: 0.5}),
+		Options.BackpressureOption(0.9, 0.5),
+		Options.DroppedSpansOption(500, 0.1),
+		Options.WorkerPoolOption(20),
+		Options.ZipkinReferenceRulesOption([]string{"consumer"}, []string{"mr"}),
+		Options.TenancyOption("x-tenant", "team"),
+		Options.StaticSamplingOption("/etc/jaeger/strategies.json", time.Minute),
 	)
 	assert.NotNil(t, opts.ElasticSearch)
 	assert.NotNil(t, opts.ElasticSearch.Servers)
+	assert.NotNil(t, opts.Kafka)
+	assert.Equal(t, "jaeger-spans", opts.Kafka.Topic)
+	assert.NotNil(t, opts.Badger)
+	assert.NotNil(t, opts.BadgerStore)
+	assert.Equal(t, "postgres://127.0.0.1:5432/jaeger", opts.Postgres.DSN)
+	assert.Equal(t, 5, opts.Postgres.MaxOpenConns)
+	assert.Equal(t, 2.0, opts.AdaptiveSampling.TargetSpansPerSecond)
+	assert.Equal(t, time.Minute, opts.AdaptiveSampling.CalculationInterval)
+	assert.True(t, opts.GRPCEnabled)
+	assert.Equal(t, "cert.pem", opts.TLS.CertPath)
+	assert.Equal(t, "1.2", opts.TLS.MinVersion)
+	assert.True(t, opts.DryRun)
+	assert.True(t, opts.OpenCensus)
+	assert.True(t, opts.OTLP)
+	assert.Equal(t, 10.0, opts.RateLimits.Default)
+	assert.Equal(t, 100.0, opts.RateLimits.Services["svc"])
+	assert.EqualValues(t, 1000, opts.SpanQuotas.Quotas.Default)
+	assert.Equal(t, app.TagOverQuota, opts.SpanQuotas.Mode)
+	assert.Equal(t, []string{"http.url"}, opts.TagSanitizer.AllowList)
+	assert.Equal(t, 1000, opts.DeduplicationWindow)
+	assert.Equal(t, time.Hour, opts.FutureSpans.Tolerance)
+	assert.Equal(t, app.ClampFutureSpans, opts.FutureSpans.Mode)
+	assert.Equal(t, 1000, opts.SpanIDCollisions.WindowSize)
+	assert.Equal(t, app.ReassignSpanIDCollisions, opts.SpanIDCollisions.Mode)
+	assert.Equal(t, 10000, opts.TraceSpanLimit.MaxSpans)
+	assert.Equal(t, time.Minute, opts.TraceSpanLimit.Window)
+	assert.Equal(t, time.Second, opts.HealthCheck.Interval)
+	assert.Equal(t, 3, opts.HealthCheck.FailureThreshold)
+	assert.Equal(t, 2, opts.HealthCheck.SuccessThreshold)
+	assert.True(t, opts.SpanMetrics)
+	assert.Equal(t, 1000, opts.AsyncWriter.BufferSize)
+	assert.Equal(t, 8, opts.AsyncWriter.NumWorkers)
+	assert.True(t, opts.AsyncWriter.BlockWhenFull)
+	assert.Equal(t, time.Second, opts.TraceBatching.Window)
+	assert.Equal(t, 50, opts.TraceBatching.MaxBatchSize)
+	assert.Equal(t, 5000, opts.TraceBatching.MaxPendingSpans)
+	assert.Equal(t, 2, opts.TraceBatching.Flushers)
+	assert.Equal(t, 2*time.Second, opts.TailSampling.Window)
+	assert.Equal(t, time.Minute, opts.TailSampling.DurationThreshold)
+	assert.True(t, opts.TailSamplingRequireRoot)
+	assert.Equal(t, 5, opts.CircuitBreaker.FailureThreshold)
+	assert.Equal(t, time.Second, opts.CircuitBreaker.LatencyThreshold)
+	assert.Equal(t, 30*time.Second, opts.CircuitBreaker.OpenPeriod)
+	assert.Equal(t, 1000, opts.CircuitBreaker.FallbackSize)
+	require.Len(t, opts.WriteDeadlines, 2)
+	assert.Equal(t, 2*time.Second, opts.WriteDeadlines["cassandra"].Timeout)
+	assert.Equal(t, 5*time.Second, opts.WriteDeadlines["elasticsearch"].Timeout)
+	require.Len(t, opts.Routes, 2)
+	assert.Equal(t, "errors", opts.Routes[0].Name)
+	assert.Equal(t, "debug", opts.Routes[1].Name)
+	assert.Len(t, opts.SpanMutators, 1)
+	assert.Equal(t, "http.status_code", opts.TagMappings.Keys["status_code"])
+	assert.Equal(t, []string{"status"}, opts.HTTPStatusRules.Default.SourceKeys)
+	assert.Equal(t, "http.route", (*opts.OperationNameRules)["frontend"][0].Tag)
+	assert.Equal(t, "premium", (*opts.SamplingRules)[0].Name)
+	assert.Equal(t, "baseline", opts.CompositeSampling.Samplers[0].Name)
+	assert.Equal(t, app.SamplingDecisionCacheOptions{Size: 1000, TTL: time.Minute}, *opts.SamplingDecisionCache)
+	assert.Equal(t, "sidecars", (*opts.DropRules)[0].Name)
+	assert.Equal(t, "team", opts.SpanSchema.Rules[0].Name)
+	assert.Equal(t, app.TagSchemaViolations, opts.SpanSchema.Mode)
+	assert.Equal(t, "payments", (*opts.ServiceAliases)["payments-legacy"])
+	assert.NotNil(t, opts.Prometheus)
+	assert.Equal(t, 4096, opts.MaxSpanSize)
+	assert.EqualValues(t, 42, opts.SamplingSeed)
+	assert.Equal(t, 500, opts.BatchSize.MaxSpans)
+	assert.Equal(t, app.RejectOversizedBatches, opts.BatchSize.Policy)
+	assert.NoError(t, opts.Auth.TokenValidator.ValidateToken("secret"))
+	assert.True(t, opts.Auth.ClientCertificates)
+	assert.True(t, opts.SamplingDecisions)
+	assert.Equal(t, "/tmp/jaeger-wal", opts.WAL.Directory)
+	assert.EqualValues(t, 1<<20, opts.WAL.SegmentSize)
+	assert.EqualValues(t, 1<<30, opts.WAL.MaxSize)
+	assert.True(t, opts.WAL.SyncWrites)
+	assert.Equal(t, 5000, opts.ProcessCompaction.MaxProcesses)
+	assert.Equal(t, "jaeger.spans", opts.NATS.Subject)
+	assert.Equal(t, 1000, opts.OperationCardinality.MaxOperations)
+	assert.Equal(t, "templated", opts.OperationCardinality.Placeholder)
+	assert.Equal(t, "log.trace_id", opts.CorrelationTag.Key)
+	assert.Equal(t, app.DecimalCorrelation, opts.CorrelationTag.Format)
+	assert.Equal(t, "collector.hostname", opts.CollectorTags.HostnameKey)
+	assert.Equal(t, map[string]string{"region": "us-east-1"}, opts.CollectorTags.Tags)
+	assert.NotNil(t, opts.Enrichment.Provider)
+	assert.Equal(t, []string{"owner"}, opts.Enrichment.TagKeys)
+	assert.Equal(t, time.Minute, opts.Enrichment.CacheTTL)
+	assert.Equal(t, 500, opts.Enrichment.CacheSize)
+	assert.EqualValues(t, 1<<30, opts.Admission.MaxMemory)
+	assert.Equal(t, 10000, opts.Admission.MaxGoroutines)
+	assert.Equal(t, 0.5, opts.Admission.ShedRatio)
+	assert.Equal(t, 500, opts.DroppedSpans.BufferSize)
+	assert.Equal(t, []string{"consumer"}, opts.ZipkinReferenceRules.SpanKinds)
+	assert.Equal(t, []string{"mr"}, opts.ZipkinReferenceRules.Annotations)
+	assert.Equal(t, 0.1, opts.DroppedSpans.SampleRate)
+	assert.Equal(t, 20, opts.WorkerPoolSize)
+	assert.Equal(t, 0.9, opts.Backpressure.HighWaterMark)
+	assert.Equal(t, 0.5, opts.Backpressure.LowWaterMark)
+	assert.Equal(t, "x-tenant", opts.Tenancy.Header)
+	assert.Equal(t, "team", opts.Tenancy.Tag)
+	assert.Equal(t, "/etc/jaeger/strategies.json", opts.StaticSampling.File)
+	assert.Equal(t, time.Minute, opts.StaticSampling.ReloadInterval)
+	assert.Nil(t, opts.TailSampler)
+	assert.NotEqual(t, metrics.NullFactory, opts.MetricsFactory)
+	assert.Equal(t, codec.ProtobufFormat, opts.SpanSerialization)
+	assert.Equal(t, 128, opts.TagSanitizer.MaxValueLength)
 	assert.NotNil(t, opts.Logger)
 	assert.NotNil(t, opts.MetricsFactory)
 }
@@ -52,3 +235,50 @@ func TestApplyNoOptions(t *testing.T) {
 	assert.NotNil(t, opts.Logger)
 	assert.NotNil(t, opts.MetricsFactory)
 }
+
+func TestPrometheusOption(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	opts := ApplyOptions(
+		Options.PrometheusOption("jaeger-collector", nil),
+		Options.MetricsFactoryOption(metricsFactory),
+	)
+	opts.MetricsFactory.Counter("spans.received", nil).Inc(1)
+
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["spans.received"])
+	w := httptest.NewRecorder()
+	opts.Prometheus.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, w.Body.String(), "jaeger_collector_spans_received 1")
+}
+
+func TestCustomStorageOption(t *testing.T) {
+	store := memory.NewStore()
+	opts := ApplyOptions(Options.CustomStorageOption(store, store))
+	assert.Equal(t, store, opts.CustomSpanWriter)
+	assert.Equal(t, store, opts.CustomSpanReader)
+}
+
+func TestMemoryStoreOptionConfiguresStore(t *testing.T) {
+	memStore := memory.NewStore()
+	for i := uint64(1); i <= 2; i++ {
+		memStore.WriteSpan(&model.Span{
+			TraceID: model.TraceID{Low: i},
+			Process: &model.Process{ServiceName: "svc"},
+		})
+	}
+	opts := ApplyOptions(Options.MemoryStoreOption(memStore, memory.Options.MaxTraces(1)))
+	assert.Equal(t, memStore, opts.MemoryStore)
+	_, err := memStore.GetTrace(model.TraceID{Low: 1})
+	assert.Error(t, err, "the least recently written trace is evicted")
+	_, err = memStore.GetTrace(model.TraceID{Low: 2})
+	assert.NoError(t, err)
+}
+
+func TestSpanFilterOption(t *testing.T) {
+	allow := func(*model.Span) bool { return true }
+	opts := ApplyOptions(
+		Options.SpanFilterOption(allow),
+		Options.SpanFilterOption(allow),
+	)
+	assert.Len(t, opts.SpanFilters, 2)
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+	"github.com/uber/tchannel-go"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+)
+
+const (
+	// DefaultAdmissionCheckInterval is the default interval between two readings of the process load
+	DefaultAdmissionCheckInterval = time.Second
+)
+
+// AdmissionOptions are the load thresholds beyond which the collector stops admitting all the spans it receives
+type AdmissionOptions struct {
+	// MaxMemory is the memory held by the process, in bytes, from which it is overloaded, no limit if 0
+	MaxMemory uint64
+	// MaxGoroutines is the number of goroutines from which the process is overloaded, no limit if 0
+	MaxGoroutines int
+	// ShedRatio is the fraction of the traces, between 0 and 1, whose spans are dropped while the process is
+	// overloaded. The whole batches are rejected with tchannel.ErrServerBusy if 0.
+	ShedRatio float64
+	// CheckInterval is the time between two readings of the load, DefaultAdmissionCheckInterval if 0
+	CheckInterval time.Duration
+}
+
+type admissionMetrics struct {
+	// Memory is the memory held by the process at the last reading, in bytes
+	Memory metrics.Gauge `metric:"admission.memory-bytes"`
+	// Goroutines is the number of goroutines at the last reading
+	Goroutines metrics.Gauge `metric:"admission.goroutines"`
+	// Overloaded is 1 while the load is beyond a threshold and 0 otherwise
+	Overloaded metrics.Gauge `metric:"admission.overloaded"`
+	// RejectedBatches counts the batches rejected as busy while overloaded
+	RejectedBatches metrics.Counter `metric:"admission.rejected-batches"`
+	// ShedSpans counts the spans dropped while overloaded
+	ShedSpans metrics.Counter `metric:"admission.shed-spans"`
+}
+
+// AdmissionController reads the memory and goroutines of the process periodically, and while either is beyond
+// its threshold rejects the batches of spans as busy, so that the clients retry them later, or sheds a fraction
+// of the traces, so that the collector degrades before running out of memory.
+type AdmissionController struct {
+	options    AdmissionOptions
+	logger     *zap.Logger
+	metrics    admissionMetrics
+	overloaded int32
+	done       chan struct{}
+
+	// the readings of the load, replaced in tests
+	readMemory     func() uint64
+	readGoroutines func() int
+}
+
+// NewAdmissionController creates an AdmissionController, admitting all the spans until the first reading.
+// Start needs to be called to begin reading the load.
+func NewAdmissionController(options AdmissionOptions, logger *zap.Logger, metricsFactory metrics.Factory) *AdmissionController {
+	if options.CheckInterval <= 0 {
+		options.CheckInterval = DefaultAdmissionCheckInterval
+	}
+	c := &AdmissionController{
+		options:        options,
+		logger:         logger,
+		done:           make(chan struct{}),
+		readMemory:     readProcessMemory,
+		readGoroutines: runtime.NumGoroutine,
+	}
+	metrics.Init(&c.metrics, metricsFactory, nil)
+	return c
+}
+
+// readProcessMemory returns the memory obtained from the OS by the Go runtime and not released to it yet
+func readProcessMemory() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.Sys - stats.HeapReleased
+}
+
+// Start begins the periodic reading of the load.
+func (c *AdmissionController) Start() {
+	c.Check()
+	go func() {
+		ticker := time.NewTicker(c.options.CheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.Check()
+			case <-c.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts the reading of the load.
+func (c *AdmissionController) Stop() {
+	close(c.done)
+}
+
+// Check reads the load once and returns whether the process is overloaded.
+func (c *AdmissionController) Check() bool {
+	memory := c.readMemory()
+	goroutines := c.readGoroutines()
+	c.metrics.Memory.Update(int64(memory))
+	c.metrics.Goroutines.Update(int64(goroutines))
+	overloaded := (c.options.MaxMemory > 0 && memory >= c.options.MaxMemory) ||
+		(c.options.MaxGoroutines > 0 && goroutines >= c.options.MaxGoroutines)
+	var state int32
+	if overloaded {
+		state = 1
+	}
+	if previous := atomic.SwapInt32(&c.overloaded, state); previous != state {
+		if overloaded {
+			c.logger.Warn("Collector is overloaded, spans are not all admitted",
+				zap.Uint64("memory", memory), zap.Int("goroutines", goroutines))
+		} else {
+			c.logger.Info("Collector is no longer overloaded, all spans are admitted")
+		}
+	}
+	c.metrics.Overloaded.Update(int64(state))
+	return overloaded
+}
+
+// Overloaded returns whether the load was beyond a threshold at the last reading
+func (c *AdmissionController) Overloaded() bool {
+	return atomic.LoadInt32(&c.overloaded) == 1
+}
+
+// AdmitBatch returns tchannel.ErrServerBusy while the process is overloaded and the spans are not shed
+func (c *AdmissionController) AdmitBatch() error {
+	if c.options.ShedRatio <= 0 && c.Overloaded() {
+		c.metrics.RejectedBatches.Inc(1)
+		return tchannel.ErrServerBusy
+	}
+	return nil
+}
+
+// AdmitSpan returns false for the spans of the ShedRatio of the traces while the process is overloaded,
+// so that the shed traces are dropped whole, the shed traces being those sampled at that rate without a seed
+func (c *AdmissionController) AdmitSpan(span *model.Span) bool {
+	if c.options.ShedRatio <= 0 || !c.Overloaded() {
+		return true
+	}
+	if sampleTrace(span.TraceID, c.options.ShedRatio, 0) {
+		c.metrics.ShedSpans.Inc(1)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-lib/metrics"
+	"github.com/uber/tchannel-go"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+)
+
+// newTestAdmissionController creates an AdmissionController reading the given load
+func newTestAdmissionController(options AdmissionOptions, metricsFactory metrics.Factory, memory *uint64, goroutines *int) *AdmissionController {
+	c := NewAdmissionController(options, zap.NewNop(), metricsFactory)
+	c.readMemory = func() uint64 { return *memory }
+	c.readGoroutines = func() int { return *goroutines }
+	return c
+}
+
+func TestAdmissionControllerRejectsBatches(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	memory, goroutines := uint64(100), 10
+	c := newTestAdmissionController(AdmissionOptions{MaxMemory: 1000, MaxGoroutines: 50}, metricsFactory, &memory, &goroutines)
+
+	assert.False(t, c.Check())
+	assert.NoError(t, c.AdmitBatch())
+
+	memory = 1000
+	assert.True(t, c.Check())
+	assert.Equal(t, tchannel.ErrServerBusy, c.AdmitBatch())
+	// the spans are not shed without a shed ratio
+	assert.True(t, c.AdmitSpan(&model.Span{}))
+
+	memory, goroutines = 100, 50
+	assert.True(t, c.Check())
+	assert.Equal(t, tchannel.ErrServerBusy, c.AdmitBatch())
+
+	goroutines = 10
+	assert.False(t, c.Check())
+	assert.NoError(t, c.AdmitBatch())
+
+	counts, gauges := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counts["admission.rejected-batches"])
+	assert.EqualValues(t, 100, gauges["admission.memory-bytes"])
+	assert.EqualValues(t, 10, gauges["admission.goroutines"])
+	assert.EqualValues(t, 0, gauges["admission.overloaded"])
+}
+
+func TestAdmissionControllerShedsTraces(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	memory, goroutines := uint64(0), 100
+	c := newTestAdmissionController(AdmissionOptions{MaxGoroutines: 50, ShedRatio: 0.25}, metricsFactory, &memory, &goroutines)
+
+	kept := &model.Span{TraceID: model.TraceID{Low: 5000}}
+	shed := &model.Span{TraceID: model.TraceID{Low: 12499}}
+	assert.True(t, c.AdmitSpan(shed), "all spans are admitted before the first reading")
+
+	assert.True(t, c.Check())
+	assert.NoError(t, c.AdmitBatch())
+	assert.True(t, c.AdmitSpan(kept))
+	assert.False(t, c.AdmitSpan(shed))
+	assert.False(t, c.AdmitSpan(shed))
+
+	goroutines = 10
+	assert.False(t, c.Check())
+	assert.True(t, c.AdmitSpan(shed))
+
+	counts, gauges := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counts["admission.shed-spans"])
+	assert.EqualValues(t, 0, counts["admission.rejected-batches"])
+	assert.EqualValues(t, 0, gauges["admission.overloaded"])
+}
+
+func TestAdmissionControllerStartStop(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	c := NewAdmissionController(AdmissionOptions{MaxGoroutines: 1}, zap.NewNop(), metricsFactory)
+	c.Start()
+	defer c.Stop()
+	// the load is read once on start
+	assert.True(t, c.Overloaded())
+	_, gauges := metricsFactory.Snapshot()
+	assert.True(t, gauges["admission.memory-bytes"] > 0)
+	assert.True(t, gauges["admission.goroutines"] > 0)
+	assert.EqualValues(t, 1, gauges["admission.overloaded"])
+}
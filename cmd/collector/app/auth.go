@@ -0,0 +1,257 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/uber/jaeger-lib/metrics"
+	"github.com/uber/tchannel-go/thrift"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/uber/jaeger/thrift-gen/jaeger"
+	zc "github.com/uber/jaeger/thrift-gen/zipkincore"
+)
+
+// AuthorizationHeader is the TChannel application header, and the HTTP header, carrying the bearer token
+// of the client submitting spans
+const AuthorizationHeader = "authorization"
+
+const (
+	bearerPrefix = "Bearer "
+
+	authReasonMissingCredentials = "missing-credentials"
+	authReasonMalformedToken     = "malformed-token"
+	authReasonInvalidToken       = "invalid-token"
+)
+
+var authReasons = []string{authReasonMissingCredentials, authReasonMalformedToken, authReasonInvalidToken}
+
+// ErrInvalidToken is returned by the static TokenValidator for unknown tokens
+var ErrInvalidToken = errors.New("Invalid token")
+
+// AuthError is returned by the handlers when the client submitting spans is not authenticated
+type AuthError struct {
+	// Reason is the reason the client was rejected, which the rejected requests are counted by
+	Reason string
+	// Err is the error returned by the TokenValidator, if any
+	Err error
+}
+
+func (e *AuthError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("Unauthenticated span submission (%s): %v", e.Reason, e.Err)
+	}
+	return fmt.Sprintf("Unauthenticated span submission (%s)", e.Reason)
+}
+
+// TokenValidator validates the bearer tokens presented by the clients submitting spans,
+// returning an error if the token is not valid
+type TokenValidator interface {
+	ValidateToken(token string) error
+}
+
+// NewStaticTokenValidator creates a TokenValidator accepting only the given tokens
+func NewStaticTokenValidator(tokens []string) TokenValidator {
+	validator := make(staticTokenValidator, len(tokens))
+	for i, token := range tokens {
+		validator[i] = []byte(token)
+	}
+	return validator
+}
+
+type staticTokenValidator [][]byte
+
+func (v staticTokenValidator) ValidateToken(token string) error {
+	// every token is compared, in constant time, so that the time taken does not tell which tokens are close
+	valid := 0
+	for _, t := range v {
+		valid |= subtle.ConstantTimeCompare(t, []byte(token))
+	}
+	if valid == 0 {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// LoadTokens reads a list of tokens, one per line, ignoring empty lines and lines starting with #
+func LoadTokens(r io.Reader) ([]string, error) {
+	var tokens []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tokens = append(tokens, line)
+	}
+	return tokens, scanner.Err()
+}
+
+// AuthOptions are the credentials accepted from the clients submitting spans
+type AuthOptions struct {
+	// TokenValidator validates the bearer tokens of the clients, tokens are not accepted if nil
+	TokenValidator TokenValidator
+	// ClientCertificates accepts the clients presenting a TLS client certificate verified by the server
+	ClientCertificates bool
+}
+
+type clientCertificatesKey struct{}
+
+// WithVerifiedChains returns a context carrying the verified TLS certificate chains of the client,
+// e.g. the tls.ConnectionState.VerifiedChains of an HTTP request.
+func WithVerifiedChains(ctx context.Context, chains [][]*x509.Certificate) context.Context {
+	return context.WithValue(ctx, clientCertificatesKey{}, chains)
+}
+
+// Authenticator rejects the span submissions of clients without valid credentials, which are
+// counted in the requests.unauthenticated metric by reason.
+type Authenticator struct {
+	options  AuthOptions
+	rejected map[string]metrics.Counter
+}
+
+// NewAuthenticator creates an Authenticator accepting the credentials of the options
+func NewAuthenticator(options AuthOptions, metricsFactory metrics.Factory) *Authenticator {
+	rejected := make(map[string]metrics.Counter, len(authReasons))
+	for _, reason := range authReasons {
+		rejected[reason] = metricsFactory.Counter("requests.unauthenticated", map[string]string{"reason": reason})
+	}
+	return &Authenticator{options: options, rejected: rejected}
+}
+
+// Authenticate returns an AuthError if the context of the request carries neither an accepted
+// TLS client certificate nor a valid bearer token in the AuthorizationHeader.
+func (a *Authenticator) Authenticate(ctx thrift.Context) error {
+	if err := a.authenticate(ctx); err != nil {
+		a.rejected[err.Reason].Inc(1)
+		return err
+	}
+	return nil
+}
+
+func (a *Authenticator) authenticate(ctx thrift.Context) *AuthError {
+	if ctx == nil {
+		return &AuthError{Reason: authReasonMissingCredentials}
+	}
+	if a.options.ClientCertificates {
+		if chains, ok := ctx.Value(clientCertificatesKey{}).([][]*x509.Certificate); ok && len(chains) > 0 {
+			return nil
+		}
+	}
+	header := ctx.Headers()[AuthorizationHeader]
+	if header == "" || a.options.TokenValidator == nil {
+		return &AuthError{Reason: authReasonMissingCredentials}
+	}
+	if !strings.HasPrefix(header, bearerPrefix) {
+		return &AuthError{Reason: authReasonMalformedToken}
+	}
+	if err := a.options.TokenValidator.ValidateToken(strings.TrimPrefix(header, bearerPrefix)); err != nil {
+		return &AuthError{Reason: authReasonInvalidToken, Err: err}
+	}
+	return nil
+}
+
+// JaegerBatchesHandler returns a JaegerBatchesHandler authenticating the requests before passing them to handler
+func (a *Authenticator) JaegerBatchesHandler(handler JaegerBatchesHandler) JaegerBatchesHandler {
+	return &authJaegerBatchesHandler{authenticator: a, handler: handler}
+}
+
+// ZipkinSpansHandler returns a ZipkinSpansHandler authenticating the requests before passing them to handler
+func (a *Authenticator) ZipkinSpansHandler(handler ZipkinSpansHandler) ZipkinSpansHandler {
+	return &authZipkinSpansHandler{authenticator: a, handler: handler}
+}
+
+// UnaryServerInterceptor returns a gRPC interceptor authenticating the unary calls, e.g. of the gRPC
+// Collect endpoint, with their authorization metadata and the verified TLS client certificates of the peer.
+// The calls of unauthenticated clients are rejected with codes.Unauthenticated.
+func (a *Authenticator) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := a.Authenticate(grpcAuthContext(ctx)); err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns a gRPC interceptor authenticating the streams, e.g. of the OpenCensus
+// receiver, like UnaryServerInterceptor does the unary calls.
+func (a *Authenticator) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := a.Authenticate(grpcAuthContext(stream.Context())); err != nil {
+			return status.Error(codes.Unauthenticated, err.Error())
+		}
+		return handler(srv, stream)
+	}
+}
+
+// grpcAuthContext returns the context of a gRPC call carrying its credentials the way the
+// TChannel and HTTP handlers carry them.
+func grpcAuthContext(ctx context.Context) thrift.Context {
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.VerifiedChains) > 0 {
+			ctx = WithVerifiedChains(ctx, tlsInfo.State.VerifiedChains)
+		}
+	}
+	headers := make(map[string]string)
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md[AuthorizationHeader]; len(values) > 0 {
+			headers[AuthorizationHeader] = values[0]
+		}
+	}
+	return thrift.WithHeaders(ctx, headers)
+}
+
+type authJaegerBatchesHandler struct {
+	authenticator *Authenticator
+	handler       JaegerBatchesHandler
+}
+
+func (h *authJaegerBatchesHandler) SubmitBatches(ctx thrift.Context, batches []*jaeger.Batch) ([]*jaeger.BatchSubmitResponse, error) {
+	if err := h.authenticator.Authenticate(ctx); err != nil {
+		return nil, err
+	}
+	return h.handler.SubmitBatches(ctx, batches)
+}
+
+type authZipkinSpansHandler struct {
+	authenticator *Authenticator
+	handler       ZipkinSpansHandler
+}
+
+func (h *authZipkinSpansHandler) SubmitZipkinBatch(ctx thrift.Context, spans []*zc.Span) ([]*zc.Response, error) {
+	if err := h.authenticator.Authenticate(ctx); err != nil {
+		return nil, err
+	}
+	return h.handler.SubmitZipkinBatch(ctx, spans)
+}
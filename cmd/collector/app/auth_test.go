@@ -0,0 +1,242 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	commonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+	tchanThrift "github.com/uber/tchannel-go/thrift"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/uber/jaeger/thrift-gen/jaeger"
+	"github.com/uber/jaeger/thrift-gen/zipkincore"
+)
+
+func withAuthorization(authorization string) tchanThrift.Context {
+	return tchanThrift.WithHeaders(context.Background(), map[string]string{AuthorizationHeader: authorization})
+}
+
+type rejectingTokenValidator struct{}
+
+func (rejectingTokenValidator) ValidateToken(token string) error {
+	return errors.New("expired")
+}
+
+func TestAuthenticator(t *testing.T) {
+	certContext := tchanThrift.WithHeaders(
+		WithVerifiedChains(context.Background(), [][]*x509.Certificate{{&x509.Certificate{}}}),
+		nil,
+	)
+	testCases := []struct {
+		caption       string
+		options       AuthOptions
+		ctx           tchanThrift.Context
+		expectedError string
+		reason        string
+	}{
+		{
+			caption: "valid token",
+			options: AuthOptions{TokenValidator: NewStaticTokenValidator([]string{"a", "b"})},
+			ctx:     withAuthorization("Bearer b"),
+		},
+		{
+			caption:       "unknown token",
+			options:       AuthOptions{TokenValidator: NewStaticTokenValidator([]string{"a", "b"})},
+			ctx:           withAuthorization("Bearer c"),
+			expectedError: "Unauthenticated span submission (invalid-token): Invalid token",
+			reason:        authReasonInvalidToken,
+		},
+		{
+			caption:       "token rejected by a custom validator",
+			options:       AuthOptions{TokenValidator: rejectingTokenValidator{}},
+			ctx:           withAuthorization("Bearer a"),
+			expectedError: "Unauthenticated span submission (invalid-token): expired",
+			reason:        authReasonInvalidToken,
+		},
+		{
+			caption:       "not a bearer token",
+			options:       AuthOptions{TokenValidator: NewStaticTokenValidator([]string{"a"})},
+			ctx:           withAuthorization("Basic a"),
+			expectedError: "Unauthenticated span submission (malformed-token)",
+			reason:        authReasonMalformedToken,
+		},
+		{
+			caption:       "no token",
+			options:       AuthOptions{TokenValidator: NewStaticTokenValidator([]string{"a"})},
+			ctx:           tchanThrift.WithHeaders(context.Background(), nil),
+			expectedError: "Unauthenticated span submission (missing-credentials)",
+			reason:        authReasonMissingCredentials,
+		},
+		{
+			caption:       "no context",
+			options:       AuthOptions{TokenValidator: NewStaticTokenValidator([]string{"a"})},
+			expectedError: "Unauthenticated span submission (missing-credentials)",
+			reason:        authReasonMissingCredentials,
+		},
+		{
+			caption:       "tokens not accepted",
+			options:       AuthOptions{ClientCertificates: true},
+			ctx:           withAuthorization("Bearer a"),
+			expectedError: "Unauthenticated span submission (missing-credentials)",
+			reason:        authReasonMissingCredentials,
+		},
+		{
+			caption: "client certificate",
+			options: AuthOptions{ClientCertificates: true},
+			ctx:     certContext,
+		},
+		{
+			caption:       "client certificates not accepted",
+			options:       AuthOptions{TokenValidator: NewStaticTokenValidator([]string{"a"})},
+			ctx:           certContext,
+			expectedError: "Unauthenticated span submission (missing-credentials)",
+			reason:        authReasonMissingCredentials,
+		},
+	}
+	for _, tc := range testCases {
+		testCase := tc
+		t.Run(testCase.caption, func(t *testing.T) {
+			metricsFactory := metrics.NewLocalFactory(0)
+			err := NewAuthenticator(testCase.options, metricsFactory).Authenticate(testCase.ctx)
+			counters, _ := metricsFactory.Snapshot()
+			if testCase.expectedError == "" {
+				assert.NoError(t, err)
+				for _, reason := range authReasons {
+					assert.EqualValues(t, 0, counters["requests.unauthenticated|reason="+reason])
+				}
+				return
+			}
+			assert.EqualError(t, err, testCase.expectedError)
+			assert.IsType(t, &AuthError{}, err)
+			assert.EqualValues(t, 1, counters["requests.unauthenticated|reason="+testCase.reason])
+		})
+	}
+}
+
+func TestAuthenticatedHandlers(t *testing.T) {
+	authenticator := NewAuthenticator(
+		AuthOptions{TokenValidator: NewStaticTokenValidator([]string{"secret"})},
+		metrics.NullFactory,
+	)
+	jHandler := &mockJaegerHandler{}
+	zHandler := &mockZipkinHandler{}
+	authJHandler := authenticator.JaegerBatchesHandler(jHandler)
+	authZHandler := authenticator.ZipkinSpansHandler(zHandler)
+
+	_, err := authJHandler.SubmitBatches(withAuthorization("Bearer wrong"), []*jaeger.Batch{{}})
+	assert.IsType(t, &AuthError{}, err)
+	_, err = authZHandler.SubmitZipkinBatch(withAuthorization("Bearer wrong"), []*zipkincore.Span{{}})
+	assert.IsType(t, &AuthError{}, err)
+	assert.Empty(t, jHandler.getBatches())
+	assert.Empty(t, zHandler.getSpans())
+
+	_, err = authJHandler.SubmitBatches(withAuthorization("Bearer secret"), []*jaeger.Batch{{}})
+	assert.NoError(t, err)
+	_, err = authZHandler.SubmitZipkinBatch(withAuthorization("Bearer secret"), []*zipkincore.Span{{}})
+	assert.NoError(t, err)
+	assert.Len(t, jHandler.getBatches(), 1)
+	assert.Len(t, zHandler.getSpans(), 1)
+}
+
+func TestAuthenticatedGRPCServers(t *testing.T) {
+	authenticator := NewAuthenticator(
+		AuthOptions{TokenValidator: NewStaticTokenValidator([]string{"secret"})},
+		metrics.NullFactory,
+	)
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(authenticator.UnaryServerInterceptor()),
+		grpc.StreamInterceptor(authenticator.StreamServerInterceptor()),
+	}
+	processor := &recordingProcessor{}
+	grpcListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	grpcServer := NewGRPCServer(NewGRPCHandler(zap.NewNop(), NewGRPCSpanHandler(zap.NewNop(), processor, metrics.NullFactory), ""), opts...)
+	go grpcServer.Serve(grpcListener)
+	defer grpcServer.Stop()
+	ocListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ocServer := NewOpenCensusServer(NewOpenCensusHandler(zap.NewNop(), processor), opts...)
+	go ocServer.Serve(ocListener)
+	defer ocServer.Stop()
+
+	grpcConn, err := grpc.Dial(grpcListener.Addr().String(), grpc.WithInsecure(), grpc.WithCodec(jsonCodec{}))
+	require.NoError(t, err)
+	defer grpcConn.Close()
+	ocConn, err := grpc.Dial(ocListener.Addr().String(), grpc.WithInsecure())
+	require.NoError(t, err)
+	defer ocConn.Close()
+
+	testCases := []struct {
+		authorization string
+		expectedCode  codes.Code
+	}{
+		{expectedCode: codes.Unauthenticated},
+		{authorization: "Bearer wrong", expectedCode: codes.Unauthenticated},
+		{authorization: "Bearer secret", expectedCode: codes.OK},
+	}
+	for _, testCase := range testCases {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		if testCase.authorization != "" {
+			ctx = metadata.NewOutgoingContext(ctx, metadata.Pairs(AuthorizationHeader, testCase.authorization))
+		}
+
+		err := grpc.Invoke(ctx, grpcFullCollect, makeGRPCRequest(), &CollectResponse{}, grpcConn)
+		assert.Equal(t, testCase.expectedCode, status.Code(err), "gRPC with %q", testCase.authorization)
+
+		stream, err := agenttracepb.NewTraceServiceClient(ocConn).Export(ctx)
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(&agenttracepb.ExportTraceServiceRequest{
+			Node:  &commonpb.Node{ServiceInfo: &commonpb.ServiceInfo{Name: "svc"}},
+			Spans: makeOpenCensusSpans(),
+		}))
+		require.NoError(t, stream.CloseSend())
+		_, err = stream.Recv()
+		if testCase.expectedCode == codes.OK {
+			assert.Error(t, err) // io.EOF once the server returns
+		} else {
+			assert.Equal(t, testCase.expectedCode, status.Code(err), "OpenCensus with %q", testCase.authorization)
+		}
+		cancel()
+	}
+	// the spans of the one authenticated gRPC call and OpenCensus stream
+	assert.Len(t, processor.spans, 2)
+}
+
+func TestLoadTokens(t *testing.T) {
+	tokens, err := LoadTokens(strings.NewReader("# comment\n  token-1 \n\ntoken-2\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"token-1", "token-2"}, tokens)
+}
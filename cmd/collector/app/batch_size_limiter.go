@@ -0,0 +1,178 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/uber/jaeger-lib/metrics"
+	"github.com/uber/tchannel-go"
+	"github.com/uber/tchannel-go/thrift"
+
+	"github.com/uber/jaeger/thrift-gen/jaeger"
+)
+
+// BatchSizePolicy is what happens to the Jaeger batches of more spans than the maximum
+type BatchSizePolicy string
+
+const (
+	// SplitOversizedBatches splits the oversized batches into batches of the maximum size
+	SplitOversizedBatches BatchSizePolicy = "split"
+	// RejectOversizedBatches rejects the requests with oversized batches with a bad request error
+	RejectOversizedBatches BatchSizePolicy = "reject"
+)
+
+// batchSizeBuckets are the upper bounds of the buckets of the batches.size histogram
+var batchSizeBuckets = []int{1, 10, 50, 100, 500, 1000, 5000}
+
+// ParseBatchSizePolicy returns the BatchSizePolicy with the given name, empty meaning SplitOversizedBatches
+func ParseBatchSizePolicy(name string) (BatchSizePolicy, error) {
+	switch policy := BatchSizePolicy(name); policy {
+	case "":
+		return SplitOversizedBatches, nil
+	case SplitOversizedBatches, RejectOversizedBatches:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("Unknown batch size policy %q", name)
+	}
+}
+
+// BatchSizeOptions configure a BatchSizeLimiter
+type BatchSizeOptions struct {
+	// MaxSpans is the maximum number of spans of a batch, batches are not limited if 0
+	MaxSpans int
+	// Policy is what happens to the batches of more spans, SplitOversizedBatches if empty
+	Policy BatchSizePolicy
+}
+
+// BatchSizeLimiter limits the number of spans of the Jaeger batches, splitting or rejecting the larger ones.
+// The received batches are counted by number of spans in the batches.size histogram, counters tagged with
+// the upper bound le of their bucket, and the oversized ones in the batches.split or batches.rejected counter.
+type BatchSizeLimiter struct {
+	options  BatchSizeOptions
+	sizes    []metrics.Counter
+	split    metrics.Counter
+	rejected metrics.Counter
+}
+
+// NewBatchSizeLimiter creates a BatchSizeLimiter counting the batches in the metrics factory
+func NewBatchSizeLimiter(options BatchSizeOptions, metricsFactory metrics.Factory) *BatchSizeLimiter {
+	if options.Policy == "" {
+		options.Policy = SplitOversizedBatches
+	}
+	sizes := make([]metrics.Counter, len(batchSizeBuckets)+1)
+	for i, bound := range batchSizeBuckets {
+		sizes[i] = metricsFactory.Counter("batches.size", map[string]string{"le": strconv.Itoa(bound)})
+	}
+	sizes[len(batchSizeBuckets)] = metricsFactory.Counter("batches.size", map[string]string{"le": "inf"})
+	return &BatchSizeLimiter{
+		options:  options,
+		sizes:    sizes,
+		split:    metricsFactory.Counter("batches.split", nil),
+		rejected: metricsFactory.Counter("batches.rejected", nil),
+	}
+}
+
+// JaegerBatchesHandler returns a JaegerBatchesHandler limiting the size of the batches before passing them
+// to handler. The response to a split batch is ok only if the responses to all its parts are.
+func (l *BatchSizeLimiter) JaegerBatchesHandler(handler JaegerBatchesHandler) JaegerBatchesHandler {
+	return &batchSizeJaegerBatchesHandler{limiter: l, handler: handler}
+}
+
+func (l *BatchSizeLimiter) observe(size int) {
+	for i, bound := range batchSizeBuckets {
+		if size <= bound {
+			l.sizes[i].Inc(1)
+			return
+		}
+	}
+	l.sizes[len(batchSizeBuckets)].Inc(1)
+}
+
+func (l *BatchSizeLimiter) oversized(batch *jaeger.Batch) bool {
+	return l.options.MaxSpans > 0 && len(batch.Spans) > l.options.MaxSpans
+}
+
+// splitBatch returns the parts of the batch of at most the maximum number of spans, sharing its process
+func (l *BatchSizeLimiter) splitBatch(batch *jaeger.Batch) []*jaeger.Batch {
+	parts := make([]*jaeger.Batch, 0, (len(batch.Spans)+l.options.MaxSpans-1)/l.options.MaxSpans)
+	for start := 0; start < len(batch.Spans); start += l.options.MaxSpans {
+		end := start + l.options.MaxSpans
+		if end > len(batch.Spans) {
+			end = len(batch.Spans)
+		}
+		parts = append(parts, &jaeger.Batch{Process: batch.Process, Spans: batch.Spans[start:end]})
+	}
+	return parts
+}
+
+type batchSizeJaegerBatchesHandler struct {
+	limiter *BatchSizeLimiter
+	handler JaegerBatchesHandler
+}
+
+func (h *batchSizeJaegerBatchesHandler) SubmitBatches(ctx thrift.Context, batches []*jaeger.Batch) ([]*jaeger.BatchSubmitResponse, error) {
+	oversized := 0
+	for _, batch := range batches {
+		h.limiter.observe(len(batch.Spans))
+		if h.limiter.oversized(batch) {
+			oversized++
+		}
+	}
+	if oversized == 0 {
+		return h.handler.SubmitBatches(ctx, batches)
+	}
+	if h.limiter.options.Policy == RejectOversizedBatches {
+		h.limiter.rejected.Inc(int64(oversized))
+		return nil, tchannel.NewSystemError(tchannel.ErrCodeBadRequest,
+			"%d batches of more than %d spans", oversized, h.limiter.options.MaxSpans)
+	}
+	h.limiter.split.Inc(int64(oversized))
+	// parts are the batches passed to the handler, and owners the indexes of the batches they are parts of
+	parts := make([]*jaeger.Batch, 0, len(batches)+oversized)
+	owners := make([]int, 0, cap(parts))
+	for i, batch := range batches {
+		if !h.limiter.oversized(batch) {
+			parts = append(parts, batch)
+			owners = append(owners, i)
+			continue
+		}
+		for _, part := range h.limiter.splitBatch(batch) {
+			parts = append(parts, part)
+			owners = append(owners, i)
+		}
+	}
+	partResponses, err := h.handler.SubmitBatches(ctx, parts)
+	if err != nil {
+		return nil, err
+	}
+	responses := make([]*jaeger.BatchSubmitResponse, len(batches))
+	for i := range responses {
+		responses[i] = &jaeger.BatchSubmitResponse{Ok: true}
+	}
+	for i, response := range partResponses {
+		if i < len(owners) && !response.Ok {
+			responses[owners[i]].Ok = false
+		}
+	}
+	return responses, nil
+}
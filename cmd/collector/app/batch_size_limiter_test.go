@@ -0,0 +1,135 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+	"github.com/uber/tchannel-go"
+	tchanThrift "github.com/uber/tchannel-go/thrift"
+
+	"github.com/uber/jaeger/thrift-gen/jaeger"
+)
+
+// failingBatchesHandler records the batches it is passed, failing those of the failing service
+type failingBatchesHandler struct {
+	failingService string
+	batches        []*jaeger.Batch
+}
+
+func (h *failingBatchesHandler) SubmitBatches(ctx tchanThrift.Context, batches []*jaeger.Batch) ([]*jaeger.BatchSubmitResponse, error) {
+	h.batches = append(h.batches, batches...)
+	responses := make([]*jaeger.BatchSubmitResponse, len(batches))
+	for i, batch := range batches {
+		responses[i] = &jaeger.BatchSubmitResponse{Ok: batch.Process.ServiceName != h.failingService}
+	}
+	return responses, nil
+}
+
+func makeBatch(serviceName string, spans int) *jaeger.Batch {
+	batch := &jaeger.Batch{Process: &jaeger.Process{ServiceName: serviceName}}
+	for i := 0; i < spans; i++ {
+		batch.Spans = append(batch.Spans, &jaeger.Span{SpanId: int64(i + 1)})
+	}
+	return batch
+}
+
+func TestBatchSizeLimiterSplit(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	handler := &failingBatchesHandler{failingService: "failing"}
+	limiter := NewBatchSizeLimiter(BatchSizeOptions{MaxSpans: 2}, metricsFactory)
+
+	responses, err := limiter.JaegerBatchesHandler(handler).SubmitBatches(nil, []*jaeger.Batch{
+		makeBatch("large", 5),
+		makeBatch("small", 2),
+		makeBatch("failing", 3),
+	})
+	require.NoError(t, err)
+	require.Len(t, responses, 3)
+	assert.True(t, responses[0].Ok)
+	assert.True(t, responses[1].Ok)
+	assert.False(t, responses[2].Ok)
+
+	require.Len(t, handler.batches, 6)
+	var sizes []int
+	for _, batch := range handler.batches {
+		sizes = append(sizes, len(batch.Spans))
+	}
+	assert.Equal(t, []int{2, 2, 1, 2, 2, 1}, sizes)
+	assert.Equal(t, "large", handler.batches[2].Process.ServiceName)
+	assert.EqualValues(t, 5, handler.batches[2].Spans[0].SpanId)
+
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counts["batches.split"])
+	assert.EqualValues(t, 3, counts["batches.size|le=10"])
+}
+
+func TestBatchSizeLimiterReject(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	handler := &failingBatchesHandler{}
+	limiter := NewBatchSizeLimiter(BatchSizeOptions{MaxSpans: 2, Policy: RejectOversizedBatches}, metricsFactory)
+	jHandler := limiter.JaegerBatchesHandler(handler)
+
+	_, err := jHandler.SubmitBatches(nil, []*jaeger.Batch{makeBatch("large", 3), makeBatch("small", 1)})
+	assert.Equal(t, tchannel.ErrCodeBadRequest, tchannel.GetSystemErrorCode(err))
+	assert.Contains(t, err.Error(), "1 batches of more than 2 spans")
+	assert.Empty(t, handler.batches)
+
+	responses, err := jHandler.SubmitBatches(nil, []*jaeger.Batch{makeBatch("small", 2)})
+	require.NoError(t, err)
+	require.Len(t, responses, 1)
+	assert.True(t, responses[0].Ok)
+	assert.Len(t, handler.batches, 1)
+
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["batches.rejected"])
+	assert.EqualValues(t, 1, counts["batches.size|le=1"])
+	assert.EqualValues(t, 2, counts["batches.size|le=10"])
+}
+
+func TestBatchSizeLimiterHistogram(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	limiter := NewBatchSizeLimiter(BatchSizeOptions{}, metricsFactory)
+	_, err := limiter.JaegerBatchesHandler(&failingBatchesHandler{}).SubmitBatches(nil, []*jaeger.Batch{
+		makeBatch("a", 50),
+		makeBatch("b", 51),
+		makeBatch("c", 5001),
+	})
+	require.NoError(t, err)
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["batches.size|le=50"])
+	assert.EqualValues(t, 1, counts["batches.size|le=100"])
+	assert.EqualValues(t, 1, counts["batches.size|le=inf"])
+	assert.EqualValues(t, 0, counts["batches.split"])
+}
+
+func TestParseBatchSizePolicy(t *testing.T) {
+	for name, expected := range map[string]BatchSizePolicy{"": SplitOversizedBatches, "split": SplitOversizedBatches, "reject": RejectOversizedBatches} {
+		policy, err := ParseBatchSizePolicy(name)
+		require.NoError(t, err)
+		assert.Equal(t, expected, policy)
+	}
+	_, err := ParseBatchSizePolicy("drop")
+	assert.EqualError(t, err, `Unknown batch size policy "drop"`)
+}
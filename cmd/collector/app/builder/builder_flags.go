@@ -25,6 +25,10 @@ import (
 	"time"
 
 	"github.com/uber/jaeger/cmd/collector/app"
+	"github.com/uber/jaeger/cmd/collector/app/sampling"
+	"github.com/uber/jaeger/storage/spanstore/batch"
+	"github.com/uber/jaeger/storage/spanstore/compaction"
+	"github.com/uber/jaeger/storage/spanstore/wal"
 )
 
 var (
@@ -32,10 +36,252 @@ var (
 	QueueSize = flag.Int("collector.queue-size", app.DefaultQueueSize, "The queue size of the collector")
 	// NumWorkers is the number of internal workers in a collector
 	NumWorkers = flag.Int("collector.num-workers", app.DefaultNumWorkers, "The number of workers pulling items from the queue")
+	// QueueHighWaterMark is the fraction of the queue capacity from which span batches are rejected as busy
+	QueueHighWaterMark = flag.Float64("collector.queue.high-water-mark", 0, "The fraction of the queue capacity, between 0 and 1, from which span batches are rejected as busy (TChannel error code Busy, HTTP status 429) so that agents back off. Disabled if 0")
+	// QueueLowWaterMark is the fraction of the queue capacity below which span batches are accepted again
+	QueueLowWaterMark = flag.Float64("collector.queue.low-water-mark", 0, "The fraction of the queue capacity below which span batches are accepted again once the high-water mark was reached. Same as the high-water mark if 0")
+	// AdmissionMaxMemory is the memory held by the collector from which spans are not all admitted
+	AdmissionMaxMemory = flag.Uint64("collector.admission.max-memory", 0, "The memory held by the collector, in bytes, from which span batches are rejected as busy or spans are shed. Not limited if 0")
+	// AdmissionMaxGoroutines is the number of goroutines of the collector from which spans are not all admitted
+	AdmissionMaxGoroutines = flag.Int("collector.admission.max-goroutines", 0, "The number of goroutines of the collector from which span batches are rejected as busy or spans are shed. Not limited if 0")
+	// AdmissionShedRatio is the fraction of the traces dropped while the collector is overloaded
+	AdmissionShedRatio = flag.Float64("collector.admission.shed-ratio", 0, "The fraction of the traces, between 0 and 1, whose spans are dropped while the collector is beyond collector.admission.max-memory or collector.admission.max-goroutines. The span batches are rejected as busy instead if 0")
+	// DroppedSpansBufferSize is the number of dropped spans retained for diagnostics
+	DroppedSpansBufferSize = flag.Int("collector.dropped-spans.buffer-size", 0, "The number of spans dropped by the collector retained for diagnostics, served at /debug/dropped-spans on the admin HTTP port. Not retained if 0")
+	// WorkerPoolSize is the number of workers of the resizable pool saving the queued spans
+	WorkerPoolSize = flag.Int("collector.worker-pool-size", 0, "The number of workers saving the queued spans to storage, resizable at runtime up to 10 times that size with PUT /debug/workers?size=N on the admin HTTP port. The fixed collector.num-workers workers are used if 0")
+	// SamplingSeed is the seed of the hash of the trace IDs sampled by the collector
+	SamplingSeed = flag.Uint64("collector.sampling-seed", 0, "The seed of the FNV-1a hash of the trace IDs sampled by the span quotas and the dropped span sampler, for reproducible decisions shared by the collectors with the same seed. The low 64 bits of the trace IDs modulo 10000 are used if 0")
+	// DroppedSpansSampleRate is the fraction of the traces whose dropped spans are retained
+	DroppedSpansSampleRate = flag.Float64("collector.dropped-spans.sample-rate", app.DefaultDroppedSpansSampleRate, "The fraction of the traces, between 0 and 1, whose spans dropped by the collector are retained")
+	// AdmissionCheckInterval is the time between two readings of the load of the collector
+	AdmissionCheckInterval = flag.Duration("collector.admission.check-interval", app.DefaultAdmissionCheckInterval, "How often the memory and goroutines of the collector are read for admission control")
 	// WriteCacheTTL denotes how often to check and re-write a service or operation name
 	WriteCacheTTL = flag.Duration("collector.write-cache-ttl", time.Hour*12, "The duration to wait before rewriting an existing service or operation name")
 	// CollectorPort is the port that the collector service listens in on for tchannel requests
 	CollectorPort = flag.Int("collector.port", 14267, "The tchannel port for the collector service")
 	// CollectorHTTPPort is the port that the collector service listens in on for http requests
 	CollectorHTTPPort = flag.Int("collector.http-port", 14268, "The http port for the collector service")
+	// CollectorHTTPMaxDecompressedSize is the size in bytes beyond which compressed HTTP request bodies are rejected
+	CollectorHTTPMaxDecompressedSize = flag.Int64("collector.http.max-decompressed-size", app.DefaultMaxDecompressedSize, "The size in bytes beyond which gzip-compressed HTTP request bodies are rejected once decompressed")
+	// CollectorZipkinHTTPPath is the path of the HTTP endpoint accepting Zipkin v2 JSON and Zipkin Thrift spans
+	CollectorZipkinHTTPPath = flag.String("collector.zipkin.http-path", app.DefaultZipkinPath, "The path of the HTTP endpoint accepting Zipkin v2 JSON (application/json) and Zipkin Thrift (application/x-thrift) spans. Disabled if empty")
+	// CollectorJSONHTTPPath is the path of the HTTP endpoint accepting spans in the JSON model of the query API
+	CollectorJSONHTTPPath = flag.String("collector.json.http-path", "", "The path of the HTTP endpoint accepting a JSON array of spans in the JSON model of the query API, each with its process, e.g. /api/v1/spans. Disabled if empty")
+	// ZipkinFollowsFromSpanKinds are the span kinds of the Zipkin spans following from their parent
+	ZipkinFollowsFromSpanKinds = flag.String("collector.zipkin.follows-from-span-kinds", "", "Comma-separated span.kind values, e.g. consumer, of the Zipkin spans referencing their parent as FOLLOWS_FROM rather than CHILD_OF")
+	// ZipkinFollowsFromAnnotations are the annotations of the Zipkin spans following from their parent
+	ZipkinFollowsFromAnnotations = flag.String("collector.zipkin.follows-from-annotations", "", "Comma-separated annotation values or binary annotation keys, e.g. mr, of the Zipkin spans referencing their parent as FOLLOWS_FROM rather than CHILD_OF")
+	// CollectorHTTPTLSCert is the certificate the HTTP, gRPC and OpenCensus endpoints are served with over TLS
+	CollectorHTTPTLSCert = flag.String("collector.http.tls.cert", "", "The PEM certificate file to serve the HTTP, gRPC and OpenCensus endpoints over TLS with. Plaintext if empty")
+	// CollectorHTTPTLSKey is the private key of CollectorHTTPTLSCert
+	CollectorHTTPTLSKey = flag.String("collector.http.tls.key", "", "The PEM private key file of the TLS certificate of the HTTP endpoints")
+	// CollectorHTTPTLSClientCA is the CA verifying the client certificates presented to the HTTP endpoints
+	CollectorHTTPTLSClientCA = flag.String("collector.http.tls.client-ca", "", "The PEM CA certificates file verifying the TLS client certificates presented to the HTTP endpoints")
+	// CollectorHTTPTLSRequireClientCert rejects the TLS clients of the HTTP endpoints without a verified certificate
+	CollectorHTTPTLSRequireClientCert = flag.Bool("collector.http.tls.require-client-cert", false, "Whether to reject the TLS clients of the HTTP endpoints without a certificate verified by collector.http.tls.client-ca, for mutual TLS")
+	// CollectorHTTPTLSCipherSuites are the cipher suites accepted by the HTTP endpoints over TLS
+	CollectorHTTPTLSCipherSuites = flag.String("collector.http.tls.cipher-suites", "", "Comma-separated names of the cipher suites accepted by the HTTP endpoints over TLS, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. The Go defaults if empty")
+	// CollectorHTTPTLSMinVersion is the minimum TLS version accepted by the HTTP endpoints
+	CollectorHTTPTLSMinVersion = flag.String("collector.http.tls.min-version", "", "The minimum TLS version accepted by the HTTP endpoints, 1.0, 1.1 or 1.2. The Go default if empty")
+	// CollectorHTTPTLSReloadInterval is how often the TLS certificate files of the HTTP endpoints are checked for changes
+	CollectorHTTPTLSReloadInterval = flag.Duration("collector.http.tls.reload-interval", 0, "How often the TLS certificate and key files of the HTTP endpoints are checked for changes, to serve the rotated certificate without a restart. Never if 0")
+	// AuthTokensFile is the file with the bearer tokens accepted from the clients submitting spans
+	AuthTokensFile = flag.String("collector.auth.tokens-file", "", "The file with the bearer tokens, one per line, accepted in the authorization header, or gRPC metadata, of span submissions. Tokens are not required if empty")
+	// AuthClientCertificates accepts the span submissions of clients with a verified TLS certificate
+	AuthClientCertificates = flag.Bool("collector.auth.client-certificates", false, "Whether to require span submissions to present a bearer token or a TLS client certificate verified by collector.http.tls.client-ca, which is only available over HTTP")
+	// CollectorGRPCEnabled enables the gRPC span ingestion endpoint
+	CollectorGRPCEnabled = flag.Bool("collector.grpc.enabled", false, "Whether to accept spans over gRPC, in the JSON model of the query service encoded in JSON")
+	// CollectorGRPCPort is the port that the collector service listens in on for gRPC requests
+	CollectorGRPCPort = flag.Int("collector.grpc-port", 14250, "The gRPC port for the collector service")
+	// KafkaBrokers is the comma-separated list of Kafka brokers used when span storage type is kafka
+	KafkaBrokers = flag.String("kafka.brokers", "127.0.0.1:9092", "The comma-separated list of Kafka brokers")
+	// KafkaTopic is the Kafka topic spans are produced to when span storage type is kafka
+	KafkaTopic = flag.String("kafka.topic", "jaeger-spans", "The Kafka topic to produce spans to")
+	// CollectorOpenCensusEnabled enables the OpenCensus span receiver
+	CollectorOpenCensusEnabled = flag.Bool("collector.opencensus.enabled", false, "Whether to accept spans from OpenCensus exporters")
+	// CollectorOpenCensusPort is the port the OpenCensus receiver listens on
+	CollectorOpenCensusPort = flag.Int("collector.opencensus-port", 55678, "The gRPC port for the OpenCensus receiver")
+	// CollectorAdminHTTPHostPort is the address the admin HTTP server listens on
+	CollectorAdminHTTPHostPort = flag.String("collector.admin-http-host-port", "localhost:14269", "The host:port of the admin HTTP server serving the /debug endpoints, only reachable from the host itself by default")
+	// CollectorOTLPEnabled enables the OTLP/HTTP span receiver
+	CollectorOTLPEnabled = flag.Bool("collector.otlp.enabled", false, "Whether to accept spans exported with OTLP over HTTP by OpenTelemetry SDKs")
+	// CollectorOTLPHTTPPort is the port the OTLP/HTTP receiver listens on
+	CollectorOTLPHTTPPort = flag.Int("collector.otlp-http-port", 4318, "The HTTP port for the OTLP receiver, serving "+app.OTLPTracesPath)
+	// TagsAllowList is the comma-separated list of the only span tags kept by the collector
+	TagsAllowList = flag.String("collector.tags.allow-list", "", "The comma-separated list of the only span tags, process tags and log fields to store, all of them are stored if empty")
+	// TagsDenyList is the comma-separated list of span tags dropped by the collector
+	TagsDenyList = flag.String("collector.tags.deny-list", "", "The comma-separated list of span tags, process tags and log fields to drop before storing spans")
+	// TagsMaxValueLength is the length beyond which span tag values are truncated
+	TagsMaxValueLength = flag.Int("collector.tags.max-value-length", 0, "The maximum length of span tag, process tag and log field values, longer values are truncated. Disabled if 0")
+	// RateLimitsFile is the JSON file with the spans per second accepted from each service, reloaded on SIGHUP
+	RateLimitsFile = flag.String("collector.rate-limits.file", "", "The JSON file with the default and per-service rates of spans per second to accept, a rate of 0 being unlimited, reloaded on SIGHUP. Disabled if empty")
+	// SpanQuotasFile is the JSON file with the spans accepted from each service each day, reloaded on SIGHUP
+	SpanQuotasFile = flag.String("collector.span-quotas.file", "", "The JSON file with the default and per-service numbers of spans to accept each day, reloaded on SIGHUP. Disabled if empty")
+	// SpanQuotasMode is what happens to the spans beyond the quota of their service
+	SpanQuotasMode = flag.String("collector.span-quotas.mode", string(app.DropOverQuota), "What happens to the spans beyond the daily quota of their service: drop them, tag them with quota.exceeded, or sample them down by trace")
+	// SpanQuotasSampleRate is the fraction of the traces beyond the quota of their service kept in the sample mode
+	SpanQuotasSampleRate = flag.Float64("collector.span-quotas.sample-rate", 0.1, "The fraction of the traces beyond the daily quota of their service kept in the sample mode")
+	// SpanQuotasResetTime is the time of day in UTC at which the usage of all services is reset
+	SpanQuotasResetTime = flag.String("collector.span-quotas.reset-time", "00:00", "The time of day in UTC, as HH:MM, at which the daily usage of all services is reset")
+	// TagMappingsFile is the JSON file with the tag keys and values to normalize, reloaded on SIGHUP
+	TagMappingsFile = flag.String("collector.tag-mappings.file", "", "The JSON file with the span and process tag keys to rename and tag values to rewrite, reloaded on SIGHUP. Disabled if empty")
+	// HTTPStatusRulesFile is the JSON file with the tags of the HTTP status codes of each service, reloaded on SIGHUP
+	HTTPStatusRulesFile = flag.String("collector.http-status-rules.file", "", "The JSON file with the default and per-service span tag keys the HTTP status codes are read from, consolidated into an integer http.status_code tag with error=true for 5xx responses, reloaded on SIGHUP. Disabled if empty")
+	// ServiceAliasesFile is the JSON file with the new names of services, reloaded on SIGHUP
+	ServiceAliasesFile = flag.String("collector.service-aliases.file", "", "The JSON file with the new names of services keyed by their old names, the old names being kept in the original.service span tag, reloaded on SIGHUP. Disabled if empty")
+	// OperationNameRulesFile is the JSON file with the rules deriving operation names from span tags, reloaded on SIGHUP
+	OperationNameRulesFile = flag.String("collector.operation-name-rules.file", "", "The JSON file with the rules of each service deriving the operation names matching a pattern from a span tag, reloaded on SIGHUP. Disabled if empty")
+	// SamplingRulesFile is the JSON file with the rules forcing spans to be kept by their tags, reloaded on SIGHUP
+	SamplingRulesFile = flag.String("collector.sampling-rules.file", "", "The JSON file with the named rules forcing the spans with a tag, or a tag value, to be kept by the tail and quota sampling, reloaded on SIGHUP. Disabled if empty")
+	// CompositeSamplingFile is the JSON file with the ordered sub-samplers whose verdicts are combined to keep traces, reloaded on SIGHUP
+	CompositeSamplingFile = flag.String("collector.composite-sampling.file", "", "The JSON file with the ordered list of named probabilistic, rate limiting and tag sub-samplers, and whether the traces kept by any or all of them are kept by the tail sampling, which it requires, reloaded on SIGHUP. Disabled if empty")
+	// SamplingDecisionCacheSize is the number of traces whose composite sampling decision is remembered
+	SamplingDecisionCacheSize = flag.Int("collector.composite-sampling.cache-size", app.DefaultSamplingDecisionCacheSize, "The number of traces whose composite sampling decision is remembered, so that the later spans of a trace are kept or dropped like its first span")
+	// SamplingDecisionCacheTTL is how long the composite sampling decision of a trace is remembered
+	SamplingDecisionCacheTTL = flag.Duration("collector.composite-sampling.cache-ttl", app.DefaultSamplingDecisionCacheTTL, "How long the composite sampling decision of a trace is remembered")
+	// DropRulesFile is the JSON file with the rules dropping the spans of infrastructure components, reloaded on SIGHUP
+	DropRulesFile = flag.String("collector.drop-rules.file", "", "The JSON file with the named rules dropping the spans with a service name prefix, a tag, or a tag value, e.g. the spans of service mesh sidecars, reloaded on SIGHUP. Disabled if empty")
+	// SchemaRulesFile is the JSON file with the rules of the tags required on the spans, reloaded on SIGHUP
+	SchemaRulesFile = flag.String("collector.schema-rules.file", "", "The JSON file with the named rules requiring the spans of services to carry a tag, optionally with a value matching a pattern, e.g. the team owning the service, reloaded on SIGHUP. Disabled if empty")
+	// SchemaViolationMode is what happens to the spans violating a schema rule
+	SchemaViolationMode = flag.String("collector.schema-rules.mode", string(app.RejectSchemaViolations), "What happens to the spans violating a schema rule: reject drops them, tag keeps them tagged with schema.violations")
+	// MaxSpanSize is the estimated size in bytes beyond which spans are rejected
+	MaxSpanSize = flag.Int("collector.max-span-size", app.DefaultMaxSpanSize, "The estimated serialized size in bytes beyond which spans are rejected before being stored. Unlimited if negative")
+	// MaxBatchSpans is the number of spans beyond which Jaeger Thrift batches are split or rejected
+	MaxBatchSpans = flag.Int("collector.max-batch-spans", 0, "The number of spans of the Jaeger Thrift batches beyond which they are split or rejected. Unlimited if 0")
+	// MaxBatchSpansPolicy is what happens to the Jaeger Thrift batches of more spans than the maximum
+	MaxBatchSpansPolicy = flag.String("collector.max-batch-spans.policy", string(app.SplitOversizedBatches), "What happens to the Jaeger Thrift batches of more spans than collector.max-batch-spans: split them into batches of the maximum size, or reject the requests submitting them")
+	// DeduplicationWindow is the number of recently seen spans the collector drops duplicates of
+	DeduplicationWindow = flag.Int("collector.dedup.window-size", 0, "The number of recently seen (trace ID, span ID, span kind) keys to drop duplicate spans of. Disabled if 0")
+	// FutureSpanTolerance is the time spans can start after the clock of the collector
+	FutureSpanTolerance = flag.Duration("collector.future-spans.tolerance", 0, "The time spans can start after the clock of the collector, the spans starting later being dropped or clamped. Disabled if 0")
+	// FutureSpanMode is what happens to the spans starting later than the tolerance
+	FutureSpanMode = flag.String("collector.future-spans.mode", string(app.DropFutureSpans), "What happens to the spans starting later than collector.future-spans.tolerance: drop them, or clamp them to start now tagged with start_time.clamped_us")
+	// SpanIDCollisionMode is what happens to the spans sharing the span ID of another span of their trace
+	SpanIDCollisionMode = flag.String("collector.span-id-collisions.mode", "", "What happens to the spans sharing their span ID with a different span of their trace: tag them with span.id.collision, or reassign them a span ID derived from their content. Disabled if empty")
+	// SpanIDCollisionWindow is the number of recently seen spans whose span IDs are checked for collisions
+	SpanIDCollisionWindow = flag.Int("collector.span-id-collisions.window-size", app.DefaultSpanIDCollisionWindow, "The number of recently seen spans whose (trace ID, span ID) pairs are checked for collisions")
+	// TraceSpanLimit is the number of spans kept for each trace
+	TraceSpanLimit = flag.Int("collector.trace-span-limit", 0, "The number of spans of each trace kept within collector.trace-span-limit.window, the others being dropped and the trace tagged with trace.truncated. Unlimited if 0")
+	// TraceSpanLimitWindow is the time the spans of a trace are counted for
+	TraceSpanLimitWindow = flag.Duration("collector.trace-span-limit.window", app.DefaultTraceSpanLimitWindow, "The time the spans of a trace are counted for from its first span by collector.trace-span-limit")
+	// SpanSerialization is the format spans are serialized to by the Cassandra and ElasticSearch writers
+	SpanSerialization = flag.String("collector.span-serialization", "none", "The format spans are serialized to before being stored in Cassandra or ElasticSearch, one of [none, thrift, json, protobuf]")
+	// ProcessCompactionEnabled makes the Cassandra and ElasticSearch writers store the process of the spans of a trace once
+	ProcessCompactionEnabled = flag.Bool("collector.process-compaction.enabled", false, "Whether to store the process of the spans of a trace once in Cassandra or ElasticSearch, the other spans of the trace referencing it")
+	// ProcessCompactionMaxProcesses is the number of processes of traces remembered by the process compaction
+	ProcessCompactionMaxProcesses = flag.Int("collector.process-compaction.max-processes", compaction.DefaultMaxProcesses, "The number of distinct processes of traces remembered by collector.process-compaction.enabled, the least recently used ones being stored again")
+	// SpanMetricsEnabled enables the request, error and duration metrics derived from the spans
+	SpanMetricsEnabled = flag.Bool("collector.span-metrics.enabled", false, "Whether to emit request, error and duration metrics of each service and operation derived from the spans")
+	// SamplingDecisionsEnabled enables the tagging of spans with the reason they were sampled
+	SamplingDecisionsEnabled = flag.Bool("collector.sampling-decisions.enabled", false, "Whether to tag spans with the reason they were sampled, as sampling.head and sampling.tail, the latter being \"duration\" for the unsampled spans lasting at least the tail sampling duration threshold, so that traces can be searched by sampling reason")
+	// MaxOperationsPerService is the number of distinct operation names of a service beyond which spans are collapsed
+	MaxOperationsPerService = flag.Int("collector.operation-cardinality.max-per-service", 0, "The number of distinct operation names of a service beyond which the spans of new operations are renamed to the placeholder. Disabled if 0")
+	// OperationPlaceholder is the operation name of the collapsed spans
+	OperationPlaceholder = flag.String("collector.operation-cardinality.placeholder", app.DefaultOperationPlaceholder, "The operation name given to the spans of operations beyond collector.operation-cardinality.max-per-service")
+	// CorrelationTagKey is the key of the tag carrying the trace ID of each span for log correlation
+	CorrelationTagKey = flag.String("collector.correlation-tag.key", "", "The key of a tag added to each span with its trace ID, so that logs can be joined with the spans. Spans that already have the tag keep it. Disabled if empty")
+	// CorrelationTagFormat is how the trace ID is written in the correlation tag
+	CorrelationTagFormat = flag.String("collector.correlation-tag.format", string(app.HexCorrelation), "How the trace ID is written in the tag of collector.correlation-tag.key: hex (32 zero-padded lower-case digits) or decimal")
+	// CollectorHostnameTag is the key of the tag added to each span with the host name of the collector
+	CollectorHostnameTag = flag.String("collector.tags.hostname-key", "", "The key of a tag added to each span with the host name of the collector storing it, e.g. collector.hostname. Spans that already have the tag keep it. Disabled if empty")
+	// CollectorTags are the tags added to each span with the metadata of the collector
+	CollectorTags = flag.String("collector.tags", "", "The comma-separated key=value tags added to each span with the metadata of the collector storing it, e.g. region=us-east-1,collector.version=1.0. Spans that already have a tag keep it. Disabled if empty")
+	// EnrichmentURL is the URL the metadata of each service is requested from
+	EnrichmentURL = flag.String("collector.enrichment.url", "", "The URL the metadata of a service added as tags to its spans is requested from, {service} being replaced by the service name, e.g. http://metadata/services/{service}. The response is a JSON object of string values. Disabled if empty")
+	// EnrichmentTagKeys are the keys of the metadata added to the spans
+	EnrichmentTagKeys = flag.String("collector.enrichment.tag-keys", "", "The comma-separated keys of the metadata added as tags to the spans, all of them if empty")
+	// EnrichmentCacheTTL is how long the metadata of a service is cached
+	EnrichmentCacheTTL = flag.Duration("collector.enrichment.cache-ttl", 5*time.Minute, "How long the metadata of a service, or the failure to get it, is cached")
+	// EnrichmentCacheSize is the number of services whose metadata is cached
+	EnrichmentCacheSize = flag.Int("collector.enrichment.cache-size", app.DefaultEnrichmentCacheSize, "The number of services whose metadata is cached, the least recently used ones being evicted beyond it")
+	// EnrichmentTimeout is the timeout of the requests for the metadata of a service
+	EnrichmentTimeout = flag.Duration("collector.enrichment.timeout", time.Second, "The timeout of the requests for the metadata of a service")
+	// TenancyHeader is the header carrying the tenant of the submitted spans
+	TenancyHeader = flag.String("collector.tenancy.header", "", "The TChannel or HTTP header, or gRPC metadata, carrying the tenant of the submitted spans, which are stored under service names scoped to their tenant. TChannel clients must send it in lower case")
+	// TenancyTag is the span or process tag carrying the tenant of the spans
+	TenancyTag = flag.String("collector.tenancy.tag", "", "The span or process tag carrying the tenant of the spans, if collector.tenancy.header is empty. Multi-tenancy is disabled if both are empty")
+	// HealthCheckInterval is how often the collector probes the span storage
+	HealthCheckInterval = flag.Duration("collector.health-check.interval", app.DefaultHealthCheckInterval, "How often to probe the span storage for the health check served on /health")
+	// HealthCheckFailureThreshold is the number of consecutive failed probes after which the collector reports unhealthy
+	HealthCheckFailureThreshold = flag.Int("collector.health-check.failure-threshold", app.DefaultHealthCheckFailureThreshold, "The number of consecutive failed probes of the span storage after which the collector is unhealthy")
+	// HealthCheckSuccessThreshold is the number of consecutive successful probes after which the collector reports healthy again
+	HealthCheckSuccessThreshold = flag.Int("collector.health-check.success-threshold", app.DefaultHealthCheckSuccessThreshold, "The number of consecutive successful probes of the span storage after which an unhealthy collector is healthy again")
+	// CollectorShutdownTimeout is how long the collector keeps saving queued spans when shutting down
+	CollectorShutdownTimeout = flag.Duration("collector.shutdown-timeout", 30*time.Second, "How long to keep saving queued spans when shutting down, the remaining ones are dropped")
+	// CollectorDryRun makes the collector process spans without writing them to storage
+	CollectorDryRun = flag.Bool("collector.dry-run", false, "Whether to process spans without writing them to storage, for load testing")
+	// AsyncWriterBufferSize is the number of spans buffered before being written to storage
+	AsyncWriterBufferSize = flag.Int("collector.async-writer.buffer-size", 0, "The number of spans buffered by workers writing them to storage, so that saving a span does not wait for the storage. Disabled if 0")
+	// AsyncWriterNumWorkers is the number of goroutines writing buffered spans to storage
+	AsyncWriterNumWorkers = flag.Int("collector.async-writer.num-workers", 10, "The number of workers writing buffered spans to storage")
+	// AsyncWriterBlockWhenFull makes saving a span wait for room in a full buffer instead of dropping the span
+	AsyncWriterBlockWhenFull = flag.Bool("collector.async-writer.block-when-full", false, "Whether saving a span waits for room in a full buffer instead of dropping the span")
+	// TraceBatchingWindow is the time the spans of a trace are held to be written together to storage
+	TraceBatchingWindow = flag.Duration("collector.trace-batching.window", 0, "The time the spans of a trace are held from its first span to be written together to storage, improving the locality of Cassandra writes. Spans arriving later are written individually. Disabled if 0")
+	// TraceBatchingMaxSize is the number of spans of a trace written together before the end of the window
+	TraceBatchingMaxSize = flag.Int("collector.trace-batching.max-size", 100, "The number of spans of a trace written together before the end of the batching window, unbounded if 0")
+	// TraceBatchingMaxPendingSpans is the number of spans held for their trace
+	TraceBatchingMaxPendingSpans = flag.Int("collector.trace-batching.max-pending-spans", batch.DefaultMaxPendingSpans, "The number of spans held for the batch of their trace. Beyond it, the batch of a span is written right away by the worker handling it, slowing ingestion down instead of buffering more spans")
+	// TraceBatchingFlushers is the number of batches written at the same time
+	TraceBatchingFlushers = flag.Int("collector.trace-batching.flushers", batch.DefaultFlushers, "The number of trace batches written to storage at the same time at the end of their window")
+	// TailSamplingWindow is the time the spans of a trace are held before deciding whether to keep it
+	TailSamplingWindow = flag.Duration("collector.tail-sampling.window", 0, "The time the spans of a trace are held from its first span before deciding whether to keep it. Traces not sampled by the clients are dropped unless a span lasts at least the duration threshold. Disabled if 0")
+	// TailSamplingDurationThreshold is the duration from which a span keeps its trace though it was not sampled
+	TailSamplingDurationThreshold = flag.Duration("collector.tail-sampling.duration-threshold", time.Second, "The duration from which a span keeps its trace though it was not sampled by the client, only sampled traces are kept if 0")
+	// TailSamplingRequireRoot drops the traces whose root span is not received within the tail sampling window
+	TailSamplingRequireRoot = flag.Bool("collector.tail-sampling.require-root", false, "Drop the traces whose root span, the span without a parent nor a reference to another span of its trace, is not received within the tail sampling window, with all their late spans")
+	// CircuitBreakerFailureThreshold is the number of consecutive failed span writes stopping the writes to storage
+	CircuitBreakerFailureThreshold = flag.Int("collector.circuit-breaker.failure-threshold", 0, "The number of consecutive failed span writes after which the spans are no longer written to storage for the open period. Disabled if 0")
+	// CircuitBreakerLatencyThreshold is the duration from which span writes count as failed
+	CircuitBreakerLatencyThreshold = flag.Duration("collector.circuit-breaker.latency-threshold", 0, "The duration from which span writes count as failed for the circuit breaker, even when they succeed. Not counted if 0")
+	// CircuitBreakerOpenPeriod is the time the spans are not written to storage once the circuit breaker opened
+	CircuitBreakerOpenPeriod = flag.Duration("collector.circuit-breaker.open-period", 30*time.Second, "The time the spans are not written to storage once the circuit breaker opened, before a span is written to probe the storage")
+	// CircuitBreakerFallbackSize is the number of spans kept while the circuit breaker is open
+	CircuitBreakerFallbackSize = flag.Int("collector.circuit-breaker.fallback-size", 0, "The number of spans kept while the circuit breaker is open, to be written once it closes. The spans are rejected if 0")
+	// WriteDeadlines is the comma-separated list of storageType=timeout deadlines of the span writes
+	WriteDeadlines = flag.String("collector.write-deadlines", "", "The comma-separated list of storageType=timeout deadlines of the span writes, e.g. cassandra=2s,elasticsearch=5s, after which the spans are dropped so that a stalled storage does not block the collector. Disabled if empty")
+	// WALDirectory is the directory of the write-ahead log recording spans until they are saved
+	WALDirectory = flag.String("collector.wal.directory", "", "The directory of the write-ahead log recording accepted spans until they are saved, so that the spans lost by a crash are saved on the next start. Disabled if empty")
+	// WALSegmentSize is the size in bytes beyond which the write-ahead log starts a new segment
+	WALSegmentSize = flag.Int64("collector.wal.segment-size", wal.DefaultSegmentSize, "The size in bytes of the write-ahead log segments, which are removed once all of their spans are saved, the others being saved again on the next start")
+	// WALMaxSize is the size in bytes of the write-ahead log beyond which spans are rejected
+	WALMaxSize = flag.Int64("collector.wal.max-size", 0, "The size in bytes of the write-ahead log segments beyond which spans are rejected. Unlimited if 0")
+	// WALSyncWrites flushes each span to disk before accepting it
+	WALSyncWrites = flag.Bool("collector.wal.sync-writes", false, "Whether to flush each span to disk before accepting it, so that spans also survive a crash of the host, at the cost of throughput")
+	// NATSServers is the comma-separated list of NATS servers the span batches are consumed from
+	NATSServers = flag.String("collector.nats.servers", "", "The comma-separated list of NATS servers to consume Jaeger Thrift span batches from with a JetStream subscription. Disabled if empty")
+	// NATSSubject is the subject of the subscribed JetStream stream
+	NATSSubject = flag.String("collector.nats.subject", "jaeger.spans", "The NATS subject the span batches are published to")
+	// NATSQueue is the queue group sharing the messages between the collectors
+	NATSQueue = flag.String("collector.nats.queue", "", "The queue group of the collectors, each message being consumed by one collector of the group. Each collector consumes all the messages if empty")
+	// NATSDurable is the name of the durable JetStream consumer
+	NATSDurable = flag.String("collector.nats.durable", "jaeger-collector", "The name of the durable JetStream consumer, which resumes from the last acknowledged message when the collectors restart. Ephemeral if empty")
+	// NATSAckWait is the time after which the unacknowledged messages are redelivered
+	NATSAckWait = flag.Duration("collector.nats.ack-wait", 0, "The time after which the messages whose spans are not saved yet are redelivered. The server default if 0")
+	// NATSMaxAckPending is the maximum number of messages consumed but not acknowledged yet
+	NATSMaxAckPending = flag.Int("collector.nats.max-ack-pending", 0, "The maximum number of messages whose spans are not saved yet, beyond which the consumption is paused. The server default if 0")
+	// NATSUsername is the user name authenticating to the NATS servers
+	NATSUsername = flag.String("collector.nats.username", "", "The user name to authenticate to the NATS servers with")
+	// NATSPassword is the password authenticating to the NATS servers
+	NATSPassword = flag.String("collector.nats.password", "", "The password to authenticate to the NATS servers with")
+	// NATSCredentialsFile is the file of the user JWT and NKey seed authenticating to the NATS servers
+	NATSCredentialsFile = flag.String("collector.nats.credentials-file", "", "The path of the credentials file, with the user JWT and NKey seed, to authenticate to the NATS servers with")
+	// PrometheusEnabled exposes the collector metrics to Prometheus, in addition to expvar
+	PrometheusEnabled = flag.Bool("collector.prometheus.enabled", false, "Whether to serve the collector metrics in the Prometheus exposition format, in addition to expvar")
+	// PrometheusHTTPPath is the path of the HTTP endpoint Prometheus scrapes the collector metrics from
+	PrometheusHTTPPath = flag.String("collector.prometheus.http-path", "/metrics", "The path of the HTTP endpoint serving the collector metrics to Prometheus")
+	// PrometheusBuckets are the buckets of the Prometheus histograms of latencies
+	PrometheusBuckets = flag.String("collector.prometheus.buckets", "", "The comma-separated, increasing buckets in seconds of the Prometheus histograms of latencies, e.g. of writes to storage. The Prometheus defaults if empty")
+	// AdaptiveSamplingEnabled enables the calculation of per-operation sampling probabilities from the observed throughput
+	AdaptiveSamplingEnabled = flag.Bool("collector.adaptive-sampling.enabled", false, "Whether to calculate per-operation sampling probabilities served to agents")
+	// AdaptiveSamplingTargetSpansPerSecond is the number of spans per second each operation should be sampled at
+	AdaptiveSamplingTargetSpansPerSecond = flag.Float64("collector.adaptive-sampling.target-spans-per-second", sampling.DefaultTargetSpansPerSecond, "The number of spans per second each operation should be sampled at")
+	// AdaptiveSamplingCalculationInterval is how often the sampling probabilities are recalculated
+	AdaptiveSamplingCalculationInterval = flag.Duration("collector.adaptive-sampling.calculation-interval", sampling.DefaultCalculationInterval, "How often the sampling probabilities are recalculated")
+	// SamplingStrategiesFile is the JSON file of the static sampling strategies served to agents
+	SamplingStrategiesFile = flag.String("collector.sampling-strategies.file", "", "The JSON file of the sampling strategies served to agents, which cannot be used with adaptive sampling. No strategies are served if empty")
+	// SamplingStrategiesReloadInterval is how often the static sampling strategies file is checked for changes
+	SamplingStrategiesReloadInterval = flag.Duration("collector.sampling-strategies.reload-interval", sampling.DefaultReloadInterval, "How often the sampling strategies file is checked for changes to reload, never if 0")
 )
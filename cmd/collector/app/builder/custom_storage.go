@@ -0,0 +1,61 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package builder
+
+import (
+	"io"
+
+	basicB "github.com/uber/jaeger/cmd/builder"
+	"github.com/uber/jaeger/cmd/collector/app"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+// customStorageBuilder writes the spans to the third-party writer of builder.Options.CustomStorageOption
+type customStorageBuilder struct {
+	handlerBuilder
+	writer spanstore.Writer
+}
+
+func newCustomStorageBuilder(options basicB.BasicOptions) *customStorageBuilder {
+	return &customStorageBuilder{
+		handlerBuilder: handlerBuilder{options: options},
+		writer:         options.CustomSpanWriter,
+	}
+}
+
+func (c *customStorageBuilder) BuildHandlers() (app.ZipkinSpansHandler, app.JaegerBatchesHandler, error) {
+	spanStore, err := c.buildSpanWriter()
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.buildHandlers(spanStore)
+}
+
+func (c *customStorageBuilder) buildSpanWriter() (spanstore.Writer, error) {
+	if prober, ok := c.writer.(spanstore.Prober); ok {
+		c.probe = prober.Probe
+	}
+	// closing the writer flushes the spans it buffers
+	if closer, ok := c.writer.(io.Closer); ok {
+		c.closers = append(c.closers, closer)
+	}
+	return c.writer, nil
+}
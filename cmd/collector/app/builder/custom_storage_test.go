@@ -0,0 +1,100 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package builder
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/jaeger/cmd/builder"
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/storage/spanstore/memory"
+)
+
+// thirdPartyWriter is a span writer of a storage unknown to the collector, which can be probed and closed
+type thirdPartyWriter struct {
+	*memory.Store
+	probeErr error
+	closed   bool
+}
+
+func (w *thirdPartyWriter) Probe() error {
+	return w.probeErr
+}
+
+func (w *thirdPartyWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestNewSpanHandlerBuilderCustomStorage(t *testing.T) {
+	originalArgs := os.Args
+	defer func() {
+		os.Args = originalArgs
+	}()
+	// the storage type of the flags is bypassed
+	os.Args = []string{"test", "--span-storage.type=cassandra"}
+	flag.Parse()
+	writer := &thirdPartyWriter{Store: memory.NewStore(), probeErr: errors.New("unreachable")}
+	handler, err := NewSpanHandlerBuilder(
+		builder.Options.CustomStorageOption(writer, writer),
+		builder.Options.HealthCheckOption(time.Hour, 1, 1),
+	)
+	require.NoError(t, err)
+	assert.IsType(t, &customStorageBuilder{}, handler)
+
+	zHandler, jHandler, err := handler.BuildHandlers()
+	require.NoError(t, err)
+	assert.NotNil(t, zHandler)
+	assert.NotNil(t, jHandler)
+
+	healthCheck := handler.HealthCheck()
+	require.NotNil(t, healthCheck)
+	assert.False(t, healthCheck.Probe())
+
+	_, err = handler.Close(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, writer.closed)
+}
+
+func TestCustomStorageBuilderPlainWriter(t *testing.T) {
+	store := memory.NewStore()
+	cBuilder := newCustomStorageBuilder(builder.ApplyOptions(builder.Options.CustomStorageOption(store, store)))
+	spanWriter, err := cBuilder.buildSpanWriter()
+	require.NoError(t, err)
+	assert.Equal(t, store, spanWriter)
+	assert.Nil(t, cBuilder.healthProbe())
+	// the memory store is closed too, since it implements io.Closer
+	assert.Len(t, cBuilder.closers, 1)
+
+	span := &model.Span{TraceID: model.TraceID{Low: 1}, Process: &model.Process{ServiceName: "svc"}}
+	require.NoError(t, spanWriter.WriteSpan(span))
+	services, err := store.GetServices()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"svc"}, services)
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package builder
+
+import (
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	basicB "github.com/uber/jaeger/cmd/builder"
+	"github.com/uber/jaeger/cmd/collector/app"
+	"github.com/uber/jaeger/model"
+)
+
+// dryRunWriter is a span writer that never touches storage, it only counts the spans
+// and logs the sampled ones at debug level.
+type dryRunWriter struct {
+	logger  *zap.Logger
+	metrics dryRunMetrics
+}
+
+type dryRunMetrics struct {
+	// Spans counts the spans that would have been written to storage
+	Spans metrics.Counter `metric:"dry-run.spans"`
+}
+
+func newDryRunWriter(logger *zap.Logger, metricsFactory metrics.Factory) *dryRunWriter {
+	w := &dryRunWriter{logger: logger}
+	metrics.Init(&w.metrics, metricsFactory, nil)
+	return w
+}
+
+func (w *dryRunWriter) WriteSpan(span *model.Span) error {
+	w.metrics.Spans.Inc(1)
+	if span.Flags.IsSampled() {
+		w.logger.Debug("Dry run, skipping sampled span",
+			zap.String("trace_id", span.TraceID.String()),
+			zap.String("span_id", span.SpanID.String()),
+			zap.String("operation_name", span.OperationName))
+	}
+	return nil
+}
+
+type dryRunBuilder struct {
+	handlerBuilder
+}
+
+func newDryRunBuilder(options basicB.BasicOptions) *dryRunBuilder {
+	return &dryRunBuilder{
+		handlerBuilder: handlerBuilder{options: options},
+	}
+}
+
+func (d *dryRunBuilder) BuildHandlers() (app.ZipkinSpansHandler, app.JaegerBatchesHandler, error) {
+	return d.buildHandlers(newDryRunWriter(d.options.Logger, d.options.MetricsFactory))
+}
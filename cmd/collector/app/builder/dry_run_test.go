@@ -0,0 +1,71 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package builder
+
+import (
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/cmd/builder"
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/pkg/testutils"
+)
+
+func TestNewSpanHandlerBuilderDryRun(t *testing.T) {
+	originalArgs := os.Args
+	defer func() {
+		os.Args = originalArgs
+	}()
+	os.Args = []string{"test", "--span-storage.type=cassandra"}
+	flag.Parse()
+	handler, err := NewSpanHandlerBuilder(builder.Options.DryRunOption(true))
+	assert.NoError(t, err)
+	assert.IsType(t, &dryRunBuilder{}, handler)
+
+	zHandler, jHandler, err := handler.BuildHandlers()
+	assert.NoError(t, err)
+	assert.NotNil(t, zHandler)
+	assert.NotNil(t, jHandler)
+}
+
+func TestDryRunWriter(t *testing.T) {
+	logger, logBuffer := testutils.NewLogger()
+	metricsFactory := metrics.NewLocalFactory(0)
+	writer := newDryRunWriter(logger, metricsFactory)
+
+	assert.NoError(t, writer.WriteSpan(&model.Span{OperationName: "not-sampled"}))
+	sampled := &model.Span{
+		TraceID:       model.TraceID{Low: 1},
+		SpanID:        model.SpanID(2),
+		OperationName: "sampled",
+	}
+	sampled.Flags.SetSampled()
+	assert.NoError(t, writer.WriteSpan(sampled))
+
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counts["dry-run.spans"])
+	assert.Contains(t, logBuffer.String(), `"operation_name":"sampled"`)
+	assert.NotContains(t, logBuffer.String(), "not-sampled")
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package builder
+
+import (
+	"context"
+
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	basicB "github.com/uber/jaeger/cmd/builder"
+	"github.com/uber/jaeger/cmd/collector/app"
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/storage/spanstore"
+	"github.com/uber/jaeger/storage/spanstore/async"
+)
+
+// fanOutWriter writes spans to a primary writer and, best-effort, to secondary writers.
+// Only the primary writer's error is returned. The spans are queued for each secondary writer
+// in a bounded buffer, so that a slow secondary storage neither delays the primary writes nor
+// the other secondary storages, the spans being dropped and counted when its buffer is full.
+type fanOutWriter struct {
+	logger      *zap.Logger
+	primary     spanstore.Writer
+	secondaries []secondaryWriter
+}
+
+type secondaryWriter struct {
+	storageType string
+	writer      *async.Writer
+	metrics     secondaryWriterMetrics
+}
+
+type secondaryWriterMetrics struct {
+	// Writes counts the spans queued to be written to the secondary storage
+	Writes metrics.Counter `metric:"writes"`
+	// Errors counts the spans dropped because the queue of the secondary storage was full, the
+	// failed writes being counted by the async writer
+	Errors metrics.Counter `metric:"errors"`
+}
+
+func (w *fanOutWriter) WriteSpan(span *model.Span) error {
+	err := w.primary.WriteSpan(span)
+	for i := range w.secondaries {
+		secondary := &w.secondaries[i]
+		if secondaryErr := secondary.writer.WriteSpan(span); secondaryErr != nil {
+			secondary.metrics.Errors.Inc(1)
+			w.logger.Error("Failed to queue span for secondary storage",
+				zap.String("storage_type", secondary.storageType),
+				zap.Error(secondaryErr))
+		} else {
+			secondary.metrics.Writes.Inc(1)
+		}
+	}
+	return err
+}
+
+// fanOutBuilder builds handlers that write each span to all configured storage types,
+// the first one being the primary.
+type fanOutBuilder struct {
+	handlerBuilder
+	storageTypes []string
+	builders     []storageBuilder
+}
+
+func newFanOutBuilder(storageTypes []string, builders []storageBuilder, options basicB.BasicOptions) *fanOutBuilder {
+	return &fanOutBuilder{
+		handlerBuilder: handlerBuilder{options: options},
+		storageTypes:   storageTypes,
+		builders:       builders,
+	}
+}
+
+func (f *fanOutBuilder) BuildHandlers() (app.ZipkinSpansHandler, app.JaegerBatchesHandler, error) {
+	primary, err := f.builders[0].buildSpanWriter()
+	if err != nil {
+		return nil, nil, err
+	}
+	// the collector is only healthy if the primary storage is, secondary storage is best-effort
+	f.probe = f.builders[0].healthProbe()
+	primary = f.withWriteDeadline(f.storageTypes[0], primary)
+	writer := &fanOutWriter{logger: f.options.Logger, primary: primary}
+	for i, b := range f.builders[1:] {
+		storageType := f.storageTypes[i+1]
+		secondary, err := b.buildSpanWriter()
+		if err != nil {
+			return nil, nil, err
+		}
+		secondary = f.withWriteDeadline(storageType, secondary)
+		metricsFactory := f.options.MetricsFactory.Namespace("secondary-storage", map[string]string{"type": storageType})
+		sw := secondaryWriter{
+			storageType: storageType,
+			writer: async.NewWriter(secondary, async.Options{
+				BufferSize: app.DefaultQueueSize,
+				NumWorkers: app.DefaultNumWorkers,
+			}, f.options.Logger, metricsFactory),
+		}
+		metrics.Init(&sw.metrics, metricsFactory, nil)
+		// closed after the span processor is drained, and before the secondary storage
+		f.closers = append(f.closers, sw.writer)
+		writer.secondaries = append(writer.secondaries, sw)
+	}
+	return f.buildHandlers(writer)
+}
+
+func (f *fanOutBuilder) Close(ctx context.Context) (int, error) {
+	dropped, lastErr := f.handlerBuilder.Close(ctx)
+	for _, b := range f.builders {
+		if _, err := b.Close(ctx); err != nil {
+			lastErr = err
+		}
+	}
+	return dropped, lastErr
+}
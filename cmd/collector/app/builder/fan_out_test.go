@@ -0,0 +1,143 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package builder
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/cmd/builder"
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/storage/spanstore/async"
+	"github.com/uber/jaeger/storage/spanstore/memory"
+)
+
+type errorWriter struct{}
+
+func (errorWriter) WriteSpan(*model.Span) error {
+	return errors.New("storage unavailable")
+}
+
+// blockedWriter holds the writes until it is released
+type blockedWriter struct {
+	release chan struct{}
+}
+
+func (w blockedWriter) WriteSpan(*model.Span) error {
+	<-w.release
+	return nil
+}
+
+func TestFanOutWriter(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	primary := memory.NewStore()
+	secondary := memory.NewStore()
+	slow := blockedWriter{release: make(chan struct{})}
+	writer := &fanOutWriter{
+		logger:  zap.NewNop(),
+		primary: primary,
+		secondaries: []secondaryWriter{
+			{storageType: "slow", writer: async.NewWriter(slow, async.Options{BufferSize: 1}, zap.NewNop(), metricsFactory)},
+			{storageType: "memory", writer: async.NewWriter(secondary, async.Options{BufferSize: 10}, zap.NewNop(), metricsFactory)},
+		},
+	}
+	metrics.Init(&writer.secondaries[0].metrics, metricsFactory, map[string]string{"type": "slow"})
+	metrics.Init(&writer.secondaries[1].metrics, metricsFactory, map[string]string{"type": "memory"})
+
+	for i := uint64(1); i <= 3; i++ {
+		span := &model.Span{TraceID: model.TraceID{Low: i}, Process: &model.Process{ServiceName: "svc"}}
+		require.NoError(t, writer.WriteSpan(span), "a slow secondary storage must not block the primary writes")
+		_, err := primary.GetTrace(span.TraceID)
+		assert.NoError(t, err)
+	}
+	close(slow.release)
+	require.NoError(t, writer.secondaries[0].writer.Close())
+	require.NoError(t, writer.secondaries[1].writer.Close())
+	for i := uint64(1); i <= 3; i++ {
+		_, err := secondary.GetTrace(model.TraceID{Low: i})
+		assert.NoError(t, err, "a slow secondary storage must not prevent writes to the others")
+	}
+
+	counts, _ := metricsFactory.Snapshot()
+	assert.True(t, counts["errors|type=slow"] >= 1, "the spans exceeding the queue of the slow storage are dropped")
+	assert.EqualValues(t, 3, counts["writes|type=slow"]+counts["errors|type=slow"])
+	assert.EqualValues(t, 3, counts["writes|type=memory"])
+
+	writer.primary = errorWriter{}
+	writer.secondaries = writer.secondaries[:0]
+	assert.EqualError(t, writer.WriteSpan(&model.Span{Process: &model.Process{ServiceName: "svc"}}), "storage unavailable")
+}
+
+func TestNewSpanHandlerBuilderMultipleStorageTypes(t *testing.T) {
+	originalArgs := os.Args
+	defer func() {
+		os.Args = originalArgs
+	}()
+	defer func() {
+		// the flags keep the last parsed storage types, which must not leak to the other tests
+		os.Args = []string{"test", "--span-storage.type=cassandra"}
+		flag.Parse()
+	}()
+	os.Args = []string{"test", "--span-storage.type=memory, memory"}
+	flag.Parse()
+	handler, err := NewSpanHandlerBuilder(builder.Options.MemoryStoreOption(memory.NewStore()))
+	require.NoError(t, err)
+	fanOut, ok := handler.(*fanOutBuilder)
+	require.True(t, ok)
+	assert.Len(t, fanOut.builders, 2)
+
+	zHandler, jHandler, err := handler.BuildHandlers()
+	assert.NoError(t, err)
+	assert.NotNil(t, zHandler)
+	assert.NotNil(t, jHandler)
+	dropped, err := handler.Close(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, dropped)
+
+	os.Args = []string{"test", "--span-storage.type=memory,cassandra"}
+	flag.Parse()
+	_, err = NewSpanHandlerBuilder(builder.Options.MemoryStoreOption(memory.NewStore()))
+	assert.EqualError(t, err, "Cassandra not configured")
+}
+
+func TestFanOutBuilderHealthCheckUsesPrimary(t *testing.T) {
+	options := builder.ApplyOptions(builder.Options.HealthCheckOption(time.Hour, 1, 1))
+	primary := newMemoryStoreBuilder(memory.NewStore(), options)
+	primary.probe = func() error { return errors.New("storage unavailable") }
+	secondary := newMemoryStoreBuilder(memory.NewStore(), options)
+	secondary.probe = func() error { return nil }
+	fanOut := newFanOutBuilder([]string{"memory", "memory"}, []storageBuilder{primary, secondary}, options)
+
+	_, _, err := fanOut.BuildHandlers()
+	require.NoError(t, err)
+	defer fanOut.Close(context.Background())
+	require.NotNil(t, fanOut.HealthCheck())
+	assert.False(t, fanOut.HealthCheck().Probe())
+}
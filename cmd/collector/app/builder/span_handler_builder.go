@@ -21,106 +21,598 @@
 package builder
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"time"
 
-	"go.uber.org/zap"
+	"github.com/Shopify/sarama"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
-	"github.com/uber/jaeger-lib/metrics"
 	basicB "github.com/uber/jaeger/cmd/builder"
 	"github.com/uber/jaeger/cmd/collector/app"
+	"github.com/uber/jaeger/cmd/collector/app/sampling"
+	"github.com/uber/jaeger/cmd/collector/app/sanitizer"
 	zs "github.com/uber/jaeger/cmd/collector/app/sanitizer/zipkin"
 	"github.com/uber/jaeger/cmd/flags"
 	"github.com/uber/jaeger/model"
+	zipkinConv "github.com/uber/jaeger/model/converter/thrift/zipkin"
+	badgercfg "github.com/uber/jaeger/pkg/badger/config"
 	"github.com/uber/jaeger/pkg/cassandra"
 	cascfg "github.com/uber/jaeger/pkg/cassandra/config"
+	casMetrics "github.com/uber/jaeger/pkg/cassandra/metrics"
+	casRetry "github.com/uber/jaeger/pkg/cassandra/retry"
 	"github.com/uber/jaeger/pkg/es"
 	escfg "github.com/uber/jaeger/pkg/es/config"
+	kafkacfg "github.com/uber/jaeger/pkg/kafka/config"
+	pgcfg "github.com/uber/jaeger/pkg/postgres/config"
+	badgerSpanstore "github.com/uber/jaeger/plugin/storage/badger/spanstore"
 	casSpanstore "github.com/uber/jaeger/plugin/storage/cassandra/spanstore"
+	casDbmodel "github.com/uber/jaeger/plugin/storage/cassandra/spanstore/dbmodel"
 	esSpanstore "github.com/uber/jaeger/plugin/storage/es/spanstore"
+	kafkaSpanstore "github.com/uber/jaeger/plugin/storage/kafka/spanstore"
+	pgSpanstore "github.com/uber/jaeger/plugin/storage/postgres/spanstore"
 	"github.com/uber/jaeger/storage/spanstore"
+	"github.com/uber/jaeger/storage/spanstore/async"
+	"github.com/uber/jaeger/storage/spanstore/batch"
+	"github.com/uber/jaeger/storage/spanstore/breaker"
+	"github.com/uber/jaeger/storage/spanstore/compaction"
+	"github.com/uber/jaeger/storage/spanstore/deadline"
 	"github.com/uber/jaeger/storage/spanstore/memory"
+	"github.com/uber/jaeger/storage/spanstore/tailsampling"
+	"github.com/uber/jaeger/storage/spanstore/tenancy"
+	"github.com/uber/jaeger/storage/spanstore/wal"
+	tSampling "github.com/uber/jaeger/thrift-gen/sampling"
 )
 
 var (
 	errMissingCassandraConfig     = errors.New("Cassandra not configured")
 	errMissingMemoryStore         = errors.New("MemoryStore is not provided")
 	errMissingElasticSearchConfig = errors.New("ElasticSearch not configured")
+	errMissingKafkaConfig         = errors.New("Kafka not configured")
+	errMissingBadgerConfig        = errors.New("Badger not configured")
+	errMissingPostgresConfig      = errors.New("PostgreSQL not configured")
+	// the asynchronous writer returns before spans are saved, which would remove them from the log too early
+	errWALWithAsyncWriter = errors.New("The write-ahead log cannot be used with the asynchronous writer")
+	// for the same reason, the batched spans are not saved when they are written
+	errWALWithTraceBatching = errors.New("The write-ahead log cannot be used with trace batching")
+	// and the spans held for tail sampling
+	errWALWithTailSampling = errors.New("The write-ahead log cannot be used with tail sampling")
+	// and the spans the circuit breaker holds while the storage is unavailable
+	errWALWithCircuitBreaker = errors.New("The write-ahead log cannot be used with the circuit breaker")
+	// and the spans buffered by the bulk writer of ElasticSearch, which are only stored once flushed
+	errWALWithElasticSearch = errors.New("The write-ahead log cannot be used with ElasticSearch")
+	// the NATS messages are acknowledged once their spans are written, which these writers return before
+	errNATSWithBufferingWriter = errors.New("NATS ingestion cannot be used with the asynchronous writer, trace batching, tail sampling or the circuit breaker")
+	// the composite sampling only marks spans as sampled, which nothing but the tail sampling reads
+	errCompositeSamplingWithoutTailSampling = errors.New("The composite sampling requires tail sampling")
+	// the OpenCensus requests do not pass their headers to the handlers, so their tenant cannot be trusted
+	errTenantHeaderWithoutHeaders = errors.New("The tenant cannot be read from a header with OpenCensus ingestion enabled")
+	errStaticWithAdaptiveSampling = errors.New("The static sampling strategies cannot be used with adaptive sampling")
+)
+
+const (
+	esHealthTimeout = 5 * time.Second
 )
 
 // SpanHandlerBuilder builds span (Jaeger and zipkin) handlers
 type SpanHandlerBuilder interface {
 	BuildHandlers() (app.ZipkinSpansHandler, app.JaegerBatchesHandler, error)
+	// SamplingManager returns the manager serving adaptive or static sampling strategies to the agents,
+	// or nil if neither is enabled. It is only available after BuildHandlers.
+	SamplingManager() tSampling.TChanSamplingManager
+	// GRPCHandler returns the handler for spans submitted over gRPC, or nil if gRPC ingestion
+	// is not enabled. It shares the span processor of the Thrift handlers and is only available
+	// after BuildHandlers.
+	GRPCHandler() app.GRPCCollector
+	// OpenCensusReceiver returns the receiver for spans exported by OpenCensus libraries, or nil if
+	// it is not enabled. It shares the span processor of the Thrift handlers and is only available
+	// after BuildHandlers.
+	OpenCensusReceiver() app.OpenCensusReceiver
+	// OTLPReceiver returns the receiver for spans exported with OTLP over HTTP, or nil if it is not
+	// enabled. It shares the span processor of the Thrift handlers and is only available after BuildHandlers.
+	OTLPReceiver() *app.OTLPReceiver
+	// RateLimiter returns the limiter of spans accepted from each service, which can be updated
+	// while the collector runs, or nil if rate limiting is not enabled. It is only available after BuildHandlers.
+	RateLimiter() *app.ServiceRateLimiter
+	// SpanQuotaEnforcer returns the enforcer of the daily quotas of spans of each service, whose quotas can be
+	// updated while the collector runs, or nil if quotas are not enabled. It is only available after BuildHandlers.
+	SpanQuotaEnforcer() *app.SpanQuotaEnforcer
+	// TagNormalizer returns the normalizer of span and process tags, which can be updated while the
+	// collector runs, or nil if tag normalization is not enabled. It is only available after BuildHandlers.
+	TagNormalizer() *app.TagNormalizer
+	// HTTPStatusNormalizer returns the normalizer of the HTTP status codes of the spans, which can be updated while
+	// the collector runs, or nil if it is not enabled. It is only available after BuildHandlers.
+	HTTPStatusNormalizer() *app.HTTPStatusNormalizer
+	// OperationNameRewriter returns the rewriter of generic operation names, which can be updated while the
+	// collector runs, or nil if it is not enabled. It is only available after BuildHandlers.
+	OperationNameRewriter() *app.OperationNameRewriter
+	// RuleSampler returns the sampler forcing the spans matching sampling rules to be kept, which can be updated
+	// while the collector runs, or nil if it is not enabled. It is only available after BuildHandlers.
+	RuleSampler() *app.RuleSampler
+	// CompositeSampler returns the sampler keeping the traces by the combined verdicts of its sub-samplers, which
+	// can be updated while the collector runs, or nil if it is not enabled. It is only available after BuildHandlers.
+	CompositeSampler() *app.CompositeSampler
+	// SpanDropper returns the filter dropping the spans matching drop rules, which can be updated while the
+	// collector runs, or nil if it is not enabled. It is only available after BuildHandlers.
+	SpanDropper() *app.SpanDropper
+	// SpanSchemaValidator returns the filter checking the spans against schema rules, which can be updated while
+	// the collector runs, or nil if it is not enabled. It is only available after BuildHandlers.
+	SpanSchemaValidator() *app.SpanSchemaValidator
+	// ServiceNameRemapper returns the remapper of service names, which can be updated while the collector
+	// runs, or nil if it is not enabled. It is only available after BuildHandlers.
+	ServiceNameRemapper() *app.ServiceNameRemapper
+	// HealthCheck returns the health check probing the span storage, or nil if it is not enabled.
+	// It is only available after BuildHandlers.
+	HealthCheck() *app.StorageHealthCheck
+	// DroppedSpans returns the sample of the spans recently dropped by the collector, which serves it
+	// as JSON, or nil if it is not enabled. It is only available after BuildHandlers.
+	DroppedSpans() *app.DroppedSpanSampler
+	// WorkerPool returns the pool of the workers saving the queued spans, which can be resized while the
+	// collector runs, or nil if it is not enabled. It is only available after BuildHandlers.
+	WorkerPool() *app.WorkerPool
+	// TLSConfig returns the TLS configuration the HTTP, gRPC and OpenCensus endpoints are served with, whose
+	// certificate is reloaded when its files change, or nil if TLS is not enabled. It is only available after
+	// BuildHandlers.
+	TLSConfig() *tls.Config
+	// GRPCServerOptions returns the options the gRPC and OpenCensus servers are created with, serving them over
+	// TLS like the HTTP endpoints and authenticating the clients like the Thrift endpoints do. It is only
+	// available after BuildHandlers.
+	GRPCServerOptions() []grpc.ServerOption
+	// MetricsHandler returns the handler serving the collector metrics in the Prometheus exposition format,
+	// or nil if Prometheus metrics are not enabled.
+	MetricsHandler() http.Handler
+	// Close stops accepting spans and saves the queued ones until the queue is empty or the context
+	// is done, then flushes the spans buffered by the span storage and releases its resources.
+	// It returns the number of queued spans dropped because the context was done first.
+	Close(ctx context.Context) (int, error)
 }
 
 // NewSpanHandlerBuilder returns a span handler
 func NewSpanHandlerBuilder(opts ...basicB.Option) (SpanHandlerBuilder, error) {
 	options := basicB.ApplyOptions(opts...)
-	if flags.SpanStorage.Type == flags.CassandraStorageType {
+	if options.DryRun {
+		return newDryRunBuilder(options), nil
+	}
+	if options.CustomSpanWriter != nil {
+		return newCustomStorageBuilder(options), nil
+	}
+	storageTypes := flags.SpanStorage.Types()
+	if len(storageTypes) == 1 {
+		return newStorageBuilder(storageTypes[0], options)
+	}
+	var builders []storageBuilder
+	for _, storageType := range storageTypes {
+		b, err := newStorageBuilder(storageType, options)
+		if err != nil {
+			return nil, err
+		}
+		builders = append(builders, b)
+	}
+	return newFanOutBuilder(storageTypes, builders, options), nil
+}
+
+// NewSpanWriter returns the span writer of the given storage type alone, without a span processor, e.g. to copy
+// spans between storage backends. The returned closer flushes the spans buffered by the writer and releases the storage.
+func NewSpanWriter(storageType string, opts ...basicB.Option) (spanstore.Writer, io.Closer, error) {
+	b, err := newStorageBuilder(storageType, basicB.ApplyOptions(opts...))
+	if err != nil {
+		return nil, nil, err
+	}
+	spanWriter, err := b.buildSpanWriter()
+	if err != nil {
+		return nil, nil, err
+	}
+	return spanWriter, builderCloser{b}, nil
+}
+
+// builderCloser adapts SpanHandlerBuilder to io.Closer
+type builderCloser struct {
+	builder SpanHandlerBuilder
+}
+
+func (c builderCloser) Close() error {
+	_, err := c.builder.Close(context.Background())
+	return err
+}
+
+// storageBuilder is a SpanHandlerBuilder backed by a single storage type, which can also
+// provide its span writer alone so that it can be combined with other storage types.
+type storageBuilder interface {
+	SpanHandlerBuilder
+	buildSpanWriter() (spanstore.Writer, error)
+	// healthProbe returns the probe of the storage, or nil if it cannot be probed.
+	// It is only available after buildSpanWriter.
+	healthProbe() app.HealthProbe
+
+	// setStorageType records the storage type the builder writes to
+	setStorageType(storageType string)
+}
+
+func newStorageBuilder(storageType string, options basicB.BasicOptions) (storageBuilder, error) {
+	b, err := newTypedStorageBuilder(storageType, options)
+	if err != nil {
+		return nil, err
+	}
+	b.setStorageType(storageType)
+	return b, nil
+}
+
+func newTypedStorageBuilder(storageType string, options basicB.BasicOptions) (storageBuilder, error) {
+	if storageType == flags.CassandraStorageType {
 		if options.Cassandra == nil {
 			return nil, errMissingCassandraConfig
 		}
-		return newCassandraBuilder(options.Cassandra, options.Logger, options.MetricsFactory), nil
-	} else if flags.SpanStorage.Type == flags.MemoryStorageType {
+		return newCassandraBuilder(options.Cassandra, options), nil
+	} else if storageType == flags.MemoryStorageType {
 		if options.MemoryStore == nil {
 			return nil, errMissingMemoryStore
 		}
-		return newMemoryStoreBuilder(options.MemoryStore, options.Logger, options.MetricsFactory), nil
-	} else if flags.SpanStorage.Type == flags.ESStorageType {
+		return newMemoryStoreBuilder(options.MemoryStore, options), nil
+	} else if storageType == flags.ESStorageType {
 		if options.ElasticSearch == nil {
 			return nil, errMissingElasticSearchConfig
 		}
-		return newESBuilder(options.ElasticSearch, options.Logger, options.MetricsFactory), nil
+		return newESBuilder(options.ElasticSearch, options), nil
+	} else if storageType == flags.KafkaStorageType {
+		if options.Kafka == nil || len(options.Kafka.Brokers) == 0 {
+			return nil, errMissingKafkaConfig
+		}
+		return newKafkaBuilder(options.Kafka, options), nil
+	} else if storageType == flags.BadgerStorageType {
+		if options.Badger == nil && options.BadgerStore == nil {
+			return nil, errMissingBadgerConfig
+		}
+		return newBadgerBuilder(options.Badger, options), nil
+	} else if storageType == flags.PostgresStorageType {
+		if options.Postgres == nil {
+			return nil, errMissingPostgresConfig
+		}
+		return newPostgresBuilder(options.Postgres, options), nil
 	}
 	return nil, flags.ErrUnsupportedStorageType
 }
 
+// handlerBuilder holds the parts shared by all storage specific builders: the basic options
+// used to build the span processor and the components the processor feeds.
+type handlerBuilder struct {
+	options         basicB.BasicOptions
+	adaptiveSampler *sampling.AdaptiveSampler
+	staticSampler   *sampling.StaticStrategyStore
+	grpcHandler     app.GRPCCollector
+	ocReceiver      app.OpenCensusReceiver
+	otlpReceiver    *app.OTLPReceiver
+	tlsConfig       *tls.Config
+	authenticator   *app.Authenticator
+	spanProcessor   app.QueuedSpanProcessor
+	rateLimiter     *app.ServiceRateLimiter
+	quotaEnforcer   *app.SpanQuotaEnforcer
+	futureSpans     *app.FutureSpanValidator
+	tagNormalizer   *app.TagNormalizer
+	enricher        *app.SpanEnricher
+	httpStatuses    *app.HTTPStatusNormalizer
+	deduplicator    *app.SpanDeduplicator
+	idCollisions    *app.SpanIDCollisionDetector
+	spanLimiter     *app.TraceSpanLimiter
+	tenantResolver  *app.TenantResolver
+	operationNamer  *app.OperationNameRewriter
+	ruleSampler     *app.RuleSampler
+	composite       *app.CompositeSampler
+	spanDropper     *app.SpanDropper
+	schemaValidator *app.SpanSchemaValidator
+	serviceRemapper *app.ServiceNameRemapper
+	probe           app.HealthProbe
+	healthCheck     *app.StorageHealthCheck
+	admission       *app.AdmissionController
+	droppedSpans    *app.DroppedSpanSampler
+	workerPool      *app.WorkerPool
+	closers         []io.Closer
+	// storageType is the storage type written by a single storage builder, empty for the fan out builder
+	storageType string
+}
+
+func (h *handlerBuilder) setStorageType(storageType string) {
+	h.storageType = storageType
+}
+
+func (h *handlerBuilder) SamplingManager() tSampling.TChanSamplingManager {
+	if h.adaptiveSampler != nil {
+		return h.adaptiveSampler
+	}
+	if h.staticSampler != nil {
+		return h.staticSampler
+	}
+	return nil
+}
+
+func (h *handlerBuilder) GRPCHandler() app.GRPCCollector {
+	return h.grpcHandler
+}
+
+func (h *handlerBuilder) OpenCensusReceiver() app.OpenCensusReceiver {
+	return h.ocReceiver
+}
+
+func (h *handlerBuilder) OTLPReceiver() *app.OTLPReceiver {
+	return h.otlpReceiver
+}
+
+func (h *handlerBuilder) RateLimiter() *app.ServiceRateLimiter {
+	return h.rateLimiter
+}
+
+func (h *handlerBuilder) SpanQuotaEnforcer() *app.SpanQuotaEnforcer {
+	return h.quotaEnforcer
+}
+
+func (h *handlerBuilder) TagNormalizer() *app.TagNormalizer {
+	return h.tagNormalizer
+}
+
+func (h *handlerBuilder) HTTPStatusNormalizer() *app.HTTPStatusNormalizer {
+	return h.httpStatuses
+}
+
+func (h *handlerBuilder) OperationNameRewriter() *app.OperationNameRewriter {
+	return h.operationNamer
+}
+
+func (h *handlerBuilder) RuleSampler() *app.RuleSampler {
+	return h.ruleSampler
+}
+
+func (h *handlerBuilder) CompositeSampler() *app.CompositeSampler {
+	return h.composite
+}
+
+func (h *handlerBuilder) SpanDropper() *app.SpanDropper {
+	return h.spanDropper
+}
+
+func (h *handlerBuilder) SpanSchemaValidator() *app.SpanSchemaValidator {
+	return h.schemaValidator
+}
+
+func (h *handlerBuilder) ServiceNameRemapper() *app.ServiceNameRemapper {
+	return h.serviceRemapper
+}
+
+func (h *handlerBuilder) HealthCheck() *app.StorageHealthCheck {
+	return h.healthCheck
+}
+
+func (h *handlerBuilder) DroppedSpans() *app.DroppedSpanSampler {
+	return h.droppedSpans
+}
+
+func (h *handlerBuilder) WorkerPool() *app.WorkerPool {
+	return h.workerPool
+}
+
+func (h *handlerBuilder) TLSConfig() *tls.Config {
+	return h.tlsConfig
+}
+
+func (h *handlerBuilder) GRPCServerOptions() []grpc.ServerOption {
+	var options []grpc.ServerOption
+	if h.tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(h.tlsConfig)))
+	}
+	if h.authenticator != nil {
+		options = append(options,
+			grpc.UnaryInterceptor(h.authenticator.UnaryServerInterceptor()),
+			grpc.StreamInterceptor(h.authenticator.StreamServerInterceptor()),
+		)
+	}
+	return options
+}
+
+func (h *handlerBuilder) MetricsHandler() http.Handler {
+	if h.options.Prometheus == nil {
+		return nil
+	}
+	return h.options.Prometheus.Handler()
+}
+
+func (h *handlerBuilder) healthProbe() app.HealthProbe {
+	return h.probe
+}
+
+func (h *handlerBuilder) Close(ctx context.Context) (int, error) {
+	if h.healthCheck != nil {
+		h.healthCheck.Stop()
+		h.healthCheck = nil
+	}
+	if h.admission != nil {
+		h.admission.Stop()
+		h.admission = nil
+	}
+	if h.adaptiveSampler != nil {
+		h.adaptiveSampler.Stop()
+		h.adaptiveSampler = nil
+	}
+	dropped := 0
+	if h.spanProcessor != nil {
+		dropped = h.spanProcessor.Drain(ctx)
+		h.spanProcessor = nil
+	}
+	var lastErr error
+	for _, closer := range h.closers {
+		if err := closer.Close(); err != nil {
+			lastErr = err
+		}
+	}
+	h.closers = nil
+	return dropped, lastErr
+}
+
 type memoryStoreBuilder struct {
-	logger         *zap.Logger
-	metricsFactory metrics.Factory
-	memStore       *memory.Store
+	handlerBuilder
+	memStore *memory.Store
 }
 
-func newMemoryStoreBuilder(memStore *memory.Store, logger *zap.Logger, metricsFactory metrics.Factory) *memoryStoreBuilder {
+func newMemoryStoreBuilder(memStore *memory.Store, options basicB.BasicOptions) *memoryStoreBuilder {
 	return &memoryStoreBuilder{
-		logger:         logger,
-		metricsFactory: metricsFactory,
+		handlerBuilder: handlerBuilder{options: options},
 		memStore:       memStore,
 	}
 }
 
 func (m *memoryStoreBuilder) BuildHandlers() (app.ZipkinSpansHandler, app.JaegerBatchesHandler, error) {
-	return buildHandlers(m.memStore, m.logger, m.metricsFactory)
+	spanStore, err := m.buildSpanWriter()
+	if err != nil {
+		return nil, nil, err
+	}
+	return m.buildHandlers(spanStore)
+}
+
+func (m *memoryStoreBuilder) buildSpanWriter() (spanstore.Writer, error) {
+	// closing the store writes its snapshot, if configured with a path
+	m.closers = append(m.closers, m.memStore)
+	return m.memStore, nil
 }
 
 type cassandraSpanHandlerBuilder struct {
-	logger         *zap.Logger
-	metricsFactory metrics.Factory
-	configuration  cascfg.Configuration
-	session        cassandra.Session
+	handlerBuilder
+	configuration cascfg.Configuration
+	session       cassandra.Session
+	// shardSessions connect to each of the servers when they are separate shards
+	shardSessions []cassandra.Session
+	// poolTracker reports the pool metrics of all sessions
+	poolTracker *casMetrics.PoolTracker
 }
 
-func newCassandraBuilder(config *cascfg.Configuration, logger *zap.Logger, metricsFactory metrics.Factory) *cassandraSpanHandlerBuilder {
+func newCassandraBuilder(config *cascfg.Configuration, options basicB.BasicOptions) *cassandraSpanHandlerBuilder {
 	return &cassandraSpanHandlerBuilder{
-		logger:         logger,
-		metricsFactory: metricsFactory,
+		handlerBuilder: handlerBuilder{options: options},
 		configuration:  fixConfiguration(*config),
 	}
 }
 
 func (c *cassandraSpanHandlerBuilder) BuildHandlers() (app.ZipkinSpansHandler, app.JaegerBatchesHandler, error) {
-	session, err := c.getSession()
+	spanStore, err := c.buildSpanWriter()
 	if err != nil {
 		return nil, nil, err
 	}
-	spanStore := casSpanstore.NewSpanWriter(
+	return c.buildHandlers(spanStore)
+}
+
+func (c *cassandraSpanHandlerBuilder) buildSpanWriter() (spanstore.Writer, error) {
+	compression, err := casDbmodel.ParseCompression(c.configuration.SpanCompression)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.configuration.ValidateSpanTTLs(); err != nil {
+		return nil, err
+	}
+	if err := c.configuration.ValidateLoadBalancing(); err != nil {
+		return nil, err
+	}
+	consistency, err := c.configuration.ConsistencyLevels()
+	if err != nil {
+		return nil, err
+	}
+	if c.configuration.ShardingScheme != "" {
+		writer, err := c.buildShardedSpanWriter(compression, consistency)
+		if err != nil {
+			return nil, err
+		}
+		return c.compactProcesses(writer), nil
+	}
+	session, err := c.getSession()
+	if err != nil {
+		return nil, err
+	}
+	if err := casSpanstore.CheckSchema(session, c.configuration.Keyspace, c.configuration.SchemaAutoMigrate); err != nil {
+		return nil, err
+	}
+	c.probe = func() error {
+		return cassandra.Probe(session)
+	}
+	return c.compactProcesses(c.newSpanWriter(session, compression, consistency)), nil
+}
+
+// buildShardedSpanWriter writes all spans of a trace to the shard picked by the sharding scheme among the servers
+func (c *cassandraSpanHandlerBuilder) buildShardedSpanWriter(
+	compression casDbmodel.Compression,
+	consistency cascfg.ConsistencyLevels,
+) (spanstore.Writer, error) {
+	selector, err := spanstore.NewShardSelector(spanstore.ShardingScheme(c.configuration.ShardingScheme), c.configuration.Servers)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := c.getShardSessions()
+	if err != nil {
+		return nil, err
+	}
+	for i, session := range sessions {
+		if err := casSpanstore.CheckSchema(session, c.configuration.Keyspace, c.configuration.SchemaAutoMigrate); err != nil {
+			return nil, fmt.Errorf("Cassandra shard %s: %v", c.configuration.Servers[i], err)
+		}
+	}
+	// the storage is only healthy if all shards are, since any of them may receive the next trace
+	servers := c.configuration.Servers
+	c.probe = func() error {
+		return cassandra.ProbeShards(servers, sessions)
+	}
+	writers := make([]spanstore.Writer, len(sessions))
+	for i, session := range sessions {
+		writers[i] = c.newSpanWriter(session, compression, consistency)
+	}
+	return spanstore.NewShardedWriter(selector, writers...), nil
+}
+
+func (c *cassandraSpanHandlerBuilder) newSpanWriter(
+	session cassandra.Session,
+	compression casDbmodel.Compression,
+	consistency cascfg.ConsistencyLevels,
+) spanstore.Writer {
+	if c.configuration.MaxWriteAttempts > 1 {
+		session = casRetry.WrapSession(
+			session,
+			c.configuration.WriteRetryPolicy(),
+			c.options.MetricsFactory,
+			c.options.Logger,
+		)
+	}
+	c.closers = append(c.closers, sessionCloser{session})
+	options := []casSpanstore.WriterOption{
+		casSpanstore.WriterOptions.Compression(compression),
+		casSpanstore.WriterOptions.Serialization(c.options.SpanSerialization),
+		casSpanstore.WriterOptions.TTL(c.configuration.SpanTTL, c.configuration.ServiceSpanTTLs),
+		casSpanstore.WriterOptions.Consistency(consistency.Write, consistency.LoadSheddingWrite, consistency.LoadSheddingPeriod),
+	}
+	if c.configuration.SpanBucketThreshold > 0 {
+		options = append(options, casSpanstore.WriterOptions.Bucketing(c.configuration.SpanBucketThreshold))
+	}
+	if len(c.configuration.PromotedTags) > 0 {
+		options = append(options, casSpanstore.WriterOptions.PromotedTags(c.configuration.PromotedTags))
+	}
+	writer := casSpanstore.NewSpanWriter(
 		session,
 		*WriteCacheTTL,
-		c.metricsFactory,
-		c.logger,
+		c.options.MetricsFactory,
+		c.options.Logger,
+		options...,
 	)
-
-	return buildHandlers(spanStore, c.logger, c.metricsFactory)
+	if c.configuration.ErrorSpanTTL <= 0 {
+		return writer
+	}
+	errorTraceWriter := casSpanstore.NewErrorTraceWriter(
+		writer,
+		c.configuration.ErrorSpanTTL,
+		c.configuration.ErrorTraceWindow,
+		c.options.MetricsFactory,
+		c.options.Logger,
+	)
+	// no span is written once the session is closed
+	c.closers = append([]io.Closer{errorTraceWriter}, c.closers...)
+	return errorTraceWriter
 }
 
 func defaultSpanFilter(*model.Span) bool {
@@ -130,75 +622,778 @@ func defaultSpanFilter(*model.Span) bool {
 func (c *cassandraSpanHandlerBuilder) getSession() (cassandra.Session, error) {
 	if c.session == nil {
 		session, err := c.configuration.NewSession()
-		c.session = session
-		return c.session, err
+		if err != nil {
+			return nil, err
+		}
+		c.session = c.trackPool(session)
 	}
 	return c.session, nil
 }
 
+func (c *cassandraSpanHandlerBuilder) getShardSessions() ([]cassandra.Session, error) {
+	if c.shardSessions == nil {
+		for _, shard := range c.configuration.Shards() {
+			session, err := shard.NewSession()
+			if err != nil {
+				for _, s := range c.shardSessions {
+					s.Close()
+				}
+				c.shardSessions = nil
+				return nil, err
+			}
+			c.shardSessions = append(c.shardSessions, c.trackPool(session))
+		}
+	}
+	return c.shardSessions, nil
+}
+
+func (c *cassandraSpanHandlerBuilder) trackPool(session cassandra.Session) cassandra.Session {
+	if c.poolTracker == nil {
+		c.poolTracker = casMetrics.NewPoolTracker(c.options.MetricsFactory.Namespace("cassandra", nil))
+		c.closers = append(c.closers, c.poolTracker)
+	}
+	return c.poolTracker.WrapSession(session)
+}
+
+// sessionCloser adapts cassandra.Session to io.Closer
+type sessionCloser struct {
+	session cassandra.Session
+}
+
+func (s sessionCloser) Close() error {
+	s.session.Close()
+	return nil
+}
+
 func fixConfiguration(config cascfg.Configuration) cascfg.Configuration {
 	config.ProtoVersion = 4
 	return config
 }
 
 type esSpanHandlerBuilder struct {
-	logger         *zap.Logger
-	client         es.Client
-	metricsFactory metrics.Factory
-	configuration  escfg.Configuration
+	handlerBuilder
+	client        es.Client
+	configuration escfg.Configuration
 }
 
-func newESBuilder(config *escfg.Configuration, logger *zap.Logger, metricsFactory metrics.Factory) *esSpanHandlerBuilder {
+func newESBuilder(config *escfg.Configuration, options basicB.BasicOptions) *esSpanHandlerBuilder {
 	return &esSpanHandlerBuilder{
+		handlerBuilder: handlerBuilder{options: options},
 		configuration:  *config,
-		metricsFactory: metricsFactory,
-		logger:         logger,
 	}
 }
 
 func (e *esSpanHandlerBuilder) BuildHandlers() (app.ZipkinSpansHandler, app.JaegerBatchesHandler, error) {
-	client, err := e.getClient()
+	spanStore, err := e.buildSpanWriter()
 	if err != nil {
 		return nil, nil, err
 	}
-	spanStore := esSpanstore.NewSpanWriter(client, e.logger, e.metricsFactory)
+	return e.buildHandlers(spanStore)
+}
 
-	return buildHandlers(spanStore, e.logger, e.metricsFactory)
+func (e *esSpanHandlerBuilder) buildSpanWriter() (spanstore.Writer, error) {
+	if e.options.WAL != nil {
+		return nil, errWALWithElasticSearch
+	}
+	indexNaming, err := esSpanstore.NewIndexNaming(e.configuration.IndexTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.configuration.ValidateIndexSettings(); err != nil {
+		return nil, err
+	}
+	client, err := e.getClient()
+	if err != nil {
+		return nil, err
+	}
+	if err := esSpanstore.CheckSchema(client, indexNaming, e.configuration.SchemaAutoMigrate); err != nil {
+		return nil, err
+	}
+	e.probe = func() error {
+		return es.Probe(client, esHealthTimeout)
+	}
+	spanStore := esSpanstore.NewBulkSpanWriter(
+		client,
+		e.options.Logger,
+		e.options.MetricsFactory,
+		esSpanstore.BulkOptions{
+			Size:          e.configuration.BulkSize,
+			FlushInterval: e.configuration.BulkFlushInterval,
+			MaxRetries:    e.configuration.BulkMaxRetries,
+			RetryBackoff:  e.configuration.BulkRetryBackoff,
+		},
+		esSpanstore.WriterOptions.Serialization(e.options.SpanSerialization),
+		esSpanstore.WriterOptions.IndexNaming(indexNaming),
+		esSpanstore.WriterOptions.IndexSettings(esSpanstore.IndexSettings{
+			RefreshInterval: e.configuration.IndexRefreshInterval,
+			Shards:          e.configuration.IndexShards,
+			Replicas:        e.configuration.IndexReplicas,
+		}),
+	)
+	e.closers = append(e.closers, spanStore)
+	return e.compactProcesses(spanStore), nil
 }
 
 func (e *esSpanHandlerBuilder) getClient() (es.Client, error) {
 	if e.client == nil {
-		client, err := e.configuration.NewClient()
+		client, closer, err := e.configuration.NewClientWithMetrics(e.options.MetricsFactory.Namespace("elasticsearch", nil))
+		if err != nil {
+			return nil, err
+		}
 		e.client = client
-		return e.client, err
+		e.closers = append(e.closers, closer)
 	}
 	return e.client, nil
 }
 
-func buildHandlers(
-	spanStore spanstore.Writer,
-	logger *zap.Logger,
-	metricsFactory metrics.Factory,
-) (app.ZipkinSpansHandler, app.JaegerBatchesHandler, error) {
+type kafkaSpanHandlerBuilder struct {
+	handlerBuilder
+	producer      sarama.SyncProducer
+	configuration kafkacfg.Configuration
+}
+
+func newKafkaBuilder(config *kafkacfg.Configuration, options basicB.BasicOptions) *kafkaSpanHandlerBuilder {
+	return &kafkaSpanHandlerBuilder{
+		handlerBuilder: handlerBuilder{options: options},
+		configuration:  *config,
+	}
+}
+
+func (k *kafkaSpanHandlerBuilder) BuildHandlers() (app.ZipkinSpansHandler, app.JaegerBatchesHandler, error) {
+	spanStore, err := k.buildSpanWriter()
+	if err != nil {
+		return nil, nil, err
+	}
+	return k.buildHandlers(spanStore)
+}
+
+func (k *kafkaSpanHandlerBuilder) buildSpanWriter() (spanstore.Writer, error) {
+	producer, err := k.getProducer()
+	if err != nil {
+		return nil, err
+	}
+	return kafkaSpanstore.NewSpanWriter(producer, k.configuration.Topic, k.options.Logger, k.options.MetricsFactory), nil
+}
+
+func (k *kafkaSpanHandlerBuilder) getProducer() (sarama.SyncProducer, error) {
+	if k.producer == nil {
+		producer, err := k.configuration.NewProducer()
+		if err != nil {
+			return nil, err
+		}
+		k.producer = producer
+		k.closers = append(k.closers, producer)
+	}
+	return k.producer, nil
+}
+
+type badgerSpanHandlerBuilder struct {
+	handlerBuilder
+	store         *badgerSpanstore.Store
+	configuration badgercfg.Configuration
+}
+
+// newBadgerBuilder creates a builder opening the Badger store of the configuration, unless the options
+// provide the store
+func newBadgerBuilder(config *badgercfg.Configuration, options basicB.BasicOptions) *badgerSpanHandlerBuilder {
+	b := &badgerSpanHandlerBuilder{
+		handlerBuilder: handlerBuilder{options: options},
+	}
+	if config != nil {
+		b.configuration = *config
+	}
+	return b
+}
+
+func (b *badgerSpanHandlerBuilder) BuildHandlers() (app.ZipkinSpansHandler, app.JaegerBatchesHandler, error) {
+	store, err := b.getStore()
+	if err != nil {
+		return nil, nil, err
+	}
+	return b.buildHandlers(store)
+}
+
+func (b *badgerSpanHandlerBuilder) buildSpanWriter() (spanstore.Writer, error) {
+	store, err := b.getStore()
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (b *badgerSpanHandlerBuilder) getStore() (*badgerSpanstore.Store, error) {
+	if b.store == nil {
+		if b.options.BadgerStore != nil {
+			// closed by the executable, which shares it with its query service
+			b.store = b.options.BadgerStore
+		} else {
+			db, err := b.configuration.NewDB()
+			if err != nil {
+				return nil, err
+			}
+			b.store = badgerSpanstore.NewStore(db, b.configuration.ValueLogGCInterval, b.options.Logger)
+			// the value log is synced when the BadgerDB is closed
+			b.closers = append(b.closers, b.store)
+		}
+		b.probe = b.store.Probe
+	}
+	return b.store, nil
+}
+
+type postgresSpanHandlerBuilder struct {
+	handlerBuilder
+	store         *pgSpanstore.Store
+	configuration pgcfg.Configuration
+}
+
+func newPostgresBuilder(config *pgcfg.Configuration, options basicB.BasicOptions) *postgresSpanHandlerBuilder {
+	return &postgresSpanHandlerBuilder{
+		handlerBuilder: handlerBuilder{options: options},
+		configuration:  *config,
+	}
+}
+
+func (p *postgresSpanHandlerBuilder) BuildHandlers() (app.ZipkinSpansHandler, app.JaegerBatchesHandler, error) {
+	store, err := p.getStore()
+	if err != nil {
+		return nil, nil, err
+	}
+	return p.buildHandlers(store)
+}
+
+func (p *postgresSpanHandlerBuilder) buildSpanWriter() (spanstore.Writer, error) {
+	store, err := p.getStore()
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (p *postgresSpanHandlerBuilder) getStore() (*pgSpanstore.Store, error) {
+	if p.store == nil {
+		db, err := p.configuration.NewDB()
+		if err != nil {
+			return nil, err
+		}
+		store, err := pgSpanstore.NewStore(db, p.options.Logger)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		p.store = store
+		p.probe = store.Ping
+		p.closers = append(p.closers, store)
+	}
+	return p.store, nil
+}
+
+// spanFilter composes the default span filter with the ones given through the options.
+// Spans rejected by the filter are counted in the spans.rejected metric.
+func (h *handlerBuilder) spanFilter() app.FilterSpan {
+	filters := []app.FilterSpan{defaultSpanFilter}
+	if h.tenantResolver != nil {
+		filters = append(filters, h.tenantResolver.HasTenant)
+	}
+	for _, filter := range h.options.SpanFilters {
+		filters = append(filters, filter)
+	}
+	if h.spanDropper != nil {
+		// before the deduplicator, the rate limiter and the quotas, so that the dropped spans do not count
+		filters = append(filters, h.spanDropper.Allow)
+	}
+	if h.schemaValidator != nil {
+		// after the dropper, so that the spans of infrastructure components do not count as violations
+		filters = append(filters, h.schemaValidator.Allow)
+	}
+	if h.futureSpans != nil {
+		filters = append(filters, h.futureSpans.Allow)
+	}
+	if maxSpanSize := h.maxSpanSize(); maxSpanSize > 0 {
+		filters = append(filters, app.NewSpanSizeLimiter(maxSpanSize, h.options.Logger, h.options.MetricsFactory).Allow)
+	}
+	if h.deduplicator != nil {
+		// before the rate limiter, so that duplicates do not use up the rate of their service
+		filters = append(filters, h.deduplicator.Allow)
+	}
+	if h.spanLimiter != nil {
+		// after the deduplicator so that duplicates do not count, before the rate limiter so that the
+		// spans of truncated traces do not use up the rate of their service
+		filters = append(filters, h.spanLimiter.Allow)
+	}
+	if h.rateLimiter != nil {
+		// after the other filters but the quotas, so that spans rejected by them do not use up the rate of their service
+		filters = append(filters, h.rateLimiter.Allow)
+	}
+	if h.quotaEnforcer != nil {
+		// after the rate limiter, so that the usage of services only counts the spans which could be kept
+		filters = append(filters, h.quotaEnforcer.Allow)
+	}
+	return app.ChainedFilterSpan(filters...)
+}
+
+func (h *handlerBuilder) maxSpanSize() int {
+	if h.options.MaxSpanSize == 0 {
+		return app.DefaultMaxSpanSize
+	}
+	return h.options.MaxSpanSize
+}
+
+// compactProcesses makes the writer store the process of the spans of a trace once, if process compaction is enabled
+func (h *handlerBuilder) compactProcesses(writer spanstore.Writer) spanstore.Writer {
+	if h.options.ProcessCompaction == nil {
+		return writer
+	}
+	compactionWriter := compaction.NewWriter(writer, *h.options.ProcessCompaction, h.options.MetricsFactory)
+	// it flushes the bulk writer of ElasticSearch until closed, before the storage
+	h.closers = append([]io.Closer{compactionWriter}, h.closers...)
+	return compactionWriter
+}
+
+// withWriteDeadline makes the writer of the storageType storage give up the writes taking too long, if a write
+// deadline is configured for that storage type
+func (h *handlerBuilder) withWriteDeadline(storageType string, writer spanstore.Writer) spanstore.Writer {
+	options, ok := h.options.WriteDeadlines[storageType]
+	if !ok {
+		return writer
+	}
+	metricsFactory := h.options.MetricsFactory.Namespace("", map[string]string{"type": storageType})
+	return deadline.NewWriter(writer, options, h.options.Logger, metricsFactory)
+}
+
+// preProcessSpans mutates the spans converted by the handlers, so that the span filters and all later stages
+// see the normalized spans
+func (h *handlerBuilder) preProcessSpans() app.ProcessSpans {
+	var preProcess []app.ProcessSpans
+	if h.idCollisions != nil {
+		// first, so that the spans are hashed as received: the tags of the collector, the samplers and the decision
+		// recorder differ between the retries of a span, which would count as collisions. It is also before the
+		// deduplicator, so that it still drops the retries of a reassigned span.
+		preProcess = append(preProcess, h.idCollisions.DetectCollisions)
+	}
+	if h.serviceRemapper != nil {
+		// so that the filters and all later stages see the new service names
+		preProcess = append(preProcess, h.serviceRemapper.RemapSpans)
+	}
+	if h.tagNormalizer != nil {
+		preProcess = append(preProcess, h.tagNormalizer.NormalizeSpans)
+	}
+	if h.httpStatuses != nil {
+		// after the normalizer, so that the status codes can be mapped from other keys first
+		preProcess = append(preProcess, h.httpStatuses.NormalizeSpans)
+	}
+	if h.tenantResolver != nil {
+		// after the normalizer, so that the tenant tag can be mapped from other keys
+		preProcess = append(preProcess, h.tenantResolver.ResolveTenants)
+	}
+	if h.operationNamer != nil {
+		// after the normalizer, so that the rules see the normalized tag keys
+		preProcess = append(preProcess, h.operationNamer.RewriteSpans)
+	}
+	if h.enricher != nil {
+		// after the normalizer, so that the metadata does not overwrite the tags mapped from other keys
+		preProcess = append(preProcess, h.enricher.EnrichSpans)
+	}
+	if h.options.CorrelationTag != nil {
+		// after the normalizer, so that a correlation tag sent under another key is kept
+		tagger := app.NewCorrelationTagger(*h.options.CorrelationTag)
+		preProcess = append(preProcess, tagger.TagSpans)
+	}
+	if h.options.CollectorTags != nil {
+		hostname, _ := os.Hostname()
+		tagger := app.NewCollectorTagger(*h.options.CollectorTags, hostname)
+		preProcess = append(preProcess, tagger.TagSpans)
+	}
+	if h.ruleSampler != nil {
+		// after the normalizer and the enricher, so that the rules see the normalized and added tags
+		preProcess = append(preProcess, h.ruleSampler.SampleSpans)
+	}
+	if h.composite != nil {
+		// after the rule sampler, so that the forced spans do not count against the sub-samplers
+		preProcess = append(preProcess, h.composite.SampleSpans)
+	}
+	if h.options.SamplingDecisions {
+		// before the mutators, so that they see the recorded decisions
+		recorder := app.NewSamplingDecisionRecorder(h.options.TailSampler, h.options.MetricsFactory)
+		preProcess = append(preProcess, recorder.RecordDecisions)
+	}
+	if len(h.options.SpanMutators) > 0 {
+		mutate := app.ChainedProcessSpan(toProcessSpan(h.options.SpanMutators)...)
+		preProcess = append(preProcess, func(spans []*model.Span) {
+			for _, span := range spans {
+				mutate(span)
+			}
+		})
+	}
+	if h.options.OperationCardinality != nil {
+		// after the mutators, so that only the operation names they could not normalize are collapsed
+		guard := app.NewOperationCardinalityGuard(*h.options.OperationCardinality, h.options.Logger, h.options.MetricsFactory)
+		preProcess = append(preProcess, guard.GuardSpans)
+	}
+	preProcess = append(preProcess, app.NewReferenceValidator(h.options.Logger, h.options.MetricsFactory).ValidateSpans)
+	return app.ChainedProcessSpans(preProcess...)
+}
+
+// tagSanitizerOptions adds the sampling decision, enrichment, correlation and collector tags to the allow list,
+// so that they are saved
+func (h *handlerBuilder) tagSanitizerOptions() sanitizer.TagSanitizerOptions {
+	options := *h.options.TagSanitizer
+	if len(options.AllowList) == 0 {
+		return options
+	}
+	allowList := append([]string{}, options.AllowList...)
+	if h.options.SamplingDecisions {
+		allowList = append(allowList, app.HeadSamplingTag, app.TailSamplingTag)
+	} else if h.options.CompositeSampling != nil {
+		allowList = append(allowList, app.TailSamplingTag)
+	}
+	if h.enricher != nil {
+		// the keys of the metadata are only known once added when all of them are
+		options.AllowFunc = h.enricher.AddsTag
+	}
+	if h.options.CorrelationTag != nil {
+		allowList = append(allowList, correlationTagKey(*h.options.CorrelationTag))
+	}
+	if h.options.CollectorTags != nil {
+		allowList = append(allowList, h.options.CollectorTags.Keys()...)
+	}
+	if h.options.SpanIDCollisions != nil {
+		allowList = append(allowList, app.SpanIDCollisionTag)
+	}
+	if h.options.SpanSchema != nil {
+		allowList = append(allowList, app.SchemaViolationTag)
+	}
+	options.AllowList = allowList
+	return options
+}
+
+func correlationTagKey(options app.CorrelationTagOptions) string {
+	if options.Key == "" {
+		return app.DefaultCorrelationTag
+	}
+	return options.Key
+}
+
+func toProcessSpan(mutators []func(*model.Span)) []app.ProcessSpan {
+	processSpans := make([]app.ProcessSpan, len(mutators))
+	for i, mutator := range mutators {
+		processSpans[i] = mutator
+	}
+	return processSpans
+}
+
+func (h *handlerBuilder) buildHandlers(spanStore spanstore.Writer) (app.ZipkinSpansHandler, app.JaegerBatchesHandler, error) {
+	logger := h.options.Logger
+	metricsFactory := h.options.MetricsFactory
 	hostname, _ := os.Hostname()
 	hostMetrics := metricsFactory.Namespace(hostname, nil)
 
+	if h.options.WAL != nil && h.options.AsyncWriter != nil {
+		return nil, nil, errWALWithAsyncWriter
+	}
+	if h.options.WAL != nil && h.options.TraceBatching != nil {
+		return nil, nil, errWALWithTraceBatching
+	}
+	if h.options.WAL != nil && h.options.TailSampling != nil {
+		return nil, nil, errWALWithTailSampling
+	}
+	if h.options.WAL != nil && h.options.CircuitBreaker != nil {
+		return nil, nil, errWALWithCircuitBreaker
+	}
+	if h.options.NATS != nil && (h.options.AsyncWriter != nil || h.options.TraceBatching != nil ||
+		h.options.TailSampling != nil || h.options.CircuitBreaker != nil) {
+		return nil, nil, errNATSWithBufferingWriter
+	}
+	if h.options.CompositeSampling != nil && h.options.TailSampling == nil {
+		return nil, nil, errCompositeSamplingWithoutTailSampling
+	}
+	if h.options.TLS != nil && h.tlsConfig == nil {
+		tlsConfig, closer, err := h.options.TLS.NewServerConfig(logger)
+		if err != nil {
+			return nil, nil, err
+		}
+		h.tlsConfig = tlsConfig
+		h.closers = append(h.closers, closer)
+	}
+	if h.options.RateLimits != nil && h.rateLimiter == nil {
+		h.rateLimiter = app.NewServiceRateLimiter(*h.options.RateLimits, metricsFactory)
+	}
+	if h.options.FutureSpans != nil && h.futureSpans == nil {
+		h.futureSpans = app.NewFutureSpanValidator(*h.options.FutureSpans, metricsFactory)
+	}
+	if h.options.SpanQuotas != nil && h.quotaEnforcer == nil {
+		quotaOptions := *h.options.SpanQuotas
+		quotaOptions.SampleSeed = h.options.SamplingSeed
+		h.quotaEnforcer = app.NewSpanQuotaEnforcer(quotaOptions, metricsFactory)
+	}
+	if h.options.Tenancy != nil && h.options.Tenancy.Header != "" && h.options.OpenCensus {
+		return nil, nil, errTenantHeaderWithoutHeaders
+	}
+	if h.options.StaticSampling != nil && h.staticSampler == nil {
+		if h.options.AdaptiveSampling != nil {
+			return nil, nil, errStaticWithAdaptiveSampling
+		}
+		staticOptions := *h.options.StaticSampling
+		if h.options.Tenancy != nil {
+			// the agents send their tenant in the same header as the tenant of their spans
+			staticOptions.TenantHeader = h.options.Tenancy.Header
+		}
+		staticSampler, err := sampling.NewStaticStrategyStore(staticOptions, logger, metricsFactory)
+		if err != nil {
+			return nil, nil, err
+		}
+		h.staticSampler = staticSampler
+		h.closers = append(h.closers, staticSampler)
+	}
+	if h.options.Tenancy != nil && h.tenantResolver == nil {
+		h.tenantResolver = app.NewTenantResolver(*h.options.Tenancy, metricsFactory)
+	}
+	if h.options.ServiceAliases != nil && h.serviceRemapper == nil {
+		h.serviceRemapper = app.NewServiceNameRemapper(*h.options.ServiceAliases, metricsFactory)
+	}
+	if h.options.Enrichment != nil && h.enricher == nil {
+		h.enricher = app.NewSpanEnricher(*h.options.Enrichment, metricsFactory)
+	}
+	if h.options.TagMappings != nil && h.tagNormalizer == nil {
+		h.tagNormalizer = app.NewTagNormalizer(*h.options.TagMappings, metricsFactory)
+	}
+	if h.options.HTTPStatusRules != nil && h.httpStatuses == nil {
+		h.httpStatuses = app.NewHTTPStatusNormalizer(*h.options.HTTPStatusRules, metricsFactory)
+	}
+	if h.options.OperationNameRules != nil && h.operationNamer == nil {
+		operationNamer, err := app.NewOperationNameRewriter(*h.options.OperationNameRules, metricsFactory)
+		if err != nil {
+			return nil, nil, err
+		}
+		h.operationNamer = operationNamer
+	}
+	if h.options.SamplingRules != nil && h.ruleSampler == nil {
+		ruleSampler, err := app.NewRuleSampler(*h.options.SamplingRules, metricsFactory)
+		if err != nil {
+			return nil, nil, err
+		}
+		h.ruleSampler = ruleSampler
+	}
+	if h.options.CompositeSampling != nil && h.composite == nil {
+		var decisions *app.SamplingDecisionCache
+		if h.options.SamplingDecisionCache != nil {
+			decisions = app.NewSamplingDecisionCache(*h.options.SamplingDecisionCache, metricsFactory)
+		}
+		composite, err := app.NewCompositeSampler(*h.options.CompositeSampling, h.options.SamplingSeed, decisions, metricsFactory)
+		if err != nil {
+			return nil, nil, err
+		}
+		h.composite = composite
+	}
+	if h.options.DropRules != nil && h.spanDropper == nil {
+		spanDropper, err := app.NewSpanDropper(*h.options.DropRules, metricsFactory)
+		if err != nil {
+			return nil, nil, err
+		}
+		h.spanDropper = spanDropper
+	}
+	if h.options.SpanSchema != nil && h.schemaValidator == nil {
+		schemaValidator, err := app.NewSpanSchemaValidator(*h.options.SpanSchema, metricsFactory)
+		if err != nil {
+			return nil, nil, err
+		}
+		h.schemaValidator = schemaValidator
+	}
+	if h.options.HealthCheck != nil && h.healthCheck == nil {
+		h.healthCheck = app.NewStorageHealthCheck(h.probe, *h.options.HealthCheck, logger, metricsFactory)
+		h.healthCheck.Start()
+	}
+	if h.options.Admission != nil && h.admission == nil {
+		h.admission = app.NewAdmissionController(*h.options.Admission, logger, metricsFactory)
+		h.admission.Start()
+	}
+	if h.options.DroppedSpans != nil && h.droppedSpans == nil {
+		droppedOptions := *h.options.DroppedSpans
+		droppedOptions.SampleSeed = h.options.SamplingSeed
+		h.droppedSpans = app.NewDroppedSpanSampler(droppedOptions, metricsFactory)
+	}
+	if h.storageType != "" {
+		// wrapped by the circuit breaker, which sees the timed out writes as failures; the fan out
+		// builder applies the deadline of each of its storage types itself
+		spanStore = h.withWriteDeadline(h.storageType, spanStore)
+	}
+	if h.options.CircuitBreaker != nil {
+		// closed before the storage, which the spans left in its fallback buffer are written to
+		circuitBreaker := breaker.NewWriter(spanStore, *h.options.CircuitBreaker, logger, metricsFactory)
+		h.closers = append([]io.Closer{circuitBreaker}, h.closers...)
+		spanStore = circuitBreaker
+	}
+	if len(h.options.Routes) > 0 {
+		spanStore = spanstore.NewRoutingWriter(spanStore, h.options.Routes, metricsFactory)
+	}
+	if h.tenantResolver != nil {
+		spanStore = tenancy.NewWriter(spanStore)
+	}
+	if h.options.TraceBatching != nil {
+		// the asynchronous writer hands its spans to the batches, it is closed before them
+		batchWriter := batch.NewWriter(spanStore, *h.options.TraceBatching, logger, metricsFactory)
+		h.closers = append([]io.Closer{batchWriter}, h.closers...)
+		spanStore = batchWriter
+	}
+	if h.options.TailSampling != nil {
+		// the kept traces are handed to the batches, it is closed before them
+		tailSamplingOptions := *h.options.TailSampling
+		tailSamplingOptions.RequireRoot = h.options.TailSamplingRequireRoot
+		tailSampler := tailsampling.NewWriter(spanStore, tailSamplingOptions, logger, metricsFactory)
+		h.closers = append([]io.Closer{tailSampler}, h.closers...)
+		spanStore = tailSampler
+	}
+	if h.options.AsyncWriter != nil {
+		asyncWriter := async.NewWriter(spanStore, *h.options.AsyncWriter, logger, metricsFactory)
+		// buffered spans must be written before the storage is closed
+		h.closers = append([]io.Closer{asyncWriter}, h.closers...)
+		spanStore = asyncWriter
+	}
+	if h.options.SpanIDCollisions != nil && h.idCollisions == nil {
+		h.idCollisions = app.NewSpanIDCollisionDetector(*h.options.SpanIDCollisions, metricsFactory)
+	}
+	if h.options.DeduplicationWindow > 0 && h.deduplicator == nil {
+		h.deduplicator = app.NewSpanDeduplicator(h.options.DeduplicationWindow, metricsFactory)
+	}
+	if h.options.TraceSpanLimit != nil && h.spanLimiter == nil {
+		h.spanLimiter = app.NewTraceSpanLimiter(*h.options.TraceSpanLimit, metricsFactory)
+	}
+
 	zSanitizer := zs.NewChainedSanitizer(
 		zs.NewSpanDurationSanitizer(logger),
 		zs.NewParentIDSanitizer(logger),
 	)
 
-	spanProcessor := app.NewSpanProcessor(
-		spanStore,
+	processorOptions := []app.Option{
 		app.Options.ServiceMetrics(metricsFactory),
 		app.Options.HostMetrics(hostMetrics),
 		app.Options.Logger(logger),
-		app.Options.SpanFilter(defaultSpanFilter),
+		app.Options.SpanFilter(h.spanFilter()),
+		app.Options.PreProcessSpans(h.preProcessSpans()),
 		app.Options.NumWorkers(*NumWorkers),
 		app.Options.QueueSize(*QueueSize),
-	)
+	}
+	if h.options.AdaptiveSampling != nil && h.adaptiveSampler == nil {
+		h.adaptiveSampler = sampling.NewAdaptiveSampler(*h.options.AdaptiveSampling, logger)
+		h.adaptiveSampler.Start()
+	}
+	var preSave []app.ProcessSpan
+	if h.adaptiveSampler != nil {
+		preSave = append(preSave, h.adaptiveSampler.RecordSpan)
+	}
+	if h.options.SpanMetrics {
+		spanMetrics := app.NewSpanMetrics(metricsFactory.Namespace("span-metrics", nil))
+		preSave = append(preSave, spanMetrics.RecordSpan)
+	}
+	if len(preSave) > 0 {
+		processorOptions = append(processorOptions, app.Options.PreSave(app.ChainedProcessSpan(preSave...)))
+	}
+	if h.options.TagSanitizer != nil {
+		processorOptions = append(processorOptions, app.Options.Sanitizer(sanitizer.NewTagSanitizer(h.tagSanitizerOptions())))
+	}
+	var extraFormatTypes []string
+	if h.options.GRPCEnabled {
+		extraFormatTypes = append(extraFormatTypes, app.GRPCFormatType)
+	}
+	if h.options.OpenCensus {
+		extraFormatTypes = append(extraFormatTypes, app.OpenCensusFormatType)
+	}
+	if h.options.OTLP {
+		extraFormatTypes = append(extraFormatTypes, app.OTLPFormatType)
+	}
+	if h.options.NATS != nil {
+		extraFormatTypes = append(extraFormatTypes, app.NATSFormatType)
+	}
+	if len(extraFormatTypes) > 0 {
+		processorOptions = append(processorOptions, app.Options.ExtraFormatTypes(extraFormatTypes))
+	}
+	if h.options.Backpressure != nil {
+		// the clients backing off on throttling are also told when the queue is full
+		processorOptions = append(processorOptions,
+			app.Options.Backpressure(*h.options.Backpressure),
+			app.Options.ReportBusy(true))
+	}
+	if h.admission != nil {
+		processorOptions = append(processorOptions, app.Options.Admission(h.admission))
+	}
+	if h.droppedSpans != nil {
+		processorOptions = append(processorOptions, app.Options.DroppedSpans(h.droppedSpans))
+	}
+	if h.options.WorkerPoolSize > 0 {
+		h.workerPool = app.NewWorkerPool(h.options.WorkerPoolSize)
+		processorOptions = append(processorOptions, app.Options.WorkerPool(h.workerPool))
+	}
+	if h.options.WAL != nil {
+		spanLog, err := wal.Open(*h.options.WAL, logger, metricsFactory)
+		if err != nil {
+			return nil, nil, err
+		}
+		// closed after the span processor is drained, so that the spans left in its queue stay in the log
+		h.closers = append(h.closers, spanLog)
+		processorOptions = append(processorOptions, app.Options.SpanLog(spanLog))
+	}
+	spanProcessor := app.NewSpanProcessor(spanStore, processorOptions...)
+	h.spanProcessor = spanProcessor
+	if h.options.OpenCensus {
+		h.ocReceiver = app.NewOpenCensusHandler(logger, spanProcessor)
+	}
 
-	return app.NewZipkinSpanHandler(logger, spanProcessor, zSanitizer),
-		app.NewJaegerSpanHandler(logger, spanProcessor),
-		nil
+	zConverter := zipkinConv.NewConverter(h.options.ZipkinReferenceRules)
+	zHandler := app.NewZipkinSpanHandler(logger, spanProcessor, zSanitizer, zConverter, metricsFactory)
+	var batchSizeLimiter *app.BatchSizeLimiter
+	if h.options.BatchSize != nil {
+		batchSizeLimiter = app.NewBatchSizeLimiter(*h.options.BatchSize, metricsFactory)
+	}
+	if h.options.Auth != nil {
+		h.authenticator = app.NewAuthenticator(*h.options.Auth, metricsFactory)
+	}
+	// the OTLP and NATS spans are submitted as Jaeger batches through the same chain as the Jaeger Thrift spans
+	batchesHandlerChain := func(handler app.JaegerBatchesHandler) app.JaegerBatchesHandler {
+		if batchSizeLimiter != nil {
+			handler = batchSizeLimiter.JaegerBatchesHandler(handler)
+		}
+		if h.tenantResolver != nil {
+			handler = h.tenantResolver.JaegerBatchesHandler(handler)
+		}
+		if h.authenticator != nil {
+			handler = h.authenticator.JaegerBatchesHandler(handler)
+		}
+		return handler
+	}
+	var tenantHeader string
+	if h.options.Tenancy != nil {
+		tenantHeader = h.options.Tenancy.Header
+	}
+	jHandler := batchesHandlerChain(app.NewJaegerSpanHandler(logger, spanProcessor, metricsFactory))
+	if h.options.GRPCEnabled {
+		// the gRPC clients are authenticated by the interceptor of GRPCServerOptions
+		grpcHandler := app.NewGRPCSpanHandler(logger, spanProcessor, metricsFactory)
+		if batchSizeLimiter != nil {
+			grpcHandler = batchSizeLimiter.JaegerBatchesHandler(grpcHandler)
+		}
+		if h.tenantResolver != nil {
+			grpcHandler = h.tenantResolver.JaegerBatchesHandler(grpcHandler)
+		}
+		h.grpcHandler = app.NewGRPCHandler(logger, grpcHandler, tenantHeader)
+	}
+	if h.options.OTLP {
+		otlpHandler := batchesHandlerChain(app.NewOTLPSpanHandler(logger, spanProcessor, metricsFactory))
+		h.otlpReceiver = app.NewOTLPReceiver(logger, otlpHandler, tenantHeader, metricsFactory)
+	}
+	if h.options.NATS != nil {
+		natsHandler := batchesHandlerChain(app.NewNATSSpanHandler(logger, spanProcessor, metricsFactory))
+		consumer := app.NewNATSConsumer(logger, natsHandler, tenantHeader, metricsFactory)
+		subscription, err := h.options.NATS.Subscribe(consumer.Consume)
+		if err != nil {
+			return nil, nil, err
+		}
+		// closed after the span processor is drained, so that the messages of the drained spans are acknowledged
+		h.closers = append(h.closers, subscription)
+	}
+	if h.tenantResolver != nil {
+		zHandler = h.tenantResolver.ZipkinSpansHandler(zHandler)
+	}
+	if h.authenticator != nil {
+		zHandler = h.authenticator.ZipkinSpansHandler(zHandler)
+	}
+	return zHandler, jHandler, nil
 }
@@ -21,20 +21,58 @@
 package builder
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/Shopify/sarama"
+	saramaMocks "github.com/Shopify/sarama/mocks"
+	"github.com/gorilla/mux"
+	"github.com/olivere/elastic"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
 
 	"github.com/uber/jaeger-lib/metrics"
+	"github.com/uber/tchannel-go"
+	tchanThrift "github.com/uber/tchannel-go/thrift"
+
 	"github.com/uber/jaeger/cmd/builder"
+	"github.com/uber/jaeger/cmd/collector/app"
+	"github.com/uber/jaeger/model"
+	jModel "github.com/uber/jaeger/model/json"
+	badgercfg "github.com/uber/jaeger/pkg/badger/config"
+	"github.com/uber/jaeger/pkg/cassandra"
 	cascfg "github.com/uber/jaeger/pkg/cassandra/config"
 	"github.com/uber/jaeger/pkg/cassandra/mocks"
 	escfg "github.com/uber/jaeger/pkg/es/config"
 	esMocks "github.com/uber/jaeger/pkg/es/mocks"
+	kafkacfg "github.com/uber/jaeger/pkg/kafka/config"
+	natscfg "github.com/uber/jaeger/pkg/nats/config"
+	pgcfg "github.com/uber/jaeger/pkg/postgres/config"
+	tlscfg "github.com/uber/jaeger/pkg/tls/config"
+	badgerSpanstore "github.com/uber/jaeger/plugin/storage/badger/spanstore"
+	casSpanstore "github.com/uber/jaeger/plugin/storage/cassandra/spanstore"
+	esSpanstore "github.com/uber/jaeger/plugin/storage/es/spanstore"
+	"github.com/uber/jaeger/storage/spanstore"
+	"github.com/uber/jaeger/storage/spanstore/deadline"
 	"github.com/uber/jaeger/storage/spanstore/memory"
+	"github.com/uber/jaeger/storage/spanstore/wal"
+	"github.com/uber/jaeger/thrift-gen/jaeger"
+	"github.com/uber/jaeger/thrift-gen/zipkincore"
 )
 
 func TestNewSpanHandlerBuilder(t *testing.T) {
@@ -95,6 +133,563 @@ func TestNewSpanHandlerBuilderMemorySet(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, jHandler)
 	assert.NotNil(t, zHandler)
+	assert.Nil(t, handler.SamplingManager())
+	assert.Nil(t, handler.GRPCHandler())
+	assert.Nil(t, handler.OpenCensusReceiver())
+	assert.Nil(t, handler.OTLPReceiver())
+	assert.Nil(t, handler.DroppedSpans())
+	assert.Nil(t, handler.WorkerPool())
+}
+
+func TestNewSpanHandlerBuilderGRPCEnabled(t *testing.T) {
+	originalArgs := os.Args
+	defer func() {
+		os.Args = originalArgs
+	}()
+	os.Args = []string{"test", "--span-storage.type=memory"}
+	flag.Parse()
+	handler, err := NewSpanHandlerBuilder(
+		builder.Options.MemoryStoreOption(memory.NewStore()),
+		builder.Options.GRPCEnabledOption(true),
+	)
+	assert.NoError(t, err)
+	_, _, err = handler.BuildHandlers()
+	assert.NoError(t, err)
+	assert.NotNil(t, handler.GRPCHandler())
+}
+
+func TestCloseDrainsQueuedSpans(t *testing.T) {
+	memStore := memory.NewStore()
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions())
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans:   []*jaeger.Span{{TraceIdLow: 1, SpanId: 1, OperationName: "op"}},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+
+	dropped, err := mBuilder.Close(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, dropped)
+	_, err = memStore.GetTrace(model.TraceID{Low: 1})
+	assert.NoError(t, err, "queued spans are saved before Close returns")
+}
+
+func TestZipkinReferenceRulesOption(t *testing.T) {
+	memStore := memory.NewStore()
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions(
+		builder.Options.ZipkinReferenceRulesOption([]string{"consumer"}, nil),
+	))
+	zHandler, _, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	parentID := int64(1)
+	_, err = zHandler.SubmitZipkinBatch(nil, []*zipkincore.Span{
+		{TraceID: 1, ID: 2, ParentID: &parentID, Name: "op", BinaryAnnotations: []*zipkincore.BinaryAnnotation{
+			{Key: "span.kind", Value: []byte("consumer"), AnnotationType: zipkincore.AnnotationType_STRING},
+			{Key: zipkincore.LOCAL_COMPONENT, Value: []byte("queue"), Host: &zipkincore.Endpoint{ServiceName: "svc"}},
+		}},
+	})
+	require.NoError(t, err)
+
+	_, err = mBuilder.Close(context.Background())
+	assert.NoError(t, err)
+	trace, err := memStore.GetTrace(model.TraceID{Low: 1})
+	require.NoError(t, err)
+	require.Len(t, trace.Spans, 1)
+	assert.Equal(t, model.SpanID(0), trace.Spans[0].ParentSpanID)
+	assert.Equal(t, []model.SpanRef{{RefType: model.FollowsFrom, TraceID: model.TraceID{Low: 1}, SpanID: 1}}, trace.Spans[0].References)
+}
+
+func TestAsyncWriterOption(t *testing.T) {
+	memStore := memory.NewStore()
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions(
+		builder.Options.AsyncWriterOption(10, 2, true),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	require.Len(t, mBuilder.closers, 2)
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans:   []*jaeger.Span{{TraceIdLow: 1, SpanId: 1, OperationName: "op"}},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = mBuilder.Close(context.Background())
+	assert.NoError(t, err)
+	_, err = memStore.GetTrace(model.TraceID{Low: 1})
+	assert.NoError(t, err, "buffered spans are saved before Close returns")
+}
+
+func TestCircuitBreakerOption(t *testing.T) {
+	memStore := memory.NewStore()
+	metricsFactory := metrics.NewLocalFactory(0)
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions(
+		builder.Options.MetricsFactoryOption(metricsFactory),
+		builder.Options.CircuitBreakerOption(5, time.Second, 30*time.Second, 100),
+		builder.Options.AsyncWriterOption(10, 2, true),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	require.Len(t, mBuilder.closers, 3)
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans:   []*jaeger.Span{{TraceIdLow: 1, SpanId: 1, OperationName: "op"}},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = mBuilder.Close(context.Background())
+	assert.NoError(t, err)
+	_, err = memStore.GetTrace(model.TraceID{Low: 1})
+	assert.NoError(t, err)
+	_, gauges := metricsFactory.Snapshot()
+	assert.EqualValues(t, 0, gauges["circuit-breaker.state"])
+}
+
+func TestWriteDeadlineOption(t *testing.T) {
+	memStore := memory.NewStore()
+	metricsFactory := metrics.NewLocalFactory(0)
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions(
+		builder.Options.MetricsFactoryOption(metricsFactory),
+		builder.Options.WriteDeadlineOption("memory", time.Minute),
+	))
+	mBuilder.setStorageType("memory")
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans:   []*jaeger.Span{{TraceIdLow: 1, SpanId: 1, OperationName: "op"}},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = mBuilder.Close(context.Background())
+	assert.NoError(t, err)
+	_, err = memStore.GetTrace(model.TraceID{Low: 1})
+	assert.NoError(t, err)
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 0, counts["write-deadline.timed-out-spans|type=memory"])
+
+	_, ok := mBuilder.withWriteDeadline("memory", memStore).(*deadline.Writer)
+	assert.True(t, ok)
+	assert.Equal(t, memStore, mBuilder.withWriteDeadline("cassandra", memStore))
+}
+
+func TestTraceBatchingOption(t *testing.T) {
+	memStore := memory.NewStore()
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions(
+		builder.Options.TraceBatchingOption(time.Hour, 0, 0, 0),
+		builder.Options.AsyncWriterOption(10, 2, true),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	require.Len(t, mBuilder.closers, 3)
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans:   []*jaeger.Span{{TraceIdLow: 1, SpanId: 1, OperationName: "op"}},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = mBuilder.Close(context.Background())
+	assert.NoError(t, err)
+	_, err = memStore.GetTrace(model.TraceID{Low: 1})
+	assert.NoError(t, err, "batched spans are saved before Close returns")
+}
+
+func TestTailSamplingOption(t *testing.T) {
+	memStore := memory.NewStore()
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions(
+		builder.Options.TailSamplingOption(time.Hour, time.Second),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	require.Len(t, mBuilder.closers, 2)
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans: []*jaeger.Span{
+				{TraceIdLow: 1, SpanId: 1, OperationName: "sampled", Flags: 1},
+				{TraceIdLow: 2, SpanId: 2, OperationName: "slow", Duration: 2000000},
+				{TraceIdLow: 3, SpanId: 3, OperationName: "fast", Duration: 1000},
+			},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = mBuilder.Close(context.Background())
+	assert.NoError(t, err)
+	_, err = memStore.GetTrace(model.TraceID{Low: 1})
+	assert.NoError(t, err, "sampled traces are kept")
+	_, err = memStore.GetTrace(model.TraceID{Low: 2})
+	assert.NoError(t, err, "slow traces are kept")
+	_, err = memStore.GetTrace(model.TraceID{Low: 3})
+	assert.Error(t, err, "other traces are dropped")
+}
+
+func TestTailSamplingRootOption(t *testing.T) {
+	memStore := memory.NewStore()
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions(
+		builder.Options.TailSamplingOption(time.Hour, 0),
+		builder.Options.TailSamplingRootOption(true),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans: []*jaeger.Span{
+				{TraceIdLow: 1, SpanId: 1, OperationName: "root", Flags: 1},
+				{TraceIdLow: 1, SpanId: 2, ParentSpanId: 1, OperationName: "child", Flags: 1},
+				{TraceIdLow: 2, SpanId: 3, ParentSpanId: 4, OperationName: "orphan", Flags: 1},
+			},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = mBuilder.Close(context.Background())
+	assert.NoError(t, err)
+	trace, err := memStore.GetTrace(model.TraceID{Low: 1})
+	require.NoError(t, err, "traces with their root are kept")
+	assert.Len(t, trace.Spans, 2)
+	_, err = memStore.GetTrace(model.TraceID{Low: 2})
+	assert.Error(t, err, "orphan fragments are dropped")
+}
+
+func TestMemoryStoreSnapshotOnClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jaeger-memory-snapshot")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshot")
+
+	options := builder.ApplyOptions(builder.Options.MemoryStoreOption(memory.NewStore(), memory.Options.SnapshotPath(path)))
+	mBuilder := newMemoryStoreBuilder(options.MemoryStore, options)
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans:   []*jaeger.Span{{TraceIdLow: 1, SpanId: 1, OperationName: "op"}},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+	_, err = mBuilder.Close(context.Background())
+	require.NoError(t, err)
+
+	_, err = memory.NewStore(memory.Options.SnapshotPath(path)).GetTrace(model.TraceID{Low: 1})
+	assert.NoError(t, err, "the traces of the closed store are loaded by the next one")
+}
+
+func TestSpanRoutingOption(t *testing.T) {
+	memStore := memory.NewStore()
+	errorStore := memory.NewStore()
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions(
+		builder.Options.SpanRoutingOption(spanstore.Route{Name: "errors", Tag: "error", Value: "true", Writer: errorStore}),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	isError := true
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans: []*jaeger.Span{
+				{TraceIdLow: 1, SpanId: 1, OperationName: "op", Tags: []*jaeger.Tag{
+					{Key: "error", VType: jaeger.TagType_BOOL, VBool: &isError},
+				}},
+				{TraceIdLow: 2, SpanId: 1, OperationName: "op"},
+			},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+	_, err = mBuilder.Close(context.Background())
+	require.NoError(t, err)
+
+	_, err = errorStore.GetTrace(model.TraceID{Low: 1})
+	assert.NoError(t, err)
+	_, err = memStore.GetTrace(model.TraceID{Low: 2})
+	assert.NoError(t, err)
+	_, err = memStore.GetTrace(model.TraceID{Low: 1})
+	assert.Error(t, err)
+}
+
+func TestBackpressureOption(t *testing.T) {
+	memStore := memory.NewStore()
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions(
+		builder.Options.BackpressureOption(0.5, 0),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	res, err := jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans:   []*jaeger.Span{{TraceIdLow: 1, SpanId: 1, OperationName: "op"}},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err, "the batches are accepted below the high-water mark")
+	require.Len(t, res, 1)
+	assert.True(t, res[0].Ok)
+}
+
+func TestAdmissionOption(t *testing.T) {
+	mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		// a running collector always has more than one goroutine
+		builder.Options.AdmissionOption(app.AdmissionOptions{MaxGoroutines: 1, CheckInterval: time.Hour}),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans:   []*jaeger.Span{{TraceIdLow: 1, SpanId: 1, OperationName: "op"}},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	assert.Equal(t, tchannel.ErrServerBusy, err)
+	_, err = mBuilder.Close(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, mBuilder.admission)
+}
+
+func TestDroppedSpansOption(t *testing.T) {
+	mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.DroppedSpansOption(10, 1),
+		builder.Options.SpanFilterOption(func(span *model.Span) bool { return span.OperationName != "blocked" }),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	require.NotNil(t, mBuilder.DroppedSpans())
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans: []*jaeger.Span{
+				{TraceIdLow: 1, SpanId: 1, OperationName: "blocked"},
+				{TraceIdLow: 1, SpanId: 2, OperationName: "op"},
+			},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+	dropped := mBuilder.DroppedSpans().Spans()
+	require.Len(t, dropped, 1)
+	assert.Equal(t, app.DroppedByFilter, dropped[0].Reason)
+	assert.Equal(t, "blocked", dropped[0].Span.OperationName)
+	assert.Equal(t, "svc", dropped[0].Span.Process.ServiceName)
+}
+
+func TestWorkerPoolOption(t *testing.T) {
+	mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.WorkerPoolOption(3),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	workerPool := mBuilder.WorkerPool()
+	require.NotNil(t, workerPool)
+	assert.Equal(t, 3, workerPool.Size())
+	require.NoError(t, workerPool.Resize(5))
+	assert.Equal(t, 5, workerPool.State().Size)
+
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans:   []*jaeger.Span{{TraceIdLow: 1, SpanId: 1, OperationName: "op"}},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+	_, err = mBuilder.Close(context.Background())
+	assert.NoError(t, err)
+}
+
+func TestWALOption(t *testing.T) {
+	directory, err := ioutil.TempDir("", "jaeger-wal")
+	require.NoError(t, err)
+	defer os.RemoveAll(directory)
+	// a span accepted by a previous run that crashed before saving it
+	spanLog, err := wal.Open(wal.Options{Directory: directory}, zap.NewNop(), metrics.NullFactory)
+	require.NoError(t, err)
+	_, err = spanLog.Append(&model.Span{TraceID: model.TraceID{Low: 1}, SpanID: 1, Process: &model.Process{ServiceName: "svc"}})
+	require.NoError(t, err)
+	require.NoError(t, spanLog.Close())
+
+	memStore := memory.NewStore()
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions(
+		builder.Options.WALOption(directory, 0, 0, false),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	_, err = memStore.GetTrace(model.TraceID{Low: 1})
+	assert.NoError(t, err, "the spans of the previous run are saved on start")
+
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans:   []*jaeger.Span{{TraceIdLow: 2, SpanId: 1, OperationName: "op"}},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+	_, err = mBuilder.Close(context.Background())
+	assert.NoError(t, err)
+	_, err = memStore.GetTrace(model.TraceID{Low: 2})
+	assert.NoError(t, err)
+	segments, err := filepath.Glob(filepath.Join(directory, "*.wal"))
+	require.NoError(t, err)
+	assert.Empty(t, segments, "the segments are removed once their spans are saved")
+}
+
+func TestWALOptionWithAsyncWriter(t *testing.T) {
+	mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.WALOption("/tmp/jaeger-wal", 0, 0, false),
+		builder.Options.AsyncWriterOption(10, 2, true),
+	))
+	_, _, err := mBuilder.BuildHandlers()
+	assert.Equal(t, errWALWithAsyncWriter, err)
+}
+
+func TestWALOptionWithTraceBatching(t *testing.T) {
+	mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.WALOption("/tmp/jaeger-wal", 0, 0, false),
+		builder.Options.TraceBatchingOption(time.Second, 0, 0, 0),
+	))
+	_, _, err := mBuilder.BuildHandlers()
+	assert.Equal(t, errWALWithTraceBatching, err)
+}
+
+func TestWALOptionWithTailSampling(t *testing.T) {
+	mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.WALOption("/tmp/jaeger-wal", 0, 0, false),
+		builder.Options.TailSamplingOption(time.Second, time.Second),
+	))
+	_, _, err := mBuilder.BuildHandlers()
+	assert.Equal(t, errWALWithTailSampling, err)
+}
+
+func TestWALOptionWithCircuitBreaker(t *testing.T) {
+	mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.WALOption("/tmp/jaeger-wal", 0, 0, false),
+		builder.Options.CircuitBreakerOption(5, time.Second, 30*time.Second, 100),
+	))
+	_, _, err := mBuilder.BuildHandlers()
+	assert.Equal(t, errWALWithCircuitBreaker, err)
+}
+
+func TestWALOptionWithElasticSearch(t *testing.T) {
+	eBuilder := newESBuilder(&escfg.Configuration{Servers: []string{"127.0.0.1"}}, builder.ApplyOptions(
+		builder.Options.WALOption("/tmp/jaeger-wal", 0, 0, false),
+	))
+	_, _, err := eBuilder.BuildHandlers()
+	assert.Equal(t, errWALWithElasticSearch, err)
+}
+
+func TestNATSOptionWithBufferingWriters(t *testing.T) {
+	nats := builder.Options.NATSOption(natscfg.Configuration{Servers: []string{"nats://127.0.0.1:4222"}, Subject: "jaeger.spans"})
+	for _, option := range []builder.Option{
+		builder.Options.AsyncWriterOption(10, 2, true),
+		builder.Options.TraceBatchingOption(time.Second, 0, 0, 0),
+		builder.Options.TailSamplingOption(time.Second, time.Second),
+		builder.Options.CircuitBreakerOption(5, time.Second, time.Second, 100),
+	} {
+		mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(nats, option))
+		_, _, err := mBuilder.BuildHandlers()
+		assert.Equal(t, errNATSWithBufferingWriter, err)
+	}
+}
+
+func TestNewSpanHandlerBuilderOpenCensus(t *testing.T) {
+	originalArgs := os.Args
+	defer func() {
+		os.Args = originalArgs
+	}()
+	os.Args = []string{"test", "--span-storage.type=memory"}
+	flag.Parse()
+	handler, err := NewSpanHandlerBuilder(
+		builder.Options.MemoryStoreOption(memory.NewStore()),
+		builder.Options.OpenCensusOption(true),
+		builder.Options.OTLPOption(true),
+		builder.Options.GRPCEnabledOption(true),
+	)
+	assert.NoError(t, err)
+	_, _, err = handler.BuildHandlers()
+	assert.NoError(t, err)
+	assert.NotNil(t, handler.OpenCensusReceiver())
+	assert.NotNil(t, handler.OTLPReceiver())
+	assert.NotNil(t, handler.GRPCHandler())
+}
+
+func TestNewSpanHandlerBuilderAdaptiveSampling(t *testing.T) {
+	originalArgs := os.Args
+	defer func() {
+		os.Args = originalArgs
+	}()
+	os.Args = []string{"test", "--span-storage.type=memory"}
+	flag.Parse()
+	handler, err := NewSpanHandlerBuilder(
+		builder.Options.MemoryStoreOption(memory.NewStore()),
+		builder.Options.AdaptiveSamplingOption(1, time.Minute),
+	)
+	assert.NoError(t, err)
+	_, _, err = handler.BuildHandlers()
+	assert.NoError(t, err)
+	samplingManager := handler.SamplingManager()
+	assert.NotNil(t, samplingManager)
+	resp, err := samplingManager.GetSamplingStrategy(nil, "svc")
+	assert.NoError(t, err)
+	assert.NotNil(t, resp.OperationSampling)
+}
+
+func TestCloseStopsAdaptiveSampler(t *testing.T) {
+	mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.AdaptiveSamplingOption(1, time.Minute),
+	))
+	_, _, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	sampler := mBuilder.adaptiveSampler
+	require.NotNil(t, sampler)
+	_, err = mBuilder.Close(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, mBuilder.SamplingManager())
+	assert.Panics(t, sampler.Stop, "the sampler is already stopped")
+}
+
+func TestNewSpanHandlerBuilderStaticSampling(t *testing.T) {
+	originalArgs := os.Args
+	defer func() {
+		os.Args = originalArgs
+	}()
+	os.Args = []string{"test", "--span-storage.type=memory"}
+	flag.Parse()
+	directory, err := ioutil.TempDir("", "strategies")
+	require.NoError(t, err)
+	defer os.RemoveAll(directory)
+	path := filepath.Join(directory, "strategies.json")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"default_strategy": {"type": "probabilistic", "param": 0.5}}`), 0644))
+
+	handler, err := NewSpanHandlerBuilder(
+		builder.Options.MemoryStoreOption(memory.NewStore()),
+		builder.Options.StaticSamplingOption(path, 0),
+	)
+	require.NoError(t, err)
+	_, _, err = handler.BuildHandlers()
+	require.NoError(t, err)
+	defer handler.Close(context.Background())
+	samplingManager := handler.SamplingManager()
+	require.NotNil(t, samplingManager)
+	resp, err := samplingManager.GetSamplingStrategy(nil, "svc")
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, resp.ProbabilisticSampling.SamplingRate)
+
+	handler, err = NewSpanHandlerBuilder(
+		builder.Options.MemoryStoreOption(memory.NewStore()),
+		builder.Options.StaticSamplingOption(path, 0),
+		builder.Options.AdaptiveSamplingOption(1, time.Minute),
+	)
+	require.NoError(t, err)
+	_, _, err = handler.BuildHandlers()
+	assert.Equal(t, errStaticWithAdaptiveSampling, err)
 }
 
 func TestNewSpanHandlerBuilderElasticSearch(t *testing.T) {
@@ -130,13 +725,30 @@ func withCassandraBuilder(f func(builder *cassandraSpanHandlerBuilder)) {
 	cfg := &cascfg.Configuration{
 		Servers: []string{"127.0.0.1"},
 	}
-	cBuilder := newCassandraBuilder(cfg, zap.NewNop(), metrics.NullFactory)
+	cBuilder := newCassandraBuilder(cfg, builder.ApplyOptions())
 	f(cBuilder)
 }
 
+// mockCassandraSchema makes the session report the schema version
+func mockCassandraSchema(session *mocks.Session, version int) {
+	iter := &mocks.Iterator{}
+	iter.On("Scan", mock.Anything).Return(func(dest ...interface{}) bool {
+		*(dest[0].(*int)) = version
+		return true
+	})
+	iter.On("Close").Return(nil)
+	query := &mocks.Query{}
+	query.On("Iter").Return(iter)
+	isVersionQuery := func(stmt string) bool {
+		return strings.Contains(stmt, "FROM schema_version")
+	}
+	session.On("Query", mock.MatchedBy(isVersionQuery), mock.Anything).Return(query)
+}
+
 func TestBuildHandlersCassandra(t *testing.T) {
 	withCassandraBuilder(func(cBuilder *cassandraSpanHandlerBuilder) {
 		mockSession := mocks.Session{}
+		mockCassandraSchema(&mockSession, casSpanstore.SchemaVersion)
 		cBuilder.session = &mockSession
 		zHandler, jHandler, err := cBuilder.BuildHandlers()
 		assert.NoError(t, err)
@@ -145,6 +757,59 @@ func TestBuildHandlersCassandra(t *testing.T) {
 	})
 }
 
+func TestBuildHandlersCassandraErrorSpanTTL(t *testing.T) {
+	withCassandraBuilder(func(cBuilder *cassandraSpanHandlerBuilder) {
+		mockSession := mocks.Session{}
+		mockCassandraSchema(&mockSession, casSpanstore.SchemaVersion)
+		mockSession.On("Close").Return()
+		cBuilder.session = &mockSession
+		cBuilder.configuration.ErrorSpanTTL = 30 * 24 * time.Hour
+		_, _, err := cBuilder.BuildHandlers()
+		require.NoError(t, err)
+		require.NotEmpty(t, cBuilder.closers)
+		// no span is written once the session is closed
+		assert.IsType(t, &casSpanstore.ErrorTraceWriter{}, cBuilder.closers[0])
+		_, err = cBuilder.Close(context.Background())
+		assert.NoError(t, err)
+		mockSession.AssertCalled(t, "Close")
+	})
+}
+
+func TestBuildHandlersCassandraSchemaMismatch(t *testing.T) {
+	withCassandraBuilder(func(cBuilder *cassandraSpanHandlerBuilder) {
+		mockSession := mocks.Session{}
+		mockCassandraSchema(&mockSession, casSpanstore.SchemaVersion+1)
+		cBuilder.session = &mockSession
+		zHandler, jHandler, err := cBuilder.BuildHandlers()
+		assert.EqualError(t, err, fmt.Sprintf(
+			"Cassandra schema version %d is newer than the version %d of this collector",
+			casSpanstore.SchemaVersion+1, casSpanstore.SchemaVersion))
+		assert.Nil(t, zHandler)
+		assert.Nil(t, jHandler)
+	})
+}
+
+func TestBuildHandlersCassandraHealthCheck(t *testing.T) {
+	cBuilder := newCassandraBuilder(&cascfg.Configuration{Servers: []string{"127.0.0.1"}}, builder.ApplyOptions(
+		builder.Options.HealthCheckOption(time.Hour, 1, 1),
+	))
+	query := &mocks.Query{}
+	query.On("Exec").Return(errors.New("unreachable"))
+	mockSession := &mocks.Session{}
+	mockSession.On("Query", cassandra.HealthQuery, mock.Anything).Return(query)
+	mockSession.On("Close").Return()
+	mockCassandraSchema(mockSession, casSpanstore.SchemaVersion)
+	cBuilder.session = mockSession
+	_, _, err := cBuilder.BuildHandlers()
+	require.NoError(t, err)
+	defer cBuilder.Close(context.Background())
+
+	healthCheck := cBuilder.HealthCheck()
+	require.NotNil(t, healthCheck)
+	assert.False(t, healthCheck.Probe())
+	query.AssertExpectations(t)
+}
+
 func TestBuildHandlersCassandraFailure(t *testing.T) {
 	withCassandraBuilder(func(cBuilder *cassandraSpanHandlerBuilder) {
 		cBuilder.configuration.Servers = []string{"badhostname"}
@@ -155,35 +820,1486 @@ func TestBuildHandlersCassandraFailure(t *testing.T) {
 	})
 }
 
-func TestDefaultSpanFilter(t *testing.T) {
-	assert.True(t, defaultSpanFilter(nil))
+func TestBuildHandlersCassandraBadCompression(t *testing.T) {
+	withCassandraBuilder(func(cBuilder *cassandraSpanHandlerBuilder) {
+		mockSession := mocks.Session{}
+		cBuilder.session = &mockSession
+		cBuilder.configuration.SpanCompression = "lz4"
+		zHandler, jHandler, err := cBuilder.BuildHandlers()
+		assert.EqualError(t, err, `Unknown span compression "lz4"`)
+		assert.Nil(t, zHandler)
+		assert.Nil(t, jHandler)
+	})
 }
 
-func withElasticSearchBuilder(f func(builder *esSpanHandlerBuilder)) {
-	cfg := &escfg.Configuration{
-		Servers: []string{"127.0.0.1"},
-	}
-	cBuilder := newESBuilder(cfg, zap.NewNop(), metrics.NullFactory)
-	f(cBuilder)
+func TestBuildHandlersCassandraBadConsistency(t *testing.T) {
+	withCassandraBuilder(func(cBuilder *cassandraSpanHandlerBuilder) {
+		mockSession := mocks.Session{}
+		cBuilder.session = &mockSession
+		cBuilder.configuration.WriteConsistency = "MOST"
+		zHandler, jHandler, err := cBuilder.BuildHandlers()
+		assert.EqualError(t, err, `Invalid consistency level "MOST", expected one of ALL, ANY, EACH_QUORUM, LOCAL_ONE, LOCAL_QUORUM, ONE, QUORUM, THREE, TWO`)
+		assert.Nil(t, zHandler)
+		assert.Nil(t, jHandler)
+	})
 }
 
-func TestBuildHandlersElasticSearch(t *testing.T) {
-	withElasticSearchBuilder(func(builder *esSpanHandlerBuilder) {
-		mockClient := esMocks.Client{}
-		builder.client = &mockClient
-		zHandler, jHandler, err := builder.BuildHandlers()
-		assert.NoError(t, err)
-		assert.NotNil(t, zHandler)
-		assert.NotNil(t, jHandler)
+func TestBuildHandlersCassandraMissingLocalDC(t *testing.T) {
+	withCassandraBuilder(func(cBuilder *cassandraSpanHandlerBuilder) {
+		mockSession := mocks.Session{}
+		cBuilder.session = &mockSession
+		cBuilder.configuration.LoadBalancingPolicy = cascfg.DCAwarePolicy
+		zHandler, jHandler, err := cBuilder.BuildHandlers()
+		assert.EqualError(t, err, "The local datacenter must be set with the dc-aware load balancing policy")
+		assert.Nil(t, zHandler)
+		assert.Nil(t, jHandler)
 	})
 }
 
-func TestBuildHandlersElasticSearchFailure(t *testing.T) {
-	withElasticSearchBuilder(func(builder *esSpanHandlerBuilder) {
-		builder.configuration.Servers = []string{}
-		zHandler, jHandler, err := builder.BuildHandlers()
+func TestBuildHandlersCassandraSharded(t *testing.T) {
+	cBuilder := newCassandraBuilder(&cascfg.Configuration{
+		Servers:        []string{"127.0.0.1", "127.0.0.2"},
+		ShardingScheme: "rendezvous",
+	}, builder.ApplyOptions(
+		builder.Options.HealthCheckOption(time.Hour, 1, 1),
+	))
+	healthy := &mocks.Query{}
+	healthy.On("Exec").Return(nil)
+	unhealthy := &mocks.Query{}
+	unhealthy.On("Exec").Return(errors.New("unreachable"))
+	first := &mocks.Session{}
+	first.On("Query", cassandra.HealthQuery, mock.Anything).Return(healthy)
+	mockCassandraSchema(first, casSpanstore.SchemaVersion)
+	second := &mocks.Session{}
+	second.On("Query", cassandra.HealthQuery, mock.Anything).Return(unhealthy)
+	mockCassandraSchema(second, casSpanstore.SchemaVersion)
+	cBuilder.shardSessions = []cassandra.Session{first, second}
+	zHandler, jHandler, err := cBuilder.BuildHandlers()
+	require.NoError(t, err)
+	assert.NotNil(t, zHandler)
+	assert.NotNil(t, jHandler)
+	assert.Len(t, cBuilder.closers, 2)
+
+	assert.EqualError(t, cBuilder.probe(), "Cassandra shard 127.0.0.2 is unavailable: unreachable")
+}
+
+func TestBuildHandlersCassandraBadShardingScheme(t *testing.T) {
+	withCassandraBuilder(func(cBuilder *cassandraSpanHandlerBuilder) {
+		cBuilder.configuration.ShardingScheme = "random"
+		zHandler, jHandler, err := cBuilder.BuildHandlers()
+		assert.EqualError(t, err, `Unknown sharding scheme "random"`)
+		assert.Nil(t, zHandler)
+		assert.Nil(t, jHandler)
+	})
+}
+
+func TestBuildHandlersCassandraShardedFailure(t *testing.T) {
+	withCassandraBuilder(func(cBuilder *cassandraSpanHandlerBuilder) {
+		cBuilder.configuration.Servers = []string{"badhostname"}
+		cBuilder.configuration.ShardingScheme = "modulo"
+		zHandler, jHandler, err := cBuilder.BuildHandlers()
 		assert.Error(t, err)
 		assert.Nil(t, zHandler)
 		assert.Nil(t, jHandler)
+		assert.Nil(t, cBuilder.shardSessions)
+	})
+}
+
+func TestDefaultSpanFilter(t *testing.T) {
+	assert.True(t, defaultSpanFilter(nil))
+}
+
+func TestSpanFilterOption(t *testing.T) {
+	isNotHealthCheck := func(span *model.Span) bool {
+		return span.OperationName != "health"
+	}
+	metricsFactory := metrics.NewLocalFactory(0)
+	mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.MetricsFactoryOption(metricsFactory),
+		builder.Options.SpanFilterOption(isNotHealthCheck),
+	))
+	filter := mBuilder.spanFilter()
+	assert.False(t, filter(&model.Span{OperationName: "health"}))
+	assert.True(t, filter(&model.Span{OperationName: "GET"}))
+
+	_, jHandler, err := mBuilder.BuildHandlers()
+	assert.NoError(t, err)
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans:   []*jaeger.Span{{OperationName: "health"}},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	assert.NoError(t, err)
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["jaeger.spans.rejected"])
+}
+
+func TestSamplingDecisionsOption(t *testing.T) {
+	var filtered []*model.Span
+	recordSpan := func(span *model.Span) bool {
+		filtered = append(filtered, span)
+		return true
+	}
+	mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.SamplingDecisionsOption(true, nil),
+		builder.Options.SpanFilterOption(recordSpan),
+		builder.Options.TagSanitizerOption([]string{"http.url"}, nil, 0),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	samplerType := "probabilistic"
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans: []*jaeger.Span{{
+				OperationName: "GET",
+				Tags:          []*jaeger.Tag{{Key: "sampler.type", VType: jaeger.TagType_STRING, VStr: &samplerType}},
+			}},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, filtered, 1)
+	tag, ok := filtered[0].Tags.FindByKey(app.HeadSamplingTag)
+	assert.True(t, ok)
+	assert.Equal(t, "probabilistic", tag.AsString())
+	assert.Equal(t, []string{"http.url", app.HeadSamplingTag, app.TailSamplingTag}, mBuilder.tagSanitizerOptions().AllowList)
+}
+
+func TestCorrelationTagOption(t *testing.T) {
+	var filtered []*model.Span
+	recordSpan := func(span *model.Span) bool {
+		filtered = append(filtered, span)
+		return true
+	}
+	mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.CorrelationTagOption("", app.HexCorrelation),
+		builder.Options.SpanFilterOption(recordSpan),
+		builder.Options.TagSanitizerOption([]string{"http.url"}, nil, 0),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans:   []*jaeger.Span{{TraceIdLow: 0x10, OperationName: "GET"}},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, filtered, 1)
+	tag, ok := filtered[0].Tags.FindByKey(app.DefaultCorrelationTag)
+	assert.True(t, ok)
+	assert.Equal(t, "00000000000000000000000000000010", tag.AsString())
+	assert.Equal(t, []string{"http.url", app.DefaultCorrelationTag}, mBuilder.tagSanitizerOptions().AllowList)
+}
+
+func TestCollectorTagOption(t *testing.T) {
+	var filtered []*model.Span
+	recordSpan := func(span *model.Span) bool {
+		filtered = append(filtered, span)
+		return true
+	}
+	mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.CollectorTagOption("collector.hostname", map[string]string{"region": "us-east-1"}),
+		builder.Options.SpanFilterOption(recordSpan),
+		builder.Options.TagSanitizerOption([]string{"http.url"}, nil, 0),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans:   []*jaeger.Span{{TraceIdLow: 1, OperationName: "GET"}},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, filtered, 1)
+	hostname, _ := os.Hostname()
+	tag, ok := filtered[0].Tags.FindByKey("collector.hostname")
+	assert.True(t, ok)
+	assert.Equal(t, hostname, tag.AsString())
+	tag, ok = filtered[0].Tags.FindByKey("region")
+	assert.True(t, ok)
+	assert.Equal(t, "us-east-1", tag.AsString())
+	assert.Equal(t, []string{"http.url", "collector.hostname", "region"}, mBuilder.tagSanitizerOptions().AllowList)
+}
+
+func TestEnrichmentOption(t *testing.T) {
+	var filtered []*model.Span
+	recordSpan := func(span *model.Span) bool {
+		filtered = append(filtered, span)
+		return true
+	}
+	provider := app.MetadataProviderFunc(func(serviceName string) (map[string]string, error) {
+		return map[string]string{"owner": serviceName + "-team", "env": "prod"}, nil
+	})
+	mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.EnrichmentOption(provider, []string{"owner"}, time.Minute, 0),
+		builder.Options.SpanFilterOption(recordSpan),
+		builder.Options.TagSanitizerOption([]string{"http.url"}, nil, 0),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans:   []*jaeger.Span{{TraceIdLow: 1, OperationName: "GET"}},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, filtered, 1)
+	assert.Equal(t, model.KeyValues{model.String("owner", "svc-team")}, filtered[0].Tags)
+	options := mBuilder.tagSanitizerOptions()
+	assert.Equal(t, []string{"http.url"}, options.AllowList)
+	assert.True(t, options.AllowFunc("owner"))
+	assert.False(t, options.AllowFunc("env"))
+}
+
+func TestEnrichmentAllTagsOption(t *testing.T) {
+	provider := app.MetadataProviderFunc(func(serviceName string) (map[string]string, error) {
+		return map[string]string{"owner": serviceName + "-team", "env": "prod"}, nil
+	})
+	memStore := memory.NewStore()
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions(
+		builder.Options.EnrichmentOption(provider, nil, time.Minute, 0),
+		builder.Options.TagSanitizerOption([]string{"http.url"}, nil, 0),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	user := "alice"
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans: []*jaeger.Span{{
+				TraceIdLow:    1,
+				OperationName: "GET",
+				Tags:          []*jaeger.Tag{{Key: "user", VType: jaeger.TagType_STRING, VStr: &user}},
+			}},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+	_, err = mBuilder.Close(context.Background())
+	require.NoError(t, err)
+	trace, err := memStore.GetTrace(model.TraceID{Low: 1})
+	require.NoError(t, err)
+	require.Len(t, trace.Spans, 1)
+	assert.Equal(t, model.KeyValues{model.String("env", "prod"), model.String("owner", "svc-team")}, trace.Spans[0].Tags,
+		"all the metadata is kept by the sanitizer, unlike the other tags")
+}
+
+func TestOperationCardinalityOption(t *testing.T) {
+	var filtered []*model.Span
+	recordSpan := func(span *model.Span) bool {
+		filtered = append(filtered, span)
+		return true
+	}
+	mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.OperationCardinalityOption(1, "templated"),
+		builder.Options.SpanFilterOption(recordSpan),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans:   []*jaeger.Span{{OperationName: "GET /users/1"}, {OperationName: "GET /users/2"}},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
 	})
+	require.NoError(t, err)
+	require.Len(t, filtered, 2)
+	assert.Equal(t, "GET /users/1", filtered[0].OperationName)
+	assert.Equal(t, "templated", filtered[1].OperationName)
+}
+
+func TestNewSpanWriter(t *testing.T) {
+	memStore := memory.NewStore()
+	spanWriter, closer, err := NewSpanWriter("memory", builder.Options.MemoryStoreOption(memStore))
+	require.NoError(t, err)
+	require.NoError(t, spanWriter.WriteSpan(&model.Span{TraceID: model.TraceID{Low: 1}, SpanID: 1, Process: &model.Process{ServiceName: "svc"}}))
+	assert.NoError(t, closer.Close())
+	_, err = memStore.GetTrace(model.TraceID{Low: 1})
+	assert.NoError(t, err)
+
+	_, _, err = NewSpanWriter("cassandra")
+	assert.Equal(t, errMissingCassandraConfig, err)
+}
+
+func TestTenancyOption(t *testing.T) {
+	memStore := memory.NewStore()
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions(
+		builder.Options.TenancyOption("", "team"),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	team := "payments"
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans: []*jaeger.Span{
+				{TraceIdLow: 1, SpanId: 1, OperationName: "op", Tags: []*jaeger.Tag{{Key: "team", VType: jaeger.TagType_STRING, VStr: &team}}},
+				{TraceIdLow: 2, SpanId: 1, OperationName: "op"},
+			},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+	_, err = mBuilder.Close(context.Background())
+	assert.NoError(t, err)
+	services, err := memStore.GetServices()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"payments/svc"}, services, "the spans without a tenant are rejected")
+}
+
+func TestTenancyOptionHeaderWithOpenCensus(t *testing.T) {
+	mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.TenancyOption("x-tenant", ""),
+		builder.Options.OpenCensusOption(true),
+	))
+	_, _, err := mBuilder.BuildHandlers()
+	assert.Equal(t, errTenantHeaderWithoutHeaders, err)
+}
+
+func TestTenancyOptionHeaderWithGRPC(t *testing.T) {
+	memStore := memory.NewStore()
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions(
+		builder.Options.TenancyOption("x-tenant", ""),
+		builder.Options.GRPCEnabledOption(true),
+	))
+	_, _, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-tenant", "payments"))
+	_, err = mBuilder.GRPCHandler().Collect(ctx, &app.CollectRequest{
+		Spans: []*jModel.Span{
+			{TraceID: "1", SpanID: "1", ParentSpanID: "0", OperationName: "op", Process: &jModel.Process{ServiceName: "svc"}},
+		},
+	})
+	require.NoError(t, err)
+	_, err = mBuilder.Close(context.Background())
+	require.NoError(t, err)
+	services, err := memStore.GetServices()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"payments/svc"}, services)
+}
+
+func TestTagMappingAndSpanMutatorOptions(t *testing.T) {
+	var filtered []*model.Span
+	recordSpan := func(span *model.Span) bool {
+		filtered = append(filtered, span)
+		return true
+	}
+	memStore := memory.NewStore()
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions(
+		builder.Options.TagMappingOption(app.TagMappings{
+			Keys: map[string]string{"status_code": "http.status_code"},
+		}),
+		builder.Options.SpanMutatorOption(func(span *model.Span) {
+			span.OperationName = strings.ToUpper(span.OperationName)
+		}),
+		builder.Options.SpanFilterOption(recordSpan),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	require.NotNil(t, mBuilder.TagNormalizer())
+	statusCode := int64(200)
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans: []*jaeger.Span{{
+				OperationName: "get",
+				Tags:          []*jaeger.Tag{{Key: "status_code", VType: jaeger.TagType_LONG, VLong: &statusCode}},
+			}},
+			Process: &jaeger.Process{
+				ServiceName: "svc",
+				Tags:        []*jaeger.Tag{{Key: "status_code", VType: jaeger.TagType_LONG, VLong: &statusCode}},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	// the filters see the spans already mutated
+	require.Len(t, filtered, 1)
+	assert.Equal(t, "GET", filtered[0].OperationName)
+	assert.Equal(t, "http.status_code", filtered[0].Tags[0].Key)
+	assert.Equal(t, "http.status_code", filtered[0].Process.Tags[0].Key)
+	_, err = mBuilder.Close(context.Background())
+	assert.NoError(t, err)
+}
+
+func TestHTTPStatusRuleOption(t *testing.T) {
+	var filtered []*model.Span
+	recordSpan := func(span *model.Span) bool {
+		filtered = append(filtered, span)
+		return true
+	}
+	mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.TagMappingOption(app.TagMappings{
+			Keys: map[string]string{"status": "http.status"},
+		}),
+		builder.Options.HTTPStatusRuleOption(app.HTTPStatusRules{
+			Default: app.HTTPStatusRule{SourceKeys: []string{"http.status"}},
+		}),
+		builder.Options.SpanFilterOption(recordSpan),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	require.NotNil(t, mBuilder.HTTPStatusNormalizer())
+	status := "500"
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans: []*jaeger.Span{{
+				OperationName: "get",
+				Tags:          []*jaeger.Tag{{Key: "status", VType: jaeger.TagType_STRING, VStr: &status}},
+			}},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+
+	// the rules see the normalized tag keys, and the filters the canonical status code
+	require.Len(t, filtered, 1)
+	statusCode, ok := filtered[0].Tags.FindByKey(app.HTTPStatusCodeKey)
+	require.True(t, ok)
+	assert.EqualValues(t, 500, statusCode.Int64())
+	errorTag, ok := filtered[0].Tags.FindByKey("error")
+	require.True(t, ok)
+	assert.True(t, errorTag.Bool())
+	_, ok = filtered[0].Tags.FindByKey("http.status")
+	assert.False(t, ok)
+	_, err = mBuilder.Close(context.Background())
+	assert.NoError(t, err)
+}
+
+func TestOperationNameRuleOption(t *testing.T) {
+	var filtered []*model.Span
+	recordSpan := func(span *model.Span) bool {
+		filtered = append(filtered, span)
+		return true
+	}
+	mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.TagMappingOption(app.TagMappings{
+			Keys: map[string]string{"route": "http.route"},
+		}),
+		builder.Options.OperationNameRuleOption(app.OperationNameRules{
+			"svc": {{Pattern: "^HTTP GET$", Tag: "http.route"}},
+		}),
+		builder.Options.SpanFilterOption(recordSpan),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	require.NotNil(t, mBuilder.OperationNameRewriter())
+	route := "/users/{id}"
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans: []*jaeger.Span{{
+				OperationName: "HTTP GET",
+				Tags:          []*jaeger.Tag{{Key: "route", VType: jaeger.TagType_STRING, VStr: &route}},
+			}},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, filtered, 1)
+	assert.Equal(t, route, filtered[0].OperationName, "the rules see the normalized tag keys")
+
+	mBuilder = newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.OperationNameRuleOption(app.OperationNameRules{"svc": {{Pattern: "("}}}),
+	))
+	_, _, err = mBuilder.BuildHandlers()
+	assert.Error(t, err)
+}
+
+func TestDropRuleOption(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	memStore := memory.NewStore()
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions(
+		builder.Options.MetricsFactoryOption(metricsFactory),
+		builder.Options.DropRuleOption(app.DropRules{{Name: "sidecars", ServicePrefix: "envoy-"}}),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	require.NotNil(t, mBuilder.SpanDropper())
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans:   []*jaeger.Span{{TraceIdLow: 1, SpanId: 1, OperationName: "op"}},
+			Process: &jaeger.Process{ServiceName: "envoy-frontend"},
+		},
+		{
+			Spans:   []*jaeger.Span{{TraceIdLow: 1, SpanId: 2, OperationName: "op"}},
+			Process: &jaeger.Process{ServiceName: "frontend"},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = mBuilder.Close(context.Background())
+	assert.NoError(t, err)
+	trace, err := memStore.GetTrace(model.TraceID{Low: 1})
+	require.NoError(t, err)
+	require.Len(t, trace.Spans, 1)
+	assert.Equal(t, "frontend", trace.Spans[0].Process.ServiceName)
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["spans.dropped-by-rule|rule=sidecars"])
+
+	mBuilder = newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.DropRuleOption(app.DropRules{{Name: "sidecars"}}),
+	))
+	_, _, err = mBuilder.BuildHandlers()
+	assert.Error(t, err)
+}
+
+func TestSpanSchemaOption(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	memStore := memory.NewStore()
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions(
+		builder.Options.MetricsFactoryOption(metricsFactory),
+		builder.Options.DropRuleOption(app.DropRules{{Name: "sidecars", ServicePrefix: "envoy-"}}),
+		builder.Options.SpanSchemaOption(app.SchemaRules{{Name: "team", Tag: "team"}}, app.RejectSchemaViolations),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	require.NotNil(t, mBuilder.SpanSchemaValidator())
+	team := "checkout"
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans:   []*jaeger.Span{{TraceIdLow: 1, SpanId: 1, OperationName: "op"}},
+			Process: &jaeger.Process{ServiceName: "envoy-frontend"},
+		},
+		{
+			Spans:   []*jaeger.Span{{TraceIdLow: 1, SpanId: 2, OperationName: "op"}},
+			Process: &jaeger.Process{ServiceName: "frontend"},
+		},
+		{
+			Spans: []*jaeger.Span{{TraceIdLow: 1, SpanId: 3, OperationName: "op"}},
+			Process: &jaeger.Process{ServiceName: "frontend", Tags: []*jaeger.Tag{
+				{Key: "team", VType: jaeger.TagType_STRING, VStr: &team},
+			}},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = mBuilder.Close(context.Background())
+	assert.NoError(t, err)
+	trace, err := memStore.GetTrace(model.TraceID{Low: 1})
+	require.NoError(t, err)
+	require.Len(t, trace.Spans, 1)
+	assert.Equal(t, model.SpanID(3), trace.Spans[0].SpanID)
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["spans.schema-violations|rule=team|service=frontend"])
+	assert.EqualValues(t, 0, counts["spans.schema-violations|rule=team|service=envoy-frontend"], "dropped first")
+
+	mBuilder = newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.SpanSchemaOption(app.SchemaRules{{Name: "team"}}, app.RejectSchemaViolations),
+	))
+	_, _, err = mBuilder.BuildHandlers()
+	assert.Error(t, err)
+}
+
+func TestSamplingRuleOption(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	memStore := memory.NewStore()
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions(
+		builder.Options.MetricsFactoryOption(metricsFactory),
+		builder.Options.SamplingRuleOption(app.SamplingRules{{Name: "premium", Tag: "user.tier", Value: "premium"}}),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	require.NotNil(t, mBuilder.RuleSampler())
+	tier := "premium"
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans: []*jaeger.Span{{
+				TraceIdLow:    1,
+				SpanId:        1,
+				OperationName: "op",
+				Tags:          []*jaeger.Tag{{Key: "user.tier", VType: jaeger.TagType_STRING, VStr: &tier}},
+			}},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = mBuilder.Close(context.Background())
+	assert.NoError(t, err)
+	trace, err := memStore.GetTrace(model.TraceID{Low: 1})
+	require.NoError(t, err)
+	require.Len(t, trace.Spans, 1)
+	assert.True(t, trace.Spans[0].Flags.IsSampled())
+	tag, ok := trace.Spans[0].Tags.FindByKey(app.ForcedSamplingTag)
+	require.True(t, ok)
+	assert.Equal(t, "premium", tag.AsString())
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["spans.sampling-forced|rule=premium"])
+
+	mBuilder = newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.SamplingRuleOption(app.SamplingRules{{Name: "premium"}}),
+	))
+	_, _, err = mBuilder.BuildHandlers()
+	assert.Error(t, err)
+}
+
+func TestCompositeSamplingOption(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	memStore := memory.NewStore()
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions(
+		builder.Options.MetricsFactoryOption(metricsFactory),
+		builder.Options.TailSamplingOption(time.Hour, 0),
+		builder.Options.CompositeSamplingOption(app.CompositeSamplingConfig{Samplers: []app.SamplerConfig{
+			{Name: "baseline", Type: app.ProbabilisticSampler, Rate: 0.1},
+		}}),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	require.NotNil(t, mBuilder.CompositeSampler())
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans:   []*jaeger.Span{{TraceIdLow: 1, SpanId: 1, OperationName: "op"}},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = mBuilder.Close(context.Background())
+	assert.NoError(t, err)
+	trace, err := memStore.GetTrace(model.TraceID{Low: 1})
+	require.NoError(t, err)
+	require.Len(t, trace.Spans, 1)
+	assert.True(t, trace.Spans[0].Flags.IsSampled())
+	tag, ok := trace.Spans[0].Tags.FindByKey(app.TailSamplingTag)
+	require.True(t, ok)
+	assert.Equal(t, "baseline", tag.AsString())
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["spans.composite-sampling|sampler=baseline|verdict=kept"])
+
+	mBuilder = newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.TailSamplingOption(time.Hour, 0),
+		builder.Options.CompositeSamplingOption(app.CompositeSamplingConfig{}),
+	))
+	_, _, err = mBuilder.BuildHandlers()
+	assert.Error(t, err)
+}
+
+func TestCompositeSamplingOptionWithoutTailSampling(t *testing.T) {
+	mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.CompositeSamplingOption(app.CompositeSamplingConfig{Samplers: []app.SamplerConfig{
+			{Name: "baseline", Type: app.ProbabilisticSampler, Rate: 0.1},
+		}}),
+	))
+	_, _, err := mBuilder.BuildHandlers()
+	assert.Equal(t, errCompositeSamplingWithoutTailSampling, err)
+}
+
+func TestSamplingDecisionCacheOption(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	memStore := memory.NewStore()
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions(
+		builder.Options.MetricsFactoryOption(metricsFactory),
+		builder.Options.TailSamplingOption(time.Hour, 0),
+		builder.Options.CompositeSamplingOption(app.CompositeSamplingConfig{Samplers: []app.SamplerConfig{
+			{Name: "baseline", Type: app.ProbabilisticSampler, Rate: 0.1},
+		}}),
+		builder.Options.SamplingDecisionCacheOption(100, time.Minute),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans: []*jaeger.Span{
+				{TraceIdLow: 1, SpanId: 1, OperationName: "op"},
+				{TraceIdLow: 1, SpanId: 2, ParentSpanId: 1, OperationName: "op"},
+			},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = mBuilder.Close(context.Background())
+	assert.NoError(t, err)
+	trace, err := memStore.GetTrace(model.TraceID{Low: 1})
+	require.NoError(t, err)
+	require.Len(t, trace.Spans, 2)
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["spans.composite-sampling|sampler=baseline|verdict=kept"])
+	assert.EqualValues(t, 1, counts["sampling-decisions.cache|result=miss"])
+	assert.EqualValues(t, 1, counts["sampling-decisions.cache|result=hit"])
+}
+
+func TestServiceAliasOption(t *testing.T) {
+	var filtered []string
+	recordService := func(span *model.Span) bool {
+		filtered = append(filtered, span.Process.ServiceName)
+		return true
+	}
+	metricsFactory := metrics.NewLocalFactory(0)
+	memStore := memory.NewStore()
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions(
+		builder.Options.MetricsFactoryOption(metricsFactory),
+		builder.Options.ServiceAliasOption(app.ServiceAliases{"payments-legacy": "payments"}),
+		builder.Options.SpanFilterOption(recordService),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	require.NotNil(t, mBuilder.ServiceNameRemapper())
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans:   []*jaeger.Span{{TraceIdLow: 1, SpanId: 1, OperationName: "charge"}},
+			Process: &jaeger.Process{ServiceName: "payments-legacy"},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = mBuilder.Close(context.Background())
+	assert.NoError(t, err)
+	// the filters see the new service names
+	assert.Equal(t, []string{"payments"}, filtered)
+	trace, err := memStore.GetTrace(model.TraceID{Low: 1})
+	require.NoError(t, err)
+	require.Len(t, trace.Spans, 1)
+	assert.Equal(t, "payments", trace.Spans[0].Process.ServiceName)
+	tag, ok := trace.Spans[0].Tags.FindByKey(app.OriginalServiceNameTag)
+	require.True(t, ok)
+	assert.Equal(t, "payments-legacy", tag.AsString())
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["spans.services-remapped"])
+}
+
+func TestRateLimitOption(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.MetricsFactoryOption(metricsFactory),
+		builder.Options.RateLimitOption(0, map[string]float64{"svc": 1}),
+	))
+	assert.Nil(t, mBuilder.RateLimiter(), "the rate limiter is created by BuildHandlers")
+
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	require.NotNil(t, mBuilder.RateLimiter())
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans: []*jaeger.Span{
+				{TraceIdLow: 1, SpanId: 1, OperationName: "op"},
+				{TraceIdLow: 1, SpanId: 2, OperationName: "op"},
+				{TraceIdLow: 1, SpanId: 3, OperationName: "op"},
+			},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+		{
+			Spans:   []*jaeger.Span{{TraceIdLow: 2, SpanId: 1, OperationName: "op"}},
+			Process: &jaeger.Process{ServiceName: "other"},
+		},
+	})
+	assert.NoError(t, err)
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counts["spans.rate-limited|service=svc"])
+	assert.EqualValues(t, 0, counts["spans.rate-limited|service=other"], "services without a rate are not limited")
+}
+
+func TestSpanQuotaOption(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.MetricsFactoryOption(metricsFactory),
+		builder.Options.SpanQuotaOption(app.SpanQuotaOptions{Quotas: app.SpanQuotas{Services: map[string]int64{"svc": 1}}}),
+	))
+	assert.Nil(t, mBuilder.SpanQuotaEnforcer(), "the quota enforcer is created by BuildHandlers")
+
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	require.NotNil(t, mBuilder.SpanQuotaEnforcer())
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans: []*jaeger.Span{
+				{TraceIdLow: 1, SpanId: 1, OperationName: "op"},
+				{TraceIdLow: 1, SpanId: 2, OperationName: "op"},
+			},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	assert.NoError(t, err)
+	counts, gauges := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["spans.over-quota|service=svc"])
+	assert.EqualValues(t, 2, gauges["spans.quota-usage|service=svc"])
+}
+
+func withElasticSearchBuilder(f func(builder *esSpanHandlerBuilder)) {
+	cfg := &escfg.Configuration{
+		Servers: []string{"127.0.0.1"},
+	}
+	cBuilder := newESBuilder(cfg, builder.ApplyOptions())
+	f(cBuilder)
+}
+
+func TestHealthCheckOption(t *testing.T) {
+	mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions())
+	_, _, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	assert.Nil(t, mBuilder.HealthCheck(), "the health check is only enabled by the option")
+
+	mBuilder = newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.HealthCheckOption(time.Hour, 1, 1),
+	))
+	assert.Nil(t, mBuilder.HealthCheck(), "the health check is created by BuildHandlers")
+	_, _, err = mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	require.NotNil(t, mBuilder.HealthCheck())
+	assert.True(t, mBuilder.HealthCheck().Probe(), "the memory store is always healthy")
+	_, err = mBuilder.Close(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, mBuilder.HealthCheck())
+}
+
+func TestPrometheusOption(t *testing.T) {
+	mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions())
+	assert.Nil(t, mBuilder.MetricsHandler(), "the metrics handler is only enabled by the option")
+
+	mBuilder = newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.MetricsFactoryOption(metrics.NewLocalFactory(0)),
+		builder.Options.PrometheusOption("jaeger-collector", nil),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	defer mBuilder.Close(context.Background())
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans:   []*jaeger.Span{{TraceIdLow: 1, SpanId: 1, OperationName: "op"}},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+
+	metricsHandler := mBuilder.MetricsHandler()
+	require.NotNil(t, metricsHandler)
+	w := httptest.NewRecorder()
+	metricsHandler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, w.Body.String(), `jaeger_collector_spans_received{format="jaeger"} 1`)
+}
+
+func TestSpanMetricsOption(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.MetricsFactoryOption(metricsFactory),
+		builder.Options.SpanMetricsOption(true),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans:   []*jaeger.Span{{TraceIdLow: 1, SpanId: 1, OperationName: "op", Duration: 10}},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	assert.NoError(t, err)
+	_, err = mBuilder.Close(context.Background())
+	require.NoError(t, err)
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["span-metrics.requests|operation=op|service=svc"])
+}
+
+func TestBuildHandlersValidatesReferences(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	memStore := memory.NewStore()
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions(
+		builder.Options.MetricsFactoryOption(metricsFactory),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans:   []*jaeger.Span{{TraceIdLow: 1, SpanId: 1, ParentSpanId: 1, OperationName: "op"}},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	assert.NoError(t, err)
+	_, err = mBuilder.Close(context.Background())
+	require.NoError(t, err)
+
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["spans.invalid-references|reason=self"])
+	trace, err := memStore.GetTrace(model.TraceID{Low: 1})
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, trace.Spans[0].ParentSpanID)
+}
+
+func TestDeduplicationOption(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	memStore := memory.NewStore()
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions(
+		builder.Options.MetricsFactoryOption(metricsFactory),
+		builder.Options.DeduplicationOption(10),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	batch := &jaeger.Batch{
+		Spans: []*jaeger.Span{
+			{TraceIdLow: 1, SpanId: 1, OperationName: "op"},
+			{TraceIdLow: 1, SpanId: 2, OperationName: "op"},
+		},
+		Process: &jaeger.Process{ServiceName: "svc"},
+	}
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{batch, batch})
+	assert.NoError(t, err)
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counts["spans.deduplicated"])
+}
+
+func TestTraceSpanLimitOption(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	memStore := memory.NewStore()
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions(
+		builder.Options.MetricsFactoryOption(metricsFactory),
+		builder.Options.TraceSpanLimitOption(1, time.Minute),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans: []*jaeger.Span{
+				{TraceIdLow: 1, SpanId: 1, OperationName: "op"},
+				{TraceIdLow: 1, SpanId: 2, OperationName: "op"},
+				{TraceIdLow: 1, SpanId: 3, OperationName: "op"},
+			},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = mBuilder.Close(context.Background())
+	assert.NoError(t, err)
+	trace, err := memStore.GetTrace(model.TraceID{Low: 1})
+	require.NoError(t, err)
+	assert.Len(t, trace.Spans, 2)
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["traces.truncated"])
+	assert.EqualValues(t, 1, counts["spans.truncated"])
+}
+
+func TestFutureSpanOption(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	memStore := memory.NewStore()
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions(
+		builder.Options.MetricsFactoryOption(metricsFactory),
+		builder.Options.FutureSpanOption(app.FutureSpanOptions{Tolerance: time.Minute, Mode: app.ClampFutureSpans}),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	future := time.Now().Add(time.Hour)
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans:   []*jaeger.Span{{TraceIdLow: 1, SpanId: 1, OperationName: "op", StartTime: int64(model.TimeAsEpochMicroseconds(future))}},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = mBuilder.Close(context.Background())
+	assert.NoError(t, err)
+	trace, err := memStore.GetTrace(model.TraceID{Low: 1})
+	require.NoError(t, err)
+	require.Len(t, trace.Spans, 1)
+	assert.True(t, trace.Spans[0].StartTime.Before(future.Add(-time.Minute)))
+	_, ok := trace.Spans[0].Tags.FindByKey(app.ClampedStartTimeTag)
+	assert.True(t, ok)
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["spans.future-clamped|service=svc"])
+}
+
+func TestTLSOption(t *testing.T) {
+	mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions())
+	_, _, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	assert.Nil(t, mBuilder.TLSConfig())
+
+	mBuilder = newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.TLSOption(tlscfg.Configuration{CertPath: "missing.pem", KeyPath: "missing.pem"}),
+	))
+	_, _, err = mBuilder.BuildHandlers()
+	assert.Error(t, err)
+	assert.Nil(t, mBuilder.TLSConfig())
+}
+
+func TestGRPCServerOptions(t *testing.T) {
+	assert.Empty(t, (&handlerBuilder{}).GRPCServerOptions())
+	assert.Len(t, (&handlerBuilder{tlsConfig: &tls.Config{}}).GRPCServerOptions(), 1, "the servers are served over TLS")
+	assert.Len(t, (&handlerBuilder{
+		tlsConfig:     &tls.Config{},
+		authenticator: app.NewAuthenticator(app.AuthOptions{}, metrics.NullFactory),
+	}).GRPCServerOptions(), 3)
+}
+
+func TestSpanIDCollisionOption(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	memStore := memory.NewStore()
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions(
+		builder.Options.MetricsFactoryOption(metricsFactory),
+		builder.Options.SpanIDCollisionOption(app.SpanIDCollisionOptions{Mode: app.ReassignSpanIDCollisions}),
+		builder.Options.DeduplicationOption(100),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans: []*jaeger.Span{
+				{TraceIdLow: 1, SpanId: 1, OperationName: "first"},
+				{TraceIdLow: 1, SpanId: 1, OperationName: "second"},
+				{TraceIdLow: 1, SpanId: 1, OperationName: "second"},
+			},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = mBuilder.Close(context.Background())
+	assert.NoError(t, err)
+	trace, err := memStore.GetTrace(model.TraceID{Low: 1})
+	require.NoError(t, err)
+	require.Len(t, trace.Spans, 2, "the retry of the reassigned span is deduplicated")
+	assert.NotEqual(t, trace.Spans[0].SpanID, trace.Spans[1].SpanID)
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counts["spans.span-id-collisions|service=svc"])
+	assert.EqualValues(t, 1, counts["spans.deduplicated"])
+}
+
+func TestSpanIDCollisionOptionRetries(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	received := 0
+	mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.MetricsFactoryOption(metricsFactory),
+		builder.Options.SpanIDCollisionOption(app.SpanIDCollisionOptions{Mode: app.ReassignSpanIDCollisions}),
+		// tags each retry differently, as the samplers do
+		builder.Options.SpanMutatorOption(func(span *model.Span) {
+			received++
+			span.Tags = append(span.Tags, model.Int64("received", int64(received)))
+		}),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{
+			{
+				Spans:   []*jaeger.Span{{TraceIdLow: 1, SpanId: 1, OperationName: "op"}},
+				Process: &jaeger.Process{ServiceName: "svc"},
+			},
+		})
+		require.NoError(t, err)
+	}
+
+	_, err = mBuilder.Close(context.Background())
+	assert.NoError(t, err)
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 0, counts["spans.span-id-collisions|service=svc"], "the retry is not a collision")
+}
+
+func TestBatchSizeOption(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	memStore := memory.NewStore()
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions(
+		builder.Options.MetricsFactoryOption(metricsFactory),
+		builder.Options.BatchSizeOption(2, app.SplitOversizedBatches),
+	))
+	_, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	responses, err := jHandler.SubmitBatches(nil, []*jaeger.Batch{
+		{
+			Spans: []*jaeger.Span{
+				{TraceIdLow: 1, SpanId: 1, OperationName: "op"},
+				{TraceIdLow: 1, SpanId: 2, OperationName: "op"},
+				{TraceIdLow: 1, SpanId: 3, OperationName: "op"},
+			},
+			Process: &jaeger.Process{ServiceName: "svc"},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, responses, 1)
+	assert.True(t, responses[0].Ok)
+
+	_, err = mBuilder.Close(context.Background())
+	assert.NoError(t, err)
+	trace, err := memStore.GetTrace(model.TraceID{Low: 1})
+	require.NoError(t, err)
+	assert.Len(t, trace.Spans, 3)
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["batches.split"])
+	assert.EqualValues(t, 1, counts["batches.size|le=10"])
+}
+
+func TestAuthOption(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+		builder.Options.MetricsFactoryOption(metricsFactory),
+		builder.Options.AuthOption(app.NewStaticTokenValidator([]string{"secret"}), false),
+	))
+	zHandler, jHandler, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	batch := &jaeger.Batch{
+		Spans:   []*jaeger.Span{{TraceIdLow: 1, SpanId: 1, OperationName: "op"}},
+		Process: &jaeger.Process{ServiceName: "svc"},
+	}
+	_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{batch})
+	assert.IsType(t, &app.AuthError{}, err)
+	_, err = zHandler.SubmitZipkinBatch(nil, nil)
+	assert.IsType(t, &app.AuthError{}, err)
+
+	ctx := tchanThrift.WithHeaders(context.Background(), map[string]string{app.AuthorizationHeader: "Bearer secret"})
+	_, err = jHandler.SubmitBatches(ctx, []*jaeger.Batch{batch})
+	assert.NoError(t, err)
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counts["requests.unauthenticated|reason=missing-credentials"])
+}
+
+func TestOTLPReceiverAuthAndTenancy(t *testing.T) {
+	memStore := memory.NewStore()
+	mBuilder := newMemoryStoreBuilder(memStore, builder.ApplyOptions(
+		builder.Options.OTLPOption(true),
+		builder.Options.TenancyOption("x-tenant", ""),
+		builder.Options.AuthOption(app.NewStaticTokenValidator([]string{"secret"}), false),
+	))
+	_, _, err := mBuilder.BuildHandlers()
+	require.NoError(t, err)
+	router := mux.NewRouter()
+	mBuilder.OTLPReceiver().RegisterRoutes(router)
+	export := func(headers map[string]string) int {
+		body := `{"resourceSpans": [{
+			"resource": {"attributes": [{"key": "service.name", "value": {"stringValue": "svc"}}]},
+			"scopeSpans": [{"spans": [{"traceId": "00000000000000000000000000000001", "spanId": "0000000000000001", "name": "op"}]}]
+		}]}`
+		req := httptest.NewRequest(http.MethodPost, app.OTLPTracesPath, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusUnauthorized, export(map[string]string{"x-tenant": "payments"}))
+	assert.Equal(t, http.StatusOK, export(map[string]string{"Authorization": "Bearer secret"}))
+	assert.Equal(t, http.StatusOK, export(map[string]string{"Authorization": "Bearer secret", "x-tenant": "payments"}))
+	_, err = mBuilder.Close(context.Background())
+	assert.NoError(t, err)
+	services, err := memStore.GetServices()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"payments/svc"}, services, "the spans without a tenant are rejected")
+}
+
+func TestMaxSpanSizeOption(t *testing.T) {
+	batch := &jaeger.Batch{
+		Spans: []*jaeger.Span{
+			{TraceIdLow: 1, SpanId: 1, OperationName: "op"},
+			{TraceIdLow: 1, SpanId: 2, OperationName: strings.Repeat("x", 200)},
+		},
+		Process: &jaeger.Process{ServiceName: "svc"},
+	}
+	testCases := []struct {
+		maxSpanSize int
+		oversized   int64
+	}{
+		{maxSpanSize: 0, oversized: 0},
+		{maxSpanSize: 100, oversized: 1},
+		{maxSpanSize: -1, oversized: 0},
+	}
+	for _, testCase := range testCases {
+		metricsFactory := metrics.NewLocalFactory(0)
+		mBuilder := newMemoryStoreBuilder(memory.NewStore(), builder.ApplyOptions(
+			builder.Options.MetricsFactoryOption(metricsFactory),
+			builder.Options.MaxSpanSizeOption(testCase.maxSpanSize),
+		))
+		_, jHandler, err := mBuilder.BuildHandlers()
+		require.NoError(t, err)
+		_, err = jHandler.SubmitBatches(nil, []*jaeger.Batch{batch})
+		assert.NoError(t, err)
+		counts, _ := metricsFactory.Snapshot()
+		assert.EqualValues(t, testCase.oversized, counts["spans.oversized"], "max span size %d", testCase.maxSpanSize)
+	}
+}
+
+// mockESSchema makes the client report the schema version of the default span indices
+func mockESSchema(client *esMocks.Client, version int) {
+	source := json.RawMessage(fmt.Sprintf(`{"version": %d}`, version))
+	searchService := &esMocks.SearchService{}
+	searchService.On("Type", mock.Anything).Return(searchService)
+	searchService.On("Query", mock.Anything).Return(searchService)
+	searchService.On("IgnoreUnavailable", true).Return(searchService)
+	searchService.On("Do", mock.Anything).Return(&elastic.SearchResult{
+		Hits: &elastic.SearchHits{Hits: []*elastic.SearchHit{{Source: &source}}},
+	}, nil)
+	client.On("Search", "jaeger-schema").Return(searchService)
+}
+
+func TestBuildHandlersElasticSearch(t *testing.T) {
+	withElasticSearchBuilder(func(builder *esSpanHandlerBuilder) {
+		mockClient := esMocks.Client{}
+		mockESSchema(&mockClient, esSpanstore.SchemaVersion)
+		builder.client = &mockClient
+		zHandler, jHandler, err := builder.BuildHandlers()
+		assert.NoError(t, err)
+		assert.NotNil(t, zHandler)
+		assert.NotNil(t, jHandler)
+		assert.Len(t, builder.closers, 1)
+		_, err = builder.Close(context.Background())
+		assert.NoError(t, err)
+		assert.Empty(t, builder.closers)
+	})
+}
+
+func TestBuildHandlersElasticSearchSchemaMismatch(t *testing.T) {
+	withElasticSearchBuilder(func(builder *esSpanHandlerBuilder) {
+		mockClient := &esMocks.Client{}
+		mockESSchema(mockClient, 1)
+		builder.client = mockClient
+		zHandler, jHandler, err := builder.BuildHandlers()
+		assert.EqualError(t, err, fmt.Sprintf(
+			"ElasticSearch schema version 1 of jaeger-schema is older than the expected version %d, enable the schema migration",
+			esSpanstore.SchemaVersion))
+		assert.Nil(t, zHandler)
+		assert.Nil(t, jHandler)
+	})
+}
+
+func TestBuildHandlersElasticSearchBadIndexTemplate(t *testing.T) {
+	withElasticSearchBuilder(func(builder *esSpanHandlerBuilder) {
+		builder.client = &esMocks.Client{}
+		builder.configuration.IndexTemplate = "{service}-{date}"
+		zHandler, jHandler, err := builder.BuildHandlers()
+		assert.EqualError(t, err, `Index template "{service}-{date}" must contain {service} at most once, and not at its start`)
+		assert.Nil(t, zHandler)
+		assert.Nil(t, jHandler)
+	})
+}
+
+func TestBuildHandlersElasticSearchBadIndexSettings(t *testing.T) {
+	withElasticSearchBuilder(func(builder *esSpanHandlerBuilder) {
+		builder.client = &esMocks.Client{}
+		builder.configuration.IndexRefreshInterval = "often"
+		zHandler, jHandler, err := builder.BuildHandlers()
+		assert.EqualError(t, err, `Invalid ElasticSearch index refresh interval "often", expected a time value such as 30s, or -1`)
+		assert.Nil(t, zHandler)
+		assert.Nil(t, jHandler)
+	})
+}
+
+func TestBuildHandlersElasticSearchHealthCheck(t *testing.T) {
+	eBuilder := newESBuilder(&escfg.Configuration{Servers: []string{"127.0.0.1"}}, builder.ApplyOptions(
+		builder.Options.HealthCheckOption(time.Hour, 1, 1),
+	))
+	healthService := &esMocks.ClusterHealthService{}
+	healthService.On("Do", mock.Anything).Return(&elastic.ClusterHealthResponse{ClusterName: "jaeger", Status: "green"}, nil).Once()
+	healthService.On("Do", mock.Anything).Return(&elastic.ClusterHealthResponse{ClusterName: "jaeger", Status: "red"}, nil).Once()
+	mockClient := &esMocks.Client{}
+	mockClient.On("ClusterHealth").Return(healthService)
+	mockESSchema(mockClient, esSpanstore.SchemaVersion)
+	eBuilder.client = mockClient
+	_, _, err := eBuilder.BuildHandlers()
+	require.NoError(t, err)
+	defer eBuilder.Close(context.Background())
+
+	healthCheck := eBuilder.HealthCheck()
+	require.NotNil(t, healthCheck)
+	assert.True(t, healthCheck.Probe())
+	assert.False(t, healthCheck.Probe())
+	_, err = healthCheck.Healthy()
+	assert.EqualError(t, err, "ElasticSearch cluster jaeger is red")
+}
+
+func TestBuildHandlersElasticSearchFailure(t *testing.T) {
+	withElasticSearchBuilder(func(builder *esSpanHandlerBuilder) {
+		builder.configuration.Servers = []string{}
+		zHandler, jHandler, err := builder.BuildHandlers()
+		assert.Error(t, err)
+		assert.Nil(t, zHandler)
+		assert.Nil(t, jHandler)
+	})
+}
+
+func TestNewSpanHandlerBuilderKafka(t *testing.T) {
+	originalArgs := os.Args
+	defer func() {
+		os.Args = originalArgs
+	}()
+	os.Args = []string{"test", "--span-storage.type=kafka"}
+	flag.Parse()
+	handler, err := NewSpanHandlerBuilder(
+		builder.Options.LoggerOption(zap.NewNop()),
+		builder.Options.KafkaOption(&kafkacfg.Configuration{
+			Brokers: []string{"127.0.0.1:9092"},
+			Topic:   "jaeger-spans",
+		}),
+	)
+	assert.NoError(t, err)
+	assert.NotNil(t, handler)
+}
+
+func TestNewSpanHandlerBuilderKafkaFailure(t *testing.T) {
+	originalArgs := os.Args
+	defer func() {
+		os.Args = originalArgs
+	}()
+	os.Args = []string{"test", "--span-storage.type=kafka"}
+	flag.Parse()
+	handler, err := NewSpanHandlerBuilder(builder.Options.KafkaOption(&kafkacfg.Configuration{}))
+	assert.EqualError(t, err, "Kafka not configured")
+	assert.Nil(t, handler)
+}
+
+func withKafkaBuilder(f func(builder *kafkaSpanHandlerBuilder)) {
+	cfg := &kafkacfg.Configuration{
+		Brokers: []string{"127.0.0.1:9092"},
+		Topic:   "jaeger-spans",
+	}
+	kBuilder := newKafkaBuilder(cfg, builder.ApplyOptions())
+	f(kBuilder)
+}
+
+func TestBuildHandlersKafka(t *testing.T) {
+	withKafkaBuilder(func(builder *kafkaSpanHandlerBuilder) {
+		builder.producer = saramaMocks.NewSyncProducer(t, nil)
+		zHandler, jHandler, err := builder.BuildHandlers()
+		assert.NoError(t, err)
+		assert.NotNil(t, zHandler)
+		assert.NotNil(t, jHandler)
+	})
+}
+
+func TestBuildHandlersKafkaFailure(t *testing.T) {
+	withKafkaBuilder(func(builder *kafkaSpanHandlerBuilder) {
+		builder.configuration.Brokers = []string{}
+		zHandler, jHandler, err := builder.BuildHandlers()
+		assert.Error(t, err)
+		assert.Nil(t, zHandler)
+		assert.Nil(t, jHandler)
+	})
+}
+
+func TestKafkaBuilderClosesProducer(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).SetBroker(broker.Addr(), broker.BrokerID()),
+	})
+	withKafkaBuilder(func(builder *kafkaSpanHandlerBuilder) {
+		builder.configuration.Brokers = []string{broker.Addr()}
+		_, _, err := builder.BuildHandlers()
+		require.NoError(t, err)
+		require.Len(t, builder.closers, 1)
+		_, err = builder.Close(context.Background())
+		assert.NoError(t, err)
+	})
+}
+
+func TestNewSpanHandlerBuilderBadger(t *testing.T) {
+	originalArgs := os.Args
+	defer func() {
+		os.Args = originalArgs
+	}()
+	os.Args = []string{"test", "--span-storage.type=badger"}
+	flag.Parse()
+	handler, err := NewSpanHandlerBuilder(
+		builder.Options.BadgerOption(&badgercfg.Configuration{
+			Directory: "/tmp/jaeger-badger",
+		}),
+	)
+	assert.NoError(t, err)
+	assert.NotNil(t, handler)
+}
+
+func TestNewSpanHandlerBuilderBadgerFailure(t *testing.T) {
+	originalArgs := os.Args
+	defer func() {
+		os.Args = originalArgs
+	}()
+	os.Args = []string{"test", "--span-storage.type=badger"}
+	flag.Parse()
+	handler, err := NewSpanHandlerBuilder()
+	assert.EqualError(t, err, "Badger not configured")
+	assert.Nil(t, handler)
+}
+
+func TestBadgerBuilderClosesStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	bBuilder := newBadgerBuilder(&badgercfg.Configuration{Directory: dir}, builder.ApplyOptions())
+	_, _, err = bBuilder.BuildHandlers()
+	require.NoError(t, err)
+	probe := bBuilder.healthProbe()
+	require.NotNil(t, probe)
+	assert.NoError(t, probe())
+	_, err = bBuilder.Close(context.Background())
+	require.NoError(t, err)
+	assert.Error(t, probe(), "the store is closed with the builder")
+}
+
+func TestBadgerBuilderSharedStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	db, err := (&badgercfg.Configuration{Directory: dir}).NewDB()
+	require.NoError(t, err)
+	store := badgerSpanstore.NewStore(db, 0, zap.NewNop())
+	defer store.Close()
+
+	bBuilder := newBadgerBuilder(nil, builder.ApplyOptions(builder.Options.BadgerStoreOption(store)))
+	_, _, err = bBuilder.BuildHandlers()
+	require.NoError(t, err)
+	assert.Equal(t, store, bBuilder.store)
+	_, err = bBuilder.Close(context.Background())
+	require.NoError(t, err)
+	assert.NoError(t, store.Probe(), "the store is closed by the executable sharing it")
+}
+
+func TestNewSpanHandlerBuilderPostgres(t *testing.T) {
+	originalArgs := os.Args
+	defer func() {
+		os.Args = originalArgs
+	}()
+	os.Args = []string{"test", "--span-storage.type=postgres"}
+	flag.Parse()
+	handler, err := NewSpanHandlerBuilder(
+		builder.Options.PostgresOption(&pgcfg.Configuration{
+			DSN: "postgres://127.0.0.1:5432/jaeger",
+		}),
+	)
+	assert.NoError(t, err)
+	assert.NotNil(t, handler)
+}
+
+func TestNewSpanHandlerBuilderPostgresFailure(t *testing.T) {
+	originalArgs := os.Args
+	defer func() {
+		os.Args = originalArgs
+	}()
+	os.Args = []string{"test", "--span-storage.type=postgres"}
+	flag.Parse()
+	handler, err := NewSpanHandlerBuilder()
+	assert.EqualError(t, err, "PostgreSQL not configured")
+	assert.Nil(t, handler)
+}
+
+func TestBuildHandlersPostgresFailure(t *testing.T) {
+	pBuilder := newPostgresBuilder(&pgcfg.Configuration{}, builder.ApplyOptions())
+	zHandler, jHandler, err := pBuilder.BuildHandlers()
+	assert.EqualError(t, err, "No DSN specified")
+	assert.Nil(t, zHandler)
+	assert.Nil(t, jHandler)
+	assert.Empty(t, pBuilder.closers)
+}
+
+func TestBuildHandlersBadger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	bBuilder := newBadgerBuilder(&badgercfg.Configuration{Directory: dir}, builder.ApplyOptions())
+	zHandler, jHandler, err := bBuilder.BuildHandlers()
+	assert.NoError(t, err)
+	assert.NotNil(t, zHandler)
+	assert.NotNil(t, jHandler)
+	assert.NoError(t, bBuilder.store.Close())
+}
+
+func TestBuildHandlersBadgerFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "file")
+	assert.NoError(t, ioutil.WriteFile(file, []byte{}, 0644))
+	bBuilder := newBadgerBuilder(&badgercfg.Configuration{Directory: file}, builder.ApplyOptions())
+	zHandler, jHandler, err := bBuilder.BuildHandlers()
+	assert.Error(t, err)
+	assert.Nil(t, zHandler)
+	assert.Nil(t, jHandler)
 }
@@ -0,0 +1,100 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/uber/jaeger/model"
+)
+
+// CollectorTagOptions configure the CollectorTagger
+type CollectorTagOptions struct {
+	// HostnameKey is the key of the tag with the host name of the collector, not added if empty
+	HostnameKey string
+	// Tags are the other tags keyed by tag key, e.g. the region or the version of the collector
+	Tags map[string]string
+}
+
+// Keys returns the keys of the tags added to the spans, in a stable order
+func (o CollectorTagOptions) Keys() []string {
+	keys := make([]string, 0, len(o.Tags)+1)
+	for key := range o.Tags {
+		keys = append(keys, key)
+	}
+	if o.HostnameKey != "" {
+		keys = append(keys, o.HostnameKey)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ParseCollectorTags parses a comma-separated list of key=value tags, e.g. region=us-east-1,collector.version=1.0
+func ParseCollectorTags(list string) (map[string]string, error) {
+	tags := make(map[string]string)
+	if list == "" {
+		return tags, nil
+	}
+	for _, pair := range strings.Split(list, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("Expected key=value, found %q", pair)
+		}
+		tags[kv[0]] = kv[1]
+	}
+	return tags, nil
+}
+
+// CollectorTagger tags the spans with the metadata of the collector storing them, e.g. its host name, so that the
+// spans stored by a misbehaving collector of a fleet can be found. The tags add one value per collector to the
+// traces, which is why the collector adds none unless configured.
+type CollectorTagger struct {
+	tags model.KeyValues
+}
+
+// NewCollectorTagger creates a CollectorTagger adding the tags of the options, with the hostname under their
+// HostnameKey
+func NewCollectorTagger(options CollectorTagOptions, hostname string) *CollectorTagger {
+	var tags model.KeyValues
+	for key, value := range options.Tags {
+		tags = append(tags, model.String(key, value))
+	}
+	if options.HostnameKey != "" {
+		tags = append(tags, model.String(options.HostnameKey, hostname))
+	}
+	// in a stable order, as the tags are a map
+	tags.Sort()
+	return &CollectorTagger{tags: tags}
+}
+
+// TagSpans adds the tags of the collector to the spans, the spans already having a tag with one of their keys
+// keeping theirs
+func (t *CollectorTagger) TagSpans(spans []*model.Span) {
+	for _, span := range spans {
+		for _, tag := range t.tags {
+			if _, ok := span.Tags.FindByKey(tag.Key); !ok {
+				span.Tags = append(span.Tags, tag)
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/jaeger/model"
+)
+
+func TestCollectorTagger(t *testing.T) {
+	options := CollectorTagOptions{
+		HostnameKey: "collector.hostname",
+		Tags:        map[string]string{"region": "us-east-1", "collector.version": "1.0"},
+	}
+	assert.Equal(t, []string{"collector.hostname", "collector.version", "region"}, options.Keys())
+	tagger := NewCollectorTagger(options, "collector-7")
+
+	span := &model.Span{}
+	regional := &model.Span{Tags: model.KeyValues{model.String("region", "eu-west-1")}}
+	tagger.TagSpans([]*model.Span{span, regional})
+	assert.Equal(t, model.KeyValues{
+		model.String("collector.hostname", "collector-7"),
+		model.String("collector.version", "1.0"),
+		model.String("region", "us-east-1"),
+	}, span.Tags)
+	assert.Equal(t, model.KeyValues{
+		model.String("region", "eu-west-1"),
+		model.String("collector.hostname", "collector-7"),
+		model.String("collector.version", "1.0"),
+	}, regional.Tags, "the spans keep their own tags")
+}
+
+func TestParseCollectorTags(t *testing.T) {
+	tags, err := ParseCollectorTags("region=us-east-1,collector.version=1.0,empty=")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"region": "us-east-1", "collector.version": "1.0", "empty": ""}, tags)
+
+	tags, err = ParseCollectorTags("")
+	require.NoError(t, err)
+	assert.Empty(t, tags)
+
+	for _, list := range []string{"region", "=us-east-1", "region=us-east-1,"} {
+		_, err := ParseCollectorTags(list)
+		assert.Error(t, err, list)
+	}
+}
@@ -0,0 +1,286 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+// SamplerType is the kind of sub-sampler of a CompositeSampler
+type SamplerType string
+
+const (
+	// ProbabilisticSampler keeps the spans of a fraction of the traces, by the TraceSamplingBucket of their trace ID
+	ProbabilisticSampler SamplerType = "probabilistic"
+	// RateLimitingSampler keeps up to a number of traces per second across all services
+	RateLimitingSampler SamplerType = "ratelimiting"
+	// TagSampler keeps the spans with a tag, or a tag value, like a SamplingRule
+	TagSampler SamplerType = "tag"
+)
+
+// SamplerCombination is how a CompositeSampler combines the verdicts of its sub-samplers
+type SamplerCombination string
+
+const (
+	// KeepIfAny keeps the spans kept by one of the sub-samplers, the later sub-samplers not being evaluated
+	KeepIfAny SamplerCombination = "any"
+	// KeepIfAll keeps the spans kept by all the sub-samplers, the later sub-samplers not being evaluated once
+	// one of them dropped the span
+	KeepIfAll SamplerCombination = "all"
+)
+
+// SamplerConfig configures a sub-sampler of a CompositeSampler
+type SamplerConfig struct {
+	// Name identifies the sub-sampler in the TailSamplingTag and in the metrics
+	Name string `json:"name"`
+	// Type is the kind of sub-sampler
+	Type SamplerType `json:"type"`
+	// Rate is the fraction of the traces kept by a ProbabilisticSampler, between 0 and 1, or the traces per second
+	// kept by a RateLimitingSampler
+	Rate float64 `json:"rate"`
+	// Tag is the key of the span or process tag a TagSampler checks
+	Tag string `json:"tag"`
+	// Value is the value the tag must have, as a string, a TagSampler matching any value of the tag if empty
+	Value string `json:"value"`
+}
+
+// CompositeSamplingConfig is the ordered list of sub-samplers of a CompositeSampler and how it combines them
+type CompositeSamplingConfig struct {
+	// Combination is how the verdicts of the sub-samplers are combined, KeepIfAny if empty
+	Combination SamplerCombination `json:"combination"`
+	Samplers    []SamplerConfig    `json:"samplers"`
+}
+
+// LoadCompositeSamplingConfig reads a CompositeSamplingConfig encoded as JSON, e.g.
+//
+//	{"combination": "any", "samplers": [{"name": "errors", "type": "tag", "tag": "error", "value": "true"},
+//	  {"name": "baseline", "type": "probabilistic", "rate": 0.01}, {"name": "floor", "type": "ratelimiting", "rate": 10}]}
+func LoadCompositeSamplingConfig(r io.Reader) (CompositeSamplingConfig, error) {
+	var config CompositeSamplingConfig
+	err := json.NewDecoder(r).Decode(&config)
+	return config, err
+}
+
+// namedSampler is a sub-sampler of a CompositeSampler with the counters of its verdicts
+type namedSampler struct {
+	name    string
+	sampler TailSampler
+	kept    metrics.Counter
+	dropped metrics.Counter
+}
+
+// CompositeSampler combines the verdicts of an ordered list of sub-samplers into the sampling decision of the
+// collector: the spans it keeps are marked as sampled, so that the tail sampling keeps their traces, and tagged
+// with the TailSamplingTag. The verdicts of each sub-sampler are counted in the spans.composite-sampling metric
+// by sampler and verdict, so that the sub-samplers driving the retention can be told apart. The decision is made
+// once per trace and remembered by a SamplingDecisionCache, the later spans of a trace honoring the decision made
+// for its first span without the sub-samplers being evaluated.
+type CompositeSampler struct {
+	sync.RWMutex
+	combination    SamplerCombination
+	samplers       []namedSampler
+	decisions      *SamplingDecisionCache
+	seed           uint64
+	metricsFactory metrics.Factory
+}
+
+// NewCompositeSampler creates a CompositeSampler counting the verdicts in the metrics factory, the probabilistic
+// sub-samplers using the seed for the TraceSamplingBucket, and the decisions being remembered by trace in the
+// cache, or in one of DefaultSamplingDecisionCacheSize traces if it is nil. It returns an error if the config is
+// not valid.
+func NewCompositeSampler(
+	config CompositeSamplingConfig,
+	seed uint64,
+	decisions *SamplingDecisionCache,
+	metricsFactory metrics.Factory,
+) (*CompositeSampler, error) {
+	if decisions == nil {
+		decisions = NewSamplingDecisionCache(SamplingDecisionCacheOptions{Size: DefaultSamplingDecisionCacheSize}, metricsFactory)
+	}
+	s := &CompositeSampler{decisions: decisions, seed: seed, metricsFactory: metricsFactory}
+	if err := s.Update(config); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Update replaces the sub-samplers and their combination, it returns an error and keeps the current ones if the
+// config is not valid. The decisions remembered for the traces are honored until they expire.
+func (s *CompositeSampler) Update(config CompositeSamplingConfig) error {
+	combination := config.Combination
+	switch combination {
+	case "":
+		combination = KeepIfAny
+	case KeepIfAny, KeepIfAll:
+	default:
+		return fmt.Errorf("Unknown sampler combination %q", config.Combination)
+	}
+	if len(config.Samplers) == 0 {
+		return fmt.Errorf("composite sampling must have a sampler")
+	}
+	var samplers []namedSampler
+	names := make(map[string]struct{}, len(config.Samplers))
+	for i, samplerConfig := range config.Samplers {
+		if samplerConfig.Name == "" {
+			return fmt.Errorf("sampler %d must have a name", i)
+		}
+		if _, ok := names[samplerConfig.Name]; ok {
+			return fmt.Errorf("duplicate sampler %s", samplerConfig.Name)
+		}
+		names[samplerConfig.Name] = struct{}{}
+		sampler, err := newSubSampler(samplerConfig, s.seed)
+		if err != nil {
+			return err
+		}
+		samplers = append(samplers, namedSampler{
+			name:    samplerConfig.Name,
+			sampler: sampler,
+			kept: s.metricsFactory.Counter("spans.composite-sampling", map[string]string{
+				"sampler": samplerConfig.Name, "verdict": "kept"}),
+			dropped: s.metricsFactory.Counter("spans.composite-sampling", map[string]string{
+				"sampler": samplerConfig.Name, "verdict": "dropped"}),
+		})
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.combination = combination
+	s.samplers = samplers
+	return nil
+}
+
+func newSubSampler(config SamplerConfig, seed uint64) (TailSampler, error) {
+	switch config.Type {
+	case ProbabilisticSampler:
+		if config.Rate < 0 || config.Rate > 1 {
+			return nil, fmt.Errorf("probabilistic sampler %s must have a rate between 0 and 1", config.Name)
+		}
+		return &probabilisticSampler{name: config.Name, rate: config.Rate, seed: seed}, nil
+	case RateLimitingSampler:
+		if config.Rate <= 0 {
+			return nil, fmt.Errorf("rate limiting sampler %s must have a positive rate", config.Name)
+		}
+		return newRateLimitingSampler(config.Name, config.Rate, time.Now), nil
+	case TagSampler:
+		if config.Tag == "" {
+			return nil, fmt.Errorf("tag sampler %s must have a tag", config.Name)
+		}
+		return &tagSampler{rule: SamplingRule{Name: config.Name, Tag: config.Tag, Value: config.Value}}, nil
+	default:
+		return nil, fmt.Errorf("Unknown sampler type %q of sampler %s", config.Type, config.Name)
+	}
+}
+
+// TailSample returns the names of the sub-samplers that kept the span, decided being false when the span is
+// dropped, so that the CompositeSampler can be the TailSampler of a SamplingDecisionRecorder.
+func (s *CompositeSampler) TailSample(span *model.Span) (string, bool) {
+	return s.decisions.Decide(span.TraceID, func() (string, bool) {
+		return s.sample(span)
+	})
+}
+
+func (s *CompositeSampler) sample(span *model.Span) (string, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	var reasons []string
+	for _, sub := range s.samplers {
+		reason, kept := sub.sampler.TailSample(span)
+		if !kept {
+			sub.dropped.Inc(1)
+			if s.combination == KeepIfAll {
+				return "", false
+			}
+			continue
+		}
+		sub.kept.Inc(1)
+		if s.combination == KeepIfAny {
+			return reason, true
+		}
+		reasons = append(reasons, reason)
+	}
+	if len(reasons) == 0 {
+		return "", false
+	}
+	return strings.Join(reasons, ","), true
+}
+
+// SampleSpans marks the kept spans as sampled and tags them with the decision, it can be used as a ProcessSpans.
+// The spans already sampled by the clients are left unchanged, the tail sampling keeping their traces anyway.
+func (s *CompositeSampler) SampleSpans(spans []*model.Span) {
+	for _, span := range spans {
+		if span.Flags.IsSampled() {
+			continue
+		}
+		if reason, kept := s.TailSample(span); kept {
+			span.Flags.SetSampled()
+			if _, ok := span.Tags.FindByKey(TailSamplingTag); !ok {
+				span.Tags = append(span.Tags, model.String(TailSamplingTag, reason))
+			}
+		}
+	}
+}
+
+// probabilisticSampler keeps the spans of the traces whose TraceSamplingBucket is below the rate
+type probabilisticSampler struct {
+	name string
+	rate float64
+	seed uint64
+}
+
+func (s *probabilisticSampler) TailSample(span *model.Span) (string, bool) {
+	return s.name, sampleTrace(span.TraceID, s.rate, s.seed)
+}
+
+// rateLimitingSampler keeps up to rate traces per second with a token bucket, the CompositeSampler evaluating it
+// only for the first span of a trace
+type rateLimitingSampler struct {
+	sync.Mutex
+	name    string
+	bucket  *tokenBucket
+	timeNow func() time.Time
+}
+
+func newRateLimitingSampler(name string, rate float64, timeNow func() time.Time) *rateLimitingSampler {
+	return &rateLimitingSampler{name: name, bucket: newTokenBucket(rate, timeNow()), timeNow: timeNow}
+}
+
+func (s *rateLimitingSampler) TailSample(span *model.Span) (string, bool) {
+	s.Lock()
+	defer s.Unlock()
+	return s.name, s.bucket.allow(s.timeNow())
+}
+
+// tagSampler keeps the spans matching a SamplingRule
+type tagSampler struct {
+	rule SamplingRule
+}
+
+func (s *tagSampler) TailSample(span *model.Span) (string, bool) {
+	return s.rule.Name, matchesSamplingRule(span, s.rule)
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+func spanForSampling(traceID uint64, tags ...model.KeyValue) *model.Span {
+	return &model.Span{
+		TraceID: model.TraceID{Low: traceID},
+		Process: &model.Process{ServiceName: "svc"},
+		Tags:    tags,
+	}
+}
+
+func TestCompositeSamplerKeepIfAny(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	s, err := NewCompositeSampler(CompositeSamplingConfig{Samplers: []SamplerConfig{
+		{Name: "errors", Type: TagSampler, Tag: "error", Value: "true"},
+		{Name: "baseline", Type: ProbabilisticSampler, Rate: 0.1},
+	}}, 0, nil, metricsFactory)
+	require.NoError(t, err)
+
+	failed := spanForSampling(9999, model.Bool("error", true))
+	lucky := spanForSampling(999)
+	unlucky := spanForSampling(1000)
+	sampled := spanForSampling(1000)
+	sampled.Flags.SetSampled()
+	s.SampleSpans([]*model.Span{failed, lucky, unlucky, sampled})
+
+	assert.True(t, failed.Flags.IsSampled())
+	assert.Equal(t, model.KeyValues{model.Bool("error", true), model.String(TailSamplingTag, "errors")}, failed.Tags)
+	assert.True(t, lucky.Flags.IsSampled())
+	assert.Equal(t, model.KeyValues{model.String(TailSamplingTag, "baseline")}, lucky.Tags)
+	assert.False(t, unlucky.Flags.IsSampled())
+	assert.Empty(t, unlucky.Tags)
+	assert.Empty(t, sampled.Tags, "the spans sampled by the clients are left unchanged")
+
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["spans.composite-sampling|sampler=errors|verdict=kept"])
+	assert.EqualValues(t, 2, counts["spans.composite-sampling|sampler=errors|verdict=dropped"])
+	assert.EqualValues(t, 1, counts["spans.composite-sampling|sampler=baseline|verdict=kept"])
+	assert.EqualValues(t, 1, counts["spans.composite-sampling|sampler=baseline|verdict=dropped"])
+}
+
+func TestCompositeSamplerKeepIfAll(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	s, err := NewCompositeSampler(CompositeSamplingConfig{Combination: KeepIfAll, Samplers: []SamplerConfig{
+		{Name: "premium", Type: TagSampler, Tag: "user.tier", Value: "premium"},
+		{Name: "half", Type: ProbabilisticSampler, Rate: 0.5},
+	}}, 0, nil, metricsFactory)
+	require.NoError(t, err)
+
+	reason, kept := s.TailSample(spanForSampling(1, model.String("user.tier", "premium")))
+	assert.True(t, kept)
+	assert.Equal(t, "premium,half", reason)
+	_, kept = s.TailSample(spanForSampling(9999, model.String("user.tier", "premium")))
+	assert.False(t, kept)
+	_, kept = s.TailSample(spanForSampling(2, model.String("user.tier", "free")))
+	assert.False(t, kept)
+
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["spans.composite-sampling|sampler=premium|verdict=dropped"])
+	assert.EqualValues(t, 1, counts["spans.composite-sampling|sampler=half|verdict=kept"])
+	assert.EqualValues(t, 1, counts["spans.composite-sampling|sampler=half|verdict=dropped"], "not evaluated once dropped")
+}
+
+func TestRateLimitingSampler(t *testing.T) {
+	now := time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+	s := newRateLimitingSampler("floor", 2, func() time.Time { return now })
+
+	for i := 0; i < 2; i++ {
+		reason, kept := s.TailSample(spanForSampling(1))
+		assert.True(t, kept)
+		assert.Equal(t, "floor", reason)
+	}
+	_, kept := s.TailSample(spanForSampling(1))
+	assert.False(t, kept)
+	now = now.Add(time.Second)
+	_, kept = s.TailSample(spanForSampling(1))
+	assert.True(t, kept)
+}
+
+func TestCompositeSamplerDecidesPerTrace(t *testing.T) {
+	s, err := NewCompositeSampler(CompositeSamplingConfig{Samplers: []SamplerConfig{
+		{Name: "floor", Type: RateLimitingSampler, Rate: 1},
+	}}, 0, nil, metrics.NullFactory)
+	require.NoError(t, err)
+
+	spans := []*model.Span{spanForSampling(1), spanForSampling(1), spanForSampling(2)}
+	s.SampleSpans(spans)
+	assert.True(t, spans[0].Flags.IsSampled())
+	assert.True(t, spans[1].Flags.IsSampled(), "the rate limit counts traces, not spans")
+	assert.False(t, spans[2].Flags.IsSampled())
+}
+
+func TestCompositeSamplerUpdate(t *testing.T) {
+	s, err := NewCompositeSampler(CompositeSamplingConfig{Samplers: []SamplerConfig{
+		{Name: "errors", Type: TagSampler, Tag: "error"},
+	}}, 0, nil, metrics.NullFactory)
+	require.NoError(t, err)
+	_, kept := s.TailSample(spanForSampling(1))
+	assert.False(t, kept)
+
+	assert.Error(t, s.Update(CompositeSamplingConfig{}))
+	_, kept = s.TailSample(spanForSampling(2))
+	assert.False(t, kept, "the invalid config is not applied")
+
+	require.NoError(t, s.Update(CompositeSamplingConfig{Samplers: []SamplerConfig{
+		{Name: "all", Type: ProbabilisticSampler, Rate: 1},
+	}}))
+	reason, kept := s.TailSample(spanForSampling(3))
+	assert.True(t, kept)
+	assert.Equal(t, "all", reason)
+	_, kept = s.TailSample(spanForSampling(1))
+	assert.False(t, kept, "the decisions made before the update are honored")
+}
+
+func TestNewCompositeSamplerErrors(t *testing.T) {
+	testCases := []struct {
+		config   CompositeSamplingConfig
+		expected string
+	}{
+		{config: CompositeSamplingConfig{}, expected: "composite sampling must have a sampler"},
+		{
+			config:   CompositeSamplingConfig{Combination: "majority", Samplers: []SamplerConfig{{Name: "a", Type: TagSampler, Tag: "t"}}},
+			expected: `Unknown sampler combination "majority"`,
+		},
+		{config: CompositeSamplingConfig{Samplers: []SamplerConfig{{Type: TagSampler, Tag: "t"}}}, expected: "sampler 0 must have a name"},
+		{
+			config:   CompositeSamplingConfig{Samplers: []SamplerConfig{{Name: "a", Type: TagSampler, Tag: "t"}, {Name: "a", Type: TagSampler, Tag: "u"}}},
+			expected: "duplicate sampler a",
+		},
+		{config: CompositeSamplingConfig{Samplers: []SamplerConfig{{Name: "a", Type: TagSampler}}}, expected: "tag sampler a must have a tag"},
+		{
+			config:   CompositeSamplingConfig{Samplers: []SamplerConfig{{Name: "a", Type: ProbabilisticSampler, Rate: 2}}},
+			expected: "probabilistic sampler a must have a rate between 0 and 1",
+		},
+		{config: CompositeSamplingConfig{Samplers: []SamplerConfig{{Name: "a", Type: RateLimitingSampler}}}, expected: "rate limiting sampler a must have a positive rate"},
+		{config: CompositeSamplingConfig{Samplers: []SamplerConfig{{Name: "a", Type: "adaptive"}}}, expected: `Unknown sampler type "adaptive" of sampler a`},
+	}
+	for _, testCase := range testCases {
+		_, err := NewCompositeSampler(testCase.config, 0, nil, metrics.NullFactory)
+		assert.EqualError(t, err, testCase.expected)
+	}
+}
+
+func TestLoadCompositeSamplingConfig(t *testing.T) {
+	config, err := LoadCompositeSamplingConfig(strings.NewReader(`{"combination": "all", "samplers": [
+		{"name": "errors", "type": "tag", "tag": "error", "value": "true"}, {"name": "floor", "type": "ratelimiting", "rate": 10}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, CompositeSamplingConfig{Combination: KeepIfAll, Samplers: []SamplerConfig{
+		{Name: "errors", Type: TagSampler, Tag: "error", Value: "true"},
+		{Name: "floor", Type: RateLimitingSampler, Rate: 10},
+	}}, config)
+
+	_, err = LoadCompositeSamplingConfig(strings.NewReader(`{"samplers": 1}`))
+	assert.Error(t, err)
+}
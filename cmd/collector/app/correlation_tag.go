@@ -0,0 +1,89 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"fmt"
+
+	"github.com/uber/jaeger/model"
+)
+
+// CorrelationFormat is how the trace ID is written in the correlation tag
+type CorrelationFormat string
+
+const (
+	// HexCorrelation writes the trace ID as 32 lower-case hex digits, zero padded
+	HexCorrelation CorrelationFormat = "hex"
+	// DecimalCorrelation writes the 128-bit trace ID as a decimal number
+	DecimalCorrelation CorrelationFormat = "decimal"
+
+	// DefaultCorrelationTag is the key of the correlation tag when none is configured
+	DefaultCorrelationTag = "trace_id"
+)
+
+// ParseCorrelationFormat returns the CorrelationFormat with the given name, empty meaning HexCorrelation
+func ParseCorrelationFormat(name string) (CorrelationFormat, error) {
+	switch format := CorrelationFormat(name); format {
+	case "":
+		return HexCorrelation, nil
+	case HexCorrelation, DecimalCorrelation:
+		return format, nil
+	default:
+		return "", fmt.Errorf("Unknown correlation tag format %q", name)
+	}
+}
+
+// CorrelationTagOptions configure the CorrelationTagger
+type CorrelationTagOptions struct {
+	// Key is the key of the tag, DefaultCorrelationTag if empty
+	Key string
+	// Format is how the trace ID is written, HexCorrelation if empty
+	Format CorrelationFormat
+}
+
+// CorrelationTagger tags the spans with their trace ID in a fixed format, so that logs can be joined on it
+type CorrelationTagger struct {
+	key    string
+	format func(model.TraceID) string
+}
+
+// NewCorrelationTagger creates a CorrelationTagger
+func NewCorrelationTagger(options CorrelationTagOptions) *CorrelationTagger {
+	key := options.Key
+	if key == "" {
+		key = DefaultCorrelationTag
+	}
+	format := model.TraceID.PaddedString
+	if options.Format == DecimalCorrelation {
+		format = model.TraceID.DecimalString
+	}
+	return &CorrelationTagger{key: key, format: format}
+}
+
+// TagSpans adds the correlation tag to the spans that do not already have a tag with its key
+func (t *CorrelationTagger) TagSpans(spans []*model.Span) {
+	for _, span := range spans {
+		if _, ok := span.Tags.FindByKey(t.key); ok {
+			continue
+		}
+		span.Tags = append(span.Tags, model.String(t.key, t.format(span.TraceID)))
+	}
+}
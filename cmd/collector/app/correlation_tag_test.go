@@ -0,0 +1,88 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/jaeger/model"
+)
+
+func TestCorrelationTaggerHex(t *testing.T) {
+	tagger := NewCorrelationTagger(CorrelationTagOptions{})
+	spans := []*model.Span{
+		{TraceID: model.TraceID{Low: 0xabc}},
+		{TraceID: model.TraceID{High: 0x1, Low: 0x2}},
+	}
+	tagger.TagSpans(spans)
+
+	value, ok := spans[0].Tags.FindByKey(DefaultCorrelationTag)
+	require.True(t, ok)
+	assert.Equal(t, "00000000000000000000000000000abc", value.AsString())
+	value, ok = spans[1].Tags.FindByKey(DefaultCorrelationTag)
+	require.True(t, ok)
+	assert.Equal(t, "00000000000000010000000000000002", value.AsString())
+}
+
+func TestCorrelationTaggerDecimal(t *testing.T) {
+	tagger := NewCorrelationTagger(CorrelationTagOptions{Key: "log.trace", Format: DecimalCorrelation})
+	spans := []*model.Span{
+		{TraceID: model.TraceID{Low: 255}},
+		{TraceID: model.TraceID{High: 1, Low: 1}},
+	}
+	tagger.TagSpans(spans)
+
+	value, ok := spans[0].Tags.FindByKey("log.trace")
+	require.True(t, ok)
+	assert.Equal(t, "255", value.AsString())
+	value, ok = spans[1].Tags.FindByKey("log.trace")
+	require.True(t, ok)
+	assert.Equal(t, "18446744073709551617", value.AsString())
+}
+
+func TestCorrelationTaggerKeepsExistingTag(t *testing.T) {
+	tagger := NewCorrelationTagger(CorrelationTagOptions{})
+	span := &model.Span{
+		TraceID: model.TraceID{Low: 1},
+		Tags:    model.KeyValues{model.String(DefaultCorrelationTag, "from-client")},
+	}
+	tagger.TagSpans([]*model.Span{span})
+
+	require.Len(t, span.Tags, 1)
+	assert.Equal(t, "from-client", span.Tags[0].AsString())
+}
+
+func TestParseCorrelationFormat(t *testing.T) {
+	for name, expected := range map[string]CorrelationFormat{
+		"":        HexCorrelation,
+		"hex":     HexCorrelation,
+		"decimal": DecimalCorrelation,
+	} {
+		format, err := ParseCorrelationFormat(name)
+		require.NoError(t, err)
+		assert.Equal(t, expected, format)
+	}
+	_, err := ParseCorrelationFormat("base64")
+	assert.EqualError(t, err, `Unknown correlation tag format "base64"`)
+}
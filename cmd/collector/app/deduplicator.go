@@ -0,0 +1,70 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"encoding/binary"
+
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/pkg/cache"
+)
+
+// spanKeyLength is the size of the (traceID, spanID) part of the keys, which are only followed by
+// the short name of the span kind, so that the memory used by the deduplicator only depends on
+// the window size and not on the content of the spans
+const spanKeyLength = 3 * 8
+
+// SpanDeduplicator drops spans with the same trace and span IDs and span kind as one of the recently
+// seen spans, e.g. spans submitted twice because of retries in the instrumentation. The kind tells
+// apart the client and server spans of Zipkin-style clients, which share their span ID.
+type SpanDeduplicator struct {
+	seen       *cache.LRU
+	duplicates metrics.Counter
+}
+
+// NewSpanDeduplicator creates a SpanDeduplicator that remembers the IDs of up to windowSize spans,
+// evicting the least recently seen ones, and counts the spans it drops in the given metrics factory.
+func NewSpanDeduplicator(windowSize int, metricsFactory metrics.Factory) *SpanDeduplicator {
+	return &SpanDeduplicator{
+		seen:       cache.NewLRU(windowSize),
+		duplicates: metricsFactory.Counter("spans.deduplicated", nil),
+	}
+}
+
+// Allow returns false when the span was already seen, it can be used as a FilterSpan.
+func (d *SpanDeduplicator) Allow(span *model.Span) bool {
+	if d.seen.Put(spanKey(span), struct{}{}) != nil {
+		d.duplicates.Inc(1)
+		return false
+	}
+	return true
+}
+
+func spanKey(span *model.Span) string {
+	kind := span.GetSpanKind()
+	key := make([]byte, spanKeyLength, spanKeyLength+len(kind))
+	binary.BigEndian.PutUint64(key[0:], span.TraceID.High)
+	binary.BigEndian.PutUint64(key[8:], span.TraceID.Low)
+	binary.BigEndian.PutUint64(key[16:], uint64(span.SpanID))
+	return string(append(key, kind...))
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"testing"
+
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+func spanWithIDs(traceIDHigh, traceIDLow, spanID uint64) *model.Span {
+	return &model.Span{
+		TraceID: model.TraceID{High: traceIDHigh, Low: traceIDLow},
+		SpanID:  model.SpanID(spanID),
+	}
+}
+
+func TestSpanDeduplicator(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	dedup := NewSpanDeduplicator(2, metricsFactory)
+
+	assert.True(t, dedup.Allow(spanWithIDs(0, 1, 1)))
+	assert.False(t, dedup.Allow(spanWithIDs(0, 1, 1)))
+	assert.True(t, dedup.Allow(spanWithIDs(0, 1, 2)), "other span of the same trace")
+	assert.True(t, dedup.Allow(spanWithIDs(1, 1, 1)), "trace with a different high ID")
+	assert.Equal(t, 2, dedup.seen.Size(), "the window is bounded")
+
+	// the oldest span fell out of the window
+	assert.True(t, dedup.Allow(spanWithIDs(0, 1, 1)))
+	assert.False(t, dedup.Allow(spanWithIDs(1, 1, 1)))
+
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counters["spans.deduplicated"])
+}
+
+func TestSpanDeduplicatorSharedSpan(t *testing.T) {
+	dedup := NewSpanDeduplicator(10, metrics.NullFactory)
+	client := spanWithIDs(0, 1, 1)
+	client.Tags = model.KeyValues{model.String(string(ext.SpanKind), "client")}
+	server := spanWithIDs(0, 1, 1)
+	server.Tags = model.KeyValues{model.String(string(ext.SpanKind), "server")}
+
+	assert.True(t, dedup.Allow(client))
+	assert.True(t, dedup.Allow(server), "the server half of a shared span is not a duplicate")
+	assert.False(t, dedup.Allow(server))
+	assert.True(t, dedup.Allow(spanWithIDs(0, 1, 1)), "span without kind")
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+// DropRule drops the spans of an infrastructure component, e.g. those of the proxy hops of service mesh sidecars.
+// A rule with both a service prefix and a tag drops the spans matching both.
+type DropRule struct {
+	// Name identifies the rule in the metrics
+	Name string `json:"name"`
+	// ServicePrefix is the prefix of the service names of the dropped spans, e.g. "istio-", any service if empty
+	ServicePrefix string `json:"service_prefix"`
+	// Tag is the key of the span or process tag of the dropped spans, any span of the services if empty
+	Tag string `json:"tag"`
+	// Value is the value the tag must have, as a string, the rule matching any value of the tag if empty
+	Value string `json:"value"`
+}
+
+// DropRules are the rules dropping spans, a span being dropped by the first rule it matches
+type DropRules []DropRule
+
+// LoadDropRules reads DropRules encoded as JSON, e.g.
+//
+//	[{"name": "sidecars", "service_prefix": "envoy-"}, {"name": "proxy-hops", "tag": "component", "value": "proxy"}]
+func LoadDropRules(r io.Reader) (DropRules, error) {
+	var rules DropRules
+	err := json.NewDecoder(r).Decode(&rules)
+	return rules, err
+}
+
+// SpanDropper rejects the spans matching DropRules before they are saved. The dropped spans are counted in the
+// spans.dropped-by-rule metric by rule.
+type SpanDropper struct {
+	sync.RWMutex
+	rules          DropRules
+	metricsFactory metrics.Factory
+	dropped        map[string]metrics.Counter
+}
+
+// NewSpanDropper creates a SpanDropper counting the dropped spans in the metrics factory, it returns an error
+// if the rules are not valid
+func NewSpanDropper(rules DropRules, metricsFactory metrics.Factory) (*SpanDropper, error) {
+	d := &SpanDropper{
+		metricsFactory: metricsFactory,
+		dropped:        make(map[string]metrics.Counter),
+	}
+	if err := d.Update(rules); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Update replaces the rules, spans filtered from then on use the new rules. The rules are left unchanged
+// if a rule has no name, has neither a service prefix nor a tag, or two rules have the same name.
+func (d *SpanDropper) Update(rules DropRules) error {
+	names := make(map[string]struct{}, len(rules))
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return fmt.Errorf("drop rule %d must have a name", i)
+		}
+		if rule.ServicePrefix == "" && rule.Tag == "" {
+			return fmt.Errorf("drop rule %s must have a service prefix or a tag", rule.Name)
+		}
+		if _, ok := names[rule.Name]; ok {
+			return fmt.Errorf("duplicate drop rule %s", rule.Name)
+		}
+		names[rule.Name] = struct{}{}
+	}
+	d.Lock()
+	defer d.Unlock()
+	for _, rule := range rules {
+		if _, ok := d.dropped[rule.Name]; !ok {
+			d.dropped[rule.Name] = d.metricsFactory.Counter("spans.dropped-by-rule", map[string]string{"rule": rule.Name})
+		}
+	}
+	d.rules = rules
+	return nil
+}
+
+// Allow returns false when the span matches a rule, it can be used as a FilterSpan.
+func (d *SpanDropper) Allow(span *model.Span) bool {
+	d.RLock()
+	defer d.RUnlock()
+	for _, rule := range d.rules {
+		if matchesDropRule(span, rule) {
+			d.dropped[rule.Name].Inc(1)
+			return false
+		}
+	}
+	return true
+}
+
+func matchesDropRule(span *model.Span, rule DropRule) bool {
+	if rule.ServicePrefix != "" && (span.Process == nil || !strings.HasPrefix(span.Process.ServiceName, rule.ServicePrefix)) {
+		return false
+	}
+	if rule.Tag == "" {
+		return true
+	}
+	return matchesSamplingRule(span, SamplingRule{Tag: rule.Tag, Value: rule.Value})
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+func TestLoadDropRules(t *testing.T) {
+	rules, err := LoadDropRules(strings.NewReader(`[
+		{"name": "sidecars", "service_prefix": "envoy-"},
+		{"name": "proxy-hops", "tag": "component", "value": "proxy"}
+	]`))
+	require.NoError(t, err)
+	assert.Equal(t, DropRules{
+		{Name: "sidecars", ServicePrefix: "envoy-"},
+		{Name: "proxy-hops", Tag: "component", Value: "proxy"},
+	}, rules)
+
+	_, err = LoadDropRules(strings.NewReader(`{"name": "sidecars"}`))
+	assert.Error(t, err)
+}
+
+func TestSpanDropper(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	dropper, err := NewSpanDropper(DropRules{
+		{Name: "sidecars", ServicePrefix: "envoy-"},
+		{Name: "mesh-hops", ServicePrefix: "mesh-", Tag: "component", Value: "proxy"},
+		{Name: "proxy-hops", Tag: "proxy.hop"},
+	}, metricsFactory)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		span    *model.Span
+		allowed bool
+	}{
+		{span: &model.Span{Process: &model.Process{ServiceName: "envoy-frontend"}}, allowed: false},
+		{span: &model.Span{Process: &model.Process{ServiceName: "frontend"}}, allowed: true},
+		{
+			span: &model.Span{
+				Tags:    model.KeyValues{model.String("component", "proxy")},
+				Process: &model.Process{ServiceName: "mesh-gateway"},
+			},
+			allowed: false,
+		},
+		{
+			// both the service prefix and the tag must match
+			span: &model.Span{
+				Tags:    model.KeyValues{model.String("component", "proxy")},
+				Process: &model.Process{ServiceName: "frontend"},
+			},
+			allowed: true,
+		},
+		{
+			span: &model.Span{
+				Tags:    model.KeyValues{model.String("component", "grpc")},
+				Process: &model.Process{ServiceName: "mesh-gateway"},
+			},
+			allowed: true,
+		},
+		{
+			span: &model.Span{
+				Process: &model.Process{ServiceName: "frontend", Tags: model.KeyValues{model.Bool("proxy.hop", true)}},
+			},
+			allowed: false,
+		},
+	}
+	for i, testCase := range testCases {
+		assert.Equal(t, testCase.allowed, dropper.Allow(testCase.span), "test case %d", i)
+	}
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["spans.dropped-by-rule|rule=sidecars"])
+	assert.EqualValues(t, 1, counts["spans.dropped-by-rule|rule=mesh-hops"])
+	assert.EqualValues(t, 1, counts["spans.dropped-by-rule|rule=proxy-hops"])
+
+	require.NoError(t, dropper.Update(DropRules{{Name: "frontend", ServicePrefix: "front"}}))
+	assert.True(t, dropper.Allow(testCases[0].span))
+	assert.False(t, dropper.Allow(testCases[1].span))
+}
+
+func TestSpanDropperInvalidRules(t *testing.T) {
+	for _, rules := range []DropRules{
+		{{ServicePrefix: "envoy-"}},
+		{{Name: "empty"}},
+		{{Name: "sidecars", ServicePrefix: "envoy-"}, {Name: "sidecars", ServicePrefix: "istio-"}},
+	} {
+		_, err := NewSpanDropper(rules, metrics.NullFactory)
+		assert.Error(t, err)
+	}
+
+	dropper, err := NewSpanDropper(DropRules{{Name: "sidecars", ServicePrefix: "envoy-"}}, metrics.NullFactory)
+	require.NoError(t, err)
+	assert.Error(t, dropper.Update(DropRules{{Name: "empty"}}))
+	assert.False(t, dropper.Allow(&model.Span{Process: &model.Process{ServiceName: "envoy-frontend"}}),
+		"invalid rules leave the rules unchanged")
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+const (
+	// DroppedByFilter is the reason of the spans rejected by a span filter, e.g. a rate limit or a span quota
+	DroppedByFilter = "rejected"
+	// DroppedByAdmission is the reason of the spans shed while the collector is overloaded
+	DroppedByAdmission = "shed"
+	// DroppedByQueue is the reason of the spans dropped because the queue of the span processor was full
+	DroppedByQueue = "queue-full"
+
+	// DefaultDroppedSpansSampleRate is the default fraction of the dropped spans retained by a DroppedSpanSampler
+	DefaultDroppedSpansSampleRate = 0.01
+)
+
+// DroppedSpanSamplerOptions configure a DroppedSpanSampler
+type DroppedSpanSamplerOptions struct {
+	// BufferSize is the number of dropped spans retained, the oldest ones being evicted first
+	BufferSize int
+	// SampleRate is the fraction of the traces, between 0 and 1, whose dropped spans are retained
+	SampleRate float64
+	// SampleSeed is the seed of the TraceSamplingBucket of the sampled traces, none if 0
+	SampleSeed uint64
+}
+
+// DroppedSpan is a span dropped by the span processor, retained for diagnostics
+type DroppedSpan struct {
+	Time   time.Time   `json:"time"`
+	Reason string      `json:"reason"`
+	Format string      `json:"format"`
+	Span   *model.Span `json:"span"`
+}
+
+// DroppedSpanSampler retains a sample of the spans dropped by the span processor in a bounded ring buffer,
+// so that the recent drops can be inspected without logging every span. The spans of a trace are sampled
+// together, so that the retained traces are complete as far as the drops go.
+type DroppedSpanSampler struct {
+	sampleRate float64
+	sampleSeed uint64
+	retained   metrics.Counter
+
+	sync.Mutex
+	buffer []DroppedSpan
+	// next is the position in buffer of the next dropped span, overwriting the oldest one once it is full
+	next int
+	full bool
+}
+
+// NewDroppedSpanSampler creates a DroppedSpanSampler and counts the spans it retains in the metrics factory
+func NewDroppedSpanSampler(options DroppedSpanSamplerOptions, metricsFactory metrics.Factory) *DroppedSpanSampler {
+	return &DroppedSpanSampler{
+		sampleRate: options.SampleRate,
+		sampleSeed: options.SampleSeed,
+		retained:   metricsFactory.Counter("dropped-spans.retained", nil),
+		buffer:     make([]DroppedSpan, options.BufferSize),
+	}
+}
+
+// Record retains the span dropped for the reason if its trace is sampled
+func (s *DroppedSpanSampler) Record(span *model.Span, format string, reason string) {
+	if len(s.buffer) == 0 || !sampleTrace(span.TraceID, s.sampleRate, s.sampleSeed) {
+		return
+	}
+	dropped := DroppedSpan{Time: time.Now(), Reason: reason, Format: format, Span: span}
+	s.Lock()
+	s.buffer[s.next] = dropped
+	s.next++
+	if s.next == len(s.buffer) {
+		s.next = 0
+		s.full = true
+	}
+	s.Unlock()
+	s.retained.Inc(1)
+}
+
+// Spans returns the retained dropped spans, the most recent first
+func (s *DroppedSpanSampler) Spans() []DroppedSpan {
+	s.Lock()
+	defer s.Unlock()
+	size := s.next
+	if s.full {
+		size = len(s.buffer)
+	}
+	spans := make([]DroppedSpan, 0, size)
+	for i := 1; i <= size; i++ {
+		spans = append(spans, s.buffer[(s.next-i+len(s.buffer))%len(s.buffer)])
+	}
+	return spans
+}
+
+// ServeHTTP writes the retained dropped spans as JSON, the most recent first, only those of the service
+// and reason of the query parameters of the same name if given
+func (s *DroppedSpanSampler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	service := r.URL.Query().Get("service")
+	reason := r.URL.Query().Get("reason")
+	spans := []DroppedSpan{}
+	for _, dropped := range s.Spans() {
+		if service != "" && (dropped.Span.Process == nil || dropped.Span.Process.ServiceName != service) {
+			continue
+		}
+		if reason != "" && dropped.Reason != reason {
+			continue
+		}
+		spans = append(spans, dropped)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Spans []DroppedSpan `json:"spans"`
+	}{Spans: spans})
+}
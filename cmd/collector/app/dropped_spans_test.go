@@ -0,0 +1,124 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+func droppedTestSpan(traceID uint64, service string) *model.Span {
+	return &model.Span{
+		TraceID:       model.TraceID{Low: traceID},
+		OperationName: "op",
+		Process:       &model.Process{ServiceName: service},
+	}
+}
+
+func TestDroppedSpanSamplerRingBuffer(t *testing.T) {
+	mb := metrics.NewLocalFactory(0)
+	s := NewDroppedSpanSampler(DroppedSpanSamplerOptions{BufferSize: 3, SampleRate: 1}, mb)
+	assert.Empty(t, s.Spans())
+
+	for i := uint64(1); i <= 5; i++ {
+		s.Record(droppedTestSpan(i, "svc"), JaegerFormatType, DroppedByFilter)
+	}
+	spans := s.Spans()
+	require.Len(t, spans, 3)
+	for i, traceID := range []uint64{5, 4, 3} {
+		assert.Equal(t, traceID, spans[i].Span.TraceID.Low)
+		assert.Equal(t, DroppedByFilter, spans[i].Reason)
+	}
+
+	counters, _ := mb.Snapshot()
+	assert.EqualValues(t, 5, counters["dropped-spans.retained"])
+}
+
+func TestDroppedSpanSamplerSampleRate(t *testing.T) {
+	s := NewDroppedSpanSampler(DroppedSpanSamplerOptions{BufferSize: 10, SampleRate: 0.5}, metrics.NullFactory)
+	s.Record(droppedTestSpan(4999, "svc"), JaegerFormatType, DroppedByFilter)
+	s.Record(droppedTestSpan(5000, "svc"), JaegerFormatType, DroppedByFilter)
+	s.Record(droppedTestSpan(10001, "svc"), JaegerFormatType, DroppedByFilter)
+
+	spans := s.Spans()
+	require.Len(t, spans, 2)
+	assert.EqualValues(t, 10001, spans[0].Span.TraceID.Low)
+	assert.EqualValues(t, 4999, spans[1].Span.TraceID.Low)
+
+	seeded := NewDroppedSpanSampler(DroppedSpanSamplerOptions{BufferSize: 10, SampleRate: 0.5, SampleSeed: 42}, metrics.NullFactory)
+	seeded.Record(droppedTestSpan(1, "svc"), JaegerFormatType, DroppedByFilter)
+	seeded.Record(droppedTestSpan(2, "svc"), JaegerFormatType, DroppedByFilter)
+	spans = seeded.Spans()
+	require.Len(t, spans, 1, "the seeded buckets of the trace IDs 1 and 2 are 9108 and 3741")
+	assert.EqualValues(t, 2, spans[0].Span.TraceID.Low)
+
+	disabled := NewDroppedSpanSampler(DroppedSpanSamplerOptions{BufferSize: 0, SampleRate: 1}, metrics.NullFactory)
+	disabled.Record(droppedTestSpan(1, "svc"), JaegerFormatType, DroppedByFilter)
+	assert.Empty(t, disabled.Spans())
+}
+
+func TestDroppedSpanSamplerServeHTTP(t *testing.T) {
+	s := NewDroppedSpanSampler(DroppedSpanSamplerOptions{BufferSize: 10, SampleRate: 1}, metrics.NullFactory)
+	s.Record(droppedTestSpan(1, "frontend"), JaegerFormatType, DroppedByFilter)
+	s.Record(droppedTestSpan(2, "backend"), ZipkinFormatType, DroppedByQueue)
+	s.Record(droppedTestSpan(3, "frontend"), JaegerFormatType, DroppedByQueue)
+
+	testCases := []struct {
+		query    string
+		traceIDs []uint64
+	}{
+		{query: "", traceIDs: []uint64{3, 2, 1}},
+		{query: "?service=frontend", traceIDs: []uint64{3, 1}},
+		{query: "?reason=queue-full", traceIDs: []uint64{3, 2}},
+		{query: "?service=frontend&reason=rejected", traceIDs: []uint64{1}},
+		{query: "?service=unknown", traceIDs: []uint64{}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+testCase.query, nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+			var response struct {
+				Spans []struct {
+					Reason string     `json:"reason"`
+					Format string     `json:"format"`
+					Span   model.Span `json:"span"`
+				} `json:"spans"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			traceIDs := []uint64{}
+			for _, dropped := range response.Spans {
+				traceIDs = append(traceIDs, dropped.Span.TraceID.Low)
+			}
+			assert.Equal(t, testCase.traceIDs, traceIDs)
+		})
+	}
+}
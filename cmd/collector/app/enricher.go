@@ -0,0 +1,264 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/pkg/cache"
+)
+
+const (
+	// DefaultEnrichmentCacheSize is the default number of services whose metadata is cached
+	DefaultEnrichmentCacheSize = 10000
+
+	// servicePlaceholder is replaced by the service name in the URL of the HTTPMetadataProvider
+	servicePlaceholder = "{service}"
+)
+
+// MetadataProvider returns the metadata of the services, e.g. their owner or environment
+type MetadataProvider interface {
+	// GetMetadata returns the metadata of the service keyed by tag key
+	GetMetadata(serviceName string) (map[string]string, error)
+}
+
+// MetadataProviderFunc is a function used as a MetadataProvider
+type MetadataProviderFunc func(serviceName string) (map[string]string, error)
+
+// GetMetadata implements MetadataProvider
+func (f MetadataProviderFunc) GetMetadata(serviceName string) (map[string]string, error) {
+	return f(serviceName)
+}
+
+// EnrichmentOptions configure the SpanEnricher
+type EnrichmentOptions struct {
+	// Provider is where the metadata of the services is looked up
+	Provider MetadataProvider
+	// TagKeys are the keys of the metadata added to the spans, all of them if empty
+	TagKeys []string
+	// CacheTTL is how long the metadata of a service is cached, not cached if 0
+	CacheTTL time.Duration
+	// CacheSize is the number of services whose metadata is cached, DefaultEnrichmentCacheSize if 0
+	CacheSize int
+}
+
+type enricherMetrics struct {
+	// LookupFailures counts the lookups of the metadata of a service which failed
+	LookupFailures metrics.Counter `metric:"span-enrichment.lookup-failures"`
+	// EnrichedSpans counts the spans which received metadata
+	EnrichedSpans metrics.Counter `metric:"span-enrichment.enriched-spans"`
+	// UnenrichedSpans counts the spans left without metadata because its lookup failed
+	UnenrichedSpans metrics.Counter `metric:"span-enrichment.unenriched-spans"`
+}
+
+// SpanEnricher adds to the spans the tags of the metadata of their service. The spans already having a tag
+// with the key of some metadata keep theirs, and the spans whose metadata cannot be looked up are left as they
+// are, so that an outage of the metadata source does not lose any span.
+type SpanEnricher struct {
+	provider MetadataProvider
+	tagKeys  []string
+	metrics  enricherMetrics
+
+	sync.RWMutex
+	// addedKeys are the keys of the metadata added to the spans, when all the keys are added
+	addedKeys map[string]struct{}
+}
+
+// NewSpanEnricher creates a SpanEnricher, caching the metadata of the provider if the options have a CacheTTL
+func NewSpanEnricher(options EnrichmentOptions, metricsFactory metrics.Factory) *SpanEnricher {
+	provider := options.Provider
+	if options.CacheTTL > 0 {
+		cacheSize := options.CacheSize
+		if cacheSize <= 0 {
+			cacheSize = DefaultEnrichmentCacheSize
+		}
+		provider = NewCachingMetadataProvider(provider, options.CacheTTL, cacheSize)
+	}
+	e := &SpanEnricher{provider: provider, tagKeys: options.TagKeys, addedKeys: make(map[string]struct{})}
+	metrics.Init(&e.metrics, metricsFactory, nil)
+	return e
+}
+
+// EnrichSpans adds the metadata of their service to the spans, looking it up once per service
+func (e *SpanEnricher) EnrichSpans(spans []*model.Span) {
+	tagsByService := make(map[string]model.KeyValues)
+	for _, span := range spans {
+		if span.Process == nil {
+			continue
+		}
+		serviceName := span.Process.ServiceName
+		tags, ok := tagsByService[serviceName]
+		if !ok {
+			tags = e.lookup(serviceName)
+			tagsByService[serviceName] = tags
+		}
+		if tags == nil {
+			e.metrics.UnenrichedSpans.Inc(1)
+			continue
+		}
+		enriched := false
+		for _, tag := range tags {
+			if _, ok := span.Tags.FindByKey(tag.Key); !ok {
+				span.Tags = append(span.Tags, tag)
+				enriched = true
+			}
+		}
+		if enriched {
+			e.metrics.EnrichedSpans.Inc(1)
+		}
+	}
+}
+
+// lookup returns the tags of the metadata of the service, nil if the lookup failed without any metadata
+func (e *SpanEnricher) lookup(serviceName string) model.KeyValues {
+	metadata, err := e.provider.GetMetadata(serviceName)
+	if err != nil {
+		e.metrics.LookupFailures.Inc(1)
+		if metadata == nil {
+			return nil
+		}
+	}
+	tags := model.KeyValues{}
+	if len(e.tagKeys) == 0 {
+		e.Lock()
+		for key, value := range metadata {
+			tags = append(tags, model.String(key, value))
+			e.addedKeys[key] = struct{}{}
+		}
+		e.Unlock()
+		// in a stable order, as the metadata is a map
+		tags.Sort()
+		return tags
+	}
+	for _, key := range e.tagKeys {
+		if value, ok := metadata[key]; ok {
+			tags = append(tags, model.String(key, value))
+		}
+	}
+	return tags
+}
+
+// AddsTag returns whether the spans are enriched with the tag key, so that it must be kept by the sanitizers
+func (e *SpanEnricher) AddsTag(key string) bool {
+	if len(e.tagKeys) > 0 {
+		for _, tagKey := range e.tagKeys {
+			if tagKey == key {
+				return true
+			}
+		}
+		return false
+	}
+	e.RLock()
+	defer e.RUnlock()
+	_, ok := e.addedKeys[key]
+	return ok
+}
+
+// CachingMetadataProvider caches the metadata of each service for a TTL. The failed lookups are also cached for
+// the TTL, so that the source is not hammered during an outage, and return the metadata of the last successful
+// lookup, if any, along with their error. The metadata of the least recently used services is evicted beyond
+// the size of the cache.
+type CachingMetadataProvider struct {
+	provider MetadataProvider
+	ttl      time.Duration
+	timeNow  func() time.Time
+	entries  *cache.LRU
+}
+
+type metadataEntry struct {
+	metadata map[string]string
+	err      error
+	expiry   time.Time
+}
+
+// NewCachingMetadataProvider creates a CachingMetadataProvider caching the metadata of up to size services of
+// the provider for ttl
+func NewCachingMetadataProvider(provider MetadataProvider, ttl time.Duration, size int) *CachingMetadataProvider {
+	return &CachingMetadataProvider{
+		provider: provider,
+		ttl:      ttl,
+		timeNow:  time.Now,
+		// without the TTL of the cache, so that the expired metadata is still returned when the lookup fails
+		entries: cache.NewLRU(size),
+	}
+}
+
+// GetMetadata implements MetadataProvider
+func (p *CachingMetadataProvider) GetMetadata(serviceName string) (map[string]string, error) {
+	now := p.timeNow()
+	entry, ok := p.entries.Get(serviceName).(*metadataEntry)
+	if ok && now.Before(entry.expiry) {
+		return entry.metadata, entry.err
+	}
+	// concurrent lookups of the same service both reach the provider
+	metadata, err := p.provider.GetMetadata(serviceName)
+	if err != nil && ok {
+		metadata = entry.metadata
+	}
+	p.entries.Put(serviceName, &metadataEntry{metadata: metadata, err: err, expiry: now.Add(p.ttl)})
+	return metadata, err
+}
+
+// HTTPMetadataProvider looks up the metadata of a service with a GET request, the response being a JSON object
+// of string values. The metadata of a service answered with 404 Not Found is empty.
+type HTTPMetadataProvider struct {
+	urlTemplate string
+	client      *http.Client
+}
+
+// NewHTTPMetadataProvider creates an HTTPMetadataProvider requesting the URL, in which {service} is replaced by
+// the escaped service name, e.g. http://metadata/services/{service}
+func NewHTTPMetadataProvider(urlTemplate string, timeout time.Duration) *HTTPMetadataProvider {
+	return &HTTPMetadataProvider{
+		urlTemplate: urlTemplate,
+		client:      &http.Client{Timeout: timeout},
+	}
+}
+
+// GetMetadata implements MetadataProvider
+func (p *HTTPMetadataProvider) GetMetadata(serviceName string) (map[string]string, error) {
+	escaped := (&url.URL{Path: serviceName}).EscapedPath()
+	res, err := p.client.Get(strings.Replace(p.urlTemplate, servicePlaceholder, escaped, -1))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return map[string]string{}, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata of service %s returned status %d", serviceName, res.StatusCode)
+	}
+	var metadata map[string]string
+	if err := json.NewDecoder(res.Body).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("cannot decode the metadata of service %s: %v", serviceName, err)
+	}
+	return metadata, nil
+}
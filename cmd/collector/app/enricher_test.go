@@ -0,0 +1,196 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+// fakeMetadataProvider returns the metadata of its map, or its error, counting the lookups
+type fakeMetadataProvider struct {
+	metadata map[string]map[string]string
+	err      error
+	lookups  int
+}
+
+func (p *fakeMetadataProvider) GetMetadata(serviceName string) (map[string]string, error) {
+	p.lookups++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.metadata[serviceName], nil
+}
+
+func TestSpanEnricher(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	provider := &fakeMetadataProvider{metadata: map[string]map[string]string{
+		"billing": {"owner": "payments-team", "env": "prod", "tier": "1"},
+	}}
+	e := NewSpanEnricher(EnrichmentOptions{Provider: provider, TagKeys: []string{"owner", "env"}}, metricsFactory)
+	spans := []*model.Span{
+		{Process: &model.Process{ServiceName: "billing"}},
+		{Process: &model.Process{ServiceName: "billing"}, Tags: model.KeyValues{model.String("env", "staging")}},
+		{Process: &model.Process{ServiceName: "unknown"}},
+	}
+	e.EnrichSpans(spans)
+
+	assert.Equal(t, model.KeyValues{model.String("owner", "payments-team"), model.String("env", "prod")}, spans[0].Tags)
+	// the existing tag is kept
+	assert.Equal(t, model.KeyValues{model.String("env", "staging"), model.String("owner", "payments-team")}, spans[1].Tags)
+	assert.Empty(t, spans[2].Tags)
+	assert.Equal(t, 2, provider.lookups, "the metadata is looked up once per service of a batch")
+
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counts["span-enrichment.enriched-spans"])
+	assert.EqualValues(t, 0, counts["span-enrichment.lookup-failures"])
+}
+
+func TestSpanEnricherAllTags(t *testing.T) {
+	provider := &fakeMetadataProvider{metadata: map[string]map[string]string{
+		"billing": {"owner": "payments-team", "env": "prod"},
+	}}
+	e := NewSpanEnricher(EnrichmentOptions{Provider: provider}, metrics.NullFactory)
+	span := &model.Span{Process: &model.Process{ServiceName: "billing"}}
+	e.EnrichSpans([]*model.Span{span})
+	assert.Equal(t, model.KeyValues{model.String("env", "prod"), model.String("owner", "payments-team")}, span.Tags)
+	assert.True(t, e.AddsTag("env"))
+	assert.False(t, e.AddsTag("region"), "only the keys of the metadata looked up are added")
+}
+
+func TestSpanEnricherFailures(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	provider := &fakeMetadataProvider{err: errors.New("unavailable")}
+	e := NewSpanEnricher(EnrichmentOptions{Provider: provider, TagKeys: []string{"owner"}}, metricsFactory)
+	spans := []*model.Span{
+		{Process: &model.Process{ServiceName: "billing"}},
+		{Process: &model.Process{ServiceName: "billing"}},
+	}
+	e.EnrichSpans(spans)
+
+	assert.Empty(t, spans[0].Tags)
+	assert.Empty(t, spans[1].Tags)
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["span-enrichment.lookup-failures"])
+	assert.EqualValues(t, 2, counts["span-enrichment.unenriched-spans"])
+}
+
+func TestCachingMetadataProvider(t *testing.T) {
+	provider := &fakeMetadataProvider{metadata: map[string]map[string]string{"billing": {"owner": "payments-team"}}}
+	cache := NewCachingMetadataProvider(provider, time.Minute, 10)
+	now := time.Unix(1000, 0)
+	cache.timeNow = func() time.Time { return now }
+
+	metadata, err := cache.GetMetadata("billing")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"owner": "payments-team"}, metadata)
+	now = now.Add(59 * time.Second)
+	_, err = cache.GetMetadata("billing")
+	require.NoError(t, err)
+	assert.Equal(t, 1, provider.lookups)
+
+	// a failed lookup returns the metadata looked up before, and is cached too
+	provider.err = errors.New("unavailable")
+	now = now.Add(time.Second)
+	metadata, err = cache.GetMetadata("billing")
+	assert.EqualError(t, err, "unavailable")
+	assert.Equal(t, map[string]string{"owner": "payments-team"}, metadata)
+	metadata, err = cache.GetMetadata("billing")
+	assert.EqualError(t, err, "unavailable")
+	assert.Equal(t, map[string]string{"owner": "payments-team"}, metadata)
+	assert.Equal(t, 2, provider.lookups)
+
+	provider.err = nil
+	provider.metadata["billing"] = map[string]string{"owner": "billing-team"}
+	now = now.Add(time.Minute)
+	metadata, err = cache.GetMetadata("billing")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"owner": "billing-team"}, metadata)
+	assert.Equal(t, 3, provider.lookups)
+}
+
+func TestSpanEnricherStaleMetadata(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	provider := &fakeMetadataProvider{metadata: map[string]map[string]string{"billing": {"owner": "payments-team"}}}
+	e := NewSpanEnricher(EnrichmentOptions{Provider: provider, CacheTTL: time.Nanosecond}, metricsFactory)
+	e.EnrichSpans([]*model.Span{{Process: &model.Process{ServiceName: "billing"}}})
+
+	provider.err = errors.New("unavailable")
+	time.Sleep(time.Millisecond)
+	span := &model.Span{Process: &model.Process{ServiceName: "billing"}}
+	e.EnrichSpans([]*model.Span{span})
+	assert.Equal(t, model.KeyValues{model.String("owner", "payments-team")}, span.Tags)
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["span-enrichment.lookup-failures"])
+	assert.EqualValues(t, 2, counts["span-enrichment.enriched-spans"])
+}
+
+func TestHTTPMetadataProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/services/billing api":
+			w.Write([]byte(`{"owner": "payments-team"}`))
+		case "/services/broken":
+			w.Write([]byte(`not json`))
+		case "/services/down":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	provider := NewHTTPMetadataProvider(server.URL+"/services/{service}", time.Second)
+
+	metadata, err := provider.GetMetadata("billing api")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"owner": "payments-team"}, metadata)
+
+	metadata, err = provider.GetMetadata("unknown")
+	require.NoError(t, err)
+	assert.Empty(t, metadata)
+
+	_, err = provider.GetMetadata("broken")
+	assert.Error(t, err)
+	_, err = provider.GetMetadata("down")
+	assert.EqualError(t, err, "metadata of service down returned status 503")
+}
+
+func TestCachingMetadataProviderEviction(t *testing.T) {
+	provider := &fakeMetadataProvider{metadata: map[string]map[string]string{
+		"billing":  {"owner": "payments-team"},
+		"frontend": {"owner": "web-team"},
+	}}
+	cache := NewCachingMetadataProvider(provider, time.Minute, 1)
+	for _, service := range []string{"billing", "billing", "frontend", "billing"} {
+		_, err := cache.GetMetadata(service)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 3, provider.lookups, "the least recently used service is evicted")
+}
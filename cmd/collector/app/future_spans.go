@@ -0,0 +1,136 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+// FutureSpanMode is what happens to the spans starting further in the future than the tolerance
+type FutureSpanMode string
+
+const (
+	// DropFutureSpans drops the spans starting in the future
+	DropFutureSpans FutureSpanMode = "drop"
+	// ClampFutureSpans moves the spans starting in the future to start now, tagged with ClampedStartTimeTag
+	ClampFutureSpans FutureSpanMode = "clamp"
+
+	// ClampedStartTimeTag is the span tag recording the microseconds the start of a span was moved back by
+	ClampedStartTimeTag = "start_time.clamped_us"
+
+	// DefaultFutureSpanTolerance is the default time spans can start in the future, e.g. because of clock skew
+	DefaultFutureSpanTolerance = 10 * time.Minute
+)
+
+// ParseFutureSpanMode returns the FutureSpanMode with the given name, empty meaning DropFutureSpans
+func ParseFutureSpanMode(name string) (FutureSpanMode, error) {
+	switch mode := FutureSpanMode(name); mode {
+	case "":
+		return DropFutureSpans, nil
+	case DropFutureSpans, ClampFutureSpans:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("Unknown future span mode %q", name)
+	}
+}
+
+// FutureSpanOptions configure a FutureSpanValidator
+type FutureSpanOptions struct {
+	// Tolerance is the time spans can start after now, DefaultFutureSpanTolerance if 0
+	Tolerance time.Duration
+	// Mode is what happens to the spans starting later, DropFutureSpans if empty
+	Mode FutureSpanMode
+}
+
+// FutureSpanValidator drops or clamps the spans starting further in the future than the tolerance, e.g. those
+// of clients with skewed clocks, which would be missed by the queries of the time ranges they really are in.
+// The clamped spans and their logs are moved back by the same time, keeping their duration. The spans of each
+// service are counted by the spans.future-dropped or spans.future-clamped counter.
+type FutureSpanValidator struct {
+	options FutureSpanOptions
+	factory metrics.Factory
+	// counterName is the name of the counters of the future spans of each service in the mode
+	counterName string
+	lock        sync.Mutex
+	counters    map[string]metrics.Counter
+	timeNow     func() time.Time
+}
+
+// NewFutureSpanValidator creates a FutureSpanValidator counting the future spans in the metrics factory
+func NewFutureSpanValidator(options FutureSpanOptions, metricsFactory metrics.Factory) *FutureSpanValidator {
+	if options.Tolerance == 0 {
+		options.Tolerance = DefaultFutureSpanTolerance
+	}
+	if options.Mode == "" {
+		options.Mode = DropFutureSpans
+	}
+	counterName := "spans.future-dropped"
+	if options.Mode == ClampFutureSpans {
+		counterName = "spans.future-clamped"
+	}
+	return &FutureSpanValidator{
+		options:     options,
+		factory:     metricsFactory,
+		counterName: counterName,
+		counters:    make(map[string]metrics.Counter),
+		timeNow:     time.Now,
+	}
+}
+
+// Allow returns false when the span starts further in the future than the tolerance and the mode drops it.
+// It can be used as a FilterSpan, the clamped spans are moved back to start now.
+func (v *FutureSpanValidator) Allow(span *model.Span) bool {
+	now := v.timeNow()
+	if !span.StartTime.After(now.Add(v.options.Tolerance)) {
+		return true
+	}
+	v.count(span.Process.ServiceName)
+	if v.options.Mode == DropFutureSpans {
+		return false
+	}
+	shift := span.StartTime.Sub(now)
+	span.StartTime = now
+	for i := range span.Logs {
+		span.Logs[i].Timestamp = span.Logs[i].Timestamp.Add(-shift)
+	}
+	span.Tags = append(span.Tags, model.Int64(ClampedStartTimeTag, int64(shift/time.Microsecond)))
+	return true
+}
+
+func (v *FutureSpanValidator) count(serviceName string) {
+	serviceName = NormalizeServiceName(serviceName)
+	v.lock.Lock()
+	counter, ok := v.counters[serviceName]
+	if !ok && len(v.counters) < maxServiceNames {
+		counter = v.factory.Counter(v.counterName, map[string]string{"service": serviceName})
+		v.counters[serviceName] = counter
+	}
+	v.lock.Unlock()
+	if counter != nil {
+		counter.Inc(1)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+func newTestFutureSpanValidator(options FutureSpanOptions, metricsFactory metrics.Factory, now time.Time) *FutureSpanValidator {
+	v := NewFutureSpanValidator(options, metricsFactory)
+	v.timeNow = func() time.Time { return now }
+	return v
+}
+
+func spanStartingAt(serviceName string, startTime time.Time) *model.Span {
+	return &model.Span{
+		StartTime: startTime,
+		Duration:  time.Second,
+		Process:   &model.Process{ServiceName: serviceName},
+		Logs:      []model.Log{{Timestamp: startTime.Add(time.Millisecond)}},
+	}
+}
+
+func TestFutureSpanValidatorDrop(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	now := time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+	v := newTestFutureSpanValidator(FutureSpanOptions{Tolerance: time.Minute}, metricsFactory, now)
+
+	assert.True(t, v.Allow(spanStartingAt("svc", now.Add(-time.Hour))))
+	assert.True(t, v.Allow(spanStartingAt("svc", now.Add(time.Minute))), "within the tolerance")
+	span := spanStartingAt("skewed", now.Add(2*time.Hour))
+	assert.False(t, v.Allow(span))
+	assert.Equal(t, now.Add(2*time.Hour), span.StartTime, "dropped spans are not clamped")
+
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["spans.future-dropped|service=skewed"])
+	assert.NotContains(t, counts, "spans.future-dropped|service=svc")
+}
+
+func TestFutureSpanValidatorClamp(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	now := time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+	v := newTestFutureSpanValidator(FutureSpanOptions{Mode: ClampFutureSpans}, metricsFactory, now)
+
+	span := spanStartingAt("skewed", now.Add(2*time.Hour))
+	assert.True(t, v.Allow(span))
+	assert.Equal(t, now, span.StartTime)
+	assert.Equal(t, time.Second, span.Duration)
+	assert.Equal(t, now.Add(time.Millisecond), span.Logs[0].Timestamp, "the logs are moved back with the span")
+	assert.Equal(t, model.KeyValues{model.Int64(ClampedStartTimeTag, int64(2*time.Hour/time.Microsecond))}, span.Tags)
+
+	span = spanStartingAt("svc", now.Add(5*time.Minute))
+	assert.True(t, v.Allow(span), "within the default tolerance")
+	assert.Empty(t, span.Tags)
+
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["spans.future-clamped|service=skewed"])
+}
+
+func TestParseFutureSpanMode(t *testing.T) {
+	for name, expected := range map[string]FutureSpanMode{"": DropFutureSpans, "drop": DropFutureSpans, "clamp": ClampFutureSpans} {
+		mode, err := ParseFutureSpanMode(name)
+		require.NoError(t, err)
+		assert.Equal(t, expected, mode)
+	}
+	_, err := ParseFutureSpanMode("tag")
+	assert.EqualError(t, err, `Unknown future span mode "tag"`)
+}
@@ -0,0 +1,207 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/uber/tchannel-go"
+	tchanThrift "github.com/uber/tchannel-go/thrift"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/uber/jaeger/model"
+	jConv "github.com/uber/jaeger/model/converter/json"
+	jModel "github.com/uber/jaeger/model/json"
+)
+
+const (
+	// GRPCFormatType is for spans received through the gRPC Collect endpoint
+	GRPCFormatType = "grpc"
+
+	grpcServiceName = "jaeger.api.Collector"
+	grpcCollectName = "Collect"
+	grpcCodecName   = "json"
+	grpcFullCollect = "/" + grpcServiceName + "/" + grpcCollectName
+)
+
+// CollectRequest is a batch of spans, each with its process embedded, submitted over gRPC
+type CollectRequest struct {
+	Spans []*jModel.Span `json:"spans"`
+}
+
+// CollectResponse reports whether all spans of a CollectRequest were accepted
+type CollectResponse struct {
+	Ok bool `json:"ok"`
+}
+
+// GRPCCollector consumes and handles batches of spans submitted over gRPC. The jaeger.api.Collector service
+// has no protobuf IDL: its messages are CollectRequest and CollectResponse in JSON, so the clients need to
+// call it with a JSON codec, e.g. grpc.WithCodec in Go, rather than protobuf.
+type GRPCCollector interface {
+	// Collect records a batch of spans in the Jaeger JSON model
+	Collect(ctx context.Context, request *CollectRequest) (*CollectResponse, error)
+}
+
+type grpcHandler struct {
+	logger         *zap.Logger
+	batchesHandler JaegerBatchesHandler
+	tenantHeader   string
+}
+
+// NewGRPCHandler returns a GRPCCollector that submits the spans to the given handler as Jaeger batches, one
+// per process, so that they go through the same tenancy and batch size handlers as the Jaeger Thrift spans,
+// the clients being authenticated by the interceptor of the server. The given tenant header of the metadata
+// of the calls is passed on to the handler as by the APIHandler.
+func NewGRPCHandler(logger *zap.Logger, batchesHandler JaegerBatchesHandler, tenantHeader string) GRPCCollector {
+	return &grpcHandler{
+		logger:         logger,
+		batchesHandler: batchesHandler,
+		tenantHeader:   tenantHeader,
+	}
+}
+
+// Collect converts the spans to the domain model and submits them to the handler. Backpressure from the
+// processor is reported as codes.ResourceExhausted, and the batches rejected by the handlers, e.g. oversized,
+// as codes.InvalidArgument.
+func (g *grpcHandler) Collect(ctx context.Context, request *CollectRequest) (*CollectResponse, error) {
+	mSpans := make([]*model.Span, 0, len(request.Spans))
+	var processes []*model.Process
+	for _, span := range request.Spans {
+		mSpan, err := jConv.SpanToDomain(span)
+		if err != nil {
+			g.logger.Warn("Unable to convert gRPC span to domain span", zap.Error(err))
+			return nil, status.Errorf(codes.InvalidArgument, "Unable to convert span: %v", err)
+		}
+		// each span embeds its process, the spans of equal processes are submitted in the same batch
+		mSpan.Process, processes = sharedProcess(mSpan.Process, processes)
+		mSpans = append(mSpans, mSpan)
+	}
+	submitCtx, cancel := g.callContext(ctx)
+	defer cancel()
+	responses, err := g.batchesHandler.SubmitBatches(submitCtx, toJaegerBatches(mSpans))
+	if err == tchannel.ErrServerBusy {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if err != nil && tchannel.GetSystemErrorCode(err) == tchannel.ErrCodeBadRequest {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	batchOk := true
+	for _, response := range responses {
+		if !response.Ok {
+			batchOk = false
+			break
+		}
+	}
+	return &CollectResponse{Ok: batchOk}, nil
+}
+
+// sharedProcess returns the process of processes equal to the given one, adding it to processes if there is none
+func sharedProcess(process *model.Process, processes []*model.Process) (*model.Process, []*model.Process) {
+	for _, p := range processes {
+		if p.Equal(process) {
+			return p, processes
+		}
+	}
+	return process, append(processes, process)
+}
+
+// callContext returns the context of the submission of the spans of a call, carrying the tenant header of its
+// metadata the way the HTTP handlers carry the request headers
+func (g *grpcHandler) callContext(ctx context.Context) (tchanThrift.Context, func()) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	headers := make(map[string]string)
+	if md, ok := metadata.FromIncomingContext(ctx); ok && g.tenantHeader != "" {
+		// the gRPC metadata keys are in lower case
+		key := strings.ToLower(g.tenantHeader)
+		if values := md[key]; len(values) > 0 {
+			headers[key] = values[0]
+		}
+	}
+	return tchanThrift.WithHeaders(ctx, headers), cancel
+}
+
+// NewGRPCServer creates a gRPC server with the Collect endpoint registered. The messages are encoded in JSON
+// for all the calls, since they reuse the Jaeger JSON model and no protobuf IDL is defined for them.
+func NewGRPCServer(collector GRPCCollector, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.CustomCodec(jsonCodec{}))
+	server := grpc.NewServer(opts...)
+	server.RegisterService(&collectorServiceDesc, collector)
+	return server
+}
+
+var collectorServiceDesc = grpc.ServiceDesc{
+	ServiceName: grpcServiceName,
+	HandlerType: (*GRPCCollector)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: grpcCollectName,
+			Handler:    collectHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+func collectHandler(
+	srv interface{},
+	ctx context.Context,
+	dec func(interface{}) error,
+	interceptor grpc.UnaryServerInterceptor,
+) (interface{}, error) {
+	request := &CollectRequest{}
+	if err := dec(request); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GRPCCollector).Collect(ctx, request)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: grpcFullCollect,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GRPCCollector).Collect(ctx, req.(*CollectRequest))
+	}
+	return interceptor(ctx, request, info, handler)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) String() string {
+	return grpcCodecName
+}
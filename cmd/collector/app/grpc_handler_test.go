@@ -0,0 +1,167 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+	"github.com/uber/tchannel-go"
+	tchanThrift "github.com/uber/tchannel-go/thrift"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/uber/jaeger/model"
+	jModel "github.com/uber/jaeger/model/json"
+	"github.com/uber/jaeger/thrift-gen/jaeger"
+)
+
+func makeGRPCRequest() *CollectRequest {
+	return &CollectRequest{
+		Spans: []*jModel.Span{
+			{
+				TraceID:       "1",
+				SpanID:        "2",
+				ParentSpanID:  "0",
+				OperationName: "op",
+				Process:       &jModel.Process{ServiceName: "someServiceName"},
+			},
+		},
+	}
+}
+
+type busyProcessor struct{}
+
+func (busyProcessor) ProcessSpans(mSpans []*model.Span, format string) ([]bool, error) {
+	return nil, tchannel.ErrServerBusy
+}
+
+func TestGRPCHandler(t *testing.T) {
+	testCases := []struct {
+		processor    SpanProcessor
+		request      *CollectRequest
+		expectedCode codes.Code
+	}{
+		{
+			processor:    &shouldIErrorProcessor{false},
+			request:      makeGRPCRequest(),
+			expectedCode: codes.OK,
+		},
+		{
+			processor:    &shouldIErrorProcessor{true},
+			request:      makeGRPCRequest(),
+			expectedCode: codes.Internal,
+		},
+		{
+			processor:    busyProcessor{},
+			request:      makeGRPCRequest(),
+			expectedCode: codes.ResourceExhausted,
+		},
+		{
+			processor: &shouldIErrorProcessor{false},
+			request: &CollectRequest{
+				Spans: []*jModel.Span{{TraceID: "not-hex"}},
+			},
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+	for _, tc := range testCases {
+		h := NewGRPCHandler(zap.NewNop(), NewGRPCSpanHandler(zap.NewNop(), tc.processor, metrics.NullFactory), "")
+		res, err := h.Collect(context.Background(), tc.request)
+		if tc.expectedCode == codes.OK {
+			require.NoError(t, err)
+			assert.True(t, res.Ok)
+		} else {
+			assert.Nil(t, res)
+			assert.Equal(t, tc.expectedCode, status.Code(err))
+		}
+	}
+}
+
+func TestGRPCServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := NewGRPCServer(NewGRPCHandler(zap.NewNop(), NewGRPCSpanHandler(zap.NewNop(), &shouldIErrorProcessor{false}, metrics.NullFactory), ""))
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure(), grpc.WithCodec(jsonCodec{}))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	res := &CollectResponse{}
+	err = grpc.Invoke(ctx, grpcFullCollect, makeGRPCRequest(), res, conn)
+	require.NoError(t, err)
+	assert.True(t, res.Ok)
+}
+
+type recordingBatchesHandler struct {
+	ctx     tchanThrift.Context
+	batches []*jaeger.Batch
+	err     error
+}
+
+func (h *recordingBatchesHandler) SubmitBatches(ctx tchanThrift.Context, batches []*jaeger.Batch) ([]*jaeger.BatchSubmitResponse, error) {
+	h.ctx = ctx
+	h.batches = append(h.batches, batches...)
+	if h.err != nil {
+		return nil, h.err
+	}
+	responses := make([]*jaeger.BatchSubmitResponse, len(batches))
+	for i := range responses {
+		responses[i] = &jaeger.BatchSubmitResponse{Ok: true}
+	}
+	return responses, nil
+}
+
+func TestGRPCHandlerBatches(t *testing.T) {
+	request := makeGRPCRequest()
+	request.Spans = append(request.Spans,
+		&jModel.Span{TraceID: "1", SpanID: "3", ParentSpanID: "2", Process: &jModel.Process{ServiceName: "someServiceName"}},
+		&jModel.Span{TraceID: "1", SpanID: "4", ParentSpanID: "2", Process: &jModel.Process{ServiceName: "otherServiceName"}},
+	)
+	batchesHandler := &recordingBatchesHandler{}
+	h := NewGRPCHandler(zap.NewNop(), batchesHandler, "X-Tenant")
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-tenant", "payments"))
+	res, err := h.Collect(ctx, request)
+	require.NoError(t, err)
+	assert.True(t, res.Ok)
+	assert.Equal(t, map[string]string{"x-tenant": "payments"}, batchesHandler.ctx.Headers())
+	require.Len(t, batchesHandler.batches, 2, "the spans of equal processes are in the same batch")
+	assert.Equal(t, "someServiceName", batchesHandler.batches[0].Process.ServiceName)
+	assert.Len(t, batchesHandler.batches[0].Spans, 2)
+	assert.Equal(t, "otherServiceName", batchesHandler.batches[1].Process.ServiceName)
+	assert.Len(t, batchesHandler.batches[1].Spans, 1)
+
+	batchesHandler.err = tchannel.NewSystemError(tchannel.ErrCodeBadRequest, "Batch too large")
+	_, err = h.Collect(context.Background(), makeGRPCRequest())
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultHealthCheckInterval is the default interval between two probes of the span storage
+	DefaultHealthCheckInterval = 10 * time.Second
+	// DefaultHealthCheckFailureThreshold is the default number of consecutive failed probes making the storage unhealthy
+	DefaultHealthCheckFailureThreshold = 3
+	// DefaultHealthCheckSuccessThreshold is the default number of consecutive successful probes making the storage healthy again
+	DefaultHealthCheckSuccessThreshold = 1
+)
+
+// HealthProbe checks that the span storage can be reached, returning an error if it cannot
+type HealthProbe func() error
+
+// HealthCheckOptions are the settings of the storage health check.
+type HealthCheckOptions struct {
+	// Interval is the time between two probes of the storage
+	Interval time.Duration
+	// FailureThreshold is the number of consecutive failed probes after which the storage is unhealthy
+	FailureThreshold int
+	// SuccessThreshold is the number of consecutive successful probes after which an unhealthy storage is healthy again
+	SuccessThreshold int
+}
+
+type healthCheckMetrics struct {
+	// Healthy is 1 when the storage is healthy and 0 otherwise
+	Healthy metrics.Gauge `metric:"storage.healthy"`
+	// ProbeFailures counts the probes of the storage that failed
+	ProbeFailures metrics.Counter `metric:"storage.probe-failures"`
+}
+
+// StorageHealthCheck periodically probes the span storage. The storage starts healthy, it becomes unhealthy
+// after FailureThreshold consecutive failed probes and healthy again after SuccessThreshold consecutive
+// successful ones, so that a single slow query does not take the collector out of rotation.
+// It implements http.Handler to be used as a readiness probe.
+type StorageHealthCheck struct {
+	sync.RWMutex
+	options              HealthCheckOptions
+	probe                HealthProbe
+	logger               *zap.Logger
+	metrics              healthCheckMetrics
+	healthy              bool
+	lastErr              error
+	consecutiveFailures  int
+	consecutiveSuccesses int
+	done                 chan struct{}
+}
+
+// NewStorageHealthCheck creates a StorageHealthCheck using the given probe, a nil probe is always healthy.
+// Start needs to be called to begin probing the storage.
+func NewStorageHealthCheck(probe HealthProbe, options HealthCheckOptions, logger *zap.Logger, metricsFactory metrics.Factory) *StorageHealthCheck {
+	if options.Interval <= 0 {
+		options.Interval = DefaultHealthCheckInterval
+	}
+	if options.FailureThreshold <= 0 {
+		options.FailureThreshold = DefaultHealthCheckFailureThreshold
+	}
+	if options.SuccessThreshold <= 0 {
+		options.SuccessThreshold = DefaultHealthCheckSuccessThreshold
+	}
+	if probe == nil {
+		probe = func() error { return nil }
+	}
+	h := &StorageHealthCheck{
+		options: options,
+		probe:   probe,
+		logger:  logger,
+		healthy: true,
+		done:    make(chan struct{}),
+	}
+	metrics.Init(&h.metrics, metricsFactory, nil)
+	h.metrics.Healthy.Update(1)
+	return h
+}
+
+// Start begins the periodic probing of the storage.
+func (h *StorageHealthCheck) Start() {
+	go func() {
+		ticker := time.NewTicker(h.options.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				h.Probe()
+			case <-h.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts the probing of the storage.
+func (h *StorageHealthCheck) Stop() {
+	close(h.done)
+}
+
+// Probe probes the storage once and updates its health, which is returned.
+func (h *StorageHealthCheck) Probe() bool {
+	err := h.probe()
+	h.Lock()
+	defer h.Unlock()
+	h.lastErr = err
+	if err != nil {
+		h.metrics.ProbeFailures.Inc(1)
+		h.consecutiveSuccesses = 0
+		h.consecutiveFailures++
+		if h.healthy && h.consecutiveFailures >= h.options.FailureThreshold {
+			h.logger.Error("Span storage is unhealthy", zap.Int("consecutive_failures", h.consecutiveFailures), zap.Error(err))
+			h.setHealthy(false)
+		}
+	} else {
+		h.consecutiveFailures = 0
+		h.consecutiveSuccesses++
+		if !h.healthy && h.consecutiveSuccesses >= h.options.SuccessThreshold {
+			h.logger.Info("Span storage is healthy again")
+			h.setHealthy(true)
+		}
+	}
+	return h.healthy
+}
+
+func (h *StorageHealthCheck) setHealthy(healthy bool) {
+	h.healthy = healthy
+	if healthy {
+		h.metrics.Healthy.Update(1)
+	} else {
+		h.metrics.Healthy.Update(0)
+	}
+}
+
+// Healthy returns whether the storage is healthy, and the error of the last probe
+func (h *StorageHealthCheck) Healthy() (bool, error) {
+	h.RLock()
+	defer h.RUnlock()
+	return h.healthy, h.lastErr
+}
+
+// ServeHTTP responds with 200 when the storage is healthy and 503 otherwise.
+func (h *StorageHealthCheck) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	healthy, err := h.Healthy()
+	if !healthy {
+		http.Error(w, "span storage is unavailable: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+)
+
+func TestStorageHealthCheckThresholds(t *testing.T) {
+	var probeErr error
+	metricsFactory := metrics.NewLocalFactory(0)
+	hc := NewStorageHealthCheck(
+		func() error { return probeErr },
+		HealthCheckOptions{FailureThreshold: 2, SuccessThreshold: 2},
+		zap.NewNop(),
+		metricsFactory,
+	)
+	healthy, err := hc.Healthy()
+	assert.True(t, healthy)
+	assert.NoError(t, err)
+
+	probeErr = errors.New("unreachable")
+	assert.True(t, hc.Probe(), "a single failure does not make the storage unhealthy")
+	assert.False(t, hc.Probe())
+	healthy, err = hc.Healthy()
+	assert.False(t, healthy)
+	assert.EqualError(t, err, "unreachable")
+
+	probeErr = nil
+	assert.False(t, hc.Probe())
+	probeErr = errors.New("unreachable")
+	assert.False(t, hc.Probe(), "the successes need to be consecutive")
+	probeErr = nil
+	assert.False(t, hc.Probe())
+	assert.True(t, hc.Probe())
+
+	counters, gauges := metricsFactory.Snapshot()
+	assert.EqualValues(t, 3, counters["storage.probe-failures"])
+	assert.EqualValues(t, 1, gauges["storage.healthy"])
+}
+
+func TestStorageHealthCheckDefaults(t *testing.T) {
+	hc := NewStorageHealthCheck(nil, HealthCheckOptions{}, zap.NewNop(), metrics.NullFactory)
+	assert.Equal(t, DefaultHealthCheckInterval, hc.options.Interval)
+	assert.Equal(t, DefaultHealthCheckFailureThreshold, hc.options.FailureThreshold)
+	assert.Equal(t, DefaultHealthCheckSuccessThreshold, hc.options.SuccessThreshold)
+	assert.True(t, hc.Probe(), "storage without a probe is always healthy")
+}
+
+func TestStorageHealthCheckStartStop(t *testing.T) {
+	probed := make(chan struct{}, 1)
+	hc := NewStorageHealthCheck(
+		func() error {
+			select {
+			case probed <- struct{}{}:
+			default:
+			}
+			return nil
+		},
+		HealthCheckOptions{Interval: time.Millisecond},
+		zap.NewNop(),
+		metrics.NullFactory,
+	)
+	hc.Start()
+	defer hc.Stop()
+	select {
+	case <-probed:
+	case <-time.After(time.Second):
+		t.Fatal("the storage was not probed")
+	}
+}
+
+func TestStorageHealthCheckServeHTTP(t *testing.T) {
+	hc := NewStorageHealthCheck(
+		func() error { return errors.New("unreachable") },
+		HealthCheckOptions{FailureThreshold: 1},
+		zap.NewNop(),
+		metrics.NullFactory,
+	)
+	w := httptest.NewRecorder()
+	hc.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	hc.Probe()
+	w = httptest.NewRecorder()
+	hc.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "unreachable")
+}
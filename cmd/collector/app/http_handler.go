@@ -21,16 +21,23 @@
 package app
 
 import (
+	"compress/gzip"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/apache/thrift/lib/go/thrift"
 	"github.com/gorilla/mux"
+	"github.com/uber/jaeger-lib/metrics"
+	"github.com/uber/tchannel-go"
 	tchanThrift "github.com/uber/tchannel-go/thrift"
 
+	"github.com/uber/jaeger/cmd/collector/app/zipkin"
 	tJaeger "github.com/uber/jaeger/thrift-gen/jaeger"
 	"github.com/uber/jaeger/thrift-gen/zipkincore"
 )
@@ -38,66 +45,176 @@ import (
 const (
 	formatParam               = "format"
 	unableToReadBodyErrFormat = "Unable to process request body: %v"
+
+	// DefaultZipkinPath is the default path of the endpoint accepting spans from Zipkin clients
+	DefaultZipkinPath = "/api/v2/spans"
+
+	// DefaultMaxDecompressedSize is the default size in bytes beyond which compressed request bodies are rejected
+	DefaultMaxDecompressedSize = 32 << 20
+
+	jsonContentType   = "application/json"
+	thriftContentType = "application/x-thrift"
+
+	gzipEncoding     = "gzip"
+	identityEncoding = "identity"
 )
 
+// bodyError is the error of a request body which cannot be read, and the status of the response
+type bodyError struct {
+	status int
+	err    error
+}
+
+func (e *bodyError) Error() string {
+	return e.err.Error()
+}
+
 // APIHandler handles all HTTP calls to the collector
 type APIHandler struct {
 	jaegerBatchesHandler JaegerBatchesHandler
 	zipkinSpansHandler   ZipkinSpansHandler
+	zipkinPath           string
+	jsonPath             string
+	// tenantHeader is the header carrying the tenant of the spans, passed on to the handlers
+	tenantHeader string
+	// maxDecompressedSize is the size in bytes beyond which compressed request bodies are rejected
+	maxDecompressedSize int64
+	metricsFactory      metrics.Factory
+	compressedRequests  metrics.Counter
+	plainRequests       metrics.Counter
+	malformedPayloads   metrics.Counter
+}
+
+// APIHandlerOption is a function that sets some option on the APIHandler
+type APIHandlerOption func(handler *APIHandler)
+
+// APIHandlerOptions is a factory for all available APIHandlerOptions
+var APIHandlerOptions apiHandlerOptions
+
+type apiHandlerOptions struct{}
+
+// ZipkinPath creates an APIHandlerOption that serves the endpoint accepting Zipkin v2 JSON and
+// Zipkin Thrift spans on the given path, depending on their content type. Disabled if empty.
+func (apiHandlerOptions) ZipkinPath(path string) APIHandlerOption {
+	return func(apiHandler *APIHandler) {
+		apiHandler.zipkinPath = path
+	}
+}
+
+// JSONPath creates an APIHandlerOption that serves the endpoint accepting a JSON array of spans in the JSON model
+// of the query API on the given path, for the clients which cannot emit Thrift. Disabled if empty.
+func (apiHandlerOptions) JSONPath(path string) APIHandlerOption {
+	return func(apiHandler *APIHandler) {
+		apiHandler.jsonPath = path
+	}
+}
+
+// MaxDecompressedSize creates an APIHandlerOption that rejects the gzip-compressed request bodies whose
+// decompressed size exceeds maxSize bytes, so that small compressed bodies cannot exhaust the memory of the collector
+func (apiHandlerOptions) MaxDecompressedSize(maxSize int64) APIHandlerOption {
+	return func(apiHandler *APIHandler) {
+		apiHandler.maxDecompressedSize = maxSize
+	}
+}
+
+// TenantHeader creates an APIHandlerOption that passes the given header of the requests, carrying the tenant of
+// their spans, on to the handlers as a TChannel application header in lower case
+func (apiHandlerOptions) TenantHeader(header string) APIHandlerOption {
+	return func(apiHandler *APIHandler) {
+		apiHandler.tenantHeader = header
+	}
+}
+
+// MetricsFactory creates an APIHandlerOption that reports the number of compressed and uncompressed requests,
+// and of requests with malformed payloads
+func (apiHandlerOptions) MetricsFactory(metricsFactory metrics.Factory) APIHandlerOption {
+	return func(apiHandler *APIHandler) {
+		apiHandler.metricsFactory = metricsFactory
+	}
 }
 
 // NewAPIHandler returns a new APIHandler
 func NewAPIHandler(
 	jaegerBatchesHandler JaegerBatchesHandler,
 	zipkinSpansHandler ZipkinSpansHandler,
+	options ...APIHandlerOption,
 ) *APIHandler {
-	return &APIHandler{
+	aH := &APIHandler{
 		jaegerBatchesHandler: jaegerBatchesHandler,
 		zipkinSpansHandler:   zipkinSpansHandler,
+		maxDecompressedSize:  DefaultMaxDecompressedSize,
+		metricsFactory:       metrics.NullFactory,
 	}
+	for _, option := range options {
+		option(aH)
+	}
+	aH.compressedRequests = aH.metricsFactory.Counter("http.requests", map[string]string{"encoding": gzipEncoding})
+	aH.plainRequests = aH.metricsFactory.Counter("http.requests", map[string]string{"encoding": identityEncoding})
+	aH.malformedPayloads = aH.metricsFactory.Counter("http.malformed-payloads", nil)
+	return aH
 }
 
 // RegisterRoutes registers routes for this handler on the given router
 func (aH *APIHandler) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc("/api/traces", aH.saveSpan).Methods(http.MethodPost)
+	if aH.zipkinPath != "" {
+		router.HandleFunc(aH.zipkinPath, aH.saveZipkinSpans).Methods(http.MethodPost)
+	}
+	if aH.jsonPath != "" {
+		router.HandleFunc(aH.jsonPath, aH.saveJSONSpans).Methods(http.MethodPost)
+	}
 }
 
 func (aH *APIHandler) saveSpan(w http.ResponseWriter, r *http.Request) {
-	bodyBytes, err := ioutil.ReadAll(r.Body)
-	r.Body.Close()
+	bodyBytes, err := aH.readBody(r)
 	if err != nil {
-		http.Error(w, fmt.Sprintf(unableToReadBodyErrFormat, err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf(unableToReadBodyErrFormat, err), bodyErrorStatus(err))
 		return
 	}
 
 	format := r.FormValue(formatParam)
 	switch strings.ToLower(format) {
 	case "jaeger.thrift":
-		tdes := thrift.NewTDeserializer()
 		// (NB): We decided to use this struct instead of straight batches to be as consistent with tchannel intake as possible.
-		batch := &tJaeger.Batch{}
-		if err = tdes.Read(batch, bodyBytes); err != nil {
-			http.Error(w, fmt.Sprintf(unableToReadBodyErrFormat, err), http.StatusBadRequest)
-			return
+		batch, decodeErr := deserializeJaeger(bodyBytes)
+		if decodeErr != nil {
+			aH.malformedPayloads.Inc(1)
+			if len(batch.Spans) == 0 {
+				http.Error(w, fmt.Sprintf(unableToReadBodyErrFormat, decodeErr), http.StatusBadRequest)
+				return
+			}
 		}
-		ctx, cancel := tchanThrift.NewContext(time.Minute)
+		ctx, cancel := requestContext(r, aH.tenantHeader)
 		defer cancel()
 		batches := []*tJaeger.Batch{batch}
 		if _, err = aH.jaegerBatchesHandler.SubmitBatches(ctx, batches); err != nil {
-			http.Error(w, fmt.Sprintf("Cannot submit Jaeger batch: %v", err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Cannot submit Jaeger batch: %v", err), submitErrorStatus(err))
+			return
+		}
+		if decodeErr != nil {
+			// the spans decoded before the malformed part of the payload are saved, the request is still rejected
+			http.Error(w, fmt.Sprintf(unableToReadBodyErrFormat, decodeErr), http.StatusBadRequest)
 			return
 		}
 
 	case "zipkin.thrift":
-		spans, err := deserializeZipkin(bodyBytes)
-		if err != nil {
-			http.Error(w, fmt.Sprintf(unableToReadBodyErrFormat, err), http.StatusBadRequest)
-			return
+		spans, decodeErr := deserializeZipkin(bodyBytes)
+		if decodeErr != nil {
+			aH.malformedPayloads.Inc(1)
+			if len(spans) == 0 {
+				http.Error(w, fmt.Sprintf(unableToReadBodyErrFormat, decodeErr), http.StatusBadRequest)
+				return
+			}
 		}
 
-		ctx, _ := tchanThrift.NewContext(time.Minute)
+		ctx, cancel := requestContext(r, aH.tenantHeader)
+		defer cancel()
 		if _, err = aH.zipkinSpansHandler.SubmitZipkinBatch(ctx, spans); err != nil {
-			http.Error(w, fmt.Sprintf("Cannot submit Zipkin batch: %v", err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Cannot submit Zipkin batch: %v", err), submitErrorStatus(err))
+			return
+		}
+		if decodeErr != nil {
+			http.Error(w, fmt.Sprintf(unableToReadBodyErrFormat, decodeErr), http.StatusBadRequest)
 			return
 		}
 
@@ -109,7 +226,177 @@ func (aH *APIHandler) saveSpan(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func deserializeZipkin(b []byte) ([]*zipkincore.Span, error) {
+// saveZipkinSpans accepts spans in the Zipkin v2 JSON format, or in the Zipkin Thrift format like Zipkin's
+// v1 endpoint, so that clients using either version can report to the same collector.
+func (aH *APIHandler) saveZipkinSpans(w http.ResponseWriter, r *http.Request) {
+	bodyBytes, err := aH.readBody(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(unableToReadBodyErrFormat, err), bodyErrorStatus(err))
+		return
+	}
+
+	contentType := jsonContentType
+	if header := r.Header.Get("Content-Type"); header != "" {
+		if contentType, _, err = mime.ParseMediaType(header); err != nil {
+			http.Error(w, fmt.Sprintf("Cannot parse content type: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	var spans []*zipkincore.Span
+	var decodeErr error
+	switch contentType {
+	case jsonContentType:
+		spans, err = zipkin.DeserializeJSONV2(bodyBytes)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(unableToReadBodyErrFormat, err), http.StatusBadRequest)
+			return
+		}
+	case thriftContentType:
+		spans, decodeErr = deserializeZipkin(bodyBytes)
+		if decodeErr != nil {
+			aH.malformedPayloads.Inc(1)
+			if len(spans) == 0 {
+				http.Error(w, fmt.Sprintf(unableToReadBodyErrFormat, decodeErr), http.StatusBadRequest)
+				return
+			}
+		}
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported content type: %v", contentType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	ctx, cancel := requestContext(r, aH.tenantHeader)
+	defer cancel()
+	if _, err = aH.zipkinSpansHandler.SubmitZipkinBatch(ctx, spans); err != nil {
+		http.Error(w, fmt.Sprintf("Cannot submit Zipkin batch: %v", err), submitErrorStatus(err))
+		return
+	}
+	if decodeErr != nil {
+		http.Error(w, fmt.Sprintf(unableToReadBodyErrFormat, decodeErr), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// saveJSONSpans accepts spans in the JSON model of the query API, whatever the content type of the request so that
+// the spans can be posted by shell scripts without setting it. The malformed payloads are rejected as a whole.
+func (aH *APIHandler) saveJSONSpans(w http.ResponseWriter, r *http.Request) {
+	bodyBytes, err := aH.readBody(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(unableToReadBodyErrFormat, err), bodyErrorStatus(err))
+		return
+	}
+	batches, err := DeserializeJSONSpans(bodyBytes)
+	if err != nil {
+		aH.malformedPayloads.Inc(1)
+		http.Error(w, fmt.Sprintf(unableToReadBodyErrFormat, err), http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := requestContext(r, aH.tenantHeader)
+	defer cancel()
+	if _, err = aH.jaegerBatchesHandler.SubmitBatches(ctx, batches); err != nil {
+		http.Error(w, fmt.Sprintf("Cannot submit JSON spans: %v", err), submitErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// readBody reads the request body, decompressing it if its Content-Encoding is gzip
+func (aH *APIHandler) readBody(r *http.Request) ([]byte, error) {
+	return readRequestBody(r, aH.maxDecompressedSize, aH.plainRequests, aH.compressedRequests)
+}
+
+// readRequestBody reads the request body, decompressing it up to maxDecompressedSize bytes if its
+// Content-Encoding is gzip, and counts the request in the counter of its encoding
+func readRequestBody(r *http.Request, maxDecompressedSize int64, plainRequests, compressedRequests metrics.Counter) ([]byte, error) {
+	defer r.Body.Close()
+	switch encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding {
+	case "", identityEncoding:
+		plainRequests.Inc(1)
+		return ioutil.ReadAll(r.Body)
+	case gzipEncoding:
+		compressedRequests.Inc(1)
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, &bodyError{status: http.StatusBadRequest, err: err}
+		}
+		defer reader.Close()
+		// read one more byte than allowed to tell bodies of exactly the maximum size from larger ones
+		body, err := ioutil.ReadAll(io.LimitReader(reader, maxDecompressedSize+1))
+		if err != nil {
+			return nil, &bodyError{status: http.StatusBadRequest, err: err}
+		}
+		if int64(len(body)) > maxDecompressedSize {
+			return nil, &bodyError{
+				status: http.StatusRequestEntityTooLarge,
+				err:    fmt.Errorf("decompressed body exceeds %d bytes", maxDecompressedSize),
+			}
+		}
+		return body, nil
+	default:
+		return nil, &bodyError{
+			status: http.StatusUnsupportedMediaType,
+			err:    fmt.Errorf("unsupported content encoding %q", encoding),
+		}
+	}
+}
+
+func bodyErrorStatus(err error) int {
+	if bodyErr, ok := err.(*bodyError); ok {
+		return bodyErr.status
+	}
+	return http.StatusInternalServerError
+}
+
+// requestContext returns the context spans of the request are submitted with, carrying the
+// Authorization header and the verified TLS client certificates of the request for the Authenticator,
+// and the tenant header, in lower case, for the TenantResolver.
+func requestContext(r *http.Request, tenantHeader string) (tchanThrift.Context, func()) {
+	ctx, cancel := tchanThrift.NewContext(time.Minute)
+	var base context.Context = ctx
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		base = WithVerifiedChains(base, r.TLS.VerifiedChains)
+	}
+	headers := make(map[string]string)
+	if authorization := r.Header.Get(AuthorizationHeader); authorization != "" {
+		headers[AuthorizationHeader] = authorization
+	}
+	if tenantHeader != "" {
+		if tenant := r.Header.Get(tenantHeader); tenant != "" {
+			headers[strings.ToLower(tenantHeader)] = tenant
+		}
+	}
+	return tchanThrift.WithHeaders(base, headers), cancel
+}
+
+func submitErrorStatus(err error) int {
+	if _, ok := err.(*AuthError); ok {
+		return http.StatusUnauthorized
+	}
+	if err == tchannel.ErrServerBusy {
+		// the collector queue is beyond its high-water mark or full, the client should retry later
+		return http.StatusTooManyRequests
+	}
+	if tchannel.GetSystemErrorCode(err) == tchannel.ErrCodeBadRequest {
+		// some spans were malformed, the others were saved
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// deserializeJaeger decodes a batch in Jaeger Thrift format. On error, including a panic of the decoder,
+// the batch holds the process and the spans decoded before the malformed part of the payload.
+func deserializeJaeger(b []byte) (batch *tJaeger.Batch, err error) {
+	batch = &tJaeger.Batch{}
+	defer recoverMalformed(&err)
+	err = thrift.NewTDeserializer().Read(batch, b)
+	return batch, err
+}
+
+// deserializeZipkin decodes a list of spans in Zipkin Thrift format. On error, including a panic of the
+// decoder, the spans decoded before the malformed one are returned.
+func deserializeZipkin(b []byte) (spans []*zipkincore.Span, err error) {
+	defer recoverMalformed(&err)
 	buffer := thrift.NewTMemoryBuffer()
 	buffer.Write(b)
 
@@ -121,11 +408,10 @@ func deserializeZipkin(b []byte) ([]*zipkincore.Span, error) {
 
 	// We don't depend on the size returned by ReadListBegin to preallocate the array because it
 	// sometimes returns a nil error on bad input and provides an unreasonably large int for size
-	var spans []*zipkincore.Span
 	for i := 0; i < size; i++ {
 		zs := &zipkincore.Span{}
 		if err = zs.Read(transport); err != nil {
-			return nil, err
+			return spans, err
 		}
 		spans = append(spans, zs)
 	}
@@ -22,6 +22,7 @@ package app
 
 import (
 	"bytes"
+	"compress/gzip"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -37,6 +38,8 @@ import (
 	jaegerClient "github.com/uber/jaeger-client-go"
 	"github.com/uber/jaeger-client-go/transport"
 	zipkinTransport "github.com/uber/jaeger-client-go/transport/zipkin"
+	"github.com/uber/jaeger-lib/metrics"
+	"github.com/uber/tchannel-go"
 	tchanThrift "github.com/uber/tchannel-go/thrift"
 
 	"github.com/uber/jaeger/thrift-gen/jaeger"
@@ -118,6 +121,66 @@ func TestJaegerFormat(t *testing.T) {
 	assert.EqualValues(t, "Cannot submit Jaeger batch: Bad times ahead\n", resBodyStr)
 }
 
+func TestJaegerFormatBusy(t *testing.T) {
+	server, handler := initializeTestServer(tchannel.ErrServerBusy)
+	defer server.Close()
+	someBytes, err := thrift.NewTSerializer().Write(&jaeger.Batch{Process: &jaeger.Process{ServiceName: "svc"}})
+	require.NoError(t, err)
+
+	statusCode, _, err := postBytes(server.URL+`/api/traces?format=jaeger.thrift`, someBytes)
+	assert.NoError(t, err)
+	assert.EqualValues(t, http.StatusTooManyRequests, statusCode)
+	assert.Len(t, handler.jaegerBatchesHandler.(*mockJaegerHandler).getBatches(), 1)
+}
+
+func TestAuthenticatedFormats(t *testing.T) {
+	authenticator := NewAuthenticator(
+		AuthOptions{TokenValidator: NewStaticTokenValidator([]string{"secret"})},
+		metrics.NullFactory,
+	)
+	jHandler := &mockJaegerHandler{}
+	zHandler := &mockZipkinHandler{}
+	r := mux.NewRouter()
+	NewAPIHandler(
+		authenticator.JaegerBatchesHandler(jHandler),
+		authenticator.ZipkinSpansHandler(zHandler),
+		APIHandlerOptions.ZipkinPath(DefaultZipkinPath),
+	).RegisterRoutes(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	batchBytes, err := thrift.NewTSerializer().Write(&jaeger.Batch{Process: &jaeger.Process{ServiceName: "svc"}})
+	require.NoError(t, err)
+	zipkinBytes := zipkinSerialize([]*zipkincore.Span{{}})
+	testCases := []struct {
+		url            string
+		body           []byte
+		authorization  string
+		expectedStatus int
+	}{
+		{url: "/api/traces?format=jaeger.thrift", body: batchBytes, expectedStatus: http.StatusUnauthorized},
+		{url: "/api/traces?format=jaeger.thrift", body: batchBytes, authorization: "Bearer wrong", expectedStatus: http.StatusUnauthorized},
+		{url: "/api/traces?format=jaeger.thrift", body: batchBytes, authorization: "Bearer secret", expectedStatus: http.StatusOK},
+		{url: "/api/traces?format=zipkin.thrift", body: zipkinBytes, expectedStatus: http.StatusUnauthorized},
+		{url: "/api/traces?format=zipkin.thrift", body: zipkinBytes, authorization: "Bearer secret", expectedStatus: http.StatusOK},
+		{url: DefaultZipkinPath, body: []byte("[]"), expectedStatus: http.StatusUnauthorized},
+		{url: DefaultZipkinPath, body: []byte("[]"), authorization: "Bearer secret", expectedStatus: http.StatusAccepted},
+	}
+	for _, testCase := range testCases {
+		req, err := http.NewRequest(http.MethodPost, server.URL+testCase.url, bytes.NewReader(testCase.body))
+		require.NoError(t, err)
+		if testCase.authorization != "" {
+			req.Header.Set("Authorization", testCase.authorization)
+		}
+		res, err := httpClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, testCase.expectedStatus, res.StatusCode, "%s with %q", testCase.url, testCase.authorization)
+	}
+	assert.Len(t, jHandler.getBatches(), 1)
+	assert.Len(t, zHandler.getSpans(), 1)
+}
+
 func TestFormatsViaClient(t *testing.T) {
 	server, handler := initializeTestServer(nil)
 	defer server.Close()
@@ -183,6 +246,77 @@ func TestFormatsViaClient(t *testing.T) {
 	}
 }
 
+func gzipBytes(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	_, err := writer.Write(b)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func TestGzipEncoding(t *testing.T) {
+	batchBytes, err := thrift.NewTSerializer().Write(&jaeger.Batch{Process: &jaeger.Process{ServiceName: "svc"}})
+	require.NoError(t, err)
+	metricsFactory := metrics.NewLocalFactory(0)
+	jHandler := &mockJaegerHandler{}
+	r := mux.NewRouter()
+	NewAPIHandler(
+		jHandler,
+		&mockZipkinHandler{},
+		APIHandlerOptions.MaxDecompressedSize(int64(len(batchBytes))),
+		APIHandlerOptions.MetricsFactory(metricsFactory),
+	).RegisterRoutes(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	testCases := []struct {
+		body           []byte
+		encoding       string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{body: batchBytes, expectedStatus: http.StatusOK},
+		{body: gzipBytes(t, batchBytes), encoding: "gzip", expectedStatus: http.StatusOK},
+		{
+			body:           gzipBytes(t, append(batchBytes, 0)),
+			encoding:       "gzip",
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedBody:   fmt.Sprintf("Unable to process request body: decompressed body exceeds %d bytes\n", len(batchBytes)),
+		},
+		{
+			body:           batchBytes,
+			encoding:       "gzip",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Unable to process request body: gzip: invalid header\n",
+		},
+		{
+			body:           batchBytes,
+			encoding:       "br",
+			expectedStatus: http.StatusUnsupportedMediaType,
+			expectedBody:   "Unable to process request body: unsupported content encoding \"br\"\n",
+		},
+	}
+	for _, testCase := range testCases {
+		req, err := http.NewRequest(http.MethodPost, server.URL+`/api/traces?format=jaeger.thrift`, bytes.NewReader(testCase.body))
+		require.NoError(t, err)
+		if testCase.encoding != "" {
+			req.Header.Set("Content-Encoding", testCase.encoding)
+		}
+		res, err := httpClient.Do(req)
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, testCase.expectedStatus, res.StatusCode, "encoding %q", testCase.encoding)
+		assert.Equal(t, testCase.expectedBody, string(body), "encoding %q", testCase.encoding)
+	}
+	assert.Len(t, jHandler.getBatches(), 2)
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 3, counters["http.requests|encoding=gzip"])
+	assert.EqualValues(t, 1, counters["http.requests|encoding=identity"])
+}
+
 func TestJaegerFormatBadBody(t *testing.T) {
 	server, _ := initializeTestServer(nil)
 	defer server.Close()
@@ -283,6 +417,121 @@ func TestZipkinFormat(t *testing.T) {
 	assert.EqualValues(t, "Cannot submit Zipkin batch: Bad times ahead\n", resBodyStr)
 }
 
+func postZipkin(urlStr, contentType string, bodyBytes []byte) (int, string, error) {
+	req, err := http.NewRequest(http.MethodPost, urlStr, bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		return 0, "", err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	return res.StatusCode, string(body), err
+}
+
+func TestZipkinEndpoint(t *testing.T) {
+	zipkinHandler := &mockZipkinHandler{}
+	r := mux.NewRouter()
+	NewAPIHandler(&mockJaegerHandler{}, zipkinHandler, APIHandlerOptions.ZipkinPath(DefaultZipkinPath)).RegisterRoutes(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+	url := server.URL + DefaultZipkinPath
+
+	v2Body := []byte(`[{"traceId": "a", "id": "b", "kind": "SERVER", "timestamp": 1000, "localEndpoint": {"serviceName": "svc"}}]`)
+	testCases := []struct {
+		contentType string
+		body        []byte
+		statusCode  int
+		response    string
+	}{
+		{contentType: "application/json", body: v2Body, statusCode: http.StatusAccepted},
+		{contentType: "application/json; charset=utf-8", body: v2Body, statusCode: http.StatusAccepted},
+		{contentType: "", body: v2Body, statusCode: http.StatusAccepted},
+		{contentType: "application/x-thrift", body: zipkinSerialize([]*zipkincore.Span{{ID: 1}}), statusCode: http.StatusAccepted},
+		{contentType: "application/json", body: []byte("not good"), statusCode: http.StatusBadRequest,
+			response: "Unable to process request body: invalid character 'o' in literal null (expecting 'u')\n"},
+		{contentType: "text/plain", body: v2Body, statusCode: http.StatusUnsupportedMediaType,
+			response: "Unsupported content type: text/plain\n"},
+		{contentType: "application/json; =", body: v2Body, statusCode: http.StatusBadRequest,
+			response: "Cannot parse content type: mime: invalid media parameter\n"},
+	}
+	for _, testCase := range testCases {
+		statusCode, resBodyStr, err := postZipkin(url, testCase.contentType, testCase.body)
+		require.NoError(t, err)
+		assert.EqualValues(t, testCase.statusCode, statusCode, testCase.contentType)
+		assert.Equal(t, testCase.response, resBodyStr, testCase.contentType)
+	}
+	spans := zipkinHandler.getSpans()
+	require.Len(t, spans, 4)
+	assert.EqualValues(t, 11, spans[0].ID)
+	assert.Equal(t, zipkincore.SERVER_RECV, spans[0].Annotations[0].Value)
+	assert.EqualValues(t, 1, spans[3].ID)
+
+	zipkinHandler.err = fmt.Errorf("Bad times ahead")
+	statusCode, resBodyStr, err := postZipkin(url, "application/json", v2Body)
+	require.NoError(t, err)
+	assert.EqualValues(t, http.StatusInternalServerError, statusCode)
+	assert.Equal(t, "Cannot submit Zipkin batch: Bad times ahead\n", resBodyStr)
+}
+
+func TestZipkinEndpointDisabled(t *testing.T) {
+	server, _ := initializeTestServer(nil)
+	defer server.Close()
+	statusCode, _, err := postZipkin(server.URL+DefaultZipkinPath, "application/json", []byte("[]"))
+	require.NoError(t, err)
+	assert.EqualValues(t, http.StatusNotFound, statusCode)
+}
+
+func TestJSONEndpoint(t *testing.T) {
+	jaegerHandler := &mockJaegerHandler{}
+	metricsFactory := metrics.NewLocalFactory(0)
+	r := mux.NewRouter()
+	NewAPIHandler(
+		jaegerHandler,
+		&mockZipkinHandler{},
+		APIHandlerOptions.JSONPath("/api/v1/spans"),
+		APIHandlerOptions.MetricsFactory(metricsFactory),
+	).RegisterRoutes(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+	url := server.URL + "/api/v1/spans"
+
+	body := []byte(`[{"traceID": "a", "spanID": "b", "operationName": "backup", "process": {"serviceName": "cron"}}]`)
+	statusCode, resBodyStr, err := postZipkin(url, "", body)
+	require.NoError(t, err)
+	assert.EqualValues(t, http.StatusAccepted, statusCode)
+	assert.Equal(t, "", resBodyStr)
+	batches := jaegerHandler.getBatches()
+	require.Len(t, batches, 1)
+	assert.Equal(t, "cron", batches[0].Process.ServiceName)
+	require.Len(t, batches[0].Spans, 1)
+	assert.EqualValues(t, 0xb, batches[0].Spans[0].SpanId)
+
+	statusCode, resBodyStr, err = postZipkin(url, "application/json", []byte(`[{"traceID": "a", "spanID": "b"}]`))
+	require.NoError(t, err)
+	assert.EqualValues(t, http.StatusBadRequest, statusCode)
+	assert.Equal(t, "Unable to process request body: span 0: process with a serviceName is required\n", resBodyStr)
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counters["http.malformed-payloads"])
+	assert.Len(t, jaegerHandler.getBatches(), 1)
+
+	jaegerHandler.err = tchannel.ErrServerBusy
+	statusCode, _, err = postZipkin(url, "application/json", body)
+	require.NoError(t, err)
+	assert.EqualValues(t, http.StatusTooManyRequests, statusCode)
+
+	server, _ = initializeTestServer(nil)
+	defer server.Close()
+	statusCode, _, err = postZipkin(server.URL+"/api/v1/spans", "application/json", body)
+	require.NoError(t, err)
+	assert.EqualValues(t, http.StatusNotFound, statusCode, "disabled by default")
+}
+
 func zipkinSerialize(spans []*zipkincore.Span) []byte {
 	t := thrift.NewTMemoryBuffer()
 	p := thrift.NewTBinaryProtocolTransport(t)
@@ -304,6 +553,61 @@ func TestZipkinFormatBadBody(t *testing.T) {
 	assert.EqualValues(t, "Unable to process request body: *zipkincore.Span field 0 read error: EOF\n", resBodyStr)
 }
 
+func TestPartiallyMalformedThriftPayloads(t *testing.T) {
+	batchBytes, err := thrift.NewTSerializer().Write(&jaeger.Batch{
+		Process: &jaeger.Process{ServiceName: "svc"},
+		Spans:   []*jaeger.Span{{SpanId: 1}, {SpanId: 2}},
+	})
+	require.NoError(t, err)
+	zipkinBytes := zipkinSerialize([]*zipkincore.Span{{ID: 1}, {ID: 2}})
+	metricsFactory := metrics.NewLocalFactory(0)
+	jHandler := &mockJaegerHandler{}
+	zHandler := &mockZipkinHandler{}
+	r := mux.NewRouter()
+	handler := NewAPIHandler(jHandler, zHandler,
+		APIHandlerOptions.ZipkinPath(DefaultZipkinPath),
+		APIHandlerOptions.MetricsFactory(metricsFactory))
+	handler.RegisterRoutes(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	// the trailing bytes of the last span are cut off
+	statusCode, _, err := postBytes(server.URL+`/api/traces?format=jaeger.thrift`, batchBytes[:len(batchBytes)-2])
+	require.NoError(t, err)
+	assert.EqualValues(t, http.StatusBadRequest, statusCode)
+	require.Len(t, jHandler.getBatches(), 1)
+	require.Len(t, jHandler.getBatches()[0].Spans, 1)
+	assert.EqualValues(t, 1, jHandler.getBatches()[0].Spans[0].SpanId)
+
+	statusCode, _, err = postBytes(server.URL+`/api/traces?format=zipkin.thrift`, zipkinBytes[:len(zipkinBytes)-1])
+	require.NoError(t, err)
+	assert.EqualValues(t, http.StatusBadRequest, statusCode)
+	require.Len(t, zHandler.getSpans(), 1)
+	assert.EqualValues(t, 1, zHandler.getSpans()[0].ID)
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+DefaultZipkinPath, bytes.NewReader(zipkinBytes[:len(zipkinBytes)-1]))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", thriftContentType)
+	res, err := httpClient.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.EqualValues(t, http.StatusBadRequest, res.StatusCode)
+	assert.Len(t, zHandler.getSpans(), 2)
+
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 3, counters["http.malformed-payloads"])
+}
+
+func TestMalformedSpansStatus(t *testing.T) {
+	server, _ := initializeTestServer(malformedSpansError(1, JaegerFormatType))
+	defer server.Close()
+	batchBytes, err := thrift.NewTSerializer().Write(&jaeger.Batch{Process: &jaeger.Process{ServiceName: "svc"}})
+	require.NoError(t, err)
+	statusCode, _, err := postBytes(server.URL+`/api/traces?format=jaeger.thrift`, batchBytes)
+	require.NoError(t, err)
+	assert.EqualValues(t, http.StatusBadRequest, statusCode)
+}
+
 func TestDeserializeZipkinWithBadListStart(t *testing.T) {
 	span := &zipkincore.Span{TraceID: 12, Name: "test"}
 	spans := []*zipkincore.Span{}
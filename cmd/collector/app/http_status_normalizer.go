@@ -0,0 +1,188 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+const (
+	// HTTPStatusCodeKey is the key of the canonical integer tag of the HTTP status code of the spans
+	HTTPStatusCodeKey = "http.status_code"
+	// errorKey is the key of the boolean tag marking the spans as failed
+	errorKey = "error"
+)
+
+// HTTPStatusRule selects the span tags the HTTP status code is read from
+type HTTPStatusRule struct {
+	// SourceKeys are the keys of the tags holding the status code as an integer or a string, e.g. "503" or
+	// "503 Service Unavailable", the first one found being used when the canonical tag is missing
+	SourceKeys []string `json:"source_keys"`
+}
+
+// HTTPStatusRules select the tags the HTTP status code of the spans is read from, by default and for some services
+type HTTPStatusRules struct {
+	// Default is the rule of the services without their own rule
+	Default HTTPStatusRule `json:"default"`
+	// Services are the rules overriding the default rule, keyed by service name
+	Services map[string]HTTPStatusRule `json:"services"`
+}
+
+// LoadHTTPStatusRules reads HTTPStatusRules encoded as JSON
+func LoadHTTPStatusRules(r io.Reader) (HTTPStatusRules, error) {
+	var rules HTTPStatusRules
+	err := json.NewDecoder(r).Decode(&rules)
+	return rules, err
+}
+
+// HTTPStatusNormalizer consolidates the HTTP status codes of the spans into the integer http.status_code tag,
+// and tags the spans of 5xx responses with error=true
+type HTTPStatusNormalizer struct {
+	sync.RWMutex
+	rules      HTTPStatusRules
+	normalized metrics.Counter
+	invalid    metrics.Counter
+	errors     metrics.Counter
+}
+
+// NewHTTPStatusNormalizer creates a HTTPStatusNormalizer that counts the spans it normalizes in the given metrics
+// factory
+func NewHTTPStatusNormalizer(rules HTTPStatusRules, metricsFactory metrics.Factory) *HTTPStatusNormalizer {
+	return &HTTPStatusNormalizer{
+		rules:      rules,
+		normalized: metricsFactory.Counter("tags.http-status-normalized", nil),
+		invalid:    metricsFactory.Counter("tags.http-status-invalid", nil),
+		errors:     metricsFactory.Counter("tags.http-status-errors", nil),
+	}
+}
+
+// Update replaces the rules, spans normalized from then on use the new rules
+func (n *HTTPStatusNormalizer) Update(rules HTTPStatusRules) {
+	n.Lock()
+	defer n.Unlock()
+	n.rules = rules
+}
+
+// NormalizeSpans replaces the status code tags of the spans with the canonical one, it can be used as a
+// ProcessSpans. The spans whose status code cannot be parsed as one between 100 and 599 are left as they are.
+func (n *HTTPStatusNormalizer) NormalizeSpans(spans []*model.Span) {
+	n.RLock()
+	defer n.RUnlock()
+	for _, span := range spans {
+		rule := n.rules.Default
+		if span.Process != nil {
+			if serviceRule, ok := n.rules.Services[span.Process.ServiceName]; ok {
+				rule = serviceRule
+			}
+		}
+		n.normalize(span, rule)
+	}
+}
+
+func (n *HTTPStatusNormalizer) normalize(span *model.Span, rule HTTPStatusRule) {
+	tag, ok := findHTTPStatus(span.Tags, rule.SourceKeys)
+	if !ok {
+		return
+	}
+	statusCode, ok := parseHTTPStatus(tag)
+	if !ok {
+		n.invalid.Inc(1)
+		return
+	}
+	tags := span.Tags[:0]
+	for _, kv := range span.Tags {
+		if kv.Key != HTTPStatusCodeKey && !containsString(rule.SourceKeys, kv.Key) {
+			tags = append(tags, kv)
+		}
+	}
+	span.Tags = append(tags, model.Int64(HTTPStatusCodeKey, statusCode))
+	n.normalized.Inc(1)
+	if statusCode >= 500 {
+		markError(span)
+		n.errors.Inc(1)
+	}
+}
+
+// findHTTPStatus returns the canonical status code tag, or else the tag of the first source key found
+func findHTTPStatus(tags model.KeyValues, sourceKeys []string) (model.KeyValue, bool) {
+	if tag, ok := tags.FindByKey(HTTPStatusCodeKey); ok {
+		return tag, true
+	}
+	for _, key := range sourceKeys {
+		if tag, ok := tags.FindByKey(key); ok {
+			return tag, true
+		}
+	}
+	return model.KeyValue{}, false
+}
+
+func parseHTTPStatus(tag model.KeyValue) (int64, bool) {
+	var statusCode int64
+	switch tag.VType {
+	case model.Int64Type:
+		statusCode = tag.Int64()
+	case model.Float64Type:
+		statusCode = int64(tag.Float64())
+		if float64(statusCode) != tag.Float64() {
+			return 0, false
+		}
+	case model.StringType:
+		fields := strings.Fields(tag.VStr)
+		if len(fields) == 0 {
+			return 0, false
+		}
+		var err error
+		if statusCode, err = strconv.ParseInt(fields[0], 10, 64); err != nil {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+	return statusCode, statusCode >= 100 && statusCode <= 599
+}
+
+// markError replaces the error tag of the span, whatever its type, with error=true
+func markError(span *model.Span) {
+	for i := range span.Tags {
+		if span.Tags[i].Key == errorKey {
+			span.Tags[i] = model.Bool(errorKey, true)
+			return
+		}
+	}
+	span.Tags = append(span.Tags, model.Bool(errorKey, true))
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
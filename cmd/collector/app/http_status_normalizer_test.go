@@ -0,0 +1,128 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+	metricsTest "github.com/uber/jaeger-lib/metrics/testutils"
+
+	"github.com/uber/jaeger/model"
+)
+
+func TestLoadHTTPStatusRules(t *testing.T) {
+	rules, err := LoadHTTPStatusRules(strings.NewReader(`{
+		"default": {"source_keys": ["status_code"]},
+		"services": {"legacy": {"source_keys": ["http.status"]}}
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, HTTPStatusRules{
+		Default:  HTTPStatusRule{SourceKeys: []string{"status_code"}},
+		Services: map[string]HTTPStatusRule{"legacy": {SourceKeys: []string{"http.status"}}},
+	}, rules)
+
+	_, err = LoadHTTPStatusRules(strings.NewReader(`{"default": []}`))
+	assert.Error(t, err)
+}
+
+func TestHTTPStatusNormalizer(t *testing.T) {
+	testCases := []struct {
+		service  string
+		tags     model.KeyValues
+		expected model.KeyValues
+	}{
+		{
+			service:  "svc",
+			tags:     model.KeyValues{model.String("status_code", "200"), model.String("span.kind", "server")},
+			expected: model.KeyValues{model.String("span.kind", "server"), model.Int64(HTTPStatusCodeKey, 200)},
+		},
+		{
+			service:  "svc",
+			tags:     model.KeyValues{model.String("status_code", "503 Service Unavailable")},
+			expected: model.KeyValues{model.Int64(HTTPStatusCodeKey, 503), model.Bool("error", true)},
+		},
+		{
+			service: "svc",
+			tags:    model.KeyValues{model.String("error", "false"), model.Float64(HTTPStatusCodeKey, 500)},
+			expected: model.KeyValues{
+				model.Bool("error", true),
+				model.Int64(HTTPStatusCodeKey, 500),
+			},
+		},
+		{
+			// the canonical tag takes precedence over the source keys, which are removed
+			service:  "svc",
+			tags:     model.KeyValues{model.Int64("status_code", 500), model.String(HTTPStatusCodeKey, "404")},
+			expected: model.KeyValues{model.Int64(HTTPStatusCodeKey, 404)},
+		},
+		{
+			service:  "svc",
+			tags:     model.KeyValues{model.String("status_code", "OK")},
+			expected: model.KeyValues{model.String("status_code", "OK")},
+		},
+		{
+			service:  "svc",
+			tags:     model.KeyValues{model.Int64("status_code", 42)},
+			expected: model.KeyValues{model.Int64("status_code", 42)},
+		},
+		{
+			// the rule of the service overrides the default one
+			service:  "legacy",
+			tags:     model.KeyValues{model.Int64("status_code", 200), model.Int64("http.status", 502)},
+			expected: model.KeyValues{model.Int64("status_code", 200), model.Int64(HTTPStatusCodeKey, 502), model.Bool("error", true)},
+		},
+		{
+			service:  "svc",
+			tags:     model.KeyValues{model.String("span.kind", "client")},
+			expected: model.KeyValues{model.String("span.kind", "client")},
+		},
+	}
+	mb := metrics.NewLocalFactory(0)
+	normalizer := NewHTTPStatusNormalizer(HTTPStatusRules{
+		Default:  HTTPStatusRule{SourceKeys: []string{"status_code"}},
+		Services: map[string]HTTPStatusRule{"legacy": {SourceKeys: []string{"http.status"}}},
+	}, mb)
+	for i, testCase := range testCases {
+		span := &model.Span{Tags: testCase.tags, Process: &model.Process{ServiceName: testCase.service}}
+		normalizer.NormalizeSpans([]*model.Span{span})
+		assert.Equal(t, testCase.expected, span.Tags, "test case %d", i)
+	}
+	metricsTest.AssertCounterMetrics(t, mb,
+		metricsTest.ExpectedMetric{Name: "tags.http-status-normalized", Value: 5},
+		metricsTest.ExpectedMetric{Name: "tags.http-status-invalid", Value: 2},
+		metricsTest.ExpectedMetric{Name: "tags.http-status-errors", Value: 3},
+	)
+}
+
+func TestHTTPStatusNormalizerUpdate(t *testing.T) {
+	normalizer := NewHTTPStatusNormalizer(HTTPStatusRules{}, metrics.NullFactory)
+	span := &model.Span{Tags: model.KeyValues{model.Int64("status", 200)}}
+	normalizer.NormalizeSpans([]*model.Span{span})
+	assert.Equal(t, model.KeyValues{model.Int64("status", 200)}, span.Tags)
+
+	normalizer.Update(HTTPStatusRules{Default: HTTPStatusRule{SourceKeys: []string{"status"}}})
+	normalizer.NormalizeSpans([]*model.Span{span})
+	assert.Equal(t, model.KeyValues{model.Int64(HTTPStatusCodeKey, 200)}, span.Tags)
+}
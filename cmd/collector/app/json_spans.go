@@ -0,0 +1,135 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/uber/jaeger/model"
+	uiconv "github.com/uber/jaeger/model/converter/json"
+	jConv "github.com/uber/jaeger/model/converter/thrift/jaeger"
+	ui "github.com/uber/jaeger/model/json"
+	tJaeger "github.com/uber/jaeger/thrift-gen/jaeger"
+)
+
+var errJSONSpanIDsRequired = errors.New("traceID and spanID are required")
+var errJSONProcessRequired = errors.New("process with a serviceName is required")
+
+// DeserializeJSONSpans decodes a JSON array of spans in the JSON model of the query API, each carrying its
+// process, for the clients which cannot emit Thrift, e.g.
+//
+//	[{"traceID": "5af7183fb1d4cf5f", "spanID": "6b2e3e4a6a1d4b8c", "operationName": "backup",
+//	  "startTime": 1500000000000000, "duration": 1500000, "tags": [{"key": "exit.code", "value": 0}],
+//	  "process": {"serviceName": "cron", "tags": [{"key": "hostname", "value": "db-1"}]}}]
+//
+// The parent span ID and the types of the tags are optional, a missing type being inferred from the JSON value.
+// The spans are converted to the domain model, then grouped into Jaeger Thrift batches by process so that they
+// go through the same handlers as the Thrift spans. A malformed span fails the whole payload.
+func DeserializeJSONSpans(b []byte) ([]*tJaeger.Batch, error) {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	var jSpans []ui.Span
+	if err := decoder.Decode(&jSpans); err != nil {
+		return nil, err
+	}
+	var batches []*tJaeger.Batch
+	var processes []*model.Process
+	for i := range jSpans {
+		span, err := jsonToDomainSpan(&jSpans[i])
+		if err != nil {
+			return nil, fmt.Errorf("span %d: %v", i, err)
+		}
+		batch := -1
+		for j, process := range processes {
+			if process.Equal(span.Process) {
+				batch = j
+				break
+			}
+		}
+		if batch < 0 {
+			batch = len(batches)
+			processes = append(processes, span.Process)
+			batches = append(batches, &tJaeger.Batch{Process: jConv.FromDomainProcess(span.Process)})
+		}
+		batches[batch].Spans = append(batches[batch].Spans, jConv.FromDomainSpan(span))
+	}
+	return batches, nil
+}
+
+// jsonToDomainSpan converts a JSON span, returning an error instead of panicking on a malformed span
+func jsonToDomainSpan(span *ui.Span) (mSpan *model.Span, err error) {
+	defer recoverMalformed(&err)
+	if span.TraceID == "" || span.SpanID == "" {
+		return nil, errJSONSpanIDsRequired
+	}
+	if span.Process == nil || span.Process.ServiceName == "" {
+		return nil, errJSONProcessRequired
+	}
+	if span.ParentSpanID == "" {
+		span.ParentSpanID = "0"
+	}
+	if err := normalizeJSONKeyValues(span.Tags); err != nil {
+		return nil, err
+	}
+	for _, log := range span.Logs {
+		if err := normalizeJSONKeyValues(log.Fields); err != nil {
+			return nil, err
+		}
+	}
+	if err := normalizeJSONKeyValues(span.Process.Tags); err != nil {
+		return nil, err
+	}
+	return uiconv.SpanToDomain(span)
+}
+
+// normalizeJSONKeyValues turns the values of the tags into the strings expected by the converter, inferring
+// the missing types from the JSON values
+func normalizeJSONKeyValues(kvs []ui.KeyValue) error {
+	for i := range kvs {
+		kv := &kvs[i]
+		switch value := kv.Value.(type) {
+		case string:
+			if kv.Type == "" {
+				kv.Type = ui.StringType
+			}
+		case bool:
+			if kv.Type == "" {
+				kv.Type = ui.BoolType
+			}
+			kv.Value = strconv.FormatBool(value)
+		case json.Number:
+			if kv.Type == "" {
+				kv.Type = ui.Float64Type
+				if _, err := value.Int64(); err == nil {
+					kv.Type = ui.Int64Type
+				}
+			}
+			kv.Value = value.String()
+		default:
+			return fmt.Errorf("value of tag %q must be a string, a number or a boolean", kv.Key)
+		}
+	}
+	return nil
+}
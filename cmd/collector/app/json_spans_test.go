@@ -0,0 +1,130 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/jaeger/thrift-gen/jaeger"
+)
+
+func TestDeserializeJSONSpans(t *testing.T) {
+	batches, err := DeserializeJSONSpans([]byte(`[
+		{
+			"traceID": "5af7183fb1d4cf5f", "spanID": "6b2e3e4a6a1d4b8c", "operationName": "backup",
+			"startTime": 1500000000000000, "duration": 1500000,
+			"tags": [
+				{"key": "exit.code", "value": 0},
+				{"key": "ratio", "value": 0.5},
+				{"key": "error", "value": false},
+				{"key": "db", "value": "users"},
+				{"key": "retries", "type": "int64", "value": "3"}
+			],
+			"logs": [{"timestamp": 1500000000500000, "fields": [{"key": "event", "value": "dumped"}]}],
+			"process": {"serviceName": "cron", "tags": [{"key": "hostname", "value": "db-1"}]}
+		},
+		{
+			"traceID": "1b2e3e4a6a1d4b8c5af7183fb1d4cf5f", "spanID": "2", "parentSpanID": "1", "operationName": "upload",
+			"references": [{"refType": "FOLLOWS_FROM", "traceID": "5af7183fb1d4cf5f", "spanID": "6b2e3e4a6a1d4b8c"}],
+			"process": {"serviceName": "uploader"}
+		},
+		{
+			"traceID": "5af7183fb1d4cf5f", "spanID": "3", "operationName": "cleanup",
+			"process": {"serviceName": "cron", "tags": [{"key": "hostname", "value": "db-1"}]}
+		}
+	]`))
+	require.NoError(t, err)
+	require.Len(t, batches, 2, "grouped by process")
+
+	assert.Equal(t, "cron", batches[0].Process.ServiceName)
+	require.Len(t, batches[0].Process.Tags, 1)
+	assert.Equal(t, "db-1", batches[0].Process.Tags[0].GetVStr())
+	require.Len(t, batches[0].Spans, 2)
+	span := batches[0].Spans[0]
+	assert.EqualValues(t, 0x5af7183fb1d4cf5f, span.TraceIdLow)
+	assert.EqualValues(t, 0x6b2e3e4a6a1d4b8c, span.SpanId)
+	assert.EqualValues(t, 0, span.ParentSpanId)
+	assert.Equal(t, "backup", span.OperationName)
+	assert.EqualValues(t, 1500000000000000, span.StartTime)
+	assert.EqualValues(t, 1500000, span.Duration)
+	tags := make(map[string]*jaeger.Tag)
+	for _, tag := range span.Tags {
+		tags[tag.Key] = tag
+	}
+	assert.Equal(t, jaeger.TagType_LONG, tags["exit.code"].VType)
+	assert.EqualValues(t, 0, tags["exit.code"].GetVLong())
+	assert.Equal(t, jaeger.TagType_DOUBLE, tags["ratio"].VType)
+	assert.Equal(t, 0.5, tags["ratio"].GetVDouble())
+	assert.Equal(t, jaeger.TagType_BOOL, tags["error"].VType)
+	assert.Equal(t, jaeger.TagType_STRING, tags["db"].VType)
+	assert.EqualValues(t, 3, tags["retries"].GetVLong())
+	require.Len(t, span.Logs, 1)
+	assert.Equal(t, "dumped", span.Logs[0].Fields[0].GetVStr())
+	assert.Equal(t, "cleanup", batches[0].Spans[1].OperationName)
+
+	assert.Equal(t, "uploader", batches[1].Process.ServiceName)
+	span = batches[1].Spans[0]
+	assert.EqualValues(t, 0x1b2e3e4a6a1d4b8c, span.TraceIdHigh)
+	assert.EqualValues(t, 1, span.ParentSpanId)
+	require.Len(t, span.References, 1)
+	assert.Equal(t, jaeger.SpanRefType_FOLLOWS_FROM, span.References[0].RefType)
+
+	batches, err = DeserializeJSONSpans([]byte(`[]`))
+	require.NoError(t, err)
+	assert.Empty(t, batches)
+}
+
+func TestDeserializeMalformedJSONSpans(t *testing.T) {
+	testCases := []struct {
+		body          string
+		expectedError string
+	}{
+		{body: `not good`, expectedError: "invalid character 'o' in literal null (expecting 'u')"},
+		{body: `{"traceID": "1"}`, expectedError: "json: cannot unmarshal object into Go value of type []json.Span"},
+		{
+			body:          `[{"spanID": "1", "process": {"serviceName": "svc"}}]`,
+			expectedError: "span 0: traceID and spanID are required",
+		},
+		{
+			body:          `[{"traceID": "1", "spanID": "1", "process": {"serviceName": "svc"}}, {"traceID": "1", "spanID": "2"}]`,
+			expectedError: "span 1: process with a serviceName is required",
+		},
+		{
+			body:          `[{"traceID": "xyz", "spanID": "1", "process": {"serviceName": "svc"}}]`,
+			expectedError: `span 0: strconv.ParseUint: parsing "xyz": invalid syntax`,
+		},
+		{
+			body:          `[{"traceID": "1", "spanID": "1", "tags": [{"key": "k", "value": [1]}], "process": {"serviceName": "svc"}}]`,
+			expectedError: `span 0: value of tag "k" must be a string, a number or a boolean`,
+		},
+		{
+			body:          `[{"traceID": "1", "spanID": "1", "tags": [{"key": "k", "type": "int64", "value": 1.5}], "process": {"serviceName": "svc"}}]`,
+			expectedError: `span 0: strconv.ParseInt: parsing "1.5": invalid syntax`,
+		},
+	}
+	for _, testCase := range testCases {
+		_, err := DeserializeJSONSpans([]byte(testCase.body))
+		assert.EqualError(t, err, testCase.expectedError, testCase.body)
+	}
+}
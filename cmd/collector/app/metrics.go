@@ -22,6 +22,7 @@ package app
 
 import (
 	"sync"
+	"time"
 
 	"github.com/uber/jaeger-lib/metrics"
 	"github.com/uber/jaeger/model"
@@ -43,8 +44,22 @@ type SpanProcessorMetrics struct { //TODO - initialize metrics in the traditiona
 	BatchSize metrics.Gauge // size of span batch
 	// QueueLength measures the size of the internal span queue
 	QueueLength metrics.Gauge
+	// QueueCapacity measures the capacity of the internal span queue
+	QueueCapacity metrics.Gauge
 	// ErrorBusy counts number of return ErrServerBusy
 	ErrorBusy metrics.Counter
+	// QueueUtilization measures the percentage of the capacity of the internal span queue in use
+	QueueUtilization metrics.Gauge
+	// WorkersBusy measures the number of workers of the span processor saving a span
+	WorkersBusy metrics.Gauge
+	// WorkersIdle measures the number of workers of the span processor waiting for queued spans
+	WorkersIdle metrics.Gauge
+	// BatchesThrottled counts the batches rejected because the queue is beyond its high-water mark
+	BatchesThrottled metrics.Counter
+	// IngestionLatencyBySvc measures the time from the start of the spans of each service to their save
+	IngestionLatencyBySvc timersBySvc
+	// IngestionClockSkew counts the saved spans starting after their save, whose ingestion latency is recorded as 0
+	IngestionClockSkew metrics.Counter
 	// SavedBySvc contains span and trace counts by service
 	SavedBySvc   metricsBySvc  // spans actually saved
 	serviceNames metrics.Gauge // total number of unique service name metrics reported by this collector
@@ -57,6 +72,13 @@ type countsBySvc struct {
 	lock    *sync.Mutex
 }
 
+type timersBySvc struct {
+	timers  map[string]metrics.Timer // timers per service
+	factory metrics.Factory
+	name    string
+	lock    *sync.Mutex
+}
+
 type metricsBySvc struct {
 	spans      countsBySvc // number of spans received per service
 	debugSpans countsBySvc // number of debug spans received per service
@@ -71,29 +93,55 @@ type CountsBySpanType struct {
 	Rejected metrics.Counter
 	// ReceivedBySvc maintain by-service metrics for a format type
 	ReceivedBySvc metricsBySvc
+	// ByFormat counts the spans of the format type through each stage of processing
+	ByFormat CountsByFormat
+}
+
+// CountsByFormat measures the spans received, queued, dropped, saved and buffered for a format type,
+// reported with a format label rather than under the namespace of the format type
+type CountsByFormat struct {
+	// Received is the number of spans received from upstream
+	Received metrics.Counter `metric:"spans.received"`
+	// Queued is the number of spans added to the queue, the others being rejected or dropped
+	Queued metrics.Counter `metric:"spans.queued"`
+	// Dropped is the number of spans that did not fit in the queue, or were left in it on shutdown
+	Dropped metrics.Counter `metric:"spans.dropped"`
+	// Saved is the number of spans successfully written to storage
+	Saved metrics.Counter `metric:"spans.saved"`
+	// Buffered is the number of spans kept by the span writer until the storage recovers, see spanstore.ErrSpanBuffered
+	Buffered metrics.Counter `metric:"spans.buffered"`
 }
 
 // NewSpanProcessorMetrics returns a SpanProcessorMetrics
 func NewSpanProcessorMetrics(serviceMetrics metrics.Factory, hostMetrics metrics.Factory, otherFormatTypes []string) *SpanProcessorMetrics {
-	spanCounts := map[string]CountsBySpanType{
-		ZipkinFormatType:  newCountsBySpanType(serviceMetrics.Namespace(ZipkinFormatType, nil)),
-		JaegerFormatType:  newCountsBySpanType(serviceMetrics.Namespace(JaegerFormatType, nil)),
-		UnknownFormatType: newCountsBySpanType(serviceMetrics.Namespace(UnknownFormatType, nil)),
-	}
-	for _, otherFormatType := range otherFormatTypes {
-		spanCounts[otherFormatType] = newCountsBySpanType(serviceMetrics.Namespace(otherFormatType, nil))
+	spanCounts := make(map[string]CountsBySpanType)
+	formatTypes := append([]string{ZipkinFormatType, JaegerFormatType, UnknownFormatType}, otherFormatTypes...)
+	for _, formatType := range formatTypes {
+		spanCounts[formatType] = newCountsBySpanType(serviceMetrics, formatType)
 	}
 	m := &SpanProcessorMetrics{
-		SaveLatency:    hostMetrics.Timer("save-latency", nil),
-		InQueueLatency: hostMetrics.Timer("in-queue-latency", nil),
-		SpansDropped:   hostMetrics.Counter("spans.dropped", nil),
-		BatchSize:      hostMetrics.Gauge("batch-size", nil),
-		QueueLength:    hostMetrics.Gauge("queue-length", nil),
-		ErrorBusy:      hostMetrics.Counter("error.busy", nil),
-		SavedBySvc:     newMetricsBySvc(serviceMetrics, "saved-by-svc"),
-		spanCounts:     spanCounts,
-		serviceNames:   hostMetrics.Gauge("spans.serviceNames", nil),
+		SaveLatency:      hostMetrics.Timer("save-latency", nil),
+		InQueueLatency:   hostMetrics.Timer("in-queue-latency", nil),
+		SpansDropped:     hostMetrics.Counter("spans.dropped", nil),
+		BatchSize:        hostMetrics.Gauge("batch-size", nil),
+		QueueLength:      hostMetrics.Gauge("queue-length", nil),
+		QueueCapacity:    hostMetrics.Gauge("queue-capacity", nil),
+		ErrorBusy:        hostMetrics.Counter("error.busy", nil),
+		QueueUtilization: hostMetrics.Gauge("queue-utilization", nil),
+		BatchesThrottled: hostMetrics.Counter("batches.throttled", nil),
+		WorkersBusy:      hostMetrics.Gauge("workers.busy", nil),
+		WorkersIdle:      hostMetrics.Gauge("workers.idle", nil),
+		SavedBySvc:       newMetricsBySvc(serviceMetrics, "saved-by-svc"),
+		spanCounts:       spanCounts,
+		serviceNames:     hostMetrics.Gauge("spans.serviceNames", nil),
+	}
+	m.IngestionLatencyBySvc = timersBySvc{
+		timers:  make(map[string]metrics.Timer),
+		factory: serviceMetrics,
+		name:    "ingestion-latency",
+		lock:    &sync.Mutex{},
 	}
+	m.IngestionClockSkew = serviceMetrics.Counter("ingestion-latency.clock-skewed", nil)
 
 	return m
 }
@@ -118,12 +166,15 @@ func newMetricsBySvc(factory metrics.Factory, category string) metricsBySvc {
 	}
 }
 
-func newCountsBySpanType(factory metrics.Factory) CountsBySpanType {
-	return CountsBySpanType{
+func newCountsBySpanType(serviceMetrics metrics.Factory, formatType string) CountsBySpanType {
+	factory := serviceMetrics.Namespace(formatType, nil)
+	counts := CountsBySpanType{
 		Received:      factory.Counter("spans.recd", nil),
 		Rejected:      factory.Counter("spans.rejected", nil),
 		ReceivedBySvc: newMetricsBySvc(factory, "by-svc"),
 	}
+	metrics.Init(&counts.ByFormat, serviceMetrics, map[string]string{"format": formatType})
+	return counts
 }
 
 // GetCountsForFormat gets the countsBySpanType for a given format. If none exists, we use the Unknown format.
@@ -193,3 +244,38 @@ func (m *countsBySvc) countByServiceName(serviceName string) {
 		counter.Inc(1)
 	}
 }
+
+// RecordIngestionLatency records the time from the start of the saved span to now, labeled by its service.
+// Spans starting after now, because of the clock skew of their clients, are recorded as 0 and counted apart.
+func (m *SpanProcessorMetrics) RecordIngestionLatency(span *model.Span, now time.Time) {
+	serviceName := span.Process.ServiceName
+	if serviceName == "" {
+		return
+	}
+	latency := now.Sub(span.StartTime)
+	if latency < 0 {
+		m.IngestionClockSkew.Inc(1)
+		latency = 0
+	}
+	m.IngestionLatencyBySvc.recordByServiceName(serviceName, latency)
+}
+
+// recordByServiceName maintains a map of timers for each service name it's given, labeled by the service,
+// and records the duration in the respective timer when called. As with countByServiceName, new service
+// names are ignored beyond maxServiceNames.
+func (m *timersBySvc) recordByServiceName(serviceName string, duration time.Duration) {
+	serviceName = NormalizeServiceName(serviceName)
+	var timer metrics.Timer
+	m.lock.Lock()
+	if t, ok := m.timers[serviceName]; ok {
+		timer = t
+	} else if len(m.timers) < maxServiceNames {
+		t := m.factory.Timer(m.name, map[string]string{"service": serviceName})
+		m.timers[serviceName] = t
+		timer = t
+	}
+	m.lock.Unlock()
+	if timer != nil {
+		timer.Record(duration)
+	}
+}
@@ -21,6 +21,7 @@
 package app
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -58,3 +59,23 @@ func TestProcessorMetrics(t *testing.T) {
 	assert.EqualValues(t, 1, counters["service.jaeger.debug-spans.by-svc.fry"])
 	assert.Empty(t, gauges)
 }
+
+func TestProcessorMetricsIngestionLatency(t *testing.T) {
+	baseMetrics := jaegerM.NewLocalFactory(time.Hour)
+	spm := NewSpanProcessorMetrics(baseMetrics.Namespace("service", nil), baseMetrics.Namespace("host", nil), nil)
+	now := time.Now()
+	spm.RecordIngestionLatency(&model.Span{StartTime: now.Add(-time.Second), Process: &model.Process{}}, now)
+	spm.RecordIngestionLatency(&model.Span{StartTime: now.Add(-time.Second), Process: &model.Process{ServiceName: "fry"}}, now)
+	spm.RecordIngestionLatency(&model.Span{StartTime: now.Add(time.Minute), Process: &model.Process{ServiceName: "fry"}}, now)
+	counters, gauges := baseMetrics.LocalBackend.Snapshot()
+
+	assert.EqualValues(t, 1, counters["service.ingestion-latency.clock-skewed"])
+	var timers int
+	for name := range gauges {
+		if strings.HasPrefix(name, "service.ingestion-latency|service=fry") {
+			timers++
+		}
+	}
+	assert.NotZero(t, timers, "the latencies are recorded by service")
+	assert.Len(t, spm.IngestionLatencyBySvc.timers, 1)
+}
@@ -39,3 +39,25 @@ func ChainedProcessSpan(spanProcessors ...ProcessSpan) ProcessSpan {
 		}
 	}
 }
+
+// ChainedProcessSpans chains batch processors as a single ProcessSpans call
+func ChainedProcessSpans(spanProcessors ...ProcessSpans) ProcessSpans {
+	return func(spans []*model.Span) {
+		for _, processor := range spanProcessors {
+			processor(spans)
+		}
+	}
+}
+
+// ChainedFilterSpan chains span filters as a single FilterSpan call. The chain short-circuits
+// on the first filter that disallows the span.
+func ChainedFilterSpan(spanFilters ...FilterSpan) FilterSpan {
+	return func(span *model.Span) bool {
+		for _, filter := range spanFilters {
+			if !filter(span) {
+				return false
+			}
+		}
+		return true
+	}
+}
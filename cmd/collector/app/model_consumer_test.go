@@ -38,3 +38,26 @@ func TestChainedProcessSpan(t *testing.T) {
 	assert.True(t, happened1)
 	assert.True(t, happened2)
 }
+
+func TestChainedProcessSpans(t *testing.T) {
+	var calls []string
+	func1 := func(spans []*model.Span) { calls = append(calls, "func1") }
+	func2 := func(spans []*model.Span) { calls = append(calls, "func2") }
+	chained := ChainedProcessSpans(func1, func2)
+	chained([]*model.Span{{}})
+	assert.Equal(t, []string{"func1", "func2"}, calls)
+}
+
+func TestChainedFilterSpan(t *testing.T) {
+	called := 0
+	allow := func(span *model.Span) bool { called++; return true }
+	deny := func(span *model.Span) bool { called++; return false }
+
+	assert.True(t, ChainedFilterSpan()(&model.Span{}))
+	assert.True(t, ChainedFilterSpan(allow, allow)(&model.Span{}))
+	assert.Equal(t, 2, called)
+
+	called = 0
+	assert.False(t, ChainedFilterSpan(deny, allow)(&model.Span{}))
+	assert.Equal(t, 1, called, "chain should stop at the first filter returning false")
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+	"github.com/uber/tchannel-go"
+	tchanThrift "github.com/uber/tchannel-go/thrift"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/thrift-gen/jaeger"
+)
+
+// NATSFormatType is for spans consumed from NATS
+const NATSFormatType = "nats"
+
+// NATSConsumer submits the span batches of the messages of a NATS subscription, in Jaeger Thrift, to the
+// batches handler, so that they go through the same authentication, tenancy and batch size handlers as the
+// Jaeger Thrift spans received by the collector, the Authorization header and the given tenant header of the
+// messages being passed on as by the APIHandler. The handler is expected to end with the NewNATSSpanHandler,
+// and a message is acknowledged once all its spans are saved, otherwise negatively acknowledged so that it
+// is redelivered, for at-least-once delivery of the spans.
+type NATSConsumer struct {
+	logger            *zap.Logger
+	batchesHandler    JaegerBatchesHandler
+	tenantHeader      string
+	savedMessages     metrics.Counter
+	retriedMessages   metrics.Counter
+	rejectedMessages  metrics.Counter
+	malformedMessages metrics.Counter
+}
+
+// NewNATSConsumer returns a NATSConsumer that submits the span batches to the given handler
+func NewNATSConsumer(
+	logger *zap.Logger,
+	batchesHandler JaegerBatchesHandler,
+	tenantHeader string,
+	metricsFactory metrics.Factory,
+) *NATSConsumer {
+	return &NATSConsumer{
+		logger:            logger,
+		batchesHandler:    batchesHandler,
+		tenantHeader:      tenantHeader,
+		savedMessages:     metricsFactory.Counter("nats.messages", map[string]string{"result": "saved"}),
+		retriedMessages:   metricsFactory.Counter("nats.messages", map[string]string{"result": "retried"}),
+		rejectedMessages:  metricsFactory.Counter("nats.messages", map[string]string{"result": "rejected"}),
+		malformedMessages: metricsFactory.Counter("nats.messages", map[string]string{"result": "malformed"}),
+	}
+}
+
+// Consume submits the span batch of a message, calling ack once its spans are saved or failed. The malformed
+// messages are acknowledged, since redelivering them would never succeed, and so are the messages rejected
+// by the handlers, e.g. unauthenticated or oversized, the spans of a message with malformed spans being
+// saved before it is acknowledged.
+func (c *NATSConsumer) Consume(data []byte, header func(key string) string, ack func(processed bool) error) {
+	batch, err := deserializeJaeger(data)
+	if err != nil {
+		c.logger.Warn("Dropping malformed NATS message", zap.Error(err))
+		c.malformedMessages.Inc(1)
+		c.acknowledge(ack, true)
+		return
+	}
+	rejected := false
+	// held by the consumer until the batch is submitted, so that the message is acknowledged once
+	message := newBatchAck(1, func(saved bool) {
+		switch {
+		case !saved:
+			c.retriedMessages.Inc(1)
+		case rejected:
+			c.rejectedMessages.Inc(1)
+		default:
+			c.savedMessages.Inc(1)
+		}
+		c.acknowledge(ack, saved)
+	})
+	ctx, cancel := c.messageContext(message, header)
+	defer cancel()
+	_, err = c.batchesHandler.SubmitBatches(ctx, []*jaeger.Batch{batch})
+	if err != nil && rejectedSubmission(err) {
+		c.logger.Warn("Rejected NATS message, it is not redelivered", zap.Error(err))
+		rejected = true
+		err = nil
+	} else if err != nil {
+		c.logger.Warn("Failed to process NATS message, it is redelivered", zap.Error(err))
+	}
+	message.done(err == nil)
+}
+
+// messageContext returns the context of the submission of a message, carrying its batchAck and its headers
+// the way the HTTP handlers carry the request headers
+func (c *NATSConsumer) messageContext(message *batchAck, header func(key string) string) (tchanThrift.Context, func()) {
+	ctx, cancel := tchanThrift.NewContext(time.Minute)
+	headers := make(map[string]string)
+	if authorization := header(AuthorizationHeader); authorization != "" {
+		headers[AuthorizationHeader] = authorization
+	}
+	if c.tenantHeader != "" {
+		if tenant := header(c.tenantHeader); tenant != "" {
+			headers[strings.ToLower(c.tenantHeader)] = tenant
+		}
+	}
+	return tchanThrift.WithHeaders(context.WithValue(ctx, batchAckKey{}, message), headers), cancel
+}
+
+func (c *NATSConsumer) acknowledge(ack func(processed bool) error, processed bool) {
+	if err := ack(processed); err != nil {
+		c.logger.Error("Failed to acknowledge NATS message", zap.Error(err))
+	}
+}
+
+// rejectedSubmission returns whether the handlers rejected the batch for good, which is not retried
+func rejectedSubmission(err error) bool {
+	if _, ok := err.(*AuthError); ok {
+		return true
+	}
+	return tchannel.GetSystemErrorCode(err) == tchannel.ErrCodeBadRequest
+}
+
+type batchAckKey struct{}
+
+// batchAckFromContext returns the batchAck of the message the batches are submitted for, nil without one
+func batchAckFromContext(ctx context.Context) *batchAck {
+	if ctx == nil {
+		return nil
+	}
+	message, _ := ctx.Value(batchAckKey{}).(*batchAck)
+	return message
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+	metricsTest "github.com/uber/jaeger-lib/metrics/testutils"
+	"github.com/uber/tchannel-go"
+	tchanThrift "github.com/uber/tchannel-go/thrift"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/thrift-gen/jaeger"
+)
+
+type fakeAckingProcessor struct {
+	spans  []*model.Span
+	format string
+	saved  bool
+	err    error
+	// acks holds the acks of the spans until they are called by the test, if not nil
+	acks []func(saved bool)
+}
+
+func (p *fakeAckingProcessor) ProcessSpansWithAck(mSpans []*model.Span, format string, ack func(saved bool)) error {
+	p.spans = append(p.spans, mSpans...)
+	p.format = format
+	if p.acks != nil {
+		p.acks = append(p.acks, ack)
+		return p.err
+	}
+	ack(p.saved)
+	return p.err
+}
+
+type recordedAcks []bool
+
+func (a *recordedAcks) ack(processed bool) error {
+	*a = append(*a, processed)
+	return nil
+}
+
+func noHeaders(string) string {
+	return ""
+}
+
+func natsMessage(t *testing.T, spans ...*jaeger.Span) []byte {
+	_, process := makeJaegerSpan("svc", true, false)
+	data, err := thrift.NewTSerializer().Write(&jaeger.Batch{Process: process, Spans: spans})
+	require.NoError(t, err)
+	return data
+}
+
+func TestNATSConsumer(t *testing.T) {
+	span, _ := makeJaegerSpan("svc", true, false)
+	data := natsMessage(t, span)
+
+	testCases := []struct {
+		processor *fakeAckingProcessor
+		expected  []bool
+		result    string
+	}{
+		{processor: &fakeAckingProcessor{saved: true}, expected: []bool{true}, result: "saved"},
+		{processor: &fakeAckingProcessor{saved: false}, expected: []bool{false}, result: "retried"},
+		{processor: &fakeAckingProcessor{err: errors.New("busy")}, expected: []bool{false}, result: "retried"},
+	}
+	for _, testCase := range testCases {
+		mb := metrics.NewLocalFactory(0)
+		handler := NewNATSSpanHandler(zap.NewNop(), testCase.processor, mb)
+		consumer := NewNATSConsumer(zap.NewNop(), handler, "", mb)
+		var acks recordedAcks
+		consumer.Consume(data, noHeaders, acks.ack)
+
+		assert.Equal(t, testCase.expected, []bool(acks))
+		require.Len(t, testCase.processor.spans, 1)
+		assert.Equal(t, "svc", testCase.processor.spans[0].Process.ServiceName)
+		assert.Equal(t, NATSFormatType, testCase.processor.format)
+		metricsTest.AssertCounterMetrics(t, mb, metricsTest.ExpectedMetric{
+			Name: "nats.messages|result=" + testCase.result, Value: 1,
+		})
+	}
+}
+
+func TestNATSConsumerAcksOnceSaved(t *testing.T) {
+	span, _ := makeJaegerSpan("svc", true, false)
+	mb := metrics.NewLocalFactory(0)
+	processor := &fakeAckingProcessor{acks: []func(bool){}}
+	handler := NewNATSSpanHandler(zap.NewNop(), processor, mb)
+	// the oversized batch is split in two, the message being acknowledged once both parts are saved
+	limiter := NewBatchSizeLimiter(BatchSizeOptions{MaxSpans: 1, Policy: SplitOversizedBatches}, mb)
+	consumer := NewNATSConsumer(zap.NewNop(), limiter.JaegerBatchesHandler(handler), "", mb)
+	var acks recordedAcks
+	consumer.Consume(natsMessage(t, span, span), noHeaders, acks.ack)
+
+	require.Len(t, processor.acks, 2)
+	assert.Empty(t, acks, "not acknowledged before the spans are saved")
+	processor.acks[0](true)
+	assert.Empty(t, acks)
+	processor.acks[1](true)
+	assert.Equal(t, []bool{true}, []bool(acks))
+}
+
+func TestNATSConsumerHeaders(t *testing.T) {
+	span, _ := makeJaegerSpan("svc", true, false)
+	handler := &recordingBatchesHandler{}
+	consumer := NewNATSConsumer(zap.NewNop(), handler, "X-Tenant", metrics.NullFactory)
+	headers := map[string]string{"authorization": "Bearer token", "x-tenant": "payments", "other": "value"}
+	var acks recordedAcks
+	consumer.Consume(natsMessage(t, span), func(key string) string {
+		return headers[strings.ToLower(key)]
+	}, acks.ack)
+
+	require.NotNil(t, handler.ctx)
+	assert.Equal(t, map[string]string{AuthorizationHeader: "Bearer token", "x-tenant": "payments"}, handler.ctx.Headers())
+	assert.NotNil(t, batchAckFromContext(handler.ctx))
+	assert.Equal(t, []bool{true}, []bool(acks))
+}
+
+func TestNATSConsumerRejectedMessage(t *testing.T) {
+	span, _ := makeJaegerSpan("svc", true, false)
+	for _, err := range []error{
+		&AuthError{Reason: authReasonMissingCredentials},
+		tchannel.NewSystemError(tchannel.ErrCodeBadRequest, "oversized"),
+	} {
+		mb := metrics.NewLocalFactory(0)
+		consumer := NewNATSConsumer(zap.NewNop(), &recordingBatchesHandler{err: err}, "", mb)
+		var acks recordedAcks
+		consumer.Consume(natsMessage(t, span), noHeaders, acks.ack)
+
+		// acknowledged, since a redelivered message would be rejected again
+		assert.Equal(t, []bool{true}, []bool(acks))
+		metricsTest.AssertCounterMetrics(t, mb, metricsTest.ExpectedMetric{
+			Name: "nats.messages|result=rejected", Value: 1,
+		})
+	}
+}
+
+func TestNATSSpanHandlerMalformedSpans(t *testing.T) {
+	span, _ := makeJaegerSpan("svc", true, false)
+	mb := metrics.NewLocalFactory(0)
+	processor := &fakeAckingProcessor{saved: true}
+	handler := NewNATSSpanHandler(zap.NewNop(), processor, mb)
+	message := newBatchAck(1, func(bool) {})
+	ctx := tchanThrift.Wrap(context.WithValue(context.Background(), batchAckKey{}, message))
+	_, err := handler.SubmitBatches(ctx, []*jaeger.Batch{{Process: &jaeger.Process{ServiceName: "svc"}, Spans: []*jaeger.Span{span, nil}}})
+
+	assert.Equal(t, tchannel.ErrCodeBadRequest, tchannel.GetSystemErrorCode(err))
+	assert.Len(t, processor.spans, 1, "the valid spans are processed")
+	metricsTest.AssertCounterMetrics(t, mb, metricsTest.ExpectedMetric{
+		Name: "malformed-spans|format=nats", Value: 1,
+	})
+}
+
+func TestNATSConsumerMalformedMessage(t *testing.T) {
+	mb := metrics.NewLocalFactory(0)
+	processor := &fakeAckingProcessor{saved: true}
+	consumer := NewNATSConsumer(zap.NewNop(), NewNATSSpanHandler(zap.NewNop(), processor, mb), "", mb)
+	var acks recordedAcks
+	consumer.Consume([]byte("not a batch"), noHeaders, acks.ack)
+
+	// acknowledged, since a redelivered malformed message would never be processed
+	assert.Equal(t, []bool{true}, []bool(acks))
+	assert.Nil(t, processor.spans)
+	metricsTest.AssertCounterMetrics(t, mb, metricsTest.ExpectedMetric{
+		Name: "nats.messages|result=malformed", Value: 1,
+	})
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"io"
+
+	commonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+	"github.com/uber/tchannel-go"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	ocConv "github.com/uber/jaeger/model/converter/opencensus"
+)
+
+// OpenCensusFormatType is for spans received through the OpenCensus trace service
+const OpenCensusFormatType = "opencensus"
+
+// OpenCensusReceiver consumes spans exported by OpenCensus libraries and agents
+type OpenCensusReceiver interface {
+	agenttracepb.TraceServiceServer
+	// SubmitOpenCensusSpans records a batch of spans reported by the given node
+	SubmitOpenCensusSpans(node *commonpb.Node, spans []*tracepb.Span) error
+}
+
+type openCensusHandler struct {
+	logger         *zap.Logger
+	modelProcessor SpanProcessor
+}
+
+// NewOpenCensusHandler returns an OpenCensusReceiver that funnels spans into the given span processor
+func NewOpenCensusHandler(logger *zap.Logger, modelProcessor SpanProcessor) OpenCensusReceiver {
+	return &openCensusHandler{
+		logger:         logger,
+		modelProcessor: modelProcessor,
+	}
+}
+
+// SubmitOpenCensusSpans converts the spans to the domain model and hands them to the span processor.
+// Backpressure from the processor is reported as codes.ResourceExhausted.
+func (h *openCensusHandler) SubmitOpenCensusSpans(node *commonpb.Node, spans []*tracepb.Span) error {
+	mSpans, err := ocConv.ToDomain(node, spans)
+	if err != nil {
+		h.logger.Warn("Unable to convert OpenCensus span to domain span", zap.Error(err))
+		return status.Errorf(codes.InvalidArgument, "Unable to convert span: %v", err)
+	}
+	_, err = h.modelProcessor.ProcessSpans(mSpans, OpenCensusFormatType)
+	if err == tchannel.ErrServerBusy {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return nil
+}
+
+// Export receives the stream of spans of an OpenCensus exporter. The node identifying the exporter
+// is only required in the first message of the stream and applies to all the following ones.
+func (h *openCensusHandler) Export(stream agenttracepb.TraceService_ExportServer) error {
+	var node *commonpb.Node
+	for {
+		request, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if request.Node != nil {
+			node = request.Node
+		}
+		if err := h.SubmitOpenCensusSpans(node, request.Spans); err != nil {
+			return err
+		}
+	}
+}
+
+// Config is not supported, the sampling configuration is served to the Jaeger agents instead.
+func (h *openCensusHandler) Config(stream agenttracepb.TraceService_ConfigServer) error {
+	return status.Error(codes.Unimplemented, "OpenCensus trace config is not supported")
+}
+
+// NewOpenCensusServer creates a gRPC server with the OpenCensus trace service registered
+func NewOpenCensusServer(receiver OpenCensusReceiver, opts ...grpc.ServerOption) *grpc.Server {
+	server := grpc.NewServer(opts...)
+	agenttracepb.RegisterTraceServiceServer(server, receiver)
+	return server
+}
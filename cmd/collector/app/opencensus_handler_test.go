@@ -0,0 +1,133 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	commonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/uber/jaeger/model"
+)
+
+func makeOpenCensusSpans() []*tracepb.Span {
+	return []*tracepb.Span{
+		{
+			TraceId: []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1},
+			SpanId:  []byte{0, 0, 0, 0, 0, 0, 0, 2},
+			Name:    &tracepb.TruncatableString{Value: "op"},
+		},
+	}
+}
+
+type recordingProcessor struct {
+	spans  []*model.Span
+	format string
+}
+
+func (p *recordingProcessor) ProcessSpans(mSpans []*model.Span, format string) ([]bool, error) {
+	p.spans = append(p.spans, mSpans...)
+	p.format = format
+	oks := make([]bool, len(mSpans))
+	for i := range oks {
+		oks[i] = true
+	}
+	return oks, nil
+}
+
+func TestOpenCensusHandler(t *testing.T) {
+	node := &commonpb.Node{ServiceInfo: &commonpb.ServiceInfo{Name: "svc"}}
+	testCases := []struct {
+		processor    SpanProcessor
+		spans        []*tracepb.Span
+		expectedCode codes.Code
+	}{
+		{
+			processor:    &shouldIErrorProcessor{false},
+			spans:        makeOpenCensusSpans(),
+			expectedCode: codes.OK,
+		},
+		{
+			processor:    &shouldIErrorProcessor{true},
+			spans:        makeOpenCensusSpans(),
+			expectedCode: codes.Internal,
+		},
+		{
+			processor:    busyProcessor{},
+			spans:        makeOpenCensusSpans(),
+			expectedCode: codes.ResourceExhausted,
+		},
+		{
+			processor:    &shouldIErrorProcessor{false},
+			spans:        []*tracepb.Span{{TraceId: []byte{1}}},
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+	for _, tc := range testCases {
+		h := NewOpenCensusHandler(zap.NewNop(), tc.processor)
+		err := h.SubmitOpenCensusSpans(node, tc.spans)
+		assert.Equal(t, tc.expectedCode, status.Code(err))
+	}
+}
+
+func TestOpenCensusServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	processor := &recordingProcessor{}
+	server := NewOpenCensusServer(NewOpenCensusHandler(zap.NewNop(), processor))
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	stream, err := agenttracepb.NewTraceServiceClient(conn).Export(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&agenttracepb.ExportTraceServiceRequest{
+		Node:  &commonpb.Node{ServiceInfo: &commonpb.ServiceInfo{Name: "svc"}},
+		Spans: makeOpenCensusSpans(),
+	}))
+	// the node is omitted from subsequent messages of the stream
+	require.NoError(t, stream.Send(&agenttracepb.ExportTraceServiceRequest{
+		Spans: makeOpenCensusSpans(),
+	}))
+	require.NoError(t, stream.CloseSend())
+	_, err = stream.Recv()
+	require.Error(t, err) // io.EOF once the server returns
+
+	require.Len(t, processor.spans, 2)
+	assert.Equal(t, OpenCensusFormatType, processor.format)
+	assert.Equal(t, "svc", processor.spans[1].Process.ServiceName)
+}
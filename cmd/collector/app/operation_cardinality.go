@@ -0,0 +1,109 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"sync"
+
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+)
+
+// DefaultOperationPlaceholder is the operation name given to the spans of operations beyond the limit of their service
+const DefaultOperationPlaceholder = "collapsed-operation"
+
+// OperationCardinalityOptions limit the number of distinct operation names of each service
+type OperationCardinalityOptions struct {
+	// MaxOperations is the number of distinct operation names a service can have, the spans of its other
+	// operations being renamed to Placeholder
+	MaxOperations int
+	// Placeholder is the operation name of the collapsed spans, DefaultOperationPlaceholder if empty
+	Placeholder string
+}
+
+// OperationCardinalityGuard protects the operation indexes from services generating unbounded operation
+// names, e.g. by templating URLs into them. The first MaxOperations operation names of each service are kept,
+// the spans of further operations are renamed to the placeholder and counted in the spans.collapsed-operations
+// metric. The operation names are remembered until the collector restarts.
+type OperationCardinalityGuard struct {
+	sync.Mutex
+	options    OperationCardinalityOptions
+	logger     *zap.Logger
+	collapsed  metrics.Counter
+	operations map[string]map[string]struct{}
+}
+
+// NewOperationCardinalityGuard creates an OperationCardinalityGuard
+func NewOperationCardinalityGuard(
+	options OperationCardinalityOptions,
+	logger *zap.Logger,
+	metricsFactory metrics.Factory,
+) *OperationCardinalityGuard {
+	if options.Placeholder == "" {
+		options.Placeholder = DefaultOperationPlaceholder
+	}
+	return &OperationCardinalityGuard{
+		options:    options,
+		logger:     logger,
+		collapsed:  metricsFactory.Counter("spans.collapsed-operations", nil),
+		operations: make(map[string]map[string]struct{}),
+	}
+}
+
+// GuardSpans renames the spans of the operations beyond the limit of their service, it can be used as a ProcessSpans.
+func (g *OperationCardinalityGuard) GuardSpans(spans []*model.Span) {
+	g.Lock()
+	defer g.Unlock()
+	for _, span := range spans {
+		if span.Process == nil || span.OperationName == g.options.Placeholder {
+			continue
+		}
+		if !g.allow(span.Process.ServiceName, span.OperationName) {
+			span.OperationName = g.options.Placeholder
+			g.collapsed.Inc(1)
+		}
+	}
+}
+
+// allow remembers the operation if its service has room for it, and returns whether it is remembered
+func (g *OperationCardinalityGuard) allow(serviceName, operationName string) bool {
+	operations, ok := g.operations[serviceName]
+	if !ok {
+		operations = make(map[string]struct{})
+		g.operations[serviceName] = operations
+	}
+	if _, ok := operations[operationName]; ok {
+		return true
+	}
+	if len(operations) >= g.options.MaxOperations {
+		return false
+	}
+	operations[operationName] = struct{}{}
+	if len(operations) == g.options.MaxOperations {
+		g.logger.Warn("Service reached the maximum number of operations, the spans of new operations are collapsed",
+			zap.String("service", serviceName),
+			zap.Int("max-operations", g.options.MaxOperations),
+			zap.String("placeholder", g.options.Placeholder))
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/pkg/testutils"
+)
+
+func operationSpan(serviceName, operationName string) *model.Span {
+	return &model.Span{OperationName: operationName, Process: &model.Process{ServiceName: serviceName}}
+}
+
+func TestOperationCardinalityGuard(t *testing.T) {
+	logger, logBuffer := testutils.NewLogger()
+	metricsFactory := metrics.NewLocalFactory(0)
+	guard := NewOperationCardinalityGuard(OperationCardinalityOptions{MaxOperations: 2}, logger, metricsFactory)
+	spans := []*model.Span{
+		operationSpan("frontend", "GET /users/1"),
+		operationSpan("frontend", "GET /users/2"),
+		operationSpan("frontend", "GET /users/1"),
+		operationSpan("frontend", "GET /users/3"),
+		operationSpan("frontend", DefaultOperationPlaceholder),
+		operationSpan("backend", "GET /users/3"),
+		{OperationName: "no process"},
+	}
+	guard.GuardSpans(spans)
+	guard.GuardSpans([]*model.Span{spans[3]})
+
+	var operations []string
+	for _, span := range spans {
+		operations = append(operations, span.OperationName)
+	}
+	assert.Equal(t, []string{
+		"GET /users/1",
+		"GET /users/2",
+		"GET /users/1",
+		DefaultOperationPlaceholder,
+		DefaultOperationPlaceholder,
+		"GET /users/3",
+		"no process",
+	}, operations)
+
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["spans.collapsed-operations"])
+	if assert.Len(t, logBuffer.Lines(), 1) {
+		assert.Contains(t, logBuffer.Lines()[0], `"msg":"Service reached the maximum number of operations`)
+		assert.Contains(t, logBuffer.Lines()[0], `"service":"frontend"`)
+	}
+}
+
+func TestOperationCardinalityGuardPlaceholder(t *testing.T) {
+	guard := NewOperationCardinalityGuard(OperationCardinalityOptions{MaxOperations: 1, Placeholder: "templated"}, zap.NewNop(), metrics.NullFactory)
+	spans := []*model.Span{operationSpan("frontend", "GET /users/1"), operationSpan("frontend", "GET /users/2")}
+	guard.GuardSpans(spans)
+	assert.Equal(t, "templated", spans[1].OperationName)
+}
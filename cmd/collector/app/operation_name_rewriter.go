@@ -0,0 +1,147 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+const (
+	// OriginalOperationNameTag is the span tag the operation name replaced by an OperationNameRule is kept in
+	OriginalOperationNameTag = "original.operation"
+
+	// tagPlaceholder is replaced by the tag value in the Template of an OperationNameRule
+	tagPlaceholder = "{tag}"
+)
+
+// OperationNameRule derives the operation name of spans from one of their tags, e.g. from the http.route
+// tag of spans named "HTTP GET"
+type OperationNameRule struct {
+	// Pattern is the regular expression the operation name must match for the rule to apply
+	Pattern string `json:"pattern"`
+	// Tag is the key of the span tag the new operation name is derived from, the rule does not apply without it
+	Tag string `json:"tag"`
+	// Template is the new operation name, where {tag} is replaced by the tag value and $1 or ${name} by the
+	// submatches of Pattern, e.g. "$1 {tag}". The new name is the tag value if it is empty.
+	Template string `json:"template"`
+}
+
+// OperationNameRules are the rules of each service, keyed by service name. The first rule that applies to
+// a span rewrites its operation name, the spans of services without rules are left untouched.
+type OperationNameRules map[string][]OperationNameRule
+
+// LoadOperationNameRules reads OperationNameRules encoded as JSON
+func LoadOperationNameRules(r io.Reader) (OperationNameRules, error) {
+	var rules OperationNameRules
+	err := json.NewDecoder(r).Decode(&rules)
+	return rules, err
+}
+
+type compiledOperationNameRule struct {
+	OperationNameRule
+	pattern *regexp.Regexp
+}
+
+// OperationNameRewriter rewrites the generic operation names of spans according to OperationNameRules,
+// keeping the replaced names in the OriginalOperationNameTag
+type OperationNameRewriter struct {
+	sync.RWMutex
+	rules     map[string][]compiledOperationNameRule
+	rewritten metrics.Counter
+}
+
+// NewOperationNameRewriter creates an OperationNameRewriter that counts the operation names it rewrites in the
+// given metrics factory, it returns an error if a Pattern is not a valid regular expression
+func NewOperationNameRewriter(rules OperationNameRules, metricsFactory metrics.Factory) (*OperationNameRewriter, error) {
+	r := &OperationNameRewriter{
+		rewritten: metricsFactory.Counter("spans.operations-rewritten", nil),
+	}
+	if err := r.Update(rules); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Update replaces the rules, spans rewritten from then on use the new rules. The rules are left unchanged
+// if a Pattern is not a valid regular expression.
+func (r *OperationNameRewriter) Update(rules OperationNameRules) error {
+	compiled := make(map[string][]compiledOperationNameRule, len(rules))
+	for service, serviceRules := range rules {
+		for _, rule := range serviceRules {
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return fmt.Errorf("invalid operation name pattern of service %s: %v", service, err)
+			}
+			compiled[service] = append(compiled[service], compiledOperationNameRule{OperationNameRule: rule, pattern: pattern})
+		}
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.rules = compiled
+	return nil
+}
+
+// RewriteSpans rewrites the operation names of the spans that a rule of their service applies to,
+// it can be used as a ProcessSpans.
+func (r *OperationNameRewriter) RewriteSpans(spans []*model.Span) {
+	r.RLock()
+	defer r.RUnlock()
+	for _, span := range spans {
+		if span.Process == nil {
+			continue
+		}
+		for _, rule := range r.rules[span.Process.ServiceName] {
+			if r.rewrite(span, rule) {
+				break
+			}
+		}
+	}
+}
+
+func (r *OperationNameRewriter) rewrite(span *model.Span, rule compiledOperationNameRule) bool {
+	match := rule.pattern.FindStringSubmatchIndex(span.OperationName)
+	if match == nil {
+		return false
+	}
+	tag, ok := span.Tags.FindByKey(rule.Tag)
+	if !ok || tag.AsString() == "" {
+		return false
+	}
+	name := tag.AsString()
+	if rule.Template != "" {
+		// the submatches are expanded first, so that a $ in the tag value is kept as is
+		template := string(rule.pattern.ExpandString(nil, rule.Template, span.OperationName, match))
+		name = strings.Replace(template, tagPlaceholder, name, -1)
+	}
+	span.Tags = append(span.Tags, model.String(OriginalOperationNameTag, span.OperationName))
+	span.OperationName = name
+	r.rewritten.Inc(1)
+	return true
+}
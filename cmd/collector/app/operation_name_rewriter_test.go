@@ -0,0 +1,101 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+func routeSpan(serviceName, operationName string, tags ...model.KeyValue) *model.Span {
+	return &model.Span{
+		OperationName: operationName,
+		Tags:          tags,
+		Process:       &model.Process{ServiceName: serviceName},
+	}
+}
+
+func TestOperationNameRewriter(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	rewriter, err := NewOperationNameRewriter(OperationNameRules{
+		"frontend": {
+			{Pattern: `^HTTP (GET|POST)$`, Tag: "http.route", Template: "$1 {tag}"},
+			{Pattern: `^HTTP`, Tag: "http.url"},
+		},
+	}, metricsFactory)
+	require.NoError(t, err)
+	route := model.String("http.route", "/users/{id}")
+	spans := []*model.Span{
+		routeSpan("frontend", "HTTP GET", route),
+		routeSpan("frontend", "HTTP PUT", route, model.String("http.url", "/users/$1")),
+		routeSpan("frontend", "HTTP GET"),
+		routeSpan("frontend", "GetUser", route),
+		routeSpan("backend", "HTTP GET", route),
+		{OperationName: "HTTP GET", Tags: model.KeyValues{route}},
+	}
+	rewriter.RewriteSpans(spans)
+
+	var operations []string
+	for _, span := range spans {
+		operations = append(operations, span.OperationName)
+	}
+	assert.Equal(t, []string{"GET /users/{id}", "/users/$1", "HTTP GET", "GetUser", "HTTP GET", "HTTP GET"}, operations)
+	original, ok := spans[0].Tags.FindByKey(OriginalOperationNameTag)
+	assert.True(t, ok)
+	assert.Equal(t, "HTTP GET", original.AsString())
+	_, ok = spans[2].Tags.FindByKey(OriginalOperationNameTag)
+	assert.False(t, ok, "the name is kept without the tag")
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counts["spans.operations-rewritten"])
+}
+
+func TestOperationNameRewriterUpdate(t *testing.T) {
+	rewriter, err := NewOperationNameRewriter(OperationNameRules{}, metrics.NullFactory)
+	require.NoError(t, err)
+	rules := OperationNameRules{"backend": {{Pattern: `^HTTP`, Tag: "http.route"}}}
+	require.NoError(t, rewriter.Update(rules))
+	span := routeSpan("backend", "HTTP GET", model.String("http.route", "/orders"))
+	rewriter.RewriteSpans([]*model.Span{span})
+	assert.Equal(t, "/orders", span.OperationName)
+
+	err = rewriter.Update(OperationNameRules{"backend": {{Pattern: `(`, Tag: "http.route"}}})
+	assert.Error(t, err)
+	span = routeSpan("backend", "HTTP GET", model.String("http.route", "/orders"))
+	rewriter.RewriteSpans([]*model.Span{span})
+	assert.Equal(t, "/orders", span.OperationName, "the previous rules are kept")
+
+	_, err = NewOperationNameRewriter(OperationNameRules{"backend": {{Pattern: `(`}}}, metrics.NullFactory)
+	assert.Error(t, err)
+}
+
+func TestLoadOperationNameRules(t *testing.T) {
+	rules, err := LoadOperationNameRules(strings.NewReader(`{"frontend": [{"pattern": "^HTTP", "tag": "http.route", "template": "{tag}"}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, OperationNameRules{
+		"frontend": {{Pattern: "^HTTP", Tag: "http.route", Template: "{tag}"}},
+	}, rules)
+}
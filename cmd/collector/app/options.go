@@ -49,6 +49,11 @@ type options struct {
 	queueSize        int
 	reportBusy       bool
 	extraFormatTypes []string
+	spanLog          SpanLog
+	backpressure     *BackpressureOptions
+	admission        *AdmissionController
+	droppedSpans     *DroppedSpanSampler
+	workerPool       *WorkerPool
 }
 
 // Option is a function that sets some option on StorageBuilder.
@@ -134,6 +139,46 @@ func (options) ReportBusy(reportBusy bool) Option {
 	}
 }
 
+// SpanLog creates an Option that records the spans in the log before they are queued, so that the spans
+// left in the queue by a crash are saved on the next start
+func (options) SpanLog(spanLog SpanLog) Option {
+	return func(b *options) {
+		b.spanLog = spanLog
+	}
+}
+
+// Backpressure creates an Option that rejects the batches of spans with tchannel.ErrServerBusy while the queue
+// is filled beyond the high-water mark, so that the clients back off before the queue overflows
+func (options) Backpressure(backpressure BackpressureOptions) Option {
+	return func(b *options) {
+		b.backpressure = &backpressure
+	}
+}
+
+// Admission creates an Option that rejects or sheds the spans while the admission controller finds the
+// process overloaded, before they are pre-processed
+func (options) Admission(admission *AdmissionController) Option {
+	return func(b *options) {
+		b.admission = admission
+	}
+}
+
+// DroppedSpans creates an Option that records the spans rejected by the span filter, shed by the admission
+// controller or dropped by the full queue in the sampler, so that a sample of the recent drops can be inspected
+func (options) DroppedSpans(droppedSpans *DroppedSpanSampler) Option {
+	return func(b *options) {
+		b.droppedSpans = droppedSpans
+	}
+}
+
+// WorkerPool creates an Option that saves the queued spans with the workers of the pool rather than
+// NumWorkers workers, so that their number can be changed while the span processor runs
+func (options) WorkerPool(workerPool *WorkerPool) Option {
+	return func(b *options) {
+		b.workerPool = workerPool
+	}
+}
+
 // ExtraFormatTypes creates an Option that initializes the extra list of format types
 func (options) ExtraFormatTypes(extraFormatTypes []string) Option {
 	return func(b *options) {
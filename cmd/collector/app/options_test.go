@@ -45,8 +45,10 @@ func TestAllOptionSet(t *testing.T) {
 		Options.Sanitizer(func(span *model.Span) *model.Span { return span }),
 		Options.QueueSize(10),
 		Options.PreSave(func(span *model.Span) {}),
+		Options.WorkerPool(NewWorkerPool(3)),
 	)
 	assert.EqualValues(t, 5, opts.numWorkers)
+	assert.Equal(t, 3, opts.workerPool.Size())
 	assert.EqualValues(t, 10, opts.queueSize)
 }
 
@@ -0,0 +1,149 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/model/converter/otlp"
+	jConv "github.com/uber/jaeger/model/converter/thrift/jaeger"
+	"github.com/uber/jaeger/thrift-gen/jaeger"
+)
+
+const (
+	// OTLPFormatType is for spans received through the OTLP/HTTP receiver
+	OTLPFormatType = "otlp"
+
+	// OTLPTracesPath is the path OpenTelemetry SDKs export spans to with OTLP over HTTP
+	OTLPTracesPath = "/v1/traces"
+
+	protobufContentType = "application/x-protobuf"
+)
+
+// OTLPReceiver consumes the spans exported by OpenTelemetry SDKs with OTLP over HTTP, encoded in
+// protobuf or in JSON and optionally compressed with gzip
+type OTLPReceiver struct {
+	logger              *zap.Logger
+	batchesHandler      JaegerBatchesHandler
+	tenantHeader        string
+	maxDecompressedSize int64
+	compressedRequests  metrics.Counter
+	plainRequests       metrics.Counter
+	malformedPayloads   metrics.Counter
+}
+
+// NewOTLPReceiver returns an OTLPReceiver that submits the spans to the given handler as Jaeger batches, one per
+// resource, so that they go through the same authentication, tenancy and batch size handlers as the Jaeger
+// Thrift spans. The Authorization header and the given tenant header of the requests are passed on to the
+// handler as by the APIHandler.
+func NewOTLPReceiver(
+	logger *zap.Logger,
+	batchesHandler JaegerBatchesHandler,
+	tenantHeader string,
+	metricsFactory metrics.Factory,
+) *OTLPReceiver {
+	return &OTLPReceiver{
+		logger:              logger,
+		batchesHandler:      batchesHandler,
+		tenantHeader:        tenantHeader,
+		maxDecompressedSize: DefaultMaxDecompressedSize,
+		compressedRequests:  metricsFactory.Counter("otlp.requests", map[string]string{"encoding": gzipEncoding}),
+		plainRequests:       metricsFactory.Counter("otlp.requests", map[string]string{"encoding": identityEncoding}),
+		malformedPayloads:   metricsFactory.Counter("otlp.malformed-payloads", nil),
+	}
+}
+
+// RegisterRoutes registers the OTLP traces endpoint on the given router
+func (h *OTLPReceiver) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc(OTLPTracesPath, h.export).Methods(http.MethodPost)
+}
+
+// export decodes the request in its content type, converts its spans to the domain model and submits them
+// to the handler, replying with an empty response in the same content type. Backpressure from the
+// processor is reported as 429 Too Many Requests, which the OTLP exporters retry.
+func (h *OTLPReceiver) export(w http.ResponseWriter, r *http.Request) {
+	bodyBytes, err := readRequestBody(r, h.maxDecompressedSize, h.plainRequests, h.compressedRequests)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(unableToReadBodyErrFormat, err), bodyErrorStatus(err))
+		return
+	}
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Cannot parse content type: %v", err), http.StatusBadRequest)
+		return
+	}
+	var request *otlp.ExportTraceServiceRequest
+	var response []byte
+	switch contentType {
+	case protobufContentType:
+		request, err = otlp.DecodeProtobuf(bodyBytes)
+	case jsonContentType:
+		request, err = otlp.DecodeJSON(bodyBytes)
+		response = []byte("{}")
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported content type: %v", contentType), http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		h.malformedPayloads.Inc(1)
+		http.Error(w, fmt.Sprintf(unableToReadBodyErrFormat, err), http.StatusBadRequest)
+		return
+	}
+	mSpans, err := otlp.ToDomain(request)
+	if err != nil {
+		h.logger.Warn("Unable to convert OTLP span to domain span", zap.Error(err))
+		http.Error(w, fmt.Sprintf("Unable to convert span: %v", err), http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := requestContext(r, h.tenantHeader)
+	defer cancel()
+	if _, err := h.batchesHandler.SubmitBatches(ctx, toJaegerBatches(mSpans)); err != nil {
+		http.Error(w, fmt.Sprintf("Cannot submit OTLP spans: %v", err), submitErrorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// toJaegerBatches converts the spans to Jaeger batches, one per process, the spans of an OTLP resource
+// sharing the same process
+func toJaegerBatches(mSpans []*model.Span) []*jaeger.Batch {
+	var batches []*jaeger.Batch
+	batchByProcess := make(map[*model.Process]*jaeger.Batch)
+	for _, mSpan := range mSpans {
+		batch, ok := batchByProcess[mSpan.Process]
+		if !ok {
+			batch = &jaeger.Batch{Process: jConv.FromDomainProcess(mSpan.Process)}
+			batchByProcess[mSpan.Process] = batch
+			batches = append(batches, batch)
+		}
+		batch.Spans = append(batch.Spans, jConv.FromDomainSpan(mSpan))
+	}
+	return batches
+}
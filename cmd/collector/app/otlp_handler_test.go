@@ -0,0 +1,224 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+	tchanThrift "github.com/uber/tchannel-go/thrift"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/thrift-gen/jaeger"
+)
+
+const otlpJSONRequest = `{
+	"resourceSpans": [{
+		"resource": {"attributes": [{"key": "service.name", "value": {"stringValue": "svc"}}]},
+		"scopeSpans": [{
+			"spans": [{
+				"traceId": "00000000000000000000000000000001",
+				"spanId": "0000000000000002",
+				"name": "op",
+				"kind": 2
+			}]
+		}]
+	}]
+}`
+
+// otlpProtobufRequest is a resource with the service.name attribute and a span with trace ID 1 and span ID 2
+var otlpProtobufRequest = []byte{
+	0x0a, 0x3d,
+	0x0a, 0x17, 0x0a, 0x15, 0x0a, 0x0c, 's', 'e', 'r', 'v', 'i', 'c', 'e', '.', 'n', 'a', 'm', 'e', 0x12, 0x05, 0x0a, 0x03, 's', 'v', 'c',
+	0x12, 0x22, 0x12, 0x20,
+	0x0a, 0x10, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1,
+	0x12, 0x08, 0, 0, 0, 0, 0, 0, 0, 2,
+	0x2a, 0x02, 'o', 'p',
+}
+
+func initializeOTLPServer(processor SpanProcessor, metricsFactory metrics.Factory) *httptest.Server {
+	r := mux.NewRouter()
+	handler := NewOTLPSpanHandler(zap.NewNop(), processor, metricsFactory)
+	NewOTLPReceiver(zap.NewNop(), handler, "", metricsFactory).RegisterRoutes(r)
+	return httptest.NewServer(r)
+}
+
+func postOTLP(t *testing.T, url, contentType, encoding string, body []byte) (int, string, string) {
+	req, err := http.NewRequest(http.MethodPost, url+OTLPTracesPath, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", contentType)
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	res, err := httpClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	resBody, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	return res.StatusCode, res.Header.Get("Content-Type"), string(resBody)
+}
+
+func TestOTLPReceiver(t *testing.T) {
+	testCases := []struct {
+		caption      string
+		contentType  string
+		encoding     string
+		body         []byte
+		expectedBody string
+	}{
+		{caption: "json", contentType: "application/json", body: []byte(otlpJSONRequest), expectedBody: "{}"},
+		{caption: "protobuf", contentType: "application/x-protobuf", body: otlpProtobufRequest},
+		{caption: "gzip", contentType: "application/x-protobuf", encoding: "gzip", body: gzipBytes(t, otlpProtobufRequest)},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.caption, func(t *testing.T) {
+			processor := &recordingProcessor{}
+			server := initializeOTLPServer(processor, metrics.NullFactory)
+			defer server.Close()
+
+			status, contentType, body := postOTLP(t, server.URL, testCase.contentType, testCase.encoding, testCase.body)
+			assert.Equal(t, http.StatusOK, status)
+			assert.Equal(t, testCase.contentType, contentType)
+			assert.Equal(t, testCase.expectedBody, body)
+			assert.Equal(t, OTLPFormatType, processor.format)
+			if assert.Len(t, processor.spans, 1) {
+				span := processor.spans[0]
+				assert.Equal(t, model.TraceID{Low: 1}, span.TraceID)
+				assert.Equal(t, model.SpanID(2), span.SpanID)
+				assert.Equal(t, "op", span.OperationName)
+				assert.Equal(t, "svc", span.Process.ServiceName)
+			}
+		})
+	}
+}
+
+func TestOTLPReceiverErrors(t *testing.T) {
+	testCases := []struct {
+		caption        string
+		processor      SpanProcessor
+		contentType    string
+		body           []byte
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			caption:        "unsupported content type",
+			processor:      &recordingProcessor{},
+			contentType:    "text/plain",
+			body:           []byte(otlpJSONRequest),
+			expectedStatus: http.StatusUnsupportedMediaType,
+			expectedBody:   "Unsupported content type: text/plain\n",
+		},
+		{
+			caption:        "missing content type",
+			processor:      &recordingProcessor{},
+			body:           []byte(otlpJSONRequest),
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Cannot parse content type: mime: no media type\n",
+		},
+		{
+			caption:        "malformed payload",
+			processor:      &recordingProcessor{},
+			contentType:    "application/x-protobuf",
+			body:           []byte{0x0a, 0x05},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Unable to process request body: Truncated protobuf message\n",
+		},
+		{
+			caption:        "invalid span",
+			processor:      &recordingProcessor{},
+			contentType:    "application/json",
+			body:           []byte(`{"resourceSpans": [{"scopeSpans": [{"spans": [{"traceId": "01"}]}]}]}`),
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Unable to convert span: Invalid trace ID length 1, expected 16 bytes\n",
+		},
+		{
+			caption:        "busy",
+			processor:      busyProcessor{},
+			contentType:    "application/json",
+			body:           []byte(otlpJSONRequest),
+			expectedStatus: http.StatusTooManyRequests,
+		},
+		{
+			caption:        "processor error",
+			processor:      &shouldIErrorProcessor{true},
+			contentType:    "application/json",
+			body:           []byte(otlpJSONRequest),
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.caption, func(t *testing.T) {
+			metricsFactory := metrics.NewLocalFactory(0)
+			server := initializeOTLPServer(testCase.processor, metricsFactory)
+			defer server.Close()
+
+			status, _, body := postOTLP(t, server.URL, testCase.contentType, "", testCase.body)
+			assert.Equal(t, testCase.expectedStatus, status)
+			if testCase.expectedBody != "" {
+				assert.Equal(t, testCase.expectedBody, body)
+			}
+			counters, _ := metricsFactory.Snapshot()
+			assert.EqualValues(t, 1, counters["otlp.requests|encoding=identity"])
+		})
+	}
+}
+
+func TestOTLPReceiverRequestHeaders(t *testing.T) {
+	handler := &headersRecordingHandler{}
+	r := mux.NewRouter()
+	NewOTLPReceiver(zap.NewNop(), handler, "X-Tenant", metrics.NullFactory).RegisterRoutes(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+OTLPTracesPath, bytes.NewReader([]byte(otlpJSONRequest)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(AuthorizationHeader, "Bearer secret")
+	req.Header.Set("X-Tenant", "payments")
+	res, err := httpClient.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, map[string]string{AuthorizationHeader: "Bearer secret", "x-tenant": "payments"}, handler.headers)
+	if batches := handler.getBatches(); assert.Len(t, batches, 1) {
+		assert.Equal(t, "svc", batches[0].Process.ServiceName)
+		assert.Len(t, batches[0].Spans, 1)
+	}
+}
+
+type headersRecordingHandler struct {
+	mockJaegerHandler
+	headers map[string]string
+}
+
+func (h *headersRecordingHandler) SubmitBatches(ctx tchanThrift.Context, batches []*jaeger.Batch) ([]*jaeger.BatchSubmitResponse, error) {
+	h.headers = ctx.Headers()
+	return h.mockJaegerHandler.SubmitBatches(ctx, batches)
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+// RateLimits are the spans per second accepted by the collector from each service. A rate of 0,
+// or less, means unlimited, for the default rate and the rates of services alike.
+type RateLimits struct {
+	// Default is the rate of each service without its own rate
+	Default float64 `json:"default"`
+	// Services are the rates of individual services, keyed by service name
+	Services map[string]float64 `json:"services"`
+}
+
+// rate returns the rate of the service, which is unlimited if not positive
+func (l RateLimits) rate(serviceName string) float64 {
+	if rate, ok := l.Services[serviceName]; ok {
+		return rate
+	}
+	return l.Default
+}
+
+// LoadRateLimits reads RateLimits encoded as JSON
+func LoadRateLimits(r io.Reader) (RateLimits, error) {
+	var limits RateLimits
+	err := json.NewDecoder(r).Decode(&limits)
+	return limits, err
+}
+
+// tokenBucket allows up to rate items per second, with bursts of up to one second worth of items
+type tokenBucket struct {
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(rate float64, now time.Time) *tokenBucket {
+	b := &tokenBucket{last: now}
+	b.setRate(rate, now)
+	b.tokens = b.capacity
+	return b
+}
+
+// setRate changes the rate of the bucket, keeping the tokens it has up to the new capacity
+func (b *tokenBucket) setRate(rate float64, now time.Time) {
+	b.refill(now)
+	b.rate = rate
+	b.capacity = rate
+	if b.capacity < 1 {
+		b.capacity = 1
+	}
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+}
+
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// ServiceRateLimiter limits the rate of spans accepted from each service with a token bucket per service,
+// the services without their own rate getting a bucket at the default rate
+type ServiceRateLimiter struct {
+	sync.Mutex
+	limits  RateLimits
+	buckets map[string]*tokenBucket
+	// overflow is shared at the default rate by the services beyond the maximum number of buckets
+	overflow *tokenBucket
+	dropped  map[string]metrics.Counter
+	factory  metrics.Factory
+	timeNow  func() time.Time
+}
+
+// NewServiceRateLimiter creates a ServiceRateLimiter that counts the spans it drops in the given metrics factory
+func NewServiceRateLimiter(limits RateLimits, metricsFactory metrics.Factory) *ServiceRateLimiter {
+	l := &ServiceRateLimiter{
+		factory: metricsFactory,
+		dropped: make(map[string]metrics.Counter),
+		buckets: make(map[string]*tokenBucket),
+		timeNow: time.Now,
+	}
+	l.Update(limits)
+	return l
+}
+
+// Update replaces the rate limits, the buckets of services keeping their tokens so that a reload
+// does not let a burst of spans through
+func (l *ServiceRateLimiter) Update(limits RateLimits) {
+	l.Lock()
+	defer l.Unlock()
+	now := l.timeNow()
+	l.limits = limits
+	for serviceName, bucket := range l.buckets {
+		if rate := limits.rate(serviceName); rate > 0 {
+			bucket.setRate(rate, now)
+		} else {
+			delete(l.buckets, serviceName)
+		}
+	}
+	if l.overflow != nil {
+		if limits.Default > 0 {
+			l.overflow.setRate(limits.Default, now)
+		} else {
+			l.overflow = nil
+		}
+	}
+}
+
+// Allow returns false when the service of the span exceeded its rate, it can be used as a FilterSpan.
+func (l *ServiceRateLimiter) Allow(span *model.Span) bool {
+	serviceName := span.Process.ServiceName
+	l.Lock()
+	now := l.timeNow()
+	allowed := true
+	if bucket := l.bucket(serviceName, now); bucket != nil {
+		allowed = bucket.allow(now)
+	}
+	l.Unlock()
+	if !allowed {
+		l.countDropped(serviceName)
+	}
+	return allowed
+}
+
+// bucket returns the bucket of the service, created on its first span, or nil if the service is unlimited.
+// It must be called with the lock held.
+func (l *ServiceRateLimiter) bucket(serviceName string, now time.Time) *tokenBucket {
+	if bucket, ok := l.buckets[serviceName]; ok {
+		return bucket
+	}
+	rate := l.limits.rate(serviceName)
+	if rate <= 0 {
+		return nil
+	}
+	if _, ok := l.limits.Services[serviceName]; !ok && len(l.buckets) >= maxServiceNames {
+		if l.overflow == nil {
+			l.overflow = newTokenBucket(rate, now)
+		}
+		return l.overflow
+	}
+	bucket := newTokenBucket(rate, now)
+	l.buckets[serviceName] = bucket
+	return bucket
+}
+
+func (l *ServiceRateLimiter) countDropped(serviceName string) {
+	serviceName = NormalizeServiceName(serviceName)
+	l.Lock()
+	counter, ok := l.dropped[serviceName]
+	if !ok && len(l.dropped) < maxServiceNames {
+		counter = l.factory.Counter("spans.rate-limited", map[string]string{"service": serviceName})
+		l.dropped[serviceName] = counter
+	}
+	l.Unlock()
+	if counter != nil {
+		counter.Inc(1)
+	}
+}
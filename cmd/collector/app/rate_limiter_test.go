@@ -0,0 +1,135 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+func spanFromService(service string) *model.Span {
+	return &model.Span{Process: &model.Process{ServiceName: service}}
+}
+
+func TestServiceRateLimiter(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	limiter := NewServiceRateLimiter(RateLimits{
+		Default:  1,
+		Services: map[string]float64{"noisy": 2},
+	}, metricsFactory)
+	now := time.Unix(0, 0)
+	limiter.timeNow = func() time.Time { return now }
+	limiter.Update(limiter.limits)
+
+	assert.True(t, limiter.Allow(spanFromService("noisy")))
+	assert.True(t, limiter.Allow(spanFromService("noisy")))
+	assert.False(t, limiter.Allow(spanFromService("noisy")))
+
+	// unknown services each get a bucket at the default rate
+	assert.True(t, limiter.Allow(spanFromService("a")))
+	assert.False(t, limiter.Allow(spanFromService("a")))
+	assert.True(t, limiter.Allow(spanFromService("b")), "a service must not be starved by another one")
+
+	now = now.Add(500 * time.Millisecond)
+	assert.True(t, limiter.Allow(spanFromService("noisy")))
+	assert.False(t, limiter.Allow(spanFromService("noisy")))
+	assert.False(t, limiter.Allow(spanFromService("a")))
+
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counts["spans.rate-limited|service=noisy"])
+	assert.EqualValues(t, 2, counts["spans.rate-limited|service=a"])
+	assert.EqualValues(t, 0, counts["spans.rate-limited|service=b"])
+}
+
+func TestServiceRateLimiterUnlimited(t *testing.T) {
+	limiter := NewServiceRateLimiter(RateLimits{
+		Default:  1,
+		Services: map[string]float64{"unlimited": 0, "limited": 1},
+	}, metrics.NullFactory)
+	for i := 0; i < 100; i++ {
+		assert.True(t, limiter.Allow(spanFromService("unlimited")), "a service rate of 0 is unlimited")
+	}
+
+	limiter.Update(RateLimits{Services: map[string]float64{"limited": 1}})
+	assert.True(t, limiter.Allow(spanFromService("limited")))
+	assert.False(t, limiter.Allow(spanFromService("limited")))
+	for i := 0; i < 100; i++ {
+		assert.True(t, limiter.Allow(spanFromService("other")), "a default rate of 0 is unlimited")
+	}
+}
+
+func TestServiceRateLimiterOverflow(t *testing.T) {
+	limiter := NewServiceRateLimiter(RateLimits{Default: 1}, metrics.NullFactory)
+	now := time.Unix(0, 0)
+	limiter.timeNow = func() time.Time { return now }
+	for i := 0; i < maxServiceNames; i++ {
+		limiter.buckets[strconv.Itoa(i)] = newTokenBucket(1, now)
+	}
+	assert.True(t, limiter.Allow(spanFromService("a")))
+	assert.False(t, limiter.Allow(spanFromService("b")), "the services beyond the maximum share a bucket")
+	assert.Len(t, limiter.buckets, maxServiceNames)
+}
+
+func TestServiceRateLimiterUpdate(t *testing.T) {
+	limiter := NewServiceRateLimiter(RateLimits{Default: 1}, metrics.NullFactory)
+	now := time.Unix(0, 0)
+	limiter.timeNow = func() time.Time { return now }
+	limiter.Update(limiter.limits)
+
+	assert.True(t, limiter.Allow(spanFromService("svc")))
+	assert.False(t, limiter.Allow(spanFromService("svc")))
+
+	limiter.Update(RateLimits{Default: 1, Services: map[string]float64{"svc": 10}})
+	assert.False(t, limiter.Allow(spanFromService("svc")), "the tokens are kept across updates")
+	now = now.Add(time.Second)
+	for i := 0; i < 10; i++ {
+		assert.True(t, limiter.Allow(spanFromService("svc")))
+	}
+	assert.False(t, limiter.Allow(spanFromService("svc")))
+
+	limiter.Update(RateLimits{Default: 1, Services: map[string]float64{"svc": 2}})
+	now = now.Add(time.Hour)
+	assert.True(t, limiter.Allow(spanFromService("svc")))
+	assert.True(t, limiter.Allow(spanFromService("svc")))
+	assert.False(t, limiter.Allow(spanFromService("svc")), "the capacity follows the new rate")
+
+	limiter.Update(RateLimits{})
+	for i := 0; i < 100; i++ {
+		assert.True(t, limiter.Allow(spanFromService("svc")), "no limit when the default rate is 0")
+	}
+}
+
+func TestLoadRateLimits(t *testing.T) {
+	limits, err := LoadRateLimits(strings.NewReader(`{"default": 100, "services": {"svc": 1000}}`))
+	require.NoError(t, err)
+	assert.Equal(t, RateLimits{Default: 100, Services: map[string]float64{"svc": 1000}}, limits)
+
+	_, err = LoadRateLimits(strings.NewReader(`{`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+)
+
+const (
+	selfReference  = "self"
+	cycleReference = "cycle"
+)
+
+// ReferenceValidator removes the invalid references between the spans of a batch before they are saved:
+// references of a span to itself, and parent references closing a cycle between spans of the same trace.
+// The removed references are logged and counted in the spans.invalid-references metric.
+//
+// Spans referencing a parent that is missing from the trace are not repaired here, since the parent
+// may arrive in a later batch; the query service repairs them when the whole trace is read.
+type ReferenceValidator struct {
+	logger         *zap.Logger
+	selfReferences metrics.Counter
+	cycles         metrics.Counter
+}
+
+// NewReferenceValidator creates a ReferenceValidator
+func NewReferenceValidator(logger *zap.Logger, metricsFactory metrics.Factory) *ReferenceValidator {
+	return &ReferenceValidator{
+		logger:         logger,
+		selfReferences: metricsFactory.Counter("spans.invalid-references", map[string]string{"reason": selfReference}),
+		cycles:         metricsFactory.Counter("spans.invalid-references", map[string]string{"reason": cycleReference}),
+	}
+}
+
+// ValidateSpans removes the invalid references of the spans, it can be used as a ProcessSpans.
+func (v *ReferenceValidator) ValidateSpans(spans []*model.Span) {
+	byTrace := make(map[model.TraceID]map[model.SpanID]*model.Span)
+	for _, span := range spans {
+		if (span.ParentSpanID != 0 && span.ParentSpanID == span.SpanID) || hasReference(span, span.SpanID) {
+			v.removeReference(span, span.SpanID, selfReference)
+			v.selfReferences.Inc(1)
+		}
+		byID, ok := byTrace[span.TraceID]
+		if !ok {
+			byID = make(map[model.SpanID]*model.Span)
+			byTrace[span.TraceID] = byID
+		}
+		if _, ok := byID[span.SpanID]; !ok {
+			byID[span.SpanID] = span
+		}
+	}
+	for _, byID := range byTrace {
+		if len(byID) > 1 {
+			v.breakCycles(byID)
+		}
+	}
+}
+
+// breakCycles walks up the parents of each span, removing the parent reference of the span
+// whose parent is already on the walked path.
+func (v *ReferenceValidator) breakCycles(byID map[model.SpanID]*model.Span) {
+	const (
+		unvisited = iota
+		onPath
+		done
+	)
+	state := make(map[model.SpanID]int, len(byID))
+	var path []*model.Span
+	for _, span := range byID {
+		path = path[:0]
+		current := span
+		for current != nil && state[current.SpanID] == unvisited {
+			state[current.SpanID] = onPath
+			path = append(path, current)
+			current = parentOf(current, byID)
+		}
+		if current != nil && state[current.SpanID] == onPath {
+			v.removeReference(path[len(path)-1], current.SpanID, cycleReference)
+			v.cycles.Inc(1)
+		}
+		for _, s := range path {
+			state[s.SpanID] = done
+		}
+	}
+}
+
+func (v *ReferenceValidator) removeReference(span *model.Span, spanID model.SpanID, reason string) {
+	v.logger.Warn("Removed invalid span reference",
+		zap.String("reason", reason),
+		zap.String("trace_id", span.TraceID.String()),
+		zap.String("span_id", span.SpanID.String()),
+		zap.String("referenced_span_id", spanID.String()))
+	if span.ParentSpanID == spanID {
+		span.ParentSpanID = 0
+	}
+	refs := span.References[:0]
+	for _, ref := range span.References {
+		if ref.TraceID != span.TraceID || ref.SpanID != spanID {
+			refs = append(refs, ref)
+		}
+	}
+	span.References = refs
+}
+
+func parentOf(span *model.Span, byID map[model.SpanID]*model.Span) *model.Span {
+	if span.ParentSpanID == 0 {
+		return nil
+	}
+	return byID[span.ParentSpanID]
+}
+
+func hasReference(span *model.Span, spanID model.SpanID) bool {
+	for _, ref := range span.References {
+		if ref.TraceID == span.TraceID && ref.SpanID == spanID {
+			return true
+		}
+	}
+	return false
+}
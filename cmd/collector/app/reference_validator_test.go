@@ -0,0 +1,96 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+)
+
+func spanWithParent(traceID uint64, spanID, parentID model.SpanID) *model.Span {
+	span := &model.Span{
+		TraceID:      model.TraceID{Low: traceID},
+		SpanID:       spanID,
+		ParentSpanID: parentID,
+	}
+	if parentID != 0 {
+		span.References = []model.SpanRef{{RefType: model.ChildOf, TraceID: span.TraceID, SpanID: parentID}}
+	}
+	return span
+}
+
+func TestReferenceValidatorSelfReference(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	validator := NewReferenceValidator(zap.NewNop(), metricsFactory)
+	selfParent := spanWithParent(1, 2, 2)
+	selfFollows := spanWithParent(1, 3, 1)
+	selfFollows.References = append(selfFollows.References, model.SpanRef{RefType: model.FollowsFrom, TraceID: selfFollows.TraceID, SpanID: 3})
+	otherTrace := spanWithParent(1, 4, 0)
+	otherTrace.References = []model.SpanRef{{RefType: model.FollowsFrom, TraceID: model.TraceID{Low: 2}, SpanID: 4}}
+	validator.ValidateSpans([]*model.Span{selfParent, selfFollows, otherTrace, spanWithParent(1, 0, 0)})
+
+	assert.EqualValues(t, 0, selfParent.ParentSpanID)
+	assert.Empty(t, selfParent.References)
+	assert.EqualValues(t, 1, selfFollows.ParentSpanID)
+	assert.Equal(t, []model.SpanRef{{RefType: model.ChildOf, TraceID: selfFollows.TraceID, SpanID: 1}}, selfFollows.References)
+	assert.Len(t, otherTrace.References, 1, "the same span ID in another trace is not a self reference")
+
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counters["spans.invalid-references|reason=self"])
+	assert.EqualValues(t, 0, counters["spans.invalid-references|reason=cycle"])
+}
+
+func TestReferenceValidatorCycles(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	validator := NewReferenceValidator(zap.NewNop(), metricsFactory)
+	// 1 -> 2 -> 3 -> 1 is a cycle, 4 is a child of the cycle, 5 -> 6 is a valid chain
+	spans := []*model.Span{
+		spanWithParent(1, 1, 3),
+		spanWithParent(1, 2, 1),
+		spanWithParent(1, 3, 2),
+		spanWithParent(1, 4, 3),
+		spanWithParent(1, 5, 0),
+		spanWithParent(1, 6, 5),
+		// same span IDs in a different trace do not form a cycle with the ones above
+		spanWithParent(2, 1, 3),
+	}
+	validator.ValidateSpans(spans)
+
+	var roots int
+	for _, span := range spans[:3] {
+		if span.ParentSpanID == 0 {
+			roots++
+			assert.Empty(t, span.References)
+		}
+	}
+	assert.Equal(t, 1, roots, "a single reference of the cycle is removed")
+	assert.EqualValues(t, 3, spans[3].ParentSpanID)
+	assert.EqualValues(t, 5, spans[5].ParentSpanID)
+	assert.EqualValues(t, 3, spans[6].ParentSpanID)
+
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counters["spans.invalid-references|reason=cycle"])
+}
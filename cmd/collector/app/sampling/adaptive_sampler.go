@@ -0,0 +1,189 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sampling
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/uber/tchannel-go/thrift"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/cmd/collector/app/sampling/model"
+	jModel "github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/thrift-gen/sampling"
+)
+
+const (
+	// DefaultTargetSpansPerSecond is the default number of spans per second each operation should be sampled at
+	DefaultTargetSpansPerSecond = 1.0
+	// DefaultCalculationInterval is the default interval between sampling probability recalculations
+	DefaultCalculationInterval = time.Minute
+	// DefaultSamplingProbability is the probability used for operations the collector has no data about
+	DefaultSamplingProbability = 0.001
+	// MinSamplingProbability is the lowest probability the collector will hand out to an operation
+	MinSamplingProbability = 0.00001
+
+	defaultLowerBoundTracesPerSecond = 1.0 / 60
+	// decayFactor is how much of the distance to the default probability is kept by operations without traffic
+	decayFactor      = 0.5
+	decayedThreshold = 0.0001
+)
+
+// AdaptiveSamplerOptions are the settings used to calculate per-operation sampling probabilities.
+type AdaptiveSamplerOptions struct {
+	// TargetSpansPerSecond is the number of spans per second each operation should be sampled at
+	TargetSpansPerSecond float64
+	// CalculationInterval is how often the probabilities are recalculated from the observed throughput
+	CalculationInterval time.Duration
+}
+
+// AdaptiveSampler aggregates the throughput of the spans received by the collector and periodically
+// recalculates per service/operation sampling probabilities so that each operation is sampled at
+// roughly TargetSpansPerSecond. It implements sampling.TChanSamplingManager so that the computed
+// strategies can be served to agents.
+type AdaptiveSampler struct {
+	sync.RWMutex
+	options       AdaptiveSamplerOptions
+	logger        *zap.Logger
+	aggregator    *throughputAggregator
+	probabilities model.ServiceOperationProbabilities
+	done          chan struct{}
+}
+
+// NewAdaptiveSampler creates an AdaptiveSampler. Start needs to be called to begin recalculating probabilities.
+func NewAdaptiveSampler(options AdaptiveSamplerOptions, logger *zap.Logger) *AdaptiveSampler {
+	if options.TargetSpansPerSecond <= 0 {
+		options.TargetSpansPerSecond = DefaultTargetSpansPerSecond
+	}
+	if options.CalculationInterval <= 0 {
+		options.CalculationInterval = DefaultCalculationInterval
+	}
+	return &AdaptiveSampler{
+		options:       options,
+		logger:        logger,
+		aggregator:    newThroughputAggregator(),
+		probabilities: make(model.ServiceOperationProbabilities),
+		done:          make(chan struct{}),
+	}
+}
+
+// RecordSpan counts the span towards the throughput of its service and operation.
+func (s *AdaptiveSampler) RecordSpan(span *jModel.Span) {
+	s.aggregator.RecordSpan(span)
+}
+
+// Start begins the periodic recalculation of sampling probabilities.
+func (s *AdaptiveSampler) Start() {
+	go func() {
+		ticker := time.NewTicker(s.options.CalculationInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.calculateProbabilities(s.aggregator.flush())
+			case <-s.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts the recalculation of sampling probabilities.
+func (s *AdaptiveSampler) Stop() {
+	close(s.done)
+}
+
+func (s *AdaptiveSampler) calculateProbabilities(throughputs map[string]map[string]*model.Throughput) {
+	intervalSeconds := s.options.CalculationInterval.Seconds()
+	s.Lock()
+	defer s.Unlock()
+	// operations without traffic decay back to the default probability
+	for service, operations := range s.probabilities {
+		for operation, probability := range operations {
+			if _, ok := throughputs[service][operation]; ok {
+				continue
+			}
+			decayed := DefaultSamplingProbability + (probability-DefaultSamplingProbability)*decayFactor
+			if math.Abs(decayed-DefaultSamplingProbability) < decayedThreshold {
+				delete(operations, operation)
+			} else {
+				operations[operation] = decayed
+			}
+		}
+		if len(operations) == 0 {
+			delete(s.probabilities, service)
+		}
+	}
+	for service, operations := range throughputs {
+		if _, ok := s.probabilities[service]; !ok {
+			s.probabilities[service] = make(map[string]float64)
+		}
+		for operation, throughput := range operations {
+			qps := float64(throughput.Count) / intervalSeconds
+			s.probabilities[service][operation] = s.calculateProbability(s.probability(service, operation), qps)
+		}
+	}
+	s.logger.Debug("Recalculated sampling probabilities", zap.Int("services", len(s.probabilities)))
+}
+
+// calculateProbability scales the current probability by how far the observed qps is from the target.
+// The observed spans have already been sampled at the current probability, so the new probability is
+// proportional to it.
+func (s *AdaptiveSampler) calculateProbability(currentProbability, qps float64) float64 {
+	probability := currentProbability * s.options.TargetSpansPerSecond / qps
+	return math.Min(1.0, math.Max(MinSamplingProbability, probability))
+}
+
+func (s *AdaptiveSampler) probability(service, operation string) float64 {
+	if probability, ok := s.probabilities[service][operation]; ok {
+		return probability
+	}
+	return DefaultSamplingProbability
+}
+
+// GetSamplingStrategy implements sampling.TChanSamplingManager#GetSamplingStrategy
+func (s *AdaptiveSampler) GetSamplingStrategy(ctx thrift.Context, serviceName string) (*sampling.SamplingStrategyResponse, error) {
+	s.RLock()
+	defer s.RUnlock()
+	operations := s.probabilities[serviceName]
+	strategies := make([]*sampling.OperationSamplingStrategy, 0, len(operations))
+	for operation, probability := range operations {
+		strategies = append(strategies, &sampling.OperationSamplingStrategy{
+			Operation: operation,
+			ProbabilisticSampling: &sampling.ProbabilisticSamplingStrategy{
+				SamplingRate: probability,
+			},
+		})
+	}
+	return &sampling.SamplingStrategyResponse{
+		StrategyType: sampling.SamplingStrategyType_PROBABILISTIC,
+		ProbabilisticSampling: &sampling.ProbabilisticSamplingStrategy{
+			SamplingRate: DefaultSamplingProbability,
+		},
+		OperationSampling: &sampling.PerOperationSamplingStrategies{
+			DefaultSamplingProbability:       DefaultSamplingProbability,
+			DefaultLowerBoundTracesPerSecond: defaultLowerBoundTracesPerSecond,
+			PerOperationStrategies:           strategies,
+		},
+	}, nil
+}
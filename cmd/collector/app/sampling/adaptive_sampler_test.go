@@ -0,0 +1,131 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sampling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/cmd/collector/app/sampling/model"
+	jModel "github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/thrift-gen/sampling"
+)
+
+var _ sampling.TChanSamplingManager = &AdaptiveSampler{} // check API conformance
+
+func newTestSampler() *AdaptiveSampler {
+	return NewAdaptiveSampler(AdaptiveSamplerOptions{
+		TargetSpansPerSecond: 1,
+		CalculationInterval:  10 * time.Second,
+	}, zap.NewNop())
+}
+
+func throughputs(service, operation string, count int64) map[string]map[string]*model.Throughput {
+	return map[string]map[string]*model.Throughput{
+		service: {
+			operation: {Service: service, Operation: operation, Count: count},
+		},
+	}
+}
+
+func TestNewAdaptiveSamplerDefaults(t *testing.T) {
+	s := NewAdaptiveSampler(AdaptiveSamplerOptions{}, zap.NewNop())
+	assert.Equal(t, DefaultTargetSpansPerSecond, s.options.TargetSpansPerSecond)
+	assert.Equal(t, DefaultCalculationInterval, s.options.CalculationInterval)
+}
+
+func TestCalculateProbabilities(t *testing.T) {
+	s := newTestSampler()
+
+	// 100 spans in 10 seconds at the default probability is 10 times the target
+	s.calculateProbabilities(throughputs("svc", "op", 100))
+	assert.InDelta(t, DefaultSamplingProbability/10, s.probabilities["svc"]["op"], 1e-9)
+
+	// 1 span in 10 seconds is 10 times below the target
+	s.calculateProbabilities(throughputs("svc", "op", 1))
+	assert.InDelta(t, DefaultSamplingProbability, s.probabilities["svc"]["op"], 1e-9)
+
+	// probabilities never exceed 1
+	s.probabilities["svc"]["op"] = 0.5
+	s.calculateProbabilities(throughputs("svc", "op", 1))
+	assert.Equal(t, 1.0, s.probabilities["svc"]["op"])
+
+	// nor fall below the minimum
+	s.calculateProbabilities(throughputs("svc", "op", 1000000000))
+	assert.Equal(t, MinSamplingProbability, s.probabilities["svc"]["op"])
+}
+
+func TestCalculateProbabilitiesDecay(t *testing.T) {
+	s := newTestSampler()
+	s.probabilities["svc"] = map[string]float64{"op": 0.5}
+
+	s.calculateProbabilities(nil)
+	assert.InDelta(t, DefaultSamplingProbability+(0.5-DefaultSamplingProbability)/2, s.probabilities["svc"]["op"], 1e-9)
+
+	for i := 0; i < 20; i++ {
+		s.calculateProbabilities(nil)
+	}
+	assert.Empty(t, s.probabilities)
+}
+
+func TestGetSamplingStrategy(t *testing.T) {
+	s := newTestSampler()
+	s.probabilities["svc"] = map[string]float64{"op": 0.5}
+
+	resp, err := s.GetSamplingStrategy(nil, "svc")
+	require.NoError(t, err)
+	assert.Equal(t, sampling.SamplingStrategyType_PROBABILISTIC, resp.StrategyType)
+	require.NotNil(t, resp.OperationSampling)
+	assert.Equal(t, DefaultSamplingProbability, resp.OperationSampling.DefaultSamplingProbability)
+	require.Len(t, resp.OperationSampling.PerOperationStrategies, 1)
+	assert.Equal(t, "op", resp.OperationSampling.PerOperationStrategies[0].Operation)
+	assert.Equal(t, 0.5, resp.OperationSampling.PerOperationStrategies[0].ProbabilisticSampling.SamplingRate)
+
+	resp, err = s.GetSamplingStrategy(nil, "unknown")
+	require.NoError(t, err)
+	assert.Empty(t, resp.OperationSampling.PerOperationStrategies)
+}
+
+func TestAdaptiveSamplerStartStop(t *testing.T) {
+	s := NewAdaptiveSampler(AdaptiveSamplerOptions{
+		TargetSpansPerSecond: 1,
+		CalculationInterval:  time.Millisecond,
+	}, zap.NewNop())
+	s.Start()
+	defer s.Stop()
+	s.RecordSpan(&jModel.Span{
+		OperationName: "op",
+		Process:       &jModel.Process{ServiceName: "svc"},
+	})
+	for i := 0; i < 100; i++ {
+		resp, err := s.GetSamplingStrategy(nil, "svc")
+		require.NoError(t, err)
+		if len(resp.OperationSampling.PerOperationStrategies) == 1 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("sampling probabilities were not recalculated")
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sampling
+
+import (
+	"sync"
+
+	"github.com/uber/jaeger/cmd/collector/app/sampling/model"
+	jModel "github.com/uber/jaeger/model"
+)
+
+// throughputAggregator counts the spans received by the collector per service and operation.
+type throughputAggregator struct {
+	sync.Mutex
+	throughputs map[string]map[string]*model.Throughput
+}
+
+func newThroughputAggregator() *throughputAggregator {
+	return &throughputAggregator{
+		throughputs: make(map[string]map[string]*model.Throughput),
+	}
+}
+
+// RecordSpan increments the throughput of the span's service and operation.
+func (a *throughputAggregator) RecordSpan(span *jModel.Span) {
+	service := span.Process.ServiceName
+	operation := span.OperationName
+	if service == "" || operation == "" {
+		return
+	}
+	a.Lock()
+	defer a.Unlock()
+	operations, ok := a.throughputs[service]
+	if !ok {
+		operations = make(map[string]*model.Throughput)
+		a.throughputs[service] = operations
+	}
+	throughput, ok := operations[operation]
+	if !ok {
+		throughput = &model.Throughput{
+			Service:   service,
+			Operation: operation,
+		}
+		operations[operation] = throughput
+	}
+	throughput.Count++
+}
+
+// flush returns the throughput accumulated since the previous flush and resets the counts.
+func (a *throughputAggregator) flush() map[string]map[string]*model.Throughput {
+	a.Lock()
+	defer a.Unlock()
+	throughputs := a.throughputs
+	a.throughputs = make(map[string]map[string]*model.Throughput)
+	return throughputs
+}
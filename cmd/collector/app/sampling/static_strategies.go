@@ -0,0 +1,392 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sampling
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+	"github.com/uber/tchannel-go/thrift"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/storage/spanstore/tenancy"
+	"github.com/uber/jaeger/thrift-gen/sampling"
+)
+
+const (
+	// DefaultReloadInterval is the default interval between two checks of the static strategies file for changes
+	DefaultReloadInterval = 30 * time.Second
+
+	// ProbabilisticStrategyType samples traces with the probability given as the param of the Strategy
+	ProbabilisticStrategyType = "probabilistic"
+	// RateLimitingStrategyType samples up to the number of traces per second given as the param of the Strategy
+	RateLimitingStrategyType = "ratelimiting"
+)
+
+// Strategy is a sampling strategy in the static strategies file
+type Strategy struct {
+	// Type is either ProbabilisticStrategyType or RateLimitingStrategyType
+	Type  string  `json:"type"`
+	Param float64 `json:"param"`
+}
+
+// OperationStrategy is the probabilistic Strategy of an operation of a service
+type OperationStrategy struct {
+	Strategy
+	Operation string `json:"operation"`
+}
+
+// ServiceStrategy is the Strategy of a service, and the probabilistic strategies of some of its operations
+type ServiceStrategy struct {
+	Strategy
+	Service             string               `json:"service"`
+	OperationStrategies []*OperationStrategy `json:"operation_strategies"`
+}
+
+// StaticStrategies are the sampling strategies read from the static strategies file, e.g.
+//
+//	{
+//	  "default_strategy": {"type": "probabilistic", "param": 0.001},
+//	  "service_strategies": [
+//	    {"service": "foo", "type": "ratelimiting", "param": 5},
+//	    {"service": "bar", "type": "probabilistic", "param": 0.1,
+//	     "operation_strategies": [{"operation": "GET /health", "type": "probabilistic", "param": 0}]}
+//	  ],
+//	  "tenant_strategies": {
+//	    "team-a": {"default_strategy": {"type": "probabilistic", "param": 0.01},
+//	               "service_strategies": [{"service": "foo", "type": "probabilistic", "param": 1}]}
+//	  }
+//	}
+//
+// The services without a strategy get the default one, a probability of DefaultSamplingProbability if none.
+// The agents of a tenant of TenantStrategies get the strategies of the tenant, the services without a strategy of
+// the tenant getting the default strategy of the tenant, or else the strategies of all the tenants.
+type StaticStrategies struct {
+	DefaultStrategy   *Strategy          `json:"default_strategy"`
+	ServiceStrategies []*ServiceStrategy `json:"service_strategies"`
+	// TenantStrategies are the strategies of individual tenants, keyed by tenant, which cannot have their own
+	TenantStrategies map[string]*StaticStrategies `json:"tenant_strategies"`
+}
+
+// StaticStrategiesOptions are the settings of a StaticStrategyStore
+type StaticStrategiesOptions struct {
+	// File is the path of the JSON file holding the StaticStrategies
+	File string
+	// ReloadInterval is how often the file is checked for changes, never if 0
+	ReloadInterval time.Duration
+	// TenantHeader is the TChannel application header carrying the tenant of the agents requesting strategies,
+	// the TenantStrategies being ignored if empty
+	TenantHeader string
+}
+
+type staticStrategiesMetrics struct {
+	// Reloads counts the successful loads of the strategies file
+	Reloads metrics.Counter `metric:"sampling-strategies.reloads" tags:"result=ok"`
+	// ReloadFailures counts the loads of the strategies file rejected as invalid, the previous strategies are kept
+	ReloadFailures metrics.Counter `metric:"sampling-strategies.reloads" tags:"result=err"`
+	// LastReload is the Unix time in seconds of the last successful load of the strategies file
+	LastReload metrics.Gauge `metric:"sampling-strategies.last-reload-timestamp"`
+}
+
+// StaticStrategyStore serves the sampling strategies of a StaticStrategies file to agents and reloads them
+// when the file changes, so that the probabilities can be changed without restarting the collector.
+// An invalid file is rejected and the previous strategies are kept. It implements sampling.TChanSamplingManager.
+type StaticStrategyStore struct {
+	sync.RWMutex
+	options    StaticStrategiesOptions
+	logger     *zap.Logger
+	metrics    staticStrategiesMetrics
+	strategies *parsedStrategies
+	// modTime and size identify the version of the file last loaded
+	modTime time.Time
+	size    int64
+	done    chan struct{}
+	stopped sync.Once
+}
+
+// NewStaticStrategyStore creates a StaticStrategyStore, returning an error if the strategies file cannot be loaded.
+// It checks the file for changes every ReloadInterval until it is closed.
+func NewStaticStrategyStore(options StaticStrategiesOptions, logger *zap.Logger, metricsFactory metrics.Factory) (*StaticStrategyStore, error) {
+	s := &StaticStrategyStore{
+		options: options,
+		logger:  logger,
+		done:    make(chan struct{}),
+	}
+	metrics.Init(&s.metrics, metricsFactory, nil)
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	if options.ReloadInterval > 0 {
+		go s.watch()
+	}
+	return s, nil
+}
+
+func (s *StaticStrategyStore) watch() {
+	ticker := time.NewTicker(s.options.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !s.changed() {
+				continue
+			}
+			if err := s.Reload(); err != nil {
+				s.logger.Error("Kept the previous sampling strategies", zap.String("file", s.options.File), zap.Error(err))
+			} else {
+				s.logger.Info("Reloaded the sampling strategies", zap.String("file", s.options.File))
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// changed returns whether the file differs from the version last loaded
+func (s *StaticStrategyStore) changed() bool {
+	info, err := os.Stat(s.options.File)
+	if err != nil {
+		// a file being replaced may briefly be missing, it is loaded once it is back
+		return false
+	}
+	s.RLock()
+	defer s.RUnlock()
+	return !info.ModTime().Equal(s.modTime) || info.Size() != s.size
+}
+
+// Reload loads the strategies file, keeping the previous strategies if it is invalid
+func (s *StaticStrategyStore) Reload() error {
+	strategies, info, err := s.load()
+	s.Lock()
+	defer s.Unlock()
+	if info != nil {
+		// an invalid version is only reported once, the file is loaded again when it changes
+		s.modTime, s.size = info.ModTime(), info.Size()
+	}
+	if err != nil {
+		s.metrics.ReloadFailures.Inc(1)
+		return err
+	}
+	s.strategies = strategies
+	s.metrics.Reloads.Inc(1)
+	s.metrics.LastReload.Update(time.Now().Unix())
+	return nil
+}
+
+func (s *StaticStrategyStore) load() (*parsedStrategies, os.FileInfo, error) {
+	file, err := os.Open(s.options.File)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	var strategies StaticStrategies
+	if err := json.NewDecoder(file).Decode(&strategies); err != nil {
+		return nil, info, fmt.Errorf("Invalid sampling strategies file %s: %v", s.options.File, err)
+	}
+	parsed, err := parseAllStrategies(strategies)
+	if err != nil {
+		return nil, info, fmt.Errorf("Invalid sampling strategies file %s: %v", s.options.File, err)
+	}
+	return parsed, info, nil
+}
+
+// parsedStrategies are the strategies of a StaticStrategies, defaultStrategy being nil for a tenant without one
+type parsedStrategies struct {
+	defaultStrategy   *sampling.SamplingStrategyResponse
+	serviceStrategies map[string]*sampling.SamplingStrategyResponse
+	tenants           map[string]*parsedStrategies
+}
+
+func parseAllStrategies(strategies StaticStrategies) (*parsedStrategies, error) {
+	defaultStrategy, serviceStrategies, err := parseStaticStrategies(strategies)
+	if err != nil {
+		return nil, err
+	}
+	parsed := &parsedStrategies{
+		defaultStrategy:   defaultStrategy,
+		serviceStrategies: serviceStrategies,
+		tenants:           make(map[string]*parsedStrategies, len(strategies.TenantStrategies)),
+	}
+	for tenant, tenantStrategies := range strategies.TenantStrategies {
+		if !tenancy.ValidTenant(tenant) {
+			return nil, fmt.Errorf("invalid tenant %q", tenant)
+		}
+		if tenantStrategies == nil {
+			return nil, fmt.Errorf("tenant %s: no strategies", tenant)
+		}
+		if len(tenantStrategies.TenantStrategies) > 0 {
+			return nil, fmt.Errorf("tenant %s: nested tenant strategies", tenant)
+		}
+		defaultStrategy, serviceStrategies, err := parseStaticStrategies(*tenantStrategies)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %v", tenant, err)
+		}
+		if tenantStrategies.DefaultStrategy == nil {
+			defaultStrategy = nil
+		}
+		parsed.tenants[tenant] = &parsedStrategies{defaultStrategy: defaultStrategy, serviceStrategies: serviceStrategies}
+	}
+	return parsed, nil
+}
+
+func parseStaticStrategies(
+	strategies StaticStrategies,
+) (*sampling.SamplingStrategyResponse, map[string]*sampling.SamplingStrategyResponse, error) {
+	defaultStrategy := &sampling.SamplingStrategyResponse{
+		StrategyType:          sampling.SamplingStrategyType_PROBABILISTIC,
+		ProbabilisticSampling: &sampling.ProbabilisticSamplingStrategy{SamplingRate: DefaultSamplingProbability},
+	}
+	if strategies.DefaultStrategy != nil {
+		var err error
+		if defaultStrategy, err = parseStrategy(*strategies.DefaultStrategy); err != nil {
+			return nil, nil, fmt.Errorf("default strategy: %v", err)
+		}
+	}
+	serviceStrategies := make(map[string]*sampling.SamplingStrategyResponse, len(strategies.ServiceStrategies))
+	for _, serviceStrategy := range strategies.ServiceStrategies {
+		if serviceStrategy.Service == "" {
+			return nil, nil, errors.New("service strategy without a service")
+		}
+		if _, ok := serviceStrategies[serviceStrategy.Service]; ok {
+			return nil, nil, fmt.Errorf("service %s: duplicate strategy", serviceStrategy.Service)
+		}
+		strategy, err := parseStrategy(serviceStrategy.Strategy)
+		if err != nil {
+			return nil, nil, fmt.Errorf("service %s: %v", serviceStrategy.Service, err)
+		}
+		if len(serviceStrategy.OperationStrategies) > 0 {
+			if strategy.OperationSampling, err = parseOperationStrategies(strategy, serviceStrategy.OperationStrategies); err != nil {
+				return nil, nil, fmt.Errorf("service %s: %v", serviceStrategy.Service, err)
+			}
+		}
+		serviceStrategies[serviceStrategy.Service] = strategy
+	}
+	return defaultStrategy, serviceStrategies, nil
+}
+
+func parseStrategy(strategy Strategy) (*sampling.SamplingStrategyResponse, error) {
+	switch strategy.Type {
+	case ProbabilisticStrategyType:
+		if strategy.Param < 0 || strategy.Param > 1 {
+			return nil, fmt.Errorf("probability %v is not within [0, 1]", strategy.Param)
+		}
+		return &sampling.SamplingStrategyResponse{
+			StrategyType:          sampling.SamplingStrategyType_PROBABILISTIC,
+			ProbabilisticSampling: &sampling.ProbabilisticSamplingStrategy{SamplingRate: strategy.Param},
+		}, nil
+	case RateLimitingStrategyType:
+		if strategy.Param < 0 || strategy.Param > math.MaxInt16 {
+			return nil, fmt.Errorf("rate %v is not within [0, %d]", strategy.Param, math.MaxInt16)
+		}
+		return &sampling.SamplingStrategyResponse{
+			StrategyType:         sampling.SamplingStrategyType_RATE_LIMITING,
+			RateLimitingSampling: &sampling.RateLimitingSamplingStrategy{MaxTracesPerSecond: int16(strategy.Param)},
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown strategy type %q", strategy.Type)
+}
+
+// parseOperationStrategies returns the per-operation strategies of a service, whose other operations are
+// sampled with the probability of the service strategy, or DefaultSamplingProbability if it is rate limiting
+func parseOperationStrategies(
+	serviceStrategy *sampling.SamplingStrategyResponse,
+	operationStrategies []*OperationStrategy,
+) (*sampling.PerOperationSamplingStrategies, error) {
+	defaultProbability := DefaultSamplingProbability
+	if serviceStrategy.ProbabilisticSampling != nil {
+		defaultProbability = serviceStrategy.ProbabilisticSampling.SamplingRate
+	}
+	strategies := make([]*sampling.OperationSamplingStrategy, 0, len(operationStrategies))
+	for _, operationStrategy := range operationStrategies {
+		if operationStrategy.Type != ProbabilisticStrategyType {
+			return nil, fmt.Errorf("operation %s: only probabilistic strategies are supported", operationStrategy.Operation)
+		}
+		strategy, err := parseStrategy(operationStrategy.Strategy)
+		if err != nil {
+			return nil, fmt.Errorf("operation %s: %v", operationStrategy.Operation, err)
+		}
+		strategies = append(strategies, &sampling.OperationSamplingStrategy{
+			Operation:             operationStrategy.Operation,
+			ProbabilisticSampling: strategy.ProbabilisticSampling,
+		})
+	}
+	return &sampling.PerOperationSamplingStrategies{
+		DefaultSamplingProbability:       defaultProbability,
+		DefaultLowerBoundTracesPerSecond: defaultLowerBoundTracesPerSecond,
+		PerOperationStrategies:           strategies,
+	}, nil
+}
+
+// GetSamplingStrategy implements sampling.TChanSamplingManager#GetSamplingStrategy. The agents of an invalid or
+// unknown tenant get the strategies of all the tenants, with a warning logged.
+func (s *StaticStrategyStore) GetSamplingStrategy(ctx thrift.Context, serviceName string) (*sampling.SamplingStrategyResponse, error) {
+	tenant := s.tenant(ctx)
+	s.RLock()
+	defer s.RUnlock()
+	if tenant != "" {
+		if tenantStrategies, ok := s.strategies.tenants[tenant]; ok {
+			if strategy, ok := tenantStrategies.serviceStrategies[serviceName]; ok {
+				return strategy, nil
+			}
+			if tenantStrategies.defaultStrategy != nil {
+				return tenantStrategies.defaultStrategy, nil
+			}
+		} else {
+			s.logger.Warn("Serving the default sampling strategies to an unknown tenant",
+				zap.String("tenant", tenant), zap.String("service", serviceName))
+		}
+	}
+	if strategy, ok := s.strategies.serviceStrategies[serviceName]; ok {
+		return strategy, nil
+	}
+	return s.strategies.defaultStrategy, nil
+}
+
+// tenant returns the tenant of the agent requesting strategies, empty if it sent none or an invalid one
+func (s *StaticStrategyStore) tenant(ctx thrift.Context) string {
+	if s.options.TenantHeader == "" || ctx == nil {
+		return ""
+	}
+	tenant := ctx.Headers()[s.options.TenantHeader]
+	if tenant != "" && !tenancy.ValidTenant(tenant) {
+		s.logger.Warn("Serving the default sampling strategies to an invalid tenant", zap.String("tenant", tenant))
+		return ""
+	}
+	return tenant
+}
+
+// Close stops checking the strategies file for changes
+func (s *StaticStrategyStore) Close() error {
+	s.stopped.Do(func() {
+		close(s.done)
+	})
+	return nil
+}
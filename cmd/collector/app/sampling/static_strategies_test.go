@@ -0,0 +1,245 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sampling
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+	tchanThrift "github.com/uber/tchannel-go/thrift"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/thrift-gen/sampling"
+)
+
+var _ sampling.TChanSamplingManager = &StaticStrategyStore{} // check API conformance
+
+const testStrategies = `{
+	"default_strategy": {"type": "probabilistic", "param": 0.5},
+	"service_strategies": [
+		{"service": "foo", "type": "ratelimiting", "param": 5},
+		{"service": "bar", "type": "probabilistic", "param": 0.1,
+		 "operation_strategies": [{"operation": "op", "type": "probabilistic", "param": 0.2}]}
+	]
+}`
+
+func writeStrategies(t *testing.T, path, content string) {
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+}
+
+func newTestStrategiesFile(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "strategies")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	writeStrategies(t, file.Name(), content)
+	return file.Name()
+}
+
+func TestStaticStrategyStore(t *testing.T) {
+	path := newTestStrategiesFile(t, testStrategies)
+	defer os.Remove(path)
+	metricsFactory := metrics.NewLocalFactory(0)
+	store, err := NewStaticStrategyStore(StaticStrategiesOptions{File: path}, zap.NewNop(), metricsFactory)
+	require.NoError(t, err)
+	defer store.Close()
+
+	resp, err := store.GetSamplingStrategy(nil, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, sampling.SamplingStrategyType_RATE_LIMITING, resp.StrategyType)
+	assert.EqualValues(t, 5, resp.RateLimitingSampling.MaxTracesPerSecond)
+
+	resp, err = store.GetSamplingStrategy(nil, "bar")
+	require.NoError(t, err)
+	assert.Equal(t, 0.1, resp.ProbabilisticSampling.SamplingRate)
+	require.NotNil(t, resp.OperationSampling)
+	assert.Equal(t, 0.1, resp.OperationSampling.DefaultSamplingProbability)
+	require.Len(t, resp.OperationSampling.PerOperationStrategies, 1)
+	assert.Equal(t, "op", resp.OperationSampling.PerOperationStrategies[0].Operation)
+	assert.Equal(t, 0.2, resp.OperationSampling.PerOperationStrategies[0].ProbabilisticSampling.SamplingRate)
+
+	resp, err = store.GetSamplingStrategy(nil, "other")
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, resp.ProbabilisticSampling.SamplingRate)
+
+	counters, gauges := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counters["sampling-strategies.reloads|result=ok"])
+	assert.NotZero(t, gauges["sampling-strategies.last-reload-timestamp"])
+}
+
+func TestStaticStrategyStoreTenants(t *testing.T) {
+	path := newTestStrategiesFile(t, `{
+		"default_strategy": {"type": "probabilistic", "param": 0.5},
+		"service_strategies": [{"service": "foo", "type": "ratelimiting", "param": 5}],
+		"tenant_strategies": {
+			"team-a": {"default_strategy": {"type": "probabilistic", "param": 0.01},
+			           "service_strategies": [{"service": "bar", "type": "probabilistic", "param": 1}]},
+			"team-b": {"service_strategies": [{"service": "bar", "type": "probabilistic", "param": 0.2}]}
+		}
+	}`)
+	defer os.Remove(path)
+	store, err := NewStaticStrategyStore(StaticStrategiesOptions{File: path, TenantHeader: "tenant"}, zap.NewNop(), metrics.NullFactory)
+	require.NoError(t, err)
+	defer store.Close()
+	tenantContext := func(tenant string) tchanThrift.Context {
+		return tchanThrift.WithHeaders(context.Background(), map[string]string{"tenant": tenant})
+	}
+
+	testCases := []struct {
+		ctx          tchanThrift.Context
+		service      string
+		probability  float64
+		rateLimiting bool
+	}{
+		{ctx: tenantContext("team-a"), service: "bar", probability: 1},
+		{ctx: tenantContext("team-a"), service: "foo", probability: 0.01},
+		{ctx: tenantContext("team-b"), service: "bar", probability: 0.2},
+		{ctx: tenantContext("team-b"), service: "foo", rateLimiting: true},
+		{ctx: tenantContext("team-b"), service: "other", probability: 0.5},
+		{ctx: tenantContext("unknown"), service: "bar", probability: 0.5},
+		{ctx: tenantContext("team/a"), service: "bar", probability: 0.5},
+		{ctx: tenantContext(""), service: "bar", probability: 0.5},
+		{ctx: nil, service: "bar", probability: 0.5},
+	}
+	for _, testCase := range testCases {
+		resp, err := store.GetSamplingStrategy(testCase.ctx, testCase.service)
+		require.NoError(t, err)
+		if testCase.rateLimiting {
+			assert.Equal(t, sampling.SamplingStrategyType_RATE_LIMITING, resp.StrategyType)
+		} else {
+			assert.Equal(t, testCase.probability, resp.ProbabilisticSampling.SamplingRate)
+		}
+	}
+
+	store, err = NewStaticStrategyStore(StaticStrategiesOptions{File: path}, zap.NewNop(), metrics.NullFactory)
+	require.NoError(t, err)
+	defer store.Close()
+	resp, err := store.GetSamplingStrategy(tenantContext("team-a"), "bar")
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, resp.ProbabilisticSampling.SamplingRate, "the tenants are ignored without a header")
+}
+
+func TestStaticStrategyStoreDefault(t *testing.T) {
+	path := newTestStrategiesFile(t, `{}`)
+	defer os.Remove(path)
+	store, err := NewStaticStrategyStore(StaticStrategiesOptions{File: path}, zap.NewNop(), metrics.NullFactory)
+	require.NoError(t, err)
+	defer store.Close()
+	resp, err := store.GetSamplingStrategy(nil, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultSamplingProbability, resp.ProbabilisticSampling.SamplingRate)
+}
+
+func TestStaticStrategyStoreInvalid(t *testing.T) {
+	testCases := []struct {
+		strategies string
+		err        string
+	}{
+		{strategies: `{`, err: "unexpected EOF"},
+		{strategies: `{"default_strategy": {"type": "adaptive"}}`, err: `default strategy: unknown strategy type "adaptive"`},
+		{strategies: `{"default_strategy": {"type": "probabilistic", "param": 2}}`, err: "default strategy: probability 2 is not within [0, 1]"},
+		{strategies: `{"service_strategies": [{"type": "probabilistic"}]}`, err: "service strategy without a service"},
+		{
+			strategies: `{"service_strategies": [{"service": "foo", "type": "ratelimiting", "param": 100000}]}`,
+			err:        "service foo: rate 100000 is not within [0, 32767]",
+		},
+		{
+			strategies: `{"service_strategies": [{"service": "foo", "type": "probabilistic"}, {"service": "foo", "type": "probabilistic"}]}`,
+			err:        "service foo: duplicate strategy",
+		},
+		{
+			strategies: `{"service_strategies": [{"service": "foo", "type": "probabilistic",
+				"operation_strategies": [{"operation": "op", "type": "ratelimiting", "param": 1}]}]}`,
+			err: "service foo: operation op: only probabilistic strategies are supported",
+		},
+		{strategies: `{"tenant_strategies": {"team/a": {}}}`, err: `invalid tenant "team/a"`},
+		{strategies: `{"tenant_strategies": {"team-a": null}}`, err: "tenant team-a: no strategies"},
+		{strategies: `{"tenant_strategies": {"team-a": {"tenant_strategies": {"team-b": {}}}}}`, err: "tenant team-a: nested tenant strategies"},
+		{
+			strategies: `{"tenant_strategies": {"team-a": {"default_strategy": {"type": "adaptive"}}}}`,
+			err:        `tenant team-a: default strategy: unknown strategy type "adaptive"`,
+		},
+	}
+	for _, testCase := range testCases {
+		path := newTestStrategiesFile(t, testCase.strategies)
+		_, err := NewStaticStrategyStore(StaticStrategiesOptions{File: path}, zap.NewNop(), metrics.NullFactory)
+		os.Remove(path)
+		require.Error(t, err, testCase.strategies)
+		assert.Contains(t, err.Error(), testCase.err)
+	}
+
+	_, err := NewStaticStrategyStore(StaticStrategiesOptions{File: "missing.json"}, zap.NewNop(), metrics.NullFactory)
+	assert.Error(t, err)
+}
+
+func TestStaticStrategyStoreReload(t *testing.T) {
+	path := newTestStrategiesFile(t, testStrategies)
+	defer os.Remove(path)
+	metricsFactory := metrics.NewLocalFactory(0)
+	store, err := NewStaticStrategyStore(StaticStrategiesOptions{File: path}, zap.NewNop(), metricsFactory)
+	require.NoError(t, err)
+	defer store.Close()
+
+	writeStrategies(t, path, `{"default_strategy": {"type": "unknown"}}`)
+	assert.Error(t, store.Reload())
+	resp, err := store.GetSamplingStrategy(nil, "other")
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, resp.ProbabilisticSampling.SamplingRate, "the previous strategies are kept")
+
+	writeStrategies(t, path, `{"default_strategy": {"type": "probabilistic", "param": 0.25}}`)
+	require.NoError(t, store.Reload())
+	resp, err = store.GetSamplingStrategy(nil, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, 0.25, resp.ProbabilisticSampling.SamplingRate)
+
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counters["sampling-strategies.reloads|result=ok"])
+	assert.EqualValues(t, 1, counters["sampling-strategies.reloads|result=err"])
+}
+
+func TestStaticStrategyStoreWatch(t *testing.T) {
+	path := newTestStrategiesFile(t, testStrategies)
+	defer os.Remove(path)
+	store, err := NewStaticStrategyStore(
+		StaticStrategiesOptions{File: path, ReloadInterval: 10 * time.Millisecond},
+		zap.NewNop(),
+		metrics.NullFactory,
+	)
+	require.NoError(t, err)
+	defer store.Close()
+
+	// the modification time may have a coarse resolution, the size differs as well
+	writeStrategies(t, path, `{"default_strategy": {"type": "probabilistic", "param": 0.125}}`)
+	for i := 0; i < 100; i++ {
+		resp, err := store.GetSamplingStrategy(nil, "other")
+		require.NoError(t, err)
+		if resp.ProbabilisticSampling.SamplingRate == 0.125 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("the changed strategies file was not reloaded")
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"sync"
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+const (
+	// HeadSamplingTag is the span tag recording why the client sampled the trace, e.g. probabilistic or debug.
+	// It is kept when the span already has it, so that decisions recorded upstream are not lost.
+	HeadSamplingTag = "sampling.head"
+	// TailSamplingTag is the span tag recording why a TailSampler kept the span after it was received
+	TailSamplingTag = "sampling.tail"
+
+	// samplerTypeTag is set by the Jaeger clients on the root span of sampled traces
+	samplerTypeTag = "sampler.type"
+	debugReason    = "debug"
+	otherReason    = "other"
+	// durationReason is the tail sampling reason of the spans kept for lasting at least the duration threshold
+	durationReason = "duration"
+)
+
+// headSamplingReasons are the sampler types of the Jaeger clients, other reasons being counted together
+var headSamplingReasons = []string{"const", "probabilistic", "ratelimiting", "lowerbound", "remote", debugReason}
+
+// TailSampler decides whether spans are kept after they were received by the collector
+type TailSampler interface {
+	// TailSample returns the reason the span is kept, decided being false when the sampler made no decision
+	TailSample(span *model.Span) (reason string, decided bool)
+}
+
+// NewDurationTailSampler creates a TailSampler keeping the spans not sampled by the clients that last at
+// least the threshold, the decision made by the tail sampling of the span storage with the same threshold.
+func NewDurationTailSampler(threshold time.Duration) TailSampler {
+	return durationTailSampler(threshold)
+}
+
+type durationTailSampler time.Duration
+
+func (s durationTailSampler) TailSample(span *model.Span) (string, bool) {
+	if span.Flags.IsSampled() || span.Duration < time.Duration(s) {
+		return "", false
+	}
+	return durationReason, true
+}
+
+// SamplingDecisionRecorder tags the spans with the sampling decisions made by the clients and by the
+// TailSampler, so that the stored traces can be searched by sampling reason. The decisions are counted
+// in the spans.sampling-decisions metric.
+type SamplingDecisionRecorder struct {
+	sync.Mutex
+	tailSampler    TailSampler
+	metricsFactory metrics.Factory
+	head           map[string]metrics.Counter
+	tail           map[string]metrics.Counter
+}
+
+// NewSamplingDecisionRecorder creates a SamplingDecisionRecorder, tailSampler can be nil
+func NewSamplingDecisionRecorder(tailSampler TailSampler, metricsFactory metrics.Factory) *SamplingDecisionRecorder {
+	r := &SamplingDecisionRecorder{
+		tailSampler:    tailSampler,
+		metricsFactory: metricsFactory,
+		head:           make(map[string]metrics.Counter),
+		tail:           make(map[string]metrics.Counter),
+	}
+	for _, reason := range append(headSamplingReasons, otherReason) {
+		r.head[reason] = r.counter("head", reason)
+	}
+	return r
+}
+
+// RecordDecisions tags the spans with their sampling decisions, it can be used as a ProcessSpans.
+func (r *SamplingDecisionRecorder) RecordDecisions(spans []*model.Span) {
+	for _, span := range spans {
+		if reason, ok := headSamplingReason(span); ok {
+			r.countHead(reason)
+		}
+		if r.tailSampler != nil {
+			r.recordTailDecision(span)
+		}
+	}
+}
+
+// headSamplingReason returns the head sampling decision of the span, tagging the span when it was not
+func headSamplingReason(span *model.Span) (string, bool) {
+	if tag, ok := span.Tags.FindByKey(HeadSamplingTag); ok {
+		return tag.AsString(), true
+	}
+	var reason string
+	if span.Flags.IsDebug() {
+		reason = debugReason
+	} else if tag, ok := span.Tags.FindByKey(samplerTypeTag); ok {
+		reason = tag.AsString()
+	} else {
+		// only the root span of the trace carries the decision
+		return "", false
+	}
+	span.Tags = append(span.Tags, model.String(HeadSamplingTag, reason))
+	return reason, true
+}
+
+func (r *SamplingDecisionRecorder) recordTailDecision(span *model.Span) {
+	if _, ok := span.Tags.FindByKey(TailSamplingTag); ok {
+		return
+	}
+	reason, decided := r.tailSampler.TailSample(span)
+	if !decided {
+		return
+	}
+	span.Tags = append(span.Tags, model.String(TailSamplingTag, reason))
+	r.countTail(reason)
+}
+
+func (r *SamplingDecisionRecorder) countHead(reason string) {
+	counter, ok := r.head[reason]
+	if !ok {
+		counter = r.head[otherReason]
+	}
+	counter.Inc(1)
+}
+
+// countTail creates the counters of tail sampling reasons on first use, since they depend on the TailSampler
+func (r *SamplingDecisionRecorder) countTail(reason string) {
+	r.Lock()
+	counter, ok := r.tail[reason]
+	if !ok {
+		counter = r.counter("tail", reason)
+		r.tail[reason] = counter
+	}
+	r.Unlock()
+	counter.Inc(1)
+}
+
+func (r *SamplingDecisionRecorder) counter(decision, reason string) metrics.Counter {
+	return r.metricsFactory.Counter("spans.sampling-decisions", map[string]string{"decision": decision, "reason": reason})
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/pkg/cache"
+)
+
+const (
+	// DefaultSamplingDecisionCacheSize is the number of traces whose sampling decision is remembered by default
+	DefaultSamplingDecisionCacheSize = 10000
+	// DefaultSamplingDecisionCacheTTL is how long the sampling decision of a trace is remembered by default
+	DefaultSamplingDecisionCacheTTL = 5 * time.Minute
+)
+
+// SamplingDecisionCacheOptions configures a SamplingDecisionCache
+type SamplingDecisionCacheOptions struct {
+	// Size is the maximum number of traces whose decision is remembered, the least recently used being evicted
+	Size int
+	// TTL is how long the decision of a trace is remembered, DefaultSamplingDecisionCacheTTL if zero
+	TTL time.Duration
+}
+
+// samplingDecision is the keep or drop decision made for a trace
+type samplingDecision struct {
+	reason string
+	kept   bool
+}
+
+// SamplingDecisionCache remembers the keep or drop decision made for the first span of a trace, so that the later
+// spans of the trace honor it instead of being sampled independently, e.g. by a rate limiting sub-sampler, which
+// would store fragments of the trace. The lookups are counted by the sampling-decisions.cache metric, tagged with
+// the hit or miss result.
+type SamplingDecisionCache struct {
+	decisions *cache.LRU
+	hits      metrics.Counter
+	misses    metrics.Counter
+}
+
+// NewSamplingDecisionCache creates a SamplingDecisionCache counting the lookups in the metrics factory
+func NewSamplingDecisionCache(options SamplingDecisionCacheOptions, metricsFactory metrics.Factory) *SamplingDecisionCache {
+	return newSamplingDecisionCache(options, metricsFactory, time.Now)
+}
+
+func newSamplingDecisionCache(options SamplingDecisionCacheOptions, metricsFactory metrics.Factory, timeNow func() time.Time) *SamplingDecisionCache {
+	if options.TTL == 0 {
+		options.TTL = DefaultSamplingDecisionCacheTTL
+	}
+	return &SamplingDecisionCache{
+		decisions: cache.NewLRUWithOptions(options.Size, &cache.Options{TTL: options.TTL, TimeNow: timeNow}),
+		hits:      metricsFactory.Counter("sampling-decisions.cache", map[string]string{"result": "hit"}),
+		misses:    metricsFactory.Counter("sampling-decisions.cache", map[string]string{"result": "miss"}),
+	}
+}
+
+// Decide returns the decision remembered for the trace, or makes it with decide and remembers it. When spans of
+// the same trace are decided concurrently, the first remembered decision is returned to all of them.
+func (c *SamplingDecisionCache) Decide(traceID model.TraceID, decide func() (string, bool)) (string, bool) {
+	key := traceID.String()
+	if decision, ok := c.decisions.Get(key).(*samplingDecision); ok {
+		c.hits.Inc(1)
+		return decision.reason, decision.kept
+	}
+	c.misses.Inc(1)
+	reason, kept := decide()
+	item, _ := c.decisions.CompareAndSwap(key, nil, &samplingDecision{reason: reason, kept: kept})
+	decision := item.(*samplingDecision)
+	return decision.reason, decision.kept
+}
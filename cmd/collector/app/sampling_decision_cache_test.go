@@ -0,0 +1,90 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+func TestSamplingDecisionCache(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	now := time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+	c := newSamplingDecisionCache(SamplingDecisionCacheOptions{Size: 2, TTL: time.Minute}, metricsFactory,
+		func() time.Time { return now })
+	decisions := 0
+	decide := func(reason string, kept bool) func() (string, bool) {
+		return func() (string, bool) {
+			decisions++
+			return reason, kept
+		}
+	}
+
+	reason, kept := c.Decide(model.TraceID{Low: 1}, decide("baseline", true))
+	assert.True(t, kept)
+	assert.Equal(t, "baseline", reason)
+	reason, kept = c.Decide(model.TraceID{Low: 1}, decide("", false))
+	assert.True(t, kept, "the decision of the trace is honored")
+	assert.Equal(t, "baseline", reason)
+	_, kept = c.Decide(model.TraceID{Low: 2}, decide("", false))
+	assert.False(t, kept)
+	_, kept = c.Decide(model.TraceID{Low: 2}, decide("baseline", true))
+	assert.False(t, kept, "the decision of the trace is honored")
+	assert.Equal(t, 2, decisions)
+
+	now = now.Add(2 * time.Minute)
+	_, kept = c.Decide(model.TraceID{Low: 2}, decide("baseline", true))
+	assert.True(t, kept, "the expired decision is made again")
+	c.Decide(model.TraceID{Low: 3}, decide("", false))
+	c.Decide(model.TraceID{Low: 4}, decide("", false))
+	_, kept = c.Decide(model.TraceID{Low: 2}, decide("", false))
+	assert.False(t, kept, "the least recently used decision is evicted")
+	assert.Equal(t, 6, decisions)
+
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counts["sampling-decisions.cache|result=hit"])
+	assert.EqualValues(t, 6, counts["sampling-decisions.cache|result=miss"])
+}
+
+func TestCompositeSamplerDecisionCache(t *testing.T) {
+	decisions := NewSamplingDecisionCache(SamplingDecisionCacheOptions{Size: 10}, metrics.NullFactory)
+	s, err := NewCompositeSampler(CompositeSamplingConfig{Samplers: []SamplerConfig{
+		{Name: "floor", Type: RateLimitingSampler, Rate: 1},
+	}}, 0, decisions, metrics.NullFactory)
+	require.NoError(t, err)
+
+	first := []*model.Span{spanForSampling(1), spanForSampling(2)}
+	s.SampleSpans(first)
+	assert.True(t, first[0].Flags.IsSampled())
+	assert.False(t, first[1].Flags.IsSampled())
+
+	later := []*model.Span{spanForSampling(1), spanForSampling(2)}
+	s.SampleSpans(later)
+	assert.True(t, later[0].Flags.IsSampled(), "the later spans of a kept trace are kept")
+	assert.Equal(t, model.KeyValues{model.String(TailSamplingTag, "floor")}, later[0].Tags)
+	assert.False(t, later[1].Flags.IsSampled(), "the later spans of a dropped trace are dropped")
+}
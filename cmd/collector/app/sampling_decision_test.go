@@ -0,0 +1,108 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+type operationTailSampler map[string]string
+
+func (s operationTailSampler) TailSample(span *model.Span) (string, bool) {
+	reason, ok := s[span.OperationName]
+	return reason, ok
+}
+
+func TestSamplingDecisionRecorderHead(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	recorder := NewSamplingDecisionRecorder(nil, metricsFactory)
+	probabilistic := &model.Span{Tags: model.KeyValues{model.String(samplerTypeTag, "probabilistic")}}
+	debug := &model.Span{Flags: model.Flags(3), Tags: model.KeyValues{model.String(samplerTypeTag, "const")}}
+	upstream := &model.Span{Tags: model.KeyValues{
+		model.String(HeadSamplingTag, "ratelimiting"),
+		model.String(samplerTypeTag, "const"),
+	}}
+	custom := &model.Span{Tags: model.KeyValues{model.String(samplerTypeTag, "custom")}}
+	child := &model.Span{}
+	recorder.RecordDecisions([]*model.Span{probabilistic, debug, upstream, custom, child})
+
+	assert.Equal(t, model.KeyValues{
+		model.String(samplerTypeTag, "probabilistic"),
+		model.String(HeadSamplingTag, "probabilistic"),
+	}, probabilistic.Tags)
+	assert.Equal(t, model.KeyValues{
+		model.String(samplerTypeTag, "const"),
+		model.String(HeadSamplingTag, "debug"),
+	}, debug.Tags)
+	assert.Len(t, upstream.Tags, 2, "the upstream decision is kept")
+	assert.Equal(t, model.String(HeadSamplingTag, "custom"), custom.Tags[1])
+	assert.Empty(t, child.Tags)
+
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["spans.sampling-decisions|decision=head|reason=probabilistic"])
+	assert.EqualValues(t, 1, counts["spans.sampling-decisions|decision=head|reason=debug"])
+	assert.EqualValues(t, 1, counts["spans.sampling-decisions|decision=head|reason=ratelimiting"])
+	assert.EqualValues(t, 1, counts["spans.sampling-decisions|decision=head|reason=other"])
+	assert.EqualValues(t, 0, counts["spans.sampling-decisions|decision=head|reason=const"])
+}
+
+func TestSamplingDecisionRecorderTail(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	recorder := NewSamplingDecisionRecorder(operationTailSampler{"checkout": "error"}, metricsFactory)
+	checkout := &model.Span{OperationName: "checkout"}
+	decided := &model.Span{OperationName: "checkout", Tags: model.KeyValues{model.String(TailSamplingTag, "latency")}}
+	browse := &model.Span{OperationName: "browse"}
+	recorder.RecordDecisions([]*model.Span{checkout, decided, browse})
+
+	assert.Equal(t, model.KeyValues{model.String(TailSamplingTag, "error")}, checkout.Tags)
+	assert.Equal(t, model.KeyValues{model.String(TailSamplingTag, "latency")}, decided.Tags)
+	assert.Empty(t, browse.Tags)
+
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["spans.sampling-decisions|decision=tail|reason=error"])
+	_, ok := counts["spans.sampling-decisions|decision=tail|reason=latency"]
+	assert.False(t, ok, "decisions made upstream are not counted")
+}
+
+func TestDurationTailSampler(t *testing.T) {
+	sampler := NewDurationTailSampler(time.Second)
+	testCases := []struct {
+		span    *model.Span
+		decided bool
+	}{
+		{span: &model.Span{Duration: time.Second}, decided: true},
+		{span: &model.Span{Duration: time.Millisecond}},
+		{span: &model.Span{Duration: time.Second, Flags: model.Flags(1)}},
+	}
+	for _, testCase := range testCases {
+		reason, decided := sampler.TailSample(testCase.span)
+		assert.Equal(t, testCase.decided, decided)
+		if decided {
+			assert.Equal(t, durationReason, reason)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+// ForcedSamplingTag is the span tag recording the name of the SamplingRule that forced the span to be kept
+const ForcedSamplingTag = "sampling.forced"
+
+// SamplingRule forces the spans with a tag to be kept, e.g. those of the premium users of a service
+type SamplingRule struct {
+	// Name identifies the rule in the ForcedSamplingTag and in the metrics
+	Name string `json:"name"`
+	// Tag is the key of the span or process tag the rule checks
+	Tag string `json:"tag"`
+	// Value is the value the tag must have, as a string, the rule matching any value of the tag if empty
+	Value string `json:"value"`
+}
+
+// SamplingRules are the rules forcing spans to be kept, the first rule matching a span being recorded
+type SamplingRules []SamplingRule
+
+// LoadSamplingRules reads SamplingRules encoded as JSON, e.g.
+//
+//	[{"name": "premium", "tag": "user.tier", "value": "premium"}, {"name": "fraud", "tag": "fraud.case"}]
+func LoadSamplingRules(r io.Reader) (SamplingRules, error) {
+	var rules SamplingRules
+	err := json.NewDecoder(r).Decode(&rules)
+	return rules, err
+}
+
+// RuleSampler forces the spans matching SamplingRules to be kept by the sampling of the collector: the spans
+// are marked as sampled, so that the tail sampling keeps their traces, and tagged with the ForcedSamplingTag,
+// so that the quota sampling keeps them. The forced spans are counted in the spans.sampling-forced metric by rule.
+type RuleSampler struct {
+	sync.RWMutex
+	rules          SamplingRules
+	metricsFactory metrics.Factory
+	forced         map[string]metrics.Counter
+}
+
+// NewRuleSampler creates a RuleSampler counting the forced spans in the metrics factory, it returns an error
+// if the rules are not valid
+func NewRuleSampler(rules SamplingRules, metricsFactory metrics.Factory) (*RuleSampler, error) {
+	s := &RuleSampler{
+		metricsFactory: metricsFactory,
+		forced:         make(map[string]metrics.Counter),
+	}
+	if err := s.Update(rules); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Update replaces the rules, spans sampled from then on use the new rules. The rules are left unchanged
+// if a rule has no name or tag, or two rules have the same name.
+func (s *RuleSampler) Update(rules SamplingRules) error {
+	names := make(map[string]struct{}, len(rules))
+	for i, rule := range rules {
+		if rule.Name == "" || rule.Tag == "" {
+			return fmt.Errorf("sampling rule %d must have a name and a tag", i)
+		}
+		if _, ok := names[rule.Name]; ok {
+			return fmt.Errorf("duplicate sampling rule %s", rule.Name)
+		}
+		names[rule.Name] = struct{}{}
+	}
+	s.Lock()
+	defer s.Unlock()
+	for _, rule := range rules {
+		if _, ok := s.forced[rule.Name]; !ok {
+			s.forced[rule.Name] = s.metricsFactory.Counter("spans.sampling-forced", map[string]string{"rule": rule.Name})
+		}
+	}
+	s.rules = rules
+	return nil
+}
+
+// SampleSpans forces the spans matching a rule to be kept, it can be used as a ProcessSpans.
+func (s *RuleSampler) SampleSpans(spans []*model.Span) {
+	s.RLock()
+	defer s.RUnlock()
+	for _, span := range spans {
+		for _, rule := range s.rules {
+			if matchesSamplingRule(span, rule) {
+				span.Flags.SetSampled()
+				if _, ok := span.Tags.FindByKey(ForcedSamplingTag); !ok {
+					span.Tags = append(span.Tags, model.String(ForcedSamplingTag, rule.Name))
+				}
+				s.forced[rule.Name].Inc(1)
+				break
+			}
+		}
+	}
+}
+
+func matchesSamplingRule(span *model.Span, rule SamplingRule) bool {
+	tag, ok := span.Tags.FindByKey(rule.Tag)
+	if !ok && span.Process != nil {
+		tag, ok = span.Process.Tags.FindByKey(rule.Tag)
+	}
+	return ok && (rule.Value == "" || tag.AsString() == rule.Value)
+}
+
+// isForcedSample returns whether a SamplingRule forced the span to be kept
+func isForcedSample(span *model.Span) bool {
+	_, ok := span.Tags.FindByKey(ForcedSamplingTag)
+	return ok
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+func TestRuleSampler(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	sampler, err := NewRuleSampler(SamplingRules{
+		{Name: "premium", Tag: "user.tier", Value: "premium"},
+		{Name: "fraud", Tag: "fraud.case"},
+	}, metricsFactory)
+	require.NoError(t, err)
+
+	premium := &model.Span{Tags: model.KeyValues{model.String("user.tier", "premium")}}
+	free := &model.Span{Tags: model.KeyValues{model.String("user.tier", "free")}}
+	fraud := &model.Span{
+		Tags:    model.KeyValues{model.String("user.tier", "free")},
+		Process: &model.Process{Tags: model.KeyValues{model.Int64("fraud.case", 42)}},
+	}
+	sampler.SampleSpans([]*model.Span{premium, free, fraud})
+
+	assert.True(t, premium.Flags.IsSampled())
+	tag, ok := premium.Tags.FindByKey(ForcedSamplingTag)
+	require.True(t, ok)
+	assert.Equal(t, "premium", tag.AsString())
+	assert.False(t, free.Flags.IsSampled())
+	assert.False(t, isForcedSample(free))
+	assert.True(t, fraud.Flags.IsSampled())
+	tag, ok = fraud.Tags.FindByKey(ForcedSamplingTag)
+	require.True(t, ok)
+	assert.Equal(t, "fraud", tag.AsString())
+
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["spans.sampling-forced|rule=premium"])
+	assert.EqualValues(t, 1, counts["spans.sampling-forced|rule=fraud"])
+}
+
+func TestRuleSamplerUpdate(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	sampler, err := NewRuleSampler(SamplingRules{{Name: "premium", Tag: "user.tier", Value: "premium"}}, metricsFactory)
+	require.NoError(t, err)
+
+	assert.EqualError(t, sampler.Update(SamplingRules{{Name: "premium"}}), "sampling rule 0 must have a name and a tag")
+	assert.EqualError(t, sampler.Update(SamplingRules{
+		{Name: "premium", Tag: "user.tier"},
+		{Name: "premium", Tag: "fraud.case"},
+	}), "duplicate sampling rule premium")
+
+	require.NoError(t, sampler.Update(SamplingRules{{Name: "gold", Tag: "user.tier", Value: "gold"}}))
+	premium := &model.Span{Tags: model.KeyValues{model.String("user.tier", "premium")}}
+	gold := &model.Span{Tags: model.KeyValues{model.String("user.tier", "gold")}}
+	sampler.SampleSpans([]*model.Span{premium, gold})
+	assert.False(t, isForcedSample(premium))
+	assert.True(t, isForcedSample(gold))
+
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 0, counts["spans.sampling-forced|rule=premium"])
+	assert.EqualValues(t, 1, counts["spans.sampling-forced|rule=gold"])
+}
+
+func TestNewRuleSamplerInvalidRules(t *testing.T) {
+	_, err := NewRuleSampler(SamplingRules{{Tag: "user.tier"}}, metrics.NullFactory)
+	assert.EqualError(t, err, "sampling rule 0 must have a name and a tag")
+}
+
+func TestLoadSamplingRules(t *testing.T) {
+	rules, err := LoadSamplingRules(strings.NewReader(`[
+		{"name": "premium", "tag": "user.tier", "value": "premium"},
+		{"name": "fraud", "tag": "fraud.case"}
+	]`))
+	require.NoError(t, err)
+	assert.Equal(t, SamplingRules{
+		{Name: "premium", Tag: "user.tier", Value: "premium"},
+		{Name: "fraud", Tag: "fraud.case"},
+	}, rules)
+
+	_, err = LoadSamplingRules(strings.NewReader(`{`))
+	assert.Error(t, err)
+}
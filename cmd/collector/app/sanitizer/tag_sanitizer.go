@@ -0,0 +1,153 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sanitizer
+
+import (
+	"unicode/utf8"
+
+	"github.com/uber/jaeger/model"
+)
+
+const (
+	// TruncatedTagKey is the tag added to spans that had at least one tag value truncated
+	TruncatedTagKey = "jaeger.tags-truncated"
+
+	ellipsis = "..."
+)
+
+// TagSanitizerOptions decide which tags are kept and how long their values can be, the rules applying
+// to the span tags, the process tags and the log fields alike.
+type TagSanitizerOptions struct {
+	// AllowList, if not empty, is the list of the only tag keys that are kept
+	AllowList []string
+	// AllowFunc, with an AllowList, also keeps the tag keys it returns true for, e.g. those added by the collector
+	AllowFunc func(key string) bool
+	// DenyList is the list of tag keys that are dropped
+	DenyList []string
+	// MaxValueLength is the maximum length of string and binary tag values, longer values are
+	// truncated and end with an ellipsis. Zero means no limit.
+	MaxValueLength int
+}
+
+// tagSanitizer drops and truncates span tags, process tags and log fields to limit the size of stored spans
+type tagSanitizer struct {
+	allow          map[string]struct{}
+	allowFunc      func(key string) bool
+	deny           map[string]struct{}
+	maxValueLength int
+}
+
+// NewTagSanitizer creates a sanitizer that removes the span tags, process tags and log fields not in the
+// allow-list or in the deny-list, and truncates the values longer than the maximum length.
+func NewTagSanitizer(options TagSanitizerOptions) SanitizeSpan {
+	s := tagSanitizer{
+		allow:          toSet(options.AllowList),
+		allowFunc:      options.AllowFunc,
+		deny:           toSet(options.DenyList),
+		maxValueLength: options.MaxValueLength,
+	}
+	return s.Sanitize
+}
+
+func toSet(keys []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		set[key] = struct{}{}
+	}
+	return set
+}
+
+// Sanitize drops and truncates the tags of the span and of its process, and the fields of its logs.
+// The truncation is marked by a span tag, whichever values were truncated.
+func (s *tagSanitizer) Sanitize(span *model.Span) *model.Span {
+	var truncated, cut bool
+	span.Tags, truncated = s.sanitizeTags(span.Tags)
+	if span.Process != nil {
+		// the process can be shared by the spans of a batch, which is fine since sanitizing is idempotent
+		span.Process.Tags, cut = s.sanitizeTags(span.Process.Tags)
+		truncated = truncated || cut
+	}
+	for i := range span.Logs {
+		span.Logs[i].Fields, cut = s.sanitizeTags(span.Logs[i].Fields)
+		truncated = truncated || cut
+	}
+	if _, marked := span.Tags.FindByKey(TruncatedTagKey); truncated && !marked {
+		span.Tags = append(span.Tags, model.Bool(TruncatedTagKey, true))
+	}
+	return span
+}
+
+// sanitizeTags drops and truncates the tags in place, and returns whether a value was truncated
+func (s *tagSanitizer) sanitizeTags(tags model.KeyValues) (model.KeyValues, bool) {
+	if len(tags) == 0 {
+		return tags, false
+	}
+	truncated := false
+	kept := tags[:0]
+	for _, tag := range tags {
+		if !s.keep(tag.Key) {
+			continue
+		}
+		if s.maxValueLength > 0 {
+			var cut bool
+			if tag, cut = s.truncate(tag); cut {
+				truncated = true
+			}
+		}
+		kept = append(kept, tag)
+	}
+	if len(kept) == 0 {
+		kept = nil
+	}
+	return kept, truncated
+}
+
+func (s *tagSanitizer) keep(key string) bool {
+	if _, ok := s.deny[key]; ok {
+		return false
+	}
+	if len(s.allow) == 0 {
+		return true
+	}
+	if _, ok := s.allow[key]; ok {
+		return true
+	}
+	return s.allowFunc != nil && s.allowFunc(key)
+}
+
+func (s *tagSanitizer) truncate(tag model.KeyValue) (model.KeyValue, bool) {
+	switch tag.VType {
+	case model.StringType:
+		if len(tag.VStr) > s.maxValueLength {
+			cut := s.maxValueLength
+			// do not split a multi-byte character
+			for cut > 0 && !utf8.RuneStart(tag.VStr[cut]) {
+				cut--
+			}
+			return model.String(tag.Key, tag.VStr[:cut]+ellipsis), true
+		}
+	case model.BinaryType:
+		if len(tag.VBlob) > s.maxValueLength {
+			return model.Binary(tag.Key, append(tag.VBlob[:s.maxValueLength:s.maxValueLength], ellipsis...)), true
+		}
+	}
+	return tag, false
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sanitizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/uber/jaeger/model"
+)
+
+func TestTagSanitizerDenyList(t *testing.T) {
+	sanitizer := NewTagSanitizer(TagSanitizerOptions{DenyList: []string{"sql.query"}})
+	span := sanitizer(&model.Span{Tags: model.KeyValues{
+		model.String("sql.query", "SELECT * FROM traces"),
+		model.String("http.method", "GET"),
+	}})
+	assert.Equal(t, model.KeyValues{model.String("http.method", "GET")}, span.Tags)
+}
+
+func TestTagSanitizerAllowList(t *testing.T) {
+	sanitizer := NewTagSanitizer(TagSanitizerOptions{
+		AllowList: []string{"http.method", "http.url"},
+		DenyList:  []string{"http.url"},
+	})
+	span := sanitizer(&model.Span{Tags: model.KeyValues{
+		model.String("request.body", "{}"),
+		model.String("http.method", "GET"),
+		model.String("http.url", "/"),
+	}})
+	assert.Equal(t, model.KeyValues{model.String("http.method", "GET")}, span.Tags)
+
+	span = sanitizer(&model.Span{Tags: model.KeyValues{model.String("request.body", "{}")}})
+	assert.Nil(t, span.Tags)
+}
+
+func TestTagSanitizerAllowFunc(t *testing.T) {
+	sanitizer := NewTagSanitizer(TagSanitizerOptions{
+		AllowList: []string{"http.method"},
+		AllowFunc: func(key string) bool { return key == "owner" },
+	})
+	span := sanitizer(&model.Span{Tags: model.KeyValues{
+		model.String("request.body", "{}"),
+		model.String("http.method", "GET"),
+		model.String("owner", "payments-team"),
+	}})
+	assert.Equal(t, model.KeyValues{model.String("http.method", "GET"), model.String("owner", "payments-team")}, span.Tags)
+}
+
+func TestTagSanitizerTruncation(t *testing.T) {
+	sanitizer := NewTagSanitizer(TagSanitizerOptions{MaxValueLength: 4})
+	span := sanitizer(&model.Span{Tags: model.KeyValues{
+		model.String("short", "abcd"),
+		model.String("long", "abcdef"),
+		model.String("multibyte", "abcé"),
+		model.Binary("blob", []byte("012345")),
+		model.Int64("number", 1234567),
+	}})
+	assert.Equal(t, model.KeyValues{
+		model.String("short", "abcd"),
+		model.String("long", "abcd..."),
+		model.String("multibyte", "abc..."),
+		model.Binary("blob", []byte("0123...")),
+		model.Int64("number", 1234567),
+		model.Bool(TruncatedTagKey, true),
+	}, span.Tags)
+}
+
+func TestTagSanitizerProcessTagsAndLogFields(t *testing.T) {
+	sanitizer := NewTagSanitizer(TagSanitizerOptions{DenyList: []string{"password"}, MaxValueLength: 4})
+	span := sanitizer(&model.Span{
+		Process: &model.Process{ServiceName: "svc", Tags: model.KeyValues{
+			model.String("password", "secret"),
+			model.String("hostname", "host-1"),
+		}},
+		Logs: []model.Log{
+			{Fields: []model.KeyValue{model.String("event", "error"), model.String("password", "secret")}},
+			{Fields: []model.KeyValue{model.String("password", "secret")}},
+		},
+	})
+	assert.Equal(t, model.KeyValues{model.String("hostname", "host...")}, span.Process.Tags)
+	assert.Equal(t, []model.KeyValue{model.String("event", "erro...")}, span.Logs[0].Fields)
+	assert.Nil(t, span.Logs[1].Fields)
+	assert.Equal(t, model.KeyValues{model.Bool(TruncatedTagKey, true)}, span.Tags,
+		"the span is marked as truncated whichever values were truncated")
+
+	span = sanitizer(span)
+	assert.Equal(t, model.KeyValues{model.String("hostname", "host...")}, span.Process.Tags, "the shared process is sanitized once")
+	assert.Equal(t, model.KeyValues{model.Bool(TruncatedTagKey, true)}, span.Tags)
+}
+
+func TestTagSanitizerNoTags(t *testing.T) {
+	sanitizer := NewTagSanitizer(TagSanitizerOptions{MaxValueLength: 4})
+	span := sanitizer(&model.Span{})
+	assert.Nil(t, span.Tags)
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+// OriginalServiceNameTag is the span tag the service name replaced by a ServiceAliases entry is kept in
+const OriginalServiceNameTag = "original.service"
+
+// ServiceAliases are the new names of services, keyed by their old names, e.g. the names of services before
+// they were renamed. Aliases are not chained, a service is renamed at most once.
+type ServiceAliases map[string]string
+
+// LoadServiceAliases reads ServiceAliases encoded as JSON, e.g. {"payments-legacy": "payments"}
+func LoadServiceAliases(r io.Reader) (ServiceAliases, error) {
+	var aliases ServiceAliases
+	err := json.NewDecoder(r).Decode(&aliases)
+	return aliases, err
+}
+
+// ServiceNameRemapper renames the services of spans according to ServiceAliases, keeping the replaced names
+// in the OriginalServiceNameTag of the spans. The renamed spans are counted in the spans.services-remapped metric.
+type ServiceNameRemapper struct {
+	sync.RWMutex
+	aliases  ServiceAliases
+	remapped metrics.Counter
+}
+
+// NewServiceNameRemapper creates a ServiceNameRemapper that counts the spans it renames the service of in
+// the given metrics factory
+func NewServiceNameRemapper(aliases ServiceAliases, metricsFactory metrics.Factory) *ServiceNameRemapper {
+	return &ServiceNameRemapper{
+		aliases:  aliases,
+		remapped: metricsFactory.Counter("spans.services-remapped", nil),
+	}
+}
+
+// Update replaces the aliases, spans remapped from then on use the new aliases
+func (r *ServiceNameRemapper) Update(aliases ServiceAliases) {
+	r.Lock()
+	defer r.Unlock()
+	r.aliases = aliases
+}
+
+// RemapSpans renames the services of the spans that have an alias, it can be used as a ProcessSpans.
+// A process shared by several spans is renamed once, all its spans being tagged with its original name.
+func (r *ServiceNameRemapper) RemapSpans(spans []*model.Span) {
+	r.RLock()
+	defer r.RUnlock()
+	if len(r.aliases) == 0 {
+		return
+	}
+	// originals are the names the processes had, empty if they were not renamed
+	originals := make(map[*model.Process]string)
+	for _, span := range spans {
+		if span.Process == nil {
+			continue
+		}
+		original, ok := originals[span.Process]
+		if !ok {
+			if alias, found := r.aliases[span.Process.ServiceName]; found && alias != span.Process.ServiceName {
+				original = span.Process.ServiceName
+				span.Process.ServiceName = alias
+			}
+			originals[span.Process] = original
+		}
+		if original == "" {
+			continue
+		}
+		if _, ok := span.Tags.FindByKey(OriginalServiceNameTag); !ok {
+			span.Tags = append(span.Tags, model.String(OriginalServiceNameTag, original))
+		}
+		r.remapped.Inc(1)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+func TestServiceNameRemapper(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	remapper := NewServiceNameRemapper(ServiceAliases{
+		"payments-legacy": "payments",
+		"payments":        "billing",
+	}, metricsFactory)
+
+	legacy := &model.Process{ServiceName: "payments-legacy"}
+	other := &model.Process{ServiceName: "frontend"}
+	spans := []*model.Span{
+		{SpanID: 1, Process: legacy},
+		{SpanID: 2, Process: legacy},
+		{SpanID: 3, Process: other},
+		{SpanID: 4},
+	}
+	remapper.RemapSpans(spans)
+
+	assert.Equal(t, "payments", legacy.ServiceName, "aliases are not chained, even for a shared process")
+	assert.Equal(t, "frontend", other.ServiceName)
+	for _, span := range spans[:2] {
+		tag, ok := span.Tags.FindByKey(OriginalServiceNameTag)
+		require.True(t, ok)
+		assert.Equal(t, "payments-legacy", tag.AsString())
+	}
+	_, ok := spans[2].Tags.FindByKey(OriginalServiceNameTag)
+	assert.False(t, ok)
+
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counts["spans.services-remapped"])
+}
+
+func TestServiceNameRemapperUpdate(t *testing.T) {
+	remapper := NewServiceNameRemapper(ServiceAliases{"old": "new"}, metrics.NullFactory)
+	remapper.Update(ServiceAliases{"older": "new"})
+
+	old := &model.Span{Process: &model.Process{ServiceName: "old"}}
+	older := &model.Span{Process: &model.Process{ServiceName: "older"}}
+	remapper.RemapSpans([]*model.Span{old, older})
+	assert.Equal(t, "old", old.Process.ServiceName)
+	assert.Equal(t, "new", older.Process.ServiceName)
+
+	remapper.Update(nil)
+	oldest := &model.Span{Process: &model.Process{ServiceName: "older"}}
+	remapper.RemapSpans([]*model.Span{oldest})
+	assert.Equal(t, "older", oldest.Process.ServiceName)
+}
+
+func TestLoadServiceAliases(t *testing.T) {
+	aliases, err := LoadServiceAliases(strings.NewReader(`{"payments-legacy": "payments"}`))
+	require.NoError(t, err)
+	assert.Equal(t, ServiceAliases{"payments-legacy": "payments"}, aliases)
+
+	_, err = LoadServiceAliases(strings.NewReader(`["payments"]`))
+	assert.Error(t, err)
+}
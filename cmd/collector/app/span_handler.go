@@ -21,6 +21,11 @@
 package app
 
 import (
+	"context"
+	"fmt"
+
+	"github.com/uber/jaeger-lib/metrics"
+	"github.com/uber/tchannel-go"
 	"github.com/uber/tchannel-go/thrift"
 	"go.uber.org/zap"
 
@@ -60,28 +65,77 @@ type SpanProcessor interface {
 	ProcessSpans(mSpans []*model.Span, spanFormat string) ([]bool, error)
 }
 
+// AckingSpanProcessor is a SpanProcessor that tells when the spans of a batch are saved, for the sources
+// redelivering the batches that are not acknowledged
+type AckingSpanProcessor interface {
+	// ProcessSpansWithAck processes the spans as ProcessSpans, then calls ack once with whether all of them
+	// were saved, the spans rejected by filters counting as saved. ack is also called when an error is returned.
+	ProcessSpansWithAck(mSpans []*model.Span, spanFormat string, ack func(saved bool)) error
+}
+
+// QueuedSpanProcessor is a SpanProcessor that queues spans before saving them
+type QueuedSpanProcessor interface {
+	SpanProcessor
+	AckingSpanProcessor
+	// Drain stops accepting spans and saves the queued ones until the queue is empty or the
+	// context is done. It returns the number of queued spans that were dropped.
+	Drain(ctx context.Context) int
+}
+
+// malformedSpansError returns the error of a request some spans of which could not be converted, a TChannel
+// bad request error so that the HTTP handler rejects the request with a 400 response
+func malformedSpansError(count int, format string) error {
+	return tchannel.NewSystemError(tchannel.ErrCodeBadRequest, "%d malformed %s spans", count, format)
+}
+
+// recoverMalformed turns the panic of decoding or converting a malformed payload into an error
+func recoverMalformed(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("malformed payload: %v", r)
+	}
+}
+
 type jaegerBatchesHandler struct {
 	logger         *zap.Logger
 	modelProcessor SpanProcessor
+	spanFormat     string
+	malformedSpans metrics.Counter
+}
+
+// NewJaegerSpanHandler returns a JaegerBatchesHandler. The spans which cannot be converted are dropped and counted,
+// the others are processed and the request fails with a bad request error.
+func NewJaegerSpanHandler(logger *zap.Logger, modelProcessor SpanProcessor, metricsFactory metrics.Factory) JaegerBatchesHandler {
+	return newJaegerSpanHandler(logger, modelProcessor, metricsFactory, JaegerFormatType)
 }
 
-// NewJaegerSpanHandler returns a JaegerBatchesHandler
-func NewJaegerSpanHandler(logger *zap.Logger, modelProcessor SpanProcessor) JaegerBatchesHandler {
+// NewOTLPSpanHandler returns a JaegerBatchesHandler for the batches converted from the spans received by the
+// OTLPReceiver, which processes their spans with the OTLP format type
+func NewOTLPSpanHandler(logger *zap.Logger, modelProcessor SpanProcessor, metricsFactory metrics.Factory) JaegerBatchesHandler {
+	return newJaegerSpanHandler(logger, modelProcessor, metricsFactory, OTLPFormatType)
+}
+
+// NewGRPCSpanHandler returns a JaegerBatchesHandler for the batches converted from the spans received by the
+// gRPC Collect endpoint, which processes their spans with the gRPC format type
+func NewGRPCSpanHandler(logger *zap.Logger, modelProcessor SpanProcessor, metricsFactory metrics.Factory) JaegerBatchesHandler {
+	return newJaegerSpanHandler(logger, modelProcessor, metricsFactory, GRPCFormatType)
+}
+
+func newJaegerSpanHandler(logger *zap.Logger, modelProcessor SpanProcessor, metricsFactory metrics.Factory, spanFormat string) *jaegerBatchesHandler {
 	return &jaegerBatchesHandler{
 		logger:         logger,
 		modelProcessor: modelProcessor,
+		spanFormat:     spanFormat,
+		malformedSpans: metricsFactory.Counter("malformed-spans", map[string]string{"format": spanFormat}),
 	}
 }
 
 func (jbh *jaegerBatchesHandler) SubmitBatches(ctx thrift.Context, batches []*jaeger.Batch) ([]*jaeger.BatchSubmitResponse, error) {
 	responses := make([]*jaeger.BatchSubmitResponse, 0, len(batches))
+	malformed := 0
 	for _, batch := range batches {
-		mSpans := make([]*model.Span, 0, len(batch.Spans))
-		for _, span := range batch.Spans {
-			mSpan := jConv.ToDomainSpan(span, batch.Process)
-			mSpans = append(mSpans, mSpan)
-		}
-		oks, err := jbh.modelProcessor.ProcessSpans(mSpans, JaegerFormatType)
+		mSpans, malformedSpans := jbh.toDomainSpans(batch)
+		malformed += malformedSpans
+		oks, err := jbh.modelProcessor.ProcessSpans(mSpans, jbh.spanFormat)
 		if err != nil {
 			return nil, err
 		}
@@ -97,35 +151,116 @@ func (jbh *jaegerBatchesHandler) SubmitBatches(ctx thrift.Context, batches []*ja
 		}
 		responses = append(responses, res)
 	}
+	if malformed > 0 {
+		jbh.malformedSpans.Inc(int64(malformed))
+		return nil, malformedSpansError(malformed, jbh.spanFormat)
+	}
 	return responses, nil
 }
 
+// toDomainSpans converts the spans of the batch, returning the number of malformed spans dropped
+func (jbh *jaegerBatchesHandler) toDomainSpans(batch *jaeger.Batch) ([]*model.Span, int) {
+	mSpans := make([]*model.Span, 0, len(batch.Spans))
+	malformed := 0
+	for _, span := range batch.Spans {
+		mSpan, err := jaegerToDomainSpan(span, batch.Process)
+		if err != nil {
+			jbh.logger.Warn("Dropping malformed span", zap.String("format", jbh.spanFormat), zap.Error(err))
+			malformed++
+			continue
+		}
+		mSpans = append(mSpans, mSpan)
+	}
+	return mSpans, malformed
+}
+
+type ackingBatchesHandler struct {
+	*jaegerBatchesHandler
+	ackingProcessor AckingSpanProcessor
+}
+
+// NewNATSSpanHandler returns a JaegerBatchesHandler for the batches of the messages consumed by the NATSConsumer,
+// which adds the spans of each call to the batchAck of the message carried by the context. The responses are
+// always ok, the message being acknowledged once its spans are saved.
+func NewNATSSpanHandler(logger *zap.Logger, modelProcessor AckingSpanProcessor, metricsFactory metrics.Factory) JaegerBatchesHandler {
+	return &ackingBatchesHandler{
+		jaegerBatchesHandler: newJaegerSpanHandler(logger, nil, metricsFactory, NATSFormatType),
+		ackingProcessor:      modelProcessor,
+	}
+}
+
+func (h *ackingBatchesHandler) SubmitBatches(ctx thrift.Context, batches []*jaeger.Batch) ([]*jaeger.BatchSubmitResponse, error) {
+	ack := batchAckFromContext(ctx)
+	responses := make([]*jaeger.BatchSubmitResponse, 0, len(batches))
+	malformed := 0
+	for _, batch := range batches {
+		mSpans, malformedSpans := h.toDomainSpans(batch)
+		malformed += malformedSpans
+		ack.hold()
+		if err := h.ackingProcessor.ProcessSpansWithAck(mSpans, h.spanFormat, ack.done); err != nil {
+			return nil, err
+		}
+		responses = append(responses, &jaeger.BatchSubmitResponse{Ok: true})
+	}
+	if malformed > 0 {
+		h.malformedSpans.Inc(int64(malformed))
+		return nil, malformedSpansError(malformed, h.spanFormat)
+	}
+	return responses, nil
+}
+
+// jaegerToDomainSpan converts a Jaeger Thrift span, returning an error instead of panicking on a malformed span
+func jaegerToDomainSpan(span *jaeger.Span, process *jaeger.Process) (mSpan *model.Span, err error) {
+	defer recoverMalformed(&err)
+	return jConv.ToDomainSpan(span, process), nil
+}
+
 type zipkinSpanHandler struct {
 	logger         *zap.Logger
 	sanitizer      zipkinS.Sanitizer
+	converter      zipkin.Converter
 	modelProcessor SpanProcessor
+	malformedSpans metrics.Counter
 }
 
-// NewZipkinSpanHandler returns a ZipkinSpansHandler
-func NewZipkinSpanHandler(logger *zap.Logger, modelHandler SpanProcessor, sanitizer zipkinS.Sanitizer) ZipkinSpansHandler {
+// NewZipkinSpanHandler returns a ZipkinSpansHandler converting the sanitized spans with the converter. The spans
+// which cannot be sanitized or converted are dropped and counted, the others are processed and the request fails
+// with a bad request error.
+func NewZipkinSpanHandler(
+	logger *zap.Logger,
+	modelHandler SpanProcessor,
+	sanitizer zipkinS.Sanitizer,
+	converter zipkin.Converter,
+	metricsFactory metrics.Factory,
+) ZipkinSpansHandler {
 	return &zipkinSpanHandler{
 		logger:         logger,
 		modelProcessor: modelHandler,
 		sanitizer:      sanitizer,
+		converter:      converter,
+		malformedSpans: metricsFactory.Counter("malformed-spans", map[string]string{"format": ZipkinFormatType}),
 	}
 }
 
 // SubmitZipkinBatch records a batch of spans already in Zipkin Thrift format.
 func (h *zipkinSpanHandler) SubmitZipkinBatch(ctx thrift.Context, spans []*zipkincore.Span) ([]*zipkincore.Response, error) {
-	mSpans := make([]*model.Span, len(spans))
-	for i, span := range spans {
-		sanitized := h.sanitizer.Sanitize(span)
-		mSpans[i] = ConvertZipkinToModel(sanitized, h.logger)
+	mSpans := make([]*model.Span, 0, len(spans))
+	for _, span := range spans {
+		mSpan, err := h.toDomainSpan(span)
+		if err != nil {
+			h.logger.Warn("Dropping malformed Zipkin span", zap.Error(err))
+			continue
+		}
+		mSpans = append(mSpans, mSpan)
 	}
 	bools, err := h.modelProcessor.ProcessSpans(mSpans, ZipkinFormatType)
 	if err != nil {
 		return nil, err
 	}
+	if malformed := len(spans) - len(mSpans); malformed > 0 {
+		h.malformedSpans.Inc(int64(malformed))
+		return nil, malformedSpansError(malformed, ZipkinFormatType)
+	}
 	responses := make([]*zipkincore.Response, len(spans))
 	for i, ok := range bools {
 		res := zipkincore.NewResponse()
@@ -135,6 +270,15 @@ func (h *zipkinSpanHandler) SubmitZipkinBatch(ctx thrift.Context, spans []*zipki
 	return responses, nil
 }
 
+func (h *zipkinSpanHandler) toDomainSpan(span *zipkincore.Span) (mSpan *model.Span, err error) {
+	defer recoverMalformed(&err)
+	mSpan, warning := h.converter.ToDomainSpan(h.sanitizer.Sanitize(span))
+	if warning != nil {
+		h.logger.Warn("Warning while converting zipkin to domain span", zap.Error(warning))
+	}
+	return mSpan, nil
+}
+
 // ConvertZipkinToModel is a helper function that logs warnings during conversion
 func ConvertZipkinToModel(zSpan *zipkincore.Span, logger *zap.Logger) *model.Span {
 	mSpan, err := zipkin.ToDomainSpan(zSpan)
@@ -26,11 +26,15 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+	"github.com/uber/tchannel-go"
 	"github.com/uber/tchannel-go/thrift"
 	"go.uber.org/zap"
 
 	"github.com/uber/jaeger/cmd/collector/app/sanitizer/zipkin"
 	"github.com/uber/jaeger/model"
+	zipkinConv "github.com/uber/jaeger/model/converter/thrift/zipkin"
 	"github.com/uber/jaeger/thrift-gen/jaeger"
 	"github.com/uber/jaeger/thrift-gen/zipkincore"
 )
@@ -48,7 +52,7 @@ func TestJaegerSpanHandler(t *testing.T) {
 	}
 	for _, tc := range testChunks {
 		logger := zap.NewNop()
-		h := NewJaegerSpanHandler(logger, &shouldIErrorProcessor{tc.expectedErr != nil})
+		h := NewJaegerSpanHandler(logger, &shouldIErrorProcessor{tc.expectedErr != nil}, metrics.NullFactory)
 		ctx, cancel := thrift.NewContext(time.Minute)
 		defer cancel()
 		res, err := h.SubmitBatches(ctx, []*jaeger.Batch{
@@ -68,6 +72,81 @@ func TestJaegerSpanHandler(t *testing.T) {
 	}
 }
 
+func TestJaegerSpanHandlerMalformedSpans(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	processor := &recordingProcessor{}
+	h := NewJaegerSpanHandler(zap.NewNop(), processor, metricsFactory)
+	ctx, cancel := thrift.NewContext(time.Minute)
+	defer cancel()
+	res, err := h.SubmitBatches(ctx, []*jaeger.Batch{
+		{
+			Process: &jaeger.Process{ServiceName: "someServiceName"},
+			// a nil tag cannot be converted
+			Spans: []*jaeger.Span{{SpanId: 1}, {SpanId: 2, Tags: []*jaeger.Tag{nil}}},
+		},
+	})
+	assert.Nil(t, res)
+	assert.Equal(t, tchannel.ErrCodeBadRequest, tchannel.GetSystemErrorCode(err))
+	require.Len(t, processor.spans, 1)
+	assert.Equal(t, model.SpanID(1), processor.spans[0].SpanID)
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counters["malformed-spans|format=jaeger"])
+}
+
+func TestZipkinSpanHandlerMalformedSpans(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	processor := &recordingProcessor{}
+	h := NewZipkinSpanHandler(zap.NewNop(), processor, panickingSanitizer{}, zipkinConv.NewConverter(zipkinConv.ReferenceRules{}), metricsFactory)
+	ctx, cancel := thrift.NewContext(time.Minute)
+	defer cancel()
+	res, err := h.SubmitZipkinBatch(ctx, []*zipkincore.Span{{ID: 1}, {ID: 2}})
+	assert.Nil(t, res)
+	assert.Equal(t, tchannel.ErrCodeBadRequest, tchannel.GetSystemErrorCode(err))
+	require.Len(t, processor.spans, 1)
+	assert.Equal(t, model.SpanID(1), processor.spans[0].SpanID)
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counters["malformed-spans|format=zipkin"])
+}
+
+func TestZipkinSpanHandlerReferenceRules(t *testing.T) {
+	processor := &recordingProcessor{}
+	converter := zipkinConv.NewConverter(zipkinConv.ReferenceRules{Annotations: []string{"async"}})
+	h := NewZipkinSpanHandler(zap.NewNop(), processor, zipkin.NewChainedSanitizer(), converter, metrics.NullFactory)
+	ctx, cancel := thrift.NewContext(time.Minute)
+	defer cancel()
+	parentID := int64(1)
+	_, err := h.SubmitZipkinBatch(ctx, []*zipkincore.Span{
+		{TraceID: 1, ID: 2, ParentID: &parentID, BinaryAnnotations: []*zipkincore.BinaryAnnotation{
+			{Key: "async", Value: []byte{1}, AnnotationType: zipkincore.AnnotationType_BOOL},
+		}},
+		{TraceID: 1, ID: 3, ParentID: &parentID},
+	})
+	require.NoError(t, err)
+	require.Len(t, processor.spans, 2)
+	assert.Equal(t, model.SpanID(0), processor.spans[0].ParentSpanID)
+	assert.Equal(t, []model.SpanRef{{RefType: model.FollowsFrom, TraceID: model.TraceID{Low: 1}, SpanID: 1}}, processor.spans[0].References)
+	assert.Equal(t, model.SpanID(1), processor.spans[1].ParentSpanID)
+	assert.Empty(t, processor.spans[1].References)
+}
+
+func TestRecoverMalformed(t *testing.T) {
+	err := func() (err error) {
+		defer recoverMalformed(&err)
+		panic("corrupt")
+	}()
+	assert.EqualError(t, err, "malformed payload: corrupt")
+}
+
+// panickingSanitizer panics on the spans with the ID 2
+type panickingSanitizer struct{}
+
+func (panickingSanitizer) Sanitize(span *zipkincore.Span) *zipkincore.Span {
+	if span.ID == 2 {
+		panic("malformed span")
+	}
+	return span
+}
+
 type shouldIErrorProcessor struct {
 	shouldError bool
 }
@@ -98,7 +177,13 @@ func TestZipkinSpanHandler(t *testing.T) {
 	}
 	for _, tc := range testChunks {
 		logger := zap.NewNop()
-		h := NewZipkinSpanHandler(logger, &shouldIErrorProcessor{tc.expectedErr != nil}, zipkin.NewParentIDSanitizer(logger))
+		h := NewZipkinSpanHandler(
+			logger,
+			&shouldIErrorProcessor{tc.expectedErr != nil},
+			zipkin.NewParentIDSanitizer(logger),
+			zipkinConv.NewConverter(zipkinConv.ReferenceRules{}),
+			metrics.NullFactory,
+		)
 		ctx, cancel := thrift.NewContext(time.Minute)
 		defer cancel()
 		res, err := h.SubmitZipkinBatch(ctx, []*zipkincore.Span{
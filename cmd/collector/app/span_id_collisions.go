@@ -0,0 +1,153 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/pkg/cache"
+)
+
+// SpanIDCollisionMode is what happens to the spans sharing their span ID with a different span of their trace
+type SpanIDCollisionMode string
+
+const (
+	// TagSpanIDCollisions keeps the span ID of the colliding spans, tagged with SpanIDCollisionTag
+	TagSpanIDCollisions SpanIDCollisionMode = "tag"
+	// ReassignSpanIDCollisions gives the colliding spans a span ID derived from their content, tagged with
+	// SpanIDCollisionTag, so that the retries of a colliding span get the same span ID
+	ReassignSpanIDCollisions SpanIDCollisionMode = "reassign"
+
+	// SpanIDCollisionTag is the span tag recording the span ID a span shared with another span of its trace
+	SpanIDCollisionTag = "span.id.collision"
+
+	// DefaultSpanIDCollisionWindow is the default number of recent spans whose IDs are remembered
+	DefaultSpanIDCollisionWindow = 100000
+)
+
+// ParseSpanIDCollisionMode returns the SpanIDCollisionMode with the given name, empty meaning TagSpanIDCollisions
+func ParseSpanIDCollisionMode(name string) (SpanIDCollisionMode, error) {
+	switch mode := SpanIDCollisionMode(name); mode {
+	case "":
+		return TagSpanIDCollisions, nil
+	case TagSpanIDCollisions, ReassignSpanIDCollisions:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("Unknown span ID collision mode %q", name)
+	}
+}
+
+// SpanIDCollisionOptions configure a SpanIDCollisionDetector
+type SpanIDCollisionOptions struct {
+	// WindowSize is the number of recent spans whose IDs are remembered, DefaultSpanIDCollisionWindow if 0
+	WindowSize int
+	// Mode is what happens to the colliding spans, TagSpanIDCollisions if empty
+	Mode SpanIDCollisionMode
+}
+
+// seenSpan is what the SpanIDCollisionDetector remembers of the first span with a given trace and span ID
+type seenSpan struct {
+	hash   uint64
+	client bool
+	server bool
+}
+
+// SpanIDCollisionDetector detects the spans sharing their span ID with a different recent span of their trace,
+// e.g. because of a bug of the instrumentation, which the UI cannot tell apart. The later spans are tagged, or
+// given a new span ID, and counted by the spans.span-id-collisions counter of their service. The retries of a
+// span are not collisions, neither are the client and server spans of Zipkin-style clients sharing a span ID,
+// which the query service tells apart. The children of a colliding span keep referencing the shared span ID.
+type SpanIDCollisionDetector struct {
+	options  SpanIDCollisionOptions
+	seen     *cache.LRU
+	factory  metrics.Factory
+	lock     sync.Mutex
+	counters map[string]metrics.Counter
+}
+
+// NewSpanIDCollisionDetector creates a SpanIDCollisionDetector counting the collisions in the metrics factory
+func NewSpanIDCollisionDetector(options SpanIDCollisionOptions, metricsFactory metrics.Factory) *SpanIDCollisionDetector {
+	if options.WindowSize <= 0 {
+		options.WindowSize = DefaultSpanIDCollisionWindow
+	}
+	if options.Mode == "" {
+		options.Mode = TagSpanIDCollisions
+	}
+	return &SpanIDCollisionDetector{
+		options:  options,
+		seen:     cache.NewLRU(options.WindowSize),
+		factory:  metricsFactory,
+		counters: make(map[string]metrics.Counter),
+	}
+}
+
+// DetectCollisions tags or reassigns the ID of the colliding spans, it can be used as a ProcessSpans. It must see
+// the spans as received, before any stage tagging them differently on each retry.
+func (d *SpanIDCollisionDetector) DetectCollisions(spans []*model.Span) {
+	for _, span := range spans {
+		current := seenSpan{hash: spanHash(span), client: span.IsRPCClient(), server: span.IsRPCServer()}
+		first, ok := d.seen.Get(spanKey(span)).(seenSpan)
+		if !ok {
+			d.seen.Put(spanKey(span), current)
+			continue
+		}
+		if first.hash == current.hash || (first.client && current.server) || (first.server && current.client) {
+			continue
+		}
+		if span.Process != nil {
+			d.count(span.Process.ServiceName)
+		}
+		sharedID := span.SpanID
+		if d.options.Mode == ReassignSpanIDCollisions {
+			span.SpanID = model.SpanID(current.hash)
+			if span.SpanID == 0 || span.SpanID == sharedID {
+				span.SpanID++
+			}
+		}
+		span.Tags = append(span.Tags, model.String(SpanIDCollisionTag, sharedID.String()))
+	}
+}
+
+func (d *SpanIDCollisionDetector) count(serviceName string) {
+	serviceName = NormalizeServiceName(serviceName)
+	d.lock.Lock()
+	counter, ok := d.counters[serviceName]
+	if !ok && len(d.counters) < maxServiceNames {
+		counter = d.factory.Counter("spans.span-id-collisions", map[string]string{"service": serviceName})
+		d.counters[serviceName] = counter
+	}
+	d.lock.Unlock()
+	if counter != nil {
+		counter.Inc(1)
+	}
+}
+
+// spanHash returns the hash of the content of the span, so that the retries of a span hash the same
+func spanHash(span *model.Span) uint64 {
+	hash := fnv.New64a()
+	span.Hash(hash)
+	return hash.Sum64()
+}
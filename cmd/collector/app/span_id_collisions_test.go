@@ -0,0 +1,113 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"testing"
+
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+func spanWithID(serviceName string, spanID model.SpanID, operationName string, tags ...model.KeyValue) *model.Span {
+	return &model.Span{
+		TraceID:       model.TraceID{Low: 1},
+		SpanID:        spanID,
+		OperationName: operationName,
+		Process:       &model.Process{ServiceName: serviceName},
+		Tags:          tags,
+	}
+}
+
+func TestSpanIDCollisionDetectorTag(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	d := NewSpanIDCollisionDetector(SpanIDCollisionOptions{}, metricsFactory)
+
+	first := spanWithID("svc", 7, "first")
+	retry := spanWithID("svc", 7, "first")
+	collider := spanWithID("buggy", 7, "second")
+	other := spanWithID("svc", 8, "second")
+	d.DetectCollisions([]*model.Span{first, retry, collider, other})
+
+	assert.Empty(t, first.Tags)
+	assert.Empty(t, retry.Tags, "the retries of a span are not collisions")
+	assert.Empty(t, other.Tags)
+	assert.Equal(t, model.SpanID(7), collider.SpanID)
+	assert.Equal(t, model.KeyValues{model.String(SpanIDCollisionTag, model.SpanID(7).String())}, collider.Tags)
+
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["spans.span-id-collisions|service=buggy"])
+	assert.NotContains(t, counts, "spans.span-id-collisions|service=svc")
+}
+
+func TestSpanIDCollisionDetectorReassign(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	d := NewSpanIDCollisionDetector(SpanIDCollisionOptions{Mode: ReassignSpanIDCollisions}, metricsFactory)
+
+	first := spanWithID("svc", 7, "first")
+	collider := spanWithID("svc", 7, "second")
+	retry := spanWithID("svc", 7, "second")
+	d.DetectCollisions([]*model.Span{first, collider, retry})
+
+	assert.Equal(t, model.SpanID(7), first.SpanID)
+	assert.NotEqual(t, model.SpanID(7), collider.SpanID)
+	assert.NotEqual(t, model.SpanID(0), collider.SpanID)
+	assert.Equal(t, collider.SpanID, retry.SpanID, "the retries of a colliding span get the same span ID")
+	assert.Equal(t, model.KeyValues{model.String(SpanIDCollisionTag, model.SpanID(7).String())}, collider.Tags)
+
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counts["spans.span-id-collisions|service=svc"])
+}
+
+func TestSpanIDCollisionDetectorSharedSpans(t *testing.T) {
+	d := NewSpanIDCollisionDetector(SpanIDCollisionOptions{Mode: ReassignSpanIDCollisions}, metrics.NullFactory)
+
+	client := spanWithID("frontend", 7, "call", model.String(string(ext.SpanKind), string(ext.SpanKindRPCClientEnum)))
+	server := spanWithID("backend", 7, "call", model.String(string(ext.SpanKind), string(ext.SpanKindRPCServerEnum)))
+	d.DetectCollisions([]*model.Span{client, server})
+
+	assert.Equal(t, model.SpanID(7), server.SpanID, "Zipkin-style clients share the span ID with the server")
+	assert.Len(t, server.Tags, 1)
+}
+
+func TestSpanIDCollisionDetectorWindow(t *testing.T) {
+	d := NewSpanIDCollisionDetector(SpanIDCollisionOptions{WindowSize: 1}, metrics.NullFactory)
+
+	first := spanWithID("svc", 7, "first")
+	collider := spanWithID("svc", 7, "second")
+	d.DetectCollisions([]*model.Span{first, spanWithID("svc", 8, "other"), collider})
+
+	assert.Empty(t, collider.Tags, "the span ID of the first span is forgotten")
+}
+
+func TestParseSpanIDCollisionMode(t *testing.T) {
+	for name, expected := range map[string]SpanIDCollisionMode{"": TagSpanIDCollisions, "tag": TagSpanIDCollisions, "reassign": ReassignSpanIDCollisions} {
+		mode, err := ParseSpanIDCollisionMode(name)
+		require.NoError(t, err)
+		assert.Equal(t, expected, mode)
+	}
+	_, err := ParseSpanIDCollisionMode("drop")
+	assert.EqualError(t, err, `Unknown span ID collision mode "drop"`)
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"sync"
+
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+const (
+	// maxSpanMetricsOperations bounds the number of service/operation pairs with their own metrics,
+	// the spans of additional pairs are counted under otherOperation
+	maxSpanMetricsOperations = 10000
+	otherOperation           = "other"
+)
+
+// SpanMetrics derives request, error and duration (RED) metrics from the spans received by the collector,
+// tagged by service and operation. The metrics of each service/operation pair are created once and
+// cached, so recording a span only costs a map lookup under a read lock.
+type SpanMetrics struct {
+	lock        sync.RWMutex
+	factory     metrics.Factory
+	byOperation map[serviceOperation]*operationMetrics
+	other       *operationMetrics
+}
+
+type serviceOperation struct {
+	service   string
+	operation string
+}
+
+type operationMetrics struct {
+	// Requests counts the spans of the operation
+	Requests metrics.Counter `metric:"requests"`
+	// Errors counts the spans of the operation with the error tag set
+	Errors metrics.Counter `metric:"errors"`
+	// Duration records the duration of the spans of the operation
+	Duration metrics.Timer `metric:"duration"`
+}
+
+// NewSpanMetrics creates SpanMetrics emitting the metrics to the given factory
+func NewSpanMetrics(metricsFactory metrics.Factory) *SpanMetrics {
+	return &SpanMetrics{
+		factory:     metricsFactory,
+		byOperation: make(map[serviceOperation]*operationMetrics),
+	}
+}
+
+// RecordSpan updates the metrics of the service and operation of the span, it can be used as a ProcessSpan.
+func (m *SpanMetrics) RecordSpan(span *model.Span) {
+	om := m.operationMetrics(serviceOperation{service: span.Process.ServiceName, operation: span.OperationName})
+	om.Requests.Inc(1)
+	if isError(span) {
+		om.Errors.Inc(1)
+	}
+	om.Duration.Record(span.Duration)
+}
+
+func (m *SpanMetrics) operationMetrics(key serviceOperation) *operationMetrics {
+	m.lock.RLock()
+	om, ok := m.byOperation[key]
+	m.lock.RUnlock()
+	if ok {
+		return om
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if om, ok := m.byOperation[key]; ok {
+		return om
+	}
+	if len(m.byOperation) >= maxSpanMetricsOperations {
+		if m.other == nil {
+			m.other = m.newOperationMetrics(otherOperation, otherOperation)
+		}
+		return m.other
+	}
+	// names are only normalized here so that recording the spans of known operations stays cheap
+	om = m.newOperationMetrics(NormalizeServiceName(key.service), NormalizeServiceName(key.operation))
+	m.byOperation[key] = om
+	return om
+}
+
+func (m *SpanMetrics) newOperationMetrics(service, operation string) *operationMetrics {
+	om := &operationMetrics{}
+	metrics.Init(om, m.factory, map[string]string{"service": service, "operation": operation})
+	return om
+}
+
+func isError(span *model.Span) bool {
+	tag, ok := span.Tags.FindByKey(string(ext.Error))
+	if !ok {
+		return false
+	}
+	if tag.VType == model.BoolType {
+		return tag.Bool()
+	}
+	return tag.AsString() == "true"
+}
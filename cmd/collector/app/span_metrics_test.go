@@ -0,0 +1,69 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+func TestSpanMetrics(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	spanMetrics := NewSpanMetrics(metricsFactory)
+	spans := []*model.Span{
+		{OperationName: "GET /", Duration: time.Millisecond},
+		{OperationName: "GET /", Duration: time.Millisecond, Tags: model.KeyValues{model.Bool("error", true)}},
+		{OperationName: "GET /", Duration: time.Millisecond, Tags: model.KeyValues{model.String("error", "true")}},
+		{OperationName: "GET /", Duration: time.Millisecond, Tags: model.KeyValues{model.Bool("error", false)}},
+		{OperationName: "query", Duration: time.Millisecond},
+	}
+	for _, span := range spans {
+		span.Process = &model.Process{ServiceName: "Frontend"}
+		spanMetrics.RecordSpan(span)
+	}
+
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 4, counters["requests|operation=get__|service=frontend"])
+	assert.EqualValues(t, 2, counters["errors|operation=get__|service=frontend"])
+	assert.EqualValues(t, 1, counters["requests|operation=query|service=frontend"])
+	assert.EqualValues(t, 0, counters["errors|operation=query|service=frontend"])
+}
+
+func TestSpanMetricsBoundsOperations(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	spanMetrics := NewSpanMetrics(metricsFactory)
+	for i := 0; i < maxSpanMetricsOperations+2; i++ {
+		spanMetrics.RecordSpan(&model.Span{
+			OperationName: fmt.Sprintf("op-%d", i),
+			Process:       &model.Process{ServiceName: "svc"},
+		})
+	}
+	assert.Len(t, spanMetrics.byOperation, maxSpanMetricsOperations)
+
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counters["requests|operation=other|service=other"])
+}
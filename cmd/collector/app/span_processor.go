@@ -21,6 +21,9 @@
 package app
 
 import (
+	"context"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/uber/tchannel-go"
@@ -38,32 +41,124 @@ type spanProcessor struct {
 	metrics         *SpanProcessorMetrics
 	preProcessSpans ProcessSpans
 	filterSpan      FilterSpan             // filter is called before the sanitizer but after preProcessSpans
-	sanitizer       sanitizer.SanitizeSpan // sanitizer is called before processSpan
-	processSpan     ProcessSpan
+	sanitizer       sanitizer.SanitizeSpan // sanitizer is called before preSave
+	preSave         ProcessSpan            // preSave is called before the span is saved
 	logger          *zap.Logger
 	spanWriter      spanstore.Writer
 	reportBusy      bool
 	numWorkers      int
+	workerPool      *WorkerPool
+	spanLog         SpanLog
+	backpressure    *BackpressureOptions
+	admission       *AdmissionController
+	droppedSpans    *DroppedSpanSampler
+	// replayStop is closed to stop replaying the span log, replayDone once the replay returned
+	replayStop     chan struct{}
+	replayDone     chan struct{}
+	stopReplayOnce sync.Once
+	// throttling is 1 from the time the queue utilization reaches the high-water mark until it falls back to
+	// the low-water mark
+	throttling int32
+}
+
+// BackpressureOptions make the span processor reject the batches of spans with tchannel.ErrServerBusy while its
+// queue is filled beyond its high-water mark, well-behaved clients then backing off and retrying the batches later.
+// Over TChannel, agents receive a system error with the code ErrCodeBusy, over HTTP clients receive a
+// 429 Too Many Requests response.
+type BackpressureOptions struct {
+	// HighWaterMark is the fraction of the queue capacity, between 0 and 1, from which batches are rejected
+	HighWaterMark float64
+	// LowWaterMark is the fraction of the queue capacity below which batches are accepted again,
+	// HighWaterMark if zero or larger
+	LowWaterMark float64
+}
+
+// SpanLog durably records the spans accepted by the processor until they are saved
+type SpanLog interface {
+	// Append records the span, the returned function is called once the span is saved or discarded
+	Append(span *model.Span) (commit func(), err error)
+	// Replay passes the spans recorded before the last start and never committed to save until stop is closed,
+	// the spans failing to be saved or not replayed being kept for the next start
+	Replay(save func(*model.Span) error, stop <-chan struct{}) error
 }
 
 type queueItem struct {
 	queuedTime time.Time
 	span       *model.Span
+	format     string
+	// commit removes the span from the span log once it is saved, nil without a span log
+	commit func()
+	// batch is acknowledged once all its spans are saved, nil if the batch is not acknowledged
+	batch *batchAck
+}
+
+// batchAck calls back once all the spans of a batch are saved or failed
+type batchAck struct {
+	pending int32
+	failed  int32
+	ack     func(saved bool)
+}
+
+func newBatchAck(size int, ack func(saved bool)) *batchAck {
+	return &batchAck{pending: int32(size), ack: ack}
+}
+
+// hold adds a part to the batch, e.g. the spans of another ProcessSpansWithAck call, which is acknowledged
+// once the part is done too. It does nothing on a nil batch.
+func (b *batchAck) hold() {
+	if b == nil {
+		return
+	}
+	atomic.AddInt32(&b.pending, 1)
+}
+
+// done records whether a span of the batch was saved, it does nothing on a nil batch
+func (b *batchAck) done(saved bool) {
+	if b == nil {
+		return
+	}
+	if !saved {
+		atomic.StoreInt32(&b.failed, 1)
+	}
+	if atomic.AddInt32(&b.pending, -1) == 0 {
+		b.ack(atomic.LoadInt32(&b.failed) == 0)
+	}
+}
+
+// fail records the spans of the batch that were not queued
+func (b *batchAck) fail(spans []*model.Span) {
+	for range spans {
+		b.done(false)
+	}
 }
 
 // NewSpanProcessor returns a SpanProcessor that preProcesses, filters, queues, sanitizes, and processes spans
 func NewSpanProcessor(
 	spanWriter spanstore.Writer,
 	opts ...Option,
-) SpanProcessor {
+) QueuedSpanProcessor {
 	sp := newSpanProcessor(spanWriter, opts...)
+	if sp.spanLog != nil {
+		// in the background, so that the collector accepts new spans while a large span log is replayed
+		sp.replayStop = make(chan struct{})
+		sp.replayDone = make(chan struct{})
+		go sp.replay()
+	}
 
-	sp.queue.StartConsumers(sp.numWorkers, func(item interface{}) {
+	consumer := func(item interface{}) {
 		value := item.(*queueItem)
 		sp.processItemFromQueue(value)
-	})
+	}
+	if sp.workerPool != nil {
+		sp.workerPool.start(sp.queue, consumer)
+	} else {
+		sp.queue.StartConsumers(sp.numWorkers, consumer)
+	}
 
 	sp.queue.StartLengthReporting(1*time.Second, sp.metrics.QueueLength)
+	sp.queue.StartUtilizationReporting(1*time.Second, sp.metrics.QueueUtilization)
+	sp.queue.StartCapacityReporting(1*time.Second, sp.metrics.QueueCapacity)
+	sp.queue.StartConsumersReporting(1*time.Second, sp.metrics.WorkersBusy, sp.metrics.WorkersIdle)
 
 	return sp
 }
@@ -75,7 +170,13 @@ func newSpanProcessor(spanWriter spanstore.Writer, opts ...Option) *spanProcesso
 		options.hostMetrics,
 		options.extraFormatTypes)
 	droppedItemHandler := func(item interface{}) {
+		value := item.(*queueItem)
 		handlerMetrics.SpansDropped.Inc(1)
+		handlerMetrics.GetCountsForFormat(value.format).ByFormat.Dropped.Inc(1)
+		if options.droppedSpans != nil {
+			options.droppedSpans.Record(value.span, value.format, DroppedByQueue)
+		}
+		value.batch.done(false)
 	}
 	boundedQueue := queue.NewBoundedQueue(options.queueSize, droppedItemHandler)
 
@@ -88,39 +189,118 @@ func newSpanProcessor(spanWriter spanstore.Writer, opts ...Option) *spanProcesso
 		sanitizer:       options.sanitizer,
 		reportBusy:      options.reportBusy,
 		numWorkers:      options.numWorkers,
+		workerPool:      options.workerPool,
 		spanWriter:      spanWriter,
+		preSave:         options.preSave,
+		spanLog:         options.spanLog,
+		backpressure:    options.backpressure,
+		admission:       options.admission,
+		droppedSpans:    options.droppedSpans,
+	}
+	if sp.backpressure != nil && (sp.backpressure.LowWaterMark <= 0 || sp.backpressure.LowWaterMark > sp.backpressure.HighWaterMark) {
+		sp.backpressure.LowWaterMark = sp.backpressure.HighWaterMark
 	}
-	sp.processSpan = ChainedProcessSpan(
-		options.preSave,
-		sp.saveSpan,
-	)
 
 	return &sp
 }
 
 // Stop halts the span processor and all its go-routines.
 func (sp *spanProcessor) Stop() {
+	sp.stopReplay()
 	sp.queue.Stop()
 }
 
-func (sp *spanProcessor) saveSpan(span *model.Span) {
+// Drain stops accepting spans and saves the queued ones until the queue is empty or the context is done.
+// The spans of the span log not replayed yet are kept for the next start.
+func (sp *spanProcessor) Drain(ctx context.Context) int {
+	sp.stopReplay()
+	return sp.queue.Drain(ctx)
+}
+
+func (sp *spanProcessor) replay() {
+	defer close(sp.replayDone)
+	if err := sp.spanLog.Replay(sp.replaySpan, sp.replayStop); err != nil {
+		sp.logger.Error("Failed to replay the span log", zap.Error(err))
+	}
+}
+
+// stopReplay stops replaying the span log and waits for the span being saved, if any
+func (sp *spanProcessor) stopReplay() {
+	if sp.replayStop == nil {
+		return
+	}
+	sp.stopReplayOnce.Do(func() {
+		close(sp.replayStop)
+	})
+	<-sp.replayDone
+}
+
+func (sp *spanProcessor) saveSpan(span *model.Span, format string) bool {
 	startTime := time.Now()
-	if err := sp.spanWriter.WriteSpan(span); err != nil {
+	err := sp.spanWriter.WriteSpan(span)
+	if err == spanstore.ErrSpanBuffered {
+		sp.metrics.GetCountsForFormat(format).ByFormat.Buffered.Inc(1)
+		// not written yet, so the batch of the span is not acknowledged
+		return false
+	}
+	if err != nil {
 		sp.logger.Error("Failed to save span", zap.Error(err))
 	} else {
 		sp.metrics.SavedBySvc.ReportServiceNameForSpan(span)
+		sp.metrics.GetCountsForFormat(format).ByFormat.Saved.Inc(1)
 	}
-	sp.metrics.SaveLatency.Record(time.Now().Sub(startTime))
+	now := time.Now()
+	if err == nil {
+		sp.metrics.RecordIngestionLatency(span, now)
+	}
+	sp.metrics.SaveLatency.Record(now.Sub(startTime))
+	return err == nil
+}
+
+// replaySpan saves a span recovered from the span log, the span storage errors being counted by the log
+func (sp *spanProcessor) replaySpan(span *model.Span) error {
+	span = sp.sanitizer(span)
+	sp.preSave(span)
+	return sp.spanWriter.WriteSpan(span)
 }
 
 func (sp *spanProcessor) ProcessSpans(mSpans []*model.Span, spanFormat string) ([]bool, error) {
+	return sp.processSpans(mSpans, spanFormat, nil)
+}
+
+// ProcessSpansWithAck acknowledges the batch once its queued spans are saved, the spans dropped from the queue
+// failing the batch
+func (sp *spanProcessor) ProcessSpansWithAck(mSpans []*model.Span, spanFormat string, ack func(saved bool)) error {
+	if len(mSpans) == 0 {
+		ack(true)
+		return nil
+	}
+	_, err := sp.processSpans(mSpans, spanFormat, newBatchAck(len(mSpans), ack))
+	return err
+}
+
+func (sp *spanProcessor) processSpans(mSpans []*model.Span, spanFormat string, batch *batchAck) ([]bool, error) {
+	if sp.admission != nil {
+		if err := sp.admission.AdmitBatch(); err != nil {
+			batch.fail(mSpans)
+			return nil, err
+		}
+	}
+	if sp.throttled() {
+		sp.metrics.BatchesThrottled.Inc(1)
+		batch.fail(mSpans)
+		return nil, tchannel.ErrServerBusy
+	}
 	sp.preProcessSpans(mSpans)
-	sp.metrics.GetCountsForFormat(spanFormat).Received.Inc(int64(len(mSpans)))
+	spanCounts := sp.metrics.GetCountsForFormat(spanFormat)
+	spanCounts.Received.Inc(int64(len(mSpans)))
+	spanCounts.ByFormat.Received.Inc(int64(len(mSpans)))
 	sp.metrics.BatchSize.Update(int64(len(mSpans)))
 	retMe := make([]bool, len(mSpans))
 	for i, mSpan := range mSpans {
-		ok := sp.enqueueSpan(mSpan, spanFormat)
+		ok := sp.enqueueSpan(mSpan, spanFormat, batch)
 		if !ok && sp.reportBusy {
+			batch.fail(mSpans[i+1:])
 			return nil, tchannel.ErrServerBusy
 		}
 		retMe[i] = ok
@@ -128,26 +308,83 @@ func (sp *spanProcessor) ProcessSpans(mSpans []*model.Span, spanFormat string) (
 	return retMe, nil
 }
 
+// throttled returns whether the batches are rejected, from the time the queue utilization reaches the
+// high-water mark until it falls back to the low-water mark
+func (sp *spanProcessor) throttled() bool {
+	if sp.backpressure == nil {
+		return false
+	}
+	utilization := sp.queue.Utilization()
+	if utilization >= sp.backpressure.HighWaterMark {
+		atomic.StoreInt32(&sp.throttling, 1)
+		return true
+	}
+	if utilization <= sp.backpressure.LowWaterMark {
+		atomic.StoreInt32(&sp.throttling, 0)
+		return false
+	}
+	return atomic.LoadInt32(&sp.throttling) == 1
+}
+
 func (sp *spanProcessor) processItemFromQueue(item *queueItem) {
-	sp.processSpan(sp.sanitizer(item.span))
+	span := sp.sanitizer(item.span)
+	sp.preSave(span)
+	saved := sp.saveSpan(span, item.format)
+	if item.commit != nil && saved {
+		// the spans failing to be saved stay in the span log, which saves them again on the next start
+		item.commit()
+	}
+	item.batch.done(saved)
 	sp.metrics.InQueueLatency.Record(time.Now().Sub(item.queuedTime))
 }
 
-func (sp *spanProcessor) enqueueSpan(span *model.Span, originalFormat string) bool {
+func (sp *spanProcessor) enqueueSpan(span *model.Span, originalFormat string, batch *batchAck) bool {
 	spanCounts := sp.metrics.GetCountsForFormat(originalFormat)
 	spanCounts.ReceivedBySvc.ReportServiceNameForSpan(span)
 
+	if sp.admission != nil && !sp.admission.AdmitSpan(span) {
+		sp.recordDropped(span, originalFormat, DroppedByAdmission)
+		batch.done(true)
+		return true // shed spans are counted by the admission controller
+	}
 	if !sp.filterSpan(span) {
 		spanCounts.Rejected.Inc(int64(1))
+		sp.recordDropped(span, originalFormat, DroppedByFilter)
+		batch.done(true)
 		return true // as in "not dropped", because it's actively rejected
 	}
 	item := &queueItem{
 		queuedTime: time.Now(),
 		span:       span,
+		format:     originalFormat,
+		batch:      batch,
+	}
+	if sp.spanLog != nil {
+		commit, err := sp.spanLog.Append(span)
+		if err != nil {
+			sp.logger.Error("Failed to record span in the span log", zap.Error(err))
+			sp.metrics.ErrorBusy.Inc(1)
+			batch.done(false)
+			return false
+		}
+		item.commit = commit
 	}
 	addedToQueue := sp.queue.Produce(item)
-	if !addedToQueue {
+	if addedToQueue {
+		spanCounts.ByFormat.Queued.Inc(1)
+	} else {
 		sp.metrics.ErrorBusy.Inc(1)
+		if item.commit != nil {
+			// the span was not accepted, so the client is responsible for it
+			item.commit()
+		}
 	}
 	return addedToQueue
 }
+
+// recordDropped retains the span in the dropped span sampler if there is one
+func (sp *spanProcessor) recordDropped(span *model.Span, format string, reason string) {
+	if sp.droppedSpans != nil {
+		sp.droppedSpans.Record(span, format, reason)
+	}
+}
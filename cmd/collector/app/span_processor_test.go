@@ -23,19 +23,24 @@ package app
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/uber/jaeger-lib/metrics"
 	metricsTest "github.com/uber/jaeger-lib/metrics/testutils"
+	"github.com/uber/tchannel-go"
 	"github.com/uber/tchannel-go/thrift"
 	"go.uber.org/zap"
 	"golang.org/x/net/context"
 
 	zipkinSanitizer "github.com/uber/jaeger/cmd/collector/app/sanitizer/zipkin"
 	"github.com/uber/jaeger/model"
+	zipkinConv "github.com/uber/jaeger/model/converter/thrift/zipkin"
 	"github.com/uber/jaeger/pkg/testutils"
+	"github.com/uber/jaeger/storage/spanstore"
 	"github.com/uber/jaeger/thrift-gen/jaeger"
 	zc "github.com/uber/jaeger/thrift-gen/zipkincore"
 )
@@ -94,12 +99,18 @@ func TestBySvcMetrics(t *testing.T) {
 		var metricPrefix string
 		if test.format == ZipkinFormatType {
 			span := makeZipkinSpan(test.serviceName, test.rootSpan, test.debug)
-			zHandler := NewZipkinSpanHandler(logger, processor, zipkinSanitizer.NewParentIDSanitizer(logger))
+			zHandler := NewZipkinSpanHandler(
+				logger,
+				processor,
+				zipkinSanitizer.NewParentIDSanitizer(logger),
+				zipkinConv.NewConverter(zipkinConv.ReferenceRules{}),
+				metrics.NullFactory,
+			)
 			zHandler.SubmitZipkinBatch(tctx, []*zc.Span{span, span})
 			metricPrefix = "service.zipkin"
 		} else if test.format == JaegerFormatType {
 			span, process := makeJaegerSpan(test.serviceName, test.rootSpan, test.debug)
-			jHandler := NewJaegerSpanHandler(logger, processor)
+			jHandler := NewJaegerSpanHandler(logger, processor, metrics.NullFactory)
 			jHandler.SubmitBatches(tctx, []*jaeger.Batch{
 				{
 					Spans: []*jaeger.Span{
@@ -116,6 +127,7 @@ func TestBySvcMetrics(t *testing.T) {
 		expected := []metricsTest.ExpectedMetric{
 			{Name: metricPrefix + ".spans.recd", Value: 2},
 			{Name: metricPrefix + ".spans.by-svc." + test.serviceName, Value: 2},
+			{Name: "service.spans.received|format=" + test.format, Value: 2},
 		}
 		if test.debug {
 			expected = append(expected, metricsTest.ExpectedMetric{
@@ -136,6 +148,8 @@ func TestBySvcMetrics(t *testing.T) {
 				Name: "host.error.busy", Value: 2,
 			}, metricsTest.ExpectedMetric{
 				Name: "host.spans.dropped", Value: 2,
+			}, metricsTest.ExpectedMetric{
+				Name: "service.spans.dropped|format=" + test.format, Value: 2,
 			})
 		} else {
 			expected = append(expected, metricsTest.ExpectedMetric{
@@ -224,6 +238,36 @@ func TestSpanProcessor(t *testing.T) {
 	assert.Equal(t, []bool{true}, res)
 }
 
+func TestSpanProcessorFormatMetrics(t *testing.T) {
+	mb := metrics.NewLocalFactory(time.Hour)
+	w := &countingWriter{}
+	p := NewSpanProcessor(w,
+		Options.ServiceMetrics(mb.Namespace("service", nil)),
+		Options.HostMetrics(mb.Namespace("host", nil)),
+		Options.ExtraFormatTypes([]string{GRPCFormatType}),
+	)
+	span := &model.Span{Process: &model.Process{ServiceName: "x"}}
+	for _, format := range []string{JaegerFormatType, ZipkinFormatType, ZipkinFormatType, GRPCFormatType} {
+		_, err := p.ProcessSpans([]*model.Span{span}, format)
+		require.NoError(t, err)
+	}
+	require.Equal(t, 0, p.Drain(context.Background()))
+
+	expected := []metricsTest.ExpectedMetric{
+		{Name: "service.spans.received|format=grpc", Value: 1},
+		{Name: "service.spans.queued|format=grpc", Value: 1},
+		{Name: "service.spans.saved|format=grpc", Value: 1},
+	}
+	for format, count := range map[string]int{JaegerFormatType: 1, ZipkinFormatType: 2} {
+		for _, stage := range []string{"received", "queued", "saved"} {
+			expected = append(expected, metricsTest.ExpectedMetric{
+				Name: "service.spans." + stage + "|format=" + format, Value: count,
+			})
+		}
+	}
+	metricsTest.AssertCounterMetrics(t, mb, expected...)
+}
+
 func TestSpanProcessorErrors(t *testing.T) {
 	logger, logBuf := testutils.NewLogger()
 	w := &fakeSpanWriter{
@@ -253,6 +297,24 @@ func TestSpanProcessorErrors(t *testing.T) {
 	}, logBuf.JSONLine(0))
 }
 
+func TestSpanProcessorBufferedSpans(t *testing.T) {
+	mb := metrics.NewLocalFactory(time.Hour)
+	logger, logBuf := testutils.NewLogger()
+	p := NewSpanProcessor(&fakeSpanWriter{err: spanstore.ErrSpanBuffered},
+		Options.ServiceMetrics(mb.Namespace("service", nil)),
+		Options.HostMetrics(mb.Namespace("host", nil)),
+		Options.Logger(logger),
+	)
+	_, err := p.ProcessSpans([]*model.Span{{Process: &model.Process{ServiceName: "x"}}}, JaegerFormatType)
+	require.NoError(t, err)
+	require.Equal(t, 0, p.Drain(context.Background()))
+
+	counters, _ := mb.Snapshot()
+	assert.EqualValues(t, 1, counters["service.spans.buffered|format=jaeger"])
+	assert.EqualValues(t, 0, counters["service.spans.saved|format=jaeger"])
+	assert.Equal(t, "", logBuf.String(), "the buffered spans are not logged as failures")
+}
+
 type blockingWriter struct {
 	sync.Mutex
 }
@@ -298,3 +360,283 @@ func TestSpanProcessorBusy(t *testing.T) {
 	assert.Error(t, err, "expcting busy error")
 	assert.Nil(t, res)
 }
+
+func TestSpanProcessorBackpressure(t *testing.T) {
+	mb := metrics.NewLocalFactory(0)
+	p := newSpanProcessor(&fakeSpanWriter{},
+		Options.HostMetrics(mb),
+		Options.QueueSize(8),
+		Options.Backpressure(BackpressureOptions{HighWaterMark: 0.5, LowWaterMark: 0.25}),
+	)
+	defer p.Stop()
+	span := &model.Span{Process: &model.Process{ServiceName: "x"}}
+	waitForSize := func(size int) {
+		for i := 0; i < 1000 && p.queue.Size() != size; i++ {
+			time.Sleep(time.Millisecond)
+		}
+		require.Equal(t, size, p.queue.Size())
+	}
+
+	// the consumers are not started yet, so that the queue fills up
+	oks, err := p.ProcessSpans([]*model.Span{span, span, span, span}, JaegerFormatType)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, true, true, true}, oks)
+	_, err = p.ProcessSpans([]*model.Span{span}, JaegerFormatType)
+	assert.Equal(t, tchannel.ErrServerBusy, err)
+
+	release := make(chan struct{})
+	defer close(release)
+	p.queue.StartConsumers(1, func(item interface{}) {
+		<-release
+	})
+	// between the water marks the batches are still rejected
+	waitForSize(3)
+	_, err = p.ProcessSpans([]*model.Span{span}, JaegerFormatType)
+	assert.Equal(t, tchannel.ErrServerBusy, err)
+
+	release <- struct{}{}
+	waitForSize(2)
+	oks, err = p.ProcessSpans([]*model.Span{span}, JaegerFormatType)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true}, oks)
+
+	counters, _ := mb.Snapshot()
+	assert.EqualValues(t, 2, counters["batches.throttled"])
+}
+
+func TestSpanProcessorAdmission(t *testing.T) {
+	memory, goroutines := uint64(0), 100
+	admission := newTestAdmissionController(AdmissionOptions{MaxGoroutines: 50}, metrics.NullFactory, &memory, &goroutines)
+	w := &fakeSpanWriter{}
+	p := newSpanProcessor(w, Options.QueueSize(1), Options.Admission(admission))
+	defer p.Stop()
+	span := &model.Span{Process: &model.Process{ServiceName: "x"}}
+
+	admission.Check()
+	_, err := p.ProcessSpans([]*model.Span{span}, JaegerFormatType)
+	assert.Equal(t, tchannel.ErrServerBusy, err)
+	assert.Equal(t, 0, p.queue.Size())
+
+	goroutines = 10
+	admission.Check()
+	oks, err := p.ProcessSpans([]*model.Span{span}, JaegerFormatType)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true}, oks)
+	assert.Equal(t, 1, p.queue.Size())
+}
+
+func TestSpanProcessorDroppedSpans(t *testing.T) {
+	memory, goroutines := uint64(0), 100
+	admission := newTestAdmissionController(AdmissionOptions{MaxGoroutines: 50, ShedRatio: 0.5}, metrics.NullFactory, &memory, &goroutines)
+	admission.Check()
+	droppedSpans := NewDroppedSpanSampler(DroppedSpanSamplerOptions{BufferSize: 10, SampleRate: 1}, metrics.NullFactory)
+	p := newSpanProcessor(&fakeSpanWriter{},
+		Options.QueueSize(1),
+		Options.Admission(admission),
+		Options.SpanFilter(func(span *model.Span) bool { return span.OperationName != "filtered" }),
+		Options.DroppedSpans(droppedSpans),
+	)
+	defer p.Stop()
+
+	// the consumers are not started, so that the second admitted span does not fit in the queue
+	spans := []*model.Span{
+		{TraceID: model.TraceID{Low: 1}, OperationName: "shed", Process: &model.Process{ServiceName: "x"}},
+		{TraceID: model.TraceID{Low: 9999}, OperationName: "filtered", Process: &model.Process{ServiceName: "x"}},
+		{TraceID: model.TraceID{Low: 9999}, OperationName: "queued", Process: &model.Process{ServiceName: "x"}},
+		{TraceID: model.TraceID{Low: 9999}, OperationName: "overflow", Process: &model.Process{ServiceName: "x"}},
+	}
+	oks, err := p.ProcessSpans(spans, JaegerFormatType)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, true, true, false}, oks)
+
+	dropped := droppedSpans.Spans()
+	require.Len(t, dropped, 3)
+	assert.Equal(t, DroppedByQueue, dropped[0].Reason)
+	assert.Equal(t, "overflow", dropped[0].Span.OperationName)
+	assert.Equal(t, DroppedByFilter, dropped[1].Reason)
+	assert.Equal(t, "filtered", dropped[1].Span.OperationName)
+	assert.Equal(t, DroppedByAdmission, dropped[2].Reason)
+	assert.Equal(t, "shed", dropped[2].Span.OperationName)
+	assert.Equal(t, JaegerFormatType, dropped[2].Format)
+}
+
+type countingWriter struct {
+	count int32
+}
+
+func (w *countingWriter) WriteSpan(span *model.Span) error {
+	atomic.AddInt32(&w.count, 1)
+	return nil
+}
+
+func TestSpanProcessorDrain(t *testing.T) {
+	w := &countingWriter{}
+	p := NewSpanProcessor(w, Options.NumWorkers(1), Options.QueueSize(10))
+
+	spans := make([]*model.Span, 10)
+	for i := range spans {
+		spans[i] = &model.Span{Process: &model.Process{ServiceName: "x"}}
+	}
+	_, err := p.ProcessSpans(spans, JaegerFormatType)
+	require.NoError(t, err)
+
+	assert.Equal(t, 0, p.Drain(context.Background()))
+	assert.EqualValues(t, 10, atomic.LoadInt32(&w.count))
+
+	res, err := p.ProcessSpans(spans[:1], JaegerFormatType)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{false}, res, "spans are not accepted after draining")
+}
+
+// fakeSpanLog commits spans by operation name, and replays the spans it is created with
+type fakeSpanLog struct {
+	sync.Mutex
+	recovered []*model.Span
+	appended  []string
+	committed []string
+	err       error
+}
+
+func (l *fakeSpanLog) Append(span *model.Span) (func(), error) {
+	l.Lock()
+	defer l.Unlock()
+	if l.err != nil {
+		return nil, l.err
+	}
+	l.appended = append(l.appended, span.OperationName)
+	return func() {
+		l.Lock()
+		defer l.Unlock()
+		l.committed = append(l.committed, span.OperationName)
+	}, nil
+}
+
+func (l *fakeSpanLog) Replay(save func(*model.Span) error, stop <-chan struct{}) error {
+	for _, span := range l.recovered {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+		save(span)
+	}
+	return nil
+}
+
+// recordingWriter records the operation names of the spans, failing the ones named "fail"
+type recordingWriter struct {
+	sync.Mutex
+	operations []string
+}
+
+func (w *recordingWriter) WriteSpan(span *model.Span) error {
+	w.Lock()
+	defer w.Unlock()
+	w.operations = append(w.operations, span.OperationName)
+	if span.OperationName == "fail" {
+		return fmt.Errorf("some-error")
+	}
+	return nil
+}
+
+func TestSpanProcessorSpanLog(t *testing.T) {
+	spanLog := &fakeSpanLog{recovered: []*model.Span{{OperationName: "recovered", Process: &model.Process{ServiceName: "x"}}}}
+	w := &recordingWriter{}
+	p := NewSpanProcessor(w,
+		Options.NumWorkers(1),
+		Options.QueueSize(10),
+		Options.SpanLog(spanLog),
+		Options.Sanitizer(func(span *model.Span) *model.Span {
+			span.Process.ServiceName = "sanitized"
+			return span
+		}),
+	)
+
+	res, err := p.ProcessSpans([]*model.Span{
+		{OperationName: "ok", Process: &model.Process{ServiceName: "x"}},
+		{OperationName: "fail", Process: &model.Process{ServiceName: "x"}},
+	}, JaegerFormatType)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, true}, res)
+
+	spanLog.Lock()
+	spanLog.err = fmt.Errorf("disk full")
+	spanLog.Unlock()
+	res, err = p.ProcessSpans([]*model.Span{{OperationName: "rejected", Process: &model.Process{ServiceName: "x"}}}, JaegerFormatType)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{false}, res, "spans that cannot be logged are not accepted")
+
+	<-p.(*spanProcessor).replayDone
+	require.Equal(t, 0, p.Drain(context.Background()))
+	w.Lock()
+	// the recovered spans are replayed while the new ones are accepted
+	assert.Len(t, w.operations, 3)
+	assert.Contains(t, w.operations, "recovered")
+	assert.Equal(t, "sanitized", spanLog.recovered[0].Process.ServiceName)
+	w.Unlock()
+	spanLog.Lock()
+	defer spanLog.Unlock()
+	assert.Equal(t, []string{"ok", "fail"}, spanLog.appended)
+	assert.Equal(t, []string{"ok"}, spanLog.committed, "spans failing to be saved are kept for the next start")
+}
+
+func TestSpanProcessorSpanLogReplayStopped(t *testing.T) {
+	spanLog := &stoppedSpanLog{}
+	// the processor is created while the replay is still running
+	p := NewSpanProcessor(&fakeSpanWriter{}, Options.SpanLog(spanLog))
+	assert.Equal(t, 0, p.Drain(context.Background()))
+	assert.EqualValues(t, 1, atomic.LoadInt32(&spanLog.stopped), "the replay is stopped by draining")
+}
+
+// stoppedSpanLog replays no span until it is stopped
+type stoppedSpanLog struct {
+	fakeSpanLog
+	stopped int32
+}
+
+func (l *stoppedSpanLog) Replay(save func(*model.Span) error, stop <-chan struct{}) error {
+	<-stop
+	atomic.StoreInt32(&l.stopped, 1)
+	return nil
+}
+
+func TestSpanProcessorWithAck(t *testing.T) {
+	// the buffered spans are not written yet, so their batch is not acknowledged as saved
+	for _, writeErr := range []error{nil, fmt.Errorf("some-error"), spanstore.ErrSpanBuffered} {
+		p := NewSpanProcessor(&fakeSpanWriter{err: writeErr})
+		acks := make(chan bool, 1)
+		span := &model.Span{Process: &model.Process{ServiceName: "x"}}
+		err := p.ProcessSpansWithAck([]*model.Span{span, span}, JaegerFormatType, func(saved bool) {
+			acks <- saved
+		})
+		require.NoError(t, err)
+		require.Equal(t, 0, p.Drain(context.Background()))
+		assert.Equal(t, writeErr == nil, <-acks)
+		assert.Len(t, acks, 0, "the batch is acknowledged once")
+	}
+}
+
+func TestSpanProcessorWithAckBusy(t *testing.T) {
+	p := newSpanProcessor(&fakeSpanWriter{},
+		Options.QueueSize(2),
+		Options.Backpressure(BackpressureOptions{HighWaterMark: 0.5}),
+	)
+	defer p.Stop()
+	span := &model.Span{Process: &model.Process{ServiceName: "x"}}
+	// the consumers are not started yet, so that the queue stays half full
+	_, err := p.ProcessSpans([]*model.Span{span}, JaegerFormatType)
+	require.NoError(t, err)
+
+	var acks []bool
+	err = p.ProcessSpansWithAck([]*model.Span{span}, JaegerFormatType, func(saved bool) {
+		acks = append(acks, saved)
+	})
+	assert.Equal(t, tchannel.ErrServerBusy, err)
+	assert.Equal(t, []bool{false}, acks)
+
+	err = p.ProcessSpansWithAck(nil, JaegerFormatType, func(saved bool) {
+		acks = append(acks, saved)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{false, true}, acks)
+}
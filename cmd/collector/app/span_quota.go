@@ -0,0 +1,219 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+// SpanQuotaMode is what happens to the spans of a service beyond its daily quota
+type SpanQuotaMode string
+
+const (
+	// DropOverQuota drops the spans beyond the quota
+	DropOverQuota SpanQuotaMode = "drop"
+	// TagOverQuota keeps the spans beyond the quota, tagged with OverQuotaTag
+	TagOverQuota SpanQuotaMode = "tag"
+	// SampleOverQuota keeps the spans of a fraction of the traces beyond the quota, and those forced to be kept
+	// by a SamplingRule, tagged with OverQuotaTag
+	SampleOverQuota SpanQuotaMode = "sample"
+
+	// OverQuotaTag is the span tag marking the spans kept beyond the quota of their service
+	OverQuotaTag = "quota.exceeded"
+)
+
+// SpanQuotas are the spans accepted by the collector from each service each day
+type SpanQuotas struct {
+	// Default is the quota of each service without its own quota, unlimited if 0
+	Default int64 `json:"default"`
+	// Services are the quotas of individual services, keyed by service name
+	Services map[string]int64 `json:"services"`
+}
+
+// LoadSpanQuotas reads SpanQuotas encoded as JSON
+func LoadSpanQuotas(r io.Reader) (SpanQuotas, error) {
+	var quotas SpanQuotas
+	err := json.NewDecoder(r).Decode(&quotas)
+	return quotas, err
+}
+
+// ParseSpanQuotaMode returns the SpanQuotaMode with the given name, empty meaning DropOverQuota
+func ParseSpanQuotaMode(name string) (SpanQuotaMode, error) {
+	switch mode := SpanQuotaMode(name); mode {
+	case "":
+		return DropOverQuota, nil
+	case DropOverQuota, TagOverQuota, SampleOverQuota:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("Unknown span quota mode %q", name)
+	}
+}
+
+// SpanQuotaOptions configure the enforcement of SpanQuotas
+type SpanQuotaOptions struct {
+	Quotas SpanQuotas
+	// Mode is what happens to the spans beyond the quota of their service, DropOverQuota if empty
+	Mode SpanQuotaMode
+	// SampleRate is the fraction of the traces beyond the quota of their service kept in SampleOverQuota mode
+	SampleRate float64
+	// SampleSeed is the seed of the TraceSamplingBucket of the traces sampled down, none if 0
+	SampleSeed uint64
+	// ResetTime is the time of day in UTC, from midnight, at which the usage of all services is reset
+	ResetTime time.Duration
+}
+
+// SpanQuotaEnforcer counts the spans received from each service since the last daily reset, and drops, tags or
+// samples down the spans beyond the quota of their service. The usage of each service is reported by the
+// spans.quota-usage gauge, and the spans beyond the quota by the spans.over-quota counter.
+type SpanQuotaEnforcer struct {
+	sync.Mutex
+	options   SpanQuotaOptions
+	usage     map[string]int64
+	resetAt   time.Time
+	factory   metrics.Factory
+	gauges    map[string]metrics.Gauge
+	overQuota map[string]metrics.Counter
+	timeNow   func() time.Time
+}
+
+// NewSpanQuotaEnforcer creates a SpanQuotaEnforcer whose usage starts at zero
+func NewSpanQuotaEnforcer(options SpanQuotaOptions, metricsFactory metrics.Factory) *SpanQuotaEnforcer {
+	if options.Mode == "" {
+		options.Mode = DropOverQuota
+	}
+	e := &SpanQuotaEnforcer{
+		options:   options,
+		usage:     make(map[string]int64),
+		factory:   metricsFactory,
+		gauges:    make(map[string]metrics.Gauge),
+		overQuota: make(map[string]metrics.Counter),
+		timeNow:   time.Now,
+	}
+	e.resetAt = e.nextReset(e.timeNow())
+	return e
+}
+
+// Update replaces the quotas, the usage of services is kept until the next reset
+func (e *SpanQuotaEnforcer) Update(quotas SpanQuotas) {
+	e.Lock()
+	defer e.Unlock()
+	e.options.Quotas = quotas
+}
+
+// Allow counts the span in the usage of its service, and returns false when the span is beyond the quota of
+// its service and not kept by the mode. It can be used as a FilterSpan, the kept spans beyond quota are tagged.
+func (e *SpanQuotaEnforcer) Allow(span *model.Span) bool {
+	serviceName := span.Process.ServiceName
+	now := e.timeNow()
+	e.Lock()
+	if !now.Before(e.resetAt) {
+		e.reset(now)
+	}
+	quota, ok := e.options.Quotas.Services[serviceName]
+	if !ok {
+		quota = e.options.Quotas.Default
+	}
+	e.usage[serviceName]++
+	usage := e.usage[serviceName]
+	gauge := e.gauge(serviceName)
+	mode, sampleRate, sampleSeed := e.options.Mode, e.options.SampleRate, e.options.SampleSeed
+	e.Unlock()
+	if gauge != nil {
+		gauge.Update(usage)
+	}
+	if quota <= 0 || usage <= quota {
+		return true
+	}
+	e.countOverQuota(serviceName)
+	if !keepOverQuota(span, mode, sampleRate, sampleSeed) {
+		return false
+	}
+	span.Tags = append(span.Tags, model.Bool(OverQuotaTag, true))
+	return true
+}
+
+// keepOverQuota returns whether the mode keeps a span beyond the quota of its service,
+// the spans of a trace being kept or dropped together when sampled down
+func keepOverQuota(span *model.Span, mode SpanQuotaMode, sampleRate float64, sampleSeed uint64) bool {
+	switch mode {
+	case TagOverQuota:
+		return true
+	case SampleOverQuota:
+		if isForcedSample(span) {
+			return true
+		}
+		return sampleTrace(span.TraceID, sampleRate, sampleSeed)
+	default:
+		return false
+	}
+}
+
+// nextReset returns the first reset time after now
+func (e *SpanQuotaEnforcer) nextReset(now time.Time) time.Time {
+	utc := now.UTC()
+	reset := time.Date(utc.Year(), utc.Month(), utc.Day(), 0, 0, 0, 0, time.UTC).Add(e.options.ResetTime)
+	for !reset.After(now) {
+		reset = reset.Add(24 * time.Hour)
+	}
+	return reset
+}
+
+// reset sets the usage of all services to zero, holding the lock
+func (e *SpanQuotaEnforcer) reset(now time.Time) {
+	e.usage = make(map[string]int64)
+	for _, gauge := range e.gauges {
+		gauge.Update(0)
+	}
+	e.resetAt = e.nextReset(now)
+}
+
+// gauge returns the usage gauge of the service, nil beyond maxServiceNames, holding the lock
+func (e *SpanQuotaEnforcer) gauge(serviceName string) metrics.Gauge {
+	serviceName = NormalizeServiceName(serviceName)
+	gauge, ok := e.gauges[serviceName]
+	if !ok && len(e.gauges) < maxServiceNames {
+		gauge = e.factory.Gauge("spans.quota-usage", map[string]string{"service": serviceName})
+		e.gauges[serviceName] = gauge
+	}
+	return gauge
+}
+
+func (e *SpanQuotaEnforcer) countOverQuota(serviceName string) {
+	serviceName = NormalizeServiceName(serviceName)
+	e.Lock()
+	counter, ok := e.overQuota[serviceName]
+	if !ok && len(e.overQuota) < maxServiceNames {
+		counter = e.factory.Counter("spans.over-quota", map[string]string{"service": serviceName})
+		e.overQuota[serviceName] = counter
+	}
+	e.Unlock()
+	if counter != nil {
+		counter.Inc(1)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+func newTestQuotaEnforcer(options SpanQuotaOptions, metricsFactory metrics.Factory, now *time.Time) *SpanQuotaEnforcer {
+	e := NewSpanQuotaEnforcer(options, metricsFactory)
+	e.timeNow = func() time.Time { return *now }
+	e.resetAt = e.nextReset(*now)
+	return e
+}
+
+func TestSpanQuotaEnforcerDrop(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	now := time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+	e := newTestQuotaEnforcer(SpanQuotaOptions{
+		Quotas:    SpanQuotas{Default: 1, Services: map[string]int64{"billed": 2}},
+		ResetTime: 6 * time.Hour,
+	}, metricsFactory, &now)
+
+	assert.True(t, e.Allow(spanFromService("billed")))
+	assert.True(t, e.Allow(spanFromService("billed")))
+	assert.False(t, e.Allow(spanFromService("billed")))
+	// each service without its own quota has the default one
+	assert.True(t, e.Allow(spanFromService("a")))
+	assert.True(t, e.Allow(spanFromService("b")))
+	assert.False(t, e.Allow(spanFromService("b")))
+
+	counts, gauges := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["spans.over-quota|service=billed"])
+	assert.EqualValues(t, 1, counts["spans.over-quota|service=b"])
+	assert.EqualValues(t, 3, gauges["spans.quota-usage|service=billed"])
+
+	// the usage is reset at 6:00 UTC on the next day
+	now = time.Date(2017, 6, 2, 5, 59, 0, 0, time.UTC)
+	assert.False(t, e.Allow(spanFromService("billed")))
+	now = now.Add(time.Minute)
+	assert.True(t, e.Allow(spanFromService("billed")))
+	_, gauges = metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, gauges["spans.quota-usage|service=billed"])
+	assert.EqualValues(t, 0, gauges["spans.quota-usage|service=b"])
+}
+
+func TestSpanQuotaEnforcerTag(t *testing.T) {
+	now := time.Unix(0, 0)
+	e := newTestQuotaEnforcer(SpanQuotaOptions{
+		Quotas: SpanQuotas{Default: 1},
+		Mode:   TagOverQuota,
+	}, metrics.NullFactory, &now)
+	first := spanFromService("svc")
+	assert.True(t, e.Allow(first))
+	assert.Empty(t, first.Tags)
+	second := spanFromService("svc")
+	assert.True(t, e.Allow(second))
+	assert.Equal(t, model.KeyValues{model.Bool(OverQuotaTag, true)}, second.Tags)
+}
+
+func TestSpanQuotaEnforcerSample(t *testing.T) {
+	now := time.Unix(0, 0)
+	e := newTestQuotaEnforcer(SpanQuotaOptions{
+		Quotas:     SpanQuotas{Default: 1},
+		Mode:       SampleOverQuota,
+		SampleRate: 0.5,
+	}, metrics.NullFactory, &now)
+	assert.True(t, e.Allow(spanFromService("svc")))
+	kept := 0
+	for i := uint64(0); i < traceSamplingPrecision; i++ {
+		span := spanFromService("svc")
+		span.TraceID = model.TraceID{Low: i}
+		if e.Allow(span) {
+			kept++
+			_, ok := span.Tags.FindByKey(OverQuotaTag)
+			assert.True(t, ok)
+		}
+	}
+	assert.Equal(t, traceSamplingPrecision/2, kept)
+
+	forced := spanFromService("svc")
+	forced.TraceID = model.TraceID{Low: traceSamplingPrecision - 1}
+	assert.False(t, e.Allow(forced))
+	forced.Tags = append(forced.Tags, model.String(ForcedSamplingTag, "premium"))
+	assert.True(t, e.Allow(forced))
+}
+
+func TestSpanQuotaEnforcerUpdate(t *testing.T) {
+	now := time.Unix(0, 0)
+	e := newTestQuotaEnforcer(SpanQuotaOptions{}, metrics.NullFactory, &now)
+	assert.True(t, e.Allow(spanFromService("svc")), "unlimited without quota")
+	assert.True(t, e.Allow(spanFromService("svc")))
+	e.Update(SpanQuotas{Services: map[string]int64{"svc": 3}})
+	assert.True(t, e.Allow(spanFromService("svc")))
+	assert.False(t, e.Allow(spanFromService("svc")), "the usage is kept across updates")
+}
+
+func TestLoadSpanQuotas(t *testing.T) {
+	quotas, err := LoadSpanQuotas(strings.NewReader(`{"default": 1000, "services": {"billed": 10}}`))
+	require.NoError(t, err)
+	assert.EqualValues(t, 1000, quotas.Default)
+	assert.EqualValues(t, 10, quotas.Services["billed"])
+
+	_, err = LoadSpanQuotas(strings.NewReader(`{`))
+	assert.Error(t, err)
+}
+
+func TestParseSpanQuotaMode(t *testing.T) {
+	for name, expected := range map[string]SpanQuotaMode{"": DropOverQuota, "drop": DropOverQuota, "tag": TagOverQuota, "sample": SampleOverQuota} {
+		mode, err := ParseSpanQuotaMode(name)
+		require.NoError(t, err)
+		assert.Equal(t, expected, mode)
+	}
+	_, err := ParseSpanQuotaMode("throttle")
+	assert.EqualError(t, err, `Unknown span quota mode "throttle"`)
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+// SchemaViolationMode is what happens to the spans violating a SchemaRule
+type SchemaViolationMode string
+
+const (
+	// RejectSchemaViolations drops the spans violating a rule
+	RejectSchemaViolations SchemaViolationMode = "reject"
+	// TagSchemaViolations keeps the spans violating a rule, tagged with SchemaViolationTag
+	TagSchemaViolations SchemaViolationMode = "tag"
+
+	// SchemaViolationTag is the span tag listing the comma-separated names of the rules violated by a kept span
+	SchemaViolationTag = "schema.violations"
+)
+
+// SchemaRule requires the spans of services to carry a tag, e.g. the team owning the service
+type SchemaRule struct {
+	// Name identifies the rule in the metrics and in SchemaViolationTag
+	Name string `json:"name"`
+	// ServicePrefix is the prefix of the service names of the spans the rule applies to, any service if empty
+	ServicePrefix string `json:"service_prefix"`
+	// Tag is the key of the span or process tag the spans must have
+	Tag string `json:"tag"`
+	// Pattern is the regular expression the whole value of the tag must match, as a string, any value if empty
+	Pattern string `json:"pattern"`
+}
+
+// SchemaRules are the rules all the spans must follow
+type SchemaRules []SchemaRule
+
+// LoadSchemaRules reads SchemaRules encoded as JSON, e.g.
+//
+//	[{"name": "team", "tag": "team"}, {"name": "env", "tag": "env", "pattern": "prod|staging|dev"}]
+func LoadSchemaRules(r io.Reader) (SchemaRules, error) {
+	var rules SchemaRules
+	err := json.NewDecoder(r).Decode(&rules)
+	return rules, err
+}
+
+// ParseSchemaViolationMode returns the SchemaViolationMode with the given name, empty meaning RejectSchemaViolations
+func ParseSchemaViolationMode(name string) (SchemaViolationMode, error) {
+	switch mode := SchemaViolationMode(name); mode {
+	case "":
+		return RejectSchemaViolations, nil
+	case RejectSchemaViolations, TagSchemaViolations:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("Unknown schema violation mode %q", name)
+	}
+}
+
+// SpanSchemaOptions configure the validation of the spans against SchemaRules
+type SpanSchemaOptions struct {
+	Rules SchemaRules
+	// Mode is what happens to the spans violating a rule, RejectSchemaViolations if empty
+	Mode SchemaViolationMode
+}
+
+type compiledSchemaRule struct {
+	SchemaRule
+	pattern *regexp.Regexp
+}
+
+// SpanSchemaValidator checks that the spans follow SchemaRules before they are saved, and rejects or tags the
+// spans violating them. The violations are counted in the spans.schema-violations metric by rule and service, a
+// span violating several rules being counted once for each.
+type SpanSchemaValidator struct {
+	sync.RWMutex
+	rules          []compiledSchemaRule
+	mode           SchemaViolationMode
+	metricsFactory metrics.Factory
+	countersLock   sync.Mutex
+	violations     map[string]metrics.Counter
+}
+
+// NewSpanSchemaValidator creates a SpanSchemaValidator counting the violations in the metrics factory, it returns
+// an error if the rules are not valid
+func NewSpanSchemaValidator(options SpanSchemaOptions, metricsFactory metrics.Factory) (*SpanSchemaValidator, error) {
+	if options.Mode == "" {
+		options.Mode = RejectSchemaViolations
+	}
+	v := &SpanSchemaValidator{
+		mode:           options.Mode,
+		metricsFactory: metricsFactory,
+		violations:     make(map[string]metrics.Counter),
+	}
+	if err := v.Update(options.Rules); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Update replaces the rules, spans validated from then on use the new rules. The rules are left unchanged
+// if a rule has no name or no tag, has an invalid pattern, or two rules have the same name.
+func (v *SpanSchemaValidator) Update(rules SchemaRules) error {
+	names := make(map[string]struct{}, len(rules))
+	compiled := make([]compiledSchemaRule, 0, len(rules))
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return fmt.Errorf("schema rule %d must have a name", i)
+		}
+		if rule.Tag == "" {
+			return fmt.Errorf("schema rule %s must have a tag", rule.Name)
+		}
+		if _, ok := names[rule.Name]; ok {
+			return fmt.Errorf("duplicate schema rule %s", rule.Name)
+		}
+		names[rule.Name] = struct{}{}
+		c := compiledSchemaRule{SchemaRule: rule}
+		if rule.Pattern != "" {
+			pattern, err := regexp.Compile("^(?:" + rule.Pattern + ")$")
+			if err != nil {
+				return fmt.Errorf("invalid pattern of schema rule %s: %v", rule.Name, err)
+			}
+			c.pattern = pattern
+		}
+		compiled = append(compiled, c)
+	}
+	v.Lock()
+	defer v.Unlock()
+	v.rules = compiled
+	return nil
+}
+
+// Allow returns false when the span violates a rule in RejectSchemaViolations mode, it can be used as a
+// FilterSpan. In TagSchemaViolations mode the span is kept and tagged with the violated rules.
+func (v *SpanSchemaValidator) Allow(span *model.Span) bool {
+	violated := v.violatedRules(span)
+	if len(violated) == 0 {
+		return true
+	}
+	serviceName := ""
+	if span.Process != nil {
+		serviceName = span.Process.ServiceName
+	}
+	for _, rule := range violated {
+		v.countViolation(rule, serviceName)
+	}
+	if v.mode != TagSchemaViolations {
+		return false
+	}
+	span.Tags = append(span.Tags, model.String(SchemaViolationTag, strings.Join(violated, ",")))
+	return true
+}
+
+// violatedRules returns the names of the rules the span violates
+func (v *SpanSchemaValidator) violatedRules(span *model.Span) []string {
+	v.RLock()
+	defer v.RUnlock()
+	var violated []string
+	for _, rule := range v.rules {
+		if !followsSchemaRule(span, rule) {
+			violated = append(violated, rule.Name)
+		}
+	}
+	return violated
+}
+
+func followsSchemaRule(span *model.Span, rule compiledSchemaRule) bool {
+	if rule.ServicePrefix != "" && (span.Process == nil || !strings.HasPrefix(span.Process.ServiceName, rule.ServicePrefix)) {
+		return true
+	}
+	tag, ok := span.Tags.FindByKey(rule.Tag)
+	if !ok && span.Process != nil {
+		tag, ok = span.Process.Tags.FindByKey(rule.Tag)
+	}
+	return ok && (rule.pattern == nil || rule.pattern.MatchString(tag.AsString()))
+}
+
+// countViolation counts a violation of the rule by a span of the service, the services beyond maxServiceNames
+// not being counted
+func (v *SpanSchemaValidator) countViolation(rule, serviceName string) {
+	serviceName = NormalizeServiceName(serviceName)
+	key := rule + "\x00" + serviceName
+	v.countersLock.Lock()
+	counter, ok := v.violations[key]
+	if !ok && len(v.violations) < maxServiceNames {
+		counter = v.metricsFactory.Counter("spans.schema-violations", map[string]string{"rule": rule, "service": serviceName})
+		v.violations[key] = counter
+	}
+	v.countersLock.Unlock()
+	if counter != nil {
+		counter.Inc(1)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+func TestLoadSchemaRules(t *testing.T) {
+	rules, err := LoadSchemaRules(strings.NewReader(`[
+		{"name": "team", "tag": "team"},
+		{"name": "env", "service_prefix": "payments-", "tag": "env", "pattern": "prod|staging"}
+	]`))
+	require.NoError(t, err)
+	assert.Equal(t, SchemaRules{
+		{Name: "team", Tag: "team"},
+		{Name: "env", ServicePrefix: "payments-", Tag: "env", Pattern: "prod|staging"},
+	}, rules)
+
+	_, err = LoadSchemaRules(strings.NewReader(`{"name": "team"}`))
+	assert.Error(t, err)
+}
+
+func TestParseSchemaViolationMode(t *testing.T) {
+	for name, expected := range map[string]SchemaViolationMode{
+		"":       RejectSchemaViolations,
+		"reject": RejectSchemaViolations,
+		"tag":    TagSchemaViolations,
+	} {
+		mode, err := ParseSchemaViolationMode(name)
+		require.NoError(t, err)
+		assert.Equal(t, expected, mode)
+	}
+	_, err := ParseSchemaViolationMode("drop")
+	assert.EqualError(t, err, `Unknown schema violation mode "drop"`)
+}
+
+func TestSpanSchemaValidatorRejects(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	validator, err := NewSpanSchemaValidator(SpanSchemaOptions{Rules: SchemaRules{
+		{Name: "team", Tag: "team"},
+		{Name: "env", ServicePrefix: "payments-", Tag: "env", Pattern: "prod|staging"},
+	}}, metricsFactory)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		span    *model.Span
+		allowed bool
+	}{
+		{
+			span: &model.Span{
+				Tags:    model.KeyValues{model.String("team", "checkout")},
+				Process: &model.Process{ServiceName: "frontend"},
+			},
+			allowed: true,
+		},
+		{
+			// the tag can be a process tag
+			span: &model.Span{
+				Process: &model.Process{ServiceName: "payments-api", Tags: model.KeyValues{
+					model.String("team", "payments"),
+					model.String("env", "prod"),
+				}},
+			},
+			allowed: true,
+		},
+		{span: &model.Span{Process: &model.Process{ServiceName: "frontend"}}, allowed: false},
+		{
+			// the whole value must match the pattern
+			span: &model.Span{
+				Tags:    model.KeyValues{model.String("team", "payments"), model.String("env", "production")},
+				Process: &model.Process{ServiceName: "payments-api"},
+			},
+			allowed: false,
+		},
+		{span: &model.Span{Process: &model.Process{ServiceName: "payments-api"}}, allowed: false},
+	}
+	for i, testCase := range testCases {
+		assert.Equal(t, testCase.allowed, validator.Allow(testCase.span), "test case %d", i)
+	}
+	assert.Empty(t, testCases[2].span.Tags, "rejected spans are not tagged")
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["spans.schema-violations|rule=team|service=frontend"])
+	assert.EqualValues(t, 1, counts["spans.schema-violations|rule=team|service=payments-api"])
+	assert.EqualValues(t, 2, counts["spans.schema-violations|rule=env|service=payments-api"])
+
+	require.NoError(t, validator.Update(SchemaRules{{Name: "owner", Tag: "owner"}}))
+	assert.False(t, validator.Allow(testCases[0].span))
+	assert.True(t, validator.Allow(&model.Span{
+		Tags:    model.KeyValues{model.String("owner", "web")},
+		Process: &model.Process{ServiceName: "payments-api"},
+	}))
+}
+
+func TestSpanSchemaValidatorTags(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	validator, err := NewSpanSchemaValidator(SpanSchemaOptions{
+		Rules: SchemaRules{{Name: "team", Tag: "team"}, {Name: "env", Tag: "env"}},
+		Mode:  TagSchemaViolations,
+	}, metricsFactory)
+	require.NoError(t, err)
+
+	span := &model.Span{Process: &model.Process{ServiceName: "frontend"}}
+	assert.True(t, validator.Allow(span))
+	assert.Equal(t, model.KeyValues{model.String(SchemaViolationTag, "team,env")}, span.Tags)
+
+	span = &model.Span{
+		Tags:    model.KeyValues{model.String("team", "web"), model.String("env", "dev")},
+		Process: &model.Process{ServiceName: "frontend"},
+	}
+	assert.True(t, validator.Allow(span))
+	assert.Len(t, span.Tags, 2)
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["spans.schema-violations|rule=team|service=frontend"])
+	assert.EqualValues(t, 1, counts["spans.schema-violations|rule=env|service=frontend"])
+}
+
+func TestSpanSchemaValidatorInvalidRules(t *testing.T) {
+	for _, rules := range []SchemaRules{
+		{{Tag: "team"}},
+		{{Name: "team"}},
+		{{Name: "env", Tag: "env", Pattern: "prod("}},
+		{{Name: "team", Tag: "team"}, {Name: "team", Tag: "owner"}},
+	} {
+		_, err := NewSpanSchemaValidator(SpanSchemaOptions{Rules: rules}, metrics.NullFactory)
+		assert.Error(t, err)
+	}
+
+	validator, err := NewSpanSchemaValidator(SpanSchemaOptions{Rules: SchemaRules{{Name: "team", Tag: "team"}}}, metrics.NullFactory)
+	require.NoError(t, err)
+	assert.Error(t, validator.Update(SchemaRules{{Name: "team"}}))
+	assert.False(t, validator.Allow(&model.Span{Process: &model.Process{ServiceName: "frontend"}}),
+		"invalid rules leave the rules unchanged")
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+)
+
+const (
+	// DefaultMaxSpanSize is the default estimated size in bytes of the largest span accepted by the collector
+	DefaultMaxSpanSize = 1 << 20
+
+	// fixedSpanSize approximates the serialized size of the IDs, flags, start time and duration of a span
+	fixedSpanSize = 48
+	// fixedReferenceSize approximates the serialized size of the trace ID, span ID and type of a reference
+	fixedReferenceSize = 25
+	// fixedValueSize is the serialized size of numeric tag values, and of log timestamps
+	fixedValueSize = 8
+	// maxLoggedValueLength is the length beyond which the largest value of a rejected span is truncated in logs
+	maxLoggedValueLength = 256
+)
+
+// SpanSizeLimiter rejects the spans whose estimated serialized size exceeds a maximum, so that a single
+// huge span, e.g. with a multi-megabyte tag value, cannot fail or slow down the writes to storage.
+// The size is estimated from the lengths of the strings and binary values of the span and its process,
+// which dominate the size of all serialized forms of spans, so that spans are not serialized twice.
+// Rejected spans are logged, with their largest value truncated, and counted in the spans.oversized metric.
+type SpanSizeLimiter struct {
+	maxSize   int
+	logger    *zap.Logger
+	oversized metrics.Counter
+}
+
+// NewSpanSizeLimiter creates a SpanSizeLimiter rejecting spans larger than maxSize bytes.
+func NewSpanSizeLimiter(maxSize int, logger *zap.Logger, metricsFactory metrics.Factory) *SpanSizeLimiter {
+	return &SpanSizeLimiter{
+		maxSize:   maxSize,
+		logger:    logger,
+		oversized: metricsFactory.Counter("spans.oversized", nil),
+	}
+}
+
+// Allow returns false when the span is too large, it can be used as a FilterSpan.
+func (l *SpanSizeLimiter) Allow(span *model.Span) bool {
+	size := estimateSpanSize(span)
+	if size <= l.maxSize {
+		return true
+	}
+	l.oversized.Inc(1)
+	key, value := loggedValue(largestValue(span))
+	l.logger.Warn("Rejected oversized span",
+		zap.String("trace_id", span.TraceID.String()),
+		zap.String("span_id", span.SpanID.String()),
+		zap.String("service", serviceName(span)),
+		zap.String("operation", span.OperationName),
+		zap.Int("estimated_size", size),
+		zap.Int("max_size", l.maxSize),
+		zap.String("largest_key", key),
+		zap.String("largest_value", value))
+	return false
+}
+
+func estimateSpanSize(span *model.Span) int {
+	size := fixedSpanSize + len(span.OperationName) + fixedReferenceSize*len(span.References)
+	size += keyValuesSize(span.Tags)
+	for _, log := range span.Logs {
+		size += fixedValueSize + keyValuesSize(log.Fields)
+	}
+	for _, warning := range span.Warnings {
+		size += len(warning)
+	}
+	if span.Process != nil {
+		size += len(span.Process.ServiceName) + keyValuesSize(span.Process.Tags)
+	}
+	return size
+}
+
+func keyValuesSize(kvs []model.KeyValue) int {
+	size := 0
+	for i := range kvs {
+		size += len(kvs[i].Key) + valueSize(&kvs[i])
+	}
+	return size
+}
+
+func valueSize(kv *model.KeyValue) int {
+	switch kv.VType {
+	case model.StringType:
+		return len(kv.VStr)
+	case model.BinaryType:
+		return len(kv.VBlob)
+	default:
+		return fixedValueSize
+	}
+}
+
+// largestValue returns the largest of the values of the span, its logs and its process,
+// which is the likely cause of the span being oversized.
+func largestValue(span *model.Span) *model.KeyValue {
+	var largest *model.KeyValue
+	find := func(kvs []model.KeyValue) {
+		for i := range kvs {
+			if largest == nil || valueSize(&kvs[i]) > valueSize(largest) {
+				largest = &kvs[i]
+			}
+		}
+	}
+	find(span.Tags)
+	for _, log := range span.Logs {
+		find(log.Fields)
+	}
+	if span.Process != nil {
+		find(span.Process.Tags)
+	}
+	return largest
+}
+
+// loggedValue returns the key and the value of kv as a string, truncated to maxLoggedValueLength.
+func loggedValue(kv *model.KeyValue) (string, string) {
+	if kv == nil {
+		return "", ""
+	}
+	truncated := *kv
+	if len(truncated.VStr) > maxLoggedValueLength {
+		truncated.VStr = truncated.VStr[:maxLoggedValueLength] + "..."
+	}
+	return truncated.Key, truncated.AsString()
+}
+
+func serviceName(span *model.Span) string {
+	if span.Process == nil {
+		return ""
+	}
+	return span.Process.ServiceName
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/pkg/testutils"
+)
+
+func TestEstimateSpanSize(t *testing.T) {
+	span := &model.Span{
+		OperationName: "op",
+		References:    []model.SpanRef{{}},
+		Tags:          model.KeyValues{model.String("k", "value"), model.Int64("n", 1)},
+		Logs:          []model.Log{{Fields: []model.KeyValue{model.Binary("b", []byte{1, 2, 3})}}},
+		Warnings:      []string{"warn"},
+		Process:       &model.Process{ServiceName: "svc", Tags: model.KeyValues{model.Bool("ok", true)}},
+	}
+	expected := fixedSpanSize + len("op") + fixedReferenceSize +
+		len("k") + len("value") + len("n") + fixedValueSize +
+		fixedValueSize + len("b") + 3 +
+		len("warn") +
+		len("svc") + len("ok") + fixedValueSize
+	assert.Equal(t, expected, estimateSpanSize(span))
+	assert.Equal(t, fixedSpanSize, estimateSpanSize(&model.Span{}))
+}
+
+func TestSpanSizeLimiter(t *testing.T) {
+	logger, logBuf := testutils.NewLogger()
+	metricsFactory := metrics.NewLocalFactory(0)
+	limiter := NewSpanSizeLimiter(1000, logger, metricsFactory)
+
+	small := &model.Span{
+		OperationName: "op",
+		Tags:          model.KeyValues{model.String("http.url", "/")},
+		Process:       &model.Process{ServiceName: "svc"},
+	}
+	assert.True(t, limiter.Allow(small))
+
+	huge := &model.Span{
+		TraceID:       model.TraceID{Low: 1},
+		SpanID:        2,
+		OperationName: "op",
+		Tags:          model.KeyValues{model.String("http.url", "/")},
+		Logs:          []model.Log{{Fields: []model.KeyValue{model.String("payload", strings.Repeat("x", 2000))}}},
+		Process:       &model.Process{ServiceName: "svc"},
+	}
+	assert.False(t, limiter.Allow(huge))
+
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counters["spans.oversized"])
+	require.Len(t, logBuf.Lines(), 1)
+	line := logBuf.Lines()[0]
+	assert.Contains(t, line, "Rejected oversized span")
+	assert.Contains(t, line, `"service":"svc"`)
+	assert.Contains(t, line, `"largest_key":"payload"`)
+	assert.Contains(t, line, `"largest_value":"`+strings.Repeat("x", maxLoggedValueLength)+`..."`)
+}
+
+func TestLoggedValue(t *testing.T) {
+	key, value := loggedValue(nil)
+	assert.Equal(t, "", key)
+	assert.Equal(t, "", value)
+
+	kv := model.Int64("status", 500)
+	key, value = loggedValue(&kv)
+	assert.Equal(t, "status", key)
+	assert.Equal(t, "500", value)
+}
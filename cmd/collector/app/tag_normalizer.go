@@ -0,0 +1,105 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+// TagMappings rename the tag keys and rewrite the tag values that services disagree on
+type TagMappings struct {
+	// Keys are the new names of tag keys, keyed by the names to replace
+	Keys map[string]string `json:"keys"`
+	// Values are the new string values of tags, keyed by the normalized tag key then by the values to replace
+	Values map[string]map[string]string `json:"values"`
+}
+
+// LoadTagMappings reads TagMappings encoded as JSON
+func LoadTagMappings(r io.Reader) (TagMappings, error) {
+	var mappings TagMappings
+	err := json.NewDecoder(r).Decode(&mappings)
+	return mappings, err
+}
+
+// TagNormalizer rewrites span and process tags according to TagMappings
+type TagNormalizer struct {
+	sync.RWMutex
+	mappings        TagMappings
+	renamedKeys     metrics.Counter
+	rewrittenValues metrics.Counter
+}
+
+// NewTagNormalizer creates a TagNormalizer that counts the tags it rewrites in the given metrics factory
+func NewTagNormalizer(mappings TagMappings, metricsFactory metrics.Factory) *TagNormalizer {
+	return &TagNormalizer{
+		mappings:        mappings,
+		renamedKeys:     metricsFactory.Counter("tags.keys-normalized", nil),
+		rewrittenValues: metricsFactory.Counter("tags.values-normalized", nil),
+	}
+}
+
+// Update replaces the tag mappings, spans normalized from then on use the new mappings
+func (n *TagNormalizer) Update(mappings TagMappings) {
+	n.Lock()
+	defer n.Unlock()
+	n.mappings = mappings
+}
+
+// NormalizeSpans rewrites the tags of the spans and of their processes, it can be used as a ProcessSpans.
+// A process shared by several spans is normalized once, so that chained mappings are not applied twice.
+func (n *TagNormalizer) NormalizeSpans(spans []*model.Span) {
+	n.RLock()
+	defer n.RUnlock()
+	processes := make(map[*model.Process]struct{})
+	for _, span := range spans {
+		n.normalize(span.Tags)
+		if span.Process == nil {
+			continue
+		}
+		if _, ok := processes[span.Process]; !ok {
+			processes[span.Process] = struct{}{}
+			n.normalize(span.Process.Tags)
+		}
+	}
+}
+
+func (n *TagNormalizer) normalize(tags model.KeyValues) {
+	for i := range tags {
+		tag := &tags[i]
+		if key, ok := n.mappings.Keys[tag.Key]; ok {
+			tag.Key = key
+			n.renamedKeys.Inc(1)
+		}
+		if tag.VType != model.StringType {
+			continue
+		}
+		if value, ok := n.mappings.Values[tag.Key][tag.VStr]; ok {
+			tag.VStr = value
+			n.rewrittenValues.Inc(1)
+		}
+	}
+}
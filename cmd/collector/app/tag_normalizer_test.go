@@ -0,0 +1,101 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+func TestLoadTagMappings(t *testing.T) {
+	mappings, err := LoadTagMappings(strings.NewReader(`{
+		"keys": {"status_code": "http.status_code"},
+		"values": {"http.method": {"get": "GET"}}
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, TagMappings{
+		Keys:   map[string]string{"status_code": "http.status_code"},
+		Values: map[string]map[string]string{"http.method": {"get": "GET"}},
+	}, mappings)
+
+	_, err = LoadTagMappings(strings.NewReader(`{"keys": []}`))
+	assert.Error(t, err)
+}
+
+func TestTagNormalizer(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	normalizer := NewTagNormalizer(TagMappings{
+		Keys:   map[string]string{"status_code": "http.status_code", "method": "http.method"},
+		Values: map[string]map[string]string{"http.method": {"get": "GET"}},
+	}, metricsFactory)
+	process := &model.Process{
+		ServiceName: "svc",
+		Tags:        model.KeyValues{model.String("method", "get")},
+	}
+	spans := []*model.Span{
+		{
+			Tags: model.KeyValues{
+				model.Int64("status_code", 200),
+				model.String("http.method", "get"),
+				model.Int64("http.method.count", 1),
+				model.String("span.kind", "server"),
+			},
+			Process: process,
+		},
+		{
+			Tags:    model.KeyValues{model.String("method", "post")},
+			Process: process,
+		},
+		{Tags: model.KeyValues{model.String("method", "get")}},
+	}
+	normalizer.NormalizeSpans(spans)
+
+	assert.Equal(t, model.KeyValues{
+		model.Int64("http.status_code", 200),
+		model.String("http.method", "GET"),
+		model.Int64("http.method.count", 1),
+		model.String("span.kind", "server"),
+	}, spans[0].Tags)
+	assert.Equal(t, model.KeyValues{model.String("http.method", "post")}, spans[1].Tags)
+	assert.Equal(t, model.KeyValues{model.String("http.method", "GET")}, spans[2].Tags)
+	assert.Equal(t, model.KeyValues{model.String("http.method", "GET")}, process.Tags)
+
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 4, counters["tags.keys-normalized"])
+	assert.EqualValues(t, 3, counters["tags.values-normalized"])
+}
+
+func TestTagNormalizerUpdate(t *testing.T) {
+	normalizer := NewTagNormalizer(TagMappings{}, metrics.NullFactory)
+	span := &model.Span{Tags: model.KeyValues{model.String("status_code", "200")}}
+	normalizer.NormalizeSpans([]*model.Span{span})
+	assert.Equal(t, "status_code", span.Tags[0].Key)
+
+	normalizer.Update(TagMappings{Keys: map[string]string{"status_code": "http.status_code"}})
+	normalizer.NormalizeSpans([]*model.Span{span})
+	assert.Equal(t, "http.status_code", span.Tags[0].Key)
+}
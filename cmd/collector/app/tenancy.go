@@ -0,0 +1,188 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"strings"
+
+	"github.com/uber/jaeger-lib/metrics"
+	"github.com/uber/tchannel-go/thrift"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/storage/spanstore/tenancy"
+	"github.com/uber/jaeger/thrift-gen/jaeger"
+	zc "github.com/uber/jaeger/thrift-gen/zipkincore"
+)
+
+// TenancyOptions tell where the tenant of the submitted spans is read from
+type TenancyOptions struct {
+	// Header is the TChannel application header, or the HTTP header or gRPC metadata, carrying the tenant of all
+	// the spans of a request. The tenant tags of the spans are then ignored, so that clients cannot write to
+	// other tenants.
+	Header string
+	// Tag is the span or process tag carrying the tenant of the span, used if Header is empty
+	Tag string
+}
+
+// TenantResolver records the tenant of each span in its tenancy.TenantTag, which tenancy.NewWriter scopes the
+// storage keys of the span by. The spans without a valid tenant are counted in the spans.without-tenant metric.
+type TenantResolver struct {
+	options       TenancyOptions
+	withoutTenant metrics.Counter
+}
+
+// NewTenantResolver creates a TenantResolver
+func NewTenantResolver(options TenancyOptions, metricsFactory metrics.Factory) *TenantResolver {
+	// TChannel headers are case-sensitive, the HTTP handler passes them on in lower case
+	options.Header = strings.ToLower(options.Header)
+	return &TenantResolver{
+		options:       options,
+		withoutTenant: metricsFactory.Counter("spans.without-tenant", nil),
+	}
+}
+
+// tagKey returns the key of the tag the tenant is read from once the spans are converted
+func (r *TenantResolver) tagKey() string {
+	if r.options.Header != "" {
+		return tenancy.TenantTag
+	}
+	return r.options.Tag
+}
+
+// JaegerBatchesHandler returns a JaegerBatchesHandler tagging the spans with the tenant of the request header,
+// if the tenant is read from a header, before passing them to handler
+func (r *TenantResolver) JaegerBatchesHandler(handler JaegerBatchesHandler) JaegerBatchesHandler {
+	if r.options.Header == "" {
+		return handler
+	}
+	return &tenantJaegerBatchesHandler{resolver: r, handler: handler}
+}
+
+// ZipkinSpansHandler returns a ZipkinSpansHandler tagging the spans with the tenant of the request header,
+// if the tenant is read from a header, before passing them to handler
+func (r *TenantResolver) ZipkinSpansHandler(handler ZipkinSpansHandler) ZipkinSpansHandler {
+	if r.options.Header == "" {
+		return handler
+	}
+	return &tenantZipkinSpansHandler{resolver: r, handler: handler}
+}
+
+func (r *TenantResolver) headerTenant(ctx thrift.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	return ctx.Headers()[r.options.Header]
+}
+
+// ResolveTenants records the tenant of each span in its tenancy.TenantTag, and removes the tenancy.TenantTag
+// of the spans without a tenant, it can be used as a ProcessSpans.
+func (r *TenantResolver) ResolveTenants(spans []*model.Span) {
+	key := r.tagKey()
+	for _, span := range spans {
+		tag, ok := span.Tags.FindByKey(key)
+		if !ok && span.Process != nil {
+			tag, ok = span.Process.Tags.FindByKey(key)
+		}
+		tags := withoutTag(span.Tags, tenancy.TenantTag)
+		if ok {
+			tags = append(tags, model.String(tenancy.TenantTag, tag.AsString()))
+		}
+		span.Tags = tags
+	}
+}
+
+// HasTenant returns true if the span has a valid tenant, it can be used as a FilterSpan after ResolveTenants.
+func (r *TenantResolver) HasTenant(span *model.Span) bool {
+	if tag, ok := span.Tags.FindByKey(tenancy.TenantTag); ok && tenancy.ValidTenant(tag.AsString()) {
+		return true
+	}
+	r.withoutTenant.Inc(1)
+	return false
+}
+
+func withoutTag(tags model.KeyValues, key string) model.KeyValues {
+	var kept model.KeyValues
+	for _, tag := range tags {
+		if tag.Key != key {
+			kept = append(kept, tag)
+		}
+	}
+	return kept
+}
+
+type tenantJaegerBatchesHandler struct {
+	resolver *TenantResolver
+	handler  JaegerBatchesHandler
+}
+
+func (h *tenantJaegerBatchesHandler) SubmitBatches(ctx thrift.Context, batches []*jaeger.Batch) ([]*jaeger.BatchSubmitResponse, error) {
+	tenant := h.resolver.headerTenant(ctx)
+	for _, batch := range batches {
+		for _, span := range batch.Spans {
+			span.Tags = withoutJaegerTag(span.Tags, tenancy.TenantTag)
+		}
+		if batch.Process == nil {
+			continue
+		}
+		batch.Process.Tags = withoutJaegerTag(batch.Process.Tags, tenancy.TenantTag)
+		if tenant != "" {
+			value := tenant
+			batch.Process.Tags = append(batch.Process.Tags, &jaeger.Tag{Key: tenancy.TenantTag, VType: jaeger.TagType_STRING, VStr: &value})
+		}
+	}
+	return h.handler.SubmitBatches(ctx, batches)
+}
+
+func withoutJaegerTag(tags []*jaeger.Tag, key string) []*jaeger.Tag {
+	var kept []*jaeger.Tag
+	for _, tag := range tags {
+		if tag.Key != key {
+			kept = append(kept, tag)
+		}
+	}
+	return kept
+}
+
+type tenantZipkinSpansHandler struct {
+	resolver *TenantResolver
+	handler  ZipkinSpansHandler
+}
+
+func (h *tenantZipkinSpansHandler) SubmitZipkinBatch(ctx thrift.Context, spans []*zc.Span) ([]*zc.Response, error) {
+	tenant := h.resolver.headerTenant(ctx)
+	for _, span := range spans {
+		var kept []*zc.BinaryAnnotation
+		for _, annotation := range span.BinaryAnnotations {
+			if annotation.Key != tenancy.TenantTag {
+				kept = append(kept, annotation)
+			}
+		}
+		if tenant != "" {
+			kept = append(kept, &zc.BinaryAnnotation{
+				Key:            tenancy.TenantTag,
+				Value:          []byte(tenant),
+				AnnotationType: zc.AnnotationType_STRING,
+			})
+		}
+		span.BinaryAnnotations = kept
+	}
+	return h.handler.SubmitZipkinBatch(ctx, spans)
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/storage/spanstore/tenancy"
+	"github.com/uber/jaeger/thrift-gen/jaeger"
+	"github.com/uber/jaeger/thrift-gen/zipkincore"
+)
+
+func TestTenantResolverFromTag(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	resolver := NewTenantResolver(TenancyOptions{Tag: "team"}, metricsFactory)
+	spans := []*model.Span{
+		{Tags: model.KeyValues{model.String("team", "payments")}},
+		{Process: &model.Process{Tags: model.KeyValues{model.String("team", "search")}}},
+		{Tags: model.KeyValues{model.String(tenancy.TenantTag, "spoofed")}},
+		{Tags: model.KeyValues{model.String("team", "a/b")}},
+	}
+	resolver.ResolveTenants(spans)
+
+	var kept []string
+	for _, span := range spans {
+		if resolver.HasTenant(span) {
+			tag, _ := span.Tags.FindByKey(tenancy.TenantTag)
+			kept = append(kept, tag.AsString())
+		}
+	}
+	assert.Equal(t, []string{"payments", "search"}, kept)
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counts["spans.without-tenant"])
+}
+
+func TestTenantResolverFromHeader(t *testing.T) {
+	resolver := NewTenantResolver(TenancyOptions{Header: "X-Tenant", Tag: "team"}, metrics.NullFactory)
+	jHandler := &mockJaegerHandler{}
+	zHandler := &mockZipkinHandler{}
+	r := mux.NewRouter()
+	NewAPIHandler(
+		resolver.JaegerBatchesHandler(jHandler),
+		resolver.ZipkinSpansHandler(zHandler),
+		APIHandlerOptions.TenantHeader("X-Tenant"),
+	).RegisterRoutes(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	spoofed := "search"
+	batchBytes, err := thrift.NewTSerializer().Write(&jaeger.Batch{
+		Process: &jaeger.Process{
+			ServiceName: "svc",
+			Tags:        []*jaeger.Tag{{Key: tenancy.TenantTag, VType: jaeger.TagType_STRING, VStr: &spoofed}},
+		},
+		Spans: []*jaeger.Span{{Tags: []*jaeger.Tag{{Key: tenancy.TenantTag, VType: jaeger.TagType_STRING, VStr: &spoofed}}}},
+	})
+	require.NoError(t, err)
+	zipkinBytes := zipkinSerialize([]*zipkincore.Span{{
+		BinaryAnnotations: []*zipkincore.BinaryAnnotation{{Key: tenancy.TenantTag, Value: []byte(spoofed)}},
+	}})
+	for _, body := range []struct {
+		format string
+		bytes  []byte
+	}{{"jaeger.thrift", batchBytes}, {"zipkin.thrift", zipkinBytes}} {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/api/traces?format="+body.format, bytes.NewReader(body.bytes))
+		require.NoError(t, err)
+		req.Header.Set("X-Tenant", "payments")
+		res, err := httpClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	}
+
+	batches := jHandler.getBatches()
+	require.Len(t, batches, 1)
+	assert.Empty(t, batches[0].Spans[0].Tags)
+	require.Len(t, batches[0].Process.Tags, 1)
+	assert.Equal(t, "payments", batches[0].Process.Tags[0].GetVStr())
+	zipkinSpans := zHandler.getSpans()
+	require.Len(t, zipkinSpans, 1)
+	require.Len(t, zipkinSpans[0].BinaryAnnotations, 1)
+	assert.Equal(t, "payments", string(zipkinSpans[0].BinaryAnnotations[0].Value))
+
+	// once converted, the tenant tag of the header wins over the configured tag
+	span := &model.Span{
+		Tags:    model.KeyValues{model.String("team", "search")},
+		Process: &model.Process{Tags: model.KeyValues{model.String(tenancy.TenantTag, "payments")}},
+	}
+	resolver.ResolveTenants([]*model.Span{span})
+	tag, ok := span.Tags.FindByKey(tenancy.TenantTag)
+	assert.True(t, ok)
+	assert.Equal(t, "payments", tag.AsString())
+}
+
+func TestTenantResolverWithoutHeader(t *testing.T) {
+	resolver := NewTenantResolver(TenancyOptions{Tag: "team"}, metrics.NullFactory)
+	jHandler := &mockJaegerHandler{}
+	zHandler := &mockZipkinHandler{}
+	assert.Equal(t, jHandler, resolver.JaegerBatchesHandler(jHandler))
+	assert.Equal(t, zHandler, resolver.ZipkinSpansHandler(zHandler))
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+
+	"github.com/uber/jaeger/model"
+)
+
+// traceSamplingPrecision is the number of buckets the trace IDs are spread over to be sampled
+const traceSamplingPrecision = 10000
+
+// TraceSamplingBucket returns the bucket of the trace ID, between 0 and 9999, the traces being sampled at a
+// rate r when their bucket is below r*10000. Without a seed, the bucket is the low 64 bits of the trace ID
+// modulo 10000, which are random for the trace IDs generated by the clients. With a seed, the bucket is the
+// 64-bit FNV-1a hash of the seed, the high and the low 64 bits of the trace ID, each encoded as 8 big-endian
+// bytes, modulo 10000. The same seed makes the same decisions on all collectors, and other tools can predict
+// them by computing the same hash.
+func TraceSamplingBucket(traceID model.TraceID, seed uint64) uint64 {
+	if seed == 0 {
+		return traceID.Low % traceSamplingPrecision
+	}
+	var data [24]byte
+	binary.BigEndian.PutUint64(data[0:], seed)
+	binary.BigEndian.PutUint64(data[8:], traceID.High)
+	binary.BigEndian.PutUint64(data[16:], traceID.Low)
+	h := fnv.New64a()
+	h.Write(data[:])
+	return h.Sum64() % traceSamplingPrecision
+}
+
+// sampleTrace returns whether the trace is sampled at the rate, between 0 and 1, with the seed
+func sampleTrace(traceID model.TraceID, rate float64, seed uint64) bool {
+	return TraceSamplingBucket(traceID, seed) < uint64(rate*traceSamplingPrecision)
+}
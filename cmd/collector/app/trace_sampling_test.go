@@ -0,0 +1,55 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/uber/jaeger/model"
+)
+
+func TestTraceSamplingBucket(t *testing.T) {
+	testCases := []struct {
+		traceID model.TraceID
+		seed    uint64
+		bucket  uint64
+	}{
+		{traceID: model.TraceID{Low: 12345}, bucket: 2345},
+		{traceID: model.TraceID{High: 1, Low: 12345}, bucket: 2345},
+		// FNV-1a of the big-endian seed, high and low bits
+		{traceID: model.TraceID{Low: 1}, seed: 42, bucket: 9108},
+		{traceID: model.TraceID{Low: 2}, seed: 42, bucket: 3741},
+		{traceID: model.TraceID{High: 1, Low: 1}, seed: 7, bucket: 8864},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.bucket, TraceSamplingBucket(testCase.traceID, testCase.seed), "%+v", testCase)
+	}
+}
+
+func TestSampleTrace(t *testing.T) {
+	traceID := model.TraceID{Low: 1}
+	assert.True(t, sampleTrace(traceID, 1, 42))
+	assert.False(t, sampleTrace(traceID, 0.9, 42), "the seeded bucket is 9108")
+	assert.True(t, sampleTrace(traceID, 0.9, 0))
+	assert.False(t, sampleTrace(traceID, 0, 0))
+}
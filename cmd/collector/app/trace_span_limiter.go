@@ -0,0 +1,116 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/pkg/cache"
+)
+
+const (
+	// TruncatedTraceTag is the span tag marking the traces whose spans beyond the limit were dropped
+	TruncatedTraceTag = "trace.truncated"
+	// DefaultTraceSpanLimitWindow is the default time the spans of a trace are counted for
+	DefaultTraceSpanLimitWindow = time.Hour
+
+	// limitedTracesSize is the number of traces whose spans are counted at once, the spans of the least
+	// recently seen traces being counted again from zero once they are evicted
+	limitedTracesSize = 100000
+)
+
+// TraceSpanLimitOptions configure a TraceSpanLimiter
+type TraceSpanLimitOptions struct {
+	// MaxSpans is the number of spans kept for each trace
+	MaxSpans int
+	// Window is the time the spans of a trace are counted for from its first span, DefaultTraceSpanLimitWindow if 0
+	Window time.Duration
+}
+
+// TraceSpanLimiter counts the spans of each trace, and drops the spans beyond the limit of the options, e.g. those
+// of a runaway loop, so that pathological traces do not overwhelm the storage and the UI. The first span beyond
+// the limit is kept tagged with TruncatedTraceTag, marking the trace as truncated. The truncated traces are
+// counted by the traces.truncated counter, and the dropped spans by the spans.truncated counter.
+type TraceSpanLimiter struct {
+	maxSpans        int
+	traces          cache.Cache
+	lock            sync.Mutex
+	truncatedTraces metrics.Counter
+	truncatedSpans  metrics.Counter
+}
+
+// NewTraceSpanLimiter creates a TraceSpanLimiter, counting the truncated traces in the metrics factory
+func NewTraceSpanLimiter(options TraceSpanLimitOptions, metricsFactory metrics.Factory) *TraceSpanLimiter {
+	return newTraceSpanLimiter(options, metricsFactory, time.Now)
+}
+
+func newTraceSpanLimiter(options TraceSpanLimitOptions, metricsFactory metrics.Factory, timeNow func() time.Time) *TraceSpanLimiter {
+	if options.Window == 0 {
+		options.Window = DefaultTraceSpanLimitWindow
+	}
+	return &TraceSpanLimiter{
+		maxSpans: options.MaxSpans,
+		traces: cache.NewLRUWithOptions(limitedTracesSize, &cache.Options{
+			TTL:     options.Window,
+			TimeNow: timeNow,
+		}),
+		truncatedTraces: metricsFactory.Counter("traces.truncated", nil),
+		truncatedSpans:  metricsFactory.Counter("spans.truncated", nil),
+	}
+}
+
+// Allow counts the span in its trace, and returns false when the trace already has more spans than the limit.
+// It can be used as a FilterSpan, the first span beyond the limit is tagged.
+func (l *TraceSpanLimiter) Allow(span *model.Span) bool {
+	key := traceKey(span.TraceID)
+	l.lock.Lock()
+	count, _ := l.traces.Get(key).(*int)
+	if count == nil {
+		count = new(int)
+		l.traces.Put(key, count)
+	}
+	*count++
+	spans := *count
+	l.lock.Unlock()
+	switch {
+	case spans <= l.maxSpans:
+		return true
+	case spans == l.maxSpans+1:
+		l.truncatedTraces.Inc(1)
+		span.Tags = append(span.Tags, model.Bool(TruncatedTraceTag, true))
+		return true
+	default:
+		l.truncatedSpans.Inc(1)
+		return false
+	}
+}
+
+func traceKey(traceID model.TraceID) string {
+	var key [16]byte
+	binary.BigEndian.PutUint64(key[0:], traceID.High)
+	binary.BigEndian.PutUint64(key[8:], traceID.Low)
+	return string(key[:])
+}
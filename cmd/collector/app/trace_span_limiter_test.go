@@ -0,0 +1,68 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+func TestTraceSpanLimiter(t *testing.T) {
+	mb := metrics.NewLocalFactory(0)
+	now := time.Unix(0, 0)
+	l := newTraceSpanLimiter(TraceSpanLimitOptions{MaxSpans: 2, Window: time.Minute}, mb, func() time.Time { return now })
+
+	spans := make([]*model.Span, 5)
+	for i := range spans {
+		spans[i] = &model.Span{TraceID: model.TraceID{Low: 1}, SpanID: model.SpanID(i + 1)}
+	}
+	var allowed []bool
+	for _, span := range spans {
+		allowed = append(allowed, l.Allow(span))
+	}
+	assert.Equal(t, []bool{true, true, true, false, false}, allowed)
+	assert.Empty(t, spans[1].Tags)
+	assert.Equal(t, model.KeyValues{model.Bool(TruncatedTraceTag, true)}, spans[2].Tags)
+
+	other := &model.Span{TraceID: model.TraceID{High: 1, Low: 1}}
+	assert.True(t, l.Allow(other), "the spans of each trace are counted apart")
+	assert.Empty(t, other.Tags)
+
+	counters, _ := mb.Snapshot()
+	assert.EqualValues(t, 1, counters["traces.truncated"])
+	assert.EqualValues(t, 2, counters["spans.truncated"])
+
+	now = now.Add(2 * time.Minute)
+	assert.True(t, l.Allow(&model.Span{TraceID: model.TraceID{Low: 1}}), "the spans are counted again after the window")
+}
+
+func TestTraceSpanLimiterDefaultWindow(t *testing.T) {
+	l := NewTraceSpanLimiter(TraceSpanLimitOptions{MaxSpans: 1}, metrics.NullFactory)
+	span := &model.Span{TraceID: model.TraceID{Low: 1}}
+	assert.True(t, l.Allow(span))
+	assert.True(t, l.Allow(span))
+	assert.False(t, l.Allow(span))
+}
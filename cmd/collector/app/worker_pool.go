@@ -0,0 +1,128 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/uber/jaeger/pkg/queue"
+)
+
+// MaxWorkerPoolGrowth is how many times its initial size a WorkerPool can be resized to, so that a resize cannot
+// start so many workers that the collector runs out of memory
+const MaxWorkerPoolGrowth = 10
+
+var errWorkerPoolSize = errors.New("the worker pool size must be positive")
+
+// WorkerPool caps the number of workers of the span processor writing the queued spans to storage, so that
+// the parallelism of the writes matches the capacity of the storage. Its size can be changed while the
+// collector runs, the workers taken out of the pool finishing the span they are saving.
+type WorkerPool struct {
+	sync.Mutex
+	size    int
+	maxSize int
+	queue   *queue.BoundedQueue
+}
+
+// WorkerPoolState is the size of a WorkerPool and the number of its workers saving a span
+type WorkerPoolState struct {
+	Size int `json:"size"`
+	Busy int `json:"busy"`
+	Idle int `json:"idle"`
+}
+
+// NewWorkerPool creates a WorkerPool of the given size, DefaultNumWorkers if not positive, which can be resized
+// up to MaxWorkerPoolGrowth times that size
+func NewWorkerPool(size int) *WorkerPool {
+	if size <= 0 {
+		size = DefaultNumWorkers
+	}
+	return &WorkerPool{size: size, maxSize: size * MaxWorkerPoolGrowth}
+}
+
+// Size returns the number of workers of the pool
+func (p *WorkerPool) Size() int {
+	p.Lock()
+	defer p.Unlock()
+	return p.size
+}
+
+// Resize changes the number of workers of the pool
+func (p *WorkerPool) Resize(size int) error {
+	if size <= 0 {
+		return errWorkerPoolSize
+	}
+	if size > p.maxSize {
+		return fmt.Errorf("the worker pool size cannot exceed %d", p.maxSize)
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.size = size
+	if p.queue != nil {
+		p.queue.Resize(size)
+	}
+	return nil
+}
+
+// State returns the size of the pool and the number of its busy and idle workers
+func (p *WorkerPool) State() WorkerPoolState {
+	p.Lock()
+	defer p.Unlock()
+	state := WorkerPoolState{Size: p.size}
+	if p.queue != nil {
+		state.Busy = p.queue.BusyConsumers()
+		if state.Busy > p.size {
+			state.Busy = p.size
+		}
+	}
+	state.Idle = p.size - state.Busy
+	return state
+}
+
+// start starts the workers of the pool consuming the items of the queue
+func (p *WorkerPool) start(q *queue.BoundedQueue, consumer func(item interface{})) {
+	p.Lock()
+	defer p.Unlock()
+	p.queue = q
+	q.StartConsumers(p.size, consumer)
+}
+
+// ServeHTTP writes the state of the pool as JSON, after resizing the pool to the size query parameter
+// on a PUT request
+func (p *WorkerPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		size, err := strconv.Atoi(r.URL.Query().Get("size"))
+		if err == nil {
+			err = p.Resize(size)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Cannot resize the worker pool: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p.State())
+}
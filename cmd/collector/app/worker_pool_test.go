@@ -0,0 +1,110 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/jaeger/model"
+)
+
+func TestWorkerPoolResize(t *testing.T) {
+	assert.Equal(t, DefaultNumWorkers, NewWorkerPool(0).Size())
+	pool := NewWorkerPool(2)
+	assert.Equal(t, errWorkerPoolSize, pool.Resize(0))
+	assert.Equal(t, 2, pool.Size())
+	require.NoError(t, pool.Resize(4))
+	assert.Equal(t, WorkerPoolState{Size: 4, Busy: 0, Idle: 4}, pool.State())
+	assert.EqualError(t, pool.Resize(2*MaxWorkerPoolGrowth+1), "the worker pool size cannot exceed 20")
+	assert.Equal(t, 4, pool.Size())
+	require.NoError(t, pool.Resize(2*MaxWorkerPoolGrowth))
+}
+
+func TestWorkerPoolServeHTTP(t *testing.T) {
+	testCases := []struct {
+		method string
+		query  string
+		status int
+		size   int
+	}{
+		{method: http.MethodGet, status: http.StatusOK, size: 2},
+		{method: http.MethodPut, query: "?size=5", status: http.StatusOK, size: 5},
+		{method: http.MethodPut, query: "?size=0", status: http.StatusBadRequest, size: 2},
+		{method: http.MethodPut, query: "?size=many", status: http.StatusBadRequest, size: 2},
+		{method: http.MethodPut, query: "?size=1000000000", status: http.StatusBadRequest, size: 2},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.method+testCase.query, func(t *testing.T) {
+			pool := NewWorkerPool(2)
+			w := httptest.NewRecorder()
+			pool.ServeHTTP(w, httptest.NewRequest(testCase.method, "/"+testCase.query, nil))
+			assert.Equal(t, testCase.status, w.Code)
+			assert.Equal(t, testCase.size, pool.Size())
+			if testCase.status != http.StatusOK {
+				return
+			}
+			var state WorkerPoolState
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &state))
+			assert.Equal(t, WorkerPoolState{Size: testCase.size, Idle: testCase.size}, state)
+		})
+	}
+}
+
+func TestSpanProcessorWorkerPool(t *testing.T) {
+	w := &blockingWriter{}
+	pool := NewWorkerPool(2)
+	p := NewSpanProcessor(w,
+		Options.NumWorkers(10),
+		Options.QueueSize(10),
+		Options.WorkerPool(pool),
+	).(*spanProcessor)
+	defer p.Stop()
+
+	// the writer is blocked, so that each worker is busy with a span and the third span stays queued
+	w.Lock()
+	defer w.Unlock()
+	_, err := p.ProcessSpans([]*model.Span{
+		{Process: &model.Process{ServiceName: "x"}},
+		{Process: &model.Process{ServiceName: "x"}},
+		{Process: &model.Process{ServiceName: "x"}},
+	}, JaegerFormatType)
+	require.NoError(t, err)
+	for i := 0; i < 1000 && pool.State().Busy < 2; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, WorkerPoolState{Size: 2, Busy: 2, Idle: 0}, pool.State())
+	assert.Equal(t, 1, p.queue.Size())
+	assert.Equal(t, 2, p.queue.Consumers())
+
+	require.NoError(t, pool.Resize(4))
+	assert.Equal(t, 4, p.queue.Consumers())
+	for i := 0; i < 1000 && p.queue.Size() > 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 0, p.queue.Size(), "the third span is taken by a new worker")
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zipkin
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/opentracing/opentracing-go/ext"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/thrift-gen/zipkincore"
+)
+
+// Span kinds of the Zipkin v2 model
+const (
+	KindClient   = "CLIENT"
+	KindServer   = "SERVER"
+	KindProducer = "PRODUCER"
+	KindConsumer = "CONSUMER"
+)
+
+// spanV2 is a span in the Zipkin v2 JSON format, see https://zipkin.io/zipkin-api/#/default/post_spans
+type spanV2 struct {
+	TraceID        string            `json:"traceId"`
+	ParentID       string            `json:"parentId"`
+	ID             string            `json:"id"`
+	Kind           string            `json:"kind"`
+	Name           string            `json:"name"`
+	Timestamp      int64             `json:"timestamp"`
+	Duration       int64             `json:"duration"`
+	Debug          bool              `json:"debug"`
+	LocalEndpoint  *endpointV2       `json:"localEndpoint"`
+	RemoteEndpoint *endpointV2       `json:"remoteEndpoint"`
+	Annotations    []annotationV2    `json:"annotations"`
+	Tags           map[string]string `json:"tags"`
+}
+
+type endpointV2 struct {
+	ServiceName string `json:"serviceName"`
+	IPv4        string `json:"ipv4"`
+	Port        int    `json:"port"`
+}
+
+type annotationV2 struct {
+	Timestamp int64  `json:"timestamp"`
+	Value     string `json:"value"`
+}
+
+// DeserializeJSONV2 decodes a list of spans in the Zipkin v2 JSON format and converts them into
+// the Zipkin Thrift (v1) model, so that they are processed like the spans received over Thrift.
+// The kind of the spans is expressed with core annotations, the remote endpoint with address annotations.
+func DeserializeJSONV2(b []byte) ([]*zipkincore.Span, error) {
+	var spans []spanV2
+	if err := json.Unmarshal(b, &spans); err != nil {
+		return nil, err
+	}
+	zSpans := make([]*zipkincore.Span, 0, len(spans))
+	for i := range spans {
+		zSpan, err := spanV2ToThrift(&spans[i])
+		if err != nil {
+			return nil, err
+		}
+		zSpans = append(zSpans, zSpan)
+	}
+	return zSpans, nil
+}
+
+func spanV2ToThrift(s *spanV2) (*zipkincore.Span, error) {
+	traceID, err := model.TraceIDFromString(s.TraceID)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid trace ID %q: %v", s.TraceID, err)
+	}
+	id, err := model.SpanIDFromString(s.ID)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid span ID %q: %v", s.ID, err)
+	}
+	zSpan := &zipkincore.Span{
+		TraceID: int64(traceID.Low),
+		ID:      int64(id),
+		Name:    s.Name,
+		Debug:   s.Debug,
+	}
+	if traceID.High != 0 {
+		high := int64(traceID.High)
+		zSpan.TraceIDHigh = &high
+	}
+	if s.ParentID != "" {
+		parentID, err := model.SpanIDFromString(s.ParentID)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid parent ID %q: %v", s.ParentID, err)
+		}
+		p := int64(parentID)
+		zSpan.ParentID = &p
+	}
+	if s.Timestamp != 0 {
+		timestamp := s.Timestamp
+		zSpan.Timestamp = &timestamp
+	}
+	if s.Duration != 0 {
+		duration := s.Duration
+		zSpan.Duration = &duration
+	}
+
+	local, err := endpointV2ToThrift(s.LocalEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := endpointV2ToThrift(s.RemoteEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	var start, end, remoteAddr string
+	switch s.Kind {
+	case KindClient:
+		start, end, remoteAddr = zipkincore.CLIENT_SEND, zipkincore.CLIENT_RECV, zipkincore.SERVER_ADDR
+	case KindServer:
+		start, end, remoteAddr = zipkincore.SERVER_RECV, zipkincore.SERVER_SEND, zipkincore.CLIENT_ADDR
+	case KindProducer, KindConsumer:
+		// Zipkin v1 has no core annotations for messaging, the kind is kept as a tag
+		remoteAddr = zipkincore.SERVER_ADDR
+		if s.Kind == KindConsumer {
+			remoteAddr = zipkincore.CLIENT_ADDR
+		}
+		kind := string(ext.SpanKindProducerEnum)
+		if s.Kind == KindConsumer {
+			kind = string(ext.SpanKindConsumerEnum)
+		}
+		zSpan.BinaryAnnotations = append(zSpan.BinaryAnnotations, stringAnnotation(string(ext.SpanKind), kind, local))
+	case "":
+	default:
+		return nil, fmt.Errorf("Unknown span kind %q", s.Kind)
+	}
+	if start != "" && s.Timestamp != 0 {
+		zSpan.Annotations = append(zSpan.Annotations, &zipkincore.Annotation{
+			Timestamp: s.Timestamp,
+			Value:     start,
+			Host:      local,
+		})
+		if s.Duration != 0 {
+			zSpan.Annotations = append(zSpan.Annotations, &zipkincore.Annotation{
+				Timestamp: s.Timestamp + s.Duration,
+				Value:     end,
+				Host:      local,
+			})
+		}
+	}
+	for _, a := range s.Annotations {
+		zSpan.Annotations = append(zSpan.Annotations, &zipkincore.Annotation{
+			Timestamp: a.Timestamp,
+			Value:     a.Value,
+			Host:      local,
+		})
+	}
+	for key, value := range s.Tags {
+		zSpan.BinaryAnnotations = append(zSpan.BinaryAnnotations, stringAnnotation(key, value, local))
+	}
+	if remote != nil && remoteAddr != "" {
+		zSpan.BinaryAnnotations = append(zSpan.BinaryAnnotations, &zipkincore.BinaryAnnotation{
+			Key:            remoteAddr,
+			Value:          []byte{1},
+			AnnotationType: zipkincore.AnnotationType_BOOL,
+			Host:           remote,
+		})
+	}
+	if len(zSpan.Annotations) == 0 && len(zSpan.BinaryAnnotations) == 0 && local != nil {
+		// local span without data, the local component annotation carries its service name
+		zSpan.BinaryAnnotations = append(zSpan.BinaryAnnotations, stringAnnotation(zipkincore.LOCAL_COMPONENT, "", local))
+	}
+	return zSpan, nil
+}
+
+func stringAnnotation(key, value string, host *zipkincore.Endpoint) *zipkincore.BinaryAnnotation {
+	return &zipkincore.BinaryAnnotation{
+		Key:            key,
+		Value:          []byte(value),
+		AnnotationType: zipkincore.AnnotationType_STRING,
+		Host:           host,
+	}
+}
+
+// endpointV2ToThrift converts an endpoint, IPv6 addresses are dropped as they cannot be represented in Zipkin Thrift
+func endpointV2ToThrift(e *endpointV2) (*zipkincore.Endpoint, error) {
+	if e == nil {
+		return nil, nil
+	}
+	endpoint := &zipkincore.Endpoint{
+		ServiceName: e.ServiceName,
+		Port:        int16(uint16(e.Port)),
+	}
+	if e.IPv4 != "" {
+		ip := net.ParseIP(e.IPv4).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("Invalid IPv4 address %q", e.IPv4)
+		}
+		endpoint.Ipv4 = int32(binary.BigEndian.Uint32(ip))
+	}
+	return endpoint, nil
+}
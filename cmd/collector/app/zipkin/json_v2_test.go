@@ -0,0 +1,153 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zipkin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/model/converter/thrift/zipkin"
+	zc "github.com/uber/jaeger/thrift-gen/zipkincore"
+)
+
+func findTag(t *testing.T, tags model.KeyValues, key string) *model.KeyValue {
+	tag, ok := tags.FindByKey(key)
+	require.True(t, ok, "missing tag %s", key)
+	return &tag
+}
+
+func TestDeserializeJSONV2Client(t *testing.T) {
+	spans, err := DeserializeJSONV2([]byte(`[{
+		"traceId": "0000000000000001000000000000000a",
+		"parentId": "b",
+		"id": "c",
+		"kind": "CLIENT",
+		"name": "get /api",
+		"timestamp": 1000,
+		"duration": 200,
+		"debug": true,
+		"localEndpoint": {"serviceName": "frontend", "ipv4": "10.0.0.1", "port": 8080},
+		"remoteEndpoint": {"serviceName": "backend", "ipv4": "10.0.0.2", "port": 9000},
+		"annotations": [{"timestamp": 1100, "value": "retry"}],
+		"tags": {"http.method": "GET"}
+	}]`))
+	require.NoError(t, err)
+	require.Len(t, spans, 1)
+	zSpan := spans[0]
+	assert.EqualValues(t, 10, zSpan.TraceID)
+	assert.EqualValues(t, 1, zSpan.GetTraceIDHigh())
+	assert.EqualValues(t, 11, zSpan.GetParentID())
+	assert.EqualValues(t, 12, zSpan.ID)
+	assert.EqualValues(t, 1000, zSpan.GetTimestamp())
+	assert.EqualValues(t, 200, zSpan.GetDuration())
+	assert.True(t, zSpan.Debug)
+	require.Len(t, zSpan.Annotations, 3)
+	assert.Equal(t, zc.CLIENT_SEND, zSpan.Annotations[0].Value)
+	assert.Equal(t, zc.CLIENT_RECV, zSpan.Annotations[1].Value)
+	assert.EqualValues(t, 1200, zSpan.Annotations[1].Timestamp)
+	assert.Equal(t, "frontend", zSpan.Annotations[0].Host.ServiceName)
+	assert.EqualValues(t, 0x0a000001, zSpan.Annotations[0].Host.Ipv4)
+
+	span, err := zipkin.ToDomainSpan(zSpan)
+	require.NoError(t, err)
+	assert.Equal(t, "frontend", span.Process.ServiceName)
+	assert.Equal(t, "client", findTag(t, span.Tags, "span.kind").AsString())
+	assert.Equal(t, "backend", findTag(t, span.Tags, "peer.service").AsString())
+	assert.EqualValues(t, 9000, findTag(t, span.Tags, "peer.port").Int64())
+	assert.Equal(t, "GET", findTag(t, span.Tags, "http.method").AsString())
+	require.Len(t, span.Logs, 1)
+	assert.Equal(t, "retry", span.Logs[0].Fields[0].AsString())
+}
+
+func TestDeserializeJSONV2Kinds(t *testing.T) {
+	testCases := []struct {
+		kind     string
+		spanKind string
+		peerAddr string
+	}{
+		{kind: KindServer, spanKind: "server", peerAddr: zc.CLIENT_ADDR},
+		{kind: KindProducer, spanKind: "producer", peerAddr: zc.SERVER_ADDR},
+		{kind: KindConsumer, spanKind: "consumer", peerAddr: zc.CLIENT_ADDR},
+	}
+	for _, tc := range testCases {
+		testCase := tc // capture loop var
+		t.Run(testCase.kind, func(t *testing.T) {
+			spans, err := DeserializeJSONV2([]byte(`[{
+				"traceId": "a", "id": "b", "kind": "` + testCase.kind + `",
+				"timestamp": 1000, "duration": 200,
+				"localEndpoint": {"serviceName": "svc"},
+				"remoteEndpoint": {"serviceName": "peer"}
+			}]`))
+			require.NoError(t, err)
+			require.Len(t, spans, 1)
+			var peer *zc.BinaryAnnotation
+			for _, a := range spans[0].BinaryAnnotations {
+				if a.Key == testCase.peerAddr {
+					peer = a
+				}
+			}
+			require.NotNil(t, peer, "missing %s annotation", testCase.peerAddr)
+			assert.Equal(t, "peer", peer.Host.ServiceName)
+
+			span, err := zipkin.ToDomainSpan(spans[0])
+			require.NoError(t, err)
+			assert.Equal(t, "svc", span.Process.ServiceName)
+			assert.Equal(t, testCase.spanKind, findTag(t, span.Tags, "span.kind").AsString())
+		})
+	}
+}
+
+func TestDeserializeJSONV2LocalSpan(t *testing.T) {
+	spans, err := DeserializeJSONV2([]byte(`[
+		{"traceId": "a", "id": "b", "localEndpoint": {"serviceName": "svc"}},
+		{"traceId": "a", "id": "c", "localEndpoint": {"serviceName": "svc"}, "tags": {"k": "v"}}
+	]`))
+	require.NoError(t, err)
+	require.Len(t, spans, 2)
+	for _, zSpan := range spans {
+		assert.Empty(t, zSpan.Annotations)
+		span, err := zipkin.ToDomainSpan(zSpan)
+		require.NoError(t, err)
+		assert.Equal(t, "svc", span.Process.ServiceName)
+	}
+}
+
+func TestDeserializeJSONV2Errors(t *testing.T) {
+	testCases := []struct {
+		json string
+		err  string
+	}{
+		{json: `{}`, err: "json: cannot unmarshal object into Go value of type []zipkin.spanV2"},
+		{json: `[{"traceId": "x", "id": "b"}]`, err: `Invalid trace ID "x": strconv.ParseUint: parsing "x": invalid syntax`},
+		{json: `[{"traceId": "a", "id": "x"}]`, err: `Invalid span ID "x": strconv.ParseUint: parsing "x": invalid syntax`},
+		{json: `[{"traceId": "a", "id": "b", "parentId": "x"}]`, err: `Invalid parent ID "x": strconv.ParseUint: parsing "x": invalid syntax`},
+		{json: `[{"traceId": "a", "id": "b", "kind": "BROKER"}]`, err: `Unknown span kind "BROKER"`},
+		{json: `[{"traceId": "a", "id": "b", "localEndpoint": {"ipv4": "::1"}}]`, err: `Invalid IPv4 address "::1"`},
+		{json: `[{"traceId": "a", "id": "b", "remoteEndpoint": {"ipv4": "nope"}}]`, err: `Invalid IPv4 address "nope"`},
+	}
+	for _, testCase := range testCases {
+		_, err := DeserializeJSONV2([]byte(testCase.json))
+		assert.EqualError(t, err, testCase.err, testCase.json)
+	}
+}
@@ -21,26 +21,44 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"flag"
 	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/uber/jaeger/pkg/recoveryhandler"
 	"github.com/uber/tchannel-go"
 	"github.com/uber/tchannel-go/thrift"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 
 	"github.com/uber/jaeger-lib/metrics/go-kit"
 	"github.com/uber/jaeger-lib/metrics/go-kit/expvar"
 	jc "github.com/uber/jaeger/thrift-gen/jaeger"
+	sc "github.com/uber/jaeger/thrift-gen/sampling"
 	zc "github.com/uber/jaeger/thrift-gen/zipkincore"
 
 	basicB "github.com/uber/jaeger/cmd/builder"
 	"github.com/uber/jaeger/cmd/collector/app"
 	"github.com/uber/jaeger/cmd/collector/app/builder"
+	"github.com/uber/jaeger/cmd/flags"
 	casFlags "github.com/uber/jaeger/cmd/flags/cassandra"
+	"github.com/uber/jaeger/model/codec"
+	badgercfg "github.com/uber/jaeger/pkg/badger/config"
+	kafkacfg "github.com/uber/jaeger/pkg/kafka/config"
+	jmetrics "github.com/uber/jaeger/pkg/metrics"
+	natscfg "github.com/uber/jaeger/pkg/nats/config"
+	pgcfg "github.com/uber/jaeger/pkg/postgres/config"
+	tlscfg "github.com/uber/jaeger/pkg/tls/config"
+	"github.com/uber/jaeger/storage/spanstore/deadline"
 )
 
 const (
@@ -53,12 +71,343 @@ func main() {
 	flag.Parse()
 	logger, _ := zap.NewProduction()
 	baseMetrics := xkit.Wrap(serviceName, expvar.NewFactory(10))
+	spanSerialization, err := codec.ParseFormat(*builder.SpanSerialization)
+	if err != nil {
+		logger.Fatal("Invalid span serialization format", zap.Error(err))
+	}
 
-	spanBuilder, err := builder.NewSpanHandlerBuilder(
+	builderOpts := []basicB.Option{
 		basicB.Options.CassandraOption(casOptions.GetPrimary()),
+		basicB.Options.BadgerOption(&badgercfg.Configuration{
+			Directory:          flags.BadgerStorage.Directory,
+			ValueLogGCInterval: flags.BadgerStorage.ValueLogGCInterval,
+		}),
+		basicB.Options.PostgresOption(&pgcfg.Configuration{
+			DSN:             flags.PostgresStorage.DSN,
+			MaxOpenConns:    flags.PostgresStorage.MaxOpenConns,
+			MaxIdleConns:    flags.PostgresStorage.MaxIdleConns,
+			ConnMaxLifetime: flags.PostgresStorage.ConnMaxLifetime,
+		}),
+		basicB.Options.KafkaOption(&kafkacfg.Configuration{
+			Brokers: splitList(*builder.KafkaBrokers),
+			Topic:   *builder.KafkaTopic,
+		}),
 		basicB.Options.LoggerOption(logger),
 		basicB.Options.MetricsFactoryOption(baseMetrics),
-	)
+		basicB.Options.GRPCEnabledOption(*builder.CollectorGRPCEnabled),
+		basicB.Options.DryRunOption(*builder.CollectorDryRun),
+		basicB.Options.ZipkinReferenceRulesOption(
+			splitList(*builder.ZipkinFollowsFromSpanKinds),
+			splitList(*builder.ZipkinFollowsFromAnnotations),
+		),
+		basicB.Options.OpenCensusOption(*builder.CollectorOpenCensusEnabled),
+		basicB.Options.OTLPOption(*builder.CollectorOTLPEnabled),
+		basicB.Options.DeduplicationOption(*builder.DeduplicationWindow),
+		basicB.Options.MaxSpanSizeOption(*builder.MaxSpanSize),
+		basicB.Options.SamplingSeedOption(*builder.SamplingSeed),
+		basicB.Options.SpanMetricsOption(*builder.SpanMetricsEnabled),
+		basicB.Options.SamplingDecisionsOption(*builder.SamplingDecisionsEnabled, tailSampler()),
+		basicB.Options.SpanSerializationOption(spanSerialization),
+		basicB.Options.HealthCheckOption(
+			*builder.HealthCheckInterval,
+			*builder.HealthCheckFailureThreshold,
+			*builder.HealthCheckSuccessThreshold,
+		),
+	}
+	if *builder.TagsAllowList != "" || *builder.TagsDenyList != "" || *builder.TagsMaxValueLength > 0 {
+		builderOpts = append(builderOpts, basicB.Options.TagSanitizerOption(
+			splitList(*builder.TagsAllowList),
+			splitList(*builder.TagsDenyList),
+			*builder.TagsMaxValueLength,
+		))
+	}
+	if *builder.AsyncWriterBufferSize > 0 {
+		builderOpts = append(builderOpts, basicB.Options.AsyncWriterOption(
+			*builder.AsyncWriterBufferSize,
+			*builder.AsyncWriterNumWorkers,
+			*builder.AsyncWriterBlockWhenFull,
+		))
+	}
+	if *builder.TraceBatchingWindow > 0 {
+		builderOpts = append(builderOpts, basicB.Options.TraceBatchingOption(
+			*builder.TraceBatchingWindow,
+			*builder.TraceBatchingMaxSize,
+			*builder.TraceBatchingMaxPendingSpans,
+			*builder.TraceBatchingFlushers,
+		))
+	}
+	if *builder.TailSamplingWindow > 0 {
+		builderOpts = append(builderOpts, basicB.Options.TailSamplingOption(
+			*builder.TailSamplingWindow,
+			*builder.TailSamplingDurationThreshold,
+		))
+		builderOpts = append(builderOpts, basicB.Options.TailSamplingRootOption(*builder.TailSamplingRequireRoot))
+	}
+	if *builder.CircuitBreakerFailureThreshold > 0 {
+		builderOpts = append(builderOpts, basicB.Options.CircuitBreakerOption(
+			*builder.CircuitBreakerFailureThreshold,
+			*builder.CircuitBreakerLatencyThreshold,
+			*builder.CircuitBreakerOpenPeriod,
+			*builder.CircuitBreakerFallbackSize,
+		))
+	}
+	if *builder.WriteDeadlines != "" {
+		timeouts, err := deadline.ParseTimeouts(*builder.WriteDeadlines)
+		if err != nil {
+			logger.Fatal("Invalid write deadlines", zap.Error(err))
+		}
+		for storageType, timeout := range timeouts {
+			builderOpts = append(builderOpts, basicB.Options.WriteDeadlineOption(storageType, timeout))
+		}
+	}
+	if *builder.WALDirectory != "" {
+		builderOpts = append(builderOpts, basicB.Options.WALOption(
+			*builder.WALDirectory,
+			*builder.WALSegmentSize,
+			*builder.WALMaxSize,
+			*builder.WALSyncWrites,
+		))
+	}
+	if *builder.NATSServers != "" {
+		builderOpts = append(builderOpts, basicB.Options.NATSOption(natscfg.Configuration{
+			Servers:         splitList(*builder.NATSServers),
+			Subject:         *builder.NATSSubject,
+			Queue:           *builder.NATSQueue,
+			Durable:         *builder.NATSDurable,
+			AckWait:         *builder.NATSAckWait,
+			MaxAckPending:   *builder.NATSMaxAckPending,
+			Username:        *builder.NATSUsername,
+			Password:        *builder.NATSPassword,
+			CredentialsFile: *builder.NATSCredentialsFile,
+		}))
+	}
+	if *builder.QueueHighWaterMark > 0 {
+		builderOpts = append(builderOpts, basicB.Options.BackpressureOption(
+			*builder.QueueHighWaterMark,
+			*builder.QueueLowWaterMark,
+		))
+	}
+	if *builder.AdmissionMaxMemory > 0 || *builder.AdmissionMaxGoroutines > 0 {
+		builderOpts = append(builderOpts, basicB.Options.AdmissionOption(app.AdmissionOptions{
+			MaxMemory:     *builder.AdmissionMaxMemory,
+			MaxGoroutines: *builder.AdmissionMaxGoroutines,
+			ShedRatio:     *builder.AdmissionShedRatio,
+			CheckInterval: *builder.AdmissionCheckInterval,
+		}))
+	}
+	if *builder.DroppedSpansBufferSize > 0 {
+		builderOpts = append(builderOpts, basicB.Options.DroppedSpansOption(
+			*builder.DroppedSpansBufferSize,
+			*builder.DroppedSpansSampleRate,
+		))
+	}
+	if *builder.WorkerPoolSize > 0 {
+		builderOpts = append(builderOpts, basicB.Options.WorkerPoolOption(*builder.WorkerPoolSize))
+	}
+	if *builder.TraceSpanLimit > 0 {
+		builderOpts = append(builderOpts, basicB.Options.TraceSpanLimitOption(
+			*builder.TraceSpanLimit,
+			*builder.TraceSpanLimitWindow,
+		))
+	}
+	if *builder.MaxOperationsPerService > 0 {
+		builderOpts = append(builderOpts, basicB.Options.OperationCardinalityOption(
+			*builder.MaxOperationsPerService,
+			*builder.OperationPlaceholder,
+		))
+	}
+	if *builder.CorrelationTagKey != "" {
+		format, err := app.ParseCorrelationFormat(*builder.CorrelationTagFormat)
+		if err != nil {
+			logger.Fatal("Invalid correlation tag format", zap.Error(err))
+		}
+		builderOpts = append(builderOpts, basicB.Options.CorrelationTagOption(*builder.CorrelationTagKey, format))
+	}
+	if *builder.CollectorHostnameTag != "" || *builder.CollectorTags != "" {
+		tags, err := app.ParseCollectorTags(*builder.CollectorTags)
+		if err != nil {
+			logger.Fatal("Invalid collector tags", zap.Error(err))
+		}
+		builderOpts = append(builderOpts, basicB.Options.CollectorTagOption(*builder.CollectorHostnameTag, tags))
+	}
+	if *builder.EnrichmentURL != "" {
+		builderOpts = append(builderOpts, basicB.Options.EnrichmentOption(
+			app.NewHTTPMetadataProvider(*builder.EnrichmentURL, *builder.EnrichmentTimeout),
+			splitList(*builder.EnrichmentTagKeys),
+			*builder.EnrichmentCacheTTL,
+			*builder.EnrichmentCacheSize,
+		))
+	}
+	if *builder.TenancyHeader != "" || *builder.TenancyTag != "" {
+		builderOpts = append(builderOpts, basicB.Options.TenancyOption(*builder.TenancyHeader, *builder.TenancyTag))
+	}
+	if *builder.ServiceAliasesFile != "" {
+		aliases, err := loadServiceAliases(*builder.ServiceAliasesFile)
+		if err != nil {
+			logger.Fatal("Unable to load service aliases", zap.Error(err))
+		}
+		builderOpts = append(builderOpts, basicB.Options.ServiceAliasOption(aliases))
+	}
+	if *builder.CollectorHTTPTLSCert == "" && *builder.CollectorHTTPTLSClientCA != "" {
+		// the client certificates would otherwise never be verified, nor the clients authenticated with them
+		logger.Fatal("A TLS client CA requires a TLS server certificate", zap.String("client-ca", *builder.CollectorHTTPTLSClientCA))
+	}
+	if *builder.CollectorHTTPTLSCert != "" {
+		builderOpts = append(builderOpts, basicB.Options.TLSOption(tlscfg.Configuration{
+			CertPath:          *builder.CollectorHTTPTLSCert,
+			KeyPath:           *builder.CollectorHTTPTLSKey,
+			ClientCAPath:      *builder.CollectorHTTPTLSClientCA,
+			RequireClientCert: *builder.CollectorHTTPTLSRequireClientCert,
+			CipherSuites:      splitList(*builder.CollectorHTTPTLSCipherSuites),
+			MinVersion:        *builder.CollectorHTTPTLSMinVersion,
+			ReloadInterval:    *builder.CollectorHTTPTLSReloadInterval,
+		}))
+	}
+	if *builder.TagMappingsFile != "" {
+		mappings, err := loadTagMappings(*builder.TagMappingsFile)
+		if err != nil {
+			logger.Fatal("Unable to load tag mappings", zap.Error(err))
+		}
+		builderOpts = append(builderOpts, basicB.Options.TagMappingOption(mappings))
+	}
+	if *builder.HTTPStatusRulesFile != "" {
+		rules, err := loadHTTPStatusRules(*builder.HTTPStatusRulesFile)
+		if err != nil {
+			logger.Fatal("Unable to load HTTP status rules", zap.Error(err))
+		}
+		builderOpts = append(builderOpts, basicB.Options.HTTPStatusRuleOption(rules))
+	}
+	if *builder.OperationNameRulesFile != "" {
+		rules, err := loadOperationNameRules(*builder.OperationNameRulesFile)
+		if err != nil {
+			logger.Fatal("Unable to load operation name rules", zap.Error(err))
+		}
+		builderOpts = append(builderOpts, basicB.Options.OperationNameRuleOption(rules))
+	}
+	if *builder.SamplingRulesFile != "" {
+		rules, err := loadSamplingRules(*builder.SamplingRulesFile)
+		if err != nil {
+			logger.Fatal("Unable to load sampling rules", zap.Error(err))
+		}
+		builderOpts = append(builderOpts, basicB.Options.SamplingRuleOption(rules))
+	}
+	if *builder.CompositeSamplingFile != "" {
+		config, err := loadCompositeSamplingConfig(*builder.CompositeSamplingFile)
+		if err != nil {
+			logger.Fatal("Unable to load composite sampling config", zap.Error(err))
+		}
+		builderOpts = append(builderOpts, basicB.Options.CompositeSamplingOption(config))
+		if *builder.SamplingDecisionCacheSize > 0 {
+			builderOpts = append(builderOpts, basicB.Options.SamplingDecisionCacheOption(
+				*builder.SamplingDecisionCacheSize, *builder.SamplingDecisionCacheTTL))
+		}
+	}
+	if *builder.DropRulesFile != "" {
+		rules, err := loadDropRules(*builder.DropRulesFile)
+		if err != nil {
+			logger.Fatal("Unable to load drop rules", zap.Error(err))
+		}
+		builderOpts = append(builderOpts, basicB.Options.DropRuleOption(rules))
+	}
+	if *builder.SchemaRulesFile != "" {
+		rules, err := loadSchemaRules(*builder.SchemaRulesFile)
+		if err != nil {
+			logger.Fatal("Unable to load schema rules", zap.Error(err))
+		}
+		mode, err := app.ParseSchemaViolationMode(*builder.SchemaViolationMode)
+		if err != nil {
+			logger.Fatal("Invalid schema violation mode", zap.Error(err))
+		}
+		builderOpts = append(builderOpts, basicB.Options.SpanSchemaOption(rules, mode))
+	}
+	if *builder.RateLimitsFile != "" {
+		limits, err := loadRateLimits(*builder.RateLimitsFile)
+		if err != nil {
+			logger.Fatal("Unable to load rate limits", zap.Error(err))
+		}
+		builderOpts = append(builderOpts, basicB.Options.RateLimitOption(limits.Default, limits.Services))
+	}
+	if *builder.SpanQuotasFile != "" {
+		quotas, err := loadSpanQuotas(*builder.SpanQuotasFile)
+		if err != nil {
+			logger.Fatal("Unable to load span quotas", zap.Error(err))
+		}
+		mode, err := app.ParseSpanQuotaMode(*builder.SpanQuotasMode)
+		if err != nil {
+			logger.Fatal("Invalid span quota mode", zap.Error(err))
+		}
+		resetTime, err := parseTimeOfDay(*builder.SpanQuotasResetTime)
+		if err != nil {
+			logger.Fatal("Invalid span quota reset time", zap.Error(err))
+		}
+		builderOpts = append(builderOpts, basicB.Options.SpanQuotaOption(app.SpanQuotaOptions{
+			Quotas:     quotas,
+			Mode:       mode,
+			SampleRate: *builder.SpanQuotasSampleRate,
+			ResetTime:  resetTime,
+		}))
+	}
+	if *builder.ProcessCompactionEnabled {
+		builderOpts = append(builderOpts, basicB.Options.ProcessCompactionOption(*builder.ProcessCompactionMaxProcesses))
+	}
+	if *builder.FutureSpanTolerance > 0 {
+		mode, err := app.ParseFutureSpanMode(*builder.FutureSpanMode)
+		if err != nil {
+			logger.Fatal("Invalid future span mode", zap.Error(err))
+		}
+		builderOpts = append(builderOpts, basicB.Options.FutureSpanOption(app.FutureSpanOptions{
+			Tolerance: *builder.FutureSpanTolerance,
+			Mode:      mode,
+		}))
+	}
+	if *builder.SpanIDCollisionMode != "" {
+		mode, err := app.ParseSpanIDCollisionMode(*builder.SpanIDCollisionMode)
+		if err != nil {
+			logger.Fatal("Invalid span ID collision mode", zap.Error(err))
+		}
+		builderOpts = append(builderOpts, basicB.Options.SpanIDCollisionOption(app.SpanIDCollisionOptions{
+			WindowSize: *builder.SpanIDCollisionWindow,
+			Mode:       mode,
+		}))
+	}
+	if *builder.MaxBatchSpans > 0 {
+		policy, err := app.ParseBatchSizePolicy(*builder.MaxBatchSpansPolicy)
+		if err != nil {
+			logger.Fatal("Invalid batch size policy", zap.Error(err))
+		}
+		builderOpts = append(builderOpts, basicB.Options.BatchSizeOption(*builder.MaxBatchSpans, policy))
+	}
+	if *builder.AuthTokensFile != "" || *builder.AuthClientCertificates {
+		var tokenValidator app.TokenValidator
+		if *builder.AuthTokensFile != "" {
+			tokens, err := loadTokens(*builder.AuthTokensFile)
+			if err != nil {
+				logger.Fatal("Unable to load auth tokens", zap.Error(err))
+			}
+			tokenValidator = app.NewStaticTokenValidator(tokens)
+		}
+		builderOpts = append(builderOpts, basicB.Options.AuthOption(tokenValidator, *builder.AuthClientCertificates))
+	}
+	if *builder.PrometheusEnabled {
+		buckets, err := jmetrics.ParseBuckets(*builder.PrometheusBuckets)
+		if err != nil {
+			logger.Fatal("Invalid Prometheus histogram buckets", zap.Error(err))
+		}
+		builderOpts = append(builderOpts, basicB.Options.PrometheusOption(serviceName, buckets))
+	}
+	if *builder.AdaptiveSamplingEnabled {
+		builderOpts = append(builderOpts, basicB.Options.AdaptiveSamplingOption(
+			*builder.AdaptiveSamplingTargetSpansPerSecond,
+			*builder.AdaptiveSamplingCalculationInterval,
+		))
+	}
+	if *builder.SamplingStrategiesFile != "" {
+		builderOpts = append(builderOpts, basicB.Options.StaticSamplingOption(
+			*builder.SamplingStrategiesFile,
+			*builder.SamplingStrategiesReloadInterval,
+		))
+	}
+	spanBuilder, err := builder.NewSpanHandlerBuilder(builderOpts...)
 	if err != nil {
 		logger.Fatal("Unable to set up builder", zap.Error(err))
 	}
@@ -74,6 +423,9 @@ func main() {
 	server := thrift.NewServer(ch)
 	server.Register(jc.NewTChanCollectorServer(jaegerBatchesHandler))
 	server.Register(zc.NewTChanZipkinCollectorServer(zipkinSpansHandler))
+	if samplingManager := spanBuilder.SamplingManager(); samplingManager != nil {
+		server.Register(sc.NewTChanSamplingManagerServer(samplingManager))
+	}
 
 	portStr := ":" + strconv.Itoa(*builder.CollectorPort)
 	listener, err := net.Listen("tcp", portStr)
@@ -82,13 +434,402 @@ func main() {
 	}
 	ch.Serve(listener)
 
+	// the servers are stopped on shutdown before the queued spans are drained
+	var grpcServers []*grpc.Server
+	var httpServers []*http.Server
+	if grpcHandler := spanBuilder.GRPCHandler(); grpcHandler != nil {
+		grpcPortStr := ":" + strconv.Itoa(*builder.CollectorGRPCPort)
+		grpcListener, err := net.Listen("tcp", grpcPortStr)
+		if err != nil {
+			logger.Fatal("Unable to start listening on gRPC port", zap.Error(err))
+		}
+		grpcServer := app.NewGRPCServer(grpcHandler, spanBuilder.GRPCServerOptions()...)
+		grpcServers = append(grpcServers, grpcServer)
+		logger.Info("Listening for gRPC traffic", zap.Int("grpc-port", *builder.CollectorGRPCPort))
+		go func() {
+			if err := grpcServer.Serve(grpcListener); err != nil {
+				logger.Fatal("Could not launch gRPC service", zap.Error(err))
+			}
+		}()
+	}
+
+	if ocReceiver := spanBuilder.OpenCensusReceiver(); ocReceiver != nil {
+		ocPortStr := ":" + strconv.Itoa(*builder.CollectorOpenCensusPort)
+		ocListener, err := net.Listen("tcp", ocPortStr)
+		if err != nil {
+			logger.Fatal("Unable to start listening on OpenCensus port", zap.Error(err))
+		}
+		ocServer := app.NewOpenCensusServer(ocReceiver, spanBuilder.GRPCServerOptions()...)
+		grpcServers = append(grpcServers, ocServer)
+		logger.Info("Listening for OpenCensus traffic", zap.Int("opencensus-port", *builder.CollectorOpenCensusPort))
+		go func() {
+			if err := ocServer.Serve(ocListener); err != nil {
+				logger.Fatal("Could not launch OpenCensus service", zap.Error(err))
+			}
+		}()
+	}
+
+	if otlpReceiver := spanBuilder.OTLPReceiver(); otlpReceiver != nil {
+		otlpRouter := mux.NewRouter()
+		otlpReceiver.RegisterRoutes(otlpRouter)
+		otlpServer := &http.Server{
+			Addr:    ":" + strconv.Itoa(*builder.CollectorOTLPHTTPPort),
+			Handler: recoveryhandler.NewRecoveryHandler(logger, true)(otlpRouter),
+		}
+		httpServers = append(httpServers, otlpServer)
+		otlpListener, err := listenHTTP(otlpServer.Addr, spanBuilder.TLSConfig())
+		if err != nil {
+			logger.Fatal("Unable to start listening on OTLP port", zap.Error(err))
+		}
+		logger.Info("Listening for OTLP traffic", zap.Int("otlp-http-port", *builder.CollectorOTLPHTTPPort))
+		go func() {
+			if err := otlpServer.Serve(otlpListener); err != nil && err != http.ErrServerClosed {
+				logger.Fatal("Could not launch OTLP service", zap.Error(err))
+			}
+		}()
+	}
+
 	r := mux.NewRouter()
-	apiHandler := app.NewAPIHandler(jaegerBatchesHandler, zipkinSpansHandler)
+	apiHandler := app.NewAPIHandler(
+		jaegerBatchesHandler,
+		zipkinSpansHandler,
+		app.APIHandlerOptions.ZipkinPath(*builder.CollectorZipkinHTTPPath),
+		app.APIHandlerOptions.JSONPath(*builder.CollectorJSONHTTPPath),
+		app.APIHandlerOptions.MaxDecompressedSize(*builder.CollectorHTTPMaxDecompressedSize),
+		app.APIHandlerOptions.MetricsFactory(baseMetrics),
+		app.APIHandlerOptions.TenantHeader(*builder.TenancyHeader),
+	)
 	apiHandler.RegisterRoutes(r)
+	if healthCheck := spanBuilder.HealthCheck(); healthCheck != nil {
+		r.Handle("/health", healthCheck)
+	}
+	if metricsHandler := spanBuilder.MetricsHandler(); metricsHandler != nil {
+		r.Handle(*builder.PrometheusHTTPPath, metricsHandler)
+	}
 	httpPortStr := ":" + strconv.Itoa(*builder.CollectorHTTPPort)
 	recoveryHandler := recoveryhandler.NewRecoveryHandler(logger, true)
+	httpServer := &http.Server{Addr: httpPortStr, Handler: recoveryHandler(r)}
+	httpServers = append(httpServers, httpServer)
+	httpListener, err := listenHTTP(httpPortStr, spanBuilder.TLSConfig())
+	if err != nil {
+		logger.Fatal("Unable to start listening on HTTP port", zap.Error(err))
+	}
 	logger.Info("Listening for HTTP traffic", zap.Int("http-port", *builder.CollectorHTTPPort))
-	if err := http.ListenAndServe(httpPortStr, recoveryHandler(r)); err != nil {
-		logger.Fatal("Could not launch service", zap.Error(err))
+	go func() {
+		if err := httpServer.Serve(httpListener); err != nil && err != http.ErrServerClosed {
+			logger.Fatal("Could not launch service", zap.Error(err))
+		}
+	}()
+
+	// the debug endpoints expose the contents of the spans or change how they are saved, they are kept off
+	// the ingestion ports
+	adminRouter := mux.NewRouter()
+	serveAdmin := false
+	if droppedSpans := spanBuilder.DroppedSpans(); droppedSpans != nil {
+		adminRouter.Handle("/debug/dropped-spans", droppedSpans).Methods(http.MethodGet)
+		serveAdmin = true
+	}
+	if workerPool := spanBuilder.WorkerPool(); workerPool != nil {
+		adminRouter.Handle("/debug/workers", workerPool).Methods(http.MethodGet, http.MethodPut)
+		serveAdmin = true
+	}
+	if serveAdmin {
+		adminServer := &http.Server{Addr: *builder.CollectorAdminHTTPHostPort, Handler: recoveryHandler(adminRouter)}
+		httpServers = append(httpServers, adminServer)
+		adminListener, err := net.Listen("tcp", adminServer.Addr)
+		if err != nil {
+			logger.Fatal("Unable to start listening on admin HTTP port", zap.Error(err))
+		}
+		logger.Info("Listening for admin HTTP traffic", zap.String("admin-http-host-port", adminServer.Addr))
+		go func() {
+			if err := adminServer.Serve(adminListener); err != nil && err != http.ErrServerClosed {
+				logger.Fatal("Could not launch admin service", zap.Error(err))
+			}
+		}()
+	}
+
+	reloader := &reloader{logger: logger}
+	if rateLimiter := spanBuilder.RateLimiter(); rateLimiter != nil {
+		reloader.register("rate limits", *builder.RateLimitsFile, func() error {
+			limits, err := loadRateLimits(*builder.RateLimitsFile)
+			if err == nil {
+				rateLimiter.Update(limits)
+			}
+			return err
+		})
+	}
+	if quotaEnforcer := spanBuilder.SpanQuotaEnforcer(); quotaEnforcer != nil {
+		reloader.register("span quotas", *builder.SpanQuotasFile, func() error {
+			quotas, err := loadSpanQuotas(*builder.SpanQuotasFile)
+			if err == nil {
+				quotaEnforcer.Update(quotas)
+			}
+			return err
+		})
+	}
+	if serviceRemapper := spanBuilder.ServiceNameRemapper(); serviceRemapper != nil {
+		reloader.register("service aliases", *builder.ServiceAliasesFile, func() error {
+			aliases, err := loadServiceAliases(*builder.ServiceAliasesFile)
+			if err == nil {
+				serviceRemapper.Update(aliases)
+			}
+			return err
+		})
+	}
+	if tagNormalizer := spanBuilder.TagNormalizer(); tagNormalizer != nil {
+		reloader.register("tag mappings", *builder.TagMappingsFile, func() error {
+			mappings, err := loadTagMappings(*builder.TagMappingsFile)
+			if err == nil {
+				tagNormalizer.Update(mappings)
+			}
+			return err
+		})
+	}
+	if httpStatusNormalizer := spanBuilder.HTTPStatusNormalizer(); httpStatusNormalizer != nil {
+		reloader.register("HTTP status rules", *builder.HTTPStatusRulesFile, func() error {
+			rules, err := loadHTTPStatusRules(*builder.HTTPStatusRulesFile)
+			if err == nil {
+				httpStatusNormalizer.Update(rules)
+			}
+			return err
+		})
+	}
+	if operationNameRewriter := spanBuilder.OperationNameRewriter(); operationNameRewriter != nil {
+		reloader.register("operation name rules", *builder.OperationNameRulesFile, func() error {
+			rules, err := loadOperationNameRules(*builder.OperationNameRulesFile)
+			if err != nil {
+				return err
+			}
+			return operationNameRewriter.Update(rules)
+		})
+	}
+	if ruleSampler := spanBuilder.RuleSampler(); ruleSampler != nil {
+		reloader.register("sampling rules", *builder.SamplingRulesFile, func() error {
+			rules, err := loadSamplingRules(*builder.SamplingRulesFile)
+			if err != nil {
+				return err
+			}
+			return ruleSampler.Update(rules)
+		})
+	}
+	if compositeSampler := spanBuilder.CompositeSampler(); compositeSampler != nil {
+		reloader.register("composite sampling config", *builder.CompositeSamplingFile, func() error {
+			config, err := loadCompositeSamplingConfig(*builder.CompositeSamplingFile)
+			if err != nil {
+				return err
+			}
+			return compositeSampler.Update(config)
+		})
+	}
+	if spanDropper := spanBuilder.SpanDropper(); spanDropper != nil {
+		reloader.register("drop rules", *builder.DropRulesFile, func() error {
+			rules, err := loadDropRules(*builder.DropRulesFile)
+			if err != nil {
+				return err
+			}
+			return spanDropper.Update(rules)
+		})
+	}
+	if schemaValidator := spanBuilder.SpanSchemaValidator(); schemaValidator != nil {
+		reloader.register("schema rules", *builder.SchemaRulesFile, func() error {
+			rules, err := loadSchemaRules(*builder.SchemaRulesFile)
+			if err != nil {
+				return err
+			}
+			return schemaValidator.Update(rules)
+		})
+	}
+	reloader.start()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+	logger.Info("Shutting down, draining queued spans", zap.Duration("timeout", *builder.CollectorShutdownTimeout))
+	ctx, cancel := context.WithTimeout(context.Background(), *builder.CollectorShutdownTimeout)
+	defer cancel()
+	// no span is accepted past this point, so that the drained queue is not filled again
+	ch.Close()
+	for _, grpcServer := range grpcServers {
+		grpcServer.GracefulStop()
+	}
+	for _, httpServer := range httpServers {
+		if err := httpServer.Shutdown(ctx); err != nil {
+			logger.Error("Failed to shut down HTTP server", zap.Error(err))
+		}
+	}
+	dropped, err := spanBuilder.Close(ctx)
+	if err != nil {
+		logger.Error("Failed to close span storage", zap.Error(err))
+	}
+	logger.Info("Shut down", zap.Int("dropped-spans", dropped))
+}
+
+// reloader reloads the files of the collector's components on SIGHUP
+type reloader struct {
+	logger  *zap.Logger
+	reloads []reload
+}
+
+type reload struct {
+	name string
+	file string
+	load func() error
+}
+
+// register adds a component whose configuration is read from file again by load on SIGHUP
+func (r *reloader) register(name, file string, load func() error) {
+	r.reloads = append(r.reloads, reload{name: name, file: file, load: load})
+}
+
+// start reloads all registered components from a single handler of SIGHUP, if any was registered
+func (r *reloader) start() {
+	if len(r.reloads) == 0 {
+		return
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			for _, reload := range r.reloads {
+				if err := reload.load(); err != nil {
+					r.logger.Error("Unable to reload "+reload.name, zap.String("file", reload.file), zap.Error(err))
+					continue
+				}
+				r.logger.Info("Reloaded "+reload.name, zap.String("file", reload.file))
+			}
+		}
+	}()
+}
+
+func splitList(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
+
+func loadRateLimits(path string) (app.RateLimits, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return app.RateLimits{}, err
+	}
+	defer file.Close()
+	return app.LoadRateLimits(file)
+}
+
+func loadSpanQuotas(path string) (app.SpanQuotas, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return app.SpanQuotas{}, err
+	}
+	defer file.Close()
+	return app.LoadSpanQuotas(file)
+}
+
+// parseTimeOfDay returns the time since midnight of a time of day formatted as HH:MM
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func loadTokens(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return app.LoadTokens(file)
+}
+
+// tailSampler returns the TailSampler recording the decisions of the tail sampling configured by the flags,
+// or nil if the spans are not tail sampled
+func tailSampler() app.TailSampler {
+	if *builder.TailSamplingWindow <= 0 || *builder.TailSamplingDurationThreshold <= 0 {
+		return nil
+	}
+	return app.NewDurationTailSampler(*builder.TailSamplingDurationThreshold)
+}
+
+// listenHTTP listens on the address, over TLS with the configuration unless it is nil
+func listenHTTP(addr string, tlsConfig *tls.Config) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil || tlsConfig == nil {
+		return listener, err
+	}
+	return tls.NewListener(listener, tlsConfig), nil
+}
+
+func loadOperationNameRules(path string) (app.OperationNameRules, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return app.LoadOperationNameRules(file)
+}
+
+func loadSamplingRules(path string) (app.SamplingRules, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return app.LoadSamplingRules(file)
+}
+
+func loadCompositeSamplingConfig(path string) (app.CompositeSamplingConfig, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return app.CompositeSamplingConfig{}, err
+	}
+	defer file.Close()
+	return app.LoadCompositeSamplingConfig(file)
+}
+
+func loadDropRules(path string) (app.DropRules, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return app.LoadDropRules(file)
+}
+
+func loadSchemaRules(path string) (app.SchemaRules, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return app.LoadSchemaRules(file)
+}
+
+func loadServiceAliases(path string) (app.ServiceAliases, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return app.LoadServiceAliases(file)
+}
+
+func loadTagMappings(path string) (app.TagMappings, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return app.TagMappings{}, err
+	}
+	defer file.Close()
+	return app.LoadTagMappings(file)
+}
+
+func loadHTTPStatusRules(path string) (app.HTTPStatusRules, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return app.HTTPStatusRules{}, err
 	}
+	defer file.Close()
+	return app.LoadHTTPStatusRules(file)
 }
@@ -22,7 +22,10 @@ package cassandra
 
 import (
 	"flag"
+	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/uber/jaeger/pkg/cassandra/config"
 )
@@ -51,10 +54,13 @@ func NewOptions() *Options {
 	return &Options{
 		primary: &namespaceConfig{
 			Configuration: config.Configuration{
-				MaxRetryAttempts:   3,
-				Keyspace:           "jaeger_v1_local",
-				ProtoVersion:       4,
-				ConnectionsPerHost: 2,
+				MaxRetryAttempts:     3,
+				Keyspace:             "jaeger_v1_local",
+				ProtoVersion:         4,
+				ConnectionsPerHost:   2,
+				MaxWriteAttempts:     3,
+				WriteRetryBackoff:    100 * time.Millisecond,
+				WriteRetryMaxBackoff: 2 * time.Second,
 			},
 			servers: "127.0.0.1",
 		},
@@ -147,4 +153,149 @@ func bind(
 		namespace+".socket-keep-alive",
 		defaults.SocketKeepAlive,
 		"Cassandra's keepalive period to use, enabled if > 0")
+	flags.IntVar(
+		&cfg.MaxWriteAttempts,
+		namespace+".max-write-attempts",
+		defaults.MaxWriteAttempts,
+		"The number of attempts when writing to Cassandra fails with a timeout or an unavailable host")
+	flags.DurationVar(
+		&cfg.WriteRetryBackoff,
+		namespace+".write-retry-backoff",
+		defaults.WriteRetryBackoff,
+		"The delay before retrying a failed write, doubled on every further attempt")
+	flags.DurationVar(
+		&cfg.WriteRetryMaxBackoff,
+		namespace+".write-retry-max-backoff",
+		defaults.WriteRetryMaxBackoff,
+		"The maximum delay between two attempts of a failed write")
+	flags.StringVar(
+		&cfg.SpanCompression,
+		namespace+".span-compression",
+		defaults.SpanCompression,
+		"The compression of span tags and logs before they are stored, one of [none, gzip, zstd]")
+	flags.StringVar(
+		&cfg.ShardingScheme,
+		namespace+".sharding-scheme",
+		defaults.ShardingScheme,
+		"Makes each of the servers a separate shard storing whole traces, picked with one of [modulo, rendezvous]")
+	flags.IntVar(
+		&cfg.SpanBucketThreshold,
+		namespace+".span-bucket-threshold",
+		defaults.SpanBucketThreshold,
+		"The number of spans of a trace after which its further spans are spread across buckets of as many spans, never bucketed when zero")
+	flags.Var(
+		(*stringList)(&cfg.PromotedTags),
+		namespace+".promoted-tags",
+		"Comma-separated keys of the tags indexed in buckets by service and value, e.g. request.id, so that frequent values do not make hot partitions")
+	flags.DurationVar(
+		&cfg.SpanTTL,
+		namespace+".span-ttl",
+		defaults.SpanTTL,
+		"How long spans of services without a TTL in span-service-ttls are kept for, the TTL of the tables applying when zero")
+	flags.Var(
+		(*durationMap)(&cfg.ServiceSpanTTLs),
+		namespace+".span-service-ttls",
+		"How long spans of each service are kept for, as comma-separated service=duration pairs, e.g. security=2160h,dev=72h")
+	flags.DurationVar(
+		&cfg.MaxSpanTTL,
+		namespace+".max-span-ttl",
+		defaults.MaxSpanTTL,
+		"The maximum span TTL allowed, unlimited when zero")
+	flags.DurationVar(
+		&cfg.ErrorSpanTTL,
+		namespace+".error-span-ttl",
+		defaults.ErrorSpanTTL,
+		"How long traces with a span tagged error=true are kept for when longer than the TTL of their services, disabled when zero")
+	flags.DurationVar(
+		&cfg.ErrorTraceWindow,
+		namespace+".error-trace-window",
+		defaults.ErrorTraceWindow,
+		"How long the written spans of a trace are remembered, to be rewritten with error-span-ttl if the trace has an error span, 5s when zero")
+	flags.StringVar(
+		&cfg.Consistency,
+		namespace+".consistency",
+		defaults.Consistency,
+		"The default consistency level of queries, LOCAL_ONE when empty")
+	flags.StringVar(
+		&cfg.ReadConsistency,
+		namespace+".read-consistency",
+		defaults.ReadConsistency,
+		"The consistency level of queries reading spans and dependencies, ONE when empty")
+	flags.StringVar(
+		&cfg.WriteConsistency,
+		namespace+".write-consistency",
+		defaults.WriteConsistency,
+		"The consistency level of queries writing spans, the default consistency level when empty")
+	flags.StringVar(
+		&cfg.LoadSheddingWriteConsistency,
+		namespace+".load-shedding-write-consistency",
+		defaults.LoadSheddingWriteConsistency,
+		"The consistency level of writes for load-shedding-period after Cassandra timed out or was unavailable, never lowered when empty")
+	flags.DurationVar(
+		&cfg.LoadSheddingPeriod,
+		namespace+".load-shedding-period",
+		defaults.LoadSheddingPeriod,
+		"How long writes use load-shedding-write-consistency after Cassandra timed out or was unavailable, one minute when zero")
+	flags.StringVar(
+		&cfg.LoadBalancingPolicy,
+		namespace+".load-balancing-policy",
+		defaults.LoadBalancingPolicy,
+		"The policy picking the hosts of queries, one of [round-robin, dc-aware], round-robin when empty; dc-aware prefers the hosts of local-dc")
+	flags.StringVar(
+		&cfg.LocalDC,
+		namespace+".local-dc",
+		defaults.LocalDC,
+		"The name of the local datacenter, whose hosts the dc-aware load balancing policy prefers")
+	flags.BoolVar(
+		&cfg.SchemaAutoMigrate,
+		namespace+".schema.auto-migrate",
+		defaults.SchemaAutoMigrate,
+		"Upgrades the schema of the keyspace when it is older than the one expected, instead of refusing to start")
+}
+
+// stringList is a flag.Value parsing a comma-separated list, ignoring the empty items
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*l = items
+	return nil
+}
+
+// durationMap is a flag.Value parsing comma-separated key=duration pairs into a map
+type durationMap map[string]time.Duration
+
+func (m *durationMap) String() string {
+	pairs := make([]string, 0, len(*m))
+	for key, duration := range *m {
+		pairs = append(pairs, key+"="+duration.String())
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m *durationMap) Set(value string) error {
+	durations := make(map[string]time.Duration)
+	for _, pair := range strings.Split(value, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("Expected key=duration, found %q", pair)
+		}
+		duration, err := time.ParseDuration(kv[1])
+		if err != nil {
+			return err
+		}
+		durations[kv[0]] = duration
+	}
+	*m = durations
+	return nil
 }
@@ -22,6 +22,7 @@ package cassandra
 
 import (
 	"flag"
+	"io/ioutil"
 	"testing"
 	"time"
 
@@ -54,6 +55,26 @@ func TestOptionsWithFlags(t *testing.T) {
 		"-cas.port=4242",
 		"-cas.proto-version=3",
 		"-cas.socket-keep-alive=42s",
+		"-cas.max-write-attempts=5",
+		"-cas.write-retry-backoff=42ms",
+		"-cas.write-retry-max-backoff=4s",
+		"-cas.span-compression=zstd",
+		"-cas.sharding-scheme=rendezvous",
+		"-cas.span-bucket-threshold=1000",
+		"-cas.promoted-tags=request.id, user.id",
+		"-cas.span-ttl=72h",
+		"-cas.span-service-ttls=security=2160h,payments=720h",
+		"-cas.max-span-ttl=2160h",
+		"-cas.error-span-ttl=720h",
+		"-cas.error-trace-window=10s",
+		"-cas.consistency=LOCAL_QUORUM",
+		"-cas.read-consistency=ONE",
+		"-cas.write-consistency=QUORUM",
+		"-cas.load-shedding-write-consistency=LOCAL_ONE",
+		"-cas.load-shedding-period=5m",
+		"-cas.load-balancing-policy=dc-aware",
+		"-cas.local-dc=us-east",
+		"-cas.schema.auto-migrate=true",
 		// a couple overrides
 		"-cas.aux.keyspace=jaeger-archive",
 		"-cas.aux.servers=3.3.3.3,4.4.4.4",
@@ -72,4 +93,44 @@ func TestOptionsWithFlags(t *testing.T) {
 	assert.Equal(t, 4242, aux.Port)
 	assert.Equal(t, 3, aux.ProtoVersion)
 	assert.Equal(t, 42*time.Second, aux.SocketKeepAlive)
+	assert.Equal(t, 5, aux.MaxWriteAttempts)
+	assert.Equal(t, 42*time.Millisecond, aux.WriteRetryBackoff)
+	assert.Equal(t, 4*time.Second, aux.WriteRetryMaxBackoff)
+	assert.Equal(t, "zstd", aux.SpanCompression)
+	assert.Equal(t, "rendezvous", aux.ShardingScheme)
+	assert.Equal(t, 1000, aux.SpanBucketThreshold)
+	assert.Equal(t, []string{"request.id", "user.id"}, aux.PromotedTags)
+	assert.Equal(t, 72*time.Hour, aux.SpanTTL)
+	assert.Equal(t, map[string]time.Duration{"security": 2160 * time.Hour, "payments": 720 * time.Hour}, aux.ServiceSpanTTLs)
+	assert.Equal(t, 2160*time.Hour, aux.MaxSpanTTL)
+	assert.Equal(t, 720*time.Hour, aux.ErrorSpanTTL)
+	assert.Equal(t, 10*time.Second, aux.ErrorTraceWindow)
+	assert.Equal(t, "LOCAL_QUORUM", aux.Consistency)
+	assert.Equal(t, "ONE", aux.ReadConsistency)
+	assert.Equal(t, "QUORUM", aux.WriteConsistency)
+	assert.Equal(t, "LOCAL_ONE", aux.LoadSheddingWriteConsistency)
+	assert.Equal(t, 5*time.Minute, aux.LoadSheddingPeriod)
+	assert.Equal(t, "dc-aware", aux.LoadBalancingPolicy)
+	assert.Equal(t, "us-east", aux.LocalDC)
+	assert.True(t, aux.SchemaAutoMigrate)
+
+	shards := primary.Shards()
+	if assert.Len(t, shards, 2) {
+		assert.Equal(t, []string{"2.2.2.2"}, shards[1].Servers)
+		assert.Equal(t, "jaeger", shards[1].Keyspace)
+	}
+}
+
+func TestOptionsSpanServiceTTLs(t *testing.T) {
+	opts := NewOptions()
+	primary := opts.GetPrimary()
+	assert.Nil(t, primary.ServiceSpanTTLs)
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	opts.Bind(flags, "cas")
+	assert.Error(t, flags.Parse([]string{"-cas.span-service-ttls=security"}))
+	assert.Error(t, flags.Parse([]string{"-cas.span-service-ttls=security=90days"}))
+	assert.NoError(t, flags.Parse([]string{"-cas.span-service-ttls=security=2160h,dev=1h"}))
+	assert.Equal(t, "dev=1h0m0s,security=2160h0m0s", flags.Lookup("cas.span-service-ttls").Value.String())
 }
@@ -0,0 +1,72 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package es
+
+import (
+	"flag"
+	"strings"
+	"time"
+
+	"github.com/uber/jaeger/pkg/es/config"
+)
+
+// Options is an ElasticSearch configuration bound to the command line flags prefixed with a namespace
+type Options struct {
+	configuration config.Configuration
+	// servers is parsed into the Servers list of the configuration
+	servers *string
+	// replicas is the IndexReplicas of the configuration, the ElasticSearch default if negative
+	replicas *int
+}
+
+// NewOptions defines the flags of an ElasticSearch configuration prefixed with the namespace, usage completing
+// their help, e.g. "read from" in "The comma-separated ElasticSearch servers the spans are read from"
+func NewOptions(flags *flag.FlagSet, namespace, usage string) *Options {
+	opt := &Options{}
+	cfg := &opt.configuration
+	opt.servers = flags.String(namespace+".server-urls", "http://127.0.0.1:9200", "The comma-separated ElasticSearch servers the spans are "+usage)
+	flags.StringVar(&cfg.Username, namespace+".username", "", "The username of the ElasticSearch servers the spans are "+usage)
+	flags.StringVar(&cfg.Password, namespace+".password", "", "The password of the ElasticSearch servers the spans are "+usage)
+	flags.StringVar((*string)(&cfg.AuthType), namespace+".auth-type", "", "The credentials sent to the ElasticSearch servers the spans are "+usage+": basic, api-key or bearer, inferred from the credentials configured if empty")
+	flags.StringVar(&cfg.APIKey, namespace+".api-key", "", "The base64-encoded API key of the ElasticSearch servers the spans are "+usage)
+	flags.StringVar(&cfg.BearerToken, namespace+".bearer-token", "", "The bearer token of the ElasticSearch servers the spans are "+usage)
+	flags.StringVar(&cfg.IndexTemplate, namespace+".index-template", "", "The naming of the ElasticSearch span indices the spans are "+usage+", the daily jaeger-{date} indices if empty")
+	flags.StringVar(&cfg.IndexRefreshInterval, namespace+".index.refresh-interval", "", "How often the ElasticSearch span indices created make the spans "+usage+" searchable, e.g. 30s, or -1 to disable the refreshes. The ElasticSearch default if empty")
+	flags.IntVar(&cfg.IndexShards, namespace+".index.shards", 0, "The number of primary shards of the ElasticSearch span indices created, the ElasticSearch default if 0")
+	opt.replicas = flags.Int(namespace+".index.replicas", -1, "The number of replicas of each shard of the ElasticSearch span indices created, the ElasticSearch default if negative")
+	flags.DurationVar(&cfg.MaxSpanAge, namespace+".max-span-age", 0, "The maximum age of the spans read from ElasticSearch, unlimited if 0")
+	flags.IntVar(&cfg.BulkSize, namespace+".bulk.size", 0, "The number of buffered spans that triggers an ElasticSearch bulk request, the default of the writer if 0")
+	flags.DurationVar(&cfg.BulkFlushInterval, namespace+".bulk.flush-interval", time.Second, "The maximum time a span stays buffered before the bulk request is sent to ElasticSearch")
+	flags.IntVar(&cfg.BulkMaxRetries, namespace+".bulk.max-retries", 3, "The number of times the spans rejected by an ElasticSearch bulk request are retried, none if 0")
+	flags.DurationVar(&cfg.BulkRetryBackoff, namespace+".bulk.retry-backoff", 100*time.Millisecond, "The time waited before the first retry of an ElasticSearch bulk request, doubled before each next retry")
+	flags.BoolVar(&cfg.SchemaAutoMigrate, namespace+".schema.auto-migrate", false, "Upgrades the schema version of the ElasticSearch span indices the spans are "+usage+" when it is older than the one expected, instead of refusing to start")
+	flags.IntVar(&cfg.MaxIdleConnsPerHost, namespace+".max-idle-conns-per-host", 0, "The number of idle connections kept open to each of the ElasticSearch servers the spans are "+usage+", the net/http default if 0")
+	return opt
+}
+
+// GetConfiguration returns the ElasticSearch configuration once the flags are parsed
+func (opt *Options) GetConfiguration() *config.Configuration {
+	opt.configuration.Servers = strings.Split(*opt.servers, ",")
+	if *opt.replicas >= 0 {
+		opt.configuration.IndexReplicas = opt.replicas
+	}
+	return &opt.configuration
+}
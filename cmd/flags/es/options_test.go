@@ -0,0 +1,64 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package es
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptions(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	opts := NewOptions(flags, "es", "read from")
+	flags.Parse(nil)
+
+	cfg := opts.GetConfiguration()
+	assert.Equal(t, []string{"http://127.0.0.1:9200"}, cfg.Servers)
+	assert.Nil(t, cfg.IndexReplicas)
+	assert.Equal(t, time.Second, cfg.BulkFlushInterval)
+}
+
+func TestOptionsWithFlags(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	opts := NewOptions(flags, "es", "read from")
+	destination := NewOptions(flags, "es.destination", "written to")
+	flags.Parse([]string{
+		"-es.server-urls=http://1.1.1.1:9200,http://2.2.2.2:9200",
+		"-es.username=jaeger",
+		"-es.index-template=jaeger-{service}-{date}",
+		"-es.index.replicas=0",
+		"-es.max-span-age=72h",
+		"-es.destination.server-urls=http://3.3.3.3:9200",
+	})
+
+	cfg := opts.GetConfiguration()
+	assert.Equal(t, []string{"http://1.1.1.1:9200", "http://2.2.2.2:9200"}, cfg.Servers)
+	assert.Equal(t, "jaeger", cfg.Username)
+	assert.Equal(t, "jaeger-{service}-{date}", cfg.IndexTemplate)
+	if assert.NotNil(t, cfg.IndexReplicas) {
+		assert.Equal(t, 0, *cfg.IndexReplicas)
+	}
+	assert.Equal(t, 72*time.Hour, cfg.MaxSpanAge)
+	assert.Equal(t, []string{"http://3.3.3.3:9200"}, destination.GetConfiguration().Servers)
+}
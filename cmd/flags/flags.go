@@ -35,6 +35,12 @@ const (
 	MemoryStorageType = "memory"
 	// ESStorageType is the storage type flag denoting an ElasticSearch backing store
 	ESStorageType = "elasticsearch"
+	// KafkaStorageType is the storage type flag denoting a Kafka topic used for buffered ingestion
+	KafkaStorageType = "kafka"
+	// BadgerStorageType is the storage type flag denoting an embedded BadgerDB store
+	BadgerStorageType = "badger"
+	// PostgresStorageType is the storage type flag denoting a PostgreSQL backing store
+	PostgresStorageType = "postgres"
 )
 
 // ErrUnsupportedStorageType is the error when dealing with an unsupported storage type
@@ -46,6 +52,15 @@ var SpanStorage = spanStorage{}
 // DependencyStorage defines common settings for Dependency Storage.
 var DependencyStorage = dependencyStorage{}
 
+// BadgerStorage defines common settings for the embedded BadgerDB storage.
+var BadgerStorage = badgerStorage{}
+
+// PostgresStorage defines common settings for the PostgreSQL storage.
+var PostgresStorage = postgresStorage{}
+
+// MemoryStorage defines common settings for the in-memory storage.
+var MemoryStorage = memoryStorage{}
+
 type logging struct {
 	Level string
 }
@@ -54,11 +69,48 @@ type spanStorage struct {
 	Type string
 }
 
+// Types returns the storage types listed in the comma-separated Type. The first one is the primary
+// storage, the others only receive best-effort writes.
+func (s spanStorage) Types() []string {
+	var types []string
+	for _, t := range strings.Split(s.Type, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// PrimaryType returns the first storage type listed in Type, which is the only one spans are read from.
+func (s spanStorage) PrimaryType() string {
+	if types := s.Types(); len(types) > 0 {
+		return types[0]
+	}
+	return ""
+}
+
 type dependencyStorage struct {
 	Type          string
 	DataFrequency time.Duration
 }
 
+type badgerStorage struct {
+	Directory          string
+	ValueLogGCInterval time.Duration
+}
+
+type postgresStorage struct {
+	DSN             string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+type memoryStorage struct {
+	MaxTraces    int
+	SnapshotPath string
+}
+
 type cassandraOptions struct {
 	ConnectionsPerHost int
 	MaxRetryAttempts   int
@@ -73,8 +125,19 @@ func (co cassandraOptions) ServerList() []string {
 }
 
 func init() {
-	flag.StringVar(&SpanStorage.Type, "span-storage.type", CassandraStorageType, fmt.Sprintf("The type of span storage backend to use, options are currently [%v,%v]", CassandraStorageType, MemoryStorageType))
+	flag.StringVar(&SpanStorage.Type, "span-storage.type", CassandraStorageType, fmt.Sprintf("The comma-separated types of span storage backends to use, the first one is primary and the others receive best-effort writes. Options are currently [%v,%v,%v,%v,%v,%v]", CassandraStorageType, MemoryStorageType, ESStorageType, KafkaStorageType, BadgerStorageType, PostgresStorageType))
 
 	flag.StringVar(&DependencyStorage.Type, "dependency-storage.type", CassandraStorageType, fmt.Sprintf("The type of dependency storage backend to use, options are currently [%v,%v]", CassandraStorageType, MemoryStorageType))
 	flag.DurationVar(&DependencyStorage.DataFrequency, "dependency-storage.data-frequency", time.Hour*24, "Frequency of service dependency calculations")
+
+	flag.StringVar(&BadgerStorage.Directory, "badger.directory", "/tmp/jaeger-badger", "The directory where BadgerDB stores its data")
+	flag.DurationVar(&BadgerStorage.ValueLogGCInterval, "badger.value-log-gc-interval", time.Minute*5, "How often to garbage collect the BadgerDB value log, disabled if 0")
+
+	flag.StringVar(&PostgresStorage.DSN, "postgres.dsn", "postgres://127.0.0.1:5432/jaeger?sslmode=disable", "The PostgreSQL connection string, the schema is created or upgraded on startup")
+	flag.IntVar(&PostgresStorage.MaxOpenConns, "postgres.max-open-conns", 10, "The maximum number of open connections to PostgreSQL, unlimited if 0")
+	flag.IntVar(&PostgresStorage.MaxIdleConns, "postgres.max-idle-conns", 2, "The maximum number of idle connections to PostgreSQL kept in the pool")
+	flag.DurationVar(&PostgresStorage.ConnMaxLifetime, "postgres.conn-max-lifetime", 0, "How long PostgreSQL connections are reused before being closed, forever if 0")
+
+	flag.IntVar(&MemoryStorage.MaxTraces, "memory.max-traces", 0, "The maximum number of traces kept by the in-memory storage, the least recently written are evicted beyond it. Unbounded if 0")
+	flag.StringVar(&MemoryStorage.SnapshotPath, "memory.snapshot-path", "", "The file the in-memory storage writes its traces to on shutdown and loads them from on startup. Disabled if empty")
 }
@@ -21,6 +21,8 @@
 package app
 
 import (
+	"time"
+
 	"github.com/uber/jaeger/model/adjuster"
 )
 
@@ -32,3 +34,25 @@ var StandardAdjusters = []adjuster.Adjuster{
 	adjuster.IPTagAdjuster(),
 	adjuster.SortLogFields(),
 }
+
+// NewAdjusters returns the StandardAdjusters, repairing the orphan spans of the traces as given.
+// Orphans are repaired once the span IDs are deduped and before the clock skew is adjusted,
+// which relies on the parent of each span. The clock skew adjustment is bounded by
+// maxClockSkewAdjustment, unless 0, or skipped if clockSkew is false.
+func NewAdjusters(
+	orphanSpans adjuster.OrphanSpanRepair,
+	clockSkew bool,
+	maxClockSkewAdjustment time.Duration,
+) []adjuster.Adjuster {
+	if orphanSpans == adjuster.NoOrphanSpanRepair && clockSkew && maxClockSkewAdjustment == 0 {
+		return StandardAdjusters
+	}
+	adjusters := []adjuster.Adjuster{StandardAdjusters[0]}
+	if orphanSpans != adjuster.NoOrphanSpanRepair {
+		adjusters = append(adjusters, adjuster.OrphanSpans(orphanSpans))
+	}
+	if clockSkew {
+		adjusters = append(adjusters, adjuster.BoundedClockSkew(maxClockSkewAdjustment))
+	}
+	return append(adjusters, StandardAdjusters[2:]...)
+}
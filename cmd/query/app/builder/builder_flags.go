@@ -20,7 +20,12 @@
 
 package builder
 
-import "flag"
+import (
+	"flag"
+	"time"
+
+	"github.com/uber/jaeger/storage/spanstore"
+)
 
 var (
 	// QueryPort is the port that the query service listens in on
@@ -29,4 +34,36 @@ var (
 	QueryPrefix = flag.String("query.prefix", "api", "The prefix for the url of the query service")
 	// QueryStaticAssets is the path for the static assets for the UI (https://github.com/uber/jaeger-ui)
 	QueryStaticAssets = flag.String("query.static-files", "jaeger-ui-build/build/", "The path for the static assets for the UI")
+	// QueryOrphanSpans is how the spans whose parent is missing from the trace are repaired
+	QueryOrphanSpans = flag.String("query.orphan-spans", "none", "How to repair spans whose parent is missing from the trace, one of [none, reparent, placeholder]")
+	// QueryCompleteness enables the completeness hints of the returned traces
+	QueryCompleteness = flag.Bool("query.completeness.enabled", true, "Whether to hint if spans of the returned traces are missing, e.g. because they are still being written")
+	// QueryCompletenessRequireRoot flags the traces without a root span as incomplete
+	QueryCompletenessRequireRoot = flag.Bool("query.completeness.require-root", true, "Whether traces without a root span are incomplete. Disable it if traces legitimately have no root, e.g. asynchronous flows started by a span of an untraced producer")
+	// QueryClockSkew enables the adjustment of the clock skew between the spans of a trace
+	QueryClockSkew = flag.Bool("query.clock-skew.enabled", true, "Whether to adjust the timestamps of the spans starting before or ending after their parent because of unsynchronized clocks, recording the offset in the clock.skew.adjustment tag")
+	// QueryClockSkewMaxAdjustment bounds the adjustment of the clock skew
+	QueryClockSkewMaxAdjustment = flag.Duration("query.clock-skew.max-adjustment", 0, "The maximum clock skew adjustment of a span, larger skews are left as they are with a warning. Unbounded if 0")
+	// QueryTraceIDFormat is how the trace IDs are written in the responses
+	QueryTraceIDFormat = flag.String("query.trace-id-format", "compact", "How the trace IDs are written in the responses: compact (hex without leading zeros), hex (32 zero-padded characters) or decimal. The trace IDs of requests are accepted in all the formats")
+	// QueryDeletion enables the admin endpoint deleting the spans matching tags
+	QueryDeletion = flag.Bool("query.deletion.enabled", false, "Whether to serve the admin endpoint DELETE /<prefix>/admin/spans deleting the spans matching tags within a time range, e.g. to erase the data of a user, on the admin HTTP port")
+	// QueryAdminHTTPHostPort is the address the admin HTTP server listens on
+	QueryAdminHTTPHostPort = flag.String("query.admin-http-host-port", "localhost:16687", "The host:port of the admin HTTP server serving the admin endpoints, only reachable from the host itself by default")
+	// QueryDeletionSpansPerSecond is the rate limit of the deletions
+	QueryDeletionSpansPerSecond = flag.Float64("query.deletion.spans-per-second", 100, "The maximum number of spans deleted per second, so that deletions do not overwhelm the storage. Unbounded if 0")
+	// QueryStats enables the endpoint of the statistics of the spans over a time range
+	QueryStats = flag.Bool("query.stats.enabled", false, "Whether to serve the endpoint GET /<prefix>/stats returning the numbers of traces, spans and error spans that started within a time range, overall and by service")
+	// QueryStatsMaxTraces bounds the scans of the storages without aggregations
+	QueryStatsMaxTraces = flag.Int("query.stats.max-traces", spanstore.DefaultStatsMaxTraces, "The number of traces of each service read to compute the statistics in the storages without aggregations, e.g. Cassandra, the statistics being truncated beyond")
+	// QueryStatsCacheTTL is the time the statistics are cached for
+	QueryStatsCacheTTL = flag.Duration("query.stats.cache-ttl", time.Minute, "The time the statistics of a time range are cached for, so that dashboards do not repeat expensive scans. Not cached if 0")
+	// QueryDurations enables the endpoint of the duration percentiles of the spans of an operation
+	QueryDurations = flag.Bool("query.durations.enabled", false, "Whether to serve the endpoint GET /<prefix>/durations returning the p50, p90 and p99 durations of the spans of an operation that started within a time range")
+	// QueryDurationsMaxTraces bounds the samples of the storages without percentile aggregations
+	QueryDurationsMaxTraces = flag.Int("query.durations.max-traces", spanstore.DefaultDurationMaxTraces, "The number of traces found by the trace search whose spans are sampled to compute the duration percentiles in the storages without percentile aggregations, e.g. Cassandra")
+	// QueryDurationsCacheTTL is the time the duration percentiles are cached for
+	QueryDurationsCacheTTL = flag.Duration("query.durations.cache-ttl", 30*time.Second, "The time the duration percentiles of an operation over a time range are cached for. Not cached if 0")
+	// QueryTenancyHeader is the header carrying the tenant the reads are scoped to
+	QueryTenancyHeader = flag.String("query.tenancy.header", "", "The HTTP header carrying the tenant the reads of a request are scoped to, for the spans stored by collectors with multi-tenancy enabled. Requests without it are rejected. Multi-tenancy is disabled if empty")
 )
@@ -29,10 +29,12 @@ import (
 	"github.com/uber/jaeger/cmd/flags"
 	"github.com/uber/jaeger/pkg/cassandra"
 	cascfg "github.com/uber/jaeger/pkg/cassandra/config"
+	casMetrics "github.com/uber/jaeger/pkg/cassandra/metrics"
 	cDependencyStore "github.com/uber/jaeger/plugin/storage/cassandra/dependencystore"
 	cSpanStore "github.com/uber/jaeger/plugin/storage/cassandra/spanstore"
 	"github.com/uber/jaeger/storage/dependencystore"
 	"github.com/uber/jaeger/storage/spanstore"
+	"github.com/uber/jaeger/storage/spanstore/compaction"
 )
 
 type cassandraBuilder struct {
@@ -40,6 +42,8 @@ type cassandraBuilder struct {
 	metricsFactory          metrics.Factory
 	configuration           cascfg.Configuration
 	session                 cassandra.Session
+	shardSessions           []cassandra.Session
+	poolTracker             *casMetrics.PoolTracker
 	dependencyDataFrequency time.Duration
 }
 
@@ -61,24 +65,174 @@ func fixConfiguration(config cascfg.Configuration) cascfg.Configuration {
 func (c *cassandraBuilder) getSession() (cassandra.Session, error) {
 	if c.session == nil {
 		session, err := c.configuration.NewSession()
-		c.session = session
-		return c.session, err
+		if err != nil {
+			return nil, err
+		}
+		c.session = c.trackPool(session)
 	}
 	return c.session, nil
 }
 
+func (c *cassandraBuilder) getShardSessions() ([]cassandra.Session, error) {
+	if c.shardSessions == nil {
+		for _, shard := range c.configuration.Shards() {
+			session, err := shard.NewSession()
+			if err != nil {
+				for _, s := range c.shardSessions {
+					s.Close()
+				}
+				c.shardSessions = nil
+				return nil, err
+			}
+			c.shardSessions = append(c.shardSessions, c.trackPool(session))
+		}
+	}
+	return c.shardSessions, nil
+}
+
+// trackPool reports the pool metrics of the session, for the lifetime of the query service
+func (c *cassandraBuilder) trackPool(session cassandra.Session) cassandra.Session {
+	if c.poolTracker == nil {
+		c.poolTracker = casMetrics.NewPoolTracker(c.metricsFactory.Namespace("cassandra", nil))
+	}
+	return c.poolTracker.WrapSession(session)
+}
+
+func (c *cassandraBuilder) probe() error {
+	if c.configuration.ShardingScheme != "" {
+		sessions, err := c.getShardSessions()
+		if err != nil {
+			return err
+		}
+		return cassandra.ProbeShards(c.configuration.Servers, sessions)
+	}
+	session, err := c.getSession()
+	if err != nil {
+		return err
+	}
+	return cassandra.Probe(session)
+}
+
+func (c *cassandraBuilder) readerOptions() ([]cSpanStore.ReaderOption, error) {
+	consistency, err := c.configuration.ConsistencyLevels()
+	if err != nil {
+		return nil, err
+	}
+	options := []cSpanStore.ReaderOption{cSpanStore.ReaderOptions.Consistency(consistency.Read)}
+	if c.configuration.SpanBucketThreshold > 0 {
+		options = append(options, cSpanStore.ReaderOptions.Bucketing())
+	}
+	if len(c.configuration.PromotedTags) > 0 {
+		options = append(options, cSpanStore.ReaderOptions.PromotedTags(c.configuration.PromotedTags))
+	}
+	return options, nil
+}
+
 func (c *cassandraBuilder) NewSpanReader() (spanstore.Reader, error) {
+	options, err := c.readerOptions()
+	if err != nil {
+		return nil, err
+	}
+	if c.configuration.ShardingScheme != "" {
+		return c.newShardedSpanReader(options)
+	}
+	session, err := c.getSession()
+	if err != nil {
+		return nil, err
+	}
+	return c.restoreProcesses(cSpanStore.NewSpanReader(session, c.metricsFactory, c.logger, options...)), nil
+}
+
+func (c *cassandraBuilder) newShardedSpanReader(options []cSpanStore.ReaderOption) (spanstore.Reader, error) {
+	selector, err := spanstore.NewShardSelector(spanstore.ShardingScheme(c.configuration.ShardingScheme), c.configuration.Servers)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := c.getShardSessions()
+	if err != nil {
+		return nil, err
+	}
+	readers := make([]spanstore.Reader, len(sessions))
+	for i, session := range sessions {
+		// the spans of a trace are all in one shard, and so the processes they reference
+		readers[i] = c.restoreProcesses(cSpanStore.NewSpanReader(session, c.metricsFactory, c.logger, options...))
+	}
+	return spanstore.NewShardedReader(selector, readers...), nil
+}
+
+// restoreProcesses makes the reader restore the processes of the spans the collector stored compacted
+func (c *cassandraBuilder) restoreProcesses(reader spanstore.Reader) spanstore.Reader {
+	return compaction.NewReader(reader, c.metricsFactory)
+}
+
+// NewSpanDeleter implements deleterBuilder, deleting the spans from all the shards when they are sharded
+func (c *cassandraBuilder) NewSpanDeleter() (spanstore.Deleter, error) {
+	options, err := c.readerOptions()
+	if err != nil {
+		return nil, err
+	}
+	if c.configuration.ShardingScheme != "" {
+		sessions, err := c.getShardSessions()
+		if err != nil {
+			return nil, err
+		}
+		deleters := make([]spanstore.Deleter, len(sessions))
+		for i, session := range sessions {
+			deleters[i] = cSpanStore.NewSpanReader(session, c.metricsFactory, c.logger, options...)
+		}
+		return spanstore.NewMultiDeleter(deleters...), nil
+	}
 	session, err := c.getSession()
 	if err != nil {
 		return nil, err
 	}
-	return cSpanStore.NewSpanReader(session, c.metricsFactory, c.logger), nil
+	return cSpanStore.NewSpanReader(session, c.metricsFactory, c.logger, options...), nil
+}
+
+// NewStatsReader implements statsReaderBuilder, adding up the statistics of the shards when they are sharded
+func (c *cassandraBuilder) NewStatsReader() (spanstore.StatsReader, error) {
+	options, err := c.readerOptions()
+	if err != nil {
+		return nil, err
+	}
+	if c.configuration.ShardingScheme != "" {
+		sessions, err := c.getShardSessions()
+		if err != nil {
+			return nil, err
+		}
+		readers := make([]spanstore.StatsReader, len(sessions))
+		for i, session := range sessions {
+			readers[i] = cSpanStore.NewSpanReader(session, c.metricsFactory, c.logger, options...)
+		}
+		return spanstore.NewShardedStatsReader(readers...), nil
+	}
+	session, err := c.getSession()
+	if err != nil {
+		return nil, err
+	}
+	return cSpanStore.NewSpanReader(session, c.metricsFactory, c.logger, options...), nil
 }
 
 func (c *cassandraBuilder) NewDependencyReader() (dependencystore.Reader, error) {
+	consistency, err := c.configuration.ConsistencyLevels()
+	if err != nil {
+		return nil, err
+	}
+	readConsistency := cDependencyStore.Options.ReadConsistency(consistency.Read)
+	if c.configuration.ShardingScheme != "" {
+		sessions, err := c.getShardSessions()
+		if err != nil {
+			return nil, err
+		}
+		readers := make([]dependencystore.Reader, len(sessions))
+		for i, session := range sessions {
+			readers[i] = cDependencyStore.NewDependencyStore(session, c.dependencyDataFrequency, c.metricsFactory, c.logger, readConsistency)
+		}
+		return dependencystore.NewMergedReader(readers...), nil
+	}
 	session, err := c.getSession()
 	if err != nil {
 		return nil, err
 	}
-	return cDependencyStore.NewDependencyStore(session, c.dependencyDataFrequency, c.metricsFactory, c.logger), nil
+	return cDependencyStore.NewDependencyStore(session, c.dependencyDataFrequency, c.metricsFactory, c.logger, readConsistency), nil
 }
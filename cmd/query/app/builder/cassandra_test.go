@@ -21,14 +21,19 @@
 package builder
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"go.uber.org/zap"
 
 	"github.com/uber/jaeger-lib/metrics"
+	"github.com/uber/jaeger/pkg/cassandra"
 	"github.com/uber/jaeger/pkg/cassandra/config"
 	"github.com/uber/jaeger/pkg/cassandra/mocks"
+	"github.com/uber/jaeger/storage/dependencystore"
+	"github.com/uber/jaeger/storage/spanstore"
 )
 
 func withBuilder(f func(builder *cassandraBuilder)) {
@@ -73,3 +78,70 @@ func TestNewReaderSuccesses(t *testing.T) {
 		assert.NotNil(t, depReader)
 	})
 }
+
+func TestCassandraReaderOptions(t *testing.T) {
+	withBuilder(func(cBuilder *cassandraBuilder) {
+		options, err := cBuilder.readerOptions()
+		assert.NoError(t, err)
+		assert.Len(t, options, 1)
+
+		cBuilder.configuration.SpanBucketThreshold = 1000
+		cBuilder.configuration.PromotedTags = []string{"request.id"}
+		options, err = cBuilder.readerOptions()
+		assert.NoError(t, err)
+		assert.Len(t, options, 3)
+	})
+}
+
+func TestCassandraProbe(t *testing.T) {
+	withBuilder(func(cBuilder *cassandraBuilder) {
+		healthy := &mocks.Query{}
+		healthy.On("Exec").Return(nil)
+		unhealthy := &mocks.Query{}
+		unhealthy.On("Exec").Return(errors.New("no hosts available"))
+		first := &mocks.Session{}
+		first.On("Query", cassandra.HealthQuery, mock.Anything).Return(healthy)
+		second := &mocks.Session{}
+		second.On("Query", cassandra.HealthQuery, mock.Anything).Return(unhealthy)
+
+		cBuilder.session = first
+		assert.NoError(t, cBuilder.probe())
+
+		cBuilder.configuration.Servers = []string{"127.0.0.1", "127.0.0.2"}
+		cBuilder.configuration.ShardingScheme = "rendezvous"
+		cBuilder.shardSessions = []cassandra.Session{first, second}
+		assert.EqualError(t, cBuilder.probe(), "Cassandra shard 127.0.0.2 is unavailable: no hosts available")
+	})
+}
+
+func TestNewShardedReaderSuccesses(t *testing.T) {
+	withBuilder(func(cBuilder *cassandraBuilder) {
+		cBuilder.configuration.Servers = []string{"127.0.0.1", "127.0.0.2"}
+		cBuilder.configuration.ShardingScheme = "rendezvous"
+		cBuilder.shardSessions = []cassandra.Session{&mocks.Session{}, &mocks.Session{}}
+		spanReader, err := cBuilder.NewSpanReader()
+		assert.NoError(t, err)
+		assert.IsType(t, &spanstore.ShardedReader{}, spanReader)
+		depReader, err := cBuilder.NewDependencyReader()
+		assert.NoError(t, err)
+		assert.IsType(t, &dependencystore.MergedReader{}, depReader)
+	})
+}
+
+func TestNewShardedReaderFailures(t *testing.T) {
+	withBuilder(func(cBuilder *cassandraBuilder) {
+		cBuilder.configuration.ShardingScheme = "random"
+		spanReader, err := cBuilder.NewSpanReader()
+		assert.EqualError(t, err, `Unknown sharding scheme "random"`)
+		assert.Nil(t, spanReader)
+
+		cBuilder.configuration.Servers = []string{"invalidhostname"}
+		cBuilder.configuration.ShardingScheme = "modulo"
+		spanReader, err = cBuilder.NewSpanReader()
+		assert.Error(t, err)
+		assert.Nil(t, spanReader)
+		depReader, err := cBuilder.NewDependencyReader()
+		assert.Error(t, err)
+		assert.Nil(t, depReader)
+	})
+}
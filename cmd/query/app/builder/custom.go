@@ -0,0 +1,81 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package builder
+
+import (
+	"time"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/storage/dependencystore"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+// customStorageBuilder reads from the third-party reader of Configuration.CustomSpanReader
+type customStorageBuilder struct {
+	reader spanstore.Reader
+}
+
+func newCustomStorageBuilder(reader spanstore.Reader) *customStorageBuilder {
+	return &customStorageBuilder{reader: reader}
+}
+
+func (c *customStorageBuilder) NewSpanReader() (spanstore.Reader, error) {
+	return c.reader, nil
+}
+
+// NewDependencyReader returns the reader itself if it reads dependencies, or a reader finding none
+func (c *customStorageBuilder) NewDependencyReader() (dependencystore.Reader, error) {
+	if d, ok := c.reader.(dependencystore.Reader); ok {
+		return d, nil
+	}
+	return noDependencies{}, nil
+}
+
+// NewSpanDeleter implements deleterBuilder
+func (c *customStorageBuilder) NewSpanDeleter() (spanstore.Deleter, error) {
+	if d, ok := c.reader.(spanstore.Deleter); ok {
+		return d, nil
+	}
+	return nil, errDeletionNotSupported
+}
+
+// NewStatsReader implements statsReaderBuilder
+func (c *customStorageBuilder) NewStatsReader() (spanstore.StatsReader, error) {
+	if s, ok := c.reader.(spanstore.StatsReader); ok {
+		return s, nil
+	}
+	return nil, errStatsNotSupported
+}
+
+// probe implements prober
+func (c *customStorageBuilder) probe() error {
+	if p, ok := c.reader.(spanstore.Prober); ok {
+		return p.Probe()
+	}
+	return nil
+}
+
+// noDependencies is the dependency reader of the storages without dependencies
+type noDependencies struct{}
+
+func (noDependencies) GetDependencies(endTs time.Time, lookback time.Duration) ([]model.DependencyLink, error) {
+	return nil, nil
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package builder
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/jaeger/storage/spanstore/memory"
+	"github.com/uber/jaeger/storage/spanstore/mocks"
+)
+
+// probedReader is a span reader of a storage unknown to the query service, which can be probed
+type probedReader struct {
+	mocks.Reader
+	probeErr error
+}
+
+func (r *probedReader) Probe() error {
+	return r.probeErr
+}
+
+func TestCustomStorageBuilder(t *testing.T) {
+	store := memory.NewStore()
+	// the storage type is bypassed
+	sBuilder, err := NewStorageBuilderForType("cassandra", Configuration{CustomSpanReader: store})
+	require.NoError(t, err)
+
+	spanReader, err := sBuilder.NewSpanReader()
+	assert.NoError(t, err)
+	assert.Equal(t, store, spanReader)
+	depReader, err := sBuilder.NewDependencyReader()
+	assert.NoError(t, err)
+	assert.Equal(t, store, depReader)
+
+	deleter, err := NewSpanDeleter("cassandra", Configuration{CustomSpanReader: store})
+	assert.NoError(t, err)
+	assert.Equal(t, store, deleter)
+	statsReader, err := NewStatsReader("cassandra", Configuration{CustomSpanReader: store})
+	assert.NoError(t, err)
+	assert.Equal(t, store, statsReader)
+}
+
+func TestCustomStorageBuilderReaderOnly(t *testing.T) {
+	reader := &probedReader{}
+	spanReader, depReader, err := NewReaders("elasticsearch", Configuration{CustomSpanReader: reader})
+	require.NoError(t, err)
+	assert.Equal(t, reader, spanReader)
+	dependencies, err := depReader.GetDependencies(time.Now(), time.Hour)
+	assert.NoError(t, err)
+	assert.Empty(t, dependencies)
+
+	_, err = NewSpanDeleter("elasticsearch", Configuration{CustomSpanReader: reader})
+	assert.EqualError(t, err, errDeletionNotSupported.Error())
+	_, err = NewStatsReader("elasticsearch", Configuration{CustomSpanReader: reader})
+	assert.EqualError(t, err, errStatsNotSupported.Error())
+
+	reader.probeErr = errors.New("unreachable")
+	_, _, err = NewReaders("elasticsearch", Configuration{CustomSpanReader: reader})
+	assert.EqualError(t, err, "unreachable")
+}
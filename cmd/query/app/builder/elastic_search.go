@@ -21,6 +21,8 @@
 package builder
 
 import (
+	"time"
+
 	"github.com/uber/jaeger-lib/metrics"
 	"go.uber.org/zap"
 
@@ -30,8 +32,12 @@ import (
 	esSpanstore "github.com/uber/jaeger/plugin/storage/es/spanstore"
 	"github.com/uber/jaeger/storage/dependencystore"
 	"github.com/uber/jaeger/storage/spanstore"
+	"github.com/uber/jaeger/storage/spanstore/compaction"
 )
 
+// esProbeTimeout is the time the ElasticSearch cluster has to report its health when checked
+const esProbeTimeout = 5 * time.Second
+
 type esBuilder struct {
 	logger         *zap.Logger
 	client         es.Client
@@ -49,19 +55,81 @@ func newESBuilder(config *escfg.Configuration, logger *zap.Logger, metricsFactor
 
 func (e *esBuilder) getClient() (es.Client, error) {
 	if e.client == nil {
-		client, err := e.configuration.NewClient()
+		// the pool metrics are reported for the lifetime of the query service, the closer is not needed
+		client, _, err := e.configuration.NewClientWithMetrics(e.metricsFactory.Namespace("elasticsearch", nil))
+		if err != nil {
+			return nil, err
+		}
 		e.client = client
-		return e.client, err
 	}
 	return e.client, nil
 }
 
+func (e *esBuilder) probe() error {
+	client, err := e.getClient()
+	if err != nil {
+		return err
+	}
+	return es.Probe(client, esProbeTimeout)
+}
+
 func (e *esBuilder) NewSpanReader() (spanstore.Reader, error) {
+	indexNaming, err := esSpanstore.NewIndexNaming(e.configuration.IndexTemplate)
+	if err != nil {
+		return nil, err
+	}
+	client, err := e.getClient()
+	if err != nil {
+		return nil, err
+	}
+	reader := esSpanstore.NewSpanReader(
+		client,
+		e.logger,
+		e.configuration.MaxSpanAge,
+		e.metricsFactory,
+		esSpanstore.ReaderOptions.IndexNaming(indexNaming),
+	)
+	// restores the processes of the spans the collector stored compacted
+	return compaction.NewReader(reader, e.metricsFactory), nil
+}
+
+// NewSpanDeleter implements deleterBuilder
+func (e *esBuilder) NewSpanDeleter() (spanstore.Deleter, error) {
+	indexNaming, err := esSpanstore.NewIndexNaming(e.configuration.IndexTemplate)
+	if err != nil {
+		return nil, err
+	}
+	client, err := e.getClient()
+	if err != nil {
+		return nil, err
+	}
+	return esSpanstore.NewSpanDeleter(client, e.logger, esSpanstore.ReaderOptions.IndexNaming(indexNaming)), nil
+}
+
+// NewStatsReader implements statsReaderBuilder
+func (e *esBuilder) NewStatsReader() (spanstore.StatsReader, error) {
+	indexNaming, err := esSpanstore.NewIndexNaming(e.configuration.IndexTemplate)
+	if err != nil {
+		return nil, err
+	}
+	client, err := e.getClient()
+	if err != nil {
+		return nil, err
+	}
+	return esSpanstore.NewStatsReader(client, e.logger, esSpanstore.ReaderOptions.IndexNaming(indexNaming)), nil
+}
+
+// NewDurationReader implements durationReaderBuilder
+func (e *esBuilder) NewDurationReader() (spanstore.DurationReader, error) {
+	indexNaming, err := esSpanstore.NewIndexNaming(e.configuration.IndexTemplate)
+	if err != nil {
+		return nil, err
+	}
 	client, err := e.getClient()
 	if err != nil {
 		return nil, err
 	}
-	return esSpanstore.NewSpanReader(client, e.logger, e.configuration.MaxSpanAge, e.metricsFactory), nil
+	return esSpanstore.NewDurationReader(client, e.logger, esSpanstore.ReaderOptions.IndexNaming(indexNaming)), nil
 }
 
 func (e *esBuilder) NewDependencyReader() (dependencystore.Reader, error) {
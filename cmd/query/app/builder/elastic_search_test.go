@@ -60,6 +60,16 @@ func TestESBuilderFailure(t *testing.T) {
 	})
 }
 
+func TestESBuilderBadIndexTemplate(t *testing.T) {
+	withESBuilder(func(esBuilder *esBuilder) {
+		esBuilder.client = &mocks.Client{}
+		esBuilder.configuration.IndexTemplate = "jaeger-{service}"
+		spanReader, err := esBuilder.NewSpanReader()
+		assert.EqualError(t, err, `Index template "jaeger-{service}" must contain {date} once`)
+		assert.Nil(t, spanReader)
+	})
+}
+
 func TestESBuilderSuccesses(t *testing.T) {
 	withESBuilder(func(esBuilder *esBuilder) {
 		mockClient := mocks.Client{}
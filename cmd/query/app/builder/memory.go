@@ -40,6 +40,16 @@ func (c *memoryStoreBuilder) NewSpanReader() (spanstore.Reader, error) {
 	return c.memStore, nil
 }
 
+// NewSpanDeleter implements deleterBuilder
+func (c *memoryStoreBuilder) NewSpanDeleter() (spanstore.Deleter, error) {
+	return c.memStore, nil
+}
+
+// NewStatsReader implements statsReaderBuilder
+func (c *memoryStoreBuilder) NewStatsReader() (spanstore.StatsReader, error) {
+	return c.memStore, nil
+}
+
 func (c *memoryStoreBuilder) NewDependencyReader() (dependencystore.Reader, error) {
 	return c.memStore, nil
 }
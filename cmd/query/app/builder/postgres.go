@@ -0,0 +1,83 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package builder
+
+import (
+	"go.uber.org/zap"
+
+	pgcfg "github.com/uber/jaeger/pkg/postgres/config"
+	pgSpanstore "github.com/uber/jaeger/plugin/storage/postgres/spanstore"
+	"github.com/uber/jaeger/storage/dependencystore"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+type postgresBuilder struct {
+	logger        *zap.Logger
+	store         *pgSpanstore.Store
+	configuration pgcfg.Configuration
+}
+
+func newPostgresBuilder(config *pgcfg.Configuration, logger *zap.Logger) *postgresBuilder {
+	return &postgresBuilder{
+		logger:        logger,
+		configuration: *config,
+	}
+}
+
+func (p *postgresBuilder) getStore() (*pgSpanstore.Store, error) {
+	if p.store == nil {
+		db, err := p.configuration.NewDB()
+		if err != nil {
+			return nil, err
+		}
+		store, err := pgSpanstore.NewStore(db, p.logger)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		p.store = store
+	}
+	return p.store, nil
+}
+
+func (p *postgresBuilder) probe() error {
+	store, err := p.getStore()
+	if err != nil {
+		return err
+	}
+	return store.Ping()
+}
+
+func (p *postgresBuilder) NewSpanReader() (spanstore.Reader, error) {
+	store, err := p.getStore()
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (p *postgresBuilder) NewDependencyReader() (dependencystore.Reader, error) {
+	store, err := p.getStore()
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
@@ -24,10 +24,17 @@ import (
 	"errors"
 	"flag"
 
-	basicB "github.com/uber/jaeger/cmd/builder"
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
 	"github.com/uber/jaeger/cmd/flags"
+	cascfg "github.com/uber/jaeger/pkg/cassandra/config"
+	escfg "github.com/uber/jaeger/pkg/es/config"
+	pgcfg "github.com/uber/jaeger/pkg/postgres/config"
+	badgerSpanstore "github.com/uber/jaeger/plugin/storage/badger/spanstore"
 	"github.com/uber/jaeger/storage/dependencystore"
 	"github.com/uber/jaeger/storage/spanstore"
+	"github.com/uber/jaeger/storage/spanstore/memory"
 )
 
 // StorageBuilder is the interface that provides the necessary store readers
@@ -36,33 +43,180 @@ type StorageBuilder interface {
 	NewDependencyReader() (dependencystore.Reader, error)
 }
 
+// prober is implemented by the builders of remote storages, to check that the storage can be reached
+type prober interface {
+	probe() error
+}
+
+// deleterBuilder is implemented by the builders of the storages spans can be deleted from
+type deleterBuilder interface {
+	NewSpanDeleter() (spanstore.Deleter, error)
+}
+
+// statsReaderBuilder is implemented by the builders of the storages computing the statistics of the spans
+type statsReaderBuilder interface {
+	NewStatsReader() (spanstore.StatsReader, error)
+}
+
+// durationReaderBuilder is implemented by the builders of the storages aggregating the percentiles of the durations
+type durationReaderBuilder interface {
+	NewDurationReader() (spanstore.DurationReader, error)
+}
+
+// Configuration describes the storage the query service reads from. Unlike the options of the collector
+// builder, it does not depend on the write path, so that the query service can be built without it.
+type Configuration struct {
+	// Logger is zap.NewNop() if nil
+	Logger *zap.Logger
+	// MetricsFactory is metrics.NullFactory if nil
+	MetricsFactory metrics.Factory
+	Cassandra      *cascfg.Configuration
+	// CassandraArchive is the keyspace of the archived traces, the spans are also deleted from it if set
+	CassandraArchive *cascfg.Configuration
+	ElasticSearch    *escfg.Configuration
+	Postgres         *pgcfg.Configuration
+	MemoryStore      *memory.Store
+	// BadgerStore is the store opened by the process writing to it, e.g. jaeger-standalone, Badger locking
+	// the directory of the store for a single process
+	BadgerStore *badgerSpanstore.Store
+	// CustomSpanReader replaces the storage type, e.g. with the reader of builder.Options.CustomStorageOption.
+	// It also reads the dependencies, deletes the spans and computes their statistics if it implements
+	// dependencystore.Reader, spanstore.Deleter and spanstore.StatsReader.
+	CustomSpanReader spanstore.Reader
+}
+
 var (
 	errMissingCassandraConfig     = errors.New("Cassandra not configured")
 	errMissingMemoryStore         = errors.New("Memory Reader was not provided")
 	errMissingElasticSearchConfig = errors.New("ElasticSearch not configured")
+	errMissingBadgerStore         = errors.New("Badger can only be read by the process writing to it, such as jaeger-standalone")
+	errMissingPostgresConfig      = errors.New("PostgreSQL not configured")
+	errDeletionNotSupported       = errors.New("Spans cannot be deleted from this storage")
+	errStatsNotSupported          = errors.New("Statistics cannot be computed by this storage")
 )
 
 // NewStorageBuilder creates a StorageBuilder based off the flags that have been set
-func NewStorageBuilder(opts ...basicB.Option) (StorageBuilder, error) {
+func NewStorageBuilder(config Configuration) (StorageBuilder, error) {
 	flag.Parse()
-	options := basicB.ApplyOptions(opts...)
+	// reads are only served from the primary storage when spans are written to several
+	return NewStorageBuilderForType(flags.SpanStorage.PrimaryType(), config)
+}
+
+// NewStorageBuilderForType creates a StorageBuilder reading from the given storage type, regardless of the flags
+func NewStorageBuilderForType(spanStorageType string, config Configuration) (StorageBuilder, error) {
+	if config.Logger == nil {
+		config.Logger = zap.NewNop()
+	}
+	if config.MetricsFactory == nil {
+		config.MetricsFactory = metrics.NullFactory
+	}
+	if config.CustomSpanReader != nil {
+		return newCustomStorageBuilder(config.CustomSpanReader), nil
+	}
 	// TODO lots of repeated code + if logic, clean up below
-	if flags.SpanStorage.Type == flags.CassandraStorageType {
-		if options.Cassandra == nil {
+	if spanStorageType == flags.CassandraStorageType {
+		if config.Cassandra == nil {
 			return nil, errMissingCassandraConfig
 		}
 		// TODO technically span and dependency storage might be separate
-		return newCassandraBuilder(options.Cassandra, options.Logger, options.MetricsFactory), nil
-	} else if flags.SpanStorage.Type == flags.MemoryStorageType {
-		if options.MemoryStore == nil {
+		return newCassandraBuilder(config.Cassandra, config.Logger, config.MetricsFactory), nil
+	} else if spanStorageType == flags.MemoryStorageType {
+		if config.MemoryStore == nil {
 			return nil, errMissingMemoryStore
 		}
-		return newMemoryStoreBuilder(options.MemoryStore), nil
-	} else if flags.SpanStorage.Type == flags.ESStorageType {
-		if options.ElasticSearch == nil {
+		return newMemoryStoreBuilder(config.MemoryStore), nil
+	} else if spanStorageType == flags.ESStorageType {
+		if config.ElasticSearch == nil {
 			return nil, errMissingElasticSearchConfig
 		}
-		return newESBuilder(options.ElasticSearch, options.Logger, options.MetricsFactory), nil
+		return newESBuilder(config.ElasticSearch, config.Logger, config.MetricsFactory), nil
+	} else if spanStorageType == flags.BadgerStorageType {
+		if config.BadgerStore == nil {
+			return nil, errMissingBadgerStore
+		}
+		return newBadgerBuilder(config.BadgerStore), nil
+	} else if spanStorageType == flags.PostgresStorageType {
+		if config.Postgres == nil {
+			return nil, errMissingPostgresConfig
+		}
+		return newPostgresBuilder(config.Postgres, config.Logger), nil
 	}
 	return nil, flags.ErrUnsupportedStorageType
 }
+
+// NewReaders creates the span and dependency readers of the given storage type, then probes the storage
+// as the health check of the collector does, so that a storage that cannot be reached fails on start
+// rather than on the first query
+func NewReaders(spanStorageType string, config Configuration) (spanstore.Reader, dependencystore.Reader, error) {
+	storageBuilder, err := NewStorageBuilderForType(spanStorageType, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	spanReader, err := storageBuilder.NewSpanReader()
+	if err != nil {
+		return nil, nil, err
+	}
+	dependencyReader, err := storageBuilder.NewDependencyReader()
+	if err != nil {
+		return nil, nil, err
+	}
+	if p, ok := storageBuilder.(prober); ok {
+		if err := p.probe(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return spanReader, dependencyReader, nil
+}
+
+// NewSpanDeleter creates the deleter of the spans of the given storage type, and of the Cassandra archive keyspace
+// if configured, or returns an error if the spans of the storage cannot be deleted
+func NewSpanDeleter(spanStorageType string, config Configuration) (spanstore.Deleter, error) {
+	storageBuilder, err := NewStorageBuilderForType(spanStorageType, config)
+	if err != nil {
+		return nil, err
+	}
+	d, ok := storageBuilder.(deleterBuilder)
+	if !ok {
+		return nil, errDeletionNotSupported
+	}
+	deleter, err := d.NewSpanDeleter()
+	if err != nil || config.CustomSpanReader != nil || spanStorageType != flags.CassandraStorageType || config.CassandraArchive == nil {
+		return deleter, err
+	}
+	archive := newCassandraBuilder(config.CassandraArchive, config.Logger, config.MetricsFactory)
+	archiveDeleter, err := archive.NewSpanDeleter()
+	if err != nil {
+		return nil, err
+	}
+	return spanstore.NewMultiDeleter(deleter, archiveDeleter), nil
+}
+
+// NewStatsReader creates the reader of the statistics of the spans of the given storage type, or returns an error
+// if the storage cannot compute them
+func NewStatsReader(spanStorageType string, config Configuration) (spanstore.StatsReader, error) {
+	storageBuilder, err := NewStorageBuilderForType(spanStorageType, config)
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := storageBuilder.(statsReaderBuilder); ok {
+		return s.NewStatsReader()
+	}
+	return nil, errStatsNotSupported
+}
+
+// NewDurationReader creates the reader of the duration percentiles of the spans of the given storage type, the
+// storages without percentile aggregations computing them from a sample of the traces found by the trace search
+func NewDurationReader(spanStorageType string, config Configuration) (spanstore.DurationReader, error) {
+	storageBuilder, err := NewStorageBuilderForType(spanStorageType, config)
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := storageBuilder.(durationReaderBuilder); ok {
+		return d.NewDurationReader()
+	}
+	spanReader, err := storageBuilder.NewSpanReader()
+	if err != nil {
+		return nil, err
+	}
+	return spanstore.NewSampledDurationReader(spanReader), nil
+}
@@ -21,27 +21,32 @@
 package builder
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 
 	"github.com/uber/jaeger-lib/metrics"
-	basicB "github.com/uber/jaeger/cmd/builder"
 	cascfg "github.com/uber/jaeger/pkg/cassandra/config"
 	escfg "github.com/uber/jaeger/pkg/es/config"
+	pgcfg "github.com/uber/jaeger/pkg/postgres/config"
+	badgerSpanstore "github.com/uber/jaeger/plugin/storage/badger/spanstore"
+	"github.com/uber/jaeger/storage/spanstore"
 	"github.com/uber/jaeger/storage/spanstore/memory"
 )
 
 func TestNewCassandraSuccess(t *testing.T) {
-	sBuilder, err := NewStorageBuilder(
-		basicB.Options.LoggerOption(zap.NewNop()),
-		basicB.Options.MetricsFactoryOption(metrics.NullFactory),
-		basicB.Options.CassandraOption(&cascfg.Configuration{
+	sBuilder, err := NewStorageBuilder(Configuration{
+		Logger:         zap.NewNop(),
+		MetricsFactory: metrics.NullFactory,
+		Cassandra: &cascfg.Configuration{
 			Servers: []string{"127.0.0.1"},
-		}),
-	)
+		},
+	})
 	assert.NoError(t, err)
 	assert.NotNil(t, sBuilder)
 }
@@ -52,23 +57,99 @@ func TestNewCassandraFailure(t *testing.T) {
 		os.Args = originalArgs
 	}()
 	os.Args = []string{"test", "--span-storage.type=sneh"}
-	sBuilder, err := NewStorageBuilder()
+	sBuilder, err := NewStorageBuilder(Configuration{})
 	assert.EqualError(t, err, "Storage Type is not supported")
 	assert.Nil(t, sBuilder)
 
 	os.Args = []string{"test", "--span-storage.type=cassandra"}
-	sBuilder, err = NewStorageBuilder()
+	sBuilder, err = NewStorageBuilder(Configuration{})
 	assert.EqualError(t, err, "Cassandra not configured")
 	assert.Nil(t, sBuilder)
 }
 
+func TestNewStorageBuilderForType(t *testing.T) {
+	sBuilder, err := NewStorageBuilderForType("memory", Configuration{MemoryStore: memory.NewStore()})
+	assert.NoError(t, err)
+	assert.NotNil(t, sBuilder)
+
+	sBuilder, err = NewStorageBuilderForType("elasticsearch", Configuration{})
+	assert.EqualError(t, err, "ElasticSearch not configured")
+	assert.Nil(t, sBuilder)
+}
+
+func TestNewReaders(t *testing.T) {
+	spanReader, dependencyReader, err := NewReaders("memory", Configuration{MemoryStore: memory.NewStore()})
+	assert.NoError(t, err)
+	assert.NotNil(t, spanReader)
+	assert.NotNil(t, dependencyReader)
+
+	_, _, err = NewReaders("elasticsearch", Configuration{})
+	assert.EqualError(t, err, "ElasticSearch not configured")
+
+	_, _, err = NewReaders("cassandra", Configuration{Cassandra: &cascfg.Configuration{Servers: []string{"invalidhostname"}}})
+	assert.Error(t, err)
+}
+
+func TestNewSpanDeleter(t *testing.T) {
+	store := memory.NewStore()
+	deleter, err := NewSpanDeleter("memory", Configuration{MemoryStore: store})
+	assert.NoError(t, err)
+	assert.Equal(t, store, deleter)
+
+	_, err = NewSpanDeleter("badger", Configuration{BadgerStore: &badgerSpanstore.Store{}})
+	assert.EqualError(t, err, errDeletionNotSupported.Error())
+
+	_, err = NewSpanDeleter("elasticsearch", Configuration{})
+	assert.EqualError(t, err, "ElasticSearch not configured")
+}
+
+func TestNewStatsReader(t *testing.T) {
+	store := memory.NewStore()
+	statsReader, err := NewStatsReader("memory", Configuration{MemoryStore: store})
+	assert.NoError(t, err)
+	assert.Equal(t, store, statsReader)
+
+	_, err = NewStatsReader("badger", Configuration{BadgerStore: &badgerSpanstore.Store{}})
+	assert.EqualError(t, err, errStatsNotSupported.Error())
+
+	_, err = NewStatsReader("elasticsearch", Configuration{})
+	assert.EqualError(t, err, "ElasticSearch not configured")
+}
+
+func TestNewElasticStatsReader(t *testing.T) {
+	// answers the health checks of the client
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	config := Configuration{ElasticSearch: &escfg.Configuration{Servers: []string{server.URL}}}
+
+	statsReader, err := NewStatsReader("elasticsearch", config)
+	require.NoError(t, err)
+	assert.NotNil(t, statsReader)
+	durationReader, err := NewDurationReader("elasticsearch", config)
+	require.NoError(t, err)
+	assert.NotNil(t, durationReader)
+}
+
+func TestNewDurationReader(t *testing.T) {
+	store := memory.NewStore()
+	durationReader, err := NewDurationReader("memory", Configuration{MemoryStore: store})
+	assert.NoError(t, err)
+	assert.Equal(t, spanstore.NewSampledDurationReader(store), durationReader)
+
+	_, err = NewDurationReader("elasticsearch", Configuration{})
+	assert.EqualError(t, err, "ElasticSearch not configured")
+}
+
 func TestNewMemorySuccess(t *testing.T) {
 	originalArgs := os.Args
 	defer func() {
 		os.Args = originalArgs
 	}()
 	os.Args = []string{"test", "--span-storage.type=memory"}
-	sBuilder, err := NewStorageBuilder(basicB.Options.MemoryStoreOption(memory.NewStore()))
+	sBuilder, err := NewStorageBuilder(Configuration{MemoryStore: memory.NewStore()})
 	assert.NoError(t, err)
 	assert.NotNil(t, sBuilder)
 }
@@ -79,7 +160,7 @@ func TestNewMemoryFailure(t *testing.T) {
 		os.Args = originalArgs
 	}()
 	os.Args = []string{"test", "--span-storage.type=memory"}
-	sBuilder, err := NewStorageBuilder()
+	sBuilder, err := NewStorageBuilder(Configuration{})
 	assert.Error(t, err)
 	assert.Nil(t, sBuilder)
 }
@@ -91,12 +172,12 @@ func TestNewElasticSuccess(t *testing.T) {
 	}()
 
 	os.Args = []string{"test", "--span-storage.type=elasticsearch"}
-	sBuilder, err := NewStorageBuilder(
-		basicB.Options.LoggerOption(zap.NewNop()),
-		basicB.Options.ElasticSearchOption(&escfg.Configuration{
+	sBuilder, err := NewStorageBuilder(Configuration{
+		Logger: zap.NewNop(),
+		ElasticSearch: &escfg.Configuration{
 			Servers: []string{"127.0.0.1"},
-		}),
-	)
+		},
+	})
 	assert.NoError(t, err)
 	assert.NotNil(t, sBuilder)
 }
@@ -108,7 +189,61 @@ func TestNewElasticFailure(t *testing.T) {
 	}()
 
 	os.Args = []string{"test", "--span-storage.type=elasticsearch"}
-	sBuilder, err := NewStorageBuilder()
+	sBuilder, err := NewStorageBuilder(Configuration{})
 	assert.EqualError(t, err, "ElasticSearch not configured")
 	assert.Nil(t, sBuilder)
 }
+
+func TestNewBadgerSuccess(t *testing.T) {
+	originalArgs := os.Args
+	defer func() {
+		os.Args = originalArgs
+	}()
+
+	os.Args = []string{"test", "--span-storage.type=badger"}
+	sBuilder, err := NewStorageBuilder(Configuration{
+		BadgerStore: &badgerSpanstore.Store{},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, sBuilder)
+}
+
+func TestNewBadgerFailure(t *testing.T) {
+	originalArgs := os.Args
+	defer func() {
+		os.Args = originalArgs
+	}()
+
+	os.Args = []string{"test", "--span-storage.type=badger"}
+	sBuilder, err := NewStorageBuilder(Configuration{})
+	assert.EqualError(t, err, "Badger can only be read by the process writing to it, such as jaeger-standalone")
+	assert.Nil(t, sBuilder)
+}
+
+func TestNewPostgresSuccess(t *testing.T) {
+	originalArgs := os.Args
+	defer func() {
+		os.Args = originalArgs
+	}()
+
+	os.Args = []string{"test", "--span-storage.type=postgres"}
+	sBuilder, err := NewStorageBuilder(Configuration{
+		Postgres: &pgcfg.Configuration{
+			DSN: "postgres://127.0.0.1:5432/jaeger",
+		},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, sBuilder)
+}
+
+func TestNewPostgresFailure(t *testing.T) {
+	originalArgs := os.Args
+	defer func() {
+		os.Args = originalArgs
+	}()
+
+	os.Args = []string{"test", "--span-storage.type=postgres"}
+	sBuilder, err := NewStorageBuilder(Configuration{})
+	assert.EqualError(t, err, "PostgreSQL not configured")
+	assert.Nil(t, sBuilder)
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"github.com/uber/jaeger/model"
+	ui "github.com/uber/jaeger/model/json"
+)
+
+// traceCompleteness hints whether spans of the trace are missing, e.g. because the trace is still being written:
+// the trace is incomplete if it has no root span, i.e. a span without a parent, or if spans reference spans of
+// the same trace which are not in the trace. Unless requireRoot is set, a trace without any root span which
+// misses a single referenced span is complete, as asynchronous flows often start with spans referencing a span
+// of a producer which is not traced.
+func traceCompleteness(trace *model.Trace, requireRoot bool) *ui.Completeness {
+	spanIDs := make(map[model.SpanID]struct{}, len(trace.Spans))
+	for _, span := range trace.Spans {
+		spanIDs[span.SpanID] = struct{}{}
+	}
+	hasRoot := false
+	missing := make(map[model.SpanID]struct{})
+	var missingSpanIDs []ui.SpanID
+	addMissing := func(spanID model.SpanID) {
+		if _, ok := spanIDs[spanID]; ok {
+			return
+		}
+		if _, ok := missing[spanID]; ok {
+			return
+		}
+		missing[spanID] = struct{}{}
+		missingSpanIDs = append(missingSpanIDs, ui.SpanID(spanID.String()))
+	}
+	for _, span := range trace.Spans {
+		isRoot := span.ParentSpanID == 0
+		if !isRoot {
+			addMissing(span.ParentSpanID)
+		}
+		for _, ref := range span.References {
+			// references to other traces, e.g. links of batch jobs, do not belong to this trace
+			if ref.TraceID != span.TraceID {
+				continue
+			}
+			isRoot = false
+			addMissing(ref.SpanID)
+		}
+		hasRoot = hasRoot || isRoot
+	}
+	completeness := &ui.Completeness{
+		Status:         ui.CompleteTrace,
+		MissingRoot:    !hasRoot,
+		MissingSpanIDs: missingSpanIDs,
+	}
+	asyncFlow := !requireRoot && !hasRoot && len(missingSpanIDs) <= 1
+	if !asyncFlow && (!hasRoot || len(missingSpanIDs) > 0) {
+		completeness.Status = ui.IncompleteTrace
+	}
+	return completeness
+}
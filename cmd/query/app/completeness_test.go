@@ -0,0 +1,90 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/uber/jaeger/model"
+	ui "github.com/uber/jaeger/model/json"
+)
+
+func TestTraceCompleteness(t *testing.T) {
+	traceID := model.TraceID{Low: 1}
+	span := func(spanID, parentID model.SpanID, refs ...model.SpanRef) *model.Span {
+		return &model.Span{TraceID: traceID, SpanID: spanID, ParentSpanID: parentID, References: refs}
+	}
+	followsFrom := func(traceID model.TraceID, spanID model.SpanID) model.SpanRef {
+		return model.SpanRef{RefType: model.FollowsFrom, TraceID: traceID, SpanID: spanID}
+	}
+	testCases := []struct {
+		name        string
+		spans       []*model.Span
+		requireRoot bool
+		expected    ui.Completeness
+	}{
+		{
+			name:        "complete",
+			spans:       []*model.Span{span(1, 0), span(2, 1), span(3, 2, followsFrom(traceID, 1))},
+			requireRoot: true,
+			expected:    ui.Completeness{Status: ui.CompleteTrace},
+		},
+		{
+			name:        "link to another trace",
+			spans:       []*model.Span{span(1, 0, followsFrom(model.TraceID{Low: 2}, 7))},
+			requireRoot: true,
+			expected:    ui.Completeness{Status: ui.CompleteTrace},
+		},
+		{
+			name:        "dangling references",
+			spans:       []*model.Span{span(1, 0), span(2, 5), span(3, 5), span(4, 1, followsFrom(traceID, 6))},
+			requireRoot: true,
+			expected:    ui.Completeness{Status: ui.IncompleteTrace, MissingSpanIDs: []ui.SpanID{"5", "6"}},
+		},
+		{
+			name:        "missing root",
+			spans:       []*model.Span{span(2, 1), span(3, 2)},
+			requireRoot: true,
+			expected:    ui.Completeness{Status: ui.IncompleteTrace, MissingRoot: true, MissingSpanIDs: []ui.SpanID{"1"}},
+		},
+		{
+			name:     "asynchronous flow",
+			spans:    []*model.Span{span(2, 0, followsFrom(traceID, 1)), span(3, 2)},
+			expected: ui.Completeness{Status: ui.CompleteTrace, MissingRoot: true, MissingSpanIDs: []ui.SpanID{"1"}},
+		},
+		{
+			name:     "asynchronous flow missing spans",
+			spans:    []*model.Span{span(2, 1), span(3, 4)},
+			expected: ui.Completeness{Status: ui.IncompleteTrace, MissingRoot: true, MissingSpanIDs: []ui.SpanID{"1", "4"}},
+		},
+		{
+			name:     "not required root with dangling references",
+			spans:    []*model.Span{span(1, 0), span(2, 5)},
+			expected: ui.Completeness{Status: ui.IncompleteTrace, MissingSpanIDs: []ui.SpanID{"5"}},
+		},
+	}
+	for _, testCase := range testCases {
+		completeness := traceCompleteness(&model.Trace{Spans: testCase.spans}, testCase.requireRoot)
+		assert.Equal(t, testCase.expected, *completeness, testCase.name)
+	}
+}
@@ -24,7 +24,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -37,9 +39,11 @@ import (
 	"github.com/uber/jaeger/model/adjuster"
 	uiconv "github.com/uber/jaeger/model/converter/json"
 	ui "github.com/uber/jaeger/model/json"
+	"github.com/uber/jaeger/pkg/cache"
 	"github.com/uber/jaeger/pkg/multierror"
 	"github.com/uber/jaeger/storage/dependencystore"
 	"github.com/uber/jaeger/storage/spanstore"
+	"github.com/uber/jaeger/storage/spanstore/tenancy"
 )
 
 const (
@@ -50,10 +54,17 @@ const (
 	defaultDependencyLookbackDuration = time.Hour * 24
 	defaultTraceQueryLookbackDuration = time.Hour * 24 * 2
 	defaultHTTPPrefix                 = "api"
+
+	// statsCacheSize is the number of distinct statistics queries cached
+	statsCacheSize = 1000
+	// durationsCacheSize is the number of distinct duration percentiles queries cached
+	durationsCacheSize = 1000
 )
 
 var (
 	errNoArchiveSpanStorage = errors.New("archive span storage was not configured")
+	errInvalidTenant        = errors.New("missing or invalid tenant header")
+	errDeletionInProgress   = errors.New("another deletion of spans is in progress")
 )
 
 // HTTPHandler handles http requests
@@ -86,6 +97,57 @@ type APIHandler struct {
 	queryParser       queryParser
 	httpPrefix        string
 	tracer            opentracing.Tracer
+	// completeness enables the completeness hints of the returned traces
+	completeness bool
+	requireRoot  bool
+	// tenantHeader is the header carrying the tenant the reads of a request are scoped to
+	tenantHeader string
+	// traceIDFormat is how the trace IDs are written in the responses
+	traceIDFormat TraceIDFormat
+	// spanDeleter enables the admin endpoint deleting spans, at most deletionSpansPerSecond
+	spanDeleter            spanstore.Deleter
+	deletionSpansPerSecond float64
+	// deletions holds the deletion in progress, so that deletions do not add up their load on the storage
+	deletions chan struct{}
+	// statsReader enables the statistics endpoint, scanning at most statsMaxTraces of each service, and
+	// statsCache holds the recent statistics when enabled
+	statsReader    spanstore.StatsReader
+	statsMaxTraces int
+	statsCache     *cache.LRU
+	// durationReader enables the duration percentiles endpoint, sampling at most durationMaxTraces in the storages
+	// without percentile aggregations, and durationsCache holds the recent percentiles when enabled
+	durationReader    spanstore.DurationReader
+	durationMaxTraces int
+	durationsCache    *cache.LRU
+}
+
+type deletionResult struct {
+	Deleted int `json:"deleted"`
+}
+
+type traceStatsResult struct {
+	Traces     int                  `json:"traces"`
+	Spans      int                  `json:"spans"`
+	ErrorSpans int                  `json:"errorSpans"`
+	ErrorRate  float64              `json:"errorRate"`
+	Services   []serviceStatsResult `json:"services"`
+	Truncated  bool                 `json:"truncated"`
+}
+
+// durationPercentilesResult holds the percentiles in microseconds, like the durations of the spans of the traces
+type durationPercentilesResult struct {
+	Spans   int    `json:"spans"`
+	P50     uint64 `json:"p50"`
+	P90     uint64 `json:"p90"`
+	P99     uint64 `json:"p99"`
+	Sampled bool   `json:"sampled"`
+}
+
+type serviceStatsResult struct {
+	ServiceName string  `json:"serviceName"`
+	Spans       int     `json:"spans"`
+	ErrorSpans  int     `json:"errorSpans"`
+	ErrorRate   float64 `json:"errorRate"`
 }
 
 // NewAPIHandler returns an APIHandler
@@ -93,6 +155,7 @@ func NewAPIHandler(spanReader spanstore.Reader, dependencyReader dependencystore
 	aH := &APIHandler{
 		spanReader:       spanReader,
 		dependencyReader: dependencyReader,
+		deletions:        make(chan struct{}, 1),
 		queryParser: queryParser{
 			traceQueryLookbackDuration: defaultTraceQueryLookbackDuration,
 			timeNow:                    time.Now,
@@ -119,33 +182,85 @@ func NewAPIHandler(spanReader spanstore.Reader, dependencyReader dependencystore
 
 // RegisterRoutes registers routes for this handler on the given router
 func (aH *APIHandler) RegisterRoutes(router *mux.Router) {
-	aH.handleFunc(router, aH.getTrace, "/traces/{%s}", traceIDParam).Methods(http.MethodGet)
-	aH.handleFunc(router, aH.archiveTrace, "/archive/{%s}", traceIDParam).Methods(http.MethodPost)
-	aH.handleFunc(router, aH.search, "/traces").Methods(http.MethodGet)
-	aH.handleFunc(router, aH.getServices, "/services").Methods(http.MethodGet)
+	aH.handleFunc(router, (*APIHandler).getTrace, "/traces/{%s}", traceIDParam).Methods(http.MethodGet)
+	aH.handleFunc(router, (*APIHandler).archiveTrace, "/archive/{%s}", traceIDParam).Methods(http.MethodPost)
+	aH.handleFunc(router, (*APIHandler).search, "/traces").Methods(http.MethodGet)
+	aH.handleFunc(router, (*APIHandler).getServices, "/services").Methods(http.MethodGet)
 	// TODO change the UI to use this endpoint. Requires ?service= parameter.
-	aH.handleFunc(router, aH.getOperations, "/operations").Methods(http.MethodGet)
+	aH.handleFunc(router, (*APIHandler).getOperations, "/operations").Methods(http.MethodGet)
 	// TODO - remove this when UI catches up
-	aH.handleFunc(router, aH.getOperationsLegacy, "/services/{%s}/operations", serviceParam).Methods(http.MethodGet)
-	aH.handleFunc(router, aH.dependencies, "/dependencies").Methods(http.MethodGet)
+	aH.handleFunc(router, (*APIHandler).getOperationsLegacy, "/services/{%s}/operations", serviceParam).Methods(http.MethodGet)
+	aH.handleFunc(router, (*APIHandler).dependencies, "/dependencies").Methods(http.MethodGet)
+	if aH.statsReader != nil {
+		aH.handleFunc(router, (*APIHandler).getTraceStats, "/stats").Methods(http.MethodGet)
+	}
+	if aH.durationReader != nil {
+		aH.handleFunc(router, (*APIHandler).getDurationPercentiles, "/durations").Methods(http.MethodGet)
+	}
 }
 
+// RegisterAdminRoutes registers the admin routes of this handler on the given router, which must not be reachable
+// by the users of the UI
+func (aH *APIHandler) RegisterAdminRoutes(router *mux.Router) {
+	if aH.spanDeleter != nil {
+		aH.handleFunc(router, (*APIHandler).deleteSpans, "/admin/spans").Methods(http.MethodDelete)
+	}
+}
+
+// handleFunc registers f, called with the handler scoped to the tenant of the request
 func (aH *APIHandler) handleFunc(
 	router *mux.Router,
-	f func(http.ResponseWriter, *http.Request),
+	f func(*APIHandler, http.ResponseWriter, *http.Request),
 	route string,
 	args ...interface{},
 ) *mux.Route {
 	route = aH.route(route, args...)
 	traceMiddleware := nethttp.Middleware(
 		aH.tracer,
-		http.HandlerFunc(f),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scoped, err := aH.forRequest(r)
+			if aH.handleError(w, err, http.StatusBadRequest) {
+				return
+			}
+			f(scoped, w, r)
+		}),
 		nethttp.OperationNameFunc(func(r *http.Request) string {
 			return route
 		}))
 	return router.HandleFunc(route, traceMiddleware.ServeHTTP)
 }
 
+// forRequest returns a copy of the handler reading, archiving and deleting the traces of the tenant of the request
+// only, or the handler itself if multi-tenancy is disabled
+func (aH *APIHandler) forRequest(r *http.Request) (*APIHandler, error) {
+	if aH.tenantHeader == "" {
+		return aH, nil
+	}
+	tenant := r.Header.Get(aH.tenantHeader)
+	if !tenancy.ValidTenant(tenant) {
+		return nil, errInvalidTenant
+	}
+	scoped := *aH
+	scoped.spanReader = tenancy.NewReader(aH.spanReader, tenant)
+	scoped.dependencyReader = tenancy.NewDependencyReader(aH.dependencyReader, tenant)
+	if aH.archiveSpanReader != nil {
+		scoped.archiveSpanReader = tenancy.NewReader(aH.archiveSpanReader, tenant)
+	}
+	if aH.archiveSpanWriter != nil {
+		scoped.archiveSpanWriter = tenancy.NewTenantWriter(aH.archiveSpanWriter, tenant)
+	}
+	if aH.statsReader != nil {
+		scoped.statsReader = tenancy.NewStatsReader(aH.statsReader, tenant)
+	}
+	if aH.durationReader != nil {
+		scoped.durationReader = tenancy.NewDurationReader(aH.durationReader, tenant)
+	}
+	if aH.spanDeleter != nil {
+		scoped.spanDeleter = tenancy.NewDeleter(aH.spanDeleter, aH.spanReader, tenant)
+	}
+	return &scoped, nil
+}
+
 func (aH *APIHandler) route(route string, args ...interface{}) string {
 	args = append([]interface{}{aH.httpPrefix}, args...)
 	return fmt.Sprintf("/%s"+route, args...)
@@ -235,10 +350,10 @@ func (aH *APIHandler) search(w http.ResponseWriter, r *http.Request) {
 	aH.writeJSON(w, &structuredRes)
 }
 
-func (aH *APIHandler) tracesByIDs(traceIDs []model.TraceID) ([]*model.Trace, error) {
+func (aH *APIHandler) tracesByIDs(traceIDs [][]model.TraceID) ([]*model.Trace, error) {
 	retMe := make([]*model.Trace, 0, len(traceIDs))
-	for _, traceID := range traceIDs {
-		trace, err := aH.spanReader.GetTrace(traceID)
+	for _, candidates := range traceIDs {
+		trace, err := getTraceByIDs(aH.spanReader, candidates)
 		if err != nil {
 			return nil, err
 		}
@@ -247,6 +362,17 @@ func (aH *APIHandler) tracesByIDs(traceIDs []model.TraceID) ([]*model.Trace, err
 	return retMe, nil
 }
 
+// getTraceByIDs returns the trace of the first of the trace IDs a request stands for found by the reader
+func getTraceByIDs(reader spanstore.Reader, traceIDs []model.TraceID) (*model.Trace, error) {
+	for _, traceID := range traceIDs {
+		trace, err := reader.GetTrace(traceID)
+		if err != spanstore.ErrTraceNotFound {
+			return trace, err
+		}
+	}
+	return nil, spanstore.ErrTraceNotFound
+}
+
 func (aH *APIHandler) dependencies(w http.ResponseWriter, r *http.Request) {
 	endTsMillis, err := strconv.ParseInt(r.FormValue(endTsParam), 10, 64)
 	if aH.handleError(w, errors.Wrapf(err, "Unable to parse %s", endTimeParam), http.StatusBadRequest) {
@@ -280,11 +406,18 @@ func (aH *APIHandler) dependencies(w http.ResponseWriter, r *http.Request) {
 
 func (aH *APIHandler) convertModelToUI(traceFromStorage *model.Trace) (*ui.Trace, *structuredError) {
 	var errors []error
+	var completeness *ui.Completeness
+	if aH.completeness {
+		// before the adjusters, which may repair the missing parents
+		completeness = traceCompleteness(traceFromStorage, aH.requireRoot)
+	}
 	trace, err := aH.adjuster.Adjust(traceFromStorage)
 	if err != nil {
 		errors = append(errors, err)
 	}
 	uiTrace := uiconv.FromDomain(trace)
+	aH.traceIDFormat.formatTrace(uiTrace)
+	uiTrace.Completeness = completeness
 	var uiError *structuredError
 	if err := multierror.Wrap(errors); err != nil {
 		uiError = &structuredError{
@@ -331,15 +464,15 @@ func (aH *APIHandler) filterDependenciesByService(
 	return filteredDependencies
 }
 
-// Parses trace ID from URL like /traces/{trace-id}
-func (aH *APIHandler) parseTraceID(w http.ResponseWriter, r *http.Request) (model.TraceID, bool) {
+// Parses trace ID from URL like /traces/{trace-id}, into the trace IDs it can stand for
+func (aH *APIHandler) parseTraceID(w http.ResponseWriter, r *http.Request) ([]model.TraceID, bool) {
 	vars := mux.Vars(r)
 	traceIDVar := vars[traceIDParam]
-	traceID, err := model.TraceIDFromString(traceIDVar)
+	traceIDs, err := aH.traceIDFormat.parseTraceID(traceIDVar)
 	if aH.handleError(w, err, http.StatusBadRequest) {
-		return traceID, false
+		return nil, false
 	}
-	return traceID, true
+	return traceIDs, true
 }
 
 // getTrace implements the REST API /traces/{trace-id}
@@ -381,17 +514,17 @@ func (aH *APIHandler) withTraceFromReader(
 	backupReader spanstore.Reader,
 	process func(trace *model.Trace),
 ) {
-	traceID, ok := aH.parseTraceID(w, r)
+	traceIDs, ok := aH.parseTraceID(w, r)
 	if !ok {
 		return
 	}
-	trace, err := reader.GetTrace(traceID)
+	trace, err := getTraceByIDs(reader, traceIDs)
 	if err == spanstore.ErrTraceNotFound {
 		if backupReader == nil {
 			aH.handleError(w, err, http.StatusNotFound)
 			return
 		}
-		trace, err = backupReader.GetTrace(traceID)
+		trace, err = getTraceByIDs(backupReader, traceIDs)
 		if err == spanstore.ErrTraceNotFound {
 			aH.handleError(w, err, http.StatusNotFound)
 			return
@@ -430,6 +563,152 @@ func (aH *APIHandler) archiveTrace(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// deleteSpans implements the admin REST API DELETE:/admin/spans?tag=key:value&start=&end=.
+// It deletes the spans with all the tags that started in the time range, one deletion at a time.
+func (aH *APIHandler) deleteSpans(w http.ResponseWriter, r *http.Request) {
+	query, err := aH.queryParser.parseDeletion(r)
+	if aH.handleError(w, err, http.StatusBadRequest) {
+		return
+	}
+	query.SpansPerSecond = aH.deletionSpansPerSecond
+	select {
+	case aH.deletions <- struct{}{}:
+		defer func() { <-aH.deletions }()
+	default:
+		aH.handleError(w, errDeletionInProgress, http.StatusTooManyRequests)
+		return
+	}
+	deleted, err := aH.spanDeleter.DeleteSpans(query)
+	// the tags are not logged, they are the personal data being deleted
+	aH.logger.Info("Deleted spans", zap.Int("deleted", deleted), zap.Error(err))
+	if err != nil {
+		err = errors.Wrapf(err, "failed after deleting %d spans", deleted)
+	}
+	if aH.handleError(w, err, http.StatusInternalServerError) {
+		return
+	}
+	structuredRes := structuredResponse{
+		Data:   deletionResult{Deleted: deleted},
+		Errors: []structuredError{},
+	}
+	aH.writeJSON(w, &structuredRes)
+}
+
+// getTraceStats implements the REST API GET:/stats?service=&start=&end=.
+// It returns the numbers of traces, spans and error spans that started in the time range, overall and by service.
+func (aH *APIHandler) getTraceStats(w http.ResponseWriter, r *http.Request) {
+	query, err := aH.queryParser.parseStats(r)
+	if aH.handleError(w, err, http.StatusBadRequest) {
+		return
+	}
+	query.MaxTraces = aH.statsMaxTraces
+	key := fmt.Sprintf("%s|%d|%d", query.ServiceName, query.StartTimeMin.UnixNano(), query.StartTimeMax.UnixNano())
+	if aH.tenantHeader != "" {
+		key = r.Header.Get(aH.tenantHeader) + "|" + key
+	}
+	var stats *spanstore.TraceStats
+	if aH.statsCache != nil {
+		stats, _ = aH.statsCache.Get(key).(*spanstore.TraceStats)
+	}
+	if stats == nil {
+		stats, err = aH.statsReader.GetTraceStats(query)
+		statusCode := http.StatusInternalServerError
+		if err == tenancy.ErrStatsServiceNotSet {
+			statusCode = http.StatusBadRequest
+		}
+		if aH.handleError(w, err, statusCode) {
+			return
+		}
+		if aH.statsCache != nil {
+			aH.statsCache.Put(key, stats)
+		}
+	}
+	structuredRes := structuredResponse{
+		Data:   newTraceStatsResult(stats),
+		Errors: []structuredError{},
+	}
+	aH.writeJSON(w, &structuredRes)
+}
+
+func newTraceStatsResult(stats *spanstore.TraceStats) traceStatsResult {
+	result := traceStatsResult{
+		Traces:     stats.Traces,
+		Spans:      stats.Spans,
+		ErrorSpans: stats.ErrorSpans,
+		ErrorRate:  errorRate(stats.ErrorSpans, stats.Spans),
+		Services:   make([]serviceStatsResult, len(stats.Services)),
+		Truncated:  stats.Truncated,
+	}
+	for i, service := range stats.Services {
+		result.Services[i] = serviceStatsResult{
+			ServiceName: service.ServiceName,
+			Spans:       service.Spans,
+			ErrorSpans:  service.ErrorSpans,
+			ErrorRate:   errorRate(service.ErrorSpans, service.Spans),
+		}
+	}
+	return result
+}
+
+// getDurationPercentiles implements the REST API
+// GET:/durations?service=&operation=&start=&end=&minDuration=&maxDuration=&tag=.
+// It returns the p50, p90 and p99 durations of the spans of the operation that started in the time range.
+func (aH *APIHandler) getDurationPercentiles(w http.ResponseWriter, r *http.Request) {
+	query, err := aH.queryParser.parseDurations(r)
+	if aH.handleError(w, err, http.StatusBadRequest) {
+		return
+	}
+	query.MaxTraces = aH.durationMaxTraces
+	key := durationsCacheKey(query)
+	if aH.tenantHeader != "" {
+		key = r.Header.Get(aH.tenantHeader) + "|" + key
+	}
+	var percentiles *spanstore.DurationPercentiles
+	if aH.durationsCache != nil {
+		percentiles, _ = aH.durationsCache.Get(key).(*spanstore.DurationPercentiles)
+	}
+	if percentiles == nil {
+		percentiles, err = aH.durationReader.GetDurationPercentiles(query)
+		if aH.handleError(w, err, http.StatusInternalServerError) {
+			return
+		}
+		if aH.durationsCache != nil {
+			aH.durationsCache.Put(key, percentiles)
+		}
+	}
+	structuredRes := structuredResponse{
+		Data: durationPercentilesResult{
+			Spans:   percentiles.Spans,
+			P50:     model.DurationAsMicroseconds(percentiles.P50),
+			P90:     model.DurationAsMicroseconds(percentiles.P90),
+			P99:     model.DurationAsMicroseconds(percentiles.P99),
+			Sampled: percentiles.Sampled,
+		},
+		Errors: []structuredError{},
+	}
+	aH.writeJSON(w, &structuredRes)
+}
+
+// durationsCacheKey returns the key of the percentiles of the query, its tags being in a stable order
+func durationsCacheKey(query *spanstore.DurationQueryParameters) string {
+	tags := make([]string, 0, len(query.Tags))
+	for key, value := range query.Tags {
+		tags = append(tags, key+":"+value)
+	}
+	sort.Strings(tags)
+	return fmt.Sprintf("%s|%s|%d|%d|%d|%d|%s", query.ServiceName, query.OperationName,
+		query.StartTimeMin.UnixNano(), query.StartTimeMax.UnixNano(), query.DurationMin, query.DurationMax,
+		strings.Join(tags, ","))
+}
+
+// errorRate returns the fraction of the spans that are errors, 0 without spans
+func errorRate(errorSpans, spans int) float64 {
+	if spans == 0 {
+		return 0
+	}
+	return float64(errorSpans) / float64(spans)
+}
+
 func (aH *APIHandler) handleError(w http.ResponseWriter, err error, statusCode int) bool {
 	if err == nil {
 		return false
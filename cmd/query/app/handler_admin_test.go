@@ -0,0 +1,159 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/uber/jaeger/storage/spanstore"
+	spanstoremocks "github.com/uber/jaeger/storage/spanstore/mocks"
+	"github.com/uber/jaeger/storage/spanstore/tenancy"
+)
+
+// deleteJSON issues an HTTP DELETE and parses the response as JSON
+func deleteJSON(url string, out interface{}) error {
+	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	if err != nil {
+		return err
+	}
+	return execJSON(req, out)
+}
+
+// withAdminTestServer runs the test with the server of the admin routes of the handler
+func withAdminTestServer(t *testing.T, doTest func(s *testServer), options ...HandlerOption) {
+	spanReader := &spanstoremocks.Reader{}
+	handler := NewAPIHandler(spanReader, nil, options...)
+	r := mux.NewRouter()
+	handler.RegisterAdminRoutes(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+	doTest(&testServer{spanReader: spanReader, handler: handler, server: server})
+}
+
+func TestDeleteSpans_NotEnabled(t *testing.T) {
+	withAdminTestServer(t, func(ts *testServer) {
+		err := deleteJSON(ts.server.URL+"/api/admin/spans?tag=user.id:x&start=1&end=2", nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestDeleteSpans_NotOnAPIRoutes(t *testing.T) {
+	deleter := &spanstoremocks.Deleter{}
+	withTestServer(t, func(ts *testServer) {
+		err := deleteJSON(ts.server.URL+"/api/admin/spans?tag=user.id:x&start=1&end=2", nil)
+		assert.Error(t, err)
+		deleter.AssertNotCalled(t, "DeleteSpans", mock.Anything)
+	}, HandlerOptions.SpanDeleter(deleter, 0))
+}
+
+func TestDeleteSpans_Tenancy(t *testing.T) {
+	deleter := &spanstoremocks.Deleter{}
+	deleter.On("DeleteSpans", mock.MatchedBy(func(q *spanstore.DeleteQueryParameters) bool {
+		return len(q.ServiceNames) == 1 && q.ServiceNames[0] == tenancy.ServiceName("acme", "frontend")
+	})).Return(1, nil).Once()
+	withAdminTestServer(t, func(ts *testServer) {
+		ts.spanReader.On("GetServices").Return([]string{
+			tenancy.ServiceName("acme", "frontend"),
+			tenancy.ServiceName("other", "frontend"),
+		}, nil)
+
+		req, err := http.NewRequest(http.MethodDelete, ts.server.URL+"/api/admin/spans?tag=user.id:x&start=1&end=2", nil)
+		assert.NoError(t, err)
+		req.Header.Set("X-Tenant", "acme")
+		var response structuredResponse
+		assert.NoError(t, execJSON(req, &response))
+		assert.Equal(t, map[string]interface{}{"deleted": float64(1)}, response.Data)
+
+		err = deleteJSON(ts.server.URL+"/api/admin/spans?tag=user.id:x&start=1&end=2", nil)
+		assert.EqualError(t, err, `400 error from server: {"data":null,"total":0,"limit":0,"offset":0,"errors":[{"code":400,"msg":"missing or invalid tenant header"}]}`+"\n")
+	}, HandlerOptions.SpanDeleter(deleter, 0), HandlerOptions.Tenancy("X-Tenant"))
+	deleter.AssertExpectations(t)
+}
+
+func TestDeleteSpans_Success(t *testing.T) {
+	deleter := &spanstoremocks.Deleter{}
+	deleter.On("DeleteSpans", mock.MatchedBy(func(q *spanstore.DeleteQueryParameters) bool {
+		return q.Tags["user.id"] == "x:y" &&
+			q.StartTimeMin.Equal(time.Unix(0, 1000)) &&
+			q.StartTimeMax.Equal(time.Unix(0, 2000)) &&
+			q.SpansPerSecond == 50
+	})).Return(3, nil).Once()
+	withAdminTestServer(t, func(ts *testServer) {
+		var response structuredResponse
+		err := deleteJSON(ts.server.URL+"/api/admin/spans?tag=user.id:x:y&start=1&end=2", &response)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"deleted": float64(3)}, response.Data)
+	}, HandlerOptions.SpanDeleter(deleter, 50))
+	deleter.AssertExpectations(t)
+}
+
+func TestDeleteSpans_Errors(t *testing.T) {
+	testCases := []struct {
+		query       string
+		deleted     int
+		deleteErr   error
+		expectedErr string
+	}{
+		{
+			query:       "tag=user.id:x&start=1",
+			expectedErr: `400 error from server: {"data":null,"total":0,"limit":0,"offset":0,"errors":[{"code":400,"msg":"Parameters 'start' and 'end' are required to delete spans"}]}` + "\n",
+		},
+		{
+			query:       "start=1&end=2",
+			expectedErr: `400 error from server: {"data":null,"total":0,"limit":0,"offset":0,"errors":[{"code":400,"msg":"Tags must be set to delete spans"}]}` + "\n",
+		},
+		{
+			query:       "tag=user.id:x&start=1&end=2",
+			deleted:     2,
+			deleteErr:   errors.New("storage error"),
+			expectedErr: `500 error from server: {"data":null,"total":0,"limit":0,"offset":0,"errors":[{"code":500,"msg":"failed after deleting 2 spans: storage error"}]}` + "\n",
+		},
+	}
+	for _, tc := range testCases {
+		testCase := tc // capture loop var
+		t.Run(testCase.query, func(t *testing.T) {
+			deleter := &spanstoremocks.Deleter{}
+			deleter.On("DeleteSpans", mock.Anything).Return(testCase.deleted, testCase.deleteErr)
+			withAdminTestServer(t, func(ts *testServer) {
+				err := deleteJSON(ts.server.URL+"/api/admin/spans?"+testCase.query, nil)
+				assert.EqualError(t, err, testCase.expectedErr)
+			}, HandlerOptions.SpanDeleter(deleter, 0))
+		})
+	}
+}
+
+func TestDeleteSpans_InProgress(t *testing.T) {
+	deleter := &spanstoremocks.Deleter{}
+	withAdminTestServer(t, func(ts *testServer) {
+		ts.handler.deletions <- struct{}{}
+		err := deleteJSON(ts.server.URL+"/api/admin/spans?tag=user.id:x&start=1&end=2", nil)
+		assert.EqualError(t, err, `429 error from server: {"data":null,"total":0,"limit":0,"offset":0,"errors":[{"code":429,"msg":"another deletion of spans is in progress"}]}`+"\n")
+		deleter.AssertNotCalled(t, "DeleteSpans", mock.Anything)
+	}, HandlerOptions.SpanDeleter(deleter, 0))
+}
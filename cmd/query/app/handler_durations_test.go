@@ -0,0 +1,141 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/jaeger/storage/spanstore"
+	spanstoremocks "github.com/uber/jaeger/storage/spanstore/mocks"
+)
+
+var testDurationPercentiles = &spanstore.DurationPercentiles{
+	Spans:   100,
+	P50:     1500 * time.Microsecond,
+	P90:     20 * time.Millisecond,
+	P99:     time.Second,
+	Sampled: true,
+}
+
+func TestGetDurationPercentiles_NotEnabled(t *testing.T) {
+	withTestServer(t, func(ts *testServer) {
+		err := getJSON(ts.server.URL+"/api/durations?service=backend&operation=GET&start=1&end=2", nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestGetDurationPercentiles_Success(t *testing.T) {
+	durationReader := &spanstoremocks.DurationReader{}
+	durationReader.On("GetDurationPercentiles", mock.MatchedBy(func(q *spanstore.DurationQueryParameters) bool {
+		return q.ServiceName == "backend" &&
+			q.OperationName == "GET" &&
+			q.StartTimeMin.Equal(time.Unix(0, 1000)) &&
+			q.StartTimeMax.Equal(time.Unix(0, 2000)) &&
+			q.DurationMin == time.Millisecond &&
+			q.DurationMax == time.Second &&
+			q.Tags["http.status_code"] == "200" &&
+			q.MaxTraces == 50
+	})).Return(testDurationPercentiles, nil).Once()
+	withTestServer(t, func(ts *testServer) {
+		var response structuredResponse
+		err := getJSON(ts.server.URL+"/api/durations?service=backend&operation=GET&start=1&end=2&minDuration=1ms&maxDuration=1s&tag=http.status_code:200", &response)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"spans":   float64(100),
+			"p50":     float64(1500),
+			"p90":     float64(20000),
+			"p99":     float64(1000000),
+			"sampled": true,
+		}, response.Data)
+	}, HandlerOptions.DurationReader(durationReader, 50, 0))
+	durationReader.AssertExpectations(t)
+}
+
+func TestGetDurationPercentiles_Cached(t *testing.T) {
+	durationReader := &spanstoremocks.DurationReader{}
+	durationReader.On("GetDurationPercentiles", mock.Anything).Return(testDurationPercentiles, nil)
+	withTestServer(t, func(ts *testServer) {
+		for _, query := range []string{
+			"service=backend&operation=GET&start=1&end=2&tag=a:1&tag=b:2",
+			"service=backend&operation=GET&start=1&end=2&tag=b:2&tag=a:1",
+			"service=backend&operation=GET&start=1&end=2",
+		} {
+			assert.NoError(t, getJSON(ts.server.URL+"/api/durations?"+query, nil))
+		}
+	}, HandlerOptions.DurationReader(durationReader, 0, time.Minute))
+	durationReader.AssertNumberOfCalls(t, "GetDurationPercentiles", 2)
+}
+
+func TestGetDurationPercentiles_Errors(t *testing.T) {
+	testCases := []struct {
+		query        string
+		durationsErr error
+		expectedErr  string
+	}{
+		{
+			query:       "service=backend&start=1&end=2",
+			expectedErr: `400 error from server: {"data":null,"total":0,"limit":0,"offset":0,"errors":[{"code":400,"msg":"Parameters 'service', 'operation', 'start' and 'end' are required to compute duration percentiles"}]}` + "\n",
+		},
+		{
+			query:       "service=backend&operation=GET&start=2&end=1",
+			expectedErr: `400 error from server: {"data":null,"total":0,"limit":0,"offset":0,"errors":[{"code":400,"msg":"Start Time Minimum is above Maximum"}]}` + "\n",
+		},
+		{
+			query:        "service=backend&operation=GET&start=1&end=2",
+			durationsErr: errors.New("storage error"),
+			expectedErr:  `500 error from server: {"data":null,"total":0,"limit":0,"offset":0,"errors":[{"code":500,"msg":"storage error"}]}` + "\n",
+		},
+	}
+	for _, tc := range testCases {
+		testCase := tc // capture loop var
+		t.Run(testCase.query, func(t *testing.T) {
+			durationReader := &spanstoremocks.DurationReader{}
+			durationReader.On("GetDurationPercentiles", mock.Anything).Return(nil, testCase.durationsErr)
+			withTestServer(t, func(ts *testServer) {
+				err := getJSON(ts.server.URL+"/api/durations?"+testCase.query, nil)
+				assert.EqualError(t, err, testCase.expectedErr)
+			}, HandlerOptions.DurationReader(durationReader, 0, time.Minute))
+		})
+	}
+}
+
+func TestGetDurationPercentiles_Tenancy(t *testing.T) {
+	durationReader := &spanstoremocks.DurationReader{}
+	durationReader.On("GetDurationPercentiles", mock.MatchedBy(func(q *spanstore.DurationQueryParameters) bool {
+		return q.ServiceName == "payments/trifle"
+	})).Return(testDurationPercentiles, nil).Once()
+	withTestServer(t, func(ts *testServer) {
+		req, err := http.NewRequest(http.MethodGet, ts.server.URL+"/api/durations?service=trifle&operation=GET&start=1&end=2", nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Tenant", "payments")
+		var response structuredResponse
+		require.NoError(t, execJSON(req, &response))
+		assert.Equal(t, float64(100), response.Data.(map[string]interface{})["spans"])
+	}, HandlerOptions.DurationReader(durationReader, 0, 0), HandlerOptions.Tenancy("X-Tenant"))
+	durationReader.AssertExpectations(t)
+}
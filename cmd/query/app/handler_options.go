@@ -27,6 +27,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/uber/jaeger/model/adjuster"
+	"github.com/uber/jaeger/pkg/cache"
 	"github.com/uber/jaeger/storage/spanstore"
 )
 
@@ -87,3 +88,67 @@ func (handlerOptions) Tracer(tracer opentracing.Tracer) HandlerOption {
 		apiHandler.tracer = tracer
 	}
 }
+
+// Completeness creates a HandlerOption that hints whether spans of the returned traces are missing, e.g. because
+// they are still being written. Traces without a root span are only incomplete if requireRoot is set or if they
+// miss more than one referenced span, so that asynchronous flows are not flagged.
+func (handlerOptions) Completeness(requireRoot bool) HandlerOption {
+	return func(apiHandler *APIHandler) {
+		apiHandler.completeness = true
+		apiHandler.requireRoot = requireRoot
+	}
+}
+
+// TraceIDFormat creates a HandlerOption that writes the trace IDs of the responses in the given format. The trace
+// IDs of the requests are accepted in all the formats.
+func (handlerOptions) TraceIDFormat(format TraceIDFormat) HandlerOption {
+	return func(apiHandler *APIHandler) {
+		apiHandler.traceIDFormat = format
+		apiHandler.queryParser.traceIDFormat = format
+	}
+}
+
+// SpanDeleter creates a HandlerOption that enables the admin endpoint deleting the spans matching tags, at most
+// spansPerSecond, or unbounded if 0. The endpoint is registered by RegisterAdminRoutes.
+func (handlerOptions) SpanDeleter(deleter spanstore.Deleter, spansPerSecond float64) HandlerOption {
+	return func(apiHandler *APIHandler) {
+		apiHandler.spanDeleter = deleter
+		apiHandler.deletionSpansPerSecond = spansPerSecond
+	}
+}
+
+// StatsReader creates a HandlerOption that enables the endpoint of the statistics of the spans over a time range,
+// the storages without aggregations scanning at most maxTraces of each service, and caching the statistics for
+// cacheTTL, or not at all if 0. With multi-tenancy, the statistics of a service of the tenant are required.
+func (handlerOptions) StatsReader(reader spanstore.StatsReader, maxTraces int, cacheTTL time.Duration) HandlerOption {
+	return func(apiHandler *APIHandler) {
+		apiHandler.statsReader = reader
+		apiHandler.statsMaxTraces = maxTraces
+		apiHandler.statsCache = nil
+		if cacheTTL > 0 {
+			apiHandler.statsCache = cache.NewLRUWithOptions(statsCacheSize, &cache.Options{TTL: cacheTTL})
+		}
+	}
+}
+
+// DurationReader creates a HandlerOption that enables the endpoint of the duration percentiles of the spans of an
+// operation over a time range, the storages without percentile aggregations sampling at most maxTraces, and caching
+// the percentiles for cacheTTL, or not at all if 0.
+func (handlerOptions) DurationReader(reader spanstore.DurationReader, maxTraces int, cacheTTL time.Duration) HandlerOption {
+	return func(apiHandler *APIHandler) {
+		apiHandler.durationReader = reader
+		apiHandler.durationMaxTraces = maxTraces
+		apiHandler.durationsCache = nil
+		if cacheTTL > 0 {
+			apiHandler.durationsCache = cache.NewLRUWithOptions(durationsCacheSize, &cache.Options{TTL: cacheTTL})
+		}
+	}
+}
+
+// Tenancy creates a HandlerOption that scopes the reads, the archived and the deleted traces, of each request to
+// the tenant of the given request header. The requests without a valid tenant are rejected.
+func (handlerOptions) Tenancy(header string) HandlerOption {
+	return func(apiHandler *APIHandler) {
+		apiHandler.tenantHeader = header
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/jaeger/storage/spanstore"
+	spanstoremocks "github.com/uber/jaeger/storage/spanstore/mocks"
+)
+
+var testTraceStats = &spanstore.TraceStats{
+	Traces:     2,
+	Spans:      4,
+	ErrorSpans: 1,
+	Services: []spanstore.ServiceStats{
+		{ServiceName: "backend", Spans: 4, ErrorSpans: 1},
+		{ServiceName: "frontend"},
+	},
+	Truncated: true,
+}
+
+func TestGetTraceStats_NotEnabled(t *testing.T) {
+	withTestServer(t, func(ts *testServer) {
+		err := getJSON(ts.server.URL+"/api/stats?start=1&end=2", nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestGetTraceStats_Success(t *testing.T) {
+	statsReader := &spanstoremocks.StatsReader{}
+	statsReader.On("GetTraceStats", mock.MatchedBy(func(q *spanstore.StatsQueryParameters) bool {
+		return q.ServiceName == "backend" &&
+			q.StartTimeMin.Equal(time.Unix(0, 1000)) &&
+			q.StartTimeMax.Equal(time.Unix(0, 2000)) &&
+			q.MaxTraces == 50
+	})).Return(testTraceStats, nil).Once()
+	withTestServer(t, func(ts *testServer) {
+		var response structuredResponse
+		err := getJSON(ts.server.URL+"/api/stats?service=backend&start=1&end=2", &response)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"traces":     float64(2),
+			"spans":      float64(4),
+			"errorSpans": float64(1),
+			"errorRate":  0.25,
+			"services": []interface{}{
+				map[string]interface{}{"serviceName": "backend", "spans": float64(4), "errorSpans": float64(1), "errorRate": 0.25},
+				map[string]interface{}{"serviceName": "frontend", "spans": float64(0), "errorSpans": float64(0), "errorRate": float64(0)},
+			},
+			"truncated": true,
+		}, response.Data)
+	}, HandlerOptions.StatsReader(statsReader, 50, 0))
+	statsReader.AssertExpectations(t)
+}
+
+func TestGetTraceStats_Cached(t *testing.T) {
+	statsReader := &spanstoremocks.StatsReader{}
+	statsReader.On("GetTraceStats", mock.Anything).Return(testTraceStats, nil)
+	withTestServer(t, func(ts *testServer) {
+		for _, query := range []string{"start=1&end=2", "start=1&end=2", "service=backend&start=1&end=2"} {
+			assert.NoError(t, getJSON(ts.server.URL+"/api/stats?"+query, nil))
+		}
+	}, HandlerOptions.StatsReader(statsReader, 0, time.Minute))
+	statsReader.AssertNumberOfCalls(t, "GetTraceStats", 2)
+}
+
+func TestGetTraceStats_Errors(t *testing.T) {
+	testCases := []struct {
+		query       string
+		statsErr    error
+		expectedErr string
+	}{
+		{
+			query:       "start=1",
+			expectedErr: `400 error from server: {"data":null,"total":0,"limit":0,"offset":0,"errors":[{"code":400,"msg":"Parameters 'start' and 'end' are required to compute statistics"}]}` + "\n",
+		},
+		{
+			query:       "start=2&end=1",
+			expectedErr: `400 error from server: {"data":null,"total":0,"limit":0,"offset":0,"errors":[{"code":400,"msg":"Start Time Minimum is above Maximum"}]}` + "\n",
+		},
+		{
+			query:       "start=1&end=2",
+			statsErr:    errors.New("storage error"),
+			expectedErr: `500 error from server: {"data":null,"total":0,"limit":0,"offset":0,"errors":[{"code":500,"msg":"storage error"}]}` + "\n",
+		},
+	}
+	for _, tc := range testCases {
+		testCase := tc // capture loop var
+		t.Run(testCase.query, func(t *testing.T) {
+			statsReader := &spanstoremocks.StatsReader{}
+			statsReader.On("GetTraceStats", mock.Anything).Return(nil, testCase.statsErr)
+			withTestServer(t, func(ts *testServer) {
+				err := getJSON(ts.server.URL+"/api/stats?"+testCase.query, nil)
+				assert.EqualError(t, err, testCase.expectedErr)
+			}, HandlerOptions.StatsReader(statsReader, 0, time.Minute))
+		})
+	}
+}
+
+func TestGetTraceStats_Tenancy(t *testing.T) {
+	statsReader := &spanstoremocks.StatsReader{}
+	statsReader.On("GetTraceStats", mock.MatchedBy(func(q *spanstore.StatsQueryParameters) bool {
+		return q.ServiceName == "payments/trifle"
+	})).Return(&spanstore.TraceStats{
+		Spans:    1,
+		Services: []spanstore.ServiceStats{{ServiceName: "payments/trifle", Spans: 1}},
+	}, nil).Once()
+	withTestServer(t, func(ts *testServer) {
+		req, err := http.NewRequest(http.MethodGet, ts.server.URL+"/api/stats?service=trifle&start=1&end=2", nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Tenant", "payments")
+		var response structuredResponse
+		require.NoError(t, execJSON(req, &response))
+		services := response.Data.(map[string]interface{})["services"].([]interface{})
+		assert.Equal(t, "trifle", services[0].(map[string]interface{})["serviceName"])
+
+		// the statistics of all the services include those of the other tenants
+		req, err = http.NewRequest(http.MethodGet, ts.server.URL+"/api/stats?start=1&end=2", nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Tenant", "payments")
+		err = execJSON(req, &response)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "400 error from server")
+		}
+	}, HandlerOptions.StatsReader(statsReader, 0, 0), HandlerOptions.Tenancy("X-Tenant"))
+	statsReader.AssertExpectations(t)
+}
@@ -35,6 +35,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 
 	jaeger "github.com/uber/jaeger-client-go"
@@ -143,6 +144,19 @@ func TestGetTraceSuccess(t *testing.T) {
 	assert.Len(t, response.Errors, 0)
 }
 
+func TestGetTraceCompleteness(t *testing.T) {
+	server, readMock, _ := initializeTestServer(HandlerOptions.Completeness(true))
+	defer server.Close()
+	readMock.On("GetTrace", mock.AnythingOfType("model.TraceID")).
+		Return(mockTrace, nil).Once()
+
+	var response structuredTraceResponse
+	err := getJSON(server.URL+`/api/traces/123456`, &response)
+	assert.NoError(t, err)
+	require.Len(t, response.Traces, 1)
+	assert.Equal(t, &ui.Completeness{Status: ui.CompleteTrace}, response.Traces[0].Completeness)
+}
+
 func TestTracing(t *testing.T) {
 	reporter := jaeger.NewInMemoryReporter()
 	jaegerTracer, jaegerCloser := jaeger.NewTracer("test", jaeger.NewConstSampler(true), reporter)
@@ -176,8 +190,9 @@ func TestGetTraceDBFailure(t *testing.T) {
 func TestGetTraceNotFound(t *testing.T) {
 	server, readMock, _ := initializeTestServer()
 	defer server.Close()
+	// the ID is looked up in hex and then as a decimal number
 	readMock.On("GetTrace", mock.AnythingOfType("model.TraceID")).
-		Return(nil, spanstore.ErrTraceNotFound).Once()
+		Return(nil, spanstore.ErrTraceNotFound).Twice()
 
 	var response structuredResponse
 	err := getJSON(server.URL+`/api/traces/123456`, &response)
@@ -345,6 +360,31 @@ func TestGetServicesStorageFailure(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestGetServicesTenancy(t *testing.T) {
+	server, readMock, _ := initializeTestServer(HandlerOptions.Tenancy("X-Tenant"))
+	defer server.Close()
+	readMock.On("GetServices").Return([]string{"payments/trifle", "search/bling", "bling"}, nil).Once()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/api/services", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Tenant", "payments")
+	var response structuredResponse
+	require.NoError(t, execJSON(req, &response))
+	assert.Equal(t, []interface{}{"trifle"}, response.Data)
+
+	for _, tenant := range []string{"", "payments/search"} {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/api/services", nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Tenant", tenant)
+		err = execJSON(req, &response)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "400 error from server")
+			assert.Contains(t, err.Error(), errInvalidTenant.Error())
+		}
+	}
+	readMock.AssertExpectations(t)
+}
+
 func TestGetOperationsSuccess(t *testing.T) {
 	server, mock, _ := initializeTestServer()
 	defer server.Close()
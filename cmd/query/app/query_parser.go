@@ -37,6 +37,7 @@ const (
 	defaultQueryLimit = 100
 
 	operationParam   = "operation"
+	spanKindParam    = "spanKind"
 	tagParam         = "tag"
 	startTimeParam   = "start"
 	limitParam       = "limit"
@@ -50,6 +51,10 @@ var (
 	errCannotQueryTagAndDuration = fmt.Errorf("Cannot query for tags when '%s' is specified", minDurationParam)
 	errMaxDurationGreaterThanMin = fmt.Errorf("'%s' should be greater than '%s'", maxDurationParam, minDurationParam)
 
+	errDeletionTimeRangeRequired = fmt.Errorf("Parameters '%s' and '%s' are required to delete spans", startTimeParam, endTimeParam)
+	errStatsTimeRangeRequired    = fmt.Errorf("Parameters '%s' and '%s' are required to compute statistics", startTimeParam, endTimeParam)
+	errDurationsParamsRequired   = fmt.Errorf("Parameters '%s', '%s', '%s' and '%s' are required to compute duration percentiles", serviceParam, operationParam, startTimeParam, endTimeParam)
+
 	// ErrServiceParameterRequired occurs when no service name is defined
 	ErrServiceParameterRequired = fmt.Errorf("Parameter '%s' is required", serviceParam)
 )
@@ -58,19 +63,22 @@ var (
 type queryParser struct {
 	traceQueryLookbackDuration time.Duration
 	timeNow                    func() time.Time
+	traceIDFormat              TraceIDFormat
 }
 
 type traceQueryParameters struct {
 	spanstore.TraceQueryParameters
-	traceIDs []model.TraceID
+	// traceIDs are the trace IDs each traceID parameter can stand for, in the order they are looked up
+	traceIDs [][]model.TraceID
 }
 
 // parse takes a request and constructs a model of parameters
 // Trace query syntax:
 //     query ::= param | param '&' query
-//     param ::= service | operation | limit | start | end | minDuration | maxDuration | tag
+//     param ::= service | operation | spanKind | limit | start | end | minDuration | maxDuration | tag
 //     service ::= 'service=' strValue
 //     operation ::= 'operation=' strValue
+//     spanKind ::= 'spanKind=' ('client' | 'server' | 'producer' | 'consumer' | 'internal' | 'unspecified')
 //     limit ::= 'limit=' intValue
 //     start ::= 'start=' intValue in unix microseconds
 //     end ::= 'end=' intValue in unix microseconds
@@ -83,6 +91,15 @@ func (p *queryParser) parse(r *http.Request) (*traceQueryParameters, error) {
 	service := r.FormValue(serviceParam)
 	operation := r.FormValue(operationParam)
 
+	var spanKind model.SpanKind
+	if value := r.FormValue(spanKindParam); value != "" {
+		kind, err := model.SpanKindFromString(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Could not parse %s", spanKindParam)
+		}
+		spanKind = kind
+	}
+
 	startTime, err := p.parseTime(startTimeParam, r)
 	if err != nil {
 		return nil, err
@@ -122,10 +139,10 @@ func (p *queryParser) parse(r *http.Request) (*traceQueryParameters, error) {
 		return nil, err
 	}
 
-	var traceIDs []model.TraceID
+	var traceIDs [][]model.TraceID
 	for _, id := range r.Form[traceIDParam] {
-		if traceID, err := model.TraceIDFromString(id); err == nil {
-			traceIDs = append(traceIDs, traceID)
+		if candidates, err := p.traceIDFormat.parseTraceID(id); err == nil {
+			traceIDs = append(traceIDs, candidates)
 		} else {
 			return nil, errors.Wrap(err, "cannot parse traceID param")
 		}
@@ -135,6 +152,7 @@ func (p *queryParser) parse(r *http.Request) (*traceQueryParameters, error) {
 		TraceQueryParameters: spanstore.TraceQueryParameters{
 			ServiceName:   service,
 			OperationName: operation,
+			SpanKind:      spanKind,
 			StartTimeMin:  startTime,
 			StartTimeMax:  endTime,
 			Tags:          tags,
@@ -151,6 +169,129 @@ func (p *queryParser) parse(r *http.Request) (*traceQueryParameters, error) {
 	return traceQuery, nil
 }
 
+// parseDeletion takes a request and constructs the parameters of a deletion of spans
+// Deletion syntax:
+//     query ::= param | param '&' query
+//     param ::= start | end | tag
+//     start ::= 'start=' intValue in unix microseconds
+//     end ::= 'end=' intValue in unix microseconds
+//     tag ::= 'tag=' keyValue
+//     keyValue := strValue ':' strValue
+// The time range and a tag are required, so that a deletion never defaults to all the recent spans.
+func (p *queryParser) parseDeletion(r *http.Request) (*spanstore.DeleteQueryParameters, error) {
+	if r.FormValue(startTimeParam) == "" || r.FormValue(endTimeParam) == "" {
+		return nil, errDeletionTimeRangeRequired
+	}
+	startTime, err := p.parseTime(startTimeParam, r)
+	if err != nil {
+		return nil, err
+	}
+	endTime, err := p.parseTime(endTimeParam, r)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := p.parseTags(r.Form[tagParam])
+	if err != nil {
+		return nil, err
+	}
+	query := &spanstore.DeleteQueryParameters{
+		Tags:         tags,
+		StartTimeMin: startTime,
+		StartTimeMax: endTime,
+	}
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	return query, nil
+}
+
+// parseStats takes a request and constructs the parameters of the statistics of the spans
+// Statistics syntax:
+//     query ::= param | param '&' query
+//     param ::= service | start | end
+//     service ::= 'service=' strValue
+//     start ::= 'start=' intValue in unix microseconds
+//     end ::= 'end=' intValue in unix microseconds
+// The time range is required, so that the same statistics can be cached.
+func (p *queryParser) parseStats(r *http.Request) (*spanstore.StatsQueryParameters, error) {
+	if r.FormValue(startTimeParam) == "" || r.FormValue(endTimeParam) == "" {
+		return nil, errStatsTimeRangeRequired
+	}
+	startTime, err := p.parseTime(startTimeParam, r)
+	if err != nil {
+		return nil, err
+	}
+	endTime, err := p.parseTime(endTimeParam, r)
+	if err != nil {
+		return nil, err
+	}
+	query := &spanstore.StatsQueryParameters{
+		ServiceName:  r.FormValue(serviceParam),
+		StartTimeMin: startTime,
+		StartTimeMax: endTime,
+	}
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	return query, nil
+}
+
+// parseDurations takes a request and constructs the parameters of the duration percentiles of an operation
+// Duration percentiles syntax:
+//     query ::= param | param '&' query
+//     param ::= service | operation | start | end | minDuration | maxDuration | tag
+//     service ::= 'service=' strValue
+//     operation ::= 'operation=' strValue
+//     start ::= 'start=' intValue in unix microseconds
+//     end ::= 'end=' intValue in unix microseconds
+//     minDuration ::= 'minDuration=' strValue (units are "ns", "us" (or "µs"), "ms", "s", "m", "h")
+//     maxDuration ::= 'maxDuration=' strValue (units are "ns", "us" (or "µs"), "ms", "s", "m", "h")
+//     tag ::= 'tag=' keyvalue
+//     keyValue := strValue ':' strValue
+// The service, operation and time range are required, so that the same percentiles can be cached. The
+// durations and tags are filtered like in the trace search, though the tags can be combined with the minimum
+// duration, the storages that cannot do it returning an error.
+func (p *queryParser) parseDurations(r *http.Request) (*spanstore.DurationQueryParameters, error) {
+	for _, param := range []string{serviceParam, operationParam, startTimeParam, endTimeParam} {
+		if r.FormValue(param) == "" {
+			return nil, errDurationsParamsRequired
+		}
+	}
+	startTime, err := p.parseTime(startTimeParam, r)
+	if err != nil {
+		return nil, err
+	}
+	endTime, err := p.parseTime(endTimeParam, r)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := p.parseTags(r.Form[tagParam])
+	if err != nil {
+		return nil, err
+	}
+	minDuration, err := p.parseDuration(minDurationParam, r)
+	if err != nil {
+		return nil, err
+	}
+	maxDuration, err := p.parseDuration(maxDurationParam, r)
+	if err != nil {
+		return nil, err
+	}
+	query := &spanstore.DurationQueryParameters{
+		ServiceName:   r.FormValue(serviceParam),
+		OperationName: r.FormValue(operationParam),
+		Tags:          tags,
+		StartTimeMin:  startTime,
+		StartTimeMax:  endTime,
+		DurationMin:   minDuration,
+		DurationMax:   maxDuration,
+	}
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	return query, nil
+}
+
 func (p *queryParser) parseTime(param string, r *http.Request) (time.Time, error) {
 	value := r.FormValue(param)
 	if value == "" {
@@ -50,6 +50,19 @@ func TestParseTraceQuery(t *testing.T) {
 		{"x?service=service&start=0&end=0&operation=operation&limit=200&tag=k:v&minDuration=1s", `Cannot query for tags when 'minDuration' is specified`, nil},
 		{"x?service=service&start=0&end=0&operation=operation&limit=200&tag=k:v&tag=x:y&tag=k&log=k:v&log=k", `Malformed 'tag' parameter, expecting key:value, received: k`, nil},
 		{"x?service=service&start=0&end=0&operation=operation&limit=200&minDuration=25s&maxDuration=1s", `'maxDuration' should be greater than 'minDuration'`, nil},
+		{"x?service=service&start=0&end=0&spanKind=rpc", `Could not parse spanKind: Unknown span kind "rpc"`, nil},
+		{"x?service=service&start=0&end=0&spanKind=client&limit=200", ``,
+			&traceQueryParameters{
+				TraceQueryParameters: spanstore.TraceQueryParameters{
+					ServiceName:  "service",
+					SpanKind:     model.SpanKindClient,
+					StartTimeMin: time.Unix(0, 0),
+					StartTimeMax: time.Unix(0, 0),
+					NumTraces:    200,
+					Tags:         make(map[string]string),
+				},
+			},
+		},
 		{"x?service=service&start=0&end=0&operation=operation&limit=200&tag=k:v&tag=x:y", ``,
 			&traceQueryParameters{
 				TraceQueryParameters: spanstore.TraceQueryParameters{
@@ -97,9 +110,9 @@ func TestParseTraceQuery(t *testing.T) {
 					StartTimeMax: timeNow,
 					Tags:         make(map[string]string),
 				},
-				traceIDs: []model.TraceID{
-					{Low: 0x100},
-					{Low: 0x200},
+				traceIDs: [][]model.TraceID{
+					{{Low: 0x100}, {Low: 100}},
+					{{Low: 0x200}, {Low: 200}},
 				},
 			},
 		},
@@ -111,9 +124,9 @@ func TestParseTraceQuery(t *testing.T) {
 					NumTraces:    100,
 					Tags:         make(map[string]string),
 				},
-				traceIDs: []model.TraceID{
-					{Low: 0x100},
-					{Low: 0x200},
+				traceIDs: [][]model.TraceID{
+					{{Low: 0x100}},
+					{{Low: 0x200}},
 				},
 			},
 		},
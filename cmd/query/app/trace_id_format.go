@@ -0,0 +1,135 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"fmt"
+
+	"github.com/uber/jaeger/model"
+	ui "github.com/uber/jaeger/model/json"
+)
+
+// TraceIDFormat is how the trace IDs are written in the responses of the query service
+type TraceIDFormat string
+
+const (
+	// CompactTraceIDFormat writes the trace IDs in hex without leading zeros
+	CompactTraceIDFormat TraceIDFormat = "compact"
+	// HexTraceIDFormat writes the trace IDs as 32 hex characters, zero padded
+	HexTraceIDFormat TraceIDFormat = "hex"
+	// DecimalTraceIDFormat writes the 128-bit trace IDs as decimal numbers
+	DecimalTraceIDFormat TraceIDFormat = "decimal"
+
+	// maxHexTraceIDLength is the number of hex characters of a 128-bit trace ID
+	maxHexTraceIDLength = 32
+)
+
+// ParseTraceIDFormat returns the TraceIDFormat with the given name, empty meaning CompactTraceIDFormat
+func ParseTraceIDFormat(name string) (TraceIDFormat, error) {
+	switch format := TraceIDFormat(name); format {
+	case "":
+		return CompactTraceIDFormat, nil
+	case CompactTraceIDFormat, HexTraceIDFormat, DecimalTraceIDFormat:
+		return format, nil
+	default:
+		return "", fmt.Errorf("Unknown trace ID format %q", name)
+	}
+}
+
+// formatTraceID writes the trace ID in the format
+func (f TraceIDFormat) formatTraceID(traceID model.TraceID) string {
+	switch f {
+	case HexTraceIDFormat:
+		return traceID.PaddedString()
+	case DecimalTraceIDFormat:
+		return traceID.DecimalString()
+	default:
+		return traceID.String()
+	}
+}
+
+// parseTraceID returns the trace IDs s stands for, in the order they are to be looked up. All the formats are
+// accepted whatever the format of the responses: the IDs of only decimal digits stand for both a hex and
+// a decimal trace ID, the one of the format of the responses being looked up first, the hex one with the
+// compact and hex formats. The IDs too long for hex are only read as decimal, and the others only in hex.
+func (f TraceIDFormat) parseTraceID(s string) ([]model.TraceID, error) {
+	if !isDecimal(s) {
+		traceID, err := model.TraceIDFromString(s)
+		if err != nil {
+			return nil, err
+		}
+		return []model.TraceID{traceID}, nil
+	}
+	decimalTraceID, err := model.TraceIDFromDecimalString(s)
+	if len(s) > maxHexTraceIDLength {
+		if err != nil {
+			return nil, err
+		}
+		return []model.TraceID{decimalTraceID}, nil
+	}
+	hexTraceID, hexErr := model.TraceIDFromString(s)
+	if hexErr != nil {
+		return nil, hexErr
+	}
+	if err != nil || decimalTraceID == hexTraceID {
+		return []model.TraceID{hexTraceID}, nil
+	}
+	if f == DecimalTraceIDFormat {
+		return []model.TraceID{decimalTraceID, hexTraceID}, nil
+	}
+	return []model.TraceID{hexTraceID, decimalTraceID}, nil
+}
+
+// formatTrace rewrites the trace IDs of the trace converted to the UI model, which are in the compact format
+func (f TraceIDFormat) formatTrace(trace *ui.Trace) {
+	if f == CompactTraceIDFormat || f == "" {
+		return
+	}
+	trace.TraceID = f.formatUITraceID(trace.TraceID)
+	for i := range trace.Spans {
+		span := &trace.Spans[i]
+		span.TraceID = f.formatUITraceID(span.TraceID)
+		for j := range span.References {
+			span.References[j].TraceID = f.formatUITraceID(span.References[j].TraceID)
+		}
+	}
+}
+
+func (f TraceIDFormat) formatUITraceID(id ui.TraceID) ui.TraceID {
+	traceID, err := model.TraceIDFromString(string(id))
+	if err != nil {
+		// e.g. the empty trace ID of a trace without spans
+		return id
+	}
+	return ui.TraceID(f.formatTraceID(traceID))
+}
+
+func isDecimal(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
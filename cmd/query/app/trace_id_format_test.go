@@ -0,0 +1,162 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/jaeger/model"
+	ui "github.com/uber/jaeger/model/json"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+func TestParseTraceIDFormat(t *testing.T) {
+	for name, expected := range map[string]TraceIDFormat{
+		"":        CompactTraceIDFormat,
+		"compact": CompactTraceIDFormat,
+		"hex":     HexTraceIDFormat,
+		"decimal": DecimalTraceIDFormat,
+	} {
+		format, err := ParseTraceIDFormat(name)
+		require.NoError(t, err)
+		assert.Equal(t, expected, format)
+	}
+	_, err := ParseTraceIDFormat("base64")
+	assert.EqualError(t, err, `Unknown trace ID format "base64"`)
+}
+
+func TestFormatTraceID(t *testing.T) {
+	traceID := model.TraceID{High: 1, Low: 0xab}
+	assert.Equal(t, "100000000000000ab", CompactTraceIDFormat.formatTraceID(traceID))
+	assert.Equal(t, "000000000000000100000000000000ab", HexTraceIDFormat.formatTraceID(traceID))
+	assert.Equal(t, "18446744073709551787", DecimalTraceIDFormat.formatTraceID(traceID))
+}
+
+func TestParseTraceIDAllFormats(t *testing.T) {
+	testCases := []struct {
+		format   TraceIDFormat
+		in       string
+		expected []model.TraceID
+	}{
+		{format: CompactTraceIDFormat, in: "ab", expected: []model.TraceID{{Low: 0xab}}},
+		{format: HexTraceIDFormat, in: "ab", expected: []model.TraceID{{Low: 0xab}}},
+		{format: DecimalTraceIDFormat, in: "ab", expected: []model.TraceID{{Low: 0xab}}},
+		{format: CompactTraceIDFormat, in: "000000000000000000000000000000ab", expected: []model.TraceID{{Low: 0xab}}},
+		// decimal digits are looked up in hex first unless the format is decimal
+		{format: CompactTraceIDFormat, in: "123", expected: []model.TraceID{{Low: 0x123}, {Low: 123}}},
+		{format: HexTraceIDFormat, in: "123", expected: []model.TraceID{{Low: 0x123}, {Low: 123}}},
+		{format: DecimalTraceIDFormat, in: "123", expected: []model.TraceID{{Low: 123}, {Low: 0x123}}},
+		{format: CompactTraceIDFormat, in: "7", expected: []model.TraceID{{Low: 7}}},
+		{format: DecimalTraceIDFormat, in: "7", expected: []model.TraceID{{Low: 7}}},
+		// they are only decimal when too long for hex
+		{format: CompactTraceIDFormat, in: "340282366920938463463374607431768211455", expected: []model.TraceID{{High: ^uint64(0), Low: ^uint64(0)}}},
+		{format: HexTraceIDFormat, in: "340282366920938463463374607431768211455", expected: []model.TraceID{{High: ^uint64(0), Low: ^uint64(0)}}},
+		{format: DecimalTraceIDFormat, in: "340282366920938463463374607431768211455", expected: []model.TraceID{{High: ^uint64(0), Low: ^uint64(0)}}},
+		{format: HexTraceIDFormat, in: "18446744073709551616", expected: []model.TraceID{{High: 0x1844, Low: 0x6744073709551616}, {High: 1}}},
+	}
+	for _, testCase := range testCases {
+		traceIDs, err := testCase.format.parseTraceID(testCase.in)
+		require.NoError(t, err, testCase.in)
+		assert.Equal(t, testCase.expected, traceIDs, "%s in %s", testCase.in, testCase.format)
+	}
+	for _, format := range []TraceIDFormat{CompactTraceIDFormat, HexTraceIDFormat, DecimalTraceIDFormat} {
+		for _, in := range []string{"", "xyz", "3402823669209384634633746074317682114560"} {
+			_, err := format.parseTraceID(in)
+			assert.Error(t, err, "%s in %s", in, format)
+		}
+	}
+}
+
+func TestGetTraceHexFallsBackToDecimal(t *testing.T) {
+	server, readMock, _ := initializeTestServer()
+	defer server.Close()
+	// the decimal ID of a link written by a tool is first looked up in hex
+	readMock.On("GetTrace", model.TraceID{Low: 0x123456}).Return(nil, spanstore.ErrTraceNotFound).Once()
+	readMock.On("GetTrace", model.TraceID{Low: 123456}).Return(mockTrace, nil).Once()
+
+	var response structuredTraceResponse
+	err := getJSON(server.URL+`/api/traces/123456`, &response)
+	require.NoError(t, err)
+	require.Len(t, response.Traces, 1)
+	readMock.AssertExpectations(t)
+}
+
+func TestFormatTrace(t *testing.T) {
+	trace := &ui.Trace{
+		TraceID: "ab",
+		Spans: []ui.Span{{
+			TraceID:    "ab",
+			References: []ui.Reference{{TraceID: "1"}},
+		}},
+	}
+	DecimalTraceIDFormat.formatTrace(trace)
+	assert.Equal(t, ui.TraceID("171"), trace.TraceID)
+	assert.Equal(t, ui.TraceID("171"), trace.Spans[0].TraceID)
+	assert.Equal(t, ui.TraceID("1"), trace.Spans[0].References[0].TraceID)
+
+	empty := &ui.Trace{}
+	HexTraceIDFormat.formatTrace(empty)
+	assert.Equal(t, ui.TraceID(""), empty.TraceID)
+}
+
+func TestGetTraceInTraceIDFormat(t *testing.T) {
+	server, readMock, _ := initializeTestServer(HandlerOptions.TraceIDFormat(HexTraceIDFormat))
+	defer server.Close()
+	readMock.On("GetTrace", mockTraceID).Return(mockTrace, nil).Once()
+
+	var response structuredTraceResponse
+	err := getJSON(server.URL+`/api/traces/`+mockTraceID.String(), &response)
+	require.NoError(t, err)
+	require.Len(t, response.Traces, 1)
+	assert.Equal(t, ui.TraceID(mockTraceID.PaddedString()), response.Traces[0].TraceID)
+	assert.Equal(t, ui.TraceID(mockTraceID.PaddedString()), response.Traces[0].Spans[0].TraceID)
+}
+
+func TestGetTraceDecimalFallsBackToHex(t *testing.T) {
+	server, readMock, _ := initializeTestServer(HandlerOptions.TraceIDFormat(DecimalTraceIDFormat))
+	defer server.Close()
+	// the hex ID 123456 of an existing link is first looked up as a decimal ID
+	readMock.On("GetTrace", model.TraceID{Low: 123456}).Return(nil, spanstore.ErrTraceNotFound).Once()
+	readMock.On("GetTrace", model.TraceID{Low: 0x123456}).Return(mockTrace, nil).Once()
+
+	var response structuredTraceResponse
+	err := getJSON(server.URL+`/api/traces/123456`, &response)
+	require.NoError(t, err)
+	require.Len(t, response.Traces, 1)
+	assert.Equal(t, ui.TraceID(mockTraceID.DecimalString()), response.Traces[0].TraceID)
+	readMock.AssertExpectations(t)
+}
+
+func TestSearchByTraceIDInDecimalFormat(t *testing.T) {
+	server, readMock, _ := initializeTestServer(HandlerOptions.TraceIDFormat(DecimalTraceIDFormat))
+	defer server.Close()
+	readMock.On("GetTrace", mockTraceID).Return(mockTrace, nil).Once()
+
+	var response structuredTraceResponse
+	err := getJSON(server.URL+`/api/traces?traceID=`+mockTraceID.DecimalString(), &response)
+	require.NoError(t, err)
+	require.Len(t, response.Traces, 1)
+	assert.Equal(t, ui.TraceID("123456"), response.Traces[0].TraceID)
+	readMock.AssertExpectations(t)
+}
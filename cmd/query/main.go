@@ -22,8 +22,10 @@ package main
 
 import (
 	"flag"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
@@ -32,49 +34,133 @@ import (
 	"github.com/uber/jaeger-lib/metrics/go-kit/expvar"
 	"github.com/uber/jaeger/cmd/query/app"
 
-	basicB "github.com/uber/jaeger/cmd/builder"
+	"github.com/uber/jaeger/cmd/flags"
 	casFlags "github.com/uber/jaeger/cmd/flags/cassandra"
+	esFlags "github.com/uber/jaeger/cmd/flags/es"
 	"github.com/uber/jaeger/cmd/query/app/builder"
+	"github.com/uber/jaeger/model/adjuster"
+	cascfg "github.com/uber/jaeger/pkg/cassandra/config"
+	pgcfg "github.com/uber/jaeger/pkg/postgres/config"
 	"github.com/uber/jaeger/pkg/recoveryhandler"
 )
 
 func main() {
 	casOptions := casFlags.NewOptions()
 	casOptions.Bind(flag.CommandLine, "cassandra", "cassandra.archive")
+	esOptions := esFlags.NewOptions(flag.CommandLine, "es", "read from")
 	flag.Parse()
 
 	logger, _ := zap.NewProduction()
 	metricsFactory := xkit.Wrap("jaeger-query", expvar.NewFactory(10))
+	esConfig := esOptions.GetConfiguration()
 
-	storageBuild, err := builder.NewStorageBuilder(
-		basicB.Options.LoggerOption(logger),
-		basicB.Options.MetricsFactoryOption(metricsFactory),
-		basicB.Options.CassandraOption(casOptions.GetPrimary()),
-	)
+	// the readers are built without the collector builder, so that the query service is independent of the write path
+	spanReader, dependencyReader, err := builder.NewReaders(flags.SpanStorage.PrimaryType(), builder.Configuration{
+		Logger:         logger,
+		MetricsFactory: metricsFactory,
+		Cassandra:      casOptions.GetPrimary(),
+		ElasticSearch:  esConfig,
+		Postgres: &pgcfg.Configuration{
+			DSN:             flags.PostgresStorage.DSN,
+			MaxOpenConns:    flags.PostgresStorage.MaxOpenConns,
+			MaxIdleConns:    flags.PostgresStorage.MaxIdleConns,
+			ConnMaxLifetime: flags.PostgresStorage.ConnMaxLifetime,
+		},
+	})
 	if err != nil {
-		logger.Fatal("Failed to init storage builder", zap.Error(err))
+		logger.Fatal("Failed to create the storage readers", zap.Error(err))
 	}
-	spanReader, err := storageBuild.NewSpanReader()
+	orphanSpans, err := adjuster.ParseOrphanSpanRepair(*builder.QueryOrphanSpans)
 	if err != nil {
-		logger.Fatal("Failed to create span reader", zap.Error(err))
+		logger.Fatal("Invalid orphan span repair", zap.Error(err))
 	}
-	dependencyReader, err := storageBuild.NewDependencyReader()
+	traceIDFormat, err := app.ParseTraceIDFormat(*builder.QueryTraceIDFormat)
 	if err != nil {
-		logger.Fatal("Failed to create dependency reader", zap.Error(err))
+		logger.Fatal("Invalid trace ID format", zap.Error(err))
 	}
-	rHandler := app.NewAPIHandler(
-		spanReader,
-		dependencyReader,
+	handlerOpts := []app.HandlerOption{
 		app.HandlerOptions.Prefix(*builder.QueryPrefix),
-		app.HandlerOptions.Logger(logger))
+		app.HandlerOptions.Logger(logger),
+		app.HandlerOptions.Adjusters(app.NewAdjusters(orphanSpans, *builder.QueryClockSkew, *builder.QueryClockSkewMaxAdjustment)...),
+		app.HandlerOptions.TraceIDFormat(traceIDFormat),
+	}
+	if *builder.QueryCompleteness {
+		handlerOpts = append(handlerOpts, app.HandlerOptions.Completeness(*builder.QueryCompletenessRequireRoot))
+	}
+	if *builder.QueryTenancyHeader != "" {
+		handlerOpts = append(handlerOpts, app.HandlerOptions.Tenancy(*builder.QueryTenancyHeader))
+	}
+	if *builder.QueryDeletion {
+		spanDeleter, err := builder.NewSpanDeleter(flags.SpanStorage.PrimaryType(), builder.Configuration{
+			Logger:           logger,
+			MetricsFactory:   metricsFactory,
+			Cassandra:        casOptions.GetPrimary(),
+			CassandraArchive: cassandraArchive(casOptions),
+			ElasticSearch:    esConfig,
+		})
+		if err != nil {
+			logger.Fatal("Failed to create the span deleter", zap.Error(err))
+		}
+		handlerOpts = append(handlerOpts, app.HandlerOptions.SpanDeleter(spanDeleter, *builder.QueryDeletionSpansPerSecond))
+	}
+	if *builder.QueryStats {
+		statsReader, err := builder.NewStatsReader(flags.SpanStorage.PrimaryType(), builder.Configuration{
+			Logger:         logger,
+			MetricsFactory: metricsFactory,
+			Cassandra:      casOptions.GetPrimary(),
+			ElasticSearch:  esConfig,
+		})
+		if err != nil {
+			logger.Fatal("Failed to create the statistics reader", zap.Error(err))
+		}
+		handlerOpts = append(handlerOpts, app.HandlerOptions.StatsReader(statsReader, *builder.QueryStatsMaxTraces, *builder.QueryStatsCacheTTL))
+	}
+	if *builder.QueryDurations {
+		durationReader, err := builder.NewDurationReader(flags.SpanStorage.PrimaryType(), builder.Configuration{
+			Logger:         logger,
+			MetricsFactory: metricsFactory,
+			Cassandra:      casOptions.GetPrimary(),
+			ElasticSearch:  esConfig,
+		})
+		if err != nil {
+			logger.Fatal("Failed to create the duration percentiles reader", zap.Error(err))
+		}
+		handlerOpts = append(handlerOpts, app.HandlerOptions.DurationReader(durationReader, *builder.QueryDurationsMaxTraces, *builder.QueryDurationsCacheTTL))
+	}
+	rHandler := app.NewAPIHandler(spanReader, dependencyReader, handlerOpts...)
 	sHandler := app.NewStaticAssetsHandler(*builder.QueryStaticAssets)
 	r := mux.NewRouter()
 	rHandler.RegisterRoutes(r)
 	sHandler.RegisterRoutes(r)
 	portStr := ":" + strconv.Itoa(*builder.QueryPort)
 	recoveryHandler := recoveryhandler.NewRecoveryHandler(logger, true)
+	if *builder.QueryDeletion {
+		adminRouter := mux.NewRouter()
+		rHandler.RegisterAdminRoutes(adminRouter)
+		adminListener, err := net.Listen("tcp", *builder.QueryAdminHTTPHostPort)
+		if err != nil {
+			logger.Fatal("Unable to start listening on admin HTTP port", zap.Error(err))
+		}
+		logger.Info("Listening for admin HTTP traffic", zap.String("admin-http-host-port", *builder.QueryAdminHTTPHostPort))
+		go func() {
+			if err := http.Serve(adminListener, recoveryHandler(adminRouter)); err != nil {
+				logger.Fatal("Could not launch admin service", zap.Error(err))
+			}
+		}()
+	}
 	logger.Info("Starting jaeger-query HTTP server", zap.Int("port", *builder.QueryPort))
 	if err := http.ListenAndServe(portStr, recoveryHandler(r)); err != nil {
 		logger.Fatal("Could not launch service", zap.Error(err))
 	}
 }
+
+// cassandraArchive returns the configuration of the archive keyspace, nil unless the cassandra.archive flags set
+// other servers or another keyspace than the primary ones
+func cassandraArchive(casOptions *casFlags.Options) *cascfg.Configuration {
+	primary := casOptions.GetPrimary()
+	archive := casOptions.Get("cassandra.archive")
+	if archive.Keyspace == primary.Keyspace && strings.Join(archive.Servers, ",") == strings.Join(primary.Servers, ",") {
+		return nil
+	}
+	return archive
+}
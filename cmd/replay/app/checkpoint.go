@@ -0,0 +1,113 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+var errCheckpointStep = errors.New("the checkpoint was recorded with a different step")
+
+// Checkpoint records the time ranges already replayed in a file, so that a restarted replay skips them.
+// The ranges are identified by their start, the checkpoint is only valid for replays with the same step.
+type Checkpoint struct {
+	sync.Mutex
+	path      string
+	step      time.Duration
+	completed map[int64]struct{}
+}
+
+// checkpointFile is the JSON document a Checkpoint is saved as
+type checkpointFile struct {
+	Step time.Duration `json:"step"`
+	// Completed are the starts of the replayed ranges in Unix nanoseconds
+	Completed []int64 `json:"completed"`
+}
+
+type int64s []int64
+
+func (s int64s) Len() int           { return len(s) }
+func (s int64s) Less(i, j int) bool { return s[i] < s[j] }
+func (s int64s) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// LoadCheckpoint reads the checkpoint of the ranges of the given step from the file at path,
+// which is created on the first completed range if it does not exist
+func LoadCheckpoint(path string, step time.Duration) (*Checkpoint, error) {
+	c := &Checkpoint{
+		path:      path,
+		step:      step,
+		completed: make(map[int64]struct{}),
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file checkpointFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if file.Step != step {
+		return nil, errCheckpointStep
+	}
+	for _, start := range file.Completed {
+		c.completed[start] = struct{}{}
+	}
+	return c, nil
+}
+
+// Completed returns true if the range starting at start was already replayed
+func (c *Checkpoint) Completed(start time.Time) bool {
+	c.Lock()
+	defer c.Unlock()
+	_, ok := c.completed[start.UnixNano()]
+	return ok
+}
+
+// Complete records the range starting at start as replayed and saves the checkpoint. The file is replaced
+// atomically, so that it is not corrupted if the replay is interrupted.
+func (c *Checkpoint) Complete(start time.Time) error {
+	c.Lock()
+	defer c.Unlock()
+	c.completed[start.UnixNano()] = struct{}{}
+	file := checkpointFile{Step: c.step, Completed: make([]int64, 0, len(c.completed))}
+	for start := range c.completed {
+		file.Completed = append(file.Completed, start)
+	}
+	sort.Sort(int64s(file.Completed))
+	data, err := json.Marshal(&file)
+	if err != nil {
+		return err
+	}
+	tmpPath := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, c.path)
+}
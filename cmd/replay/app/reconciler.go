@@ -0,0 +1,259 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/pkg/multierror"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+const (
+	// DefaultReconcileInterval is the default time between two reconciliation rounds
+	DefaultReconcileInterval = time.Minute
+	// DefaultReconcileLookback is the default range of start times of the traces sampled by a round
+	DefaultReconcileLookback = 10 * time.Minute
+	// DefaultReconcileDelay is the default age of the most recent traces sampled by a round
+	DefaultReconcileDelay = 5 * time.Minute
+	// DefaultReconcileTracesPerService is the default number of traces of each service sampled by a round
+	DefaultReconcileTracesPerService = 20
+)
+
+// ReconcilerOptions are the settings of a Reconciler
+type ReconcilerOptions struct {
+	// Interval is the time between two reconciliation rounds
+	Interval time.Duration
+	// Lookback is the range of start times of the traces sampled by a round, which ends Delay before the round
+	Lookback time.Duration
+	// Delay leaves the traces still being written out of the rounds, so that their late spans are not counted as missing
+	Delay time.Duration
+	// TracesPerService is the number of traces of each service sampled by a round
+	TracesPerService int
+	// TracesPerSecond limits the rate of traces reconciled, unlimited if 0
+	TracesPerSecond float64
+}
+
+type reconcileMetrics struct {
+	// Rounds counts the reconciliation rounds
+	Rounds metrics.Counter `metric:"reconcile.rounds"`
+	// TracesReconciled counts the sampled traces compared between the two storages
+	TracesReconciled metrics.Counter `metric:"reconcile.traces"`
+	// TracesDiverged counts the sampled traces whose spans differ between the two storages
+	TracesDiverged metrics.Counter `metric:"reconcile.traces-diverged"`
+	// MissingFromSecondary counts the spans of the primary storage missing from the secondary storage
+	MissingFromSecondary metrics.Counter `metric:"reconcile.spans-missing" tags:"storage=secondary"`
+	// MissingFromPrimary counts the spans of the secondary storage missing from the primary storage, which
+	// are not repaired
+	MissingFromPrimary metrics.Counter `metric:"reconcile.spans-missing" tags:"storage=primary"`
+	// LastRoundMissing is the number of spans missing from either storage found by the last round
+	LastRoundMissing metrics.Gauge `metric:"reconcile.last-round.spans-missing"`
+	// SpansRepaired counts the spans copied to the secondary storage
+	SpansRepaired metrics.Counter `metric:"reconcile.spans-repaired"`
+	// ReadErrors counts the failed reads from either storage
+	ReadErrors metrics.Counter `metric:"errors" tags:"operation=read"`
+	// WriteErrors counts the spans that could not be copied to the secondary storage
+	WriteErrors metrics.Counter `metric:"errors" tags:"operation=write"`
+}
+
+// Reconciler periodically samples recent traces of each service from a primary storage, reads them from a
+// secondary storage written to at the same time, e.g. during a migration, and copies the spans missing from
+// the secondary storage. The spans missing from the primary storage are only counted.
+type Reconciler struct {
+	primary         spanstore.Reader
+	secondary       spanstore.Reader
+	secondaryWriter spanstore.Writer
+	options         ReconcilerOptions
+	pacer           *pacer
+	logger          *zap.Logger
+	metrics         reconcileMetrics
+	timeNow         func() time.Time
+	done            chan struct{}
+	stopped         chan struct{}
+}
+
+// NewReconciler creates a Reconciler repairing the secondary storage from the primary storage.
+// Start needs to be called to begin the reconciliation rounds.
+func NewReconciler(
+	primary spanstore.Reader,
+	secondary spanstore.Reader,
+	secondaryWriter spanstore.Writer,
+	options ReconcilerOptions,
+	logger *zap.Logger,
+	metricsFactory metrics.Factory,
+) *Reconciler {
+	if options.Interval <= 0 {
+		options.Interval = DefaultReconcileInterval
+	}
+	if options.Lookback <= 0 {
+		options.Lookback = DefaultReconcileLookback
+	}
+	if options.TracesPerService <= 0 {
+		options.TracesPerService = DefaultReconcileTracesPerService
+	}
+	r := &Reconciler{
+		primary:         primary,
+		secondary:       secondary,
+		secondaryWriter: secondaryWriter,
+		options:         options,
+		logger:          logger,
+		timeNow:         time.Now,
+		done:            make(chan struct{}),
+		stopped:         make(chan struct{}),
+	}
+	if options.TracesPerSecond > 0 {
+		r.pacer = newPacer(options.TracesPerSecond)
+	}
+	metrics.Init(&r.metrics, metricsFactory, nil)
+	return r
+}
+
+// Start begins the periodic reconciliation rounds.
+func (r *Reconciler) Start() {
+	go func() {
+		defer close(r.stopped)
+		ticker := time.NewTicker(r.options.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := r.Reconcile(); err != nil {
+					r.logger.Error("Failed to reconcile some traces", zap.Error(err))
+				}
+			case <-r.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts the reconciliation rounds, waiting for the current round to complete.
+func (r *Reconciler) Stop() {
+	close(r.done)
+	<-r.stopped
+}
+
+// Reconcile runs a single reconciliation round, and returns the errors of the traces that could not be
+// reconciled once the other traces are.
+func (r *Reconciler) Reconcile() error {
+	r.metrics.Rounds.Inc(1)
+	services, err := r.primary.GetServices()
+	if err != nil {
+		r.metrics.ReadErrors.Inc(1)
+		return err
+	}
+	end := r.timeNow().Add(-r.options.Delay)
+	query := &spanstore.TraceQueryParameters{
+		StartTimeMin: end.Add(-r.options.Lookback),
+		StartTimeMax: end,
+		NumTraces:    r.options.TracesPerService,
+	}
+	// the traces sampled through several of their services are reconciled once
+	reconciled := make(map[model.TraceID]struct{})
+	missing := 0
+	var errs []error
+	for _, service := range services {
+		query.ServiceName = service
+		traces, err := r.primary.FindTraces(query)
+		if err != nil {
+			r.metrics.ReadErrors.Inc(1)
+			errs = append(errs, fmt.Errorf("service %s: %v", service, err))
+			continue
+		}
+		for _, trace := range traces {
+			if len(trace.Spans) == 0 {
+				continue
+			}
+			traceID := trace.Spans[0].TraceID
+			if _, ok := reconciled[traceID]; ok {
+				continue
+			}
+			reconciled[traceID] = struct{}{}
+			n, err := r.reconcileTrace(trace)
+			missing += n
+			if err != nil {
+				errs = append(errs, fmt.Errorf("trace %v: %v", traceID, err))
+			}
+		}
+	}
+	r.metrics.LastRoundMissing.Update(int64(missing))
+	if missing > 0 {
+		r.logger.Warn("The storages diverged",
+			zap.Int("traces", len(reconciled)),
+			zap.Int("missing-spans", missing))
+	}
+	return multierror.Wrap(errs)
+}
+
+// reconcileTrace copies the spans of the primary trace missing from the secondary storage, and returns the
+// number of spans missing from either storage
+func (r *Reconciler) reconcileTrace(trace *model.Trace) (int, error) {
+	r.pacer.wait()
+	r.metrics.TracesReconciled.Inc(1)
+	traceID := trace.Spans[0].TraceID
+	secondarySpans := make(map[model.SpanID]struct{})
+	secondaryTrace, err := r.secondary.GetTrace(traceID)
+	if err == nil {
+		for _, span := range secondaryTrace.Spans {
+			secondarySpans[span.SpanID] = struct{}{}
+		}
+	} else if err != spanstore.ErrTraceNotFound {
+		r.metrics.ReadErrors.Inc(1)
+		return 0, err
+	}
+
+	primarySpans := make(map[model.SpanID]struct{}, len(trace.Spans))
+	missingFromSecondary := 0
+	failed := 0
+	for _, span := range trace.Spans {
+		primarySpans[span.SpanID] = struct{}{}
+		if _, ok := secondarySpans[span.SpanID]; ok {
+			continue
+		}
+		missingFromSecondary++
+		if err := r.secondaryWriter.WriteSpan(span); err != nil {
+			r.metrics.WriteErrors.Inc(1)
+			failed++
+			continue
+		}
+		r.metrics.SpansRepaired.Inc(1)
+	}
+	missingFromPrimary := 0
+	for spanID := range secondarySpans {
+		if _, ok := primarySpans[spanID]; !ok {
+			missingFromPrimary++
+		}
+	}
+	r.metrics.MissingFromSecondary.Inc(int64(missingFromSecondary))
+	r.metrics.MissingFromPrimary.Inc(int64(missingFromPrimary))
+	if missingFromSecondary+missingFromPrimary > 0 {
+		r.metrics.TracesDiverged.Inc(1)
+	}
+	if failed > 0 {
+		return missingFromSecondary + missingFromPrimary, fmt.Errorf("failed to copy %d spans", failed)
+	}
+	return missingFromSecondary + missingFromPrimary, nil
+}
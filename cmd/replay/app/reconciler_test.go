@@ -0,0 +1,125 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/storage/spanstore/memory"
+)
+
+// unreadableStore fails the reads of traces with another error than spanstore.ErrTraceNotFound
+type unreadableStore struct {
+	*memory.Store
+}
+
+func (s unreadableStore) GetTrace(traceID model.TraceID) (*model.Trace, error) {
+	return nil, errors.New("read failed")
+}
+
+func TestReconciler(t *testing.T) {
+	primary := memory.NewStore()
+	for _, span := range []*model.Span{
+		replaySpan(1, 1, "frontend", replayStart.Add(time.Minute)),
+		replaySpan(1, 2, "backend", replayStart.Add(time.Minute+time.Second)),
+		replaySpan(2, 1, "frontend", replayStart.Add(2*time.Minute)),
+		// too recent to be sampled
+		replaySpan(3, 1, "frontend", replayStart.Add(time.Hour)),
+	} {
+		require.NoError(t, primary.WriteSpan(span))
+	}
+	secondary := memory.NewStore()
+	for _, span := range []*model.Span{
+		replaySpan(1, 1, "frontend", replayStart.Add(time.Minute)),
+		replaySpan(1, 3, "backend", replayStart.Add(time.Minute+2*time.Second)),
+	} {
+		require.NoError(t, secondary.WriteSpan(span))
+	}
+
+	mb := metrics.NewLocalFactory(0)
+	reconciler := NewReconciler(primary, secondary, secondary, ReconcilerOptions{
+		Lookback: time.Hour,
+		Delay:    30 * time.Minute,
+	}, zap.NewNop(), mb)
+	reconciler.timeNow = func() time.Time { return replayStart.Add(time.Hour) }
+	require.NoError(t, reconciler.Reconcile())
+
+	assert.Equal(t, 3, countSpans(t, secondary, 1))
+	assert.Equal(t, 1, countSpans(t, secondary, 2))
+	assert.Equal(t, 0, countSpans(t, secondary, 3))
+	counters, gauges := mb.Snapshot()
+	assert.EqualValues(t, 2, counters["reconcile.traces"])
+	assert.EqualValues(t, 2, counters["reconcile.traces-diverged"])
+	assert.EqualValues(t, 2, counters["reconcile.spans-missing|storage=secondary"])
+	assert.EqualValues(t, 1, counters["reconcile.spans-missing|storage=primary"])
+	assert.EqualValues(t, 2, counters["reconcile.spans-repaired"])
+	assert.EqualValues(t, 3, gauges["reconcile.last-round.spans-missing"])
+
+	// the spans missing from the primary storage are not repaired
+	require.NoError(t, reconciler.Reconcile())
+	counters, gauges = mb.Snapshot()
+	assert.EqualValues(t, 2, counters["reconcile.spans-repaired"])
+	assert.EqualValues(t, 1, gauges["reconcile.last-round.spans-missing"])
+}
+
+func TestReconcilerErrors(t *testing.T) {
+	primary := memory.NewStore()
+	require.NoError(t, primary.WriteSpan(replaySpan(1, 1, "frontend", replayStart)))
+
+	mb := metrics.NewLocalFactory(0)
+	secondary := memory.NewStore()
+	reconciler := NewReconciler(primary, unreadableStore{secondary}, secondary, ReconcilerOptions{}, zap.NewNop(), mb)
+	reconciler.timeNow = func() time.Time { return replayStart.Add(time.Minute) }
+	assert.Error(t, reconciler.Reconcile())
+	assert.Equal(t, 0, countSpans(t, secondary, 1), "the spans are not copied when the secondary cannot be read")
+
+	reconciler = NewReconciler(primary, secondary, failingWriter{}, ReconcilerOptions{}, zap.NewNop(), mb)
+	reconciler.timeNow = func() time.Time { return replayStart.Add(time.Minute) }
+	assert.EqualError(t, reconciler.Reconcile(), "trace 1: failed to copy 1 spans")
+
+	counters, _ := mb.Snapshot()
+	assert.EqualValues(t, 1, counters["errors|operation=read"])
+	assert.EqualValues(t, 1, counters["errors|operation=write"])
+}
+
+func TestReconcilerStartStop(t *testing.T) {
+	mb := metrics.NewLocalFactory(0)
+	store := memory.NewStore()
+	reconciler := NewReconciler(store, store, store, ReconcilerOptions{Interval: time.Millisecond}, zap.NewNop(), mb)
+	reconciler.Start()
+	for i := 0; i < 1000; i++ {
+		if counters, _ := mb.Snapshot(); counters["reconcile.rounds"] > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	reconciler.Stop()
+	counters, _ := mb.Snapshot()
+	assert.NotZero(t, counters["reconcile.rounds"])
+}
@@ -0,0 +1,322 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/pkg/multierror"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+const (
+	// DefaultStep is the default length of the time ranges replayed at once
+	DefaultStep = time.Hour
+	// DefaultMaxTracesPerQuery is the default number of traces read by a single query of a service
+	DefaultMaxTracesPerQuery = 1000
+
+	// minQueryRange is the shortest time range a query returning too many traces is split down to
+	minQueryRange = time.Second
+)
+
+var errFlushFailed = errors.New("spans written in the time range may have been dropped by a failed flush of the destination")
+
+// Options are the settings of a Replayer
+type Options struct {
+	// Start and End bound the start times of the replayed spans
+	Start time.Time
+	End   time.Time
+	// Step is the length of the time ranges replayed at once, which are recorded in the Checkpoint once replayed
+	Step time.Duration
+	// Concurrency is the number of time ranges replayed in parallel
+	Concurrency int
+	// SpansPerSecond limits the rate of spans written to the destination, unlimited if 0
+	SpansPerSecond float64
+	// MaxTracesPerQuery is the number of traces read by a single query of a service. The time range of
+	// a query returning as many traces is split in halves, since the query may have missed some.
+	MaxTracesPerQuery int
+	// Checkpoint records the replayed time ranges, which are skipped. Nothing is recorded if it is nil.
+	Checkpoint *Checkpoint
+}
+
+type replayMetrics struct {
+	// Ranges is the number of time ranges to replay
+	Ranges metrics.Gauge `metric:"ranges.total"`
+	// RangesCompleted counts the replayed time ranges
+	RangesCompleted metrics.Counter `metric:"ranges.completed"`
+	// RangesSkipped counts the time ranges already replayed according to the checkpoint
+	RangesSkipped metrics.Counter `metric:"ranges.skipped"`
+	// RangesFailed counts the time ranges that could not be fully replayed, and are retried by the next run
+	RangesFailed metrics.Counter `metric:"ranges.failed"`
+	// SpansWritten counts the spans written to the destination
+	SpansWritten metrics.Counter `metric:"spans.written"`
+	// ReadErrors counts the failed reads from the source
+	ReadErrors metrics.Counter `metric:"errors" tags:"operation=read"`
+	// WriteErrors counts the spans that could not be written to the destination
+	WriteErrors metrics.Counter `metric:"errors" tags:"operation=write"`
+	// FlushErrors counts the failed flushes of the spans buffered by the destination
+	FlushErrors metrics.Counter `metric:"errors" tags:"operation=flush"`
+}
+
+// Replayer copies the spans started within a time range from a source storage to a destination storage.
+// The spans of each service are read with FindTraces, and only the spans of that service started within
+// the queried range are written, so that each span is written once.
+type Replayer struct {
+	source      spanstore.Reader
+	destination spanstore.Writer
+	options     Options
+	pacer       *pacer
+	logger      *zap.Logger
+	metrics     replayMetrics
+	// flushFailures counts the failed flushes of the destination, which may have dropped the spans of any range
+	// written before them
+	flushFailures int64
+}
+
+// NewReplayer creates a Replayer reading from source and writing to destination
+func NewReplayer(
+	source spanstore.Reader,
+	destination spanstore.Writer,
+	options Options,
+	logger *zap.Logger,
+	metricsFactory metrics.Factory,
+) *Replayer {
+	if options.Step <= 0 {
+		options.Step = DefaultStep
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = 1
+	}
+	if options.MaxTracesPerQuery <= 0 {
+		options.MaxTracesPerQuery = DefaultMaxTracesPerQuery
+	}
+	r := &Replayer{
+		source:      source,
+		destination: destination,
+		options:     options,
+		logger:      logger,
+	}
+	if options.SpansPerSecond > 0 {
+		r.pacer = newPacer(options.SpansPerSecond)
+	}
+	metrics.Init(&r.metrics, metricsFactory, nil)
+	return r
+}
+
+// Run replays all the time ranges not recorded in the checkpoint. The ranges that fail are not recorded
+// and the errors are returned once the other ranges are replayed, so that the next run retries them only.
+func (r *Replayer) Run() error {
+	services, err := r.source.GetServices()
+	if err != nil {
+		r.metrics.ReadErrors.Inc(1)
+		return err
+	}
+	var starts []time.Time
+	for start := r.options.Start; start.Before(r.options.End); start = start.Add(r.options.Step) {
+		starts = append(starts, start)
+	}
+	r.metrics.Ranges.Update(int64(len(starts)))
+
+	var (
+		wg     sync.WaitGroup
+		mux    sync.Mutex
+		errs   []error
+		ranges = make(chan time.Time)
+	)
+	for i := 0; i < r.options.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range ranges {
+				if err := r.replayRange(services, start); err != nil {
+					mux.Lock()
+					errs = append(errs, err)
+					mux.Unlock()
+				}
+			}
+		}()
+	}
+	for _, start := range starts {
+		if r.options.Checkpoint != nil && r.options.Checkpoint.Completed(start) {
+			r.metrics.RangesSkipped.Inc(1)
+			continue
+		}
+		ranges <- start
+	}
+	close(ranges)
+	wg.Wait()
+	return multierror.Wrap(errs)
+}
+
+func (r *Replayer) replayRange(services []string, start time.Time) error {
+	end := start.Add(r.options.Step)
+	if end.After(r.options.End) {
+		end = r.options.End
+	}
+	flushFailures := atomic.LoadInt64(&r.flushFailures)
+	written := 0
+	var errs []error
+	for _, service := range services {
+		n, err := r.replayService(service, start, end)
+		written += n
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 {
+		if err := r.flush(flushFailures); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := multierror.Wrap(errs); err != nil {
+		r.metrics.RangesFailed.Inc(1)
+		r.logger.Error("Failed to replay time range", zap.Time("start", start), zap.Time("end", end), zap.Error(err))
+		return fmt.Errorf("time range starting at %v: %v", start, err)
+	}
+	if r.options.Checkpoint != nil {
+		if err := r.options.Checkpoint.Complete(start); err != nil {
+			return err
+		}
+	}
+	r.metrics.RangesCompleted.Inc(1)
+	r.logger.Info("Replayed time range", zap.Time("start", start), zap.Time("end", end), zap.Int("spans", written))
+	return nil
+}
+
+// flush flushes the spans buffered by the destination, so that the range is only recorded in the checkpoint
+// once its spans are stored. It returns an error if a flush failed since the range started, since the spans
+// of the range may have been dropped by the flush of another range or by one the destination made on its own.
+func (r *Replayer) flush(flushFailures int64) error {
+	flusher, ok := r.destination.(spanstore.Flusher)
+	if !ok {
+		return nil
+	}
+	if err := flusher.Flush(); err != nil {
+		atomic.AddInt64(&r.flushFailures, 1)
+		r.metrics.FlushErrors.Inc(1)
+		return err
+	}
+	if atomic.LoadInt64(&r.flushFailures) != flushFailures {
+		return errFlushFailed
+	}
+	return nil
+}
+
+// replayService writes the spans of the service started within [start, end), and returns how many were written
+func (r *Replayer) replayService(service string, start, end time.Time) (int, error) {
+	traces, err := r.source.FindTraces(&spanstore.TraceQueryParameters{
+		ServiceName:  service,
+		StartTimeMin: start,
+		StartTimeMax: end,
+		NumTraces:    r.options.MaxTracesPerQuery,
+	})
+	if err != nil {
+		r.metrics.ReadErrors.Inc(1)
+		return 0, err
+	}
+	if len(traces) >= r.options.MaxTracesPerQuery {
+		if end.Sub(start) > minQueryRange {
+			middle := start.Add(end.Sub(start) / 2)
+			n, err := r.replayService(service, start, middle)
+			if err != nil {
+				return n, err
+			}
+			m, err := r.replayService(service, middle, end)
+			return n + m, err
+		}
+		r.logger.Warn("Too many traces to replay them all",
+			zap.String("service", service),
+			zap.Time("start", start),
+			zap.Int("traces", len(traces)))
+	}
+	written := 0
+	failed := 0
+	for _, trace := range traces {
+		for _, span := range trace.Spans {
+			if !owns(span, service, start, end) {
+				continue
+			}
+			r.pacer.wait()
+			if err := r.destination.WriteSpan(span); err != nil {
+				r.metrics.WriteErrors.Inc(1)
+				failed++
+				continue
+			}
+			r.metrics.SpansWritten.Inc(1)
+			written++
+		}
+	}
+	if failed > 0 {
+		return written, fmt.Errorf("failed to write %d spans of service %s", failed, service)
+	}
+	return written, nil
+}
+
+// owns returns true if the span is replayed by the query of the service over [start, end)
+func owns(span *model.Span, service string, start, end time.Time) bool {
+	if span.Process == nil || span.Process.ServiceName != service {
+		return false
+	}
+	return !span.StartTime.Before(start) && span.StartTime.Before(end)
+}
+
+// pacer spaces out the writes to allow up to rate spans per second
+type pacer struct {
+	sync.Mutex
+	interval time.Duration
+	next     time.Time
+	timeNow  func() time.Time
+	sleep    func(time.Duration)
+}
+
+func newPacer(rate float64) *pacer {
+	return &pacer{
+		interval: time.Duration(float64(time.Second) / rate),
+		timeNow:  time.Now,
+		sleep:    time.Sleep,
+	}
+}
+
+// wait blocks until the next span can be written, it returns immediately on a nil pacer
+func (p *pacer) wait() {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	now := p.timeNow()
+	if p.next.Before(now) {
+		p.next = now
+	}
+	delay := p.next.Sub(now)
+	p.next = p.next.Add(p.interval)
+	p.Unlock()
+	if delay > 0 {
+		p.sleep(delay)
+	}
+}
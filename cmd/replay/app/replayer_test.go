@@ -0,0 +1,208 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package app
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/storage/spanstore/memory"
+)
+
+var replayStart = time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func replaySpan(traceID uint64, spanID uint64, service string, start time.Time) *model.Span {
+	return &model.Span{
+		TraceID:   model.TraceID{Low: traceID},
+		SpanID:    model.SpanID(spanID),
+		StartTime: start,
+		Process:   &model.Process{ServiceName: service},
+	}
+}
+
+func newReplaySource(t *testing.T) *memory.Store {
+	source := memory.NewStore()
+	for _, span := range []*model.Span{
+		replaySpan(1, 1, "frontend", replayStart.Add(time.Minute)),
+		replaySpan(1, 2, "backend", replayStart.Add(time.Minute+time.Second)),
+		// a trace crossing the boundary of two ranges
+		replaySpan(2, 1, "frontend", replayStart.Add(time.Hour-time.Second)),
+		replaySpan(2, 2, "backend", replayStart.Add(time.Hour+time.Second)),
+		replaySpan(3, 1, "frontend", replayStart.Add(90*time.Minute)),
+		// outside of the replayed time range
+		replaySpan(4, 1, "frontend", replayStart.Add(3*time.Hour)),
+	} {
+		require.NoError(t, source.WriteSpan(span))
+	}
+	return source
+}
+
+func countSpans(t *testing.T, store *memory.Store, traceIDs ...uint64) int {
+	count := 0
+	for _, traceID := range traceIDs {
+		trace, err := store.GetTrace(model.TraceID{Low: traceID})
+		if err == nil {
+			count += len(trace.Spans)
+		}
+	}
+	return count
+}
+
+func TestReplayer(t *testing.T) {
+	source := newReplaySource(t)
+	destination := memory.NewStore()
+	metricsFactory := metrics.NewLocalFactory(0)
+	replayer := NewReplayer(source, destination, Options{
+		Start:             replayStart,
+		End:               replayStart.Add(2 * time.Hour),
+		Concurrency:       2,
+		MaxTracesPerQuery: 1,
+	}, zap.NewNop(), metricsFactory)
+	require.NoError(t, replayer.Run())
+
+	assert.Equal(t, 5, countSpans(t, destination, 1, 2, 3), "each span is written once")
+	assert.Equal(t, 0, countSpans(t, destination, 4))
+	counts, gauges := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, gauges["ranges.total"])
+	assert.EqualValues(t, 2, counts["ranges.completed"])
+	assert.EqualValues(t, 5, counts["spans.written"])
+}
+
+func TestReplayerCheckpoint(t *testing.T) {
+	directory, err := ioutil.TempDir("", "jaeger-replay")
+	require.NoError(t, err)
+	defer os.RemoveAll(directory)
+	path := filepath.Join(directory, "checkpoint.json")
+	options := Options{Start: replayStart, End: replayStart.Add(2 * time.Hour)}
+
+	checkpoint, err := LoadCheckpoint(path, DefaultStep)
+	require.NoError(t, err)
+	require.NoError(t, checkpoint.Complete(replayStart))
+	options.Checkpoint = checkpoint
+	destination := memory.NewStore()
+	metricsFactory := metrics.NewLocalFactory(0)
+	require.NoError(t, NewReplayer(newReplaySource(t), destination, options, zap.NewNop(), metricsFactory).Run())
+	assert.Equal(t, 2, countSpans(t, destination, 1, 2, 3), "only the spans of the second range are written")
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["ranges.skipped"])
+
+	// a restarted replay has nothing left to do
+	checkpoint, err = LoadCheckpoint(path, DefaultStep)
+	require.NoError(t, err)
+	assert.True(t, checkpoint.Completed(replayStart))
+	assert.True(t, checkpoint.Completed(replayStart.Add(time.Hour)))
+	assert.False(t, checkpoint.Completed(replayStart.Add(2*time.Hour)))
+
+	_, err = LoadCheckpoint(path, time.Minute)
+	assert.Equal(t, errCheckpointStep, err)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) WriteSpan(span *model.Span) error {
+	return errors.New("write failed")
+}
+
+func TestReplayerWriteFailure(t *testing.T) {
+	directory, err := ioutil.TempDir("", "jaeger-replay")
+	require.NoError(t, err)
+	defer os.RemoveAll(directory)
+	checkpoint, err := LoadCheckpoint(filepath.Join(directory, "checkpoint.json"), DefaultStep)
+	require.NoError(t, err)
+
+	metricsFactory := metrics.NewLocalFactory(0)
+	err = NewReplayer(newReplaySource(t), failingWriter{}, Options{
+		Start:      replayStart,
+		End:        replayStart.Add(time.Hour),
+		Checkpoint: checkpoint,
+	}, zap.NewNop(), metricsFactory).Run()
+	assert.Error(t, err)
+	assert.False(t, checkpoint.Completed(replayStart), "the failed range is retried by the next run")
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["ranges.failed"])
+	assert.EqualValues(t, 3, counts["errors|operation=write"])
+}
+
+// flushFailingWriter buffers the spans in a memory store, failing to flush them the first time
+type flushFailingWriter struct {
+	*memory.Store
+	flushes int
+}
+
+func (w *flushFailingWriter) Flush() error {
+	w.flushes++
+	if w.flushes == 1 {
+		return errors.New("flush failed")
+	}
+	return nil
+}
+
+func TestReplayerFlushFailure(t *testing.T) {
+	directory, err := ioutil.TempDir("", "jaeger-replay")
+	require.NoError(t, err)
+	defer os.RemoveAll(directory)
+	checkpoint, err := LoadCheckpoint(filepath.Join(directory, "checkpoint.json"), DefaultStep)
+	require.NoError(t, err)
+
+	metricsFactory := metrics.NewLocalFactory(0)
+	destination := &flushFailingWriter{Store: memory.NewStore()}
+	err = NewReplayer(newReplaySource(t), destination, Options{
+		Start:      replayStart,
+		End:        replayStart.Add(2 * time.Hour),
+		Checkpoint: checkpoint,
+	}, zap.NewNop(), metricsFactory).Run()
+	assert.Error(t, err)
+	assert.Equal(t, 2, destination.flushes, "each range is flushed")
+	assert.False(t, checkpoint.Completed(replayStart), "the range failing to be flushed is retried by the next run")
+	assert.True(t, checkpoint.Completed(replayStart.Add(time.Hour)))
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["ranges.failed"])
+	assert.EqualValues(t, 1, counts["errors|operation=flush"])
+}
+
+func TestPacer(t *testing.T) {
+	now := replayStart
+	var slept []time.Duration
+	p := newPacer(2)
+	p.timeNow = func() time.Time { return now }
+	p.sleep = func(d time.Duration) { slept = append(slept, d) }
+	p.wait()
+	p.wait()
+	p.wait()
+	assert.Equal(t, []time.Duration{500 * time.Millisecond, time.Second}, slept)
+
+	now = now.Add(time.Hour)
+	p.wait()
+	assert.Len(t, slept, 2, "the unused rate does not accumulate")
+
+	var nilPacer *pacer
+	nilPacer.wait()
+}
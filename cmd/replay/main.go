@@ -0,0 +1,188 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger-lib/metrics"
+	"github.com/uber/jaeger-lib/metrics/go-kit"
+	"github.com/uber/jaeger-lib/metrics/go-kit/expvar"
+
+	basicB "github.com/uber/jaeger/cmd/builder"
+	collector "github.com/uber/jaeger/cmd/collector/app/builder"
+	"github.com/uber/jaeger/cmd/flags"
+	casFlags "github.com/uber/jaeger/cmd/flags/cassandra"
+	esFlags "github.com/uber/jaeger/cmd/flags/es"
+	query "github.com/uber/jaeger/cmd/query/app/builder"
+	"github.com/uber/jaeger/cmd/replay/app"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+var (
+	sourceType        = flag.String("replay.source.type", flags.CassandraStorageType, "The type of storage backend the spans are read from, configured by the cassandra.* or es.* flags")
+	destinationType   = flag.String("replay.destination.type", flags.ESStorageType, "The type of storage backend the spans are written to, configured by the cassandra.destination.* or es.destination.* flags")
+	start             = flag.String("replay.start", "", "The start of the replayed time range in RFC 3339 format, e.g. 2018-01-01T00:00:00Z")
+	end               = flag.String("replay.end", "", "The end of the replayed time range in RFC 3339 format, now if empty")
+	step              = flag.Duration("replay.step", app.DefaultStep, "The length of the time ranges replayed at once, and recorded in the checkpoint once replayed")
+	concurrency       = flag.Int("replay.concurrency", 4, "The number of time ranges replayed in parallel")
+	spansPerSecond    = flag.Float64("replay.spans-per-second", 0, "The maximum number of spans written to the destination per second, unlimited if 0")
+	maxTracesPerQuery = flag.Int("replay.max-traces-per-query", app.DefaultMaxTracesPerQuery, "The number of traces read by a single query of a service, the time range of queries returning as many traces is split")
+	checkpointPath    = flag.String("replay.checkpoint", "", "The file recording the replayed time ranges, which a restarted replay skips. A range is recorded once its spans are written, and flushed by the destination if it buffers them for bulk requests. Ranges are not recorded if empty")
+	httpPort          = flag.Int("replay.http-port", 14280, "The port serving the replay metrics at /debug/vars, disabled if 0")
+
+	reconcileInterval         = flag.Duration("replay.reconcile.interval", 0, "Runs in the background until terminated, copying every interval the spans of sampled recent traces of the source missing from the destination, instead of replaying a time range, e.g. while both are written to during a migration. Disabled if 0")
+	reconcileLookback         = flag.Duration("replay.reconcile.lookback", app.DefaultReconcileLookback, "The range of start times of the traces sampled by a reconciliation round")
+	reconcileDelay            = flag.Duration("replay.reconcile.delay", app.DefaultReconcileDelay, "The age of the most recent traces sampled by a reconciliation round, so that the spans still being written are not counted as missing")
+	reconcileTracesPerService = flag.Int("replay.reconcile.traces-per-service", app.DefaultReconcileTracesPerService, "The number of traces of each service sampled by a reconciliation round")
+	reconcileTracesPerSecond  = flag.Float64("replay.reconcile.traces-per-second", 0, "The maximum number of traces reconciled per second, unlimited if 0")
+
+	sourceES      = esFlags.NewOptions(flag.CommandLine, "es", "read from")
+	destinationES = esFlags.NewOptions(flag.CommandLine, "es.destination", "written to")
+)
+
+// reconcile repairs the destination from the source until the process is terminated
+func reconcile(
+	source spanstore.Reader,
+	destination spanstore.Writer,
+	logger *zap.Logger,
+	metricsFactory metrics.Factory,
+	casOptions *casFlags.Options,
+) {
+	destinationBuilder, err := query.NewStorageBuilderForType(*destinationType, query.Configuration{
+		Logger:         logger,
+		MetricsFactory: metricsFactory.Namespace("destination", nil),
+		Cassandra:      casOptions.Get("cassandra.destination"),
+		ElasticSearch:  destinationES.GetConfiguration(),
+	})
+	if err != nil {
+		logger.Fatal("Unable to set up the destination storage", zap.Error(err))
+	}
+	destinationReader, err := destinationBuilder.NewSpanReader()
+	if err != nil {
+		logger.Fatal("Unable to create the destination span reader", zap.Error(err))
+	}
+	reconciler := app.NewReconciler(source, destinationReader, destination, app.ReconcilerOptions{
+		Interval:         *reconcileInterval,
+		Lookback:         *reconcileLookback,
+		Delay:            *reconcileDelay,
+		TracesPerService: *reconcileTracesPerService,
+		TracesPerSecond:  *reconcileTracesPerSecond,
+	}, logger, metricsFactory)
+	reconciler.Start()
+	logger.Info("Reconciling the destination with the source", zap.Duration("interval", *reconcileInterval))
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+	reconciler.Stop()
+}
+
+func main() {
+	casOptions := casFlags.NewOptions()
+	casOptions.Bind(flag.CommandLine, "cassandra", "cassandra.destination")
+	flag.Parse()
+	logger, _ := zap.NewProduction()
+	metricsFactory := xkit.Wrap("jaeger-replay", expvar.NewFactory(10))
+
+	options := app.Options{
+		Step:              *step,
+		Concurrency:       *concurrency,
+		SpansPerSecond:    *spansPerSecond,
+		MaxTracesPerQuery: *maxTracesPerQuery,
+		End:               time.Now(),
+	}
+	var err error
+	if *reconcileInterval <= 0 {
+		if options.Start, err = time.Parse(time.RFC3339, *start); err != nil {
+			logger.Fatal("Invalid start of the replayed time range", zap.Error(err))
+		}
+		if *end != "" {
+			if options.End, err = time.Parse(time.RFC3339, *end); err != nil {
+				logger.Fatal("Invalid end of the replayed time range", zap.Error(err))
+			}
+		}
+		if *checkpointPath != "" {
+			if options.Checkpoint, err = app.LoadCheckpoint(*checkpointPath, *step); err != nil {
+				logger.Fatal("Unable to load the checkpoint", zap.Error(err))
+			}
+		}
+	}
+
+	sourceBuilder, err := query.NewStorageBuilderForType(*sourceType, query.Configuration{
+		Logger:         logger,
+		MetricsFactory: metricsFactory.Namespace("source", nil),
+		Cassandra:      casOptions.GetPrimary(),
+		ElasticSearch:  sourceES.GetConfiguration(),
+	})
+	if err != nil {
+		logger.Fatal("Unable to set up the source storage", zap.Error(err))
+	}
+	source, err := sourceBuilder.NewSpanReader()
+	if err != nil {
+		logger.Fatal("Unable to create the source span reader", zap.Error(err))
+	}
+	destination, closer, err := collector.NewSpanWriter(
+		*destinationType,
+		basicB.Options.LoggerOption(logger),
+		basicB.Options.MetricsFactoryOption(metricsFactory.Namespace("destination", nil)),
+		basicB.Options.CassandraOption(casOptions.Get("cassandra.destination")),
+		basicB.Options.ElasticSearchOption(destinationES.GetConfiguration()),
+	)
+	if err != nil {
+		logger.Fatal("Unable to create the destination span writer", zap.Error(err))
+	}
+
+	if *httpPort > 0 {
+		go func() {
+			// expvar serves the metrics on the default mux
+			if err := http.ListenAndServe(":"+strconv.Itoa(*httpPort), nil); err != nil {
+				logger.Error("Could not launch the metrics HTTP server", zap.Error(err))
+			}
+		}()
+	}
+	if *reconcileInterval > 0 {
+		reconcile(source, destination, logger, metricsFactory, casOptions)
+		if err := closer.Close(); err != nil {
+			logger.Fatal("Failed to flush the destination span writer", zap.Error(err))
+		}
+		logger.Info("Reconciliation stopped")
+		return
+	}
+	replayer := app.NewReplayer(source, destination, options, logger, metricsFactory)
+	err = replayer.Run()
+	// the spans buffered by the destination are flushed before the checkpoint is trusted by the next run
+	if closeErr := closer.Close(); closeErr != nil {
+		logger.Fatal("Failed to flush the destination span writer", zap.Error(closeErr))
+	}
+	if err != nil {
+		logger.Fatal("Some time ranges failed to replay, run the replay again to retry them", zap.Error(err))
+	}
+	logger.Info("Replay completed")
+}
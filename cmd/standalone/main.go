@@ -21,14 +21,17 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
 	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/gorilla/mux"
 	"github.com/spf13/cobra"
@@ -45,16 +48,20 @@ import (
 	basic "github.com/uber/jaeger/cmd/builder"
 	collectorApp "github.com/uber/jaeger/cmd/collector/app"
 	collector "github.com/uber/jaeger/cmd/collector/app/builder"
+	"github.com/uber/jaeger/cmd/flags"
 	queryApp "github.com/uber/jaeger/cmd/query/app"
 	query "github.com/uber/jaeger/cmd/query/app/builder"
+	"github.com/uber/jaeger/model/adjuster"
+	badgercfg "github.com/uber/jaeger/pkg/badger/config"
 	pMetrics "github.com/uber/jaeger/pkg/metrics"
 	"github.com/uber/jaeger/pkg/recoveryhandler"
+	badgerSpanstore "github.com/uber/jaeger/plugin/storage/badger/spanstore"
 	"github.com/uber/jaeger/storage/spanstore/memory"
 	jc "github.com/uber/jaeger/thrift-gen/jaeger"
 	zc "github.com/uber/jaeger/thrift-gen/zipkincore"
 )
 
-// standalone/main is a standalone full-stack jaeger backend, backed by a memory store
+// standalone/main is a standalone full-stack jaeger backend, backed by a memory store or an embedded Badger store
 func main() {
 	logger, _ := zap.NewProduction()
 	metricsFactory := xkit.Wrap("jaeger-standalone", expvar.NewFactory(10))
@@ -64,11 +71,41 @@ func main() {
 
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
+	// Badger locks the directory of the store, so the collector and the query service share the store
+	var badgerStore *badgerSpanstore.Store
+	if flags.SpanStorage.PrimaryType() == flags.BadgerStorageType {
+		badgerStore = openBadgerStore(logger)
+		defer badgerStore.Close()
+	}
+
 	startAgent(logger, metricsFactory)
-	startCollector(logger, metricsFactory, memStore)
-	startQuery(logger, metricsFactory, memStore)
+	spanBuilder := startCollector(logger, metricsFactory, memStore, badgerStore)
+	startQuery(logger, metricsFactory, memStore, badgerStore)
 
-	select {}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+	logger.Info("Shutting down, draining queued spans", zap.Duration("timeout", *collector.CollectorShutdownTimeout))
+	ctx, cancel := context.WithTimeout(context.Background(), *collector.CollectorShutdownTimeout)
+	defer cancel()
+	// closing the collector also writes the snapshot of the memory store, if configured
+	dropped, err := spanBuilder.Close(ctx)
+	if err != nil {
+		logger.Error("Failed to close span storage", zap.Error(err))
+	}
+	logger.Info("Shut down", zap.Int("dropped-spans", dropped))
+}
+
+func openBadgerStore(logger *zap.Logger) *badgerSpanstore.Store {
+	config := badgercfg.Configuration{
+		Directory:          flags.BadgerStorage.Directory,
+		ValueLogGCInterval: flags.BadgerStorage.ValueLogGCInterval,
+	}
+	db, err := config.NewDB()
+	if err != nil {
+		logger.Fatal("Unable to open the Badger store", zap.Error(err))
+	}
+	return badgerSpanstore.NewStore(db, config.ValueLogGCInterval, logger)
 }
 
 func startAgent(logger *zap.Logger, baseFactory metrics.Factory) {
@@ -100,14 +137,29 @@ func startAgent(logger *zap.Logger, baseFactory metrics.Factory) {
 	}
 }
 
-func startCollector(logger *zap.Logger, baseFactory metrics.Factory, memoryStore *memory.Store) {
+func startCollector(
+	logger *zap.Logger,
+	baseFactory metrics.Factory,
+	memoryStore *memory.Store,
+	badgerStore *badgerSpanstore.Store,
+) collector.SpanHandlerBuilder {
 	metricsFactory := baseFactory.Namespace("jaeger-collector", nil)
 
-	spanBuilder, err := collector.NewSpanHandlerBuilder(
+	options := []basic.Option{
 		basic.Options.LoggerOption(logger),
 		basic.Options.MetricsFactoryOption(metricsFactory),
-		basic.Options.MemoryStoreOption(memoryStore),
-	)
+		basic.Options.MemoryStoreOption(
+			memoryStore,
+			memory.Options.MaxTraces(flags.MemoryStorage.MaxTraces),
+			memory.Options.MetricsFactory(baseFactory.Namespace("memory-store", nil)),
+			memory.Options.Logger(logger),
+			memory.Options.SnapshotPath(flags.MemoryStorage.SnapshotPath),
+		),
+	}
+	if badgerStore != nil {
+		options = append(options, basic.Options.BadgerStoreOption(badgerStore))
+	}
+	spanBuilder, err := collector.NewSpanHandlerBuilder(options...)
 	if err != nil {
 		logger.Fatal("Unable to set up builder", zap.Error(err))
 	}
@@ -132,7 +184,13 @@ func startCollector(logger *zap.Logger, baseFactory metrics.Factory, memoryStore
 	logger.Info("Starting jaeger-collector TChannel server", zap.Int("port", *collector.CollectorPort))
 
 	r := mux.NewRouter()
-	apiHandler := collectorApp.NewAPIHandler(jaegerBatchesHandler, zipkinSpansHandler)
+	apiHandler := collectorApp.NewAPIHandler(
+		jaegerBatchesHandler,
+		zipkinSpansHandler,
+		collectorApp.APIHandlerOptions.ZipkinPath(*collector.CollectorZipkinHTTPPath),
+		collectorApp.APIHandlerOptions.MaxDecompressedSize(*collector.CollectorHTTPMaxDecompressedSize),
+		collectorApp.APIHandlerOptions.MetricsFactory(metricsFactory),
+	)
 	apiHandler.RegisterRoutes(r)
 	httpPortStr := ":" + strconv.Itoa(*collector.CollectorHTTPPort)
 	recoveryHandler := recoveryhandler.NewRecoveryHandler(logger, true)
@@ -142,16 +200,23 @@ func startCollector(logger *zap.Logger, baseFactory metrics.Factory, memoryStore
 			logger.Fatal("Could not launch jaeger-collector HTTP server", zap.Error(err))
 		}
 	}()
+	return spanBuilder
 }
 
-func startQuery(logger *zap.Logger, baseFactory metrics.Factory, memoryStore *memory.Store) {
+func startQuery(
+	logger *zap.Logger,
+	baseFactory metrics.Factory,
+	memoryStore *memory.Store,
+	badgerStore *badgerSpanstore.Store,
+) {
 	metricsFactory := baseFactory.Namespace("jaeger-query", nil)
 
-	storageBuild, err := query.NewStorageBuilder(
-		basic.Options.LoggerOption(logger),
-		basic.Options.MetricsFactoryOption(metricsFactory),
-		basic.Options.MemoryStoreOption(memoryStore),
-	)
+	storageBuild, err := query.NewStorageBuilder(query.Configuration{
+		Logger:         logger,
+		MetricsFactory: metricsFactory,
+		MemoryStore:    memoryStore,
+		BadgerStore:    badgerStore,
+	})
 	if err != nil {
 		logger.Fatal("Failed to wire up service", zap.Error(err))
 	}
@@ -163,6 +228,14 @@ func startQuery(logger *zap.Logger, baseFactory metrics.Factory, memoryStore *me
 	if err != nil {
 		logger.Fatal("Failed to get dependency reader", zap.Error(err))
 	}
+	orphanSpans, err := adjuster.ParseOrphanSpanRepair(*query.QueryOrphanSpans)
+	if err != nil {
+		logger.Fatal("Invalid orphan span repair", zap.Error(err))
+	}
+	traceIDFormat, err := queryApp.ParseTraceIDFormat(*query.QueryTraceIDFormat)
+	if err != nil {
+		logger.Fatal("Invalid trace ID format", zap.Error(err))
+	}
 	tracer, closer, err := jaegerClientConfig.Configuration{
 		Sampler: &jaegerClientConfig.SamplerConfig{
 			Type:  "probabilistic",
@@ -174,12 +247,17 @@ func startQuery(logger *zap.Logger, baseFactory metrics.Factory, memoryStore *me
 		logger.Fatal("Failed to initialize tracer", zap.Error(err))
 	}
 	defer closer.Close()
-	rHandler := queryApp.NewAPIHandler(
-		spanReader,
-		dependencyReader,
+	handlerOpts := []queryApp.HandlerOption{
 		queryApp.HandlerOptions.Prefix(*query.QueryPrefix),
 		queryApp.HandlerOptions.Logger(logger),
-		queryApp.HandlerOptions.Tracer(tracer))
+		queryApp.HandlerOptions.Tracer(tracer),
+		queryApp.HandlerOptions.Adjusters(queryApp.NewAdjusters(orphanSpans, *query.QueryClockSkew, *query.QueryClockSkewMaxAdjustment)...),
+		queryApp.HandlerOptions.TraceIDFormat(traceIDFormat),
+	}
+	if *query.QueryCompleteness {
+		handlerOpts = append(handlerOpts, queryApp.HandlerOptions.Completeness(*query.QueryCompletenessRequireRoot))
+	}
+	rHandler := queryApp.NewAPIHandler(spanReader, dependencyReader, handlerOpts...)
 	sHandler := queryApp.NewStaticAssetsHandler(*query.QueryStaticAssets)
 	r := mux.NewRouter()
 	rHandler.RegisterRoutes(r)
@@ -37,12 +37,24 @@ import (
 // The algorithm assumes that all spans have unique IDs, so the trace may need
 // to go through another adjuster first, such as SpanIDDeduper.
 //
+// The adjusted spans record the applied offset in the ClockSkewAdjustmentTag.
+//
 // This adjuster never returns any errors. Instead it records any issues
 // it encounters in Span.Warnings.
 func ClockSkew() Adjuster {
+	return BoundedClockSkew(0)
+}
+
+// BoundedClockSkew returns a ClockSkew adjuster that does not adjust the spans
+// whose skew exceeds maxAdjustment, unbounded if 0, so that large offsets more
+// likely caused by real issues than by unsynchronized clocks remain visible.
+// Such spans, and their descendants from the same host, are left as they are
+// with a warning.
+func BoundedClockSkew(maxAdjustment time.Duration) Adjuster {
 	return Func(func(trace *model.Trace) (*model.Trace, error) {
 		adjuster := &clockSkewAdjuster{
-			trace: trace,
+			trace:         trace,
+			maxAdjustment: maxAdjustment,
 		}
 		adjuster.buildNodesMap()
 		adjuster.buildSubGraphs()
@@ -54,15 +66,20 @@ func ClockSkew() Adjuster {
 	})
 }
 
+// ClockSkewAdjustmentTag is the tag recording the offset added to the timestamps of adjusted spans, e.g. "35ms"
+const ClockSkewAdjustmentTag = "clock.skew.adjustment"
+
 const (
 	warningDuplicateSpanID       = "duplicate span IDs; skipping clock skew adjustment"
 	warningFormatInvalidParentID = "invalid parent span IDs=%s; skipping clock skew adjustment"
+	warningFormatMaxAdjustment   = "clock skew adjustment of %v exceeds the maximum of %v; skipping clock skew adjustment"
 )
 
 type clockSkewAdjuster struct {
-	trace *model.Trace
-	spans map[model.SpanID]*node
-	roots map[model.SpanID]*node
+	trace         *model.Trace
+	spans         map[model.SpanID]*node
+	roots         map[model.SpanID]*node
+	maxAdjustment time.Duration
 }
 
 type clockSkew struct {
@@ -144,6 +161,11 @@ func (a *clockSkewAdjuster) adjustNode(n *node, parent *node, skew clockSkew) {
 			hostKey: n.hostKey,
 			delta:   a.calculateSkew(n, parent),
 		}
+		if a.maxAdjustment > 0 && (skew.delta > a.maxAdjustment || skew.delta < -a.maxAdjustment) {
+			warning := fmt.Sprintf(warningFormatMaxAdjustment, skew.delta, a.maxAdjustment)
+			n.span.Warnings = append(n.span.Warnings, warning)
+			skew.delta = 0
+		}
 	}
 	a.adjustTimestamps(n, skew)
 	for _, child := range n.children {
@@ -178,6 +200,10 @@ func (a *clockSkewAdjuster) calculateSkew(child *node, parent *node) time.Durati
 }
 
 func (a *clockSkewAdjuster) adjustTimestamps(n *node, skew clockSkew) {
+	if skew.delta == 0 {
+		return
+	}
+	n.span.Tags = append(n.span.Tags, model.String(ClockSkewAdjustmentTag, skew.delta.String()))
 	n.span.StartTime = n.span.StartTime.Add(skew.delta)
 	for i := range n.span.Logs {
 		n.span.Logs[i].Timestamp = n.span.Logs[i].Timestamp.Add(skew.delta)
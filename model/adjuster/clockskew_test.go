@@ -201,6 +201,52 @@ func TestClockSkewAdjuster(t *testing.T) {
 	}
 }
 
+func TestBoundedClockSkew(t *testing.T) {
+	makeTrace := func() *model.Trace {
+		span := func(id, parent model.SpanID, host string, startTime, duration time.Duration) *model.Span {
+			return &model.Span{
+				TraceID:      model.TraceID{Low: 1},
+				SpanID:       id,
+				ParentSpanID: parent,
+				StartTime:    time.Unix(0, 0).Add(startTime),
+				Duration:     duration,
+				Process: &model.Process{
+					ServiceName: host,
+					Tags:        []model.KeyValue{model.String("ip", host)},
+				},
+			}
+		}
+		return &model.Trace{Spans: []*model.Span{
+			span(1, 0, "a", 10*time.Millisecond, 100*time.Millisecond),
+			// latency = (100-50) / 2 = 25, delta = (10 - 0) + 25 = 35
+			span(2, 1, "b", 0, 50*time.Millisecond),
+			span(3, 2, "b", 10*time.Millisecond, 10*time.Millisecond),
+		}}
+	}
+
+	trace, err := BoundedClockSkew(35 * time.Millisecond).Adjust(makeTrace())
+	require.NoError(t, err)
+	for _, id := range []model.SpanID{2, 3} {
+		span := trace.FindSpanByID(id)
+		assert.Empty(t, span.Warnings)
+		assert.Equal(t, model.KeyValues{model.String(ClockSkewAdjustmentTag, "35ms")}, span.Tags)
+	}
+	assert.Equal(t, time.Unix(0, 0).Add(35*time.Millisecond), trace.FindSpanByID(2).StartTime)
+	assert.Equal(t, time.Unix(0, 0).Add(45*time.Millisecond), trace.FindSpanByID(3).StartTime)
+	assert.Empty(t, trace.FindSpanByID(1).Tags, "the root span is not adjusted")
+
+	trace, err = BoundedClockSkew(30 * time.Millisecond).Adjust(makeTrace())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"clock skew adjustment of 35ms exceeds the maximum of 30ms; skipping clock skew adjustment"},
+		trace.FindSpanByID(2).Warnings)
+	for _, id := range []model.SpanID{2, 3} {
+		span := trace.FindSpanByID(id)
+		assert.Empty(t, span.Tags)
+	}
+	assert.Equal(t, time.Unix(0, 0), trace.FindSpanByID(2).StartTime)
+	assert.Equal(t, time.Unix(0, 0).Add(10*time.Millisecond), trace.FindSpanByID(3).StartTime)
+}
+
 func TestHostKey(t *testing.T) {
 	testCases := []struct {
 		tag     model.KeyValue
@@ -0,0 +1,141 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package adjuster
+
+import (
+	"fmt"
+
+	"github.com/uber/jaeger/model"
+)
+
+// OrphanSpanRepair describes how the spans referencing a parent missing from the trace are repaired
+type OrphanSpanRepair string
+
+const (
+	// NoOrphanSpanRepair leaves the orphan spans as they are
+	NoOrphanSpanRepair OrphanSpanRepair = ""
+	// ReparentOrphanSpans makes the orphan spans children of the root span of the trace
+	ReparentOrphanSpans OrphanSpanRepair = "reparent"
+	// PlaceholderOrphanSpans adds a placeholder root span in place of each missing parent
+	PlaceholderOrphanSpans OrphanSpanRepair = "placeholder"
+
+	// PlaceholderOperationName is the operation name of the spans created in place of missing parents
+	PlaceholderOperationName = "<missing span>"
+)
+
+// ParseOrphanSpanRepair converts a string into an OrphanSpanRepair, "" and "none" disable the repair
+func ParseOrphanSpanRepair(s string) (OrphanSpanRepair, error) {
+	switch OrphanSpanRepair(s) {
+	case NoOrphanSpanRepair, "none":
+		return NoOrphanSpanRepair, nil
+	case ReparentOrphanSpans, PlaceholderOrphanSpans:
+		return OrphanSpanRepair(s), nil
+	}
+	return NoOrphanSpanRepair, fmt.Errorf("Unknown orphan span repair %q", s)
+}
+
+// OrphanSpans returns an adjuster that repairs the spans whose parent is missing from the trace,
+// e.g. because the parent span was dropped by the client or the collector, so that the trace
+// is displayed as a single tree:
+//   - with ReparentOrphanSpans the orphans become children of the earliest root span of the trace,
+//     a trace without any root span is left as is;
+//   - with PlaceholderOrphanSpans a root span is created for each missing parent, starting with
+//     its earliest child and ending with its latest one.
+//
+// This adjuster never returns any errors. Instead it records the repairs in Span.Warnings.
+func OrphanSpans(repair OrphanSpanRepair) Adjuster {
+	return Func(func(trace *model.Trace) (*model.Trace, error) {
+		if repair == NoOrphanSpanRepair {
+			return trace, nil
+		}
+		spanIDs := make(map[model.SpanID]struct{}, len(trace.Spans))
+		for _, span := range trace.Spans {
+			spanIDs[span.SpanID] = struct{}{}
+		}
+		orphansByParent := make(map[model.SpanID][]*model.Span)
+		var parentIDs []model.SpanID
+		var root *model.Span
+		for _, span := range trace.Spans {
+			if span.ParentSpanID == 0 {
+				if root == nil || span.StartTime.Before(root.StartTime) {
+					root = span
+				}
+				continue
+			}
+			if _, ok := spanIDs[span.ParentSpanID]; !ok {
+				if _, ok := orphansByParent[span.ParentSpanID]; !ok {
+					parentIDs = append(parentIDs, span.ParentSpanID)
+				}
+				orphansByParent[span.ParentSpanID] = append(orphansByParent[span.ParentSpanID], span)
+			}
+		}
+		for _, parentID := range parentIDs {
+			orphans := orphansByParent[parentID]
+			if repair == ReparentOrphanSpans {
+				if root == nil {
+					continue
+				}
+				warning := fmt.Sprintf("parent span %v is missing from the trace, the span was re-parented to the trace root", parentID)
+				for _, orphan := range orphans {
+					setParent(orphan, parentID, root.SpanID)
+					orphan.Warnings = append(orphan.Warnings, warning)
+				}
+			} else {
+				trace.Spans = append(trace.Spans, placeholderSpan(parentID, orphans))
+			}
+		}
+		return trace, nil
+	})
+}
+
+// setParent replaces the references of the span to its old parent
+func setParent(span *model.Span, oldParentID, newParentID model.SpanID) {
+	span.ParentSpanID = newParentID
+	for i := range span.References {
+		ref := &span.References[i]
+		if ref.TraceID == span.TraceID && ref.SpanID == oldParentID {
+			ref.SpanID = newParentID
+		}
+	}
+}
+
+func placeholderSpan(spanID model.SpanID, children []*model.Span) *model.Span {
+	start, end := children[0].StartTime, children[0].StartTime.Add(children[0].Duration)
+	for _, child := range children[1:] {
+		if child.StartTime.Before(start) {
+			start = child.StartTime
+		}
+		if childEnd := child.StartTime.Add(child.Duration); childEnd.After(end) {
+			end = childEnd
+		}
+	}
+	return &model.Span{
+		TraceID:       children[0].TraceID,
+		SpanID:        spanID,
+		OperationName: PlaceholderOperationName,
+		StartTime:     start,
+		Duration:      end.Sub(start),
+		Process:       children[0].Process,
+		Warnings: []string{
+			fmt.Sprintf("span %v is missing from the trace, this placeholder was created for its %d children", spanID, len(children)),
+		},
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package adjuster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/jaeger/model"
+)
+
+func newOrphanTrace() *model.Trace {
+	start := time.Unix(100, 0)
+	traceID := model.TraceID{Low: 1}
+	child := func(spanID, parentID model.SpanID, offset time.Duration) *model.Span {
+		return &model.Span{
+			TraceID:      traceID,
+			SpanID:       spanID,
+			ParentSpanID: parentID,
+			References:   []model.SpanRef{{RefType: model.ChildOf, TraceID: traceID, SpanID: parentID}},
+			StartTime:    start.Add(offset),
+			Duration:     time.Second,
+			Process:      &model.Process{ServiceName: "svc"},
+		}
+	}
+	return &model.Trace{
+		Spans: []*model.Span{
+			{TraceID: traceID, SpanID: 1, StartTime: start},
+			child(2, 1, 0),
+			child(3, 9, 2*time.Second), // orphan
+			child(4, 9, time.Second),   // orphan with the same missing parent
+			child(5, 3, 0),
+		},
+	}
+}
+
+func TestParseOrphanSpanRepair(t *testing.T) {
+	for s, expected := range map[string]OrphanSpanRepair{
+		"":            NoOrphanSpanRepair,
+		"none":        NoOrphanSpanRepair,
+		"reparent":    ReparentOrphanSpans,
+		"placeholder": PlaceholderOrphanSpans,
+	} {
+		repair, err := ParseOrphanSpanRepair(s)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, repair)
+	}
+	_, err := ParseOrphanSpanRepair("drop")
+	assert.EqualError(t, err, `Unknown orphan span repair "drop"`)
+}
+
+func TestOrphanSpansNoRepair(t *testing.T) {
+	trace, err := OrphanSpans(NoOrphanSpanRepair).Adjust(newOrphanTrace())
+	require.NoError(t, err)
+	assert.Equal(t, newOrphanTrace(), trace)
+}
+
+func TestOrphanSpansReparent(t *testing.T) {
+	trace, err := OrphanSpans(ReparentOrphanSpans).Adjust(newOrphanTrace())
+	require.NoError(t, err)
+	require.Len(t, trace.Spans, 5)
+	for _, span := range trace.Spans[2:4] {
+		assert.EqualValues(t, 1, span.ParentSpanID)
+		assert.EqualValues(t, 1, span.References[0].SpanID)
+		assert.Equal(t, []string{"parent span 9 is missing from the trace, the span was re-parented to the trace root"}, span.Warnings)
+	}
+	assert.EqualValues(t, 3, trace.Spans[4].ParentSpanID, "spans with a parent are not changed")
+	assert.Empty(t, trace.Spans[4].Warnings)
+}
+
+func TestOrphanSpansReparentWithoutRoot(t *testing.T) {
+	trace := newOrphanTrace()
+	trace.Spans = trace.Spans[2:]
+	trace, err := OrphanSpans(ReparentOrphanSpans).Adjust(trace)
+	require.NoError(t, err)
+	assert.EqualValues(t, 9, trace.Spans[0].ParentSpanID)
+	assert.Empty(t, trace.Spans[0].Warnings)
+}
+
+func TestOrphanSpansPlaceholder(t *testing.T) {
+	trace, err := OrphanSpans(PlaceholderOrphanSpans).Adjust(newOrphanTrace())
+	require.NoError(t, err)
+	require.Len(t, trace.Spans, 6)
+	placeholder := trace.Spans[5]
+	assert.EqualValues(t, 9, placeholder.SpanID)
+	assert.EqualValues(t, 0, placeholder.ParentSpanID)
+	assert.Equal(t, PlaceholderOperationName, placeholder.OperationName)
+	assert.Equal(t, time.Unix(101, 0), placeholder.StartTime)
+	assert.Equal(t, 2*time.Second, placeholder.Duration)
+	assert.Equal(t, "svc", placeholder.Process.ServiceName)
+	assert.Equal(t, []string{"span 9 is missing from the trace, this placeholder was created for its 2 children"}, placeholder.Warnings)
+	assert.EqualValues(t, 9, trace.Spans[2].ParentSpanID, "the orphans keep their parent")
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+// Format identifies the codec used to serialize a span, it is stored as the header byte of the payload
+type Format byte
+
+const (
+	// NoFormat means the spans are not serialized by a codec but stored in the native layout of the backend
+	NoFormat Format = iota
+	// ThriftFormat serializes spans as jaeger.thrift batches with the binary protocol
+	ThriftFormat
+	// JSONFormat serializes spans as JSON, which is the easiest to debug
+	JSONFormat
+	// ProtobufFormat serializes spans in the protobuf wire format described in span.proto, which is the densest
+	ProtobufFormat
+)
+
+var (
+	// ErrEmptyPayload is returned when deserializing an empty payload
+	ErrEmptyPayload = errors.New("Cannot deserialize an empty span payload")
+
+	formatNames = map[Format]string{
+		NoFormat:       "none",
+		ThriftFormat:   "thrift",
+		JSONFormat:     "json",
+		ProtobufFormat: "protobuf",
+	}
+
+	codecs = map[Format]Codec{
+		ThriftFormat:   thriftCodec{},
+		JSONFormat:     jsonCodec{},
+		ProtobufFormat: protobufCodec{},
+	}
+)
+
+// Codec converts spans to and from bytes
+type Codec interface {
+	Marshal(span *model.Span) ([]byte, error)
+	Unmarshal(data []byte) (*model.Span, error)
+}
+
+// ParseFormat returns the Format with the given name, empty meaning NoFormat
+func ParseFormat(name string) (Format, error) {
+	if name == "" {
+		return NoFormat, nil
+	}
+	for format, formatName := range formatNames {
+		if formatName == name {
+			return format, nil
+		}
+	}
+	return NoFormat, fmt.Errorf("Unknown span serialization format %q", name)
+}
+
+func (f Format) String() string {
+	if name, ok := formatNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("<unknown format %d>", f)
+}
+
+// serializerMetrics are the serialization latencies of a format
+type serializerMetrics struct {
+	Marshal   metrics.Timer `metric:"serialization.marshal"`
+	Unmarshal metrics.Timer `metric:"serialization.unmarshal"`
+}
+
+// Serializer serializes spans with any of the codecs and records how long it takes
+type Serializer struct {
+	metrics map[Format]*serializerMetrics
+}
+
+// NewSerializer creates a Serializer whose latencies are tagged with the format
+func NewSerializer(metricsFactory metrics.Factory) *Serializer {
+	s := &Serializer{metrics: make(map[Format]*serializerMetrics, len(codecs))}
+	for format := range codecs {
+		m := &serializerMetrics{}
+		metrics.Init(m, metricsFactory, map[string]string{"format": format.String()})
+		s.metrics[format] = m
+	}
+	return s
+}
+
+// Serialize returns the span serialized with the given format, preceded by the format header byte
+func (s *Serializer) Serialize(format Format, span *model.Span) ([]byte, error) {
+	codec, ok := codecs[format]
+	if !ok {
+		return nil, fmt.Errorf("Cannot serialize span with format %v", format)
+	}
+	start := time.Now()
+	payload, err := codec.Marshal(span)
+	s.metrics[format].Marshal.Record(time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{byte(format)}, payload...), nil
+}
+
+// Deserialize returns the span serialized by Serialize, whatever the format that was used
+func (s *Serializer) Deserialize(data []byte) (*model.Span, error) {
+	if len(data) == 0 {
+		return nil, ErrEmptyPayload
+	}
+	format := Format(data[0])
+	codec, ok := codecs[format]
+	if !ok {
+		return nil, fmt.Errorf("Cannot deserialize span with format %v", format)
+	}
+	start := time.Now()
+	span, err := codec.Unmarshal(data[1:])
+	s.metrics[format].Unmarshal.Record(time.Since(start))
+	return span, err
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package codec
+
+import (
+	"testing"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+	jConverter "github.com/uber/jaeger/model/converter/thrift/jaeger"
+	"github.com/uber/jaeger/thrift-gen/jaeger"
+)
+
+var formats = []Format{ThriftFormat, JSONFormat, ProtobufFormat}
+
+// testSpan has all fields populated, with times rounded to microseconds like the other formats store them
+func testSpan() *model.Span {
+	startTime := model.EpochMicrosecondsAsTime(1485467191639875)
+	return &model.Span{
+		TraceID:       model.TraceID{Low: 0x52969a8955571a3f, High: 0x1},
+		SpanID:        model.SpanID(0x647d98),
+		ParentSpanID:  model.SpanID(0x68c4e3),
+		OperationName: "get",
+		References: []model.SpanRef{
+			{RefType: model.FollowsFrom, TraceID: model.TraceID{Low: 0x52969a8955571a3f, High: 0x1}, SpanID: model.SpanID(0x98)},
+		},
+		Flags:     model.Flags(1),
+		StartTime: startTime,
+		Duration:  22938 * time.Microsecond,
+		Tags: model.KeyValues{
+			model.String("http.url", "http://127.0.0.1:15598/client_transactions"),
+			model.Bool("error", true),
+			model.Int64("peer.port", -53931),
+			model.Float64("temperature", 72.5),
+			model.Binary("blob", []byte{0x00, 0xff}),
+		},
+		Logs: []model.Log{
+			{
+				Timestamp: startTime.Add(time.Millisecond),
+				Fields:    []model.KeyValue{model.String("event", "retry"), model.Int64("attempt", 2)},
+			},
+		},
+		Process: &model.Process{
+			ServiceName: "api",
+			Tags:        model.KeyValues{model.String("hostname", "api246-sjc1")},
+		},
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, format := range append(formats, NoFormat) {
+		parsed, err := ParseFormat(format.String())
+		require.NoError(t, err)
+		assert.Equal(t, format, parsed)
+	}
+	format, err := ParseFormat("")
+	require.NoError(t, err)
+	assert.Equal(t, NoFormat, format)
+
+	_, err = ParseFormat("avro")
+	assert.EqualError(t, err, `Unknown span serialization format "avro"`)
+	assert.Equal(t, "<unknown format 42>", Format(42).String())
+}
+
+func TestSerializerRoundTrip(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	serializer := NewSerializer(metricsFactory)
+	for _, format := range formats {
+		t.Run(format.String(), func(t *testing.T) {
+			span := testSpan()
+			data, err := serializer.Serialize(format, span)
+			require.NoError(t, err)
+			assert.Equal(t, byte(format), data[0])
+
+			decoded, err := serializer.Deserialize(data)
+			require.NoError(t, err)
+			span.NormalizeTimestamps()
+			decoded.NormalizeTimestamps()
+			assert.Equal(t, span, decoded)
+
+			_, gauges := metricsFactory.Snapshot()
+			assert.Contains(t, gauges, "serialization.marshal|format="+format.String()+".P50")
+			assert.Contains(t, gauges, "serialization.unmarshal|format="+format.String()+".P50")
+		})
+	}
+}
+
+func TestSerializerMixedFormats(t *testing.T) {
+	serializer := NewSerializer(metrics.NullFactory)
+	var payloads [][]byte
+	for _, format := range formats {
+		data, err := serializer.Serialize(format, testSpan())
+		require.NoError(t, err)
+		payloads = append(payloads, data)
+	}
+	for i, data := range payloads {
+		span, err := serializer.Deserialize(data)
+		require.NoError(t, err, formats[i].String())
+		assert.Equal(t, "get", span.OperationName)
+		assert.Equal(t, "api", span.Process.ServiceName)
+	}
+}
+
+func TestSerializerErrors(t *testing.T) {
+	serializer := NewSerializer(metrics.NullFactory)
+
+	_, err := serializer.Serialize(NoFormat, testSpan())
+	assert.EqualError(t, err, "Cannot serialize span with format none")
+
+	_, err = serializer.Deserialize(nil)
+	assert.Equal(t, ErrEmptyPayload, err)
+
+	_, err = serializer.Deserialize([]byte{42, 1, 2})
+	assert.EqualError(t, err, "Cannot deserialize span with format <unknown format 42>")
+
+	for _, format := range formats {
+		data, err := serializer.Serialize(format, testSpan())
+		require.NoError(t, err)
+		_, err = serializer.Deserialize(data[:len(data)-1])
+		assert.Error(t, err, format.String())
+	}
+}
+
+func TestSerializerWarnings(t *testing.T) {
+	serializer := NewSerializer(metrics.NullFactory)
+	for _, format := range []Format{JSONFormat, ProtobufFormat} {
+		span := testSpan()
+		span.Warnings = []string{"clock skew adjustment disabled", ""}
+		data, err := serializer.Serialize(format, span)
+		require.NoError(t, err)
+		decoded, err := serializer.Deserialize(data)
+		require.NoError(t, err)
+		assert.Equal(t, span.Warnings, decoded.Warnings, format.String())
+	}
+}
+
+func TestProtobufSkipsUnknownFields(t *testing.T) {
+	data, err := protobufCodec{}.Marshal(testSpan())
+	require.NoError(t, err)
+	buf := proto.NewBuffer(data)
+	require.NoError(t, buf.EncodeVarint(100<<3|proto.WireVarint))
+	require.NoError(t, buf.EncodeVarint(42))
+	require.NoError(t, buf.EncodeVarint(101<<3|proto.WireBytes))
+	require.NoError(t, buf.EncodeStringBytes("future"))
+
+	decoded, err := protobufCodec{}.Unmarshal(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, "get", decoded.OperationName)
+}
+
+func TestProtobufCorrupted(t *testing.T) {
+	_, err := protobufCodec{}.Unmarshal([]byte{0x2a, 0x05, 'g'})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Failed to deserialize span from protobuf")
+}
+
+func TestThriftSingleSpan(t *testing.T) {
+	span := testSpan()
+	batch := &jaeger.Batch{
+		Process: jConverter.FromDomainProcess(span.Process),
+		Spans:   jConverter.FromDomain([]*model.Span{span, span}),
+	}
+	data, err := thrift.NewTSerializer().Write(batch)
+	require.NoError(t, err)
+	_, err = thriftCodec{}.Unmarshal(data)
+	assert.EqualError(t, err, "Expected a single span in the Thrift batch, found 2")
+}
+
+func BenchmarkSerialize(b *testing.B) {
+	serializer := NewSerializer(metrics.NullFactory)
+	span := testSpan()
+	for _, format := range formats {
+		b.Run(format.String(), func(b *testing.B) {
+			data, _ := serializer.Serialize(format, span)
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				serializer.Serialize(format, span)
+			}
+		})
+	}
+}
+
+func BenchmarkDeserialize(b *testing.B) {
+	serializer := NewSerializer(metrics.NullFactory)
+	for _, format := range formats {
+		b.Run(format.String(), func(b *testing.B) {
+			data, _ := serializer.Serialize(format, testSpan())
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				serializer.Deserialize(data)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package codec
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/uber/jaeger/model"
+)
+
+// jsonCodec serializes spans in the JSON representation of the domain model, which keeps
+// every field unlike the JSON model of the UI
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(span *model.Span) ([]byte, error) {
+	data, err := json.Marshal(span)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to serialize span to JSON")
+	}
+	return data, nil
+}
+
+func (jsonCodec) Unmarshal(data []byte) (*model.Span, error) {
+	span := &model.Span{}
+	if err := json.Unmarshal(data, span); err != nil {
+		return nil, errors.Wrap(err, "Failed to deserialize span from JSON")
+	}
+	return span, nil
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package codec
+
+import (
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/proto-gen/codecpb"
+)
+
+// protobufCodec serializes spans with the schema in span.proto, through the generated codecpb structs
+type protobufCodec struct{}
+
+func (protobufCodec) Marshal(span *model.Span) ([]byte, error) {
+	pbSpan := &codecpb.Span{
+		TraceIdLow:    span.TraceID.Low,
+		TraceIdHigh:   span.TraceID.High,
+		SpanId:        uint64(span.SpanID),
+		ParentSpanId:  uint64(span.ParentSpanID),
+		OperationName: span.OperationName,
+		Flags:         uint32(span.Flags),
+		StartTime:     span.StartTime.UnixNano(),
+		Duration:      int64(span.Duration),
+		Tags:          fromDomainKeyValues(span.Tags),
+		Warnings:      span.Warnings,
+	}
+	for _, ref := range span.References {
+		pbSpan.References = append(pbSpan.References, &codecpb.SpanRef{
+			RefType:     int32(ref.RefType),
+			TraceIdLow:  ref.TraceID.Low,
+			TraceIdHigh: ref.TraceID.High,
+			SpanId:      uint64(ref.SpanID),
+		})
+	}
+	for _, log := range span.Logs {
+		pbSpan.Logs = append(pbSpan.Logs, &codecpb.Log{
+			Timestamp: log.Timestamp.UnixNano(),
+			Fields:    fromDomainKeyValues(log.Fields),
+		})
+	}
+	if span.Process != nil {
+		pbSpan.Process = &codecpb.Process{
+			ServiceName: span.Process.ServiceName,
+			Tags:        fromDomainKeyValues(span.Process.Tags),
+		}
+	}
+	data, err := proto.Marshal(pbSpan)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to serialize span to protobuf")
+	}
+	return data, nil
+}
+
+func (protobufCodec) Unmarshal(data []byte) (*model.Span, error) {
+	pbSpan := &codecpb.Span{}
+	if err := proto.Unmarshal(data, pbSpan); err != nil {
+		return nil, errors.Wrap(err, "Failed to deserialize span from protobuf")
+	}
+	span := &model.Span{
+		TraceID:       model.TraceID{Low: pbSpan.TraceIdLow, High: pbSpan.TraceIdHigh},
+		SpanID:        model.SpanID(pbSpan.SpanId),
+		ParentSpanID:  model.SpanID(pbSpan.ParentSpanId),
+		OperationName: pbSpan.OperationName,
+		Flags:         model.Flags(pbSpan.Flags),
+		StartTime:     time.Unix(0, pbSpan.StartTime),
+		Duration:      time.Duration(pbSpan.Duration),
+		Tags:          toDomainKeyValues(pbSpan.Tags),
+		Warnings:      pbSpan.Warnings,
+	}
+	for _, ref := range pbSpan.References {
+		span.References = append(span.References, model.SpanRef{
+			RefType: model.SpanRefType(ref.RefType),
+			TraceID: model.TraceID{Low: ref.TraceIdLow, High: ref.TraceIdHigh},
+			SpanID:  model.SpanID(ref.SpanId),
+		})
+	}
+	for _, log := range pbSpan.Logs {
+		span.Logs = append(span.Logs, model.Log{
+			Timestamp: time.Unix(0, log.Timestamp),
+			Fields:    toDomainKeyValues(log.Fields),
+		})
+	}
+	if pbSpan.Process != nil {
+		span.Process = &model.Process{
+			ServiceName: pbSpan.Process.ServiceName,
+			Tags:        toDomainKeyValues(pbSpan.Process.Tags),
+		}
+	}
+	return span, nil
+}
+
+func fromDomainKeyValues(kvs []model.KeyValue) []*codecpb.KeyValue {
+	if len(kvs) == 0 {
+		return nil
+	}
+	pbKVs := make([]*codecpb.KeyValue, len(kvs))
+	for i, kv := range kvs {
+		pbKVs[i] = &codecpb.KeyValue{
+			Key:   kv.Key,
+			VType: int32(kv.VType),
+			VStr:  kv.VStr,
+			VNum:  kv.VNum,
+			VBlob: kv.VBlob,
+		}
+	}
+	return pbKVs
+}
+
+func toDomainKeyValues(pbKVs []*codecpb.KeyValue) model.KeyValues {
+	if len(pbKVs) == 0 {
+		return nil
+	}
+	kvs := make(model.KeyValues, len(pbKVs))
+	for i, kv := range pbKVs {
+		kvs[i] = model.KeyValue{
+			Key:   kv.Key,
+			VType: model.ValueType(kv.VType),
+			VStr:  kv.VStr,
+			VNum:  kv.VNum,
+			VBlob: kv.VBlob,
+		}
+	}
+	return kvs
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package codec
+
+import (
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/pkg/errors"
+
+	"github.com/uber/jaeger/model"
+	jConverter "github.com/uber/jaeger/model/converter/thrift/jaeger"
+	"github.com/uber/jaeger/thrift-gen/jaeger"
+)
+
+// thriftCodec serializes a span with its process as a jaeger.thrift batch.
+// The span warnings are not part of the Thrift model and are not kept.
+type thriftCodec struct{}
+
+func (thriftCodec) Marshal(span *model.Span) ([]byte, error) {
+	batch := &jaeger.Batch{
+		Process: jConverter.FromDomainProcess(span.Process),
+		Spans:   []*jaeger.Span{jConverter.FromDomainSpan(span)},
+	}
+	data, err := thrift.NewTSerializer().Write(batch)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to serialize span to Thrift")
+	}
+	return data, nil
+}
+
+func (thriftCodec) Unmarshal(data []byte) (*model.Span, error) {
+	batch := &jaeger.Batch{}
+	if err := thrift.NewTDeserializer().Read(batch, data); err != nil {
+		return nil, errors.Wrap(err, "Failed to deserialize span from Thrift")
+	}
+	if len(batch.Spans) != 1 {
+		return nil, errors.Errorf("Expected a single span in the Thrift batch, found %d", len(batch.Spans))
+	}
+	return jConverter.ToDomainSpan(batch.Spans[0], batch.Process), nil
+}
@@ -256,3 +256,23 @@ func TestFailureBadParentSpanID(t *testing.T) {
 	badParentSpanIDESSpan.ParentSpanID = "zz"
 	failingSpanTransformAnyMsg(t, &badParentSpanIDESSpan)
 }
+
+func TestTraceID128BitRoundTrip(t *testing.T) {
+	traceID := model.TraceID{High: 0x0af7651916cd43dd, Low: 0x8448eb211c80319c}
+	span := &model.Span{
+		TraceID: traceID,
+		SpanID:  model.SpanID(1),
+		References: []model.SpanRef{
+			{RefType: model.FollowsFrom, TraceID: traceID, SpanID: model.SpanID(2)},
+		},
+		Process: &model.Process{ServiceName: "svc"},
+	}
+	jSpan := FromDomainEmbedProcess(span)
+	assert.Equal(t, jModel.TraceID("af7651916cd43dd8448eb211c80319c"), jSpan.TraceID)
+
+	domainSpan, err := SpanToDomain(jSpan)
+	require.NoError(t, err)
+	assert.Equal(t, traceID, domainSpan.TraceID)
+	require.Len(t, domainSpan.References, 1)
+	assert.Equal(t, traceID, domainSpan.References[0].TraceID)
+}
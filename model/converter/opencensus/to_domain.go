@@ -0,0 +1,244 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package opencensus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	commonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/opentracing/opentracing-go/ext"
+
+	"github.com/uber/jaeger/model"
+)
+
+const (
+	statusCodeTag    = "status.code"
+	statusMessageTag = "status.message"
+	hostnameTag      = "hostname"
+	pidTag           = "pid"
+	libraryTag       = "opencensus.exporter.version"
+)
+
+// ToDomain transforms a set of spans reported by an OpenCensus node into a slice of model.Span.
+// An error is returned if any of the spans has an invalid trace or span ID.
+func ToDomain(node *commonpb.Node, ocSpans []*tracepb.Span) ([]*model.Span, error) {
+	return toDomain{}.ToDomain(node, ocSpans)
+}
+
+// ToDomainSpan transforms a span reported by an OpenCensus node into model.Span.
+func ToDomainSpan(node *commonpb.Node, ocSpan *tracepb.Span) (*model.Span, error) {
+	return toDomain{}.transformSpan(ocSpan, toDomain{}.getProcess(node))
+}
+
+// toDomain is a private struct that namespaces some conversion functions. It has access to its own private utility functions
+type toDomain struct{}
+
+func (td toDomain) ToDomain(node *commonpb.Node, ocSpans []*tracepb.Span) ([]*model.Span, error) {
+	spans := make([]*model.Span, len(ocSpans))
+	mProcess := td.getProcess(node)
+	for i, ocSpan := range ocSpans {
+		span, err := td.transformSpan(ocSpan, mProcess)
+		if err != nil {
+			return nil, err
+		}
+		spans[i] = span
+	}
+	return spans, nil
+}
+
+func (td toDomain) transformSpan(ocSpan *tracepb.Span, mProcess *model.Process) (*model.Span, error) {
+	traceID, err := td.getTraceID(ocSpan.TraceId)
+	if err != nil {
+		return nil, err
+	}
+	spanID, err := td.getSpanID(ocSpan.SpanId)
+	if err != nil {
+		return nil, err
+	}
+	var parentSpanID model.SpanID
+	if len(ocSpan.ParentSpanId) > 0 {
+		if parentSpanID, err = td.getSpanID(ocSpan.ParentSpanId); err != nil {
+			return nil, err
+		}
+	}
+	refs, err := td.getReferences(ocSpan.Links)
+	if err != nil {
+		return nil, err
+	}
+	startTime := td.getTime(ocSpan.StartTime)
+	span := &model.Span{
+		TraceID:       traceID,
+		SpanID:        spanID,
+		ParentSpanID:  parentSpanID,
+		OperationName: ocSpan.GetName().GetValue(),
+		References:    refs,
+		StartTime:     startTime,
+		Duration:      td.getTime(ocSpan.EndTime).Sub(startTime),
+		Tags:          td.getTags(ocSpan),
+		Logs:          td.getLogs(ocSpan.GetTimeEvents()),
+		Process:       mProcess,
+	}
+	// OpenCensus only exports sampled spans
+	span.Flags.SetSampled()
+	return span, nil
+}
+
+func (td toDomain) getTraceID(id []byte) (model.TraceID, error) {
+	if len(id) != 16 {
+		return model.TraceID{}, fmt.Errorf("Invalid trace ID length %d, expected 16 bytes", len(id))
+	}
+	return model.TraceID{
+		High: binary.BigEndian.Uint64(id[:8]),
+		Low:  binary.BigEndian.Uint64(id[8:]),
+	}, nil
+}
+
+func (td toDomain) getSpanID(id []byte) (model.SpanID, error) {
+	if len(id) != 8 {
+		return 0, fmt.Errorf("Invalid span ID length %d, expected 8 bytes", len(id))
+	}
+	return model.SpanID(binary.BigEndian.Uint64(id)), nil
+}
+
+func (td toDomain) getTime(ts *timestamp.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return time.Unix(ts.Seconds, int64(ts.Nanos)).UTC()
+}
+
+// getReferences maps links to a parent span to ChildOf references, and all other links to FollowsFrom
+func (td toDomain) getReferences(links *tracepb.Span_Links) ([]model.SpanRef, error) {
+	if links == nil || len(links.Link) == 0 {
+		return nil, nil
+	}
+	refs := make([]model.SpanRef, len(links.Link))
+	for i, link := range links.Link {
+		traceID, err := td.getTraceID(link.TraceId)
+		if err != nil {
+			return nil, err
+		}
+		spanID, err := td.getSpanID(link.SpanId)
+		if err != nil {
+			return nil, err
+		}
+		refType := model.FollowsFrom
+		if link.Type == tracepb.Span_Link_PARENT_LINKED_SPAN {
+			refType = model.ChildOf
+		}
+		refs[i] = model.SpanRef{RefType: refType, TraceID: traceID, SpanID: spanID}
+	}
+	return refs, nil
+}
+
+func (td toDomain) getTags(ocSpan *tracepb.Span) model.KeyValues {
+	tags := td.getAttributes(ocSpan.GetAttributes())
+	switch ocSpan.Kind {
+	case tracepb.Span_SERVER:
+		tags = append(tags, model.String(string(ext.SpanKind), string(ext.SpanKindRPCServerEnum)))
+	case tracepb.Span_CLIENT:
+		tags = append(tags, model.String(string(ext.SpanKind), string(ext.SpanKindRPCClientEnum)))
+	}
+	if status := ocSpan.Status; status != nil {
+		tags = append(tags, model.Int64(statusCodeTag, int64(status.Code)))
+		if status.Message != "" {
+			tags = append(tags, model.String(statusMessageTag, status.Message))
+		}
+		if status.Code != 0 {
+			tags = append(tags, model.Bool(string(ext.Error), true))
+		}
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	return tags
+}
+
+func (td toDomain) getAttributes(attributes *tracepb.Span_Attributes) model.KeyValues {
+	if attributes == nil || len(attributes.AttributeMap) == 0 {
+		return nil
+	}
+	tags := make(model.KeyValues, 0, len(attributes.AttributeMap))
+	for key, value := range attributes.AttributeMap {
+		tags = append(tags, td.getTag(key, value))
+	}
+	tags.Sort()
+	return tags
+}
+
+func (td toDomain) getTag(key string, value *tracepb.AttributeValue) model.KeyValue {
+	switch v := value.Value.(type) {
+	case *tracepb.AttributeValue_StringValue:
+		return model.String(key, v.StringValue.GetValue())
+	case *tracepb.AttributeValue_IntValue:
+		return model.Int64(key, v.IntValue)
+	case *tracepb.AttributeValue_BoolValue:
+		return model.Bool(key, v.BoolValue)
+	case *tracepb.AttributeValue_DoubleValue:
+		return model.Float64(key, v.DoubleValue)
+	default:
+		return model.String(key, fmt.Sprintf("Unknown attribute value: %+v", value))
+	}
+}
+
+// getLogs converts the annotations of the span to logs, message events are ignored
+func (td toDomain) getLogs(timeEvents *tracepb.Span_TimeEvents) []model.Log {
+	if timeEvents == nil || len(timeEvents.TimeEvent) == 0 {
+		return nil
+	}
+	var logs []model.Log
+	for _, event := range timeEvents.TimeEvent {
+		annotation := event.GetAnnotation()
+		if annotation == nil {
+			continue
+		}
+		fields := model.KeyValues{model.String("message", annotation.GetDescription().GetValue())}
+		fields = append(fields, td.getAttributes(annotation.Attributes)...)
+		logs = append(logs, model.Log{
+			Timestamp: td.getTime(event.Time),
+			Fields:    fields,
+		})
+	}
+	return logs
+}
+
+// getProcess takes the node that reported the spans and produces a model.Process
+func (td toDomain) getProcess(node *commonpb.Node) *model.Process {
+	process := &model.Process{ServiceName: node.GetServiceInfo().GetName()}
+	if hostname := node.GetIdentifier().GetHostName(); hostname != "" {
+		process.Tags = append(process.Tags, model.String(hostnameTag, hostname))
+	}
+	if pid := node.GetIdentifier().GetPid(); pid != 0 {
+		process.Tags = append(process.Tags, model.Int64(pidTag, int64(pid)))
+	}
+	if version := node.GetLibraryInfo().GetExporterVersion(); version != "" {
+		process.Tags = append(process.Tags, model.String(libraryTag, version))
+	}
+	for key, value := range node.GetAttributes() {
+		process.Tags = append(process.Tags, model.String(key, value))
+	}
+	process.Tags.Sort()
+	return process
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package opencensus
+
+import (
+	"testing"
+	"time"
+
+	commonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/jaeger/model"
+)
+
+var (
+	testTraceID = []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 2}
+	testSpanID  = []byte{0, 0, 0, 0, 0, 0, 0, 3}
+	testParent  = []byte{0, 0, 0, 0, 0, 0, 0, 4}
+)
+
+func testNode() *commonpb.Node {
+	return &commonpb.Node{
+		Identifier:  &commonpb.ProcessIdentifier{HostName: "host", Pid: 42},
+		ServiceInfo: &commonpb.ServiceInfo{Name: "svc"},
+		Attributes:  map[string]string{"zone": "dca1"},
+	}
+}
+
+func TestToDomainSpan(t *testing.T) {
+	start := time.Date(2017, 11, 1, 10, 0, 0, 0, time.UTC)
+	ocSpan := &tracepb.Span{
+		TraceId:      testTraceID,
+		SpanId:       testSpanID,
+		ParentSpanId: testParent,
+		Name:         &tracepb.TruncatableString{Value: "GET /"},
+		Kind:         tracepb.Span_SERVER,
+		StartTime:    &timestamp.Timestamp{Seconds: start.Unix()},
+		EndTime:      &timestamp.Timestamp{Seconds: start.Unix(), Nanos: int32(time.Millisecond)},
+		Attributes: &tracepb.Span_Attributes{
+			AttributeMap: map[string]*tracepb.AttributeValue{
+				"http.url":    {Value: &tracepb.AttributeValue_StringValue{StringValue: &tracepb.TruncatableString{Value: "/"}}},
+				"http.status": {Value: &tracepb.AttributeValue_IntValue{IntValue: 500}},
+				"retry":       {Value: &tracepb.AttributeValue_BoolValue{BoolValue: true}},
+			},
+		},
+		Status: &tracepb.Status{Code: 13, Message: "internal"},
+		Links: &tracepb.Span_Links{
+			Link: []*tracepb.Span_Link{
+				{TraceId: testTraceID, SpanId: testParent, Type: tracepb.Span_Link_PARENT_LINKED_SPAN},
+				{TraceId: testTraceID, SpanId: testSpanID, Type: tracepb.Span_Link_CHILD_LINKED_SPAN},
+			},
+		},
+		TimeEvents: &tracepb.Span_TimeEvents{
+			TimeEvent: []*tracepb.Span_TimeEvent{
+				{
+					Time: &timestamp.Timestamp{Seconds: start.Unix()},
+					Value: &tracepb.Span_TimeEvent_Annotation_{
+						Annotation: &tracepb.Span_TimeEvent_Annotation{
+							Description: &tracepb.TruncatableString{Value: "cache miss"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	span, err := ToDomainSpan(testNode(), ocSpan)
+	require.NoError(t, err)
+	assert.Equal(t, model.TraceID{High: 1, Low: 2}, span.TraceID)
+	assert.Equal(t, model.SpanID(3), span.SpanID)
+	assert.Equal(t, model.SpanID(4), span.ParentSpanID)
+	assert.Equal(t, "GET /", span.OperationName)
+	assert.Equal(t, start, span.StartTime)
+	assert.Equal(t, time.Millisecond, span.Duration)
+	assert.True(t, span.Flags.IsSampled())
+	assert.Equal(t, []model.SpanRef{
+		{RefType: model.ChildOf, TraceID: model.TraceID{High: 1, Low: 2}, SpanID: 4},
+		{RefType: model.FollowsFrom, TraceID: model.TraceID{High: 1, Low: 2}, SpanID: 3},
+	}, span.References)
+	assert.Equal(t, model.KeyValues{
+		model.Int64("http.status", 500),
+		model.String("http.url", "/"),
+		model.Bool("retry", true),
+		model.String("span.kind", "server"),
+		model.Int64("status.code", 13),
+		model.String("status.message", "internal"),
+		model.Bool("error", true),
+	}, span.Tags)
+	assert.Equal(t, []model.Log{
+		{Timestamp: start, Fields: model.KeyValues{model.String("message", "cache miss")}},
+	}, span.Logs)
+	assert.Equal(t, &model.Process{
+		ServiceName: "svc",
+		Tags: model.KeyValues{
+			model.String("hostname", "host"),
+			model.Int64("pid", 42),
+			model.String("zone", "dca1"),
+		},
+	}, span.Process)
+}
+
+func TestToDomainInvalidIDs(t *testing.T) {
+	_, err := ToDomain(testNode(), []*tracepb.Span{{TraceId: []byte{1}, SpanId: testSpanID}})
+	assert.EqualError(t, err, "Invalid trace ID length 1, expected 16 bytes")
+
+	_, err = ToDomain(testNode(), []*tracepb.Span{{TraceId: testTraceID, SpanId: []byte{1, 2}}})
+	assert.EqualError(t, err, "Invalid span ID length 2, expected 8 bytes")
+}
+
+func TestToDomainMinimalSpan(t *testing.T) {
+	spans, err := ToDomain(nil, []*tracepb.Span{{TraceId: testTraceID, SpanId: testSpanID}})
+	require.NoError(t, err)
+	require.Len(t, spans, 1)
+	assert.Nil(t, spans[0].Tags)
+	assert.Nil(t, spans[0].References)
+	assert.Equal(t, "", spans[0].Process.ServiceName)
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package otlp
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+var (
+	spanKindNames = map[string]SpanKind{
+		"SPAN_KIND_UNSPECIFIED": SpanKindUnspecified,
+		"SPAN_KIND_INTERNAL":    SpanKindInternal,
+		"SPAN_KIND_SERVER":      SpanKindServer,
+		"SPAN_KIND_CLIENT":      SpanKindClient,
+		"SPAN_KIND_PRODUCER":    SpanKindProducer,
+		"SPAN_KIND_CONSUMER":    SpanKindConsumer,
+	}
+	statusCodeNames = map[string]StatusCode{
+		"STATUS_CODE_UNSET": StatusCodeUnset,
+		"STATUS_CODE_OK":    StatusCodeOK,
+		"STATUS_CODE_ERROR": StatusCodeError,
+	}
+)
+
+// DecodeJSON decodes a request encoded in the JSON mapping of OTLP, where the trace and span IDs
+// are hex strings, the 64-bit integers are numbers or decimal strings and the enums are numbers or names.
+func DecodeJSON(data []byte) (*ExportTraceServiceRequest, error) {
+	var request ExportTraceServiceRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// HexID is a trace or span ID, encoded as a hex string in JSON
+type HexID []byte
+
+// UnmarshalJSON decodes the hex string of the ID
+func (id *HexID) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := hex.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("Invalid hex ID %q: %v", s, err)
+	}
+	*id = decoded
+	return nil
+}
+
+// Uint64 is an unsigned 64-bit integer, encoded as a number or a decimal string in JSON
+type Uint64 uint64
+
+// UnmarshalJSON decodes the number or the decimal string
+func (u *Uint64) UnmarshalJSON(data []byte) error {
+	value, err := strconv.ParseUint(unquoteNumber(data), 10, 64)
+	if err != nil {
+		return fmt.Errorf("Invalid unsigned integer %s", data)
+	}
+	*u = Uint64(value)
+	return nil
+}
+
+// Int64 is a signed 64-bit integer, encoded as a number or a decimal string in JSON
+type Int64 int64
+
+// UnmarshalJSON decodes the number or the decimal string
+func (i *Int64) UnmarshalJSON(data []byte) error {
+	value, err := strconv.ParseInt(unquoteNumber(data), 10, 64)
+	if err != nil {
+		return fmt.Errorf("Invalid integer %s", data)
+	}
+	*i = Int64(value)
+	return nil
+}
+
+// UnmarshalJSON decodes the number or the name of the kind
+func (k *SpanKind) UnmarshalJSON(data []byte) error {
+	value, err := unmarshalEnum(data, func(name string) (int32, bool) {
+		kind, ok := spanKindNames[name]
+		return int32(kind), ok
+	})
+	*k = SpanKind(value)
+	return err
+}
+
+// UnmarshalJSON decodes the number or the name of the code
+func (c *StatusCode) UnmarshalJSON(data []byte) error {
+	value, err := unmarshalEnum(data, func(name string) (int32, bool) {
+		code, ok := statusCodeNames[name]
+		return int32(code), ok
+	})
+	*c = StatusCode(value)
+	return err
+}
+
+func unquoteNumber(data []byte) string {
+	if len(data) >= 2 && data[0] == '"' && data[len(data)-1] == '"' {
+		return string(data[1 : len(data)-1])
+	}
+	return string(data)
+}
+
+func unmarshalEnum(data []byte, byName func(string) (int32, bool)) (int32, error) {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		value, ok := byName(name)
+		if !ok {
+			return 0, fmt.Errorf("Unknown enum value %q", name)
+		}
+		return value, nil
+	}
+	var value int32
+	if err := json.Unmarshal(data, &value); err != nil {
+		return 0, fmt.Errorf("Invalid enum value %s", data)
+	}
+	return value, nil
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package otlp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	start := time.Date(2017, 11, 1, 10, 0, 0, 0, time.UTC)
+	data := []byte(`{
+		"resourceSpans": [{
+			"resource": {"attributes": [
+				{"key": "service.name", "value": {"stringValue": "svc"}},
+				{"key": "host.name", "value": {"stringValue": "host"}},
+				{"key": "process.pid", "value": {"intValue": "42"}}
+			]},
+			"scopeSpans": [{
+				"scope": {"name": "net/http", "version": "1.0"},
+				"spans": [{
+					"traceId": "00000000000000010000000000000002",
+					"spanId": "0000000000000003",
+					"parentSpanId": "0000000000000004",
+					"name": "GET /",
+					"kind": "SPAN_KIND_SERVER",
+					"startTimeUnixNano": "1509530400000000000",
+					"endTimeUnixNano": 1509530400001000000,
+					"attributes": [
+						{"key": "http.url", "value": {"stringValue": "/"}},
+						{"key": "http.status_code", "value": {"intValue": 500}},
+						{"key": "retry", "value": {"boolValue": true}},
+						{"key": "http.methods", "value": {"arrayValue": {"values": [{"stringValue": "GET"}, {"stringValue": "HEAD"}]}}}
+					],
+					"events": [{
+						"timeUnixNano": "1509530400000000000",
+						"name": "cache miss",
+						"attributes": [{"key": "key", "value": {"stringValue": "user:1"}}]
+					}],
+					"links": [{"traceId": "00000000000000010000000000000002", "spanId": "0000000000000004"}],
+					"status": {"code": 2, "message": "internal"}
+				}]
+			}]
+		}]
+	}`)
+	request, err := DecodeJSON(data)
+	require.NoError(t, err)
+	assert.Equal(t, testRequest(start), request)
+}
+
+func TestDecodeJSONErrors(t *testing.T) {
+	testCases := []struct {
+		data     string
+		expected string
+	}{
+		{data: `{"resourceSpans": [{"scopeSpans": [{"spans": [{"traceId": "xyz"}]}]}]}`, expected: "Invalid hex ID"},
+		{data: `{"resourceSpans": [{"scopeSpans": [{"spans": [{"startTimeUnixNano": "-1"}]}]}]}`, expected: "Invalid unsigned integer"},
+		{data: `{"resourceSpans": [{"scopeSpans": [{"spans": [{"kind": "SPAN_KIND_UNKNOWN"}]}]}]}`, expected: "Unknown enum value"},
+		{data: `{"resourceSpans": [{"scopeSpans": [{"spans": [{"status": {"code": true}}]}]}]}`, expected: "Invalid enum value"},
+		{data: `{"resourceSpans": [{"resource": {"attributes": [{"value": {"intValue": "x"}}]}}]}`, expected: "Invalid integer"},
+		{data: `{"resourceSpans": `, expected: "unexpected end of JSON input"},
+	}
+	for _, testCase := range testCases {
+		_, err := DecodeJSON([]byte(testCase.data))
+		if assert.Error(t, err, testCase.data) {
+			assert.Contains(t, err.Error(), testCase.expected)
+		}
+	}
+}
+
+func TestDecodeJSONEnumNames(t *testing.T) {
+	request, err := DecodeJSON([]byte(`{"resourceSpans": [{"scopeSpans": [{"spans": [{"kind": 3, "status": {"code": "STATUS_CODE_OK"}}]}]}]}`))
+	require.NoError(t, err)
+	span := request.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	assert.Equal(t, SpanKindClient, span.Kind)
+	assert.Equal(t, StatusCodeOK, span.Status.Code)
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package otlp
+
+// The types below mirror the messages of the OTLP trace protocol, opentelemetry/proto/trace/v1, keeping only
+// the fields converted to the domain model. They are decoded by UnmarshalProtobuf and UnmarshalJSON.
+
+// SpanKind is the kind of an OTLP span
+type SpanKind int32
+
+// The kinds of OTLP spans
+const (
+	SpanKindUnspecified SpanKind = 0
+	SpanKindInternal    SpanKind = 1
+	SpanKindServer      SpanKind = 2
+	SpanKindClient      SpanKind = 3
+	SpanKindProducer    SpanKind = 4
+	SpanKindConsumer    SpanKind = 5
+)
+
+// StatusCode is the code of the status of an OTLP span
+type StatusCode int32
+
+// The codes of the status of OTLP spans
+const (
+	StatusCodeUnset StatusCode = 0
+	StatusCodeOK    StatusCode = 1
+	StatusCodeError StatusCode = 2
+)
+
+// ExportTraceServiceRequest is the body of the requests exporting spans
+type ExportTraceServiceRequest struct {
+	ResourceSpans []*ResourceSpans `json:"resourceSpans"`
+}
+
+// ResourceSpans are the spans of a resource, i.e. a process, grouped by instrumentation scope
+type ResourceSpans struct {
+	Resource   *Resource     `json:"resource"`
+	ScopeSpans []*ScopeSpans `json:"scopeSpans"`
+	// InstrumentationLibrarySpans is the deprecated name of ScopeSpans, still sent by older SDKs
+	InstrumentationLibrarySpans []*ScopeSpans `json:"instrumentationLibrarySpans"`
+}
+
+// Resource is the entity producing the spans, described by its attributes
+type Resource struct {
+	Attributes []*KeyValue `json:"attributes"`
+}
+
+// ScopeSpans are the spans produced by an instrumentation scope
+type ScopeSpans struct {
+	Scope *InstrumentationScope `json:"scope"`
+	// InstrumentationLibrary is the deprecated name of Scope, still sent by older SDKs
+	InstrumentationLibrary *InstrumentationScope `json:"instrumentationLibrary"`
+	Spans                  []*Span               `json:"spans"`
+}
+
+// InstrumentationScope is the library producing the spans
+type InstrumentationScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Span is an OTLP span, whose times are in nanoseconds since the epoch
+type Span struct {
+	TraceID           HexID       `json:"traceId"`
+	SpanID            HexID       `json:"spanId"`
+	TraceState        string      `json:"traceState"`
+	ParentSpanID      HexID       `json:"parentSpanId"`
+	Name              string      `json:"name"`
+	Kind              SpanKind    `json:"kind"`
+	StartTimeUnixNano Uint64      `json:"startTimeUnixNano"`
+	EndTimeUnixNano   Uint64      `json:"endTimeUnixNano"`
+	Attributes        []*KeyValue `json:"attributes"`
+	Events            []*Event    `json:"events"`
+	Links             []*Link     `json:"links"`
+	Status            *Status     `json:"status"`
+}
+
+// Event is a timestamped annotation of a span
+type Event struct {
+	TimeUnixNano Uint64      `json:"timeUnixNano"`
+	Name         string      `json:"name"`
+	Attributes   []*KeyValue `json:"attributes"`
+}
+
+// Link is a reference from a span to another span
+type Link struct {
+	TraceID    HexID       `json:"traceId"`
+	SpanID     HexID       `json:"spanId"`
+	Attributes []*KeyValue `json:"attributes"`
+}
+
+// Status is the outcome of the operation of a span
+type Status struct {
+	Message string     `json:"message"`
+	Code    StatusCode `json:"code"`
+}
+
+// KeyValue is an attribute of a resource, span or event
+type KeyValue struct {
+	Key   string    `json:"key"`
+	Value *AnyValue `json:"value"`
+}
+
+// AnyValue is the value of an attribute, only one of its fields is set
+type AnyValue struct {
+	StringValue *string       `json:"stringValue"`
+	BoolValue   *bool         `json:"boolValue"`
+	IntValue    *Int64        `json:"intValue"`
+	DoubleValue *float64      `json:"doubleValue"`
+	ArrayValue  *ArrayValue   `json:"arrayValue"`
+	KvlistValue *KeyValueList `json:"kvlistValue"`
+	BytesValue  []byte        `json:"bytesValue"`
+}
+
+// ArrayValue is a list of attribute values
+type ArrayValue struct {
+	Values []*AnyValue `json:"values"`
+}
+
+// KeyValueList is a nested list of attributes
+type KeyValueList struct {
+	Values []*KeyValue `json:"values"`
+}
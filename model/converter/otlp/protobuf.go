@@ -0,0 +1,358 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package otlp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// The wire types of the protobuf encoding
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncated = errors.New("Truncated protobuf message")
+
+// DecodeProtobuf decodes a request encoded in the binary protobuf format of OTLP. The fields
+// that are not converted to the domain model are skipped.
+func DecodeProtobuf(data []byte) (*ExportTraceServiceRequest, error) {
+	request := &ExportTraceServiceRequest{}
+	err := decodeMessage(data, func(field int, r *wireReader) error {
+		if field != 1 {
+			return r.skip()
+		}
+		resourceSpans := &ResourceSpans{}
+		request.ResourceSpans = append(request.ResourceSpans, resourceSpans)
+		return r.message(resourceSpans.decode)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func (rs *ResourceSpans) decode(field int, r *wireReader) error {
+	switch field {
+	case 1:
+		rs.Resource = &Resource{}
+		return r.message(rs.Resource.decode)
+	case 2, 1000:
+		scopeSpans := &ScopeSpans{}
+		rs.ScopeSpans = append(rs.ScopeSpans, scopeSpans)
+		return r.message(scopeSpans.decode)
+	}
+	return r.skip()
+}
+
+func (res *Resource) decode(field int, r *wireReader) error {
+	if field == 1 {
+		return r.keyValue(&res.Attributes)
+	}
+	return r.skip()
+}
+
+func (ss *ScopeSpans) decode(field int, r *wireReader) error {
+	switch field {
+	case 1:
+		ss.Scope = &InstrumentationScope{}
+		return r.message(ss.Scope.decode)
+	case 2:
+		span := &Span{}
+		ss.Spans = append(ss.Spans, span)
+		return r.message(span.decode)
+	}
+	return r.skip()
+}
+
+func (scope *InstrumentationScope) decode(field int, r *wireReader) error {
+	switch field {
+	case 1:
+		return r.string(&scope.Name)
+	case 2:
+		return r.string(&scope.Version)
+	}
+	return r.skip()
+}
+
+func (s *Span) decode(field int, r *wireReader) error {
+	switch field {
+	case 1:
+		return r.id(&s.TraceID)
+	case 2:
+		return r.id(&s.SpanID)
+	case 3:
+		return r.string(&s.TraceState)
+	case 4:
+		return r.id(&s.ParentSpanID)
+	case 5:
+		return r.string(&s.Name)
+	case 6:
+		v, err := r.varint()
+		s.Kind = SpanKind(v)
+		return err
+	case 7:
+		v, err := r.fixed64()
+		s.StartTimeUnixNano = Uint64(v)
+		return err
+	case 8:
+		v, err := r.fixed64()
+		s.EndTimeUnixNano = Uint64(v)
+		return err
+	case 9:
+		return r.keyValue(&s.Attributes)
+	case 11:
+		event := &Event{}
+		s.Events = append(s.Events, event)
+		return r.message(event.decode)
+	case 13:
+		link := &Link{}
+		s.Links = append(s.Links, link)
+		return r.message(link.decode)
+	case 15:
+		s.Status = &Status{}
+		return r.message(s.Status.decode)
+	}
+	return r.skip()
+}
+
+func (e *Event) decode(field int, r *wireReader) error {
+	switch field {
+	case 1:
+		v, err := r.fixed64()
+		e.TimeUnixNano = Uint64(v)
+		return err
+	case 2:
+		return r.string(&e.Name)
+	case 3:
+		return r.keyValue(&e.Attributes)
+	}
+	return r.skip()
+}
+
+func (l *Link) decode(field int, r *wireReader) error {
+	switch field {
+	case 1:
+		return r.id(&l.TraceID)
+	case 2:
+		return r.id(&l.SpanID)
+	case 4:
+		return r.keyValue(&l.Attributes)
+	}
+	return r.skip()
+}
+
+func (s *Status) decode(field int, r *wireReader) error {
+	switch field {
+	case 2:
+		return r.string(&s.Message)
+	case 3:
+		v, err := r.varint()
+		s.Code = StatusCode(v)
+		return err
+	}
+	return r.skip()
+}
+
+func (kv *KeyValue) decode(field int, r *wireReader) error {
+	switch field {
+	case 1:
+		return r.string(&kv.Key)
+	case 2:
+		kv.Value = &AnyValue{}
+		return r.message(kv.Value.decode)
+	}
+	return r.skip()
+}
+
+func (v *AnyValue) decode(field int, r *wireReader) error {
+	switch field {
+	case 1:
+		var s string
+		v.StringValue = &s
+		return r.string(v.StringValue)
+	case 2:
+		b, err := r.varint()
+		boolValue := b != 0
+		v.BoolValue = &boolValue
+		return err
+	case 3:
+		i, err := r.varint()
+		intValue := Int64(i)
+		v.IntValue = &intValue
+		return err
+	case 4:
+		bits, err := r.fixed64()
+		doubleValue := math.Float64frombits(bits)
+		v.DoubleValue = &doubleValue
+		return err
+	case 5:
+		v.ArrayValue = &ArrayValue{}
+		return r.message(func(field int, r *wireReader) error {
+			if field != 1 {
+				return r.skip()
+			}
+			value := &AnyValue{}
+			v.ArrayValue.Values = append(v.ArrayValue.Values, value)
+			return r.message(value.decode)
+		})
+	case 6:
+		v.KvlistValue = &KeyValueList{}
+		return r.message(func(field int, r *wireReader) error {
+			if field != 1 {
+				return r.skip()
+			}
+			return r.keyValue(&v.KvlistValue.Values)
+		})
+	case 7:
+		b, err := r.bytes()
+		v.BytesValue = append([]byte{}, b...)
+		return err
+	}
+	return r.skip()
+}
+
+// wireReader reads the fields of a protobuf message, the wire type of the current field
+// telling how to read or skip its value
+type wireReader struct {
+	data     []byte
+	wireType int
+}
+
+// decodeMessage calls decodeField with each field of the message, which must read or skip its value
+func decodeMessage(data []byte, decodeField func(field int, r *wireReader) error) error {
+	r := &wireReader{data: data}
+	for len(r.data) > 0 {
+		key, err := r.rawVarint()
+		if err != nil {
+			return err
+		}
+		r.wireType = int(key & 7)
+		if err := decodeField(int(key>>3), r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *wireReader) expect(wireType int) error {
+	if r.wireType != wireType {
+		return fmt.Errorf("Unexpected protobuf wire type %d, expected %d", r.wireType, wireType)
+	}
+	return nil
+}
+
+func (r *wireReader) rawVarint() (uint64, error) {
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		return 0, errTruncated
+	}
+	r.data = r.data[n:]
+	return v, nil
+}
+
+func (r *wireReader) varint() (uint64, error) {
+	if err := r.expect(wireVarint); err != nil {
+		return 0, err
+	}
+	return r.rawVarint()
+}
+
+func (r *wireReader) fixed64() (uint64, error) {
+	if err := r.expect(wireFixed64); err != nil {
+		return 0, err
+	}
+	if len(r.data) < 8 {
+		return 0, errTruncated
+	}
+	v := binary.LittleEndian.Uint64(r.data)
+	r.data = r.data[8:]
+	return v, nil
+}
+
+func (r *wireReader) bytes() ([]byte, error) {
+	if err := r.expect(wireBytes); err != nil {
+		return nil, err
+	}
+	length, err := r.rawVarint()
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(r.data)) < length {
+		return nil, errTruncated
+	}
+	b := r.data[:length]
+	r.data = r.data[length:]
+	return b, nil
+}
+
+func (r *wireReader) string(s *string) error {
+	b, err := r.bytes()
+	*s = string(b)
+	return err
+}
+
+func (r *wireReader) id(id *HexID) error {
+	b, err := r.bytes()
+	*id = append(HexID{}, b...)
+	return err
+}
+
+func (r *wireReader) message(decodeField func(field int, r *wireReader) error) error {
+	b, err := r.bytes()
+	if err != nil {
+		return err
+	}
+	return decodeMessage(b, decodeField)
+}
+
+func (r *wireReader) keyValue(attributes *[]*KeyValue) error {
+	kv := &KeyValue{}
+	*attributes = append(*attributes, kv)
+	return r.message(kv.decode)
+}
+
+// skip skips the value of a field that is not converted
+func (r *wireReader) skip() error {
+	switch r.wireType {
+	case wireVarint:
+		_, err := r.rawVarint()
+		return err
+	case wireFixed64:
+		_, err := r.fixed64()
+		return err
+	case wireBytes:
+		_, err := r.bytes()
+		return err
+	case wireFixed32:
+		if len(r.data) < 4 {
+			return errTruncated
+		}
+		r.data = r.data[4:]
+		return nil
+	}
+	return fmt.Errorf("Unsupported protobuf wire type %d", r.wireType)
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package otlp
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// the helpers below encode the fields of protobuf messages, as the OTLP exporters do
+
+func appendVarint(b []byte, v uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return append(b, buf[:binary.PutUvarint(buf, v)]...)
+}
+
+func varintField(field int, v uint64) []byte {
+	return appendVarint(appendVarint(nil, uint64(field<<3|wireVarint)), v)
+}
+
+func fixed64Field(field int, v uint64) []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, v)
+	return append(appendVarint(nil, uint64(field<<3|wireFixed64)), buf...)
+}
+
+func bytesField(field int, parts ...[]byte) []byte {
+	var payload []byte
+	for _, part := range parts {
+		payload = append(payload, part...)
+	}
+	b := appendVarint(nil, uint64(field<<3|wireBytes))
+	b = appendVarint(b, uint64(len(payload)))
+	return append(b, payload...)
+}
+
+func stringField(field int, s string) []byte {
+	return bytesField(field, []byte(s))
+}
+
+func attributeField(field int, key string, value []byte) []byte {
+	return bytesField(field, stringField(1, key), bytesField(2, value))
+}
+
+func TestDecodeProtobuf(t *testing.T) {
+	start := time.Date(2017, 11, 1, 10, 0, 0, 0, time.UTC)
+	span := bytesField(2,
+		bytesField(1, testTraceID),
+		bytesField(2, testSpanID),
+		bytesField(4, testParent),
+		stringField(5, "GET /"),
+		varintField(6, uint64(SpanKindServer)),
+		fixed64Field(7, uint64(start.UnixNano())),
+		fixed64Field(8, uint64(start.Add(time.Millisecond).UnixNano())),
+		attributeField(9, "http.url", stringField(1, "/")),
+		attributeField(9, "http.status_code", varintField(3, 500)),
+		attributeField(9, "retry", varintField(2, 1)),
+		attributeField(9, "http.methods", bytesField(5,
+			bytesField(1, stringField(1, "GET")),
+			bytesField(1, stringField(1, "HEAD")),
+		)),
+		varintField(10, 3), // dropped_attributes_count is skipped
+		bytesField(11,
+			fixed64Field(1, uint64(start.UnixNano())),
+			stringField(2, "cache miss"),
+			attributeField(3, "key", stringField(1, "user:1")),
+		),
+		bytesField(13, bytesField(1, testTraceID), bytesField(2, testParent)),
+		bytesField(15, stringField(2, "internal"), varintField(3, uint64(StatusCodeError))),
+	)
+	data := bytesField(1,
+		bytesField(1,
+			attributeField(1, "service.name", stringField(1, "svc")),
+			attributeField(1, "host.name", stringField(1, "host")),
+			attributeField(1, "process.pid", varintField(3, 42)),
+		),
+		bytesField(2,
+			bytesField(1, stringField(1, "net/http"), stringField(2, "1.0")),
+			span,
+		),
+		stringField(3, "https://opentelemetry.io/schemas/1.4.0"),
+	)
+
+	request, err := DecodeProtobuf(data)
+	require.NoError(t, err)
+	assert.Equal(t, testRequest(start), request)
+}
+
+func TestDecodeProtobufAttributeValues(t *testing.T) {
+	data := bytesField(1, bytesField(1,
+		attributeField(1, "ratio", fixed64Field(4, math.Float64bits(0.5))),
+		attributeField(1, "payload", bytesField(7, []byte{1, 2})),
+		attributeField(1, "negative", varintField(3, math.MaxUint64)),
+		attributeField(1, "labels", bytesField(6, attributeField(1, "zone", stringField(1, "dca1")))),
+	))
+	request, err := DecodeProtobuf(data)
+	require.NoError(t, err)
+	attributes := request.ResourceSpans[0].Resource.Attributes
+	require.Len(t, attributes, 4)
+	assert.Equal(t, 0.5, *attributes[0].Value.DoubleValue)
+	assert.Equal(t, []byte{1, 2}, attributes[1].Value.BytesValue)
+	assert.Equal(t, Int64(-1), *attributes[2].Value.IntValue)
+	assert.Equal(t, "zone", attributes[3].Value.KvlistValue.Values[0].Key)
+	assert.Equal(t, "dca1", *attributes[3].Value.KvlistValue.Values[0].Value.StringValue)
+}
+
+func TestDecodeProtobufErrors(t *testing.T) {
+	testCases := []struct {
+		caption  string
+		data     []byte
+		expected string
+	}{
+		{caption: "truncated key", data: []byte{0x80}, expected: "Truncated protobuf message"},
+		{caption: "truncated bytes", data: []byte{0x0a, 0x05, 0x01}, expected: "Truncated protobuf message"},
+		{caption: "wrong wire type", data: bytesField(1, bytesField(2, varintField(2, 1))), expected: "Unexpected protobuf wire type 0, expected 2"},
+		{caption: "unsupported wire type", data: []byte{0x13}, expected: "Unsupported protobuf wire type 3"},
+		{caption: "truncated fixed64", data: bytesField(1, bytesField(2, bytesField(2, []byte{0x39, 0x01}))), expected: "Truncated protobuf message"},
+	}
+	for _, testCase := range testCases {
+		_, err := DecodeProtobuf(testCase.data)
+		assert.EqualError(t, err, testCase.expected, testCase.caption)
+	}
+}
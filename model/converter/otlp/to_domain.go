@@ -0,0 +1,310 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package otlp
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/opentracing/opentracing-go/ext"
+
+	"github.com/uber/jaeger/model"
+)
+
+const (
+	serviceNameAttribute = "service.name"
+	// defaultServiceName is the service name of the resources without one, as in the OpenTelemetry SDKs
+	defaultServiceName = "unknown_service"
+
+	scopeNameTag         = "otel.scope.name"
+	scopeVersionTag      = "otel.scope.version"
+	statusCodeTag        = "otel.status_code"
+	statusDescriptionTag = "otel.status_description"
+	traceStateTag        = "w3c.tracestate"
+	eventTag             = "event"
+)
+
+var spanKinds = map[SpanKind]string{
+	SpanKindInternal: "internal",
+	SpanKindServer:   string(ext.SpanKindRPCServerEnum),
+	SpanKindClient:   string(ext.SpanKindRPCClientEnum),
+	SpanKindProducer: string(ext.SpanKindProducerEnum),
+	SpanKindConsumer: string(ext.SpanKindConsumerEnum),
+}
+
+// ToDomain transforms the spans of an OTLP export request into a slice of model.Span. The attributes
+// of the resources become the process tags, and their service.name attribute the service name.
+// An error is returned if any of the spans has an invalid trace or span ID.
+func ToDomain(request *ExportTraceServiceRequest) ([]*model.Span, error) {
+	return toDomain{}.ToDomain(request)
+}
+
+// toDomain is a private struct that namespaces some conversion functions. It has access to its own private utility functions
+type toDomain struct{}
+
+func (td toDomain) ToDomain(request *ExportTraceServiceRequest) ([]*model.Span, error) {
+	var spans []*model.Span
+	for _, resourceSpans := range request.ResourceSpans {
+		mProcess := td.getProcess(resourceSpans.Resource)
+		scopeSpans := append(resourceSpans.ScopeSpans, resourceSpans.InstrumentationLibrarySpans...)
+		for _, scopeSpan := range scopeSpans {
+			scopeTags := td.getScopeTags(scopeSpan)
+			for _, otlpSpan := range scopeSpan.Spans {
+				span, err := td.transformSpan(otlpSpan, mProcess, scopeTags)
+				if err != nil {
+					return nil, err
+				}
+				spans = append(spans, span)
+			}
+		}
+	}
+	return spans, nil
+}
+
+func (td toDomain) transformSpan(otlpSpan *Span, mProcess *model.Process, scopeTags model.KeyValues) (*model.Span, error) {
+	traceID, err := td.getTraceID(otlpSpan.TraceID)
+	if err != nil {
+		return nil, err
+	}
+	spanID, err := td.getSpanID(otlpSpan.SpanID)
+	if err != nil {
+		return nil, err
+	}
+	var parentSpanID model.SpanID
+	if len(otlpSpan.ParentSpanID) > 0 {
+		if parentSpanID, err = td.getSpanID(otlpSpan.ParentSpanID); err != nil {
+			return nil, err
+		}
+	}
+	refs, err := td.getReferences(otlpSpan.Links)
+	if err != nil {
+		return nil, err
+	}
+	startTime := td.getTime(otlpSpan.StartTimeUnixNano)
+	span := &model.Span{
+		TraceID:       traceID,
+		SpanID:        spanID,
+		ParentSpanID:  parentSpanID,
+		OperationName: otlpSpan.Name,
+		References:    refs,
+		StartTime:     startTime,
+		Duration:      td.getTime(otlpSpan.EndTimeUnixNano).Sub(startTime),
+		Tags:          td.getTags(otlpSpan, scopeTags),
+		Logs:          td.getLogs(otlpSpan.Events),
+		Process:       mProcess,
+	}
+	// OTLP exporters only export sampled spans
+	span.Flags.SetSampled()
+	return span, nil
+}
+
+func (td toDomain) getTraceID(id []byte) (model.TraceID, error) {
+	if len(id) != 16 {
+		return model.TraceID{}, fmt.Errorf("Invalid trace ID length %d, expected 16 bytes", len(id))
+	}
+	return model.TraceID{
+		High: binary.BigEndian.Uint64(id[:8]),
+		Low:  binary.BigEndian.Uint64(id[8:]),
+	}, nil
+}
+
+func (td toDomain) getSpanID(id []byte) (model.SpanID, error) {
+	if len(id) != 8 {
+		return 0, fmt.Errorf("Invalid span ID length %d, expected 8 bytes", len(id))
+	}
+	return model.SpanID(binary.BigEndian.Uint64(id)), nil
+}
+
+func (td toDomain) getTime(unixNano Uint64) time.Time {
+	if unixNano == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(unixNano)).UTC()
+}
+
+// getReferences maps the links to FollowsFrom references, the parent span being a field of the span
+func (td toDomain) getReferences(links []*Link) ([]model.SpanRef, error) {
+	if len(links) == 0 {
+		return nil, nil
+	}
+	refs := make([]model.SpanRef, len(links))
+	for i, link := range links {
+		traceID, err := td.getTraceID(link.TraceID)
+		if err != nil {
+			return nil, err
+		}
+		spanID, err := td.getSpanID(link.SpanID)
+		if err != nil {
+			return nil, err
+		}
+		refs[i] = model.SpanRef{RefType: model.FollowsFrom, TraceID: traceID, SpanID: spanID}
+	}
+	return refs, nil
+}
+
+func (td toDomain) getScopeTags(scopeSpans *ScopeSpans) model.KeyValues {
+	scope := scopeSpans.Scope
+	if scope == nil {
+		scope = scopeSpans.InstrumentationLibrary
+	}
+	if scope == nil {
+		return nil
+	}
+	var tags model.KeyValues
+	if scope.Name != "" {
+		tags = append(tags, model.String(scopeNameTag, scope.Name))
+	}
+	if scope.Version != "" {
+		tags = append(tags, model.String(scopeVersionTag, scope.Version))
+	}
+	return tags
+}
+
+func (td toDomain) getTags(otlpSpan *Span, scopeTags model.KeyValues) model.KeyValues {
+	tags := td.getAttributes(otlpSpan.Attributes)
+	if kind, ok := spanKinds[otlpSpan.Kind]; ok {
+		tags = append(tags, model.String(string(ext.SpanKind), kind))
+	}
+	if status := otlpSpan.Status; status != nil {
+		switch status.Code {
+		case StatusCodeOK:
+			tags = append(tags, model.String(statusCodeTag, "OK"))
+		case StatusCodeError:
+			tags = append(tags, model.String(statusCodeTag, "ERROR"), model.Bool(string(ext.Error), true))
+		}
+		if status.Message != "" {
+			tags = append(tags, model.String(statusDescriptionTag, status.Message))
+		}
+	}
+	if otlpSpan.TraceState != "" {
+		tags = append(tags, model.String(traceStateTag, otlpSpan.TraceState))
+	}
+	tags = append(tags, scopeTags...)
+	if len(tags) == 0 {
+		return nil
+	}
+	return tags
+}
+
+func (td toDomain) getAttributes(attributes []*KeyValue) model.KeyValues {
+	if len(attributes) == 0 {
+		return nil
+	}
+	tags := make(model.KeyValues, 0, len(attributes))
+	for _, attribute := range attributes {
+		tags = append(tags, td.getTag(attribute.Key, attribute.Value))
+	}
+	tags.Sort()
+	return tags
+}
+
+// getTag converts the attribute to a tag of the same type, arrays and nested attributes being encoded in JSON
+func (td toDomain) getTag(key string, value *AnyValue) model.KeyValue {
+	switch {
+	case value == nil:
+		return model.String(key, "")
+	case value.StringValue != nil:
+		return model.String(key, *value.StringValue)
+	case value.BoolValue != nil:
+		return model.Bool(key, *value.BoolValue)
+	case value.IntValue != nil:
+		return model.Int64(key, int64(*value.IntValue))
+	case value.DoubleValue != nil:
+		return model.Float64(key, *value.DoubleValue)
+	case value.BytesValue != nil:
+		return model.Binary(key, value.BytesValue)
+	case value.ArrayValue != nil, value.KvlistValue != nil:
+		data, err := json.Marshal(td.getJSONValue(value))
+		if err != nil {
+			return model.String(key, fmt.Sprintf("Unknown attribute value: %v", err))
+		}
+		return model.String(key, string(data))
+	default:
+		return model.String(key, "")
+	}
+}
+
+// getJSONValue returns the value of the attribute as it is encoded in JSON
+func (td toDomain) getJSONValue(value *AnyValue) interface{} {
+	switch {
+	case value == nil:
+		return nil
+	case value.StringValue != nil:
+		return *value.StringValue
+	case value.BoolValue != nil:
+		return *value.BoolValue
+	case value.IntValue != nil:
+		return int64(*value.IntValue)
+	case value.DoubleValue != nil:
+		return *value.DoubleValue
+	case value.BytesValue != nil:
+		return value.BytesValue
+	case value.ArrayValue != nil:
+		values := make([]interface{}, len(value.ArrayValue.Values))
+		for i, v := range value.ArrayValue.Values {
+			values[i] = td.getJSONValue(v)
+		}
+		return values
+	case value.KvlistValue != nil:
+		values := make(map[string]interface{}, len(value.KvlistValue.Values))
+		for _, kv := range value.KvlistValue.Values {
+			values[kv.Key] = td.getJSONValue(kv.Value)
+		}
+		return values
+	}
+	return nil
+}
+
+// getLogs converts the events of the span to logs, the name of the event being their event field
+func (td toDomain) getLogs(events []*Event) []model.Log {
+	if len(events) == 0 {
+		return nil
+	}
+	logs := make([]model.Log, len(events))
+	for i, event := range events {
+		fields := model.KeyValues{model.String(eventTag, event.Name)}
+		fields = append(fields, td.getAttributes(event.Attributes)...)
+		logs[i] = model.Log{
+			Timestamp: td.getTime(event.TimeUnixNano),
+			Fields:    fields,
+		}
+	}
+	return logs
+}
+
+// getProcess takes the resource that produced the spans and produces a model.Process
+func (td toDomain) getProcess(resource *Resource) *model.Process {
+	process := &model.Process{ServiceName: defaultServiceName}
+	if resource == nil {
+		return process
+	}
+	for _, attribute := range resource.Attributes {
+		if attribute.Key == serviceNameAttribute && attribute.Value != nil && attribute.Value.StringValue != nil {
+			process.ServiceName = *attribute.Value.StringValue
+			continue
+		}
+		process.Tags = append(process.Tags, td.getTag(attribute.Key, attribute.Value))
+	}
+	process.Tags.Sort()
+	return process
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package otlp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/jaeger/model"
+)
+
+var (
+	testTraceID = HexID{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 2}
+	testSpanID  = HexID{0, 0, 0, 0, 0, 0, 0, 3}
+	testParent  = HexID{0, 0, 0, 0, 0, 0, 0, 4}
+)
+
+func stringValue(s string) *AnyValue {
+	return &AnyValue{StringValue: &s}
+}
+
+func intValue(i int64) *AnyValue {
+	value := Int64(i)
+	return &AnyValue{IntValue: &value}
+}
+
+func testRequest(start time.Time) *ExportTraceServiceRequest {
+	retry := true
+	return &ExportTraceServiceRequest{
+		ResourceSpans: []*ResourceSpans{
+			{
+				Resource: &Resource{
+					Attributes: []*KeyValue{
+						{Key: "service.name", Value: stringValue("svc")},
+						{Key: "host.name", Value: stringValue("host")},
+						{Key: "process.pid", Value: intValue(42)},
+					},
+				},
+				ScopeSpans: []*ScopeSpans{
+					{
+						Scope: &InstrumentationScope{Name: "net/http", Version: "1.0"},
+						Spans: []*Span{
+							{
+								TraceID:           testTraceID,
+								SpanID:            testSpanID,
+								ParentSpanID:      testParent,
+								Name:              "GET /",
+								Kind:              SpanKindServer,
+								StartTimeUnixNano: Uint64(start.UnixNano()),
+								EndTimeUnixNano:   Uint64(start.Add(time.Millisecond).UnixNano()),
+								Attributes: []*KeyValue{
+									{Key: "http.url", Value: stringValue("/")},
+									{Key: "http.status_code", Value: intValue(500)},
+									{Key: "retry", Value: &AnyValue{BoolValue: &retry}},
+									{Key: "http.methods", Value: &AnyValue{ArrayValue: &ArrayValue{
+										Values: []*AnyValue{stringValue("GET"), stringValue("HEAD")},
+									}}},
+								},
+								Events: []*Event{
+									{
+										TimeUnixNano: Uint64(start.UnixNano()),
+										Name:         "cache miss",
+										Attributes:   []*KeyValue{{Key: "key", Value: stringValue("user:1")}},
+									},
+								},
+								Links:  []*Link{{TraceID: testTraceID, SpanID: testParent}},
+								Status: &Status{Code: StatusCodeError, Message: "internal"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestToDomain(t *testing.T) {
+	start := time.Date(2017, 11, 1, 10, 0, 0, 0, time.UTC)
+	spans, err := ToDomain(testRequest(start))
+	require.NoError(t, err)
+	require.Len(t, spans, 1)
+	span := spans[0]
+
+	assert.Equal(t, model.TraceID{High: 1, Low: 2}, span.TraceID)
+	assert.Equal(t, model.SpanID(3), span.SpanID)
+	assert.Equal(t, model.SpanID(4), span.ParentSpanID)
+	assert.Equal(t, "GET /", span.OperationName)
+	assert.Equal(t, start, span.StartTime)
+	assert.Equal(t, time.Millisecond, span.Duration)
+	assert.True(t, span.Flags.IsSampled())
+	assert.Equal(t, []model.SpanRef{
+		{RefType: model.FollowsFrom, TraceID: model.TraceID{High: 1, Low: 2}, SpanID: 4},
+	}, span.References)
+	assert.Equal(t, model.KeyValues{
+		model.String("http.methods", `["GET","HEAD"]`),
+		model.Int64("http.status_code", 500),
+		model.String("http.url", "/"),
+		model.Bool("retry", true),
+		model.String("span.kind", "server"),
+		model.String("otel.status_code", "ERROR"),
+		model.Bool("error", true),
+		model.String("otel.status_description", "internal"),
+		model.String("otel.scope.name", "net/http"),
+		model.String("otel.scope.version", "1.0"),
+	}, span.Tags)
+	require.Len(t, span.Logs, 1)
+	assert.Equal(t, start, span.Logs[0].Timestamp)
+	assert.Equal(t, []model.KeyValue{
+		model.String("event", "cache miss"),
+		model.String("key", "user:1"),
+	}, span.Logs[0].Fields)
+	assert.Equal(t, &model.Process{
+		ServiceName: "svc",
+		Tags: model.KeyValues{
+			model.String("host.name", "host"),
+			model.Int64("process.pid", 42),
+		},
+	}, span.Process)
+}
+
+func TestToDomainMinimalSpan(t *testing.T) {
+	spans, err := ToDomain(&ExportTraceServiceRequest{
+		ResourceSpans: []*ResourceSpans{
+			{
+				InstrumentationLibrarySpans: []*ScopeSpans{
+					{Spans: []*Span{{TraceID: testTraceID, SpanID: testSpanID, Kind: SpanKindUnspecified}}},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, spans, 1)
+	assert.Equal(t, "unknown_service", spans[0].Process.ServiceName)
+	assert.Nil(t, spans[0].Tags)
+	assert.Nil(t, spans[0].Logs)
+	assert.Nil(t, spans[0].References)
+	assert.Equal(t, model.SpanID(0), spans[0].ParentSpanID)
+}
+
+func TestToDomainInvalidIDs(t *testing.T) {
+	testCases := []struct {
+		span     *Span
+		expected string
+	}{
+		{span: &Span{TraceID: testSpanID, SpanID: testSpanID}, expected: "Invalid trace ID length 8, expected 16 bytes"},
+		{span: &Span{TraceID: testTraceID, SpanID: testTraceID}, expected: "Invalid span ID length 16, expected 8 bytes"},
+		{span: &Span{TraceID: testTraceID, SpanID: testSpanID, ParentSpanID: HexID{1}}, expected: "Invalid span ID length 1, expected 8 bytes"},
+		{
+			span:     &Span{TraceID: testTraceID, SpanID: testSpanID, Links: []*Link{{TraceID: testTraceID}}},
+			expected: "Invalid span ID length 0, expected 8 bytes",
+		},
+	}
+	for _, testCase := range testCases {
+		_, err := ToDomain(&ExportTraceServiceRequest{
+			ResourceSpans: []*ResourceSpans{{ScopeSpans: []*ScopeSpans{{Spans: []*Span{testCase.span}}}}},
+		})
+		assert.EqualError(t, err, testCase.expected)
+	}
+}
@@ -80,6 +80,15 @@ func TestFromDomain(t *testing.T) {
 	assert.Equal(t, modelSpans, newModelSpans)
 }
 
+func TestFromDomainProcess(t *testing.T) {
+	modelSpans := loadSpans(t, "fixtures/model_01.json")
+	jaegerBatch := loadBatch(t, "fixtures/thrift_batch_01.json")
+
+	process := FromDomainProcess(modelSpans[0].Process)
+	assert.Equal(t, modelSpans[0].Process, ToDomainSpan(&j.Span{}, process).Process)
+	assert.Equal(t, jaegerBatch.Process.ServiceName, process.ServiceName)
+}
+
 func TestKeyValueToTag(t *testing.T) {
 	dToJ := domainToJaegerTransformer{}
 	jaegerTag := dToJ.keyValueToTag(&model.KeyValue{
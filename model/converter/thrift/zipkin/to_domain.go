@@ -26,6 +26,7 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/opentracing/opentracing-go/ext"
 
@@ -47,6 +48,12 @@ var (
 		zipkincore.CLIENT_SEND: string(ext.SpanKindRPCClientEnum),
 	}
 
+	// The messaging annotations also give the kind of the span, but remain logs since they are not core annotations
+	messagingAnnotations = map[string]string{
+		"ms": string(ext.SpanKindProducerEnum),
+		"mr": string(ext.SpanKindConsumerEnum),
+	}
+
 	// Some tags on Zipkin spans really describe the process emitting them rather than an individual span.
 	// Once all clients are upgraded to use native Jaeger model, this won't be happenning, but for now
 	// we remove these tags from the span and store them in the Process.
@@ -69,6 +76,30 @@ var (
 	IPTagName = "ip"
 )
 
+// ReferenceRules select the Zipkin spans that follow from their parent span rather than being its children,
+// e.g. the consumers of asynchronous messages. Zipkin spans only have a parent ID, which becomes a
+// FOLLOWS_FROM reference for the matching spans and the parent span ID of the others.
+type ReferenceRules struct {
+	// SpanKinds are the values of the span.kind tag of the spans following from their parent, e.g. consumer
+	SpanKinds []string
+	// Annotations are the annotation values and binary annotation keys of the spans following from their parent
+	Annotations []string
+}
+
+// Converter transforms spans in zipkin.thrift format into the domain model
+type Converter interface {
+	// ToDomain transforms a trace in zipkin.thrift format into model.Trace, like the ToDomain function
+	ToDomain(zSpans []*zipkincore.Span) (*model.Trace, error)
+	// ToDomainSpan transforms a span in zipkin.thrift format into model.Span, like the ToDomainSpan function
+	ToDomainSpan(zSpan *zipkincore.Span) (*model.Span, error)
+}
+
+// NewConverter returns a Converter mapping the parent ID of the spans matching the rules to a FOLLOWS_FROM
+// reference, the parent ID of the other spans being the parent span ID as with ToDomain and ToDomainSpan.
+func NewConverter(rules ReferenceRules) Converter {
+	return toDomain{rules: rules}
+}
+
 // ToDomain transforms a trace in zipkin.thrift format into model.Trace.
 // The transformation assumes that all spans have the same Trace ID.
 // A valid model.Trace is always returned, even when there are errors.
@@ -86,7 +117,9 @@ func ToDomainSpan(zSpan *zipkincore.Span) (*model.Span, error) {
 	return toDomain{}.ToDomainSpan(zSpan)
 }
 
-type toDomain struct{}
+type toDomain struct {
+	rules ReferenceRules
+}
 
 func (td toDomain) ToDomain(zSpans []*zipkincore.Span) (*model.Trace, error) {
 	var errors []error
@@ -117,14 +150,21 @@ func (td toDomain) transformSpan(zSpan *zipkincore.Span) *model.Span {
 	if spanKindTag, ok := td.getSpanKindTag(zSpan.Annotations); ok {
 		tags = append(tags, spanKindTag)
 	}
+	traceID := model.TraceID{High: uint64(zSpan.GetTraceIDHigh()), Low: uint64(zSpan.TraceID)}
 	var parentID int64
+	var refs []model.SpanRef
 	if zSpan.ParentID != nil {
 		parentID = *zSpan.ParentID
+		if parentID != 0 && td.followsFromParent(zSpan, tags) {
+			refs = []model.SpanRef{{RefType: model.FollowsFrom, TraceID: traceID, SpanID: model.SpanID(parentID)}}
+			parentID = 0
+		}
 	}
 	return &model.Span{
-		TraceID:       model.TraceID{Low: uint64(zSpan.TraceID)},
+		TraceID:       traceID,
 		SpanID:        model.SpanID(zSpan.ID),
 		OperationName: zSpan.Name,
+		References:    refs,
 		ParentSpanID:  model.SpanID(parentID),
 		Flags:         td.getFlags(zSpan),
 		StartTime:     model.EpochMicrosecondsAsTime(uint64(zSpan.GetTimestamp())),
@@ -134,6 +174,31 @@ func (td toDomain) transformSpan(zSpan *zipkincore.Span) *model.Span {
 	}
 }
 
+// followsFromParent returns whether the span kind tag, an annotation or a binary annotation of the span
+// matches the reference rules
+func (td toDomain) followsFromParent(zSpan *zipkincore.Span, tags []model.KeyValue) bool {
+	for _, kind := range td.rules.SpanKinds {
+		for _, tag := range tags {
+			if tag.Key == string(ext.SpanKind) && tag.AsString() == kind {
+				return true
+			}
+		}
+	}
+	for _, value := range td.rules.Annotations {
+		for _, a := range zSpan.Annotations {
+			if a.Value == value {
+				return true
+			}
+		}
+		for _, a := range zSpan.BinaryAnnotations {
+			if a.Key == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // getFlags takes a Zipkin Span and deduces the proper flags settings
 func (td toDomain) getFlags(zSpan *zipkincore.Span) model.Flags {
 	f := model.Flags(0)
@@ -175,9 +240,19 @@ func (td toDomain) findServiceNameAndIP(zSpan *zipkincore.Span) (string, int32,
 			return a.Host.ServiceName, a.Host.Ipv4, nil
 		}
 	}
+	// Finally use the service name from any tag, the address annotations describe the remote peer
+	for _, a := range zSpan.BinaryAnnotations {
+		if a.Key == zipkincore.SERVER_ADDR || a.Key == zipkincore.CLIENT_ADDR {
+			continue
+		}
+		if a.Host != nil && a.Host.ServiceName != "" {
+			return a.Host.ServiceName, a.Host.Ipv4, nil
+		}
+	}
+	traceID := model.TraceID{High: uint64(zSpan.GetTraceIDHigh()), Low: uint64(zSpan.TraceID)}
 	err := fmt.Errorf(
-		"Cannot find service name in Zipkin span [traceID=%x, spanID=%x]",
-		uint64(zSpan.TraceID), uint64(zSpan.ID))
+		"Cannot find service name in Zipkin span [traceID=%v, spanID=%x]",
+		traceID, uint64(zSpan.ID))
 	return UnknownServiceName, 0, err
 }
 
@@ -292,27 +367,56 @@ func (td toDomain) getLogs(annotations []*zipkincore.Annotation) []model.Log {
 }
 
 func (td toDomain) getLogFields(annotation *zipkincore.Annotation) []model.KeyValue {
-	var logFields map[string]string
+	var logFields map[string]json.RawMessage
 	// Since Zipkin format does not support kv-logging, some clients encode those Logs
 	// as annotations with JSON value. Therefore, we try JSON decoding first.
-	if err := json.Unmarshal([]byte(annotation.Value), &logFields); err == nil {
-		fields := make([]model.KeyValue, len(logFields))
-		i := 0
+	if err := json.Unmarshal([]byte(annotation.Value), &logFields); err == nil && logFields != nil {
+		fields := make([]model.KeyValue, 0, len(logFields))
 		for k, v := range logFields {
-			fields[i] = model.String(k, v)
-			i++
+			fields = append(fields, td.getLogField(k, v))
 		}
+		// sorted so that the fields of a log are the same every time it is converted
+		model.KeyValues(fields).Sort()
 		return fields
 	}
 	return []model.KeyValue{model.String(DefaultLogFieldKey, annotation.Value)}
 }
 
+// getLogField keeps the type of the JSON strings, booleans and numbers of a log encoded as JSON,
+// integers becoming int64 fields. Other values, e.g. nested objects, are kept as their JSON encoding.
+func (td toDomain) getLogField(key string, value json.RawMessage) model.KeyValue {
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err == nil {
+		switch v := v.(type) {
+		case string:
+			return model.String(key, v)
+		case bool:
+			return model.Bool(key, v)
+		case json.Number:
+			if i, err := v.Int64(); err == nil {
+				return model.Int64(key, i)
+			}
+			if f, err := v.Float64(); err == nil {
+				return model.Float64(key, f)
+			}
+		}
+	}
+	return model.String(key, strings.TrimSpace(string(value)))
+}
+
 func (td toDomain) getSpanKindTag(annotations []*zipkincore.Annotation) (model.KeyValue, bool) {
 	for _, a := range annotations {
 		if spanKind, ok := coreAnnotations[a.Value]; ok {
 			return model.String(string(ext.SpanKind), spanKind), true
 		}
 	}
+	for _, a := range annotations {
+		if spanKind, ok := messagingAnnotations[a.Value]; ok {
+			return model.String(string(ext.SpanKind), spanKind), true
+		}
+	}
 	return model.KeyValue{}, false
 }
 
@@ -80,6 +80,87 @@ func TestToDomainNoServiceNameError(t *testing.T) {
 	assert.Equal(t, "unknown-service-name", trace.Spans[0].Process.ServiceName)
 }
 
+func TestToDomainServiceNameFromTag(t *testing.T) {
+	zSpans := getZipkinSpans(t, `[{ "trace_id": 1, "id": 31, "binary_annotations": [
+		{"key": "sa", "value": "AQ==", "annotation_type": "BOOL", "host": {"service_name": "remote"}},
+		{"key": "k", "value": "dg==", "annotation_type": "STRING", "host": {"service_name": "local"}}
+	]}]`)
+	trace, err := ToDomain(zSpans)
+	require.NoError(t, err)
+	assert.Equal(t, "local", trace.Spans[0].Process.ServiceName)
+}
+
+func TestToDomainJSONLogFields(t *testing.T) {
+	zSpans := getZipkinSpans(t, `[{ "trace_id": 1, "id": 31, "annotations": [
+		{"value": "{\"event\":\"retry\",\"attempt\":2,\"backoff\":0.5,\"final\":false,\"error\":{\"code\":503}}",
+		 "timestamp": 1485467191639875, "host": {"service_name": "svc"}},
+		{"value": "[1,2]", "timestamp": 1485467191639876, "host": {"service_name": "svc"}}
+	]}]`)
+	trace, err := ToDomain(zSpans)
+	require.NoError(t, err)
+	logs := trace.Spans[0].Logs
+	require.Len(t, logs, 2)
+	assert.Equal(t, model.EpochMicrosecondsAsTime(1485467191639875), logs[0].Timestamp)
+	assert.Equal(t, []model.KeyValue{
+		model.Int64("attempt", 2),
+		model.Float64("backoff", 0.5),
+		model.String("error", `{"code":503}`),
+		model.String("event", "retry"),
+		model.Bool("final", false),
+	}, logs[0].Fields)
+	assert.Equal(t, []model.KeyValue{model.String(DefaultLogFieldKey, "[1,2]")}, logs[1].Fields)
+}
+
+func TestToDomain128BitTraceID(t *testing.T) {
+	zSpans := getZipkinSpans(t, `[{ "trace_id": 2, "trace_id_high": 1, "id": 31 }]`)
+	trace, err := ToDomain(zSpans)
+	assert.EqualError(t, err, "Cannot find service name in Zipkin span [traceID=10000000000000002, spanID=1f]")
+	require.Len(t, trace.Spans, 1)
+	assert.Equal(t, model.TraceID{High: 1, Low: 2}, trace.Spans[0].TraceID)
+}
+
+func TestToDomainReferenceRules(t *testing.T) {
+	zSpans := getZipkinSpans(t, `[
+		{ "trace_id": 1, "id": 2, "parent_id": 1, "binary_annotations": [
+			{"key": "span.kind", "value": "Y29uc3VtZXI=", "annotation_type": "STRING", "host": {"service_name": "svc"}}
+		]},
+		{ "trace_id": 1, "id": 3, "parent_id": 1, "annotations": [
+			{"value": "mr", "timestamp": 1485467191639875, "host": {"service_name": "svc"}}
+		]},
+		{ "trace_id": 1, "id": 4, "parent_id": 1, "binary_annotations": [
+			{"key": "async", "value": "AQ==", "annotation_type": "BOOL", "host": {"service_name": "svc"}}
+		]},
+		{ "trace_id": 1, "id": 5, "parent_id": 1, "annotations": [
+			{"value": "sr", "timestamp": 1485467191639875, "host": {"service_name": "svc"}}
+		]},
+		{ "trace_id": 1, "id": 6, "binary_annotations": [
+			{"key": "async", "value": "AQ==", "annotation_type": "BOOL", "host": {"service_name": "svc"}}
+		]}
+	]`)
+	converter := NewConverter(ReferenceRules{SpanKinds: []string{"consumer"}, Annotations: []string{"mr", "async"}})
+	trace, err := converter.ToDomain(zSpans)
+	require.NoError(t, err)
+	require.Len(t, trace.Spans, 5)
+	followsFrom := []model.SpanRef{{RefType: model.FollowsFrom, TraceID: model.TraceID{Low: 1}, SpanID: 1}}
+	for _, span := range trace.Spans[:3] {
+		assert.Equal(t, model.SpanID(0), span.ParentSpanID, span.SpanID.String())
+		assert.Equal(t, followsFrom, span.References, span.SpanID.String())
+	}
+	assert.Equal(t, model.SpanID(1), trace.Spans[3].ParentSpanID)
+	assert.Empty(t, trace.Spans[3].References)
+	assert.Equal(t, model.SpanID(0), trace.Spans[4].ParentSpanID, "root spans have no reference")
+	assert.Empty(t, trace.Spans[4].References)
+	// the kind of messaging spans is given by their annotation
+	assert.Equal(t, model.SpanKindConsumer, trace.Spans[1].GetSpanKind())
+	assert.Equal(t, model.SpanKindServer, trace.Spans[3].GetSpanKind())
+
+	// without rules the parent is always the parent span ID
+	span, err := ToDomainSpan(zSpans[0])
+	require.NoError(t, err)
+	assert.Equal(t, model.SpanID(1), span.ParentSpanID)
+	assert.Empty(t, span.References)
+}
+
 func TestInvalidAnnotationTypeError(t *testing.T) {
 	_, err := toDomain{}.transformBinaryAnnotation(&z.BinaryAnnotation{
 		AnnotationType: -1,
@@ -64,6 +64,27 @@ type Trace struct {
 	Spans     []Span                `json:"spans"`
 	Processes map[ProcessID]Process `json:"processes"`
 	Warnings  []string              `json:"warnings"`
+	// Completeness hints whether spans of the trace are missing, e.g. because they are still being written
+	Completeness *Completeness `json:"completeness,omitempty"`
+}
+
+// CompletenessStatus tells whether all the spans of a trace were found
+type CompletenessStatus string
+
+const (
+	// CompleteTrace means that the trace has a root span and all the spans referenced by its spans
+	CompleteTrace CompletenessStatus = "complete"
+	// IncompleteTrace means that the root span of the trace or spans referenced by its spans are missing
+	IncompleteTrace CompletenessStatus = "incomplete"
+)
+
+// Completeness is the completeness of a trace, and the reasons it is incomplete
+type Completeness struct {
+	Status CompletenessStatus `json:"status"`
+	// MissingRoot is true if none of the spans of the trace is a root span
+	MissingRoot bool `json:"missingRoot,omitempty"`
+	// MissingSpanIDs are the spans referenced by spans of the trace which are missing from the trace
+	MissingSpanIDs []SpanID `json:"missingSpanIDs,omitempty"`
 }
 
 // Span is a span denoting a piece of work in some infrastructure
@@ -34,7 +34,7 @@ func (s traceByTraceID) Less(i, j int) bool {
 	} else if len(s[j].Spans) == 0 {
 		return false
 	} else {
-		return s[i].Spans[0].TraceID.Low < s[j].Spans[0].TraceID.Low
+		return s[i].Spans[0].TraceID.Less(s[j].Spans[0].TraceID)
 	}
 }
 
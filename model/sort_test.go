@@ -117,10 +117,25 @@ func TestSortListOfTraces(t *testing.T) {
 		},
 	}
 	t4 := &Trace{}
+	t5 := &Trace{
+		Spans: []*Span{
+			{
+				TraceID: TraceID{High: 1, Low: 1},
+			},
+		},
+	}
 
-	list1 := []*Trace{t1, t4, t2, t3}
-	list2 := []*Trace{t4, t2, t1, t3}
+	list1 := []*Trace{t1, t4, t5, t2, t3}
+	list2 := []*Trace{t4, t5, t2, t1, t3}
 	SortTraces(list1)
 	SortTraces(list2)
 	assert.EqualValues(t, list1, list2)
+	assert.Equal(t, t5, list1[len(list1)-1], "traces with 128-bit IDs are ordered by their high bits first")
+}
+
+func TestTraceIDLess(t *testing.T) {
+	assert.True(t, TraceID{Low: 2}.Less(TraceID{Low: 3}))
+	assert.True(t, TraceID{Low: 3}.Less(TraceID{High: 1, Low: 2}))
+	assert.False(t, TraceID{High: 1, Low: 2}.Less(TraceID{High: 1, Low: 2}))
+	assert.False(t, TraceID{High: 2}.Less(TraceID{High: 1, Low: 5}))
 }
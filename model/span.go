@@ -23,6 +23,7 @@ package model
 import (
 	"fmt"
 	"io"
+	"math/big"
 	"strconv"
 	"time"
 
@@ -50,6 +51,38 @@ type Flags uint32
 // SpanID is a random 64bit identifier for a span
 type SpanID uint64
 
+// SpanKind is the role of a span in the interaction it takes part in, as given by its `span.kind` tag
+type SpanKind string
+
+// The span kinds, which are the values of the `span.kind` tag except for SpanKindUnspecified
+const (
+	SpanKindClient   = SpanKind(ext.SpanKindRPCClientEnum)
+	SpanKindServer   = SpanKind(ext.SpanKindRPCServerEnum)
+	SpanKindProducer = SpanKind(ext.SpanKindProducerEnum)
+	SpanKindConsumer = SpanKind(ext.SpanKindConsumerEnum)
+	SpanKindInternal = SpanKind("internal")
+	// SpanKindUnspecified is the kind of the spans without a `span.kind` tag, or with an unknown one
+	SpanKindUnspecified = SpanKind("unspecified")
+)
+
+var spanKinds = map[SpanKind]struct{}{
+	SpanKindClient:      {},
+	SpanKindServer:      {},
+	SpanKindProducer:    {},
+	SpanKindConsumer:    {},
+	SpanKindInternal:    {},
+	SpanKindUnspecified: {},
+}
+
+// SpanKindFromString returns the span kind with the given name
+func SpanKindFromString(s string) (SpanKind, error) {
+	kind := SpanKind(s)
+	if _, ok := spanKinds[kind]; !ok {
+		return "", fmt.Errorf("Unknown span kind %q", s)
+	}
+	return kind, nil
+}
+
 // Span represents a unit of work in an application, such as an RPC, a database call, etc.
 type Span struct {
 	TraceID       TraceID       `json:"traceID"`
@@ -82,6 +115,18 @@ func (s *Span) HasSpanKind(kind ext.SpanKindEnum) bool {
 	return false
 }
 
+// GetSpanKind returns the kind of the span given by its `span.kind` tag, SpanKindUnspecified
+// when the span has no such tag or it is not one of the known kinds.
+func (s *Span) GetSpanKind() SpanKind {
+	if tag, ok := s.Tags.FindByKey(string(ext.SpanKind)); ok {
+		kind := SpanKind(tag.AsString())
+		if _, ok := spanKinds[kind]; ok && kind != SpanKindUnspecified {
+			return kind
+		}
+	}
+	return SpanKindUnspecified
+}
+
 // IsRPCClient returns true if the span represents a client side of an RPC,
 // as indicated by the `span.kind` tag set to `client`.
 func (s *Span) IsRPCClient() bool {
@@ -142,6 +187,27 @@ func (t TraceID) String() string {
 	return fmt.Sprintf("%x%016x", t.High, t.Low)
 }
 
+// PaddedString returns the trace ID as 32 hex characters, zero padded as in W3C trace context
+func (t TraceID) PaddedString() string {
+	return fmt.Sprintf("%016x%016x", t.High, t.Low)
+}
+
+// DecimalString returns the 128 bits of the trace ID as a decimal number
+func (t TraceID) DecimalString() string {
+	id := new(big.Int).SetUint64(t.High)
+	id.Lsh(id, 64)
+	id.Or(id, new(big.Int).SetUint64(t.Low))
+	return id.String()
+}
+
+// Less returns true if t is ordered before other, comparing the high 64 bits first
+func (t TraceID) Less(other TraceID) bool {
+	if t.High != other.High {
+		return t.High < other.High
+	}
+	return t.Low < other.Low
+}
+
 // TraceIDFromString creates a TraceID from a hexadecimal string
 func TraceIDFromString(s string) (TraceID, error) {
 	var hi, lo uint64
@@ -164,6 +230,19 @@ func TraceIDFromString(s string) (TraceID, error) {
 	return TraceID{High: hi, Low: lo}, nil
 }
 
+// TraceIDFromDecimalString creates a TraceID from a decimal number of up to 128 bits
+func TraceIDFromDecimalString(s string) (TraceID, error) {
+	id, ok := new(big.Int).SetString(s, 10)
+	if !ok || id.Sign() < 0 {
+		return TraceID{}, fmt.Errorf("TraceID is not a decimal number: %s", s)
+	}
+	if id.BitLen() > 128 {
+		return TraceID{}, fmt.Errorf("TraceID cannot be larger than 128 bits: %s", s)
+	}
+	low := new(big.Int).And(id, new(big.Int).SetUint64(^uint64(0)))
+	return TraceID{High: new(big.Int).Rsh(id, 64).Uint64(), Low: low.Uint64()}, nil
+}
+
 // MarshalText allows TraceID to serialize itself in JSON as a string.
 func (t TraceID) MarshalText() ([]byte, error) {
 	return []byte(t.String()), nil
@@ -71,6 +71,9 @@ func TestTraceIDUnmarshalText(t *testing.T) {
 		{lo: 257, in: `{"id":"101"}`},
 		{hi: 1, lo: 1, in: `{"id":"10000000000000001"}`},
 		{hi: 257, lo: 1, in: `{"id":"1010000000000000001"}`},
+		// W3C trace-id, always 32 hex characters
+		{hi: 0x0af7651916cd43dd, lo: 0x8448eb211c80319c, in: `{"id":"0af7651916cd43dd8448eb211c80319c"}`},
+		{lo: 1, in: `{"id":"00000000000000000000000000000001"}`},
 		{err: true, in: `{"id":""}`},
 		{err: true, in: `{"id":"x"}`},
 		{err: true, in: `{"id":"x0000000000000001"}`},
@@ -91,6 +94,37 @@ func TestTraceIDUnmarshalText(t *testing.T) {
 	}
 }
 
+func TestTraceIDPaddedString(t *testing.T) {
+	assert.Equal(t, "00000000000000000000000000000001", model.TraceID{Low: 1}.PaddedString())
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c",
+		model.TraceID{High: 0x0af7651916cd43dd, Low: 0x8448eb211c80319c}.PaddedString())
+}
+
+func TestTraceIDDecimalString(t *testing.T) {
+	testCases := []struct {
+		traceID model.TraceID
+		out     string
+	}{
+		{traceID: model.TraceID{}, out: "0"},
+		{traceID: model.TraceID{Low: 255}, out: "255"},
+		{traceID: model.TraceID{High: 1, Low: 1}, out: "18446744073709551617"},
+		{traceID: model.TraceID{High: ^uint64(0), Low: ^uint64(0)}, out: "340282366920938463463374607431768211455"},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.out, testCase.traceID.DecimalString())
+		traceID, err := model.TraceIDFromDecimalString(testCase.out)
+		require.NoError(t, err)
+		assert.Equal(t, testCase.traceID, traceID)
+	}
+}
+
+func TestTraceIDFromDecimalStringErrors(t *testing.T) {
+	for _, in := range []string{"", "abc", "-1", "340282366920938463463374607431768211456"} {
+		_, err := model.TraceIDFromDecimalString(in)
+		assert.Error(t, err, in)
+	}
+}
+
 type SpanIDContainer struct {
 	SpanID model.SpanID `json:"id"`
 }
@@ -157,6 +191,34 @@ func TestIsRPCClientServer(t *testing.T) {
 	assert.False(t, span2.IsRPCServer())
 }
 
+func TestGetSpanKind(t *testing.T) {
+	testCases := []struct {
+		tags model.KeyValues
+		kind model.SpanKind
+	}{
+		{tags: nil, kind: model.SpanKindUnspecified},
+		{tags: model.KeyValues{model.String(string(ext.SpanKind), "server")}, kind: model.SpanKindServer},
+		{tags: model.KeyValues{model.String(string(ext.SpanKind), "consumer")}, kind: model.SpanKindConsumer},
+		{tags: model.KeyValues{model.String(string(ext.SpanKind), "internal")}, kind: model.SpanKindInternal},
+		{tags: model.KeyValues{model.String(string(ext.SpanKind), "unknown")}, kind: model.SpanKindUnspecified},
+	}
+	for _, testCase := range testCases {
+		span := &model.Span{Tags: testCase.tags}
+		assert.Equal(t, testCase.kind, span.GetSpanKind())
+	}
+}
+
+func TestSpanKindFromString(t *testing.T) {
+	kind, err := model.SpanKindFromString("client")
+	require.NoError(t, err)
+	assert.Equal(t, model.SpanKindClient, kind)
+	kind, err = model.SpanKindFromString("unspecified")
+	require.NoError(t, err)
+	assert.Equal(t, model.SpanKindUnspecified, kind)
+	_, err = model.SpanKindFromString("rpc")
+	assert.EqualError(t, err, `Unknown span kind "rpc"`)
+}
+
 func TestIsDebug(t *testing.T) {
 	flags := model.Flags(0)
 	flags.SetDebug()
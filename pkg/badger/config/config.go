@@ -0,0 +1,64 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/dgraph-io/badger"
+	"github.com/pkg/errors"
+)
+
+// Configuration describes the configuration properties needed to open an embedded BadgerDB
+type Configuration struct {
+	Directory          string
+	ValueLogGCInterval time.Duration // how often to garbage collect the value log, disabled if 0
+}
+
+// NewDB opens the BadgerDB stored in the configured directory, creating it if necessary
+func (c *Configuration) NewDB() (*badger.DB, error) {
+	if c.Directory == "" {
+		return nil, errors.New("No data directory specified")
+	}
+	if err := checkWritable(c.Directory); err != nil {
+		return nil, errors.Wrapf(err, "Data directory %s is not writable", c.Directory)
+	}
+	opts := badger.DefaultOptions
+	opts.Dir = c.Directory
+	opts.ValueDir = c.Directory
+	return badger.Open(opts)
+}
+
+// checkWritable makes sure that the directory exists and that we are able to create files in it,
+// so that we can fail with a clear message instead of an obscure error from the badger internals.
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, ".jaeger-write-check")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -28,6 +28,7 @@ import (
 
 	"github.com/uber/jaeger/pkg/cassandra"
 	gocqlw "github.com/uber/jaeger/pkg/cassandra/gocql"
+	"github.com/uber/jaeger/pkg/cassandra/retry"
 )
 
 // Configuration describes the configuration properties needed to connect to a Cassandra cluster
@@ -41,8 +42,87 @@ type Configuration struct {
 	ProtoVersion       int           `yaml:"proto_version"`
 	Consistency        string        `yaml:"consistency"`
 	Port               int           `yaml:"port"`
+
+	// MaxWriteAttempts is the number of attempts for a write failing with a transient error, such as a timeout
+	MaxWriteAttempts     int           `validate:"min=0" yaml:"max_write_attempts"`
+	WriteRetryBackoff    time.Duration `validate:"min=0" yaml:"write_retry_backoff"`
+	WriteRetryMaxBackoff time.Duration `validate:"min=0" yaml:"write_retry_max_backoff"`
+
+	// SpanCompression is the algorithm compressing the tags and logs of spans before they are stored,
+	// one of none, gzip or zstd. Spans are read back whatever the algorithm they were written with.
+	SpanCompression string `yaml:"span_compression"`
+
+	// ShardingScheme makes each of the Servers a separate shard when set, all spans of a trace being
+	// stored in the same shard picked by the scheme, one of modulo or rendezvous.
+	ShardingScheme string `yaml:"sharding_scheme"`
+
+	// SpanBucketThreshold is the number of spans of a trace stored in its partition of the traces table,
+	// the further spans being spread across buckets of as many spans in the trace_buckets table. The
+	// spans of a trace are never bucketed when zero.
+	SpanBucketThreshold int `validate:"min=0" yaml:"span_bucket_threshold"`
+
+	// PromotedTags are the keys of the tags indexed in the service_promoted_tag_index table rather than in tag_index,
+	// whose partitions of each service and tag value are spread over buckets so that frequent values do not make
+	// hot partitions. The query service searches both tables for them.
+	PromotedTags []string `yaml:"promoted_tags"`
+
+	// SpanTTL is the time spans are kept for when their service has no entry in ServiceSpanTTLs,
+	// the default TTL of the tables applying when zero. MaxSpanTTL caps all of them when set.
+	SpanTTL         time.Duration            `validate:"min=0" yaml:"span_ttl"`
+	ServiceSpanTTLs map[string]time.Duration `yaml:"service_span_ttls"`
+	MaxSpanTTL      time.Duration            `validate:"min=0" yaml:"max_span_ttl"`
+	// ErrorSpanTTL is the time the traces with a span tagged error=true are kept for, when longer than the
+	// TTL of their services, the written spans of each trace being rewritten with it when one of them has an
+	// error within ErrorTraceWindow, 5s when zero. Error traces are not kept longer when zero.
+	ErrorSpanTTL     time.Duration `validate:"min=0" yaml:"error_span_ttl"`
+	ErrorTraceWindow time.Duration `validate:"min=0" yaml:"error_trace_window"`
+
+	// ReadConsistency and WriteConsistency are the consistency levels of the queries reading and
+	// writing spans, ONE and Consistency respectively when empty.
+	ReadConsistency  string `yaml:"read_consistency"`
+	WriteConsistency string `yaml:"write_consistency"`
+	// LoadSheddingWriteConsistency replaces WriteConsistency for LoadSheddingPeriod after a write failed
+	// because Cassandra timed out or was unavailable, so that an overloaded cluster can recover.
+	LoadSheddingWriteConsistency string        `yaml:"load_shedding_write_consistency"`
+	LoadSheddingPeriod           time.Duration `validate:"min=0" yaml:"load_shedding_period"`
+
+	// LoadBalancingPolicy picks the hosts the queries are sent to, one of round-robin or dc-aware, round-robin
+	// when empty. The dc-aware policy prefers the hosts of LocalDC, which must be set, e.g. to keep the writes
+	// of a multi-datacenter cluster in the local datacenter with the LOCAL_ONE or LOCAL_QUORUM consistency.
+	LoadBalancingPolicy string `yaml:"load_balancing_policy"`
+	LocalDC             string `yaml:"local_dc"`
+
+	// SchemaAutoMigrate upgrades the schema of the keyspace when it is older than the one expected by the
+	// collector, which refuses to start otherwise.
+	SchemaAutoMigrate bool `yaml:"schema_auto_migrate"`
 }
 
+// ConsistencyLevels are the consistency levels of the queries, parsed from the configuration
+type ConsistencyLevels struct {
+	Read  cassandra.Consistency
+	Write cassandra.Consistency
+	// LoadSheddingWrite is only used when LoadSheddingPeriod is positive
+	LoadSheddingWrite  cassandra.Consistency
+	LoadSheddingPeriod time.Duration
+}
+
+const (
+	defaultConsistency        = cassandra.LocalOne
+	defaultReadConsistency    = cassandra.One
+	defaultLoadSheddingPeriod = time.Minute
+)
+
+const (
+	// RoundRobinPolicy spreads the queries across the hosts of all datacenters
+	RoundRobinPolicy = "round-robin"
+	// DCAwarePolicy spreads the queries across the hosts of the local datacenter, the hosts of the other
+	// datacenters being used only when none of the local ones is up
+	DCAwarePolicy = "dc-aware"
+)
+
+// maxCassandraTTL is the largest TTL accepted by Cassandra, 20 years
+const maxCassandraTTL = 20 * 365 * 24 * time.Hour
+
 // ApplyDefaults copies settings from source unless its own value is non-zero.
 func (c *Configuration) ApplyDefaults(source *Configuration) {
 	if c.ConnectionsPerHost == 0 {
@@ -66,10 +146,161 @@ func (c *Configuration) ApplyDefaults(source *Configuration) {
 	if c.SocketKeepAlive == 0 {
 		c.SocketKeepAlive = source.SocketKeepAlive
 	}
+	if c.MaxWriteAttempts == 0 {
+		c.MaxWriteAttempts = source.MaxWriteAttempts
+	}
+	if c.WriteRetryBackoff == 0 {
+		c.WriteRetryBackoff = source.WriteRetryBackoff
+	}
+	if c.WriteRetryMaxBackoff == 0 {
+		c.WriteRetryMaxBackoff = source.WriteRetryMaxBackoff
+	}
+	if c.SpanCompression == "" {
+		c.SpanCompression = source.SpanCompression
+	}
+	if c.ShardingScheme == "" {
+		c.ShardingScheme = source.ShardingScheme
+	}
+	if c.SpanBucketThreshold == 0 {
+		c.SpanBucketThreshold = source.SpanBucketThreshold
+	}
+	if c.PromotedTags == nil {
+		c.PromotedTags = source.PromotedTags
+	}
+	if c.SpanTTL == 0 {
+		c.SpanTTL = source.SpanTTL
+	}
+	if c.ServiceSpanTTLs == nil {
+		c.ServiceSpanTTLs = source.ServiceSpanTTLs
+	}
+	if c.MaxSpanTTL == 0 {
+		c.MaxSpanTTL = source.MaxSpanTTL
+	}
+	if c.ErrorSpanTTL == 0 {
+		c.ErrorSpanTTL = source.ErrorSpanTTL
+	}
+	if c.ErrorTraceWindow == 0 {
+		c.ErrorTraceWindow = source.ErrorTraceWindow
+	}
+	if c.Consistency == "" {
+		c.Consistency = source.Consistency
+	}
+	if c.ReadConsistency == "" {
+		c.ReadConsistency = source.ReadConsistency
+	}
+	if c.WriteConsistency == "" {
+		c.WriteConsistency = source.WriteConsistency
+	}
+	if c.LoadSheddingWriteConsistency == "" {
+		c.LoadSheddingWriteConsistency = source.LoadSheddingWriteConsistency
+	}
+	if c.LoadSheddingPeriod == 0 {
+		c.LoadSheddingPeriod = source.LoadSheddingPeriod
+	}
+	if c.LoadBalancingPolicy == "" {
+		c.LoadBalancingPolicy = source.LoadBalancingPolicy
+	}
+	if c.LocalDC == "" {
+		c.LocalDC = source.LocalDC
+	}
+	if !c.SchemaAutoMigrate {
+		c.SchemaAutoMigrate = source.SchemaAutoMigrate
+	}
+}
+
+// ConsistencyLevels parses the consistency levels, failing if any of them is not supported
+func (c *Configuration) ConsistencyLevels() (ConsistencyLevels, error) {
+	var levels ConsistencyLevels
+	consistency, err := parseConsistency(c.Consistency, defaultConsistency)
+	if err != nil {
+		return levels, err
+	}
+	if levels.Read, err = parseConsistency(c.ReadConsistency, defaultReadConsistency); err != nil {
+		return levels, err
+	}
+	if levels.Write, err = parseConsistency(c.WriteConsistency, consistency); err != nil {
+		return levels, err
+	}
+	if c.LoadSheddingPeriod < 0 {
+		return levels, fmt.Errorf("Load shedding period %v must not be negative", c.LoadSheddingPeriod)
+	}
+	if c.LoadSheddingWriteConsistency != "" {
+		if levels.LoadSheddingWrite, err = cassandra.ParseConsistency(c.LoadSheddingWriteConsistency); err != nil {
+			return levels, err
+		}
+		levels.LoadSheddingPeriod = c.LoadSheddingPeriod
+		if levels.LoadSheddingPeriod == 0 {
+			levels.LoadSheddingPeriod = defaultLoadSheddingPeriod
+		}
+	}
+	return levels, nil
+}
+
+func parseConsistency(name string, defaultLevel cassandra.Consistency) (cassandra.Consistency, error) {
+	if name == "" {
+		return defaultLevel, nil
+	}
+	return cassandra.ParseConsistency(name)
+}
+
+// ValidateSpanTTLs checks that the span TTLs are accepted by Cassandra, and no longer than MaxSpanTTL
+func (c *Configuration) ValidateSpanTTLs() error {
+	maxTTL := maxCassandraTTL
+	if c.MaxSpanTTL > 0 && c.MaxSpanTTL < maxTTL {
+		maxTTL = c.MaxSpanTTL
+	}
+	if c.SpanTTL < 0 || c.SpanTTL > maxTTL {
+		return fmt.Errorf("Span TTL %v must be between 0 and %v", c.SpanTTL, maxTTL)
+	}
+	for service, ttl := range c.ServiceSpanTTLs {
+		if ttl < time.Second || ttl > maxTTL {
+			return fmt.Errorf("Span TTL %v of service %q must be between %v and %v", ttl, service, time.Second, maxTTL)
+		}
+	}
+	if c.ErrorSpanTTL < 0 || c.ErrorSpanTTL > maxTTL {
+		return fmt.Errorf("Error span TTL %v must be between 0 and %v", c.ErrorSpanTTL, maxTTL)
+	}
+	if c.ErrorTraceWindow < 0 {
+		return fmt.Errorf("Error trace window %v must not be negative", c.ErrorTraceWindow)
+	}
+	return nil
+}
+
+// ValidateLoadBalancing checks that the load balancing policy is supported, and that the local datacenter is set
+// when the policy is DCAwarePolicy
+func (c *Configuration) ValidateLoadBalancing() error {
+	switch c.LoadBalancingPolicy {
+	case "", RoundRobinPolicy:
+		return nil
+	case DCAwarePolicy:
+		if c.LocalDC == "" {
+			return fmt.Errorf("The local datacenter must be set with the %s load balancing policy", DCAwarePolicy)
+		}
+		return nil
+	default:
+		return fmt.Errorf("Unknown load balancing policy %q, expected one of %s, %s",
+			c.LoadBalancingPolicy, RoundRobinPolicy, DCAwarePolicy)
+	}
+}
+
+// Shards returns the configuration of each shard, connecting to a single one of the Servers
+func (c *Configuration) Shards() []Configuration {
+	shards := make([]Configuration, len(c.Servers))
+	for i, server := range c.Servers {
+		shards[i] = *c
+		shards[i].Servers = []string{server}
+	}
+	return shards
 }
 
 // NewSession creates a new Cassandra session
 func (c *Configuration) NewSession() (cassandra.Session, error) {
+	if _, err := c.ConsistencyLevels(); err != nil {
+		return nil, err
+	}
+	if err := c.ValidateLoadBalancing(); err != nil {
+		return nil, err
+	}
 	cluster := c.NewCluster()
 	session, err := cluster.CreateSession()
 	if err != nil {
@@ -95,15 +326,34 @@ func (c *Configuration) NewCluster() *gocql.ClusterConfig {
 		cluster.Port = c.Port
 	}
 	cluster.Compressor = gocql.SnappyCompressor{}
-	if c.Consistency == "" {
-		cluster.Consistency = gocql.LocalOne
-	} else {
-		cluster.Consistency = gocql.ParseConsistency(c.Consistency)
+	// invalid levels are reported by ConsistencyLevels, gocql would panic on them
+	consistency, err := parseConsistency(c.Consistency, defaultConsistency)
+	if err != nil {
+		consistency = defaultConsistency
 	}
-	cluster.PoolConfig.HostSelectionPolicy = gocql.TokenAwareHostPolicy(gocql.RoundRobinHostPolicy())
+	cluster.Consistency = gocql.Consistency(consistency)
+	cluster.PoolConfig.HostSelectionPolicy = gocql.TokenAwareHostPolicy(c.hostPolicy())
 	return cluster
 }
 
+// hostPolicy returns the policy picking the hosts of the queries whose replicas are not known, an invalid
+// policy reported by ValidateLoadBalancing falling back to round robin
+func (c *Configuration) hostPolicy() gocql.HostSelectionPolicy {
+	if c.LoadBalancingPolicy == DCAwarePolicy && c.LocalDC != "" {
+		return gocql.DCAwareRoundRobinPolicy(c.LocalDC)
+	}
+	return gocql.RoundRobinHostPolicy()
+}
+
+// WriteRetryPolicy returns the policy used to retry transient write failures
+func (c *Configuration) WriteRetryPolicy() retry.Policy {
+	return retry.Policy{
+		MaxAttempts:     c.MaxWriteAttempts,
+		InitialInterval: c.WriteRetryBackoff,
+		MaxInterval:     c.WriteRetryMaxBackoff,
+	}
+}
+
 func (c *Configuration) String() string {
 	return fmt.Sprintf("%+v", *c)
 }
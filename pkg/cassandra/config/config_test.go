@@ -0,0 +1,260 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/jaeger/pkg/cassandra"
+)
+
+func TestValidateSpanTTLs(t *testing.T) {
+	testCases := []struct {
+		config        Configuration
+		expectedError string
+	}{
+		{config: Configuration{}},
+		{config: Configuration{
+			SpanTTL:         72 * time.Hour,
+			ServiceSpanTTLs: map[string]time.Duration{"security": 90 * 24 * time.Hour},
+			MaxSpanTTL:      90 * 24 * time.Hour,
+			ErrorSpanTTL:    30 * 24 * time.Hour,
+		}},
+		{
+			config: Configuration{
+				ServiceSpanTTLs: map[string]time.Duration{"security": 91 * 24 * time.Hour},
+				MaxSpanTTL:      90 * 24 * time.Hour,
+			},
+			expectedError: `Span TTL 2184h0m0s of service "security" must be between 1s and 2160h0m0s`,
+		},
+		{
+			config: Configuration{
+				ServiceSpanTTLs: map[string]time.Duration{"dev": time.Millisecond},
+			},
+			expectedError: `Span TTL 1ms of service "dev" must be between 1s and 175200h0m0s`,
+		},
+		{
+			config: Configuration{
+				SpanTTL:    48 * time.Hour,
+				MaxSpanTTL: 24 * time.Hour,
+			},
+			expectedError: "Span TTL 48h0m0s must be between 0 and 24h0m0s",
+		},
+		{
+			config: Configuration{
+				SpanTTL: -time.Hour,
+			},
+			expectedError: "Span TTL -1h0m0s must be between 0 and 175200h0m0s",
+		},
+		{
+			config: Configuration{
+				ErrorSpanTTL: 30 * 24 * time.Hour,
+				MaxSpanTTL:   24 * time.Hour,
+			},
+			expectedError: "Error span TTL 720h0m0s must be between 0 and 24h0m0s",
+		},
+		{
+			config: Configuration{
+				ErrorSpanTTL:     time.Hour,
+				ErrorTraceWindow: -time.Second,
+			},
+			expectedError: "Error trace window -1s must not be negative",
+		},
+	}
+	for _, testCase := range testCases {
+		err := testCase.config.ValidateSpanTTLs()
+		if testCase.expectedError == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, testCase.expectedError)
+		}
+	}
+}
+
+func TestApplyDefaultsSpanTTLs(t *testing.T) {
+	source := &Configuration{
+		SpanTTL:          time.Hour,
+		ServiceSpanTTLs:  map[string]time.Duration{"security": 2 * time.Hour},
+		MaxSpanTTL:       3 * time.Hour,
+		ErrorSpanTTL:     2 * time.Hour,
+		ErrorTraceWindow: time.Second,
+		PromotedTags:     []string{"request.id"},
+	}
+	config := &Configuration{}
+	config.ApplyDefaults(source)
+	assert.Equal(t, source.SpanTTL, config.SpanTTL)
+	assert.Equal(t, source.ServiceSpanTTLs, config.ServiceSpanTTLs)
+	assert.Equal(t, source.MaxSpanTTL, config.MaxSpanTTL)
+	assert.Equal(t, source.ErrorSpanTTL, config.ErrorSpanTTL)
+	assert.Equal(t, source.ErrorTraceWindow, config.ErrorTraceWindow)
+	assert.Equal(t, source.PromotedTags, config.PromotedTags)
+}
+
+func TestConsistencyLevels(t *testing.T) {
+	testCases := []struct {
+		config        Configuration
+		expected      ConsistencyLevels
+		expectedError string
+	}{
+		{
+			config:   Configuration{},
+			expected: ConsistencyLevels{Read: cassandra.One, Write: cassandra.LocalOne},
+		},
+		{
+			config:   Configuration{Consistency: "local_quorum"},
+			expected: ConsistencyLevels{Read: cassandra.One, Write: cassandra.LocalQuorum},
+		},
+		{
+			config: Configuration{
+				ReadConsistency:              "ONE",
+				WriteConsistency:             "QUORUM",
+				LoadSheddingWriteConsistency: "LOCAL_ONE",
+			},
+			expected: ConsistencyLevels{
+				Read:               cassandra.One,
+				Write:              cassandra.Quorum,
+				LoadSheddingWrite:  cassandra.LocalOne,
+				LoadSheddingPeriod: time.Minute,
+			},
+		},
+		{
+			config: Configuration{
+				WriteConsistency:             "EACH_QUORUM",
+				LoadSheddingWriteConsistency: "ANY",
+				LoadSheddingPeriod:           10 * time.Second,
+			},
+			expected: ConsistencyLevels{
+				Read:               cassandra.One,
+				Write:              cassandra.EachQuorum,
+				LoadSheddingWrite:  cassandra.Any,
+				LoadSheddingPeriod: 10 * time.Second,
+			},
+		},
+		{
+			config:        Configuration{Consistency: "MOST"},
+			expectedError: `Invalid consistency level "MOST", expected one of ALL, ANY, EACH_QUORUM, LOCAL_ONE, LOCAL_QUORUM, ONE, QUORUM, THREE, TWO`,
+		},
+		{
+			config:        Configuration{ReadConsistency: "SERIAL"},
+			expectedError: `Invalid consistency level "SERIAL", expected one of ALL, ANY, EACH_QUORUM, LOCAL_ONE, LOCAL_QUORUM, ONE, QUORUM, THREE, TWO`,
+		},
+		{
+			config:        Configuration{WriteConsistency: "QUORUMS"},
+			expectedError: `Invalid consistency level "QUORUMS", expected one of ALL, ANY, EACH_QUORUM, LOCAL_ONE, LOCAL_QUORUM, ONE, QUORUM, THREE, TWO`,
+		},
+		{
+			config:        Configuration{LoadSheddingWriteConsistency: "NONE"},
+			expectedError: `Invalid consistency level "NONE", expected one of ALL, ANY, EACH_QUORUM, LOCAL_ONE, LOCAL_QUORUM, ONE, QUORUM, THREE, TWO`,
+		},
+		{
+			config:        Configuration{LoadSheddingPeriod: -time.Second},
+			expectedError: "Load shedding period -1s must not be negative",
+		},
+	}
+	for _, testCase := range testCases {
+		levels, err := testCase.config.ConsistencyLevels()
+		if testCase.expectedError == "" {
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, levels)
+		} else {
+			assert.EqualError(t, err, testCase.expectedError)
+		}
+	}
+}
+
+func TestNewSessionInvalidConsistency(t *testing.T) {
+	config := &Configuration{Servers: []string{"127.0.0.1"}, WriteConsistency: "MOST"}
+	_, err := config.NewSession()
+	assert.EqualError(t, err, `Invalid consistency level "MOST", expected one of ALL, ANY, EACH_QUORUM, LOCAL_ONE, LOCAL_QUORUM, ONE, QUORUM, THREE, TWO`)
+}
+
+func TestValidateLoadBalancing(t *testing.T) {
+	testCases := []struct {
+		config        Configuration
+		expectedError string
+	}{
+		{config: Configuration{}},
+		{config: Configuration{LoadBalancingPolicy: "round-robin"}},
+		{config: Configuration{LoadBalancingPolicy: "dc-aware", LocalDC: "us-east"}},
+		{
+			config:        Configuration{LoadBalancingPolicy: "dc-aware"},
+			expectedError: "The local datacenter must be set with the dc-aware load balancing policy",
+		},
+		{
+			config:        Configuration{LoadBalancingPolicy: "latency-aware", LocalDC: "us-east"},
+			expectedError: `Unknown load balancing policy "latency-aware", expected one of round-robin, dc-aware`,
+		},
+	}
+	for _, testCase := range testCases {
+		err := testCase.config.ValidateLoadBalancing()
+		if testCase.expectedError == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, testCase.expectedError)
+		}
+	}
+}
+
+func TestNewSessionMissingLocalDC(t *testing.T) {
+	config := &Configuration{Servers: []string{"127.0.0.1"}, LoadBalancingPolicy: DCAwarePolicy}
+	_, err := config.NewSession()
+	assert.EqualError(t, err, "The local datacenter must be set with the dc-aware load balancing policy")
+}
+
+func TestNewClusterHostPolicy(t *testing.T) {
+	config := &Configuration{Servers: []string{"127.0.0.1"}}
+	assert.NotNil(t, config.NewCluster().PoolConfig.HostSelectionPolicy)
+	assert.IsType(t, gocql.RoundRobinHostPolicy(), config.hostPolicy())
+
+	config.LoadBalancingPolicy = DCAwarePolicy
+	config.LocalDC = "us-east"
+	assert.IsType(t, gocql.DCAwareRoundRobinPolicy("us-east"), config.hostPolicy())
+}
+
+func TestApplyDefaultsLoadBalancing(t *testing.T) {
+	source := &Configuration{LoadBalancingPolicy: DCAwarePolicy, LocalDC: "us-east"}
+	config := &Configuration{LocalDC: "eu-west"}
+	config.ApplyDefaults(source)
+	assert.Equal(t, DCAwarePolicy, config.LoadBalancingPolicy)
+	assert.Equal(t, "eu-west", config.LocalDC)
+}
+
+func TestApplyDefaultsConsistency(t *testing.T) {
+	source := &Configuration{
+		Consistency:                  "LOCAL_QUORUM",
+		ReadConsistency:              "ONE",
+		WriteConsistency:             "QUORUM",
+		LoadSheddingWriteConsistency: "LOCAL_ONE",
+		LoadSheddingPeriod:           time.Minute,
+	}
+	config := &Configuration{WriteConsistency: "ALL"}
+	config.ApplyDefaults(source)
+	assert.Equal(t, source.Consistency, config.Consistency)
+	assert.Equal(t, source.ReadConsistency, config.ReadConsistency)
+	assert.Equal(t, "ALL", config.WriteConsistency)
+	assert.Equal(t, source.LoadSheddingWriteConsistency, config.LoadSheddingWriteConsistency)
+	assert.Equal(t, source.LoadSheddingPeriod, config.LoadSheddingPeriod)
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/gocql/gocql"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/pkg/cassandra"
+	jmetrics "github.com/uber/jaeger/pkg/metrics"
+)
+
+// PoolTracker reports the pool metrics of Cassandra sessions. gocql multiplexes the queries over the streams of
+// its connections without queueing them, and does not expose its pool: the queries in flight are reported as the
+// active connections, the queries failing because no connection is available as the acquisition failures, and
+// neither the idle connections nor the wait times are reported.
+type PoolTracker struct {
+	inFlight int64
+	metrics  *jmetrics.PoolMetrics
+	reporter *jmetrics.PoolReporter
+}
+
+// NewPoolTracker creates a PoolTracker reporting in the given metrics factory, until it is closed
+func NewPoolTracker(metricsFactory metrics.Factory) *PoolTracker {
+	t := &PoolTracker{metrics: jmetrics.NewPoolMetrics(metricsFactory)}
+	t.reporter = jmetrics.NewPoolReporter(t.metrics, t.stats, jmetrics.DefaultPoolReportInterval)
+	return t
+}
+
+func (t *PoolTracker) stats() jmetrics.PoolStats {
+	return jmetrics.PoolStats{Active: atomic.LoadInt64(&t.inFlight), Idle: -1}
+}
+
+// WrapSession returns a Session whose queries are tracked, the sessions of all shards can share a PoolTracker
+func (t *PoolTracker) WrapSession(session cassandra.Session) cassandra.Session {
+	return &poolSession{Session: session, tracker: t}
+}
+
+// Close stops reporting the pool metrics
+func (t *PoolTracker) Close() error {
+	return t.reporter.Close()
+}
+
+// acquire records a query in flight, release must be called once it completes
+func (t *PoolTracker) acquire() {
+	atomic.AddInt64(&t.inFlight, 1)
+}
+
+func (t *PoolTracker) release(err error) {
+	atomic.AddInt64(&t.inFlight, -1)
+	if err == gocql.ErrNoConnections {
+		t.metrics.AcquisitionFailures.Inc(1)
+	}
+}
+
+type poolSession struct {
+	cassandra.Session
+	tracker *PoolTracker
+}
+
+func (s *poolSession) Query(stmt string, values ...interface{}) cassandra.Query {
+	return &poolQuery{Query: s.Session.Query(stmt, values...), tracker: s.tracker}
+}
+
+// poolQuery embeds cassandra.Query so that only the executing methods change behaviour; builder methods are
+// re-wrapped so that the tracking survives chaining.
+type poolQuery struct {
+	cassandra.Query
+	tracker *PoolTracker
+}
+
+func (q *poolQuery) Exec() error {
+	q.tracker.acquire()
+	err := q.Query.Exec()
+	q.tracker.release(err)
+	return err
+}
+
+func (q *poolQuery) ScanCAS(dest ...interface{}) (bool, error) {
+	q.tracker.acquire()
+	applied, err := q.Query.ScanCAS(dest...)
+	q.tracker.release(err)
+	return applied, err
+}
+
+// Iter tracks the query until the iterator is closed, since its pages are fetched while scanning
+func (q *poolQuery) Iter() cassandra.Iterator {
+	q.tracker.acquire()
+	return &poolIterator{Iterator: q.Query.Iter(), tracker: q.tracker}
+}
+
+func (q *poolQuery) Bind(v ...interface{}) cassandra.Query {
+	return &poolQuery{Query: q.Query.Bind(v...), tracker: q.tracker}
+}
+
+func (q *poolQuery) Consistency(level cassandra.Consistency) cassandra.Query {
+	return &poolQuery{Query: q.Query.Consistency(level), tracker: q.tracker}
+}
+
+func (q *poolQuery) PageSize(n int) cassandra.Query {
+	return &poolQuery{Query: q.Query.PageSize(n), tracker: q.tracker}
+}
+
+type poolIterator struct {
+	cassandra.Iterator
+	tracker *PoolTracker
+	closed  sync.Once
+}
+
+func (i *poolIterator) Close() error {
+	err := i.Iterator.Close()
+	i.closed.Do(func() {
+		i.tracker.release(err)
+	})
+	return err
+}
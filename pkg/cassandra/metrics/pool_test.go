@@ -0,0 +1,63 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/pkg/cassandra/mocks"
+)
+
+func TestPoolTracker(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	tracker := NewPoolTracker(metricsFactory)
+	defer tracker.Close()
+
+	query := &mocks.Query{}
+	iter := &mocks.Iterator{}
+	session := &mocks.Session{}
+	session.On("Query", "SELECT", []interface{}(nil)).Return(query)
+	query.On("Consistency", mock.Anything).Return(query)
+	var inFlight []int64
+	query.On("Exec").Run(func(mock.Arguments) {
+		inFlight = append(inFlight, tracker.stats().Active)
+	}).Return(gocql.ErrNoConnections)
+	query.On("Iter").Return(iter)
+	iter.On("Close").Return(nil)
+
+	s := tracker.WrapSession(session)
+	assert.Equal(t, gocql.ErrNoConnections, s.Query("SELECT").Consistency(1).Exec())
+	assert.Equal(t, []int64{1}, inFlight, "the chained query is tracked")
+
+	it := s.Query("SELECT").Iter()
+	assert.EqualValues(t, 1, tracker.stats().Active, "the query is in flight until its iterator is closed")
+	assert.NoError(t, it.Close())
+	assert.NoError(t, it.Close())
+	assert.EqualValues(t, 0, tracker.stats().Active)
+
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["pool.acquisition-failures"])
+}
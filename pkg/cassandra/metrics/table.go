@@ -28,6 +28,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/uber/jaeger/pkg/cassandra"
+	"github.com/uber/jaeger/pkg/cassandra/retry"
 	storageMetrics "github.com/uber/jaeger/storage/spanstore/metrics"
 )
 
@@ -43,6 +44,12 @@ func NewTable(factory metrics.Factory, tableName string) *Table {
 	return &Table{t}
 }
 
+// Emit records success or failure counts and latency metrics depending on the passed error,
+// failures being counted by the category of the Cassandra error.
+func (t *Table) Emit(err error, latency time.Duration) {
+	t.WriteMetrics.Emit(err, latency, retry.ClassifyError)
+}
+
 // Exec executes an update query and reports metrics/logs about it.
 func (t *Table) Exec(query cassandra.UpdateQuery, logger *zap.Logger) error {
 	start := time.Now()
@@ -0,0 +1,42 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cassandra
+
+import "fmt"
+
+// HealthQuery is a cheap query checking that Cassandra can be reached
+const HealthQuery = "SELECT now() FROM system.local"
+
+// Probe checks that the session can query Cassandra
+func Probe(session Session) error {
+	return session.Query(HealthQuery).Exec()
+}
+
+// ProbeShards checks that the sessions of all shards can query Cassandra, servers are the shard addresses
+// in the order of their sessions
+func ProbeShards(servers []string, sessions []Session) error {
+	for i, session := range sessions {
+		if err := Probe(session); err != nil {
+			return fmt.Errorf("Cassandra shard %s is unavailable: %v", servers[i], err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package retry
+
+import (
+	"net"
+
+	"github.com/gocql/gocql"
+
+	storageMetrics "github.com/uber/jaeger/storage/spanstore/metrics"
+)
+
+// Cassandra native protocol error codes that indicate a temporary condition of the cluster.
+// gocql does not export them.
+const (
+	errCodeUnavailable   = 0x1000
+	errCodeOverloaded    = 0x1001
+	errCodeBootstrapping = 0x1002
+	errCodeWriteTimeout  = 0x1100
+	errCodeReadTimeout   = 0x1200
+
+	// error codes of invalid requests
+	errCodeProtocol = 0x000A
+	errCodeSyntax   = 0x2000
+	errCodeInvalid  = 0x2200
+)
+
+// IsTransient returns true if the error is caused by timeouts or unavailable hosts, and the
+// same query can succeed if attempted again. Data errors, such as invalid queries, are not transient.
+func IsTransient(err error) bool {
+	switch err {
+	case gocql.ErrTimeoutNoResponse, gocql.ErrConnectionClosed, gocql.ErrNoConnections:
+		return true
+	}
+	switch err.(type) {
+	case *gocql.RequestErrUnavailable, *gocql.RequestErrWriteTimeout, *gocql.RequestErrReadTimeout:
+		return true
+	}
+	if reqErr, ok := err.(gocql.RequestError); ok {
+		switch reqErr.Code() {
+		case errCodeUnavailable, errCodeOverloaded, errCodeBootstrapping, errCodeWriteTimeout, errCodeReadTimeout:
+			return true
+		}
+		return false
+	}
+	if netErr, ok := err.(net.Error); ok {
+		return netErr.Timeout() || netErr.Temporary()
+	}
+	return false
+}
+
+// ClassifyError is the storageMetrics.ErrorClassifier of Cassandra errors: timeouts, unavailable or overloaded
+// nodes, values which cannot be marshaled and invalid queries, and batches with too many statements
+func ClassifyError(err error) (storageMetrics.ErrorCategory, bool) {
+	switch err {
+	case gocql.ErrTimeoutNoResponse:
+		return storageMetrics.TimeoutError, true
+	case gocql.ErrConnectionClosed, gocql.ErrNoConnections:
+		return storageMetrics.UnavailableError, true
+	case gocql.ErrQueryArgLength:
+		return storageMetrics.SerializationError, true
+	case gocql.ErrTooManyStmts:
+		return storageMetrics.QuotaError, true
+	}
+	switch err.(type) {
+	case gocql.MarshalError:
+		return storageMetrics.SerializationError, true
+	case *gocql.RequestErrWriteTimeout, *gocql.RequestErrReadTimeout:
+		return storageMetrics.TimeoutError, true
+	case *gocql.RequestErrUnavailable:
+		return storageMetrics.UnavailableError, true
+	}
+	if reqErr, ok := err.(gocql.RequestError); ok {
+		switch reqErr.Code() {
+		case errCodeWriteTimeout, errCodeReadTimeout:
+			return storageMetrics.TimeoutError, true
+		case errCodeUnavailable, errCodeOverloaded, errCodeBootstrapping:
+			return storageMetrics.UnavailableError, true
+		case errCodeProtocol, errCodeSyntax, errCodeInvalid:
+			return storageMetrics.SerializationError, true
+		}
+	}
+	return "", false
+}
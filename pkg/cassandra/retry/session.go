@@ -0,0 +1,137 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package retry
+
+import (
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/pkg/cassandra"
+)
+
+// Policy describes how failed writes are retried
+type Policy struct {
+	// MaxAttempts is the total number of attempts for a single write, including the first one.
+	// Values lower than 2 disable retries.
+	MaxAttempts int
+	// InitialInterval is the delay before the first retry, doubled on every subsequent retry.
+	InitialInterval time.Duration
+	// MaxInterval caps the delay between two retries.
+	MaxInterval time.Duration
+}
+
+// backoff returns the delay before the given retry, starting at 1
+func (p Policy) backoff(retry int) time.Duration {
+	delay := p.InitialInterval
+	for i := 1; i < retry && (p.MaxInterval == 0 || delay < p.MaxInterval); i++ {
+		delay *= 2
+	}
+	if p.MaxInterval > 0 && delay > p.MaxInterval {
+		return p.MaxInterval
+	}
+	return delay
+}
+
+type retryMetrics struct {
+	// Retries counts the writes attempted again after a transient failure
+	Retries metrics.Counter `metric:"write-retries"`
+	// Exhausted counts the writes that kept failing after all attempts were used
+	Exhausted metrics.Counter `metric:"write-retries-exhausted"`
+}
+
+// Session is a cassandra.Session that retries transient failures of Query#Exec
+type Session struct {
+	session cassandra.Session
+	policy  Policy
+	metrics *retryMetrics
+	logger  *zap.Logger
+	sleep   func(time.Duration)
+}
+
+// WrapSession returns a Session that retries writes made through the given session according to the policy
+func WrapSession(session cassandra.Session, policy Policy, metricsFactory metrics.Factory, logger *zap.Logger) *Session {
+	m := &retryMetrics{}
+	metrics.Init(m, metricsFactory, nil)
+	return &Session{
+		session: session,
+		policy:  policy,
+		metrics: m,
+		logger:  logger,
+		sleep:   time.Sleep,
+	}
+}
+
+// Query delegates to the wrapped session and wraps the result as a retrying Query.
+func (s *Session) Query(stmt string, values ...interface{}) cassandra.Query {
+	return &query{Query: s.session.Query(stmt, values...), session: s}
+}
+
+// Close delegates to the wrapped session.
+func (s *Session) Close() {
+	s.session.Close()
+}
+
+func (s *Session) exec(q cassandra.Query) error {
+	err := q.Exec()
+	for attempt := 1; err != nil && attempt < s.policy.MaxAttempts; attempt++ {
+		if !IsTransient(err) {
+			return err
+		}
+		delay := s.policy.backoff(attempt)
+		s.logger.Debug("Retrying Cassandra write",
+			zap.Stringer("query", q),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("backoff", delay),
+			zap.Error(err))
+		s.metrics.Retries.Inc(1)
+		s.sleep(delay)
+		err = q.Exec()
+	}
+	if err != nil && s.policy.MaxAttempts > 1 && IsTransient(err) {
+		s.metrics.Exhausted.Inc(1)
+	}
+	return err
+}
+
+// query embeds cassandra.Query so that only Exec changes behaviour; builder methods are re-wrapped
+// so that the retrying Exec survives chaining.
+type query struct {
+	cassandra.Query
+	session *Session
+}
+
+func (q *query) Exec() error {
+	return q.session.exec(q.Query)
+}
+
+func (q *query) Bind(v ...interface{}) cassandra.Query {
+	return &query{Query: q.Query.Bind(v...), session: q.session}
+}
+
+func (q *query) Consistency(level cassandra.Consistency) cassandra.Query {
+	return &query{Query: q.Query.Consistency(level), session: q.session}
+}
+
+func (q *query) PageSize(n int) cassandra.Query {
+	return &query{Query: q.Query.PageSize(n), session: q.session}
+}
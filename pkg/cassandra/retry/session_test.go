@@ -0,0 +1,167 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package retry
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/pkg/cassandra"
+	"github.com/uber/jaeger/pkg/cassandra/mocks"
+	storageMetrics "github.com/uber/jaeger/storage/spanstore/metrics"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return false }
+
+var _ net.Error = timeoutError{}
+
+func withRetrySession(policy Policy, fn func(s *Session, query *mocks.Query, mf *metrics.LocalFactory, sleeps *[]time.Duration)) {
+	query := &mocks.Query{}
+	session := &mocks.Session{}
+	session.On("Query", "INSERT", []interface{}{1}).Return(query)
+	mf := metrics.NewLocalFactory(0)
+	s := WrapSession(session, policy, mf, zap.NewNop())
+	var sleeps []time.Duration
+	s.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+	fn(s, query, mf, &sleeps)
+}
+
+func TestExecRetriesTransientErrors(t *testing.T) {
+	policy := Policy{MaxAttempts: 4, InitialInterval: 10 * time.Millisecond, MaxInterval: 30 * time.Millisecond}
+	withRetrySession(policy, func(s *Session, query *mocks.Query, mf *metrics.LocalFactory, sleeps *[]time.Duration) {
+		query.On("Exec").Return(gocql.ErrTimeoutNoResponse).Twice()
+		query.On("Exec").Return(nil).Once()
+
+		assert.NoError(t, s.Query("INSERT", 1).Exec())
+		assert.Equal(t, []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}, *sleeps)
+
+		counters, _ := mf.Snapshot()
+		assert.EqualValues(t, 2, counters["write-retries"])
+		assert.EqualValues(t, 0, counters["write-retries-exhausted"])
+	})
+}
+
+func TestExecRetriesExhausted(t *testing.T) {
+	policy := Policy{MaxAttempts: 4, InitialInterval: 10 * time.Millisecond, MaxInterval: 30 * time.Millisecond}
+	withRetrySession(policy, func(s *Session, query *mocks.Query, mf *metrics.LocalFactory, sleeps *[]time.Duration) {
+		query.On("Exec").Return(timeoutError{})
+
+		assert.Equal(t, timeoutError{}, s.Query("INSERT", 1).Exec())
+		assert.Equal(t, []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond}, *sleeps)
+		query.AssertNumberOfCalls(t, "Exec", 4)
+
+		counters, _ := mf.Snapshot()
+		assert.EqualValues(t, 3, counters["write-retries"])
+		assert.EqualValues(t, 1, counters["write-retries-exhausted"])
+	})
+}
+
+func TestExecDoesNotRetryDataErrors(t *testing.T) {
+	policy := Policy{MaxAttempts: 4, InitialInterval: time.Millisecond}
+	withRetrySession(policy, func(s *Session, query *mocks.Query, mf *metrics.LocalFactory, sleeps *[]time.Duration) {
+		invalid := errors.New("invalid query")
+		query.On("Exec").Return(invalid)
+
+		assert.Equal(t, invalid, s.Query("INSERT", 1).Exec())
+		assert.Empty(t, *sleeps)
+		query.AssertNumberOfCalls(t, "Exec", 1)
+
+		counters, _ := mf.Snapshot()
+		assert.EqualValues(t, 0, counters["write-retries"])
+		assert.EqualValues(t, 0, counters["write-retries-exhausted"])
+	})
+}
+
+func TestExecRetriesDisabled(t *testing.T) {
+	withRetrySession(Policy{MaxAttempts: 1}, func(s *Session, query *mocks.Query, mf *metrics.LocalFactory, sleeps *[]time.Duration) {
+		query.On("Exec").Return(gocql.ErrNoConnections)
+
+		assert.Equal(t, gocql.ErrNoConnections, s.Query("INSERT", 1).Exec())
+		query.AssertNumberOfCalls(t, "Exec", 1)
+
+		counters, _ := mf.Snapshot()
+		assert.EqualValues(t, 0, counters["write-retries-exhausted"])
+	})
+}
+
+func TestChainedQueryKeepsRetrying(t *testing.T) {
+	withRetrySession(Policy{MaxAttempts: 2}, func(s *Session, query *mocks.Query, mf *metrics.LocalFactory, sleeps *[]time.Duration) {
+		query.On("Consistency", cassandra.One).Return(query)
+		query.On("Exec").Return(gocql.ErrConnectionClosed).Once()
+		query.On("Exec").Return(nil).Once()
+
+		assert.NoError(t, s.Query("INSERT", 1).Consistency(cassandra.One).Exec())
+		query.AssertNumberOfCalls(t, "Exec", 2)
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	p := Policy{InitialInterval: time.Second, MaxInterval: 5 * time.Second}
+	assert.Equal(t, time.Second, p.backoff(1))
+	assert.Equal(t, 2*time.Second, p.backoff(2))
+	assert.Equal(t, 4*time.Second, p.backoff(3))
+	assert.Equal(t, 5*time.Second, p.backoff(4))
+	assert.Equal(t, 5*time.Second, p.backoff(10))
+}
+
+func TestIsTransient(t *testing.T) {
+	assert.True(t, IsTransient(gocql.ErrTimeoutNoResponse))
+	assert.True(t, IsTransient(gocql.ErrNoConnections))
+	assert.True(t, IsTransient(&gocql.RequestErrWriteTimeout{}))
+	assert.True(t, IsTransient(&gocql.RequestErrUnavailable{}))
+	assert.True(t, IsTransient(timeoutError{}))
+	assert.False(t, IsTransient(errors.New("invalid query")))
+	assert.False(t, IsTransient(&gocql.RequestErrAlreadyExists{}))
+}
+
+func TestClassifyError(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected storageMetrics.ErrorCategory
+	}{
+		{err: gocql.ErrTimeoutNoResponse, expected: storageMetrics.TimeoutError},
+		{err: &gocql.RequestErrWriteTimeout{}, expected: storageMetrics.TimeoutError},
+		{err: &gocql.RequestErrReadTimeout{}, expected: storageMetrics.TimeoutError},
+		{err: gocql.ErrNoConnections, expected: storageMetrics.UnavailableError},
+		{err: &gocql.RequestErrUnavailable{}, expected: storageMetrics.UnavailableError},
+		{err: gocql.MarshalError("can not marshal"), expected: storageMetrics.SerializationError},
+		{err: gocql.ErrQueryArgLength, expected: storageMetrics.SerializationError},
+		{err: gocql.ErrTooManyStmts, expected: storageMetrics.QuotaError},
+	}
+	for _, testCase := range testCases {
+		category, ok := ClassifyError(testCase.err)
+		assert.True(t, ok, testCase.err.Error())
+		assert.Equal(t, testCase.expected, category, testCase.err.Error())
+	}
+	_, ok := ClassifyError(errors.New("other"))
+	assert.False(t, ok)
+}
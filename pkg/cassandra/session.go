@@ -20,6 +20,12 @@
 
 package cassandra
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
 // Consistency is Cassandra's consistency level for queries.
 type Consistency uint16
 
@@ -44,6 +50,36 @@ const (
 	LocalOne Consistency = 0x0A
 )
 
+var consistencyNames = map[string]Consistency{
+	"ANY":          Any,
+	"ONE":          One,
+	"TWO":          Two,
+	"THREE":        Three,
+	"QUORUM":       Quorum,
+	"ALL":          All,
+	"LOCAL_QUORUM": LocalQuorum,
+	"EACH_QUORUM":  EachQuorum,
+	"LOCAL_ONE":    LocalOne,
+}
+
+// ParseConsistency returns the consistency level with the given name, e.g. LOCAL_QUORUM, ignoring case.
+// Only the levels supported by gocql are accepted.
+func ParseConsistency(name string) (Consistency, error) {
+	if level, ok := consistencyNames[strings.ToUpper(strings.TrimSpace(name))]; ok {
+		return level, nil
+	}
+	return 0, fmt.Errorf("Invalid consistency level %q, expected one of %s", name, strings.Join(consistencyNameList(), ", "))
+}
+
+func consistencyNameList() []string {
+	names := make([]string, 0, len(consistencyNames))
+	for name := range consistencyNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Session is an abstraction of gocql.Session
 type Session interface {
 	Query(stmt string, values ...interface{}) Query
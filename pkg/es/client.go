@@ -31,6 +31,9 @@ type Client interface {
 	CreateIndex(index string) IndicesCreateService
 	Index() IndexService
 	Search(indices ...string) SearchService
+	Bulk() BulkService
+	ClusterHealth() ClusterHealthService
+	DeleteByQuery(indices ...string) DeleteByQueryService
 }
 
 // IndicesCreateService is an abstraction for elastic.IndicesCreateService
@@ -57,3 +60,25 @@ type SearchService interface {
 	Query(query elastic.Query) SearchService
 	Do(ctx context.Context) (*elastic.SearchResult, error)
 }
+
+// BulkService is an abstraction for elastic.BulkService
+type BulkService interface {
+	Add(requests ...elastic.BulkableRequest) BulkService
+	NumberOfActions() int
+	Do(ctx context.Context) (*elastic.BulkResponse, error)
+}
+
+// ClusterHealthService is an abstraction for elastic.ClusterHealthService
+type ClusterHealthService interface {
+	Do(ctx context.Context) (*elastic.ClusterHealthResponse, error)
+}
+
+// DeleteByQueryService is an abstraction for elastic.DeleteByQueryService
+type DeleteByQueryService interface {
+	Type(typ ...string) DeleteByQueryService
+	Query(query elastic.Query) DeleteByQueryService
+	IgnoreUnavailable(ignoreUnavailable bool) DeleteByQueryService
+	ProceedOnVersionConflict() DeleteByQueryService
+	RequestsPerSecond(requestsPerSecond int) DeleteByQueryService
+	Do(ctx context.Context) (*elastic.BulkIndexByScrollResponse, error)
+}
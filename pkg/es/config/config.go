@@ -21,14 +21,36 @@
 package config
 
 import (
+	"io"
+	"net/http"
+	"regexp"
 	"time"
 
 	"github.com/olivere/elastic"
 	"github.com/pkg/errors"
+	"github.com/uber/jaeger-lib/metrics"
 
 	"github.com/uber/jaeger/pkg/es"
 )
 
+// AuthType is how the client authenticates to the ElasticSearch servers
+type AuthType string
+
+const (
+	// BasicAuth sends the Username and Password
+	BasicAuth AuthType = "basic"
+	// APIKeyAuth sends the APIKey
+	APIKeyAuth AuthType = "api-key"
+	// BearerTokenAuth sends the BearerToken
+	BearerTokenAuth AuthType = "bearer"
+
+	// maxIndexShards is the number of primary shards allowed by ElasticSearch for an index
+	maxIndexShards = 1024
+)
+
+// refreshIntervalPattern matches the ElasticSearch time values, or -1 which disables the refreshes
+var refreshIntervalPattern = regexp.MustCompile(`^(-1|[0-9]+(d|h|m|s|ms|micros|nanos))$`)
+
 // Configuration describes the configuration properties needed to connect to a ElasticSearch cluster
 type Configuration struct {
 	Servers    []string
@@ -36,6 +58,40 @@ type Configuration struct {
 	Password   string
 	Sniffer    bool          // https://github.com/olivere/elastic/wiki/Sniffing
 	MaxSpanAge time.Duration // configures the maximum lookback on span reads
+
+	BulkSize          int           // the number of spans buffered before they are sent in one bulk request
+	BulkFlushInterval time.Duration // the maximum time a span stays buffered before the bulk request is sent
+	BulkMaxRetries    int           // the number of times documents rejected by a bulk request are retried, none if 0
+	BulkRetryBackoff  time.Duration // the time waited before the first retry of a bulk request, doubled before each next one
+
+	// IndexTemplate names the indices of spans, e.g. jaeger-{service}-{date} for daily indices per service.
+	// The daily jaeger-{date} indices shared by all services are used when it is empty.
+	IndexTemplate string
+
+	// IndexRefreshInterval is how often the span indices created by the writers make the new spans searchable,
+	// e.g. 30s, -1 disabling the periodic refreshes. The ElasticSearch default if empty.
+	IndexRefreshInterval string
+	// IndexShards is the number of primary shards of the span indices created by the writers, the
+	// ElasticSearch default if 0
+	IndexShards int
+	// IndexReplicas is the number of replicas of each shard of the span indices created by the writers, the
+	// ElasticSearch default if nil
+	IndexReplicas *int
+
+	// SchemaAutoMigrate upgrades the schema version recorded for the span indices when it is older than the one
+	// expected by the writers, which refuse to start otherwise
+	SchemaAutoMigrate bool
+
+	// MaxIdleConnsPerHost is the number of idle connections kept open to each server, the net/http default if 0
+	MaxIdleConnsPerHost int
+
+	// AuthType selects the credentials sent to the servers. It is inferred from the credentials configured when
+	// empty, no credentials meaning no authentication.
+	AuthType AuthType
+	// APIKey is the base64 encoding of id:api_key, as returned in the "encoded" field by ElasticSearch
+	APIKey string
+	// BearerToken is an OAuth2 access token, e.g. from the ElasticSearch token service
+	BearerToken string
 }
 
 // NewClient creates a new ElasticSearch client
@@ -43,18 +99,133 @@ func (c *Configuration) NewClient() (es.Client, error) {
 	if len(c.Servers) < 1 {
 		return nil, errors.New("No servers specified")
 	}
-	rawClient, err := elastic.NewClient(c.GetConfigs()...)
+	if err := c.validateAuth(); err != nil {
+		return nil, err
+	}
+	options := append(c.GetConfigs(), elastic.SetHttpClient(&http.Client{Transport: c.authTransport(http.DefaultTransport)}))
+	rawClient, err := elastic.NewClient(options...)
 	if err != nil {
 		return nil, err
 	}
 	return es.WrapESClient(rawClient), nil
 }
 
+// NewClientWithMetrics creates a new ElasticSearch client reporting the metrics of its connection pool
+// in the given metrics factory until the returned closer is closed
+func (c *Configuration) NewClientWithMetrics(metricsFactory metrics.Factory) (es.Client, io.Closer, error) {
+	if len(c.Servers) < 1 {
+		return nil, nil, errors.New("No servers specified")
+	}
+	if err := c.validateAuth(); err != nil {
+		return nil, nil, err
+	}
+	transport := es.NewPoolTransport(c.MaxIdleConnsPerHost, metricsFactory)
+	options := append(c.GetConfigs(), elastic.SetHttpClient(&http.Client{Transport: c.authTransport(transport)}))
+	rawClient, err := elastic.NewClient(options...)
+	if err != nil {
+		transport.Close()
+		return nil, nil, err
+	}
+	return es.WrapESClient(rawClient), transport, nil
+}
+
 // GetConfigs wraps the configs to feed to the ElasticSearch client init
 func (c *Configuration) GetConfigs() []elastic.ClientOptionFunc {
-	options := make([]elastic.ClientOptionFunc, 3)
-	options[0] = elastic.SetURL(c.Servers...)
-	options[1] = elastic.SetBasicAuth(c.Username, c.Password)
-	options[2] = elastic.SetSniff(c.Sniffer)
+	options := []elastic.ClientOptionFunc{
+		elastic.SetURL(c.Servers...),
+		elastic.SetSniff(c.Sniffer),
+	}
+	if c.authType() == BasicAuth {
+		options = append(options, elastic.SetBasicAuth(c.Username, c.Password))
+	}
 	return options
 }
+
+// ValidateIndexSettings checks that the settings of the span indices created by the writers are accepted by
+// ElasticSearch, so that the index creations do not all fail later
+func (c *Configuration) ValidateIndexSettings() error {
+	if c.IndexRefreshInterval != "" && !refreshIntervalPattern.MatchString(c.IndexRefreshInterval) {
+		return errors.Errorf("Invalid ElasticSearch index refresh interval %q, expected a time value such as 30s, or -1", c.IndexRefreshInterval)
+	}
+	if c.IndexShards < 0 || c.IndexShards > maxIndexShards {
+		return errors.Errorf("Invalid number of ElasticSearch index shards %d, expected between 1 and %d", c.IndexShards, maxIndexShards)
+	}
+	if c.IndexReplicas != nil && *c.IndexReplicas < 0 {
+		return errors.Errorf("Invalid number of ElasticSearch index replicas %d, expected 0 or more", *c.IndexReplicas)
+	}
+	return nil
+}
+
+// authType returns the AuthType, inferred from the credentials if empty
+func (c *Configuration) authType() AuthType {
+	switch {
+	case c.AuthType != "":
+		return c.AuthType
+	case c.APIKey != "":
+		return APIKeyAuth
+	case c.BearerToken != "":
+		return BearerTokenAuth
+	default:
+		return BasicAuth
+	}
+}
+
+// validateAuth checks that the credentials of exactly the AuthType are configured, or none at all without AuthType
+func (c *Configuration) validateAuth() error {
+	var configured []AuthType
+	if c.Username != "" || c.Password != "" {
+		configured = append(configured, BasicAuth)
+	}
+	if c.APIKey != "" {
+		configured = append(configured, APIKeyAuth)
+	}
+	if c.BearerToken != "" {
+		configured = append(configured, BearerTokenAuth)
+	}
+	if len(configured) > 1 {
+		return errors.Errorf("Only one ElasticSearch auth method can be configured, found %v", configured)
+	}
+	switch c.AuthType {
+	case "":
+		return nil
+	case BasicAuth, APIKeyAuth, BearerTokenAuth:
+		if len(configured) == 0 || configured[0] != c.AuthType {
+			return errors.Errorf("ElasticSearch auth type %s has no credentials configured", c.AuthType)
+		}
+		return nil
+	default:
+		return errors.Errorf("Unknown ElasticSearch auth type %q", c.AuthType)
+	}
+}
+
+// authTransport wraps the transport to send the Authorization header of API keys and bearer tokens, which the
+// client cannot add by itself
+func (c *Configuration) authTransport(transport http.RoundTripper) http.RoundTripper {
+	switch c.authType() {
+	case APIKeyAuth:
+		return &headerTransport{transport: transport, key: "Authorization", value: "ApiKey " + c.APIKey}
+	case BearerTokenAuth:
+		return &headerTransport{transport: transport, key: "Authorization", value: "Bearer " + c.BearerToken}
+	default:
+		return transport
+	}
+}
+
+// headerTransport sets a header on every request
+type headerTransport struct {
+	transport  http.RoundTripper
+	key, value string
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a RoundTripper must not modify the request, the header is set on a copy
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	r.Header.Set(t.key, t.value)
+	return t.transport.RoundTrip(r)
+}
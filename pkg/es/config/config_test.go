@@ -0,0 +1,182 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+)
+
+func TestValidateAuth(t *testing.T) {
+	testCases := []struct {
+		config Configuration
+		err    string
+	}{
+		{config: Configuration{}},
+		{config: Configuration{Username: "user", Password: "secret"}},
+		{config: Configuration{AuthType: BasicAuth, Username: "user"}},
+		{config: Configuration{APIKey: "a2V5"}},
+		{config: Configuration{AuthType: APIKeyAuth, APIKey: "a2V5"}},
+		{config: Configuration{AuthType: BearerTokenAuth, BearerToken: "token"}},
+		{
+			config: Configuration{Username: "user", APIKey: "a2V5"},
+			err:    "Only one ElasticSearch auth method can be configured, found [basic api-key]",
+		},
+		{
+			config: Configuration{AuthType: BearerTokenAuth, APIKey: "a2V5", BearerToken: "token"},
+			err:    "Only one ElasticSearch auth method can be configured, found [api-key bearer]",
+		},
+		{
+			config: Configuration{AuthType: APIKeyAuth},
+			err:    "ElasticSearch auth type api-key has no credentials configured",
+		},
+		{
+			config: Configuration{AuthType: APIKeyAuth, BearerToken: "token"},
+			err:    "ElasticSearch auth type api-key has no credentials configured",
+		},
+		{
+			config: Configuration{AuthType: "kerberos"},
+			err:    `Unknown ElasticSearch auth type "kerberos"`,
+		},
+	}
+	for _, testCase := range testCases {
+		err := testCase.config.validateAuth()
+		if testCase.err == "" {
+			assert.NoError(t, err, "%+v", testCase.config)
+		} else {
+			assert.EqualError(t, err, testCase.err, "%+v", testCase.config)
+		}
+	}
+}
+
+// authServer records the Authorization headers received by a fake ElasticSearch server
+type authServer struct {
+	*httptest.Server
+	sync.Mutex
+	headers []string
+}
+
+func newAuthServer() *authServer {
+	s := &authServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Lock()
+		s.headers = append(s.headers, r.Header.Get("Authorization"))
+		s.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	return s
+}
+
+func (s *authServer) lastHeader() string {
+	s.Lock()
+	defer s.Unlock()
+	if len(s.headers) == 0 {
+		return ""
+	}
+	return s.headers[len(s.headers)-1]
+}
+
+func TestValidateIndexSettings(t *testing.T) {
+	zero, negative := 0, -1
+	testCases := []struct {
+		config Configuration
+		err    string
+	}{
+		{config: Configuration{}},
+		{config: Configuration{IndexRefreshInterval: "30s", IndexShards: 5, IndexReplicas: &zero}},
+		{config: Configuration{IndexRefreshInterval: "-1"}},
+		{config: Configuration{IndexRefreshInterval: "500ms", IndexShards: 1024}},
+		{
+			config: Configuration{IndexRefreshInterval: "30 seconds"},
+			err:    `Invalid ElasticSearch index refresh interval "30 seconds", expected a time value such as 30s, or -1`,
+		},
+		{
+			config: Configuration{IndexRefreshInterval: "5"},
+			err:    `Invalid ElasticSearch index refresh interval "5", expected a time value such as 30s, or -1`,
+		},
+		{
+			config: Configuration{IndexShards: -1},
+			err:    "Invalid number of ElasticSearch index shards -1, expected between 1 and 1024",
+		},
+		{
+			config: Configuration{IndexShards: 1025},
+			err:    "Invalid number of ElasticSearch index shards 1025, expected between 1 and 1024",
+		},
+		{
+			config: Configuration{IndexReplicas: &negative},
+			err:    "Invalid number of ElasticSearch index replicas -1, expected 0 or more",
+		},
+	}
+	for _, testCase := range testCases {
+		err := testCase.config.ValidateIndexSettings()
+		if testCase.err == "" {
+			assert.NoError(t, err, "%+v", testCase.config)
+		} else {
+			assert.EqualError(t, err, testCase.err, "%+v", testCase.config)
+		}
+	}
+}
+
+func TestNewClientAuthHeader(t *testing.T) {
+	testCases := []struct {
+		config Configuration
+		header string
+	}{
+		{config: Configuration{}, header: ""},
+		{config: Configuration{Username: "user", Password: "secret"}, header: "Basic dXNlcjpzZWNyZXQ="},
+		{config: Configuration{AuthType: APIKeyAuth, APIKey: "a2V5"}, header: "ApiKey a2V5"},
+		{config: Configuration{AuthType: BearerTokenAuth, BearerToken: "token"}, header: "Bearer token"},
+	}
+	for _, testCase := range testCases {
+		server := newAuthServer()
+		config := testCase.config
+		config.Servers = []string{server.URL}
+		_, err := config.NewClient()
+		require.NoError(t, err)
+		assert.Equal(t, testCase.header, server.lastHeader(), "%+v", testCase.config)
+		server.Close()
+	}
+}
+
+func TestNewClientWithMetricsAuthHeader(t *testing.T) {
+	server := newAuthServer()
+	defer server.Close()
+	config := Configuration{Servers: []string{server.URL}, BearerToken: "token"}
+	_, closer, err := config.NewClientWithMetrics(metrics.NullFactory)
+	require.NoError(t, err)
+	defer closer.Close()
+	assert.Equal(t, "Bearer token", server.lastHeader())
+}
+
+func TestNewClientInvalidAuth(t *testing.T) {
+	config := Configuration{Servers: []string{"http://127.0.0.1:9200"}, APIKey: "a2V5", BearerToken: "token"}
+	_, err := config.NewClient()
+	assert.Error(t, err)
+	_, _, err = config.NewClientWithMetrics(metrics.NullFactory)
+	assert.Error(t, err)
+}
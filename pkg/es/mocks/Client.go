@@ -29,6 +29,38 @@ type Client struct {
 	mock.Mock
 }
 
+// Bulk provides a mock function with given fields:
+func (_m *Client) Bulk() es.BulkService {
+	ret := _m.Called()
+
+	var r0 es.BulkService
+	if rf, ok := ret.Get(0).(func() es.BulkService); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(es.BulkService)
+		}
+	}
+
+	return r0
+}
+
+// ClusterHealth provides a mock function with given fields:
+func (_m *Client) ClusterHealth() es.ClusterHealthService {
+	ret := _m.Called()
+
+	var r0 es.ClusterHealthService
+	if rf, ok := ret.Get(0).(func() es.ClusterHealthService); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(es.ClusterHealthService)
+		}
+	}
+
+	return r0
+}
+
 // CreateIndex provides a mock function with given fields: index
 func (_m *Client) CreateIndex(index string) es.IndicesCreateService {
 	ret := _m.Called(index)
@@ -45,6 +77,28 @@ func (_m *Client) CreateIndex(index string) es.IndicesCreateService {
 	return r0
 }
 
+// DeleteByQuery provides a mock function with given fields: indices
+func (_m *Client) DeleteByQuery(indices ...string) es.DeleteByQueryService {
+	_va := make([]interface{}, len(indices))
+	for _i := range indices {
+		_va[_i] = indices[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 es.DeleteByQueryService
+	if rf, ok := ret.Get(0).(func(...string) es.DeleteByQueryService); ok {
+		r0 = rf(indices...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(es.DeleteByQueryService)
+		}
+	}
+
+	return r0
+}
+
 // Index provides a mock function with given fields:
 func (_m *Client) Index() es.IndexService {
 	ret := _m.Called()
@@ -0,0 +1,142 @@
+// Code generated by mockery v1.0.0
+
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package mocks
+
+import context "context"
+import elastic "github.com/olivere/elastic"
+import es "github.com/uber/jaeger/pkg/es"
+import mock "github.com/stretchr/testify/mock"
+
+// DeleteByQueryService is an autogenerated mock type for the DeleteByQueryService type
+type DeleteByQueryService struct {
+	mock.Mock
+}
+
+// Do provides a mock function with given fields: ctx
+func (_m *DeleteByQueryService) Do(ctx context.Context) (*elastic.BulkIndexByScrollResponse, error) {
+	ret := _m.Called(ctx)
+
+	var r0 *elastic.BulkIndexByScrollResponse
+	if rf, ok := ret.Get(0).(func(context.Context) *elastic.BulkIndexByScrollResponse); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*elastic.BulkIndexByScrollResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// IgnoreUnavailable provides a mock function with given fields: ignoreUnavailable
+func (_m *DeleteByQueryService) IgnoreUnavailable(ignoreUnavailable bool) es.DeleteByQueryService {
+	ret := _m.Called(ignoreUnavailable)
+
+	var r0 es.DeleteByQueryService
+	if rf, ok := ret.Get(0).(func(bool) es.DeleteByQueryService); ok {
+		r0 = rf(ignoreUnavailable)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(es.DeleteByQueryService)
+		}
+	}
+
+	return r0
+}
+
+// ProceedOnVersionConflict provides a mock function with given fields:
+func (_m *DeleteByQueryService) ProceedOnVersionConflict() es.DeleteByQueryService {
+	ret := _m.Called()
+
+	var r0 es.DeleteByQueryService
+	if rf, ok := ret.Get(0).(func() es.DeleteByQueryService); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(es.DeleteByQueryService)
+		}
+	}
+
+	return r0
+}
+
+// Query provides a mock function with given fields: query
+func (_m *DeleteByQueryService) Query(query elastic.Query) es.DeleteByQueryService {
+	ret := _m.Called(query)
+
+	var r0 es.DeleteByQueryService
+	if rf, ok := ret.Get(0).(func(elastic.Query) es.DeleteByQueryService); ok {
+		r0 = rf(query)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(es.DeleteByQueryService)
+		}
+	}
+
+	return r0
+}
+
+// RequestsPerSecond provides a mock function with given fields: requestsPerSecond
+func (_m *DeleteByQueryService) RequestsPerSecond(requestsPerSecond int) es.DeleteByQueryService {
+	ret := _m.Called(requestsPerSecond)
+
+	var r0 es.DeleteByQueryService
+	if rf, ok := ret.Get(0).(func(int) es.DeleteByQueryService); ok {
+		r0 = rf(requestsPerSecond)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(es.DeleteByQueryService)
+		}
+	}
+
+	return r0
+}
+
+// Type provides a mock function with given fields: typ
+func (_m *DeleteByQueryService) Type(typ ...string) es.DeleteByQueryService {
+	_va := make([]interface{}, len(typ))
+	for _i := range typ {
+		_va[_i] = typ[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 es.DeleteByQueryService
+	if rf, ok := ret.Get(0).(func(...string) es.DeleteByQueryService); ok {
+		r0 = rf(typ...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(es.DeleteByQueryService)
+		}
+	}
+
+	return r0
+}
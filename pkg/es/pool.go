@@ -0,0 +1,146 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package es
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+
+	jmetrics "github.com/uber/jaeger/pkg/metrics"
+)
+
+// PoolTransport is an http.RoundTripper reporting the pool metrics of its connections to ElasticSearch:
+// the connections serving a request until its response body is closed are active, the other open ones idle.
+// The wait time includes dialing new connections, whose failures are counted as acquisition failures.
+type PoolTransport struct {
+	// the atomic counters come first to be 64-bit aligned
+	open      int64
+	inUse     int64
+	transport *http.Transport
+	metrics   *jmetrics.PoolMetrics
+	reporter  *jmetrics.PoolReporter
+}
+
+// NewPoolTransport creates a PoolTransport keeping up to maxIdleConnsPerHost idle connections to each server,
+// the default of net/http if 0, and reporting in the given metrics factory until it is closed
+func NewPoolTransport(maxIdleConnsPerHost int, metricsFactory metrics.Factory) *PoolTransport {
+	t := &PoolTransport{metrics: jmetrics.NewPoolMetrics(metricsFactory)}
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	t.transport = &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, address)
+			if err != nil {
+				return nil, err
+			}
+			atomic.AddInt64(&t.open, 1)
+			return &poolConn{Conn: conn, transport: t}, nil
+		},
+		MaxIdleConnsPerHost: maxIdleConnsPerHost,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	t.reporter = jmetrics.NewPoolReporter(t.metrics, t.stats, jmetrics.DefaultPoolReportInterval)
+	return t
+}
+
+func (t *PoolTransport) stats() jmetrics.PoolStats {
+	inUse := atomic.LoadInt64(&t.inUse)
+	idle := atomic.LoadInt64(&t.open) - inUse
+	if idle < 0 {
+		// a connection is closed before the body of its last response
+		idle = 0
+	}
+	return jmetrics.PoolStats{Active: inUse, Idle: idle}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *PoolTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var (
+		getConn  time.Time
+		acquired int32
+	)
+	trace := &httptrace.ClientTrace{
+		GetConn: func(string) {
+			getConn = time.Now()
+		},
+		GotConn: func(httptrace.GotConnInfo) {
+			t.metrics.WaitTime.Record(time.Since(getConn))
+			atomic.AddInt64(&t.inUse, 1)
+			atomic.StoreInt32(&acquired, 1)
+		},
+	}
+	res, err := t.transport.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err != nil {
+		if atomic.LoadInt32(&acquired) == 1 {
+			atomic.AddInt64(&t.inUse, -1)
+		} else {
+			t.metrics.AcquisitionFailures.Inc(1)
+		}
+		return nil, err
+	}
+	if atomic.LoadInt32(&acquired) == 1 {
+		res.Body = &poolBody{ReadCloser: res.Body, transport: t}
+	}
+	return res, nil
+}
+
+// Close stops reporting the pool metrics and closes the idle connections
+func (t *PoolTransport) Close() error {
+	t.transport.CloseIdleConnections()
+	return t.reporter.Close()
+}
+
+// poolBody releases the connection of the response once closed
+type poolBody struct {
+	io.ReadCloser
+	transport *PoolTransport
+	closed    sync.Once
+}
+
+func (b *poolBody) Close() error {
+	b.closed.Do(func() {
+		atomic.AddInt64(&b.transport.inUse, -1)
+	})
+	return b.ReadCloser.Close()
+}
+
+// poolConn counts the open connections
+type poolConn struct {
+	net.Conn
+	transport *PoolTransport
+	closed    sync.Once
+}
+
+func (c *poolConn) Close() error {
+	c.closed.Do(func() {
+		atomic.AddInt64(&c.transport.open, -1)
+	})
+	return c.Conn.Close()
+}
@@ -53,6 +53,21 @@ func (c ESClient) Search(indices ...string) SearchService {
 	return WrapESSearchService(c.client.Search(indices...))
 }
 
+// Bulk calls this function to internal client.
+func (c ESClient) Bulk() BulkService {
+	return WrapESBulkService(c.client.Bulk())
+}
+
+// ClusterHealth calls this function to internal client.
+func (c ESClient) ClusterHealth() ClusterHealthService {
+	return WrapESClusterHealthService(c.client.ClusterHealth())
+}
+
+// DeleteByQuery calls this function to internal client.
+func (c ESClient) DeleteByQuery(indices ...string) DeleteByQueryService {
+	return WrapESDeleteByQueryService(c.client.DeleteByQuery(indices...))
+}
+
 // ---
 
 // ESIndicesCreateService is a wrapper around elastic.IndicesCreateService
@@ -153,3 +168,89 @@ func (s ESSearchService) Query(query elastic.Query) SearchService {
 func (s ESSearchService) Do(ctx context.Context) (*elastic.SearchResult, error) {
 	return s.searchService.Do(ctx)
 }
+
+// ---
+
+// ESBulkService is a wrapper around elastic.BulkService
+type ESBulkService struct {
+	bulkService *elastic.BulkService
+}
+
+// WrapESBulkService creates an ESBulkService out of *elastic.BulkService.
+func WrapESBulkService(bulkService *elastic.BulkService) ESBulkService {
+	return ESBulkService{bulkService: bulkService}
+}
+
+// Add calls this function to internal service.
+func (b ESBulkService) Add(requests ...elastic.BulkableRequest) BulkService {
+	return WrapESBulkService(b.bulkService.Add(requests...))
+}
+
+// NumberOfActions calls this function to internal service.
+func (b ESBulkService) NumberOfActions() int {
+	return b.bulkService.NumberOfActions()
+}
+
+// Do calls this function to internal service.
+func (b ESBulkService) Do(ctx context.Context) (*elastic.BulkResponse, error) {
+	return b.bulkService.Do(ctx)
+}
+
+// ---
+
+// ESClusterHealthService is a wrapper around elastic.ClusterHealthService
+type ESClusterHealthService struct {
+	clusterHealthService *elastic.ClusterHealthService
+}
+
+// WrapESClusterHealthService creates an ESClusterHealthService out of *elastic.ClusterHealthService.
+func WrapESClusterHealthService(clusterHealthService *elastic.ClusterHealthService) ESClusterHealthService {
+	return ESClusterHealthService{clusterHealthService: clusterHealthService}
+}
+
+// Do calls this function to internal service.
+func (h ESClusterHealthService) Do(ctx context.Context) (*elastic.ClusterHealthResponse, error) {
+	return h.clusterHealthService.Do(ctx)
+}
+
+// ---
+
+// ESDeleteByQueryService is a wrapper around elastic.DeleteByQueryService
+type ESDeleteByQueryService struct {
+	deleteByQueryService *elastic.DeleteByQueryService
+}
+
+// WrapESDeleteByQueryService creates an ESDeleteByQueryService out of *elastic.DeleteByQueryService.
+func WrapESDeleteByQueryService(deleteByQueryService *elastic.DeleteByQueryService) ESDeleteByQueryService {
+	return ESDeleteByQueryService{deleteByQueryService: deleteByQueryService}
+}
+
+// Type calls this function to internal service.
+func (d ESDeleteByQueryService) Type(typ ...string) DeleteByQueryService {
+	return WrapESDeleteByQueryService(d.deleteByQueryService.Type(typ...))
+}
+
+// Query calls this function to internal service.
+func (d ESDeleteByQueryService) Query(query elastic.Query) DeleteByQueryService {
+	return WrapESDeleteByQueryService(d.deleteByQueryService.Query(query))
+}
+
+// IgnoreUnavailable calls this function to internal service.
+func (d ESDeleteByQueryService) IgnoreUnavailable(ignoreUnavailable bool) DeleteByQueryService {
+	return WrapESDeleteByQueryService(d.deleteByQueryService.IgnoreUnavailable(ignoreUnavailable))
+}
+
+// ProceedOnVersionConflict calls this function to internal service.
+func (d ESDeleteByQueryService) ProceedOnVersionConflict() DeleteByQueryService {
+	return WrapESDeleteByQueryService(d.deleteByQueryService.ProceedOnVersionConflict())
+}
+
+// RequestsPerSecond calls this function to internal service.
+func (d ESDeleteByQueryService) RequestsPerSecond(requestsPerSecond int) DeleteByQueryService {
+	return WrapESDeleteByQueryService(d.deleteByQueryService.RequestsPerSecond(requestsPerSecond))
+}
+
+// Do calls this function to internal service.
+func (d ESDeleteByQueryService) Do(ctx context.Context) (*elastic.BulkIndexByScrollResponse, error) {
+	return d.deleteByQueryService.Do(ctx)
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+)
+
+// Configuration describes the configuration properties needed to produce spans to a Kafka cluster
+type Configuration struct {
+	Brokers []string
+	Topic   string
+}
+
+// NewProducer creates a new synchronous Kafka producer
+func (c *Configuration) NewProducer() (sarama.SyncProducer, error) {
+	if len(c.Brokers) < 1 {
+		return nil, errors.New("No brokers specified")
+	}
+	if c.Topic == "" {
+		return nil, errors.New("No topic specified")
+	}
+	return sarama.NewSyncProducer(c.Brokers, c.GetConfig())
+}
+
+// GetConfig creates the sarama config used to initialize the producer
+func (c *Configuration) GetConfig() *sarama.Config {
+	saramaConfig := sarama.NewConfig()
+	saramaConfig.Producer.RequiredAcks = sarama.WaitForLocal
+	// required by sarama.SyncProducer
+	saramaConfig.Producer.Return.Successes = true
+	return saramaConfig
+}
@@ -18,5 +18,6 @@
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
-// Package metrics provides command line flags for configuring the metrics backend.
+// Package metrics provides command line flags for configuring the metrics backend, and the
+// metrics factories reporting to Prometheus or to several backends at once.
 package metrics
@@ -0,0 +1,106 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+)
+
+// DefaultPoolReportInterval is how often the PoolStats of storage clients are reported
+const DefaultPoolReportInterval = 10 * time.Second
+
+// PoolStats is a snapshot of the connection pool of a storage client
+type PoolStats struct {
+	// Active is the number of connections in use
+	Active int64
+	// Idle is the number of open connections not in use, negative if the client does not expose it
+	Idle int64
+}
+
+// PoolMetrics are the metrics of the connection pool of a storage client. The gauges are updated periodically
+// by a PoolReporter, the wait times and the failures are recorded by the client as connections are acquired.
+type PoolMetrics struct {
+	Active metrics.Gauge `metric:"pool.active"`
+	Idle   metrics.Gauge `metric:"pool.idle"`
+	// WaitTime is the time spent acquiring a connection, including dialing a new one
+	WaitTime metrics.Timer `metric:"pool.wait-time"`
+	// AcquisitionFailures counts the requests that could not acquire a connection
+	AcquisitionFailures metrics.Counter `metric:"pool.acquisition-failures"`
+}
+
+// NewPoolMetrics creates the PoolMetrics in the given metrics factory
+func NewPoolMetrics(metricsFactory metrics.Factory) *PoolMetrics {
+	m := &PoolMetrics{}
+	metrics.Init(m, metricsFactory, nil)
+	return m
+}
+
+// PoolReporter updates the gauges of PoolMetrics with the PoolStats of a storage client every interval,
+// until it is closed
+type PoolReporter struct {
+	metrics *PoolMetrics
+	stats   func() PoolStats
+	stop    chan struct{}
+	done    sync.WaitGroup
+}
+
+// NewPoolReporter creates a PoolReporter and starts reporting
+func NewPoolReporter(poolMetrics *PoolMetrics, stats func() PoolStats, interval time.Duration) *PoolReporter {
+	r := &PoolReporter{
+		metrics: poolMetrics,
+		stats:   stats,
+		stop:    make(chan struct{}),
+	}
+	r.done.Add(1)
+	go func() {
+		defer r.done.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.Report()
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+	return r
+}
+
+// Report updates the gauges with the current stats
+func (r *PoolReporter) Report() {
+	stats := r.stats()
+	r.metrics.Active.Update(stats.Active)
+	if stats.Idle >= 0 {
+		r.metrics.Idle.Update(stats.Idle)
+	}
+}
+
+// Close stops reporting
+func (r *PoolReporter) Close() error {
+	close(r.stop)
+	r.done.Wait()
+	return nil
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-lib/metrics"
+)
+
+func TestPoolReporter(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	stats := PoolStats{Active: 3, Idle: 2}
+	reporter := NewPoolReporter(NewPoolMetrics(metricsFactory), func() PoolStats { return stats }, time.Hour)
+	defer reporter.Close()
+
+	reporter.Report()
+	_, gauges := metricsFactory.Snapshot()
+	assert.EqualValues(t, 3, gauges["pool.active"])
+	assert.EqualValues(t, 2, gauges["pool.idle"])
+
+	stats = PoolStats{Active: 5, Idle: -1}
+	reporter.Report()
+	_, gauges = metricsFactory.Snapshot()
+	assert.EqualValues(t, 5, gauges["pool.active"])
+	assert.EqualValues(t, 2, gauges["pool.idle"], "the idle connections are not reported if unknown")
+}
+
+func TestPoolReporterPeriodically(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	reported := make(chan struct{}, 1)
+	stats := func() PoolStats {
+		select {
+		case reported <- struct{}{}:
+		default:
+		}
+		return PoolStats{Active: 1}
+	}
+	reporter := NewPoolReporter(NewPoolMetrics(metricsFactory), stats, time.Millisecond)
+	select {
+	case <-reported:
+	case <-time.After(time.Second):
+		t.Fatal("the stats were not reported")
+	}
+	assert.NoError(t, reporter.Close())
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	kitprom "github.com/go-kit/kit/metrics/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/uber/jaeger-lib/metrics"
+	xkit "github.com/uber/jaeger-lib/metrics/go-kit"
+)
+
+// PrometheusFactory is a metrics.Factory of go-kit Prometheus metrics, adapted by the jaeger-lib go-kit
+// wrappers. Unlike with the go-kit factory of jaeger-lib, which registers each metric without labels in
+// the default registry, tags become labels and each metric is registered once in a registry of the
+// factory, so that metrics can be created for each service and do not clash with other factories.
+// Timers are histograms of durations in seconds.
+type PrometheusFactory struct {
+	registry  *prometheusRegistry
+	namespace string
+	tags      map[string]string
+}
+
+type prometheusRegistry struct {
+	sync.Mutex
+	registry   *prometheus.Registry
+	buckets    []float64
+	collectors map[string]prometheus.Collector
+}
+
+// NewPrometheusFactory creates a PrometheusFactory prefixing the names of its metrics with namespace.
+// The histograms of timers count observations into buckets, prometheus.DefBuckets if empty.
+func NewPrometheusFactory(namespace string, buckets []float64) *PrometheusFactory {
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+	return &PrometheusFactory{
+		registry: &prometheusRegistry{
+			registry:   prometheus.NewRegistry(),
+			buckets:    buckets,
+			collectors: make(map[string]prometheus.Collector),
+		},
+		namespace: namespace,
+	}
+}
+
+// Handler returns the handler serving the metrics of the factory, and of the factories derived from it
+// by Namespace, in the Prometheus exposition format.
+func (f *PrometheusFactory) Handler() http.Handler {
+	return promhttp.HandlerFor(f.registry.registry, promhttp.HandlerOpts{})
+}
+
+// Counter creates a Counter backed by a Prometheus counter.
+func (f *PrometheusFactory) Counter(name string, tags map[string]string) metrics.Counter {
+	name, labelNames, labelValues := f.nameAndLabels(name, tags)
+	collector, ok := f.registry.getOrRegister(name, labelNames, func() prometheus.Collector {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: name}, labelNames)
+	})
+	if !ok {
+		return metrics.NullCounter
+	}
+	return xkit.NewCounter(kitprom.NewCounter(collector.(*prometheus.CounterVec)).With(labelValues...))
+}
+
+// Gauge creates a Gauge backed by a Prometheus gauge.
+func (f *PrometheusFactory) Gauge(name string, tags map[string]string) metrics.Gauge {
+	name, labelNames, labelValues := f.nameAndLabels(name, tags)
+	collector, ok := f.registry.getOrRegister(name, labelNames, func() prometheus.Collector {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: name}, labelNames)
+	})
+	if !ok {
+		return metrics.NullGauge
+	}
+	return xkit.NewGauge(kitprom.NewGauge(collector.(*prometheus.GaugeVec)).With(labelValues...))
+}
+
+// Timer creates a Timer backed by a Prometheus histogram of seconds.
+func (f *PrometheusFactory) Timer(name string, tags map[string]string) metrics.Timer {
+	name, labelNames, labelValues := f.nameAndLabels(name, tags)
+	collector, ok := f.registry.getOrRegister(name, labelNames, func() prometheus.Collector {
+		return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    name,
+			Help:    name + " in seconds",
+			Buckets: f.registry.buckets,
+		}, labelNames)
+	})
+	if !ok {
+		return metrics.NullTimer
+	}
+	return xkit.NewTimer(kitprom.NewHistogram(collector.(*prometheus.HistogramVec)).With(labelValues...))
+}
+
+// Namespace returns a factory sharing the registry of this one, whose metrics names are
+// prefixed with the name and labelled with the tags of the namespace.
+func (f *PrometheusFactory) Namespace(name string, tags map[string]string) metrics.Factory {
+	return &PrometheusFactory{
+		registry:  f.registry,
+		namespace: f.subName(name),
+		tags:      f.mergeTags(tags),
+	}
+}
+
+func (f *PrometheusFactory) subName(name string) string {
+	if f.namespace == "" {
+		return name
+	}
+	if name == "" {
+		return f.namespace
+	}
+	return f.namespace + "." + name
+}
+
+func (f *PrometheusFactory) mergeTags(tags map[string]string) map[string]string {
+	merged := make(map[string]string, len(f.tags)+len(tags))
+	for k, v := range f.tags {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return merged
+}
+
+// nameAndLabels returns the sanitized name of a metric, the names of its labels sorted by name, and the
+// alternating names and values of its labels that go-kit metrics are given.
+func (f *PrometheusFactory) nameAndLabels(name string, tags map[string]string) (string, []string, []string) {
+	tags = f.mergeTags(tags)
+	labels := make(map[string]string, len(tags))
+	labelNames := make([]string, 0, len(tags))
+	for k, v := range tags {
+		k = sanitizePrometheusName(k, false)
+		if _, ok := labels[k]; !ok {
+			labelNames = append(labelNames, k)
+		}
+		labels[k] = v
+	}
+	sort.Strings(labelNames)
+	labelValues := make([]string, 0, 2*len(labelNames))
+	for _, k := range labelNames {
+		labelValues = append(labelValues, k, labels[k])
+	}
+	return sanitizePrometheusName(f.subName(name), true), labelNames, labelValues
+}
+
+// getOrRegister returns the collector of the metric with the name and label names, registering the one
+// returned by newCollector if there is none yet. It returns false if the metric cannot be registered,
+// e.g. because a metric with the same name but other label names already exists.
+func (r *prometheusRegistry) getOrRegister(
+	name string,
+	labelNames []string,
+	newCollector func() prometheus.Collector,
+) (prometheus.Collector, bool) {
+	key := name + "|" + strings.Join(labelNames, ",")
+	r.Lock()
+	defer r.Unlock()
+	if collector, ok := r.collectors[key]; ok {
+		return collector, true
+	}
+	collector := newCollector()
+	if err := r.registry.Register(collector); err != nil {
+		return nil, false
+	}
+	r.collectors[key] = collector
+	return collector, true
+}
+
+// sanitizePrometheusName replaces the characters not allowed in Prometheus metric names, or label
+// names if metricName is false, with underscores, e.g. the dots and dashes of Jaeger metric names.
+// Names cannot start with a digit, which is preceded by an underscore.
+func sanitizePrometheusName(name string, metricName bool) string {
+	sanitized := []byte(name)
+	for i, c := range sanitized {
+		allowed := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
+			(c >= '0' && c <= '9') || (c == ':' && metricName)
+		if !allowed {
+			sanitized[i] = '_'
+		}
+	}
+	if len(sanitized) > 0 && sanitized[0] >= '0' && sanitized[0] <= '9' {
+		return "_" + string(sanitized)
+	}
+	return string(sanitized)
+}
+
+// ParseBuckets parses a comma-separated list of histogram buckets in seconds, which must be increasing.
+// It returns nil for an empty list, so that the default buckets are used.
+func ParseBuckets(list string) ([]float64, error) {
+	if list == "" {
+		return nil, nil
+	}
+	var buckets []float64
+	for _, s := range strings.Split(list, ",") {
+		bucket, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid histogram bucket %q", s)
+		}
+		if len(buckets) > 0 && bucket <= buckets[len(buckets)-1] {
+			return nil, fmt.Errorf("Histogram buckets must be increasing, found %v after %v", bucket, buckets[len(buckets)-1])
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+)
+
+func scrape(t *testing.T, f *PrometheusFactory) string {
+	w := httptest.NewRecorder()
+	f.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, 200, w.Code)
+	return w.Body.String()
+}
+
+func TestPrometheusFactory(t *testing.T) {
+	f := NewPrometheusFactory("jaeger-collector", []float64{0.1, 1})
+	service := f.Namespace("service", map[string]string{"host": "h1"})
+	service.Counter("spans.received", map[string]string{"svc": "frontend"}).Inc(2)
+	service.Counter("spans.received", map[string]string{"svc": "frontend"}).Inc(1)
+	service.Counter("spans.received", map[string]string{"svc": "backend"}).Inc(1)
+	f.Gauge("queue-length", nil).Update(7)
+	f.Timer("save-latency", nil).Record(500 * time.Millisecond)
+
+	output := scrape(t, f)
+	assert.Contains(t, output, `jaeger_collector_service_spans_received{host="h1",svc="frontend"} 3`)
+	assert.Contains(t, output, `jaeger_collector_service_spans_received{host="h1",svc="backend"} 1`)
+	assert.Contains(t, output, `jaeger_collector_queue_length 7`)
+	assert.Contains(t, output, `jaeger_collector_save_latency_bucket{le="0.1"} 0`)
+	assert.Contains(t, output, `jaeger_collector_save_latency_bucket{le="1"} 1`)
+	assert.Contains(t, output, `jaeger_collector_save_latency_sum 0.5`)
+}
+
+func TestPrometheusFactoryConflictingLabels(t *testing.T) {
+	f := NewPrometheusFactory("", nil)
+	f.Counter("requests", map[string]string{"a": "1"}).Inc(1)
+	counter := f.Counter("requests", map[string]string{"b": "1"})
+	assert.Equal(t, metrics.NullCounter, counter)
+	assert.Equal(t, metrics.NullGauge, f.Gauge("requests", nil))
+	assert.Equal(t, metrics.NullTimer, f.Timer("requests", nil))
+	assert.Contains(t, scrape(t, f), `requests{a="1"} 1`)
+}
+
+func TestPrometheusFactoriesDoNotShareRegistries(t *testing.T) {
+	NewPrometheusFactory("", nil).Counter("requests", nil).Inc(1)
+	f := NewPrometheusFactory("", nil)
+	f.Counter("requests", nil).Inc(2)
+	assert.Contains(t, scrape(t, f), "requests 2")
+}
+
+func TestSanitizePrometheusName(t *testing.T) {
+	assert.Equal(t, "jaeger_collector_spans_received", sanitizePrometheusName("jaeger-collector.spans.received", true))
+	assert.Equal(t, "a:b", sanitizePrometheusName("a:b", true))
+	assert.Equal(t, "a_b", sanitizePrometheusName("a:b", false))
+	assert.Equal(t, "_3xx", sanitizePrometheusName("3xx", false))
+}
+
+func TestParseBuckets(t *testing.T) {
+	buckets, err := ParseBuckets("0.005, 0.1,1,10")
+	require.NoError(t, err)
+	assert.Equal(t, []float64{0.005, 0.1, 1, 10}, buckets)
+
+	buckets, err = ParseBuckets("")
+	require.NoError(t, err)
+	assert.Nil(t, buckets)
+
+	_, err = ParseBuckets("0.1,x")
+	assert.EqualError(t, err, `Invalid histogram bucket "x"`)
+
+	_, err = ParseBuckets("1,0.1")
+	assert.EqualError(t, err, "Histogram buckets must be increasing, found 0.1 after 1")
+}
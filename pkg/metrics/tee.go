@@ -0,0 +1,91 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+)
+
+// NewTeeFactory returns a metrics.Factory reporting every metric to all the given factories,
+// e.g. to expose the same metrics through expvar and Prometheus.
+func NewTeeFactory(factories ...metrics.Factory) metrics.Factory {
+	return teeFactory(factories)
+}
+
+type teeFactory []metrics.Factory
+
+func (t teeFactory) Counter(name string, tags map[string]string) metrics.Counter {
+	counters := make(teeCounter, len(t))
+	for i, f := range t {
+		counters[i] = f.Counter(name, tags)
+	}
+	return counters
+}
+
+func (t teeFactory) Gauge(name string, tags map[string]string) metrics.Gauge {
+	gauges := make(teeGauge, len(t))
+	for i, f := range t {
+		gauges[i] = f.Gauge(name, tags)
+	}
+	return gauges
+}
+
+func (t teeFactory) Timer(name string, tags map[string]string) metrics.Timer {
+	timers := make(teeTimer, len(t))
+	for i, f := range t {
+		timers[i] = f.Timer(name, tags)
+	}
+	return timers
+}
+
+func (t teeFactory) Namespace(name string, tags map[string]string) metrics.Factory {
+	factories := make(teeFactory, len(t))
+	for i, f := range t {
+		factories[i] = f.Namespace(name, tags)
+	}
+	return factories
+}
+
+type teeCounter []metrics.Counter
+
+func (t teeCounter) Inc(delta int64) {
+	for _, c := range t {
+		c.Inc(delta)
+	}
+}
+
+type teeGauge []metrics.Gauge
+
+func (t teeGauge) Update(value int64) {
+	for _, g := range t {
+		g.Update(value)
+	}
+}
+
+type teeTimer []metrics.Timer
+
+func (t teeTimer) Record(d time.Duration) {
+	for _, timer := range t {
+		timer.Record(d)
+	}
+}
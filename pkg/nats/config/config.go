@@ -0,0 +1,141 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// Handler consumes the data of a message, header returning the first value of its header of the given key
+// regardless of its case, then calls ack once with whether the message was processed, the messages not processed being redelivered
+type Handler func(data []byte, header func(key string) string, ack func(processed bool) error)
+
+// Configuration describes the JetStream subscription collectors consume span batches from
+type Configuration struct {
+	Servers []string
+	Subject string
+	// Queue is the queue group of the collectors, each message being delivered to one collector of the group
+	Queue string
+	// Durable is the name of the JetStream consumer, which keeps track of the acknowledged messages
+	// while the collectors restart
+	Durable string
+	// AckWait is the time a delivered message can stay unacknowledged before it is redelivered
+	AckWait time.Duration
+	// MaxAckPending bounds the messages delivered but not acknowledged yet, so that a slow storage
+	// holds the consumption back
+	MaxAckPending int
+	Username      string
+	Password      string
+	// CredentialsFile is the file of the user JWT and NKey seed, for the servers with decentralized authentication
+	CredentialsFile string
+}
+
+// Subscribe connects to the NATS servers and subscribes to the subject of the stream, handler acknowledging
+// the messages. Closing the returned closer closes the connection, keeping the durable consumer so that
+// the messages not acknowledged yet are redelivered.
+func (c *Configuration) Subscribe(handler Handler) (io.Closer, error) {
+	if len(c.Servers) < 1 {
+		return nil, errors.New("No NATS servers specified")
+	}
+	if c.Subject == "" {
+		return nil, errors.New("No NATS subject specified")
+	}
+	conn, err := nats.Connect(strings.Join(c.Servers, ","), c.connectOptions()...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to connect to NATS")
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "Failed to create the JetStream context")
+	}
+	msgHandler := func(msg *nats.Msg) {
+		handler(msg.Data, headerValue(msg.Header), func(processed bool) error {
+			if processed {
+				return msg.Ack()
+			}
+			return msg.Nak()
+		})
+	}
+	if c.Queue != "" {
+		_, err = js.QueueSubscribe(c.Subject, c.Queue, msgHandler, c.subscribeOptions()...)
+	} else {
+		_, err = js.Subscribe(c.Subject, msgHandler, c.subscribeOptions()...)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrapf(err, "Failed to subscribe to NATS subject %s", c.Subject)
+	}
+	return connCloser{conn}, nil
+}
+
+func (c *Configuration) connectOptions() []nats.Option {
+	options := []nats.Option{nats.Name("jaeger-collector"), nats.MaxReconnects(-1)}
+	if c.Username != "" {
+		options = append(options, nats.UserInfo(c.Username, c.Password))
+	}
+	if c.CredentialsFile != "" {
+		options = append(options, nats.UserCredentials(c.CredentialsFile))
+	}
+	return options
+}
+
+func (c *Configuration) subscribeOptions() []nats.SubOpt {
+	options := []nats.SubOpt{nats.ManualAck()}
+	if c.Durable != "" {
+		options = append(options, nats.Durable(c.Durable))
+	}
+	if c.AckWait > 0 {
+		options = append(options, nats.AckWait(c.AckWait))
+	}
+	if c.MaxAckPending > 0 {
+		options = append(options, nats.MaxAckPending(c.MaxAckPending))
+	}
+	return options
+}
+
+// headerValue returns the first value of the header of the given key, ignoring the case of the key as the
+// HTTP headers do, while the NATS headers are case-sensitive
+func headerValue(header nats.Header) func(key string) string {
+	return func(key string) string {
+		for k, values := range header {
+			if strings.EqualFold(k, key) && len(values) > 0 {
+				return values[0]
+			}
+		}
+		return ""
+	}
+}
+
+// connCloser closes the connection without unsubscribing, which would delete the durable consumer
+type connCloser struct {
+	conn *nats.Conn
+}
+
+func (c connCloser) Close() error {
+	c.conn.Close()
+	return nil
+}
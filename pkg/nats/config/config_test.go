@@ -0,0 +1,62 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribeInvalidConfiguration(t *testing.T) {
+	handler := func([]byte, func(string) string, func(bool) error) {}
+	_, err := (&Configuration{Subject: "spans"}).Subscribe(handler)
+	assert.EqualError(t, err, "No NATS servers specified")
+	_, err = (&Configuration{Servers: []string{"nats://127.0.0.1:4222"}}).Subscribe(handler)
+	assert.EqualError(t, err, "No NATS subject specified")
+}
+
+func TestOptions(t *testing.T) {
+	c := &Configuration{}
+	assert.Len(t, c.connectOptions(), 2)
+	assert.Len(t, c.subscribeOptions(), 1, "manual acknowledgements only")
+
+	c = &Configuration{
+		Username:        "jaeger",
+		Password:        "secret",
+		CredentialsFile: "/etc/nats/jaeger.creds",
+		Durable:         "jaeger-collector",
+		AckWait:         time.Minute,
+		MaxAckPending:   100,
+	}
+	assert.Len(t, c.connectOptions(), 4)
+	assert.Len(t, c.subscribeOptions(), 4)
+}
+
+func TestHeaderValue(t *testing.T) {
+	header := headerValue(nats.Header{"Authorization": []string{"Bearer token", "other"}, "X-Tenant": nil})
+	assert.Equal(t, "Bearer token", header("authorization"))
+	assert.Equal(t, "", header("x-tenant"))
+	assert.Equal(t, "", header("missing"))
+	assert.Equal(t, "", headerValue(nil)("authorization"))
+}
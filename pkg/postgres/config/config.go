@@ -0,0 +1,63 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"database/sql"
+	"time"
+
+	// registers the postgres driver used by NewDB
+	_ "github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// Configuration describes the configuration properties needed to connect to a PostgreSQL database
+type Configuration struct {
+	DSN             string
+	MaxOpenConns    int           // unlimited if 0
+	MaxIdleConns    int           // the database/sql default is used if 0
+	ConnMaxLifetime time.Duration // connections are reused forever if 0
+}
+
+// NewDB opens a pool of connections to the configured database and checks that it is reachable
+func (c *Configuration) NewDB() (*sql.DB, error) {
+	if c.DSN == "" {
+		return nil, errors.New("No DSN specified")
+	}
+	db, err := sql.Open("postgres", c.DSN)
+	if err != nil {
+		return nil, err
+	}
+	c.configurePool(db)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "Unable to connect to PostgreSQL")
+	}
+	return db, nil
+}
+
+func (c *Configuration) configurePool(db *sql.DB) {
+	db.SetMaxOpenConns(c.MaxOpenConns)
+	if c.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(c.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(c.ConnMaxLifetime)
+}
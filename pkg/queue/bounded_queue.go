@@ -21,6 +21,7 @@
 package queue
 
 import (
+	"context"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -28,6 +29,8 @@ import (
 	"github.com/uber/jaeger-lib/metrics"
 )
 
+const drainPollInterval = 10 * time.Millisecond
+
 // BoundedQueue implements a producer-consumer exchange similar to a ring buffer queue,
 // where the queue is bounded and if it fills up due to slow consumers, the new items written by
 // the producer force the earliest items to be dropped. The implementation is actually based on
@@ -35,12 +38,18 @@ import (
 // the items from the top of the queue until its size drops back to maxSize
 type BoundedQueue struct {
 	capacity      int
-	size          int32
 	onDroppedItem func(item interface{})
 	items         chan interface{}
 	stopCh        chan struct{}
 	stopWG        sync.WaitGroup
-	stopped       int32
+	// stopLock is held for reading while producing, so that the items channel is not closed under a send
+	stopLock     sync.RWMutex
+	stopped      int32
+	consumer     func(item interface{})
+	consumersMux sync.Mutex
+	// consumers holds the channel closed to stop each running consumer
+	consumers []chan struct{}
+	busy      int32
 }
 
 // NewBoundedQueue constructs the new queue of specified capacity, and with an optional
@@ -57,8 +66,36 @@ func NewBoundedQueue(capacity int, onDroppedItem func(item interface{})) *Bounde
 // StartConsumers starts a given number of goroutines consuming items from the queue
 // and passing them into the consumer callback.
 func (q *BoundedQueue) StartConsumers(num int, consumer func(item interface{})) {
+	q.consumersMux.Lock()
+	defer q.consumersMux.Unlock()
+	q.consumer = consumer
+	q.startConsumers(num)
+}
+
+// Resize starts or stops consumers until num of them consume the items from the queue, the stopped
+// ones finishing the item they are consuming. It does nothing before StartConsumers or after Stop.
+func (q *BoundedQueue) Resize(num int) {
+	q.consumersMux.Lock()
+	defer q.consumersMux.Unlock()
+	if q.consumer == nil || atomic.LoadInt32(&q.stopped) != 0 {
+		return
+	}
+	if num > len(q.consumers) {
+		q.startConsumers(num - len(q.consumers))
+		return
+	}
+	for _, quit := range q.consumers[num:] {
+		close(quit)
+	}
+	q.consumers = q.consumers[:num]
+}
+
+// startConsumers must be called with consumersMux held
+func (q *BoundedQueue) startConsumers(num int) {
 	var startWG sync.WaitGroup
 	for i := 0; i < num; i++ {
+		quit := make(chan struct{})
+		q.consumers = append(q.consumers, quit)
 		q.stopWG.Add(1)
 		startWG.Add(1)
 		go func() {
@@ -67,8 +104,11 @@ func (q *BoundedQueue) StartConsumers(num int, consumer func(item interface{}))
 			for {
 				select {
 				case item := <-q.items:
-					atomic.AddInt32(&q.size, -1)
-					consumer(item)
+					atomic.AddInt32(&q.busy, 1)
+					q.consumer(item)
+					atomic.AddInt32(&q.busy, -1)
+				case <-quit:
+					return
 				case <-q.stopCh:
 					return
 				}
@@ -78,15 +118,31 @@ func (q *BoundedQueue) StartConsumers(num int, consumer func(item interface{}))
 	startWG.Wait()
 }
 
+// Consumers returns the number of consumers running
+func (q *BoundedQueue) Consumers() int {
+	q.consumersMux.Lock()
+	defer q.consumersMux.Unlock()
+	return len(q.consumers)
+}
+
+// BusyConsumers returns the number of consumers passing an item into the consumer callback, which can
+// briefly include consumers stopped by Resize
+func (q *BoundedQueue) BusyConsumers() int {
+	return int(atomic.LoadInt32(&q.busy))
+}
+
 // Produce is used by the producer to submit new item to the queue. Returns false in case of queue overflow.
 func (q *BoundedQueue) Produce(item interface{}) bool {
+	q.stopLock.RLock()
+	defer q.stopLock.RUnlock()
 	if atomic.LoadInt32(&q.stopped) != 0 {
-		q.onDroppedItem(item)
+		if q.onDroppedItem != nil {
+			q.onDroppedItem(item)
+		}
 		return false
 	}
 	select {
 	case q.items <- item:
-		atomic.AddInt32(&q.size, 1)
 		return true
 	default:
 		if q.onDroppedItem != nil {
@@ -99,15 +155,55 @@ func (q *BoundedQueue) Produce(item interface{}) bool {
 // Stop stops all consumers, as well as the length reporter if started,
 // and releases the items channel. It blocks until all consumers have stopped.
 func (q *BoundedQueue) Stop() {
-	atomic.StoreInt32(&q.stopped, 1) // disable producer
+	// under the lock so that no consumer is started by Resize past this point
+	q.consumersMux.Lock()
+	q.disableProducer()
 	close(q.stopCh)
+	q.consumersMux.Unlock()
 	q.stopWG.Wait()
 	close(q.items)
 }
 
-// Size returns the current size of the queue
+// Drain disables the producer and lets the consumers empty the queue until it is empty or the
+// context is done, then stops the queue. The items left in the queue are passed to the dropped
+// item callback, and their number is returned.
+func (q *BoundedQueue) Drain(ctx context.Context) int {
+	q.disableProducer()
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for q.Size() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return q.stopAndDrop()
+		}
+	}
+	return q.stopAndDrop()
+}
+
+// disableProducer waits for the items being produced to be sent, so that no item is produced once it returns
+func (q *BoundedQueue) disableProducer() {
+	q.stopLock.Lock()
+	atomic.StoreInt32(&q.stopped, 1)
+	q.stopLock.Unlock()
+}
+
+func (q *BoundedQueue) stopAndDrop() int {
+	q.Stop()
+	dropped := 0
+	for item := range q.items {
+		dropped++
+		if q.onDroppedItem != nil {
+			q.onDroppedItem(item)
+		}
+	}
+	return dropped
+}
+
+// Size returns the current size of the queue, the number of items in its channel, which is exact with
+// concurrent producers and consumers, unlike a counter updated after the items are sent or received
 func (q *BoundedQueue) Size() int {
-	return int(atomic.LoadInt32(&q.size))
+	return len(q.items)
 }
 
 // Capacity returns capacity of the queue
@@ -115,17 +211,61 @@ func (q *BoundedQueue) Capacity() int {
 	return q.capacity
 }
 
+// Utilization returns the fraction of the capacity of the queue used by the queued items, between 0 and 1
+func (q *BoundedQueue) Utilization() float64 {
+	if q.capacity == 0 {
+		return 1
+	}
+	return float64(q.Size()) / float64(q.capacity)
+}
+
 // StartLengthReporting starts a timer-based gorouting that periodically reports
 // current queue length to a given metrics gauge.
 func (q *BoundedQueue) StartLengthReporting(reportPeriod time.Duration, gauge metrics.Gauge) {
+	q.startReporting(reportPeriod, func() {
+		gauge.Update(int64(q.Size()))
+	})
+}
+
+// StartUtilizationReporting starts a timer-based goroutine that periodically reports
+// the current utilization of the queue, as a percentage of its capacity, to a given metrics gauge.
+func (q *BoundedQueue) StartUtilizationReporting(reportPeriod time.Duration, gauge metrics.Gauge) {
+	q.startReporting(reportPeriod, func() {
+		gauge.Update(int64(q.Utilization() * 100))
+	})
+}
+
+// StartCapacityReporting reports the capacity of the queue to a given metrics gauge, once and then periodically,
+// so that the length of the queue can be compared to it by the metrics backends
+func (q *BoundedQueue) StartCapacityReporting(reportPeriod time.Duration, gauge metrics.Gauge) {
+	gauge.Update(int64(q.capacity))
+	q.startReporting(reportPeriod, func() {
+		gauge.Update(int64(q.capacity))
+	})
+}
+
+// StartConsumersReporting starts a timer-based goroutine that periodically reports the number of
+// consumers busy with an item and of the idle ones waiting for items to the given metrics gauges.
+func (q *BoundedQueue) StartConsumersReporting(reportPeriod time.Duration, busyGauge, idleGauge metrics.Gauge) {
+	q.startReporting(reportPeriod, func() {
+		busy := q.BusyConsumers()
+		idle := q.Consumers() - busy
+		if idle < 0 {
+			idle = 0
+		}
+		busyGauge.Update(int64(busy))
+		idleGauge.Update(int64(idle))
+	})
+}
+
+func (q *BoundedQueue) startReporting(reportPeriod time.Duration, report func()) {
 	ticker := time.NewTicker(reportPeriod)
 	go func() {
 		defer ticker.Stop()
 		for {
 			select {
 			case <-ticker.C:
-				size := q.Size()
-				gauge.Update(int64(size))
+				report()
 			case <-q.stopCh:
 				return
 			}
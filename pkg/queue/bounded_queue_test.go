@@ -21,6 +21,7 @@
 package queue
 
 import (
+	"context"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -112,6 +113,157 @@ func TestBoundedQueue(t *testing.T) {
 	assert.False(t, q.Produce("x"), "cannot push to closed queue")
 }
 
+func TestBoundedQueueDrain(t *testing.T) {
+	var dropped int32
+	q := NewBoundedQueue(10, func(item interface{}) {
+		atomic.AddInt32(&dropped, 1)
+	})
+	var consumed int32
+	q.StartConsumers(1, func(item interface{}) {
+		atomic.AddInt32(&consumed, 1)
+	})
+	for i := 0; i < 5; i++ {
+		require.True(t, q.Produce(i))
+	}
+
+	assert.Equal(t, 0, q.Drain(context.Background()))
+	assert.EqualValues(t, 5, atomic.LoadInt32(&consumed))
+	assert.False(t, q.Produce("x"), "cannot push to drained queue")
+	assert.EqualValues(t, 1, atomic.LoadInt32(&dropped))
+}
+
+func TestBoundedQueueProduceWhileStopping(t *testing.T) {
+	q := NewBoundedQueue(100, nil)
+	q.StartConsumers(1, func(item interface{}) {})
+	var producers sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		producers.Add(1)
+		go func() {
+			defer producers.Done()
+			for j := 0; j < 1000; j++ {
+				q.Produce(j) // must not send on the closed items channel
+			}
+		}()
+	}
+	q.Drain(context.Background())
+	producers.Wait()
+	assert.False(t, q.Produce("x"))
+}
+
+func TestBoundedQueueUtilization(t *testing.T) {
+	mFact := metrics.NewLocalFactory(0)
+	gauge := mFact.Gauge("utilization", nil)
+	q := NewBoundedQueue(4, func(item interface{}) {})
+	defer q.Stop()
+	assert.Equal(t, 0.0, q.Utilization())
+	require.True(t, q.Produce("a"))
+	assert.Equal(t, 0.25, q.Utilization())
+
+	q.StartUtilizationReporting(time.Millisecond, gauge)
+	for i := 0; i < 1000; i++ {
+		_, g := mFact.Snapshot()
+		if g["utilization"] == 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	_, g := mFact.Snapshot()
+	assert.EqualValues(t, 25, g["utilization"])
+}
+
+func TestBoundedQueueCapacityReporting(t *testing.T) {
+	mFact := metrics.NewLocalFactory(0)
+	q := NewBoundedQueue(4, func(item interface{}) {})
+	defer q.Stop()
+
+	q.StartCapacityReporting(time.Hour, mFact.Gauge("capacity", nil))
+	_, g := mFact.Snapshot()
+	assert.EqualValues(t, 4, g["capacity"], "reported before the first period")
+}
+
+func TestBoundedQueueConcurrentProducers(t *testing.T) {
+	q := NewBoundedQueue(100, func(item interface{}) {})
+	var blockLock sync.Mutex
+	blockLock.Lock()
+	var sizes sync.WaitGroup
+	sizes.Add(1)
+	var invalid int32
+	go func() {
+		defer sizes.Done()
+		for i := 0; i < 1000; i++ {
+			if size := q.Size(); size < 0 || size > q.Capacity() {
+				atomic.AddInt32(&invalid, 1)
+			}
+		}
+	}()
+	received := make(chan struct{}, 1)
+	q.StartConsumers(1, func(item interface{}) {
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+		blockLock.Lock()
+		blockLock.Unlock()
+	})
+	require.True(t, q.Produce("a"))
+	<-received
+
+	var producers sync.WaitGroup
+	var produced int32
+	for i := 0; i < 10; i++ {
+		producers.Add(1)
+		go func() {
+			defer producers.Done()
+			for j := 0; j < 50; j++ {
+				if q.Produce(j) {
+					atomic.AddInt32(&produced, 1)
+				}
+			}
+		}()
+	}
+	producers.Wait()
+	sizes.Wait()
+
+	// the consumer is blocked on the first item, the queue is filled by the producers
+	assert.EqualValues(t, q.Capacity(), atomic.LoadInt32(&produced))
+	assert.Equal(t, q.Capacity(), q.Size())
+	assert.EqualValues(t, 0, atomic.LoadInt32(&invalid))
+	blockLock.Unlock()
+	q.Drain(context.Background())
+	assert.Equal(t, 0, q.Size())
+}
+
+func TestBoundedQueueDrainDeadline(t *testing.T) {
+	var dropped int32
+	q := NewBoundedQueue(10, func(item interface{}) {
+		atomic.AddInt32(&dropped, 1)
+	})
+	var blockLock sync.Mutex
+	blockLock.Lock()
+	consumerState := newConsumerState(t)
+	q.StartConsumers(1, func(item interface{}) {
+		consumerState.record(item.(string))
+		blockLock.Lock()
+		blockLock.Unlock()
+	})
+	require.True(t, q.Produce("a"))
+	consumerState.waitToConsumeOnce()
+	require.True(t, q.Produce("b"))
+	require.True(t, q.Produce("c"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		blockLock.Unlock() // let the consumer stop once the deadline has passed
+	}()
+	left := q.Drain(ctx)
+	assert.Error(t, ctx.Err(), "drain must wait for the deadline while the consumer is blocked")
+	// once stopping, the consumer may still pick some of the remaining items
+	assert.EqualValues(t, left, atomic.LoadInt32(&dropped))
+	assert.Equal(t, 3, len(consumerState.snapshot())+left)
+	assert.Equal(t, 0, q.Size())
+}
+
 type consumerState struct {
 	sync.Mutex
 	t            *testing.T
@@ -160,3 +312,65 @@ func (s *consumerState) assertConsumed(expected map[string]bool) {
 	}
 	assert.Equal(s.t, expected, s.snapshot())
 }
+
+func TestBoundedQueueResize(t *testing.T) {
+	q := NewBoundedQueue(10, func(item interface{}) {})
+	q.Resize(2)
+	assert.Equal(t, 0, q.Consumers(), "not resized before the consumers are started")
+
+	release := make(chan struct{})
+	received := make(chan struct{}, 10)
+	q.StartConsumers(1, func(item interface{}) {
+		received <- struct{}{}
+		<-release
+	})
+	assert.Equal(t, 1, q.Consumers())
+
+	q.Resize(3)
+	assert.Equal(t, 3, q.Consumers())
+	for i := 0; i < 3; i++ {
+		require.True(t, q.Produce(i))
+	}
+	for i := 0; i < 3; i++ {
+		<-received
+	}
+	assert.Equal(t, 3, q.BusyConsumers())
+
+	q.Resize(1)
+	assert.Equal(t, 1, q.Consumers())
+	close(release)
+	for i := 0; i < 1000 && q.BusyConsumers() > 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 0, q.BusyConsumers())
+
+	q.Stop()
+	q.Resize(2)
+	assert.Equal(t, 1, q.Consumers(), "not resized after stop")
+}
+
+func TestBoundedQueueConsumersReporting(t *testing.T) {
+	mFact := metrics.NewLocalFactory(0)
+	q := NewBoundedQueue(10, func(item interface{}) {})
+	defer q.Stop()
+	release := make(chan struct{})
+	defer close(release)
+	received := make(chan struct{}, 1)
+	q.StartConsumers(3, func(item interface{}) {
+		received <- struct{}{}
+		<-release
+	})
+	require.True(t, q.Produce("a"))
+	<-received
+
+	q.StartConsumersReporting(time.Millisecond, mFact.Gauge("busy", nil), mFact.Gauge("idle", nil))
+	for i := 0; i < 1000; i++ {
+		_, g := mFact.Snapshot()
+		if g["idle"] == 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	_, g := mFact.Snapshot()
+	assert.EqualValues(t, 1, g["busy"])
+	assert.EqualValues(t, 2, g["idle"])
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// cipherSuites are the cipher suites that can be configured by name, RC4 being left out as insecure
+var cipherSuites = map[string]uint16{
+	"TLS_RSA_WITH_3DES_EDE_CBC_SHA":           tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+	"TLS_RSA_WITH_AES_128_CBC_SHA":            tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_RSA_WITH_AES_256_CBC_SHA":            tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_RSA_WITH_AES_128_GCM_SHA256":         tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_RSA_WITH_AES_256_GCM_SHA384":         tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA":    tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA":    tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA":     tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA":      tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA":      tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256":   tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256": tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384":   tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384": tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+}
+
+// versions are the TLS versions that can be configured as the minimum version
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+}
+
+// Configuration describes the TLS of a server
+type Configuration struct {
+	// CertPath is the PEM certificate file of the server
+	CertPath string
+	// KeyPath is the PEM private key file of the certificate
+	KeyPath string
+	// ClientCAPath is the PEM CA certificates file verifying the client certificates, which are not
+	// requested if empty
+	ClientCAPath string
+	// RequireClientCert rejects the clients without a certificate verified by ClientCAPath, the clients without
+	// a certificate being accepted otherwise
+	RequireClientCert bool
+	// CipherSuites are the names of the cipher suites accepted by the server, e.g.
+	// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, the Go defaults if empty
+	CipherSuites []string
+	// MinVersion is the minimum TLS version accepted by the server, 1.0, 1.1 or 1.2, the Go default if empty
+	MinVersion string
+	// ReloadInterval is how often the certificate and key files are checked for changes, to serve the new
+	// certificate without a restart, never if 0
+	ReloadInterval time.Duration
+}
+
+// NewServerConfig loads the certificate and returns the tls.Config of the server. Closing the returned closer
+// stops the reloading of the certificate.
+func (c *Configuration) NewServerConfig(logger *zap.Logger) (*tls.Config, io.Closer, error) {
+	if c.CertPath == "" || c.KeyPath == "" {
+		return nil, nil, errors.New("No TLS certificate or key specified")
+	}
+	if c.RequireClientCert && c.ClientCAPath == "" {
+		return nil, nil, errors.New("No TLS client CA specified to verify the required client certificates")
+	}
+	config := &tls.Config{}
+	if c.MinVersion != "" {
+		version, ok := versions[c.MinVersion]
+		if !ok {
+			return nil, nil, fmt.Errorf("Unknown TLS version %q", c.MinVersion)
+		}
+		config.MinVersion = version
+	}
+	for _, name := range c.CipherSuites {
+		suite, ok := cipherSuites[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("Unknown TLS cipher suite %q", name)
+		}
+		config.CipherSuites = append(config.CipherSuites, suite)
+	}
+	if c.ClientCAPath != "" {
+		clientCAs, err := loadCertPool(c.ClientCAPath)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "Failed to load the TLS client CA")
+		}
+		config.ClientCAs = clientCAs
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		if c.RequireClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	reloader := &certReloader{certPath: c.CertPath, keyPath: c.KeyPath, logger: logger, stopCh: make(chan struct{})}
+	if _, err := reloader.reload(); err != nil {
+		return nil, nil, errors.Wrap(err, "Failed to load the TLS certificate")
+	}
+	config.GetCertificate = reloader.getCertificate
+	if c.ReloadInterval > 0 {
+		reloader.start(c.ReloadInterval)
+	}
+	return config, reloader, nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("No PEM certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// certReloader serves the last certificate loaded, the files being reloaded when their modification time changes,
+// e.g. when they are rotated. A certificate that cannot be loaded is logged, the previous one being kept.
+type certReloader struct {
+	sync.RWMutex
+	certPath string
+	keyPath  string
+	logger   *zap.Logger
+	cert     *tls.Certificate
+	certMod  time.Time
+	keyMod   time.Time
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	stopWG   sync.WaitGroup
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.RLock()
+	defer r.RUnlock()
+	return r.cert, nil
+}
+
+// reload loads the certificate if its files changed since it was last loaded, and returns whether it did
+func (r *certReloader) reload() (bool, error) {
+	certMod, err := modTime(r.certPath)
+	if err != nil {
+		return false, err
+	}
+	keyMod, err := modTime(r.keyPath)
+	if err != nil {
+		return false, err
+	}
+	r.RLock()
+	unchanged := r.cert != nil && certMod.Equal(r.certMod) && keyMod.Equal(r.keyMod)
+	r.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return false, err
+	}
+	r.Lock()
+	r.cert = &cert
+	r.certMod = certMod
+	r.keyMod = keyMod
+	r.Unlock()
+	return true, nil
+}
+
+func modTime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+func (r *certReloader) start(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	r.stopWG.Add(1)
+	go func() {
+		defer r.stopWG.Done()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				reloaded, err := r.reload()
+				if err != nil {
+					r.logger.Error("Failed to reload the TLS certificate", zap.String("cert", r.certPath), zap.Error(err))
+				} else if reloaded {
+					r.logger.Info("Reloaded the TLS certificate", zap.String("cert", r.certPath))
+				}
+			case <-r.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the reloading of the certificate
+func (r *certReloader) Close() error {
+	r.stopOnce.Do(func() {
+		close(r.stopCh)
+	})
+	r.stopWG.Wait()
+	return nil
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// writeCertificate writes a self-signed certificate with the common name and its key to the paths
+func writeCertificate(t *testing.T, certPath, keyPath, commonName string, modTime time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	require.NoError(t, os.Chtimes(certPath, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyPath, modTime, modTime))
+}
+
+func commonName(t *testing.T, config *tls.Config) string {
+	cert, err := config.GetCertificate(nil)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+func TestNewServerConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	modTime := time.Now().Add(-time.Minute)
+	writeCertificate(t, certPath, keyPath, "first", modTime)
+
+	c := &Configuration{
+		CertPath:          certPath,
+		KeyPath:           keyPath,
+		ClientCAPath:      certPath,
+		RequireClientCert: true,
+		CipherSuites:      []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+		MinVersion:        "1.2",
+	}
+	config, closer, err := c.NewServerConfig(zap.NewNop())
+	require.NoError(t, err)
+	defer closer.Close()
+	assert.EqualValues(t, tls.VersionTLS12, config.MinVersion)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, config.CipherSuites)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, config.ClientAuth)
+	assert.NotNil(t, config.ClientCAs)
+	assert.Equal(t, "first", commonName(t, config))
+
+	c.RequireClientCert = false
+	config, closer, err = c.NewServerConfig(zap.NewNop())
+	require.NoError(t, err)
+	defer closer.Close()
+	assert.Equal(t, tls.VerifyClientCertIfGiven, config.ClientAuth)
+}
+
+func TestNewServerConfigReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	modTime := time.Now().Add(-time.Minute)
+	writeCertificate(t, certPath, keyPath, "first", modTime)
+
+	c := &Configuration{CertPath: certPath, KeyPath: keyPath, ReloadInterval: time.Millisecond}
+	config, closer, err := c.NewServerConfig(zap.NewNop())
+	require.NoError(t, err)
+	defer closer.Close()
+	assert.Equal(t, tls.NoClientCert, config.ClientAuth)
+
+	writeCertificate(t, certPath, keyPath, "second", modTime.Add(time.Second))
+	for i := 0; i < 1000 && commonName(t, config) != "second"; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, "second", commonName(t, config))
+
+	require.NoError(t, ioutil.WriteFile(keyPath, []byte("not a key"), 0600))
+	require.NoError(t, os.Chtimes(keyPath, modTime.Add(2*time.Second), modTime.Add(2*time.Second)))
+	reloaded, err := closer.(*certReloader).reload()
+	assert.Error(t, err)
+	assert.False(t, reloaded)
+	assert.Equal(t, "second", commonName(t, config), "the previous certificate is kept")
+	assert.NoError(t, closer.Close())
+}
+
+func TestNewServerConfigErrors(t *testing.T) {
+	testCases := []struct {
+		configuration Configuration
+		expected      string
+	}{
+		{configuration: Configuration{}, expected: "No TLS certificate or key specified"},
+		{
+			configuration: Configuration{CertPath: "cert.pem", KeyPath: "key.pem", RequireClientCert: true},
+			expected:      "No TLS client CA specified to verify the required client certificates",
+		},
+		{configuration: Configuration{CertPath: "cert.pem", KeyPath: "key.pem", MinVersion: "0.9"}, expected: `Unknown TLS version "0.9"`},
+		{
+			configuration: Configuration{CertPath: "cert.pem", KeyPath: "key.pem", CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+			expected:      `Unknown TLS cipher suite "TLS_RSA_WITH_RC4_128_SHA"`,
+		},
+	}
+	for _, testCase := range testCases {
+		_, _, err := testCase.configuration.NewServerConfig(zap.NewNop())
+		assert.EqualError(t, err, testCase.expected)
+	}
+
+	_, _, err := (&Configuration{CertPath: "missing.pem", KeyPath: "missing.pem"}).NewServerConfig(zap.NewNop())
+	assert.Error(t, err)
+}
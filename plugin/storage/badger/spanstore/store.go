@@ -0,0 +1,478 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/dgraph-io/badger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	jConverter "github.com/uber/jaeger/model/converter/json"
+	jModel "github.com/uber/jaeger/model/json"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+const (
+	// spanKeyPrefix + traceID + spanID => json span
+	spanKeyPrefix byte = 0x80
+	// serviceIndexPrefix + service + separator + startTime + traceID => nothing
+	serviceIndexPrefix byte = 0x81
+	// operationIndexPrefix + service + separator + operation + separator + startTime + traceID => nothing
+	operationIndexPrefix byte = 0x82
+	// serviceNamePrefix + service => nothing
+	serviceNamePrefix byte = 0x83
+	// operationNamePrefix + service + separator + operation => nothing
+	operationNamePrefix byte = 0x84
+
+	keySeparator byte = 0x00
+
+	traceIDLength   = 16
+	startTimeLength = 8
+
+	valueLogGCDiscardRatio = 0.5
+)
+
+var errStoreClosed = errors.New("The Badger store is closed")
+
+// Store is a span store backed by an embedded BadgerDB. Spans are keyed by trace ID,
+// with secondary indices for service and service+operation lookups.
+type Store struct {
+	db     *badger.DB
+	logger *zap.Logger
+	done   chan struct{}
+}
+
+// NewStore creates a Store on top of the given BadgerDB. If gcInterval is positive
+// the value log is garbage collected periodically until the store is closed.
+func NewStore(db *badger.DB, gcInterval time.Duration, logger *zap.Logger) *Store {
+	s := &Store{
+		db:     db,
+		logger: logger,
+		done:   make(chan struct{}),
+	}
+	if gcInterval > 0 {
+		go s.runValueLogGC(gcInterval)
+	}
+	return s
+}
+
+func (s *Store) runValueLogGC(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// ErrNoRewrite only means there was nothing to collect
+			if err := s.db.RunValueLogGC(valueLogGCDiscardRatio); err != nil && err != badger.ErrNoRewrite {
+				s.logger.Warn("Failed to garbage collect value log", zap.Error(err))
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Close stops the value log garbage collection and closes the underlying BadgerDB
+func (s *Store) Close() error {
+	close(s.done)
+	return s.db.Close()
+}
+
+// Probe implements spanstore.Prober, returning an error once the store is closed or if the BadgerDB cannot be read
+func (s *Store) Probe() error {
+	select {
+	case <-s.done:
+		return errStoreClosed
+	default:
+	}
+	return s.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte{serviceNamePrefix})
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+// WriteSpan writes the span and all its index entries in a single transaction
+func (s *Store) WriteSpan(span *model.Span) error {
+	value, err := json.Marshal(jConverter.FromDomainEmbedProcess(span))
+	if err != nil {
+		return errors.Wrap(err, "Failed to serialize span")
+	}
+	serviceName := span.Process.ServiceName
+	startTime := span.StartTime
+	indexKeys := [][]byte{
+		serviceIndexKey(serviceName, startTime, span.TraceID),
+		operationIndexKey(serviceName, span.OperationName, startTime, span.TraceID),
+		serviceNameKey(serviceName),
+		operationNameKey(serviceName, span.OperationName),
+	}
+	err = s.db.Update(func(txn *badger.Txn) error {
+		if err := txn.Set(spanKey(span.TraceID, span.SpanID), value); err != nil {
+			return err
+		}
+		for _, key := range indexKeys {
+			if err := txn.Set(key, []byte{}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "Failed to write span")
+	}
+	return nil
+}
+
+// GetTrace loads all spans of the given trace
+func (s *Store) GetTrace(traceID model.TraceID) (*model.Trace, error) {
+	var trace *model.Trace
+	err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		trace, err = s.getTrace(txn, traceID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if trace == nil {
+		return nil, spanstore.ErrTraceNotFound
+	}
+	return trace, nil
+}
+
+func (s *Store) getTrace(txn *badger.Txn, traceID model.TraceID) (*model.Trace, error) {
+	prefix := traceKeyPrefix(traceID)
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+	var spans []*model.Span
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		value, err := it.Item().Value()
+		if err != nil {
+			return nil, err
+		}
+		span, err := decodeSpan(value)
+		if err != nil {
+			return nil, err
+		}
+		spans = append(spans, span)
+	}
+	if len(spans) == 0 {
+		return nil, nil
+	}
+	return &model.Trace{Spans: spans}, nil
+}
+
+// GetServices returns a list of all known services
+func (s *Store) GetServices() ([]string, error) {
+	var services []string
+	err := s.db.View(func(txn *badger.Txn) error {
+		services = scanNames(txn, []byte{serviceNamePrefix})
+		return nil
+	})
+	return services, err
+}
+
+// GetOperations returns the operations of a given service
+func (s *Store) GetOperations(service string) ([]string, error) {
+	operations := []string{}
+	err := s.db.View(func(txn *badger.Txn) error {
+		operations = append(operations, scanNames(txn, operationNameKey(service, ""))...)
+		return nil
+	})
+	return operations, err
+}
+
+// scanNames returns the remainder of all keys starting with the given prefix
+func scanNames(txn *badger.Txn, prefix []byte) []string {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	var names []string
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		names = append(names, string(it.Item().Key()[len(prefix):]))
+	}
+	return names
+}
+
+// FindTraces looks up candidate traces in the service or operation index and returns
+// the most recent ones that have at least one span satisfying the query parameters
+func (s *Store) FindTraces(query *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
+	var retMe []*model.Trace
+	err := s.db.View(func(txn *badger.Txn) error {
+		traceIDs := s.findTraceIDs(txn, query)
+		for _, traceID := range traceIDs {
+			if len(retMe) >= query.NumTraces {
+				return nil
+			}
+			trace, err := s.getTrace(txn, traceID)
+			if err != nil {
+				return err
+			}
+			if trace != nil && validTrace(trace, query) {
+				retMe = append(retMe, trace)
+			}
+		}
+		return nil
+	})
+	return retMe, err
+}
+
+func (s *Store) findTraceIDs(txn *badger.Txn, query *spanstore.TraceQueryParameters) []model.TraceID {
+	var prefix []byte
+	if query.OperationName != "" {
+		prefix = operationIndexKey(query.ServiceName, query.OperationName, time.Time{}, model.TraceID{})
+	} else {
+		prefix = serviceIndexKey(query.ServiceName, time.Time{}, model.TraceID{})
+	}
+	prefix = prefix[:len(prefix)-startTimeLength-traceIDLength]
+	return scanIndex(txn, prefix, query.StartTimeMin, query.StartTimeMax)
+}
+
+// scanIndex returns the unique trace IDs found in the index entries with the given prefix, the most recent
+// first, restricted to the [startTimeMin, startTimeMax] interval if the bounds are set
+func scanIndex(txn *badger.Txn, prefix []byte, startTimeMin, startTimeMax time.Time) []model.TraceID {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Reverse = true
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	// the reverse iterator seeks the last key before the seek key, which sorts after all the trace IDs
+	seek := append([]byte{}, prefix...)
+	if !startTimeMax.IsZero() {
+		seek = append(seek, encodeTime(startTimeMax)...)
+	} else {
+		seek = append(seek, bytes.Repeat([]byte{0xFF}, startTimeLength)...)
+	}
+	seek = append(seek, bytes.Repeat([]byte{0xFF}, traceIDLength)...)
+	seen := make(map[model.TraceID]struct{})
+	var traceIDs []model.TraceID
+	for it.Seek(seek); it.ValidForPrefix(prefix); it.Next() {
+		suffix := it.Item().Key()[len(prefix):]
+		startTime := model.EpochMicrosecondsAsTime(binary.BigEndian.Uint64(suffix[:startTimeLength]))
+		if !startTimeMin.IsZero() && startTime.Before(startTimeMin) {
+			break
+		}
+		traceID := decodeTraceID(suffix[startTimeLength:])
+		if _, ok := seen[traceID]; !ok {
+			seen[traceID] = struct{}{}
+			traceIDs = append(traceIDs, traceID)
+		}
+	}
+	return traceIDs
+}
+
+// GetDependencies derives the links between services from the traces that started within the lookback
+func (s *Store) GetDependencies(endTs time.Time, lookback time.Duration) ([]model.DependencyLink, error) {
+	deps := map[string]*model.DependencyLink{}
+	err := s.db.View(func(txn *badger.Txn) error {
+		services := scanNames(txn, []byte{serviceNamePrefix})
+		seen := make(map[model.TraceID]struct{})
+		for _, service := range services {
+			prefix := serviceIndexKey(service, time.Time{}, model.TraceID{})
+			prefix = prefix[:len(prefix)-startTimeLength-traceIDLength]
+			for _, traceID := range scanIndex(txn, prefix, endTs.Add(-lookback), endTs) {
+				if _, ok := seen[traceID]; ok {
+					continue
+				}
+				seen[traceID] = struct{}{}
+				trace, err := s.getTrace(txn, traceID)
+				if err != nil {
+					return err
+				}
+				if trace != nil {
+					addDependencies(deps, trace)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	retMe := make([]model.DependencyLink, 0, len(deps))
+	for _, dep := range deps {
+		retMe = append(retMe, *dep)
+	}
+	return retMe, nil
+}
+
+func addDependencies(deps map[string]*model.DependencyLink, trace *model.Trace) {
+	for _, s := range trace.Spans {
+		parentSpan := trace.FindSpanByID(s.ParentSpanID)
+		if parentSpan == nil || parentSpan.Process.ServiceName == s.Process.ServiceName {
+			continue
+		}
+		depKey := parentSpan.Process.ServiceName + "&&&" + s.Process.ServiceName
+		if dep, ok := deps[depKey]; ok {
+			dep.CallCount++
+		} else {
+			deps[depKey] = &model.DependencyLink{
+				Parent:    parentSpan.Process.ServiceName,
+				Child:     s.Process.ServiceName,
+				CallCount: 1,
+			}
+		}
+	}
+}
+
+func validTrace(trace *model.Trace, query *spanstore.TraceQueryParameters) bool {
+	for _, span := range trace.Spans {
+		if validSpan(span, query) {
+			return true
+		}
+	}
+	return false
+}
+
+func validSpan(span *model.Span, query *spanstore.TraceQueryParameters) bool {
+	if query.ServiceName != span.Process.ServiceName {
+		return false
+	}
+	if query.OperationName != "" && query.OperationName != span.OperationName {
+		return false
+	}
+	if query.SpanKind != "" && query.SpanKind != span.GetSpanKind() {
+		return false
+	}
+	if query.DurationMin != 0 && span.Duration < query.DurationMin {
+		return false
+	}
+	if query.DurationMax != 0 && span.Duration > query.DurationMax {
+		return false
+	}
+	if !query.StartTimeMin.IsZero() && span.StartTime.Before(query.StartTimeMin) {
+		return false
+	}
+	if !query.StartTimeMax.IsZero() && span.StartTime.After(query.StartTimeMax) {
+		return false
+	}
+	for queryK, queryV := range query.Tags {
+		if !hasTag(span, queryK, queryV) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasTag(span *model.Span, key, value string) bool {
+	matches := func(kvs model.KeyValues) bool {
+		// (NB): we cannot use KeyValues.FindByKey because there can be multiple tags with the same key
+		for _, kv := range kvs {
+			if kv.Key == key && kv.AsString() == value {
+				return true
+			}
+		}
+		return false
+	}
+	if matches(span.Tags) || matches(span.Process.Tags) {
+		return true
+	}
+	for _, log := range span.Logs {
+		if matches(log.Fields) {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeSpan(value []byte) (*model.Span, error) {
+	var jsonSpan jModel.Span
+	if err := json.Unmarshal(value, &jsonSpan); err != nil {
+		return nil, errors.Wrap(err, "Failed to deserialize span")
+	}
+	return jConverter.SpanToDomain(&jsonSpan)
+}
+
+func traceKeyPrefix(traceID model.TraceID) []byte {
+	return append([]byte{spanKeyPrefix}, encodeTraceID(traceID)...)
+}
+
+func spanKey(traceID model.TraceID, spanID model.SpanID) []byte {
+	key := traceKeyPrefix(traceID)
+	spanIDBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(spanIDBytes, uint64(spanID))
+	return append(key, spanIDBytes...)
+}
+
+func serviceIndexKey(service string, startTime time.Time, traceID model.TraceID) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(serviceIndexPrefix)
+	buf.WriteString(service)
+	buf.WriteByte(keySeparator)
+	buf.Write(encodeTime(startTime))
+	buf.Write(encodeTraceID(traceID))
+	return buf.Bytes()
+}
+
+func operationIndexKey(service, operation string, startTime time.Time, traceID model.TraceID) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(operationIndexPrefix)
+	buf.WriteString(service)
+	buf.WriteByte(keySeparator)
+	buf.WriteString(operation)
+	buf.WriteByte(keySeparator)
+	buf.Write(encodeTime(startTime))
+	buf.Write(encodeTraceID(traceID))
+	return buf.Bytes()
+}
+
+func serviceNameKey(service string) []byte {
+	return append([]byte{serviceNamePrefix}, service...)
+}
+
+func operationNameKey(service, operation string) []byte {
+	key := append([]byte{operationNamePrefix}, service...)
+	key = append(key, keySeparator)
+	return append(key, operation...)
+}
+
+func encodeTime(t time.Time) []byte {
+	b := make([]byte, startTimeLength)
+	// the times before the epoch, e.g. of a lookback longer than the end time, are encoded as the epoch
+	if !t.IsZero() && t.After(time.Unix(0, 0)) {
+		binary.BigEndian.PutUint64(b, model.TimeAsEpochMicroseconds(t))
+	}
+	return b
+}
+
+func encodeTraceID(traceID model.TraceID) []byte {
+	b := make([]byte, traceIDLength)
+	binary.BigEndian.PutUint64(b[:8], traceID.High)
+	binary.BigEndian.PutUint64(b[8:], traceID.Low)
+	return b
+}
+
+func decodeTraceID(b []byte) model.TraceID {
+	return model.TraceID{
+		High: binary.BigEndian.Uint64(b[:8]),
+		Low:  binary.BigEndian.Uint64(b[8:traceIDLength]),
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	badgercfg "github.com/uber/jaeger/pkg/badger/config"
+	"github.com/uber/jaeger/storage/dependencystore"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+var (
+	_ spanstore.Writer       = &Store{} // check API conformance
+	_ spanstore.Reader       = &Store{}
+	_ dependencystore.Reader = &Store{}
+)
+
+var (
+	testTraceID = model.TraceID{Low: 1, High: 2}
+	rootSpan    = &model.Span{
+		TraceID:       testTraceID,
+		SpanID:        model.SpanID(1),
+		OperationName: "root",
+		Process: &model.Process{
+			ServiceName: "frontend",
+		},
+		Tags: model.KeyValues{
+			model.String("http.method", "GET"),
+		},
+		StartTime: time.Unix(300, 0),
+		Duration:  time.Second,
+	}
+	childSpan = &model.Span{
+		TraceID:       testTraceID,
+		SpanID:        model.SpanID(2),
+		ParentSpanID:  model.SpanID(1),
+		OperationName: "child",
+		Process: &model.Process{
+			ServiceName: "backend",
+		},
+		StartTime: time.Unix(301, 0),
+		Duration:  time.Millisecond,
+	}
+)
+
+func withStore(t *testing.T, fn func(store *Store)) {
+	dir, err := ioutil.TempDir("", "badger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cfg := &badgercfg.Configuration{Directory: dir}
+	db, err := cfg.NewDB()
+	require.NoError(t, err)
+	store := NewStore(db, time.Minute, zap.NewNop())
+	defer store.Close()
+	require.NoError(t, store.WriteSpan(rootSpan))
+	require.NoError(t, store.WriteSpan(childSpan))
+	fn(store)
+}
+
+func TestStoreGetTrace(t *testing.T) {
+	withStore(t, func(store *Store) {
+		trace, err := store.GetTrace(testTraceID)
+		require.NoError(t, err)
+		require.Len(t, trace.Spans, 2)
+		assert.Equal(t, "root", trace.Spans[0].OperationName)
+		assert.Equal(t, "backend", trace.Spans[1].Process.ServiceName)
+
+		_, err = store.GetTrace(model.TraceID{Low: 42})
+		assert.Equal(t, spanstore.ErrTraceNotFound, err)
+	})
+}
+
+func TestStoreGetServicesAndOperations(t *testing.T) {
+	withStore(t, func(store *Store) {
+		services, err := store.GetServices()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"backend", "frontend"}, services)
+
+		operations, err := store.GetOperations("frontend")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"root"}, operations)
+
+		operations, err = store.GetOperations("unknown")
+		require.NoError(t, err)
+		assert.Empty(t, operations)
+	})
+}
+
+func TestStoreFindTraces(t *testing.T) {
+	testCases := []struct {
+		caption  string
+		query    *spanstore.TraceQueryParameters
+		expected int
+	}{
+		{
+			caption:  "by service",
+			query:    &spanstore.TraceQueryParameters{ServiceName: "backend", NumTraces: 10},
+			expected: 1,
+		},
+		{
+			caption:  "by operation",
+			query:    &spanstore.TraceQueryParameters{ServiceName: "frontend", OperationName: "root", NumTraces: 10},
+			expected: 1,
+		},
+		{
+			caption:  "by unknown operation",
+			query:    &spanstore.TraceQueryParameters{ServiceName: "frontend", OperationName: "child", NumTraces: 10},
+			expected: 0,
+		},
+		{
+			caption: "by tag",
+			query: &spanstore.TraceQueryParameters{
+				ServiceName: "frontend",
+				Tags:        map[string]string{"http.method": "GET"},
+				NumTraces:   10,
+			},
+			expected: 1,
+		},
+		{
+			caption: "outside of time range",
+			query: &spanstore.TraceQueryParameters{
+				ServiceName:  "frontend",
+				StartTimeMin: time.Unix(400, 0),
+				NumTraces:    10,
+			},
+			expected: 0,
+		},
+		{
+			caption: "by duration",
+			query: &spanstore.TraceQueryParameters{
+				ServiceName: "backend",
+				DurationMin: time.Second,
+				NumTraces:   10,
+			},
+			expected: 0,
+		},
+	}
+	withStore(t, func(store *Store) {
+		for _, testCase := range testCases {
+			traces, err := store.FindTraces(testCase.query)
+			require.NoError(t, err, testCase.caption)
+			assert.Len(t, traces, testCase.expected, testCase.caption)
+		}
+	})
+}
+
+func TestStoreFindTracesMostRecent(t *testing.T) {
+	withStore(t, func(store *Store) {
+		for i := 1; i <= 5; i++ {
+			span := *rootSpan
+			span.TraceID = model.TraceID{Low: uint64(100 + i)}
+			span.StartTime = time.Unix(int64(1000*i), 0)
+			require.NoError(t, store.WriteSpan(&span))
+		}
+		traces, err := store.FindTraces(&spanstore.TraceQueryParameters{ServiceName: "frontend", NumTraces: 2})
+		require.NoError(t, err)
+		require.Len(t, traces, 2)
+		assert.Equal(t, model.TraceID{Low: 105}, traces[0].Spans[0].TraceID)
+		assert.Equal(t, model.TraceID{Low: 104}, traces[1].Spans[0].TraceID)
+
+		traces, err = store.FindTraces(&spanstore.TraceQueryParameters{
+			ServiceName:  "frontend",
+			StartTimeMin: time.Unix(2000, 0),
+			StartTimeMax: time.Unix(3000, 0),
+			NumTraces:    10,
+		})
+		require.NoError(t, err)
+		require.Len(t, traces, 2)
+		assert.Equal(t, model.TraceID{Low: 103}, traces[0].Spans[0].TraceID)
+		assert.Equal(t, model.TraceID{Low: 102}, traces[1].Spans[0].TraceID)
+	})
+}
+
+func TestStoreGetDependencies(t *testing.T) {
+	withStore(t, func(store *Store) {
+		deps, err := store.GetDependencies(time.Unix(400, 0), time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, []model.DependencyLink{
+			{Parent: "frontend", Child: "backend", CallCount: 1},
+		}, deps)
+	})
+}
@@ -37,9 +37,25 @@ const (
 	depsSelectStmt = "SELECT ts, dependencies FROM dependencies WHERE ts_index >= ? AND ts_index < ?"
 )
 
+// Option is a function that sets some option on the DependencyStore.
+type Option func(*DependencyStore)
+
+// Options is a factory for all available Option's
+var Options options
+
+type options struct{}
+
+// ReadConsistency creates an Option that reads dependencies at the given consistency level instead of ONE.
+func (options) ReadConsistency(level cassandra.Consistency) Option {
+	return func(s *DependencyStore) {
+		s.readConsistency = level
+	}
+}
+
 // DependencyStore handles all queries and insertions to Cassandra dependencies
 type DependencyStore struct {
 	session                  cassandra.Session
+	readConsistency          cassandra.Consistency
 	dependencyDataFrequency  time.Duration
 	dependenciesTableMetrics *casMetrics.Table
 	logger                   *zap.Logger
@@ -51,13 +67,19 @@ func NewDependencyStore(
 	dependencyDataFrequency time.Duration,
 	metricsFactory metrics.Factory,
 	logger *zap.Logger,
+	options ...Option,
 ) *DependencyStore {
-	return &DependencyStore{
+	store := &DependencyStore{
 		session:                  session,
+		readConsistency:          cassandra.One,
 		dependencyDataFrequency:  dependencyDataFrequency,
 		dependenciesTableMetrics: casMetrics.NewTable(metricsFactory, "Dependencies"),
 		logger: logger,
 	}
+	for _, option := range options {
+		option(store)
+	}
+	return store
 }
 
 // WriteDependencies implements dependencystore.Writer#WriteDependencies.
@@ -77,7 +99,7 @@ func (s *DependencyStore) WriteDependencies(ts time.Time, dependencies []model.D
 // GetDependencies returns all interservice dependencies
 func (s *DependencyStore) GetDependencies(endTs time.Time, lookback time.Duration) ([]model.DependencyLink, error) {
 	query := s.session.Query(depsSelectStmt, endTs.Add(-1*lookback), endTs)
-	iter := query.Consistency(cassandra.One).Iter()
+	iter := query.Consistency(s.readConsistency).Iter()
 
 	var mDependency []model.DependencyLink
 	var dependencies []Dependency
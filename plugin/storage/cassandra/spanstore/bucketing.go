@@ -0,0 +1,92 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"sync"
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/pkg/cache"
+	"github.com/uber/jaeger/plugin/storage/cassandra/spanstore/dbmodel"
+)
+
+const (
+	// bucketedTracesSize is the number of traces whose spans are counted at once, the spans of the
+	// least recently written traces being counted again from zero once they are evicted
+	bucketedTracesSize = 100000
+	// bucketedTracesTTL is longer than the spans of a trace usually take to arrive
+	bucketedTracesTTL = time.Hour
+)
+
+// traceBuckets picks the bucket of each span, counting the spans written for each trace so that
+// the spans beyond the threshold are spread across buckets of at most threshold spans. Bucket 0
+// is the partition of the trace in the traces table.
+type traceBuckets struct {
+	threshold      int
+	traces         cache.Cache
+	lock           sync.Mutex
+	bucketedTraces metrics.Counter
+}
+
+// traceBucketCount is the number of spans written for a trace and the highest bucket indexed
+type traceBucketCount struct {
+	spans   int
+	indexed int
+}
+
+func newTraceBuckets(threshold int, metricsFactory metrics.Factory) *traceBuckets {
+	return &traceBuckets{
+		threshold: threshold,
+		traces: cache.NewLRUWithOptions(bucketedTracesSize, &cache.Options{
+			TTL: bucketedTracesTTL,
+		}),
+		bucketedTraces: metricsFactory.Counter("bucketed-traces", nil),
+	}
+}
+
+// next returns the bucket of the next span of the trace and whether the bucket is already indexed
+func (b *traceBuckets) next(traceID dbmodel.TraceID) (bucket int, indexed bool) {
+	key := traceID.String()
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	count, _ := b.traces.Get(key).(*traceBucketCount)
+	if count == nil {
+		count = &traceBucketCount{}
+		b.traces.Put(key, count)
+	}
+	count.spans++
+	bucket = (count.spans - 1) / b.threshold
+	if bucket == 1 && count.spans == b.threshold+1 {
+		b.bucketedTraces.Inc(1)
+	}
+	return bucket, bucket <= count.indexed
+}
+
+// markIndexed records that the bucket of the trace is indexed, so that later spans skip the index
+func (b *traceBuckets) markIndexed(traceID dbmodel.TraceID, bucket int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if count, _ := b.traces.Get(traceID.String()).(*traceBucketCount); count != nil && bucket > count.indexed {
+		count.indexed = bucket
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/plugin/storage/cassandra/spanstore/dbmodel"
+)
+
+func TestTraceBuckets(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	buckets := newTraceBuckets(2, metricsFactory)
+	traceID := dbmodel.TraceIDFromDomain(model.TraceID{Low: 1})
+	otherTraceID := dbmodel.TraceIDFromDomain(model.TraceID{Low: 2})
+
+	var picked []int
+	for i := 0; i < 5; i++ {
+		bucket, indexed := buckets.next(traceID)
+		picked = append(picked, bucket)
+		if bucket > 0 && !indexed {
+			buckets.markIndexed(traceID, bucket)
+		}
+	}
+	assert.Equal(t, []int{0, 0, 1, 1, 2}, picked)
+
+	bucket, indexed := buckets.next(otherTraceID)
+	assert.Equal(t, 0, bucket)
+	assert.True(t, indexed)
+
+	buckets.next(otherTraceID)
+	bucket, indexed = buckets.next(otherTraceID)
+	assert.Equal(t, 1, bucket)
+	assert.False(t, indexed)
+	// the bucket is indexed again until the index is written
+	bucket, indexed = buckets.next(otherTraceID)
+	assert.Equal(t, 1, bucket)
+	assert.False(t, indexed)
+
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counters["bucketed-traces"])
+}
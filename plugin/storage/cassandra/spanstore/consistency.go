@@ -0,0 +1,99 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/pkg/cassandra"
+	"github.com/uber/jaeger/pkg/cassandra/retry"
+)
+
+// writeConsistency picks the consistency level of writes, switching to the load shedding level
+// for a while after a write failed because Cassandra timed out or was unavailable.
+type writeConsistency struct {
+	// shedUntil is the time in nanoseconds until which writes use sheddingLevel, accessed atomically
+	shedUntil      int64
+	level          cassandra.Consistency
+	sheddingLevel  cassandra.Consistency
+	sheddingPeriod time.Duration
+	sheddingCount  metrics.Counter
+	logger         *zap.Logger
+	now            func() time.Time
+}
+
+// current returns the consistency level of the next write
+func (c *writeConsistency) current() cassandra.Consistency {
+	if c.shedding() {
+		return c.sheddingLevel
+	}
+	return c.level
+}
+
+func (c *writeConsistency) shedding() bool {
+	return c.sheddingPeriod > 0 && c.now().UnixNano() < atomic.LoadInt64(&c.shedUntil)
+}
+
+// observe starts shedding load when a write at the normal level fails with a transient error
+func (c *writeConsistency) observe(level cassandra.Consistency, err error) {
+	if err == nil || c.sheddingPeriod <= 0 || level != c.level || !retry.IsTransient(err) {
+		return
+	}
+	wasShedding := c.shedding()
+	atomic.StoreInt64(&c.shedUntil, c.now().Add(c.sheddingPeriod).UnixNano())
+	if !wasShedding {
+		c.sheddingCount.Inc(1)
+		c.logger.Warn("Lowering the consistency of writes to shed load",
+			zap.Duration("period", c.sheddingPeriod),
+			zap.Error(err))
+	}
+}
+
+// consistentSession is a cassandra.Session executing all queries at the current write consistency level
+type consistentSession struct {
+	cassandra.Session
+	consistency *writeConsistency
+}
+
+func (s consistentSession) Query(stmt string, values ...interface{}) cassandra.Query {
+	return &consistentQuery{Query: s.Session.Query(stmt, values...), consistency: s.consistency}
+}
+
+// consistentQuery sets the consistency level right before Exec, since a bound query is executed many times
+type consistentQuery struct {
+	cassandra.Query
+	consistency *writeConsistency
+}
+
+func (q *consistentQuery) Exec() error {
+	level := q.consistency.current()
+	err := q.Query.Consistency(level).Exec()
+	q.consistency.observe(level, err)
+	return err
+}
+
+func (q *consistentQuery) Bind(v ...interface{}) cassandra.Query {
+	return &consistentQuery{Query: q.Query.Bind(v...), consistency: q.consistency}
+}
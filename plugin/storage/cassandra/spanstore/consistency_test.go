@@ -0,0 +1,99 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/pkg/cassandra"
+	"github.com/uber/jaeger/pkg/cassandra/mocks"
+	"github.com/uber/jaeger/pkg/testutils"
+)
+
+func TestSpanWriterConsistency(t *testing.T) {
+	session := &mocks.Session{}
+	logger, logBuffer := testutils.NewLogger()
+	metricsFactory := metrics.NewLocalFactory(0)
+	writer := NewSpanWriter(session, 0, metricsFactory, logger,
+		WriterOptions.Consistency(cassandra.Quorum, cassandra.One, time.Minute))
+	writer.serviceNamesWriter = func(serviceName string) error { return nil }
+	writer.operationNamesWriter = func(serviceName, operationName string) error { return nil }
+	now := time.Unix(1000, 0)
+	writer.consistency.now = func() time.Time { return now }
+
+	var levels []cassandra.Consistency
+	var execErr error
+	query := &mocks.Query{}
+	query.On("Bind", matchEverything()).Return(query)
+	query.On("Consistency", mock.AnythingOfType("cassandra.Consistency")).Run(func(args mock.Arguments) {
+		levels = append(levels, args.Get(0).(cassandra.Consistency))
+	}).Return(query)
+	query.On("Exec").Return(func() error { return execErr })
+	query.On("String").Return("insert")
+	session.On("Query", mock.AnythingOfType("string"), matchEverything()).Return(query)
+
+	span := &model.Span{
+		TraceID: model.TraceID{Low: 1},
+		Process: &model.Process{ServiceName: "service-a"},
+	}
+	writeSpan := func(err error) []cassandra.Consistency {
+		levels, execErr = nil, err
+		writer.WriteSpan(span)
+		return levels
+	}
+
+	// the span, its service, operation, the two duration indexes and the span kind index
+	assert.Equal(t, repeatConsistency(cassandra.Quorum, 6), writeSpan(nil))
+	assert.Equal(t, repeatConsistency(cassandra.Quorum, 1), writeSpan(errors.New("invalid query")))
+	assert.Equal(t, repeatConsistency(cassandra.Quorum, 1), writeSpan(gocql.ErrTimeoutNoResponse))
+	assert.Equal(t, repeatConsistency(cassandra.One, 6), writeSpan(nil))
+	// failures at the load shedding level do not extend the period
+	assert.Equal(t, repeatConsistency(cassandra.One, 1), writeSpan(gocql.ErrTimeoutNoResponse))
+	now = now.Add(time.Minute)
+	assert.Equal(t, repeatConsistency(cassandra.Quorum, 6), writeSpan(nil))
+
+	assert.Equal(t, 1, strings.Count(logBuffer.String(), "Lowering the consistency of writes to shed load"))
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["load-shedding"])
+}
+
+func TestSpanWriterConsistencyWithoutLoadShedding(t *testing.T) {
+	consistency := &writeConsistency{level: cassandra.LocalQuorum, sheddingLevel: cassandra.One, now: time.Now}
+	consistency.observe(cassandra.LocalQuorum, gocql.ErrTimeoutNoResponse)
+	assert.Equal(t, cassandra.LocalQuorum, consistency.current())
+}
+
+func repeatConsistency(level cassandra.Consistency, n int) []cassandra.Consistency {
+	levels := make([]cassandra.Consistency, n)
+	for i := range levels {
+		levels[i] = level
+	}
+	return levels
+}
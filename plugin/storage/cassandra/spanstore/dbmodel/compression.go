@@ -0,0 +1,173 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dbmodel
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+
+	"github.com/uber/jaeger/model"
+)
+
+// Compression is the algorithm used to compress the tags and logs of spans before they are stored
+type Compression string
+
+const (
+	// NoCompression stores spans as they are
+	NoCompression Compression = ""
+	// GzipCompression compresses spans with gzip
+	GzipCompression Compression = "gzip"
+	// ZstdCompression compresses spans with zstd, which is usually faster than gzip for a similar ratio
+	ZstdCompression Compression = "zstd"
+
+	// compressedPayloadKey is the key of the single tag replacing the tags and logs of a compressed span.
+	// The algorithm is stored as the string value and the compressed payload as the binary value.
+	compressedPayloadKey = "$$jaeger.compressed"
+)
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// compressedPayload holds the parts of a span that are compressed, which make up most of its size
+type compressedPayload struct {
+	Tags        []KeyValue `json:"tags,omitempty"`
+	Logs        []Log      `json:"logs,omitempty"`
+	ProcessTags []KeyValue `json:"processTags,omitempty"`
+}
+
+// ParseCompression returns the Compression with the given name, "none" or empty meaning no compression
+func ParseCompression(name string) (Compression, error) {
+	switch Compression(name) {
+	case NoCompression, "none":
+		return NoCompression, nil
+	case GzipCompression, ZstdCompression:
+		return Compression(name), nil
+	}
+	return NoCompression, fmt.Errorf("Unknown span compression %q", name)
+}
+
+// CompressSpan replaces the tags, logs and process tags of the span with their compressed form.
+// It returns the sizes of the payload before and after compression, the span is left as is
+// if compression does not make it smaller.
+func CompressSpan(span *Span, compression Compression) (int, int, error) {
+	if compression == NoCompression {
+		return 0, 0, nil
+	}
+	payload, err := json.Marshal(compressedPayload{
+		Tags:        span.Tags,
+		Logs:        span.Logs,
+		ProcessTags: span.Process.Tags,
+	})
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "Failed to serialize span payload")
+	}
+	compressed, err := compress(payload, compression)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(compressed) >= len(payload) {
+		return len(payload), len(payload), nil
+	}
+	span.Tags = []KeyValue{{
+		Key:         compressedPayloadKey,
+		ValueType:   model.BinaryType.String(),
+		ValueString: string(compression),
+		ValueBinary: compressed,
+	}}
+	span.Logs = nil
+	span.Process.Tags = nil
+	return len(payload), len(compressed), nil
+}
+
+// IsCompressed returns true if the tags and logs of the span are compressed
+func IsCompressed(span *Span) bool {
+	return len(span.Tags) == 1 && span.Tags[0].Key == compressedPayloadKey
+}
+
+// DecompressSpan restores the tags, logs and process tags of a span written by CompressSpan,
+// whatever the algorithm. Spans that are not compressed are left as is.
+func DecompressSpan(span *Span) error {
+	if !IsCompressed(span) {
+		return nil
+	}
+	tag := span.Tags[0]
+	payload, err := decompress(tag.ValueBinary, Compression(tag.ValueString))
+	if err != nil {
+		return err
+	}
+	var decoded compressedPayload
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		return errors.Wrap(err, "Failed to deserialize span payload")
+	}
+	span.Tags = decoded.Tags
+	span.Logs = decoded.Logs
+	span.Process.Tags = decoded.ProcessTags
+	return nil
+}
+
+func compress(payload []byte, compression Compression) ([]byte, error) {
+	switch compression {
+	case GzipCompression:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(payload); err != nil {
+			return nil, errors.Wrap(err, "Failed to compress span")
+		}
+		if err := w.Close(); err != nil {
+			return nil, errors.Wrap(err, "Failed to compress span")
+		}
+		return buf.Bytes(), nil
+	case ZstdCompression:
+		return zstdEncoder.EncodeAll(payload, nil), nil
+	}
+	return nil, fmt.Errorf("Unknown span compression %q", compression)
+}
+
+func decompress(compressed []byte, compression Compression) ([]byte, error) {
+	switch compression {
+	case GzipCompression:
+		r, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to decompress span")
+		}
+		defer r.Close()
+		payload, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to decompress span")
+		}
+		return payload, nil
+	case ZstdCompression:
+		payload, err := zstdDecoder.DecodeAll(compressed, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to decompress span")
+		}
+		return payload, nil
+	}
+	return nil, fmt.Errorf("Unknown span compression %q", compression)
+}
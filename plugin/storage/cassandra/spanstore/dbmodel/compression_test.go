@@ -0,0 +1,136 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dbmodel
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/jaeger/model"
+)
+
+func repetitiveSpan() *model.Span {
+	span := &model.Span{
+		TraceID:       model.TraceID{Low: 1},
+		SpanID:        model.SpanID(2),
+		OperationName: "GET /",
+		Process: &model.Process{
+			ServiceName: "frontend",
+			Tags:        model.KeyValues{model.String("hostname", "host-1")},
+		},
+		Logs: []model.Log{
+			{Fields: model.KeyValues{model.String("event", "retry")}},
+		},
+	}
+	for i := 0; i < 20; i++ {
+		span.Tags = append(span.Tags, model.String(fmt.Sprintf("sql.query.%d", i), "SELECT * FROM customers WHERE id = ?"))
+	}
+	return span
+}
+
+func TestParseCompression(t *testing.T) {
+	for _, name := range []string{"", "none"} {
+		compression, err := ParseCompression(name)
+		assert.NoError(t, err)
+		assert.Equal(t, NoCompression, compression)
+	}
+	for _, compression := range []Compression{GzipCompression, ZstdCompression} {
+		parsed, err := ParseCompression(string(compression))
+		assert.NoError(t, err)
+		assert.Equal(t, compression, parsed)
+	}
+	_, err := ParseCompression("lz4")
+	assert.EqualError(t, err, `Unknown span compression "lz4"`)
+}
+
+func TestCompressSpanRoundTrip(t *testing.T) {
+	for _, compression := range []Compression{GzipCompression, ZstdCompression} {
+		t.Run(string(compression), func(t *testing.T) {
+			span := repetitiveSpan()
+			expected := FromDomain(span)
+			dbSpan := FromDomain(span)
+
+			bytesIn, bytesOut, err := CompressSpan(dbSpan, compression)
+			require.NoError(t, err)
+			assert.True(t, bytesOut < bytesIn, "compressed %d bytes to %d", bytesIn, bytesOut)
+			assert.True(t, IsCompressed(dbSpan))
+			assert.Len(t, dbSpan.Tags, 1)
+			assert.Empty(t, dbSpan.Logs)
+			assert.Empty(t, dbSpan.Process.Tags)
+			assert.Equal(t, "frontend", dbSpan.Process.ServiceName, "the service name is not compressed")
+
+			require.NoError(t, DecompressSpan(dbSpan))
+			assert.Equal(t, expected, dbSpan)
+			domainSpan, err := ToDomain(dbSpan)
+			require.NoError(t, err)
+			assert.Equal(t, span.Tags, domainSpan.Tags)
+		})
+	}
+}
+
+func TestCompressSpanNotSmaller(t *testing.T) {
+	// even a single tag compresses a little since the fields of KeyValue repeat "Value",
+	// only a span without tags and logs is smaller than the gzip header
+	span := &model.Span{
+		TraceID: model.TraceID{Low: 1},
+		Process: &model.Process{ServiceName: "frontend"},
+	}
+	for _, compression := range []Compression{GzipCompression, ZstdCompression} {
+		dbSpan := FromDomain(span)
+		bytesIn, bytesOut, err := CompressSpan(dbSpan, compression)
+		require.NoError(t, err)
+		assert.Equal(t, bytesIn, bytesOut, string(compression))
+		assert.False(t, IsCompressed(dbSpan), "spans that do not get smaller are stored uncompressed")
+	}
+}
+
+func TestCompressSpanNoCompression(t *testing.T) {
+	dbSpan := FromDomain(repetitiveSpan())
+	bytesIn, bytesOut, err := CompressSpan(dbSpan, NoCompression)
+	require.NoError(t, err)
+	assert.Equal(t, 0, bytesIn)
+	assert.Equal(t, 0, bytesOut)
+	assert.False(t, IsCompressed(dbSpan))
+}
+
+func TestDecompressSpanUncompressed(t *testing.T) {
+	dbSpan := FromDomain(repetitiveSpan())
+	expected := FromDomain(repetitiveSpan())
+	assert.NoError(t, DecompressSpan(dbSpan))
+	assert.Equal(t, expected, dbSpan)
+}
+
+func TestDecompressSpanCorrupted(t *testing.T) {
+	for _, compression := range []Compression{GzipCompression, ZstdCompression, "lz4"} {
+		dbSpan := &Span{
+			Tags: []KeyValue{{
+				Key:         compressedPayloadKey,
+				ValueType:   model.BinaryType.String(),
+				ValueString: string(compression),
+				ValueBinary: []byte("garbage"),
+			}},
+		}
+		assert.Error(t, DecompressSpan(dbSpan), string(compression))
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dbmodel
+
+import (
+	"github.com/uber/jaeger/model"
+)
+
+// serializedSpanKey is the key of the single tag replacing the tags, logs and references of a span
+// serialized by a codec, the payload with its format header byte is stored as the binary value.
+const serializedSpanKey = "$$jaeger.serialized"
+
+// SetSerializedSpan replaces the tags, logs, references and process tags of the span with the
+// span serialized by a codec. The other columns are kept since the indexes and queries rely on them.
+func SetSerializedSpan(span *Span, data []byte) {
+	span.Tags = []KeyValue{{
+		Key:         serializedSpanKey,
+		ValueType:   model.BinaryType.String(),
+		ValueBinary: data,
+	}}
+	span.Logs = nil
+	span.Refs = nil
+	span.Process.Tags = nil
+}
+
+// SerializedSpan returns the payload of a span written by SetSerializedSpan
+func SerializedSpan(span *Span) ([]byte, bool) {
+	if len(span.Tags) == 1 && span.Tags[0].Key == serializedSpanKey {
+		return span.Tags[0].ValueBinary, true
+	}
+	return nil, false
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dbmodel
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSerializedSpan(t *testing.T) {
+	span := FromDomain(repetitiveSpan())
+	_, ok := SerializedSpan(span)
+	assert.False(t, ok)
+
+	SetSerializedSpan(span, []byte{3, 1, 2})
+	data, ok := SerializedSpan(span)
+	require.True(t, ok)
+	assert.Equal(t, []byte{3, 1, 2}, data)
+	assert.Len(t, span.Tags, 1)
+	assert.Nil(t, span.Logs)
+	assert.Nil(t, span.Refs)
+	assert.Nil(t, span.Process.Tags)
+	assert.Equal(t, "frontend", span.Process.ServiceName)
+	assert.Equal(t, "GET /", span.OperationName)
+}
+
+func TestSerializedSpanCompressed(t *testing.T) {
+	span := FromDomain(repetitiveSpan())
+	payload := bytes.Repeat([]byte("SELECT * FROM customers WHERE id = ?"), 10)
+	SetSerializedSpan(span, payload)
+	_, _, err := CompressSpan(span, GzipCompression)
+	require.NoError(t, err)
+	require.True(t, IsCompressed(span))
+	require.NoError(t, DecompressSpan(span))
+
+	data, ok := SerializedSpan(span)
+	require.True(t, ok)
+	assert.Equal(t, payload, data)
+}
@@ -0,0 +1,304 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/pkg/cassandra"
+	"github.com/uber/jaeger/plugin/storage/cassandra/spanstore/dbmodel"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+const (
+	queryDeletionCandidates = `
+		SELECT trace_id
+		FROM tag_index
+		WHERE service_name = ? AND tag_key = ? AND tag_value = ? and start_time > ? and start_time < ?`
+	queryPromotedDeletionCandidates = `
+		SELECT trace_id
+		FROM service_promoted_tag_index
+		WHERE bucket IN ` + bucketRange + ` AND service_name = ? AND tag_key = ? AND tag_value = ? AND start_time > ? AND start_time < ?`
+	queryServiceDeletionCandidates = `
+		SELECT trace_id
+		FROM service_name_index
+		WHERE bucket IN ` + bucketRange + ` AND service_name = ? AND start_time > ? AND start_time < ?`
+	deleteSpan = `
+		DELETE
+		FROM traces
+		WHERE trace_id = ? AND span_id = ?`
+	deleteBucketSpan = `
+		DELETE
+		FROM trace_buckets
+		WHERE trace_id = ? AND bucket = ? AND span_id = ?`
+	deleteTag = `
+		DELETE
+		FROM tag_index
+		WHERE service_name = ? AND tag_key = ? AND tag_value = ? AND start_time = ? AND trace_id = ? AND span_id = ?`
+	deletePromotedTag = `
+		DELETE
+		FROM service_promoted_tag_index
+		WHERE service_name = ? AND tag_key = ? AND tag_value = ? AND bucket IN ` + bucketRange + ` AND start_time = ? AND trace_id = ? AND span_id = ?`
+	queryServiceNameIndexEntries = `
+		SELECT bucket, trace_id
+		FROM service_name_index
+		WHERE bucket IN ` + bucketRange + ` AND service_name = ? AND start_time = ?`
+	deleteServiceNameIndexEntry = `
+		DELETE
+		FROM service_name_index
+		WHERE service_name = ? AND bucket = ? AND start_time = ?`
+	querySpanKindIndexEntries = `
+		SELECT bucket, trace_id
+		FROM service_span_kind_index
+		WHERE service_name = ? AND span_kind = ? AND bucket IN ` + bucketRange + ` AND start_time = ?`
+	deleteSpanKindIndexEntry = `
+		DELETE
+		FROM service_span_kind_index
+		WHERE service_name = ? AND span_kind = ? AND bucket = ? AND start_time = ?`
+	queryOperationIndexEntry = `
+		SELECT trace_id
+		FROM service_operation_index
+		WHERE service_name = ? AND operation_name = ? AND start_time = ?`
+	deleteOperationIndexEntry = `
+		DELETE
+		FROM service_operation_index
+		WHERE service_name = ? AND operation_name = ? AND start_time = ?`
+	deleteDurationIndexEntry = `
+		DELETE
+		FROM duration_index
+		WHERE service_name = ? AND operation_name = ? AND bucket = ? AND duration = ? AND start_time = ? AND trace_id = ?`
+)
+
+// deletionCandidates are the IDs of the traces looked up for a deletion, in the order they were found
+type deletionCandidates struct {
+	traceIDs []dbmodel.TraceID
+	seen     map[dbmodel.TraceID]struct{}
+}
+
+func (c *deletionCandidates) add(traceID dbmodel.TraceID) {
+	if _, ok := c.seen[traceID]; !ok {
+		c.seen[traceID] = struct{}{}
+		c.traceIDs = append(c.traceIDs, traceID)
+	}
+}
+
+// DeleteSpans implements spanstore.Deleter. The traces of each service carrying the indexed tag of the query
+// within the time range are range-scanned from the tag index, and from the promoted tag index if the tag is
+// promoted, or from the service name index if the writers do not index the tag. Their matching spans are then
+// deleted from the partitions they are stored in, along with their entries in all the indices.
+func (s *SpanReader) DeleteSpans(query *spanstore.DeleteQueryParameters) (int, error) {
+	if err := query.Validate(); err != nil {
+		return 0, err
+	}
+	services := query.ServiceNames
+	if len(services) == 0 {
+		var err error
+		if services, err = s.serviceNamesReader(); err != nil {
+			return 0, err
+		}
+	}
+	candidates := &deletionCandidates{seen: make(map[dbmodel.TraceID]struct{})}
+	for _, service := range services {
+		if err := s.findDeletionCandidates(service, query, candidates); err != nil {
+			return 0, err
+		}
+	}
+	pacer := spanstore.NewDeletePacer(query)
+	deleted := 0
+	for _, traceID := range candidates.traceIDs {
+		n, err := s.deleteTraceSpans(traceID, query, pacer)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// findDeletionCandidates adds the IDs of the traces of the service that can have spans with the indexed tag of
+// the query, from the promoted tag index too if the tag is promoted. All the traces of the service are candidates
+// if the writers could not index the tag.
+func (s *SpanReader) findDeletionCandidates(service string, query *spanstore.DeleteQueryParameters, candidates *deletionCandidates) error {
+	k, v := query.IndexedTag()
+	// the bounds of the index queries are exclusive
+	startTimeMin := int64(model.TimeAsEpochMicroseconds(query.StartTimeMin)) - 1
+	startTimeMax := int64(model.TimeAsEpochMicroseconds(query.StartTimeMax)) + 1
+	var queries []cassandra.Query
+	if shouldIndexTag(dbmodel.TagInsertion{ServiceName: service, TagKey: k, TagValue: v}) {
+		queries = append(queries, s.session.Query(queryDeletionCandidates, service, k, v, startTimeMin, startTimeMax))
+		if s.promotedTags.contains(k) {
+			queries = append(queries, s.session.Query(queryPromotedDeletionCandidates, service, k, v, startTimeMin, startTimeMax).PageSize(0))
+		}
+	} else {
+		queries = append(queries, s.session.Query(queryServiceDeletionCandidates, service, startTimeMin, startTimeMax).PageSize(0))
+	}
+	for _, q := range queries {
+		i := q.Consistency(s.consistency).Iter()
+		var traceID dbmodel.TraceID
+		for i.Scan(&traceID) {
+			candidates.add(traceID)
+		}
+		if err := i.Close(); err != nil {
+			return errors.Wrap(err, "Error reading the index for the deletion")
+		}
+	}
+	return nil
+}
+
+// deleteTraceSpans deletes the spans of the trace matching the query from the traces table and the trace buckets
+func (s *SpanReader) deleteTraceSpans(traceID dbmodel.TraceID, query *spanstore.DeleteQueryParameters, pacer *spanstore.DeletePacer) (int, error) {
+	// the entries of the indices outlive the spans deleted by a previous deletion, whose partitions are then empty
+	deleted, err := s.deletePartitionSpans(traceID, s.session.Query(querySpanByTraceID, traceID), query, pacer, func(spanID int64) cassandra.Query {
+		return s.session.Query(deleteSpan, traceID, spanID)
+	})
+	if err != nil || !s.bucketing {
+		return deleted, err
+	}
+	buckets, err := s.traceBuckets(traceID)
+	if err != nil {
+		return deleted, err
+	}
+	for _, bucket := range buckets {
+		bucket := bucket // capture loop var
+		n, err := s.deletePartitionSpans(traceID, s.session.Query(querySpanByTraceBucket, traceID, bucket), query, pacer, func(spanID int64) cassandra.Query {
+			return s.session.Query(deleteBucketSpan, traceID, bucket, spanID)
+		})
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// deletePartitionSpans deletes the spans matching the query among those read from a partition of the trace,
+// with the queries deleting their rows from that partition
+func (s *SpanReader) deletePartitionSpans(
+	traceID dbmodel.TraceID,
+	read cassandra.Query,
+	query *spanstore.DeleteQueryParameters,
+	pacer *spanstore.DeletePacer,
+	deleteRow func(spanID int64) cassandra.Query,
+) (int, error) {
+	partition := &model.Trace{}
+	if err := s.readSpans(partition, read); err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, span := range partition.Spans {
+		if !query.Matches(span) {
+			continue
+		}
+		pacer.Wait(1)
+		if err := deleteRow(int64(span.SpanID)).Exec(); err != nil {
+			return deleted, errors.Wrap(err, "Failed to delete span")
+		}
+		if err := s.deleteIndexEntries(traceID, span); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// deleteIndexEntries deletes the entries of the span from all the indices
+func (s *SpanReader) deleteIndexEntries(traceID dbmodel.TraceID, span *model.Span) error {
+	spanID := int64(span.SpanID)
+	startTime := int64(model.TimeAsEpochMicroseconds(span.StartTime))
+	for _, tag := range dbmodel.GetAllUniqueTags(span) {
+		query := s.session.Query(deleteTag, tag.ServiceName, tag.TagKey, tag.TagValue, startTime, traceID, spanID)
+		if err := query.Exec(); err != nil {
+			return errors.Wrap(err, "Failed to delete tag index entry")
+		}
+		if s.promotedTags.contains(tag.TagKey) {
+			query := s.session.Query(deletePromotedTag, tag.ServiceName, tag.TagKey, tag.TagValue, startTime, traceID, spanID)
+			if err := query.Exec(); err != nil {
+				return errors.Wrap(err, "Failed to delete promoted tag index entry")
+			}
+		}
+	}
+	service := span.Process.ServiceName
+	if err := s.deleteBucketedIndexEntry(queryServiceNameIndexEntries, deleteServiceNameIndexEntry, traceID, startTime, service); err != nil {
+		return errors.Wrap(err, "Failed to delete service name index entry")
+	}
+	kind := string(span.GetSpanKind())
+	if err := s.deleteBucketedIndexEntry(querySpanKindIndexEntries, deleteSpanKindIndexEntry, traceID, startTime, service, kind); err != nil {
+		return errors.Wrap(err, "Failed to delete span kind index entry")
+	}
+	if err := s.deleteOperationIndexEntry(traceID, startTime, service, span.OperationName); err != nil {
+		return errors.Wrap(err, "Failed to delete operation name index entry")
+	}
+	timeBucket := span.StartTime.Round(durationBucketSize)
+	duration := int64(model.DurationAsMicroseconds(span.Duration))
+	// the spans are indexed by service name alone and by service and operation names
+	for _, operationName := range []string{"", span.OperationName} {
+		query := s.session.Query(deleteDurationIndexEntry, service, operationName, timeBucket, duration, startTime, traceID)
+		if err := query.Exec(); err != nil {
+			return errors.Wrap(err, "Failed to delete duration index entry")
+		}
+	}
+	return nil
+}
+
+// deleteBucketedIndexEntry deletes the entry of the trace at the start time from an index whose partitions are
+// spread over buckets, looking up the buckets holding it. The entries of other traces started at the same time
+// are kept, the keys of the index not including the trace ID.
+func (s *SpanReader) deleteBucketedIndexEntry(lookup, deletion string, traceID dbmodel.TraceID, startTime int64, partition ...interface{}) error {
+	lookupValues := append(append([]interface{}{}, partition...), startTime)
+	i := s.session.Query(lookup, lookupValues...).Consistency(s.consistency).Iter()
+	var buckets []int
+	var bucket int
+	var entryTraceID dbmodel.TraceID
+	for i.Scan(&bucket, &entryTraceID) {
+		if entryTraceID == traceID {
+			buckets = append(buckets, bucket)
+		}
+	}
+	if err := i.Close(); err != nil {
+		return err
+	}
+	for _, bucket := range buckets {
+		deletionValues := append(append([]interface{}{}, partition...), bucket, startTime)
+		if err := s.session.Query(deletion, deletionValues...).Exec(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteOperationIndexEntry deletes the entry of the trace at the start time from the operation name index,
+// unless it is the entry of another trace started at the same time
+func (s *SpanReader) deleteOperationIndexEntry(traceID dbmodel.TraceID, startTime int64, service, operationName string) error {
+	i := s.session.Query(queryOperationIndexEntry, service, operationName, startTime).Consistency(s.consistency).Iter()
+	found := false
+	var entryTraceID dbmodel.TraceID
+	for i.Scan(&entryTraceID) {
+		found = found || entryTraceID == traceID
+	}
+	if err := i.Close(); err != nil {
+		return err
+	}
+	if !found {
+		return nil
+	}
+	return s.session.Query(deleteOperationIndexEntry, service, operationName, startTime).Exec()
+}
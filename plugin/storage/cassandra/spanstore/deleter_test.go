@@ -0,0 +1,250 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/pkg/cassandra"
+	"github.com/uber/jaeger/pkg/cassandra/mocks"
+	"github.com/uber/jaeger/plugin/storage/cassandra/spanstore/dbmodel"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+var _ spanstore.Deleter = &SpanReader{} // check API conformance
+
+func TestSpanReaderDeleteSpans(t *testing.T) {
+	startTime := model.EpochMicrosecondsAsTime(1485467191639875)
+	startMicros := int64(model.TimeAsEpochMicroseconds(startTime))
+	deleteQuery := &spanstore.DeleteQueryParameters{
+		Tags:         map[string]string{"user.id": "x"},
+		StartTimeMin: startTime.Add(-time.Hour),
+		StartTimeMax: startTime.Add(time.Hour),
+	}
+	readQuery := func(scans ...func(args []interface{})) *mocks.Query {
+		iter := &mocks.Iterator{}
+		for _, scan := range scans {
+			iter.On("Scan", matchOnceWithSideEffect(scan)).Return(true)
+		}
+		iter.On("Scan", matchEverything()).Return(false)
+		iter.On("Close").Return(nil)
+		query := &mocks.Query{}
+		query.On("Consistency", cassandra.One).Return(query)
+		query.On("PageSize", 0).Return(query)
+		query.On("Iter").Return(iter)
+		return query
+	}
+	spanRow := func(spanID int64, userID string) func(args []interface{}) {
+		return func(args []interface{}) {
+			*args[1].(*int64) = spanID
+			*args[3].(*string) = "op"
+			*args[5].(*int64) = startMicros
+			*args[7].(*[]dbmodel.KeyValue) = []dbmodel.KeyValue{
+				{Key: "user.id", ValueType: model.StringType.String(), ValueString: userID},
+			}
+			*args[10].(*dbmodel.Process) = dbmodel.Process{ServiceName: "service-a"}
+		}
+	}
+	entryRow := func(bucket int, traceID dbmodel.TraceID) func(args []interface{}) {
+		return func(args []interface{}) {
+			*args[0].(*int) = bucket
+			*args[1].(*dbmodel.TraceID) = traceID
+		}
+	}
+	execQuery := func(err error) *mocks.Query {
+		query := &mocks.Query{}
+		query.On("Exec").Return(err)
+		return query
+	}
+	// mockIndexDeletions mocks the deletions of the entries of the spans from the indices without the tags
+	mockIndexDeletions := func(session *mocks.Session) {
+		session.On("Query", stringMatcher(queryServiceNameIndexEntries), matchEverything()).Return(readQuery())
+		session.On("Query", stringMatcher(querySpanKindIndexEntries), matchEverything()).Return(readQuery())
+		session.On("Query", stringMatcher(queryOperationIndexEntry), matchEverything()).Return(readQuery())
+		session.On("Query", stringMatcher(deleteDurationIndexEntry), matchEverything()).Return(execQuery(nil))
+	}
+
+	t.Run("deleted", func(t *testing.T) {
+		session := &mocks.Session{}
+		reader := NewSpanReader(session, metrics.NullFactory, zap.NewNop())
+		reader.serviceNamesReader = func() ([]string, error) { return []string{"service-a"}, nil }
+		// the trace is listed by the index for both of its spans
+		session.On("Query", stringMatcher(queryDeletionCandidates), matchEverything()).
+			Return(readQuery(func([]interface{}) {}, func([]interface{}) {}))
+		session.On("Query", stringMatcher(querySpanByTraceID), matchEverything()).
+			Return(readQuery(spanRow(1, "x"), spanRow(2, "y")))
+		deleteSpanQuery := execQuery(nil)
+		session.On("Query", stringMatcher(deleteSpan), []interface{}{dbmodel.TraceID{}, int64(1)}).Return(deleteSpanQuery)
+		deleteTagQuery := execQuery(nil)
+		session.On("Query", stringMatcher(deleteTag), []interface{}{
+			"service-a", "user.id", "x", startMicros, dbmodel.TraceID{}, int64(1),
+		}).Return(deleteTagQuery)
+		// the entry of another trace started at the same time is kept
+		session.On("Query", stringMatcher(queryServiceNameIndexEntries), []interface{}{"service-a", startMicros}).
+			Return(readQuery(entryRow(3, dbmodel.TraceID{}), entryRow(4, dbmodel.TraceIDFromDomain(model.TraceID{Low: 2}))))
+		deleteServiceQuery := execQuery(nil)
+		session.On("Query", stringMatcher(deleteServiceNameIndexEntry), []interface{}{"service-a", 3, startMicros}).
+			Return(deleteServiceQuery)
+		session.On("Query", stringMatcher(querySpanKindIndexEntries), []interface{}{"service-a", "unspecified", startMicros}).
+			Return(readQuery(entryRow(5, dbmodel.TraceID{})))
+		deleteSpanKindQuery := execQuery(nil)
+		session.On("Query", stringMatcher(deleteSpanKindIndexEntry), []interface{}{"service-a", "unspecified", 5, startMicros}).
+			Return(deleteSpanKindQuery)
+		session.On("Query", stringMatcher(queryOperationIndexEntry), []interface{}{"service-a", "op", startMicros}).
+			Return(readQuery(func(args []interface{}) { *args[0].(*dbmodel.TraceID) = dbmodel.TraceID{} }))
+		deleteOperationQuery := execQuery(nil)
+		session.On("Query", stringMatcher(deleteOperationIndexEntry), []interface{}{"service-a", "op", startMicros}).
+			Return(deleteOperationQuery)
+		deleteDurationQuery := execQuery(nil)
+		session.On("Query", stringMatcher(deleteDurationIndexEntry), matchEverything()).Return(deleteDurationQuery)
+
+		deleted, err := reader.DeleteSpans(deleteQuery)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, deleted)
+		deleteSpanQuery.AssertNumberOfCalls(t, "Exec", 1)
+		deleteTagQuery.AssertNumberOfCalls(t, "Exec", 1)
+		deleteServiceQuery.AssertNumberOfCalls(t, "Exec", 1)
+		deleteSpanKindQuery.AssertNumberOfCalls(t, "Exec", 1)
+		deleteOperationQuery.AssertNumberOfCalls(t, "Exec", 1)
+		// by service name alone and by service and operation names
+		deleteDurationQuery.AssertNumberOfCalls(t, "Exec", 2)
+		session.AssertNotCalled(t, "Query", stringMatcher(queryPromotedDeletionCandidates), matchEverything())
+	})
+
+	t.Run("promoted", func(t *testing.T) {
+		session := &mocks.Session{}
+		reader := NewSpanReader(session, metrics.NullFactory, zap.NewNop(), ReaderOptions.PromotedTags([]string{"user.id"}))
+		session.On("Query", stringMatcher(queryDeletionCandidates), matchEverything()).Return(readQuery())
+		// the promoted tag index of the service of the query is read
+		session.On("Query", stringMatcher(queryPromotedDeletionCandidates), mock.MatchedBy(func(v []interface{}) bool {
+			return len(v) > 2 && v[0] == "service-a" && v[1] == "user.id" && v[2] == "x"
+		})).Return(readQuery(func(args []interface{}) {}))
+		session.On("Query", stringMatcher(querySpanByTraceID), []interface{}{dbmodel.TraceID{}}).Return(readQuery(spanRow(1, "x")))
+		session.On("Query", stringMatcher(deleteSpan), matchEverything()).Return(execQuery(nil))
+		session.On("Query", stringMatcher(deleteTag), matchEverything()).Return(execQuery(nil))
+		deletePromotedQuery := execQuery(nil)
+		session.On("Query", stringMatcher(deletePromotedTag), []interface{}{"service-a", "user.id", "x", startMicros, dbmodel.TraceID{}, int64(1)}).
+			Return(deletePromotedQuery)
+		mockIndexDeletions(session)
+
+		query := *deleteQuery
+		query.ServiceNames = []string{"service-a"}
+		deleted, err := reader.DeleteSpans(&query)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, deleted)
+		deletePromotedQuery.AssertNumberOfCalls(t, "Exec", 1)
+	})
+
+	t.Run("unindexed tag", func(t *testing.T) {
+		session := &mocks.Session{}
+		reader := NewSpanReader(session, metrics.NullFactory, zap.NewNop())
+		reader.serviceNamesReader = func() ([]string, error) { return []string{"service-a"}, nil }
+		// the writers do not index JSON values, so all the traces of the service are scanned
+		session.On("Query", stringMatcher(queryServiceDeletionCandidates), matchEverything()).
+			Return(readQuery(func([]interface{}) {}))
+		session.On("Query", stringMatcher(querySpanByTraceID), matchEverything()).Return(readQuery(spanRow(1, "x")))
+
+		query := *deleteQuery
+		query.Tags = map[string]string{"user.id": `{"id":"x"}`}
+		deleted, err := reader.DeleteSpans(&query)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, deleted)
+		session.AssertNotCalled(t, "Query", stringMatcher(queryDeletionCandidates), matchEverything())
+	})
+
+	t.Run("bucketed", func(t *testing.T) {
+		session := &mocks.Session{}
+		reader := NewSpanReader(session, metrics.NullFactory, zap.NewNop(), ReaderOptions.Bucketing())
+		reader.serviceNamesReader = func() ([]string, error) { return []string{"service-a"}, nil }
+		session.On("Query", stringMatcher(queryDeletionCandidates), matchEverything()).Return(readQuery(func([]interface{}) {}))
+		session.On("Query", stringMatcher(querySpanByTraceID), matchEverything()).Return(readQuery())
+		session.On("Query", stringMatcher(queryTraceBuckets), matchEverything()).
+			Return(readQuery(func(args []interface{}) { *args[0].(*int) = 1 }))
+		session.On("Query", stringMatcher(querySpanByTraceBucket), matchEverything()).Return(readQuery(spanRow(1, "x")))
+		deleteBucketQuery := execQuery(nil)
+		session.On("Query", stringMatcher(deleteBucketSpan), []interface{}{dbmodel.TraceID{}, 1, int64(1)}).Return(deleteBucketQuery)
+		session.On("Query", stringMatcher(deleteTag), matchEverything()).Return(execQuery(nil))
+		mockIndexDeletions(session)
+
+		deleted, err := reader.DeleteSpans(deleteQuery)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, deleted)
+		deleteBucketQuery.AssertNumberOfCalls(t, "Exec", 1)
+		// the span is only deleted from the partition it is stored in
+		session.AssertNotCalled(t, "Query", stringMatcher(deleteSpan), matchEverything())
+	})
+
+	t.Run("already deleted", func(t *testing.T) {
+		session := &mocks.Session{}
+		reader := NewSpanReader(session, metrics.NullFactory, zap.NewNop())
+		reader.serviceNamesReader = func() ([]string, error) { return []string{"service-a"}, nil }
+		session.On("Query", stringMatcher(queryDeletionCandidates), matchEverything()).Return(readQuery(func([]interface{}) {}))
+		session.On("Query", stringMatcher(querySpanByTraceID), matchEverything()).Return(readQuery())
+
+		deleted, err := reader.DeleteSpans(deleteQuery)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, deleted)
+	})
+
+	t.Run("delete error", func(t *testing.T) {
+		session := &mocks.Session{}
+		reader := NewSpanReader(session, metrics.NullFactory, zap.NewNop())
+		reader.serviceNamesReader = func() ([]string, error) { return []string{"service-a"}, nil }
+		session.On("Query", stringMatcher(queryDeletionCandidates), matchEverything()).Return(readQuery(func([]interface{}) {}))
+		session.On("Query", stringMatcher(querySpanByTraceID), matchEverything()).Return(readQuery(spanRow(1, "x")))
+		session.On("Query", stringMatcher(deleteSpan), matchEverything()).Return(execQuery(errors.New("timeout")))
+
+		deleted, err := reader.DeleteSpans(deleteQuery)
+		assert.EqualError(t, err, "Failed to delete span: timeout")
+		assert.Equal(t, 0, deleted)
+	})
+
+	t.Run("index entry delete error", func(t *testing.T) {
+		session := &mocks.Session{}
+		reader := NewSpanReader(session, metrics.NullFactory, zap.NewNop())
+		reader.serviceNamesReader = func() ([]string, error) { return []string{"service-a"}, nil }
+		session.On("Query", stringMatcher(queryDeletionCandidates), matchEverything()).Return(readQuery(func([]interface{}) {}))
+		session.On("Query", stringMatcher(querySpanByTraceID), matchEverything()).Return(readQuery(spanRow(1, "x")))
+		session.On("Query", stringMatcher(deleteSpan), matchEverything()).Return(execQuery(nil))
+		session.On("Query", stringMatcher(deleteTag), matchEverything()).Return(execQuery(nil))
+		session.On("Query", stringMatcher(queryServiceNameIndexEntries), matchEverything()).
+			Return(readQuery(entryRow(3, dbmodel.TraceID{})))
+		session.On("Query", stringMatcher(deleteServiceNameIndexEntry), matchEverything()).Return(execQuery(errors.New("timeout")))
+
+		deleted, err := reader.DeleteSpans(deleteQuery)
+		assert.EqualError(t, err, "Failed to delete service name index entry: timeout")
+		assert.Equal(t, 0, deleted)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		reader := NewSpanReader(&mocks.Session{}, metrics.NullFactory, zap.NewNop())
+		_, err := reader.DeleteSpans(&spanstore.DeleteQueryParameters{})
+		assert.EqualError(t, err, spanstore.ErrDeleteTagsNotSet.Error())
+	})
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/pkg/cache"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+const (
+	// DefaultErrorTraceWindow is the default time the written spans of a trace are remembered for an error span
+	DefaultErrorTraceWindow = 5 * time.Second
+
+	// DefaultErrorTraceMaxTraces is the default number of traces whose written spans are remembered
+	DefaultErrorTraceMaxTraces = 10000
+
+	// maxSpansPerTrace is the number of written spans remembered for each trace, so that a huge trace does not
+	// take the memory of the others
+	maxSpansPerTrace = 100
+
+	// errorTracesRetention is the number of windows the error traces are remembered for, so that their
+	// late spans are kept as long as the others
+	errorTracesRetention = 10
+)
+
+// ErrErrorTraceWriterClosed is returned by WriteSpan once the ErrorTraceWriter is closed
+var ErrErrorTraceWriterClosed = errors.New("The error trace writer is closed")
+
+type errorTraceMetrics struct {
+	// ExtendedSpans counts the spans written with the TTL of the error traces
+	ExtendedSpans metrics.Counter `metric:"extended-ttl-spans"`
+	// Traces counts the traces found to have an error span
+	Traces metrics.Counter `metric:"traces"`
+	// Failures counts the spans of error traces the SpanWriter failed to rewrite with the error TTL
+	Failures metrics.Counter `metric:"failed-writes"`
+	// ForgottenSpans counts the written spans not remembered because their trace had too many of them, which
+	// keep their usual TTL if their trace has an error span
+	ForgottenSpans metrics.Counter `metric:"forgotten-spans"`
+}
+
+// ErrorTraceWriter keeps the traces with an error span, i.e. a span with the error tag set to true, for
+// longer than the TTL of their services. Every span is written right away, so that it is stored once
+// WriteSpan returns, and remembered until a window elapsed without a span of its trace. When a span of a
+// trace has an error, the remembered spans of the trace are written again with the error TTL, like the error
+// span and the later spans of the trace. The forgotten spans of a trace keep their usual TTL, whether their
+// window elapsed or the least recently used traces were evicted beyond DefaultErrorTraceMaxTraces.
+type ErrorTraceWriter struct {
+	writer   *SpanWriter
+	errorTTL time.Duration
+	logger   *zap.Logger
+	metrics  errorTraceMetrics
+
+	sync.Mutex
+	// written holds the spans written with their usual TTL of the recent traces, by trace ID
+	written *cache.LRU
+	// errorTraces holds the recent traces with an error span
+	errorTraces *cache.LRU
+	closed      bool
+}
+
+// NewErrorTraceWriter creates an ErrorTraceWriter writing the spans of error traces with errorTTL, or the
+// TTL of their service if longer, the written spans of each trace being remembered for the window,
+// DefaultErrorTraceWindow if zero.
+func NewErrorTraceWriter(
+	writer *SpanWriter,
+	errorTTL time.Duration,
+	window time.Duration,
+	metricsFactory metrics.Factory,
+	logger *zap.Logger,
+) *ErrorTraceWriter {
+	if window <= 0 {
+		window = DefaultErrorTraceWindow
+	}
+	w := &ErrorTraceWriter{
+		writer:      writer,
+		errorTTL:    errorTTL,
+		logger:      logger,
+		written:     cache.NewLRUWithOptions(DefaultErrorTraceMaxTraces, &cache.Options{TTL: window}),
+		errorTraces: cache.NewLRUWithOptions(DefaultErrorTraceMaxTraces, &cache.Options{TTL: errorTracesRetention * window}),
+	}
+	metrics.Init(&w.metrics, metricsFactory.Namespace("error-traces", nil), nil)
+	return w
+}
+
+// WriteSpan writes the span with its usual TTL and remembers it, or with the error TTL if its trace has an
+// error span, in which case the remembered spans of the trace are written again with the error TTL
+func (w *ErrorTraceWriter) WriteSpan(span *model.Span) error {
+	key := span.TraceID.String()
+	w.Lock()
+	if w.closed {
+		w.Unlock()
+		return ErrErrorTraceWriterClosed
+	}
+	if w.errorTraces.Get(key) != nil {
+		w.Unlock()
+		return w.writeExtended(span)
+	}
+	if !spanstore.IsErrorSpan(span) {
+		w.Unlock()
+		if err := w.writer.WriteSpan(span); err != nil {
+			return err
+		}
+		w.remember(key, span)
+		return nil
+	}
+	w.errorTraces.Put(key, true)
+	var written []*model.Span
+	if spans, ok := w.written.Get(key).([]*model.Span); ok {
+		written = spans
+		w.written.Delete(key)
+	}
+	w.Unlock()
+	w.metrics.Traces.Inc(1)
+	for _, span := range written {
+		// the span is already stored with its usual TTL, so the failure is not returned
+		if err := w.writeExtended(span); err != nil {
+			w.metrics.Failures.Inc(1)
+			w.logger.Error("Failed to write span of error trace with the error TTL", zap.Error(err))
+		}
+	}
+	return w.writeExtended(span)
+}
+
+// remember keeps the span written with its usual TTL, unless its trace has an error span since it was written
+func (w *ErrorTraceWriter) remember(key string, span *model.Span) {
+	w.Lock()
+	if w.errorTraces.Get(key) != nil {
+		w.Unlock()
+		if err := w.writeExtended(span); err != nil {
+			w.metrics.Failures.Inc(1)
+			w.logger.Error("Failed to write span of error trace with the error TTL", zap.Error(err))
+		}
+		return
+	}
+	defer w.Unlock()
+	spans, _ := w.written.Get(key).([]*model.Span)
+	if len(spans) >= maxSpansPerTrace {
+		w.metrics.ForgottenSpans.Inc(1)
+		return
+	}
+	w.written.Put(key, append(spans, span))
+}
+
+func (w *ErrorTraceWriter) writeExtended(span *model.Span) error {
+	w.metrics.ExtendedSpans.Inc(1)
+	return w.writer.writeSpan(span, w.errorTTL)
+}
+
+// Close stops accepting spans
+func (w *ErrorTraceWriter) Close() error {
+	w.Lock()
+	defer w.Unlock()
+	w.closed = true
+	return nil
+}
@@ -0,0 +1,208 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/pkg/cassandra/mocks"
+	"github.com/uber/jaeger/pkg/testutils"
+)
+
+// spanTTLRecorder records the TTL of the spans written to the traces table by their span ID
+type spanTTLRecorder struct {
+	sync.Mutex
+	ttls map[int64]interface{}
+}
+
+func (r *spanTTLRecorder) get(spanID int64) (interface{}, bool) {
+	r.Lock()
+	defer r.Unlock()
+	ttl, ok := r.ttls[spanID]
+	return ttl, ok
+}
+
+func newRecordingSpanWriter(metricsFactory metrics.Factory, logger *zap.Logger) (*SpanWriter, *spanTTLRecorder) {
+	session := &mocks.Session{}
+	writer := NewSpanWriter(session, 0, metricsFactory, logger, WriterOptions.TTL(
+		72*time.Hour,
+		map[string]time.Duration{"security": 90 * 24 * time.Hour},
+	))
+	writer.serviceNamesWriter = func(serviceName string) error { return nil }
+	writer.operationNamesWriter = func(serviceName, operationName string) error { return nil }
+
+	recorder := &spanTTLRecorder{ttls: make(map[int64]interface{})}
+	query := &mocks.Query{}
+	query.On("Bind", matchEverything()).Return(query)
+	query.On("Exec").Return(nil)
+	session.On("Query", stringMatcher(insertSpan), matchEverything()).Run(func(args mock.Arguments) {
+		v := args.Get(1).([]interface{})
+		recorder.Lock()
+		recorder.ttls[v[1].(int64)] = v[len(v)-1]
+		recorder.Unlock()
+	}).Return(query)
+	session.On("Query", mock.AnythingOfType("string"), matchEverything()).Return(query)
+	return writer, recorder
+}
+
+func newErrorTraceSpan(traceID uint64, spanID uint64, service string, tags ...model.KeyValue) *model.Span {
+	return &model.Span{
+		TraceID: model.TraceID{Low: traceID},
+		SpanID:  model.SpanID(spanID),
+		Tags:    tags,
+		Process: &model.Process{ServiceName: service},
+	}
+}
+
+func TestErrorTraceWriter(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	spanWriter, recorder := newRecordingSpanWriter(metricsFactory, zap.NewNop())
+	writer := NewErrorTraceWriter(spanWriter, 30*24*time.Hour, time.Hour, metricsFactory, zap.NewNop())
+
+	assert.NoError(t, writer.WriteSpan(newErrorTraceSpan(1, 1, "dev")))
+	assert.NoError(t, writer.WriteSpan(newErrorTraceSpan(2, 2, "dev", model.Bool("error", false))))
+	assert.NoError(t, writer.WriteSpan(newErrorTraceSpan(3, 3, "security")))
+	ttl, written := recorder.get(1)
+	require.True(t, written, "the spans are written right away")
+	assert.Equal(t, 72*3600, ttl)
+
+	assert.NoError(t, writer.WriteSpan(newErrorTraceSpan(1, 4, "dev", model.Bool("error", true))))
+	assert.NoError(t, writer.WriteSpan(newErrorTraceSpan(3, 5, "security", model.String("error", "true"))))
+	assert.NoError(t, writer.WriteSpan(newErrorTraceSpan(1, 6, "dev")))
+
+	require.NoError(t, writer.Close())
+	testCases := []struct {
+		spanID      int64
+		expectedTTL int
+	}{
+		{spanID: 1, expectedTTL: 30 * 24 * 3600},
+		{spanID: 2, expectedTTL: 72 * 3600},
+		// the TTL of the service is longer than the error TTL
+		{spanID: 3, expectedTTL: 90 * 24 * 3600},
+		{spanID: 4, expectedTTL: 30 * 24 * 3600},
+		{spanID: 5, expectedTTL: 90 * 24 * 3600},
+		{spanID: 6, expectedTTL: 30 * 24 * 3600},
+	}
+	for _, testCase := range testCases {
+		ttl, ok := recorder.get(testCase.spanID)
+		require.True(t, ok, "span %d", testCase.spanID)
+		assert.Equal(t, testCase.expectedTTL, ttl, "span %d", testCase.spanID)
+	}
+
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 5, counters["error-traces.extended-ttl-spans"])
+	assert.EqualValues(t, 2, counters["error-traces.traces"])
+
+	assert.Equal(t, ErrErrorTraceWriterClosed, writer.WriteSpan(newErrorTraceSpan(4, 7, "dev")))
+	assert.NoError(t, writer.Close())
+}
+
+func TestErrorTraceWriterWindow(t *testing.T) {
+	spanWriter, recorder := newRecordingSpanWriter(metrics.NullFactory, zap.NewNop())
+	writer := NewErrorTraceWriter(spanWriter, 30*24*time.Hour, 10*time.Millisecond, metrics.NullFactory, zap.NewNop())
+	defer writer.Close()
+
+	assert.NoError(t, writer.WriteSpan(newErrorTraceSpan(1, 1, "dev")))
+	time.Sleep(20 * time.Millisecond)
+
+	// the error span of a trace whose spans were forgotten is kept longer on its own
+	assert.NoError(t, writer.WriteSpan(newErrorTraceSpan(1, 2, "dev", model.Bool("error", true))))
+	ttl, ok := recorder.get(1)
+	require.True(t, ok)
+	assert.Equal(t, 72*3600, ttl)
+	ttl, ok = recorder.get(2)
+	require.True(t, ok)
+	assert.Equal(t, 30*24*3600, ttl)
+}
+
+func TestErrorTraceWriterMaxSpansPerTrace(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	spanWriter, recorder := newRecordingSpanWriter(metricsFactory, zap.NewNop())
+	writer := NewErrorTraceWriter(spanWriter, 30*24*time.Hour, time.Hour, metricsFactory, zap.NewNop())
+
+	for i := 1; i <= maxSpansPerTrace+1; i++ {
+		assert.NoError(t, writer.WriteSpan(newErrorTraceSpan(1, uint64(i), "dev")))
+	}
+	assert.NoError(t, writer.WriteSpan(newErrorTraceSpan(1, maxSpansPerTrace+2, "dev", model.Bool("error", true))))
+	ttl, _ := recorder.get(maxSpansPerTrace)
+	assert.Equal(t, 30*24*3600, ttl)
+	ttl, _ = recorder.get(maxSpansPerTrace + 1)
+	assert.Equal(t, 72*3600, ttl, "the spans beyond the limit are forgotten")
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counters["error-traces.forgotten-spans"])
+}
+
+func TestErrorTraceWriterFailures(t *testing.T) {
+	session := &mocks.Session{}
+	logger, logBuffer := testutils.NewLogger()
+	metricsFactory := metrics.NewLocalFactory(0)
+	spanWriter := NewSpanWriter(session, 0, metricsFactory, logger)
+	spanWriter.serviceNamesWriter = func(serviceName string) error { return nil }
+	spanWriter.operationNamesWriter = func(serviceName, operationName string) error { return nil }
+	query := &mocks.Query{}
+	query.On("Bind", matchEverything()).Return(query)
+	query.On("Exec").Return(nil)
+	session.On("Query", mock.AnythingOfType("string"), matchEverything()).Return(query)
+
+	writer := NewErrorTraceWriter(spanWriter, 30*24*time.Hour, time.Hour, metricsFactory, logger)
+	assert.NoError(t, writer.WriteSpan(newErrorTraceSpan(1, 1, "dev")))
+
+	failing := &mocks.Query{}
+	failing.On("Bind", matchEverything()).Return(failing)
+	failing.On("Exec").Return(errors.New("write error"))
+	failing.On("String").Return("insert into traces")
+	session.ExpectedCalls = nil
+	session.On("Query", mock.AnythingOfType("string"), matchEverything()).Return(failing)
+	assert.Error(t, writer.WriteSpan(newErrorTraceSpan(2, 2, "dev")), "the errors of the spans are returned")
+	assert.Error(t, writer.WriteSpan(newErrorTraceSpan(1, 3, "dev", model.Bool("error", true))))
+	require.NoError(t, writer.Close())
+
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counters["error-traces.failed-writes"], "the span stored with its usual TTL")
+	assert.Contains(t, logBuffer.String(), "Failed to write span of error trace with the error TTL")
+}
+
+func TestSpanTTLExtended(t *testing.T) {
+	testCases := []struct {
+		ttl      spanTTL
+		minTTL   time.Duration
+		expected spanTTL
+	}{
+		{ttl: 0, minTTL: 0, expected: 0},
+		{ttl: 60, minTTL: 0, expected: 60},
+		{ttl: 0, minTTL: time.Hour, expected: 3600},
+		{ttl: 60, minTTL: time.Hour, expected: 3600},
+		{ttl: 7200, minTTL: time.Hour, expected: 7200},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, testCase.ttl.extended(testCase.minTTL))
+	}
+}
@@ -92,6 +92,7 @@ func TestOperationNamesStorageWrite(t *testing.T) {
 				counts, _ := s.metricsFactory.Snapshot()
 				assert.Equal(t, map[string]int64{
 					"OperationNames.attempts": 2, "OperationNames.inserts": 1, "OperationNames.errors": 1,
+					"OperationNames.errors-by-category|category=unknown": 1,
 				}, counts, "after first two writes")
 
 				// write again
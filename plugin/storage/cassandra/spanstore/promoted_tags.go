@@ -0,0 +1,95 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"sync/atomic"
+
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/plugin/storage/cassandra/spanstore/dbmodel"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+const (
+	insertPromotedTag = `
+		INSERT
+		INTO service_promoted_tag_index(service_name, tag_key, tag_value, bucket, start_time, trace_id, span_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	queryByPromotedTag = `
+		SELECT trace_id
+		FROM service_promoted_tag_index
+		WHERE bucket IN ` + bucketRange + ` AND service_name = ? AND tag_key = ? AND tag_value = ? AND start_time > ? AND start_time < ?
+		ORDER BY start_time DESC
+		LIMIT ?`
+)
+
+// promotedTags are the keys of the tags indexed in the service_promoted_tag_index table
+type promotedTags map[string]struct{}
+
+func newPromotedTags(keys []string) promotedTags {
+	if len(keys) == 0 {
+		return nil
+	}
+	tags := make(promotedTags, len(keys))
+	for _, key := range keys {
+		tags[key] = struct{}{}
+	}
+	return tags
+}
+
+// contains returns true if the key is promoted
+func (p promotedTags) contains(key string) bool {
+	_, ok := p[key]
+	return ok
+}
+
+// indexPromotedTag indexes the tag of the span in the service_promoted_tag_index table, whose partitions hold the
+// spans of a single service and tag value, spread over buckets
+func (s *SpanWriter) indexPromotedTag(tag dbmodel.TagInsertion, ds *dbmodel.Span, ttl spanTTL) error {
+	bucketNo := atomic.AddUint32(&s.bucketCounter, 1) % defaultNumBuckets
+	query := s.session.Query(
+		ttl.statement(insertPromotedTag),
+		ttl.values(tag.ServiceName, tag.TagKey, tag.TagValue, bucketNo, ds.StartTime, ds.TraceID, ds.SpanID)...,
+	)
+	if err := s.writerMetrics.promotedTagIndex.Exec(query, s.logger); err != nil {
+		withTagInfo := s.logger.
+			With(zap.String("tag_key", tag.TagKey)).
+			With(zap.String("tag_value", tag.TagValue))
+		return s.logError(ds, err, "Failed to index promoted tag", withTagInfo)
+	}
+	return nil
+}
+
+// queryByPromotedTag returns the traces with a span of the service carrying the tag
+func (s *SpanReader) queryByPromotedTag(key, value string, tq *spanstore.TraceQueryParameters) (dbmodel.UniqueTraceIDs, error) {
+	query := s.session.Query(
+		queryByPromotedTag,
+		tq.ServiceName,
+		key,
+		value,
+		model.TimeAsEpochMicroseconds(tq.StartTimeMin),
+		model.TimeAsEpochMicroseconds(tq.StartTimeMax),
+		tq.NumTraces*limitMultiple,
+	).PageSize(0)
+	return s.executeQuery(query, s.metrics.queryPromotedTagIndex)
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/pkg/cassandra"
+	"github.com/uber/jaeger/pkg/cassandra/mocks"
+	"github.com/uber/jaeger/plugin/storage/cassandra/spanstore/dbmodel"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+func TestSpanWriterPromotedTags(t *testing.T) {
+	session := &mocks.Session{}
+	metricsFactory := metrics.NewLocalFactory(0)
+	writer := NewSpanWriter(session, 0, metricsFactory, zap.NewNop(),
+		WriterOptions.PromotedTags([]string{"request.id", "user.id"}))
+	writer.serviceNamesWriter = func(serviceName string) error { return nil }
+	writer.operationNamesWriter = func(serviceName, operationName string) error { return nil }
+
+	var promoted, tags [][]interface{}
+	query := &mocks.Query{}
+	query.On("Bind", matchEverything()).Return(query)
+	query.On("Exec").Return(nil)
+	session.On("Query", stringMatcher(insertPromotedTag), matchEverything()).Run(func(args mock.Arguments) {
+		promoted = append(promoted, args.Get(1).([]interface{}))
+	}).Return(query)
+	session.On("Query", stringMatcher(insertTag), matchEverything()).Run(func(args mock.Arguments) {
+		tags = append(tags, args.Get(1).([]interface{}))
+	}).Return(query)
+	session.On("Query", mock.AnythingOfType("string"), matchEverything()).Return(query)
+
+	span := &model.Span{
+		TraceID: model.TraceID{Low: 1},
+		SpanID:  model.SpanID(2),
+		Tags:    model.KeyValues{model.String("request.id", "abc"), model.String("http.method", "GET")},
+		Process: &model.Process{ServiceName: "service-a"},
+	}
+	require.NoError(t, writer.WriteSpan(span))
+	require.Len(t, promoted, 1)
+	assert.Equal(t, "service-a", promoted[0][0])
+	assert.Equal(t, "request.id", promoted[0][1])
+	assert.Equal(t, "abc", promoted[0][2])
+	// the promoted tags are not indexed in tag_index
+	require.Len(t, tags, 1)
+	assert.Equal(t, "http.method", tags[0][4])
+	require.NoError(t, writer.WriteSpan(span))
+	require.Len(t, promoted, 2)
+	assert.NotEqual(t, promoted[0][3], promoted[1][3], "the spans of a tag value are spread over buckets")
+
+	// the spans without the promoted tags are written as usual
+	promoted = nil
+	require.NoError(t, writer.WriteSpan(&model.Span{
+		TraceID: model.TraceID{Low: 3},
+		Process: &model.Process{ServiceName: "service-a"},
+	}))
+	assert.Empty(t, promoted)
+
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counters["PromotedTagIndex.inserts"])
+	assert.EqualValues(t, 4, counters["promotedTagMissing"])
+}
+
+func TestSpanWriterPromotedTagError(t *testing.T) {
+	session := &mocks.Session{}
+	writer := NewSpanWriter(session, 0, metrics.NullFactory, zap.NewNop(),
+		WriterOptions.PromotedTags([]string{"request.id"}))
+	writer.serviceNamesWriter = func(serviceName string) error { return nil }
+	writer.operationNamesWriter = func(serviceName, operationName string) error { return nil }
+
+	query := &mocks.Query{}
+	query.On("Bind", matchEverything()).Return(query)
+	query.On("Exec").Return(nil)
+	promotedQuery := &mocks.Query{}
+	promotedQuery.On("Exec").Return(errors.New("index error"))
+	promotedQuery.On("String").Return("insert into service_promoted_tag_index")
+	session.On("Query", stringMatcher(insertPromotedTag), matchEverything()).Return(promotedQuery)
+	session.On("Query", mock.AnythingOfType("string"), matchEverything()).Return(query)
+
+	err := writer.WriteSpan(&model.Span{
+		TraceID: model.TraceID{Low: 1},
+		Tags:    model.KeyValues{model.String("request.id", "abc")},
+		Process: &model.Process{ServiceName: "service-a"},
+	})
+	assert.EqualError(t, err, "Failed to index tags: Failed to index promoted tag: failed to Exec query 'insert into service_promoted_tag_index': index error")
+}
+
+func TestSpanReaderPromotedTags(t *testing.T) {
+	session := &mocks.Session{}
+	metricsFactory := metrics.NewLocalFactory(0)
+	reader := NewSpanReader(session, metricsFactory, zap.NewNop(), ReaderOptions.PromotedTags([]string{"request.id"}))
+
+	newQuery := func(traceIDs ...uint64) *mocks.Query {
+		iter := &mocks.Iterator{}
+		iter.On("Scan", mock.Anything).Return(func(dest ...interface{}) bool {
+			if len(traceIDs) == 0 {
+				return false
+			}
+			*(dest[0].(*dbmodel.TraceID)) = dbmodel.TraceIDFromDomain(model.TraceID{Low: traceIDs[0]})
+			traceIDs = traceIDs[1:]
+			return true
+		})
+		iter.On("Close").Return(nil)
+		query := &mocks.Query{}
+		query.On("PageSize", 0).Return(query)
+		query.On("Consistency", cassandra.One).Return(query)
+		query.On("Iter").Return(iter)
+		return query
+	}
+	var promotedArgs []interface{}
+	session.On("Query", stringMatcher(queryByPromotedTag), mock.Anything).Run(func(args mock.Arguments) {
+		promotedArgs = args.Get(1).([]interface{})
+	}).Return(newQuery(1))
+	// the spans written before the key was promoted are in tag_index
+	session.On("Query", stringMatcher(queryByTag), mock.Anything).Return(newQuery(3))
+
+	tq := &spanstore.TraceQueryParameters{
+		ServiceName:  "service-a",
+		Tags:         map[string]string{"request.id": "abc"},
+		StartTimeMin: time.Now().Add(-time.Hour),
+		StartTimeMax: time.Now(),
+		NumTraces:    10,
+	}
+	traceIDs, err := reader.queryByTagsAndLogs(tq)
+	require.NoError(t, err)
+	assert.Equal(t, dbmodel.UniqueTraceIDs{
+		dbmodel.TraceIDFromDomain(model.TraceID{Low: 1}): struct{}{},
+		dbmodel.TraceIDFromDomain(model.TraceID{Low: 3}): struct{}{},
+	}, traceIDs)
+	require.True(t, len(promotedArgs) > 3)
+	assert.Equal(t, []interface{}{"service-a", "request.id", "abc"}, promotedArgs[:3])
+
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counters["Read.PromotedTagIndex.inserts"])
+	assert.EqualValues(t, 1, counters["Read.TagIndex.inserts"])
+}
@@ -28,6 +28,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/model/codec"
 	"github.com/uber/jaeger/pkg/cassandra"
 	casMetrics "github.com/uber/jaeger/pkg/cassandra/metrics"
 	"github.com/uber/jaeger/plugin/storage/cassandra/spanstore/dbmodel"
@@ -40,6 +41,14 @@ const (
 		SELECT trace_id, span_id, parent_id, operation_name, flags, start_time, duration, tags, logs, refs, process
 		FROM traces
 		WHERE trace_id = ?`
+	queryTraceBuckets = `
+		SELECT bucket
+		FROM trace_bucket_index
+		WHERE trace_id = ?`
+	querySpanByTraceBucket = `
+		SELECT trace_id, span_id, parent_id, operation_name, flags, start_time, duration, tags, logs, refs, process
+		FROM trace_buckets
+		WHERE trace_id = ? AND bucket = ?`
 	queryByTag = `
 		SELECT trace_id
 		FROM tag_index
@@ -58,6 +67,12 @@ const (
 		WHERE service_name = ? AND operation_name = ? AND start_time > ? AND start_time < ?
 		ORDER BY start_time DESC
 		LIMIT ?`
+	queryBySpanKind = `
+		SELECT trace_id
+		FROM service_span_kind_index
+		WHERE bucket IN ` + bucketRange + ` AND service_name = ? AND span_kind = ? AND start_time > ? AND start_time < ?
+		ORDER BY start_time DESC
+		LIMIT ?`
 	queryByDuration = `
 		SELECT trace_id
 		FROM duration_index
@@ -101,16 +116,54 @@ type spanReaderMetrics struct {
 	queryDurationIndex         *casMetrics.Table
 	queryServiceOperationIndex *casMetrics.Table
 	queryServiceNameIndex      *casMetrics.Table
+	queryServiceSpanKindIndex  *casMetrics.Table
+	queryPromotedTagIndex      *casMetrics.Table
+	decompressionTime          metrics.Timer
+}
+
+// ReaderOption is a function that sets some option on the SpanReader.
+type ReaderOption func(*SpanReader)
+
+// ReaderOptions is a factory for all available ReaderOption's
+var ReaderOptions readerOptions
+
+type readerOptions struct{}
+
+// Consistency creates a ReaderOption that reads spans at the given consistency level instead of ONE.
+func (readerOptions) Consistency(level cassandra.Consistency) ReaderOption {
+	return func(s *SpanReader) {
+		s.consistency = level
+	}
+}
+
+// Bucketing creates a ReaderOption that also reads the spans that WriterOptions.Bucketing stored in
+// the buckets of the traces, reassembling them with the spans of the traces table.
+func (readerOptions) Bucketing() ReaderOption {
+	return func(s *SpanReader) {
+		s.bucketing = true
+	}
+}
+
+// PromotedTags creates a ReaderOption that also searches the tags with the given keys in the
+// service_promoted_tag_index table, which WriterOptions.PromotedTags populates. The tag_index table is still
+// searched for the spans written before a key was promoted, or by the writers not promoting it.
+func (readerOptions) PromotedTags(keys []string) ReaderOption {
+	return func(s *SpanReader) {
+		s.promotedTags = newPromotedTags(keys)
+	}
 }
 
 // SpanReader can query for and load traces from Cassandra.
 type SpanReader struct {
 	session              cassandra.Session
 	consistency          cassandra.Consistency
+	bucketing            bool
+	promotedTags         promotedTags
 	serviceNamesReader   serviceNamesReader
 	operationNamesReader operationNamesReader
 	metrics              spanReaderMetrics
 	logger               *zap.Logger
+	serializer           *codec.Serializer
 }
 
 // NewSpanReader returns a new SpanReader.
@@ -118,11 +171,12 @@ func NewSpanReader(
 	session cassandra.Session,
 	metricsFactory metrics.Factory,
 	logger *zap.Logger,
+	options ...ReaderOption,
 ) *SpanReader {
 	readFactory := metricsFactory.Namespace("Read", nil)
 	serviceNamesStorage := NewServiceNamesStorage(session, 0, metricsFactory, logger)
 	operationNamesStorage := NewOperationNamesStorage(session, 0, metricsFactory, logger)
-	return &SpanReader{
+	reader := &SpanReader{
 		session:              session,
 		consistency:          cassandra.One,
 		serviceNamesReader:   serviceNamesStorage.GetServices,
@@ -134,9 +188,17 @@ func NewSpanReader(
 			queryDurationIndex:         casMetrics.NewTable(readFactory, "DurationIndex"),
 			queryServiceOperationIndex: casMetrics.NewTable(readFactory, "ServiceOperationIndex"),
 			queryServiceNameIndex:      casMetrics.NewTable(readFactory, "ServiceNameIndex"),
+			queryServiceSpanKindIndex:  casMetrics.NewTable(readFactory, "ServiceSpanKindIndex"),
+			queryPromotedTagIndex:      casMetrics.NewTable(readFactory, "PromotedTagIndex"),
+			decompressionTime:          readFactory.Timer("decompression.time", nil),
 		},
-		logger: logger,
+		logger:     logger,
+		serializer: codec.NewSerializer(readFactory),
+	}
+	for _, option := range options {
+		option(reader)
 	}
+	return reader
 }
 
 // GetServices returns all services traced by Jaeger
@@ -152,7 +214,51 @@ func (s *SpanReader) GetOperations(service string) ([]string, error) {
 
 func (s *SpanReader) readTrace(traceID dbmodel.TraceID) (*model.Trace, error) {
 	start := time.Now()
-	q := s.session.Query(querySpanByTraceID, traceID)
+	retMe := &model.Trace{}
+	err := s.readSpans(retMe, s.session.Query(querySpanByTraceID, traceID))
+	if err == nil && s.bucketing {
+		err = s.readBuckets(retMe, traceID)
+	}
+	s.metrics.readTraces.Emit(err, time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+	if len(retMe.Spans) == 0 {
+		return nil, spanstore.ErrTraceNotFound
+	}
+	return retMe, nil
+}
+
+// readBuckets appends the spans stored in the buckets of the trace to it
+func (s *SpanReader) readBuckets(trace *model.Trace, traceID dbmodel.TraceID) error {
+	buckets, err := s.traceBuckets(traceID)
+	if err != nil {
+		return err
+	}
+	for _, bucket := range buckets {
+		if err := s.readSpans(trace, s.session.Query(querySpanByTraceBucket, traceID, bucket)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// traceBuckets returns the buckets the spans of the trace are stored in besides the traces table
+func (s *SpanReader) traceBuckets(traceID dbmodel.TraceID) ([]int, error) {
+	i := s.session.Query(queryTraceBuckets, traceID).Consistency(s.consistency).Iter()
+	var bucket int
+	var buckets []int
+	for i.Scan(&bucket) {
+		buckets = append(buckets, bucket)
+	}
+	if err := i.Close(); err != nil {
+		return nil, errors.Wrap(err, "Error reading trace buckets from storage")
+	}
+	return buckets, nil
+}
+
+// readSpans appends the spans returned by the query to the trace
+func (s *SpanReader) readSpans(trace *model.Trace, q cassandra.Query) error {
 	i := q.Consistency(s.consistency).Iter()
 	var traceIDFromSpan dbmodel.TraceID
 	var startTime, spanID, duration, parentID int64
@@ -162,7 +268,6 @@ func (s *SpanReader) readTrace(traceID dbmodel.TraceID) (*model.Trace, error) {
 	var refs []dbmodel.SpanRef
 	var tags []dbmodel.KeyValue
 	var logs []dbmodel.Log
-	retMe := &model.Trace{}
 	for i.Scan(&traceIDFromSpan, &spanID, &parentID, &operationName, &flags, &startTime, &duration, &tags, &logs, &refs, &dbProcess) {
 		dbSpan := dbmodel.Span{
 			TraceID:       traceIDFromSpan,
@@ -178,24 +283,34 @@ func (s *SpanReader) readTrace(traceID dbmodel.TraceID) (*model.Trace, error) {
 			Process:       dbProcess,
 			ServiceName:   dbProcess.ServiceName,
 		}
-		span, err := dbmodel.ToDomain(&dbSpan)
+		if dbmodel.IsCompressed(&dbSpan) {
+			decompressStart := time.Now()
+			err := dbmodel.DecompressSpan(&dbSpan)
+			s.metrics.decompressionTime.Record(time.Since(decompressStart))
+			if err != nil {
+				return err
+			}
+		}
+		span, err := s.toDomain(&dbSpan)
 		if err != nil {
 			//do we consider conversion failure to cause such metrics to be emitted? for now i'm assuming yes.
-			s.metrics.readTraces.Emit(err, time.Since(start))
-			return nil, err
+			return err
 		}
-		retMe.Spans = append(retMe.Spans, span)
+		trace.Spans = append(trace.Spans, span)
 	}
 
-	err := i.Close()
-	s.metrics.readTraces.Emit(err, time.Since(start))
-	if err != nil {
-		return nil, errors.Wrap(err, "Error reading traces from storage")
+	if err := i.Close(); err != nil {
+		return errors.Wrap(err, "Error reading traces from storage")
 	}
-	if len(retMe.Spans) == 0 {
-		return nil, spanstore.ErrTraceNotFound
+	return nil
+}
+
+// toDomain converts a row to a span, whether it was stored in columns or serialized by a codec
+func (s *SpanReader) toDomain(dbSpan *dbmodel.Span) (*model.Span, error) {
+	if data, ok := dbmodel.SerializedSpan(dbSpan); ok {
+		return s.serializer.Deserialize(data)
 	}
-	return retMe, nil
+	return dbmodel.ToDomain(dbSpan)
 }
 
 // GetTrace takes a traceID and returns a Trace associated with that traceID
@@ -207,7 +322,7 @@ func validateQuery(p *spanstore.TraceQueryParameters) error {
 	if p == nil {
 		return ErrMalformedRequestObject
 	}
-	if p.ServiceName == "" && len(p.Tags) > 0 {
+	if p.ServiceName == "" && (len(p.Tags) > 0 || p.SpanKind != "") {
 		return ErrServiceNameNotSet
 	}
 	if p.StartTimeMin.IsZero() || p.StartTimeMax.IsZero() {
@@ -237,9 +352,35 @@ func (s *SpanReader) FindTraces(traceQuery *spanstore.TraceQueryParameters) ([]*
 	if err != nil {
 		return nil, err
 	}
+	retMe := s.readTraces(uniqueTraceIDs, traceQuery.NumTraces, nil)
+	if traceQuery.SpanKind != "" && len(retMe) < traceQuery.NumTraces {
+		// the spans written before the span kind index existed are not in it, so the traces matching
+		// the other parameters are read and kept if they have a span of the service with the kind
+		traceIDs, err := s.findTraceIDsByIndices(traceQuery)
+		if err != nil {
+			return nil, err
+		}
+		for traceID := range uniqueTraceIDs {
+			delete(traceIDs, traceID)
+		}
+		hasSpanKind := func(trace *model.Trace) bool {
+			for _, span := range trace.Spans {
+				if span.Process.ServiceName == traceQuery.ServiceName && span.GetSpanKind() == traceQuery.SpanKind {
+					return true
+				}
+			}
+			return false
+		}
+		retMe = append(retMe, s.readTraces(traceIDs, traceQuery.NumTraces-len(retMe), hasSpanKind)...)
+	}
+	return retMe, nil
+}
+
+// readTraces reads up to numTraces of the traces, skipping those rejected by the match function if it is not nil
+func (s *SpanReader) readTraces(traceIDs dbmodel.UniqueTraceIDs, numTraces int, match func(*model.Trace) bool) []*model.Trace {
 	var retMe []*model.Trace
-	for traceID := range uniqueTraceIDs {
-		if len(retMe) >= traceQuery.NumTraces {
+	for traceID := range traceIDs {
+		if len(retMe) >= numTraces {
 			break
 		}
 		jTrace, err := s.readTrace(traceID)
@@ -247,12 +388,37 @@ func (s *SpanReader) FindTraces(traceQuery *spanstore.TraceQueryParameters) ([]*
 			s.logger.Error("Failure to read trace", zap.String("trace_id", traceID.String()), zap.Error(err))
 			continue
 		}
-		retMe = append(retMe, jTrace)
+		if match == nil || match(jTrace) {
+			retMe = append(retMe, jTrace)
+		}
 	}
-	return retMe, nil
+	return retMe
 }
 
 func (s *SpanReader) findTraceIDs(traceQuery *spanstore.TraceQueryParameters) (dbmodel.UniqueTraceIDs, error) {
+	if traceQuery.SpanKind == "" {
+		return s.findTraceIDsByIndices(traceQuery)
+	}
+	spanKindTraceIds, err := s.queryBySpanKind(traceQuery)
+	if err != nil {
+		return nil, err
+	}
+	if traceQuery.OperationName == "" && len(traceQuery.Tags) == 0 &&
+		traceQuery.DurationMin == 0 && traceQuery.DurationMax == 0 {
+		return spanKindTraceIds, nil
+	}
+	traceIds, err := s.findTraceIDsByIndices(traceQuery)
+	if err != nil {
+		return nil, err
+	}
+	return dbmodel.IntersectTraceIDs([]dbmodel.UniqueTraceIDs{
+		traceIds,
+		spanKindTraceIds,
+	}), nil
+}
+
+// findTraceIDsByIndices looks up the trace IDs matching the query in all the indices but the span kind one
+func (s *SpanReader) findTraceIDsByIndices(traceQuery *spanstore.TraceQueryParameters) (dbmodel.UniqueTraceIDs, error) {
 	if traceQuery.DurationMin != 0 || traceQuery.DurationMax != 0 {
 		return s.queryByDuration(traceQuery)
 	}
@@ -296,6 +462,15 @@ func (s *SpanReader) queryByTagsAndLogs(tq *spanstore.TraceQueryParameters) (dbm
 		if err != nil {
 			return nil, err
 		}
+		if s.promotedTags.contains(k) {
+			promoted, err := s.queryByPromotedTag(k, v, tq)
+			if err != nil {
+				return nil, err
+			}
+			for traceID := range promoted {
+				t.Add(traceID)
+			}
+		}
 		results = append(results, t)
 	}
 	return dbmodel.IntersectTraceIDs(results), nil
@@ -362,6 +537,18 @@ func (s *SpanReader) queryByService(tq *spanstore.TraceQueryParameters) (dbmodel
 	return s.executeQuery(query, s.metrics.queryServiceNameIndex)
 }
 
+func (s *SpanReader) queryBySpanKind(tq *spanstore.TraceQueryParameters) (dbmodel.UniqueTraceIDs, error) {
+	query := s.session.Query(
+		queryBySpanKind,
+		tq.ServiceName,
+		string(tq.SpanKind),
+		model.TimeAsEpochMicroseconds(tq.StartTimeMin),
+		model.TimeAsEpochMicroseconds(tq.StartTimeMax),
+		tq.NumTraces*limitMultiple,
+	).PageSize(0)
+	return s.executeQuery(query, s.metrics.queryServiceSpanKindIndex)
+}
+
 func (s *SpanReader) executeQuery(query cassandra.Query, tableMetrics *casMetrics.Table) (dbmodel.UniqueTraceIDs, error) {
 	start := time.Now()
 	i := query.Consistency(s.consistency).Iter()
@@ -28,10 +28,12 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"github.com/uber/jaeger-lib/metrics"
 	"go.uber.org/zap"
 
 	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/model/codec"
 	"github.com/uber/jaeger/pkg/cassandra"
 	"github.com/uber/jaeger/pkg/cassandra/mocks"
 	"github.com/uber/jaeger/pkg/testutils"
@@ -135,6 +137,90 @@ func TestSpanReaderGetTrace(t *testing.T) {
 	}
 }
 
+func TestSpanReaderGetTraceCompressed(t *testing.T) {
+	tags := model.KeyValues{}
+	for i := 0; i < 10; i++ {
+		tags = append(tags, model.String("sql.query", "SELECT * FROM customers WHERE id = ?"))
+	}
+	compressed := dbmodel.FromDomain(&model.Span{Tags: tags, Process: &model.Process{}})
+	_, _, err := dbmodel.CompressSpan(compressed, dbmodel.GzipCompression)
+	assert.NoError(t, err)
+	assert.True(t, dbmodel.IsCompressed(compressed))
+
+	withSpanReader(func(r *spanReaderTest) {
+		iter := &mocks.Iterator{}
+		iter.On("Scan", matchOnceWithSideEffect(func(args []interface{}) {
+			for _, arg := range args {
+				if v, ok := arg.(*[]dbmodel.KeyValue); ok {
+					*v = compressed.Tags
+				}
+			}
+		})).Return(true)
+		iter.On("Scan", matchEverything()).Return(false)
+		iter.On("Close").Return(nil)
+
+		query := &mocks.Query{}
+		query.On("Consistency", cassandra.One).Return(query)
+		query.On("Iter").Return(iter)
+
+		r.session.On("Query", mock.AnythingOfType("string"), matchEverything()).Return(query)
+
+		trace, err := r.reader.GetTrace(model.TraceID{})
+		assert.NoError(t, err)
+		if assert.Len(t, trace.Spans, 1) {
+			assert.Equal(t, tags, trace.Spans[0].Tags)
+		}
+	})
+}
+
+func TestSpanReaderGetTraceSerialized(t *testing.T) {
+	span := &model.Span{
+		TraceID:       model.TraceID{Low: 1},
+		SpanID:        model.SpanID(2),
+		OperationName: "operation-a",
+		StartTime:     model.EpochMicrosecondsAsTime(1485467191639875),
+		Tags:          model.KeyValues{model.String("x", "y")},
+		Process:       &model.Process{ServiceName: "service-a"},
+	}
+	for _, format := range []codec.Format{codec.ThriftFormat, codec.JSONFormat, codec.ProtobufFormat} {
+		t.Run(format.String(), func(t *testing.T) {
+			data, err := codec.NewSerializer(metrics.NullFactory).Serialize(format, span)
+			assert.NoError(t, err)
+			serialized := dbmodel.FromDomain(span)
+			dbmodel.SetSerializedSpan(serialized, data)
+
+			withSpanReader(func(r *spanReaderTest) {
+				iter := &mocks.Iterator{}
+				iter.On("Scan", matchOnceWithSideEffect(func(args []interface{}) {
+					for _, arg := range args {
+						if v, ok := arg.(*[]dbmodel.KeyValue); ok {
+							*v = serialized.Tags
+						}
+					}
+				})).Return(true)
+				iter.On("Scan", matchEverything()).Return(false)
+				iter.On("Close").Return(nil)
+
+				query := &mocks.Query{}
+				query.On("Consistency", cassandra.One).Return(query)
+				query.On("Iter").Return(iter)
+
+				r.session.On("Query", mock.AnythingOfType("string"), matchEverything()).Return(query)
+
+				trace, err := r.reader.GetTrace(model.TraceID{})
+				assert.NoError(t, err)
+				if assert.Len(t, trace.Spans, 1) {
+					assert.Equal(t, span.SpanID, trace.Spans[0].SpanID)
+					assert.Equal(t, span.OperationName, trace.Spans[0].OperationName)
+					assert.True(t, span.StartTime.Equal(trace.Spans[0].StartTime))
+					assert.Equal(t, span.Tags, trace.Spans[0].Tags)
+					assert.Equal(t, span.Process.ServiceName, trace.Spans[0].Process.ServiceName)
+				}
+			})
+		})
+	}
+}
+
 func TestSpanReaderGetTrace_TraceNotFound(t *testing.T) {
 	withSpanReader(func(r *spanReaderTest) {
 		iter := &mocks.Iterator{}
@@ -153,6 +239,103 @@ func TestSpanReaderGetTrace_TraceNotFound(t *testing.T) {
 	})
 }
 
+func TestSpanReaderConsistency(t *testing.T) {
+	session := &mocks.Session{}
+	reader := NewSpanReader(session, metrics.NullFactory, zap.NewNop(), ReaderOptions.Consistency(cassandra.LocalQuorum))
+
+	iter := &mocks.Iterator{}
+	iter.On("Scan", matchEverything()).Return(false)
+	iter.On("Close").Return(nil)
+	query := &mocks.Query{}
+	query.On("Consistency", cassandra.LocalQuorum).Return(query)
+	query.On("Iter").Return(iter)
+	session.On("Query", mock.AnythingOfType("string"), matchEverything()).Return(query)
+
+	_, err := reader.GetTrace(model.TraceID{})
+	assert.EqualError(t, err, "trace not found")
+	query.AssertExpectations(t)
+}
+
+func TestSpanReaderBucketing(t *testing.T) {
+	spanQuery := func(spanID int64) *mocks.Query {
+		iter := &mocks.Iterator{}
+		iter.On("Scan", matchOnceWithSideEffect(func(args []interface{}) {
+			*args[1].(*int64) = spanID
+		})).Return(true)
+		iter.On("Scan", matchEverything()).Return(false)
+		iter.On("Close").Return(nil)
+		query := &mocks.Query{}
+		query.On("Consistency", cassandra.One).Return(query)
+		query.On("Iter").Return(iter)
+		return query
+	}
+	bucketsQuery := func(closeErr error, buckets ...int) *mocks.Query {
+		iter := &mocks.Iterator{}
+		for _, bucket := range buckets {
+			bucket := bucket // capture loop var
+			iter.On("Scan", matchOnceWithSideEffect(func(args []interface{}) {
+				*args[0].(*int) = bucket
+			})).Return(true)
+		}
+		iter.On("Scan", matchEverything()).Return(false)
+		iter.On("Close").Return(closeErr)
+		query := &mocks.Query{}
+		query.On("Consistency", cassandra.One).Return(query)
+		query.On("Iter").Return(iter)
+		return query
+	}
+
+	t.Run("reassembled", func(t *testing.T) {
+		session := &mocks.Session{}
+		reader := NewSpanReader(session, metrics.NullFactory, zap.NewNop(), ReaderOptions.Bucketing())
+		session.On("Query", stringMatcher(querySpanByTraceID), matchEverything()).Return(spanQuery(1))
+		session.On("Query", stringMatcher(queryTraceBuckets), matchEverything()).Return(bucketsQuery(nil, 1, 2))
+		session.On("Query", stringMatcher(querySpanByTraceBucket), []interface{}{dbmodel.TraceID{}, 1}).Return(spanQuery(2))
+		session.On("Query", stringMatcher(querySpanByTraceBucket), []interface{}{dbmodel.TraceID{}, 2}).Return(spanQuery(3))
+
+		trace, err := reader.GetTrace(model.TraceID{})
+		assert.NoError(t, err)
+		if assert.Len(t, trace.Spans, 3) {
+			for i, span := range trace.Spans {
+				assert.Equal(t, model.SpanID(i+1), span.SpanID)
+			}
+		}
+	})
+
+	t.Run("only in buckets", func(t *testing.T) {
+		session := &mocks.Session{}
+		reader := NewSpanReader(session, metrics.NullFactory, zap.NewNop(), ReaderOptions.Bucketing())
+		session.On("Query", stringMatcher(querySpanByTraceID), matchEverything()).Return(bucketsQuery(nil))
+		session.On("Query", stringMatcher(queryTraceBuckets), matchEverything()).Return(bucketsQuery(nil, 1))
+		session.On("Query", stringMatcher(querySpanByTraceBucket), matchEverything()).Return(spanQuery(2))
+
+		trace, err := reader.GetTrace(model.TraceID{})
+		assert.NoError(t, err)
+		assert.Len(t, trace.Spans, 1)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		session := &mocks.Session{}
+		reader := NewSpanReader(session, metrics.NullFactory, zap.NewNop(), ReaderOptions.Bucketing())
+		session.On("Query", mock.AnythingOfType("string"), matchEverything()).Return(bucketsQuery(nil))
+
+		trace, err := reader.GetTrace(model.TraceID{})
+		assert.Nil(t, trace)
+		assert.EqualError(t, err, "trace not found")
+	})
+
+	t.Run("buckets error", func(t *testing.T) {
+		session := &mocks.Session{}
+		reader := NewSpanReader(session, metrics.NullFactory, zap.NewNop(), ReaderOptions.Bucketing())
+		session.On("Query", stringMatcher(querySpanByTraceID), matchEverything()).Return(spanQuery(1))
+		session.On("Query", stringMatcher(queryTraceBuckets), matchEverything()).Return(bucketsQuery(errors.New("error on close()")))
+
+		trace, err := reader.GetTrace(model.TraceID{})
+		assert.Nil(t, trace)
+		assert.EqualError(t, err, "Error reading trace buckets from storage: error on close()")
+	})
+}
+
 func TestSpanReaderFindTracesBadRequest(t *testing.T) {
 	withSpanReader(func(r *spanReaderTest) {
 		_, err := r.reader.FindTraces(nil)
@@ -167,10 +350,12 @@ func TestSpanReaderFindTraces(t *testing.T) {
 		queryTags                         bool
 		queryOperation                    bool
 		queryDuration                     bool
+		querySpanKind                     bool
 		mainQueryError                    error
 		tagsQueryError                    error
 		serviceNameAndOperationQueryError error
 		durationQueryError                error
+		spanKindQueryError                error
 		loadQueryError                    error
 		expectedCount                     int
 		expectedError                     string
@@ -259,6 +444,27 @@ func TestSpanReaderFindTraces(t *testing.T) {
 				"duration query error",
 			},
 		},
+		{
+			caption:       "span kind query",
+			querySpanKind: true,
+			expectedCount: 2,
+		},
+		{
+			caption:        "operation name and span kind query",
+			queryOperation: true,
+			querySpanKind:  true,
+			expectedCount:  2,
+		},
+		{
+			caption:            "span kind query error",
+			querySpanKind:      true,
+			spanKindQueryError: errors.New("span kind query error"),
+			expectedError:      "span kind query error",
+			expectedLogs: []string{
+				"Failed to exec query",
+				"span kind query error",
+			},
+		},
 		{
 			caption:        "load trace error",
 			loadQueryError: errors.New("load query error"),
@@ -316,6 +522,7 @@ func TestSpanReaderFindTraces(t *testing.T) {
 				tagsQuery := mockQuery(testCase.tagsQueryError)
 				operationQuery := mockQuery(testCase.serviceNameAndOperationQueryError)
 				durationQuery := mockQuery(testCase.durationQueryError)
+				spanKindQuery := mockQuery(testCase.spanKindQueryError)
 
 				makeLoadQuery := func() *mocks.Query {
 					loadQueryIter := &mocks.Iterator{}
@@ -334,6 +541,7 @@ func TestSpanReaderFindTraces(t *testing.T) {
 				r.session.On("Query", stringMatcher(queryByTag), matchEverything()).Return(tagsQuery)
 				r.session.On("Query", stringMatcher(queryByServiceAndOperationName), matchEverything()).Return(operationQuery)
 				r.session.On("Query", stringMatcher(queryByDuration), matchEverything()).Return(durationQuery)
+				r.session.On("Query", stringMatcher(queryBySpanKind), matchEverything()).Return(spanKindQuery)
 				r.session.On("Query", stringMatcher("SELECT trace_id"), matchOnce()).Return(makeLoadQuery())
 				r.session.On("Query", stringMatcher("SELECT trace_id"), matchEverything()).Return(makeLoadQuery())
 
@@ -357,6 +565,9 @@ func TestSpanReaderFindTraces(t *testing.T) {
 					queryParams.DurationMax = time.Minute * 3
 
 				}
+				if testCase.querySpanKind {
+					queryParams.SpanKind = model.SpanKindServer
+				}
 				res, err := r.reader.FindTraces(queryParams)
 				if testCase.expectedError == "" {
 					assert.NoError(t, err)
@@ -376,6 +587,65 @@ func TestSpanReaderFindTraces(t *testing.T) {
 	}
 }
 
+func TestSpanReaderFindTracesSpanKindFallback(t *testing.T) {
+	withSpanReader(func(r *spanReaderTest) {
+		mockQuery := func(traceIDs ...model.TraceID) *mocks.Query {
+			iter := &mocks.Iterator{}
+			for _, traceID := range traceIDs {
+				dbTraceID := dbmodel.TraceIDFromDomain(traceID)
+				iter.On("Scan", matchOnceWithSideEffect(func(args []interface{}) {
+					*args[0].(*dbmodel.TraceID) = dbTraceID
+				})).Return(true)
+			}
+			iter.On("Scan", matchEverything()).Return(false)
+			iter.On("Close").Return(nil)
+
+			query := &mocks.Query{}
+			query.On("Consistency", cassandra.One).Return(query)
+			query.On("PageSize", 0).Return(query)
+			query.On("Iter").Return(iter)
+			return query
+		}
+		// loadQuery returns a span of service-a with the given kind
+		loadQuery := func(kind string) *mocks.Query {
+			iter := &mocks.Iterator{}
+			iter.On("Scan", matchOnceWithSideEffect(func(args []interface{}) {
+				*args[7].(*[]dbmodel.KeyValue) = []dbmodel.KeyValue{{Key: "span.kind", ValueType: model.StringType.String(), ValueString: kind}}
+				*args[10].(*dbmodel.Process) = dbmodel.Process{ServiceName: "service-a"}
+			})).Return(true)
+			iter.On("Scan", matchEverything()).Return(false)
+			iter.On("Close").Return(nil)
+
+			query := &mocks.Query{}
+			query.On("Consistency", cassandra.One).Return(query)
+			query.On("Iter").Return(iter)
+			return query
+		}
+		traceIDMatcher := func(traceID model.TraceID) interface{} {
+			return mock.MatchedBy(func(v []interface{}) bool {
+				return len(v) == 1 && v[0] == dbmodel.TraceIDFromDomain(traceID)
+			})
+		}
+
+		// the span kind index has none of the older traces 1 and 2, found by service name
+		r.session.On("Query", stringMatcher(queryBySpanKind), matchEverything()).Return(mockQuery())
+		r.session.On("Query", stringMatcher(queryByServiceName), matchEverything()).Return(mockQuery(model.TraceID{Low: 1}, model.TraceID{Low: 2}))
+		r.session.On("Query", stringMatcher(querySpanByTraceID), traceIDMatcher(model.TraceID{Low: 1})).Return(loadQuery("server"))
+		r.session.On("Query", stringMatcher(querySpanByTraceID), traceIDMatcher(model.TraceID{Low: 2})).Return(loadQuery("client"))
+
+		traces, err := r.reader.FindTraces(&spanstore.TraceQueryParameters{
+			ServiceName:  "service-a",
+			SpanKind:     model.SpanKindServer,
+			StartTimeMax: time.Now(),
+			StartTimeMin: time.Now().Add(-1 * time.Minute * 30),
+		})
+		require.NoError(t, err)
+		if assert.Len(t, traces, 1) {
+			assert.Equal(t, model.SpanKindServer, traces[0].Spans[0].GetSpanKind())
+		}
+	})
+}
+
 func TestTraceQueryParameterValidation(t *testing.T) {
 	tsp := &spanstore.TraceQueryParameters{
 		ServiceName: "",
@@ -386,6 +656,9 @@ func TestTraceQueryParameterValidation(t *testing.T) {
 	err := validateQuery(tsp)
 	assert.EqualError(t, err, ErrServiceNameNotSet.Error())
 
+	err = validateQuery(&spanstore.TraceQueryParameters{SpanKind: model.SpanKindClient})
+	assert.EqualError(t, err, ErrServiceNameNotSet.Error())
+
 	tsp.ServiceName = "serviceName"
 	tsp.StartTimeMin = time.Now()
 	tsp.StartTimeMax = time.Now().Add(-1 * time.Hour)
@@ -0,0 +1,229 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/uber/jaeger/pkg/cassandra"
+)
+
+// SchemaVersion is the version of the keyspace schema the span writer and reader expect. It is recorded
+// in the schema_version table by the schema template, and by MigrateSchema.
+const SchemaVersion = 3
+
+const (
+	// schemaName is the key of the row of the schema_version table recording the version of the span tables
+	schemaName = "jaeger"
+
+	// traceTTLVariable is replaced in the migrations by the default TTL of the traces table
+	traceTTLVariable = "${trace_ttl}"
+
+	createSchemaVersionTable = `
+		CREATE TABLE IF NOT EXISTS schema_version (
+			schema_name text PRIMARY KEY,
+			version     int
+		)`
+	querySchemaVersion  = `SELECT version FROM schema_version WHERE schema_name = ?`
+	insertSchemaVersion = `INSERT INTO schema_version (schema_name, version) VALUES (?, ?)`
+	queryTracesTTL      = `
+		SELECT default_time_to_live
+		FROM system_schema.tables
+		WHERE keyspace_name = ? AND table_name = 'traces'`
+)
+
+// schemaMigrations are the statements upgrading the schema from the previous version to each version,
+// keyed by version. Version 1 is the schema created by the template before it was versioned.
+// Released migrations must never be changed, new ones are added with the next version.
+var schemaMigrations = map[int][]string{
+	2: {`
+		CREATE TABLE IF NOT EXISTS trace_buckets (
+			trace_id       blob,
+			bucket         int,
+			span_id        bigint,
+			span_hash      bigint,
+			parent_id      bigint,
+			operation_name text,
+			flags          int,
+			start_time     bigint,
+			duration       bigint,
+			tags           list<frozen<keyvalue>>,
+			logs           list<frozen<log>>,
+			refs           list<frozen<span_ref>>,
+			process        frozen<process>,
+			PRIMARY KEY ((trace_id, bucket), span_id, span_hash)
+		) WITH compaction = {
+				'compaction_window_size': '1',
+				'compaction_window_unit': 'HOURS',
+				'class': 'org.apache.cassandra.db.compaction.TimeWindowCompactionStrategy'
+			}
+			AND dclocal_read_repair_chance = 0.0
+			AND default_time_to_live = ${trace_ttl}
+			AND speculative_retry = 'NONE'
+			AND gc_grace_seconds = 10800`, `
+		CREATE TABLE IF NOT EXISTS trace_bucket_index (
+			trace_id blob,
+			bucket   int,
+			PRIMARY KEY (trace_id, bucket)
+		) WITH compaction = {
+				'compaction_window_size': '1',
+				'compaction_window_unit': 'HOURS',
+				'class': 'org.apache.cassandra.db.compaction.TimeWindowCompactionStrategy'
+			}
+			AND dclocal_read_repair_chance = 0.0
+			AND default_time_to_live = ${trace_ttl}
+			AND speculative_retry = 'NONE'
+			AND gc_grace_seconds = 10800`, `
+		CREATE TABLE IF NOT EXISTS service_span_kind_index (
+			service_name text,
+			span_kind    text,
+			bucket       int,
+			start_time   bigint,
+			trace_id     blob,
+			PRIMARY KEY ((service_name, span_kind, bucket), start_time)
+		) WITH CLUSTERING ORDER BY (start_time DESC)
+			AND compaction = {
+				'compaction_window_size': '1',
+				'compaction_window_unit': 'HOURS',
+				'class': 'org.apache.cassandra.db.compaction.TimeWindowCompactionStrategy'
+			}
+			AND dclocal_read_repair_chance = 0.0
+			AND default_time_to_live = ${trace_ttl}
+			AND speculative_retry = 'NONE'
+			AND gc_grace_seconds = 10800`,
+	},
+	3: {`
+		CREATE TABLE IF NOT EXISTS service_promoted_tag_index (
+			service_name text,
+			tag_key      text,
+			tag_value    text,
+			bucket       int,
+			start_time   bigint,
+			trace_id     blob,
+			span_id      bigint,
+			PRIMARY KEY ((service_name, tag_key, tag_value, bucket), start_time, trace_id, span_id)
+		) WITH CLUSTERING ORDER BY (start_time DESC)
+			AND compaction = {
+				'compaction_window_size': '1',
+				'compaction_window_unit': 'HOURS',
+				'class': 'org.apache.cassandra.db.compaction.TimeWindowCompactionStrategy'
+			}
+			AND dclocal_read_repair_chance = 0.0
+			AND default_time_to_live = ${trace_ttl}
+			AND speculative_retry = 'NONE'
+			AND gc_grace_seconds = 10800`,
+	},
+}
+
+// CheckSchema returns an error unless the schema version recorded in the keyspace is SchemaVersion, so that
+// collectors do not write spans in a format the tables do not have. A newer version is always an error, since
+// the spans written by this collector could not be read by the newer ones. An older version is upgraded
+// by MigrateSchema if autoMigrate is true.
+func CheckSchema(session cassandra.Session, keyspace string, autoMigrate bool) error {
+	if autoMigrate {
+		return MigrateSchema(session, keyspace)
+	}
+	version, err := readSchemaVersion(session)
+	if err != nil {
+		return err
+	}
+	if version > SchemaVersion {
+		return newerSchemaError(version)
+	}
+	if version < SchemaVersion {
+		return errors.Errorf(
+			"Cassandra schema version %d of keyspace %s is older than the expected version %d, "+
+				"upgrade the keyspace or enable the schema migration",
+			version, keyspace, SchemaVersion)
+	}
+	return nil
+}
+
+// MigrateSchema upgrades the schema of the keyspace to SchemaVersion. The keyspaces without a recorded version
+// are assumed to have the version 1 schema, provided they have a traces table. The migrations only create
+// missing tables, so that collectors starting at the same time can apply them concurrently.
+func MigrateSchema(session cassandra.Session, keyspace string) error {
+	if err := session.Query(createSchemaVersionTable).Exec(); err != nil {
+		return errors.Wrap(err, "Failed to create the Cassandra schema_version table")
+	}
+	version, err := readSchemaVersion(session)
+	if err != nil {
+		return err
+	}
+	if version > SchemaVersion {
+		return newerSchemaError(version)
+	}
+	if version == SchemaVersion {
+		return nil
+	}
+	traceTTL, err := readTracesTTL(session, keyspace)
+	if err != nil {
+		return err
+	}
+	if version == 0 {
+		version = 1
+	}
+	for v := version + 1; v <= SchemaVersion; v++ {
+		for _, statement := range schemaMigrations[v] {
+			statement = strings.Replace(statement, traceTTLVariable, strconv.Itoa(traceTTL), -1)
+			if err := session.Query(statement).Exec(); err != nil {
+				return errors.Wrapf(err, "Failed to migrate the Cassandra schema to version %d", v)
+			}
+		}
+		if err := session.Query(insertSchemaVersion, schemaName, v).Exec(); err != nil {
+			return errors.Wrap(err, "Failed to record the Cassandra schema version")
+		}
+	}
+	return nil
+}
+
+// readSchemaVersion returns the recorded schema version, 0 if there is none
+func readSchemaVersion(session cassandra.Session) (int, error) {
+	var version int
+	iter := session.Query(querySchemaVersion, schemaName).Iter()
+	iter.Scan(&version)
+	if err := iter.Close(); err != nil {
+		return 0, errors.Wrap(err, "Failed to read the Cassandra schema version")
+	}
+	return version, nil
+}
+
+// readTracesTTL returns the default TTL of the traces table, which the tables created by migrations share
+func readTracesTTL(session cassandra.Session, keyspace string) (int, error) {
+	var ttl int
+	// unquoted keyspace names are stored in lower case
+	iter := session.Query(queryTracesTTL, strings.ToLower(keyspace)).Iter()
+	found := iter.Scan(&ttl)
+	if err := iter.Close(); err != nil {
+		return 0, errors.Wrap(err, "Failed to read the Cassandra traces table")
+	}
+	if !found {
+		return 0, errors.Errorf("Cassandra keyspace %s has no traces table to migrate, create it from the schema template", keyspace)
+	}
+	return ttl, nil
+}
+
+func newerSchemaError(version int) error {
+	return errors.Errorf("Cassandra schema version %d is newer than the version %d of this collector", version, SchemaVersion)
+}
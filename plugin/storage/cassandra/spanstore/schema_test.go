@@ -0,0 +1,219 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/jaeger/pkg/cassandra/mocks"
+)
+
+type schemaTest struct {
+	session *mocks.Session
+	// executed are the statements executed, with their values
+	executed []string
+	values   [][]interface{}
+}
+
+// newSchemaTest mocks a keyspace with the recorded schema version, 0 meaning none, and a traces table
+// with the TTL, none if negative
+func newSchemaTest(version int, versionErr error, traceTTL int) *schemaTest {
+	s := &schemaTest{session: &mocks.Session{}}
+
+	versionIter := &mocks.Iterator{}
+	versionIter.On("Scan", matchEverything()).Return(func(dest ...interface{}) bool {
+		if version == 0 {
+			return false
+		}
+		*(dest[0].(*int)) = version
+		return true
+	})
+	versionIter.On("Close").Return(versionErr)
+	versionQuery := &mocks.Query{}
+	versionQuery.On("Iter").Return(versionIter)
+	s.session.On("Query", querySchemaVersion, []interface{}{schemaName}).Return(versionQuery)
+
+	ttlIter := &mocks.Iterator{}
+	ttlIter.On("Scan", matchEverything()).Return(func(dest ...interface{}) bool {
+		if traceTTL < 0 {
+			return false
+		}
+		*(dest[0].(*int)) = traceTTL
+		return true
+	})
+	ttlIter.On("Close").Return(nil)
+	ttlQuery := &mocks.Query{}
+	ttlQuery.On("Iter").Return(ttlIter)
+	s.session.On("Query", queryTracesTTL, []interface{}{"jaeger_v1_test"}).Return(ttlQuery)
+
+	execQuery := &mocks.Query{}
+	execQuery.On("Exec").Return(nil)
+	s.session.On("Query", mock.AnythingOfType("string"), mock.Anything).
+		Run(func(args mock.Arguments) {
+			s.executed = append(s.executed, args.String(0))
+			s.values = append(s.values, args.Get(1).([]interface{}))
+		}).
+		Return(execQuery)
+	return s
+}
+
+func TestCheckSchema(t *testing.T) {
+	testCases := []struct {
+		caption       string
+		version       int
+		versionErr    error
+		expectedError string
+	}{
+		{
+			caption: "expected version",
+			version: SchemaVersion,
+		},
+		{
+			caption:       "older version",
+			version:       1,
+			expectedError: "Cassandra schema version 1 of keyspace jaeger_v1_test is older than the expected version 3, upgrade the keyspace or enable the schema migration",
+		},
+		{
+			caption:       "no version",
+			expectedError: "Cassandra schema version 0 of keyspace jaeger_v1_test is older than the expected version 3, upgrade the keyspace or enable the schema migration",
+		},
+		{
+			caption:       "newer version",
+			version:       SchemaVersion + 1,
+			expectedError: "Cassandra schema version 4 is newer than the version 3 of this collector",
+		},
+		{
+			caption:       "no schema_version table",
+			versionErr:    errors.New("unconfigured table schema_version"),
+			expectedError: "Failed to read the Cassandra schema version: unconfigured table schema_version",
+		},
+	}
+	for _, tc := range testCases {
+		testCase := tc // capture loop var
+		t.Run(testCase.caption, func(t *testing.T) {
+			s := newSchemaTest(testCase.version, testCase.versionErr, 172800)
+			err := CheckSchema(s.session, "jaeger_v1_test", false)
+			if testCase.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, testCase.expectedError)
+			}
+			assert.Empty(t, s.executed, "the schema is never changed without autoMigrate")
+		})
+	}
+}
+
+// versionTables are the tables added to the schema template by each version
+var versionTables = map[int][]string{
+	2: {"trace_buckets", "trace_bucket_index", "service_span_kind_index"},
+	3: {"service_promoted_tag_index"},
+}
+
+func TestMigrateSchemaFromUnversionedKeyspace(t *testing.T) {
+	s := newSchemaTest(0, nil, 172800)
+	require.NoError(t, CheckSchema(s.session, "Jaeger_V1_Test", true))
+
+	assert.Equal(t, createSchemaVersionTable, s.executed[0])
+	i := 1
+	for v := 2; v <= SchemaVersion; v++ {
+		require.True(t, len(s.executed) >= i+len(versionTables[v])+1)
+		for _, table := range versionTables[v] {
+			assert.True(t, strings.Contains(s.executed[i], "CREATE TABLE IF NOT EXISTS "+table+" ("), s.executed[i])
+			assert.True(t, strings.Contains(s.executed[i], "default_time_to_live = 172800"))
+			i++
+		}
+		assert.Equal(t, insertSchemaVersion, s.executed[i])
+		assert.Equal(t, []interface{}{schemaName, v}, s.values[i])
+		i++
+	}
+	assert.Len(t, s.executed, i)
+}
+
+func TestMigrateSchemaFromOlderVersions(t *testing.T) {
+	for version := 1; version < SchemaVersion; version++ {
+		s := newSchemaTest(version, nil, 172800)
+		require.NoError(t, MigrateSchema(s.session, "jaeger_v1_test"))
+
+		// the tables added to the template since the version are created, and each later version recorded
+		var created, expected []string
+		var recorded []int
+		for i, statement := range s.executed[1:] {
+			if statement == insertSchemaVersion {
+				recorded = append(recorded, s.values[i+1][1].(int))
+				continue
+			}
+			fields := strings.Fields(statement)
+			require.True(t, len(fields) > 5 && strings.Join(fields[:5], " ") == "CREATE TABLE IF NOT EXISTS", statement)
+			created = append(created, fields[5])
+		}
+		var expectedVersions []int
+		for v := version + 1; v <= SchemaVersion; v++ {
+			expected = append(expected, versionTables[v]...)
+			expectedVersions = append(expectedVersions, v)
+		}
+		assert.Equal(t, expected, created, "from version %d", version)
+		assert.Equal(t, expectedVersions, recorded, "from version %d", version)
+	}
+}
+
+func TestSchemaTemplate(t *testing.T) {
+	template, err := ioutil.ReadFile("../schema/v001.cql.tmpl")
+	require.NoError(t, err)
+	// the keyspaces created by the template have the tables of all the migrations and need none
+	for v := 2; v <= SchemaVersion; v++ {
+		require.Len(t, schemaMigrations[v], len(versionTables[v]))
+		for _, table := range versionTables[v] {
+			assert.True(t, strings.Contains(string(template), "CREATE TABLE IF NOT EXISTS ${keyspace}."+table+" ("), table)
+		}
+	}
+	assert.True(t, strings.Contains(string(template),
+		"INSERT INTO ${keyspace}.schema_version (schema_name, version) VALUES ('jaeger', "+strconv.Itoa(SchemaVersion)+");"))
+}
+
+func TestMigrateSchemaUpToDate(t *testing.T) {
+	s := newSchemaTest(SchemaVersion, nil, 172800)
+	require.NoError(t, MigrateSchema(s.session, "jaeger_v1_test"))
+	assert.Equal(t, []string{createSchemaVersionTable}, s.executed)
+}
+
+func TestMigrateSchemaErrors(t *testing.T) {
+	s := newSchemaTest(SchemaVersion+1, nil, 172800)
+	assert.EqualError(t, MigrateSchema(s.session, "jaeger_v1_test"), "Cassandra schema version 4 is newer than the version 3 of this collector")
+	assert.Equal(t, []string{createSchemaVersionTable}, s.executed)
+
+	s = newSchemaTest(0, nil, -1)
+	assert.EqualError(t, MigrateSchema(s.session, "jaeger_v1_test"), "Cassandra keyspace jaeger_v1_test has no traces table to migrate, create it from the schema template")
+	assert.Equal(t, []string{createSchemaVersionTable}, s.executed)
+
+	execQuery := &mocks.Query{}
+	execQuery.On("Exec").Return(errors.New("no permission"))
+	session := &mocks.Session{}
+	session.On("Query", createSchemaVersionTable, []interface{}(nil)).Return(execQuery)
+	assert.EqualError(t, MigrateSchema(session, "jaeger_v1_test"), "Failed to create the Cassandra schema_version table: no permission")
+}
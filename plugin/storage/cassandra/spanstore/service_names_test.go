@@ -92,6 +92,7 @@ func TestServiceNamesStorageWrite(t *testing.T) {
 				counts, _ := s.metricsFactory.Snapshot()
 				assert.Equal(t, map[string]int64{
 					"ServiceNames.attempts": 2, "ServiceNames.inserts": 1, "ServiceNames.errors": 1,
+					"ServiceNames.errors-by-category|category=unknown": 1,
 				}, counts)
 
 				// write again
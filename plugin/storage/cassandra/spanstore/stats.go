@@ -0,0 +1,79 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+// GetTraceStats implements spanstore.StatsReader with a bounded scan: the traces of each service within the time
+// range are looked up in the service name index, and up to MaxTraces of them are read to count their spans. The
+// statistics are truncated when more traces of a service were found.
+func (s *SpanReader) GetTraceStats(query *spanstore.StatsQueryParameters) (*spanstore.TraceStats, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	maxTraces := query.MaxTraces
+	if maxTraces <= 0 {
+		maxTraces = spanstore.DefaultStatsMaxTraces
+	}
+	services := []string{query.ServiceName}
+	if query.ServiceName == "" {
+		var err error
+		if services, err = s.serviceNamesReader(); err != nil {
+			return nil, err
+		}
+	}
+	builder := spanstore.NewTraceStatsBuilder(query)
+	for _, service := range services {
+		traceIDs, err := s.queryByService(&spanstore.TraceQueryParameters{
+			ServiceName:  service,
+			StartTimeMin: query.StartTimeMin,
+			StartTimeMax: query.StartTimeMax,
+			NumTraces:    maxTraces,
+		})
+		if err != nil {
+			return nil, err
+		}
+		read := 0
+		for traceID := range traceIDs {
+			if builder.Has(traceID.ToDomain()) {
+				// a trace of several services is read once
+				continue
+			}
+			if read == maxTraces {
+				builder.Truncate()
+				break
+			}
+			trace, err := s.readTrace(traceID)
+			if err == spanstore.ErrTraceNotFound {
+				// the entries of the index outlive the spans
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			builder.AddTrace(trace)
+			read++
+		}
+	}
+	return builder.Stats(), nil
+}
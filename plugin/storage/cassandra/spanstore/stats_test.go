@@ -0,0 +1,147 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/pkg/cassandra"
+	"github.com/uber/jaeger/pkg/cassandra/mocks"
+	"github.com/uber/jaeger/plugin/storage/cassandra/spanstore/dbmodel"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+var _ spanstore.StatsReader = &SpanReader{} // check API conformance
+
+func TestSpanReaderGetTraceStats(t *testing.T) {
+	startTime := model.EpochMicrosecondsAsTime(1485467191639875)
+	statsQuery := spanstore.StatsQueryParameters{
+		StartTimeMin: startTime.Add(-time.Hour),
+		StartTimeMax: startTime.Add(time.Hour),
+	}
+	traceID1 := dbmodel.TraceIDFromDomain(model.TraceID{Low: 1})
+	traceID2 := dbmodel.TraceIDFromDomain(model.TraceID{Low: 2})
+	readQuery := func(err error, scans ...func(args []interface{})) *mocks.Query {
+		iter := &mocks.Iterator{}
+		for _, scan := range scans {
+			iter.On("Scan", matchOnceWithSideEffect(scan)).Return(true)
+		}
+		iter.On("Scan", matchEverything()).Return(false)
+		iter.On("Close").Return(err)
+		query := &mocks.Query{}
+		query.On("Consistency", cassandra.One).Return(query)
+		query.On("PageSize", 0).Return(query)
+		query.On("Iter").Return(iter)
+		return query
+	}
+	indexRow := func(traceID dbmodel.TraceID) func(args []interface{}) {
+		return func(args []interface{}) {
+			*args[0].(*dbmodel.TraceID) = traceID
+		}
+	}
+	spanRow := func(traceID dbmodel.TraceID, service string, failed bool) func(args []interface{}) {
+		return func(args []interface{}) {
+			*args[0].(*dbmodel.TraceID) = traceID
+			*args[5].(*int64) = int64(model.TimeAsEpochMicroseconds(startTime))
+			// the tags of the previous row are overwritten
+			*args[7].(*[]dbmodel.KeyValue) = []dbmodel.KeyValue{
+				{Key: "error", ValueType: model.BoolType.String(), ValueBool: failed},
+			}
+			*args[10].(*dbmodel.Process) = dbmodel.Process{ServiceName: service}
+		}
+	}
+	newReader := func(indexErr error) (*SpanReader, *mocks.Session) {
+		session := &mocks.Session{}
+		reader := NewSpanReader(session, metrics.NullFactory, zap.NewNop())
+		reader.serviceNamesReader = func() ([]string, error) { return []string{"service-a", "service-b"}, nil }
+		session.On("Query", stringMatcher(queryByServiceName), mock.MatchedBy(func(v []interface{}) bool {
+			return v[0] == "service-a"
+		})).Return(readQuery(indexErr, indexRow(traceID1), indexRow(traceID2)))
+		session.On("Query", stringMatcher(queryByServiceName), matchEverything()).
+			Return(readQuery(nil, indexRow(traceID2)))
+		session.On("Query", stringMatcher(querySpanByTraceID), []interface{}{traceID1}).
+			Return(readQuery(nil, spanRow(traceID1, "service-a", true), spanRow(traceID1, "service-a", false)))
+		session.On("Query", stringMatcher(querySpanByTraceID), []interface{}{traceID2}).
+			Return(readQuery(nil, spanRow(traceID2, "service-a", false), spanRow(traceID2, "service-b", true)))
+		return reader, session
+	}
+
+	t.Run("all services", func(t *testing.T) {
+		reader, session := newReader(nil)
+		query := statsQuery
+		stats, err := reader.GetTraceStats(&query)
+		assert.NoError(t, err)
+		assert.Equal(t, &spanstore.TraceStats{
+			Traces:     2,
+			Spans:      4,
+			ErrorSpans: 2,
+			Services: []spanstore.ServiceStats{
+				{ServiceName: "service-a", Spans: 3, ErrorSpans: 1},
+				{ServiceName: "service-b", Spans: 1, ErrorSpans: 1},
+			},
+		}, stats)
+		// the trace of both services is read once
+		session.AssertNumberOfCalls(t, "Query", 4)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		reader, _ := newReader(nil)
+		query := statsQuery
+		query.ServiceName = "service-a"
+		query.MaxTraces = 1
+		stats, err := reader.GetTraceStats(&query)
+		assert.NoError(t, err)
+		assert.True(t, stats.Truncated)
+		assert.Equal(t, 1, stats.Traces)
+		if assert.Len(t, stats.Services, 1) {
+			assert.Equal(t, "service-a", stats.Services[0].ServiceName)
+		}
+	})
+
+	t.Run("index error", func(t *testing.T) {
+		reader, _ := newReader(errors.New("timeout"))
+		query := statsQuery
+		_, err := reader.GetTraceStats(&query)
+		assert.EqualError(t, err, "timeout")
+	})
+
+	t.Run("services error", func(t *testing.T) {
+		reader, _ := newReader(nil)
+		reader.serviceNamesReader = func() ([]string, error) { return nil, errors.New("timeout") }
+		query := statsQuery
+		_, err := reader.GetTraceStats(&query)
+		assert.EqualError(t, err, "timeout")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		reader, _ := newReader(nil)
+		_, err := reader.GetTraceStats(&spanstore.StatsQueryParameters{})
+		assert.EqualError(t, err, spanstore.ErrStatsTimeRangeNotSet.Error())
+	})
+}
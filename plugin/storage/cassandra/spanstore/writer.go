@@ -23,6 +23,7 @@ package spanstore
 import (
 	"encoding/json"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 	"unicode/utf8"
@@ -32,6 +33,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/model/codec"
 	"github.com/uber/jaeger/pkg/cassandra"
 	casMetrics "github.com/uber/jaeger/pkg/cassandra/metrics"
 	"github.com/uber/jaeger/plugin/storage/cassandra/spanstore/dbmodel"
@@ -43,6 +45,15 @@ const (
 		INTO traces(trace_id, span_id, span_hash, parent_id, operation_name, flags,
 				    start_time, duration, tags, logs, refs, process)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	insertBucketedSpan = `
+		INSERT
+		INTO trace_buckets(trace_id, bucket, span_id, span_hash, parent_id, operation_name, flags,
+				    start_time, duration, tags, logs, refs, process)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	insertTraceBucket = `
+		INSERT
+		INTO trace_bucket_index(trace_id, bucket)
+		VALUES (?, ?)`
 	insertTag = `
 		INSERT
 		INTO tag_index(trace_id, span_id, service_name, start_time, tag_key, tag_value)
@@ -59,11 +70,19 @@ const (
 		service_operation_index(service_name, operation_name, start_time, trace_id)
 		VALUES (?, ?, ?, ?)`
 
+	serviceSpanKindIndex = `
+		INSERT
+		INTO service_span_kind_index(service_name, span_kind, bucket, start_time, trace_id)
+		VALUES (?, ?, ?, ?, ?)`
+
 	durationIndex = `
 		INSERT
 		INTO duration_index(service_name, operation_name, bucket, duration, start_time, trace_id)
 		VALUES (?, ?, ?, ?, ?, ?)`
 
+	// usingTTL makes the inserted row expire, its TTL bound as the last value of the query
+	usingTTL = ` USING TTL ?`
+
 	maximumTagKeyOrValueSize = 256
 
 	// DefaultNumBuckets Number of buckets for bucketed keys
@@ -75,16 +94,128 @@ const (
 type serviceNamesWriter func(serviceName string) error
 type operationNamesWriter func(serviceName, operationName string) error
 
+// WriterOption is a function that sets some option on the SpanWriter.
+type WriterOption func(*SpanWriter)
+
+// WriterOptions is a factory for all available WriterOption's
+var WriterOptions writerOptions
+
+type writerOptions struct{}
+
+// Compression creates a WriterOption that compresses the tags and logs of spans before storing them.
+// Spans are read back whatever their compression, so this can be changed at any time.
+func (writerOptions) Compression(compression dbmodel.Compression) WriterOption {
+	return func(s *SpanWriter) {
+		s.compression = compression
+	}
+}
+
+// Serialization creates a WriterOption that stores spans serialized with the given format,
+// instead of spreading their tags, logs and references across columns. Rows are read back
+// whatever the format they were written with, so this can be changed at any time.
+func (writerOptions) Serialization(format codec.Format) WriterOption {
+	return func(s *SpanWriter) {
+		s.format = format
+	}
+}
+
+// TTL creates a WriterOption that expires spans of the services after their TTL, or after the
+// default TTL for services without one. Spans are kept for the TTL of the tables when it is zero.
+// Cassandra drops expired spans during compaction, so changing the TTLs only affects new spans.
+func (writerOptions) TTL(defaultTTL time.Duration, serviceTTLs map[string]time.Duration) WriterOption {
+	return func(s *SpanWriter) {
+		s.defaultTTL = defaultTTL
+		s.serviceTTLs = serviceTTLs
+	}
+}
+
+// Consistency creates a WriterOption that writes spans at the given consistency level, lowered to the load
+// shedding level for the load shedding period after a write failed because Cassandra timed out or was
+// unavailable. Every such failure extends the period; load is never shed when the period is zero.
+func (writerOptions) Consistency(level, loadSheddingLevel cassandra.Consistency, loadSheddingPeriod time.Duration) WriterOption {
+	return func(s *SpanWriter) {
+		s.consistency = &writeConsistency{
+			level:          level,
+			sheddingLevel:  loadSheddingLevel,
+			sheddingPeriod: loadSheddingPeriod,
+			now:            time.Now,
+		}
+	}
+}
+
+// Bucketing creates a WriterOption that stores the spans of a trace beyond the threshold in buckets
+// of the trace_buckets table holding at most threshold spans each, so that the partitions of large
+// traces stay bounded. The spans are counted by each writer, so a bucket receives at most threshold
+// spans from every collector. Readers must be created with ReaderOptions.Bucketing to find them.
+func (writerOptions) Bucketing(threshold int) WriterOption {
+	return func(s *SpanWriter) {
+		s.bucketThreshold = threshold
+	}
+}
+
+// PromotedTags creates a WriterOption that indexes the tags with the given keys in the service_promoted_tag_index
+// table rather than in the tag_index table. Its partitions of each service and tag value are spread over buckets,
+// so that frequent values do not make hot partitions. Readers must be created with ReaderOptions.PromotedTags
+// to find them.
+func (writerOptions) PromotedTags(keys []string) WriterOption {
+	return func(s *SpanWriter) {
+		s.promotedTags = newPromotedTags(keys)
+	}
+}
+
+// spanTTL is the number of seconds before a span expires, zero leaving it to the table's default
+type spanTTL int
+
+// statement returns the insert statement expiring rows after the TTL
+func (t spanTTL) statement(stmt string) string {
+	if t == 0 {
+		return stmt
+	}
+	return stmt + usingTTL
+}
+
+// values returns the values bound to the statement returned by statement
+func (t spanTTL) values(values ...interface{}) []interface{} {
+	if t == 0 {
+		return values
+	}
+	return append(values, int(t))
+}
+
+// extended returns the TTL extended to at least ttl, which also replaces the table's default
+func (t spanTTL) extended(ttl time.Duration) spanTTL {
+	if extended := spanTTL(ttl / time.Second); extended > t {
+		return extended
+	}
+	return t
+}
+
+// compressionMetrics allow to weigh the space saved by compression against its processing time
+type compressionMetrics struct {
+	BytesIn  metrics.Counter `metric:"compression.bytes-in"`
+	BytesOut metrics.Counter `metric:"compression.bytes-out"`
+	// Ratio is the percentage of the original size left after compression, since the writer started
+	Ratio metrics.Gauge `metric:"compression.ratio-percent"`
+	Time  metrics.Timer `metric:"compression.time"`
+}
+
 type spanWriterMetrics struct {
 	traces                *casMetrics.Table
+	traceBucketIndex      *casMetrics.Table
 	tagIndex              *casMetrics.Table
 	serviceNameIndex      *casMetrics.Table
 	serviceOperationIndex *casMetrics.Table
+	serviceSpanKindIndex  *casMetrics.Table
 	durationIndex         *casMetrics.Table
+	promotedTagIndex      *casMetrics.Table
 }
 
 // SpanWriter handles all writes to Cassandra for the Jaeger data model
 type SpanWriter struct {
+	// accessed atomically, kept first for 64-bit alignment on 32-bit platforms
+	totalBytesIn  int64
+	totalBytesOut int64
+
 	session              cassandra.Session
 	serviceNamesWriter   serviceNamesWriter
 	operationNamesWriter operationNamesWriter
@@ -92,6 +223,23 @@ type SpanWriter struct {
 	logger               *zap.Logger
 	tagIndexSkipped      metrics.Counter
 	bucketCounter        uint32
+	compression          dbmodel.Compression
+	compressionMetrics   compressionMetrics
+	format               codec.Format
+	serializer           *codec.Serializer
+	defaultTTL           time.Duration
+	serviceTTLs          map[string]time.Duration
+	// unmappedServices are the services without a TTL that have already been logged
+	unmappedServices map[string]struct{}
+	unmappedLock     sync.Mutex
+	// consistency is nil when writes use the default consistency level of the session
+	consistency *writeConsistency
+	// buckets is nil when the spans of a trace are all stored in the same partition
+	buckets         *traceBuckets
+	bucketThreshold int
+	// promotedTags is nil when no tag is indexed in the service_promoted_tag_index table
+	promotedTags       promotedTags
+	promotedTagMissing metrics.Counter
 }
 
 // NewSpanWriter returns a SpanWriter
@@ -100,43 +248,87 @@ func NewSpanWriter(
 	writeCacheTTL time.Duration,
 	metricsFactory metrics.Factory,
 	logger *zap.Logger,
+	options ...WriterOption,
 ) *SpanWriter {
-	serviceNamesStorage := NewServiceNamesStorage(session, writeCacheTTL, metricsFactory, logger)
-	operationNamesStorage := NewOperationNamesStorage(session, writeCacheTTL, metricsFactory, logger)
-	tagIndexSkipped := metricsFactory.Counter("tagIndexSkipped", nil)
-	return &SpanWriter{
-		session:              session,
-		serviceNamesWriter:   serviceNamesStorage.Write,
-		operationNamesWriter: operationNamesStorage.Write,
+	writer := &SpanWriter{
 		writerMetrics: spanWriterMetrics{
 			traces:                casMetrics.NewTable(metricsFactory, "Traces"),
+			traceBucketIndex:      casMetrics.NewTable(metricsFactory, "TraceBucketIndex"),
 			tagIndex:              casMetrics.NewTable(metricsFactory, "TagIndex"),
 			serviceNameIndex:      casMetrics.NewTable(metricsFactory, "ServiceNameIndex"),
 			serviceOperationIndex: casMetrics.NewTable(metricsFactory, "ServiceOperationIndex"),
+			serviceSpanKindIndex:  casMetrics.NewTable(metricsFactory, "ServiceSpanKindIndex"),
 			durationIndex:         casMetrics.NewTable(metricsFactory, "DurationIndex"),
+			promotedTagIndex:      casMetrics.NewTable(metricsFactory, "PromotedTagIndex"),
 		},
-		logger:          logger,
-		tagIndexSkipped: tagIndexSkipped,
+		logger:             logger,
+		tagIndexSkipped:    metricsFactory.Counter("tagIndexSkipped", nil),
+		promotedTagMissing: metricsFactory.Counter("promotedTagMissing", nil),
+	}
+	for _, option := range options {
+		option(writer)
+	}
+	if writer.consistency != nil {
+		writer.consistency.sheddingCount = metricsFactory.Counter("load-shedding", nil)
+		writer.consistency.logger = logger
+		session = consistentSession{Session: session, consistency: writer.consistency}
 	}
+	if writer.bucketThreshold > 0 {
+		writer.buckets = newTraceBuckets(writer.bucketThreshold, metricsFactory)
+	}
+	writer.session = session
+	writer.serviceNamesWriter = NewServiceNamesStorage(session, writeCacheTTL, metricsFactory, logger).Write
+	writer.operationNamesWriter = NewOperationNamesStorage(session, writeCacheTTL, metricsFactory, logger).Write
+	metrics.Init(&writer.compressionMetrics, metricsFactory, nil)
+	writer.serializer = codec.NewSerializer(metricsFactory)
+	return writer
 }
 
 // WriteSpan saves the span into Cassandra
 func (s *SpanWriter) WriteSpan(span *model.Span) error {
+	return s.writeSpan(span, 0)
+}
+
+// writeSpan saves the span into Cassandra, expiring it after minTTL if longer than the TTL of its service
+func (s *SpanWriter) writeSpan(span *model.Span, minTTL time.Duration) error {
 	ds := dbmodel.FromDomain(span)
+	if s.format != codec.NoFormat {
+		data, err := s.serializer.Serialize(s.format, span)
+		if err != nil {
+			return s.logError(ds, err, "Failed to serialize span", s.logger)
+		}
+		dbmodel.SetSerializedSpan(ds, data)
+	}
+	if err := s.compressSpan(ds); err != nil {
+		return s.logError(ds, err, "Failed to compress span", s.logger)
+	}
+	ttl := s.spanTTL(ds.ServiceName).extended(minTTL)
+	stmt, values := insertSpan, []interface{}{ds.TraceID}
+	if s.buckets != nil {
+		bucket, err := s.traceBucket(ds.TraceID, ttl)
+		if err != nil {
+			return s.logError(ds, err, "Failed to index trace bucket", s.logger)
+		}
+		if bucket > 0 {
+			stmt, values = insertBucketedSpan, append(values, bucket)
+		}
+	}
 	mainQuery := s.session.Query(
-		insertSpan,
-		ds.TraceID,
-		ds.SpanID,
-		ds.SpanHash,
-		ds.ParentID,
-		ds.OperationName,
-		ds.Flags,
-		ds.StartTime,
-		ds.Duration,
-		ds.Tags,
-		ds.Logs,
-		ds.Refs,
-		ds.Process,
+		ttl.statement(stmt),
+		ttl.values(append(
+			values,
+			ds.SpanID,
+			ds.SpanHash,
+			ds.ParentID,
+			ds.OperationName,
+			ds.Flags,
+			ds.StartTime,
+			ds.Duration,
+			ds.Tags,
+			ds.Logs,
+			ds.Refs,
+			ds.Process,
+		)...)...,
 	)
 
 	if err := s.writerMetrics.traces.Exec(mainQuery, s.logger); err != nil {
@@ -147,30 +339,114 @@ func (s *SpanWriter) WriteSpan(span *model.Span) error {
 		return s.logError(ds, err, "Failed to insert service name and operation name", s.logger)
 	}
 
-	if err := s.indexByTags(span, ds); err != nil {
+	if err := s.indexByTags(span, ds, ttl); err != nil {
 		return s.logError(ds, err, "Failed to index tags", s.logger)
 	}
 
-	if err := s.indexBySerice(span.TraceID, ds); err != nil {
+	if err := s.indexBySerice(span.TraceID, ds, ttl); err != nil {
 		return s.logError(ds, err, "Failed to index service name", s.logger)
 	}
 
-	if err := s.indexByOperation(span.TraceID, ds); err != nil {
+	if err := s.indexByOperation(span.TraceID, ds, ttl); err != nil {
 		return s.logError(ds, err, "Failed to index operation name", s.logger)
 	}
 
-	if err := s.indexByDuration(ds, span.StartTime); err != nil {
+	if err := s.indexByDuration(ds, span.StartTime, ttl); err != nil {
 		return s.logError(ds, err, "Failed to index duration", s.logger)
 	}
+
+	if err := s.indexBySpanKind(span.GetSpanKind(), ds, ttl); err != nil {
+		return s.logError(ds, err, "Failed to index span kind", s.logger)
+	}
+	return nil
+}
+
+// traceBucket returns the bucket of the next span of the trace, indexing the bucket the first time
+// it is used so that readers find it
+func (s *SpanWriter) traceBucket(traceID dbmodel.TraceID, ttl spanTTL) (int, error) {
+	bucket, indexed := s.buckets.next(traceID)
+	if bucket == 0 || indexed {
+		return bucket, nil
+	}
+	query := s.session.Query(ttl.statement(insertTraceBucket), ttl.values(traceID, bucket)...)
+	if err := s.writerMetrics.traceBucketIndex.Exec(query, s.logger); err != nil {
+		return 0, err
+	}
+	s.buckets.markIndexed(traceID, bucket)
+	return bucket, nil
+}
+
+// spanTTL returns the TTL of the spans of the service, logging the first span of services without one
+func (s *SpanWriter) spanTTL(serviceName string) spanTTL {
+	ttl, ok := s.serviceTTLs[serviceName]
+	if !ok {
+		ttl = s.defaultTTL
+		if len(s.serviceTTLs) > 0 {
+			if s.firstUnmapped(serviceName) {
+				s.logger.Info("No span TTL for the service, using the default",
+					zap.String("service_name", serviceName),
+					zap.Duration("ttl", ttl))
+			}
+		}
+	}
+	return spanTTL(ttl / time.Second)
+}
+
+// firstUnmapped returns true the first time it is called for the service
+func (s *SpanWriter) firstUnmapped(serviceName string) bool {
+	s.unmappedLock.Lock()
+	defer s.unmappedLock.Unlock()
+	if _, ok := s.unmappedServices[serviceName]; ok {
+		return false
+	}
+	if s.unmappedServices == nil {
+		s.unmappedServices = make(map[string]struct{})
+	}
+	s.unmappedServices[serviceName] = struct{}{}
+	return true
+}
+
+// compressSpan compresses the tags and logs stored in the traces table, the indexes are
+// populated from the domain span and are not affected.
+func (s *SpanWriter) compressSpan(ds *dbmodel.Span) error {
+	if s.compression == dbmodel.NoCompression {
+		return nil
+	}
+	start := time.Now()
+	bytesIn, bytesOut, err := dbmodel.CompressSpan(ds, s.compression)
+	s.compressionMetrics.Time.Record(time.Since(start))
+	if err != nil {
+		return err
+	}
+	s.compressionMetrics.BytesIn.Inc(int64(bytesIn))
+	s.compressionMetrics.BytesOut.Inc(int64(bytesOut))
+	totalIn := atomic.AddInt64(&s.totalBytesIn, int64(bytesIn))
+	totalOut := atomic.AddInt64(&s.totalBytesOut, int64(bytesOut))
+	if totalIn > 0 {
+		s.compressionMetrics.Ratio.Update(totalOut * 100 / totalIn)
+	}
 	return nil
 }
 
-func (s *SpanWriter) indexByTags(span *model.Span, ds *dbmodel.Span) error {
+func (s *SpanWriter) indexByTags(span *model.Span, ds *dbmodel.Span, ttl spanTTL) error {
+	var promoted map[string]struct{}
+	if s.promotedTags != nil {
+		promoted = make(map[string]struct{}, len(s.promotedTags))
+	}
 	for _, v := range dbmodel.GetAllUniqueTags(span) {
 		// we should introduce retries or just ignore failures imo, retrying each individual tag insertion might be better
 		// we should consider bucketing.
-		if s.shouldIndexTag(v) {
-			insertTagQuery := s.session.Query(insertTag, ds.TraceID, ds.SpanID, v.ServiceName, ds.StartTime, v.TagKey, v.TagValue)
+		if shouldIndexTag(v) && s.promotedTags.contains(v.TagKey) {
+			// the promoted tags are only indexed in their table, whose buckets spread the frequent values
+			if err := s.indexPromotedTag(v, ds, ttl); err != nil {
+				return err
+			}
+			promoted[v.TagKey] = struct{}{}
+		} else if shouldIndexTag(v) {
+			insertTagQuery := s.session.Query(
+				ttl.statement(insertTag),
+				ttl.values(ds.TraceID, ds.SpanID, v.ServiceName, ds.StartTime, v.TagKey, v.TagValue)...,
+			)
 			if err := s.writerMetrics.tagIndex.Exec(insertTagQuery, s.logger); err != nil {
 				withTagInfo := s.logger.
 					With(zap.String("tag_key", v.TagKey)).
@@ -182,15 +458,19 @@ func (s *SpanWriter) indexByTags(span *model.Span, ds *dbmodel.Span) error {
 			s.tagIndexSkipped.Inc(1)
 		}
 	}
+	// the spans without some promoted tags are only found by the others
+	if missing := len(s.promotedTags) - len(promoted); missing > 0 {
+		s.promotedTagMissing.Inc(int64(missing))
+	}
 	return nil
 }
 
-func (s *SpanWriter) indexByDuration(span *dbmodel.Span, startTime time.Time) error {
-	query := s.session.Query(durationIndex)
+func (s *SpanWriter) indexByDuration(span *dbmodel.Span, startTime time.Time, ttl spanTTL) error {
+	query := s.session.Query(ttl.statement(durationIndex))
 	timeBucket := startTime.Round(durationBucketSize)
 	var err error
 	indexByOperationName := func(operationName string) {
-		q1 := query.Bind(span.Process.ServiceName, operationName, timeBucket, span.Duration, span.StartTime, span.TraceID)
+		q1 := query.Bind(ttl.values(span.Process.ServiceName, operationName, timeBucket, span.Duration, span.StartTime, span.TraceID)...)
 		if err2 := s.writerMetrics.durationIndex.Exec(q1, s.logger); err2 != nil {
 			s.logError(span, err2, "Cannot index duration", s.logger)
 			err = err2
@@ -201,21 +481,29 @@ func (s *SpanWriter) indexByDuration(span *dbmodel.Span, startTime time.Time) er
 	return err
 }
 
-func (s *SpanWriter) indexBySerice(traceID model.TraceID, span *dbmodel.Span) error {
+func (s *SpanWriter) indexBySerice(traceID model.TraceID, span *dbmodel.Span, ttl spanTTL) error {
 	bucketNo := atomic.AddUint32(&s.bucketCounter, 1) % defaultNumBuckets
-	query := s.session.Query(serviceNameIndex)
-	q := query.Bind(span.Process.ServiceName, bucketNo, span.StartTime, span.TraceID)
+	query := s.session.Query(ttl.statement(serviceNameIndex))
+	q := query.Bind(ttl.values(span.Process.ServiceName, bucketNo, span.StartTime, span.TraceID)...)
 	return s.writerMetrics.serviceNameIndex.Exec(q, s.logger)
 }
 
-func (s *SpanWriter) indexByOperation(traceID model.TraceID, span *dbmodel.Span) error {
-	query := s.session.Query(serviceOperationIndex)
-	q := query.Bind(span.Process.ServiceName, span.OperationName, span.StartTime, span.TraceID)
+func (s *SpanWriter) indexByOperation(traceID model.TraceID, span *dbmodel.Span, ttl spanTTL) error {
+	query := s.session.Query(ttl.statement(serviceOperationIndex))
+	q := query.Bind(ttl.values(span.Process.ServiceName, span.OperationName, span.StartTime, span.TraceID)...)
 	return s.writerMetrics.serviceOperationIndex.Exec(q, s.logger)
 }
 
+// indexBySpanKind indexes every span, those without a kind as model.SpanKindUnspecified
+func (s *SpanWriter) indexBySpanKind(kind model.SpanKind, span *dbmodel.Span, ttl spanTTL) error {
+	bucketNo := atomic.AddUint32(&s.bucketCounter, 1) % defaultNumBuckets
+	query := s.session.Query(ttl.statement(serviceSpanKindIndex))
+	q := query.Bind(ttl.values(span.Process.ServiceName, string(kind), bucketNo, span.StartTime, span.TraceID)...)
+	return s.writerMetrics.serviceSpanKindIndex.Exec(q, s.logger)
+}
+
 // shouldIndexTag checks to see if the tag is json or not, if it's UTF8 valid and it's not too large
-func (s *SpanWriter) shouldIndexTag(tag dbmodel.TagInsertion) bool {
+func shouldIndexTag(tag dbmodel.TagInsertion) bool {
 	isJSON := func(s string) bool {
 		var js map[string]interface{}
 		// poor man's string-is-a-json check shortcircuits full unmarshalling
@@ -27,10 +27,12 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/uber/jaeger-lib/metrics"
 	"go.uber.org/zap"
 
 	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/model/codec"
 	"github.com/uber/jaeger/pkg/cassandra/mocks"
 	"github.com/uber/jaeger/pkg/testutils"
 	"github.com/uber/jaeger/plugin/storage/cassandra/spanstore/dbmodel"
@@ -67,6 +69,7 @@ func TestSpanWriter(t *testing.T) {
 		serviceNameQueryError          error
 		serviceOperationNameQueryError error
 		durationNoOperationQueryError  error
+		spanKindQueryError             error
 		serviceNameError               error
 		expectedError                  string
 		expectedLogs                   []string
@@ -138,6 +141,16 @@ func TestSpanWriter(t *testing.T) {
 				`"error":"durationNoOperationError"`,
 			},
 		},
+		{
+			caption:            "add span to span kind index",
+			spanKindQueryError: errors.New("spanKindQueryError"),
+			expectedError:      "Failed to index span kind: failed to Exec query 'select from service_span_kind_index': spanKindQueryError",
+			expectedLogs: []string{
+				`"msg":"Failed to exec query"`,
+				`"query":"select from service_span_kind_index"`,
+				`"error":"spanKindQueryError"`,
+			},
+		},
 	}
 	for _, tc := range testCases {
 		testCase := tc // capture loop var
@@ -179,6 +192,11 @@ func TestSpanWriter(t *testing.T) {
 				durationNoOperationQuery.On("Exec").Return(testCase.durationNoOperationQueryError)
 				durationNoOperationQuery.On("String").Return("select from duration_index")
 
+				spanKindQuery := &mocks.Query{}
+				spanKindQuery.On("Bind", matchEverything()).Return(spanKindQuery)
+				spanKindQuery.On("Exec").Return(testCase.spanKindQueryError)
+				spanKindQuery.On("String").Return("select from service_span_kind_index")
+
 				w.session.On("Query", stringMatcher(insertSpan), matchEverything()).Return(spanQuery)
 				// note: using matchOnce below because we only want one tag to be inserted
 				w.session.On("Query", stringMatcher(insertTag), matchOnce()).Return(tagsQuery)
@@ -187,6 +205,7 @@ func TestSpanWriter(t *testing.T) {
 				w.session.On("Query", stringMatcher(serviceOperationIndex), matchEverything()).Return(serviceOperationNameQuery)
 
 				w.session.On("Query", stringMatcher(durationIndex), matchOnce()).Return(durationNoOperationQuery)
+				w.session.On("Query", stringMatcher(serviceSpanKindIndex), matchEverything()).Return(spanKindQuery)
 
 				w.writer.serviceNamesWriter = func(serviceName string) error { return testCase.serviceNameError }
 				w.writer.operationNamesWriter = func(serviceName, operationName string) error { return testCase.serviceNameError }
@@ -208,6 +227,188 @@ func TestSpanWriter(t *testing.T) {
 	}
 }
 
+func TestSpanWriterCompression(t *testing.T) {
+	session := &mocks.Session{}
+	metricsFactory := metrics.NewLocalFactory(0)
+	writer := NewSpanWriter(session, 0, metricsFactory, zap.NewNop(), WriterOptions.Compression(dbmodel.ZstdCompression))
+	span := &model.Span{
+		TraceID: model.TraceID{Low: 1},
+		Process: &model.Process{ServiceName: "service-a"},
+	}
+	for i := 0; i < 10; i++ {
+		span.Tags = append(span.Tags, model.String("sql.query", "SELECT * FROM customers WHERE id = ?"))
+	}
+	ds := dbmodel.FromDomain(span)
+	assert.NoError(t, writer.compressSpan(ds))
+	assert.True(t, dbmodel.IsCompressed(ds))
+
+	counters, gauges := metricsFactory.Snapshot()
+	assert.True(t, counters["compression.bytes-out"] < counters["compression.bytes-in"])
+	assert.True(t, gauges["compression.ratio-percent"] < 100)
+	assert.NotZero(t, gauges["compression.ratio-percent"])
+}
+
+func TestSpanWriterSerialization(t *testing.T) {
+	session := &mocks.Session{}
+	writer := NewSpanWriter(session, 0, metrics.NullFactory, zap.NewNop(), WriterOptions.Serialization(codec.ProtobufFormat))
+	span := &model.Span{
+		TraceID:       model.TraceID{Low: 1},
+		OperationName: "operation-a",
+		Tags:          model.KeyValues{model.String("x", "y")},
+		Process:       &model.Process{ServiceName: "service-a"},
+	}
+
+	query := &mocks.Query{}
+	query.On("Bind", matchEverything()).Return(query)
+	query.On("Exec").Return(nil)
+	var tags []dbmodel.KeyValue
+	session.On("Query", stringMatcher(insertSpan), matchOnceWithSideEffect(func(args []interface{}) {
+		tags = args[8].([]dbmodel.KeyValue)
+	})).Return(query)
+	session.On("Query", mock.AnythingOfType("string"), matchEverything()).Return(query)
+	writer.serviceNamesWriter = func(serviceName string) error { return nil }
+	writer.operationNamesWriter = func(serviceName, operationName string) error { return nil }
+
+	assert.NoError(t, writer.WriteSpan(span))
+	data, ok := dbmodel.SerializedSpan(&dbmodel.Span{Tags: tags})
+	if assert.True(t, ok) {
+		assert.Equal(t, byte(codec.ProtobufFormat), data[0])
+		decoded, err := codec.NewSerializer(metrics.NullFactory).Deserialize(data)
+		assert.NoError(t, err)
+		assert.Equal(t, span.Tags, decoded.Tags)
+	}
+	// the tags are still indexed from the domain span
+	session.AssertCalled(t, "Query", stringMatcher(insertTag), matchEverything())
+}
+
+func TestSpanWriterTTL(t *testing.T) {
+	session := &mocks.Session{}
+	logger, logBuffer := testutils.NewLogger()
+	writer := NewSpanWriter(session, 0, metrics.NullFactory, logger, WriterOptions.TTL(
+		72*time.Hour,
+		map[string]time.Duration{"security": 90 * 24 * time.Hour},
+	))
+	writer.serviceNamesWriter = func(serviceName string) error { return nil }
+	writer.operationNamesWriter = func(serviceName, operationName string) error { return nil }
+
+	var statements []string
+	var values [][]interface{}
+	query := &mocks.Query{}
+	query.On("Bind", matchEverything()).Run(func(args mock.Arguments) {
+		values = append(values, args.Get(0).([]interface{}))
+	}).Return(query)
+	query.On("Exec").Return(nil)
+	session.On("Query", mock.AnythingOfType("string"), matchEverything()).Run(func(args mock.Arguments) {
+		statements = append(statements, args.String(0))
+		if v := args.Get(1).([]interface{}); len(v) > 0 {
+			values = append(values, v)
+		}
+	}).Return(query)
+
+	testCases := []struct {
+		service     string
+		expectedTTL int
+	}{
+		{service: "security", expectedTTL: 90 * 24 * 3600},
+		{service: "dev", expectedTTL: 72 * 3600},
+		{service: "dev", expectedTTL: 72 * 3600},
+	}
+	for _, testCase := range testCases {
+		statements, values = nil, nil
+		span := &model.Span{
+			TraceID: model.TraceID{Low: 1},
+			Tags:    model.KeyValues{model.String("x", "y")},
+			Process: &model.Process{ServiceName: testCase.service},
+		}
+		assert.NoError(t, writer.WriteSpan(span))
+		// the span, its tag, its service, operation, span kind and the two duration indexes
+		assert.Len(t, statements, 6)
+		for _, statement := range statements {
+			assert.True(t, strings.HasSuffix(statement, usingTTL), statement)
+		}
+		assert.Len(t, values, 7)
+		for _, v := range values {
+			assert.Equal(t, testCase.expectedTTL, v[len(v)-1])
+		}
+	}
+	assert.Equal(t, 1, strings.Count(logBuffer.String(), "No span TTL for the service, using the default"))
+	assert.Contains(t, logBuffer.String(), `"service_name":"dev"`)
+}
+
+func TestSpanWriterBucketing(t *testing.T) {
+	session := &mocks.Session{}
+	metricsFactory := metrics.NewLocalFactory(0)
+	writer := NewSpanWriter(session, 0, metricsFactory, zap.NewNop(), WriterOptions.Bucketing(2))
+	writer.serviceNamesWriter = func(serviceName string) error { return nil }
+	writer.operationNamesWriter = func(serviceName, operationName string) error { return nil }
+
+	var spanBuckets []interface{}
+	var indexedBuckets []interface{}
+	query := &mocks.Query{}
+	query.On("Bind", matchEverything()).Return(query)
+	query.On("Exec").Return(nil)
+	session.On("Query", stringMatcher(insertSpan), matchEverything()).Run(func(args mock.Arguments) {
+		spanBuckets = append(spanBuckets, 0)
+	}).Return(query)
+	session.On("Query", stringMatcher(insertBucketedSpan), matchEverything()).Run(func(args mock.Arguments) {
+		spanBuckets = append(spanBuckets, args.Get(1).([]interface{})[1])
+	}).Return(query)
+	session.On("Query", stringMatcher(insertTraceBucket), matchEverything()).Run(func(args mock.Arguments) {
+		indexedBuckets = append(indexedBuckets, args.Get(1).([]interface{})[1])
+	}).Return(query)
+	session.On("Query", mock.AnythingOfType("string"), matchEverything()).Return(query)
+
+	for i := 0; i < 5; i++ {
+		span := &model.Span{
+			TraceID: model.TraceID{Low: 1},
+			SpanID:  model.SpanID(i),
+			Process: &model.Process{ServiceName: "service-a"},
+		}
+		assert.NoError(t, writer.WriteSpan(span))
+	}
+	assert.Equal(t, []interface{}{0, 0, 1, 1, 2}, spanBuckets)
+	assert.Equal(t, []interface{}{1, 2}, indexedBuckets)
+
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counters["bucketed-traces"])
+}
+
+func TestSpanWriterBucketingIndexError(t *testing.T) {
+	session := &mocks.Session{}
+	logger, logBuffer := testutils.NewLogger()
+	writer := NewSpanWriter(session, 0, metrics.NullFactory, logger, WriterOptions.Bucketing(1))
+	writer.serviceNamesWriter = func(serviceName string) error { return nil }
+	writer.operationNamesWriter = func(serviceName, operationName string) error { return nil }
+
+	query := &mocks.Query{}
+	query.On("Bind", matchEverything()).Return(query)
+	query.On("Exec").Return(nil)
+	indexQuery := &mocks.Query{}
+	indexQuery.On("Exec").Return(errors.New("index error"))
+	indexQuery.On("String").Return("insert into trace_bucket_index")
+	session.On("Query", stringMatcher(insertTraceBucket), matchEverything()).Return(indexQuery)
+	session.On("Query", mock.AnythingOfType("string"), matchEverything()).Return(query)
+
+	span := &model.Span{
+		TraceID: model.TraceID{Low: 1},
+		Process: &model.Process{ServiceName: "service-a"},
+	}
+	assert.NoError(t, writer.WriteSpan(span))
+	err := writer.WriteSpan(span)
+	assert.EqualError(t, err, "Failed to index trace bucket: failed to Exec query 'insert into trace_bucket_index': index error")
+	assert.Contains(t, logBuffer.String(), "Failed to index trace bucket")
+	session.AssertNotCalled(t, "Query", stringMatcher(insertBucketedSpan), matchEverything())
+}
+
+func TestSpanWriterWithoutTTL(t *testing.T) {
+	withSpanWriter(0, func(w *spanWriterTest) {
+		assert.Equal(t, spanTTL(0), w.writer.spanTTL("service-a"))
+		assert.Equal(t, insertSpan, spanTTL(0).statement(insertSpan))
+		assert.Equal(t, []interface{}{"service-a"}, spanTTL(0).values("service-a"))
+		assert.Equal(t, "", w.logBuffer.String())
+	})
+}
+
 func TestSpanWriterSaveServiceNameAndOperationName(t *testing.T) {
 	expectedErr := errors.New("some error")
 	testCases := []struct {
@@ -266,7 +467,7 @@ func TestSpanWriterSkippingTags(t *testing.T) {
 				TagKey:      testCase.key,
 				TagValue:    testCase.value,
 			}
-			ok := w.writer.shouldIndexTag(db)
+			ok := shouldIndexTag(db)
 			assert.Equal(t, testCase.insert, ok)
 		})
 	}
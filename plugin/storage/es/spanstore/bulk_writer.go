@@ -0,0 +1,259 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/olivere/elastic"
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/model/converter/json"
+	"github.com/uber/jaeger/pkg/es"
+	storageMetrics "github.com/uber/jaeger/storage/spanstore/metrics"
+)
+
+const (
+	defaultBulkSize          = 500
+	defaultBulkFlushInterval = time.Second
+	defaultBulkRetryBackoff  = 100 * time.Millisecond
+	maxBulkRetryBackoff      = 10 * time.Second
+)
+
+// BulkOptions control how spans are buffered before being sent to ElasticSearch in one bulk request
+type BulkOptions struct {
+	// Size is the number of buffered spans that triggers a flush
+	Size int
+	// FlushInterval is the maximum time a span stays in the buffer
+	FlushInterval time.Duration
+	// MaxRetries is the number of times documents rejected by ElasticSearch are sent again, 0 disabling the retries
+	MaxRetries int
+	// RetryBackoff is the time waited before the first retry, doubled before each next one
+	RetryBackoff time.Duration
+}
+
+func (o BulkOptions) withDefaults() BulkOptions {
+	if o.Size <= 0 {
+		o.Size = defaultBulkSize
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = defaultBulkFlushInterval
+	}
+	if o.MaxRetries < 0 {
+		o.MaxRetries = 0
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = defaultBulkRetryBackoff
+	}
+	return o
+}
+
+type bulkWriterMetrics struct {
+	// Size is the number of documents in the last bulk request
+	Size metrics.Gauge `metric:"bulk-index.size"`
+	// RetriedDocs counts documents sent again after being rejected
+	RetriedDocs metrics.Counter `metric:"bulk-index.retried-docs"`
+	// DroppedDocs counts documents that could not be indexed
+	DroppedDocs metrics.Counter `metric:"bulk-index.dropped-docs"`
+}
+
+// BulkSpanWriter is a SpanWriter that buffers spans and indexes them in ElasticSearch with bulk requests.
+// Close must be called to flush the spans still in the buffer.
+type BulkSpanWriter struct {
+	*SpanWriter
+	options     BulkOptions
+	bulkIndex   *storageMetrics.WriteMetrics
+	bulkMetrics bulkWriterMetrics
+
+	bufferMux sync.Mutex
+	buffer    []elastic.BulkableRequest
+	flushMux  sync.Mutex
+	// dropped counts the documents that could not be indexed, of which reported were returned by Flush,
+	// both guarded by flushMux
+	dropped  int64
+	reported int64
+
+	stop  chan struct{}
+	done  sync.WaitGroup
+	sleep func(time.Duration)
+}
+
+// NewBulkSpanWriter creates a new BulkSpanWriter and starts flushing its buffer periodically
+func NewBulkSpanWriter(
+	client es.Client,
+	logger *zap.Logger,
+	metricsFactory metrics.Factory,
+	options BulkOptions,
+	writerOptions ...WriterOption,
+) *BulkSpanWriter {
+	w := &BulkSpanWriter{
+		SpanWriter: NewSpanWriter(client, logger, metricsFactory, writerOptions...),
+		options:    options.withDefaults(),
+		bulkIndex:  storageMetrics.NewWriteMetrics(metricsFactory, "BulkIndex"),
+		stop:       make(chan struct{}),
+		sleep:      time.Sleep,
+	}
+	metrics.Init(&w.bulkMetrics, metricsFactory, nil)
+	w.done.Add(1)
+	go w.flushPeriodically()
+	return w
+}
+
+// WriteSpan writes the span's service:operation and adds the span to the bulk request buffer
+func (w *BulkSpanWriter) WriteSpan(span *model.Span) error {
+	jaegerIndexName := w.spanIndexName(span)
+	jsonSpan := json.FromDomainEmbedProcess(span)
+
+	if err := w.createIndex(jaegerIndexName, jsonSpan); err != nil {
+		return err
+	}
+	if err := w.writeService(jaegerIndexName, jsonSpan); err != nil {
+		return err
+	}
+	document, err := w.spanDocument(span, jsonSpan)
+	if err != nil {
+		return err
+	}
+	request := elastic.NewBulkIndexRequest().Index(jaegerIndexName).Type(spanType).Id(spanDocumentID(span)).Doc(document)
+
+	w.bufferMux.Lock()
+	w.buffer = append(w.buffer, request)
+	full := len(w.buffer) >= w.options.Size
+	w.bufferMux.Unlock()
+
+	if full {
+		w.flush()
+	}
+	return nil
+}
+
+// Flush sends the spans in the buffer, returning an error if spans failed to be indexed since the previous Flush,
+// including by the periodic flushes
+func (w *BulkSpanWriter) Flush() error {
+	w.flush()
+	w.flushMux.Lock()
+	defer w.flushMux.Unlock()
+	dropped := w.dropped - w.reported
+	w.reported = w.dropped
+	if dropped > 0 {
+		return fmt.Errorf("failed to index %d spans", dropped)
+	}
+	return nil
+}
+
+// Close stops the periodic flushing and sends the spans remaining in the buffer
+func (w *BulkSpanWriter) Close() error {
+	close(w.stop)
+	w.done.Wait()
+	w.flush()
+	return nil
+}
+
+func (w *BulkSpanWriter) flushPeriodically() {
+	defer w.done.Done()
+	ticker := time.NewTicker(w.options.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.flush()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+func (w *BulkSpanWriter) flush() {
+	w.flushMux.Lock()
+	defer w.flushMux.Unlock()
+
+	w.bufferMux.Lock()
+	requests := w.buffer
+	w.buffer = nil
+	w.bufferMux.Unlock()
+
+	backoff := w.options.RetryBackoff
+	for attempt := 0; len(requests) > 0; attempt++ {
+		failed := w.send(requests)
+		if len(failed) == 0 {
+			return
+		}
+		if attempt >= w.options.MaxRetries {
+			w.bulkMetrics.DroppedDocs.Inc(int64(len(failed)))
+			w.dropped += int64(len(failed))
+			w.logger.Error("Failed to index spans after retries, dropping them", zap.Int("count", len(failed)))
+			return
+		}
+		w.bulkMetrics.RetriedDocs.Inc(int64(len(failed)))
+		requests = failed
+		// give an overloaded cluster time to recover instead of sending the documents again right away
+		w.sleep(backoff)
+		if backoff *= 2; backoff > maxBulkRetryBackoff {
+			backoff = maxBulkRetryBackoff
+		}
+	}
+}
+
+// send submits the requests in one bulk request and returns the ones that should be sent again
+func (w *BulkSpanWriter) send(requests []elastic.BulkableRequest) []elastic.BulkableRequest {
+	w.bulkMetrics.Size.Update(int64(len(requests)))
+	start := time.Now()
+	response, err := w.client.Bulk().Add(requests...).Do(w.ctx)
+	w.bulkIndex.Emit(err, time.Since(start), classifyError)
+	if err != nil {
+		w.logger.Error("Failed to submit bulk request", zap.Error(err))
+		return requests
+	}
+	var failed []elastic.BulkableRequest
+	for i, item := range response.Items {
+		if i >= len(requests) {
+			break
+		}
+		for _, result := range item {
+			if result.Status >= 200 && result.Status <= 299 {
+				continue
+			}
+			var errorType string
+			if result.Error != nil {
+				errorType = result.Error.Type
+			}
+			w.bulkIndex.EmitError(statusCategory(result.Status, errorType))
+			if !retryableStatus(result.Status) {
+				w.bulkMetrics.DroppedDocs.Inc(1)
+				w.dropped++
+				w.logger.Error("Failed to index span", zap.Int("status", result.Status), zap.Any("error", result.Error))
+				continue
+			}
+			failed = append(failed, requests[i])
+		}
+	}
+	return failed
+}
+
+// retryableStatus returns true for statuses caused by an overloaded or temporarily unavailable cluster
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
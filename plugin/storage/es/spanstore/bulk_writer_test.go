@@ -0,0 +1,219 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	jModel "github.com/uber/jaeger/model/json"
+	"github.com/uber/jaeger/pkg/es/mocks"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+var _ spanstore.Writer = &BulkSpanWriter{}  // check API conformance
+var _ spanstore.Flusher = &BulkSpanWriter{} // check API conformance
+
+type bulkWriterTest struct {
+	client         *mocks.Client
+	bulk           *mocks.BulkService
+	metricsFactory *metrics.LocalFactory
+	writer         *BulkSpanWriter
+	backoffs       []time.Duration
+}
+
+func withBulkSpanWriter(options BulkOptions, fn func(w *bulkWriterTest)) {
+	client := &mocks.Client{}
+	bulk := &mocks.BulkService{}
+	client.On("Bulk").Return(bulk)
+	metricsFactory := metrics.NewLocalFactory(0)
+	w := &bulkWriterTest{
+		client:         client,
+		bulk:           bulk,
+		metricsFactory: metricsFactory,
+		writer:         NewBulkSpanWriter(client, zap.NewNop(), metricsFactory, options),
+	}
+	w.writer.serviceWriter = func(string, *jModel.Span) error { return nil }
+	w.writer.sleep = func(d time.Duration) { w.backoffs = append(w.backoffs, d) }
+	defer w.writer.Close()
+	fn(w)
+}
+
+func bulkResponse(statuses ...int) *elastic.BulkResponse {
+	response := &elastic.BulkResponse{}
+	for _, status := range statuses {
+		response.Items = append(response.Items, map[string]*elastic.BulkResponseItem{
+			"index": {Status: status},
+		})
+	}
+	return response
+}
+
+func (w *bulkWriterTest) buffer(n int) {
+	for i := 0; i < n; i++ {
+		w.writer.buffer = append(w.writer.buffer, elastic.NewBulkIndexRequest())
+	}
+}
+
+func TestBulkSpanWriterFlushesWhenFull(t *testing.T) {
+	withBulkSpanWriter(BulkOptions{Size: 2, FlushInterval: time.Hour}, func(w *bulkWriterTest) {
+		date, _ := time.Parse(time.RFC3339, "1995-04-21T22:08:41+00:00")
+		writeCache("jaeger-1995-04-21", w.writer.indexCache)
+		w.bulk.On("Add", mock.Anything, mock.Anything).Return(w.bulk)
+		w.bulk.On("Do", mock.Anything).Return(bulkResponse(201, 201), nil)
+
+		span := &model.Span{StartTime: date, Process: &model.Process{ServiceName: "svc"}}
+		assert.NoError(t, w.writer.WriteSpan(span))
+		w.bulk.AssertNotCalled(t, "Do", mock.Anything)
+		assert.NoError(t, w.writer.WriteSpan(span))
+		w.bulk.AssertNumberOfCalls(t, "Do", 1)
+
+		counters, gauges := w.metricsFactory.Snapshot()
+		assert.EqualValues(t, 2, gauges["bulk-index.size"])
+		assert.EqualValues(t, 1, counters["BulkIndex.inserts"])
+	})
+}
+
+func TestBulkSpanWriterRetriesOnlyFailedDocuments(t *testing.T) {
+	withBulkSpanWriter(BulkOptions{FlushInterval: time.Hour, MaxRetries: 3}, func(w *bulkWriterTest) {
+		w.buffer(2)
+		w.bulk.On("Add", mock.Anything, mock.Anything).Return(w.bulk).Once()
+		w.bulk.On("Do", mock.Anything).Return(bulkResponse(201, 429), nil).Once()
+		w.bulk.On("Add", mock.Anything).Return(w.bulk).Once()
+		w.bulk.On("Do", mock.Anything).Return(bulkResponse(201), nil).Once()
+
+		w.writer.flush()
+		w.bulk.AssertNumberOfCalls(t, "Do", 2)
+
+		counters, gauges := w.metricsFactory.Snapshot()
+		assert.EqualValues(t, 1, counters["bulk-index.retried-docs"])
+		assert.EqualValues(t, 0, counters["bulk-index.dropped-docs"])
+		assert.EqualValues(t, 1, gauges["bulk-index.size"])
+		assert.Equal(t, []time.Duration{defaultBulkRetryBackoff}, w.backoffs)
+	})
+}
+
+func TestBulkSpanWriterDropsRejectedDocuments(t *testing.T) {
+	withBulkSpanWriter(BulkOptions{FlushInterval: time.Hour, MaxRetries: 3}, func(w *bulkWriterTest) {
+		w.buffer(2)
+		w.bulk.On("Add", mock.Anything, mock.Anything).Return(w.bulk)
+		w.bulk.On("Do", mock.Anything).Return(bulkResponse(201, 400), nil)
+
+		w.writer.flush()
+		w.bulk.AssertNumberOfCalls(t, "Do", 1)
+
+		counters, _ := w.metricsFactory.Snapshot()
+		assert.EqualValues(t, 0, counters["bulk-index.retried-docs"])
+		assert.EqualValues(t, 1, counters["bulk-index.dropped-docs"])
+		assert.EqualValues(t, 1, counters["BulkIndex.errors-by-category|category=serialization"])
+	})
+}
+
+func TestBulkSpanWriterRetriesExhausted(t *testing.T) {
+	withBulkSpanWriter(BulkOptions{FlushInterval: time.Hour, MaxRetries: 2, RetryBackoff: time.Second}, func(w *bulkWriterTest) {
+		w.buffer(2)
+		w.bulk.On("Add", mock.Anything, mock.Anything).Return(w.bulk)
+		w.bulk.On("Do", mock.Anything).Return(nil, errors.New("no available connection"))
+
+		w.writer.flush()
+		w.bulk.AssertNumberOfCalls(t, "Do", 3)
+
+		counters, _ := w.metricsFactory.Snapshot()
+		assert.EqualValues(t, 4, counters["bulk-index.retried-docs"])
+		assert.EqualValues(t, 2, counters["bulk-index.dropped-docs"])
+		assert.EqualValues(t, 3, counters["BulkIndex.errors"])
+		assert.EqualValues(t, 3, counters["BulkIndex.errors-by-category|category=unknown"])
+		assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, w.backoffs, "the backoff is exponential")
+	})
+}
+
+func TestBulkSpanWriterFlushReportsDroppedDocuments(t *testing.T) {
+	withBulkSpanWriter(BulkOptions{FlushInterval: time.Hour}, func(w *bulkWriterTest) {
+		w.buffer(2)
+		w.bulk.On("Add", mock.Anything, mock.Anything).Return(w.bulk)
+		w.bulk.On("Do", mock.Anything).Return(bulkResponse(201, 400), nil).Once()
+		// e.g. a periodic flush
+		w.writer.flush()
+		assert.EqualError(t, w.writer.Flush(), "failed to index 1 spans")
+
+		w.buffer(1)
+		w.bulk.On("Do", mock.Anything).Return(bulkResponse(201), nil).Once()
+		assert.NoError(t, w.writer.Flush(), "the dropped documents are reported once")
+		w.bulk.AssertNumberOfCalls(t, "Do", 2)
+	})
+}
+
+func TestBulkSpanWriterNoRetries(t *testing.T) {
+	withBulkSpanWriter(BulkOptions{FlushInterval: time.Hour}, func(w *bulkWriterTest) {
+		w.buffer(2)
+		w.bulk.On("Add", mock.Anything, mock.Anything).Return(w.bulk)
+		w.bulk.On("Do", mock.Anything).Return(bulkResponse(201, 429), nil)
+
+		w.writer.flush()
+		w.bulk.AssertNumberOfCalls(t, "Do", 1)
+
+		counters, _ := w.metricsFactory.Snapshot()
+		assert.EqualValues(t, 0, counters["bulk-index.retried-docs"])
+		assert.EqualValues(t, 1, counters["bulk-index.dropped-docs"])
+		assert.Empty(t, w.backoffs)
+	})
+}
+
+func TestBulkSpanWriterFlushesOnInterval(t *testing.T) {
+	withBulkSpanWriter(BulkOptions{FlushInterval: time.Millisecond}, func(w *bulkWriterTest) {
+		w.bulk.On("Add", mock.Anything).Return(w.bulk)
+		w.bulk.On("Do", mock.Anything).Return(bulkResponse(201), nil)
+		w.writer.bufferMux.Lock()
+		w.buffer(1)
+		w.writer.bufferMux.Unlock()
+
+		for i := 0; i < 100; i++ {
+			if counters, _ := w.metricsFactory.Snapshot(); counters["BulkIndex.inserts"] == 1 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		counters, _ := w.metricsFactory.Snapshot()
+		assert.EqualValues(t, 1, counters["BulkIndex.inserts"])
+	})
+}
+
+func TestBulkSpanWriterFlushesOnClose(t *testing.T) {
+	client := &mocks.Client{}
+	bulk := &mocks.BulkService{}
+	client.On("Bulk").Return(bulk)
+	bulk.On("Add", mock.Anything).Return(bulk)
+	bulk.On("Do", mock.Anything).Return(bulkResponse(201), nil)
+	writer := NewBulkSpanWriter(client, zap.NewNop(), metrics.NullFactory, BulkOptions{FlushInterval: time.Hour})
+	writer.buffer = append(writer.buffer, elastic.NewBulkIndexRequest())
+
+	assert.NoError(t, writer.Close())
+	bulk.AssertNumberOfCalls(t, "Do", 1)
+	assert.Empty(t, writer.buffer)
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"math"
+
+	"github.com/olivere/elastic"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/pkg/es"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+// NewSpanDeleter returns a spanstore.Deleter of the spans in the indices named by the ReaderOptions
+func NewSpanDeleter(client es.Client, logger *zap.Logger, options ...ReaderOption) spanstore.Deleter {
+	reader := newSpanReader(client, logger, 0)
+	for _, option := range options {
+		option(reader)
+	}
+	return reader
+}
+
+// DeleteSpans implements spanstore.Deleter with a delete-by-query on the indices of the time range, throttled
+// by ElasticSearch to the SpansPerSecond of the query
+func (s *SpanReader) DeleteSpans(query *spanstore.DeleteQueryParameters) (int, error) {
+	if err := query.Validate(); err != nil {
+		return 0, err
+	}
+	boolQuery := elastic.NewBoolQuery().Must(s.buildStartTimeQuery(query.StartTimeMin, query.StartTimeMax))
+	for k, v := range query.Tags {
+		boolQuery.Must(s.buildTagQuery(k, v))
+	}
+	jaegerIndices := s.deletionIndices(query)
+	if len(query.ServiceNames) > 0 {
+		serviceQuery := elastic.NewBoolQuery()
+		for _, service := range query.ServiceNames {
+			serviceQuery.Should(s.buildServiceNameQuery(service))
+		}
+		boolQuery.Must(serviceQuery)
+	}
+	deleteService := s.client.DeleteByQuery(jaegerIndices...).
+		Type(spanType).
+		Query(boolQuery).
+		IgnoreUnavailable(true).
+		ProceedOnVersionConflict()
+	if query.SpansPerSecond > 0 {
+		deleteService = deleteService.RequestsPerSecond(int(math.Ceil(query.SpansPerSecond)))
+	}
+	res, err := deleteService.Do(s.ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "Delete by query failed")
+	}
+	return int(res.Deleted), nil
+}
+
+// deletionIndices returns the indices of the services of the deletion, those of all the services if none is set
+func (s *SpanReader) deletionIndices(query *spanstore.DeleteQueryParameters) []string {
+	if len(query.ServiceNames) == 0 {
+		return s.indexNaming.indices("", query.StartTimeMin, query.StartTimeMax)
+	}
+	var indices []string
+	// the services share their indices unless the index template names them
+	seen := make(map[string]struct{})
+	for _, service := range query.ServiceNames {
+		for _, index := range s.indexNaming.indices(service, query.StartTimeMin, query.StartTimeMax) {
+			if _, ok := seen[index]; !ok {
+				seen[index] = struct{}{}
+				indices = append(indices, index)
+			}
+		}
+	}
+	return indices
+}
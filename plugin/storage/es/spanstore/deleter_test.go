@@ -0,0 +1,128 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/pkg/es/mocks"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+var _ spanstore.Deleter = &SpanReader{} // check API conformance
+
+func TestNewSpanDeleter(t *testing.T) {
+	indexNaming, err := NewIndexNaming(ServiceIndexTemplate)
+	assert.NoError(t, err)
+	deleter := NewSpanDeleter(&mocks.Client{}, zap.NewNop(), ReaderOptions.IndexNaming(indexNaming))
+	assert.Equal(t, indexNaming, deleter.(*SpanReader).indexNaming)
+}
+
+func TestSpanReaderDeleteSpans(t *testing.T) {
+	startTime := time.Date(2017, time.January, 26, 10, 0, 0, 0, time.UTC)
+	deleteQuery := &spanstore.DeleteQueryParameters{
+		Tags:         map[string]string{"user.id": "x"},
+		StartTimeMin: startTime,
+		StartTimeMax: startTime.Add(time.Hour),
+	}
+	testCases := []struct {
+		spansPerSecond float64
+		requests       int
+		doErr          error
+		expectedErr    string
+	}{
+		{},
+		{spansPerSecond: 0.5, requests: 1},
+		{spansPerSecond: 100, requests: 100},
+		{doErr: errors.New("timeout"), expectedErr: "Delete by query failed: timeout"},
+	}
+	for _, tc := range testCases {
+		testCase := tc // capture loop var
+		withSpanReader(func(r *spanReaderTest) {
+			deleteService := &mocks.DeleteByQueryService{}
+			deleteService.On("Type", spanType).Return(deleteService)
+			deleteService.On("Query", mock.AnythingOfType("*elastic.BoolQuery")).Return(deleteService)
+			deleteService.On("IgnoreUnavailable", true).Return(deleteService)
+			deleteService.On("ProceedOnVersionConflict").Return(deleteService)
+			deleteService.On("RequestsPerSecond", testCase.requests).Return(deleteService)
+			if testCase.doErr != nil {
+				deleteService.On("Do", mock.Anything).Return(nil, testCase.doErr)
+			} else {
+				deleteService.On("Do", mock.Anything).Return(&elastic.BulkIndexByScrollResponse{Deleted: 3}, nil)
+			}
+			indices := r.reader.indexNaming.indices("", deleteQuery.StartTimeMin, deleteQuery.StartTimeMax)
+			assert.Len(t, indices, 1)
+			r.client.On("DeleteByQuery", indices[0]).Return(deleteService)
+
+			query := *deleteQuery
+			query.SpansPerSecond = testCase.spansPerSecond
+			deleted, err := r.reader.DeleteSpans(&query)
+			if testCase.expectedErr == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, 3, deleted)
+			} else {
+				assert.EqualError(t, err, testCase.expectedErr)
+			}
+			if testCase.requests == 0 {
+				deleteService.AssertNotCalled(t, "RequestsPerSecond", mock.Anything)
+			}
+		})
+	}
+}
+
+func TestSpanReaderDeleteSpansOfServices(t *testing.T) {
+	indexNaming, err := NewIndexNaming(ServiceIndexTemplate)
+	assert.NoError(t, err)
+	startTime := time.Date(2017, time.January, 26, 10, 0, 0, 0, time.UTC)
+	withSpanReader(func(r *spanReaderTest) {
+		r.reader.indexNaming = indexNaming
+		deleteService := &mocks.DeleteByQueryService{}
+		deleteService.On("Type", spanType).Return(deleteService)
+		deleteService.On("Query", mock.AnythingOfType("*elastic.BoolQuery")).Return(deleteService)
+		deleteService.On("IgnoreUnavailable", true).Return(deleteService)
+		deleteService.On("ProceedOnVersionConflict").Return(deleteService)
+		deleteService.On("Do", mock.Anything).Return(&elastic.BulkIndexByScrollResponse{Deleted: 2}, nil)
+		r.client.On("DeleteByQuery", "jaeger-a_frontend-2017-01-26", "jaeger-a_backend-2017-01-26").Return(deleteService)
+
+		deleted, err := r.reader.DeleteSpans(&spanstore.DeleteQueryParameters{
+			Tags:         map[string]string{"user.id": "x"},
+			StartTimeMin: startTime,
+			StartTimeMax: startTime.Add(time.Hour),
+			ServiceNames: []string{"a/frontend", "a/backend", "a/frontend"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, deleted)
+	})
+}
+
+func TestSpanReaderDeleteSpansInvalid(t *testing.T) {
+	withSpanReader(func(r *spanReaderTest) {
+		_, err := r.reader.DeleteSpans(&spanstore.DeleteQueryParameters{Tags: map[string]string{"user.id": "x"}})
+		assert.EqualError(t, err, spanstore.ErrDeleteTimeRangeNotSet.Error())
+	})
+}
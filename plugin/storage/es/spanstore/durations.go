@@ -0,0 +1,91 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"time"
+
+	"github.com/olivere/elastic"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/pkg/es"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+const durationsAggregation = "durations"
+
+// ErrUnableToFindDurationsAggregation occurs when the percentiles aggregation is missing from the search result
+var ErrUnableToFindDurationsAggregation = errors.New("Could not find aggregation of the duration percentiles")
+
+// NewDurationReader returns a spanstore.DurationReader of the spans in the indices named by the ReaderOptions
+func NewDurationReader(client es.Client, logger *zap.Logger, options ...ReaderOption) spanstore.DurationReader {
+	reader := newSpanReader(client, logger, 0)
+	for _, option := range options {
+		option(reader)
+	}
+	return reader
+}
+
+// GetDurationPercentiles implements spanstore.DurationReader with the percentiles aggregation of a single search
+// of the spans matching the query like the trace search, the percentiles being approximated by ElasticSearch
+// over all the spans rather than sampled.
+func (s *SpanReader) GetDurationPercentiles(query *spanstore.DurationQueryParameters) (*spanstore.DurationPercentiles, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	percentilesAggregation := elastic.NewPercentilesAggregation().Field(durationField).Percentiles(50, 90, 99)
+
+	jaegerIndices := s.indexNaming.indices(query.ServiceName, query.StartTimeMin, query.StartTimeMax)
+	searchService := s.client.Search(jaegerIndices...).
+		Type(spanType).
+		Size(0). // only the aggregation is needed
+		Aggregation(durationsAggregation, percentilesAggregation).
+		IgnoreUnavailable(true).
+		Query(s.buildFindTraceIDsQuery(query.TraceQuery()))
+
+	searchResult, err := searchService.Do(s.ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "Search service failed")
+	}
+	durations, found := searchResult.Aggregations.Percentiles(durationsAggregation)
+	if !found {
+		return nil, ErrUnableToFindDurationsAggregation
+	}
+	percentiles := &spanstore.DurationPercentiles{Spans: int(searchResult.TotalHits())}
+	if percentiles.Spans == 0 {
+		// the percentiles of no span are null
+		return percentiles, nil
+	}
+	for key, percentile := range map[string]*time.Duration{
+		"50.0": &percentiles.P50,
+		"90.0": &percentiles.P90,
+		"99.0": &percentiles.P99,
+	} {
+		micros, ok := durations.Values[key]
+		if !ok {
+			return nil, ErrUnableToFindDurationsAggregation
+		}
+		*percentile = model.MicrosecondsAsDuration(uint64(micros))
+	}
+	return percentiles, nil
+}
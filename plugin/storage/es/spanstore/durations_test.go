@@ -0,0 +1,131 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/pkg/es/mocks"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+var _ spanstore.DurationReader = &SpanReader{} // check API conformance
+
+func TestNewDurationReader(t *testing.T) {
+	indexNaming, err := NewIndexNaming(ServiceIndexTemplate)
+	assert.NoError(t, err)
+	durationReader := NewDurationReader(&mocks.Client{}, zap.NewNop(), ReaderOptions.IndexNaming(indexNaming))
+	assert.Equal(t, indexNaming, durationReader.(*SpanReader).indexNaming)
+}
+
+func TestSpanReaderGetDurationPercentiles(t *testing.T) {
+	startTime := time.Date(2017, time.January, 26, 10, 0, 0, 0, time.UTC)
+	durationQuery := &spanstore.DurationQueryParameters{
+		ServiceName:   "frontend",
+		OperationName: "GET",
+		Tags:          map[string]string{"http.status_code": "200"},
+		StartTimeMin:  startTime,
+		StartTimeMax:  startTime.Add(time.Hour),
+	}
+	aggregations := func(values string) elastic.Aggregations {
+		message := json.RawMessage(`{"values": ` + values + `}`)
+		return elastic.Aggregations(map[string]*json.RawMessage{durationsAggregation: &message})
+	}
+	testCases := []struct {
+		searchResult  *elastic.SearchResult
+		searchErr     error
+		expected      *spanstore.DurationPercentiles
+		expectedError string
+	}{
+		{
+			searchResult: &elastic.SearchResult{
+				Hits:         &elastic.SearchHits{TotalHits: 10},
+				Aggregations: aggregations(`{"50.0": 1500, "90.0": 20000, "99.0": 1000000}`),
+			},
+			expected: &spanstore.DurationPercentiles{
+				Spans: 10,
+				P50:   1500 * time.Microsecond,
+				P90:   20 * time.Millisecond,
+				P99:   time.Second,
+			},
+		},
+		{
+			searchResult: &elastic.SearchResult{
+				Hits:         &elastic.SearchHits{TotalHits: 0},
+				Aggregations: aggregations(`{"50.0": null, "90.0": null, "99.0": null}`),
+			},
+			expected: &spanstore.DurationPercentiles{},
+		},
+		{
+			searchResult: &elastic.SearchResult{
+				Hits:         &elastic.SearchHits{TotalHits: 10},
+				Aggregations: aggregations(`{"50.0": 1500}`),
+			},
+			expectedError: ErrUnableToFindDurationsAggregation.Error(),
+		},
+		{
+			searchResult:  &elastic.SearchResult{},
+			expectedError: ErrUnableToFindDurationsAggregation.Error(),
+		},
+		{
+			searchErr:     errors.New("timeout"),
+			expectedError: "Search service failed: timeout",
+		},
+	}
+	for _, tc := range testCases {
+		testCase := tc // capture loop var
+		withSpanReader(func(r *spanReaderTest) {
+			searchService := &mocks.SearchService{}
+			searchService.On("Type", spanType).Return(searchService)
+			searchService.On("Size", 0).Return(searchService)
+			searchService.On("Aggregation", durationsAggregation, mock.AnythingOfType("*elastic.PercentilesAggregation")).Return(searchService)
+			searchService.On("IgnoreUnavailable", true).Return(searchService)
+			searchService.On("Query", mock.AnythingOfType("*elastic.BoolQuery")).Return(searchService)
+			searchService.On("Do", mock.Anything).Return(testCase.searchResult, testCase.searchErr)
+			indices := r.reader.indexNaming.indices("frontend", durationQuery.StartTimeMin, durationQuery.StartTimeMax)
+			assert.Len(t, indices, 1)
+			r.client.On("Search", indices[0]).Return(searchService)
+
+			percentiles, err := r.reader.GetDurationPercentiles(durationQuery)
+			if testCase.expectedError == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, testCase.expected, percentiles)
+			} else {
+				assert.EqualError(t, err, testCase.expectedError)
+			}
+		})
+	}
+}
+
+func TestSpanReaderGetDurationPercentilesInvalid(t *testing.T) {
+	withSpanReader(func(r *spanReaderTest) {
+		_, err := r.reader.GetDurationPercentiles(&spanstore.DurationQueryParameters{ServiceName: "frontend"})
+		assert.EqualError(t, err, spanstore.ErrDurationOperationNotSet.Error())
+	})
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"net/http"
+
+	"github.com/olivere/elastic"
+
+	storageMetrics "github.com/uber/jaeger/storage/spanstore/metrics"
+)
+
+// clusterBlockException is the error type of writes to indices made read-only, e.g. once the disks are full
+const clusterBlockException = "cluster_block_exception"
+
+// classifyError is the storageMetrics.ErrorClassifier of ElasticSearch errors
+func classifyError(err error) (storageMetrics.ErrorCategory, bool) {
+	if err == elastic.ErrNoClient {
+		return storageMetrics.UnavailableError, true
+	}
+	if esErr, ok := err.(*elastic.Error); ok {
+		var errorType string
+		if esErr.Details != nil {
+			errorType = esErr.Details.Type
+		}
+		return statusCategory(esErr.Status, errorType), true
+	}
+	return "", false
+}
+
+// statusCategory returns the category of a failed request or bulk item given its HTTP status and error type
+func statusCategory(status int, errorType string) storageMetrics.ErrorCategory {
+	switch {
+	case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout:
+		return storageMetrics.TimeoutError
+	case status == http.StatusTooManyRequests || status == http.StatusRequestEntityTooLarge:
+		return storageMetrics.QuotaError
+	case status == http.StatusForbidden && errorType == clusterBlockException:
+		return storageMetrics.QuotaError
+	case status == http.StatusBadRequest:
+		// e.g. mapper_parsing_exception for documents which do not match the index mapping
+		return storageMetrics.SerializationError
+	case status == http.StatusBadGateway || status == http.StatusServiceUnavailable:
+		return storageMetrics.UnavailableError
+	}
+	return storageMetrics.UnknownError
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/olivere/elastic"
+	"github.com/stretchr/testify/assert"
+
+	storageMetrics "github.com/uber/jaeger/storage/spanstore/metrics"
+)
+
+func TestClassifyError(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected storageMetrics.ErrorCategory
+	}{
+		{err: elastic.ErrNoClient, expected: storageMetrics.UnavailableError},
+		{err: &elastic.Error{Status: http.StatusServiceUnavailable}, expected: storageMetrics.UnavailableError},
+		{err: &elastic.Error{Status: http.StatusGatewayTimeout}, expected: storageMetrics.TimeoutError},
+		{err: &elastic.Error{Status: http.StatusTooManyRequests}, expected: storageMetrics.QuotaError},
+		{
+			err:      &elastic.Error{Status: http.StatusForbidden, Details: &elastic.ErrorDetails{Type: "cluster_block_exception"}},
+			expected: storageMetrics.QuotaError,
+		},
+		{
+			err:      &elastic.Error{Status: http.StatusBadRequest, Details: &elastic.ErrorDetails{Type: "mapper_parsing_exception"}},
+			expected: storageMetrics.SerializationError,
+		},
+		{err: &elastic.Error{Status: http.StatusNotFound}, expected: storageMetrics.UnknownError},
+	}
+	for _, testCase := range testCases {
+		category, ok := classifyError(testCase.err)
+		assert.True(t, ok, testCase.err.Error())
+		assert.Equal(t, testCase.expected, category, testCase.err.Error())
+	}
+	_, ok := classifyError(errors.New("other"))
+	assert.False(t, ok)
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultIndexTemplate names the daily index shared by all services
+	DefaultIndexTemplate = indexPrefix + dateVariable
+
+	// ServiceIndexTemplate names a daily index per service
+	ServiceIndexTemplate = indexPrefix + serviceVariable + "-" + dateVariable
+
+	serviceVariable = "{service}"
+	dateVariable    = "{date}"
+	indexDateLayout = "2006-01-02"
+
+	// maxServiceIndexPart keeps index names well under the 255 bytes allowed by ElasticSearch
+	maxServiceIndexPart = 128
+)
+
+// IndexNaming names the indices spans are written to from a template, where {date} is replaced
+// by the day the span started and {service} by the sanitized name of the service of the span.
+type IndexNaming struct {
+	template string
+}
+
+// NewIndexNaming creates an IndexNaming from a template, DefaultIndexTemplate if it is empty.
+// The template must contain {date}, so that old indices can be deleted, and must not start with
+// {service}, so that all indices share a prefix.
+func NewIndexNaming(template string) (*IndexNaming, error) {
+	if template == "" {
+		template = DefaultIndexTemplate
+	}
+	if strings.Count(template, dateVariable) != 1 {
+		return nil, fmt.Errorf("Index template %q must contain %s once", template, dateVariable)
+	}
+	if strings.Count(template, serviceVariable) > 1 || strings.HasPrefix(template, serviceVariable) {
+		return nil, fmt.Errorf("Index template %q must contain %s at most once, and not at its start", template, serviceVariable)
+	}
+	if sanitizeIndexName(template) != template {
+		return nil, fmt.Errorf("Index template %q contains characters not allowed in index names", template)
+	}
+	return &IndexNaming{template: template}, nil
+}
+
+var defaultIndexNaming = &IndexNaming{template: DefaultIndexTemplate}
+
+// PerService returns whether each service has its own indices
+func (n *IndexNaming) PerService() bool {
+	return strings.Contains(n.template, serviceVariable)
+}
+
+// IndexName returns the index of the spans of the service on the date
+func (n *IndexNaming) IndexName(service string, date time.Time) string {
+	return n.name(SanitizeServiceName(service), date)
+}
+
+// indexPattern returns the pattern matching the indices of all services on the date
+func (n *IndexNaming) indexPattern(date time.Time) string {
+	return n.name("*", date)
+}
+
+func (n *IndexNaming) name(service string, date time.Time) string {
+	name := strings.Replace(n.template, dateVariable, date.Format(indexDateLayout), 1)
+	return strings.Replace(name, serviceVariable, service, 1)
+}
+
+// indices returns the indices to query for the spans of the service between the dates, starting from the
+// most recent day. The indices of all services are matched when the service is empty.
+func (n *IndexNaming) indices(service string, startTime time.Time, endTime time.Time) []string {
+	indexName := func(date time.Time) string {
+		if service == "" {
+			return n.indexPattern(date.UTC())
+		}
+		return n.IndexName(service, date.UTC())
+	}
+	var indices []string
+	firstIndex := indexName(startTime)
+	currentIndex := indexName(endTime)
+	for currentIndex != firstIndex {
+		indices = append(indices, currentIndex)
+		endTime = endTime.Add(-24 * time.Hour)
+		currentIndex = indexName(endTime)
+	}
+	return append(indices, firstIndex)
+}
+
+// SanitizeServiceName returns the service name as it appears in index names. Index names are
+// lowercase and cannot contain some characters, which are replaced by underscores. Services
+// whose names only differ by these characters share indices, but their spans are still told
+// apart by the service name stored in each span.
+func SanitizeServiceName(service string) string {
+	name := sanitizeIndexName(strings.ToLower(service))
+	if len(name) > maxServiceIndexPart {
+		end := maxServiceIndexPart
+		for !utf8.RuneStart(name[end]) {
+			end--
+		}
+		name = name[:end]
+	}
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+// sanitizeIndexName replaces the characters ElasticSearch does not allow in index names, and the ones
+// that would make an index name a pattern matching other indices
+func sanitizeIndexName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '\\', '/', '*', '?', '"', '<', '>', '|', ' ', ',', '#', ':':
+			return '_'
+		}
+		if r < ' ' || (r >= 'A' && r <= 'Z') {
+			return '_'
+		}
+		return r
+	}, name)
+}
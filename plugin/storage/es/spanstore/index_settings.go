@@ -0,0 +1,88 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"encoding/json"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// IndexSettings are the settings of the span indices created by the writer, the zero values
+// leaving the ElasticSearch defaults
+type IndexSettings struct {
+	// RefreshInterval is how often the new spans become searchable, e.g. 30s, -1 disabling the refreshes
+	RefreshInterval string
+	// Shards is the number of primary shards of each index
+	Shards int
+	// Replicas is the number of replicas of each shard, the default if nil
+	Replicas *int
+}
+
+// isDefault returns whether all the settings are the ElasticSearch defaults
+func (s IndexSettings) isDefault() bool {
+	return s.RefreshInterval == "" && s.Shards == 0 && s.Replicas == nil
+}
+
+// indexBody returns the body of the index creation requests, the mapping with the settings added
+func (s IndexSettings) indexBody(mapping string) string {
+	if s.isDefault() {
+		return mapping
+	}
+	var body map[string]map[string]interface{}
+	// the mappings are constants known to be valid JSON objects
+	if err := json.Unmarshal([]byte(mapping), &body); err != nil {
+		panic(err)
+	}
+	if body["settings"] == nil {
+		body["settings"] = make(map[string]interface{})
+	}
+	if s.RefreshInterval != "" {
+		body["settings"]["index.refresh_interval"] = s.RefreshInterval
+	}
+	if s.Shards != 0 {
+		body["settings"]["index.number_of_shards"] = s.Shards
+	}
+	if s.Replicas != nil {
+		body["settings"]["index.number_of_replicas"] = *s.Replicas
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+// logFields returns the settings which are not the ElasticSearch defaults as log fields
+func (s IndexSettings) logFields() []zapcore.Field {
+	var fields []zapcore.Field
+	if s.RefreshInterval != "" {
+		fields = append(fields, zap.String("refresh_interval", s.RefreshInterval))
+	}
+	if s.Shards != 0 {
+		fields = append(fields, zap.Int("shards", s.Shards))
+	}
+	if s.Replicas != nil {
+		fields = append(fields, zap.Int("replicas", *s.Replicas))
+	}
+	return fields
+}
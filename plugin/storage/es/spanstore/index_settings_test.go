@@ -0,0 +1,69 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestIndexSettingsDefault(t *testing.T) {
+	settings := IndexSettings{}
+	assert.Equal(t, spanMapping, settings.indexBody(spanMapping))
+	assert.Empty(t, settings.logFields())
+}
+
+func TestIndexSettingsBody(t *testing.T) {
+	replicas := 0
+	settings := IndexSettings{RefreshInterval: "30s", Shards: 3, Replicas: &replicas}
+
+	var body struct {
+		Settings map[string]interface{} `json:"settings"`
+		Mappings map[string]interface{} `json:"mappings"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(settings.indexBody(spanMapping)), &body))
+	assert.Equal(t, map[string]interface{}{
+		"index.mapping.nested_fields.limit": float64(50),
+		"index.requests.cache.enable":       true,
+		"index.mapper.dynamic":              false,
+		"index.refresh_interval":            "30s",
+		"index.number_of_shards":            float64(3),
+		"index.number_of_replicas":          float64(0),
+	}, body.Settings)
+	assert.Contains(t, body.Mappings, "span", "the mappings are kept")
+	assert.Equal(t, []zapcore.Field{
+		zap.String("refresh_interval", "30s"),
+		zap.Int("shards", 3),
+		zap.Int("replicas", 0),
+	}, settings.logFields())
+}
+
+func TestIndexSettingsBodyWithoutSettings(t *testing.T) {
+	settings := IndexSettings{Shards: 1}
+	assert.JSONEq(t,
+		`{"settings":{"index.number_of_shards":1},"mappings":{}}`,
+		settings.indexBody(`{"mappings":{}}`))
+}
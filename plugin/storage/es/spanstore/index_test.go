@@ -0,0 +1,124 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewIndexNaming(t *testing.T) {
+	testCases := []struct {
+		template      string
+		expectedError string
+	}{
+		{template: ""},
+		{template: DefaultIndexTemplate},
+		{template: ServiceIndexTemplate},
+		{template: "spans-{date}-{service}"},
+		{
+			template:      "jaeger",
+			expectedError: `Index template "jaeger" must contain {date} once`,
+		},
+		{
+			template:      "jaeger-{date}-{date}",
+			expectedError: `Index template "jaeger-{date}-{date}" must contain {date} once`,
+		},
+		{
+			template:      "{service}-{date}",
+			expectedError: `Index template "{service}-{date}" must contain {service} at most once, and not at its start`,
+		},
+		{
+			template:      "Jaeger-{date}",
+			expectedError: `Index template "Jaeger-{date}" contains characters not allowed in index names`,
+		},
+		{
+			template:      "jaeger*{date}",
+			expectedError: `Index template "jaeger*{date}" contains characters not allowed in index names`,
+		},
+	}
+	for _, testCase := range testCases {
+		naming, err := NewIndexNaming(testCase.template)
+		if testCase.expectedError == "" {
+			assert.NoError(t, err, testCase.template)
+			assert.NotNil(t, naming)
+		} else {
+			assert.EqualError(t, err, testCase.expectedError)
+			assert.Nil(t, naming)
+		}
+	}
+}
+
+func TestIndexNamingIndexName(t *testing.T) {
+	date := time.Date(2017, time.March, 14, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, "jaeger-2017-03-14", defaultIndexNaming.IndexName("frontend", date))
+	assert.False(t, defaultIndexNaming.PerService())
+
+	naming, err := NewIndexNaming(ServiceIndexTemplate)
+	require.NoError(t, err)
+	assert.True(t, naming.PerService())
+	assert.Equal(t, "jaeger-frontend-2017-03-14", naming.IndexName("frontend", date))
+	assert.Equal(t, "jaeger-my_service_v2_-2017-03-14", naming.IndexName("My Service/v2*", date))
+	assert.Equal(t, "jaeger-*-2017-03-14", naming.indexPattern(date))
+}
+
+func TestIndexNamingIndices(t *testing.T) {
+	naming, err := NewIndexNaming(ServiceIndexTemplate)
+	require.NoError(t, err)
+	end := time.Date(2017, time.March, 14, 1, 0, 0, 0, time.UTC)
+	// midnight two days before
+	start := end.Add(-49 * time.Hour)
+	assert.Equal(t, []string{
+		"jaeger-frontend-2017-03-14",
+		"jaeger-frontend-2017-03-13",
+		"jaeger-frontend-2017-03-12",
+	}, naming.indices("Frontend", start, end))
+	assert.Equal(t, []string{
+		"jaeger-*-2017-03-14",
+		"jaeger-*-2017-03-13",
+		"jaeger-*-2017-03-12",
+	}, naming.indices("", start, end))
+}
+
+func TestSanitizeServiceName(t *testing.T) {
+	testCases := []struct {
+		service  string
+		expected string
+	}{
+		{service: "frontend", expected: "frontend"},
+		{service: "Frontend", expected: "frontend"},
+		{service: `a\b/c*d?e"f<g>h|i j,k#l:m`, expected: "a_b_c_d_e_f_g_h_i_j_k_l_m"},
+		{service: "tab\tservice", expected: "tab_service"},
+		{service: "café", expected: "café"},
+		{service: "", expected: "_"},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, SanitizeServiceName(testCase.service))
+	}
+
+	long := SanitizeServiceName(strings.Repeat("é", maxServiceIndexPart))
+	assert.True(t, len(long) <= maxServiceIndexPart)
+	assert.Equal(t, strings.Repeat("é", maxServiceIndexPart/2), long, "names are truncated between characters")
+}
@@ -32,8 +32,8 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/model/codec"
 	jConverter "github.com/uber/jaeger/model/converter/json"
-	jModel "github.com/uber/jaeger/model/json"
 	"github.com/uber/jaeger/pkg/es"
 	"github.com/uber/jaeger/storage/spanstore"
 	storageMetrics "github.com/uber/jaeger/storage/spanstore/metrics"
@@ -48,6 +48,7 @@ const (
 	startTimeField     = "startTime"
 	serviceNameField   = "process.serviceName"
 	operationNameField = "operationName"
+	spanKindField      = "spanKind"
 	tagsField          = "tags"
 	processTagsField   = "process.tags"
 	logFieldsField     = "logs.fields"
@@ -91,11 +92,41 @@ type SpanReader struct {
 	// this will be rounded down to UTC 00:00 of that day.
 	maxLookback             time.Duration
 	serviceOperationStorage *ServiceOperationStorage
+	serializer              *codec.Serializer
+	indexNaming             *IndexNaming
+}
+
+// ReaderOption is a function that sets some option on the SpanReader.
+type ReaderOption func(*SpanReader)
+
+// ReaderOptions is a factory for all available ReaderOption's
+var ReaderOptions readerOptions
+
+type readerOptions struct{}
+
+// IndexNaming creates a ReaderOption that names the indices spans are read from, which must be the
+// same IndexNaming as the one of the writers. With per-service indices, the spans of a service are only
+// searched in the indices of the service, while traces are searched in the indices of all services.
+func (readerOptions) IndexNaming(indexNaming *IndexNaming) ReaderOption {
+	return func(s *SpanReader) {
+		s.indexNaming = indexNaming
+	}
 }
 
 // NewSpanReader returns a new SpanReader with a metrics.
-func NewSpanReader(client es.Client, logger *zap.Logger, maxLookback time.Duration, metricsFactory metrics.Factory) spanstore.Reader {
-	return storageMetrics.NewReadMetricsDecorator(newSpanReader(client, logger, maxLookback), metricsFactory)
+func NewSpanReader(
+	client es.Client,
+	logger *zap.Logger,
+	maxLookback time.Duration,
+	metricsFactory metrics.Factory,
+	options ...ReaderOption,
+) spanstore.Reader {
+	reader := newSpanReader(client, logger, maxLookback)
+	reader.serializer = codec.NewSerializer(metricsFactory)
+	for _, option := range options {
+		option(reader)
+	}
+	return storageMetrics.NewReadMetricsDecorator(reader, metricsFactory)
 }
 
 func newSpanReader(client es.Client, logger *zap.Logger, maxLookback time.Duration) *SpanReader {
@@ -106,6 +137,8 @@ func newSpanReader(client es.Client, logger *zap.Logger, maxLookback time.Durati
 		logger:                  logger,
 		maxLookback:             maxLookback,
 		serviceOperationStorage: NewServiceOperationStorage(ctx, client, metrics.NullFactory, logger, 0), // the decorator takes care of metrics
+		serializer:              codec.NewSerializer(metrics.NullFactory),
+		indexNaming:             defaultIndexNaming,
 	}
 }
 
@@ -126,7 +159,8 @@ func (s *SpanReader) readTrace(traceID string, traceQuery *spanstore.TraceQueryP
 
 	traceQuery.StartTimeMax = traceQuery.StartTimeMax.Add(time.Hour)
 	traceQuery.StartTimeMin = traceQuery.StartTimeMin.Add(-time.Hour)
-	indices := findIndices(traceQuery.StartTimeMin, traceQuery.StartTimeMax)
+	// the spans of a trace can belong to any service
+	indices := s.indexNaming.indices("", traceQuery.StartTimeMin, traceQuery.StartTimeMax)
 	esSpansRaw, err := s.executeQuery(query, indices...)
 	if err != nil {
 		return nil, errors.Wrap(err, "Query execution failed")
@@ -146,11 +180,19 @@ func (s *SpanReader) collectSpans(esSpansRaw []*elastic.SearchHit) ([]*model.Spa
 	spans := make([]*model.Span, len(esSpansRaw))
 
 	for i, esSpanRaw := range esSpansRaw {
-		jsonSpan, err := s.unmarshalJSONSpan(esSpanRaw)
+		document, err := s.unmarshalSpanDocument(esSpanRaw)
 		if err != nil {
 			return nil, errors.Wrap(err, "Marshalling JSON to span object failed")
 		}
-		span, err := jConverter.SpanToDomain(jsonSpan)
+		if document.SerializedSpan != nil {
+			span, err := s.serializer.Deserialize(document.SerializedSpan)
+			if err != nil {
+				return nil, errors.Wrap(err, "Deserializing span failed")
+			}
+			spans[i] = span
+			continue
+		}
+		span, err := jConverter.SpanToDomain(&document.Span)
 		if err != nil {
 			return nil, errors.Wrap(err, "Converting JSONSpan to domain Span failed")
 		}
@@ -171,45 +213,33 @@ func (s *SpanReader) executeQuery(query elastic.Query, indices ...string) ([]*el
 	return searchService.Hits.Hits, nil
 }
 
-func (s *SpanReader) unmarshalJSONSpan(esSpanRaw *elastic.SearchHit) (*jModel.Span, error) {
+// unmarshalSpanDocument reads the JSON span along with its serialized form, if it was written with one
+func (s *SpanReader) unmarshalSpanDocument(esSpanRaw *elastic.SearchHit) (*spanDocument, error) {
 	esSpanInByteArray := esSpanRaw.Source
 
-	var jsonSpan jModel.Span
-	if err := json.Unmarshal(*esSpanInByteArray, &jsonSpan); err != nil {
+	var document spanDocument
+	if err := json.Unmarshal(*esSpanInByteArray, &document); err != nil {
 		return nil, err
 	}
-	return &jsonSpan, nil
-}
-
-// Returns the array of indices that we need to query, based on query params
-func findIndices(startTime time.Time, endTime time.Time) []string {
-	var indices []string
-	firstIndex := IndexWithDate(startTime)
-	currentIndex := IndexWithDate(endTime)
-	for currentIndex != firstIndex {
-		indices = append(indices, currentIndex)
-		endTime = endTime.Add(-24 * time.Hour)
-		currentIndex = IndexWithDate(endTime)
-	}
-	return append(indices, firstIndex)
+	return &document, nil
 }
 
 // IndexWithDate returns the index name formatted to date.
 func IndexWithDate(date time.Time) string {
-	return indexPrefix + date.UTC().Format("2006-01-02")
+	return defaultIndexNaming.indexPattern(date.UTC())
 }
 
 // GetServices returns all services traced by Jaeger, ordered by frequency
 func (s *SpanReader) GetServices() ([]string, error) {
 	currentTime := time.Now()
-	jaegerIndices := findIndices(currentTime.Add(-s.maxLookback), currentTime)
+	jaegerIndices := s.indexNaming.indices("", currentTime.Add(-s.maxLookback), currentTime)
 	return s.serviceOperationStorage.getServices(jaegerIndices)
 }
 
 // GetOperations returns all operations for a specific service traced by Jaeger
 func (s *SpanReader) GetOperations(service string) ([]string, error) {
 	currentTime := time.Now()
-	jaegerIndices := findIndices(currentTime.Add(-s.maxLookback), currentTime)
+	jaegerIndices := s.indexNaming.indices(service, currentTime.Add(-s.maxLookback), currentTime)
 	return s.serviceOperationStorage.getOperations(jaegerIndices, service)
 }
 
@@ -320,7 +350,7 @@ func (s *SpanReader) findTraceIDs(traceQuery *spanstore.TraceQueryParameters) ([
 	aggregation := s.buildTraceIDAggregation(traceQuery.NumTraces)
 	boolQuery := s.buildFindTraceIDsQuery(traceQuery)
 
-	jaegerIndices := findIndices(traceQuery.StartTimeMin, traceQuery.StartTimeMax)
+	jaegerIndices := s.indexNaming.indices(traceQuery.ServiceName, traceQuery.StartTimeMin, traceQuery.StartTimeMax)
 
 	searchService := s.client.Search(jaegerIndices...).
 		Type(spanType).
@@ -374,6 +404,12 @@ func (s *SpanReader) buildFindTraceIDsQuery(traceQuery *spanstore.TraceQueryPara
 		boolQuery.Must(operationNameQuery)
 	}
 
+	//add spanKind query
+	if traceQuery.SpanKind != "" {
+		spanKindQuery := s.buildSpanKindQuery(traceQuery.SpanKind)
+		boolQuery.Must(spanKindQuery)
+	}
+
 	for k, v := range traceQuery.Tags {
 		tagQuery := s.buildTagQuery(k, v)
 		boolQuery.Must(tagQuery)
@@ -404,6 +440,16 @@ func (s *SpanReader) buildOperationNameQuery(operationName string) elastic.Query
 	return elastic.NewMatchQuery(operationNameField, operationName)
 }
 
+// buildSpanKindQuery matches the spans of the kind, the spans written without a kind being unspecified
+func (s *SpanReader) buildSpanKindQuery(kind model.SpanKind) elastic.Query {
+	kindQuery := elastic.NewTermQuery(spanKindField, string(kind))
+	if kind != model.SpanKindUnspecified {
+		return kindQuery
+	}
+	missingQuery := elastic.NewBoolQuery().MustNot(elastic.NewExistsQuery(spanKindField))
+	return elastic.NewBoolQuery().Should(kindQuery, missingQuery)
+}
+
 func (s *SpanReader) buildTagQuery(k string, v string) elastic.Query {
 	queries := make([]elastic.Query, len(tagFieldList))
 	for i := range queries {
@@ -34,6 +34,8 @@ import (
 
 	"github.com/uber/jaeger-lib/metrics"
 	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/model/codec"
+	jConverter "github.com/uber/jaeger/model/converter/json"
 	esJson "github.com/uber/jaeger/model/json"
 	"github.com/uber/jaeger/pkg/es/mocks"
 	"github.com/uber/jaeger/pkg/testutils"
@@ -130,6 +132,46 @@ func TestSpanReader_GetTrace(t *testing.T) {
 	})
 }
 
+func TestSpanReader_GetTraceSerialized(t *testing.T) {
+	span := &model.Span{
+		TraceID:       model.TraceID{Low: 1},
+		SpanID:        model.SpanID(2),
+		OperationName: "op",
+		StartTime:     model.EpochMicrosecondsAsTime(812965625),
+		Tags:          model.KeyValues{model.Int64("tag", 1965806585)},
+		Process:       &model.Process{ServiceName: "serv"},
+	}
+	writer := NewSpanWriter(&mocks.Client{}, zap.NewNop(), metrics.NullFactory, WriterOptions.Serialization(codec.ProtobufFormat))
+	document, err := writer.spanDocument(span, jConverter.FromDomainEmbedProcess(span))
+	require.NoError(t, err)
+	source, err := json.Marshal(document)
+	require.NoError(t, err)
+
+	withSpanReader(func(r *spanReaderTest) {
+		hits := []*elastic.SearchHit{{Source: (*json.RawMessage)(&source)}}
+		mockSearchService(r).Return(&elastic.SearchResult{Hits: &elastic.SearchHits{Hits: hits}}, nil)
+
+		trace, err := r.reader.GetTrace(model.TraceID{Low: 1})
+		require.NoError(t, err)
+		require.Len(t, trace.Spans, 1)
+		span.NormalizeTimestamps()
+		trace.Spans[0].NormalizeTimestamps()
+		assert.Equal(t, span, trace.Spans[0])
+	})
+}
+
+func TestSpanReader_GetTraceInvalidSerializedSpan(t *testing.T) {
+	withSpanReader(func(r *spanReaderTest) {
+		source := []byte(`{"traceID": "1", "serializedSpan": "KgEC"}`)
+		hits := []*elastic.SearchHit{{Source: (*json.RawMessage)(&source)}}
+		mockSearchService(r).Return(&elastic.SearchResult{Hits: &elastic.SearchHits{Hits: hits}}, nil)
+
+		trace, err := r.reader.GetTrace(model.TraceID{Low: 1})
+		require.Nil(t, trace)
+		assert.EqualError(t, err, "Span collection failed: Deserializing span failed: Cannot deserialize span with format <unknown format 42>")
+	})
+}
+
 func TestSpanReader_GetTraceQueryError(t *testing.T) {
 	withSpanReader(func(r *spanReaderTest) {
 		mockSearchService(r).
@@ -223,12 +265,13 @@ func TestSpanReader_esJSONtoJSONSpanModel(t *testing.T) {
 			Source: jsonPayload,
 		}
 
-		span, err := r.reader.unmarshalJSONSpan(esSpanRaw)
+		document, err := r.reader.unmarshalSpanDocument(esSpanRaw)
 		require.NoError(t, err)
 
 		var expectedSpan esJson.Span
 		require.NoError(t, json.Unmarshal(exampleESSpan, &expectedSpan))
-		assert.EqualValues(t, &expectedSpan, span)
+		assert.EqualValues(t, &expectedSpan, &document.Span)
+		assert.Nil(t, document.SerializedSpan)
 	})
 }
 
@@ -241,9 +284,9 @@ func TestSpanReader_esJSONtoJSONSpanModelError(t *testing.T) {
 			Source: jsonPayload,
 		}
 
-		span, err := r.reader.unmarshalJSONSpan(esSpanRaw)
+		document, err := r.reader.unmarshalSpanDocument(esSpanRaw)
 		require.Error(t, err)
-		assert.Nil(t, span)
+		assert.Nil(t, document)
 	})
 }
 
@@ -283,7 +326,7 @@ func TestSpanReaderFindIndices(t *testing.T) {
 		},
 	}
 	for _, testCase := range testCases {
-		actual := findIndices(testCase.startTime, testCase.endTime)
+		actual := defaultIndexNaming.indices("", testCase.startTime, testCase.endTime)
 		assert.EqualValues(t, testCase.expected, actual)
 	}
 }
@@ -509,6 +552,36 @@ func TestFindTraceIDs(t *testing.T) {
 	testGet(traceIDAggregation, t)
 }
 
+func TestFindTraceIDsServiceIndices(t *testing.T) {
+	goodAggregations := make(map[string]*json.RawMessage)
+	rawMessage := []byte(`{"buckets": [{"key": "123","doc_count": 16}]}`)
+	goodAggregations[traceIDAggregation] = (*json.RawMessage)(&rawMessage)
+
+	indexNaming, err := NewIndexNaming(ServiceIndexTemplate)
+	require.NoError(t, err)
+	withSpanReader(func(r *spanReaderTest) {
+		r.reader.indexNaming = indexNaming
+		searchService := &mocks.SearchService{}
+		searchService.On("Type", stringMatcher(spanType)).Return(searchService)
+		searchService.On("Size", mock.AnythingOfType("int")).Return(searchService)
+		searchService.On("Aggregation", stringMatcher(traceIDAggregation), mock.AnythingOfType("*elastic.TermsAggregation")).Return(searchService)
+		searchService.On("Query", mock.Anything).Return(searchService)
+		searchService.On("IgnoreUnavailable", true).Return(searchService)
+		searchService.On("Do", mock.AnythingOfType("*context.emptyCtx")).
+			Return(&elastic.SearchResult{Aggregations: elastic.Aggregations(goodAggregations)}, nil)
+		r.client.On("Search", "jaeger-frontend-1995-04-22", "jaeger-frontend-1995-04-21").Return(searchService)
+
+		traceIDs, err := r.reader.findTraceIDs(&spanstore.TraceQueryParameters{
+			ServiceName:  "Frontend",
+			StartTimeMin: time.Date(1995, time.April, 21, 22, 0, 0, 0, time.UTC),
+			StartTimeMax: time.Date(1995, time.April, 22, 2, 0, 0, 0, time.UTC),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"123"}, traceIDs)
+		r.client.AssertExpectations(t)
+	})
+}
+
 func mockSearchService(r *spanReaderTest) *mock.Call {
 	searchService := &mocks.SearchService{}
 	searchService.On("Type", stringMatcher(serviceType)).Return(searchService)
@@ -585,6 +658,7 @@ func TestSpanReader_buildFindTraceIDsQuery(t *testing.T) {
 			StartTimeMax:  time.Time{}.Add(time.Second),
 			ServiceName:   "s",
 			OperationName: "o",
+			SpanKind:      model.SpanKindClient,
 			Tags: map[string]string{
 				"hello": "world",
 			},
@@ -599,6 +673,7 @@ func TestSpanReader_buildFindTraceIDsQuery(t *testing.T) {
 				r.reader.buildStartTimeQuery(time.Time{}, time.Time{}.Add(time.Second)),
 				r.reader.buildServiceNameQuery("s"),
 				r.reader.buildOperationNameQuery("o"),
+				r.reader.buildSpanKindQuery(model.SpanKindClient),
 				r.reader.buildTagQuery("hello", "world"),
 			)
 		expected, err := expectedQuery.Source()
@@ -687,6 +762,39 @@ func TestSpanReader_buildOperationNameQuery(t *testing.T) {
 	})
 }
 
+func TestSpanReader_buildSpanKindQuery(t *testing.T) {
+	testCases := []struct {
+		kind        model.SpanKind
+		expectedStr string
+	}{
+		{
+			kind:        model.SpanKindServer,
+			expectedStr: `{ "term": { "spanKind": "server" }}`,
+		},
+		{
+			kind: model.SpanKindUnspecified,
+			expectedStr: `{ "bool": {
+			   "should": [
+			      { "term": { "spanKind": "unspecified" }},
+			      { "bool": { "must_not": { "exists": { "field": "spanKind" }}}}
+			   ]
+			}}`,
+		},
+	}
+	for _, testCase := range testCases {
+		withSpanReader(func(r *spanReaderTest) {
+			spanKindQuery := r.reader.buildSpanKindQuery(testCase.kind)
+			actual, err := spanKindQuery.Source()
+			require.NoError(t, err)
+
+			expected := make(map[string]interface{})
+			require.NoError(t, json.Unmarshal([]byte(testCase.expectedStr), &expected))
+
+			assert.EqualValues(t, expected, actual)
+		})
+	}
+}
+
 func TestSpanReader_buildTagQuery(t *testing.T) {
 	expectedStr :=
 		`{ "bool": {
@@ -52,6 +52,10 @@ const spanMapping = `{
                "type":"keyword",
                "ignore_above":256
             },
+            "spanKind":{
+               "type":"keyword",
+               "ignore_above":256
+            },
             "startTime":{
                "type":"long"
             },
@@ -62,6 +66,8 @@ const spanMapping = `{
                "type":"integer"
             },
             "logs":{
+               "type":"nested",
+               "dynamic":false,
                "properties":{
                   "timestamp":{
                      "type":"long"
@@ -147,6 +153,9 @@ const spanMapping = `{
                      "ignore_above":256
                   }
                }
+            },
+            "serializedSpan":{
+               "type":"binary"
             }
          }
       },
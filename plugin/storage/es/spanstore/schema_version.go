@@ -0,0 +1,102 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/olivere/elastic"
+	"github.com/pkg/errors"
+
+	"github.com/uber/jaeger/pkg/es"
+)
+
+// SchemaVersion is the version of the span mapping the writer and reader expect. It is recorded in a
+// document of the schema index, named after the prefix of the span indices, e.g. jaeger-schema.
+//
+// Version 2 added the spanKind field, which is only mapped in the indices created from then on.
+const SchemaVersion = 2
+
+const (
+	schemaType       = "schema"
+	schemaDocumentID = "jaeger"
+	schemaIndexName  = "schema"
+)
+
+type schemaDocument struct {
+	Version int `json:"version"`
+}
+
+// SchemaIndex returns the index recording the schema version of the span indices
+func (n *IndexNaming) SchemaIndex() string {
+	prefix := n.template[:strings.Index(n.template, "{")]
+	if prefix == "" {
+		prefix = indexPrefix
+	}
+	return prefix + schemaIndexName
+}
+
+// CheckSchema returns an error unless the schema version recorded for the span indices is SchemaVersion, so
+// that collectors do not write spans with a mapping other collectors do not expect. A newer version is always
+// an error, since the spans written by this collector could not be read by the newer ones. An older version is
+// upgraded if autoMigrate is true. Since the indices are created by the writers, the version is recorded when
+// there is none yet.
+func CheckSchema(client es.Client, indexNaming *IndexNaming, autoMigrate bool) error {
+	ctx := context.Background()
+	index := indexNaming.SchemaIndex()
+	result, err := client.Search(index).
+		Type(schemaType).
+		Query(elastic.NewIdsQuery(schemaType).Ids(schemaDocumentID)).
+		IgnoreUnavailable(true).
+		Do(ctx)
+	if err != nil {
+		return errors.Wrap(err, "Failed to read the ElasticSearch schema version")
+	}
+	var version int
+	if result.Hits != nil && len(result.Hits.Hits) > 0 {
+		var document schemaDocument
+		if err := json.Unmarshal(*result.Hits.Hits[0].Source, &document); err != nil {
+			return errors.Wrap(err, "Failed to read the ElasticSearch schema version")
+		}
+		version = document.Version
+	}
+	if version > SchemaVersion {
+		return errors.Errorf("ElasticSearch schema version %d is newer than the version %d of this collector", version, SchemaVersion)
+	}
+	if version == SchemaVersion {
+		return nil
+	}
+	if version > 0 && !autoMigrate {
+		return errors.Errorf(
+			"ElasticSearch schema version %d of %s is older than the expected version %d, enable the schema migration",
+			version, index, SchemaVersion)
+	}
+	// the migrations so far only change the mapping of the indices created from now on
+	_, err = client.Index().
+		Index(index).
+		Type(schemaType).
+		Id(schemaDocumentID).
+		BodyJson(schemaDocument{Version: SchemaVersion}).
+		Do(ctx)
+	return errors.Wrap(err, "Failed to record the ElasticSearch schema version")
+}
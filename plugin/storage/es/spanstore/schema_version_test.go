@@ -0,0 +1,138 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/olivere/elastic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/jaeger/pkg/es/mocks"
+)
+
+// withSchemaClient mocks a client whose schema index records the version, none if 0, recording
+// the versions written to it
+func withSchemaClient(index string, version int, searchErr error, fn func(client *mocks.Client, written *[]int)) {
+	var hits []*elastic.SearchHit
+	if version > 0 {
+		source := json.RawMessage(`{"version": ` + strconv.Itoa(version) + `}`)
+		hits = append(hits, &elastic.SearchHit{Source: &source})
+	}
+	searchService := &mocks.SearchService{}
+	searchService.On("Type", schemaType).Return(searchService)
+	searchService.On("Query", mock.AnythingOfType("*elastic.IdsQuery")).Return(searchService)
+	searchService.On("IgnoreUnavailable", true).Return(searchService)
+	searchService.On("Do", mock.AnythingOfType("*context.emptyCtx")).
+		Return(&elastic.SearchResult{Hits: &elastic.SearchHits{Hits: hits}}, searchErr)
+
+	var written []int
+	indexService := &mocks.IndexService{}
+	indexService.On("Index", index).Return(indexService)
+	indexService.On("Type", schemaType).Return(indexService)
+	indexService.On("Id", schemaDocumentID).Return(indexService)
+	indexService.On("BodyJson", mock.AnythingOfType("spanstore.schemaDocument")).
+		Run(func(args mock.Arguments) {
+			written = append(written, args.Get(0).(schemaDocument).Version)
+		}).
+		Return(indexService)
+	indexService.On("Do", mock.AnythingOfType("*context.emptyCtx")).Return(&elastic.IndexResponse{}, nil)
+
+	client := &mocks.Client{}
+	client.On("Search", index).Return(searchService)
+	client.On("Index").Return(indexService)
+	fn(client, &written)
+}
+
+func TestSchemaIndex(t *testing.T) {
+	for template, expected := range map[string]string{
+		"":                       "jaeger-schema",
+		ServiceIndexTemplate:     "jaeger-schema",
+		"tenant-a-{date}":        "tenant-a-schema",
+		"{date}-spans":           "jaeger-schema",
+		"spans-{service}-{date}": "spans-schema",
+	} {
+		indexNaming, err := NewIndexNaming(template)
+		require.NoError(t, err)
+		assert.Equal(t, expected, indexNaming.SchemaIndex(), template)
+	}
+}
+
+func TestCheckSchema(t *testing.T) {
+	testCases := []struct {
+		caption         string
+		version         int
+		autoMigrate     bool
+		searchErr       error
+		expectedError   string
+		expectedWritten []int
+	}{
+		{
+			caption: "expected version",
+			version: SchemaVersion,
+		},
+		{
+			caption:         "no version yet",
+			expectedWritten: []int{SchemaVersion},
+		},
+		{
+			caption:       "older version",
+			version:       1,
+			expectedError: "ElasticSearch schema version 1 of jaeger-schema is older than the expected version 2, enable the schema migration",
+		},
+		{
+			caption:         "older version migrated",
+			version:         1,
+			autoMigrate:     true,
+			expectedWritten: []int{SchemaVersion},
+		},
+		{
+			caption:       "newer version",
+			version:       SchemaVersion + 1,
+			autoMigrate:   true,
+			expectedError: "ElasticSearch schema version 3 is newer than the version 2 of this collector",
+		},
+		{
+			caption:       "search failure",
+			searchErr:     errors.New("cluster unavailable"),
+			expectedError: "Failed to read the ElasticSearch schema version: cluster unavailable",
+		},
+	}
+	for _, tc := range testCases {
+		testCase := tc // capture loop var
+		t.Run(testCase.caption, func(t *testing.T) {
+			withSchemaClient("jaeger-schema", testCase.version, testCase.searchErr, func(client *mocks.Client, written *[]int) {
+				err := CheckSchema(client, defaultIndexNaming, testCase.autoMigrate)
+				if testCase.expectedError == "" {
+					assert.NoError(t, err)
+				} else {
+					assert.EqualError(t, err, testCase.expectedError)
+				}
+				assert.Equal(t, testCase.expectedWritten, *written)
+			})
+		})
+	}
+}
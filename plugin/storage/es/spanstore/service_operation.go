@@ -86,7 +86,7 @@ func (s *ServiceOperationStorage) Write(indexName string, jsonSpan *jModel.Span)
 	if !keyInCache(cacheKey, s.serviceCache) {
 		start := time.Now()
 		_, err := s.client.Index().Index(indexName).Type(serviceType).Id(serviceID).BodyJson(service).Do(s.ctx)
-		s.metrics.Emit(err, time.Since(start))
+		s.metrics.Emit(err, time.Since(start), classifyError)
 		if err != nil {
 			return s.logError(jsonSpan, err, "Failed to insert service:operation", s.logger)
 		}
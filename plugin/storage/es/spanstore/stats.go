@@ -0,0 +1,114 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"github.com/olivere/elastic"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/pkg/es"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+const (
+	statsTracesAggregation   = "traces"
+	statsErrorsAggregation   = "errors"
+	statsServicesAggregation = "services"
+)
+
+// ErrUnableToFindStatsAggregation occurs when an aggregation of the statistics is missing from the search result
+var ErrUnableToFindStatsAggregation = errors.New("Could not find aggregation of the statistics")
+
+// NewStatsReader returns a spanstore.StatsReader of the spans in the indices named by the ReaderOptions
+func NewStatsReader(client es.Client, logger *zap.Logger, options ...ReaderOption) spanstore.StatsReader {
+	reader := newSpanReader(client, logger, 0)
+	for _, option := range options {
+		option(reader)
+	}
+	return reader
+}
+
+// GetTraceStats implements spanstore.StatsReader with the aggregations of a single search of the spans of the
+// time range: a cardinality of the trace IDs, approximate beyond 3000 traces, and the spans with the error tag,
+// overall and by service, the services being aggregated in the order of their names.
+func (s *SpanReader) GetTraceStats(query *spanstore.StatsQueryParameters) (*spanstore.TraceStats, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	boolQuery := elastic.NewBoolQuery().Must(s.buildStartTimeQuery(query.StartTimeMin, query.StartTimeMax))
+	if query.ServiceName != "" {
+		boolQuery.Must(s.buildServiceNameQuery(query.ServiceName))
+	}
+	errorsAggregation := elastic.NewFilterAggregation().Filter(s.buildNestedQuery(tagsField, "error", "true"))
+	servicesAggregation := elastic.NewTermsAggregation().
+		Field(serviceNameField).
+		Size(defaultDocCount).
+		OrderByTermAsc().
+		SubAggregation(statsErrorsAggregation, errorsAggregation)
+
+	jaegerIndices := s.indexNaming.indices(query.ServiceName, query.StartTimeMin, query.StartTimeMax)
+	searchService := s.client.Search(jaegerIndices...).
+		Type(spanType).
+		Size(0). // only the aggregations are needed
+		Aggregation(statsTracesAggregation, elastic.NewCardinalityAggregation().Field(traceIDField)).
+		Aggregation(statsErrorsAggregation, errorsAggregation).
+		Aggregation(statsServicesAggregation, servicesAggregation).
+		IgnoreUnavailable(true).
+		Query(boolQuery)
+
+	searchResult, err := searchService.Do(s.ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "Search service failed")
+	}
+	traces, found := searchResult.Aggregations.Cardinality(statsTracesAggregation)
+	if !found || traces.Value == nil {
+		return nil, ErrUnableToFindStatsAggregation
+	}
+	errorSpans, found := searchResult.Aggregations.Filter(statsErrorsAggregation)
+	if !found {
+		return nil, ErrUnableToFindStatsAggregation
+	}
+	services, found := searchResult.Aggregations.Terms(statsServicesAggregation)
+	if !found {
+		return nil, ErrUnableToFindStatsAggregation
+	}
+	stats := &spanstore.TraceStats{
+		Traces:     int(*traces.Value),
+		Spans:      int(searchResult.TotalHits()),
+		ErrorSpans: int(errorSpans.DocCount),
+		Services:   make([]spanstore.ServiceStats, 0, len(services.Buckets)),
+		// the services beyond the size of the terms aggregation are left out
+		Truncated: services.SumOfOtherDocCount > 0,
+	}
+	for _, bucket := range services.Buckets {
+		service, ok := bucket.Key.(string)
+		if !ok {
+			return nil, errors.Errorf("Non-string key found in aggregation: %v", bucket.Key)
+		}
+		serviceStats := spanstore.ServiceStats{ServiceName: service, Spans: int(bucket.DocCount)}
+		if serviceErrors, found := bucket.Filter(statsErrorsAggregation); found {
+			serviceStats.ErrorSpans = int(serviceErrors.DocCount)
+		}
+		stats.Services = append(stats.Services, serviceStats)
+	}
+	return stats, nil
+}
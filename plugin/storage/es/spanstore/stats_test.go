@@ -0,0 +1,134 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/pkg/es/mocks"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+var _ spanstore.StatsReader = &SpanReader{} // check API conformance
+
+func TestNewStatsReader(t *testing.T) {
+	indexNaming, err := NewIndexNaming(ServiceIndexTemplate)
+	assert.NoError(t, err)
+	statsReader := NewStatsReader(&mocks.Client{}, zap.NewNop(), ReaderOptions.IndexNaming(indexNaming))
+	assert.Equal(t, indexNaming, statsReader.(*SpanReader).indexNaming)
+}
+
+func TestSpanReaderGetTraceStats(t *testing.T) {
+	startTime := time.Date(2017, time.January, 26, 10, 0, 0, 0, time.UTC)
+	statsQuery := &spanstore.StatsQueryParameters{
+		StartTimeMin: startTime,
+		StartTimeMax: startTime.Add(time.Hour),
+	}
+	aggregations := func(services string) elastic.Aggregations {
+		raw := map[string]string{
+			statsTracesAggregation:   `{"value": 4}`,
+			statsErrorsAggregation:   `{"doc_count": 3}`,
+			statsServicesAggregation: `{"sum_other_doc_count": 0, "buckets": [` + services + `]}`,
+		}
+		result := make(map[string]*json.RawMessage)
+		for name, value := range raw {
+			message := json.RawMessage(value)
+			result[name] = &message
+		}
+		return elastic.Aggregations(result)
+	}
+	testCases := []struct {
+		searchResult  *elastic.SearchResult
+		searchErr     error
+		expected      *spanstore.TraceStats
+		expectedError string
+	}{
+		{
+			searchResult: &elastic.SearchResult{
+				Hits: &elastic.SearchHits{TotalHits: 10},
+				Aggregations: aggregations(`
+					{"key": "service-a", "doc_count": 7, "errors": {"doc_count": 3}},
+					{"key": "service-b", "doc_count": 3, "errors": {"doc_count": 0}}`),
+			},
+			expected: &spanstore.TraceStats{
+				Traces:     4,
+				Spans:      10,
+				ErrorSpans: 3,
+				Services: []spanstore.ServiceStats{
+					{ServiceName: "service-a", Spans: 7, ErrorSpans: 3},
+					{ServiceName: "service-b", Spans: 3},
+				},
+			},
+		},
+		{
+			searchResult:  &elastic.SearchResult{Aggregations: aggregations(`{"key": 1, "doc_count": 7}`)},
+			expectedError: "Non-string key found in aggregation: 1",
+		},
+		{
+			searchResult:  &elastic.SearchResult{},
+			expectedError: ErrUnableToFindStatsAggregation.Error(),
+		},
+		{
+			searchErr:     errors.New("timeout"),
+			expectedError: "Search service failed: timeout",
+		},
+	}
+	for _, tc := range testCases {
+		testCase := tc // capture loop var
+		withSpanReader(func(r *spanReaderTest) {
+			searchService := &mocks.SearchService{}
+			searchService.On("Type", spanType).Return(searchService)
+			searchService.On("Size", 0).Return(searchService)
+			searchService.On("Aggregation", statsTracesAggregation, mock.AnythingOfType("*elastic.CardinalityAggregation")).Return(searchService)
+			searchService.On("Aggregation", statsErrorsAggregation, mock.AnythingOfType("*elastic.FilterAggregation")).Return(searchService)
+			searchService.On("Aggregation", statsServicesAggregation, mock.AnythingOfType("*elastic.TermsAggregation")).Return(searchService)
+			searchService.On("IgnoreUnavailable", true).Return(searchService)
+			searchService.On("Query", mock.AnythingOfType("*elastic.BoolQuery")).Return(searchService)
+			searchService.On("Do", mock.Anything).Return(testCase.searchResult, testCase.searchErr)
+			indices := r.reader.indexNaming.indices("", statsQuery.StartTimeMin, statsQuery.StartTimeMax)
+			assert.Len(t, indices, 1)
+			r.client.On("Search", indices[0]).Return(searchService)
+
+			stats, err := r.reader.GetTraceStats(statsQuery)
+			if testCase.expectedError == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, testCase.expected, stats)
+			} else {
+				assert.EqualError(t, err, testCase.expectedError)
+			}
+		})
+	}
+}
+
+func TestSpanReaderGetTraceStatsInvalid(t *testing.T) {
+	withSpanReader(func(r *spanReaderTest) {
+		_, err := r.reader.GetTraceStats(&spanstore.StatsQueryParameters{StartTimeMin: time.Now()})
+		assert.EqualError(t, err, spanstore.ErrStatsTimeRangeNotSet.Error())
+	})
+}
@@ -22,6 +22,7 @@ package spanstore
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/pkg/errors"
@@ -29,6 +30,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/model/codec"
 	"github.com/uber/jaeger/model/converter/json"
 	jModel "github.com/uber/jaeger/model/json"
 	"github.com/uber/jaeger/pkg/cache"
@@ -39,6 +41,8 @@ import (
 const (
 	spanType    = "span"
 	serviceType = "service"
+
+	serviceIndexCacheSize = 10000
 )
 
 type spanWriterMetrics struct {
@@ -56,6 +60,53 @@ type SpanWriter struct {
 	writerMetrics spanWriterMetrics // TODO: build functions to wrap around each Do fn
 	indexCache    cache.Cache
 	serviceWriter serviceWriter
+	format        codec.Format
+	serializer    *codec.Serializer
+	indexNaming   *IndexNaming
+	indexSettings IndexSettings
+	// indexBody is the mapping and settings of the span indices created by the writer
+	indexBody string
+}
+
+// WriterOption is a function that sets some option on the SpanWriter.
+type WriterOption func(*SpanWriter)
+
+// WriterOptions is a factory for all available WriterOption's
+var WriterOptions writerOptions
+
+type writerOptions struct{}
+
+// Serialization creates a WriterOption that stores spans serialized with the given format along with
+// their JSON fields, which are still needed to search them. Spans are read back from the serialized
+// form when there is one, so this can be changed at any time.
+func (writerOptions) Serialization(format codec.Format) WriterOption {
+	return func(s *SpanWriter) {
+		s.format = format
+	}
+}
+
+// IndexNaming creates a WriterOption that names the indices spans are written to, which must
+// be the same IndexNaming as the one of the readers.
+func (writerOptions) IndexNaming(indexNaming *IndexNaming) WriterOption {
+	return func(s *SpanWriter) {
+		s.indexNaming = indexNaming
+	}
+}
+
+// IndexSettings creates a WriterOption that applies the settings to the span indices created by the writer,
+// the indices created before keeping their own settings.
+func (writerOptions) IndexSettings(settings IndexSettings) WriterOption {
+	return func(s *SpanWriter) {
+		s.indexSettings = settings
+	}
+}
+
+// spanDocument is the document of a span, along with its serialized form when it is serialized by a codec
+type spanDocument struct {
+	jModel.Span
+	// SpanKind is searched instead of the span.kind tag, it is missing from the spans written before it was
+	SpanKind       model.SpanKind `json:"spanKind,omitempty"`
+	SerializedSpan []byte         `json:"serializedSpan,omitempty"`
 }
 
 // Service is the JSON struct for service:operation documents in ElasticSearch
@@ -65,11 +116,11 @@ type Service struct {
 }
 
 // NewSpanWriter creates a new SpanWriter for use
-func NewSpanWriter(client es.Client, logger *zap.Logger, metricsFactory metrics.Factory) *SpanWriter {
+func NewSpanWriter(client es.Client, logger *zap.Logger, metricsFactory metrics.Factory, options ...WriterOption) *SpanWriter {
 	ctx := context.Background()
 	// TODO: Configurable TTL
 	serviceOperationStorage := NewServiceOperationStorage(ctx, client, metricsFactory, logger, time.Hour*12)
-	return &SpanWriter{
+	writer := &SpanWriter{
 		ctx:    ctx,
 		client: client,
 		logger: logger,
@@ -78,18 +129,33 @@ func NewSpanWriter(client es.Client, logger *zap.Logger, metricsFactory metrics.
 			spans:       storageMetrics.NewWriteMetrics(metricsFactory, "Spans"),
 		},
 		serviceWriter: serviceOperationStorage.Write,
-		indexCache: cache.NewLRUWithOptions(
-			5,
-			&cache.Options{
-				TTL: 48 * time.Hour,
-			},
-		),
+		serializer:    codec.NewSerializer(metricsFactory),
+		indexNaming:   defaultIndexNaming,
 	}
+	for _, option := range options {
+		option(writer)
+	}
+	writer.indexBody = writer.indexSettings.indexBody(spanMapping)
+	if !writer.indexSettings.isDefault() {
+		logger.Info("Creating the span indices with settings", writer.indexSettings.logFields()...)
+	}
+	indexCacheSize := 5
+	if writer.indexNaming.PerService() {
+		// the indices of the current day of every service
+		indexCacheSize = serviceIndexCacheSize
+	}
+	writer.indexCache = cache.NewLRUWithOptions(
+		indexCacheSize,
+		&cache.Options{
+			TTL: 48 * time.Hour,
+		},
+	)
+	return writer
 }
 
 // WriteSpan writes a span and its corresponding service:operation in ElasticSearch
 func (s *SpanWriter) WriteSpan(span *model.Span) error {
-	jaegerIndexName := spanIndexName(span)
+	jaegerIndexName := s.spanIndexName(span)
 	// Convert model.Span into json.Span
 	jsonSpan := json.FromDomainEmbedProcess(span)
 
@@ -99,22 +165,49 @@ func (s *SpanWriter) WriteSpan(span *model.Span) error {
 	if err := s.writeService(jaegerIndexName, jsonSpan); err != nil {
 		return err
 	}
-	if err := s.writeSpan(jaegerIndexName, jsonSpan); err != nil {
+	document, err := s.spanDocument(span, jsonSpan)
+	if err != nil {
+		return err
+	}
+	if err := s.writeSpan(jaegerIndexName, spanDocumentID(span), jsonSpan, document); err != nil {
 		return err
 	}
 	return nil
 }
 
-func spanIndexName(span *model.Span) string {
-	spanDate := span.StartTime.Format("2006-01-02")
-	return "jaeger-" + spanDate
+// spanDocument returns the document indexed for the span, which is the JSON span with its kind, and its
+// serialized form when it is serialized by a codec
+func (s *SpanWriter) spanDocument(span *model.Span, jsonSpan *jModel.Span) (*spanDocument, error) {
+	document := &spanDocument{Span: *jsonSpan, SpanKind: span.GetSpanKind()}
+	if s.format == codec.NoFormat {
+		return document, nil
+	}
+	data, err := s.serializer.Serialize(s.format, span)
+	if err != nil {
+		s.writerMetrics.spans.EmitError(storageMetrics.SerializationError)
+		return nil, s.logError(jsonSpan, err, "Failed to serialize span", s.logger)
+	}
+	document.SerializedSpan = data
+	return document, nil
+}
+
+// spanDocumentID is the ID of the document of a span. Like the span_hash of the Cassandra primary key, it
+// is derived from the content of the span so that a span written twice overwrites its document, while
+// the client and server spans of Zipkin-style clients sharing their ID are both kept.
+func spanDocumentID(span *model.Span) string {
+	spanHash, _ := model.HashCode(span)
+	return fmt.Sprintf("%s|%s|%x", span.TraceID, span.SpanID, spanHash)
+}
+
+func (s *SpanWriter) spanIndexName(span *model.Span) string {
+	return s.indexNaming.IndexName(span.Process.ServiceName, span.StartTime)
 }
 
 func (s *SpanWriter) createIndex(indexName string, jsonSpan *jModel.Span) error {
 	if !keyInCache(indexName, s.indexCache) {
 		start := time.Now()
-		_, err := s.client.CreateIndex(indexName).Body(spanMapping).Do(s.ctx)
-		s.writerMetrics.indexCreate.Emit(err, time.Since(start))
+		_, err := s.client.CreateIndex(indexName).Body(s.indexBody).Do(s.ctx)
+		s.writerMetrics.indexCreate.Emit(err, time.Since(start), classifyError)
 		if err != nil {
 			return s.logError(jsonSpan, err, "Failed to create index", s.logger)
 		}
@@ -135,10 +228,10 @@ func (s *SpanWriter) writeService(indexName string, jsonSpan *jModel.Span) error
 	return s.serviceWriter(indexName, jsonSpan)
 }
 
-func (s *SpanWriter) writeSpan(indexName string, jsonSpan *jModel.Span) error {
+func (s *SpanWriter) writeSpan(indexName, id string, jsonSpan *jModel.Span, document interface{}) error {
 	start := time.Now()
-	_, err := s.client.Index().Index(indexName).Type(spanType).BodyJson(jsonSpan).Do(s.ctx)
-	s.writerMetrics.spans.Emit(err, time.Since(start))
+	_, err := s.client.Index().Index(indexName).Type(spanType).Id(id).BodyJson(document).Do(s.ctx)
+	s.writerMetrics.spans.Emit(err, time.Since(start), classifyError)
 	if err != nil {
 		return s.logError(jsonSpan, err, "Failed to insert span", s.logger)
 	}
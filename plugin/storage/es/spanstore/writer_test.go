@@ -34,6 +34,8 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/model/codec"
+	jConverter "github.com/uber/jaeger/model/converter/json"
 	"github.com/uber/jaeger/model/json"
 	"github.com/uber/jaeger/pkg/es/mocks"
 	"github.com/uber/jaeger/pkg/testutils"
@@ -183,7 +185,7 @@ func TestSpanWriter_WriteSpan(t *testing.T) {
 				indexServicePut.On("Do", mock.AnythingOfType("*context.emptyCtx")).Return(testCase.putResult, testCase.servicePutError)
 
 				indexSpanPut.On("Id", mock.AnythingOfType("string")).Return(indexSpanPut)
-				indexSpanPut.On("BodyJson", mock.AnythingOfType("*json.Span")).Return(indexSpanPut)
+				indexSpanPut.On("BodyJson", mock.AnythingOfType("*spanstore.spanDocument")).Return(indexSpanPut)
 				indexSpanPut.On("Do", mock.AnythingOfType("*context.emptyCtx")).Return(testCase.putResult, testCase.spanPutError)
 
 				w.client.On("CreateIndex", stringMatcher(indexName)).Return(createService)
@@ -210,14 +212,88 @@ func TestSpanWriter_WriteSpan(t *testing.T) {
 	}
 }
 
+func TestSpanWriterSerialization(t *testing.T) {
+	client := &mocks.Client{}
+	writer := NewSpanWriter(client, zap.NewNop(), metrics.NullFactory, WriterOptions.Serialization(codec.JSONFormat))
+	span := &model.Span{
+		TraceID:       model.TraceID{Low: 1},
+		OperationName: "operation-a",
+		Tags:          model.KeyValues{model.String("x", "y")},
+		Process:       &model.Process{ServiceName: "service-a"},
+	}
+	jsonSpan := jConverter.FromDomainEmbedProcess(span)
+
+	document, err := writer.spanDocument(span, jsonSpan)
+	require.NoError(t, err)
+	// the JSON fields are kept for searching
+	assert.Equal(t, *jsonSpan, document.Span)
+	assert.Equal(t, byte(codec.JSONFormat), document.SerializedSpan[0])
+
+	writer = NewSpanWriter(client, zap.NewNop(), metrics.NullFactory)
+	document, err = writer.spanDocument(span, jsonSpan)
+	require.NoError(t, err)
+	assert.Equal(t, &spanDocument{Span: *jsonSpan, SpanKind: model.SpanKindUnspecified}, document)
+}
+
+func TestSpanDocumentID(t *testing.T) {
+	client := &model.Span{
+		TraceID: model.TraceID{Low: 1},
+		SpanID:  model.SpanID(2),
+		Tags:    model.KeyValues{model.String("span.kind", "client")},
+		Process: &model.Process{ServiceName: "service-a"},
+	}
+	server := *client
+	server.Tags = model.KeyValues{model.String("span.kind", "server")}
+	retry := *client
+
+	assert.Regexp(t, `^1\|2\|[0-9a-f]+$`, spanDocumentID(client))
+	assert.Equal(t, spanDocumentID(client), spanDocumentID(&retry), "a retried span overwrites its document")
+	assert.NotEqual(t, spanDocumentID(client), spanDocumentID(&server), "both halves of a shared span are kept")
+}
+
+func TestSpanWriterSpanKind(t *testing.T) {
+	writer := NewSpanWriter(&mocks.Client{}, zap.NewNop(), metrics.NullFactory)
+	span := &model.Span{
+		TraceID: model.TraceID{Low: 1},
+		Tags:    model.KeyValues{model.String("span.kind", "server")},
+		Process: &model.Process{ServiceName: "service-a"},
+	}
+	document, err := writer.spanDocument(span, jConverter.FromDomainEmbedProcess(span))
+	require.NoError(t, err)
+	assert.Equal(t, model.SpanKindServer, document.SpanKind)
+}
+
+func TestSpanWriterIndexSettings(t *testing.T) {
+	client := &mocks.Client{}
+	logger, logBuffer := testutils.NewLogger()
+	settings := IndexSettings{RefreshInterval: "30s", Shards: 3}
+	writer := NewSpanWriter(client, logger, metrics.NullFactory, WriterOptions.IndexSettings(settings))
+	assert.Contains(t, logBuffer.String(), `"msg":"Creating the span indices with settings","refresh_interval":"30s","shards":3`)
+
+	createService := &mocks.IndicesCreateService{}
+	createService.On("Body", stringMatcher(settings.indexBody(spanMapping))).Return(createService)
+	createService.On("Do", mock.AnythingOfType("*context.emptyCtx")).Return(&elastic.IndicesCreateResult{}, nil)
+	client.On("CreateIndex", stringMatcher("jaeger-1995-04-21")).Return(createService)
+
+	err := writer.createIndex("jaeger-1995-04-21", &json.Span{TraceID: json.TraceID("1")})
+	assert.NoError(t, err)
+	createService.AssertNumberOfCalls(t, "Body", 1)
+}
+
 func TestSpanIndexName(t *testing.T) {
 	date, err := time.Parse(time.RFC3339, "1995-04-21T22:08:41+00:00")
 	require.NoError(t, err)
 	span := &model.Span{
 		StartTime: date,
+		Process:   &model.Process{ServiceName: "Frontend"},
 	}
-	indexName := spanIndexName(span)
-	assert.Equal(t, "jaeger-1995-04-21", indexName)
+	writer := NewSpanWriter(&mocks.Client{}, zap.NewNop(), metrics.NullFactory)
+	assert.Equal(t, "jaeger-1995-04-21", writer.spanIndexName(span))
+
+	indexNaming, err := NewIndexNaming(ServiceIndexTemplate)
+	require.NoError(t, err)
+	writer = NewSpanWriter(&mocks.Client{}, zap.NewNop(), metrics.NullFactory, WriterOptions.IndexNaming(indexNaming))
+	assert.Equal(t, "jaeger-frontend-1995-04-21", writer.spanIndexName(span))
 }
 
 func TestCheckAndCreateIndex(t *testing.T) {
@@ -288,6 +364,7 @@ func TestWriteSpanInternal(t *testing.T) {
 		indexName := "jaeger-1995-04-21"
 		indexService.On("Index", stringMatcher(indexName)).Return(indexService)
 		indexService.On("Type", stringMatcher(spanType)).Return(indexService)
+		indexService.On("Id", stringMatcher("1|0|2a")).Return(indexService)
 		indexService.On("BodyJson", mock.AnythingOfType("*json.Span")).Return(indexService)
 		indexService.On("Do", mock.AnythingOfType("*context.emptyCtx")).Return(&elastic.IndexResponse{}, nil)
 
@@ -295,7 +372,7 @@ func TestWriteSpanInternal(t *testing.T) {
 
 		jsonSpan := &json.Span{}
 
-		err := w.writer.writeSpan(indexName, jsonSpan)
+		err := w.writer.writeSpan(indexName, "1|0|2a", jsonSpan, jsonSpan)
 		require.NoError(t, err)
 
 		indexService.AssertNumberOfCalls(t, "Do", 1)
@@ -310,6 +387,7 @@ func TestWriteSpanInternalError(t *testing.T) {
 		indexName := "jaeger-1995-04-21"
 		indexService.On("Index", stringMatcher(indexName)).Return(indexService)
 		indexService.On("Type", stringMatcher(spanType)).Return(indexService)
+		indexService.On("Id", stringMatcher("1|0|2a")).Return(indexService)
 		indexService.On("BodyJson", mock.AnythingOfType("*json.Span")).Return(indexService)
 		indexService.On("Do", mock.AnythingOfType("*context.emptyCtx")).Return(nil, errors.New("span insertion error"))
 
@@ -320,7 +398,7 @@ func TestWriteSpanInternalError(t *testing.T) {
 			SpanID:  json.SpanID("0"),
 		}
 
-		err := w.writer.writeSpan(indexName, jsonSpan)
+		err := w.writer.writeSpan(indexName, "1|0|2a", jsonSpan, jsonSpan)
 		assert.EqualError(t, err, "Failed to insert span: span insertion error")
 
 		indexService.AssertNumberOfCalls(t, "Do", 1)
@@ -0,0 +1,94 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	jConverter "github.com/uber/jaeger/model/converter/json"
+	storageMetrics "github.com/uber/jaeger/storage/spanstore/metrics"
+)
+
+type spanWriterMetrics struct {
+	spans *storageMetrics.WriteMetrics
+}
+
+// SpanWriter writes spans to a Kafka topic for buffered ingestion
+type SpanWriter struct {
+	producer      sarama.SyncProducer
+	topic         string
+	logger        *zap.Logger
+	writerMetrics spanWriterMetrics
+}
+
+// NewSpanWriter creates a new SpanWriter for use
+func NewSpanWriter(
+	producer sarama.SyncProducer,
+	topic string,
+	logger *zap.Logger,
+	metricsFactory metrics.Factory,
+) *SpanWriter {
+	return &SpanWriter{
+		producer: producer,
+		topic:    topic,
+		logger:   logger,
+		writerMetrics: spanWriterMetrics{
+			spans: storageMetrics.NewWriteMetrics(metricsFactory, "Spans"),
+		},
+	}
+}
+
+// WriteSpan serializes the span with its embedded process and produces it to the configured topic.
+// Messages are keyed by trace ID so that all spans of a trace land on the same partition.
+func (w *SpanWriter) WriteSpan(span *model.Span) error {
+	jsonSpan := jConverter.FromDomainEmbedProcess(span)
+	bytes, err := json.Marshal(jsonSpan)
+	if err != nil {
+		return w.logError(span, err, "Failed to serialize span")
+	}
+	start := time.Now()
+	_, _, err = w.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: w.topic,
+		Key:   sarama.StringEncoder(span.TraceID.String()),
+		Value: sarama.ByteEncoder(bytes),
+	})
+	w.writerMetrics.spans.Emit(err, time.Since(start))
+	if err != nil {
+		return w.logError(span, err, "Failed to produce span")
+	}
+	return nil
+}
+
+func (w *SpanWriter) logError(span *model.Span, err error, msg string) error {
+	w.logger.
+		With(zap.String("trace_id", span.TraceID.String())).
+		With(zap.String("span_id", span.SpanID.String())).
+		With(zap.Error(err)).
+		Error(msg)
+	return errors.Wrap(err, msg)
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	saramaMocks "github.com/Shopify/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/pkg/testutils"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+var _ spanstore.Writer = &SpanWriter{} // check API conformance
+
+var testSpan = &model.Span{
+	TraceID:       model.TraceID{Low: 1},
+	SpanID:        model.SpanID(2),
+	OperationName: "operation",
+	StartTime:     time.Unix(300, 0),
+	Process: &model.Process{
+		ServiceName: "service",
+	},
+}
+
+func TestSpanWriter_WriteSpan(t *testing.T) {
+	producer := saramaMocks.NewSyncProducer(t, nil)
+	defer producer.Close()
+	producer.ExpectSendMessageWithCheckerFunctionAndSucceed(func(val []byte) error {
+		if len(val) == 0 {
+			return errors.New("empty message")
+		}
+		return nil
+	})
+	logger, _ := testutils.NewLogger()
+	metricsFactory := metrics.NewLocalFactory(0)
+	writer := NewSpanWriter(producer, "jaeger-spans", logger, metricsFactory)
+
+	assert.NoError(t, writer.WriteSpan(testSpan))
+
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["Spans.inserts"])
+}
+
+func TestSpanWriter_WriteSpanFailure(t *testing.T) {
+	producer := saramaMocks.NewSyncProducer(t, nil)
+	defer producer.Close()
+	producer.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+	logger, logBuffer := testutils.NewLogger()
+	metricsFactory := metrics.NewLocalFactory(0)
+	writer := NewSpanWriter(producer, "jaeger-spans", logger, metricsFactory)
+
+	err := writer.WriteSpan(testSpan)
+	assert.EqualError(t, err, "Failed to produce span: "+sarama.ErrOutOfBrokers.Error())
+	assert.Contains(t, logBuffer.String(), "Failed to produce span")
+
+	counts, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counts["Spans.errors"])
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// schemaLockID is the key of the advisory lock that keeps collectors and query services
+// starting at the same time from applying the migrations concurrently
+const schemaLockID = 0x6a6165676572
+
+// migrations are the statements that bring the schema to each version, in order.
+// Released migrations must never be changed, new ones are appended.
+var migrations = [][]string{
+	{
+		`CREATE TABLE spans (
+			id             BIGSERIAL PRIMARY KEY,
+			trace_id       VARCHAR(32) NOT NULL,
+			span_id        BIGINT NOT NULL,
+			parent_span_id BIGINT NOT NULL,
+			service_name   TEXT NOT NULL,
+			operation_name TEXT NOT NULL,
+			start_time     TIMESTAMPTZ NOT NULL,
+			duration       BIGINT NOT NULL,
+			span           JSONB NOT NULL
+		)`,
+		`CREATE INDEX spans_trace_id_idx ON spans (trace_id)`,
+		`CREATE INDEX spans_service_name_start_time_idx ON spans (service_name, start_time)`,
+		`CREATE INDEX spans_operation_name_start_time_idx ON spans (service_name, operation_name, start_time)`,
+		`CREATE TABLE span_tags (
+			span_row BIGINT NOT NULL REFERENCES spans (id) ON DELETE CASCADE,
+			key      TEXT NOT NULL,
+			value    TEXT NOT NULL
+		)`,
+		`CREATE INDEX span_tags_key_value_idx ON span_tags (key, value)`,
+		`CREATE INDEX span_tags_span_row_idx ON span_tags (span_row)`,
+		`CREATE TABLE operations (
+			service_name   TEXT NOT NULL,
+			operation_name TEXT NOT NULL,
+			PRIMARY KEY (service_name, operation_name)
+		)`,
+	},
+	// the spans written before have no span kind, FindTraces looks them up as unspecified
+	{
+		`ALTER TABLE spans ADD COLUMN span_kind TEXT`,
+		`CREATE INDEX spans_span_kind_start_time_idx ON spans (service_name, span_kind, start_time)`,
+	},
+	// spans retried by the clients or the collectors are only stored once, the duplicates written
+	// before are removed first. The kind and service are part of the key because the client and
+	// server halves of a Zipkin span share its ID.
+	{
+		`DELETE FROM spans a USING spans b
+		WHERE a.id > b.id AND a.trace_id = b.trace_id AND a.span_id = b.span_id
+		AND a.service_name = b.service_name AND a.span_kind IS NOT DISTINCT FROM b.span_kind`,
+		`CREATE UNIQUE INDEX spans_trace_id_span_id_idx ON spans (trace_id, span_id, service_name, COALESCE(span_kind, ''))`,
+	},
+}
+
+// Migrate creates the schema or upgrades it to the latest version. The version applied
+// last is recorded in the jaeger_schema_version table.
+func Migrate(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "Failed to start schema migration")
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, schemaLockID); err != nil {
+		return errors.Wrap(err, "Failed to lock schema")
+	}
+	if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS jaeger_schema_version (version INT NOT NULL)`); err != nil {
+		return errors.Wrap(err, "Failed to create schema version table")
+	}
+	var version int
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM jaeger_schema_version`).Scan(&version); err != nil {
+		return errors.Wrap(err, "Failed to read schema version")
+	}
+	if version > len(migrations) {
+		return errors.Errorf("Schema version %d is newer than the latest known version %d", version, len(migrations))
+	}
+	for i := version; i < len(migrations); i++ {
+		for _, statement := range migrations[i] {
+			if _, err := tx.Exec(statement); err != nil {
+				return errors.Wrapf(err, "Failed to migrate schema to version %d", i+1)
+			}
+		}
+		if _, err := tx.Exec(`INSERT INTO jaeger_schema_version (version) VALUES ($1)`, i+1); err != nil {
+			return errors.Wrap(err, "Failed to record schema version")
+		}
+	}
+	return tx.Commit()
+}
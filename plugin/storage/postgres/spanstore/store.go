@@ -0,0 +1,422 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	jConverter "github.com/uber/jaeger/model/converter/json"
+	jModel "github.com/uber/jaeger/model/json"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+const (
+	defaultNumTraces = 100
+
+	// maxBindParameters is the number of parameters PostgreSQL accepts in a single statement
+	maxBindParameters = 65535
+)
+
+var (
+	// ErrServiceNameNotSet occurs when attempting to query with an empty service name
+	ErrServiceNameNotSet = errors.New("Service Name must be set")
+
+	// ErrStartTimeMinGreaterThanMax occurs when start time min is above start time max
+	ErrStartTimeMinGreaterThanMax = errors.New("Start Time Minimum is above Maximum")
+
+	// ErrDurationMinGreaterThanMax occurs when duration min is above duration max
+	ErrDurationMinGreaterThanMax = errors.New("Duration Minimum is above Maximum")
+
+	// ErrMalformedRequestObject occurs when a request object is nil
+	ErrMalformedRequestObject = errors.New("Malformed request object")
+)
+
+// Store is a span store backed by PostgreSQL. Spans are stored as JSON in a table indexed by
+// trace ID, service, operation and start time, their tags are copied to a table indexed by key and value.
+type Store struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+// NewStore creates a Store on top of the given database, creating or upgrading the schema first
+func NewStore(db *sql.DB, logger *zap.Logger) (*Store, error) {
+	if err := Migrate(db); err != nil {
+		return nil, err
+	}
+	return &Store{db: db, logger: logger}, nil
+}
+
+// Close closes the underlying database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Ping checks that the database can be reached
+func (s *Store) Ping() error {
+	return s.db.Ping()
+}
+
+// WriteSpan writes the span, its tags and its service and operation names in a single transaction.
+// A span that is already stored is ignored.
+func (s *Store) WriteSpan(span *model.Span) error {
+	value, err := json.Marshal(jConverter.FromDomainEmbedProcess(span))
+	if err != nil {
+		return errors.Wrap(err, "Failed to serialize span")
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "Failed to write span")
+	}
+	defer tx.Rollback()
+	var row int64
+	err = tx.QueryRow(
+		`INSERT INTO spans (trace_id, span_id, parent_span_id, service_name, operation_name, start_time, duration, span_kind, span)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) ON CONFLICT DO NOTHING RETURNING id`,
+		span.TraceID.String(),
+		int64(span.SpanID),
+		int64(span.ParentSpanID),
+		span.Process.ServiceName,
+		span.OperationName,
+		span.StartTime.UTC(),
+		int64(model.DurationAsMicroseconds(span.Duration)),
+		string(span.GetSpanKind()),
+		value,
+	).Scan(&row)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "Failed to write span")
+	}
+	tags := spanTags(span)
+	for len(tags) > 0 {
+		chunk := tags
+		if len(chunk) > maxTagsPerStatement {
+			chunk = chunk[:maxTagsPerStatement]
+		}
+		tags = tags[len(chunk):]
+		statement, args := insertTagsStatement(row, chunk)
+		if _, err := tx.Exec(statement, args...); err != nil {
+			return errors.Wrap(err, "Failed to write span tags")
+		}
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO operations (service_name, operation_name) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		span.Process.ServiceName,
+		span.OperationName,
+	); err != nil {
+		return errors.Wrap(err, "Failed to write operation name")
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "Failed to write span")
+	}
+	return nil
+}
+
+// spanTags returns the tags that FindTraces can look up, i.e. those of the span, its process and its logs
+func spanTags(span *model.Span) model.KeyValues {
+	tags := append(model.KeyValues{}, span.Tags...)
+	tags = append(tags, span.Process.Tags...)
+	for _, log := range span.Logs {
+		tags = append(tags, log.Fields...)
+	}
+	return tags
+}
+
+// maxTagsPerStatement is the number of tags insertTagsStatement binds without exceeding maxBindParameters
+const maxTagsPerStatement = (maxBindParameters - 1) / 2
+
+func insertTagsStatement(row int64, tags model.KeyValues) (string, []interface{}) {
+	var statement bytes.Buffer
+	statement.WriteString(`INSERT INTO span_tags (span_row, key, value) VALUES `)
+	args := []interface{}{row}
+	for i, tag := range tags {
+		if i > 0 {
+			statement.WriteString(", ")
+		}
+		fmt.Fprintf(&statement, "($1, $%d, $%d)", len(args)+1, len(args)+2)
+		args = append(args, tag.Key, tag.AsString())
+	}
+	return statement.String(), args
+}
+
+// GetTrace loads all spans of the given trace
+func (s *Store) GetTrace(traceID model.TraceID) (*model.Trace, error) {
+	rows, err := s.db.Query(`SELECT span FROM spans WHERE trace_id = $1`, traceID.String())
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read trace")
+	}
+	defer rows.Close()
+	var spans []*model.Span
+	for rows.Next() {
+		var value []byte
+		if err := rows.Scan(&value); err != nil {
+			return nil, errors.Wrap(err, "Failed to read trace")
+		}
+		span, err := decodeSpan(value)
+		if err != nil {
+			return nil, err
+		}
+		spans = append(spans, span)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "Failed to read trace")
+	}
+	if len(spans) == 0 {
+		return nil, spanstore.ErrTraceNotFound
+	}
+	return &model.Trace{Spans: spans}, nil
+}
+
+// GetServices returns a list of all known services
+func (s *Store) GetServices() ([]string, error) {
+	return s.queryNames(`SELECT DISTINCT service_name FROM operations ORDER BY service_name`)
+}
+
+// GetOperations returns the operations of a given service
+func (s *Store) GetOperations(service string) ([]string, error) {
+	operations, err := s.queryNames(`SELECT operation_name FROM operations WHERE service_name = $1 ORDER BY operation_name`, service)
+	if operations == nil && err == nil {
+		operations = []string{}
+	}
+	return operations, err
+}
+
+func (s *Store) queryNames(query string, args ...interface{}) ([]string, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func validateQuery(p *spanstore.TraceQueryParameters) error {
+	if p == nil {
+		return ErrMalformedRequestObject
+	}
+	if p.ServiceName == "" {
+		return ErrServiceNameNotSet
+	}
+	if !p.StartTimeMin.IsZero() && !p.StartTimeMax.IsZero() && p.StartTimeMax.Before(p.StartTimeMin) {
+		return ErrStartTimeMinGreaterThanMax
+	}
+	if p.DurationMin != 0 && p.DurationMax != 0 && p.DurationMin > p.DurationMax {
+		return ErrDurationMinGreaterThanMax
+	}
+	return nil
+}
+
+// FindTraces returns the most recent traces with at least one span satisfying the query parameters
+func (s *Store) FindTraces(query *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
+	if err := validateQuery(query); err != nil {
+		return nil, err
+	}
+	traceIDs, err := s.findTraceIDs(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(traceIDs) == 0 {
+		return nil, nil
+	}
+	statement, args := getTracesStatement(traceIDs)
+	rows, err := s.db.Query(statement, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read traces")
+	}
+	defer rows.Close()
+	traces := make(map[model.TraceID]*model.Trace, len(traceIDs))
+	for rows.Next() {
+		var value []byte
+		if err := rows.Scan(&value); err != nil {
+			return nil, errors.Wrap(err, "Failed to read traces")
+		}
+		span, err := decodeSpan(value)
+		if err != nil {
+			return nil, err
+		}
+		trace, ok := traces[span.TraceID]
+		if !ok {
+			trace = &model.Trace{}
+			traces[span.TraceID] = trace
+		}
+		trace.Spans = append(trace.Spans, span)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "Failed to read traces")
+	}
+	// the traces are returned in the order of findTraceIDs, most recent first
+	var retMe []*model.Trace
+	for _, traceID := range traceIDs {
+		if trace, ok := traces[traceID]; ok {
+			retMe = append(retMe, trace)
+		}
+	}
+	return retMe, nil
+}
+
+// getTracesStatement builds the query loading the spans of all the given traces at once
+func getTracesStatement(traceIDs []model.TraceID) (string, []interface{}) {
+	var statement bytes.Buffer
+	statement.WriteString(`SELECT span FROM spans WHERE trace_id IN (`)
+	args := make([]interface{}, len(traceIDs))
+	for i, traceID := range traceIDs {
+		if i > 0 {
+			statement.WriteString(", ")
+		}
+		fmt.Fprintf(&statement, "$%d", i+1)
+		args[i] = traceID.String()
+	}
+	statement.WriteString(")")
+	return statement.String(), args
+}
+
+func (s *Store) findTraceIDs(query *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
+	statement, args := findTraceIDsStatement(query)
+	rows, err := s.db.Query(statement, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to find trace IDs")
+	}
+	defer rows.Close()
+	var traceIDs []model.TraceID
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, errors.Wrap(err, "Failed to find trace IDs")
+		}
+		traceID, err := model.TraceIDFromString(value)
+		if err != nil {
+			return nil, err
+		}
+		traceIDs = append(traceIDs, traceID)
+	}
+	return traceIDs, rows.Err()
+}
+
+// findTraceIDsStatement builds the query returning the IDs of the most recent traces with a span
+// matching all the query parameters. Tags are looked up in a way that uses the span_tags index.
+func findTraceIDsStatement(query *spanstore.TraceQueryParameters) (string, []interface{}) {
+	var statement bytes.Buffer
+	args := []interface{}{query.ServiceName}
+	statement.WriteString(`SELECT s.trace_id FROM spans s WHERE s.service_name = $1`)
+	condition := func(format string, values ...interface{}) {
+		placeholders := make([]interface{}, len(values))
+		for i, value := range values {
+			args = append(args, value)
+			placeholders[i] = len(args)
+		}
+		statement.WriteString(" AND ")
+		fmt.Fprintf(&statement, format, placeholders...)
+	}
+	if query.OperationName != "" {
+		condition(`s.operation_name = $%d`, query.OperationName)
+	}
+	if query.SpanKind == model.SpanKindUnspecified {
+		condition(`(s.span_kind = $%d OR s.span_kind IS NULL)`, string(query.SpanKind))
+	} else if query.SpanKind != "" {
+		condition(`s.span_kind = $%d`, string(query.SpanKind))
+	}
+	if !query.StartTimeMin.IsZero() {
+		condition(`s.start_time >= $%d`, query.StartTimeMin.UTC())
+	}
+	if !query.StartTimeMax.IsZero() {
+		condition(`s.start_time <= $%d`, query.StartTimeMax.UTC())
+	}
+	if query.DurationMin != 0 {
+		condition(`s.duration >= $%d`, int64(model.DurationAsMicroseconds(query.DurationMin)))
+	}
+	if query.DurationMax != 0 {
+		condition(`s.duration <= $%d`, int64(model.DurationAsMicroseconds(query.DurationMax)))
+	}
+	// sorted so that the same query always produces the same statement
+	keys := make([]string, 0, len(query.Tags))
+	for key := range query.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		condition(
+			`EXISTS (SELECT 1 FROM span_tags t WHERE t.span_row = s.id AND t.key = $%d AND t.value = $%d)`,
+			key, query.Tags[key],
+		)
+	}
+	numTraces := query.NumTraces
+	if numTraces <= 0 {
+		numTraces = defaultNumTraces
+	}
+	// FindTraces binds one parameter per trace ID to load their spans
+	if numTraces > maxBindParameters {
+		numTraces = maxBindParameters
+	}
+	args = append(args, numTraces)
+	fmt.Fprintf(&statement, ` GROUP BY s.trace_id ORDER BY MAX(s.start_time) DESC LIMIT $%d`, len(args))
+	return statement.String(), args
+}
+
+// GetDependencies counts the calls between services in the spans that started within the lookback
+func (s *Store) GetDependencies(endTs time.Time, lookback time.Duration) ([]model.DependencyLink, error) {
+	rows, err := s.db.Query(
+		`SELECT parent.service_name, child.service_name, COUNT(*)
+		FROM spans child JOIN spans parent ON child.trace_id = parent.trace_id AND child.parent_span_id = parent.span_id
+		WHERE child.start_time >= $1 AND child.start_time <= $2 AND parent.service_name <> child.service_name
+		GROUP BY parent.service_name, child.service_name`,
+		endTs.Add(-lookback).UTC(),
+		endTs.UTC(),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read dependencies")
+	}
+	defer rows.Close()
+	retMe := []model.DependencyLink{}
+	for rows.Next() {
+		var dep model.DependencyLink
+		if err := rows.Scan(&dep.Parent, &dep.Child, &dep.CallCount); err != nil {
+			return nil, errors.Wrap(err, "Failed to read dependencies")
+		}
+		retMe = append(retMe, dep)
+	}
+	return retMe, rows.Err()
+}
+
+func decodeSpan(value []byte) (*model.Span, error) {
+	var jsonSpan jModel.Span
+	if err := json.Unmarshal(value, &jsonSpan); err != nil {
+		return nil, errors.Wrap(err, "Failed to deserialize span")
+	}
+	return jConverter.SpanToDomain(&jsonSpan)
+}
@@ -0,0 +1,420 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	jConverter "github.com/uber/jaeger/model/converter/json"
+	"github.com/uber/jaeger/storage/dependencystore"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+var (
+	_ spanstore.Writer       = &Store{} // check API conformance
+	_ spanstore.Reader       = &Store{}
+	_ dependencystore.Reader = &Store{}
+)
+
+var testSpan = &model.Span{
+	TraceID:       model.TraceID{Low: 1, High: 2},
+	SpanID:        model.SpanID(3),
+	ParentSpanID:  model.SpanID(4),
+	OperationName: "GET /",
+	Process: &model.Process{
+		ServiceName: "frontend",
+		Tags:        model.KeyValues{model.String("hostname", "host-1")},
+	},
+	Tags: model.KeyValues{
+		model.String("http.method", "GET"),
+		model.Int64("http.status_code", 200),
+	},
+	StartTime: time.Unix(300, 0).UTC(),
+	Duration:  time.Second,
+}
+
+func withStore(t *testing.T, f func(store *Store, mock sqlmock.Sqlmock)) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	f(&Store{db: db, logger: zap.NewNop()}, mock)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func exactly(query string) string {
+	return regexp.QuoteMeta(query)
+}
+
+func expectSchemaVersion(mock sqlmock.Sqlmock, version int) {
+	mock.ExpectBegin()
+	mock.ExpectExec(exactly(`SELECT pg_advisory_xact_lock($1)`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(exactly(`CREATE TABLE IF NOT EXISTS jaeger_schema_version`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(exactly(`SELECT COALESCE(MAX(version), 0) FROM jaeger_schema_version`)).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(version))
+}
+
+func TestNewStoreCreatesSchema(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	expectSchemaVersion(mock, 0)
+	for i, statements := range migrations {
+		for _, statement := range statements {
+			mock.ExpectExec(exactly(statement)).WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		mock.ExpectExec(exactly(`INSERT INTO jaeger_schema_version (version) VALUES ($1)`)).
+			WithArgs(int64(i + 1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+
+	store, err := NewStore(db, zap.NewNop())
+	require.NoError(t, err)
+	assert.NotNil(t, store)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrateUpToDate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	expectSchemaVersion(mock, len(migrations))
+	mock.ExpectCommit()
+
+	assert.NoError(t, Migrate(db))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrateUnknownVersion(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	expectSchemaVersion(mock, len(migrations)+1)
+	mock.ExpectRollback()
+
+	err = Migrate(db)
+	assert.EqualError(t, err, "Schema version 4 is newer than the latest known version 3")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrateFromFirstVersion(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	expectSchemaVersion(mock, 1)
+	for i := 1; i < len(migrations); i++ {
+		for _, statement := range migrations[i] {
+			mock.ExpectExec(exactly(statement)).WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		mock.ExpectExec(exactly(`INSERT INTO jaeger_schema_version (version) VALUES ($1)`)).
+			WithArgs(int64(i + 1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+
+	assert.NoError(t, Migrate(db))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrateFailure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	expectSchemaVersion(mock, 0)
+	mock.ExpectExec(exactly(migrations[0][0])).WillReturnError(errors.New("permission denied"))
+	mock.ExpectRollback()
+
+	_, err = NewStore(db, zap.NewNop())
+	assert.EqualError(t, err, "Failed to migrate schema to version 1: permission denied")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWriteSpan(t *testing.T) {
+	withStore(t, func(store *Store, mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(exactly(`INSERT INTO spans`)).
+			WithArgs("20000000000000001", int64(3), int64(4), "frontend", "GET /", testSpan.StartTime, int64(1000000), "unspecified", sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+		mock.ExpectExec(exactly(`INSERT INTO span_tags (span_row, key, value) VALUES ($1, $2, $3), ($1, $4, $5), ($1, $6, $7)`)).
+			WithArgs(int64(42), "http.method", "GET", "http.status_code", "200", "hostname", "host-1").
+			WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec(exactly(`INSERT INTO operations (service_name, operation_name) VALUES ($1, $2) ON CONFLICT DO NOTHING`)).
+			WithArgs("frontend", "GET /").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		assert.NoError(t, store.WriteSpan(testSpan))
+	})
+}
+
+func TestWriteSpanDuplicate(t *testing.T) {
+	withStore(t, func(store *Store, mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(exactly(`INSERT INTO spans`)).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectRollback()
+
+		assert.NoError(t, store.WriteSpan(testSpan))
+	})
+}
+
+func TestWriteSpanManyTags(t *testing.T) {
+	span := *testSpan
+	span.Process = &model.Process{ServiceName: "frontend"}
+	span.Tags = make(model.KeyValues, maxTagsPerStatement+1)
+	for i := range span.Tags {
+		span.Tags[i] = model.String("key", "value")
+	}
+	withStore(t, func(store *Store, mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(exactly(`INSERT INTO spans`)).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+		mock.ExpectExec(exactly(`INSERT INTO span_tags (span_row, key, value) VALUES ($1, $2, $3), `)).
+			WillReturnResult(sqlmock.NewResult(0, maxTagsPerStatement))
+		mock.ExpectExec(exactly(`INSERT INTO span_tags (span_row, key, value) VALUES ($1, $2, $3)`)).
+			WithArgs(int64(42), "key", "value").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(exactly(`INSERT INTO operations`)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		assert.NoError(t, store.WriteSpan(&span))
+	})
+}
+
+func TestWriteSpanFailure(t *testing.T) {
+	withStore(t, func(store *Store, mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(exactly(`INSERT INTO spans`)).WillReturnError(errors.New("disk full"))
+		mock.ExpectRollback()
+
+		assert.EqualError(t, store.WriteSpan(testSpan), "Failed to write span: disk full")
+	})
+}
+
+func spanValue(t *testing.T, span *model.Span) driver.Value {
+	value, err := json.Marshal(jConverter.FromDomainEmbedProcess(span))
+	require.NoError(t, err)
+	return value
+}
+
+func TestGetTrace(t *testing.T) {
+	withStore(t, func(store *Store, mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(exactly(`SELECT span FROM spans WHERE trace_id = $1`)).
+			WithArgs("20000000000000001").
+			WillReturnRows(sqlmock.NewRows([]string{"span"}).AddRow(spanValue(t, testSpan)))
+
+		trace, err := store.GetTrace(testSpan.TraceID)
+		require.NoError(t, err)
+		require.Len(t, trace.Spans, 1)
+		assert.Equal(t, testSpan.TraceID, trace.Spans[0].TraceID)
+		assert.Equal(t, testSpan.OperationName, trace.Spans[0].OperationName)
+		assert.Equal(t, testSpan.Process.ServiceName, trace.Spans[0].Process.ServiceName)
+	})
+}
+
+func TestGetTraceNotFound(t *testing.T) {
+	withStore(t, func(store *Store, mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(exactly(`SELECT span FROM spans WHERE trace_id = $1`)).
+			WillReturnRows(sqlmock.NewRows([]string{"span"}))
+
+		_, err := store.GetTrace(testSpan.TraceID)
+		assert.Equal(t, spanstore.ErrTraceNotFound, err)
+	})
+}
+
+func TestGetTraceBadSpan(t *testing.T) {
+	withStore(t, func(store *Store, mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(exactly(`SELECT span FROM spans WHERE trace_id = $1`)).
+			WillReturnRows(sqlmock.NewRows([]string{"span"}).AddRow([]byte("{")))
+
+		_, err := store.GetTrace(testSpan.TraceID)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "Failed to deserialize span")
+	})
+}
+
+func TestGetServicesAndOperations(t *testing.T) {
+	withStore(t, func(store *Store, mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(exactly(`SELECT DISTINCT service_name FROM operations`)).
+			WillReturnRows(sqlmock.NewRows([]string{"service_name"}).AddRow("backend").AddRow("frontend"))
+		mock.ExpectQuery(exactly(`SELECT operation_name FROM operations WHERE service_name = $1`)).
+			WithArgs("frontend").
+			WillReturnRows(sqlmock.NewRows([]string{"operation_name"}).AddRow("GET /"))
+		mock.ExpectQuery(exactly(`SELECT operation_name FROM operations WHERE service_name = $1`)).
+			WithArgs("unknown").
+			WillReturnRows(sqlmock.NewRows([]string{"operation_name"}))
+
+		services, err := store.GetServices()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"backend", "frontend"}, services)
+		operations, err := store.GetOperations("frontend")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"GET /"}, operations)
+		operations, err = store.GetOperations("unknown")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{}, operations)
+	})
+}
+
+func TestFindTraceIDsStatement(t *testing.T) {
+	startTimeMin := time.Unix(100, 0)
+	startTimeMax := time.Unix(200, 0)
+	statement, args := findTraceIDsStatement(&spanstore.TraceQueryParameters{
+		ServiceName:   "frontend",
+		OperationName: "GET /",
+		StartTimeMin:  startTimeMin,
+		StartTimeMax:  startTimeMax,
+		DurationMin:   time.Millisecond,
+		Tags:          map[string]string{"http.status_code": "500", "error": "true"},
+		NumTraces:     20,
+	})
+	assert.Equal(t, `SELECT s.trace_id FROM spans s WHERE s.service_name = $1`+
+		` AND s.operation_name = $2`+
+		` AND s.start_time >= $3`+
+		` AND s.start_time <= $4`+
+		` AND s.duration >= $5`+
+		` AND EXISTS (SELECT 1 FROM span_tags t WHERE t.span_row = s.id AND t.key = $6 AND t.value = $7)`+
+		` AND EXISTS (SELECT 1 FROM span_tags t WHERE t.span_row = s.id AND t.key = $8 AND t.value = $9)`+
+		` GROUP BY s.trace_id ORDER BY MAX(s.start_time) DESC LIMIT $10`, statement)
+	assert.Equal(t, []interface{}{
+		"frontend", "GET /", startTimeMin.UTC(), startTimeMax.UTC(), int64(1000),
+		"error", "true", "http.status_code", "500", 20,
+	}, args)
+}
+
+func TestFindTraceIDsStatementSpanKind(t *testing.T) {
+	statement, args := findTraceIDsStatement(&spanstore.TraceQueryParameters{ServiceName: "frontend", SpanKind: model.SpanKindServer})
+	assert.Equal(t, `SELECT s.trace_id FROM spans s WHERE s.service_name = $1`+
+		` AND s.span_kind = $2`+
+		` GROUP BY s.trace_id ORDER BY MAX(s.start_time) DESC LIMIT $3`, statement)
+	assert.Equal(t, []interface{}{"frontend", "server", defaultNumTraces}, args)
+
+	statement, args = findTraceIDsStatement(&spanstore.TraceQueryParameters{ServiceName: "frontend", SpanKind: model.SpanKindUnspecified})
+	assert.Equal(t, `SELECT s.trace_id FROM spans s WHERE s.service_name = $1`+
+		` AND (s.span_kind = $2 OR s.span_kind IS NULL)`+
+		` GROUP BY s.trace_id ORDER BY MAX(s.start_time) DESC LIMIT $3`, statement)
+	assert.Equal(t, []interface{}{"frontend", "unspecified", defaultNumTraces}, args)
+}
+
+func TestFindTraceIDsStatementDefaultNumTraces(t *testing.T) {
+	statement, args := findTraceIDsStatement(&spanstore.TraceQueryParameters{ServiceName: "frontend"})
+	assert.Equal(t, `SELECT s.trace_id FROM spans s WHERE s.service_name = $1`+
+		` GROUP BY s.trace_id ORDER BY MAX(s.start_time) DESC LIMIT $2`, statement)
+	assert.Equal(t, []interface{}{"frontend", defaultNumTraces}, args)
+}
+
+func TestFindTraces(t *testing.T) {
+	withStore(t, func(store *Store, mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(exactly(`SELECT s.trace_id FROM spans s WHERE s.service_name = $1`)).
+			WithArgs("frontend", int64(defaultNumTraces)).
+			WillReturnRows(sqlmock.NewRows([]string{"trace_id"}).AddRow("20000000000000005").AddRow("20000000000000001"))
+		otherSpan := *testSpan
+		otherSpan.TraceID = model.TraceID{High: 2, Low: 5}
+		mock.ExpectQuery(exactly(`SELECT span FROM spans WHERE trace_id IN ($1, $2)`)).
+			WithArgs("20000000000000005", "20000000000000001").
+			WillReturnRows(sqlmock.NewRows([]string{"span"}).AddRow(spanValue(t, testSpan)).AddRow(spanValue(t, &otherSpan)))
+
+		traces, err := store.FindTraces(&spanstore.TraceQueryParameters{ServiceName: "frontend"})
+		require.NoError(t, err)
+		require.Len(t, traces, 2)
+		assert.Equal(t, otherSpan.TraceID, traces[0].Spans[0].TraceID)
+		assert.Equal(t, testSpan.TraceID, traces[1].Spans[0].TraceID)
+	})
+}
+
+func TestFindTracesNoTraces(t *testing.T) {
+	withStore(t, func(store *Store, mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(exactly(`SELECT s.trace_id FROM spans s WHERE s.service_name = $1`)).
+			WillReturnRows(sqlmock.NewRows([]string{"trace_id"}))
+
+		traces, err := store.FindTraces(&spanstore.TraceQueryParameters{ServiceName: "frontend"})
+		require.NoError(t, err)
+		assert.Empty(t, traces)
+	})
+}
+
+func TestFindTracesInvalidQuery(t *testing.T) {
+	testCases := []struct {
+		query *spanstore.TraceQueryParameters
+		err   error
+	}{
+		{nil, ErrMalformedRequestObject},
+		{&spanstore.TraceQueryParameters{}, ErrServiceNameNotSet},
+		{
+			&spanstore.TraceQueryParameters{
+				ServiceName:  "frontend",
+				StartTimeMin: time.Unix(200, 0),
+				StartTimeMax: time.Unix(100, 0),
+			},
+			ErrStartTimeMinGreaterThanMax,
+		},
+		{
+			&spanstore.TraceQueryParameters{
+				ServiceName: "frontend",
+				DurationMin: time.Second,
+				DurationMax: time.Millisecond,
+			},
+			ErrDurationMinGreaterThanMax,
+		},
+	}
+	for _, testCase := range testCases {
+		withStore(t, func(store *Store, mock sqlmock.Sqlmock) {
+			_, err := store.FindTraces(testCase.query)
+			assert.Equal(t, testCase.err, err)
+		})
+	}
+}
+
+func TestGetDependencies(t *testing.T) {
+	withStore(t, func(store *Store, mock sqlmock.Sqlmock) {
+		endTs := time.Unix(1000, 0)
+		mock.ExpectQuery(exactly(`SELECT parent.service_name, child.service_name, COUNT(*)`)).
+			WithArgs(endTs.Add(-time.Hour).UTC(), endTs.UTC()).
+			WillReturnRows(sqlmock.NewRows([]string{"parent", "child", "count"}).AddRow("frontend", "backend", 3))
+
+		links, err := store.GetDependencies(endTs, time.Hour)
+		assert.NoError(t, err)
+		assert.Equal(t, []model.DependencyLink{{Parent: "frontend", Child: "backend", CallCount: 3}}, links)
+	})
+}
+
+func TestClose(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	mock.ExpectClose()
+	store := &Store{db: db, logger: zap.NewNop()}
+	assert.NoError(t, store.Close())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dependencystore
+
+import (
+	"time"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/pkg/multierror"
+)
+
+// MergedReader is a dependency Reader that combines the dependencies loaded from several stores,
+// such as the shards of a sharded storage.
+type MergedReader struct {
+	readers []Reader
+}
+
+// NewMergedReader creates a MergedReader over the readers
+func NewMergedReader(readers ...Reader) *MergedReader {
+	return &MergedReader{readers: readers}
+}
+
+// GetDependencies loads the dependencies from all readers, summing the call counts of the same link
+func (r *MergedReader) GetDependencies(endTs time.Time, lookback time.Duration) ([]model.DependencyLink, error) {
+	var errors []error
+	var links []model.DependencyLink
+	indexes := make(map[[2]string]int)
+	for _, reader := range r.readers {
+		dependencies, err := reader.GetDependencies(endTs, lookback)
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		for _, link := range dependencies {
+			key := [2]string{link.Parent, link.Child}
+			if i, ok := indexes[key]; ok {
+				links[i].CallCount += link.CallCount
+				continue
+			}
+			indexes[key] = len(links)
+			links = append(links, link)
+		}
+	}
+	if len(errors) > 0 {
+		return nil, multierror.Wrap(errors)
+	}
+	return links, nil
+}
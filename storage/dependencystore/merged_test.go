@@ -0,0 +1,70 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dependencystore_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/jaeger/model"
+	. "github.com/uber/jaeger/storage/dependencystore"
+	"github.com/uber/jaeger/storage/dependencystore/mocks"
+)
+
+func TestMergedReaderGetDependencies(t *testing.T) {
+	endTs := time.Unix(0, 0)
+	first := &mocks.Reader{}
+	first.On("GetDependencies", endTs, time.Hour).Return([]model.DependencyLink{
+		{Parent: "frontend", Child: "backend", CallCount: 2},
+		{Parent: "backend", Child: "db", CallCount: 1},
+	}, nil)
+	second := &mocks.Reader{}
+	second.On("GetDependencies", endTs, time.Hour).Return([]model.DependencyLink{
+		{Parent: "frontend", Child: "backend", CallCount: 3},
+		{Parent: "frontend", Child: "cache", CallCount: 4},
+	}, nil)
+
+	links, err := NewMergedReader(first, second).GetDependencies(endTs, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, []model.DependencyLink{
+		{Parent: "frontend", Child: "backend", CallCount: 5},
+		{Parent: "backend", Child: "db", CallCount: 1},
+		{Parent: "frontend", Child: "cache", CallCount: 4},
+	}, links)
+}
+
+func TestMergedReaderGetDependenciesError(t *testing.T) {
+	endTs := time.Unix(0, 0)
+	first := &mocks.Reader{}
+	first.On("GetDependencies", endTs, time.Hour).Return([]model.DependencyLink{
+		{Parent: "frontend", Child: "backend", CallCount: 2},
+	}, nil)
+	second := &mocks.Reader{}
+	second.On("GetDependencies", endTs, time.Hour).Return(nil, errors.New("shard unavailable"))
+
+	links, err := NewMergedReader(first, second).GetDependencies(endTs, time.Hour)
+	assert.EqualError(t, err, "shard unavailable")
+	assert.Nil(t, links)
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package async provides a span Writer decoupling the latency of span ingestion from the latency of storage.
+package async
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+var (
+	// ErrBufferFull is returned by WriteSpan when the span is dropped because the buffer is full
+	ErrBufferFull = errors.New("The span buffer is full")
+
+	// ErrWriterClosed is returned by WriteSpan once the writer is closed
+	ErrWriterClosed = errors.New("The span writer is closed")
+)
+
+// Options configure the buffering of a Writer
+type Options struct {
+	// BufferSize is the number of spans waiting to be written before the buffer is full
+	BufferSize int
+	// NumWorkers is the number of goroutines writing spans concurrently
+	NumWorkers int
+	// BlockWhenFull makes WriteSpan wait for room in a full buffer instead of dropping the span
+	BlockWhenFull bool
+}
+
+type writerMetrics struct {
+	// QueueLength is the number of spans in the buffer
+	QueueLength metrics.Gauge `metric:"queue-length"`
+	// Dropped counts the spans dropped because the buffer was full
+	Dropped metrics.Counter `metric:"dropped-spans"`
+	// Failures counts the spans the underlying writer failed to write
+	Failures metrics.Counter `metric:"failed-writes"`
+}
+
+// Writer is a span Writer that returns before spans are written, buffering them for a pool
+// of workers writing them to the underlying writer. Since the caller does not wait for the
+// write, errors of the underlying writer are logged and counted instead of being returned.
+type Writer struct {
+	writer  spanstore.Writer
+	logger  *zap.Logger
+	metrics writerMetrics
+	block   bool
+	spans   chan *model.Span
+	length  int64 // accessed atomically
+
+	// closeLock is held for reading while sending to spans, so that it is not closed under a blocked send
+	closeLock sync.RWMutex
+	closed    bool
+	workers   sync.WaitGroup
+}
+
+// NewWriter creates a Writer and starts its workers
+func NewWriter(writer spanstore.Writer, options Options, logger *zap.Logger, metricsFactory metrics.Factory) *Writer {
+	if options.BufferSize < 1 {
+		options.BufferSize = 1
+	}
+	if options.NumWorkers < 1 {
+		options.NumWorkers = 1
+	}
+	w := &Writer{
+		writer: writer,
+		logger: logger,
+		block:  options.BlockWhenFull,
+		spans:  make(chan *model.Span, options.BufferSize),
+	}
+	metrics.Init(&w.metrics, metricsFactory.Namespace("async-writer", nil), nil)
+	w.workers.Add(options.NumWorkers)
+	for i := 0; i < options.NumWorkers; i++ {
+		go w.work()
+	}
+	return w
+}
+
+// WriteSpan buffers the span, dropping it if the buffer is full unless the writer blocks when full
+func (w *Writer) WriteSpan(span *model.Span) error {
+	w.closeLock.RLock()
+	defer w.closeLock.RUnlock()
+	if w.closed {
+		return ErrWriterClosed
+	}
+	// the length is incremented before sending so that the worker never makes it negative
+	w.metrics.QueueLength.Update(atomic.AddInt64(&w.length, 1))
+	if w.block {
+		w.spans <- span
+		return nil
+	}
+	select {
+	case w.spans <- span:
+		return nil
+	default:
+		w.metrics.QueueLength.Update(atomic.AddInt64(&w.length, -1))
+		w.metrics.Dropped.Inc(1)
+		return ErrBufferFull
+	}
+}
+
+func (w *Writer) work() {
+	defer w.workers.Done()
+	for span := range w.spans {
+		w.metrics.QueueLength.Update(atomic.AddInt64(&w.length, -1))
+		if err := w.writer.WriteSpan(span); err != nil && err != spanstore.ErrSpanBuffered {
+			w.metrics.Failures.Inc(1)
+			w.logger.Error("Failed to write buffered span", zap.Error(err))
+		}
+	}
+}
+
+// QueueLength returns the number of spans in the buffer
+func (w *Writer) QueueLength() int {
+	return int(atomic.LoadInt64(&w.length))
+}
+
+// Close stops accepting spans and waits for the buffered spans to be written
+func (w *Writer) Close() error {
+	w.closeLock.Lock()
+	if w.closed {
+		w.closeLock.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.spans)
+	w.closeLock.Unlock()
+	w.workers.Wait()
+	return nil
+}
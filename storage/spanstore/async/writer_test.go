@@ -0,0 +1,155 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package async
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/pkg/testutils"
+	"github.com/uber/jaeger/storage/spanstore"
+	"github.com/uber/jaeger/storage/spanstore/memory"
+)
+
+var _ spanstore.Writer = &Writer{} // check API conformance
+
+// blockingWriter holds every write until it is released
+type blockingWriter struct {
+	sync.Mutex
+	release chan struct{}
+	spans   []*model.Span
+	err     error
+}
+
+func newBlockingWriter() *blockingWriter {
+	return &blockingWriter{release: make(chan struct{})}
+}
+
+func (w *blockingWriter) WriteSpan(span *model.Span) error {
+	<-w.release
+	w.Lock()
+	defer w.Unlock()
+	w.spans = append(w.spans, span)
+	return w.err
+}
+
+func (w *blockingWriter) written() int {
+	w.Lock()
+	defer w.Unlock()
+	return len(w.spans)
+}
+
+func testSpan(id uint64) *model.Span {
+	return &model.Span{
+		TraceID: model.TraceID{Low: id},
+		SpanID:  model.SpanID(id),
+		Process: &model.Process{ServiceName: "service"},
+	}
+}
+
+func TestWriterWritesAllSpans(t *testing.T) {
+	store := memory.NewStore()
+	// large enough for all spans, which are written faster than the workers save them
+	w := NewWriter(store, Options{BufferSize: 100, NumWorkers: 4}, zap.NewNop(), metrics.NullFactory)
+	for i := uint64(1); i <= 100; i++ {
+		require.NoError(t, w.WriteSpan(testSpan(i)))
+	}
+	require.NoError(t, w.Close())
+	assert.Equal(t, 0, w.QueueLength())
+	for i := uint64(1); i <= 100; i++ {
+		_, err := store.GetTrace(model.TraceID{Low: i})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, ErrWriterClosed, w.WriteSpan(testSpan(1)))
+	assert.NoError(t, w.Close())
+}
+
+func TestWriterDropsWhenFull(t *testing.T) {
+	underlying := newBlockingWriter()
+	metricsFactory := metrics.NewLocalFactory(0)
+	w := NewWriter(underlying, Options{BufferSize: 2, NumWorkers: 1}, zap.NewNop(), metricsFactory)
+
+	// the worker holds the first span, the next two fill the buffer
+	require.NoError(t, w.WriteSpan(testSpan(1)))
+	for i := 0; i < 100 && w.QueueLength() > 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	require.NoError(t, w.WriteSpan(testSpan(2)))
+	require.NoError(t, w.WriteSpan(testSpan(3)))
+	assert.Equal(t, ErrBufferFull, w.WriteSpan(testSpan(4)))
+	assert.Equal(t, 2, w.QueueLength())
+
+	counters, gauges := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counters["async-writer.dropped-spans"])
+	assert.EqualValues(t, 2, gauges["async-writer.queue-length"])
+
+	close(underlying.release)
+	require.NoError(t, w.Close())
+	assert.Equal(t, 3, underlying.written())
+	_, gauges = metricsFactory.Snapshot()
+	assert.EqualValues(t, 0, gauges["async-writer.queue-length"])
+}
+
+func TestWriterBlocksWhenFull(t *testing.T) {
+	underlying := newBlockingWriter()
+	w := NewWriter(underlying, Options{BufferSize: 1, NumWorkers: 1, BlockWhenFull: true}, zap.NewNop(), metrics.NullFactory)
+
+	written := make(chan struct{})
+	go func() {
+		for i := uint64(1); i <= 3; i++ {
+			w.WriteSpan(testSpan(i))
+		}
+		close(written)
+	}()
+	select {
+	case <-written:
+		t.Fatal("WriteSpan must block while the buffer is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(underlying.release)
+	<-written
+	require.NoError(t, w.Close())
+	assert.Equal(t, 3, underlying.written())
+}
+
+func TestWriterLogsFailures(t *testing.T) {
+	underlying := newBlockingWriter()
+	underlying.err = errors.New("storage unavailable")
+	close(underlying.release)
+	logger, logBuffer := testutils.NewLogger()
+	metricsFactory := metrics.NewLocalFactory(0)
+	w := NewWriter(underlying, Options{}, logger, metricsFactory)
+
+	require.NoError(t, w.WriteSpan(testSpan(1)))
+	require.NoError(t, w.Close())
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counters["async-writer.failed-writes"])
+	assert.Contains(t, logBuffer.String(), "storage unavailable")
+}
@@ -0,0 +1,319 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package batch provides a span Writer grouping the spans of each trace, so that they are written together.
+package batch
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+const (
+	// DefaultWindow is the default time the spans of a trace are held for its other spans
+	DefaultWindow = time.Second
+
+	// DefaultMaxPendingSpans is the default number of spans held for their trace
+	DefaultMaxPendingSpans = 10000
+
+	// DefaultFlushers is the default number of batches written at the same time
+	DefaultFlushers = 4
+
+	// flushedTracesRetention is the number of windows the traces of written batches are remembered for,
+	// so that their late spans are written right away instead of being held for a batch of their own
+	flushedTracesRetention = 10
+)
+
+// ErrWriterClosed is returned by WriteSpan once the writer is closed
+var ErrWriterClosed = errors.New("The span writer is closed")
+
+// Options configure the batching of a Writer
+type Options struct {
+	// Window is the time the spans of a trace are held from its first span, DefaultWindow if 0
+	Window time.Duration
+	// MaxBatchSize is the number of spans of a trace written before the end of the window, unbounded if 0
+	MaxBatchSize int
+	// MaxPendingSpans is the number of spans held for their trace, DefaultMaxPendingSpans if 0. Beyond it,
+	// the caller writes the batch of its span itself.
+	MaxPendingSpans int
+	// Flushers is the number of batches written at the same time at the end of their window, DefaultFlushers if 0
+	Flushers int
+	// Sampler decides whether the spans of each batch are written, they all are if nil
+	Sampler Sampler
+	// Namespace is the namespace of the metrics of the Writer, "trace-batching" if empty
+	Namespace string
+}
+
+// Sampler decides whether the spans of the batches are written, e.g. from the spans received for their trace
+type Sampler interface {
+	// SampleBatch returns whether the spans of a trace are written once its batch is removed, and the decision
+	// on the trace, which is passed on to SampleLateSpan for the spans of the trace arriving later
+	SampleBatch(spans []*model.Span) (decision int, write bool)
+	// SampleLateSpan returns whether a span arriving once the decision on its trace was taken is written
+	SampleLateSpan(span *model.Span, decision int) bool
+}
+
+type writerMetrics struct {
+	// PartitionWrites counts the batches and the late spans written, the span storage writes the
+	// spans of a trace to the same partition. With Spans, it measures how many spans are written together.
+	PartitionWrites metrics.Counter `metric:"partition-writes"`
+	// Spans counts the spans the underlying writer wrote
+	Spans metrics.Counter `metric:"spans"`
+	// LateSpans counts the spans written individually because the batch of their trace was already written
+	LateSpans metrics.Counter `metric:"late-spans"`
+	// OverflowSpans counts the spans whose batch was written by the caller because too many spans were held
+	OverflowSpans metrics.Counter `metric:"overflow-spans"`
+	// Failures counts the spans the underlying writer failed to write
+	Failures metrics.Counter `metric:"failed-writes"`
+	// PendingSpans is the number of spans held for their trace
+	PendingSpans metrics.Gauge `metric:"pending-spans"`
+}
+
+type pendingBatch struct {
+	spans    []*model.Span
+	deadline time.Time
+	// write is set by the Sampler once the batch is removed
+	write bool
+}
+
+type flushedTrace struct {
+	decision int
+	until    time.Time
+}
+
+// Writer is a span Writer holding the spans of each trace for a window, to write them together to the
+// underlying writer, which improves the locality of the writes to storages partitioned by trace ID such as
+// Cassandra. The spans arriving once the batch of their trace is written are written individually. With a
+// Sampler, only the batches and the late spans it accepts are written.
+// WriteSpan returns nil for a held span before it is written: the errors of the batches written at the end
+// of their window are logged and counted, while the errors of the batches written by WriteSpan, once they
+// reach MaxBatchSize or when MaxPendingSpans are held, are returned.
+type Writer struct {
+	writer  spanstore.Writer
+	options Options
+	logger  *zap.Logger
+	metrics writerMetrics
+
+	sync.Mutex
+	pending      map[model.TraceID]*pendingBatch
+	pendingSpans int
+	// flushed holds the decisions on the traces of the written batches, and until when they are remembered
+	flushed map[model.TraceID]flushedTrace
+	closed  bool
+
+	done    chan struct{}
+	flusher sync.WaitGroup
+}
+
+// NewWriter creates a Writer and starts writing the batches at the end of their window
+func NewWriter(writer spanstore.Writer, options Options, logger *zap.Logger, metricsFactory metrics.Factory) *Writer {
+	if options.Window <= 0 {
+		options.Window = DefaultWindow
+	}
+	if options.MaxPendingSpans <= 0 {
+		options.MaxPendingSpans = DefaultMaxPendingSpans
+	}
+	if options.Flushers <= 0 {
+		options.Flushers = DefaultFlushers
+	}
+	if options.Namespace == "" {
+		options.Namespace = "trace-batching"
+	}
+	w := &Writer{
+		writer:  writer,
+		options: options,
+		logger:  logger,
+		pending: make(map[model.TraceID]*pendingBatch),
+		flushed: make(map[model.TraceID]flushedTrace),
+		done:    make(chan struct{}),
+	}
+	metrics.Init(&w.metrics, metricsFactory.Namespace(options.Namespace, nil), nil)
+	w.flusher.Add(1)
+	go w.flushExpired()
+	return w
+}
+
+// WriteSpan holds the span for the batch of its trace, or writes it right away if the batch was already written
+func (w *Writer) WriteSpan(span *model.Span) error {
+	w.Lock()
+	if w.closed {
+		w.Unlock()
+		return ErrWriterClosed
+	}
+	if trace, ok := w.flushed[span.TraceID]; ok {
+		w.Unlock()
+		if w.options.Sampler != nil && !w.options.Sampler.SampleLateSpan(span, trace.decision) {
+			return nil
+		}
+		w.metrics.LateSpans.Inc(1)
+		return w.write([]*model.Span{span})
+	}
+	batch, ok := w.pending[span.TraceID]
+	if !ok {
+		batch = &pendingBatch{deadline: time.Now().Add(w.options.Window)}
+		w.pending[span.TraceID] = batch
+	}
+	batch.spans = append(batch.spans, span)
+	w.pendingSpans++
+	full := w.options.MaxBatchSize > 0 && len(batch.spans) >= w.options.MaxBatchSize
+	if !full && w.pendingSpans <= w.options.MaxPendingSpans {
+		w.metrics.PendingSpans.Update(int64(w.pendingSpans))
+		w.Unlock()
+		return nil
+	}
+	if !full {
+		w.metrics.OverflowSpans.Inc(int64(len(batch.spans)))
+	}
+	w.removeBatch(span.TraceID, batch, time.Now())
+	w.Unlock()
+	if !batch.write {
+		return nil
+	}
+	return w.write(batch.spans)
+}
+
+// removeBatch removes the batch of the trace from the pending ones and decides whether it is written,
+// holding the lock
+func (w *Writer) removeBatch(traceID model.TraceID, batch *pendingBatch, now time.Time) {
+	delete(w.pending, traceID)
+	w.pendingSpans -= len(batch.spans)
+	w.metrics.PendingSpans.Update(int64(w.pendingSpans))
+	trace := flushedTrace{until: now.Add(flushedTracesRetention * w.options.Window)}
+	batch.write = true
+	if w.options.Sampler != nil {
+		trace.decision, batch.write = w.options.Sampler.SampleBatch(batch.spans)
+	}
+	w.flushed[traceID] = trace
+}
+
+func (w *Writer) flushExpired() {
+	defer w.flusher.Done()
+	interval := w.options.Window / 2
+	if interval <= 0 {
+		interval = w.options.Window
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			w.writeBatches(w.expiredBatches(now))
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// expiredBatches removes and returns the batches whose window ended, and forgets the old written traces
+func (w *Writer) expiredBatches(now time.Time) []*pendingBatch {
+	w.Lock()
+	defer w.Unlock()
+	for traceID, trace := range w.flushed {
+		if now.After(trace.until) {
+			delete(w.flushed, traceID)
+		}
+	}
+	var expired []*pendingBatch
+	for traceID, batch := range w.pending {
+		if !now.Before(batch.deadline) {
+			w.removeBatch(traceID, batch, now)
+			expired = append(expired, batch)
+		}
+	}
+	return expired
+}
+
+// writeBatches writes the batches of different traces in parallel with up to Flushers goroutines,
+// returning once all of them are written
+func (w *Writer) writeBatches(batches []*pendingBatch) {
+	queue := make(chan *pendingBatch, len(batches))
+	for _, batch := range batches {
+		if batch.write {
+			queue <- batch
+		}
+	}
+	close(queue)
+	flushers := w.options.Flushers
+	if flushers > len(queue) {
+		flushers = len(queue)
+	}
+	var wg sync.WaitGroup
+	wg.Add(flushers)
+	for i := 0; i < flushers; i++ {
+		go func() {
+			defer wg.Done()
+			for batch := range queue {
+				w.write(batch.spans)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// write writes the spans of a trace one after the other, returning the last error
+func (w *Writer) write(spans []*model.Span) error {
+	w.metrics.PartitionWrites.Inc(1)
+	var lastErr error
+	var written int64
+	for _, span := range spans {
+		if err := w.writer.WriteSpan(span); err != nil {
+			if err != spanstore.ErrSpanBuffered {
+				w.metrics.Failures.Inc(1)
+				w.logger.Error("Failed to write batched span", zap.Error(err))
+			}
+			lastErr = err
+			continue
+		}
+		written++
+	}
+	w.metrics.Spans.Inc(written)
+	return lastErr
+}
+
+// Close stops accepting spans and writes the pending batches
+func (w *Writer) Close() error {
+	w.Lock()
+	if w.closed {
+		w.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.Unlock()
+	close(w.done)
+	w.flusher.Wait()
+
+	w.Lock()
+	now := time.Now()
+	batches := make([]*pendingBatch, 0, len(w.pending))
+	for traceID, batch := range w.pending {
+		w.removeBatch(traceID, batch, now)
+		batches = append(batches, batch)
+	}
+	w.Unlock()
+	w.writeBatches(batches)
+	return nil
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package batch
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+var _ spanstore.Writer = &Writer{} // check API conformance
+
+// recordingWriter records the order of the written spans
+type recordingWriter struct {
+	sync.Mutex
+	spans []*model.Span
+	err   error
+}
+
+func (w *recordingWriter) WriteSpan(span *model.Span) error {
+	w.Lock()
+	defer w.Unlock()
+	w.spans = append(w.spans, span)
+	return w.err
+}
+
+func (w *recordingWriter) traceIDs() []uint64 {
+	w.Lock()
+	defer w.Unlock()
+	ids := make([]uint64, len(w.spans))
+	for i, span := range w.spans {
+		ids[i] = span.TraceID.Low
+	}
+	return ids
+}
+
+func testSpan(traceID, spanID uint64) *model.Span {
+	return &model.Span{
+		TraceID: model.TraceID{Low: traceID},
+		SpanID:  model.SpanID(spanID),
+		Process: &model.Process{ServiceName: "service"},
+	}
+}
+
+func TestWriterGroupsSpansByTrace(t *testing.T) {
+	store := &recordingWriter{}
+	metricsFactory := metrics.NewLocalFactory(0)
+	w := NewWriter(store, Options{Window: time.Hour}, zap.NewNop(), metricsFactory)
+	for i := uint64(1); i <= 3; i++ {
+		require.NoError(t, w.WriteSpan(testSpan(1, i)))
+		require.NoError(t, w.WriteSpan(testSpan(2, i)))
+	}
+	assert.Empty(t, store.traceIDs(), "the spans are held until the end of the window")
+	_, gauges := metricsFactory.Snapshot()
+	assert.EqualValues(t, 6, gauges["trace-batching.pending-spans"])
+
+	require.NoError(t, w.Close())
+	ids := store.traceIDs()
+	require.Len(t, ids, 6)
+	assert.Equal(t, ids[0], ids[1])
+	assert.Equal(t, ids[0], ids[2])
+	assert.Equal(t, ids[3], ids[4])
+	assert.Equal(t, ids[3], ids[5])
+	assert.Equal(t, ErrWriterClosed, w.WriteSpan(testSpan(3, 1)))
+	assert.NoError(t, w.Close())
+
+	counters, gauges := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counters["trace-batching.partition-writes"])
+	assert.EqualValues(t, 6, counters["trace-batching.spans"])
+	assert.EqualValues(t, 0, gauges["trace-batching.pending-spans"])
+}
+
+func TestWriterFlushesAtEndOfWindow(t *testing.T) {
+	store := &recordingWriter{}
+	metricsFactory := metrics.NewLocalFactory(0)
+	w := NewWriter(store, Options{Window: 10 * time.Millisecond}, zap.NewNop(), metricsFactory)
+	defer w.Close()
+	require.NoError(t, w.WriteSpan(testSpan(1, 1)))
+	require.NoError(t, w.WriteSpan(testSpan(1, 2)))
+	for i := 0; i < 100 && len(store.traceIDs()) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, []uint64{1, 1}, store.traceIDs())
+
+	require.NoError(t, w.WriteSpan(testSpan(1, 3)))
+	assert.Equal(t, []uint64{1, 1, 1}, store.traceIDs(), "the late span is written right away")
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counters["trace-batching.late-spans"])
+	assert.EqualValues(t, 2, counters["trace-batching.partition-writes"])
+	assert.EqualValues(t, 3, counters["trace-batching.spans"])
+}
+
+func TestWriterMaxBatchSize(t *testing.T) {
+	store := &recordingWriter{}
+	w := NewWriter(store, Options{Window: time.Hour, MaxBatchSize: 2}, zap.NewNop(), metrics.NullFactory)
+	defer w.Close()
+	require.NoError(t, w.WriteSpan(testSpan(1, 1)))
+	assert.Empty(t, store.traceIDs())
+	require.NoError(t, w.WriteSpan(testSpan(1, 2)))
+	assert.Equal(t, []uint64{1, 1}, store.traceIDs())
+	require.NoError(t, w.WriteSpan(testSpan(1, 3)))
+	assert.Equal(t, []uint64{1, 1, 1}, store.traceIDs())
+}
+
+func TestWriterFailures(t *testing.T) {
+	store := &recordingWriter{err: errors.New("storage error")}
+	metricsFactory := metrics.NewLocalFactory(0)
+	w := NewWriter(store, Options{Window: time.Hour, MaxBatchSize: 2}, zap.NewNop(), metricsFactory)
+	assert.NoError(t, w.WriteSpan(testSpan(1, 1)))
+	assert.EqualError(t, w.WriteSpan(testSpan(1, 2)), "storage error", "the errors of full batches are returned")
+	assert.EqualError(t, w.WriteSpan(testSpan(1, 3)), "storage error")
+	require.NoError(t, w.WriteSpan(testSpan(2, 1)), "the errors of batches written at the end of the window are not returned")
+	require.NoError(t, w.Close())
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 4, counters["trace-batching.failed-writes"])
+	assert.EqualValues(t, 0, counters["trace-batching.spans"], "only the written spans are counted")
+}
+
+func TestWriterMaxPendingSpans(t *testing.T) {
+	store := &recordingWriter{}
+	metricsFactory := metrics.NewLocalFactory(0)
+	w := NewWriter(store, Options{Window: time.Hour, MaxPendingSpans: 2}, zap.NewNop(), metricsFactory)
+	defer w.Close()
+	require.NoError(t, w.WriteSpan(testSpan(1, 1)))
+	require.NoError(t, w.WriteSpan(testSpan(2, 1)))
+	assert.Empty(t, store.traceIDs())
+	require.NoError(t, w.WriteSpan(testSpan(1, 2)))
+	assert.Equal(t, []uint64{1, 1}, store.traceIDs(), "the caller writes its batch once too many spans are held")
+	counters, gauges := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counters["trace-batching.overflow-spans"])
+	assert.EqualValues(t, 1, gauges["trace-batching.pending-spans"])
+}
+
+// blockingWriter signals the start of each write and blocks it until released
+type blockingWriter struct {
+	recordingWriter
+	started chan struct{}
+	release chan struct{}
+}
+
+func (w *blockingWriter) WriteSpan(span *model.Span) error {
+	w.started <- struct{}{}
+	<-w.release
+	return w.recordingWriter.WriteSpan(span)
+}
+
+func TestWriterFlushesInParallel(t *testing.T) {
+	store := &blockingWriter{started: make(chan struct{}, 3), release: make(chan struct{})}
+	w := NewWriter(store, Options{Window: time.Hour, Flushers: 2}, zap.NewNop(), metrics.NullFactory)
+	for i := uint64(1); i <= 3; i++ {
+		require.NoError(t, w.WriteSpan(testSpan(i, 1)))
+	}
+	done := make(chan struct{})
+	go func() {
+		w.writeBatches(w.expiredBatches(time.Now().Add(time.Hour)))
+		close(done)
+	}()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-store.started:
+		case <-time.After(time.Second):
+			t.Fatal("the batches are not written in parallel")
+		}
+	}
+	select {
+	case <-store.started:
+		t.Fatal("more batches are written than flushers")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(store.release)
+	<-done
+	assert.Len(t, store.traceIDs(), 3)
+	require.NoError(t, w.Close())
+}
+
+func TestWriterForgetsFlushedTraces(t *testing.T) {
+	w := NewWriter(&recordingWriter{}, Options{Window: time.Hour, MaxBatchSize: 1}, zap.NewNop(), metrics.NullFactory)
+	defer w.Close()
+	require.NoError(t, w.WriteSpan(testSpan(1, 1)))
+	assert.Empty(t, w.expiredBatches(time.Now()))
+	assert.Len(t, w.flushed, 1)
+	w.expiredBatches(time.Now().Add(flushedTracesRetention*time.Hour + time.Second))
+	assert.Empty(t, w.flushed)
+}
+
+// oddTraceSampler writes the traces with an odd ID, and the late spans with an odd span ID
+type oddTraceSampler struct{}
+
+func (oddTraceSampler) SampleBatch(spans []*model.Span) (int, bool) {
+	if spans[0].TraceID.Low%2 == 1 {
+		return 1, true
+	}
+	return 0, false
+}
+
+func (oddTraceSampler) SampleLateSpan(span *model.Span, decision int) bool {
+	return decision > 0 && span.SpanID%2 == 1
+}
+
+func TestWriterSampler(t *testing.T) {
+	store := &recordingWriter{}
+	metricsFactory := metrics.NewLocalFactory(0)
+	w := NewWriter(store, Options{Window: time.Hour, MaxBatchSize: 2, Sampler: oddTraceSampler{}, Namespace: "sampled"}, zap.NewNop(), metricsFactory)
+	defer w.Close()
+	for _, traceID := range []uint64{1, 2} {
+		require.NoError(t, w.WriteSpan(testSpan(traceID, 1)))
+		require.NoError(t, w.WriteSpan(testSpan(traceID, 2)))
+	}
+	assert.Equal(t, []uint64{1, 1}, store.traceIDs())
+	require.NoError(t, w.WriteSpan(testSpan(1, 3)))
+	require.NoError(t, w.WriteSpan(testSpan(1, 4)))
+	require.NoError(t, w.WriteSpan(testSpan(2, 5)))
+	assert.Equal(t, []uint64{1, 1, 1}, store.traceIDs())
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 3, counters["sampled.spans"])
+	assert.EqualValues(t, 1, counters["sampled.late-spans"])
+}
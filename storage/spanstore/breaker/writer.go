@@ -0,0 +1,287 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package breaker provides a span Writer failing fast while the storage is failing or slow.
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+// ErrCircuitOpen is returned by WriteSpan when the span is rejected because the circuit is open
+var ErrCircuitOpen = errors.New("The storage circuit breaker is open")
+
+// State is the state of the circuit of a Writer, reported by the circuit-breaker.state gauge
+type State int64
+
+const (
+	// Closed lets the spans through to the storage
+	Closed State = iota
+	// Open rejects the spans, or keeps them in the fallback buffer, without writing them
+	Open
+	// HalfOpen lets a single span through to probe the storage, rejecting the others until it is written
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	default:
+		return "half-open"
+	}
+}
+
+// Options configure when a Writer opens its circuit
+type Options struct {
+	// FailureThreshold is the number of consecutive failed writes opening the circuit
+	FailureThreshold int
+	// LatencyThreshold makes the writes taking longer count as failed, even when they succeed, if positive
+	LatencyThreshold time.Duration
+	// OpenPeriod is the time the circuit stays open before a span is let through to probe the storage
+	OpenPeriod time.Duration
+	// FallbackSize is the number of spans kept while the circuit is open and written once it closes,
+	// the spans being rejected instead when it is zero
+	FallbackSize int
+}
+
+type writerMetrics struct {
+	// State is the current State of the circuit
+	State metrics.Gauge `metric:"state"`
+	// Opened counts the times the circuit opened
+	Opened metrics.Counter `metric:"opened"`
+	// Rejected counts the spans rejected while the circuit was open
+	Rejected metrics.Counter `metric:"rejected-spans"`
+	// Buffered counts the spans kept in the fallback buffer while the circuit was open
+	Buffered metrics.Counter `metric:"buffered-spans"`
+	// FallbackLength is the number of spans in the fallback buffer
+	FallbackLength metrics.Gauge `metric:"fallback-length"`
+	// Written counts the buffered spans written once the circuit closed, or on Close
+	Written metrics.Counter `metric:"written-buffered-spans"`
+	// Failures counts the buffered spans the underlying writer failed to write
+	Failures metrics.Counter `metric:"failed-writes"`
+}
+
+// Writer is a span Writer that stops writing to the underlying writer after it failed, or was slow,
+// for a number of consecutive spans. The circuit is then open: spans are rejected with ErrCircuitOpen,
+// or kept in a bounded fallback buffer with spanstore.ErrSpanBuffered returned, until the open period
+// elapsed and a probe span is written successfully, closing the circuit again. The buffered spans are
+// then written in the background, and those left are written on Close.
+type Writer struct {
+	writer  spanstore.Writer
+	options Options
+	logger  *zap.Logger
+	metrics writerMetrics
+	timeNow func() time.Time
+
+	lock     sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	fallback []*model.Span
+	draining bool
+	closed   bool
+	drainers sync.WaitGroup
+}
+
+// NewWriter creates a Writer with a closed circuit
+func NewWriter(writer spanstore.Writer, options Options, logger *zap.Logger, metricsFactory metrics.Factory) *Writer {
+	if options.FailureThreshold < 1 {
+		options.FailureThreshold = 1
+	}
+	w := &Writer{
+		writer:  writer,
+		options: options,
+		logger:  logger,
+		timeNow: time.Now,
+	}
+	metrics.Init(&w.metrics, metricsFactory.Namespace("circuit-breaker", nil), nil)
+	w.metrics.State.Update(int64(Closed))
+	return w
+}
+
+// WriteSpan writes the span to the underlying writer unless the circuit is open
+func (w *Writer) WriteSpan(span *model.Span) error {
+	if !w.allow() {
+		return w.divert(span)
+	}
+	return w.write(span)
+}
+
+// State returns the current state of the circuit
+func (w *Writer) State() State {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.state
+}
+
+// write writes the span to the underlying writer and records the outcome
+func (w *Writer) write(span *model.Span) error {
+	start := w.timeNow()
+	err := w.writer.WriteSpan(span)
+	slow := w.options.LatencyThreshold > 0 && w.timeNow().Sub(start) > w.options.LatencyThreshold
+	w.record(err == nil && !slow)
+	return err
+}
+
+// allow returns whether the span can be written, turning an open circuit half-open once the open period elapsed
+func (w *Writer) allow() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	switch w.state {
+	case Closed:
+		return true
+	case Open:
+		if w.timeNow().Sub(w.openedAt) >= w.options.OpenPeriod {
+			w.setState(HalfOpen)
+			return true
+		}
+	}
+	return false
+}
+
+// record updates the circuit after a write
+func (w *Writer) record(ok bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if ok {
+		w.failures = 0
+		if w.state == HalfOpen {
+			w.setState(Closed)
+			w.logger.Info("Closed the storage circuit breaker", zap.Int("buffered_spans", len(w.fallback)))
+			w.startDraining()
+		}
+		return
+	}
+	w.failures++
+	// the writes started before the circuit opened do not extend the open period
+	if w.state == HalfOpen || (w.state == Closed && w.failures >= w.options.FailureThreshold) {
+		w.openedAt = w.timeNow()
+		w.setState(Open)
+		w.metrics.Opened.Inc(1)
+		w.logger.Warn("Opened the storage circuit breaker",
+			zap.Int("consecutive_failures", w.failures),
+			zap.Duration("open_period", w.options.OpenPeriod))
+	}
+}
+
+// setState must be called with the lock held
+func (w *Writer) setState(state State) {
+	w.state = state
+	w.metrics.State.Update(int64(state))
+}
+
+// divert keeps the span in the fallback buffer, returning spanstore.ErrSpanBuffered, or rejects it when
+// the buffer is full or disabled
+func (w *Writer) divert(span *model.Span) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if len(w.fallback) >= w.options.FallbackSize || w.closed {
+		w.metrics.Rejected.Inc(1)
+		return ErrCircuitOpen
+	}
+	w.fallback = append(w.fallback, span)
+	w.metrics.Buffered.Inc(1)
+	w.metrics.FallbackLength.Update(int64(len(w.fallback)))
+	return spanstore.ErrSpanBuffered
+}
+
+// startDraining must be called with the lock held
+func (w *Writer) startDraining() {
+	if w.draining || w.closed || len(w.fallback) == 0 {
+		return
+	}
+	w.draining = true
+	w.drainers.Add(1)
+	go w.drain()
+}
+
+// drain writes the buffered spans while the circuit is closed
+func (w *Writer) drain() {
+	defer w.drainers.Done()
+	for {
+		span := w.nextBuffered()
+		if span == nil {
+			return
+		}
+		if err := w.write(span); err != nil {
+			w.metrics.Failures.Inc(1)
+			w.logger.Error("Failed to write buffered span", zap.Error(err))
+		} else {
+			w.metrics.Written.Inc(1)
+		}
+	}
+}
+
+// nextBuffered pops the oldest buffered span, returning nil when draining must stop
+func (w *Writer) nextBuffered() *model.Span {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.state != Closed || w.closed || len(w.fallback) == 0 {
+		w.draining = false
+		return nil
+	}
+	span := w.fallback[0]
+	w.fallback[0] = nil
+	w.fallback = w.fallback[1:]
+	w.metrics.FallbackLength.Update(int64(len(w.fallback)))
+	return span
+}
+
+// Close stops buffering spans and writes the spans left in the fallback buffer, whatever the state of the
+// circuit, returning an error if some of them could not be written
+func (w *Writer) Close() error {
+	w.lock.Lock()
+	w.closed = true
+	w.lock.Unlock()
+	w.drainers.Wait()
+
+	w.lock.Lock()
+	spans := w.fallback
+	w.fallback = nil
+	w.metrics.FallbackLength.Update(0)
+	w.lock.Unlock()
+	var failed int
+	var lastErr error
+	for _, span := range spans {
+		if err := w.writer.WriteSpan(span); err != nil {
+			failed++
+			lastErr = err
+		} else {
+			w.metrics.Written.Inc(1)
+		}
+	}
+	if failed > 0 {
+		w.metrics.Failures.Inc(int64(failed))
+		return fmt.Errorf("Failed to write %d buffered spans of the storage circuit breaker: %v", failed, lastErr)
+	}
+	return nil
+}
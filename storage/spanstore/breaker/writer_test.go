@@ -0,0 +1,244 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+var _ spanstore.Writer = &Writer{} // check API conformance
+
+// testWriter fails with err, and advances the clock of the breaker by delay, on every write
+type testWriter struct {
+	sync.Mutex
+	err   error
+	delay time.Duration
+	now   time.Time
+	spans []*model.Span
+}
+
+func (w *testWriter) WriteSpan(span *model.Span) error {
+	w.Lock()
+	defer w.Unlock()
+	w.now = w.now.Add(w.delay)
+	if w.err != nil {
+		return w.err
+	}
+	w.spans = append(w.spans, span)
+	return nil
+}
+
+func (w *testWriter) timeNow() time.Time {
+	w.Lock()
+	defer w.Unlock()
+	return w.now
+}
+
+func (w *testWriter) advance(d time.Duration) {
+	w.Lock()
+	defer w.Unlock()
+	w.now = w.now.Add(d)
+}
+
+func (w *testWriter) set(err error, delay time.Duration) {
+	w.Lock()
+	defer w.Unlock()
+	w.err = err
+	w.delay = delay
+}
+
+func (w *testWriter) written() int {
+	w.Lock()
+	defer w.Unlock()
+	return len(w.spans)
+}
+
+func newTestWriter(options Options, metricsFactory metrics.Factory) (*Writer, *testWriter) {
+	underlying := &testWriter{now: time.Unix(1000, 0)}
+	w := NewWriter(underlying, options, zap.NewNop(), metricsFactory)
+	w.timeNow = underlying.timeNow
+	return w, underlying
+}
+
+func testSpan(id uint64) *model.Span {
+	return &model.Span{
+		TraceID: model.TraceID{Low: id},
+		SpanID:  model.SpanID(id),
+		Process: &model.Process{ServiceName: "service"},
+	}
+}
+
+func TestWriterOpensAfterFailures(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	w, underlying := newTestWriter(Options{FailureThreshold: 2, OpenPeriod: time.Minute}, metricsFactory)
+	storageErr := errors.New("timeout")
+	underlying.set(storageErr, 0)
+
+	assert.Equal(t, storageErr, w.WriteSpan(testSpan(1)))
+	assert.Equal(t, Closed, w.State())
+	assert.Equal(t, storageErr, w.WriteSpan(testSpan(2)))
+	assert.Equal(t, Open, w.State())
+	assert.Equal(t, ErrCircuitOpen, w.WriteSpan(testSpan(3)))
+
+	counters, gauges := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counters["circuit-breaker.opened"])
+	assert.EqualValues(t, 1, counters["circuit-breaker.rejected-spans"])
+	assert.EqualValues(t, Open, gauges["circuit-breaker.state"])
+	assert.NoError(t, w.Close())
+}
+
+func TestWriterSuccessResetsFailures(t *testing.T) {
+	w, underlying := newTestWriter(Options{FailureThreshold: 2, OpenPeriod: time.Minute}, metrics.NullFactory)
+	underlying.set(errors.New("timeout"), 0)
+	assert.Error(t, w.WriteSpan(testSpan(1)))
+	underlying.set(nil, 0)
+	assert.NoError(t, w.WriteSpan(testSpan(2)))
+	underlying.set(errors.New("timeout"), 0)
+	assert.Error(t, w.WriteSpan(testSpan(3)))
+	assert.Equal(t, Closed, w.State())
+}
+
+func TestWriterHalfOpenProbe(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	w, underlying := newTestWriter(Options{FailureThreshold: 1, OpenPeriod: time.Minute}, metricsFactory)
+	underlying.set(errors.New("timeout"), 0)
+	assert.Error(t, w.WriteSpan(testSpan(1)))
+	require.Equal(t, Open, w.State())
+
+	// a failed probe opens the circuit for another period
+	underlying.advance(time.Minute)
+	assert.Error(t, w.WriteSpan(testSpan(2)))
+	assert.Equal(t, Open, w.State())
+	underlying.advance(30 * time.Second)
+	assert.Equal(t, ErrCircuitOpen, w.WriteSpan(testSpan(3)))
+
+	underlying.advance(30 * time.Second)
+	underlying.set(nil, 0)
+	assert.NoError(t, w.WriteSpan(testSpan(4)))
+	assert.Equal(t, Closed, w.State())
+	assert.NoError(t, w.WriteSpan(testSpan(5)))
+	assert.Equal(t, 2, underlying.written())
+
+	counters, gauges := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counters["circuit-breaker.opened"])
+	assert.EqualValues(t, Closed, gauges["circuit-breaker.state"])
+}
+
+func TestWriterRejectsWhileProbing(t *testing.T) {
+	w, underlying := newTestWriter(Options{FailureThreshold: 1, OpenPeriod: time.Minute}, metrics.NullFactory)
+	underlying.set(errors.New("timeout"), 0)
+	assert.Error(t, w.WriteSpan(testSpan(1)))
+	underlying.advance(time.Minute)
+
+	require.True(t, w.allow())
+	assert.Equal(t, HalfOpen, w.State())
+	assert.Equal(t, ErrCircuitOpen, w.WriteSpan(testSpan(2)))
+}
+
+func TestWriterLatencyThreshold(t *testing.T) {
+	w, underlying := newTestWriter(Options{FailureThreshold: 1, LatencyThreshold: time.Second, OpenPeriod: time.Minute}, metrics.NullFactory)
+	underlying.set(nil, time.Second)
+	assert.NoError(t, w.WriteSpan(testSpan(1)))
+	assert.Equal(t, Closed, w.State())
+
+	// slow writes succeed but open the circuit
+	underlying.set(nil, 2*time.Second)
+	assert.NoError(t, w.WriteSpan(testSpan(2)))
+	assert.Equal(t, Open, w.State())
+	assert.Equal(t, ErrCircuitOpen, w.WriteSpan(testSpan(3)))
+	assert.Equal(t, 2, underlying.written())
+}
+
+func TestWriterFallback(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	w, underlying := newTestWriter(Options{FailureThreshold: 1, OpenPeriod: time.Minute, FallbackSize: 2}, metricsFactory)
+	underlying.set(errors.New("timeout"), 0)
+	assert.Error(t, w.WriteSpan(testSpan(1)))
+
+	assert.Equal(t, spanstore.ErrSpanBuffered, w.WriteSpan(testSpan(2)))
+	assert.Equal(t, spanstore.ErrSpanBuffered, w.WriteSpan(testSpan(3)))
+	assert.Equal(t, ErrCircuitOpen, w.WriteSpan(testSpan(4)))
+	counters, gauges := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counters["circuit-breaker.buffered-spans"])
+	assert.EqualValues(t, 1, counters["circuit-breaker.rejected-spans"])
+	assert.EqualValues(t, 2, gauges["circuit-breaker.fallback-length"])
+
+	// the buffered spans are written once the probe closes the circuit
+	underlying.advance(time.Minute)
+	underlying.set(nil, 0)
+	assert.NoError(t, w.WriteSpan(testSpan(5)))
+	for i := 0; i < 100 && underlying.written() < 3; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	require.NoError(t, w.Close())
+	assert.Equal(t, 3, underlying.written())
+	counters, gauges = metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counters["circuit-breaker.written-buffered-spans"])
+	assert.EqualValues(t, 0, gauges["circuit-breaker.fallback-length"])
+	assert.Equal(t, ErrCircuitOpen, w.divert(testSpan(6)))
+}
+
+func TestWriterCloseWritesBufferedSpans(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	w, underlying := newTestWriter(Options{FailureThreshold: 1, OpenPeriod: time.Minute, FallbackSize: 10}, metricsFactory)
+	underlying.set(errors.New("timeout"), 0)
+	assert.Error(t, w.WriteSpan(testSpan(1)))
+	assert.Equal(t, spanstore.ErrSpanBuffered, w.WriteSpan(testSpan(2)))
+	assert.Equal(t, spanstore.ErrSpanBuffered, w.WriteSpan(testSpan(3)))
+
+	// the circuit is still open, the buffered spans are written anyway
+	underlying.set(nil, 0)
+	require.NoError(t, w.Close())
+	assert.Equal(t, 2, underlying.written())
+	assert.Equal(t, ErrCircuitOpen, w.WriteSpan(testSpan(4)))
+	counters, gauges := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counters["circuit-breaker.written-buffered-spans"])
+	assert.EqualValues(t, 0, gauges["circuit-breaker.fallback-length"])
+}
+
+func TestWriterCloseFailure(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	w, underlying := newTestWriter(Options{FailureThreshold: 1, OpenPeriod: time.Minute, FallbackSize: 10}, metricsFactory)
+	underlying.set(errors.New("timeout"), 0)
+	assert.Error(t, w.WriteSpan(testSpan(1)))
+	assert.Equal(t, spanstore.ErrSpanBuffered, w.WriteSpan(testSpan(2)))
+	assert.EqualError(t, w.Close(), "Failed to write 1 buffered spans of the storage circuit breaker: timeout")
+
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counters["circuit-breaker.failed-writes"])
+}
+
+func TestStateString(t *testing.T) {
+	assert.Equal(t, "closed", Closed.String())
+	assert.Equal(t, "open", Open.String())
+	assert.Equal(t, "half-open", HalfOpen.String())
+}
@@ -0,0 +1,294 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package compaction
+
+import (
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/pkg/cache"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+const (
+	// DefaultMaxProcesses is the default number of processes of recent traces the Writer remembers as stored
+	DefaultMaxProcesses = 100000
+
+	// DefaultFlushInterval is the default interval at which the processes written to a buffering writer are
+	// confirmed stored
+	DefaultFlushInterval = time.Second
+
+	// processRefKey is the key of the single process tag replacing the tags of a process stored with another
+	// span of the trace, its value being the hash of the process
+	processRefKey = "$$jaeger.process-ref"
+)
+
+// Options are the settings of the Writer
+type Options struct {
+	// MaxProcesses is the number of processes of recent traces remembered as stored, DefaultMaxProcesses if 0.
+	// The spans of the traces evicted from it store their process again.
+	MaxProcesses int
+	// FlushInterval is the interval at which the Writer flushes a spanstore.Flusher it wraps, the processes
+	// written since the previous flush being remembered as stored once the flush succeeds, DefaultFlushInterval
+	// if 0
+	FlushInterval time.Duration
+}
+
+type compactionMetrics struct {
+	// SpansCompacted counts the spans stored with a reference to their process instead of its tags
+	SpansCompacted metrics.Counter `metric:"process-compaction.spans"`
+	// BytesSaved is the estimated size of the process tags not stored
+	BytesSaved metrics.Counter `metric:"process-compaction.bytes-saved"`
+	// ProcessesForgotten counts the processes written before a failed flush, which are stored again
+	ProcessesForgotten metrics.Counter `metric:"process-compaction.forgotten"`
+}
+
+// Writer stores the process of the spans of a trace once, see NewWriter
+type Writer struct {
+	writer spanstore.Writer
+	// stored are the trace IDs and process hashes of the processes stored with a span of their trace
+	stored  *cache.LRU
+	metrics compactionMetrics
+
+	// flusher is the wrapped writer if it buffers spans, nil otherwise
+	flusher spanstore.Flusher
+	// pending are the keys of the processes written to the flusher since its last flush, which are
+	// stored again until a flush confirms them
+	pending    map[string]struct{}
+	pendingMux sync.Mutex
+	stop       chan struct{}
+	done       sync.WaitGroup
+}
+
+// NewWriter returns a Writer storing the process of the spans of a trace once: the spans whose process has
+// already been stored with another span of the trace by this writer are stored with a reference to it instead
+// of its tags. The spans are restored by the Reader returned by NewReader. The process tags of the compacted
+// spans are not indexed, the spans storing their process are.
+//
+// If spanWriter is a spanstore.Flusher, e.g. the bulk writer of ElasticSearch, which returns before the spans are
+// stored, a process is only referenced once a flush succeeds after the span storing it was written, the processes
+// written before a failed flush being stored again with the next span of their trace. The Writer then flushes
+// spanWriter every Options.FlushInterval until it is closed, which must happen before spanWriter is closed.
+func NewWriter(spanWriter spanstore.Writer, options Options, metricsFactory metrics.Factory) *Writer {
+	if options.MaxProcesses <= 0 {
+		options.MaxProcesses = DefaultMaxProcesses
+	}
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = DefaultFlushInterval
+	}
+	w := &Writer{
+		writer: spanWriter,
+		stored: cache.NewLRU(options.MaxProcesses),
+		stop:   make(chan struct{}),
+	}
+	metrics.Init(&w.metrics, metricsFactory, nil)
+	if flusher, ok := spanWriter.(spanstore.Flusher); ok {
+		w.flusher = flusher
+		w.done.Add(1)
+		go w.flushPeriodically(options.FlushInterval)
+	}
+	return w
+}
+
+func (w *Writer) WriteSpan(span *model.Span) error {
+	if span.Process == nil || len(span.Process.Tags) == 0 {
+		return w.writer.WriteSpan(span)
+	}
+	hash := processHash(span.Process)
+	key := span.TraceID.String() + ":" + strconv.FormatUint(hash, 16)
+	if w.stored.Get(key) == nil {
+		if err := w.writer.WriteSpan(span); err != nil {
+			return err
+		}
+		// only once stored, so that the process is not lost with a failed span
+		w.markStored(key)
+		return nil
+	}
+	ref := model.KeyValues{model.Int64(processRefKey, int64(hash))}
+	saved := tagsSize(span.Process.Tags) - tagsSize(ref)
+	if saved <= 0 {
+		// the process is smaller than its reference
+		return w.writer.WriteSpan(span)
+	}
+	// the span is shared with the other stages of the collector, it is left as is
+	compacted := *span
+	compacted.Process = &model.Process{ServiceName: span.Process.ServiceName, Tags: ref}
+	if err := w.writer.WriteSpan(&compacted); err != nil {
+		return err
+	}
+	w.metrics.SpansCompacted.Inc(1)
+	w.metrics.BytesSaved.Inc(int64(saved))
+	return nil
+}
+
+// markStored remembers the process of the key as stored, once confirmed by a flush if the writer buffers spans
+func (w *Writer) markStored(key string) {
+	if w.flusher == nil {
+		w.stored.Put(key, true)
+		return
+	}
+	w.pendingMux.Lock()
+	if w.pending == nil {
+		w.pending = make(map[string]struct{})
+	}
+	w.pending[key] = struct{}{}
+	w.pendingMux.Unlock()
+}
+
+func (w *Writer) flushPeriodically(interval time.Duration) {
+	defer w.done.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.confirmPending()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// confirmPending flushes the wrapped writer, remembering the processes written before as stored if the flush
+// succeeds, and forgetting them otherwise, since the failed spans may be the ones storing them
+func (w *Writer) confirmPending() {
+	w.pendingMux.Lock()
+	pending := w.pending
+	w.pending = nil
+	w.pendingMux.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+	if err := w.flusher.Flush(); err != nil {
+		w.metrics.ProcessesForgotten.Inc(int64(len(pending)))
+		return
+	}
+	for key := range pending {
+		w.stored.Put(key, true)
+	}
+}
+
+// Close stops flushing the wrapped writer, which is not closed
+func (w *Writer) Close() error {
+	close(w.stop)
+	w.done.Wait()
+	return nil
+}
+
+type reader struct {
+	spanstore.Reader
+	unresolved metrics.Counter
+}
+
+// NewReader returns a Reader restoring the processes of the spans stored by the Writer returned by NewWriter.
+// The other spans are returned as they are, so that it can read any span.
+func NewReader(spanReader spanstore.Reader, metricsFactory metrics.Factory) spanstore.Reader {
+	return &reader{
+		Reader:     spanReader,
+		unresolved: metricsFactory.Counter("process-compaction.unresolved", nil),
+	}
+}
+
+func (r *reader) GetTrace(traceID model.TraceID) (*model.Trace, error) {
+	trace, err := r.Reader.GetTrace(traceID)
+	if err != nil {
+		return nil, err
+	}
+	r.unresolved.Inc(int64(RestoreProcesses(trace)))
+	return trace, nil
+}
+
+func (r *reader) FindTraces(query *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
+	traces, err := r.Reader.FindTraces(query)
+	if err != nil {
+		return nil, err
+	}
+	for _, trace := range traces {
+		r.unresolved.Inc(int64(RestoreProcesses(trace)))
+	}
+	return traces, nil
+}
+
+// RestoreProcesses replaces the references to processes of the spans of the trace with the processes stored with
+// other spans of the trace. It returns the number of spans whose process was not found, e.g. because the span
+// storing it expired first, which keep their reference.
+func RestoreProcesses(trace *model.Trace) int {
+	var processes map[uint64]*model.Process
+	unresolved := 0
+	for _, span := range trace.Spans {
+		hash, ok := processRef(span.Process)
+		if !ok {
+			continue
+		}
+		if processes == nil {
+			processes = storedProcesses(trace)
+		}
+		if process, ok := processes[hash]; ok {
+			span.Process = process
+		} else {
+			unresolved++
+		}
+	}
+	return unresolved
+}
+
+// storedProcesses returns the processes stored with the spans of the trace, by hash
+func storedProcesses(trace *model.Trace) map[uint64]*model.Process {
+	processes := make(map[uint64]*model.Process)
+	for _, span := range trace.Spans {
+		if span.Process == nil {
+			continue
+		}
+		if _, ok := processRef(span.Process); !ok {
+			processes[processHash(span.Process)] = span.Process
+		}
+	}
+	return processes
+}
+
+// processRef returns the hash of the process referenced by a compacted span
+func processRef(process *model.Process) (uint64, bool) {
+	if process == nil || len(process.Tags) != 1 || process.Tags[0].Key != processRefKey {
+		return 0, false
+	}
+	return uint64(process.Tags[0].Int64()), true
+}
+
+func processHash(process *model.Process) uint64 {
+	hash := fnv.New64a()
+	process.Hash(hash)
+	return hash.Sum64()
+}
+
+// tagsSize estimates the stored size of the tags
+func tagsSize(tags model.KeyValues) int {
+	size := 0
+	for _, tag := range tags {
+		// the numeric and boolean values take 8 bytes at most
+		size += len(tag.Key) + len(tag.VStr) + len(tag.VBlob) + 8
+	}
+	return size
+}
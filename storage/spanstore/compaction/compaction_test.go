@@ -0,0 +1,189 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package compaction
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/storage/spanstore"
+	"github.com/uber/jaeger/storage/spanstore/memory"
+)
+
+func makeSpan(traceID uint64, spanID uint64, process *model.Process) *model.Span {
+	return &model.Span{
+		TraceID: model.TraceID{Low: traceID},
+		SpanID:  model.SpanID(spanID),
+		Process: process,
+	}
+}
+
+func newProcess(service string) *model.Process {
+	return &model.Process{
+		ServiceName: service,
+		Tags:        model.KeyValues{model.String("hostname", "host-1"), model.String("ip", "10.0.0.1")},
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	store := memory.NewStore()
+	mb := metrics.NewLocalFactory(0)
+	writer := NewWriter(store, Options{}, mb)
+	frontend := newProcess("frontend")
+	spans := []*model.Span{
+		makeSpan(1, 1, frontend),
+		makeSpan(1, 2, newProcess("frontend")),
+		makeSpan(1, 3, newProcess("backend")),
+		makeSpan(1, 4, &model.Process{ServiceName: "backend"}),
+		// the processes are stored once per trace
+		makeSpan(2, 1, newProcess("frontend")),
+	}
+	for _, span := range spans {
+		require.NoError(t, writer.WriteSpan(span))
+	}
+	assert.Equal(t, frontend, spans[1].Process, "the written span is left as is")
+
+	stored, err := store.GetTrace(model.TraceID{Low: 1})
+	require.NoError(t, err)
+	require.Len(t, stored.Spans, 4)
+	assert.Equal(t, frontend.Tags, stored.Spans[0].Process.Tags)
+	_, compacted := processRef(stored.Spans[1].Process)
+	assert.True(t, compacted)
+	assert.Equal(t, "frontend", stored.Spans[1].Process.ServiceName)
+	_, compacted = processRef(stored.Spans[2].Process)
+	assert.False(t, compacted)
+	counters, _ := mb.Snapshot()
+	assert.EqualValues(t, 1, counters["process-compaction.spans"])
+	assert.True(t, counters["process-compaction.bytes-saved"] > 0)
+
+	reader := NewReader(store, mb)
+	trace, err := reader.GetTrace(model.TraceID{Low: 1})
+	require.NoError(t, err)
+	for i, span := range trace.Spans {
+		assert.Equal(t, spans[i].Process, span.Process)
+	}
+	traces, err := reader.FindTraces(&spanstore.TraceQueryParameters{ServiceName: "frontend", NumTraces: 10})
+	require.NoError(t, err)
+	assert.Len(t, traces, 2)
+	counters, _ = mb.Snapshot()
+	assert.EqualValues(t, 0, counters["process-compaction.unresolved"])
+}
+
+type failingWriter struct{}
+
+func (failingWriter) WriteSpan(span *model.Span) error {
+	return errors.New("write failed")
+}
+
+func TestCompactionFailedWrite(t *testing.T) {
+	store := memory.NewStore()
+	w := NewWriter(failingWriter{}, Options{}, metrics.NullFactory)
+	assert.Error(t, w.WriteSpan(makeSpan(1, 1, newProcess("frontend"))))
+
+	// the process was not stored, so the next span stores it
+	w.writer = store
+	require.NoError(t, w.WriteSpan(makeSpan(1, 2, newProcess("frontend"))))
+	trace, err := store.GetTrace(model.TraceID{Low: 1})
+	require.NoError(t, err)
+	assert.Len(t, trace.Spans[0].Process.Tags, 2)
+}
+
+// flushingWriter stores the spans when flushed, failing the flush if err is set
+type flushingWriter struct {
+	store    *memory.Store
+	buffered []*model.Span
+	err      error
+}
+
+func (w *flushingWriter) WriteSpan(span *model.Span) error {
+	w.buffered = append(w.buffered, span)
+	return nil
+}
+
+func (w *flushingWriter) Flush() error {
+	buffered := w.buffered
+	w.buffered = nil
+	if w.err != nil {
+		return w.err
+	}
+	for _, span := range buffered {
+		if err := w.store.WriteSpan(span); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestCompactionFlusher(t *testing.T) {
+	store := memory.NewStore()
+	flusher := &flushingWriter{store: store, err: errors.New("flush failed")}
+	mb := metrics.NewLocalFactory(0)
+	w := NewWriter(flusher, Options{FlushInterval: time.Hour}, mb)
+	defer w.Close()
+
+	require.NoError(t, w.WriteSpan(makeSpan(1, 1, newProcess("frontend"))))
+	// not flushed yet, so the process is stored again
+	require.NoError(t, w.WriteSpan(makeSpan(1, 2, newProcess("frontend"))))
+	w.confirmPending()
+	counters, _ := mb.Snapshot()
+	assert.EqualValues(t, 1, counters["process-compaction.forgotten"])
+
+	// the flush failed, so the process is stored again, and referenced once a flush succeeds
+	flusher.err = nil
+	require.NoError(t, w.WriteSpan(makeSpan(1, 3, newProcess("frontend"))))
+	w.confirmPending()
+	require.NoError(t, w.WriteSpan(makeSpan(1, 4, newProcess("frontend"))))
+	require.NoError(t, flusher.Flush())
+
+	trace, err := store.GetTrace(model.TraceID{Low: 1})
+	require.NoError(t, err)
+	require.Len(t, trace.Spans, 2)
+	assert.Len(t, trace.Spans[0].Process.Tags, 2)
+	_, compacted := processRef(trace.Spans[1].Process)
+	assert.True(t, compacted)
+	counters, _ = mb.Snapshot()
+	assert.EqualValues(t, 1, counters["process-compaction.spans"])
+}
+
+func TestRestoreProcessesUnresolved(t *testing.T) {
+	process := newProcess("frontend")
+	trace := &model.Trace{Spans: []*model.Span{
+		makeSpan(1, 1, &model.Process{
+			ServiceName: "frontend",
+			Tags:        model.KeyValues{model.Int64(processRefKey, int64(processHash(process)))},
+		}),
+		makeSpan(1, 2, &model.Process{
+			ServiceName: "frontend",
+			Tags:        model.KeyValues{model.Int64(processRefKey, 42)},
+		}),
+		makeSpan(1, 3, process),
+	}}
+	assert.Equal(t, 1, RestoreProcesses(trace))
+	assert.Equal(t, process, trace.Spans[0].Process)
+	_, compacted := processRef(trace.Spans[1].Process)
+	assert.True(t, compacted, "the spans whose process is not found keep their reference")
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package deadline provides a span Writer giving up the writes of a stalled storage after a deadline.
+package deadline
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+// DefaultMaxInFlight is the default number of writes running at once beyond which spans are not written
+const DefaultMaxInFlight = 1000
+
+var (
+	// ErrDeadlineExceeded is returned by WriteSpan when its write did not finish in time, the span being stored
+	// if the write finishes later
+	ErrDeadlineExceeded = errors.New("The span was not written before the deadline")
+
+	// ErrTooManyWrites is returned by WriteSpan when the span is not written because too many writes are running
+	ErrTooManyWrites = errors.New("The span was not written because too many writes are running")
+)
+
+// Options configure the deadline of a Writer
+type Options struct {
+	// Timeout is how long the write of a span may take before it is given up
+	Timeout time.Duration
+	// MaxInFlight is the number of writes running at once, including the timed out ones, beyond which the spans
+	// are not written, so that a stalled storage does not pile up goroutines, DefaultMaxInFlight if 0
+	MaxInFlight int
+}
+
+// ParseTimeouts parses a comma-separated list of storageType=timeout write deadlines, e.g. cassandra=2s,elasticsearch=5s
+func ParseTimeouts(list string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	if list == "" {
+		return timeouts, nil
+	}
+	for _, pair := range strings.Split(list, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("Expected storageType=timeout, found %q", pair)
+		}
+		timeout, err := time.ParseDuration(kv[1])
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("Invalid write deadline of %s storage: %q", kv[0], kv[1])
+		}
+		timeouts[kv[0]] = timeout
+	}
+	return timeouts, nil
+}
+
+type writerMetrics struct {
+	// TimedOut counts the spans whose write did not finish before the deadline
+	TimedOut metrics.Counter `metric:"timed-out-spans"`
+	// Rejected counts the spans not written because too many writes were running
+	Rejected metrics.Counter `metric:"rejected-spans"`
+	// Stalled is the number of timed out writes still running
+	Stalled metrics.Gauge `metric:"stalled-writes"`
+}
+
+// Writer is a span Writer giving up the writes to the underlying writer that take longer than a timeout, so that
+// a stalled storage frees the goroutines saving the spans instead of blocking all of them, WriteSpan returning
+// ErrDeadlineExceeded. The given up write keeps running in the background, since the storage clients cannot be
+// interrupted, and counts as stalled until it finishes. The writes running at once are capped, so that a stalled
+// storage does not pile up goroutines, the spans beyond the cap being rejected with ErrTooManyWrites.
+type Writer struct {
+	writer   spanstore.Writer
+	options  Options
+	logger   *zap.Logger
+	metrics  writerMetrics
+	inFlight chan struct{}
+
+	sync.Mutex
+	stalled int64
+}
+
+// NewWriter creates a Writer giving up the writes to writer after the timeout of the options
+func NewWriter(writer spanstore.Writer, options Options, logger *zap.Logger, metricsFactory metrics.Factory) *Writer {
+	if options.MaxInFlight <= 0 {
+		options.MaxInFlight = DefaultMaxInFlight
+	}
+	w := &Writer{
+		writer:   writer,
+		options:  options,
+		logger:   logger,
+		inFlight: make(chan struct{}, options.MaxInFlight),
+	}
+	metrics.Init(&w.metrics, metricsFactory.Namespace("write-deadline", nil), nil)
+	return w
+}
+
+// WriteSpan writes the span to the underlying writer, giving it up once the timeout elapsed
+func (w *Writer) WriteSpan(span *model.Span) error {
+	select {
+	case w.inFlight <- struct{}{}:
+	default:
+		w.metrics.Rejected.Inc(1)
+		return ErrTooManyWrites
+	}
+	// finished and abandoned are guarded by the lock, so that an abandoned write stops being stalled exactly once
+	var finished, abandoned bool
+	result := make(chan error, 1)
+	go func() {
+		defer func() { <-w.inFlight }()
+		result <- w.writer.WriteSpan(span)
+		w.Lock()
+		defer w.Unlock()
+		finished = true
+		if abandoned {
+			w.stalled--
+			w.metrics.Stalled.Update(w.stalled)
+		}
+	}()
+	timer := time.NewTimer(w.options.Timeout)
+	defer timer.Stop()
+	select {
+	case err := <-result:
+		return err
+	case <-timer.C:
+	}
+	w.Lock()
+	if finished {
+		// finished as the deadline elapsed
+		w.Unlock()
+		return <-result
+	}
+	abandoned = true
+	w.stalled++
+	w.metrics.Stalled.Update(w.stalled)
+	w.Unlock()
+	w.metrics.TimedOut.Inc(1)
+	return ErrDeadlineExceeded
+}
+
+// stalledWrites returns the number of timed out writes still running
+func (w *Writer) stalledWrites() int64 {
+	w.Lock()
+	defer w.Unlock()
+	return w.stalled
+}
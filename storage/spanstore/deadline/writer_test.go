@@ -0,0 +1,134 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package deadline
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/storage/spanstore"
+	"github.com/uber/jaeger/storage/spanstore/memory"
+)
+
+var _ spanstore.Writer = &Writer{} // check API conformance
+
+// stallingWriter blocks the writes until it is released, then fails with err
+type stallingWriter struct {
+	release chan struct{}
+	err     error
+}
+
+func (w *stallingWriter) WriteSpan(span *model.Span) error {
+	<-w.release
+	return w.err
+}
+
+// slowWriter sleeps for its duration before writing the spans
+type slowWriter time.Duration
+
+func (w slowWriter) WriteSpan(span *model.Span) error {
+	time.Sleep(time.Duration(w))
+	return nil
+}
+
+func waitForStalled(t *testing.T, w *Writer, expected int64) {
+	for i := 0; i < 1000; i++ {
+		if w.stalledWrites() == expected {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected %d stalled writes, found %d", expected, w.stalledWrites())
+}
+
+func TestParseTimeouts(t *testing.T) {
+	timeouts, err := ParseTimeouts("cassandra=2s,elasticsearch=500ms")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]time.Duration{"cassandra": 2 * time.Second, "elasticsearch": 500 * time.Millisecond}, timeouts)
+
+	timeouts, err = ParseTimeouts("")
+	require.NoError(t, err)
+	assert.Empty(t, timeouts)
+
+	_, err = ParseTimeouts("cassandra")
+	assert.EqualError(t, err, `Expected storageType=timeout, found "cassandra"`)
+	_, err = ParseTimeouts("cassandra=soon")
+	assert.EqualError(t, err, `Invalid write deadline of cassandra storage: "soon"`)
+	_, err = ParseTimeouts("cassandra=0s")
+	assert.EqualError(t, err, `Invalid write deadline of cassandra storage: "0s"`)
+}
+
+func TestWriterWithinDeadline(t *testing.T) {
+	store := memory.NewStore()
+	w := NewWriter(store, Options{Timeout: time.Minute}, zap.NewNop(), metrics.NullFactory)
+	span := &model.Span{TraceID: model.TraceID{Low: 1}, Process: &model.Process{ServiceName: "svc"}}
+	require.NoError(t, w.WriteSpan(span))
+	trace, err := store.GetTrace(span.TraceID)
+	require.NoError(t, err)
+	assert.Len(t, trace.Spans, 1)
+
+	failing := &stallingWriter{release: make(chan struct{}), err: errors.New("unavailable")}
+	close(failing.release)
+	w = NewWriter(failing, Options{Timeout: time.Minute}, zap.NewNop(), metrics.NullFactory)
+	assert.EqualError(t, w.WriteSpan(span), "unavailable")
+}
+
+func TestWriterDropsTimedOutSpans(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	stalling := &stallingWriter{release: make(chan struct{})}
+	w := NewWriter(stalling, Options{Timeout: time.Millisecond, MaxInFlight: 2}, zap.NewNop(), metricsFactory)
+
+	assert.Equal(t, ErrDeadlineExceeded, w.WriteSpan(&model.Span{}))
+	assert.Equal(t, ErrDeadlineExceeded, w.WriteSpan(&model.Span{}))
+	assert.Equal(t, ErrTooManyWrites, w.WriteSpan(&model.Span{}))
+	counts, gauges := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counts["write-deadline.timed-out-spans"])
+	assert.EqualValues(t, 1, counts["write-deadline.rejected-spans"], "not written beyond the writes in flight")
+	assert.EqualValues(t, 2, gauges["write-deadline.stalled-writes"])
+
+	close(stalling.release)
+	waitForStalled(t, w, 0)
+	_, gauges = metricsFactory.Snapshot()
+	assert.EqualValues(t, 0, gauges["write-deadline.stalled-writes"])
+	for i := 0; i < 2; i++ {
+		// the finished writes release their slots
+		assert.NoError(t, w.WriteSpan(&model.Span{}))
+	}
+}
+
+func TestWriterStalledWritesAreCountedOnce(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	// the writes finish around their deadline
+	w := NewWriter(slowWriter(time.Millisecond), Options{Timeout: time.Millisecond}, zap.NewNop(), metricsFactory)
+	for i := 0; i < 20; i++ {
+		w.WriteSpan(&model.Span{})
+	}
+	waitForStalled(t, w, 0)
+	_, gauges := metricsFactory.Snapshot()
+	assert.EqualValues(t, 0, gauges["write-deadline.stalled-writes"])
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uber/jaeger/model"
+)
+
+var (
+	// ErrDeleteTagsNotSet occurs when attempting to delete spans without a tag filter
+	ErrDeleteTagsNotSet = errors.New("Tags must be set to delete spans")
+
+	// ErrDeleteTimeRangeNotSet occurs when attempting to delete spans without a time range
+	ErrDeleteTimeRangeNotSet = errors.New("Start and End Time must be set to delete spans")
+
+	// ErrDeleteStartTimeMinGreaterThanMax occurs when the start time min of a deletion is above its max
+	ErrDeleteStartTimeMinGreaterThanMax = errors.New("Start Time Minimum is above Maximum")
+)
+
+// Deleter deletes spans from storage, e.g. to honor the requests to erase the data of a user.
+type Deleter interface {
+	// DeleteSpans deletes the spans matching the query and returns how many were deleted. The spans
+	// deleted before an error are counted.
+	DeleteSpans(query *DeleteQueryParameters) (int, error)
+}
+
+// DeleteQueryParameters contains the parameters of a deletion. A span is deleted if it started within
+// the time range and has all the tags, as span tags, process tags or log fields.
+type DeleteQueryParameters struct {
+	Tags         map[string]string
+	StartTimeMin time.Time
+	StartTimeMax time.Time
+	// ServiceNames restricts the deletion to the spans of the services, e.g. those of a tenant, all if empty
+	ServiceNames []string
+	// SpansPerSecond is the maximum rate at which the spans are deleted, unbounded if 0
+	SpansPerSecond float64
+}
+
+// Validate returns an error if the deletion is not restricted by tags and a time range
+func (q *DeleteQueryParameters) Validate() error {
+	if len(q.Tags) == 0 {
+		return ErrDeleteTagsNotSet
+	}
+	if q.StartTimeMin.IsZero() || q.StartTimeMax.IsZero() {
+		return ErrDeleteTimeRangeNotSet
+	}
+	if q.StartTimeMax.Before(q.StartTimeMin) {
+		return ErrDeleteStartTimeMinGreaterThanMax
+	}
+	return nil
+}
+
+// IndexedTag returns the tag the candidate spans are looked up by, the first one in the order of the keys
+// so that the same deletion always scans the same index
+func (q *DeleteQueryParameters) IndexedTag() (string, string) {
+	keys := make([]string, 0, len(q.Tags))
+	for k := range q.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys[0], q.Tags[keys[0]]
+}
+
+// Matches returns whether the span must be deleted
+func (q *DeleteQueryParameters) Matches(span *model.Span) bool {
+	if span.StartTime.Before(q.StartTimeMin) || span.StartTime.After(q.StartTimeMax) {
+		return false
+	}
+	if len(q.ServiceNames) > 0 && (span.Process == nil || !q.HasService(span.Process.ServiceName)) {
+		return false
+	}
+	for k, v := range q.Tags {
+		if !hasTag(span, k, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// HasService returns whether the spans of the service can be deleted
+func (q *DeleteQueryParameters) HasService(service string) bool {
+	if len(q.ServiceNames) == 0 {
+		return true
+	}
+	for _, s := range q.ServiceNames {
+		if s == service {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTag returns whether the span has the tag in its span, process or log tags
+func hasTag(span *model.Span, k, v string) bool {
+	matches := func(kvs model.KeyValues) bool {
+		// there can be several tags with the same key, so KeyValues.FindByKey cannot be used
+		for _, kv := range kvs {
+			if kv.Key == k && kv.AsString() == v {
+				return true
+			}
+		}
+		return false
+	}
+	if matches(span.Tags) || (span.Process != nil && matches(span.Process.Tags)) {
+		return true
+	}
+	for _, log := range span.Logs {
+		if matches(log.Fields) {
+			return true
+		}
+	}
+	return false
+}
+
+type multiDeleter []Deleter
+
+// NewMultiDeleter returns a Deleter deleting the spans from each of the deleters, e.g. the shards of a storage
+func NewMultiDeleter(deleters ...Deleter) Deleter {
+	return multiDeleter(deleters)
+}
+
+// DeleteSpans implements Deleter, stopping at the first deleter that fails
+func (d multiDeleter) DeleteSpans(query *DeleteQueryParameters) (int, error) {
+	deleted := 0
+	for _, deleter := range d {
+		n, err := deleter.DeleteSpans(query)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// DeletePacer spaces out the deletions of spans to allow up to a rate of spans per second
+type DeletePacer struct {
+	sync.Mutex
+	interval time.Duration
+	next     time.Time
+	timeNow  func() time.Time
+	sleep    func(time.Duration)
+}
+
+// NewDeletePacer returns the pacer of the deletions of the query, or nil if they are unbounded
+func NewDeletePacer(query *DeleteQueryParameters) *DeletePacer {
+	if query.SpansPerSecond <= 0 {
+		return nil
+	}
+	return &DeletePacer{
+		interval: time.Duration(float64(time.Second) / query.SpansPerSecond),
+		timeNow:  time.Now,
+		sleep:    time.Sleep,
+	}
+}
+
+// Wait blocks until n more spans can be deleted, it returns immediately on a nil pacer
+func (p *DeletePacer) Wait(n int) {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	now := p.timeNow()
+	if p.next.Before(now) {
+		p.next = now
+	}
+	delay := p.next.Sub(now)
+	p.next = p.next.Add(time.Duration(n) * p.interval)
+	p.Unlock()
+	if delay > 0 {
+		p.sleep(delay)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/uber/jaeger/model"
+)
+
+func TestDeleteQueryParametersValidate(t *testing.T) {
+	start := time.Unix(100, 0)
+	end := time.Unix(200, 0)
+	tags := map[string]string{"user.id": "x"}
+	testCases := []struct {
+		query       DeleteQueryParameters
+		expectedErr error
+	}{
+		{query: DeleteQueryParameters{Tags: tags, StartTimeMin: start, StartTimeMax: end}},
+		{query: DeleteQueryParameters{StartTimeMin: start, StartTimeMax: end}, expectedErr: ErrDeleteTagsNotSet},
+		{query: DeleteQueryParameters{Tags: tags, StartTimeMin: start}, expectedErr: ErrDeleteTimeRangeNotSet},
+		{query: DeleteQueryParameters{Tags: tags, StartTimeMin: end, StartTimeMax: start}, expectedErr: ErrDeleteStartTimeMinGreaterThanMax},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expectedErr, testCase.query.Validate())
+	}
+}
+
+func TestDeleteQueryParametersIndexedTag(t *testing.T) {
+	query := DeleteQueryParameters{Tags: map[string]string{"user.id": "x", "tenant": "y", "zone": "z"}}
+	k, v := query.IndexedTag()
+	assert.Equal(t, "tenant", k)
+	assert.Equal(t, "y", v)
+}
+
+func TestDeleteQueryParametersMatches(t *testing.T) {
+	query := DeleteQueryParameters{
+		Tags:         map[string]string{"user.id": "x", "retries": "3"},
+		StartTimeMin: time.Unix(100, 0),
+		StartTimeMax: time.Unix(200, 0),
+	}
+	span := func(startTime int64, tags model.KeyValues, processTags model.KeyValues, fields model.KeyValues) *model.Span {
+		return &model.Span{
+			StartTime: time.Unix(startTime, 0),
+			Tags:      tags,
+			Process:   &model.Process{Tags: processTags},
+			Logs:      []model.Log{{Fields: fields}},
+		}
+	}
+	userID := model.KeyValues{model.String("user.id", "x")}
+	retries := model.KeyValues{model.Int64("retries", 3)}
+	testCases := []struct {
+		span     *model.Span
+		expected bool
+	}{
+		{span: span(150, append(model.KeyValues{model.String("user.id", "y")}, userID[0], retries[0]), nil, nil), expected: true},
+		{span: span(150, userID, retries, nil), expected: true},
+		{span: span(150, nil, userID, retries), expected: true},
+		{span: span(150, userID, nil, nil), expected: false},
+		{span: span(250, userID, retries, nil), expected: false},
+		{span: span(50, userID, retries, nil), expected: false},
+	}
+	for i, testCase := range testCases {
+		assert.Equal(t, testCase.expected, query.Matches(testCase.span), "test case %d", i)
+	}
+}
+
+func TestDeleteQueryParametersServiceNames(t *testing.T) {
+	query := DeleteQueryParameters{
+		Tags:         map[string]string{"user.id": "x"},
+		StartTimeMin: time.Unix(100, 0),
+		StartTimeMax: time.Unix(200, 0),
+		ServiceNames: []string{"tenant-a/service"},
+	}
+	span := func(service string) *model.Span {
+		return &model.Span{
+			StartTime: time.Unix(150, 0),
+			Tags:      model.KeyValues{model.String("user.id", "x")},
+			Process:   &model.Process{ServiceName: service},
+		}
+	}
+	assert.True(t, query.Matches(span("tenant-a/service")))
+	assert.False(t, query.Matches(span("tenant-b/service")))
+	assert.True(t, query.HasService("tenant-a/service"))
+	assert.False(t, query.HasService("tenant-b/service"))
+
+	query.ServiceNames = nil
+	assert.True(t, query.Matches(span("tenant-b/service")))
+	assert.True(t, query.HasService("tenant-b/service"))
+}
+
+func TestDeletePacer(t *testing.T) {
+	assert.Nil(t, NewDeletePacer(&DeleteQueryParameters{}))
+	var nilPacer *DeletePacer
+	nilPacer.Wait(1)
+
+	now := time.Unix(0, 0)
+	var slept []time.Duration
+	p := NewDeletePacer(&DeleteQueryParameters{SpansPerSecond: 10})
+	p.timeNow = func() time.Time { return now }
+	p.sleep = func(d time.Duration) { slept = append(slept, d) }
+	p.Wait(1)
+	p.Wait(5)
+	p.Wait(1)
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 600 * time.Millisecond}, slept)
+}
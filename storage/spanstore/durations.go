@@ -0,0 +1,217 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/uber/jaeger/model"
+)
+
+// DefaultDurationMaxTraces is the default number of traces sampled by the storages without percentile aggregations
+const DefaultDurationMaxTraces = 1000
+
+var (
+	// ErrDurationOperationNotSet occurs when attempting to compute duration percentiles without a service and operation
+	ErrDurationOperationNotSet = errors.New("Service Name and Operation Name must be set to compute duration percentiles")
+
+	// ErrDurationMinGreaterThanMax occurs when the duration min of the percentiles is above its max
+	ErrDurationMinGreaterThanMax = errors.New("Duration Minimum is above Maximum")
+)
+
+// DurationReader computes the distribution of the durations of the spans of an operation, e.g. for latency
+// investigations that need more than individual traces.
+type DurationReader interface {
+	// GetDurationPercentiles returns the percentiles of the durations of the spans matching the query
+	GetDurationPercentiles(query *DurationQueryParameters) (*DurationPercentiles, error)
+}
+
+// DurationQueryParameters contains the parameters of the duration percentiles of the spans of an operation of a
+// service that started within the time range, with the same tag and duration filters as the trace search.
+type DurationQueryParameters struct {
+	ServiceName   string
+	OperationName string
+	Tags          map[string]string
+	StartTimeMin  time.Time
+	StartTimeMax  time.Time
+	DurationMin   time.Duration
+	DurationMax   time.Duration
+	// MaxTraces is the number of traces sampled by the storages without percentile aggregations,
+	// DefaultDurationMaxTraces if 0
+	MaxTraces int
+}
+
+// Validate returns an error if the percentiles are not restricted to an operation and a time range
+func (q *DurationQueryParameters) Validate() error {
+	if q.ServiceName == "" || q.OperationName == "" {
+		return ErrDurationOperationNotSet
+	}
+	if q.StartTimeMin.IsZero() || q.StartTimeMax.IsZero() {
+		return ErrStatsTimeRangeNotSet
+	}
+	if q.StartTimeMax.Before(q.StartTimeMin) {
+		return ErrStatsStartTimeMinGreaterThanMax
+	}
+	if q.DurationMax != 0 && q.DurationMax < q.DurationMin {
+		return ErrDurationMinGreaterThanMax
+	}
+	return nil
+}
+
+// TraceQuery returns the trace search of the traces with the spans of the percentiles
+func (q *DurationQueryParameters) TraceQuery() *TraceQueryParameters {
+	maxTraces := q.MaxTraces
+	if maxTraces <= 0 {
+		maxTraces = DefaultDurationMaxTraces
+	}
+	return &TraceQueryParameters{
+		ServiceName:   q.ServiceName,
+		OperationName: q.OperationName,
+		Tags:          q.Tags,
+		StartTimeMin:  q.StartTimeMin,
+		StartTimeMax:  q.StartTimeMax,
+		DurationMin:   q.DurationMin,
+		DurationMax:   q.DurationMax,
+		NumTraces:     maxTraces,
+	}
+}
+
+// Matches returns whether the duration of the span is counted by the percentiles, its tags matching those of the
+// query in its span, process or log tags like in the trace search
+func (q *DurationQueryParameters) Matches(span *model.Span) bool {
+	if span.Process == nil || span.Process.ServiceName != q.ServiceName || span.OperationName != q.OperationName {
+		return false
+	}
+	if span.StartTime.Before(q.StartTimeMin) || span.StartTime.After(q.StartTimeMax) {
+		return false
+	}
+	if span.Duration < q.DurationMin || (q.DurationMax != 0 && span.Duration > q.DurationMax) {
+		return false
+	}
+	for key, value := range q.Tags {
+		if !hasTag(span, key, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// DurationPercentiles are the percentiles of the durations of the spans of an operation
+type DurationPercentiles struct {
+	// Spans is the number of spans whose durations were aggregated
+	Spans int
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+	// Sampled is set when the percentiles were computed from a sample of the traces rather than all of them
+	Sampled bool
+}
+
+// DurationPercentilesBuilder computes the percentiles of the traces sampled by the storages without aggregations
+type DurationPercentilesBuilder struct {
+	query     *DurationQueryParameters
+	durations []time.Duration
+	sampled   bool
+}
+
+// NewDurationPercentilesBuilder returns a DurationPercentilesBuilder of the percentiles of the query
+func NewDurationPercentilesBuilder(query *DurationQueryParameters) *DurationPercentilesBuilder {
+	return &DurationPercentilesBuilder{query: query}
+}
+
+// AddTrace adds the durations of the spans of the trace matching the query
+func (b *DurationPercentilesBuilder) AddTrace(trace *model.Trace) {
+	for _, span := range trace.Spans {
+		if b.query.Matches(span) {
+			b.durations = append(b.durations, span.Duration)
+		}
+	}
+}
+
+// Sample records that only some of the traces were added
+func (b *DurationPercentilesBuilder) Sample() {
+	b.sampled = true
+}
+
+// Percentiles returns the nearest-rank percentiles of the durations added so far, 0 without any
+func (b *DurationPercentilesBuilder) Percentiles() *DurationPercentiles {
+	durations := append([]time.Duration{}, b.durations...)
+	sort.Sort(durationsAscending(durations))
+	return &DurationPercentiles{
+		Spans:   len(durations),
+		P50:     nearestRank(durations, 50),
+		P90:     nearestRank(durations, 90),
+		P99:     nearestRank(durations, 99),
+		Sampled: b.sampled,
+	}
+}
+
+// nearestRank returns the smallest of the sorted durations above the percentile p of them
+func nearestRank(durations []time.Duration, p float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p * float64(len(durations)) / 100))
+	if rank < 1 {
+		rank = 1
+	}
+	return durations[rank-1]
+}
+
+type durationsAscending []time.Duration
+
+func (d durationsAscending) Len() int           { return len(d) }
+func (d durationsAscending) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d durationsAscending) Less(i, j int) bool { return d[i] < d[j] }
+
+type sampledDurationReader struct {
+	reader Reader
+}
+
+// NewSampledDurationReader returns a DurationReader computing the percentiles of the spans of up to MaxTraces of
+// the traces found by the trace search of the query, for the storages without percentile aggregations
+func NewSampledDurationReader(reader Reader) DurationReader {
+	return &sampledDurationReader{reader: reader}
+}
+
+// GetDurationPercentiles implements DurationReader, the percentiles being Sampled when the search found as many
+// traces as it was limited to
+func (r *sampledDurationReader) GetDurationPercentiles(query *DurationQueryParameters) (*DurationPercentiles, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	traceQuery := query.TraceQuery()
+	traces, err := r.reader.FindTraces(traceQuery)
+	if err != nil {
+		return nil, err
+	}
+	builder := NewDurationPercentilesBuilder(query)
+	for _, trace := range traces {
+		builder.AddTrace(trace)
+	}
+	if len(traces) >= traceQuery.NumTraces {
+		builder.Sample()
+	}
+	return builder.Percentiles(), nil
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/jaeger/model"
+	. "github.com/uber/jaeger/storage/spanstore"
+	"github.com/uber/jaeger/storage/spanstore/memory"
+	"github.com/uber/jaeger/storage/spanstore/mocks"
+)
+
+func TestDurationQueryParametersValidate(t *testing.T) {
+	start := time.Unix(100, 0)
+	end := time.Unix(200, 0)
+	testCases := []struct {
+		query       DurationQueryParameters
+		expectedErr error
+	}{
+		{query: DurationQueryParameters{ServiceName: "svc", OperationName: "GET", StartTimeMin: start, StartTimeMax: end}},
+		{query: DurationQueryParameters{ServiceName: "svc", StartTimeMin: start, StartTimeMax: end}, expectedErr: ErrDurationOperationNotSet},
+		{query: DurationQueryParameters{OperationName: "GET", StartTimeMin: start, StartTimeMax: end}, expectedErr: ErrDurationOperationNotSet},
+		{query: DurationQueryParameters{ServiceName: "svc", OperationName: "GET", StartTimeMin: start}, expectedErr: ErrStatsTimeRangeNotSet},
+		{query: DurationQueryParameters{ServiceName: "svc", OperationName: "GET", StartTimeMin: end, StartTimeMax: start}, expectedErr: ErrStatsStartTimeMinGreaterThanMax},
+		{query: DurationQueryParameters{ServiceName: "svc", OperationName: "GET", StartTimeMin: start, StartTimeMax: end,
+			DurationMin: time.Second, DurationMax: time.Millisecond}, expectedErr: ErrDurationMinGreaterThanMax},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expectedErr, testCase.query.Validate())
+	}
+}
+
+func TestDurationPercentilesBuilder(t *testing.T) {
+	process := &model.Process{ServiceName: "frontend", Tags: model.KeyValues{model.String("region", "us-east-1")}}
+	query := &DurationQueryParameters{
+		ServiceName:   "frontend",
+		OperationName: "GET",
+		Tags:          map[string]string{"region": "us-east-1"},
+		StartTimeMin:  time.Unix(100, 0),
+		StartTimeMax:  time.Unix(200, 0),
+	}
+	builder := NewDurationPercentilesBuilder(query)
+	assert.Equal(t, &DurationPercentiles{}, builder.Percentiles())
+
+	var spans []*model.Span
+	for i := 1; i <= 100; i++ {
+		spans = append(spans, &model.Span{
+			Process:       process,
+			OperationName: "GET",
+			StartTime:     time.Unix(150, 0),
+			Duration:      time.Duration(i) * time.Millisecond,
+		})
+	}
+	spans = append(spans,
+		&model.Span{Process: process, OperationName: "POST", StartTime: time.Unix(150, 0), Duration: time.Hour},
+		&model.Span{Process: process, OperationName: "GET", StartTime: time.Unix(250, 0), Duration: time.Hour},
+		&model.Span{Process: &model.Process{ServiceName: "frontend"}, OperationName: "GET", StartTime: time.Unix(150, 0), Duration: time.Hour},
+	)
+	builder.AddTrace(&model.Trace{Spans: spans})
+	assert.Equal(t, &DurationPercentiles{
+		Spans: 100,
+		P50:   50 * time.Millisecond,
+		P90:   90 * time.Millisecond,
+		P99:   99 * time.Millisecond,
+	}, builder.Percentiles())
+
+	query.DurationMax = 10 * time.Millisecond
+	builder = NewDurationPercentilesBuilder(query)
+	builder.AddTrace(&model.Trace{Spans: spans})
+	builder.Sample()
+	assert.Equal(t, &DurationPercentiles{
+		Spans:   10,
+		P50:     5 * time.Millisecond,
+		P90:     9 * time.Millisecond,
+		P99:     10 * time.Millisecond,
+		Sampled: true,
+	}, builder.Percentiles())
+}
+
+func TestSampledDurationReader(t *testing.T) {
+	store := memory.NewStore()
+	for i := uint64(1); i <= 4; i++ {
+		span := testSpan(i, i, "a")
+		span.OperationName = "GET"
+		span.Duration = time.Duration(i) * time.Second
+		require.NoError(t, store.WriteSpan(span))
+	}
+	query := &DurationQueryParameters{
+		ServiceName:   "a",
+		OperationName: "GET",
+		StartTimeMin:  time.Unix(0, 0).Add(-time.Hour),
+		StartTimeMax:  time.Unix(0, 0).Add(time.Hour),
+		MaxTraces:     10,
+	}
+	reader := NewSampledDurationReader(store)
+	percentiles, err := reader.GetDurationPercentiles(query)
+	require.NoError(t, err)
+	assert.Equal(t, &DurationPercentiles{Spans: 4, P50: 2 * time.Second, P90: 4 * time.Second, P99: 4 * time.Second}, percentiles)
+
+	query.MaxTraces = 2
+	percentiles, err = reader.GetDurationPercentiles(query)
+	require.NoError(t, err)
+	assert.Equal(t, 2, percentiles.Spans)
+	assert.True(t, percentiles.Sampled)
+
+	_, err = reader.GetDurationPercentiles(&DurationQueryParameters{ServiceName: "a"})
+	assert.Equal(t, ErrDurationOperationNotSet, err)
+
+	failing := &mocks.Reader{}
+	failing.On("FindTraces", query.TraceQuery()).Return(nil, errors.New("unavailable"))
+	_, err = NewSampledDurationReader(failing).GetDurationPercentiles(query)
+	assert.EqualError(t, err, "unavailable")
+}
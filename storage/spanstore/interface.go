@@ -28,16 +28,60 @@ import (
 )
 
 // Writer writes spans to storage.
+//
+// This is the contract of the third-party storages plugged into the collector with
+// builder.Options.CustomStorageOption:
+//   - WriteSpan is called concurrently by the workers of the span processor, and must be safe for
+//     concurrent use. The spans of a trace may arrive in any order and in different calls, possibly
+//     from different collectors, so the storage must not expect the root span first nor the spans of
+//     a trace together.
+//   - The span must not be modified, nor retained after WriteSpan returns unless copied, since it
+//     may be shared with other writers, e.g. the routes or the secondary storages.
+//   - A nil error means that the span is durably stored, or accepted for storage if the writer
+//     buffers spans, in which case it should also implement io.Closer to flush them on shutdown.
+//   - ErrSpanBuffered means that the storage is unavailable and the span is kept in memory to be
+//     written once it recovers. The collector counts the span as buffered rather than saved.
+//   - An error means that the span was not stored. It is counted and logged by the collector, which
+//     does not retry the span itself, so a transient failure can only be retried by the writer.
+//   - The same span may be written more than once, e.g. when resent by its client, and should then
+//     overwrite the stored one rather than be stored twice.
 type Writer interface {
 	WriteSpan(span *model.Span) error
 }
 
+// Prober is optionally implemented by the span storages that can check that they are reachable,
+// so that the health check of the collector and the start of the query service can probe them.
+type Prober interface {
+	Probe() error
+}
+
+// Flusher is optionally implemented by the span writers buffering spans, so that the spans written are known
+// to be stored once Flush returns. Flush returns an error if spans failed to be stored since the previous Flush,
+// whether by this flush or by one the writer made on its own.
+type Flusher interface {
+	Flush() error
+}
+
 var (
 	// ErrTraceNotFound is returned by Reader's GetTrace if no data is found for given trace ID.
 	ErrTraceNotFound = errors.New("trace not found")
+
+	// ErrSpanBuffered is returned by WriteSpan when the span is kept to be written once the storage recovers
+	ErrSpanBuffered = errors.New("The span is buffered until the storage recovers")
 )
 
 // Reader finds and loads traces and other data from storage.
+//
+// This is the contract of the third-party storages the query service reads from:
+//   - All methods are called concurrently by the handlers of the query service.
+//   - GetTrace returns all the stored spans of the trace, in any order, or ErrTraceNotFound if it has
+//     none. The query service adjusts the spans, e.g. for clock skew, so they are returned as stored.
+//   - GetServices and GetOperations return the names in any order, without duplicates, and an empty
+//     list rather than an error when there is none.
+//   - FindTraces returns at most NumTraces traces with a span matching all the set parameters, each
+//     trace with all its spans. The traces are returned in any order, the query service sorting them.
+//     No traces found is an empty list, not an error.
+//   - Any other error fails the request of the query service, which does not retry it.
 type Reader interface {
 	GetTrace(traceID model.TraceID) (*model.Trace, error)
 	GetServices() ([]string, error)
@@ -49,10 +93,12 @@ type Reader interface {
 type TraceQueryParameters struct {
 	ServiceName   string
 	OperationName string
-	Tags          map[string]string
-	StartTimeMin  time.Time
-	StartTimeMax  time.Time
-	DurationMin   time.Duration
-	DurationMax   time.Duration
-	NumTraces     int
+	// SpanKind restricts the query to the spans of that kind when it is set
+	SpanKind     model.SpanKind
+	Tags         map[string]string
+	StartTimeMin time.Time
+	StartTimeMax time.Time
+	DurationMin  time.Duration
+	DurationMax  time.Duration
+	NumTraces    int
 }
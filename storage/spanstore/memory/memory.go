@@ -21,34 +21,98 @@
 package memory
 
 import (
-	"errors"
+	"container/list"
 	"sync"
 	"time"
 
+	"github.com/uber/jaeger-lib/metrics"
+
 	"github.com/uber/jaeger/model"
 	"github.com/uber/jaeger/model/adjuster"
 	"github.com/uber/jaeger/storage/spanstore"
 )
 
-var errTraceNotFound = errors.New("Trace was not found")
+// errTraceNotFound is the error of every Reader, so that wrappers like the ShardedReader recognize it
+var errTraceNotFound = spanstore.ErrTraceNotFound
 
-// Store is an unbounded in-memory store of traces
+// Store is an in-memory store of traces, unbounded unless created with Options.MaxTraces
 type Store struct {
-	// TODO: make this a bounded memory store
 	sync.RWMutex
-	traces     map[model.TraceID]*model.Trace
-	services   map[string]struct{}
-	operations map[string]map[string]struct{}
+	traces map[model.TraceID]*model.Trace
+	// operations counts the spans in the store by service and operation, so that the services and
+	// operations of the evicted and deleted spans are forgotten with their last span
+	operations map[string]map[string]int
 	deduper    adjuster.Adjuster
+	options    options
+	metrics    storeMetrics
+	// recentlyWritten holds the trace IDs from the most to the least recently written
+	recentlyWritten *list.List
+	writtenElements map[model.TraceID]*list.Element
+}
+
+type storeMetrics struct {
+	// Traces is the number of traces currently in the store
+	Traces metrics.Gauge `metric:"traces"`
+	// EvictedTraces is the number of traces evicted because the store was full
+	EvictedTraces metrics.Counter `metric:"evicted-traces"`
 }
 
 // NewStore creates an in-memory store
-func NewStore() *Store {
-	return &Store{
-		traces:     map[model.TraceID]*model.Trace{},
-		services:   map[string]struct{}{},
-		operations: map[string]map[string]struct{}{},
-		deduper:    adjuster.SpanIDDeduper(),
+func NewStore(opts ...Option) *Store {
+	m := &Store{
+		traces:          map[model.TraceID]*model.Trace{},
+		operations:      map[string]map[string]int{},
+		deduper:         adjuster.SpanIDDeduper(),
+		recentlyWritten: list.New(),
+		writtenElements: map[model.TraceID]*list.Element{},
+	}
+	m.Configure(opts...)
+	return m
+}
+
+// Configure applies the given options on top of the current ones. Traces beyond a lowered
+// MaxTraces are evicted right away. The traces of a new SnapshotPath are loaded.
+func (m *Store) Configure(opts ...Option) {
+	m.Lock()
+	defer m.Unlock()
+	previousSnapshotPath := m.options.snapshotPath
+	m.options = m.options.apply(opts...)
+	metrics.Init(&m.metrics, m.options.metricsFactory, nil)
+	if m.options.snapshotPath != "" && m.options.snapshotPath != previousSnapshotPath {
+		m.loadSnapshot()
+	}
+	m.evict()
+	m.metrics.Traces.Update(int64(len(m.traces)))
+}
+
+// evict removes the least recently written traces until the store is within its limit, and the
+// services and operations left without spans. Traces are always removed as a whole so that
+// queries never return partial traces.
+func (m *Store) evict() {
+	if m.options.maxTraces == 0 {
+		return
+	}
+	for len(m.traces) > m.options.maxTraces {
+		oldest := m.recentlyWritten.Back()
+		traceID := m.recentlyWritten.Remove(oldest).(model.TraceID)
+		delete(m.writtenElements, traceID)
+		for _, span := range m.traces[traceID].Spans {
+			m.forgetOperation(span)
+		}
+		delete(m.traces, traceID)
+		m.metrics.EvictedTraces.Inc(1)
+	}
+}
+
+// forgetOperation uncounts the span from its service and operation, holding the lock
+func (m *Store) forgetOperation(span *model.Span) {
+	operations := m.operations[span.Process.ServiceName]
+	if operations[span.OperationName]--; operations[span.OperationName] > 0 {
+		return
+	}
+	delete(operations, span.OperationName)
+	if len(operations) == 0 {
+		delete(m.operations, span.Process.ServiceName)
 	}
 }
 
@@ -112,17 +176,88 @@ func (m *Store) traceIsBetweenStartAndEnd(startTs, endTs time.Time, trace *model
 func (m *Store) WriteSpan(span *model.Span) error {
 	m.Lock()
 	defer m.Unlock()
+	m.writeSpan(span)
+	m.evict()
+	m.metrics.Traces.Update(int64(len(m.traces)))
+
+	return nil
+}
+
+// writeSpan adds the span to its trace, holding the lock
+func (m *Store) writeSpan(span *model.Span) {
 	if _, ok := m.operations[span.Process.ServiceName]; !ok {
-		m.operations[span.Process.ServiceName] = map[string]struct{}{}
+		m.operations[span.Process.ServiceName] = map[string]int{}
 	}
-	m.operations[span.Process.ServiceName][span.OperationName] = struct{}{}
-	m.services[span.Process.ServiceName] = struct{}{}
+	m.operations[span.Process.ServiceName][span.OperationName]++
 	if _, ok := m.traces[span.TraceID]; !ok {
 		m.traces[span.TraceID] = &model.Trace{}
 	}
 	m.traces[span.TraceID].Spans = append(m.traces[span.TraceID].Spans, span)
+	if element, ok := m.writtenElements[span.TraceID]; ok {
+		m.recentlyWritten.MoveToFront(element)
+	} else {
+		m.writtenElements[span.TraceID] = m.recentlyWritten.PushFront(span.TraceID)
+	}
+}
 
-	return nil
+// Close writes the traces to the snapshot file if the store was configured with a SnapshotPath,
+// so that they are loaded by the next store. The store can still be used.
+func (m *Store) Close() error {
+	m.RLock()
+	defer m.RUnlock()
+	if m.options.snapshotPath == "" {
+		return nil
+	}
+	return m.saveSnapshot()
+}
+
+// DeleteSpans deletes the spans matching the query, and the traces left without spans
+func (m *Store) DeleteSpans(query *spanstore.DeleteQueryParameters) (int, error) {
+	if err := query.Validate(); err != nil {
+		return 0, err
+	}
+	m.Lock()
+	defer m.Unlock()
+	deleted := 0
+	for traceID, trace := range m.traces {
+		var kept []*model.Span
+		for _, span := range trace.Spans {
+			if query.Matches(span) {
+				deleted++
+				m.forgetOperation(span)
+			} else {
+				kept = append(kept, span)
+			}
+		}
+		if len(kept) == len(trace.Spans) {
+			continue
+		}
+		if len(kept) > 0 {
+			trace.Spans = kept
+			continue
+		}
+		delete(m.traces, traceID)
+		if element, ok := m.writtenElements[traceID]; ok {
+			m.recentlyWritten.Remove(element)
+			delete(m.writtenElements, traceID)
+		}
+	}
+	m.metrics.Traces.Update(int64(len(m.traces)))
+	return deleted, nil
+}
+
+// GetTraceStats implements spanstore.StatsReader, scanning all the traces of the store
+func (m *Store) GetTraceStats(query *spanstore.StatsQueryParameters) (*spanstore.TraceStats, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	m.RLock()
+	defer m.RUnlock()
+	builder := spanstore.NewTraceStatsBuilder(query)
+	for _, trace := range m.traces {
+		builder.AddTrace(trace)
+	}
+	return builder.Stats(), nil
 }
 
 // GetTrace gets a trace
@@ -141,7 +276,7 @@ func (m *Store) GetServices() ([]string, error) {
 	m.RLock()
 	defer m.RUnlock()
 	var retMe []string
-	for k := range m.services {
+	for k := range m.operations {
 		retMe = append(retMe, k)
 	}
 	return retMe, nil
@@ -193,6 +328,9 @@ func (m *Store) validSpan(span *model.Span, query *spanstore.TraceQueryParameter
 	if query.OperationName != "" && query.OperationName != span.OperationName {
 		return false
 	}
+	if query.SpanKind != "" && query.SpanKind != span.GetSpanKind() {
+		return false
+	}
 	if query.DurationMin != 0 && span.Duration < query.DurationMin {
 		return false
 	}
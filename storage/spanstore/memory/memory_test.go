@@ -25,6 +25,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-lib/metrics"
 
 	"github.com/uber/jaeger/model"
 	"github.com/uber/jaeger/storage/spanstore"
@@ -253,6 +254,18 @@ func TestStoreGetTrace(t *testing.T) {
 				OperationName: "wrongOperationName",
 			}, false,
 		},
+		{
+			&spanstore.TraceQueryParameters{
+				ServiceName: testingSpan.Process.ServiceName,
+				SpanKind:    model.SpanKindUnspecified,
+			}, true,
+		},
+		{
+			&spanstore.TraceQueryParameters{
+				ServiceName: testingSpan.Process.ServiceName,
+				SpanKind:    model.SpanKindServer,
+			}, false,
+		},
 		{
 			&spanstore.TraceQueryParameters{
 				ServiceName: testingSpan.Process.ServiceName,
@@ -310,3 +323,152 @@ func TestStoreGetTrace(t *testing.T) {
 		})
 	}
 }
+
+func newSpanInTrace(traceID uint64, spanID uint64) *model.Span {
+	return &model.Span{
+		TraceID:       model.TraceID{Low: traceID},
+		SpanID:        model.SpanID(spanID),
+		Process:       &model.Process{ServiceName: "serviceName"},
+		OperationName: "operationName",
+	}
+}
+
+func TestStoreEvictsLeastRecentlyWrittenTraces(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	store := NewStore(Options.MaxTraces(2), Options.MetricsFactory(metricsFactory))
+	assert.NoError(t, store.WriteSpan(newSpanInTrace(1, 1)))
+	assert.NoError(t, store.WriteSpan(newSpanInTrace(2, 1)))
+	// trace 1 becomes the most recently written
+	assert.NoError(t, store.WriteSpan(newSpanInTrace(1, 2)))
+	assert.NoError(t, store.WriteSpan(newSpanInTrace(3, 1)))
+
+	_, err := store.GetTrace(model.TraceID{Low: 2})
+	assert.EqualError(t, err, errTraceNotFound.Error())
+	trace, err := store.GetTrace(model.TraceID{Low: 1})
+	assert.NoError(t, err)
+	assert.Len(t, trace.Spans, 2, "traces are kept complete")
+	_, err = store.GetTrace(model.TraceID{Low: 3})
+	assert.NoError(t, err)
+
+	counters, gauges := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counters["evicted-traces"])
+	assert.EqualValues(t, 2, gauges["traces"])
+}
+
+func TestStoreEvictsServicesAndOperations(t *testing.T) {
+	store := NewStore(Options.MaxTraces(1))
+	span := newSpanInTrace(1, 1)
+	span.Process = &model.Process{ServiceName: "evicted"}
+	assert.NoError(t, store.WriteSpan(span))
+	span = newSpanInTrace(2, 1)
+	span.OperationName = "other"
+	assert.NoError(t, store.WriteSpan(span))
+	span = newSpanInTrace(3, 1)
+	assert.NoError(t, store.WriteSpan(span))
+
+	services, err := store.GetServices()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"serviceName"}, services)
+	operations, err := store.GetOperations("serviceName")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"operationName"}, operations)
+	operations, err = store.GetOperations("evicted")
+	assert.NoError(t, err)
+	assert.Empty(t, operations)
+}
+
+func TestStoreConfigureLowersMaxTraces(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	store := NewStore()
+	for i := uint64(1); i <= 3; i++ {
+		assert.NoError(t, store.WriteSpan(newSpanInTrace(i, 1)))
+	}
+
+	store.Configure(Options.MaxTraces(1), Options.MetricsFactory(metricsFactory))
+	_, err := store.GetTrace(model.TraceID{Low: 3})
+	assert.NoError(t, err)
+	for i := uint64(1); i <= 2; i++ {
+		_, err := store.GetTrace(model.TraceID{Low: i})
+		assert.EqualError(t, err, errTraceNotFound.Error())
+	}
+	counters, gauges := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counters["evicted-traces"])
+	assert.EqualValues(t, 1, gauges["traces"])
+}
+
+func TestStoreUnbounded(t *testing.T) {
+	store := NewStore(Options.MaxTraces(-1))
+	for i := uint64(1); i <= 10; i++ {
+		assert.NoError(t, store.WriteSpan(newSpanInTrace(i, 1)))
+	}
+	assert.Len(t, store.traces, 10)
+}
+
+func TestStoreDeleteSpans(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	store := NewStore(Options.MetricsFactory(metricsFactory))
+	tagged := func(traceID, spanID uint64, userID string) *model.Span {
+		span := newSpanInTrace(traceID, spanID)
+		span.StartTime = time.Unix(300, 0)
+		span.Tags = model.KeyValues{model.String("user.id", userID)}
+		return span
+	}
+	assert.NoError(t, store.WriteSpan(tagged(1, 1, "x")))
+	assert.NoError(t, store.WriteSpan(tagged(1, 2, "y")))
+	assert.NoError(t, store.WriteSpan(tagged(2, 1, "x")))
+	outOfRange := tagged(3, 1, "x")
+	outOfRange.StartTime = time.Unix(900, 0)
+	assert.NoError(t, store.WriteSpan(outOfRange))
+
+	_, err := store.DeleteSpans(&spanstore.DeleteQueryParameters{StartTimeMin: time.Unix(0, 0), StartTimeMax: time.Unix(600, 0)})
+	assert.EqualError(t, err, spanstore.ErrDeleteTagsNotSet.Error())
+
+	deleted, err := store.DeleteSpans(&spanstore.DeleteQueryParameters{
+		Tags:         map[string]string{"user.id": "x"},
+		StartTimeMin: time.Unix(0, 0),
+		StartTimeMax: time.Unix(600, 0),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+
+	trace, err := store.GetTrace(model.TraceID{Low: 1})
+	assert.NoError(t, err)
+	if assert.Len(t, trace.Spans, 1) {
+		assert.Equal(t, model.SpanID(2), trace.Spans[0].SpanID)
+	}
+	_, err = store.GetTrace(model.TraceID{Low: 2})
+	assert.EqualError(t, err, errTraceNotFound.Error())
+	_, err = store.GetTrace(model.TraceID{Low: 3})
+	assert.NoError(t, err)
+	assert.Len(t, store.writtenElements, 2)
+	_, gauges := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, gauges["traces"])
+}
+
+func TestStoreGetTraceStats(t *testing.T) {
+	store := NewStore()
+	span := func(traceID, spanID uint64, failed bool) *model.Span {
+		span := newSpanInTrace(traceID, spanID)
+		span.StartTime = time.Unix(300, 0)
+		span.Tags = model.KeyValues{model.Bool("error", failed)}
+		return span
+	}
+	assert.NoError(t, store.WriteSpan(span(1, 1, false)))
+	assert.NoError(t, store.WriteSpan(span(1, 2, true)))
+	assert.NoError(t, store.WriteSpan(span(2, 1, false)))
+
+	_, err := store.GetTraceStats(&spanstore.StatsQueryParameters{StartTimeMin: time.Unix(0, 0)})
+	assert.EqualError(t, err, spanstore.ErrStatsTimeRangeNotSet.Error())
+
+	stats, err := store.GetTraceStats(&spanstore.StatsQueryParameters{
+		StartTimeMin: time.Unix(0, 0),
+		StartTimeMax: time.Unix(600, 0),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &spanstore.TraceStats{
+		Traces:     2,
+		Spans:      3,
+		ErrorSpans: 1,
+		Services:   []spanstore.ServiceStats{{ServiceName: "serviceName", Spans: 3, ErrorSpans: 1}},
+	}, stats)
+}
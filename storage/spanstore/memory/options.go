@@ -0,0 +1,85 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package memory
+
+import (
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+)
+
+type options struct {
+	maxTraces      int
+	metricsFactory metrics.Factory
+	snapshotPath   string
+	logger         *zap.Logger
+}
+
+// Option is a function that sets some option on the Store.
+type Option func(*options)
+
+// Options is a factory for all available Option's
+var Options = options{}
+
+// MaxTraces creates an Option that limits the number of traces kept by the store, the least
+// recently written traces are evicted beyond it. The store is unbounded if maxTraces is 0.
+func (options) MaxTraces(maxTraces int) Option {
+	return func(o *options) {
+		o.maxTraces = maxTraces
+	}
+}
+
+// MetricsFactory creates an Option that initializes the metrics factory of the store.
+func (options) MetricsFactory(metricsFactory metrics.Factory) Option {
+	return func(o *options) {
+		o.metricsFactory = metricsFactory
+	}
+}
+
+// SnapshotPath creates an Option that writes the traces of the store to the file on Close, and loads
+// the traces of the file when it is configured. A missing, corrupted or incompatible file is ignored.
+func (options) SnapshotPath(path string) Option {
+	return func(o *options) {
+		o.snapshotPath = path
+	}
+}
+
+// Logger creates an Option that initializes the logger of the store, used for its snapshots.
+func (options) Logger(logger *zap.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+func (o options) apply(opts ...Option) options {
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.maxTraces < 0 {
+		o.maxTraces = 0
+	}
+	if o.metricsFactory == nil {
+		o.metricsFactory = metrics.NullFactory
+	}
+	if o.logger == nil {
+		o.logger = zap.NewNop()
+	}
+	return o
+}
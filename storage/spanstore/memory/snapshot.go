@@ -0,0 +1,142 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package memory
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/model/codec"
+	"github.com/uber/jaeger/storage/spanstore/wal"
+)
+
+const (
+	// snapshotMagic starts the snapshot files, followed by the version of their layout
+	snapshotMagic = "JAEGERMS"
+	// snapshotVersion is the version of the layout written, the snapshots of other versions are not loaded.
+	// Each span is stored as an entry of the write-ahead log, its payload being serialized with a codec
+	// identified by its header byte, so that the codec can change without a new version.
+	snapshotVersion uint32 = 1
+)
+
+// saveSnapshot writes the spans to the snapshot file, from the least to the most recently written trace so
+// that the store loading them evicts the same traces. The file is replaced once written, holding the lock.
+func (m *Store) saveSnapshot() error {
+	tmpPath := m.options.snapshotPath + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if err := m.writeSnapshot(file); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, m.options.snapshotPath)
+}
+
+func (m *Store) writeSnapshot(file io.Writer) error {
+	writer := bufio.NewWriter(file)
+	header := make([]byte, len(snapshotMagic)+4)
+	copy(header, snapshotMagic)
+	binary.BigEndian.PutUint32(header[len(snapshotMagic):], snapshotVersion)
+	writer.Write(header)
+	serializer := codec.NewSerializer(metrics.NullFactory)
+	var entry []byte
+	for element := m.recentlyWritten.Back(); element != nil; element = element.Prev() {
+		for _, span := range m.traces[element.Value.(model.TraceID)].Spans {
+			payload, err := serializer.Serialize(codec.ProtobufFormat, span)
+			if err != nil {
+				return err
+			}
+			entry = wal.AppendEntry(entry[:0], payload)
+			writer.Write(entry)
+		}
+	}
+	// the errors of the writes are returned by Flush
+	return writer.Flush()
+}
+
+// loadSnapshot adds the spans of the snapshot file to the store, holding the lock. The snapshot is ignored
+// as a whole when it cannot be read, so that the store never holds a part of it.
+func (m *Store) loadSnapshot() {
+	logger := m.options.logger.With(zap.String("path", m.options.snapshotPath))
+	spans, err := readSnapshot(m.options.snapshotPath)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		logger.Warn("Ignoring the memory store snapshot, starting empty", zap.Error(err))
+		return
+	}
+	for _, span := range spans {
+		m.writeSpan(span)
+	}
+	logger.Info("Loaded the memory store snapshot", zap.Int("spans", len(spans)))
+}
+
+func readSnapshot(path string) ([]*model.Span, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	header := make([]byte, len(snapshotMagic)+4)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, fmt.Errorf("cannot read the snapshot header: %v", err)
+	}
+	if !bytes.Equal(header[:len(snapshotMagic)], []byte(snapshotMagic)) {
+		return nil, errors.New("not a memory store snapshot")
+	}
+	if version := binary.BigEndian.Uint32(header[len(snapshotMagic):]); version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d, expected %d", version, snapshotVersion)
+	}
+	serializer := codec.NewSerializer(metrics.NullFactory)
+	var spans []*model.Span
+	for {
+		payload, err := wal.ReadEntry(reader)
+		if err == io.EOF {
+			return spans, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		span, err := serializer.Deserialize(payload)
+		if err != nil {
+			return nil, err
+		}
+		spans = append(spans, span)
+	}
+}
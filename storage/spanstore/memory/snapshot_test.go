@@ -0,0 +1,123 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package memory
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/pkg/testutils"
+	"github.com/uber/jaeger/storage/spanstore/wal"
+)
+
+func withSnapshotPath(t *testing.T, test func(path string)) {
+	dir, err := ioutil.TempDir("", "jaeger-memory-snapshot")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	test(filepath.Join(dir, "snapshot"))
+}
+
+func TestStoreSnapshot(t *testing.T) {
+	withSnapshotPath(t, func(path string) {
+		store := NewStore(Options.SnapshotPath(path))
+		otherSpan := *testingSpan
+		otherSpan.TraceID = model.TraceID{Low: 3}
+		for _, span := range []*model.Span{testingSpan, childSpan1, &otherSpan} {
+			require.NoError(t, store.WriteSpan(span))
+		}
+		require.NoError(t, store.Close())
+		require.NoError(t, store.WriteSpan(childSpan2), "the store can be used once closed")
+
+		loaded := NewStore(Options.SnapshotPath(path))
+		trace, err := loaded.GetTrace(testingSpan.TraceID)
+		require.NoError(t, err)
+		require.Len(t, trace.Spans, 2)
+		assert.Equal(t, testingSpan.SpanID, trace.Spans[0].SpanID)
+		assert.Equal(t, childSpan1.SpanID, trace.Spans[1].SpanID)
+		assert.Equal(t, "childService", trace.Spans[1].Process.ServiceName)
+		services, err := loaded.GetServices()
+		require.NoError(t, err)
+		assert.Len(t, services, 2)
+		operations, err := loaded.GetOperations("childService")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"childOperationName"}, operations)
+
+		lru := NewStore(Options.MaxTraces(1), Options.SnapshotPath(path))
+		_, err = lru.GetTrace(testingSpan.TraceID)
+		assert.Error(t, err, "the least recently written trace is evicted")
+		_, err = lru.GetTrace(otherSpan.TraceID)
+		assert.NoError(t, err)
+	})
+}
+
+func TestStoreWithoutSnapshot(t *testing.T) {
+	withSnapshotPath(t, func(path string) {
+		store := NewStore(Options.SnapshotPath(path))
+		services, err := store.GetServices()
+		require.NoError(t, err)
+		assert.Empty(t, services)
+		require.NoError(t, store.Close())
+		_, err = os.Stat(path)
+		assert.NoError(t, err, "an empty snapshot is written")
+	})
+	assert.NoError(t, NewStore().Close(), "no snapshot is written without a path")
+}
+
+func TestStoreIgnoresInvalidSnapshots(t *testing.T) {
+	withSnapshotPath(t, func(path string) {
+		store := NewStore(Options.SnapshotPath(path))
+		require.NoError(t, store.WriteSpan(testingSpan))
+		require.NoError(t, store.Close())
+		valid, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+
+		otherVersion := append([]byte{}, valid...)
+		binary.BigEndian.PutUint32(otherVersion[len(snapshotMagic):], snapshotVersion+1)
+		corrupted := append([]byte{}, valid...)
+		corrupted[len(corrupted)-1]++
+		testCases := []struct {
+			name     string
+			contents []byte
+			log      string
+		}{
+			{name: "not a snapshot", contents: []byte("not a snapshot file"), log: "not a memory store snapshot"},
+			{name: "empty", contents: []byte{}, log: "cannot read the snapshot header"},
+			{name: "other version", contents: otherVersion, log: "unsupported snapshot version 2"},
+			{name: "truncated", contents: valid[:len(valid)-1], log: wal.ErrCorruptedEntry.Error()},
+			{name: "corrupted", contents: corrupted, log: wal.ErrCorruptedEntry.Error()},
+		}
+		for _, testCase := range testCases {
+			require.NoError(t, ioutil.WriteFile(path, testCase.contents, 0644))
+			logger, logBuffer := testutils.NewLogger()
+			store := NewStore(Options.Logger(logger), Options.SnapshotPath(path))
+			_, err := store.GetTrace(testingSpan.TraceID)
+			assert.Error(t, err, testCase.name)
+			assert.Contains(t, logBuffer.String(), testCase.log, testCase.name)
+		}
+	})
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// ErrorCategory is the kind of failure of a storage operation, the same for all storage backends
+type ErrorCategory string
+
+const (
+	// TimeoutError means that the storage did not answer in time, e.g. because it is overloaded
+	TimeoutError ErrorCategory = "timeout"
+	// UnavailableError means that the storage could not be reached or refused the operation until it recovers
+	UnavailableError ErrorCategory = "unavailable"
+	// SerializationError means that the data or the query sent to the storage is invalid
+	SerializationError ErrorCategory = "serialization"
+	// QuotaError means that the storage rejected the operation because a limit was reached, e.g. a rate or size limit
+	QuotaError ErrorCategory = "quota"
+	// UnknownError is the category of all the other failures
+	UnknownError ErrorCategory = "unknown"
+)
+
+// ErrorClassifier returns the category of the errors of a storage backend, and false if it does not recognize the error
+type ErrorClassifier func(err error) (ErrorCategory, bool)
+
+// ClassifyError returns the category of the error, given by the first of the classifiers which recognizes it,
+// or else by the errors common to all backends: network and context timeouts, network failures, and JSON
+// serialization failures. The error is unwrapped with errors.Cause first.
+func ClassifyError(err error, classifiers ...ErrorClassifier) ErrorCategory {
+	err = errors.Cause(err)
+	for _, classify := range classifiers {
+		if category, ok := classify(err); ok {
+			return category
+		}
+	}
+	if err == context.DeadlineExceeded {
+		return TimeoutError
+	}
+	switch e := err.(type) {
+	case *json.MarshalerError, *json.UnsupportedTypeError, *json.UnsupportedValueError:
+		return SerializationError
+	case net.Error:
+		if e.Timeout() {
+			return TimeoutError
+		}
+		return UnavailableError
+	}
+	return UnknownError
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	pkgErrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-lib/metrics"
+)
+
+type timeoutError struct{ timeout bool }
+
+func (e timeoutError) Error() string   { return "network error" }
+func (e timeoutError) Timeout() bool   { return e.timeout }
+func (e timeoutError) Temporary() bool { return false }
+
+var _ net.Error = timeoutError{}
+
+func TestClassifyError(t *testing.T) {
+	errQuota := errors.New("quota")
+	classifier := func(err error) (ErrorCategory, bool) {
+		return QuotaError, err == errQuota
+	}
+	_, jsonErr := json.Marshal(make(chan int))
+	testCases := []struct {
+		err      error
+		expected ErrorCategory
+	}{
+		{err: errQuota, expected: QuotaError},
+		{err: pkgErrors.Wrap(errQuota, "failed"), expected: QuotaError},
+		{err: context.DeadlineExceeded, expected: TimeoutError},
+		{err: timeoutError{timeout: true}, expected: TimeoutError},
+		{err: timeoutError{}, expected: UnavailableError},
+		{err: jsonErr, expected: SerializationError},
+		{err: errors.New("other"), expected: UnknownError},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, ClassifyError(testCase.err, classifier), testCase.err.Error())
+	}
+}
+
+func TestEmitErrorCategories(t *testing.T) {
+	mf := metrics.NewLocalFactory(0)
+	tm := NewWriteMetrics(mf, "a_table")
+	errQuota := errors.New("quota")
+	classifier := func(err error) (ErrorCategory, bool) {
+		return QuotaError, err == errQuota
+	}
+	tm.Emit(errQuota, time.Millisecond, classifier)
+	tm.Emit(context.DeadlineExceeded, time.Millisecond, classifier)
+	tm.EmitError(SerializationError)
+	tm.EmitError(UnavailableError)
+	counts, _ := mf.Snapshot()
+	assert.EqualValues(t, 2, counts["a_table.errors"])
+	assert.EqualValues(t, 1, counts["a_table.errors-by-category|category=quota"])
+	assert.EqualValues(t, 1, counts["a_table.errors-by-category|category=timeout"])
+	assert.EqualValues(t, 1, counts["a_table.errors-by-category|category=serialization"])
+	assert.EqualValues(t, 1, counts["a_table.errors-by-category|category=unavailable"])
+}
@@ -33,6 +33,12 @@ type WriteMetrics struct {
 	Errors     metrics.Counter `metric:"errors"`
 	LatencyOk  metrics.Timer   `metric:"latency-ok"`
 	LatencyErr metrics.Timer   `metric:"latency-err"`
+
+	TimeoutErrors       metrics.Counter `metric:"errors-by-category" tags:"category=timeout"`
+	UnavailableErrors   metrics.Counter `metric:"errors-by-category" tags:"category=unavailable"`
+	SerializationErrors metrics.Counter `metric:"errors-by-category" tags:"category=serialization"`
+	QuotaErrors         metrics.Counter `metric:"errors-by-category" tags:"category=quota"`
+	UnknownErrors       metrics.Counter `metric:"errors-by-category" tags:"category=unknown"`
 }
 
 // NewWriteMetrics takes a metrics scope and creates a metrics struct
@@ -43,13 +49,31 @@ func NewWriteMetrics(factory metrics.Factory, tableName string) *WriteMetrics {
 }
 
 // Emit will record success or failure counts and latency metrics depending on the passed error.
-func (t *WriteMetrics) Emit(err error, latency time.Duration) {
+// Failures are also counted by category, as given by ClassifyError with the classifiers of the storage backend.
+func (t *WriteMetrics) Emit(err error, latency time.Duration, classifiers ...ErrorClassifier) {
 	t.Attempts.Inc(1)
 	if err != nil {
 		t.LatencyErr.Record(latency)
 		t.Errors.Inc(1)
+		t.EmitError(ClassifyError(err, classifiers...))
 	} else {
 		t.LatencyOk.Record(latency)
 		t.Inserts.Inc(1)
 	}
 }
+
+// EmitError counts a failure of the given category, without counting an attempt
+func (t *WriteMetrics) EmitError(category ErrorCategory) {
+	switch category {
+	case TimeoutError:
+		t.TimeoutErrors.Inc(1)
+	case UnavailableError:
+		t.UnavailableErrors.Inc(1)
+	case SerializationError:
+		t.SerializationErrors.Inc(1)
+	case QuotaError:
+		t.QuotaErrors.Inc(1)
+	default:
+		t.UnknownErrors.Inc(1)
+	}
+}
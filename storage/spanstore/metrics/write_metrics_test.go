@@ -55,6 +55,7 @@ func TestTableEmit(t *testing.T) {
 			counts: map[string]int64{
 				"a_table.attempts": 1,
 				"a_table.errors":   1,
+				"a_table.errors-by-category|category=unknown": 1,
 			},
 			gauges: map[string]int64{
 				"a_table.latency-err.P999": 51,
@@ -0,0 +1,54 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package mocks
+
+import mock "github.com/stretchr/testify/mock"
+import spanstore "github.com/uber/jaeger/storage/spanstore"
+
+// StatsReader is an autogenerated mock type for the StatsReader type
+type StatsReader struct {
+	mock.Mock
+}
+
+// GetTraceStats provides a mock function with given fields: query
+func (_m *StatsReader) GetTraceStats(query *spanstore.StatsQueryParameters) (*spanstore.TraceStats, error) {
+	ret := _m.Called(query)
+
+	var r0 *spanstore.TraceStats
+	if rf, ok := ret.Get(0).(func(*spanstore.StatsQueryParameters) *spanstore.TraceStats); ok {
+		r0 = rf(query)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*spanstore.TraceStats)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*spanstore.StatsQueryParameters) error); ok {
+		r1 = rf(query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+var _ spanstore.StatsReader = (*StatsReader)(nil)
@@ -0,0 +1,80 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+)
+
+// DefaultRouteName is the destination the spans matching no Route are counted under
+const DefaultRouteName = "default"
+
+// Route directs the spans with a tag to a span Writer, e.g. the spans tagged error=true to a long-retention storage
+type Route struct {
+	// Name identifies the destination in the metrics
+	Name string
+	// Tag is the key of the span tag the route matches
+	Tag string
+	// Value is the value of the tag as a string, e.g. "true" for a boolean tag
+	Value string
+	// Writer saves the matched spans
+	Writer Writer
+}
+
+// RoutingWriter is a span Writer that saves each span into the Writer of the first Route matching its tags,
+// or into the default Writer if none does. Spans are routed individually: the spans of a trace only some
+// of which carry the tag are split between the destinations, and the trace is only complete when read
+// from all of them.
+type RoutingWriter struct {
+	defaultWriter Writer
+	routes        []Route
+	routed        []metrics.Counter
+	unrouted      metrics.Counter
+}
+
+// NewRoutingWriter creates a RoutingWriter. It counts the spans of each destination in the routed-spans
+// counter of the metrics factory, tagged with the Name of the route or DefaultRouteName.
+func NewRoutingWriter(defaultWriter Writer, routes []Route, metricsFactory metrics.Factory) *RoutingWriter {
+	w := &RoutingWriter{
+		defaultWriter: defaultWriter,
+		routes:        routes,
+		routed:        make([]metrics.Counter, len(routes)),
+		unrouted:      metricsFactory.Counter("routed-spans", map[string]string{"destination": DefaultRouteName}),
+	}
+	for i, route := range routes {
+		w.routed[i] = metricsFactory.Counter("routed-spans", map[string]string{"destination": route.Name})
+	}
+	return w
+}
+
+// WriteSpan calls WriteSpan on the Writer of the span's route
+func (w *RoutingWriter) WriteSpan(span *model.Span) error {
+	for i, route := range w.routes {
+		if tag, ok := span.Tags.FindByKey(route.Tag); ok && tag.AsString() == route.Value {
+			w.routed[i].Inc(1)
+			return route.Writer.WriteSpan(span)
+		}
+	}
+	w.unrouted.Inc(1)
+	return w.defaultWriter.WriteSpan(span)
+}
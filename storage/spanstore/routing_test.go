@@ -0,0 +1,73 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+
+	"github.com/uber/jaeger/model"
+	. "github.com/uber/jaeger/storage/spanstore"
+	"github.com/uber/jaeger/storage/spanstore/memory"
+)
+
+func TestRoutingWriter(t *testing.T) {
+	metricsFactory := metrics.NewLocalFactory(0)
+	short := memory.NewStore()
+	errorStore := memory.NewStore()
+	debug := memory.NewStore()
+	w := NewRoutingWriter(short, []Route{
+		{Name: "errors", Tag: "error", Value: "true", Writer: errorStore},
+		{Name: "debug", Tag: "debug", Value: "1", Writer: debug},
+	}, metricsFactory)
+
+	span := func(traceID uint64, tags ...model.KeyValue) *model.Span {
+		return &model.Span{
+			TraceID: model.TraceID{Low: traceID},
+			SpanID:  model.SpanID(len(tags) + 1),
+			Tags:    tags,
+			Process: &model.Process{ServiceName: "svc"},
+		}
+	}
+	require.NoError(t, w.WriteSpan(span(1, model.Bool("error", true), model.Int64("debug", 1))))
+	require.NoError(t, w.WriteSpan(span(2, model.Int64("debug", 1))))
+	require.NoError(t, w.WriteSpan(span(3, model.Bool("error", false))))
+	require.NoError(t, w.WriteSpan(span(4)))
+
+	_, err := errorStore.GetTrace(model.TraceID{Low: 1})
+	assert.NoError(t, err, "the first matching route is used")
+	_, err = debug.GetTrace(model.TraceID{Low: 2})
+	assert.NoError(t, err)
+	_, err = short.GetTrace(model.TraceID{Low: 3})
+	assert.NoError(t, err)
+	_, err = short.GetTrace(model.TraceID{Low: 4})
+	assert.NoError(t, err)
+	_, err = short.GetTrace(model.TraceID{Low: 1})
+	assert.Error(t, err)
+
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counters["routed-spans|destination=errors"])
+	assert.EqualValues(t, 1, counters["routed-spans|destination=debug"])
+	assert.EqualValues(t, 2, counters["routed-spans|destination=default"])
+}
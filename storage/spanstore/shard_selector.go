@@ -0,0 +1,110 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/uber/jaeger/model"
+)
+
+// ShardingScheme is the algorithm picking the shard that stores the spans of a trace
+type ShardingScheme string
+
+const (
+	// ModuloSharding picks the shard from the trace ID hash modulo the number of shards. It is the cheapest,
+	// but changing the number of shards moves most traces to another shard.
+	ModuloSharding ShardingScheme = "modulo"
+	// RendezvousSharding picks the shard with the highest hash of the trace ID combined with the shard name.
+	// Adding or removing a shard only moves the traces of that shard, in proportion of 1/n of all traces.
+	RendezvousSharding ShardingScheme = "rendezvous"
+)
+
+var errNoShards = errors.New("No shards to select from")
+
+// ShardSelector picks the shard storing the spans of a trace, which must always be the same
+// for a given trace ID so that the trace can be reassembled
+type ShardSelector interface {
+	Select(traceID model.TraceID) int
+}
+
+// NewShardSelector creates the ShardSelector of the scheme for the named shards, whose
+// order determines the index returned by Select
+func NewShardSelector(scheme ShardingScheme, shards []string) (ShardSelector, error) {
+	if len(shards) == 0 {
+		return nil, errNoShards
+	}
+	switch scheme {
+	case ModuloSharding:
+		return moduloSelector(len(shards)), nil
+	case RendezvousSharding:
+		selector := make(rendezvousSelector, len(shards))
+		for i, shard := range shards {
+			h := fnv.New64a()
+			h.Write([]byte(shard))
+			selector[i] = h.Sum64()
+		}
+		return selector, nil
+	}
+	return nil, fmt.Errorf("Unknown sharding scheme %q", scheme)
+}
+
+type moduloSelector int
+
+func (s moduloSelector) Select(traceID model.TraceID) int {
+	return int(hashTraceID(traceID) % uint64(s))
+}
+
+// rendezvousSelector holds the hash of each shard name
+type rendezvousSelector []uint64
+
+func (s rendezvousSelector) Select(traceID model.TraceID) int {
+	traceHash := hashTraceID(traceID)
+	selected, maxScore := 0, uint64(0)
+	for i, shardHash := range s {
+		if score := mix(shardHash ^ traceHash); i == 0 || score > maxScore {
+			selected, maxScore = i, score
+		}
+	}
+	return selected
+}
+
+func hashTraceID(traceID model.TraceID) uint64 {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], traceID.High)
+	binary.BigEndian.PutUint64(b[8:], traceID.Low)
+	h := fnv.New64a()
+	h.Write(b[:])
+	return h.Sum64()
+}
+
+// mix is the finalizer of SplitMix64, spreading the combined hashes so that their scores are independent
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/jaeger/model"
+	. "github.com/uber/jaeger/storage/spanstore"
+)
+
+func shardNames(n int) []string {
+	var names []string
+	for i := 0; i < n; i++ {
+		names = append(names, fmt.Sprintf("10.0.0.%d", i))
+	}
+	return names
+}
+
+func TestNewShardSelectorErrors(t *testing.T) {
+	_, err := NewShardSelector(RendezvousSharding, nil)
+	assert.EqualError(t, err, "No shards to select from")
+	_, err = NewShardSelector("consistent", shardNames(2))
+	assert.EqualError(t, err, `Unknown sharding scheme "consistent"`)
+}
+
+func TestShardSelectorDistribution(t *testing.T) {
+	for _, scheme := range []ShardingScheme{ModuloSharding, RendezvousSharding} {
+		t.Run(string(scheme), func(t *testing.T) {
+			selector, err := NewShardSelector(scheme, shardNames(4))
+			require.NoError(t, err)
+			counts := make([]int, 4)
+			for i := uint64(0); i < 4000; i++ {
+				traceID := model.TraceID{Low: i * 7919, High: i}
+				shard := selector.Select(traceID)
+				assert.Equal(t, shard, selector.Select(traceID), "the shard of a trace must be stable")
+				counts[shard]++
+			}
+			for shard, count := range counts {
+				assert.InDelta(t, 1000, count, 200, "shard %d", shard)
+			}
+		})
+	}
+}
+
+func TestRendezvousShardingAddShard(t *testing.T) {
+	before, err := NewShardSelector(RendezvousSharding, shardNames(4))
+	require.NoError(t, err)
+	after, err := NewShardSelector(RendezvousSharding, shardNames(5))
+	require.NoError(t, err)
+	moved := 0
+	for i := uint64(0); i < 5000; i++ {
+		traceID := model.TraceID{Low: i * 7919}
+		if shard := after.Select(traceID); shard != before.Select(traceID) {
+			assert.Equal(t, 4, shard, "traces may only move to the new shard")
+			moved++
+		}
+	}
+	// about 1/5 of the traces move to the new shard
+	assert.InDelta(t, 1000, moved, 200)
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/pkg/multierror"
+)
+
+// ShardedWriter is a span Writer that saves all spans of a trace into the same underlying span Writer
+type ShardedWriter struct {
+	selector ShardSelector
+	shards   []Writer
+}
+
+// NewShardedWriter creates a ShardedWriter, the selector picks the index of the shard among the writers
+func NewShardedWriter(selector ShardSelector, shards ...Writer) *ShardedWriter {
+	return &ShardedWriter{
+		selector: selector,
+		shards:   shards,
+	}
+}
+
+// WriteSpan calls WriteSpan on the shard of the span's trace
+func (w *ShardedWriter) WriteSpan(span *model.Span) error {
+	return w.shards[w.selector.Select(span.TraceID)].WriteSpan(span)
+}
+
+// ShardedReader is a span Reader that loads traces from the shards written by a ShardedWriter.
+// Traces are looked up in the other shards when missing from the selected one, since they were
+// written to another shard if the shards changed since.
+type ShardedReader struct {
+	selector ShardSelector
+	shards   []Reader
+}
+
+// NewShardedReader creates a ShardedReader, the selector picks the index of the shard among the readers
+func NewShardedReader(selector ShardSelector, shards ...Reader) *ShardedReader {
+	return &ShardedReader{
+		selector: selector,
+		shards:   shards,
+	}
+}
+
+// GetTrace loads the trace from its shard, or from the first other shard that has it
+func (r *ShardedReader) GetTrace(traceID model.TraceID) (*model.Trace, error) {
+	selected := r.selector.Select(traceID)
+	trace, err := r.shards[selected].GetTrace(traceID)
+	if err != ErrTraceNotFound {
+		return trace, err
+	}
+	for i, shard := range r.shards {
+		if i == selected {
+			continue
+		}
+		if trace, err := shard.GetTrace(traceID); err != ErrTraceNotFound {
+			return trace, err
+		}
+	}
+	return nil, ErrTraceNotFound
+}
+
+// GetServices returns the services of all shards
+func (r *ShardedReader) GetServices() ([]string, error) {
+	return r.union(func(shard Reader) ([]string, error) {
+		return shard.GetServices()
+	})
+}
+
+// GetOperations returns the operations of the service in all shards
+func (r *ShardedReader) GetOperations(service string) ([]string, error) {
+	return r.union(func(shard Reader) ([]string, error) {
+		return shard.GetOperations(service)
+	})
+}
+
+// forEachShard calls query on all shards in parallel and returns the errors of the shards that failed
+func (r *ShardedReader) forEachShard(query func(i int, shard Reader) error) error {
+	errs := make([]error, len(r.shards))
+	var wg sync.WaitGroup
+	wg.Add(len(r.shards))
+	for i, shard := range r.shards {
+		go func(i int, shard Reader) {
+			defer wg.Done()
+			errs[i] = query(i, shard)
+		}(i, shard)
+	}
+	wg.Wait()
+	var errors []error
+	for _, err := range errs {
+		if err != nil {
+			errors = append(errors, err)
+		}
+	}
+	return multierror.Wrap(errors)
+}
+
+func (r *ShardedReader) union(get func(shard Reader) ([]string, error)) ([]string, error) {
+	found := make([][]string, len(r.shards))
+	err := r.forEachShard(func(i int, shard Reader) error {
+		values, err := get(shard)
+		found[i] = values
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]struct{})
+	for _, values := range found {
+		for _, value := range values {
+			seen[value] = struct{}{}
+		}
+	}
+	union := make([]string, 0, len(seen))
+	for value := range seen {
+		union = append(union, value)
+	}
+	sort.Strings(union)
+	return union, nil
+}
+
+// FindTraces queries all shards in parallel, the spans of a trace found in several shards are merged
+// into one trace. The most recent traces of all shards are returned, up to query.NumTraces.
+func (r *ShardedReader) FindTraces(query *TraceQueryParameters) ([]*model.Trace, error) {
+	found := make([][]*model.Trace, len(r.shards))
+	err := r.forEachShard(func(i int, shard Reader) error {
+		traces, err := shard.FindTraces(query)
+		found[i] = traces
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var traces []*model.Trace
+	indexes := make(map[model.TraceID]int)
+	for _, shardTraces := range found {
+		for _, trace := range shardTraces {
+			if len(trace.Spans) == 0 {
+				continue
+			}
+			traceID := trace.Spans[0].TraceID
+			if i, ok := indexes[traceID]; ok {
+				// the traces returned by the shards are not modified since they may be cached
+				spans := append([]*model.Span{}, traces[i].Spans...)
+				traces[i] = &model.Trace{Spans: append(spans, trace.Spans...)}
+				continue
+			}
+			indexes[traceID] = len(traces)
+			traces = append(traces, trace)
+		}
+	}
+	sort.SliceStable(traces, func(i, j int) bool {
+		return traceStartTime(traces[i]).After(traceStartTime(traces[j]))
+	})
+	if query.NumTraces > 0 && len(traces) > query.NumTraces {
+		traces = traces[:query.NumTraces]
+	}
+	return traces, nil
+}
+
+func traceStartTime(trace *model.Trace) time.Time {
+	startTime := trace.Spans[0].StartTime
+	for _, span := range trace.Spans[1:] {
+		if span.StartTime.Before(startTime) {
+			startTime = span.StartTime
+		}
+	}
+	return startTime
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/jaeger/model"
+	. "github.com/uber/jaeger/storage/spanstore"
+	"github.com/uber/jaeger/storage/spanstore/memory"
+	"github.com/uber/jaeger/storage/spanstore/mocks"
+)
+
+// fixedSelector sends the traces with an odd ID to the second shard
+type fixedSelector struct{}
+
+func (fixedSelector) Select(traceID model.TraceID) int {
+	return int(traceID.Low % 2)
+}
+
+func testSpan(traceID uint64, spanID uint64, service string) *model.Span {
+	return &model.Span{
+		TraceID:       model.TraceID{Low: traceID},
+		SpanID:        model.SpanID(spanID),
+		OperationName: service + "-op",
+		StartTime:     time.Unix(0, 0),
+		Process:       &model.Process{ServiceName: service},
+	}
+}
+
+func TestShardedWriter(t *testing.T) {
+	even, odd := memory.NewStore(), memory.NewStore()
+	writer := NewShardedWriter(fixedSelector{}, even, odd)
+	require.NoError(t, writer.WriteSpan(testSpan(1, 1, "a")))
+	require.NoError(t, writer.WriteSpan(testSpan(1, 2, "a")))
+	require.NoError(t, writer.WriteSpan(testSpan(2, 3, "b")))
+
+	trace, err := odd.GetTrace(model.TraceID{Low: 1})
+	require.NoError(t, err)
+	assert.Len(t, trace.Spans, 2)
+	_, err = even.GetTrace(model.TraceID{Low: 1})
+	assert.Equal(t, ErrTraceNotFound, err)
+	trace, err = even.GetTrace(model.TraceID{Low: 2})
+	require.NoError(t, err)
+	assert.Len(t, trace.Spans, 1)
+}
+
+func TestShardedReaderGetTrace(t *testing.T) {
+	even, odd := memory.NewStore(), memory.NewStore()
+	require.NoError(t, odd.WriteSpan(testSpan(1, 1, "a")))
+	// written before the shards changed
+	require.NoError(t, odd.WriteSpan(testSpan(2, 2, "b")))
+	reader := NewShardedReader(fixedSelector{}, even, odd)
+
+	for _, traceID := range []uint64{1, 2} {
+		trace, err := reader.GetTrace(model.TraceID{Low: traceID})
+		require.NoError(t, err)
+		assert.Len(t, trace.Spans, 1)
+	}
+	_, err := reader.GetTrace(model.TraceID{Low: 3})
+	assert.Equal(t, ErrTraceNotFound, err)
+}
+
+func TestShardedReaderGetTraceError(t *testing.T) {
+	failing := &mocks.Reader{}
+	failing.On("GetTrace", model.TraceID{Low: 2}).Return(nil, errors.New("unavailable"))
+	reader := NewShardedReader(fixedSelector{}, failing, memory.NewStore())
+	_, err := reader.GetTrace(model.TraceID{Low: 2})
+	assert.EqualError(t, err, "unavailable")
+}
+
+func TestShardedReaderServicesAndOperations(t *testing.T) {
+	even, odd := memory.NewStore(), memory.NewStore()
+	require.NoError(t, odd.WriteSpan(testSpan(1, 1, "b")))
+	require.NoError(t, even.WriteSpan(testSpan(2, 2, "a")))
+	require.NoError(t, odd.WriteSpan(testSpan(3, 3, "a")))
+	reader := NewShardedReader(fixedSelector{}, even, odd)
+
+	services, err := reader.GetServices()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, services)
+
+	operations, err := reader.GetOperations("a")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a-op"}, operations)
+
+	failing := &mocks.Reader{}
+	failing.On("GetServices").Return(nil, errors.New("unavailable"))
+	_, err = NewShardedReader(fixedSelector{}, failing, odd).GetServices()
+	assert.EqualError(t, err, "unavailable")
+}
+
+func TestShardedReaderFindTraces(t *testing.T) {
+	even, odd := memory.NewStore(), memory.NewStore()
+	require.NoError(t, odd.WriteSpan(testSpan(1, 1, "a")))
+	require.NoError(t, even.WriteSpan(testSpan(2, 2, "a")))
+	// a trace split across shards when they changed
+	require.NoError(t, even.WriteSpan(testSpan(3, 3, "a")))
+	require.NoError(t, odd.WriteSpan(testSpan(3, 4, "a")))
+	reader := NewShardedReader(fixedSelector{}, even, odd)
+
+	query := &TraceQueryParameters{
+		ServiceName:  "a",
+		StartTimeMin: time.Unix(0, 0).Add(-time.Hour),
+		StartTimeMax: time.Unix(0, 0).Add(time.Hour),
+		NumTraces:    10,
+	}
+	traces, err := reader.FindTraces(query)
+	require.NoError(t, err)
+	require.Len(t, traces, 3)
+	spans := make(map[model.TraceID]int)
+	for _, trace := range traces {
+		spans[trace.Spans[0].TraceID] = len(trace.Spans)
+	}
+	assert.Equal(t, map[model.TraceID]int{{Low: 1}: 1, {Low: 2}: 1, {Low: 3}: 2}, spans)
+
+	query.NumTraces = 2
+	traces, err = reader.FindTraces(query)
+	require.NoError(t, err)
+	assert.Len(t, traces, 2)
+
+	failing := &mocks.Reader{}
+	failing.On("FindTraces", query).Return(nil, errors.New("unavailable"))
+	_, err = NewShardedReader(fixedSelector{}, even, failing).FindTraces(query)
+	assert.EqualError(t, err, "unavailable")
+}
+
+func TestShardedReaderFindTracesMostRecent(t *testing.T) {
+	even, odd := memory.NewStore(), memory.NewStore()
+	for i := uint64(1); i <= 4; i++ {
+		span := testSpan(i, i, "a")
+		span.StartTime = time.Unix(int64(i), 0)
+		shard := even
+		if i%2 == 1 {
+			shard = odd
+		}
+		require.NoError(t, shard.WriteSpan(span))
+	}
+	reader := NewShardedReader(fixedSelector{}, even, odd)
+
+	traces, err := reader.FindTraces(&TraceQueryParameters{
+		ServiceName:  "a",
+		StartTimeMin: time.Unix(0, 0),
+		StartTimeMax: time.Unix(10, 0),
+		NumTraces:    3,
+	})
+	require.NoError(t, err)
+	var traceIDs []uint64
+	for _, trace := range traces {
+		traceIDs = append(traceIDs, trace.Spans[0].TraceID.Low)
+	}
+	assert.Equal(t, []uint64{4, 3, 2}, traceIDs, "the most recent traces of all shards")
+}
@@ -0,0 +1,227 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/opentracing/opentracing-go/ext"
+
+	"github.com/uber/jaeger/model"
+)
+
+// DefaultStatsMaxTraces is the default number of traces of each service scanned by the storages without aggregations
+const DefaultStatsMaxTraces = 1000
+
+var (
+	// ErrStatsTimeRangeNotSet occurs when attempting to compute statistics without a time range
+	ErrStatsTimeRangeNotSet = errors.New("Start and End Time must be set to compute statistics")
+
+	// ErrStatsStartTimeMinGreaterThanMax occurs when the start time min of the statistics is above its max
+	ErrStatsStartTimeMinGreaterThanMax = errors.New("Start Time Minimum is above Maximum")
+)
+
+// StatsReader computes aggregate statistics of the stored spans, e.g. for dashboards that do not need the traces.
+type StatsReader interface {
+	// GetTraceStats returns the statistics of the spans that started within the time range of the query
+	GetTraceStats(query *StatsQueryParameters) (*TraceStats, error)
+}
+
+// StatsQueryParameters contains the parameters of the statistics of the spans that started within the time range,
+// of the given service or of all the services if empty.
+type StatsQueryParameters struct {
+	ServiceName  string
+	StartTimeMin time.Time
+	StartTimeMax time.Time
+	// MaxTraces is the number of traces of each service scanned by the storages without aggregations,
+	// DefaultStatsMaxTraces if 0
+	MaxTraces int
+}
+
+// Validate returns an error if the statistics are not restricted by a time range
+func (q *StatsQueryParameters) Validate() error {
+	if q.StartTimeMin.IsZero() || q.StartTimeMax.IsZero() {
+		return ErrStatsTimeRangeNotSet
+	}
+	if q.StartTimeMax.Before(q.StartTimeMin) {
+		return ErrStatsStartTimeMinGreaterThanMax
+	}
+	return nil
+}
+
+// Matches returns whether the span is counted by the statistics
+func (q *StatsQueryParameters) Matches(span *model.Span) bool {
+	if span.StartTime.Before(q.StartTimeMin) || span.StartTime.After(q.StartTimeMax) {
+		return false
+	}
+	return q.ServiceName == "" || (span.Process != nil && span.Process.ServiceName == q.ServiceName)
+}
+
+// TraceStats are the statistics of the spans that started within a time range
+type TraceStats struct {
+	// Traces is the number of traces with counted spans, it is approximate for large numbers in ElasticSearch
+	Traces     int
+	Spans      int
+	ErrorSpans int
+	// Services are the statistics of each service, sorted by name
+	Services []ServiceStats
+	// Truncated is set when the storage scanned only some of the traces or services, the numbers being lower bounds
+	Truncated bool
+}
+
+// ServiceStats are the statistics of the spans of a service
+type ServiceStats struct {
+	ServiceName string
+	Spans       int
+	ErrorSpans  int
+}
+
+// TraceStatsBuilder computes the statistics of the traces scanned by the storages without aggregations
+type TraceStatsBuilder struct {
+	query    *StatsQueryParameters
+	traces   map[model.TraceID]struct{}
+	services map[string]*ServiceStats
+	stats    TraceStats
+}
+
+// NewTraceStatsBuilder returns a TraceStatsBuilder of the statistics of the query
+func NewTraceStatsBuilder(query *StatsQueryParameters) *TraceStatsBuilder {
+	return &TraceStatsBuilder{
+		query:    query,
+		traces:   make(map[model.TraceID]struct{}),
+		services: make(map[string]*ServiceStats),
+	}
+}
+
+// Has returns whether the trace has already been added, so that the storages scanning the traces of each
+// service read the traces of several services once
+func (b *TraceStatsBuilder) Has(traceID model.TraceID) bool {
+	_, ok := b.traces[traceID]
+	return ok
+}
+
+// AddTrace counts the spans of the trace matching the query, unless the trace has already been added
+func (b *TraceStatsBuilder) AddTrace(trace *model.Trace) {
+	if len(trace.Spans) == 0 || b.Has(trace.Spans[0].TraceID) {
+		return
+	}
+	b.traces[trace.Spans[0].TraceID] = struct{}{}
+	counted := false
+	for _, span := range trace.Spans {
+		if !b.query.Matches(span) {
+			continue
+		}
+		counted = true
+		service := ""
+		if span.Process != nil {
+			service = span.Process.ServiceName
+		}
+		serviceStats, ok := b.services[service]
+		if !ok {
+			serviceStats = &ServiceStats{ServiceName: service}
+			b.services[service] = serviceStats
+		}
+		b.stats.Spans++
+		serviceStats.Spans++
+		if IsErrorSpan(span) {
+			b.stats.ErrorSpans++
+			serviceStats.ErrorSpans++
+		}
+	}
+	if counted {
+		b.stats.Traces++
+	}
+}
+
+// Truncate records that only some of the traces were added
+func (b *TraceStatsBuilder) Truncate() {
+	b.stats.Truncated = true
+}
+
+// Stats returns the statistics of the traces added so far
+func (b *TraceStatsBuilder) Stats() *TraceStats {
+	stats := b.stats
+	stats.Services = make([]ServiceStats, 0, len(b.services))
+	for _, serviceStats := range b.services {
+		stats.Services = append(stats.Services, *serviceStats)
+	}
+	sort.Sort(servicesByName(stats.Services))
+	return &stats
+}
+
+type shardedStatsReader []StatsReader
+
+// NewShardedStatsReader returns a StatsReader adding up the statistics of the shards of a storage, which must
+// store all the spans of a trace in the same shard for the traces not to be counted twice
+func NewShardedStatsReader(readers ...StatsReader) StatsReader {
+	return shardedStatsReader(readers)
+}
+
+// GetTraceStats implements StatsReader, failing at the first shard that fails
+func (r shardedStatsReader) GetTraceStats(query *StatsQueryParameters) (*TraceStats, error) {
+	total := &TraceStats{}
+	services := make(map[string]*ServiceStats)
+	for _, reader := range r {
+		stats, err := reader.GetTraceStats(query)
+		if err != nil {
+			return nil, err
+		}
+		total.Traces += stats.Traces
+		total.Spans += stats.Spans
+		total.ErrorSpans += stats.ErrorSpans
+		total.Truncated = total.Truncated || stats.Truncated
+		for _, serviceStats := range stats.Services {
+			sum, ok := services[serviceStats.ServiceName]
+			if !ok {
+				sum = &ServiceStats{ServiceName: serviceStats.ServiceName}
+				services[serviceStats.ServiceName] = sum
+			}
+			sum.Spans += serviceStats.Spans
+			sum.ErrorSpans += serviceStats.ErrorSpans
+		}
+	}
+	total.Services = make([]ServiceStats, 0, len(services))
+	for _, serviceStats := range services {
+		total.Services = append(total.Services, *serviceStats)
+	}
+	sort.Sort(servicesByName(total.Services))
+	return total, nil
+}
+
+type servicesByName []ServiceStats
+
+func (s servicesByName) Len() int           { return len(s) }
+func (s servicesByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s servicesByName) Less(i, j int) bool { return s[i].ServiceName < s[j].ServiceName }
+
+// IsErrorSpan returns whether the span has the error tag set to true
+func IsErrorSpan(span *model.Span) bool {
+	tag, ok := span.Tags.FindByKey(string(ext.Error))
+	if !ok {
+		return false
+	}
+	if tag.VType == model.BoolType {
+		return tag.Bool()
+	}
+	return tag.AsString() == "true"
+}
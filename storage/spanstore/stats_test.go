@@ -0,0 +1,182 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spanstore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/uber/jaeger/model"
+)
+
+func TestStatsQueryParametersValidate(t *testing.T) {
+	start := time.Unix(100, 0)
+	end := time.Unix(200, 0)
+	testCases := []struct {
+		query       StatsQueryParameters
+		expectedErr error
+	}{
+		{query: StatsQueryParameters{StartTimeMin: start, StartTimeMax: end}},
+		{query: StatsQueryParameters{ServiceName: "svc", StartTimeMin: start, StartTimeMax: end}},
+		{query: StatsQueryParameters{StartTimeMin: start}, expectedErr: ErrStatsTimeRangeNotSet},
+		{query: StatsQueryParameters{StartTimeMin: end, StartTimeMax: start}, expectedErr: ErrStatsStartTimeMinGreaterThanMax},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expectedErr, testCase.query.Validate())
+	}
+}
+
+func TestTraceStatsBuilder(t *testing.T) {
+	frontend := &model.Process{ServiceName: "frontend"}
+	backend := &model.Process{ServiceName: "backend"}
+	span := func(traceID uint64, process *model.Process, startTime int64, tags ...model.KeyValue) *model.Span {
+		return &model.Span{
+			TraceID:   model.TraceID{Low: traceID},
+			Process:   process,
+			StartTime: time.Unix(startTime, 0),
+			Tags:      tags,
+		}
+	}
+	traces := []*model.Trace{
+		{Spans: []*model.Span{
+			span(1, frontend, 150),
+			span(1, backend, 151, model.Bool("error", true)),
+			span(1, backend, 250, model.Bool("error", true)),
+		}},
+		{Spans: []*model.Span{
+			span(2, frontend, 160, model.String("error", "true")),
+			span(2, backend, 161, model.Bool("error", false)),
+		}},
+		// out of the time range
+		{Spans: []*model.Span{span(3, frontend, 50)}},
+		{},
+	}
+	testCases := []struct {
+		service  string
+		expected TraceStats
+	}{
+		{
+			expected: TraceStats{
+				Traces:     2,
+				Spans:      4,
+				ErrorSpans: 2,
+				Services: []ServiceStats{
+					{ServiceName: "backend", Spans: 2, ErrorSpans: 1},
+					{ServiceName: "frontend", Spans: 2, ErrorSpans: 1},
+				},
+			},
+		},
+		{
+			service: "backend",
+			expected: TraceStats{
+				Traces:     2,
+				Spans:      2,
+				ErrorSpans: 1,
+				Services:   []ServiceStats{{ServiceName: "backend", Spans: 2, ErrorSpans: 1}},
+			},
+		},
+		{
+			service:  "unknown",
+			expected: TraceStats{Services: []ServiceStats{}},
+		},
+	}
+	for _, testCase := range testCases {
+		builder := NewTraceStatsBuilder(&StatsQueryParameters{
+			ServiceName:  testCase.service,
+			StartTimeMin: time.Unix(100, 0),
+			StartTimeMax: time.Unix(200, 0),
+		})
+		for _, trace := range traces {
+			builder.AddTrace(trace)
+			// the traces added twice are counted once
+			builder.AddTrace(trace)
+		}
+		assert.Equal(t, &testCase.expected, builder.Stats(), testCase.service)
+	}
+}
+
+func TestTraceStatsBuilderTruncate(t *testing.T) {
+	builder := NewTraceStatsBuilder(&StatsQueryParameters{StartTimeMin: time.Unix(100, 0), StartTimeMax: time.Unix(200, 0)})
+	assert.False(t, builder.Has(model.TraceID{Low: 1}))
+	builder.AddTrace(&model.Trace{Spans: []*model.Span{{TraceID: model.TraceID{Low: 1}, StartTime: time.Unix(150, 0)}}})
+	assert.True(t, builder.Has(model.TraceID{Low: 1}))
+	builder.Truncate()
+	stats := builder.Stats()
+	assert.True(t, stats.Truncated)
+	assert.Equal(t, []ServiceStats{{Spans: 1}}, stats.Services)
+}
+
+type fixedStatsReader struct {
+	stats *TraceStats
+	err   error
+}
+
+func (r fixedStatsReader) GetTraceStats(query *StatsQueryParameters) (*TraceStats, error) {
+	return r.stats, r.err
+}
+
+func TestShardedStatsReader(t *testing.T) {
+	reader := NewShardedStatsReader(
+		fixedStatsReader{stats: &TraceStats{
+			Traces:     1,
+			Spans:      3,
+			ErrorSpans: 1,
+			Services:   []ServiceStats{{ServiceName: "frontend", Spans: 1}, {ServiceName: "backend", Spans: 2, ErrorSpans: 1}},
+		}},
+		fixedStatsReader{stats: &TraceStats{
+			Traces:    2,
+			Spans:     2,
+			Services:  []ServiceStats{{ServiceName: "backend", Spans: 2}},
+			Truncated: true,
+		}},
+	)
+	stats, err := reader.GetTraceStats(&StatsQueryParameters{})
+	assert.NoError(t, err)
+	assert.Equal(t, &TraceStats{
+		Traces:     3,
+		Spans:      5,
+		ErrorSpans: 1,
+		Services:   []ServiceStats{{ServiceName: "backend", Spans: 4, ErrorSpans: 1}, {ServiceName: "frontend", Spans: 1}},
+		Truncated:  true,
+	}, stats)
+
+	_, err = NewShardedStatsReader(reader, fixedStatsReader{err: errors.New("timeout")}).GetTraceStats(&StatsQueryParameters{})
+	assert.EqualError(t, err, "timeout")
+}
+
+func TestIsErrorSpan(t *testing.T) {
+	testCases := []struct {
+		tags     model.KeyValues
+		expected bool
+	}{
+		{tags: nil, expected: false},
+		{tags: model.KeyValues{model.Bool("error", true)}, expected: true},
+		{tags: model.KeyValues{model.Bool("error", false)}, expected: false},
+		{tags: model.KeyValues{model.String("error", "true")}, expected: true},
+		{tags: model.KeyValues{model.String("error", "no")}, expected: false},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, IsErrorSpan(&model.Span{Tags: testCase.tags}))
+	}
+}
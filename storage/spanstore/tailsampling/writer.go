@@ -0,0 +1,183 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package tailsampling provides a span Writer deciding whether to keep each trace once its spans were
+// received, so that the slow traces are kept even when they were not sampled by the clients.
+package tailsampling
+
+import (
+	"time"
+
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/storage/spanstore"
+	"github.com/uber/jaeger/storage/spanstore/batch"
+)
+
+// DefaultWindow is the default time the spans of a trace are held before deciding whether to keep it
+const DefaultWindow = 5 * time.Second
+
+// ErrWriterClosed is returned by WriteSpan once the writer is closed
+var ErrWriterClosed = batch.ErrWriterClosed
+
+// Options configure the tail sampling of a Writer
+type Options struct {
+	// Window is the time the spans of a trace are held from its first span, DefaultWindow if 0
+	Window time.Duration
+	// DurationThreshold is the duration from which a span keeps its trace though it was not sampled,
+	// only the sampled traces are kept if 0
+	DurationThreshold time.Duration
+	// RequireRoot drops the traces whose root span, the span without a parent, was not received within
+	// the window, so that only complete traces are kept rather than orphan fragments
+	RequireRoot bool
+}
+
+type samplerMetrics struct {
+	// SampledSpans counts the spans kept because their trace was sampled by the client
+	SampledSpans metrics.Counter `metric:"kept-spans" tags:"reason=sampled"`
+	// SlowSpans counts the spans kept only because their trace has a span beyond the duration threshold
+	SlowSpans metrics.Counter `metric:"kept-spans" tags:"reason=duration"`
+	// DroppedSpans counts the spans of the traces neither sampled nor slow
+	DroppedSpans metrics.Counter `metric:"dropped-spans"`
+	// OrphanSpans counts the spans dropped because the root span of their trace was not received
+	OrphanSpans metrics.Counter `metric:"orphan-spans"`
+}
+
+// decision is why the spans of a trace are kept
+type decision int
+
+const (
+	dropped decision = iota
+	sampled
+	slow
+	orphaned
+)
+
+// Writer is a span Writer holding the spans of each trace for a window, to decide whether the trace is kept.
+// A trace is kept when one of its spans is sampled, or else when one of its spans lasts at least the duration
+// threshold, overriding the decision of the client not to sample it. The spans of the other traces are dropped.
+// The spans arriving once the decision on their trace was made follow it, unless they are slow themselves.
+// With RequireRoot, the traces whose root span was not received within the window are dropped with all
+// their late spans. The spans are held by a batch.Writer, which writes the spans of a kept trace together.
+type Writer struct {
+	*batch.Writer
+}
+
+// NewWriter creates a Writer and starts deciding on the traces at the end of their window
+func NewWriter(writer spanstore.Writer, options Options, logger *zap.Logger, metricsFactory metrics.Factory) *Writer {
+	if options.Window <= 0 {
+		options.Window = DefaultWindow
+	}
+	s := &sampler{options: options}
+	metrics.Init(&s.metrics, metricsFactory.Namespace("tail-sampling", nil), nil)
+	return &Writer{
+		Writer: batch.NewWriter(writer, batch.Options{
+			Window:    options.Window,
+			Sampler:   s,
+			Namespace: "tail-sampling",
+		}, logger, metricsFactory),
+	}
+}
+
+// sampler is the batch.Sampler of a Writer
+type sampler struct {
+	options Options
+	metrics samplerMetrics
+}
+
+// SampleBatch decides on a trace whose spans were held for its window, the spans being orphans
+// if the trace must have a root span and none of them is the root
+func (s *sampler) SampleBatch(spans []*model.Span) (int, bool) {
+	d := orphaned
+	if !s.options.RequireRoot || hasRootSpan(spans) {
+		d = s.decide(spans)
+	}
+	return int(d), s.apply(d, spans)
+}
+
+// SampleLateSpan follows the decision on the trace of the span, the late spans of a dropped trace
+// whose root was received being kept if they are slow
+func (s *sampler) SampleLateSpan(span *model.Span, d int) bool {
+	spans := []*model.Span{span}
+	if decision(d) == dropped {
+		return s.apply(s.decide(spans), spans)
+	}
+	return s.apply(decision(d), spans)
+}
+
+// decide returns why the spans of a trace are kept
+func (s *sampler) decide(spans []*model.Span) decision {
+	for _, span := range spans {
+		if span.Flags.IsSampled() {
+			return sampled
+		}
+	}
+	if s.options.DurationThreshold <= 0 {
+		return dropped
+	}
+	for _, span := range spans {
+		if span.Duration >= s.options.DurationThreshold {
+			return slow
+		}
+	}
+	return dropped
+}
+
+// apply counts the spans according to the decision, returning whether they are kept
+func (s *sampler) apply(d decision, spans []*model.Span) bool {
+	switch d {
+	case sampled:
+		s.metrics.SampledSpans.Inc(int64(len(spans)))
+		return true
+	case slow:
+		s.metrics.SlowSpans.Inc(int64(len(spans)))
+		return true
+	case orphaned:
+		s.metrics.OrphanSpans.Inc(int64(len(spans)))
+	default:
+		s.metrics.DroppedSpans.Inc(int64(len(spans)))
+	}
+	return false
+}
+
+func hasRootSpan(spans []*model.Span) bool {
+	for _, span := range spans {
+		if isRootSpan(span) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRootSpan returns whether the span has neither a parent nor a reference to another span of its trace,
+// a span following from another one not being the root of the trace
+func isRootSpan(span *model.Span) bool {
+	if span.ParentSpanID != 0 {
+		return false
+	}
+	for _, ref := range span.References {
+		if ref.TraceID == span.TraceID {
+			return false
+		}
+	}
+	return true
+}
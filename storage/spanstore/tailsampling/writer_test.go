@@ -0,0 +1,206 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tailsampling
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+var _ spanstore.Writer = &Writer{} // check API conformance
+
+// sampledFlags are the flags of the spans sampled by the client
+const sampledFlags = model.Flags(1)
+
+type recordingWriter struct {
+	sync.Mutex
+	spans []*model.Span
+	err   error
+}
+
+func (w *recordingWriter) WriteSpan(span *model.Span) error {
+	w.Lock()
+	defer w.Unlock()
+	w.spans = append(w.spans, span)
+	return w.err
+}
+
+func (w *recordingWriter) spanIDs() []uint64 {
+	w.Lock()
+	defer w.Unlock()
+	ids := make([]uint64, len(w.spans))
+	for i, span := range w.spans {
+		ids[i] = uint64(span.SpanID)
+	}
+	return ids
+}
+
+func sortedIDs(ids []uint64) []uint64 {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// waitForDecisions waits until n spans were decided on at the end of the window, and the kept ones written
+func waitForDecisions(t *testing.T, metricsFactory *metrics.LocalFactory, store *recordingWriter, n int64, kept int) {
+	for i := 0; i < 100; i++ {
+		counters, _ := metricsFactory.Snapshot()
+		var decided int64
+		for _, key := range []string{
+			"tail-sampling.kept-spans|reason=sampled",
+			"tail-sampling.kept-spans|reason=duration",
+			"tail-sampling.dropped-spans",
+			"tail-sampling.orphan-spans",
+		} {
+			decided += counters[key]
+		}
+		if decided >= n && len(store.spanIDs()) >= kept {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("the traces were not decided on")
+}
+
+func testSpan(traceID, spanID uint64, flags model.Flags, duration time.Duration) *model.Span {
+	return &model.Span{
+		TraceID:  model.TraceID{Low: traceID},
+		SpanID:   model.SpanID(spanID),
+		Flags:    flags,
+		Duration: duration,
+		Process:  &model.Process{ServiceName: "service"},
+	}
+}
+
+func TestWriterDecidesByTrace(t *testing.T) {
+	store := &recordingWriter{}
+	metricsFactory := metrics.NewLocalFactory(0)
+	w := NewWriter(store, Options{Window: time.Hour, DurationThreshold: time.Second}, zap.NewNop(), metricsFactory)
+	// sampled by the client
+	require.NoError(t, w.WriteSpan(testSpan(1, 1, sampledFlags, time.Millisecond)))
+	require.NoError(t, w.WriteSpan(testSpan(1, 2, 0, time.Millisecond)))
+	// not sampled, with a slow span
+	require.NoError(t, w.WriteSpan(testSpan(2, 3, 0, time.Millisecond)))
+	require.NoError(t, w.WriteSpan(testSpan(2, 4, 0, 2*time.Second)))
+	// not sampled and fast
+	require.NoError(t, w.WriteSpan(testSpan(3, 5, 0, time.Millisecond)))
+	assert.Empty(t, store.spanIDs(), "the spans are held until the end of the window")
+	_, gauges := metricsFactory.Snapshot()
+	assert.EqualValues(t, 5, gauges["tail-sampling.pending-spans"])
+
+	require.NoError(t, w.Close())
+	assert.Len(t, store.spanIDs(), 4)
+	assert.NotContains(t, store.spanIDs(), uint64(5))
+	assert.Equal(t, ErrWriterClosed, w.WriteSpan(testSpan(4, 6, sampledFlags, 0)))
+	assert.NoError(t, w.Close())
+
+	counters, gauges := metricsFactory.Snapshot()
+	assert.EqualValues(t, 2, counters["tail-sampling.kept-spans|reason=sampled"])
+	assert.EqualValues(t, 2, counters["tail-sampling.kept-spans|reason=duration"])
+	assert.EqualValues(t, 1, counters["tail-sampling.dropped-spans"])
+	assert.EqualValues(t, 0, gauges["tail-sampling.pending-spans"])
+}
+
+func TestWriterWithoutDurationThreshold(t *testing.T) {
+	store := &recordingWriter{}
+	w := NewWriter(store, Options{Window: time.Hour}, zap.NewNop(), metrics.NullFactory)
+	require.NoError(t, w.WriteSpan(testSpan(1, 1, 0, time.Hour)))
+	require.NoError(t, w.Close())
+	assert.Empty(t, store.spanIDs())
+}
+
+func TestWriterLateSpans(t *testing.T) {
+	store := &recordingWriter{}
+	metricsFactory := metrics.NewLocalFactory(0)
+	w := NewWriter(store, Options{Window: 10 * time.Millisecond, DurationThreshold: time.Second}, zap.NewNop(), metricsFactory)
+	defer w.Close()
+	require.NoError(t, w.WriteSpan(testSpan(1, 1, 0, 2*time.Second)))
+	require.NoError(t, w.WriteSpan(testSpan(2, 2, 0, time.Millisecond)))
+	waitForDecisions(t, metricsFactory, store, 2, 1)
+	assert.Equal(t, []uint64{1}, store.spanIDs())
+
+	require.NoError(t, w.WriteSpan(testSpan(1, 3, 0, time.Millisecond)))
+	assert.Equal(t, []uint64{1, 3}, store.spanIDs(), "the late span of a kept trace is written right away")
+	require.NoError(t, w.WriteSpan(testSpan(2, 4, 0, time.Millisecond)))
+	assert.Equal(t, []uint64{1, 3}, store.spanIDs(), "the late span of a dropped trace is dropped")
+	require.NoError(t, w.WriteSpan(testSpan(2, 5, 0, 2*time.Second)))
+	assert.Equal(t, []uint64{1, 3, 5}, store.spanIDs(), "a late slow span is kept")
+
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 3, counters["tail-sampling.kept-spans|reason=duration"])
+	assert.EqualValues(t, 2, counters["tail-sampling.dropped-spans"])
+}
+
+func TestWriterRequireRoot(t *testing.T) {
+	store := &recordingWriter{}
+	metricsFactory := metrics.NewLocalFactory(0)
+	w := NewWriter(store, Options{Window: 10 * time.Millisecond, RequireRoot: true}, zap.NewNop(), metricsFactory)
+	defer w.Close()
+	// the root and its child
+	require.NoError(t, w.WriteSpan(testSpan(1, 1, sampledFlags, 0)))
+	child := testSpan(1, 2, sampledFlags, 0)
+	child.ParentSpanID = 1
+	require.NoError(t, w.WriteSpan(child))
+	// a fragment without its root
+	orphan := testSpan(2, 3, sampledFlags, 0)
+	orphan.ParentSpanID = 4
+	require.NoError(t, w.WriteSpan(orphan))
+	// a span following from a span of its trace is not a root either
+	follower := testSpan(3, 5, sampledFlags, 0)
+	follower.References = []model.SpanRef{{RefType: model.FollowsFrom, TraceID: follower.TraceID, SpanID: 6}}
+	require.NoError(t, w.WriteSpan(follower))
+	// unlike a span following from a span of another trace
+	linked := testSpan(4, 7, sampledFlags, 0)
+	linked.References = []model.SpanRef{{RefType: model.FollowsFrom, TraceID: model.TraceID{Low: 1}, SpanID: 1}}
+	require.NoError(t, w.WriteSpan(linked))
+
+	waitForDecisions(t, metricsFactory, store, 5, 3)
+	assert.Equal(t, []uint64{1, 2, 7}, sortedIDs(store.spanIDs()))
+
+	root := testSpan(2, 4, sampledFlags, 0)
+	require.NoError(t, w.WriteSpan(root))
+	assert.Equal(t, []uint64{1, 2, 7}, sortedIDs(store.spanIDs()), "the late spans of an orphaned trace are dropped")
+
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 3, counters["tail-sampling.kept-spans|reason=sampled"])
+	assert.EqualValues(t, 3, counters["tail-sampling.orphan-spans"])
+	assert.EqualValues(t, 0, counters["tail-sampling.dropped-spans"])
+}
+
+func TestWriterFailures(t *testing.T) {
+	store := &recordingWriter{err: errors.New("storage error")}
+	metricsFactory := metrics.NewLocalFactory(0)
+	w := NewWriter(store, Options{Window: time.Hour}, zap.NewNop(), metricsFactory)
+	require.NoError(t, w.WriteSpan(testSpan(1, 1, sampledFlags, 0)), "the errors of held spans are not returned")
+	require.NoError(t, w.Close())
+	counters, _ := metricsFactory.Snapshot()
+	assert.EqualValues(t, 1, counters["tail-sampling.failed-writes"])
+}
@@ -0,0 +1,293 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tenancy
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/storage/dependencystore"
+	"github.com/uber/jaeger/storage/spanstore"
+)
+
+const (
+	// TenantTag is the span tag carrying the tenant of the spans written by the Writer returned by NewWriter
+	TenantTag = "tenant"
+	// Separator separates the tenant from the service name in the storage, tenants cannot contain it
+	Separator = "/"
+)
+
+var (
+	// ErrMissingTenant is returned by the Writer for the spans without a valid tenant
+	ErrMissingTenant = errors.New("span has no tenant")
+
+	// ErrStatsServiceNotSet is returned by the StatsReader for the statistics of all the services
+	ErrStatsServiceNotSet = errors.New("Service Name must be set to compute the statistics of a tenant")
+)
+
+// ValidTenant returns true for the non-empty tenants not containing the Separator
+func ValidTenant(tenant string) bool {
+	return tenant != "" && !strings.Contains(tenant, Separator)
+}
+
+// ServiceName returns the name the service of the tenant is stored with, so that all the storage keys and
+// indexes of the service, e.g. the service and operation names and the trace indexes, are scoped to the tenant
+func ServiceName(tenant, service string) string {
+	return tenant + Separator + service
+}
+
+// serviceOf returns the service of the tenant stored with the given name, and false if it belongs to another tenant
+func serviceOf(tenant, storedName string) (string, bool) {
+	prefix := tenant + Separator
+	if !strings.HasPrefix(storedName, prefix) {
+		return "", false
+	}
+	return storedName[len(prefix):], true
+}
+
+type writer struct {
+	writer spanstore.Writer
+	tenant string
+}
+
+// NewWriter returns a Writer storing the spans under the service names scoped to the tenant of their TenantTag,
+// the spans without a valid tenant are rejected with ErrMissingTenant.
+func NewWriter(spanWriter spanstore.Writer) spanstore.Writer {
+	return &writer{writer: spanWriter}
+}
+
+// NewTenantWriter returns a Writer storing all the spans under the service names scoped to the given tenant
+func NewTenantWriter(spanWriter spanstore.Writer, tenant string) spanstore.Writer {
+	return &writer{writer: spanWriter, tenant: tenant}
+}
+
+func (w *writer) WriteSpan(span *model.Span) error {
+	tenant := w.tenant
+	if tenant == "" {
+		if tag, ok := span.Tags.FindByKey(TenantTag); ok {
+			tenant = tag.AsString()
+		}
+	}
+	if !ValidTenant(tenant) || span.Process == nil {
+		return ErrMissingTenant
+	}
+	// the span and its process may be shared with other stages of the collector
+	scoped := *span
+	process := *span.Process
+	process.ServiceName = ServiceName(tenant, process.ServiceName)
+	scoped.Process = &process
+	return w.writer.WriteSpan(&scoped)
+}
+
+type reader struct {
+	reader spanstore.Reader
+	tenant string
+}
+
+// NewReader returns a Reader only returning the services and the spans of the tenant, under their own service names
+func NewReader(spanReader spanstore.Reader, tenant string) spanstore.Reader {
+	return &reader{reader: spanReader, tenant: tenant}
+}
+
+func (r *reader) GetTrace(traceID model.TraceID) (*model.Trace, error) {
+	trace, err := r.reader.GetTrace(traceID)
+	if err != nil {
+		return nil, err
+	}
+	if trace = r.scopeTrace(trace); trace == nil {
+		return nil, spanstore.ErrTraceNotFound
+	}
+	return trace, nil
+}
+
+func (r *reader) GetServices() ([]string, error) {
+	storedNames, err := r.reader.GetServices()
+	if err != nil {
+		return nil, err
+	}
+	var services []string
+	for _, storedName := range storedNames {
+		if service, ok := serviceOf(r.tenant, storedName); ok {
+			services = append(services, service)
+		}
+	}
+	return services, nil
+}
+
+func (r *reader) GetOperations(service string) ([]string, error) {
+	return r.reader.GetOperations(ServiceName(r.tenant, service))
+}
+
+func (r *reader) FindTraces(query *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
+	scopedQuery := *query
+	if query.ServiceName != "" {
+		scopedQuery.ServiceName = ServiceName(r.tenant, query.ServiceName)
+	}
+	traces, err := r.reader.FindTraces(&scopedQuery)
+	if err != nil {
+		return nil, err
+	}
+	scopedTraces := make([]*model.Trace, 0, len(traces))
+	for _, trace := range traces {
+		if trace = r.scopeTrace(trace); trace != nil {
+			scopedTraces = append(scopedTraces, trace)
+		}
+	}
+	return scopedTraces, nil
+}
+
+// scopeTrace returns a copy of the trace with only the spans of the tenant, or nil if it has none
+func (r *reader) scopeTrace(trace *model.Trace) *model.Trace {
+	var spans []*model.Span
+	processes := make(map[*model.Process]*model.Process)
+	for _, span := range trace.Spans {
+		if span.Process == nil {
+			continue
+		}
+		process, ok := processes[span.Process]
+		if !ok {
+			service, ok := serviceOf(r.tenant, span.Process.ServiceName)
+			if !ok {
+				continue
+			}
+			// the stored spans must not be modified, e.g. those of the memory store
+			copied := *span.Process
+			copied.ServiceName = service
+			process = &copied
+			processes[span.Process] = process
+		}
+		scoped := *span
+		scoped.Process = process
+		spans = append(spans, &scoped)
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+	return &model.Trace{Spans: spans, Warnings: trace.Warnings}
+}
+
+type statsReader struct {
+	reader spanstore.StatsReader
+	tenant string
+}
+
+// NewStatsReader returns a StatsReader of the spans of the services of the tenant. The statistics of all the
+// services are rejected with ErrStatsServiceNotSet, those of the other tenants being stored with them.
+func NewStatsReader(spanStatsReader spanstore.StatsReader, tenant string) spanstore.StatsReader {
+	return &statsReader{reader: spanStatsReader, tenant: tenant}
+}
+
+func (r *statsReader) GetTraceStats(query *spanstore.StatsQueryParameters) (*spanstore.TraceStats, error) {
+	if query.ServiceName == "" {
+		return nil, ErrStatsServiceNotSet
+	}
+	scopedQuery := *query
+	scopedQuery.ServiceName = ServiceName(r.tenant, query.ServiceName)
+	stats, err := r.reader.GetTraceStats(&scopedQuery)
+	if err != nil {
+		return nil, err
+	}
+	for i := range stats.Services {
+		if service, ok := serviceOf(r.tenant, stats.Services[i].ServiceName); ok {
+			stats.Services[i].ServiceName = service
+		}
+	}
+	return stats, nil
+}
+
+type durationReader struct {
+	reader spanstore.DurationReader
+	tenant string
+}
+
+// NewDurationReader returns a DurationReader of the percentiles of the operations of the services of the tenant
+func NewDurationReader(spanDurationReader spanstore.DurationReader, tenant string) spanstore.DurationReader {
+	return &durationReader{reader: spanDurationReader, tenant: tenant}
+}
+
+func (r *durationReader) GetDurationPercentiles(query *spanstore.DurationQueryParameters) (*spanstore.DurationPercentiles, error) {
+	scopedQuery := *query
+	if query.ServiceName != "" {
+		scopedQuery.ServiceName = ServiceName(r.tenant, query.ServiceName)
+	}
+	return r.reader.GetDurationPercentiles(&scopedQuery)
+}
+
+type deleter struct {
+	deleter spanstore.Deleter
+	reader  spanstore.Reader
+	tenant  string
+}
+
+// NewDeleter returns a Deleter of the spans of the services of the tenant only, listed by the unscoped spanReader
+func NewDeleter(spanDeleter spanstore.Deleter, spanReader spanstore.Reader, tenant string) spanstore.Deleter {
+	return &deleter{deleter: spanDeleter, reader: spanReader, tenant: tenant}
+}
+
+func (d *deleter) DeleteSpans(query *spanstore.DeleteQueryParameters) (int, error) {
+	if err := query.Validate(); err != nil {
+		return 0, err
+	}
+	storedNames, err := d.reader.GetServices()
+	if err != nil {
+		return 0, err
+	}
+	scopedQuery := *query
+	scopedQuery.ServiceNames = nil
+	for _, storedName := range storedNames {
+		if service, ok := serviceOf(d.tenant, storedName); ok && query.HasService(service) {
+			scopedQuery.ServiceNames = append(scopedQuery.ServiceNames, storedName)
+		}
+	}
+	// no services would mean all of them to the deleter
+	if len(scopedQuery.ServiceNames) == 0 {
+		return 0, nil
+	}
+	return d.deleter.DeleteSpans(&scopedQuery)
+}
+
+type dependencyReader struct {
+	reader dependencystore.Reader
+	tenant string
+}
+
+// NewDependencyReader returns a dependency Reader only returning the links between the services of the tenant
+func NewDependencyReader(depReader dependencystore.Reader, tenant string) dependencystore.Reader {
+	return &dependencyReader{reader: depReader, tenant: tenant}
+}
+
+func (r *dependencyReader) GetDependencies(endTs time.Time, lookback time.Duration) ([]model.DependencyLink, error) {
+	links, err := r.reader.GetDependencies(endTs, lookback)
+	if err != nil {
+		return nil, err
+	}
+	var scoped []model.DependencyLink
+	for _, link := range links {
+		parent, parentOk := serviceOf(r.tenant, link.Parent)
+		child, childOk := serviceOf(r.tenant, link.Child)
+		if parentOk && childOk {
+			scoped = append(scoped, model.DependencyLink{Parent: parent, Child: child, CallCount: link.CallCount})
+		}
+	}
+	return scoped, nil
+}
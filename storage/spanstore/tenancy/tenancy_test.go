@@ -0,0 +1,215 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tenancy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/storage/spanstore"
+	"github.com/uber/jaeger/storage/spanstore/memory"
+)
+
+func tenantSpan(tenant string, traceID, spanID, parentID uint64, service string) *model.Span {
+	span := &model.Span{
+		TraceID:       model.TraceID{Low: traceID},
+		SpanID:        model.SpanID(spanID),
+		ParentSpanID:  model.SpanID(parentID),
+		OperationName: "op",
+		StartTime:     time.Unix(10, 0),
+		Process:       &model.Process{ServiceName: service},
+	}
+	if tenant != "" {
+		span.Tags = model.KeyValues{model.String(TenantTag, tenant)}
+	}
+	return span
+}
+
+func TestValidTenant(t *testing.T) {
+	assert.True(t, ValidTenant("team-a"))
+	assert.False(t, ValidTenant(""))
+	assert.False(t, ValidTenant("team/a"))
+}
+
+func TestWriterAndReader(t *testing.T) {
+	store := memory.NewStore()
+	writer := NewWriter(store)
+	spans := []*model.Span{
+		tenantSpan("a", 1, 1, 0, "frontend"),
+		tenantSpan("a", 1, 2, 1, "backend"),
+		tenantSpan("b", 1, 3, 2, "database"),
+		tenantSpan("b", 2, 1, 0, "frontend"),
+	}
+	for _, span := range spans {
+		require.NoError(t, writer.WriteSpan(span))
+	}
+	assert.Equal(t, "frontend", spans[0].Process.ServiceName, "the written span is not modified")
+	assert.Equal(t, ErrMissingTenant, writer.WriteSpan(tenantSpan("", 3, 1, 0, "frontend")))
+	assert.Equal(t, ErrMissingTenant, writer.WriteSpan(tenantSpan("a/b", 3, 1, 0, "frontend")))
+
+	storedServices, err := store.GetServices()
+	require.NoError(t, err)
+	assert.Len(t, storedServices, 4)
+
+	reader := NewReader(store, "a")
+	services, err := reader.GetServices()
+	require.NoError(t, err)
+	assert.Len(t, services, 2)
+	assert.Contains(t, services, "frontend")
+	assert.Contains(t, services, "backend")
+
+	operations, err := reader.GetOperations("backend")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"op"}, operations)
+
+	trace, err := reader.GetTrace(model.TraceID{Low: 1})
+	require.NoError(t, err)
+	require.Len(t, trace.Spans, 2, "the spans of other tenants are left out")
+	for _, span := range trace.Spans {
+		assert.NotEqual(t, "database", span.Process.ServiceName)
+	}
+	_, err = reader.GetTrace(model.TraceID{Low: 2})
+	assert.Equal(t, spanstore.ErrTraceNotFound, err)
+
+	traces, err := reader.FindTraces(&spanstore.TraceQueryParameters{ServiceName: "frontend", NumTraces: 10})
+	require.NoError(t, err)
+	require.Len(t, traces, 1)
+	assert.Equal(t, model.TraceID{Low: 1}, traces[0].Spans[0].TraceID)
+
+	stored, err := store.GetTrace(model.TraceID{Low: 1})
+	require.NoError(t, err)
+	assert.Equal(t, ServiceName("a", "frontend"), stored.Spans[0].Process.ServiceName, "the stored spans are not modified")
+}
+
+func TestTenantWriter(t *testing.T) {
+	store := memory.NewStore()
+	require.NoError(t, NewTenantWriter(store, "a").WriteSpan(tenantSpan("", 1, 1, 0, "frontend")))
+	services, err := store.GetServices()
+	require.NoError(t, err)
+	assert.Equal(t, []string{ServiceName("a", "frontend")}, services)
+}
+
+func TestDependencyReader(t *testing.T) {
+	store := memory.NewStore()
+	writer := NewWriter(store)
+	for _, span := range []*model.Span{
+		tenantSpan("a", 1, 1, 0, "frontend"),
+		tenantSpan("a", 1, 2, 1, "backend"),
+		tenantSpan("b", 1, 3, 2, "database"),
+	} {
+		require.NoError(t, writer.WriteSpan(span))
+	}
+	links, err := NewDependencyReader(store, "a").GetDependencies(time.Unix(20, 0), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []model.DependencyLink{{Parent: "frontend", Child: "backend", CallCount: 1}}, links)
+}
+
+func TestStatsReader(t *testing.T) {
+	store := memory.NewStore()
+	writer := NewWriter(store)
+	for _, span := range []*model.Span{
+		tenantSpan("a", 1, 1, 0, "frontend"),
+		tenantSpan("a", 1, 2, 1, "backend"),
+		tenantSpan("b", 2, 1, 0, "frontend"),
+	} {
+		require.NoError(t, writer.WriteSpan(span))
+	}
+	statsReader := NewStatsReader(store, "a")
+	query := &spanstore.StatsQueryParameters{StartTimeMin: time.Unix(0, 0), StartTimeMax: time.Unix(20, 0)}
+	_, err := statsReader.GetTraceStats(query)
+	assert.Equal(t, ErrStatsServiceNotSet, err)
+
+	query.ServiceName = "frontend"
+	stats, err := statsReader.GetTraceStats(query)
+	require.NoError(t, err)
+	assert.Equal(t, &spanstore.TraceStats{
+		Traces:   1,
+		Spans:    1,
+		Services: []spanstore.ServiceStats{{ServiceName: "frontend", Spans: 1}},
+	}, stats)
+	assert.Equal(t, "frontend", query.ServiceName)
+}
+
+func TestDurationReader(t *testing.T) {
+	store := memory.NewStore()
+	writer := NewWriter(store)
+	for i, span := range []*model.Span{
+		tenantSpan("a", 1, 1, 0, "frontend"),
+		tenantSpan("a", 2, 1, 0, "frontend"),
+		tenantSpan("b", 3, 1, 0, "frontend"),
+	} {
+		span.Duration = time.Duration(i+1) * time.Second
+		require.NoError(t, writer.WriteSpan(span))
+	}
+	durationReader := NewDurationReader(spanstore.NewSampledDurationReader(store), "a")
+	query := &spanstore.DurationQueryParameters{
+		ServiceName:   "frontend",
+		OperationName: "op",
+		StartTimeMin:  time.Unix(0, 0),
+		StartTimeMax:  time.Unix(20, 0),
+	}
+	percentiles, err := durationReader.GetDurationPercentiles(query)
+	require.NoError(t, err)
+	assert.Equal(t, &spanstore.DurationPercentiles{Spans: 2, P50: time.Second, P90: 2 * time.Second, P99: 2 * time.Second}, percentiles)
+	assert.Equal(t, "frontend", query.ServiceName)
+}
+
+func TestDeleter(t *testing.T) {
+	store := memory.NewStore()
+	writer := NewWriter(store)
+	for _, span := range []*model.Span{
+		tenantSpan("a", 1, 1, 0, "frontend"),
+		tenantSpan("a", 1, 2, 1, "backend"),
+		tenantSpan("b", 2, 1, 0, "frontend"),
+	} {
+		span.Tags = append(span.Tags, model.String("user.id", "x"))
+		require.NoError(t, writer.WriteSpan(span))
+	}
+	query := &spanstore.DeleteQueryParameters{
+		Tags:         map[string]string{"user.id": "x"},
+		StartTimeMin: time.Unix(0, 0),
+		StartTimeMax: time.Unix(20, 0),
+		ServiceNames: []string{"frontend"},
+	}
+	deleted, err := NewDeleter(store, store, "a").DeleteSpans(query)
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	assert.Equal(t, []string{"frontend"}, query.ServiceNames)
+
+	query.ServiceNames = nil
+	deleted, err = NewDeleter(store, store, "c").DeleteSpans(query)
+	require.NoError(t, err)
+	assert.Equal(t, 0, deleted)
+
+	_, err = NewDeleter(store, store, "a").DeleteSpans(&spanstore.DeleteQueryParameters{})
+	assert.Equal(t, spanstore.ErrDeleteTagsNotSet, err)
+
+	trace, err := NewReader(store, "a").GetTrace(model.TraceID{Low: 1})
+	require.NoError(t, err)
+	require.Len(t, trace.Spans, 1)
+	assert.Equal(t, "backend", trace.Spans[0].Process.ServiceName)
+	_, err = NewReader(store, "b").GetTrace(model.TraceID{Low: 2})
+	assert.NoError(t, err)
+}
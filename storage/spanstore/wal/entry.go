@@ -0,0 +1,69 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	// EntryHeaderSize is the size of the payload length and checksum preceding each entry
+	EntryHeaderSize = 8
+	// maxEntrySize guards against allocating a corrupted length, spans are much smaller
+	maxEntrySize = 64 << 20
+)
+
+// ErrCorruptedEntry is returned by ReadEntry for a truncated entry, or one whose length or checksum is invalid
+var ErrCorruptedEntry = errors.New("corrupted entry")
+
+// AppendEntry appends to buf the entry holding the payload, preceded by its length and checksum
+func AppendEntry(buf, payload []byte) []byte {
+	var header [EntryHeaderSize]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(payload)))
+	binary.BigEndian.PutUint32(header[4:], crc32.ChecksumIEEE(payload))
+	return append(append(buf, header[:]...), payload...)
+}
+
+// ReadEntry returns the payload of the next entry written by AppendEntry, io.EOF at the end of the reader
+func ReadEntry(reader io.Reader) ([]byte, error) {
+	var header [EntryHeaderSize]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, ErrCorruptedEntry
+		}
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:])
+	if length > maxEntrySize {
+		return nil, ErrCorruptedEntry
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, ErrCorruptedEntry
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, ErrCorruptedEntry
+	}
+	return payload, nil
+}
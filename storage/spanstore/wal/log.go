@@ -0,0 +1,404 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package wal provides a write-ahead log recording spans until they are saved to storage, so that the spans
+// accepted by a collector that crashed are saved when it starts again.
+package wal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+	"github.com/uber/jaeger/model/codec"
+)
+
+const (
+	// DefaultSegmentSize is the size in bytes beyond which a new segment is started, if not configured
+	DefaultSegmentSize = 64 << 20
+
+	segmentExtension = ".wal"
+)
+
+var (
+	// ErrFull is returned by Append when the log reached its maximum size
+	ErrFull = errors.New("The write-ahead log is full")
+
+	// ErrClosed is returned by Append once the log is closed
+	ErrClosed = errors.New("The write-ahead log is closed")
+)
+
+// Options configure a Log
+type Options struct {
+	// Directory holds the segment files, it is created if missing
+	Directory string
+	// SegmentSize is the size in bytes beyond which a new segment is started, DefaultSegmentSize if zero
+	SegmentSize int64
+	// MaxSize caps the total size in bytes of the segments, unlimited if zero
+	MaxSize int64
+	// SyncWrites flushes each span to disk before Append returns, so that spans survive a crash of the
+	// host and not only of the collector, at the cost of a slower Append
+	SyncWrites bool
+}
+
+type logMetrics struct {
+	// Size is the total size of the segments in bytes
+	Size metrics.Gauge `metric:"size-bytes"`
+	// Segments is the number of segment files
+	Segments metrics.Gauge `metric:"segments"`
+	// Appended counts the spans recorded in the log
+	Appended metrics.Counter `metric:"appended-spans"`
+	// Rejected counts the spans that could not be recorded because the log was full or failed to write
+	Rejected metrics.Counter `metric:"rejected-spans"`
+	// Replayed counts the spans recovered from a previous run and saved
+	Replayed metrics.Counter `metric:"replayed-spans"`
+	// ReplayFailures counts the spans recovered from a previous run that failed to be saved
+	ReplayFailures metrics.Counter `metric:"replay-failures"`
+	// Corrupted counts the entries that could not be read back, usually the last one written before a crash
+	Corrupted metrics.Counter `metric:"corrupted-entries"`
+}
+
+// segment is a file of the log, removed once all of its spans are committed and it is no longer appended to
+type segment struct {
+	id      uint64
+	file    *os.File
+	size    int64
+	pending int
+}
+
+// Log records spans in segment files until they are committed, which happens once they are saved to storage.
+// The segments left by a previous run hold the spans that were never committed, they are saved by Replay.
+// Spans are committed individually but removed from disk a segment at a time, so replaying may save
+// again spans that were already saved: delivery is at least once.
+type Log struct {
+	sync.Mutex
+	options    Options
+	logger     *zap.Logger
+	metrics    logMetrics
+	serializer *codec.Serializer
+	active     *segment
+	segments   map[uint64]*segment
+	// recovered are the IDs of the segments left by a previous run, in the order they were written
+	recovered []uint64
+	size      int64
+	nextID    uint64
+	closed    bool
+}
+
+// Open creates a Log in the directory, keeping the segments found there for Replay
+func Open(options Options, logger *zap.Logger, metricsFactory metrics.Factory) (*Log, error) {
+	if options.SegmentSize <= 0 {
+		options.SegmentSize = DefaultSegmentSize
+	}
+	if err := os.MkdirAll(options.Directory, 0755); err != nil {
+		return nil, err
+	}
+	l := &Log{
+		options:  options,
+		logger:   logger,
+		segments: make(map[uint64]*segment),
+		nextID:   1,
+	}
+	walFactory := metricsFactory.Namespace("wal", nil)
+	metrics.Init(&l.metrics, walFactory, nil)
+	l.serializer = codec.NewSerializer(walFactory)
+	if err := l.recover(); err != nil {
+		return nil, err
+	}
+	l.Lock()
+	defer l.Unlock()
+	if err := l.startSegment(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// recover lists the segments of a previous run
+func (l *Log) recover() error {
+	files, err := ioutil.ReadDir(l.options.Directory)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		id, ok := segmentID(file.Name())
+		if !ok || file.IsDir() {
+			continue
+		}
+		l.recovered = append(l.recovered, id)
+		l.size += file.Size()
+		if id >= l.nextID {
+			l.nextID = id + 1
+		}
+	}
+	sort.Sort(segmentIDs(l.recovered))
+	if len(l.recovered) > 0 {
+		l.logger.Info("Found spans of a previous run in the write-ahead log",
+			zap.Int("segments", len(l.recovered)),
+			zap.Int64("size", l.size))
+	}
+	l.updateSizeMetrics()
+	return nil
+}
+
+// Append records the span, the returned function commits it once the span is saved or discarded
+func (l *Log) Append(span *model.Span) (func(), error) {
+	payload, err := l.serializer.Serialize(codec.ProtobufFormat, span)
+	if err != nil {
+		l.metrics.Rejected.Inc(1)
+		return nil, err
+	}
+	entry := AppendEntry(make([]byte, 0, EntryHeaderSize+len(payload)), payload)
+
+	l.Lock()
+	defer l.Unlock()
+	if l.closed {
+		return nil, ErrClosed
+	}
+	if l.options.MaxSize > 0 && l.size+int64(len(entry)) > l.options.MaxSize {
+		l.metrics.Rejected.Inc(1)
+		return nil, ErrFull
+	}
+	if l.active != nil && l.active.size >= l.options.SegmentSize {
+		l.sealActive()
+	}
+	if l.active == nil {
+		if err := l.startSegment(); err != nil {
+			l.metrics.Rejected.Inc(1)
+			return nil, err
+		}
+	}
+	seg := l.active
+	n, err := seg.file.Write(entry)
+	seg.size += int64(n)
+	l.size += int64(n)
+	if err == nil && l.options.SyncWrites {
+		err = seg.file.Sync()
+	}
+	if err != nil {
+		// the partial entry is skipped as corrupted if the segment is ever replayed
+		l.metrics.Rejected.Inc(1)
+		return nil, err
+	}
+	seg.pending++
+	l.metrics.Appended.Inc(1)
+	l.updateSizeMetrics()
+	var once sync.Once
+	return func() {
+		once.Do(func() { l.commit(seg) })
+	}, nil
+}
+
+func (l *Log) commit(seg *segment) {
+	l.Lock()
+	defer l.Unlock()
+	seg.pending--
+	if seg != l.active && seg.pending == 0 {
+		l.removeSegment(seg)
+	}
+}
+
+// startSegment creates a new active segment
+func (l *Log) startSegment() error {
+	id := l.nextID
+	file, err := os.OpenFile(l.segmentPath(id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	l.nextID++
+	l.active = &segment{id: id, file: file}
+	l.segments[id] = l.active
+	l.updateSizeMetrics()
+	return nil
+}
+
+// sealActive stops appending to the active segment, removing it if all of its spans are committed
+func (l *Log) sealActive() {
+	seg := l.active
+	l.active = nil
+	if err := seg.file.Close(); err != nil {
+		l.logger.Error("Failed to close write-ahead log segment", zap.Uint64("segment", seg.id), zap.Error(err))
+	}
+	if seg.pending == 0 {
+		l.removeSegment(seg)
+	}
+}
+
+func (l *Log) removeSegment(seg *segment) {
+	delete(l.segments, seg.id)
+	l.removeFile(seg.id, seg.size)
+}
+
+func (l *Log) removeFile(id uint64, size int64) {
+	if err := os.Remove(l.segmentPath(id)); err != nil {
+		l.logger.Error("Failed to remove write-ahead log segment", zap.Uint64("segment", id), zap.Error(err))
+		return
+	}
+	l.size -= size
+	l.updateSizeMetrics()
+}
+
+// Replay saves the spans left by a previous run until stop is closed, removing each segment once all of
+// its spans are saved. The segments with spans that failed to be saved, or that were not replayed before
+// stop was closed, are kept for the next run. The failures are logged and counted, and the entries that
+// cannot be read are skipped.
+func (l *Log) Replay(save func(*model.Span) error, stop <-chan struct{}) error {
+	l.Lock()
+	recovered := append([]uint64(nil), l.recovered...)
+	l.Unlock()
+	replayed := 0
+	for _, id := range recovered {
+		size, n, complete, err := l.replaySegment(id, save, stop)
+		replayed += n
+		if err != nil {
+			return err
+		}
+		if !complete {
+			continue
+		}
+		l.Lock()
+		l.forgetRecovered(id)
+		l.removeFile(id, size)
+		l.Unlock()
+	}
+	if replayed > 0 {
+		l.logger.Info("Replayed the write-ahead log", zap.Int("spans", replayed))
+	}
+	return nil
+}
+
+// replaySegment saves the spans of the segment until stop is closed, returning the size of the file,
+// the number of spans saved and whether all of them were
+func (l *Log) replaySegment(id uint64, save func(*model.Span) error, stop <-chan struct{}) (int64, int, bool, error) {
+	file, err := os.Open(l.segmentPath(id))
+	if err != nil {
+		return 0, 0, false, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, 0, false, err
+	}
+	reader := bufio.NewReader(file)
+	replayed := 0
+	complete := true
+	for {
+		select {
+		case <-stop:
+			return info.Size(), replayed, false, nil
+		default:
+		}
+		payload, err := ReadEntry(reader)
+		if err == io.EOF {
+			return info.Size(), replayed, complete, nil
+		}
+		if err != nil {
+			// nothing after a torn entry can be framed, it is usually the last one written before a crash
+			l.metrics.Corrupted.Inc(1)
+			l.logger.Warn("Skipping the rest of a corrupted write-ahead log segment", zap.Uint64("segment", id), zap.Error(err))
+			return info.Size(), replayed, complete, nil
+		}
+		span, err := l.serializer.Deserialize(payload)
+		if err != nil {
+			l.metrics.Corrupted.Inc(1)
+			l.logger.Warn("Skipping a write-ahead log entry that cannot be deserialized", zap.Uint64("segment", id), zap.Error(err))
+			continue
+		}
+		if err := save(span); err != nil {
+			l.metrics.ReplayFailures.Inc(1)
+			l.logger.Error("Failed to save a span of the write-ahead log", zap.Error(err))
+			complete = false
+			continue
+		}
+		l.metrics.Replayed.Inc(1)
+		replayed++
+	}
+}
+
+// forgetRecovered removes the segment from the ones left by a previous run
+func (l *Log) forgetRecovered(id uint64) {
+	for i, recovered := range l.recovered {
+		if recovered == id {
+			l.recovered = append(l.recovered[:i], l.recovered[i+1:]...)
+			return
+		}
+	}
+}
+
+// Size returns the total size of the segments in bytes
+func (l *Log) Size() int64 {
+	l.Lock()
+	defer l.Unlock()
+	return l.size
+}
+
+// Close stops appending to the log. The segments holding uncommitted spans are kept for the next run.
+func (l *Log) Close() error {
+	l.Lock()
+	defer l.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	seg := l.active
+	if seg == nil {
+		return nil
+	}
+	l.active = nil
+	err := seg.file.Close()
+	if seg.pending == 0 {
+		l.removeSegment(seg)
+	}
+	return err
+}
+
+func (l *Log) updateSizeMetrics() {
+	l.metrics.Size.Update(l.size)
+	l.metrics.Segments.Update(int64(len(l.segments) + len(l.recovered)))
+}
+
+func (l *Log) segmentPath(id uint64) string {
+	return filepath.Join(l.options.Directory, fmt.Sprintf("%020d%s", id, segmentExtension))
+}
+
+func segmentID(name string) (uint64, bool) {
+	if !strings.HasSuffix(name, segmentExtension) {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExtension), 10, 64)
+	return id, err == nil
+}
+
+type segmentIDs []uint64
+
+func (ids segmentIDs) Len() int           { return len(ids) }
+func (ids segmentIDs) Less(i, j int) bool { return ids[i] < ids[j] }
+func (ids segmentIDs) Swap(i, j int)      { ids[i], ids[j] = ids[j], ids[i] }
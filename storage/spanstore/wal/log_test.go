@@ -0,0 +1,237 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package wal
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-lib/metrics"
+	"go.uber.org/zap"
+
+	"github.com/uber/jaeger/model"
+)
+
+func withLogDirectory(t *testing.T, fn func(directory string)) {
+	directory, err := ioutil.TempDir("", "jaeger-wal")
+	require.NoError(t, err)
+	defer os.RemoveAll(directory)
+	fn(directory)
+}
+
+func testSpan(operationName string) *model.Span {
+	return &model.Span{
+		TraceID:       model.TraceID{Low: 1},
+		SpanID:        model.SpanID(2),
+		OperationName: operationName,
+		Process:       &model.Process{ServiceName: "service-a"},
+	}
+}
+
+func segmentFiles(t *testing.T, directory string) []string {
+	files, err := filepath.Glob(filepath.Join(directory, "*"+segmentExtension))
+	require.NoError(t, err)
+	for i, file := range files {
+		files[i] = filepath.Base(file)
+	}
+	return files
+}
+
+func replayedOperations(t *testing.T, l *Log) []string {
+	var operations []string
+	require.NoError(t, l.Replay(func(span *model.Span) error {
+		operations = append(operations, span.OperationName)
+		return nil
+	}, nil))
+	return operations
+}
+
+func TestLogCommitRemovesSegments(t *testing.T) {
+	withLogDirectory(t, func(directory string) {
+		metricsFactory := metrics.NewLocalFactory(0)
+		l, err := Open(Options{Directory: directory, SegmentSize: 1}, zap.NewNop(), metricsFactory)
+		require.NoError(t, err)
+		commits := make([]func(), 3)
+		for i := range commits {
+			commits[i], err = l.Append(testSpan("op"))
+			require.NoError(t, err)
+		}
+		// each span fills a segment
+		assert.Equal(t, []string{
+			"00000000000000000001.wal",
+			"00000000000000000002.wal",
+			"00000000000000000003.wal",
+		}, segmentFiles(t, directory))
+
+		commits[1]()
+		commits[1]()
+		assert.Equal(t, []string{"00000000000000000001.wal", "00000000000000000003.wal"}, segmentFiles(t, directory))
+		commits[2]()
+		assert.Len(t, segmentFiles(t, directory), 2, "the active segment is kept")
+
+		size := l.Size()
+		assert.True(t, size > 0)
+		require.NoError(t, l.Close())
+		assert.Equal(t, []string{"00000000000000000001.wal"}, segmentFiles(t, directory))
+		assert.Equal(t, size/2, l.Size())
+		_, err = l.Append(testSpan("op"))
+		assert.Equal(t, ErrClosed, err)
+
+		_, gauges := metricsFactory.Snapshot()
+		assert.EqualValues(t, 1, gauges["wal.segments"])
+		assert.EqualValues(t, size/2, gauges["wal.size-bytes"])
+	})
+}
+
+func TestLogReplay(t *testing.T) {
+	withLogDirectory(t, func(directory string) {
+		l, err := Open(Options{Directory: directory}, zap.NewNop(), metrics.NullFactory)
+		require.NoError(t, err)
+		commit, err := l.Append(testSpan("saved"))
+		require.NoError(t, err)
+		commit()
+		_, err = l.Append(testSpan("lost"))
+		require.NoError(t, err)
+		require.NoError(t, l.Close())
+
+		metricsFactory := metrics.NewLocalFactory(0)
+		l, err = Open(Options{Directory: directory, SyncWrites: true}, zap.NewNop(), metricsFactory)
+		require.NoError(t, err)
+		_, err = l.Append(testSpan("new"))
+		require.NoError(t, err)
+		// the segment is removed once all of its spans are committed, so the saved span is replayed too
+		assert.Equal(t, []string{"saved", "lost"}, replayedOperations(t, l))
+		assert.Equal(t, []string{"00000000000000000002.wal"}, segmentFiles(t, directory))
+		assert.Empty(t, replayedOperations(t, l))
+		require.NoError(t, l.Close())
+
+		counts, gauges := metricsFactory.Snapshot()
+		assert.EqualValues(t, 2, counts["wal.replayed-spans"])
+		assert.EqualValues(t, 1, counts["wal.appended-spans"])
+		assert.EqualValues(t, 1, gauges["wal.segments"])
+
+		l, err = Open(Options{Directory: directory}, zap.NewNop(), metrics.NullFactory)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"new"}, replayedOperations(t, l))
+		require.NoError(t, l.Close())
+		assert.Empty(t, segmentFiles(t, directory))
+	})
+}
+
+func TestLogReplayFailures(t *testing.T) {
+	withLogDirectory(t, func(directory string) {
+		l, err := Open(Options{Directory: directory}, zap.NewNop(), metrics.NullFactory)
+		require.NoError(t, err)
+		for _, operation := range []string{"a", "b", "c"} {
+			_, err = l.Append(testSpan(operation))
+			require.NoError(t, err)
+		}
+		require.NoError(t, l.Close())
+		// a torn entry left by a crash while appending
+		file, err := os.OpenFile(filepath.Join(directory, "00000000000000000001.wal"), os.O_APPEND|os.O_WRONLY, 0644)
+		require.NoError(t, err)
+		_, err = file.Write([]byte{0, 0, 0, 42, 1, 2})
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		metricsFactory := metrics.NewLocalFactory(0)
+		l, err = Open(Options{Directory: directory}, zap.NewNop(), metricsFactory)
+		require.NoError(t, err)
+		var saved []string
+		err = l.Replay(func(span *model.Span) error {
+			if span.OperationName == "b" {
+				return errors.New("storage failure")
+			}
+			saved = append(saved, span.OperationName)
+			return nil
+		}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "c"}, saved)
+		assert.Contains(t, segmentFiles(t, directory), "00000000000000000001.wal", "the segment is kept for the next run")
+		assert.Equal(t, []string{"a", "b", "c"}, replayedOperations(t, l))
+		assert.NotContains(t, segmentFiles(t, directory), "00000000000000000001.wal")
+		require.NoError(t, l.Close())
+
+		counts, _ := metricsFactory.Snapshot()
+		assert.EqualValues(t, 5, counts["wal.replayed-spans"])
+		assert.EqualValues(t, 1, counts["wal.replay-failures"])
+		assert.EqualValues(t, 2, counts["wal.corrupted-entries"])
+	})
+}
+
+func TestLogReplayStopped(t *testing.T) {
+	withLogDirectory(t, func(directory string) {
+		l, err := Open(Options{Directory: directory}, zap.NewNop(), metrics.NullFactory)
+		require.NoError(t, err)
+		_, err = l.Append(testSpan("lost"))
+		require.NoError(t, err)
+		require.NoError(t, l.Close())
+
+		l, err = Open(Options{Directory: directory}, zap.NewNop(), metrics.NullFactory)
+		require.NoError(t, err)
+		stop := make(chan struct{})
+		close(stop)
+		require.NoError(t, l.Replay(func(span *model.Span) error {
+			t.Fatal("no span is replayed once stopped")
+			return nil
+		}, stop))
+		assert.Equal(t, []string{"lost"}, replayedOperations(t, l), "the segment is kept")
+		require.NoError(t, l.Close())
+	})
+}
+
+func TestLogMaxSize(t *testing.T) {
+	withLogDirectory(t, func(directory string) {
+		metricsFactory := metrics.NewLocalFactory(0)
+		l, err := Open(Options{Directory: directory, MaxSize: 100}, zap.NewNop(), metricsFactory)
+		require.NoError(t, err)
+		defer l.Close()
+		commit, err := l.Append(testSpan("op"))
+		require.NoError(t, err)
+		for err == nil {
+			_, err = l.Append(testSpan("op"))
+		}
+		assert.Equal(t, ErrFull, err)
+		assert.True(t, l.Size() <= 100)
+
+		// committing does not free the active segment
+		commit()
+		_, err = l.Append(testSpan("op"))
+		assert.Equal(t, ErrFull, err)
+
+		counts, _ := metricsFactory.Snapshot()
+		assert.EqualValues(t, 2, counts["wal.rejected-spans"])
+	})
+}
+
+func TestOpenInvalidDirectory(t *testing.T) {
+	withLogDirectory(t, func(directory string) {
+		file := filepath.Join(directory, "file")
+		require.NoError(t, ioutil.WriteFile(file, nil, 0644))
+		_, err := Open(Options{Directory: file}, zap.NewNop(), metrics.NullFactory)
+		assert.Error(t, err)
+	})
+}